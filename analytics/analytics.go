@@ -1,10 +1,18 @@
 package analytics
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"qr-menu/db"
 	"qr-menu/logger"
+	"qr-menu/pkg/anonymize"
+	"qr-menu/pkg/geoip"
+	"qr-menu/pkg/metrics"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -12,10 +20,67 @@ import (
 
 // Analytics rappresenta il sistema di analisi
 type Analytics struct {
-	mu    sync.RWMutex
-	stats map[string]*RestaurantStats
+	mu      sync.RWMutex
+	stats   map[string]*RestaurantStats
+	sink    EventSink      // Destinazione degli eventi grezzi (nil = solo aggregati)
+	pending sync.WaitGroup // Salvataggi in background non ancora completati
+	geo     GeoResolver    // Geolocalizzazione degli IP (nil = paese e città sconosciuti)
+
+	anonymizer *anonymize.Anonymizer // Anonimizzazione di IP e User-Agent salvati (nil = valori completi)
+
+	salt    []byte // Sale giornaliero delle impronte dei visitatori senza cookie, solo in memoria
+	saltDay string // Giorno ("2006-01-02") a cui appartiene salt
 }
 
+// Tipi di evento grezzo
+const (
+	EventView  = "view"
+	EventShare = "share"
+	EventScan  = "scan"
+)
+
+// Origini di una scansione: il QR code stampato, un tag NFC sul tavolo o un link breve
+const (
+	ScanSourceQR   = "qr"
+	ScanSourceNFC  = "nfc"
+	ScanSourceLink = "link"
+)
+
+// RawEvent è un singolo evento (visualizzazione, condivisione o scansione QR) così come
+// è avvenuto, conservato per interrogazioni ed export verso strumenti di BI esterni
+type RawEvent struct {
+	Type         string
+	RestaurantID string
+	MenuID       string
+	ItemID       string
+	Timestamp    time.Time
+	UserIP       string
+	UserAgent    string
+	DeviceType   string
+	Browser      string
+	OS           string
+	Country      string
+	City         string
+	Referrer     string
+	SessionID    string
+	Platform     string // Solo per le condivisioni
+	Source       string // Solo per le scansioni: qr, nfc o link
+	LinkSource   string // Solo per i link brevi: origine del link (es. volantino)
+	Campaign     string // Solo per i link brevi
+	UTMSource    string // Solo per le visualizzazioni arrivate con parametri UTM
+	UTMMedium    string
+	UTMCampaign  string
+}
+
+// GeoResolver risolve l'IP di un visitatore in paese e città. Non restituisce errori:
+// se la posizione non è determinabile la Location è vuota
+type GeoResolver interface {
+	Locate(ip string) geoip.Location
+}
+
+// EventSink persiste un evento grezzo (es. nella collection analytics_events di MongoDB)
+type EventSink func(ctx context.Context, event RawEvent) error
+
 // RestaurantStats contiene le statistiche di un ristorante
 type RestaurantStats struct {
 	RestaurantID     string         `json:"restaurant_id"`
@@ -27,11 +92,36 @@ type RestaurantStats struct {
 	OperatingSystems map[string]int `json:"operating_systems"`
 	Browsers         map[string]int `json:"browsers"`
 	Countries        map[string]int `json:"countries"`
+	Cities           map[string]int `json:"cities,omitempty"` // Chiave "Città, PAESE", es. "Rome, IT"
 	MenuViews        map[string]int `json:"menu_views"`
 	PopularItems     []PopularItem  `json:"popular_items"`
 	ShareStats       ShareStats     `json:"share_stats"`
 	QRCodeScans      map[string]int `json:"qr_code_scans"`
+	NFCScans         map[string]int `json:"nfc_scans,omitempty"`      // Aperture dai tag NFC per giorno, escluse da QRCodeScans
+	LinkClicks       map[string]int `json:"link_clicks,omitempty"`    // Aperture dai link brevi per giorno, escluse da QRCodeScans
+	LinkSources      map[string]int `json:"link_sources,omitempty"`   // Aperture dai link brevi per origine del link
+	LinkCampaigns    map[string]int `json:"link_campaigns,omitempty"` // Aperture dai link brevi per campagna
+	CampaignViews    map[string]int `json:"campaign_views,omitempty"` // Viste per parametri UTM, chiave "sorgente|mezzo|campagna"
 	LastUpdated      time.Time      `json:"last_updated"`
+
+	// Conteggi giornalieri più vecchi della retention, compattati per mese ("2006-01") da Compact
+	MonthlyViews      map[string]int `json:"monthly_views,omitempty"`
+	MonthlyQRScans    map[string]int `json:"monthly_qr_scans,omitempty"`
+	MonthlyNFCScans   map[string]int `json:"monthly_nfc_scans,omitempty"`
+	MonthlyLinkClicks map[string]int `json:"monthly_link_clicks,omitempty"`
+
+	// Visitatori unici per giorno ("2006-01-02"), settimana ISO ("2006-W01") e mese ("2006-01")
+	DailyUniques   map[string]int            `json:"daily_uniques,omitempty"`
+	WeeklyUniques  map[string]int            `json:"weekly_uniques,omitempty"`
+	MonthlyUniques map[string]int            `json:"monthly_uniques,omitempty"`
+	Visitors       map[string]*VisitorPeriod `json:"visitors,omitempty"` // Periodi correnti: "day", "week", "month"
+}
+
+// VisitorPeriod contiene gli identificativi anonimi (hash) dei visitatori già contati nel
+// periodo corrente. Viene azzerato all'inizio di ogni nuovo periodo
+type VisitorPeriod struct {
+	Key string          `json:"key"`
+	IDs map[string]bool `json:"ids"`
 }
 
 // PopularItem rappresenta un piatto popolare
@@ -65,8 +155,20 @@ type ViewEvent struct {
 	Browser      string    `json:"browser"`
 	OS           string    `json:"os"`
 	Country      string    `json:"country"`
+	City         string    `json:"city,omitempty"`
 	Referrer     string    `json:"referrer"`
 	SessionID    string    `json:"session_id"`
+	VisitorID    string    `json:"visitor_id,omitempty"` // Cookie first-party del visitatore, se presente
+
+	// Parametri UTM dell'indirizzo del menu (utm_source, utm_medium, utm_campaign), per
+	// confrontare il traffico di campagne e canali diversi (es. Instagram e QR sul tavolo)
+	UTMSource   string `json:"utm_source,omitempty"`
+	UTMMedium   string `json:"utm_medium,omitempty"`
+	UTMCampaign string `json:"utm_campaign,omitempty"`
+
+	// Il visitatore non ha dato il consenso (o chiede di non essere tracciato con DNT/GPC):
+	// vengono aggiornati solo i conteggi delle viste, senza IP, User-Agent, posizione né visitatori unici
+	AggregateOnly bool `json:"aggregate_only,omitempty"`
 }
 
 // ShareEvent rappresenta un evento di condivisione
@@ -79,10 +181,14 @@ type ShareEvent struct {
 	UserAgent    string    `json:"user_agent"`
 }
 
-// QRScanEvent rappresenta una scansione QR
+// QRScanEvent rappresenta una scansione del QR code o l'apertura del menu da un tag NFC o
+// da un link breve
 type QRScanEvent struct {
 	RestaurantID string    `json:"restaurant_id"`
 	MenuID       string    `json:"menu_id"`
+	Source       string    `json:"source,omitempty"`      // qr (default), nfc o link
+	LinkSource   string    `json:"link_source,omitempty"` // Solo per i link brevi
+	Campaign     string    `json:"campaign,omitempty"`    // Solo per i link brevi
 	Timestamp    time.Time `json:"timestamp"`
 	UserIP       string    `json:"user_ip"`
 	UserAgent    string    `json:"user_agent"`
@@ -105,27 +211,107 @@ func GetAnalytics() *Analytics {
 	return globalAnalytics
 }
 
-// TrackView registra una visualizzazione pagina
-func (a *Analytics) TrackView(event ViewEvent) {
+// SetEventSink imposta la destinazione degli eventi grezzi
+func (a *Analytics) SetEventSink(sink EventSink) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
+	a.sink = sink
+}
 
-	// Inizializza stats se non esistono
-	if a.stats[event.RestaurantID] == nil {
-		a.stats[event.RestaurantID] = &RestaurantStats{
-			RestaurantID:     event.RestaurantID,
-			DailyViews:       make(map[string]int),
-			HourlyViews:      make(map[int]int),
-			DeviceTypes:      make(map[string]int),
-			OperatingSystems: make(map[string]int),
-			Browsers:         make(map[string]int),
-			Countries:        make(map[string]int),
-			MenuViews:        make(map[string]int),
-			QRCodeScans:      make(map[string]int),
+// SetGeoResolver imposta la geolocalizzazione usata per paese e città degli eventi
+func (a *Analytics) SetGeoResolver(geo GeoResolver) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.geo = geo
+}
+
+// SetAnonymizer imposta l'anonimizzazione di IP e User-Agent applicata agli eventi prima
+// del salvataggio. Geolocalizzazione e impronte dei visitatori usano comunque l'IP completo,
+// che non viene mai memorizzato
+func (a *Analytics) SetAnonymizer(anonymizer *anonymize.Anonymizer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.anonymizer = anonymizer
+}
+
+// Locate geolocalizza un IP con il resolver configurato
+func (a *Analytics) Locate(ip string) geoip.Location {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.locate(ip)
+}
+
+// locate va chiamato con a.mu già acquisito
+func (a *Analytics) locate(ip string) geoip.Location {
+	if a.geo == nil || ip == "" {
+		return geoip.Location{}
+	}
+	return a.geo.Locate(ip)
+}
+
+var (
+	eventsTracked = metrics.NewCounter("qrmenu_analytics_events_total",
+		"Analytics events tracked by type (view, share, scan).", "type")
+	eventsStoreFailures = metrics.NewCounter("qrmenu_analytics_event_store_failures_total",
+		"Raw analytics events that could not be persisted.")
+)
+
+// recordRaw invia l'evento al sink in background. Va chiamato con a.mu già acquisito
+func (a *Analytics) recordRaw(event RawEvent) {
+	eventsTracked.Inc(event.Type)
+
+	sink := a.sink
+	if sink == nil || event.RestaurantID == "" {
+		return
+	}
+	if event.DeviceType == "" {
+		event.DeviceType, event.Browser, event.OS = ParseUserAgent(event.UserAgent)
+	}
+	// Dispositivo e browser sono già estratti: si salvano solo IP e User-Agent anonimizzati
+	event.UserIP = a.anonymizer.IP(event.UserIP)
+	event.UserAgent = a.anonymizer.UserAgent(event.UserAgent)
+
+	a.pending.Add(1)
+	go func() {
+		defer a.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := sink(ctx, event); err != nil {
+			eventsStoreFailures.Inc()
+			logger.Warn("Errore nel salvataggio dell'evento analytics", map[string]interface{}{
+				"type":          event.Type,
+				"restaurant_id": event.RestaurantID,
+				"error":         err.Error(),
+			})
 		}
+	}()
+}
+
+// TrackView registra una visualizzazione pagina. Con event.AggregateOnly aggiorna solo i
+// conteggi di viste per giorno, ora e menu e non salva l'evento grezzo
+func (a *Analytics) TrackView(event ViewEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	event.UTMSource = normalizeUTM(event.UTMSource)
+	event.UTMMedium = normalizeUTM(event.UTMMedium)
+	event.UTMCampaign = normalizeUTM(event.UTMCampaign)
+
+	if event.AggregateOnly {
+		a.trackAggregateView(event)
+		return
 	}
 
-	stats := a.stats[event.RestaurantID]
+	stats := a.viewStats(event.RestaurantID)
+
+	// Geolocalizzazione dall'IP se il chiamante non l'ha già fornita
+	if event.Country == "" {
+		location := a.locate(event.UserIP)
+		event.Country = location.CountryCode
+		if event.City == "" {
+			event.City = location.City
+		}
+	}
 
 	// Aggiorna contatori
 	stats.TotalViews++
@@ -143,12 +329,24 @@ func (a *Analytics) TrackView(event ViewEvent) {
 	stats.OperatingSystems[event.OS]++
 	stats.Browsers[event.Browser]++
 	stats.Countries[event.Country]++
+	if event.City != "" {
+		if stats.Cities == nil {
+			stats.Cities = make(map[string]int)
+		}
+		stats.Cities[cityKey(event.City, event.Country)]++
+	}
 
 	// Menu views
 	if event.MenuID != "" {
 		stats.MenuViews[event.MenuID]++
 	}
 
+	// Campagne
+	trackCampaign(stats, event)
+
+	// Visitatori unici
+	a.trackVisitor(stats, event)
+
 	stats.LastUpdated = time.Now()
 
 	// Log evento
@@ -157,10 +355,74 @@ func (a *Analytics) TrackView(event ViewEvent) {
 		"menu_id":       event.MenuID,
 		"device_type":   event.DeviceType,
 		"country":       event.Country,
+		"city":          event.City,
+		"utm_source":    event.UTMSource,
+		"utm_campaign":  event.UTMCampaign,
+	})
+
+	a.recordRaw(RawEvent{
+		Type:         EventView,
+		RestaurantID: event.RestaurantID,
+		MenuID:       event.MenuID,
+		ItemID:       event.ItemID,
+		Timestamp:    event.Timestamp,
+		UserIP:       event.UserIP,
+		UserAgent:    event.UserAgent,
+		DeviceType:   event.DeviceType,
+		Browser:      event.Browser,
+		OS:           event.OS,
+		Country:      event.Country,
+		City:         event.City,
+		Referrer:     event.Referrer,
+		SessionID:    event.SessionID,
+		UTMSource:    event.UTMSource,
+		UTMMedium:    event.UTMMedium,
+		UTMCampaign:  event.UTMCampaign,
 	})
 
 	// Salva in background
-	go a.saveToStorage()
+	a.saveAsync()
+}
+
+// viewStats restituisce le statistiche del ristorante, creandole con tutti i contatori delle
+// viste se non esistono. Va chiamato con a.mu bloccato
+func (a *Analytics) viewStats(restaurantID string) *RestaurantStats {
+	if a.stats[restaurantID] == nil {
+		a.stats[restaurantID] = &RestaurantStats{
+			RestaurantID:     restaurantID,
+			DailyViews:       make(map[string]int),
+			HourlyViews:      make(map[int]int),
+			DeviceTypes:      make(map[string]int),
+			OperatingSystems: make(map[string]int),
+			Browsers:         make(map[string]int),
+			Countries:        make(map[string]int),
+			MenuViews:        make(map[string]int),
+			QRCodeScans:      make(map[string]int),
+		}
+	}
+	return a.stats[restaurantID]
+}
+
+// trackAggregateView conta una visualizzazione senza dati del visitatore. I parametri UTM
+// descrivono il link, non il visitatore, e vengono contati. Va chiamato con a.mu bloccato
+func (a *Analytics) trackAggregateView(event ViewEvent) {
+	stats := a.viewStats(event.RestaurantID)
+	if stats.MenuViews == nil {
+		// Statistiche create da una condivisione o da una scansione QR
+		stats.MenuViews = make(map[string]int)
+	}
+
+	stats.TotalViews++
+	stats.DailyViews[event.Timestamp.Format("2006-01-02")]++
+	stats.HourlyViews[event.Timestamp.Hour()]++
+	if event.MenuID != "" {
+		stats.MenuViews[event.MenuID]++
+	}
+	trackCampaign(stats, event)
+	stats.LastUpdated = time.Now()
+
+	eventsTracked.Inc(EventView)
+	a.saveAsync()
 }
 
 // TrackShare registra una condivisione
@@ -195,16 +457,27 @@ func (a *Analytics) TrackShare(event ShareEvent) {
 	stats.LastUpdated = time.Now()
 
 	logger.AuditLog("SHARE_TRACKED", "analytics",
-		"Condivisione tracciata", event.RestaurantID, event.UserIP, event.UserAgent,
+		"Condivisione tracciata", event.RestaurantID, a.anonymizer.IP(event.UserIP), a.anonymizer.UserAgent(event.UserAgent),
 		map[string]interface{}{
 			"platform": event.Platform,
 			"menu_id":  event.MenuID,
 		})
 
-	go a.saveToStorage()
+	a.recordRaw(RawEvent{
+		Type:         EventShare,
+		RestaurantID: event.RestaurantID,
+		MenuID:       event.MenuID,
+		Timestamp:    event.Timestamp,
+		UserIP:       event.UserIP,
+		UserAgent:    event.UserAgent,
+		Platform:     event.Platform,
+	})
+
+	a.saveAsync()
 }
 
-// TrackQRScan registra una scansione QR
+// TrackQRScan registra una scansione QR o, con Source nfc o link, l'apertura da un tag NFC
+// o da un link breve
 func (a *Analytics) TrackQRScan(event QRScanEvent) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -220,19 +493,67 @@ func (a *Analytics) TrackQRScan(event QRScanEvent) {
 
 	stats := a.stats[event.RestaurantID]
 
-	// Incrementa scansioni QR
+	country, city := event.Location, ""
+	if country == "" {
+		location := a.locate(event.UserIP)
+		country, city = location.CountryCode, location.City
+	}
+
+	// Incrementa scansioni QR, aperture NFC o aperture dei link brevi
 	dayKey := event.Timestamp.Format("2006-01-02")
-	stats.QRCodeScans[dayKey]++
+	switch event.Source {
+	case ScanSourceNFC:
+		if stats.NFCScans == nil {
+			stats.NFCScans = make(map[string]int)
+		}
+		stats.NFCScans[dayKey]++
+	case ScanSourceLink:
+		if stats.LinkClicks == nil {
+			stats.LinkClicks = make(map[string]int)
+			stats.LinkSources = make(map[string]int)
+			stats.LinkCampaigns = make(map[string]int)
+		}
+		stats.LinkClicks[dayKey]++
+		if event.LinkSource != "" {
+			stats.LinkSources[event.LinkSource]++
+		}
+		if event.Campaign != "" {
+			stats.LinkCampaigns[event.Campaign]++
+		}
+	default:
+		if stats.QRCodeScans == nil {
+			// Statistiche create da una condivisione
+			stats.QRCodeScans = make(map[string]int)
+		}
+		event.Source = ScanSourceQR
+		stats.QRCodeScans[dayKey]++
+	}
 	stats.LastUpdated = time.Now()
 
 	logger.AuditLog("QR_SCAN_TRACKED", "analytics",
-		"Scansione QR tracciata", event.RestaurantID, event.UserIP, event.UserAgent,
+		"Scansione QR tracciata", event.RestaurantID, a.anonymizer.IP(event.UserIP), a.anonymizer.UserAgent(event.UserAgent),
 		map[string]interface{}{
 			"menu_id":  event.MenuID,
 			"location": event.Location,
+			"source":   event.Source,
+			"campaign": event.Campaign,
 		})
 
-	go a.saveToStorage()
+	a.recordRaw(RawEvent{
+		Type:         EventScan,
+		RestaurantID: event.RestaurantID,
+		MenuID:       event.MenuID,
+		Timestamp:    event.Timestamp,
+		UserIP:       event.UserIP,
+		UserAgent:    event.UserAgent,
+		Country:      country,
+		City:         city,
+		Source:       event.Source,
+		LinkSource:   event.LinkSource,
+		Campaign:     event.Campaign,
+	})
+
+	a.saveAsync()
 }
 
 // GetRestaurantStats restituisce le statistiche di un ristorante
@@ -254,6 +575,20 @@ func (a *Analytics) GetRestaurantStats(restaurantID string) *RestaurantStats {
 	return &statsCopy
 }
 
+// MarshalRestaurantStats restituisce in JSON le statistiche aggregate di un ristorante, per
+// l'export dei dati dell'account. Le impronte dei visitatori non sono incluse
+func (a *Analytics) MarshalRestaurantStats(restaurantID string) ([]byte, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	stats := RestaurantStats{RestaurantID: restaurantID}
+	if current, exists := a.stats[restaurantID]; exists {
+		stats = *current
+		stats.Visitors = nil
+	}
+	return json.MarshalIndent(stats, "", "  ")
+}
+
 // GetDashboardData calcola dati aggregati per dashboard
 func (a *Analytics) GetDashboardData(restaurantID string, days int) map[string]interface{} {
 	a.mu.RLock()
@@ -262,10 +597,19 @@ func (a *Analytics) GetDashboardData(restaurantID string, days int) map[string]i
 	stats := a.stats[restaurantID]
 	if stats == nil {
 		return map[string]interface{}{
-			"total_views":   0,
-			"unique_views":  0,
+			"total_views":  0,
+			"unique_views": 0,
+			"unique_visitors": map[string]int{
+				"today": 0,
+				"week":  0,
+				"month": 0,
+			},
 			"total_shares":  0,
 			"qr_scans":      0,
+			"nfc_scans":     0,
+			"link_clicks":   0,
+			"campaigns":     []CampaignStats{},
+			"utm_sources":   map[string]int{},
 			"daily_trend":   []interface{}{},
 			"device_stats":  map[string]int{},
 			"popular_items": []interface{}{},
@@ -283,36 +627,290 @@ func (a *Analytics) GetDashboardData(restaurantID string, days int) map[string]i
 		qrScans := stats.QRCodeScans[dayKey]
 
 		dailyTrend = append(dailyTrend, map[string]interface{}{
-			"date":     dayKey,
-			"views":    views,
-			"qr_scans": qrScans,
+			"date":            dayKey,
+			"views":           views,
+			"unique_visitors": stats.DailyUniques[dayKey],
+			"qr_scans":        qrScans,
+			"nfc_scans":       stats.NFCScans[dayKey],
+			"link_clicks":     stats.LinkClicks[dayKey],
 		})
 	}
 
-	// Calcola totale scansioni QR
+	// Calcola totale scansioni QR (anche quelle già compattate per mese)
 	totalQRScans := 0
 	for _, scans := range stats.QRCodeScans {
 		totalQRScans += scans
 	}
+	for _, scans := range stats.MonthlyQRScans {
+		totalQRScans += scans
+	}
+	totalNFCScans := 0
+	for _, scans := range stats.NFCScans {
+		totalNFCScans += scans
+	}
+	for _, scans := range stats.MonthlyNFCScans {
+		totalNFCScans += scans
+	}
+	totalLinkClicks := 0
+	for _, clicks := range stats.LinkClicks {
+		totalLinkClicks += clicks
+	}
+	for _, clicks := range stats.MonthlyLinkClicks {
+		totalLinkClicks += clicks
+	}
+
+	campaigns, utmSources := campaignBreakdown(stats)
 
 	return map[string]interface{}{
 		"total_views":     stats.TotalViews,
 		"unique_views":    stats.UniqueViews,
+		"unique_visitors": uniqueVisitors(stats, now),
 		"total_shares":    stats.ShareStats.Total,
 		"qr_scans":        totalQRScans,
+		"nfc_scans":       totalNFCScans,
+		"link_clicks":     totalLinkClicks,
+		"scan_sources":    map[string]int{ScanSourceQR: totalQRScans, ScanSourceNFC: totalNFCScans, ScanSourceLink: totalLinkClicks},
+		"link_sources":    stats.LinkSources,
+		"link_campaigns":  stats.LinkCampaigns,
+		"campaigns":       campaigns,
+		"utm_sources":     utmSources,
 		"daily_trend":     dailyTrend,
 		"device_stats":    stats.DeviceTypes,
 		"os_stats":        stats.OperatingSystems,
 		"browser_stats":   stats.Browsers,
 		"country_stats":   stats.Countries,
+		"city_stats":      stats.Cities,
 		"popular_items":   stats.PopularItems,
 		"share_breakdown": stats.ShareStats,
 		"last_updated":    stats.LastUpdated,
 	}
 }
 
+// MenuPeriodStats contiene le statistiche di un menu in un periodo (usate per l'archivio stagionale)
+type MenuPeriodStats struct {
+	MenuViews       int
+	RestaurantViews int
+	QRScans         int
+	DailyViews      map[string]int
+	TopItems        []PopularItem
+}
+
+// GetMenuPeriodStats calcola le statistiche di un menu tra from e to. Le viste giornaliere
+// sono registrate per ristorante, quindi RestaurantViews e QRScans coprono tutto il ristorante;
+// i piatti più visti sono filtrati su itemIDs (i piatti del menu)
+func (a *Analytics) GetMenuPeriodStats(restaurantID, menuID string, itemIDs []string, from, to time.Time) MenuPeriodStats {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	result := MenuPeriodStats{DailyViews: make(map[string]int)}
+	stats := a.stats[restaurantID]
+	if stats == nil {
+		return result
+	}
+
+	result.MenuViews = stats.MenuViews[menuID]
+
+	fromKey := from.Format("2006-01-02")
+	toKey := to.Format("2006-01-02")
+	for day, views := range stats.DailyViews {
+		if day >= fromKey && day <= toKey {
+			result.DailyViews[day] = views
+			result.RestaurantViews += views
+		}
+	}
+	for day, scans := range stats.QRCodeScans {
+		if day >= fromKey && day <= toKey {
+			result.QRScans += scans
+		}
+	}
+	// I mesi già compattati contano solo se interamente compresi nel periodo
+	for month, views := range stats.MonthlyViews {
+		if monthWithin(month, from, to) {
+			result.RestaurantViews += views
+		}
+	}
+	for month, scans := range stats.MonthlyQRScans {
+		if monthWithin(month, from, to) {
+			result.QRScans += scans
+		}
+	}
+
+	inMenu := make(map[string]bool, len(itemIDs))
+	for _, id := range itemIDs {
+		inMenu[id] = true
+	}
+	for _, item := range stats.PopularItems {
+		if inMenu[item.ItemID] {
+			result.TopItems = append(result.TopItems, item)
+		}
+	}
+	sort.Slice(result.TopItems, func(i, j int) bool {
+		return result.TopItems[i].Views > result.TopItems[j].Views
+	})
+	if len(result.TopItems) > 10 {
+		result.TopItems = result.TopItems[:10]
+	}
+
+	return result
+}
+
+// monthWithin indica se il mese ("2006-01") è interamente compreso tra from e to
+func monthWithin(month string, from, to time.Time) bool {
+	start, err := time.ParseInLocation("2006-01", month, from.Location())
+	if err != nil {
+		return false
+	}
+	end := start.AddDate(0, 1, -1)
+	return !start.Before(truncateDay(from)) && !end.After(truncateDay(to))
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// RetentionPolicy stabilisce per quanto tempo vengono conservate le statistiche
+type RetentionPolicy struct {
+	DailyDays     int // I conteggi giornalieri più vecchi vengono compattati in aggregati mensili
+	MonthlyMonths int // Gli aggregati mensili più vecchi vengono eliminati (0 = conservati per sempre)
+}
+
+// CompactionResult riassume una compattazione delle statistiche
+type CompactionResult struct {
+	Restaurants   int `json:"restaurants"`    // Ristoranti con dati compattati o eliminati
+	DaysRolledUp  int `json:"days_rolled_up"` // Conteggi giornalieri spostati negli aggregati mensili
+	MonthsDropped int `json:"months_dropped"` // Aggregati mensili eliminati perché oltre la retention
+}
+
+// Compact applica la retention alle statistiche in memoria: i conteggi giornalieri di viste,
+// scansioni QR, aperture NFC e dei link brevi più vecchi di policy.DailyDays vengono sommati nel rispettivo mese, gli
+// aggregati mensili più vecchi di policy.MonthlyMonths vengono eliminati. Le viste orarie
+// sono già aggregate per ora del giorno e non crescono nel tempo. Salva su disco se cambia qualcosa
+func (a *Analytics) Compact(policy RetentionPolicy, now time.Time) CompactionResult {
+	var result CompactionResult
+	if policy.DailyDays <= 0 {
+		return result
+	}
+
+	dayCutoff := now.AddDate(0, 0, -policy.DailyDays).Format("2006-01-02")
+	monthCutoff := ""
+	if policy.MonthlyMonths > 0 {
+		monthCutoff = now.AddDate(0, -policy.MonthlyMonths, 0).Format("2006-01")
+	}
+
+	a.mu.Lock()
+	for _, stats := range a.stats {
+		rolled, dropped := compactStats(stats, dayCutoff, monthCutoff)
+		if rolled+dropped > 0 {
+			result.Restaurants++
+			result.DaysRolledUp += rolled
+			result.MonthsDropped += dropped
+		}
+	}
+	a.mu.Unlock()
+
+	if result.Restaurants > 0 {
+		a.saveAsync()
+	}
+	return result
+}
+
+// compactStats sposta nei mesi i giorni precedenti a dayCutoff ed elimina i mesi
+// precedenti a monthCutoff (se non vuoto). Restituisce giorni compattati e mesi eliminati
+func compactStats(stats *RestaurantStats, dayCutoff, monthCutoff string) (rolled, dropped int) {
+	rollUp := func(daily map[string]int, monthly *map[string]int) {
+		for day, count := range daily {
+			if day >= dayCutoff || len(day) < len("2006-01") {
+				continue
+			}
+			if *monthly == nil {
+				*monthly = make(map[string]int)
+			}
+			(*monthly)[day[:len("2006-01")]] += count
+			delete(daily, day)
+			rolled++
+		}
+	}
+	rollUp(stats.DailyViews, &stats.MonthlyViews)
+	rollUp(stats.QRCodeScans, &stats.MonthlyQRScans)
+	rollUp(stats.NFCScans, &stats.MonthlyNFCScans)
+	rollUp(stats.LinkClicks, &stats.MonthlyLinkClicks)
+
+	// I visitatori unici non si possono sommare tra giorni: quelli giornalieri e settimanali
+	// oltre la retention vengono eliminati, restano gli aggregati mensili già calcolati
+	for day := range stats.DailyUniques {
+		if day < dayCutoff {
+			delete(stats.DailyUniques, day)
+			rolled++
+		}
+	}
+	cutoff, _ := time.Parse("2006-01-02", dayCutoff)
+	year, week := cutoff.ISOWeek()
+	weekCutoff := fmt.Sprintf("%d-W%02d", year, week)
+	for key := range stats.WeeklyUniques {
+		if key < weekCutoff {
+			delete(stats.WeeklyUniques, key)
+		}
+	}
+
+	if monthCutoff != "" {
+		for _, monthly := range []map[string]int{stats.MonthlyViews, stats.MonthlyQRScans, stats.MonthlyNFCScans, stats.MonthlyLinkClicks, stats.MonthlyUniques} {
+			for month := range monthly {
+				if month < monthCutoff {
+					delete(monthly, month)
+					dropped++
+				}
+			}
+		}
+	}
+	return rolled, dropped
+}
+
+// AnonymizeRestaurant rimuove dalle statistiche in memoria di un ristorante i dati più vicini
+// al singolo visitatore: le impronte dei visitatori del periodo corrente e le città.
+// I conteggi aggregati restano. Va chiamato alla cancellazione dell'account del ristorante
+func (a *Analytics) AnonymizeRestaurant(restaurantID string) {
+	a.mu.Lock()
+	stats, exists := a.stats[restaurantID]
+	if exists {
+		stats.Visitors = nil
+		stats.Cities = nil
+	}
+	a.mu.Unlock()
+
+	if exists {
+		a.saveAsync()
+	}
+}
+
 // Storage functions
 
+// saveAsync salva le statistiche in background tenendo traccia del salvataggio per Flush
+func (a *Analytics) saveAsync() {
+	a.pending.Add(1)
+	go func() {
+		defer a.pending.Done()
+		a.saveToStorage()
+	}()
+}
+
+// Flush attende i salvataggi in corso ed esegue un ultimo salvataggio su disco.
+// Va chiamato allo spegnimento del server per non perdere gli ultimi eventi
+func (a *Analytics) Flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		a.pending.Wait()
+		a.saveToStorage()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("flush analytics interrotto: %w", ctx.Err())
+	}
+}
+
 func (a *Analytics) saveToStorage() {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
@@ -327,16 +925,8 @@ func (a *Analytics) saveToStorage() {
 	for restaurantID, stats := range a.stats {
 		filename := filepath.Join("storage/analytics", restaurantID+".json")
 
-		data, err := json.MarshalIndent(stats, "", "  ")
-		if err != nil {
-			logger.Error("Errore serializzazione analytics", map[string]interface{}{
-				"restaurant_id": restaurantID,
-				"error":         err.Error(),
-			})
-			continue
-		}
-
-		if err := os.WriteFile(filename, data, 0644); err != nil {
+		// Scrittura atomica: un crash durante il salvataggio lascia il file precedente intatto
+		if err := db.WriteJSONAtomic(filename, stats); err != nil {
 			logger.Error("Errore salvataggio analytics", map[string]interface{}{
 				"restaurant_id": restaurantID,
 				"file":          filename,
@@ -367,21 +957,19 @@ func (a *Analytics) loadFromStorage() {
 		}
 
 		filename := filepath.Join(analyticsDir, entry.Name())
-		data, err := os.ReadFile(filename)
-		if err != nil {
-			logger.Error("Errore lettura file analytics", map[string]interface{}{
-				"file":  filename,
-				"error": err.Error(),
-			})
-			continue
-		}
-
 		var stats RestaurantStats
-		if err := json.Unmarshal(data, &stats); err != nil {
-			logger.Error("Errore parsing analytics", map[string]interface{}{
+		if err := db.ReadJSONFile(filename, &stats); err != nil {
+			fields := map[string]interface{}{
 				"file":  filename,
 				"error": err.Error(),
-			})
+			}
+			// I file corrotti vanno in quarantena invece di essere riletti e ignorati a ogni avvio
+			if errors.Is(err, db.ErrCorruptFile) {
+				if dst, qerr := db.QuarantineCorruptFile(filename, err); qerr == nil {
+					fields["quarantined_to"] = dst
+				}
+			}
+			logger.Error("Errore lettura file analytics", fields)
 			continue
 		}
 
@@ -443,9 +1031,17 @@ func ParseUserAgent(userAgent string) (deviceType, browser, os string) {
 	return
 }
 
-// GetCountryFromIP ottiene il paese dall'IP (implementazione mock)
+// GetCountryFromIP ottiene il codice ISO del paese dall'IP tramite il GeoResolver
+// configurato. Restituisce "" se il database GeoIP non è caricato o l'IP è privato
 func GetCountryFromIP(ip string) string {
-	// In produzione, usare servizio di geolocalizzazione come MaxMind
-	// Per ora restituiamo "IT" come default
-	return "IT"
+	return GetAnalytics().Locate(ip).CountryCode
+}
+
+// cityKey compone la chiave delle statistiche per città, distinguendo città omonime
+// di paesi diversi
+func cityKey(city, country string) string {
+	if country == "" {
+		return city
+	}
+	return city + ", " + country
 }
@@ -0,0 +1,192 @@
+package analytics
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestCompactStats tests how daily counts are merged into monthly buckets and where the
+// retention cutoffs fall
+func TestCompactStats(t *testing.T) {
+	tests := []struct {
+		name        string
+		stats       RestaurantStats
+		dayCutoff   string
+		monthCutoff string
+		want        RestaurantStats
+		rolled      int
+		dropped     int
+	}{
+		{
+			name: "days before the cutoff merge into their month",
+			stats: RestaurantStats{
+				DailyViews:   map[string]int{"2026-01-30": 3, "2026-01-31": 4, "2026-02-01": 5, "2026-03-01": 6},
+				MonthlyViews: map[string]int{"2026-01": 10},
+			},
+			dayCutoff: "2026-03-01",
+			want: RestaurantStats{
+				DailyViews:   map[string]int{"2026-03-01": 6},
+				MonthlyViews: map[string]int{"2026-01": 17, "2026-02": 5},
+			},
+			rolled: 3,
+		},
+		{
+			name: "the cutoff day itself is kept",
+			stats: RestaurantStats{
+				DailyViews: map[string]int{"2026-03-01": 2, "2026-03-02": 1},
+			},
+			dayCutoff: "2026-03-01",
+			want: RestaurantStats{
+				DailyViews: map[string]int{"2026-03-01": 2, "2026-03-02": 1},
+			},
+		},
+		{
+			name: "monthly maps are created for every daily counter",
+			stats: RestaurantStats{
+				QRCodeScans: map[string]int{"2025-12-24": 7, "2026-01-02": 1},
+				NFCScans:    map[string]int{"2025-12-25": 2},
+				LinkClicks:  map[string]int{"2025-12-31": 4, "2025-12-01": 1},
+			},
+			dayCutoff: "2026-01-01",
+			want: RestaurantStats{
+				QRCodeScans:       map[string]int{"2026-01-02": 1},
+				NFCScans:          map[string]int{},
+				LinkClicks:        map[string]int{},
+				MonthlyQRScans:    map[string]int{"2025-12": 7},
+				MonthlyNFCScans:   map[string]int{"2025-12": 2},
+				MonthlyLinkClicks: map[string]int{"2025-12": 5},
+			},
+			rolled: 4,
+		},
+		{
+			name: "malformed keys are left alone",
+			stats: RestaurantStats{
+				DailyViews: map[string]int{"2026": 1, "": 2},
+			},
+			dayCutoff: "2026-03-01",
+			want: RestaurantStats{
+				DailyViews: map[string]int{"2026": 1, "": 2},
+			},
+		},
+		{
+			name: "unique visitors are dropped, not summed",
+			stats: RestaurantStats{
+				DailyUniques:   map[string]int{"2026-02-27": 3, "2026-03-02": 4},
+				WeeklyUniques:  map[string]int{"2026-W08": 9, "2026-W09": 8, "2026-W10": 7},
+				MonthlyUniques: map[string]int{"2026-02": 20},
+			},
+			dayCutoff: "2026-03-01", // Sunday of ISO week 9: that week is kept
+			want: RestaurantStats{
+				DailyUniques:   map[string]int{"2026-03-02": 4},
+				WeeklyUniques:  map[string]int{"2026-W09": 8, "2026-W10": 7},
+				MonthlyUniques: map[string]int{"2026-02": 20},
+			},
+			rolled: 1,
+		},
+		{
+			name: "months before the month cutoff are dropped",
+			stats: RestaurantStats{
+				DailyViews:     map[string]int{"2025-03-15": 1},
+				MonthlyViews:   map[string]int{"2025-02": 5, "2025-03": 6, "2025-04": 7},
+				MonthlyQRScans: map[string]int{"2024-12": 1},
+				MonthlyUniques: map[string]int{"2025-01": 3, "2025-03": 4},
+			},
+			dayCutoff:   "2026-03-01",
+			monthCutoff: "2025-03",
+			want: RestaurantStats{
+				DailyViews:     map[string]int{},
+				MonthlyViews:   map[string]int{"2025-03": 7, "2025-04": 7},
+				MonthlyQRScans: map[string]int{},
+				MonthlyUniques: map[string]int{"2025-03": 4},
+			},
+			rolled:  1,
+			dropped: 3,
+		},
+		{
+			name: "days rolled into a month older than the month cutoff are dropped too",
+			stats: RestaurantStats{
+				DailyViews: map[string]int{"2024-06-01": 2},
+			},
+			dayCutoff:   "2026-03-01",
+			monthCutoff: "2025-03",
+			want: RestaurantStats{
+				DailyViews:   map[string]int{},
+				MonthlyViews: map[string]int{},
+			},
+			rolled:  1,
+			dropped: 1,
+		},
+		{
+			name: "without a month cutoff months are kept forever",
+			stats: RestaurantStats{
+				MonthlyViews: map[string]int{"2019-01": 1},
+			},
+			dayCutoff: "2026-03-01",
+			want: RestaurantStats{
+				MonthlyViews: map[string]int{"2019-01": 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := tt.stats
+			rolled, dropped := compactStats(&stats, tt.dayCutoff, tt.monthCutoff)
+			if rolled != tt.rolled || dropped != tt.dropped {
+				t.Errorf("Expected %d rolled and %d dropped, got %d and %d", tt.rolled, tt.dropped, rolled, dropped)
+			}
+			if !reflect.DeepEqual(stats, tt.want) {
+				t.Errorf("Unexpected stats after compaction:\n got  %+v\n want %+v", stats, tt.want)
+			}
+		})
+	}
+}
+
+// TestCompact tests that the policy is turned into cutoffs relative to now and that only
+// restaurants with changes are counted
+func TestCompact(t *testing.T) {
+	t.Chdir(t.TempDir()) // Compact saves to storage/analytics
+
+	now := time.Date(2026, 3, 15, 10, 0, 0, 0, time.UTC)
+	newAnalytics := func() *Analytics {
+		return &Analytics{stats: map[string]*RestaurantStats{
+			"old": {
+				DailyViews:   map[string]int{"2026-02-12": 1, "2026-02-13": 2},
+				MonthlyViews: map[string]int{"2025-02": 3, "2025-03": 4},
+			},
+			"recent": {
+				DailyViews: map[string]int{"2026-03-14": 5},
+			},
+		}}
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   CompactionResult
+	}{
+		{"disabled", RetentionPolicy{}, CompactionResult{}},
+		{"negative days disable compaction", RetentionPolicy{DailyDays: -1, MonthlyMonths: 1}, CompactionResult{}},
+		{"daily only", RetentionPolicy{DailyDays: 30}, CompactionResult{Restaurants: 1, DaysRolledUp: 1}},
+		{"daily and monthly", RetentionPolicy{DailyDays: 30, MonthlyMonths: 12}, CompactionResult{Restaurants: 1, DaysRolledUp: 1, MonthsDropped: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAnalytics()
+			if got := a.Compact(tt.policy, now); got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+			if err := a.Flush(context.Background()); err != nil {
+				t.Fatalf("Flush failed: %v", err)
+			}
+			if tt.policy.DailyDays > 0 {
+				// The cutoff is 30 days before now: 2026-02-13 stays daily
+				if got := a.stats["old"].DailyViews; !reflect.DeepEqual(got, map[string]int{"2026-02-13": 2}) {
+					t.Errorf("Unexpected daily views %v", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package analytics
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxUTMLength è la lunghezza massima di un parametro UTM, in caratteri: i valori più
+	// lunghi vengono troncati
+	maxUTMLength = 50
+	// maxCampaignKeys è il numero massimo di combinazioni sorgente/mezzo/campagna di un
+	// ristorante: i parametri UTM arrivano dall'URL e chiunque può inventarne di nuovi, le
+	// combinazioni successive vengono contate in campaignOtherKey
+	maxCampaignKeys = 500
+	// campaignOtherKey raccoglie le visualizzazioni oltre maxCampaignKeys
+	campaignOtherKey = "(altro)||"
+)
+
+// CampaignStats sono le visualizzazioni arrivate con una combinazione di parametri UTM
+type CampaignStats struct {
+	Source   string `json:"source"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Views    int    `json:"views"`
+}
+
+// normalizeUTM restituisce il parametro UTM in minuscolo, senza spazi iniziali e finali e
+// senza il separatore delle chiavi, così "Instagram" e "instagram " sono la stessa sorgente
+func normalizeUTM(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	value = strings.ReplaceAll(value, "|", "-")
+	if utf8.RuneCountInString(value) > maxUTMLength {
+		value = string([]rune(value)[:maxUTMLength])
+	}
+	return value
+}
+
+// campaignKey compone la chiave delle statistiche per campagna: sorgente, mezzo e campagna
+// separati da "|". Senza parametri UTM la chiave è vuota
+func campaignKey(source, medium, campaign string) string {
+	if source == "" && medium == "" && campaign == "" {
+		return ""
+	}
+	return source + "|" + medium + "|" + campaign
+}
+
+// trackCampaign conta la visualizzazione nella combinazione di parametri UTM dell'evento.
+// Va chiamato con a.mu bloccato e i parametri già normalizzati
+func trackCampaign(stats *RestaurantStats, event ViewEvent) {
+	key := campaignKey(event.UTMSource, event.UTMMedium, event.UTMCampaign)
+	if key == "" {
+		return
+	}
+	if stats.CampaignViews == nil {
+		stats.CampaignViews = make(map[string]int)
+	}
+	if _, known := stats.CampaignViews[key]; !known && len(stats.CampaignViews) >= maxCampaignKeys {
+		key = campaignOtherKey
+	}
+	stats.CampaignViews[key]++
+}
+
+// campaignBreakdown restituisce le visualizzazioni per campagna, dalla più vista, e le
+// visualizzazioni per sola sorgente (es. instagram, tavolo)
+func campaignBreakdown(stats *RestaurantStats) ([]CampaignStats, map[string]int) {
+	campaigns := make([]CampaignStats, 0, len(stats.CampaignViews))
+	sources := make(map[string]int)
+	for key, views := range stats.CampaignViews {
+		parts := strings.SplitN(key, "|", 3)
+		for len(parts) < 3 {
+			parts = append(parts, "")
+		}
+		campaigns = append(campaigns, CampaignStats{Source: parts[0], Medium: parts[1], Campaign: parts[2], Views: views})
+		sources[parts[0]] += views
+	}
+	sort.Slice(campaigns, func(i, j int) bool {
+		if campaigns[i].Views != campaigns[j].Views {
+			return campaigns[i].Views > campaigns[j].Views
+		}
+		return campaignKey(campaigns[i].Source, campaigns[i].Medium, campaigns[i].Campaign) <
+			campaignKey(campaigns[j].Source, campaigns[j].Medium, campaigns[j].Campaign)
+	})
+	return campaigns, sources
+}
@@ -0,0 +1,107 @@
+package analytics
+
+import (
+	"sort"
+	"time"
+)
+
+// LocationPeriodStats contiene i conteggi di una sede negli ultimi giorni del cruscotto
+// di gruppo. UniqueVisitors è la somma dei visitatori unici giornalieri
+type LocationPeriodStats struct {
+	RestaurantID   string `json:"restaurant_id"`
+	Views          int    `json:"views"`
+	UniqueVisitors int    `json:"unique_visitors"`
+	QRScans        int    `json:"qr_scans"`
+}
+
+// GroupDay contiene i conteggi di tutte le sedi in un giorno ("2006-01-02")
+type GroupDay struct {
+	Date           string `json:"date"`
+	Views          int    `json:"views"`
+	UniqueVisitors int    `json:"unique_visitors"`
+	QRScans        int    `json:"qr_scans"`
+}
+
+// GroupDashboard è il cruscotto aggregato di un gruppo di ristoranti (le sedi di
+// un'organizzazione): totali, dettaglio per sede, andamento giornaliero e piatti più visti
+type GroupDashboard struct {
+	Days       int                   `json:"days"`
+	Totals     LocationPeriodStats   `json:"totals"`
+	Locations  []LocationPeriodStats `json:"locations"`
+	DailyTrend []GroupDay            `json:"daily_trend"`
+	TopItems   []PopularItem         `json:"top_items"`
+}
+
+// GetGroupDashboard calcola il cruscotto aggregato dei ristoranti indicati sugli ultimi
+// days giorni. Le sedi sono ordinate per visualizzazioni; i piatti più visti sono sommati
+// per ID, così i piatti dei menu distribuiti da un modello comune si sommano tra le sedi
+func (a *Analytics) GetGroupDashboard(restaurantIDs []string, days int) GroupDashboard {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	now := time.Now()
+	result := GroupDashboard{
+		Days:       days,
+		Locations:  make([]LocationPeriodStats, 0, len(restaurantIDs)),
+		DailyTrend: make([]GroupDay, 0, days),
+		TopItems:   []PopularItem{},
+	}
+	for i := days - 1; i >= 0; i-- {
+		result.DailyTrend = append(result.DailyTrend, GroupDay{Date: now.AddDate(0, 0, -i).Format("2006-01-02")})
+	}
+
+	items := make(map[string]*PopularItem)
+	for _, restaurantID := range restaurantIDs {
+		location := LocationPeriodStats{RestaurantID: restaurantID}
+		stats := a.stats[restaurantID]
+		if stats == nil {
+			result.Locations = append(result.Locations, location)
+			continue
+		}
+
+		for i := range result.DailyTrend {
+			day := &result.DailyTrend[i]
+			views, uniques, scans := stats.DailyViews[day.Date], stats.DailyUniques[day.Date], stats.QRCodeScans[day.Date]
+			day.Views += views
+			day.UniqueVisitors += uniques
+			day.QRScans += scans
+			location.Views += views
+			location.UniqueVisitors += uniques
+			location.QRScans += scans
+		}
+		result.Locations = append(result.Locations, location)
+
+		for _, item := range stats.PopularItems {
+			if merged, exists := items[item.ItemID]; exists {
+				merged.Views += item.Views
+				continue
+			}
+			copied := item
+			items[item.ItemID] = &copied
+		}
+	}
+
+	for _, location := range result.Locations {
+		result.Totals.Views += location.Views
+		result.Totals.UniqueVisitors += location.UniqueVisitors
+		result.Totals.QRScans += location.QRScans
+	}
+	sort.SliceStable(result.Locations, func(i, j int) bool {
+		return result.Locations[i].Views > result.Locations[j].Views
+	})
+
+	for _, item := range items {
+		result.TopItems = append(result.TopItems, *item)
+	}
+	sort.Slice(result.TopItems, func(i, j int) bool {
+		if result.TopItems[i].Views != result.TopItems[j].Views {
+			return result.TopItems[i].Views > result.TopItems[j].Views
+		}
+		return result.TopItems[i].ItemID < result.TopItems[j].ItemID
+	})
+	if len(result.TopItems) > 10 {
+		result.TopItems = result.TopItems[:10]
+	}
+
+	return result
+}
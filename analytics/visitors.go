@@ -0,0 +1,92 @@
+package analytics
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// visitorIDLength è la lunghezza (in caratteri esadecimali) degli identificativi salvati:
+// bastano per distinguere i visitatori di un ristorante senza conservare l'hash completo
+const visitorIDLength = 16
+
+// visitorID restituisce l'identificativo anonimo del visitatore di event. Con il cookie
+// first-party l'identificativo è stabile nel tempo; senza cookie è l'hash di IP e User-Agent
+// con un sale casuale che cambia ogni giorno e non viene mai salvato, quindi non è
+// riconducibile all'IP né collegabile tra giorni diversi. Va chiamato con a.mu bloccato
+func (a *Analytics) visitorID(event ViewEvent) string {
+	h := sha256.New()
+	if event.VisitorID != "" {
+		h.Write([]byte("cookie\x00" + event.RestaurantID + "\x00" + event.VisitorID))
+	} else {
+		day := event.Timestamp.Format("2006-01-02")
+		if a.saltDay != day || a.salt == nil {
+			a.salt = make([]byte, 32)
+			rand.Read(a.salt)
+			a.saltDay = day
+		}
+		h.Write(a.salt)
+		h.Write([]byte("\x00" + event.RestaurantID + "\x00" + event.UserIP + "\x00" + event.UserAgent))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:visitorIDLength]
+}
+
+// trackVisitor conta il visitatore di event tra gli unici del giorno, della settimana e
+// del mese. Senza cookie lo stesso visitatore torna a contare in giorni diversi, quindi
+// settimana e mese sono una stima per eccesso. Va chiamato con a.mu bloccato
+func (a *Analytics) trackVisitor(stats *RestaurantStats, event ViewEvent) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	id := a.visitorID(event)
+
+	year, week := event.Timestamp.ISOWeek()
+	periods := []struct {
+		name   string
+		key    string
+		counts *map[string]int
+	}{
+		{"day", event.Timestamp.Format("2006-01-02"), &stats.DailyUniques},
+		{"week", fmt.Sprintf("%d-W%02d", year, week), &stats.WeeklyUniques},
+		{"month", event.Timestamp.Format("2006-01"), &stats.MonthlyUniques},
+	}
+
+	if stats.Visitors == nil {
+		stats.Visitors = make(map[string]*VisitorPeriod)
+	}
+	for _, period := range periods {
+		current := stats.Visitors[period.name]
+		if current != nil && period.key < current.Key {
+			// Evento in ritardo di un periodo già chiuso
+			continue
+		}
+		if current == nil || current.Key != period.key {
+			current = &VisitorPeriod{Key: period.key, IDs: make(map[string]bool)}
+			stats.Visitors[period.name] = current
+		}
+		if current.IDs[id] {
+			continue
+		}
+		current.IDs[id] = true
+
+		if *period.counts == nil {
+			*period.counts = make(map[string]int)
+		}
+		(*period.counts)[period.key]++
+		if period.name == "day" {
+			stats.UniqueViews++
+		}
+	}
+}
+
+// uniqueVisitors restituisce i visitatori unici di oggi, della settimana e del mese correnti
+func uniqueVisitors(stats *RestaurantStats, now time.Time) map[string]int {
+	year, week := now.ISOWeek()
+	return map[string]int{
+		"today": stats.DailyUniques[now.Format("2006-01-02")],
+		"week":  stats.WeeklyUniques[fmt.Sprintf("%d-W%02d", year, week)],
+		"month": stats.MonthlyUniques[now.Format("2006-01")],
+	}
+}
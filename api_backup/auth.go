@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"qr-menu/db"
 	"qr-menu/logger"
 	"qr-menu/models"
 
@@ -66,6 +68,9 @@ const (
 	PermWebhooksRead    = "webhooks:read"
 	PermWebhooksWrite   = "webhooks:write"
 	PermWebhooksDeliver = "webhooks:deliver"
+
+	// Rotazione delle chiavi di firma: riguarda tutti i ristoranti, solo per gli admin
+	PermAuthRotateKeys = "auth:rotate-keys"
 )
 
 var allPermissions = []string{
@@ -85,19 +90,12 @@ var allPermissions = []string{
 
 var rolePermissions = map[string]map[string]bool{
 	RoleOwner:   permissionSet(allPermissions...),
-	RoleAdmin:   permissionSet(allPermissions...),
+	RoleAdmin:   permissionSet(append(allPermissions, PermAuthRotateKeys)...),
 	RoleManager: permissionSet(PermMenusRead, PermMenusWrite, PermMenusActivate, PermRestaurantRead, PermRestaurantWrite, PermAuthChangePass, PermBillingRead, PermWebhooksRead, PermWebhooksWrite, PermWebhooksDeliver),
 	RoleStaff:   permissionSet(PermMenusRead, PermRestaurantRead),
 	RoleViewer:  permissionSet(PermMenusRead, PermRestaurantRead),
 }
 
-var (
-	// Chiave segreta JWT (in produzione deve essere configurabile)
-	jwtSecret = []byte("qr-menu-jwt-secret-2024")
-	// Cache per token revocati (in produzione usare Redis)
-	revokedTokens = make(map[string]bool)
-)
-
 // Funzioni helper per risposte API
 
 // SuccessResponse crea una risposta di successo
@@ -148,7 +146,15 @@ func CreatedResponse(w http.ResponseWriter, data interface{}) {
 
 // GenerateJWT genera un token JWT per un ristorante
 func GenerateJWT(restaurant *models.Restaurant) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+	if jwtKeys == nil {
+		return "", fmt.Errorf("chiavi JWT non configurate")
+	}
+	key, err := jwtKeys.Current()
+	if err != nil {
+		return "", err
+	}
+
+	expirationTime := time.Now().Add(jwtExpiry)
 	role := normalizeRole(restaurant.Role)
 	if restaurant.Role != role {
 		restaurant.Role = role
@@ -162,27 +168,33 @@ func GenerateJWT(restaurant *models.Restaurant) (string, error) {
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Subject:   restaurant.ID,
-			Issuer:    "qr-menu-api",
+			Issuer:    jwtIssuer,
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Secret)
 }
 
 // ValidateJWT valida un token JWT
 func ValidateJWT(tokenString string) (*Claims, error) {
-	// Controlla se il token è stato revocato
-	if revokedTokens[tokenString] {
-		return nil, fmt.Errorf("token revocato")
+	if jwtKeys == nil {
+		return nil, fmt.Errorf("chiavi JWT non configurate")
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// La chiave è scelta dal kid: dopo una rotazione i token firmati con la chiave
+	// precedente restano validi fino alla scadenza
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("metodo di firma non valido")
 		}
-		return jwtSecret, nil
-	})
+		kid, _ := token.Header["kid"].(string)
+		return jwtKeys.Lookup(ctx, kid, time.Now())
+	}, jwt.WithIssuer(jwtIssuer))
 
 	if err != nil {
 		return nil, err
@@ -193,18 +205,43 @@ func ValidateJWT(tokenString string) (*Claims, error) {
 		return nil, fmt.Errorf("token non valido")
 	}
 
+	// Controlla se il token è stato revocato
+	revoked, err := db.MongoInstance.IsTokenRevoked(ctx, revocationID(tokenString))
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, fmt.Errorf("token revocato")
+	}
+
 	return claims, nil
 }
 
-// RevokeJWT revoca un token JWT
-func RevokeJWT(tokenString string) {
-	revokedTokens[tokenString] = true
+// RevokeJWT revoca un token JWT fino alla sua scadenza, anche dopo un riavvio
+func RevokeJWT(tokenString string) error {
+	expiresAt := time.Now().Add(jwtExpiry)
+	claims := &Claims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(tokenString, claims); err == nil && claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.RevokeToken(ctx, &models.RevokedToken{
+		ID:        revocationID(tokenString),
+		RevokedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return err
+	}
 
 	logger.AuditLog("TOKEN_REVOKED", "authentication",
 		"Token JWT revocato", "", "", "",
 		map[string]interface{}{
 			"token_hash": hashToken(tokenString),
 		})
+	return nil
 }
 
 // Middleware di autenticazione API
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/config"
+	"qr-menu/pkg/jwtkeys"
+	"qr-menu/security"
+)
+
+var (
+	// Chiavi di firma dei token, con kid nell'header e rotazione (vedi ConfigureJWT)
+	jwtKeys *jwtkeys.Keyring
+	// Durata degli access token: è anche la finestra in cui una chiave sostituita resta valida
+	jwtExpiry = 15 * time.Minute
+	// Durata dei refresh token, rinnovata a ogni refresh
+	jwtRefreshExpiry = 30 * 24 * time.Hour
+	jwtIssuer        = "qr-menu-api"
+)
+
+// ConfigureJWT carica dal database le chiavi di firma dei token, creando la prima se non ne
+// esistono. I segreti sono salvati cifrati con security.jwt_secret, che deve restare lo stesso
+// tra i riavvii e tra le istanze
+func ConfigureJWT(ctx context.Context, settings config.SecurityConfig) error {
+	if settings.JWTSecret == "" {
+		return fmt.Errorf("security.jwt_secret è obbligatorio per l'API")
+	}
+	if settings.JWTExpiry > 0 {
+		jwtExpiry = settings.JWTExpiry
+	}
+	if settings.JWTRefreshExpiry > 0 {
+		jwtRefreshExpiry = settings.JWTRefreshExpiry
+	}
+	if settings.JWTIssuer != "" {
+		jwtIssuer = settings.JWTIssuer
+	}
+
+	keys, err := jwtkeys.New(ctx, &mongoKeyStore{enc: security.NewEncryption(settings.JWTSecret)}, jwtExpiry)
+	if err != nil {
+		return err
+	}
+	jwtKeys = keys
+	return nil
+}
+
+// mongoKeyStore salva le chiavi di firma nella collection jwt_keys
+type mongoKeyStore struct {
+	enc *security.Encryption
+}
+
+func (s *mongoKeyStore) LoadKeys(ctx context.Context) ([]jwtkeys.Key, error) {
+	stored, err := db.MongoInstance.GetJWTSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]jwtkeys.Key, 0, len(stored))
+	for _, k := range stored {
+		plain, err := s.enc.Decrypt(k.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("chiave JWT %s non decifrabile (jwt_secret cambiato?): %v", k.ID, err)
+		}
+		secret, err := base64.StdEncoding.DecodeString(plain)
+		if err != nil {
+			return nil, fmt.Errorf("chiave JWT %s non valida: %v", k.ID, err)
+		}
+		key := jwtkeys.Key{ID: k.ID, Secret: secret, CreatedAt: k.CreatedAt}
+		if k.RetiredAt != nil {
+			key.RetiredAt = *k.RetiredAt
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *mongoKeyStore) SaveKey(ctx context.Context, key jwtkeys.Key) error {
+	sealed, err := s.enc.Encrypt(base64.StdEncoding.EncodeToString(key.Secret))
+	if err != nil {
+		return err
+	}
+	return db.MongoInstance.CreateJWTSigningKey(ctx, &models.JWTSigningKey{
+		ID:        key.ID,
+		Secret:    sealed,
+		CreatedAt: key.CreatedAt,
+	})
+}
+
+func (s *mongoKeyStore) RetireKey(ctx context.Context, id string, at time.Time) error {
+	return db.MongoInstance.RetireJWTSigningKey(ctx, id, at)
+}
+
+func (s *mongoKeyStore) DeleteKeysRetiredBefore(ctx context.Context, before time.Time) error {
+	return db.MongoInstance.DeleteJWTSigningKeysRetiredBefore(ctx, before)
+}
+
+// revocationID identifica un token nella lista di revoca senza salvarlo in chiaro
+func revocationID(tokenString string) string {
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])
+}
+
+// RotateJWTKeysHandler forza la rotazione delle chiavi di firma (POST /api/v1/admin/jwt/rotate).
+// I nuovi token sono firmati con la nuova chiave; quelli già emessi restano validi fino alla
+// scadenza. Da usare subito se si sospetta che una chiave sia stata compromessa insieme alla
+// revoca dei token interessati
+func RotateJWTKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if jwtKeys == nil {
+		ErrorResponse(w, http.StatusServiceUnavailable, "JWT_NOT_CONFIGURED",
+			"Chiavi JWT non configurate", "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	key, err := jwtKeys.Rotate(ctx)
+	if err != nil {
+		logger.Error("Errore nella rotazione delle chiavi JWT", map[string]interface{}{
+			"error": err.Error(),
+		})
+		ErrorResponse(w, http.StatusInternalServerError, "KEY_ROTATION_FAILED",
+			"Errore nella rotazione delle chiavi", "")
+		return
+	}
+
+	logger.AuditLog("JWT_KEYS_ROTATED", "authentication",
+		"Chiavi di firma JWT ruotate", GetRestaurantIDFromRequest(r), getClientIP(r), r.UserAgent(),
+		map[string]interface{}{
+			"kid": key.ID,
+		})
+
+	SuccessResponse(w, map[string]interface{}{
+		"kid":               key.ID,
+		"created_at":        key.CreatedAt.UTC().Format(time.RFC3339),
+		"previous_valid_to": key.CreatedAt.Add(jwtExpiry).UTC().Format(time.RFC3339),
+	}, nil)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+
+	"github.com/google/uuid"
+)
+
+// TokenPair è la coppia di token restituita da login, registrazione e refresh: l'access token
+// (JWT di breve durata) autentica le richieste, il refresh token serve solo a ottenerne di nuovi
+type TokenPair struct {
+	AccessToken      string `json:"token"`
+	ExpiresAt        string `json:"expires_at"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt string `json:"refresh_expires_at"`
+}
+
+// errRefreshTokenReused indica che è stato presentato un refresh token già sostituito
+var errRefreshTokenReused = fmt.Errorf("refresh token già utilizzato")
+
+// issueTokens genera un access token e un refresh token della famiglia indicata; familyID
+// vuoto avvia una nuova famiglia (login o registrazione)
+func issueTokens(ctx context.Context, restaurant *models.Restaurant, familyID string) (*TokenPair, error) {
+	accessToken, err := GenerateJWT(restaurant)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	refreshToken := hex.EncodeToString(secret)
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+
+	now := time.Now()
+	if err := db.MongoInstance.CreateRefreshToken(ctx, &models.RefreshToken{
+		ID:           uuid.New().String(),
+		Hash:         revocationID(refreshToken),
+		FamilyID:     familyID,
+		RestaurantID: restaurant.ID,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(jwtRefreshExpiry),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		ExpiresAt:        now.Add(jwtExpiry).UTC().Format(time.RFC3339),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: now.Add(jwtRefreshExpiry).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// useRefreshToken consuma un refresh token e restituisce il record. Se il token era già stato
+// usato o revocato qualcuno ne ha una copia: l'intera famiglia viene revocata e restituisce
+// errRefreshTokenReused. Restituisce nil, nil per token sconosciuti o scaduti
+func useRefreshToken(ctx context.Context, r *http.Request, refreshToken string) (*models.RefreshToken, error) {
+	hash := revocationID(refreshToken)
+	now := time.Now()
+
+	token, err := db.MongoInstance.UseRefreshToken(ctx, hash, now)
+	if err != nil || token != nil {
+		return token, err
+	}
+
+	previous, err := db.MongoInstance.GetRefreshTokenByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil || (previous.UsedAt == nil && previous.RevokedAt == nil) {
+		return nil, nil
+	}
+
+	if err := db.MongoInstance.RevokeRefreshTokenFamily(ctx, previous.FamilyID, now); err != nil {
+		return nil, err
+	}
+	logger.SecurityEvent("REFRESH_TOKEN_REUSE", "Refresh token riutilizzato: sessione revocata",
+		previous.RestaurantID, getClientIP(r), r.UserAgent(),
+		map[string]interface{}{
+			"family_id": previous.FamilyID,
+		})
+	return nil, errRefreshTokenReused
+}
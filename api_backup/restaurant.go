@@ -25,8 +25,7 @@ type LoginRequest struct {
 
 // LoginResponse rappresenta una risposta di login
 type LoginResponse struct {
-	Token      string             `json:"token"`
-	ExpiresAt  string             `json:"expires_at"`
+	TokenPair
 	Restaurant *models.Restaurant `json:"restaurant"`
 }
 
@@ -44,7 +43,7 @@ type RegisterRequest struct {
 
 // RefreshTokenRequest rappresenta una richiesta di refresh token
 type RefreshTokenRequest struct {
-	Token string `json:"token" validate:"required"`
+	RefreshToken string `json:"refresh_token" validate:"required"`
 }
 
 // ChangePasswordRequest rappresenta una richiesta di cambio password
@@ -126,8 +125,8 @@ func APILoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Genera JWT token
-	token, err := GenerateJWT(restaurant)
+	// Genera access token e refresh token
+	tokens, err := issueTokens(ctx, restaurant, "")
 	if err != nil {
 		logger.Error("Errore nella generazione del token JWT", map[string]interface{}{
 			"error":         err.Error(),
@@ -157,8 +156,7 @@ func APILoginHandler(w http.ResponseWriter, r *http.Request) {
 		})
 
 	response := LoginResponse{
-		Token:      token,
-		ExpiresAt:  time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+		TokenPair:  *tokens,
 		Restaurant: restaurant,
 	}
 
@@ -246,8 +244,8 @@ func APIRegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Genera JWT token
-	token, err := GenerateJWT(restaurant)
+	// Genera access token e refresh token
+	tokens, err := issueTokens(ctx, restaurant, "")
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "TOKEN_GENERATION_FAILED",
 			"Errore nella generazione del token", "")
@@ -263,15 +261,15 @@ func APIRegisterHandler(w http.ResponseWriter, r *http.Request) {
 		})
 
 	response := LoginResponse{
-		Token:      token,
-		ExpiresAt:  time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
+		TokenPair:  *tokens,
 		Restaurant: restaurant,
 	}
 
 	CreatedResponse(w, response)
 }
 
-// APIRefreshTokenHandler rinnova un token JWT
+// APIRefreshTokenHandler scambia un refresh token con una nuova coppia di token. Il refresh
+// token presentato viene sostituito: riusarlo revoca l'intera sessione
 func APIRefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	var req RefreshTokenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -279,31 +277,45 @@ func APIRefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 			"JSON non valido", err.Error())
 		return
 	}
-
-	// Valida il token esistente
-	claims, err := ValidateJWT(req.Token)
-	if err != nil {
-		ErrorResponse(w, http.StatusUnauthorized, "INVALID_TOKEN",
-			"Token non valido", err.Error())
+	if req.RefreshToken == "" {
+		ErrorResponse(w, http.StatusBadRequest, "VALIDATION_ERROR",
+			"refresh_token richiesto", "")
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
+	previous, err := useRefreshToken(ctx, r, req.RefreshToken)
+	if err == errRefreshTokenReused {
+		ErrorResponse(w, http.StatusUnauthorized, "REFRESH_TOKEN_REUSED",
+			"Refresh token già utilizzato", "La sessione è stata revocata: effettuare di nuovo il login")
+		return
+	}
+	if err != nil {
+		logger.Error("Errore nella verifica del refresh token", map[string]interface{}{
+			"error": err.Error(),
+		})
+		ErrorResponse(w, http.StatusInternalServerError, "TOKEN_REFRESH_FAILED",
+			"Errore nel rinnovo del token", "")
+		return
+	}
+	if previous == nil {
+		ErrorResponse(w, http.StatusUnauthorized, "INVALID_REFRESH_TOKEN",
+			"Refresh token non valido o scaduto", "")
+		return
+	}
+
 	// Trova il ristorante da MongoDB
-	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, claims.RestaurantID)
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, previous.RestaurantID)
 	if err != nil || restaurant == nil || !restaurant.IsActive {
 		ErrorResponse(w, http.StatusUnauthorized, "RESTAURANT_NOT_FOUND",
 			"Ristorante non trovato o disattivato", "")
 		return
 	}
 
-	// Revoca il token vecchio
-	RevokeJWT(req.Token)
-
-	// Genera nuovo token
-	newToken, err := GenerateJWT(restaurant)
+	// Genera la nuova coppia nella stessa famiglia
+	tokens, err := issueTokens(ctx, restaurant, previous.FamilyID)
 	if err != nil {
 		ErrorResponse(w, http.StatusInternalServerError, "TOKEN_GENERATION_FAILED",
 			"Errore nella generazione del nuovo token", "")
@@ -313,24 +325,24 @@ func APIRefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
 	logger.AuditLog("TOKEN_REFRESHED", "authentication",
 		"Token JWT rinnovato", restaurant.ID, getClientIP(r), r.UserAgent(),
 		map[string]interface{}{
-			"old_token_hash": hashToken(req.Token),
-			"new_token_hash": hashToken(newToken),
+			"family_id":      previous.FamilyID,
+			"new_token_hash": hashToken(tokens.AccessToken),
 		})
 
-	response := map[string]interface{}{
-		"token":      newToken,
-		"expires_at": time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339),
-	}
-
-	SuccessResponse(w, response, nil)
+	SuccessResponse(w, tokens, nil)
 }
 
-// APILogoutHandler gestisce il logout (revoca token)
+// APILogoutHandler gestisce il logout: revoca l'access token e, se presente nel corpo, la
+// sessione del refresh token
 func APILogoutHandler(w http.ResponseWriter, r *http.Request) {
 	authHeader := r.Header.Get("Authorization")
 	if len(authHeader) > 7 {
 		tokenString := authHeader[7:]
-		RevokeJWT(tokenString)
+		if err := RevokeJWT(tokenString); err != nil {
+			ErrorResponse(w, http.StatusInternalServerError, "TOKEN_REVOCATION_FAILED",
+				"Errore nella revoca del token", "")
+			return
+		}
 
 		logger.AuditLog("API_LOGOUT", "authentication",
 			"Logout API", GetRestaurantIDFromRequest(r), getClientIP(r), r.UserAgent(),
@@ -339,6 +351,22 @@ func APILogoutHandler(w http.ResponseWriter, r *http.Request) {
 			})
 	}
 
+	var req RefreshTokenRequest
+	if json.NewDecoder(r.Body).Decode(&req) == nil && req.RefreshToken != "" {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		token, err := db.MongoInstance.GetRefreshTokenByHash(ctx, revocationID(req.RefreshToken))
+		if err == nil && token != nil && token.RestaurantID == GetRestaurantIDFromRequest(r) {
+			err = db.MongoInstance.RevokeRefreshTokenFamily(ctx, token.FamilyID, time.Now())
+		}
+		if err != nil {
+			ErrorResponse(w, http.StatusInternalServerError, "TOKEN_REVOCATION_FAILED",
+				"Errore nella revoca del refresh token", "")
+			return
+		}
+	}
+
 	SuccessResponse(w, map[string]string{"message": "Logout completato"}, nil)
 }
 
@@ -487,6 +515,14 @@ func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Le sessioni aperte con la vecchia password non possono più rinnovare i token
+	if err := db.MongoInstance.RevokeRefreshTokensByRestaurant(ctx, restaurantID, time.Now()); err != nil {
+		logger.Error("Errore nella revoca dei refresh token", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurantID,
+		})
+	}
+
 	logger.AuditLog("PASSWORD_CHANGED", "authentication",
 		"Password cambiata via API", restaurantID, getClientIP(r), r.UserAgent(), nil)
 
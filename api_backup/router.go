@@ -38,6 +38,9 @@ func SetupAPIRoutes(r *mux.Router) {
 	protected.HandleFunc("/auth/logout", APILogoutHandler).Methods("POST")
 	protected.HandleFunc("/auth/change-password", ChangePasswordHandler).Methods("POST")
 
+	// Admin: rotazione forzata delle chiavi di firma dei token
+	protected.HandleFunc("/admin/jwt/rotate", RequirePermissions(PermAuthRotateKeys)(RotateJWTKeysHandler)).Methods("POST")
+
 	// Restaurant endpoints
 	protected.HandleFunc("/restaurant/profile", RequirePermissions(PermRestaurantRead)(GetRestaurantProfileHandler)).Methods("GET")
 	protected.HandleFunc("/restaurant/profile", RequirePermissions(PermRestaurantWrite)(UpdateRestaurantProfileHandler)).Methods("PUT")
@@ -343,6 +346,7 @@ func APIDocsHandler(w http.ResponseWriter, r *http.Request) {
 func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	// Verifica connessione MongoDB
 	dbStatus := "disconnected"
+	stats := map[string]interface{}{}
 	if db.MongoInstance != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 		defer cancel()
@@ -350,6 +354,9 @@ func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 		if err := db.MongoInstance.Ping(ctx); err == nil {
 			dbStatus = "connected"
 		}
+		if revoked, err := db.MongoInstance.CountRevokedTokens(ctx); err == nil {
+			stats["revoked_tokens"] = revoked
+		}
 	}
 
 	health := map[string]interface{}{
@@ -363,9 +370,7 @@ func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 			"logging":        "running",
 			"rate_limiting":  "running",
 		},
-		"stats": map[string]interface{}{
-			"active_tokens": len(revokedTokens),
-		},
+		"stats": stats,
 	}
 
 	SuccessResponse(w, health, nil)
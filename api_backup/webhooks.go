@@ -18,6 +18,7 @@ import (
 
 	"qr-menu/logger"
 	"qr-menu/models"
+	"qr-menu/pkg/i18n"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -39,12 +40,15 @@ type createWebhookRequest struct {
 	URL    string   `json:"url"`
 	Events []string `json:"events"`
 	Secret string   `json:"secret"`
+	Locale string   `json:"locale"`
 	Active *bool    `json:"active"`
 }
 
 type webhookPayload struct {
 	ID        string      `json:"id"`
 	Type      string      `json:"type"`
+	Locale    string      `json:"locale"`
+	Message   string      `json:"message,omitempty"` // Human-readable summary in the endpoint's locale
 	Data      interface{} `json:"data"`
 	CreatedAt string      `json:"created_at"`
 }
@@ -71,6 +75,12 @@ func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	locale := strings.TrimSpace(req.Locale)
+	if locale != "" && !i18n.Default().Supported(locale) {
+		ErrorResponse(w, http.StatusBadRequest, "INVALID_LOCALE", "Lingua non supportata", locale)
+		return
+	}
+
 	secret := strings.TrimSpace(req.Secret)
 	if secret == "" {
 		secret = generateWebhookSecret()
@@ -88,6 +98,7 @@ func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
 		URL:          endpointURL,
 		Events:       events,
 		Secret:       secret,
+		Locale:       i18n.Default().Resolve(locale),
 		IsActive:     isActive,
 		CreatedAt:    now,
 		UpdatedAt:    now,
@@ -228,9 +239,14 @@ func deliverEvent(endpoint *models.WebhookEndpoint, event *models.WebhookEvent)
 	payload := webhookPayload{
 		ID:        event.ID,
 		Type:      event.Type,
+		Locale:    i18n.Default().Resolve(endpoint.Locale),
 		Data:      event.Data,
 		CreatedAt: event.CreatedAt.UTC().Format(time.RFC3339),
 	}
+	if msg, err := renderEventMessage(endpoint.Locale, event); err == nil {
+		payload.Locale = msg.Locale
+		payload.Message = msg.Body
+	}
 
 	body, err := json.Marshal(payload)
 	if err != nil {
@@ -242,6 +258,20 @@ func deliverEvent(endpoint *models.WebhookEndpoint, event *models.WebhookEvent)
 	deliverWithRetry(endpoint, event.Type, body, attempt)
 }
 
+// renderEventMessage renders the summary of an event through the localization catalog.
+// Templates address the event data by its JSON field names
+func renderEventMessage(locale string, event *models.WebhookEvent) (i18n.Message, error) {
+	var data map[string]interface{}
+	raw, err := json.Marshal(event.Data)
+	if err != nil {
+		return i18n.Message{}, err
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		data = map[string]interface{}{}
+	}
+	return i18n.Default().Render(locale, i18n.WebhookKey(event.Type), data)
+}
+
 func deliverWithRetry(endpoint *models.WebhookEndpoint, eventType string, body []byte, attempt int) {
 	timestamp := time.Now().UTC().Format(time.RFC3339)
 	signature := signWebhookPayload(endpoint.Secret, timestamp, body)
@@ -257,6 +287,7 @@ func deliverWithRetry(endpoint *models.WebhookEndpoint, eventType string, body [
 	req.Header.Set("X-Webhook-Event", eventType)
 	req.Header.Set("X-Webhook-Timestamp", timestamp)
 	req.Header.Set("X-Webhook-Signature", signature)
+	req.Header.Set("Content-Language", i18n.Default().Resolve(endpoint.Locale))
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
@@ -295,6 +326,7 @@ func recordDelivery(endpoint *models.WebhookEndpoint, eventType, status string,
 		WebhookID:    endpoint.ID,
 		RestaurantID: endpoint.RestaurantID,
 		EventType:    eventType,
+		Locale:       i18n.Default().Resolve(endpoint.Locale),
 		Status:       status,
 		Attempt:      attempt,
 		LastError:    errMsg,
@@ -2,17 +2,46 @@ package backup
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"qr-menu/logger"
+	"qr-menu/pkg/avscan"
+	"qr-menu/pkg/events"
+	"qr-menu/pkg/metrics"
+	"qr-menu/pkg/storage"
 )
 
+var (
+	backupDuration = metrics.NewHistogram("qrmenu_backup_duration_seconds",
+		"Duration of backup creations and restores.", []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800}, "operation")
+	backupRuns = metrics.NewCounter("qrmenu_backups_total",
+		"Backup creations and restores by result (success or error).", "operation", "result")
+	backupUploads = metrics.NewCounter("qrmenu_backup_uploads_total",
+		"Backup archives copied to the remote targets by target and result (success or error).", "target", "result")
+)
+
+// observeBackup registra durata ed esito di un'operazione di backup; va usata in defer
+func observeBackup(operation string, start time.Time, err *error) {
+	result := "success"
+	if *err != nil {
+		result = "error"
+	}
+	backupRuns.Inc(operation, result)
+	backupDuration.ObserveDuration(start, operation)
+}
+
 // BackupManager gestisce i backup automatici del sistema
 type BackupManager struct {
 	mu                sync.Mutex
@@ -22,28 +51,49 @@ type BackupManager struct {
 	lastBackupTime    time.Time
 	isRunning         bool
 	backupSchedule    time.Duration
-	directoriesBackup []string // Directory da backuppare
+	directoriesBackup []string          // Directory da backuppare
+	store             storage.BlobStore // Destinazione degli archivi zip (default: basePath locale)
+	guard             *avscan.Guard     // Scansione antivirus degli archivi prima del restore (nil = disattivata)
+	targets           []Target          // Destinazioni remote in cui copiare ogni archivio
+	tenants           TenantData        // Dati dei singoli ristoranti per i backup per ristorante
+	fullEvery         int               // Incrementali consecutivi prima di un backup completo (0 = nessun limite)
+	schedulerMu       sync.Mutex        // Protegge lo stato dello scheduler (mu resta bloccato durante un backup)
+	stopCh            chan struct{}     // Chiuso da Shutdown per fermare lo scheduler
+	doneCh            chan struct{}     // Chiuso quando lo scheduler è terminato
+	reloadCh          chan struct{}     // Sveglia lo scheduler quando cambiano le pianificazioni
+	schedules         []*scheduledBackup
+	scheduleRuns      map[string]ScheduleRun // Ultima esecuzione per nome di pianificazione
+	defaultSchedules  []Schedule             // Pianificazioni della configurazione
+	customSchedules   bool                   // Pianificazioni impostate via API (vedi SetSchedules)
+	scheduleStore     storage.BlobStore      // Dove salvare schedules.json senza attendere mu
 }
 
 // BackupMetadata contiene informazioni su un backup
 type BackupMetadata struct {
 	ID           string    `json:"id"`
+	Kind         string    `json:"kind"`                    // full, incremental, restaurant
+	RestaurantID string    `json:"restaurant_id,omitempty"` // Solo per i backup di un ristorante
 	Timestamp    time.Time `json:"timestamp"`
 	Size         int64     `json:"size"`
-	Status       string    `json:"status"`   // success, failed, partial
-	Duration     int64     `json:"duration"` // millisecondi
-	FileCount    int       `json:"file_count"`
-	CompressRate float64   `json:"compress_rate"`
-	Hash         string    `json:"hash"` // SHA256 per integrità
+	Status       string    `json:"status"`        // success, failed, partial
+	Duration     int64     `json:"duration"`      // millisecondi
+	FileCount    int       `json:"file_count"`    // File salvati nell'archivio
+	CompressRate float64   `json:"compress_rate"` // Dimensione dell'archivio / dimensione originale dei file
+	Hash         string    `json:"hash"`          // SHA256 dell'archivio per integrità
+}
+
+// Target è una destinazione remota (S3, SFTP, Google Drive) in cui viene copiato ogni archivio
+// dopo la creazione, così i backup sopravvivono alla perdita del disco del server
+type Target struct {
+	Name      string
+	Store     storage.BlobStore
+	Retention Retention
 }
 
-// BackupSchedule definisce la pianificazione dei backup
-type BackupSchedule struct {
-	Type       string        // "hourly", "daily", "weekly", "monthly"
-	Interval   time.Duration // Intervallo custom
-	Hour       int           // Ora del giorno (0-23)
-	Day        int           // Giorno della settimana (0-6) per weekly
-	DayOfMonth int           // Giorno del mese (1-31) per monthly
+// Retention limita i backup conservati su una destinazione; i valori zero non limitano
+type Retention struct {
+	MaxBackups int           // Numero massimo di archivi, i più recenti
+	MaxAge     time.Duration // Età massima di un archivio
 }
 
 var (
@@ -68,6 +118,56 @@ func GetBackupManager() *BackupManager {
 	return defaultManager
 }
 
+// SetBlobStore imposta lo storage in cui vengono salvati gli archivi di backup
+func (bm *BackupManager) SetBlobStore(store storage.BlobStore) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.store = store
+}
+
+// SetScanGuard imposta la scansione antivirus degli archivi prima del restore
+func (bm *BackupManager) SetScanGuard(guard *avscan.Guard) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.guard = guard
+}
+
+// SetTargets imposta le destinazioni remote dei backup
+func (bm *BackupManager) SetTargets(targets []Target) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.targets = targets
+}
+
+// TargetNames restituisce i nomi delle destinazioni remote configurate
+func (bm *BackupManager) TargetNames() []string {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	names := make([]string, 0, len(bm.targets))
+	for _, t := range bm.targets {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+// target restituisce la destinazione remota con il nome indicato; va chiamata con bm.mu bloccato
+func (bm *BackupManager) target(name string) (Target, error) {
+	for _, t := range bm.targets {
+		if t.Name == name {
+			return t, nil
+		}
+	}
+	return Target{}, fmt.Errorf("destinazione di backup sconosciuta: %s", name)
+}
+
+// blobStore restituisce lo storage configurato o, in mancanza, la cartella basePath locale
+func (bm *BackupManager) blobStore() storage.BlobStore {
+	if bm.store == nil {
+		return storage.NewLocalStore(bm.basePath, "")
+	}
+	return bm.store
+}
+
 // Init inizializza il backup manager
 func (bm *BackupManager) Init(basePath string, maxBackups int) error {
 	bm.mu.Lock()
@@ -81,6 +181,17 @@ func (bm *BackupManager) Init(basePath string, maxBackups int) error {
 		return fmt.Errorf("errore creazione directory backup: %w", err)
 	}
 
+	// L'ultimo backup sopravvive ai riavvii grazie all'indice
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if index, err := bm.loadIndex(ctx); err == nil {
+		for _, entry := range index {
+			if entry.Kind != KindRestaurant && entry.Timestamp.After(bm.lastBackupTime) {
+				bm.lastBackupTime = entry.Timestamp
+			}
+		}
+	}
+
 	logger.Info("Backup manager inizializzato", map[string]interface{}{
 		"path":        bm.basePath,
 		"max_backups": bm.maxBackups,
@@ -90,135 +201,244 @@ func (bm *BackupManager) Init(basePath string, maxBackups int) error {
 	return nil
 }
 
-// StartScheduled avvia il backup automatico schedulato
-func (bm *BackupManager) StartScheduled(schedule BackupSchedule) error {
-	bm.mu.Lock()
-	if bm.isRunning {
-		bm.mu.Unlock()
-		return fmt.Errorf("backup scheduler già in esecuzione")
-	}
-	bm.isRunning = true
-	bm.mu.Unlock()
-
-	// Calcola il prossimo tempo di backup
-	nextBackup := bm.calculateNextBackupTime(schedule)
-
-	logger.Info("Backup scheduler avviato", map[string]interface{}{
-		"schedule":    schedule.Type,
-		"next_backup": nextBackup,
-	})
-
-	// Goroutine per scheduling
-	go func() {
-		ticker := time.NewTicker(1 * time.Minute) // Controlla ogni minuto
-		defer ticker.Stop()
-
-		for range ticker.C {
-			if time.Now().After(nextBackup) {
-				// È ora di fare il backup
-				backupID, err := bm.CreateBackup()
-				if err != nil {
-					logger.Error("Errore nel backup automatico", map[string]interface{}{
-						"error": err.Error(),
-					})
-				} else {
-					logger.Info("Backup automatico completato", map[string]interface{}{
-						"backup_id": backupID,
-					})
-				}
-
-				// Calcola il prossimo backup
-				nextBackup = bm.calculateNextBackupTime(schedule)
-			}
-		}
-	}()
-
-	return nil
+// CreateBackup crea un backup manuale completo
+func (bm *BackupManager) CreateBackup() (string, error) {
+	return bm.createBackup(KindFull, "")
 }
 
-// CreateBackup crea un backup manuale
-func (bm *BackupManager) CreateBackup() (string, error) {
+// createBackup crea un backup del tipo indicato; restaurantID vale solo per KindRestaurant
+func (bm *BackupManager) createBackup(kind, restaurantID string) (string, error) {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
+	return bm.createBackupLocked(kind, restaurantID)
+}
+
+// createBackupLocked è createBackup con bm.mu già bloccato
+func (bm *BackupManager) createBackupLocked(kind, restaurantID string) (_ string, err error) {
+	defer observeBackup("create", time.Now(), &err)
 
-	backupID := fmt.Sprintf("backup-%d", time.Now().Unix())
 	startTime := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	var previous *Manifest
+	if kind == KindIncremental {
+		if previous = bm.incrementalBase(ctx); previous == nil {
+			kind = KindFull
+		}
+	}
+	backupID := newBackupID(kind, restaurantID, startTime)
 
 	logger.Info("Inizio backup", map[string]interface{}{
-		"backup_id": backupID,
+		"backup_id":     backupID,
+		"kind":          kind,
+		"restaurant_id": restaurantID,
 	})
 
-	// Crea un file zip contenente tutti i dati
-	var zipPath string
-	if bm.compressBackups {
-		zipPath = filepath.Join(bm.basePath, backupID+".zip")
-	} else {
-		zipPath = filepath.Join(bm.basePath, backupID)
+	metadata := BackupMetadata{
+		ID:           backupID,
+		Kind:         kind,
+		RestaurantID: restaurantID,
+		Timestamp:    startTime,
+		Status:       "success",
 	}
 
-	if bm.compressBackups {
-		err := bm.createCompressedBackup(zipPath, backupID)
-		if err != nil {
-			logger.Error("Errore nel backup compresso", map[string]interface{}{
-				"backup_id": backupID,
-				"error":     err.Error(),
-			})
-			return "", err
-		}
-	} else {
-		err := bm.createUncompressedBackup(zipPath, backupID)
-		if err != nil {
-			logger.Error("Errore nel backup non compresso", map[string]interface{}{
-				"backup_id": backupID,
-				"error":     err.Error(),
-			})
-			return "", err
+	// Crea un file zip contenente i dati
+	var uploaded []string
+	switch {
+	case bm.compressBackups:
+		uploaded, err = bm.createCompressedBackup(ctx, &metadata, previous)
+	case kind == KindFull:
+		backupDir := filepath.Join(bm.basePath, backupID)
+		if err = bm.createUncompressedBackup(backupDir, backupID); err == nil {
+			metadata.FileCount, metadata.Size, err = dirStats(backupDir)
+			metadata.CompressRate = 1
 		}
+	default:
+		err = fmt.Errorf("i backup %s richiedono la compressione degli archivi", kind)
+	}
+	if err != nil {
+		logger.Error("Errore nel backup", map[string]interface{}{
+			"backup_id":  backupID,
+			"kind":       kind,
+			"compressed": bm.compressBackups,
+			"error":      err.Error(),
+		})
+		events.Default().Publish(events.Event{
+			Type: events.BackupFailed,
+			Data: map[string]interface{}{
+				"backup_id":     backupID,
+				"kind":          kind,
+				"restaurant_id": restaurantID,
+				"error":         err.Error(),
+			},
+		})
+		return "", err
 	}
 
 	// Registra i metadati del backup
 	duration := time.Since(startTime).Milliseconds()
-	metadata := BackupMetadata{
-		ID:        backupID,
-		Timestamp: startTime,
-		Status:    "success",
-		Duration:  duration,
-	}
+	metadata.Duration = duration
+	bm.saveBackupMetadata(metadata)
 
-	bm.lastBackupTime = startTime
+	if kind != KindRestaurant {
+		bm.lastBackupTime = startTime
+	}
 
-	// Pulisci i backup vecchi
-	err := bm.cleanupOldBackups()
-	if err != nil {
+	// Pulisci i backup vecchi, in locale e sulle destinazioni remote
+	if err := bm.cleanupOldBackups(); err != nil {
 		logger.Warn("Errore nella pulizia backup vecchi", map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
+	for _, name := range uploaded {
+		bm.applyRetention(name)
+	}
 
 	logger.Info("Backup completato", map[string]interface{}{
-		"backup_id":   backupID,
-		"duration_ms": duration,
-		"compressed":  bm.compressBackups,
+		"backup_id":     backupID,
+		"kind":          kind,
+		"restaurant_id": restaurantID,
+		"duration_ms":   duration,
+		"size":          metadata.Size,
+		"file_count":    metadata.FileCount,
+		"compressed":    bm.compressBackups,
+		"uploaded_to":   uploaded,
 	})
 
-	// Salva i metadati
-	bm.saveBackupMetadata(metadata)
+	events.Default().Publish(events.Event{
+		Type: events.BackupCompleted,
+		Data: map[string]interface{}{
+			"backup_id":     backupID,
+			"kind":          kind,
+			"restaurant_id": restaurantID,
+			"duration_ms":   duration,
+			"compressed":    bm.compressBackups,
+			"uploaded_to":   uploaded,
+		},
+	})
 
 	return backupID, nil
 }
 
-// createCompressedBackup crea un backup compresso
-func (bm *BackupManager) createCompressedBackup(zipPath string, backupID string) error {
-	zipFile, err := os.Create(zipPath)
+// createCompressedBackup crea un backup compresso in un file temporaneo, lo carica nel blob
+// store insieme al manifest e lo copia sulle destinazioni remote, completando metadata con
+// dimensione, numero di file, compressione e hash dell'archivio. Restituisce le destinazioni su
+// cui la copia è riuscita: un errore di upload remoto non fa fallire il backup, che resta nel
+// blob store
+func (bm *BackupManager) createCompressedBackup(ctx context.Context, metadata *BackupMetadata, previous *Manifest) ([]string, error) {
+	backupID := metadata.ID
+	store := bm.blobStore()
+	// Gli ID hanno la risoluzione del secondo: un secondo backup nello stesso istante
+	// sovrascriverebbe il primo, da cui un incrementale potrebbe dipendere
+	if exists, err := store.Exists(ctx, backupID+".zip"); err != nil || exists {
+		if err == nil {
+			err = fmt.Errorf("backup %s già presente, riprovare tra qualche secondo", backupID)
+		}
+		return nil, err
+	}
+
+	zipFile, err := os.CreateTemp("", backupID+"-*.zip")
 	if err != nil {
-		return fmt.Errorf("errore creazione zip: %w", err)
+		return nil, fmt.Errorf("errore creazione zip: %w", err)
 	}
+	defer os.Remove(zipFile.Name())
 	defer zipFile.Close()
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer zipWriter.Close()
+	manifest := &Manifest{
+		BackupID:     backupID,
+		Kind:         metadata.Kind,
+		RestaurantID: metadata.RestaurantID,
+		CreatedAt:    time.Now().UTC(),
+		Files:        map[string]ManifestEntry{},
+	}
+	if previous != nil {
+		manifest.Chain = previous.Chain + 1
+	}
+
+	var manifestData []byte
+	if metadata.Kind == KindRestaurant {
+		manifestData, err = bm.writeRestaurantZip(ctx, zipFile, manifest)
+	} else {
+		manifestData, err = bm.writeZip(zipFile, manifest, previous)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := zipFile.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("errore stat zip: %w", err)
+	}
+	h := sha256.New()
+	if _, err := zipFile.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("errore lettura zip: %w", err)
+	}
+	if _, err := io.Copy(h, zipFile); err != nil {
+		return nil, fmt.Errorf("errore lettura zip: %w", err)
+	}
+	metadata.Size = info.Size()
+	metadata.Hash = hex.EncodeToString(h.Sum(nil))
+	metadata.FileCount, metadata.CompressRate = archiveStats(manifest, info.Size())
+	if _, err := zipFile.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("errore lettura zip: %w", err)
+	}
+
+	if err := store.Put(ctx, backupID+".zip", zipFile, info.Size(), "application/zip"); err != nil {
+		return nil, fmt.Errorf("errore upload backup: %w", err)
+	}
+	if err := store.Put(ctx, manifestKey(backupID), bytes.NewReader(manifestData), int64(len(manifestData)), "application/json"); err != nil {
+		return nil, fmt.Errorf("errore upload manifest: %w", err)
+	}
+
+	var uploaded []string
+	for _, target := range bm.targets {
+		if err := bm.uploadToTarget(target, backupID, zipFile, info.Size(), manifestData); err != nil {
+			backupUploads.Inc(target.Name, "error")
+			logger.Error("Errore copia backup sulla destinazione remota", map[string]interface{}{
+				"backup_id": backupID,
+				"target":    target.Name,
+				"error":     err.Error(),
+			})
+			continue
+		}
+		backupUploads.Inc(target.Name, "success")
+		uploaded = append(uploaded, target.Name)
+	}
+
+	return uploaded, nil
+}
+
+// uploadToTarget copia l'archivio, rileggendolo dall'inizio, e il suo manifest su una
+// destinazione remota
+func (bm *BackupManager) uploadToTarget(target Target, backupID string, zipFile *os.File, size int64, manifest []byte) error {
+	if _, err := zipFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("errore lettura zip: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	start := time.Now()
+	if err := target.Store.Put(ctx, backupID+".zip", zipFile, size, "application/zip"); err != nil {
+		return err
+	}
+	if err := target.Store.Put(ctx, manifestKey(backupID), bytes.NewReader(manifest), int64(len(manifest)), "application/json"); err != nil {
+		return err
+	}
+	logger.Info("Backup copiato sulla destinazione remota", map[string]interface{}{
+		"backup_id":   backupID,
+		"target":      target.Name,
+		"size":        size,
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+	return nil
+}
 
-	fileCount := 0
+// writeZip scrive nello zip le directory da backuppare e il manifest, che restituisce. Con un
+// manifest precedente vengono aggiunti solo i file nuovi o cambiati: gli altri restano negli
+// archivi indicati dal manifest
+func (bm *BackupManager) writeZip(w io.Writer, manifest *Manifest, previous *Manifest) ([]byte, error) {
+	zipWriter := zip.NewWriter(w)
 
 	// Aggiungi ogni directory al backup
 	for _, dir := range bm.directoriesBackup {
@@ -232,6 +452,12 @@ func (bm *BackupManager) createCompressedBackup(zipPath string, backupID string)
 				return nil
 			}
 
+			name := filepath.ToSlash(path)
+			if entry, ok, err := unchangedEntry(previous, name, path, info); err != nil || ok {
+				manifest.Files[name] = entry
+				return err
+			}
+
 			// Apri il file
 			fileData, err := os.Open(path)
 			if err != nil {
@@ -244,7 +470,7 @@ func (bm *BackupManager) createCompressedBackup(zipPath string, backupID string)
 			if err != nil {
 				return err
 			}
-			header.Name = filepath.Join(backupID, path)
+			header.Name = manifest.BackupID + "/" + name
 			header.Method = zip.Deflate
 
 			writer, err := zipWriter.CreateHeader(header)
@@ -252,17 +478,29 @@ func (bm *BackupManager) createCompressedBackup(zipPath string, backupID string)
 				return err
 			}
 
-			_, err = io.Copy(writer, fileData)
-			fileCount++
+			h := sha256.New()
+			size, err := io.Copy(io.MultiWriter(writer, h), fileData)
+			manifest.Files[name] = ManifestEntry{
+				Size:    size,
+				ModTime: info.ModTime(),
+				SHA256:  hex.EncodeToString(h.Sum(nil)),
+				Archive: manifest.BackupID,
+			}
 			return err
 		})
 
 		if err != nil {
-			return fmt.Errorf("errore durante backup di %s: %w", dir, err)
+			zipWriter.Close()
+			return nil, fmt.Errorf("errore durante backup di %s: %w", dir, err)
 		}
 	}
 
-	return nil
+	data, err := writeManifest(zipWriter, manifest)
+	if err != nil {
+		zipWriter.Close()
+		return nil, fmt.Errorf("errore scrittura manifest: %w", err)
+	}
+	return data, zipWriter.Close()
 }
 
 // createUncompressedBackup crea un backup non compresso (copia)
@@ -288,6 +526,9 @@ func (bm *BackupManager) copyDirectory(src, dst string) error {
 	if err != nil {
 		return err
 	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
 
 	for _, entry := range entries {
 		srcPath := filepath.Join(src, entry.Name())
@@ -328,121 +569,159 @@ func (bm *BackupManager) copyFile(src, dst string) error {
 	return err
 }
 
-// RestoreBackup ripristina un backup
-func (bm *BackupManager) RestoreBackup(backupID string, restorePath string) error {
-	bm.mu.Lock()
-	defer bm.mu.Unlock()
-
-	logger.Info("Inizio restore backup", map[string]interface{}{
-		"backup_id":    backupID,
-		"restore_path": restorePath,
-	})
+// downloadBackup copia l'archivio in un file temporaneo; va chiamata con bm.mu bloccato
+func (bm *BackupManager) downloadBackup(backupID, target string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
 
-	// Trova il file backup
-	var backupFile string
-	backups, err := os.ReadDir(bm.basePath)
+	blob, _, err := bm.openBackup(ctx, backupID, target)
 	if err != nil {
-		return fmt.Errorf("errore lettura directory backup: %w", err)
+		return "", err
 	}
+	defer blob.Close()
 
-	for _, backup := range backups {
-		if strings.Contains(backup.Name(), backupID) {
-			backupFile = filepath.Join(bm.basePath, backup.Name())
-			break
-		}
+	tmp, err := os.CreateTemp("", backupID+"-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("errore creazione file temporaneo: %w", err)
 	}
+	defer tmp.Close()
 
-	if backupFile == "" {
-		return fmt.Errorf("backup non trovato: %s", backupID)
+	if _, err := io.Copy(tmp, blob); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("errore download backup: %w", err)
 	}
 
-	// Se è un file zip, estrai
-	if strings.HasSuffix(backupFile, ".zip") {
-		err := bm.extractZipBackup(backupFile, restorePath)
+	return tmp.Name(), nil
+}
+
+// OpenBackup apre l'archivio di un backup per scaricarlo, dalla destinazione remota indicata o,
+// se target è vuoto, dal blob store con ripiego sulle destinazioni remote. Restituisce anche il
+// nome della destinazione da cui viene letto ("" per il blob store)
+func (bm *BackupManager) OpenBackup(ctx context.Context, backupID, target string) (io.ReadCloser, string, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return bm.openBackup(ctx, backupID, target)
+}
+
+// openBackup va chiamata con bm.mu bloccato; la lettura dell'archivio non richiede il lock
+func (bm *BackupManager) openBackup(ctx context.Context, backupID, target string) (io.ReadCloser, string, error) {
+	key := backupID + ".zip"
+	if target != "" {
+		t, err := bm.target(target)
+		if err != nil {
+			return nil, "", err
+		}
+		blob, err := t.Store.Get(ctx, key)
+		if err == storage.ErrNotFound {
+			return nil, "", fmt.Errorf("backup non trovato su %s: %s", target, backupID)
+		}
 		if err != nil {
-			logger.Error("Errore estrazione backup", map[string]interface{}{
+			return nil, "", fmt.Errorf("errore download backup da %s: %w", target, err)
+		}
+		return blob, target, nil
+	}
+
+	blob, err := bm.blobStore().Get(ctx, key)
+	if err == nil {
+		return blob, "", nil
+	}
+	if err != storage.ErrNotFound {
+		return nil, "", fmt.Errorf("errore download backup: %w", err)
+	}
+	// Il disco locale potrebbe essere stato perso: cerca l'archivio sulle destinazioni remote
+	for _, t := range bm.targets {
+		blob, err := t.Store.Get(ctx, key)
+		if err == nil {
+			logger.Info("Backup scaricato dalla destinazione remota", map[string]interface{}{
 				"backup_id": backupID,
-				"error":     err.Error(),
+				"target":    t.Name,
 			})
-			return err
+			return blob, t.Name, nil
 		}
-	} else {
-		// Altrimenti è una directory, copia da lì
-		err := bm.copyDirectory(backupFile, restorePath)
-		if err != nil {
-			logger.Error("Errore copia backup", map[string]interface{}{
+		if err != storage.ErrNotFound {
+			logger.Warn("Errore lettura backup dalla destinazione remota", map[string]interface{}{
 				"backup_id": backupID,
+				"target":    t.Name,
 				"error":     err.Error(),
 			})
-			return err
 		}
 	}
+	return nil, "", fmt.Errorf("backup non trovato: %s", backupID)
+}
 
-	logger.Info("Restore backup completato", map[string]interface{}{
-		"backup_id": backupID,
-	})
-
-	return nil
+// ListBackups elenca tutti i backup disponibili, dal più recente
+func (bm *BackupManager) ListBackups() ([]BackupMetadata, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return bm.listBackups()
 }
 
-// extractZipBackup estrae un backup compresso
-func (bm *BackupManager) extractZipBackup(zipPath string, destPath string) error {
-	zipFile, err := os.Open(zipPath)
+// ListTargetBackups elenca i backup conservati su una destinazione remota, dal più recente
+func (bm *BackupManager) ListTargetBackups(target string) ([]BackupMetadata, error) {
+	bm.mu.Lock()
+	t, err := bm.target(target)
+	bm.mu.Unlock()
 	if err != nil {
-		return fmt.Errorf("errore apertura zip: %w", err)
+		return nil, err
 	}
-	defer zipFile.Close()
-
-	stat, err := zipFile.Stat()
+	backups, err := listArchives(t.Store)
 	if err != nil {
-		return fmt.Errorf("errore stat zip: %w", err)
+		return nil, err
 	}
 
-	zipReader, err := zip.NewReader(zipFile, stat.Size())
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	return bm.withIndex(backups), nil
+}
+
+// listArchives elenca gli archivi zip di uno storage, dal più recente
+func listArchives(store storage.BlobStore) ([]BackupMetadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	blobs, err := store.List(ctx, "")
 	if err != nil {
-		return fmt.Errorf("errore lettura zip: %w", err)
+		return nil, fmt.Errorf("errore lettura backup: %w", err)
 	}
 
-	for _, file := range zipReader.File {
-		path := filepath.Join(destPath, file.Name)
-
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(path, file.Mode())
+	var backups []BackupMetadata
+	for _, blob := range blobs {
+		if !strings.HasSuffix(blob.Key, ".zip") {
 			continue
 		}
+		id := strings.TrimSuffix(blob.Key, ".zip")
+		kind, restaurantID := ParseBackupID(id)
+		backups = append(backups, BackupMetadata{
+			ID:           id,
+			Kind:         kind,
+			RestaurantID: restaurantID,
+			Timestamp:    blob.LastModified,
+			Size:         blob.Size,
+			Status:       "success",
+		})
+	}
+	sortNewestFirst(backups)
+	return backups, nil
+}
 
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			return err
-		}
-
-		outFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-		if err != nil {
-			return err
-		}
-
-		inFile, err := file.Open()
-		if err != nil {
-			outFile.Close()
-			return err
-		}
-
-		_, err = io.Copy(outFile, inFile)
-		outFile.Close()
-		inFile.Close()
+// sortNewestFirst ordina i backup dal più recente
+func sortNewestFirst(backups []BackupMetadata) {
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].Timestamp.After(backups[j].Timestamp)
+	})
+}
 
+// listBackups va chiamata con bm.mu bloccato. I metadati vengono dall'indice; per i backup
+// assenti dall'indice sono ricavati dallo storage
+func (bm *BackupManager) listBackups() ([]BackupMetadata, error) {
+	if bm.compressBackups {
+		backups, err := listArchives(bm.blobStore())
 		if err != nil {
-			return err
+			return nil, err
 		}
+		return bm.withIndex(backups), nil
 	}
 
-	return nil
-}
-
-// ListBackups elenca tutti i backup disponibili
-func (bm *BackupManager) ListBackups() ([]BackupMetadata, error) {
-	bm.mu.Lock()
-	defer bm.mu.Unlock()
-
 	var backups []BackupMetadata
 
 	entries, err := os.ReadDir(bm.basePath)
@@ -451,7 +730,7 @@ func (bm *BackupManager) ListBackups() ([]BackupMetadata, error) {
 	}
 
 	for _, entry := range entries {
-		if entry.IsDir() || (bm.compressBackups && !strings.HasSuffix(entry.Name(), ".zip")) {
+		if !entry.IsDir() {
 			continue
 		}
 
@@ -462,6 +741,7 @@ func (bm *BackupManager) ListBackups() ([]BackupMetadata, error) {
 
 		metadata := BackupMetadata{
 			ID:        strings.TrimSuffix(entry.Name(), ".zip"),
+			Kind:      KindFull,
 			Timestamp: info.ModTime(),
 			Size:      info.Size(),
 			Status:    "success",
@@ -470,13 +750,56 @@ func (bm *BackupManager) ListBackups() ([]BackupMetadata, error) {
 		backups = append(backups, metadata)
 	}
 
-	return backups, nil
+	return bm.withIndex(backups), nil
 }
 
 // DeleteBackup elimina uno specifico backup
 func (bm *BackupManager) DeleteBackup(backupID string) error {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
+	return bm.deleteBackup(backupID)
+}
+
+// deleteBackup va chiamata con bm.mu bloccato
+func (bm *BackupManager) deleteBackup(backupID string) error {
+	if err := bm.removeBackup(backupID); err != nil {
+		return err
+	}
+	err := bm.updateIndex(func(index map[string]BackupMetadata) {
+		delete(index, backupID)
+	})
+	if err != nil {
+		logger.Warn("Errore aggiornamento indice backup", map[string]interface{}{
+			"backup_id": backupID,
+			"error":     err.Error(),
+		})
+	}
+	return nil
+}
+
+// removeBackup elimina l'archivio o la directory di un backup; va chiamata con bm.mu bloccato
+func (bm *BackupManager) removeBackup(backupID string) error {
+	if bm.compressBackups {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		store := bm.blobStore()
+		exists, err := store.Exists(ctx, backupID+".zip")
+		if err != nil {
+			return fmt.Errorf("errore lettura backup: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("backup non trovato: %s", backupID)
+		}
+		if err := store.Delete(ctx, backupID+".zip"); err != nil {
+			return fmt.Errorf("errore eliminazione backup: %w", err)
+		}
+		store.Delete(ctx, manifestKey(backupID))
+		logger.Info("Backup eliminato", map[string]interface{}{
+			"backup_id": backupID,
+		})
+		return nil
+	}
 
 	backups, err := os.ReadDir(bm.basePath)
 	if err != nil {
@@ -500,66 +823,118 @@ func (bm *BackupManager) DeleteBackup(backupID string) error {
 	return fmt.Errorf("backup non trovato: %s", backupID)
 }
 
-// cleanupOldBackups elimina i backup più vecchi oltre il limite
+// cleanupOldBackups elimina i backup più vecchi oltre il limite; va chiamata con bm.mu bloccato
 func (bm *BackupManager) cleanupOldBackups() error {
-	backups, err := bm.ListBackups()
+	backups, err := bm.listBackups()
 	if err != nil {
 		return err
 	}
 
-	// Ordina per timestamp (più recenti primo)
-	if len(backups) > bm.maxBackups {
-		// Elimina i più vecchi
-		for i := bm.maxBackups; i < len(backups); i++ {
-			err := bm.DeleteBackup(backups[i].ID)
-			if err != nil {
-				logger.Warn("Errore eliminazione backup vecchio", map[string]interface{}{
-					"backup_id": backups[i].ID,
-					"error":     err.Error(),
-				})
-			}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	expired, err := expiredBackups(ctx, bm.blobStore(), backups, Retention{MaxBackups: bm.maxBackups})
+	if err != nil {
+		return err
+	}
+	for _, id := range expired {
+		if err := bm.deleteBackup(id); err != nil {
+			logger.Warn("Errore eliminazione backup vecchio", map[string]interface{}{
+				"backup_id": id,
+				"error":     err.Error(),
+			})
 		}
 	}
 
 	return nil
 }
 
-// calculateNextBackupTime calcola il prossimo tempo di backup
-func (bm *BackupManager) calculateNextBackupTime(schedule BackupSchedule) time.Time {
-	now := time.Now()
+// applyRetention elimina da una destinazione remota gli archivi oltre il numero massimo o più
+// vecchi dell'età massima; va chiamata con bm.mu bloccato
+func (bm *BackupManager) applyRetention(name string) {
+	target, err := bm.target(name)
+	if err != nil || (target.Retention.MaxBackups <= 0 && target.Retention.MaxAge <= 0) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	backups, err := listArchives(target.Store)
+	var expired []string
+	if err == nil {
+		expired, err = expiredBackups(ctx, target.Store, backups, target.Retention)
+	}
+	if err != nil {
+		logger.Warn("Errore lettura backup sulla destinazione remota", map[string]interface{}{
+			"target": name,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	for _, id := range expired {
+		if err := target.Store.Delete(ctx, id+".zip"); err != nil {
+			logger.Warn("Errore eliminazione backup remoto", map[string]interface{}{
+				"backup_id": id,
+				"target":    name,
+				"error":     err.Error(),
+			})
+			continue
+		}
+		target.Store.Delete(ctx, manifestKey(id))
+		logger.Info("Backup remoto eliminato dalla retention", map[string]interface{}{
+			"backup_id": id,
+			"target":    name,
+		})
+	}
+}
+
+// expiredBackups restituisce i backup da eliminare secondo la retention. I limiti valgono
+// separatamente per i backup dell'installazione e per quelli di ogni ristorante, il backup più
+// recente di ogni gruppo non viene mai eliminato, e nemmeno gli archivi da cui dipende un
+// incrementale conservato. backups deve essere ordinato dal più recente
+func expiredBackups(ctx context.Context, store storage.BlobStore, backups []BackupMetadata, retention Retention) ([]string, error) {
+	var expired []string
+	kept := map[string]int{}
+	needed := map[string]bool{}
+	for _, b := range backups {
+		scope := backupScope(b.ID)
+		i := kept[scope]
+		tooMany := retention.MaxBackups > 0 && i >= retention.MaxBackups
+		tooOld := retention.MaxAge > 0 && time.Since(b.Timestamp) > retention.MaxAge
+		if i > 0 && (tooMany || tooOld) {
+			expired = append(expired, b.ID)
+			continue
+		}
+		kept[scope]++
 
-	switch schedule.Type {
-	case "hourly":
-		return now.Add(1 * time.Hour)
-	case "daily":
-		next := now.AddDate(0, 0, 1)
-		next = time.Date(next.Year(), next.Month(), next.Day(), schedule.Hour, 0, 0, 0, next.Location())
-		if next.Before(now) {
-			next = next.Add(24 * time.Hour)
+		if b.Kind != KindIncremental {
+			continue
 		}
-		return next
-	case "weekly":
-		next := now.AddDate(0, 0, 1)
-		for next.Weekday() != time.Weekday(schedule.Day) {
-			next = next.AddDate(0, 0, 1)
+		// Senza il manifest non si sa quali archivi servono: meglio non eliminare nulla
+		manifest, err := readManifest(ctx, store, b.ID)
+		if err != nil {
+			return nil, fmt.Errorf("manifest di %s non leggibile: %w", b.ID, err)
 		}
-		next = time.Date(next.Year(), next.Month(), next.Day(), schedule.Hour, 0, 0, 0, next.Location())
-		return next
-	case "monthly":
-		next := time.Date(now.Year(), now.Month(), schedule.DayOfMonth, schedule.Hour, 0, 0, 0, now.Location())
-		if next.Before(now) {
-			next = next.AddDate(0, 1, 0)
+		for _, dep := range manifest.DependsOn() {
+			needed[dep] = true
 		}
-		return next
-	default:
-		return now.Add(schedule.Interval)
 	}
+
+	return slices.DeleteFunc(expired, func(id string) bool { return needed[id] }), nil
 }
 
-// saveBackupMetadata salva i metadati del backup
+// saveBackupMetadata registra i metadati del backup nell'indice; va chiamata con bm.mu bloccato
 func (bm *BackupManager) saveBackupMetadata(metadata BackupMetadata) {
-	// In futuro, salvare in database o file JSON
-	// Per ora, semplicemente logghiamo
+	err := bm.updateIndex(func(index map[string]BackupMetadata) {
+		index[metadata.ID] = metadata
+	})
+	if err != nil {
+		logger.Warn("Errore salvataggio metadati backup", map[string]interface{}{
+			"backup_id": metadata.ID,
+			"error":     err.Error(),
+		})
+		return
+	}
 	logger.Info("Metadati backup salvati", map[string]interface{}{
 		"backup_id": metadata.ID,
 		"timestamp": metadata.Timestamp,
@@ -579,19 +954,17 @@ func (bm *BackupManager) GetTotalBackupSize() int64 {
 	bm.mu.Lock()
 	defer bm.mu.Unlock()
 
-	var totalSize int64
-	entries, err := os.ReadDir(bm.basePath)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	blobs, err := bm.blobStore().List(ctx, "")
 	if err != nil {
 		return 0
 	}
 
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			info, err := entry.Info()
-			if err == nil {
-				totalSize += info.Size()
-			}
-		}
+	var totalSize int64
+	for _, blob := range blobs {
+		totalSize += blob.Size
 	}
 
 	return totalSize
@@ -599,8 +972,27 @@ func (bm *BackupManager) GetTotalBackupSize() int64 {
 
 // Stop ferma il backup scheduler
 func (bm *BackupManager) Stop() {
-	bm.mu.Lock()
-	defer bm.mu.Unlock()
+	bm.Shutdown(context.Background())
+}
+
+// Shutdown ferma lo scheduler e attende che l'eventuale backup in corso termini,
+// al massimo fino alla scadenza di ctx
+func (bm *BackupManager) Shutdown(ctx context.Context) error {
+	bm.schedulerMu.Lock()
+	if !bm.isRunning {
+		bm.schedulerMu.Unlock()
+		return nil
+	}
 	bm.isRunning = false
-	logger.Info("Backup scheduler fermato", nil)
+	close(bm.stopCh)
+	doneCh := bm.doneCh
+	bm.schedulerMu.Unlock()
+
+	select {
+	case <-doneCh:
+		logger.Info("Backup scheduler fermato", nil)
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("backup in corso non terminato: %w", ctx.Err())
+	}
 }
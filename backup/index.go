@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"qr-menu/logger"
+	"qr-menu/pkg/storage"
+)
+
+// indexKey è la chiave, nel blob store dei backup, dell'indice con i metadati di ogni backup
+const indexKey = "index.json"
+
+// loadIndex legge l'indice dei metadati dei backup per ID; va chiamata con bm.mu bloccato.
+// Un indice assente (prima installazione o backup creati prima dell'indice) è vuoto
+func (bm *BackupManager) loadIndex(ctx context.Context) (map[string]BackupMetadata, error) {
+	index := map[string]BackupMetadata{}
+	blob, err := bm.blobStore().Get(ctx, indexKey)
+	if err == storage.ErrNotFound {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura indice backup: %w", err)
+	}
+	defer blob.Close()
+
+	var entries []BackupMetadata
+	if err := json.NewDecoder(blob).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("indice backup non valido: %w", err)
+	}
+	for _, entry := range entries {
+		index[entry.ID] = entry
+	}
+	return index, nil
+}
+
+// saveIndex scrive l'indice dei metadati, dal backup più recente; va chiamata con bm.mu bloccato
+func (bm *BackupManager) saveIndex(ctx context.Context, index map[string]BackupMetadata) error {
+	entries := make([]BackupMetadata, 0, len(index))
+	for _, entry := range index {
+		entries = append(entries, entry)
+	}
+	sortNewestFirst(entries)
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := bm.blobStore().Put(ctx, indexKey, bytes.NewReader(data), int64(len(data)), "application/json"); err != nil {
+		return fmt.Errorf("errore scrittura indice backup: %w", err)
+	}
+	return nil
+}
+
+// updateIndex applica update all'indice e lo salva; va chiamata con bm.mu bloccato
+func (bm *BackupManager) updateIndex(update func(index map[string]BackupMetadata)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	index, err := bm.loadIndex(ctx)
+	if err != nil {
+		return err
+	}
+	update(index)
+	return bm.saveIndex(ctx, index)
+}
+
+// withIndex sostituisce i metadati ricavati dallo storage con quelli registrati nell'indice,
+// quando presenti; va chiamata con bm.mu bloccato. Se l'indice non è leggibile restituisce i
+// metadati ricavati
+func (bm *BackupManager) withIndex(backups []BackupMetadata) []BackupMetadata {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	index, err := bm.loadIndex(ctx)
+	if err != nil {
+		logger.Warn("Indice backup non disponibile, metadati ricavati dallo storage", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return backups
+	}
+	for i, b := range backups {
+		if entry, ok := index[b.ID]; ok {
+			backups[i] = entry
+		}
+	}
+	sortNewestFirst(backups)
+	return backups
+}
+
+// archiveStats calcola numero di file e rapporto di compressione di un archivio dal manifest:
+// contano solo i file salvati nell'archivio, non quelli ereditati dagli incrementali precedenti
+func archiveStats(manifest *Manifest, archiveSize int64) (fileCount int, compressRate float64) {
+	var original int64
+	for _, entry := range manifest.Files {
+		if entry.Archive == manifest.BackupID {
+			fileCount++
+			original += entry.Size
+		}
+	}
+	if original > 0 {
+		compressRate = float64(archiveSize) / float64(original)
+	}
+	return fileCount, compressRate
+}
+
+// dirStats conta i file e ne somma le dimensioni in una directory di backup non compresso
+func dirStats(dir string) (fileCount int, size int64, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fileCount++
+		size += info.Size()
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return fileCount, size, err
+}
@@ -0,0 +1,239 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"qr-menu/logger"
+	"qr-menu/pkg/storage"
+)
+
+// Tipi di backup
+const (
+	KindFull        = "full"        // Tutti i file delle directory da backuppare
+	KindIncremental = "incremental" // Solo i file cambiati dal backup precedente
+	KindRestaurant  = "restaurant"  // Dati di un solo ristorante (vedi TenantData)
+)
+
+// manifestEntryName è il nome del manifest dentro l'archivio
+const manifestEntryName = "manifest.json"
+
+// backupIDPattern riconosce gli ID generati da newBackupID: backup-<unix> per i completi,
+// backup-<unix>-inc per gli incrementali e backup-<unix>-r-<ristorante> per quelli per ristorante
+var backupIDPattern = regexp.MustCompile(`^backup-[0-9]+(-inc|-r-[A-Za-z0-9-]+)?$`)
+
+// Manifest descrive un backup: per ogni file registra l'archivio che ne contiene la versione
+// salvata, così un incrementale include solo i file cambiati e rimanda agli archivi precedenti
+// per gli altri. Viene salvato nell'archivio e accanto ad esso come <id>.manifest.json
+type Manifest struct {
+	BackupID     string                   `json:"backup_id"`
+	Kind         string                   `json:"kind"`
+	RestaurantID string                   `json:"restaurant_id,omitempty"`
+	CreatedAt    time.Time                `json:"created_at"`
+	Chain        int                      `json:"chain"` // Incrementali consecutivi dall'ultimo backup completo
+	Files        map[string]ManifestEntry `json:"files"`
+}
+
+// ManifestEntry descrive un file salvato in un backup
+type ManifestEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+	Archive string    `json:"archive"` // ID del backup il cui archivio contiene il file
+}
+
+// DependsOn restituisce gli altri backup i cui archivi servono per ripristinare questo
+func (m *Manifest) DependsOn() []string {
+	seen := map[string]bool{m.BackupID: true}
+	var deps []string
+	for _, entry := range m.Files {
+		if !seen[entry.Archive] {
+			seen[entry.Archive] = true
+			deps = append(deps, entry.Archive)
+		}
+	}
+	return deps
+}
+
+// ValidBackupID indica se id ha il formato degli ID generati dal BackupManager
+func ValidBackupID(id string) bool {
+	return backupIDPattern.MatchString(id)
+}
+
+// newBackupID genera l'ID di un nuovo backup, che ne codifica il tipo e il ristorante
+func newBackupID(kind, restaurantID string, now time.Time) string {
+	id := fmt.Sprintf("backup-%d", now.Unix())
+	switch kind {
+	case KindIncremental:
+		return id + "-inc"
+	case KindRestaurant:
+		return id + "-r-" + restaurantID
+	}
+	return id
+}
+
+// ParseBackupID ricava dall'ID di un backup il tipo e, per quelli per ristorante, il ristorante
+func ParseBackupID(id string) (kind, restaurantID string) {
+	rest := strings.TrimPrefix(id, "backup-")
+	if i := strings.Index(rest, "-r-"); i >= 0 {
+		return KindRestaurant, rest[i+len("-r-"):]
+	}
+	if strings.HasSuffix(rest, "-inc") {
+		return KindIncremental, ""
+	}
+	return KindFull, ""
+}
+
+// backupScope raggruppa i backup soggetti alla stessa retention: quelli completi e incrementali
+// dell'installazione da una parte, quelli di ogni ristorante dall'altra
+func backupScope(id string) string {
+	if kind, restaurantID := ParseBackupID(id); kind == KindRestaurant {
+		return "restaurant:" + restaurantID
+	}
+	return "platform"
+}
+
+// manifestKey restituisce la chiave del manifest salvato accanto all'archivio
+func manifestKey(backupID string) string {
+	return backupID + ".manifest.json"
+}
+
+// readManifest legge il manifest di un backup da uno storage; restituisce storage.ErrNotFound
+// per gli archivi creati prima dei manifest
+func readManifest(ctx context.Context, store storage.BlobStore, backupID string) (*Manifest, error) {
+	blob, err := store.Get(ctx, manifestKey(backupID))
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(blob).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("manifest di %s non valido: %w", backupID, err)
+	}
+	return &manifest, nil
+}
+
+// readZipManifest legge il manifest contenuto in un archivio; restituisce nil per gli archivi
+// creati prima dei manifest
+func readZipManifest(zipReader *zip.Reader) (*Manifest, error) {
+	file, err := zipReader.Open(manifestEntryName)
+	if err != nil {
+		return nil, nil
+	}
+	defer file.Close()
+
+	var manifest Manifest
+	if err := json.NewDecoder(file).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("manifest non valido: %w", err)
+	}
+	return &manifest, nil
+}
+
+// CreateIncrementalBackup crea un backup con i soli file cambiati dall'ultimo backup
+// dell'installazione. Diventa un backup completo se manca un backup precedente con manifest o
+// se la catena di incrementali ha raggiunto il limite impostato con SetFullEvery
+func (bm *BackupManager) CreateIncrementalBackup() (string, error) {
+	return bm.createBackup(KindIncremental, "")
+}
+
+// SetFullEvery imposta ogni quanti backup incrementali ne viene creato uno completo, per
+// limitare gli archivi necessari a un restore (0 = nessun limite)
+func (bm *BackupManager) SetFullEvery(n int) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.fullEvery = n
+}
+
+// incrementalBase restituisce il manifest dell'ultimo backup dell'installazione su cui basare un
+// incrementale, o nil se serve un backup completo; va chiamata con bm.mu bloccato
+func (bm *BackupManager) incrementalBase(ctx context.Context) *Manifest {
+	backups, err := bm.listBackups()
+	if err != nil {
+		logger.Warn("Errore lettura backup precedenti, eseguo un backup completo", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return nil
+	}
+	for _, b := range backups {
+		if b.Kind == KindRestaurant {
+			continue
+		}
+		manifest, err := readManifest(ctx, bm.blobStore(), b.ID)
+		if err != nil {
+			if err != storage.ErrNotFound {
+				logger.Warn("Errore lettura manifest, eseguo un backup completo", map[string]interface{}{
+					"backup_id": b.ID,
+					"error":     err.Error(),
+				})
+			}
+			return nil
+		}
+		if bm.fullEvery > 0 && manifest.Chain+1 >= bm.fullEvery {
+			return nil
+		}
+		return manifest
+	}
+	return nil
+}
+
+// hashFile calcola lo SHA256 di un file
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// unchangedEntry restituisce la voce del manifest precedente se il file non è cambiato:
+// dimensione e data di modifica uguali, o contenuto identico a quello già salvato
+func unchangedEntry(previous *Manifest, name, path string, info os.FileInfo) (ManifestEntry, bool, error) {
+	if previous == nil {
+		return ManifestEntry{}, false, nil
+	}
+	entry, ok := previous.Files[name]
+	if !ok || entry.Size != info.Size() {
+		return ManifestEntry{}, false, nil
+	}
+	if entry.ModTime.Equal(info.ModTime()) {
+		return entry, true, nil
+	}
+	hash, err := hashFile(path)
+	if err != nil || hash != entry.SHA256 {
+		return ManifestEntry{}, false, err
+	}
+	entry.ModTime = info.ModTime()
+	return entry, true, nil
+}
+
+// writeManifest aggiunge il manifest all'archivio e ne restituisce il contenuto
+func writeManifest(zipWriter *zip.Writer, manifest *Manifest) ([]byte, error) {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	writer, err := zipWriter.Create(manifestEntryName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,454 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"qr-menu/logger"
+)
+
+// Modifiche previste da un restore
+const (
+	ChangeCreate    = "create"    // Elemento assente, viene creato
+	ChangeOverwrite = "overwrite" // Elemento presente con contenuto diverso, viene sostituito
+	ChangeDelete    = "delete"    // Elemento non presente nel backup, viene eliminato
+	ChangeUnchanged = "unchanged" // Elemento identico a quello del backup
+)
+
+// RestoreOptions controlla un restore
+type RestoreOptions struct {
+	Target       string   // Destinazione remota da cui leggere gli archivi ("" = blob store, poi destinazioni)
+	Paths        []string // Solo i file sotto questi percorsi dell'archivio (es. "storage/analytics")
+	RestaurantID string   // Solo i file del ristorante (scheda, menu e statistiche in storage/)
+	DryRun       bool     // Calcola le modifiche senza applicarle
+}
+
+// RestoreChange è una modifica prevista o applicata da un restore
+type RestoreChange struct {
+	Path   string `json:"path"`
+	Action string `json:"action"` // create, overwrite, delete, unchanged
+	Size   int64  `json:"size,omitempty"`
+}
+
+// RestoreResult descrive l'esito di un restore o, con DryRun, le modifiche che applicherebbe
+type RestoreResult struct {
+	BackupID string          `json:"backup_id"`
+	DryRun   bool            `json:"dry_run"`
+	Snapshot string          `json:"snapshot,omitempty"` // Copia di sicurezza di quanto sovrascritto
+	Changes  []RestoreChange `json:"changes"`
+}
+
+// overwrites indica se il restore sostituisce o elimina dati esistenti
+func (r *RestoreResult) overwrites() bool {
+	return slices.ContainsFunc(r.Changes, func(c RestoreChange) bool {
+		return c.Action == ChangeOverwrite || c.Action == ChangeDelete
+	})
+}
+
+// RestoreBackup ripristina un backup. Un archivio assente dal blob store viene scaricato dalla
+// prima destinazione remota che lo conserva
+func (bm *BackupManager) RestoreBackup(backupID string, restorePath string) error {
+	_, err := bm.Restore(backupID, restorePath, RestoreOptions{})
+	return err
+}
+
+// RestoreBackupFrom ripristina un backup scaricandolo dalla destinazione remota indicata, o
+// come RestoreBackup se target è vuoto
+func (bm *BackupManager) RestoreBackupFrom(backupID, target, restorePath string) error {
+	_, err := bm.Restore(backupID, restorePath, RestoreOptions{Target: target})
+	return err
+}
+
+// Restore estrae un backup in restorePath/<id>. Un backup incrementale viene ricostruito con i
+// file di tutti gli archivi da cui dipende, letti dalla stessa sorgente. Paths e RestaurantID
+// limitano i file estratti; con DryRun restituisce solo le modifiche previste. Prima di
+// sostituire file esistenti li copia in restorePath/<id>-pre-restore-<unix>
+func (bm *BackupManager) Restore(backupID, restorePath string, opts RestoreOptions) (_ *RestoreResult, err error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	if !opts.DryRun {
+		defer observeBackup("restore", time.Now(), &err)
+	}
+
+	if kind, _ := ParseBackupID(backupID); kind == KindRestaurant {
+		return nil, fmt.Errorf("il backup %s riguarda un solo ristorante: usare RestoreRestaurant", backupID)
+	}
+
+	logger.Info("Inizio restore backup", map[string]interface{}{
+		"backup_id":     backupID,
+		"target":        opts.Target,
+		"restore_path":  restorePath,
+		"paths":         opts.Paths,
+		"restaurant_id": opts.RestaurantID,
+		"dry_run":       opts.DryRun,
+	})
+
+	result := &RestoreResult{BackupID: backupID, DryRun: opts.DryRun}
+	if !bm.compressBackups && opts.Target == "" {
+		if opts.DryRun || len(opts.Paths) > 0 || opts.RestaurantID != "" {
+			return nil, fmt.Errorf("restore selettivo e simulato disponibili solo per i backup compressi")
+		}
+		// Backup non compresso: è una directory locale, copia da lì
+		backupDir := filepath.Join(bm.basePath, backupID)
+		if _, err := os.Stat(backupDir); err != nil {
+			return nil, fmt.Errorf("backup non trovato: %s", backupID)
+		}
+		if err := bm.copyDirectory(backupDir, restorePath); err != nil {
+			logger.Error("Errore copia backup", map[string]interface{}{
+				"backup_id": backupID,
+				"error":     err.Error(),
+			})
+			return nil, err
+		}
+		return result, nil
+	}
+
+	sources, err := bm.restoreSources(backupID, opts.Target)
+	defer func() {
+		for _, s := range sources {
+			os.Remove(s.path)
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	destPath := filepath.Join(restorePath, backupID)
+	plan, err := planRestore(sources, destPath, opts)
+	if err != nil {
+		logger.Error("Errore lettura backup", map[string]interface{}{
+			"backup_id": backupID,
+			"error":     err.Error(),
+		})
+		return nil, err
+	}
+	for _, p := range plan {
+		result.Changes = append(result.Changes, p.change)
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	if result.overwrites() {
+		result.Snapshot = filepath.Join(restorePath, fmt.Sprintf("%s-pre-restore-%d", backupID, time.Now().Unix()))
+		if err := bm.snapshotFiles(plan, destPath, result.Snapshot); err != nil {
+			return nil, fmt.Errorf("errore copia di sicurezza prima del restore: %w", err)
+		}
+	}
+	if err := applyRestore(sources, plan, destPath); err != nil {
+		logger.Error("Errore estrazione backup", map[string]interface{}{
+			"backup_id": backupID,
+			"error":     err.Error(),
+		})
+		return nil, err
+	}
+
+	logger.Info("Restore backup completato", map[string]interface{}{
+		"backup_id": backupID,
+		"files":     len(plan),
+		"snapshot":  result.Snapshot,
+	})
+	return result, nil
+}
+
+// restoreSource è un archivio scaricato da cui il restore legge dei file
+type restoreSource struct {
+	archive string          // ID del backup dell'archivio
+	path    string          // File temporaneo con l'archivio
+	files   map[string]bool // File da leggere per un incrementale (nil = tutti)
+}
+
+// restoreSources scarica l'archivio del backup e, per un incrementale, quelli da cui dipende;
+// va chiamata con bm.mu bloccato. Le sorgenti restituite vanno rimosse anche in caso di errore
+func (bm *BackupManager) restoreSources(backupID, target string) ([]restoreSource, error) {
+	zipPath, err := bm.fetchBackup(backupID, target)
+	if err != nil {
+		return nil, err
+	}
+	sources := []restoreSource{{archive: backupID, path: zipPath}}
+
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return sources, fmt.Errorf("errore lettura zip: %w", err)
+	}
+	manifest, err := readZipManifest(&zipReader.Reader)
+	zipReader.Close()
+	if err != nil || manifest == nil || manifest.Kind != KindIncremental {
+		return sources, err
+	}
+
+	byArchive := map[string]map[string]bool{}
+	for name, entry := range manifest.Files {
+		if byArchive[entry.Archive] == nil {
+			byArchive[entry.Archive] = map[string]bool{}
+		}
+		byArchive[entry.Archive][name] = true
+	}
+	sources[0].files = byArchive[backupID]
+	if sources[0].files == nil {
+		sources[0].files = map[string]bool{}
+	}
+	for archive, files := range byArchive {
+		if archive == backupID {
+			continue
+		}
+		if !ValidBackupID(archive) {
+			return sources, fmt.Errorf("manifest di %s non valido: archivio %q", backupID, archive)
+		}
+		path, err := bm.fetchBackup(archive, target)
+		if err != nil {
+			return sources, fmt.Errorf("archivio %s necessario per %s: %w", archive, backupID, err)
+		}
+		sources = append(sources, restoreSource{archive: archive, path: path, files: files})
+	}
+	return sources, nil
+}
+
+// fetchBackup scarica l'archivio in un file temporaneo e lo sottopone all'antivirus; va
+// chiamata con bm.mu bloccato. Un archivio segnalato viene spostato in quarantena
+func (bm *BackupManager) fetchBackup(backupID, target string) (string, error) {
+	zipPath, err := bm.downloadBackup(backupID, target)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	err = bm.guard.CheckFile(ctx, backupID+".zip", zipPath)
+	cancel()
+	if err != nil {
+		os.Remove(zipPath)
+		logger.Error("Restore backup bloccato dal controllo antivirus", map[string]interface{}{
+			"backup_id": backupID,
+			"error":     err.Error(),
+		})
+		return "", fmt.Errorf("restore backup %s bloccato: %w", backupID, err)
+	}
+	return zipPath, nil
+}
+
+// plannedFile è un file selezionato per il restore
+type plannedFile struct {
+	change RestoreChange
+	source int    // Indice della sorgente che contiene il file
+	name   string // Nome del file nell'archivio
+}
+
+// planRestore seleziona i file delle sorgenti secondo le opzioni e li confronta con quelli già
+// presenti in destPath
+func planRestore(sources []restoreSource, destPath string, opts RestoreOptions) ([]plannedFile, error) {
+	var plan []plannedFile
+	for i, source := range sources {
+		zipReader, err := zip.OpenReader(source.path)
+		if err != nil {
+			return nil, fmt.Errorf("errore lettura zip: %w", err)
+		}
+		found := 0
+		for _, file := range zipReader.File {
+			rel, ok := strings.CutPrefix(file.Name, source.archive+"/")
+			if !ok || file.FileInfo().IsDir() || (source.files != nil && !source.files[rel]) {
+				continue
+			}
+			found++
+			// Gli archivi possono arrivare da storage remoti: nessun file fuori da destPath
+			if !filepath.IsLocal(rel) {
+				zipReader.Close()
+				return nil, fmt.Errorf("percorso non valido nell'archivio: %s", file.Name)
+			}
+			selected, err := opts.selects(rel, file)
+			if err != nil {
+				zipReader.Close()
+				return nil, err
+			}
+			if !selected {
+				continue
+			}
+			action, err := compareFile(filepath.Join(destPath, rel), file)
+			if err != nil {
+				zipReader.Close()
+				return nil, err
+			}
+			plan = append(plan, plannedFile{
+				change: RestoreChange{Path: rel, Action: action, Size: int64(file.UncompressedSize64)},
+				source: i,
+				name:   file.Name,
+			})
+		}
+		zipReader.Close()
+		if source.files != nil && found != len(source.files) {
+			return nil, fmt.Errorf("archivio %s incompleto: %d file su %d", source.archive, found, len(source.files))
+		}
+	}
+	slices.SortFunc(plan, func(a, b plannedFile) int { return strings.Compare(a.change.Path, b.change.Path) })
+	return plan, nil
+}
+
+// selects indica se il restore include il file rel dell'archivio
+func (opts RestoreOptions) selects(rel string, file *zip.File) (bool, error) {
+	if len(opts.Paths) > 0 && !slices.ContainsFunc(opts.Paths, func(p string) bool {
+		p = strings.Trim(p, "/")
+		return rel == p || strings.HasPrefix(rel, p+"/")
+	}) {
+		return false, nil
+	}
+	if opts.RestaurantID == "" {
+		return true, nil
+	}
+	return restaurantFile(rel, file, opts.RestaurantID)
+}
+
+// restaurantFile indica se un file dello storage su file appartiene al ristorante: la scheda
+// (storage/restaurant_<id>.json), le statistiche (storage/analytics/<id>.json) e i menu
+// (storage/menu_*.json con lo stesso restaurant_id)
+func restaurantFile(rel string, file *zip.File, restaurantID string) (bool, error) {
+	switch rel {
+	case "storage/restaurant_" + restaurantID + ".json", "storage/analytics/" + restaurantID + ".json":
+		return true, nil
+	}
+	if !strings.HasPrefix(rel, "storage/menu_") || !strings.HasSuffix(rel, ".json") || strings.Count(rel, "/") != 1 {
+		return false, nil
+	}
+
+	r, err := file.Open()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	var menu struct {
+		RestaurantID string `json:"restaurant_id"`
+	}
+	if err := json.NewDecoder(r).Decode(&menu); err != nil {
+		return false, nil // Non è un menu leggibile: non appartiene a nessun ristorante
+	}
+	return menu.RestaurantID == restaurantID, nil
+}
+
+// compareFile confronta un file dell'archivio con quello presente in path tramite CRC32
+func compareFile(path string, file *zip.File) (string, error) {
+	current, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ChangeCreate, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer current.Close()
+
+	info, err := current.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() || uint64(info.Size()) != file.UncompressedSize64 {
+		return ChangeOverwrite, nil
+	}
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, current); err != nil {
+		return "", err
+	}
+	if h.Sum32() != file.CRC32 {
+		return ChangeOverwrite, nil
+	}
+	return ChangeUnchanged, nil
+}
+
+// snapshotFiles copia in snapshotPath i file di destPath che il restore sostituirà
+func (bm *BackupManager) snapshotFiles(plan []plannedFile, destPath, snapshotPath string) error {
+	for _, p := range plan {
+		if p.change.Action != ChangeOverwrite {
+			continue
+		}
+		dst := filepath.Join(snapshotPath, p.change.Path)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := bm.copyFile(filepath.Join(destPath, p.change.Path), dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyRestore estrae in destPath i file del piano nuovi o cambiati
+func applyRestore(sources []restoreSource, plan []plannedFile, destPath string) error {
+	for i, source := range sources {
+		wanted := map[string]string{} // nome nell'archivio -> percorso relativo
+		for _, p := range plan {
+			if p.source == i && p.change.Action != ChangeUnchanged {
+				wanted[p.name] = p.change.Path
+			}
+		}
+		if len(wanted) == 0 {
+			continue
+		}
+		_, err := extractZip(source.path, destPath, func(name string) (string, bool) {
+			rel, ok := wanted[name]
+			return rel, ok
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractZip estrae in destPath i file dell'archivio per cui rename restituisce true, con il
+// percorso restituito. Restituisce il numero di file estratti
+func extractZip(zipPath, destPath string, rename func(name string) (string, bool)) (int, error) {
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return 0, fmt.Errorf("errore lettura zip: %w", err)
+	}
+	defer zipReader.Close()
+
+	extracted := 0
+	for _, file := range zipReader.File {
+		name, ok := rename(file.Name)
+		if !ok {
+			continue
+		}
+		path := filepath.Join(destPath, name)
+		// Gli archivi possono arrivare da storage remoti: nessun file fuori da destPath
+		if !filepath.IsLocal(name) {
+			return extracted, fmt.Errorf("percorso non valido nell'archivio: %s", file.Name)
+		}
+
+		if file.FileInfo().IsDir() {
+			os.MkdirAll(path, file.Mode())
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return extracted, err
+		}
+
+		outFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
+		if err != nil {
+			return extracted, err
+		}
+
+		inFile, err := file.Open()
+		if err != nil {
+			outFile.Close()
+			return extracted, err
+		}
+
+		_, err = io.Copy(outFile, inFile)
+		outFile.Close()
+		inFile.Close()
+
+		if err != nil {
+			return extracted, err
+		}
+		extracted++
+	}
+
+	return extracted, nil
+}
@@ -0,0 +1,368 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"qr-menu/logger"
+	"qr-menu/pkg/cron"
+	"qr-menu/pkg/storage"
+)
+
+// schedulesKey è la chiave, nel blob store dei backup, delle pianificazioni e delle loro ultime
+// esecuzioni, che sopravvivono così ai riavvii
+const schedulesKey = "schedules.json"
+
+// maxSchedulerSleep limita l'attesa dello scheduler: i timer seguono l'orologio monotono, quindi
+// dopo una sospensione della macchina o una correzione dell'ora l'orario va ricontrollato
+const maxSchedulerSleep = time.Minute
+
+// Schedule è una pianificazione dei backup con nome, espressione cron e tipo di backup
+type Schedule struct {
+	Name string `json:"name"`
+	Cron string `json:"cron"` // Es. "0 2 * * *" o "@hourly", nell'ora locale del server
+	Kind string `json:"kind"` // full o incremental
+}
+
+// ScheduleRun è l'esito dell'ultima esecuzione di una pianificazione
+type ScheduleRun struct {
+	At       time.Time `json:"at"`
+	BackupID string    `json:"backup_id,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// ScheduleStatus descrive una pianificazione attiva con la prossima e l'ultima esecuzione
+type ScheduleStatus struct {
+	Schedule
+	NextRun time.Time    `json:"next_run"`
+	LastRun *ScheduleRun `json:"last_run,omitempty"`
+}
+
+// SchedulerStatus descrive lo stato dello scheduler dei backup
+type SchedulerStatus struct {
+	Running   bool             `json:"running"`
+	Custom    bool             `json:"custom"` // Pianificazioni impostate via API invece che da configurazione
+	Schedules []ScheduleStatus `json:"schedules"`
+}
+
+// scheduledBackup è una pianificazione attiva dello scheduler
+type scheduledBackup struct {
+	Schedule
+	cron *cron.Schedule
+	next time.Time
+}
+
+// persistedSchedules è il contenuto di schedules.json
+type persistedSchedules struct {
+	Custom    bool                   `json:"custom"`
+	Schedules []Schedule             `json:"schedules,omitempty"` // Solo se impostate via API
+	LastRuns  map[string]ScheduleRun `json:"last_runs"`
+}
+
+// ValidateSchedules controlla espressioni cron, tipi e unicità dei nomi delle pianificazioni
+func ValidateSchedules(schedules []Schedule) error {
+	names := map[string]bool{}
+	for i, s := range schedules {
+		if s.Name == "" || names[s.Name] {
+			return fmt.Errorf("pianificazione %d: nome mancante o duplicato", i)
+		}
+		names[s.Name] = true
+		if s.Kind != KindFull && s.Kind != KindIncremental {
+			return fmt.Errorf("pianificazione %s: tipo %q non valido (full o incremental)", s.Name, s.Kind)
+		}
+		if _, err := cron.Parse(s.Cron); err != nil {
+			return fmt.Errorf("pianificazione %s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// StartScheduled avvia lo scheduler dei backup. Le pianificazioni salvate via API con
+// SetSchedules prevalgono su quelle passate; un'esecuzione persa mentre il server era fermo
+// viene recuperata all'avvio
+func (bm *BackupManager) StartScheduled(schedules []Schedule) error {
+	if err := ValidateSchedules(schedules); err != nil {
+		return err
+	}
+
+	bm.mu.Lock()
+	store := bm.blobStore()
+	bm.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	persisted, err := loadSchedules(ctx, store)
+	if err != nil {
+		logger.Warn("Pianificazioni dei backup salvate non leggibili, uso la configurazione", map[string]interface{}{
+			"error": err.Error(),
+		})
+		persisted = &persistedSchedules{}
+	}
+	active := schedules
+	if persisted.Custom {
+		if err := ValidateSchedules(persisted.Schedules); err != nil {
+			return fmt.Errorf("pianificazioni dei backup salvate non valide: %w", err)
+		}
+		active = persisted.Schedules
+	}
+
+	bm.schedulerMu.Lock()
+	if bm.isRunning {
+		bm.schedulerMu.Unlock()
+		return fmt.Errorf("backup scheduler già in esecuzione")
+	}
+	bm.isRunning = true
+	bm.stopCh = make(chan struct{})
+	bm.doneCh = make(chan struct{})
+	bm.reloadCh = make(chan struct{}, 1)
+	bm.scheduleStore = store
+	bm.defaultSchedules = schedules
+	bm.customSchedules = persisted.Custom
+	bm.scheduleRuns = persisted.LastRuns
+	if bm.scheduleRuns == nil {
+		bm.scheduleRuns = map[string]ScheduleRun{}
+	}
+	bm.schedules = newScheduledBackups(active, bm.scheduleRuns, time.Now())
+	stopCh, doneCh, reloadCh := bm.stopCh, bm.doneCh, bm.reloadCh
+	status := bm.schedulerStatusLocked()
+	bm.schedulerMu.Unlock()
+
+	logger.Info("Backup scheduler avviato", map[string]interface{}{
+		"schedules": status.Schedules,
+		"custom":    status.Custom,
+	})
+
+	go func() {
+		defer close(doneCh)
+		for {
+			timer := time.NewTimer(bm.untilNextRun())
+			select {
+			case <-stopCh:
+				timer.Stop()
+				return
+			case <-reloadCh:
+				timer.Stop()
+				continue
+			case <-timer.C:
+			}
+			bm.runDueSchedules(stopCh)
+		}
+	}()
+
+	return nil
+}
+
+// newScheduledBackups prepara le pianificazioni attive. Con un'ultima esecuzione nota la prossima
+// segue quella, quindi se è già passata (server fermo) il backup parte subito
+func newScheduledBackups(schedules []Schedule, lastRuns map[string]ScheduleRun, now time.Time) []*scheduledBackup {
+	active := make([]*scheduledBackup, 0, len(schedules))
+	for _, s := range schedules {
+		parsed, _ := cron.Parse(s.Cron) // Già validata
+		entry := &scheduledBackup{Schedule: s, cron: parsed, next: parsed.Next(now)}
+		if run, ok := lastRuns[s.Name]; ok {
+			entry.next = parsed.Next(run.At)
+		}
+		active = append(active, entry)
+	}
+	return active
+}
+
+// untilNextRun restituisce l'attesa fino alla prossima esecuzione, al massimo maxSchedulerSleep
+func (bm *BackupManager) untilNextRun() time.Duration {
+	bm.schedulerMu.Lock()
+	defer bm.schedulerMu.Unlock()
+
+	wait := maxSchedulerSleep
+	for _, s := range bm.schedules {
+		if s.next.IsZero() {
+			continue // L'espressione non scatta mai
+		}
+		if d := time.Until(s.next); d < wait {
+			wait = max(d, 0)
+		}
+	}
+	return wait
+}
+
+// runDueSchedules esegue i backup delle pianificazioni scadute, prima i completi: un
+// incrementale che scade insieme a un completo viene saltato perché sarebbe vuoto. La prossima
+// esecuzione si calcola dall'espressione cron a backup terminato, così resta allineata agli
+// orari previsti anche se il backup dura a lungo
+func (bm *BackupManager) runDueSchedules(stopCh <-chan struct{}) {
+	now := time.Now()
+	bm.schedulerMu.Lock()
+	var due []Schedule
+	for _, s := range bm.schedules {
+		if !s.next.IsZero() && !s.next.After(now) {
+			due = append(due, s.Schedule)
+		}
+	}
+	bm.schedulerMu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool { return due[i].Kind == KindFull && due[j].Kind != KindFull })
+	fullID := ""
+	for _, s := range due {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		run := ScheduleRun{At: time.Now()}
+		if s.Kind == KindIncremental && fullID != "" {
+			logger.Info("Backup incrementale saltato, eseguito un backup completo", map[string]interface{}{
+				"schedule":  s.Name,
+				"backup_id": fullID,
+			})
+			run.BackupID = fullID
+			bm.scheduleDone(s.Name, run)
+			continue
+		}
+
+		var err error
+		if s.Kind == KindFull {
+			run.BackupID, err = bm.CreateBackup()
+			if err == nil {
+				fullID = run.BackupID
+			}
+		} else {
+			run.BackupID, err = bm.CreateIncrementalBackup()
+		}
+		if err != nil {
+			run.Error = err.Error()
+			logger.Error("Errore nel backup automatico", map[string]interface{}{
+				"schedule": s.Name,
+				"error":    err.Error(),
+			})
+		} else {
+			logger.Info("Backup automatico completato", map[string]interface{}{
+				"schedule":  s.Name,
+				"backup_id": run.BackupID,
+			})
+		}
+		bm.scheduleDone(s.Name, run)
+	}
+}
+
+// scheduleDone registra l'esecuzione di una pianificazione e ne calcola la prossima
+func (bm *BackupManager) scheduleDone(name string, run ScheduleRun) {
+	bm.schedulerMu.Lock()
+	defer bm.schedulerMu.Unlock()
+
+	for _, s := range bm.schedules {
+		if s.Name == name { // Le pianificazioni possono essere cambiate durante il backup
+			s.next = s.cron.Next(time.Now())
+		}
+	}
+	bm.scheduleRuns[name] = run
+	bm.saveSchedulesLocked()
+}
+
+// SetSchedules sostituisce le pianificazioni dello scheduler in esecuzione e le salva, così
+// prevalgono su quelle della configurazione anche dopo un riavvio
+func (bm *BackupManager) SetSchedules(schedules []Schedule) error {
+	if err := ValidateSchedules(schedules); err != nil {
+		return err
+	}
+	return bm.replaceSchedules(schedules, true)
+}
+
+// ResetSchedules ripristina le pianificazioni della configurazione
+func (bm *BackupManager) ResetSchedules() error {
+	bm.schedulerMu.Lock()
+	defaults := bm.defaultSchedules
+	bm.schedulerMu.Unlock()
+	return bm.replaceSchedules(defaults, false)
+}
+
+// replaceSchedules attiva le pianificazioni indicate; le ultime esecuzioni restano associate
+// ai nomi
+func (bm *BackupManager) replaceSchedules(schedules []Schedule, custom bool) error {
+	bm.schedulerMu.Lock()
+	defer bm.schedulerMu.Unlock()
+
+	if !bm.isRunning {
+		return fmt.Errorf("backup scheduler non in esecuzione")
+	}
+	bm.schedules = newScheduledBackups(schedules, nil, time.Now())
+	bm.customSchedules = custom
+	if err := bm.saveSchedulesLocked(); err != nil {
+		return err
+	}
+
+	select {
+	case bm.reloadCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// ScheduleStatus restituisce lo stato dello scheduler, senza attendere un backup in corso
+func (bm *BackupManager) ScheduleStatus() SchedulerStatus {
+	bm.schedulerMu.Lock()
+	defer bm.schedulerMu.Unlock()
+	return bm.schedulerStatusLocked()
+}
+
+// schedulerStatusLocked va chiamata con bm.schedulerMu bloccato
+func (bm *BackupManager) schedulerStatusLocked() SchedulerStatus {
+	status := SchedulerStatus{Running: bm.isRunning, Custom: bm.customSchedules, Schedules: []ScheduleStatus{}}
+	if !bm.isRunning {
+		return status
+	}
+	for _, s := range bm.schedules {
+		entry := ScheduleStatus{Schedule: s.Schedule, NextRun: s.next}
+		if run, ok := bm.scheduleRuns[s.Name]; ok {
+			entry.LastRun = &run
+		}
+		status.Schedules = append(status.Schedules, entry)
+	}
+	return status
+}
+
+// saveSchedulesLocked salva pianificazioni e ultime esecuzioni; va chiamata con bm.schedulerMu
+// bloccato. Un errore viene anche registrato nei log
+func (bm *BackupManager) saveSchedulesLocked() error {
+	persisted := persistedSchedules{Custom: bm.customSchedules, LastRuns: bm.scheduleRuns}
+	if bm.customSchedules {
+		for _, s := range bm.schedules {
+			persisted.Schedules = append(persisted.Schedules, s.Schedule)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	data, err := json.MarshalIndent(persisted, "", "  ")
+	if err == nil {
+		err = bm.scheduleStore.Put(ctx, schedulesKey, bytes.NewReader(data), int64(len(data)), "application/json")
+	}
+	if err != nil {
+		logger.Warn("Errore salvataggio pianificazioni dei backup", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return fmt.Errorf("errore salvataggio pianificazioni: %w", err)
+	}
+	return nil
+}
+
+// loadSchedules legge le pianificazioni salvate; un file assente equivale a nessuna esecuzione
+func loadSchedules(ctx context.Context, store storage.BlobStore) (*persistedSchedules, error) {
+	persisted := &persistedSchedules{}
+	blob, err := store.Get(ctx, schedulesKey)
+	if err == storage.ErrNotFound {
+		return persisted, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	if err := json.NewDecoder(blob).Decode(persisted); err != nil {
+		return nil, fmt.Errorf("%s non valido: %w", schedulesKey, err)
+	}
+	return persisted, nil
+}
@@ -0,0 +1,179 @@
+package backup
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	"qr-menu/logger"
+)
+
+// TenantData esporta e ripristina i dati di un singolo ristorante (documenti del database e
+// file nel blob store) per i backup per ristorante
+type TenantData interface {
+	// Export passa ad add ogni file da salvare nell'archivio, con un percorso relativo
+	Export(ctx context.Context, restaurantID string, add func(name string, r io.Reader) error) error
+	// Plan confronta i dati dell'archivio con quelli attuali del ristorante senza modificarli
+	Plan(ctx context.Context, restaurantID string, files fs.FS) ([]RestoreChange, error)
+	// Import sostituisce i dati del ristorante con quelli letti dall'archivio
+	Import(ctx context.Context, restaurantID string, files fs.FS) error
+}
+
+// SetTenantData imposta l'esportazione dei dati dei ristoranti usata dai backup per ristorante
+func (bm *BackupManager) SetTenantData(tenants TenantData) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.tenants = tenants
+}
+
+// CreateRestaurantBackup crea un backup dei soli dati di un ristorante, ripristinabile con
+// RestoreRestaurant senza toccare gli altri
+func (bm *BackupManager) CreateRestaurantBackup(restaurantID string) (string, error) {
+	if !backupIDPattern.MatchString(newBackupID(KindRestaurant, restaurantID, time.Now())) {
+		return "", fmt.Errorf("ID ristorante non valido: %q", restaurantID)
+	}
+	return bm.createBackup(KindRestaurant, restaurantID)
+}
+
+// writeRestaurantZip scrive nello zip i dati esportati del ristorante e il manifest, che
+// restituisce; va chiamata con bm.mu bloccato
+func (bm *BackupManager) writeRestaurantZip(ctx context.Context, w io.Writer, manifest *Manifest) ([]byte, error) {
+	if bm.tenants == nil {
+		return nil, fmt.Errorf("backup per ristorante non disponibili")
+	}
+	zipWriter := zip.NewWriter(w)
+
+	now := time.Now()
+	add := func(name string, r io.Reader) error {
+		if !fs.ValidPath(name) || name == manifestEntryName {
+			return fmt.Errorf("nome file non valido: %q", name)
+		}
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     path.Join(manifest.BackupID, name),
+			Method:   zip.Deflate,
+			Modified: now,
+		})
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		size, err := io.Copy(io.MultiWriter(writer, h), r)
+		manifest.Files[name] = ManifestEntry{
+			Size:    size,
+			ModTime: now,
+			SHA256:  hex.EncodeToString(h.Sum(nil)),
+			Archive: manifest.BackupID,
+		}
+		return err
+	}
+	if err := bm.tenants.Export(ctx, manifest.RestaurantID, add); err != nil {
+		zipWriter.Close()
+		return nil, fmt.Errorf("errore esportazione ristorante %s: %w", manifest.RestaurantID, err)
+	}
+
+	data, err := writeManifest(zipWriter, manifest)
+	if err != nil {
+		zipWriter.Close()
+		return nil, fmt.Errorf("errore scrittura manifest: %w", err)
+	}
+	return data, zipWriter.Close()
+}
+
+// RestoreRestaurantBackup ripristina i dati di un ristorante da un suo backup, letto dalla
+// destinazione remota indicata o, se target è vuoto, come RestoreBackup. Gli altri ristoranti
+// non vengono toccati
+func (bm *BackupManager) RestoreRestaurantBackup(backupID, target, restaurantID string) error {
+	_, err := bm.RestoreRestaurant(backupID, restaurantID, RestoreOptions{Target: target})
+	return err
+}
+
+// RestoreRestaurant ripristina i dati di un ristorante da un suo backup. Con DryRun restituisce
+// solo le modifiche previste; altrimenti, se il ristorante ha dati che verrebbero sostituiti,
+// prima li salva in un nuovo backup del ristorante, indicato in RestoreResult.Snapshot
+func (bm *BackupManager) RestoreRestaurant(backupID, restaurantID string, opts RestoreOptions) (_ *RestoreResult, err error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	if !opts.DryRun {
+		defer observeBackup("restore", time.Now(), &err)
+	}
+
+	if kind, owner := ParseBackupID(backupID); kind != KindRestaurant || owner != restaurantID {
+		return nil, fmt.Errorf("il backup %s non appartiene al ristorante %s", backupID, restaurantID)
+	}
+	if len(opts.Paths) > 0 {
+		return nil, fmt.Errorf("il restore di un ristorante non è selettivo")
+	}
+	if bm.tenants == nil {
+		return nil, fmt.Errorf("backup per ristorante non disponibili")
+	}
+
+	logger.Info("Inizio restore backup ristorante", map[string]interface{}{
+		"backup_id":     backupID,
+		"target":        opts.Target,
+		"restaurant_id": restaurantID,
+		"dry_run":       opts.DryRun,
+	})
+
+	zipPath, err := bm.fetchBackup(backupID, opts.Target)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(zipPath)
+
+	zipReader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura zip: %w", err)
+	}
+	defer zipReader.Close()
+
+	manifest, err := readZipManifest(&zipReader.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil || manifest.Kind != KindRestaurant || manifest.RestaurantID != restaurantID {
+		return nil, fmt.Errorf("l'archivio %s non è un backup del ristorante %s", backupID, restaurantID)
+	}
+	files, err := fs.Sub(zipReader, backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	result := &RestoreResult{BackupID: backupID, DryRun: opts.DryRun}
+	if result.Changes, err = bm.tenants.Plan(ctx, restaurantID, files); err != nil {
+		return nil, fmt.Errorf("errore confronto ristorante %s: %w", restaurantID, err)
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	if result.overwrites() {
+		if result.Snapshot, err = bm.createBackupLocked(KindRestaurant, restaurantID); err != nil {
+			return nil, fmt.Errorf("errore backup di sicurezza prima del restore: %w", err)
+		}
+	}
+	if err := bm.tenants.Import(ctx, restaurantID, files); err != nil {
+		logger.Error("Errore restore backup ristorante", map[string]interface{}{
+			"backup_id":     backupID,
+			"restaurant_id": restaurantID,
+			"snapshot":      result.Snapshot,
+			"error":         err.Error(),
+		})
+		return nil, fmt.Errorf("errore restore ristorante %s: %w", restaurantID, err)
+	}
+
+	logger.Info("Restore backup ristorante completato", map[string]interface{}{
+		"backup_id":     backupID,
+		"restaurant_id": restaurantID,
+		"snapshot":      result.Snapshot,
+	})
+	return result, nil
+}
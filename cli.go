@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+	"github.com/spf13/cobra"
+
+	"qr-menu/backup"
+	"qr-menu/db"
+	"qr-menu/handlers"
+	"qr-menu/models"
+	"qr-menu/pkg/app"
+	"qr-menu/pkg/config"
+	"qr-menu/pkg/push"
+	"qr-menu/pkg/storage"
+)
+
+// cliTimeout limita le operazioni sul database dei comandi di amministrazione
+const cliTimeout = 30 * time.Second
+
+// cliFailure è l'errore di un comando fallito (exit code 1). Gli altri errori restituiti dai
+// comandi sono argomenti non validi (exit code 2, con l'uso del comando)
+type cliFailure struct {
+	err error
+}
+
+func (f *cliFailure) Error() string { return f.err.Error() }
+func (f *cliFailure) Unwrap() error { return f.err }
+
+// cliFail segna err come fallimento del comando
+func cliFail(err error) error {
+	return &cliFailure{err: err}
+}
+
+// newCLI crea il comando radice con i comandi per gestire il sistema senza passare dall'API
+// HTTP. Senza comando l'applicazione avvia il server (vedi main)
+func newCLI(configPath string) *cobra.Command {
+	root := &cobra.Command{
+		Use:           "qr-menu",
+		Short:         "QR Menu: senza comando avvia il server",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	root.CompletionOptions.DisableDefaultCmd = true
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "doctor",
+			Short: "verifica configurazione, database e servizi esterni",
+			Args:  cobra.NoArgs,
+			RunE:  func(*cobra.Command, []string) error { return runDoctor(configPath) },
+		},
+		newMigrateCommand(configPath),
+		&cobra.Command{
+			Use:   "vapid-keys",
+			Short: "genera le chiavi per le notifiche Web Push",
+			Args:  cobra.NoArgs,
+			RunE:  func(*cobra.Command, []string) error { return runVAPIDKeys() },
+		},
+		newCreateAdminCommand(configPath),
+		newResetPasswordCommand(configPath),
+		newExportMenuCommand(configPath),
+		newImportMenuCommand(configPath),
+		newBackupCommand(configPath),
+		newGenerateQRCommand(configPath),
+		&cobra.Command{
+			Use:   "scrub-analytics",
+			Short: "anonimizza IP e User-Agent degli eventi analytics già salvati",
+			Args:  cobra.NoArgs,
+			RunE:  func(*cobra.Command, []string) error { return runScrubAnalytics(configPath) },
+		},
+	)
+	return root
+}
+
+// runCLI esegue il comando in args e restituisce l'exit code: 1 se il comando fallisce, 2 per
+// comandi e argomenti non validi
+func runCLI(configPath string, args []string) int {
+	root := newCLI(configPath)
+	root.SetArgs(args)
+	cmd, err := root.ExecuteC()
+	if err == nil {
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+	var failure *cliFailure
+	if errors.As(err, &failure) {
+		return 1
+	}
+	fmt.Fprintln(os.Stderr)
+	cmd.SetOut(os.Stderr)
+	cmd.Usage()
+	return 2
+}
+
+// cliSetup carica la configurazione, si connette a MongoDB e prepara blob storage e URL
+// pubblico come all'avvio del server. close va chiamata al termine del comando
+func cliSetup(configPath string) (settings *config.Config, close func(), err error) {
+	// I log dei package interni finirebbero mescolati all'output
+	log.SetOutput(io.Discard)
+
+	settings, err = config.LoadFile(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("errore nella configurazione: %w", err)
+	}
+	if err := db.Connect(); err != nil {
+		return nil, nil, fmt.Errorf("errore connessione MongoDB: %w", err)
+	}
+	close = func() { db.MongoInstance.Disconnect() }
+
+	assets, err := storage.New(storage.ConfigFromEnv("static"))
+	if err != nil {
+		close()
+		return nil, nil, fmt.Errorf("errore inizializzazione storage: %w", err)
+	}
+	handlers.SetBlobStore(assets)
+	handlers.SetBaseURL(settings.Server.BaseURL, settings.Server.TrustProxyHeaders)
+	return settings, close, nil
+}
+
+// readPassword legge la password dalla prima riga di stdin oppure, se fromStdin è falso, ne
+// genera una casuale. generated indica che va mostrata all'operatore
+func readPassword(fromStdin bool) (password string, generated bool, err error) {
+	if !fromStdin {
+		b := make([]byte, 12)
+		if _, err := rand.Read(b); err != nil {
+			return "", false, err
+		}
+		return base64.RawURLEncoding.EncodeToString(b), true, nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", false, err
+	}
+	return strings.TrimRight(line, "\r\n"), false, nil
+}
+
+// runVAPIDKeys esegue "qr-menu vapid-keys"
+func runVAPIDKeys() error {
+	keys, err := push.GenerateVAPIDKeys()
+	if err != nil {
+		return cliFail(fmt.Errorf("errore nella generazione delle chiavi VAPID: %w", err))
+	}
+	fmt.Printf("NOTIFICATIONS_VAPID_PUBLIC_KEY=%s\nNOTIFICATIONS_VAPID_PRIVATE_KEY=%s\n", keys.PublicKey, keys.PrivateKey)
+	return nil
+}
+
+// newCreateAdminCommand crea "qr-menu create-admin": crea l'account del titolare di un
+// ristorante. Senza --password-stdin genera una password casuale e la stampa
+func newCreateAdminCommand(configPath string) *cobra.Command {
+	var username, email, restaurantName string
+	var passwordStdin bool
+	cmd := &cobra.Command{
+		Use:   "create-admin --username <utente> --email <email> --restaurant <nome> [--password-stdin]",
+		Short: "crea un account con il suo primo ristorante",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			password, generated, err := readPassword(passwordStdin)
+			if err != nil {
+				return cliFail(err)
+			}
+
+			_, closeDB, err := cliSetup(configPath)
+			if err != nil {
+				return cliFail(err)
+			}
+			defer closeDB()
+
+			ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+			defer cancel()
+			user, restaurant, err := handlers.CreateAccount(ctx, username, email, password, restaurantName)
+			if err != nil {
+				return cliFail(err)
+			}
+
+			fmt.Printf("✓ Utente %s creato (id %s)\n", user.Username, user.ID)
+			fmt.Printf("✓ Ristorante %s creato (id %s, username %s)\n", restaurant.Name, restaurant.ID, restaurant.Username)
+			if generated {
+				fmt.Printf("Password: %s\n", password)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&username, "username", "", "username di accesso")
+	cmd.Flags().StringVar(&email, "email", "", "email dell'account")
+	cmd.Flags().StringVar(&restaurantName, "restaurant", "", "nome del primo ristorante")
+	cmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "legge la password dalla prima riga di stdin")
+	cmd.MarkFlagRequired("username")
+	cmd.MarkFlagRequired("email")
+	cmd.MarkFlagRequired("restaurant")
+	return cmd
+}
+
+// newResetPasswordCommand crea "qr-menu reset-password". Senza --password-stdin genera una
+// password casuale e la stampa
+func newResetPasswordCommand(configPath string) *cobra.Command {
+	var login string
+	var passwordStdin bool
+	cmd := &cobra.Command{
+		Use:   "reset-password --user <utente|email> [--password-stdin]",
+		Short: "imposta una nuova password e chiude le sessioni dell'utente",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			password, generated, err := readPassword(passwordStdin)
+			if err != nil {
+				return cliFail(err)
+			}
+
+			_, closeDB, err := cliSetup(configPath)
+			if err != nil {
+				return cliFail(err)
+			}
+			defer closeDB()
+
+			ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+			defer cancel()
+			user, err := handlers.SetUserPassword(ctx, login, password)
+			if err != nil {
+				return cliFail(err)
+			}
+
+			fmt.Printf("✓ Password di %s aggiornata, sessioni chiuse\n", user.Username)
+			if generated {
+				fmt.Printf("Password: %s\n", password)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&login, "user", "", "username o email dell'utente")
+	cmd.Flags().BoolVar(&passwordStdin, "password-stdin", false, "legge la password dalla prima riga di stdin")
+	cmd.MarkFlagRequired("user")
+	return cmd
+}
+
+// newExportMenuCommand crea "qr-menu export-menu": scrive il menu in JSON su file o su stdout
+func newExportMenuCommand(configPath string) *cobra.Command {
+	var menuID, output string
+	cmd := &cobra.Command{
+		Use:   "export-menu --menu <id> [-o <file.json>]",
+		Short: "esporta un menu in JSON",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			_, closeDB, err := cliSetup(configPath)
+			if err != nil {
+				return cliFail(err)
+			}
+			defer closeDB()
+
+			ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+			defer cancel()
+			menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
+			if err != nil {
+				return cliFail(err)
+			}
+			if menu == nil {
+				return cliFail(fmt.Errorf("menu %s non trovato", menuID))
+			}
+
+			data, err := json.MarshalIndent(menu, "", "  ")
+			if err != nil {
+				return cliFail(err)
+			}
+			data = append(data, '\n')
+			if output == "" {
+				os.Stdout.Write(data)
+				return nil
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				return cliFail(err)
+			}
+			fmt.Printf("✓ Menu %s esportato in %s\n", menu.Name, output)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&menuID, "menu", "", "ID del menu")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "file di destinazione (default stdout)")
+	cmd.MarkFlagRequired("menu")
+	return cmd
+}
+
+// newImportMenuCommand crea "qr-menu import-menu": crea un nuovo menu da un file di export-menu
+func newImportMenuCommand(configPath string) *cobra.Command {
+	var restaurantRef string
+	var activate bool
+	cmd := &cobra.Command{
+		Use:   "import-menu --restaurant <id|username> [--activate] <file.json>",
+		Short: "importa come nuovo menu un menu esportato",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return cliFail(err)
+			}
+			var source models.Menu
+			if err := json.Unmarshal(data, &source); err != nil {
+				return cliFail(fmt.Errorf("file %s non valido: %w", args[0], err))
+			}
+
+			_, closeDB, err := cliSetup(configPath)
+			if err != nil {
+				return cliFail(err)
+			}
+			defer closeDB()
+
+			ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+			defer cancel()
+			restaurant, err := handlers.FindRestaurant(ctx, restaurantRef)
+			if err != nil {
+				return cliFail(err)
+			}
+			menu, err := handlers.ImportMenu(ctx, restaurant, &source, activate)
+			if err != nil {
+				return cliFail(err)
+			}
+
+			fmt.Printf("✓ Menu %s importato in %s (id %s)\n", menu.Name, restaurant.Name, menu.ID)
+			if activate {
+				fmt.Println("✓ Menu attivo")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&restaurantRef, "restaurant", "", "ID o username del ristorante")
+	cmd.Flags().BoolVar(&activate, "activate", false, "completa il menu e lo rende l'unico attivo")
+	cmd.MarkFlagRequired("restaurant")
+	return cmd
+}
+
+// newBackupCommand crea "qr-menu backup now", che esegue un backup con le impostazioni
+// backup.* del server senza avviare lo scheduler. Il comando attende la fine del backup e
+// delle copie remote
+func newBackupCommand(configPath string) *cobra.Command {
+	var mode, restaurantRef string
+	now := &cobra.Command{
+		Use:   "now [--mode full|incremental] [--restaurant <id|username>]",
+		Short: "esegue subito un backup",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			if mode != backup.KindFull && mode != backup.KindIncremental {
+				return fmt.Errorf("--mode deve essere full o incremental, non %q", mode)
+			}
+			if restaurantRef != "" && mode == backup.KindIncremental {
+				return cliFail(errors.New("i backup di un ristorante sono sempre completi"))
+			}
+
+			settings, closeDB, err := cliSetup(configPath)
+			if err != nil {
+				return cliFail(err)
+			}
+			defer closeDB()
+			if _, err := app.ConfigureBackups(settings, storage.ConfigFromEnv("backups")); err != nil {
+				return cliFail(err)
+			}
+
+			bm := backup.GetBackupManager()
+			var backupID, restaurantID string
+			switch {
+			case restaurantRef != "":
+				ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+				restaurant, err := handlers.FindRestaurant(ctx, restaurantRef)
+				cancel()
+				if err != nil {
+					return cliFail(err)
+				}
+				restaurantID = restaurant.ID
+				backupID, err = bm.CreateRestaurantBackup(restaurantID)
+			case mode == backup.KindIncremental:
+				backupID, err = bm.CreateIncrementalBackup()
+			default:
+				backupID, err = bm.CreateBackup()
+			}
+
+			status := "success"
+			if err != nil {
+				status = "failure"
+			}
+			handlers.RecordAuditLog(context.Background(), "BACKUP_REQUESTED", "backup", backupID, restaurantID, handlers.OperatorClient, handlers.OperatorClient, status)
+			if err != nil {
+				return cliFail(err)
+			}
+			fmt.Printf("✓ Backup %s completato\n", backupID)
+			return nil
+		},
+	}
+	now.Flags().StringVar(&mode, "mode", backup.KindFull, "full o incremental")
+	now.Flags().StringVar(&restaurantRef, "restaurant", "", "salva solo i dati di un ristorante (ID o username)")
+
+	cmd := &cobra.Command{
+		Use:   "backup now",
+		Short: "esegue subito un backup",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			return errors.New("sottocomando mancante: qr-menu backup now")
+		},
+	}
+	cmd.AddCommand(now)
+	return cmd
+}
+
+// newGenerateQRCommand crea "qr-menu generate-qr": rigenera il QR code del ristorante su
+// server.base_url, aggiorna i menu completati e, con -o, ne salva una copia in PNG
+func newGenerateQRCommand(configPath string) *cobra.Command {
+	var restaurantRef, output string
+	var size int
+	cmd := &cobra.Command{
+		Use:   "generate-qr --restaurant <id|username> [-o <file.png>] [--size <pixel>]",
+		Short: "rigenera il QR code del ristorante",
+		Args:  cobra.NoArgs,
+		RunE: func(*cobra.Command, []string) error {
+			if size <= 0 {
+				return fmt.Errorf("--size deve essere positivo, non %d", size)
+			}
+
+			_, closeDB, err := cliSetup(configPath)
+			if err != nil {
+				return cliFail(err)
+			}
+			defer closeDB()
+
+			ctx, cancel := context.WithTimeout(context.Background(), cliTimeout)
+			defer cancel()
+			restaurant, err := handlers.FindRestaurant(ctx, restaurantRef)
+			if err != nil {
+				return cliFail(err)
+			}
+			restaurantURL, err := handlers.RegenerateRestaurantQRCode(ctx, restaurant)
+			if err != nil {
+				return cliFail(err)
+			}
+			fmt.Printf("✓ QR code di %s rigenerato: %s\n", restaurant.Name, restaurantURL)
+
+			if output != "" {
+				if err := qrcode.WriteFile(restaurantURL, qrcode.Medium, size, output); err != nil {
+					return cliFail(err)
+				}
+				fmt.Printf("✓ Copia salvata in %s\n", output)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&restaurantRef, "restaurant", "", "ID o username del ristorante")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "salva anche una copia del QR code in questo file PNG")
+	cmd.Flags().IntVar(&size, "size", 256, "lato in pixel della copia salvata con -o")
+	cmd.MarkFlagRequired("restaurant")
+	return cmd
+}
+
+// runScrubAnalytics esegue "qr-menu scrub-analytics": applica agli eventi analytics già
+// salvati l'anonimizzazione di analytics.anonymize_ip e hash_user_agent, come per i nuovi
+// eventi. Va eseguito una volta dopo averla attivata; gli eventi già anonimizzati restano invariati
+func runScrubAnalytics(configPath string) error {
+	settings, closeDB, err := cliSetup(configPath)
+	if err != nil {
+		return cliFail(err)
+	}
+	defer closeDB()
+
+	anonymizer, err := app.NewAnonymizer(settings.Analytics)
+	if err != nil {
+		return cliFail(err)
+	}
+	if !anonymizer.Enabled() {
+		return cliFail(errors.New("anonimizzazione disattivata: imposta analytics.anonymize_ip o analytics.hash_user_agent"))
+	}
+
+	// Gli eventi possono essere molti: il limite è più ampio di cliTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	updated, err := handlers.ScrubAnalyticsEvents(ctx, anonymizer)
+
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+	handlers.RecordAuditLog(context.Background(), "ANALYTICS_SCRUBBED", "analytics", "", "", handlers.OperatorClient, handlers.OperatorClient, status)
+	if err != nil {
+		return cliFail(err)
+	}
+	fmt.Printf("✓ %d eventi anonimizzati\n", updated)
+	return nil
+}
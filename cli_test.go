@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRunCLIExitCodes tests that unknown commands and invalid arguments exit with code 2
+// before touching configuration or database
+func TestRunCLIExitCodes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = devNull, devNull
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"help"}, 0},
+		{[]string{"--help"}, 0},
+		{[]string{"unknown"}, 2},
+		{[]string{"export-menu"}, 2},
+		{[]string{"create-admin", "--username", "mario"}, 2},
+		{[]string{"import-menu", "--restaurant", "da-mario"}, 2},
+		{[]string{"backup"}, 2},
+		{[]string{"backup", "now", "--mode", "differential"}, 2},
+		{[]string{"generate-qr", "--restaurant", "da-mario", "--size", "0"}, 2},
+		{[]string{"migrate", "down"}, 2},
+		{[]string{"migrate", "new"}, 2},
+		{[]string{"doctor", "extra"}, 2},
+	}
+	for _, tt := range tests {
+		if code := runCLI("config.yaml", tt.args); code != tt.code {
+			t.Errorf("runCLI(%v) = %d, expected %d", tt.args, code, tt.code)
+		}
+	}
+
+	// The session key is only needed by the server
+	if _, err := os.Stat(filepath.Join("storage", "session_key.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected no session key created by CLI commands, got %v", err)
+	}
+}
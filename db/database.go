@@ -7,6 +7,10 @@ import (
 	"time"
 
 	"qr-menu/logger"
+
+	// Driver dei database SQL supportati (database.engine)
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 )
 
 // DatabaseManager gestisce la connessione al database
@@ -23,7 +27,7 @@ type DatabaseManager struct {
 
 // DatabaseConfig contiene la configurazione del database
 type DatabaseConfig struct {
-	Type        string        // postgres, mysql, sqlite
+	Type        string        // postgres o mysql
 	DSN         string        // Data Source Name
 	MaxOpen     int           // Max open connections
 	MaxIdle     int           // Max idle connections
@@ -76,8 +80,6 @@ func (dm *DatabaseManager) Init(config DatabaseConfig) error {
 		driver = "postgres"
 	case "mysql":
 		driver = "mysql"
-	case "sqlite":
-		driver = "sqlite3"
 	default:
 		return fmt.Errorf("database type non supportato: %s", dm.dbType)
 	}
@@ -95,6 +97,7 @@ func (dm *DatabaseManager) Init(config DatabaseConfig) error {
 
 	// Testa la connessione
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return fmt.Errorf("errore connessione database: %w", err)
 	}
 
@@ -214,7 +217,7 @@ func (dm *DatabaseManager) BeginTx() (*sql.Tx, error) {
 	return dm.db.Begin()
 }
 
-// ExecuteMigration esegue una migrazione
+// ExecuteMigration esegue le istruzioni di uno script SQL in una transazione
 func (dm *DatabaseManager) ExecuteMigration(sql string) error {
 	dm.mu.RLock()
 	defer dm.mu.RUnlock()
@@ -223,67 +226,19 @@ func (dm *DatabaseManager) ExecuteMigration(sql string) error {
 		return fmt.Errorf("database non connesso")
 	}
 
-	// Dividi il SQL in singoli statement
-	statements := dm.splitStatements(sql)
-
-	for _, stmt := range statements {
-		if stmt = dm.trimStatement(stmt); stmt == "" {
-			continue
-		}
-
-		if _, err := dm.db.Exec(stmt); err != nil {
-			return fmt.Errorf("errore esecuzione migrazione: %w", err)
-		}
-	}
-
-	return nil
-}
-
-// splitStatements divide il SQL in singoli statement
-func (dm *DatabaseManager) splitStatements(sql string) []string {
-	var statements []string
-	var current string
-
-	for _, line := range string(sql) {
-		if line == ';' {
-			statements = append(statements, current)
-			current = ""
-		} else {
-			current += string(line)
-		}
-	}
-
-	if current != "" {
-		statements = append(statements, current)
+	tx, err := dm.db.Begin()
+	if err != nil {
+		return fmt.Errorf("errore esecuzione migrazione: %w", err)
 	}
+	defer tx.Rollback() // Nessun effetto dopo il commit
 
-	return statements
-}
-
-// trimStatement rimuove commenti e whitespace
-func (dm *DatabaseManager) trimStatement(sql string) string {
-	lines := ""
-
-	for _, line := range string(sql) {
-		// Skip comment lines
-		trimmed := dm.trimString(string(line))
-		if trimmed != "" && !dm.isCommentLine(trimmed) {
-			lines = dm.trimString(lines + string(line))
+	for _, stmt := range splitSQLStatements(sql) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("errore esecuzione migrazione: %w", err)
 		}
 	}
 
-	return dm.trimString(lines)
-}
-
-// trimString rimuove whitespace
-func (dm *DatabaseManager) trimString(s string) string {
-	return string(s)
-}
-
-// isCommentLine verifica se è una riga di commento
-func (dm *DatabaseManager) isCommentLine(line string) bool {
-	trimmed := string(line)
-	return len(trimmed) > 0 && trimmed[0] == '-' && len(trimmed) > 1 && trimmed[1] == '-'
+	return tx.Commit()
 }
 
 // CreateMigrationTable crea la tabella di tracking delle migrazioni
@@ -295,7 +250,9 @@ func (dm *DatabaseManager) CreateMigrationTable() error {
 		return fmt.Errorf("database non connesso")
 	}
 
-	// Skip for now, implementato dal migration manager
+	if _, err := dm.db.Exec(schemaMigrationsDDL); err != nil {
+		return fmt.Errorf("errore creazione schema_migrations: %w", err)
+	}
 	return nil
 }
 
@@ -308,8 +265,11 @@ func (dm *DatabaseManager) InsertMigrationRecord(version string, name string) er
 		return fmt.Errorf("database non connesso")
 	}
 
-	query := `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
-	_, err := dm.db.Exec(query, version, name)
+	query := `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`
+	if dm.dbType == "postgres" {
+		query = `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`
+	}
+	_, err := dm.db.Exec(query, version, name, time.Now().UTC())
 	return err
 }
 
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+// TestSQLDriversRegistered tests that the drivers of every supported database.engine are
+// linked in the binary
+func TestSQLDriversRegistered(t *testing.T) {
+	registered := map[string]bool{}
+	for _, name := range sql.Drivers() {
+		registered[name] = true
+	}
+	for _, driver := range []string{"postgres", "mysql"} {
+		if !registered[driver] {
+			t.Errorf("Expected SQL driver %q to be registered, got %v", driver, sql.Drivers())
+		}
+	}
+}
+
+// TestDatabaseManagerOpensDrivers tests that Init opens the real drivers, the default one
+// included: with nothing listening the connection fails, but not because the driver is missing
+func TestDatabaseManagerOpensDrivers(t *testing.T) {
+	tests := []struct {
+		name   string
+		config DatabaseConfig
+	}{
+		{"default", DatabaseConfig{DSN: "postgres://qrmenu@127.0.0.1:1/qrmenu?sslmode=disable&connect_timeout=2"}},
+		{"mysql", DatabaseConfig{Type: "mysql", DSN: "qrmenu@tcp(127.0.0.1:1)/qrmenu?timeout=2s"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm := &DatabaseManager{dbType: GetDatabaseManager().dbType}
+			err := dm.Init(tt.config)
+			if err == nil {
+				t.Fatal("Expected connection error with nothing listening")
+			}
+			if !strings.Contains(err.Error(), "errore connessione database") || strings.Contains(err.Error(), "unknown driver") {
+				t.Errorf("Expected a connection error from the driver, got %v", err)
+			}
+			if dm.GetConnection() != nil {
+				t.Error("Expected no connection after a failed ping")
+			}
+		})
+	}
+
+	dm := &DatabaseManager{}
+	if err := dm.Init(DatabaseConfig{Type: "sqlite", DSN: "file::memory:"}); err == nil || !strings.Contains(err.Error(), "non supportato") {
+		t.Errorf("Expected unsupported type error for sqlite, got %v", err)
+	}
+}
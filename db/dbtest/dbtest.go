@@ -0,0 +1,101 @@
+// Package dbtest collega i test dei pacchetti che usano db.MongoInstance, come gli handler
+// HTTP, a un mongod reale.
+//
+// L'indirizzo del server è in MONGODB_TEST_URI (es. mongodb://localhost:27017); senza, i test
+// che usano New vengono saltati. Ogni test lavora su un database nuovo, con gli stessi indici
+// della produzione, che viene eliminato alla fine del test
+package dbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"qr-menu/db"
+)
+
+// URIEnv è la variabile d'ambiente con l'indirizzo del mongod dei test
+const URIEnv = "MONGODB_TEST_URI"
+
+// Store è il database di un test
+type Store struct {
+	db *db.MongoClient
+}
+
+// New crea un database vuoto con gli indici dell'applicazione e lo imposta come
+// db.MongoInstance fino alla fine del test, quando viene eliminato e viene ripristinata
+// l'istanza precedente. Salta il test se MONGODB_TEST_URI non è impostata
+func New(t testing.TB) *Store {
+	t.Helper()
+	uri := os.Getenv(URIEnv)
+	if uri == "" {
+		t.Skip(URIEnv + " non impostata: test con MongoDB saltato")
+	}
+
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	name := "qr-menu-test-" + hex.EncodeToString(suffix)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	previous := db.MongoInstance
+	if err := db.ConnectURI(ctx, uri, name); err != nil {
+		db.MongoInstance = previous
+		t.Fatalf("dbtest: connessione a %s: %v", uri, err)
+	}
+	s := &Store{db: db.MongoInstance}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.db.DB.Drop(ctx); err != nil {
+			t.Errorf("dbtest: eliminazione del database %s: %v", name, err)
+		}
+		s.db.Disconnect()
+		db.MongoInstance = previous
+	})
+	return s
+}
+
+// Insert aggiunge documenti (struct o mappe con tag bson) alla collection
+func (s *Store) Insert(t testing.TB, collection string, docs ...interface{}) {
+	t.Helper()
+	if _, err := s.db.DB.Collection(collection).InsertMany(context.Background(), docs); err != nil {
+		t.Fatalf("dbtest: insert in %s: %v", collection, err)
+	}
+}
+
+// Find decodifica in out (puntatore a slice) i documenti della collection che corrispondono
+// al filtro
+func (s *Store) Find(t testing.TB, collection string, filter interface{}, out interface{}) {
+	t.Helper()
+	ctx := context.Background()
+	if filter == nil {
+		filter = bson.M{}
+	}
+	cursor, err := s.db.DB.Collection(collection).Find(ctx, filter)
+	if err != nil {
+		t.Fatalf("dbtest: find in %s: %v", collection, err)
+	}
+	if err := cursor.All(ctx, out); err != nil {
+		t.Fatalf("dbtest: decodifica dei documenti di %s: %v", collection, err)
+	}
+}
+
+// Count restituisce il numero di documenti della collection che corrispondono al filtro
+func (s *Store) Count(t testing.TB, collection string, filter interface{}) int {
+	t.Helper()
+	if filter == nil {
+		filter = bson.M{}
+	}
+	n, err := s.db.DB.Collection(collection).CountDocuments(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("dbtest: count in %s: %v", collection, err)
+	}
+	return int(n)
+}
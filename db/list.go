@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListOptions pagina e ordina le ricerche degli endpoint di elenco. Sort elenca i campi
+// bson, con "-" davanti per l'ordine decrescente; vuoto usa l'ordinamento predefinito
+type ListOptions struct {
+	Skip  int64
+	Limit int64
+	Sort  []string
+}
+
+// sortDocument converte Sort nel documento di ordinamento di MongoDB
+func (o ListOptions) sortDocument(defaultSort ...string) bson.D {
+	fields := o.Sort
+	if len(fields) == 0 {
+		fields = defaultSort
+	}
+	sort := make(bson.D, 0, len(fields))
+	for _, field := range fields {
+		if strings.HasPrefix(field, "-") {
+			sort = append(sort, bson.E{Key: field[1:], Value: -1})
+		} else {
+			sort = append(sort, bson.E{Key: field, Value: 1})
+		}
+	}
+	return sort
+}
+
+// findPage restituisce una pagina dei documenti che soddisfano query e il loro numero totale
+func findPage[T any](ctx context.Context, coll *mongo.Collection, query bson.M, opts ListOptions, defaultSort ...string) ([]*T, int64, error) {
+	total, err := coll.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	findOpts := options.Find().SetSort(opts.sortDocument(defaultSort...)).SetSkip(opts.Skip)
+	if opts.Limit > 0 {
+		findOpts.SetLimit(opts.Limit)
+	}
+	cursor, err := coll.Find(ctx, query, findOpts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	results := make([]*T, 0)
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
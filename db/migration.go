@@ -1,6 +1,8 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -17,8 +19,10 @@ type Migration struct {
 	Version   string    `json:"version"`
 	Name      string    `json:"name"`
 	AppliedAt time.Time `json:"applied_at,omitempty"`
-	Status    string    `json:"status"` // pending, applied, failed
+	Status    string    `json:"status"` // pending, applied, failed, modified (applicata ma file cambiato)
 	SQL       string    `json:"-"`
+	DownSQL   string    `json:"-"`        // Da <versione>_<nome>.down.sql, vuoto se la migrazione non è annullabile
+	Checksum  string    `json:"checksum"` // SHA256 del file, registrato in schema_migrations all'applicazione
 }
 
 // MigrationManager gestisce le migrazioni del database
@@ -27,14 +31,17 @@ type MigrationManager struct {
 	migrationsPath    string
 	appliedMigrations []Migration
 	pendingMigrations []Migration
-	databaseType      string // postgres, mysql, sqlite
+	databaseType      string // postgres o mysql
 	schemaVersion     int
+	db                *sql.DB  // Connessione su cui vengono eseguite le migrazioni
+	modified          []string // Migrazioni applicate il cui file è cambiato (vedi syncApplied)
 }
 
 // MigrationConfig contiene la configurazione per le migrazioni
 type MigrationConfig struct {
-	MigrationsPath string // Path ai file di migrazione
-	DatabaseType   string // postgres, mysql, sqlite
+	MigrationsPath string  // Path ai file di migrazione
+	DatabaseType   string  // postgres o mysql
+	DB             *sql.DB // Connessione su cui eseguire le migrazioni (nil = solo elenco dei file)
 }
 
 var (
@@ -228,6 +235,29 @@ CREATE TABLE IF NOT EXISTS notification_history (
 	INDEX idx_restaurant_id (restaurant_id),
 	INDEX idx_created_at (created_at)
 );`,
+
+		// Down-migration: annullano la migrazione con la stessa versione (vedi RollbackMigration)
+		"001_initial_schema.down": `-- Drop the initial schema, children first
+DROP TABLE IF EXISTS menu_items;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS menus;
+DROP TABLE IF EXISTS restaurants;`,
+
+		"002_add_orders_table.down": `-- Drop orders tables
+DROP TABLE IF EXISTS order_items;
+DROP TABLE IF EXISTS orders;`,
+
+		"003_add_analytics_table.down": `-- Drop analytics tables
+DROP TABLE IF EXISTS analytics_sessions;
+DROP TABLE IF EXISTS analytics_events;`,
+
+		"004_add_backups_table.down": `-- Drop backups tables
+DROP TABLE IF EXISTS backup_schedules;
+DROP TABLE IF EXISTS backups;`,
+
+		"005_add_notifications_table.down": `-- Drop notifications tables
+DROP TABLE IF EXISTS notification_history;
+DROP TABLE IF EXISTS notification_preferences;`,
 	}
 )
 
@@ -254,6 +284,7 @@ func (mm *MigrationManager) Init(config MigrationConfig) error {
 	if config.DatabaseType != "" {
 		mm.databaseType = config.DatabaseType
 	}
+	mm.db = config.DB
 
 	// Crea la directory per le migrazioni
 	if err := os.MkdirAll(mm.migrationsPath, 0755); err != nil {
@@ -267,6 +298,15 @@ func (mm *MigrationManager) Init(config MigrationConfig) error {
 		})
 	}
 
+	// Separa le migrazioni già applicate secondo schema_migrations
+	if mm.db != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+		defer cancel()
+		if err := mm.syncApplied(ctx); err != nil {
+			return err
+		}
+	}
+
 	logger.Info("Migration manager inizializzato", map[string]interface{}{
 		"migrations_path": mm.migrationsPath,
 		"database_type":   mm.databaseType,
@@ -308,6 +348,61 @@ func (mm *MigrationManager) CreateDefaultMigrations() error {
 	return nil
 }
 
+// NewMigration crea i file vuoti di una nuova migrazione, <timestamp>_<nome>.sql e
+// <timestamp>_<nome>.down.sql: la versione è l'ora UTC (AAAAMMGGhhmmss), quindi segue le
+// migrazioni esistenti e non collide tra sviluppatori diversi. Restituisce i path creati
+func (mm *MigrationManager) NewMigration(name string, now time.Time) (upPath, downPath string, err error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	slug := migrationSlug(name)
+	if slug == "" {
+		return "", "", fmt.Errorf("nome migrazione non valido: %q", name)
+	}
+	if err := os.MkdirAll(mm.migrationsPath, 0755); err != nil {
+		return "", "", fmt.Errorf("errore creazione directory migrazioni: %w", err)
+	}
+
+	base := now.UTC().Format("20060102150405") + "_" + slug
+	upPath = filepath.Join(mm.migrationsPath, base+".sql")
+	downPath = filepath.Join(mm.migrationsPath, base+".down.sql")
+	files := map[string]string{
+		upPath:   fmt.Sprintf("-- %s\n", name),
+		downPath: fmt.Sprintf("-- Annulla %s\n", base),
+	}
+	for _, path := range []string{upPath, downPath} {
+		// O_EXCL: non sovrascrive una migrazione creata nello stesso secondo
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return "", "", fmt.Errorf("errore creazione migrazione: %w", err)
+		}
+		_, err = f.WriteString(files[path])
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("errore scrittura migrazione: %w", err)
+		}
+	}
+	return upPath, downPath, nil
+}
+
+// migrationSlug riduce il nome di una migrazione a lettere minuscole, cifre e underscore
+func migrationSlug(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ', r == '-', r == '_':
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
 // loadMigrations carica tutte le migrazioni dai file
 func (mm *MigrationManager) loadMigrations() error {
 	entries, err := os.ReadDir(mm.migrationsPath)
@@ -320,14 +415,29 @@ func (mm *MigrationManager) loadMigrations() error {
 	}
 
 	migrations := []Migration{}
+	downSQL := map[string]string{}
 
 	for _, entry := range entries {
 		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
 			continue
 		}
 
+		// Le down-migration (001_initial_schema.down.sql) vengono associate alla migrazione
+		if name, ok := strings.CutSuffix(entry.Name(), ".down.sql"); ok {
+			data, err := os.ReadFile(filepath.Join(mm.migrationsPath, entry.Name()))
+			if err != nil {
+				logger.Warn("Errore lettura migration file", map[string]interface{}{
+					"file":  entry.Name(),
+					"error": err.Error(),
+				})
+				continue
+			}
+			downSQL[name] = string(data)
+			continue
+		}
+
 		// Estrai versione dal nome file (es. 001_initial_schema.sql -> 001)
-		version := strings.TrimSuffix(entry.Name(), ".sql")
+		version := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".sql"), ".up")
 		parts := strings.Split(version, "_")
 		if len(parts) < 1 {
 			continue
@@ -344,15 +454,20 @@ func (mm *MigrationManager) loadMigrations() error {
 		}
 
 		migration := Migration{
-			Version: parts[0],
-			Name:    version,
-			SQL:     string(sqlData),
-			Status:  "pending",
+			Version:  parts[0],
+			Name:     version,
+			SQL:      string(sqlData),
+			Status:   "pending",
+			Checksum: migrationChecksum(string(sqlData)),
 		}
 
 		migrations = append(migrations, migration)
 	}
 
+	for i := range migrations {
+		migrations[i].DownSQL = downSQL[migrations[i].Name]
+	}
+
 	// Ordina le migrazioni per versione
 	sort.Slice(migrations, func(i, j int) bool {
 		return migrations[i].Version < migrations[j].Version
@@ -442,27 +557,57 @@ func (mm *MigrationManager) MarkMigrationFailed(version string, errMsg string) e
 	return fmt.Errorf("migrazione non trovata: %s", version)
 }
 
-// RollbackMigration esegue il rollback di una migrazione
+// RollbackMigration annulla l'ultima migrazione applicata eseguendone la down-migration in
+// una transazione e rimuovendola da schema_migrations. Le migrazioni vanno annullate dalla più
+// recente, quindi version deve essere l'ultima applicata
 func (mm *MigrationManager) RollbackMigration(version string) error {
 	mm.mu.Lock()
 	defer mm.mu.Unlock()
 
-	for i, m := range mm.appliedMigrations {
-		if m.Version == version {
-			m.Status = "pending"
-			mm.pendingMigrations = append(mm.pendingMigrations, m)
-			mm.appliedMigrations = append(mm.appliedMigrations[:i], mm.appliedMigrations[i+1:]...)
-
-			logger.Info("Migrazione rollback", map[string]interface{}{
-				"version": version,
-				"name":    m.Name,
-			})
-
-			return nil
+	if mm.db == nil {
+		return fmt.Errorf("database non connesso")
+	}
+	if err := mm.checkModified(); err != nil {
+		return err
+	}
+	last := len(mm.appliedMigrations) - 1
+	if last < 0 || mm.appliedMigrations[last].Version != version {
+		for _, m := range mm.appliedMigrations {
+			if m.Version == version {
+				return fmt.Errorf("annullare prima le migrazioni successive a %s", version)
+			}
 		}
+		return fmt.Errorf("migrazione applicata non trovata: %s", version)
+	}
+	m := mm.appliedMigrations[last]
+	if strings.TrimSpace(m.DownSQL) == "" {
+		return fmt.Errorf("la migrazione %s non ha una down-migration (%s.down.sql)", version, m.Name)
 	}
 
-	return fmt.Errorf("migrazione applicata non trovata: %s", version)
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+	err := mm.runInTx(ctx, m.DownSQL, "DELETE FROM schema_migrations WHERE version = "+mm.placeholder(1), m.Version)
+	if err != nil {
+		logger.Error("Rollback migrazione fallito", map[string]interface{}{
+			"version": version,
+			"name":    m.Name,
+			"error":   err.Error(),
+		})
+		return fmt.Errorf("rollback della migrazione %s fallito: %w", version, err)
+	}
+
+	m.Status = "pending"
+	m.AppliedAt = time.Time{}
+	mm.pendingMigrations = append([]Migration{m}, mm.pendingMigrations...)
+	mm.appliedMigrations = mm.appliedMigrations[:last]
+	mm.schemaVersion = mm.appliedVersion()
+
+	logger.Info("Migrazione rollback", map[string]interface{}{
+		"version": version,
+		"name":    m.Name,
+	})
+
+	return nil
 }
 
 // GetNextMigration restituisce la prossima migrazione da applicare
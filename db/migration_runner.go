@@ -0,0 +1,314 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"qr-menu/logger"
+)
+
+// migrationTimeout limita la durata di una singola migrazione
+const migrationTimeout = 10 * time.Minute
+
+// schemaMigrationsDDL crea la tabella con le versioni applicate, compatibile con postgres e
+// mysql
+const schemaMigrationsDDL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version VARCHAR(50) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	applied_at TIMESTAMP NOT NULL,
+	checksum VARCHAR(64)
+)`
+
+// ApplyPending esegue in ordine le migrazioni in attesa, ciascuna in una transazione insieme
+// alla registrazione in schema_migrations: una migrazione fallita non lascia modifiche parziali
+// (su mysql le istruzioni DDL fanno commit implicito e non possono essere annullate) e ferma le
+// successive. Si rifiuta di procedere se il file di una migrazione già applicata è stato
+// modificato. Restituisce le migrazioni applicate
+func (mm *MigrationManager) ApplyPending(ctx context.Context) ([]Migration, error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if mm.db == nil {
+		return nil, fmt.Errorf("database non connesso")
+	}
+	// Un altro processo può aver applicato migrazioni nel frattempo
+	if err := mm.syncApplied(ctx); err != nil {
+		return nil, err
+	}
+	if err := mm.checkModified(); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for len(mm.pendingMigrations) > 0 {
+		m := mm.pendingMigrations[0]
+		now := time.Now().UTC()
+		record := fmt.Sprintf("INSERT INTO schema_migrations (version, name, applied_at, checksum) VALUES (%s, %s, %s, %s)",
+			mm.placeholder(1), mm.placeholder(2), mm.placeholder(3), mm.placeholder(4))
+
+		migrationCtx, cancel := context.WithTimeout(ctx, migrationTimeout)
+		err := mm.runInTx(migrationCtx, m.SQL, record, m.Version, m.Name, now, m.Checksum)
+		cancel()
+		if err != nil {
+			mm.pendingMigrations[0].Status = "failed"
+			logger.Error("Migrazione fallita", map[string]interface{}{
+				"version": m.Version,
+				"name":    m.Name,
+				"error":   err.Error(),
+			})
+			return applied, fmt.Errorf("migrazione %s fallita: %w", m.Name, err)
+		}
+
+		m.Status = "applied"
+		m.AppliedAt = now
+		mm.appliedMigrations = append(mm.appliedMigrations, m)
+		mm.pendingMigrations = mm.pendingMigrations[1:]
+		mm.schemaVersion = mm.appliedVersion()
+		applied = append(applied, m)
+
+		logger.Info("Migrazione applicata", map[string]interface{}{
+			"version": m.Version,
+			"name":    m.Name,
+		})
+	}
+	return applied, nil
+}
+
+// appliedRecord è una riga di schema_migrations
+type appliedRecord struct {
+	at       time.Time
+	checksum string // Vuoto per le righe registrate prima dei checksum
+}
+
+// syncApplied crea schema_migrations se manca e divide le migrazioni caricate in applicate e in
+// attesa secondo le versioni registrate, confrontando i checksum dei file con quelli registrati.
+// Le righe senza checksum ricevono quello del file attuale; va chiamata con mm.mu bloccato
+func (mm *MigrationManager) syncApplied(ctx context.Context) error {
+	records, err := mm.readApplied(ctx)
+	if err != nil {
+		return err
+	}
+
+	all := append(append([]Migration{}, mm.appliedMigrations...), mm.pendingMigrations...)
+	mm.appliedMigrations, mm.pendingMigrations, mm.modified = nil, nil, nil
+	for _, m := range all {
+		record, ok := records[m.Version]
+		if !ok {
+			if m.Status != "pending" && m.Status != "failed" {
+				m.Status = "pending" // Annullata da un altro processo
+			}
+			mm.pendingMigrations = append(mm.pendingMigrations, m)
+			continue
+		}
+
+		m.Status = "applied"
+		m.AppliedAt = record.at
+		switch record.checksum {
+		case m.Checksum:
+		case "":
+			if err := mm.recordChecksum(ctx, m); err != nil {
+				return err
+			}
+		default:
+			m.Status = "modified"
+			mm.modified = append(mm.modified, m.Name)
+		}
+		mm.appliedMigrations = append(mm.appliedMigrations, m)
+	}
+	for _, list := range [][]Migration{mm.appliedMigrations, mm.pendingMigrations} {
+		sortMigrations(list)
+	}
+	if len(mm.appliedMigrations) < len(records) {
+		logger.Warn("Migrazioni registrate in schema_migrations senza file", map[string]interface{}{
+			"registered": len(records),
+			"found":      len(mm.appliedMigrations),
+		})
+	}
+	if len(mm.modified) > 0 {
+		sort.Strings(mm.modified)
+		logger.Error("File di migrazioni già applicate modificati", map[string]interface{}{
+			"migrations": mm.modified,
+		})
+	}
+	mm.schemaVersion = mm.appliedVersion()
+	return nil
+}
+
+// readApplied crea schema_migrations se manca e ne legge le righe per versione. Aggiunge la
+// colonna checksum alle tabelle create prima dei checksum
+func (mm *MigrationManager) readApplied(ctx context.Context) (map[string]appliedRecord, error) {
+	if _, err := mm.db.ExecContext(ctx, schemaMigrationsDDL); err != nil {
+		return nil, fmt.Errorf("errore creazione schema_migrations: %w", err)
+	}
+
+	const query = `SELECT version, applied_at, checksum FROM schema_migrations`
+	rows, err := mm.db.QueryContext(ctx, query)
+	if err != nil {
+		if _, alterErr := mm.db.ExecContext(ctx, `ALTER TABLE schema_migrations ADD COLUMN checksum VARCHAR(64)`); alterErr != nil {
+			return nil, fmt.Errorf("errore lettura migrazioni: %w", err)
+		}
+		if rows, err = mm.db.QueryContext(ctx, query); err != nil {
+			return nil, fmt.Errorf("errore lettura migrazioni: %w", err)
+		}
+	}
+	defer rows.Close()
+
+	records := map[string]appliedRecord{}
+	for rows.Next() {
+		var version string
+		var record appliedRecord
+		var checksum sql.NullString
+		if err := rows.Scan(&version, &record.at, &checksum); err != nil {
+			return nil, fmt.Errorf("errore lettura migrazioni: %w", err)
+		}
+		record.checksum = checksum.String
+		records[version] = record
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("errore lettura migrazioni: %w", err)
+	}
+	return records, nil
+}
+
+// recordChecksum registra il checksum di una migrazione applicata prima dei checksum
+func (mm *MigrationManager) recordChecksum(ctx context.Context, m Migration) error {
+	query := fmt.Sprintf("UPDATE schema_migrations SET checksum = %s WHERE version = %s", mm.placeholder(1), mm.placeholder(2))
+	if _, err := mm.db.ExecContext(ctx, query, m.Checksum, m.Version); err != nil {
+		return fmt.Errorf("errore registrazione checksum di %s: %w", m.Name, err)
+	}
+	return nil
+}
+
+// checkModified blocca applicazione e rollback se il file di una migrazione già applicata è
+// cambiato: lo schema non corrisponderebbe più ai file. Va chiamata con mm.mu bloccato
+func (mm *MigrationManager) checkModified() error {
+	if len(mm.modified) == 0 {
+		return nil
+	}
+	return fmt.Errorf("migrazioni già applicate modificate dopo l'applicazione: %s (ripristinare i file originali e "+
+		"descrivere le modifiche in una nuova migrazione, qr-menu migrate new <nome>)", strings.Join(mm.modified, ", "))
+}
+
+// migrationChecksum calcola il checksum del file di una migrazione
+func migrationChecksum(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(sum[:])
+}
+
+// runInTx esegue le istruzioni di script e la query di registrazione in una transazione
+func (mm *MigrationManager) runInTx(ctx context.Context, script, record string, args ...interface{}) error {
+	tx, err := mm.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Nessun effetto dopo il commit
+
+	for i, stmt := range splitSQLStatements(script) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("istruzione %d: %w", i+1, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("errore registrazione in schema_migrations: %w", err)
+	}
+	return tx.Commit()
+}
+
+// placeholder restituisce il segnaposto dell'n-esimo parametro per il database configurato
+func (mm *MigrationManager) placeholder(n int) string {
+	if mm.databaseType == "postgres" {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// appliedVersion restituisce la versione numerica dell'ultima migrazione applicata
+func (mm *MigrationManager) appliedVersion() int {
+	if len(mm.appliedMigrations) == 0 {
+		return 0
+	}
+	version, _ := strconv.Atoi(mm.appliedMigrations[len(mm.appliedMigrations)-1].Version)
+	return version
+}
+
+// sortMigrations ordina le migrazioni per versione
+func sortMigrations(migrations []Migration) {
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+}
+
+// splitSQLStatements divide uno script SQL nelle singole istruzioni, separate da ';' fuori da
+// stringhe, identificatori tra virgolette, commenti e blocchi $$ di postgres. I commenti
+// vengono rimossi e le istruzioni vuote ignorate
+func splitSQLStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+				continue
+			}
+			i += end - 1 // Il ritorno a capo resta nell'istruzione
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+				continue
+			}
+			i += end + 3
+			current.WriteByte(' ')
+		case c == '\'' || c == '"' || c == '`':
+			end := closingQuote(script, i)
+			current.WriteString(script[i:end])
+			i = end - 1
+		case c == '$' && strings.HasPrefix(script[i:], "$$"):
+			end := len(script)
+			if k := strings.Index(script[i+2:], "$$"); k >= 0 {
+				end = i + 2 + k + 2
+			}
+			current.WriteString(script[i:end])
+			i = end - 1
+		case c == ';':
+			flush()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return statements
+}
+
+// closingQuote restituisce la posizione successiva alla chiusura della stringa che inizia in
+// start; una virgoletta ripetuta due volte (come in 'l”ora') fa parte della stringa
+func closingQuote(script string, start int) int {
+	quote := script[start]
+	for i := start + 1; i < len(script); i++ {
+		if script[i] == quote {
+			if i+1 < len(script) && script[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(script)
+}
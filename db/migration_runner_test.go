@@ -0,0 +1,307 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDB is the state shared by the connections of the fake driver: committed statements and
+// schema_migrations rows. Statements containing failOn fail
+type fakeDB struct {
+	mu       sync.Mutex
+	executed []string
+	applied  map[string]fakeRecord
+	failOn   string
+}
+
+type fakeRecord struct {
+	at       time.Time
+	checksum interface{} // nil for rows recorded without checksum
+}
+
+type fakeDriver struct{ db *fakeDB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{db: d.db}, nil }
+
+// fakeConn applies statements on commit, so rolled back transactions leave no trace
+type fakeConn struct {
+	db      *fakeDB
+	pending []func()
+	inTx    bool
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { c.inTx = true; return c, nil }
+
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for _, apply := range c.pending {
+		apply()
+	}
+	c.pending, c.inTx = nil, false
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	c.pending, c.inTx = nil, false
+	return nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c.db.failOn != "" && strings.Contains(query, c.db.failOn) {
+		return nil, errors.New("syntax error")
+	}
+	apply := func() {
+		c.db.executed = append(c.db.executed, query)
+		switch {
+		case strings.HasPrefix(query, "INSERT INTO schema_migrations"):
+			c.db.applied[args[0].Value.(string)] = fakeRecord{args[2].Value.(time.Time), args[3].Value}
+		case strings.HasPrefix(query, "UPDATE schema_migrations SET checksum"):
+			record := c.db.applied[args[1].Value.(string)]
+			record.checksum = args[0].Value
+			c.db.applied[args[1].Value.(string)] = record
+		case strings.HasPrefix(query, "DELETE FROM schema_migrations"):
+			delete(c.db.applied, args[0].Value.(string))
+		}
+	}
+	if c.inTx {
+		c.pending = append(c.pending, apply)
+	} else {
+		c.db.mu.Lock()
+		apply()
+		c.db.mu.Unlock()
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	rows := &fakeRows{}
+	for version, record := range c.db.applied {
+		rows.values = append(rows.values, []driver.Value{version, record.at, record.checksum})
+	}
+	return rows, nil
+}
+
+type fakeRows struct{ values [][]driver.Value }
+
+func (r *fakeRows) Columns() []string { return []string{"version", "applied_at", "checksum"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// newFakeMigrations writes the migration files to a temp dir and opens a fake database
+func newFakeMigrations(t *testing.T, files map[string]string) (*MigrationManager, *fakeDB) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fake := &fakeDB{applied: map[string]fakeRecord{}}
+	conn := sql.OpenDB(fakeConnector{fake})
+	t.Cleanup(func() { conn.Close() })
+
+	mm := &MigrationManager{}
+	if err := mm.Init(MigrationConfig{MigrationsPath: dir, DatabaseType: "postgres", DB: conn}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return mm, fake
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: c.db}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver(c) }
+
+// TestApplyPending tests that pending migrations run in order, each recorded in its transaction,
+// and that a failed migration leaves no changes and stops the next ones
+func TestApplyPending(t *testing.T) {
+	mm, fake := newFakeMigrations(t, map[string]string{
+		"001_a.sql":      "CREATE TABLE a (id INT);",
+		"002_b.up.sql":   "CREATE TABLE b (id INT); CREATE TABLE b2 (id INT)",
+		"002_b.down.sql": "DROP TABLE b2; DROP TABLE b;",
+		"003_c.sql":      "CREATE TABLE c (id INT); BROKEN;",
+		"004_d.sql":      "CREATE TABLE d (id INT);",
+	})
+	fake.failOn = "BROKEN"
+
+	applied, err := mm.ApplyPending(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "003_c") {
+		t.Fatalf("Expected 003_c to fail, got %v", err)
+	}
+	if len(applied) != 2 || applied[1].Name != "002_b" {
+		t.Fatalf("Expected 001 and 002 applied, got %+v", applied)
+	}
+	want := []string{
+		"CREATE TABLE IF NOT EXISTS schema_migrations",
+		"CREATE TABLE a (id INT)",
+		"INSERT INTO schema_migrations",
+		"CREATE TABLE b (id INT)",
+		"CREATE TABLE b2 (id INT)",
+		"INSERT INTO schema_migrations",
+	}
+	if len(fake.executed) != len(want)+1 { // +1: the table is created again by ApplyPending
+		t.Fatalf("Unexpected statements: %q", fake.executed)
+	}
+	for i, prefix := range want {
+		if got := fake.executed[i+1]; !strings.HasPrefix(got, prefix) {
+			t.Errorf("Statement %d = %q, want prefix %q", i, got, prefix)
+		}
+	}
+	if _, ok := fake.applied["003"]; ok {
+		t.Error("Failed migration recorded in schema_migrations")
+	}
+	if pending := mm.GetPendingMigrations(); len(pending) != 2 || pending[0].Status != "failed" {
+		t.Errorf("Expected 003 failed and 004 pending, got %+v", pending)
+	}
+	if v := mm.GetMigrationStatus()["current_version"]; v != 2 {
+		t.Errorf("Expected schema version 2, got %v", v)
+	}
+
+	// A new manager on the same database skips the recorded migrations
+	fake.failOn = ""
+	mm2 := &MigrationManager{}
+	if err := mm2.Init(MigrationConfig{MigrationsPath: mm.migrationsPath, DatabaseType: "postgres", DB: mm.db}); err != nil {
+		t.Fatal(err)
+	}
+	applied, err = mm2.ApplyPending(context.Background())
+	if err != nil || len(applied) != 2 || applied[0].Name != "003_c" {
+		t.Fatalf("Expected 003 and 004 applied, got %+v, %v", applied, err)
+	}
+}
+
+// TestRollbackMigration tests that only the newest migration is rolled back, with its down SQL
+func TestRollbackMigration(t *testing.T) {
+	mm, fake := newFakeMigrations(t, map[string]string{
+		"001_a.sql":      "CREATE TABLE a (id INT);",
+		"002_b.sql":      "CREATE TABLE b (id INT);",
+		"002_b.down.sql": "-- Undo 002\nDROP TABLE b;",
+	})
+	if _, err := mm.ApplyPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mm.RollbackMigration("001"); err == nil {
+		t.Error("Rolled back a migration that is not the newest")
+	}
+	if err := mm.RollbackMigration("002"); err != nil {
+		t.Fatalf("RollbackMigration failed: %v", err)
+	}
+	if last := fake.executed[len(fake.executed)-2]; last != "DROP TABLE b" {
+		t.Errorf("Expected the down SQL to run, got %q", last)
+	}
+	if _, ok := fake.applied["002"]; ok {
+		t.Error("Rolled back migration still recorded")
+	}
+	if pending := mm.GetPendingMigrations(); len(pending) != 1 || pending[0].Version != "002" {
+		t.Errorf("Expected 002 pending, got %+v", pending)
+	}
+
+	// 001 has no down-migration
+	if err := mm.RollbackMigration("001"); err == nil || !strings.Contains(err.Error(), "down") {
+		t.Errorf("Expected missing down-migration error, got %v", err)
+	}
+}
+
+// TestModifiedMigration tests that editing an applied migration blocks the runner, and that
+// rows recorded without checksum get the one of the current file
+func TestModifiedMigration(t *testing.T) {
+	mm, fake := newFakeMigrations(t, map[string]string{
+		"001_a.sql": "CREATE TABLE a (id INT);",
+		"002_b.sql": "CREATE TABLE b (id INT);",
+	})
+	if _, err := mm.ApplyPending(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fake.applied["002"] = fakeRecord{at: fake.applied["002"].at} // Recorded before checksums
+
+	if err := os.WriteFile(filepath.Join(mm.migrationsPath, "001_a.sql"), []byte("CREATE TABLE a (id BIGINT);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mm.migrationsPath, "003_c.sql"), []byte("CREATE TABLE c (id INT);"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mm2 := &MigrationManager{}
+	if err := mm2.Init(MigrationConfig{MigrationsPath: mm.migrationsPath, DatabaseType: "postgres", DB: mm.db}); err != nil {
+		t.Fatal(err)
+	}
+
+	if fake.applied["002"].checksum != migrationChecksum("CREATE TABLE b (id INT);") {
+		t.Errorf("Expected the missing checksum to be recorded, got %v", fake.applied["002"].checksum)
+	}
+	if applied := mm2.GetAppliedMigrations(); applied[0].Status != "modified" || applied[1].Status != "applied" {
+		t.Errorf("Expected 001 modified and 002 applied, got %+v", applied)
+	}
+	if _, err := mm2.ApplyPending(context.Background()); err == nil || !strings.Contains(err.Error(), "001_a") {
+		t.Errorf("Expected the modified migration to block the runner, got %v", err)
+	}
+	if _, ok := fake.applied["003"]; ok {
+		t.Error("Pending migration applied despite the modified one")
+	}
+}
+
+// TestNewMigration tests the scaffolded file names
+func TestNewMigration(t *testing.T) {
+	mm := &MigrationManager{migrationsPath: filepath.Join(t.TempDir(), "migrations")}
+	now := time.Date(2026, 10, 16, 14, 30, 5, 0, time.UTC)
+
+	up, down, err := mm.NewMigration("Add menu tags!", now)
+	if err != nil {
+		t.Fatalf("NewMigration failed: %v", err)
+	}
+	if filepath.Base(up) != "20261016143005_add_menu_tags.sql" || filepath.Base(down) != "20261016143005_add_menu_tags.down.sql" {
+		t.Errorf("Unexpected files %s, %s", up, down)
+	}
+	if _, _, err := mm.NewMigration("add menu tags", now); err == nil {
+		t.Error("Expected an error for an existing migration")
+	}
+	if _, _, err := mm.NewMigration("  --  ", now); err == nil {
+		t.Error("Expected an error for an empty name")
+	}
+
+	// The new migration sorts after the existing ones, with its down-migration
+	if err := mm.loadMigrations(); err != nil {
+		t.Fatal(err)
+	}
+	if pending := mm.GetPendingMigrations(); len(pending) != 1 || pending[0].Version != "20261016143005" || pending[0].DownSQL == "" {
+		t.Errorf("Unexpected migrations %+v", pending)
+	}
+}
+
+func TestSplitSQLStatements(t *testing.T) {
+	script := `-- comment; not a statement
+CREATE TABLE t (name VARCHAR(10) DEFAULT 'a;b', note TEXT DEFAULT 'it''s; ok');
+/* block; comment */ INSERT INTO t VALUES ("x;y");
+CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN RETURN NEW; END; $$ LANGUAGE plpgsql;
+;`
+	want := []string{
+		"CREATE TABLE t (name VARCHAR(10) DEFAULT 'a;b', note TEXT DEFAULT 'it''s; ok')",
+		`INSERT INTO t VALUES ("x;y")`,
+		"CREATE FUNCTION f() RETURNS trigger AS $$ BEGIN RETURN NEW; END; $$ LANGUAGE plpgsql",
+	}
+	if got := splitSQLStatements(script); !reflect.DeepEqual(got, want) {
+		t.Errorf("splitSQLStatements = %q, want %q", got, want)
+	}
+}
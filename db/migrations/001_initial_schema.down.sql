@@ -0,0 +1,5 @@
+-- Drop the initial schema, children first
+DROP TABLE IF EXISTS menu_items;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS menus;
+DROP TABLE IF EXISTS restaurants;
\ No newline at end of file
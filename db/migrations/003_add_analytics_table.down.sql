@@ -0,0 +1,3 @@
+-- Drop analytics tables
+DROP TABLE IF EXISTS analytics_sessions;
+DROP TABLE IF EXISTS analytics_events;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Drop backups tables
+DROP TABLE IF EXISTS backup_schedules;
+DROP TABLE IF EXISTS backups;
\ No newline at end of file
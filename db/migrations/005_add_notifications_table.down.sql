@@ -0,0 +1,3 @@
+-- Drop notifications tables
+DROP TABLE IF EXISTS notification_history;
+DROP TABLE IF EXISTS notification_preferences;
\ No newline at end of file
@@ -3,9 +3,11 @@ package db
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
 	"strings"
 	"time"
@@ -35,6 +37,49 @@ func Connect() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	client, err := dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Salva istanza
+	ctx3, cancel3 := context.WithTimeout(context.Background(), 30*time.Second)
+
+	dbName := os.Getenv("MONGODB_DB_NAME")
+	if dbName == "" {
+		dbName = "qr-menu"
+	}
+
+	MongoInstance = &MongoClient{
+		client: client,
+		DB:     client.Database(dbName),
+		ctx:    ctx3,
+		cancel: cancel3,
+	}
+
+	// Crea indici
+	if err := MongoInstance.createIndexes(); err != nil {
+		log.Printf("Avviso: errore nella creazione degli indici: %v", err)
+	}
+
+	log.Println("✓ Connesso a MongoDB Atlas")
+	return nil
+}
+
+// CheckConnection verifica configurazione e raggiungibilità di MongoDB senza
+// inizializzare l'istanza globale né creare indici (usata da "qr-menu doctor")
+func CheckConnection(ctx context.Context) error {
+	client, err := dial(ctx)
+	if err != nil {
+		return err
+	}
+	return client.Disconnect(ctx)
+}
+
+// dial apre la connessione a MongoDB leggendo URI e certificato dalle variabili d'ambiente
+// e ne verifica la raggiungibilità con un ping
+func dial(ctx context.Context) (*mongo.Client, error) {
+
 	// Leggi certificato X.509 - supporta sia env var che file
 	var certData []byte
 	var err error
@@ -50,12 +95,12 @@ func Connect() error {
 		// Opzione 2: Certificato da file (per sviluppo locale)
 		certPath := os.Getenv("MONGODB_CERT_PATH")
 		if certPath == "" {
-			return fmt.Errorf("nessun certificato MongoDB configurato: imposta MONGODB_CERT_CONTENT (contenuto) o MONGODB_CERT_PATH (path file)")
+			return nil, fmt.Errorf("nessun certificato MongoDB configurato: imposta MONGODB_CERT_CONTENT (contenuto) o MONGODB_CERT_PATH (path file)")
 		}
 
 		certData, err = ioutil.ReadFile(certPath)
 		if err != nil {
-			return fmt.Errorf("errore lettura certificato da %s: %v", certPath, err)
+			return nil, fmt.Errorf("errore lettura certificato da %s: %v", certPath, err)
 		}
 		log.Printf("✓ Certificato MongoDB caricato da file: %s\n", certPath)
 	}
@@ -66,7 +111,7 @@ func Connect() error {
 	// Parse certificato per client certificate authentication
 	cert, err := tls.X509KeyPair(certData, certData)
 	if err != nil {
-		return fmt.Errorf("errore nel parsing del certificato: %v", err)
+		return nil, fmt.Errorf("errore nel parsing del certificato: %v", err)
 	}
 
 	tlsConfig.Certificates = []tls.Certificate{cert}
@@ -76,7 +121,7 @@ func Connect() error {
 	// Connection string MongoDB Atlas
 	mongoURI := os.Getenv("MONGODB_URI")
 	if mongoURI == "" {
-		return fmt.Errorf("MONGODB_URI non configurato - imposta la connection string completa")
+		return nil, fmt.Errorf("MONGODB_URI non configurato - imposta la connection string completa")
 	}
 
 	// Opzioni di connessione
@@ -88,7 +133,7 @@ func Connect() error {
 	// Crea client
 	client, err := mongo.Connect(ctx, opts)
 	if err != nil {
-		return fmt.Errorf("errore connessione MongoDB: %v", err)
+		return nil, fmt.Errorf("errore connessione MongoDB: %v", err)
 	}
 
 	// Verifica connessione
@@ -96,30 +141,35 @@ func Connect() error {
 	defer cancel2()
 
 	if err := client.Ping(ctx2, nil); err != nil {
-		return fmt.Errorf("errore ping MongoDB: %v", err)
+		client.Disconnect(ctx)
+		return nil, fmt.Errorf("errore ping MongoDB: %v", err)
 	}
 
-	// Salva istanza
-	ctx3, cancel3 := context.WithTimeout(context.Background(), 30*time.Second)
+	return client, nil
+}
 
-	dbName := os.Getenv("MONGODB_DB_NAME")
-	if dbName == "" {
-		dbName = "qr-menu"
+// ConnectURI si collega a un MongoDB senza certificato X.509 (es. un mongod locale o quello
+// dei test, vedi db/dbtest), imposta l'istanza globale sul database dbName e ne crea gli indici
+func ConnectURI(ctx context.Context, uri, dbName string) error {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerSelectionTimeout(5*time.Second))
+	if err != nil {
+		return fmt.Errorf("errore connessione MongoDB: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(ctx)
+		return fmt.Errorf("errore ping MongoDB: %v", err)
 	}
 
+	instanceCtx, cancel := context.WithCancel(context.Background())
 	MongoInstance = &MongoClient{
 		client: client,
 		DB:     client.Database(dbName),
-		ctx:    ctx3,
-		cancel: cancel3,
+		ctx:    instanceCtx,
+		cancel: cancel,
 	}
-
-	// Crea indici
 	if err := MongoInstance.createIndexes(); err != nil {
-		log.Printf("Avviso: errore nella creazione degli indici: %v", err)
+		return err
 	}
-
-	log.Println("✓ Connesso a MongoDB Atlas")
 	return nil
 }
 
@@ -145,10 +195,14 @@ func (m *MongoClient) GetDB() *mongo.Database {
 
 // ==================== RESTAURANTS ====================
 
-// CreateRestaurant salva un ristorante
+// CreateRestaurant salva un ristorante.
+// Restituisce ErrDuplicateRestaurantUsername se lo username pubblico è già in uso
 func (m *MongoClient) CreateRestaurant(ctx context.Context, restaurant *models.Restaurant) error {
 	coll := m.DB.Collection("restaurants")
 	_, err := coll.InsertOne(ctx, restaurant)
+	if mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "idx_restaurant_username_ci") {
+		return ErrDuplicateRestaurantUsername
+	}
 	if err != nil {
 		return fmt.Errorf("errore insert restaurant: %v", err)
 	}
@@ -211,6 +265,209 @@ func (m *MongoClient) UpdateRestaurant(ctx context.Context, restaurant *models.R
 	return nil
 }
 
+// GetRestaurantByPreviousUsername recupera il ristorante che in passato usava lo username indicato
+func (m *MongoClient) GetRestaurantByPreviousUsername(ctx context.Context, username string) (*models.Restaurant, error) {
+	coll := m.DB.Collection("restaurants")
+	var restaurant models.Restaurant
+	err := coll.FindOne(ctx, bson.M{"previous_usernames": username}).Decode(&restaurant)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find restaurant by previous username: %v", err)
+	}
+	return &restaurant, nil
+}
+
+// ChangeRestaurantUsername cambia lo username pubblico di un ristorante conservando
+// quello vecchio tra i PreviousUsernames per i redirect.
+// Restituisce ErrDuplicateRestaurantUsername se il nuovo username è già in uso
+func (m *MongoClient) ChangeRestaurantUsername(ctx context.Context, restaurant *models.Restaurant, newUsername string) error {
+	coll := m.DB.Collection("restaurants")
+
+	update := bson.M{"$set": bson.M{"username": newUsername}}
+	if restaurant.Username != "" {
+		update["$addToSet"] = bson.M{"previous_usernames": restaurant.Username}
+	}
+
+	_, err := coll.UpdateOne(ctx, bson.M{"_id": restaurant.ID}, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateRestaurantUsername
+	}
+	if err != nil {
+		return fmt.Errorf("errore update restaurant username: %v", err)
+	}
+
+	// Se il nuovo username era uno di quelli vecchi non serve più il redirect
+	if _, err := coll.UpdateOne(ctx, bson.M{"_id": restaurant.ID}, bson.M{"$pull": bson.M{"previous_usernames": newUsername}}); err != nil {
+		return fmt.Errorf("errore update restaurant previous usernames: %v", err)
+	}
+
+	if restaurant.Username != "" && restaurant.Username != newUsername {
+		restaurant.PreviousUsernames = append(restaurant.PreviousUsernames, restaurant.Username)
+	}
+	restaurant.Username = newUsername
+	return nil
+}
+
+// GetRestaurantByVanitySlug recupera il ristorante con l'indirizzo breve indicato
+func (m *MongoClient) GetRestaurantByVanitySlug(ctx context.Context, slug string) (*models.Restaurant, error) {
+	coll := m.DB.Collection("restaurants")
+	var restaurant models.Restaurant
+	err := coll.FindOne(ctx, bson.M{"vanity_slug": slug}).Decode(&restaurant)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find restaurant by vanity slug: %v", err)
+	}
+	return &restaurant, nil
+}
+
+// GetRestaurantByCustomDomain recupera il ristorante che ha verificato il dominio indicato
+func (m *MongoClient) GetRestaurantByCustomDomain(ctx context.Context, domain string) (*models.Restaurant, error) {
+	coll := m.DB.Collection("restaurants")
+	var restaurant models.Restaurant
+	err := coll.FindOne(ctx, bson.M{"custom_domain": domain, "domain_verified": true}).Decode(&restaurant)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find restaurant by custom domain: %v", err)
+	}
+	return &restaurant, nil
+}
+
+// SetRestaurantVanitySlug imposta l'indirizzo breve del ristorante (vuoto per rimuoverlo).
+// Restituisce ErrDuplicateVanitySlug se è già in uso
+func (m *MongoClient) SetRestaurantVanitySlug(ctx context.Context, restaurant *models.Restaurant, slug string) error {
+	update := bson.M{"$set": bson.M{"vanity_slug": slug}}
+	if slug == "" {
+		update = bson.M{"$unset": bson.M{"vanity_slug": ""}}
+	}
+
+	_, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurant.ID}, update)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateVanitySlug
+	}
+	if err != nil {
+		return fmt.Errorf("errore update restaurant vanity slug: %v", err)
+	}
+	restaurant.VanitySlug = slug
+	return nil
+}
+
+// SetRestaurantPrivacyFirstAnalytics attiva o disattiva le analytics privacy-first del ristorante
+func (m *MongoClient) SetRestaurantPrivacyFirstAnalytics(ctx context.Context, restaurant *models.Restaurant, enabled bool) error {
+	_, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurant.ID},
+		bson.M{"$set": bson.M{"privacy_first_analytics": enabled}})
+	if err != nil {
+		return fmt.Errorf("errore update restaurant privacy analytics: %v", err)
+	}
+	restaurant.PrivacyFirstAnalytics = enabled
+	return nil
+}
+
+// SetRestaurantNutritionDisplay imposta quali informazioni nutrizionali il ristorante pubblica
+func (m *MongoClient) SetRestaurantNutritionDisplay(ctx context.Context, restaurant *models.Restaurant, display models.NutritionDisplay) error {
+	_, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurant.ID},
+		bson.M{"$set": bson.M{"nutrition_display": display}})
+	if err != nil {
+		return fmt.Errorf("errore update restaurant nutrition display: %v", err)
+	}
+	restaurant.NutritionDisplay = display
+	return nil
+}
+
+// SetRestaurantShowRatings mostra o nasconde le valutazioni dei clienti nel menu pubblico
+func (m *MongoClient) SetRestaurantShowRatings(ctx context.Context, restaurant *models.Restaurant, enabled bool) error {
+	_, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurant.ID},
+		bson.M{"$set": bson.M{"show_ratings": enabled}})
+	if err != nil {
+		return fmt.Errorf("errore update restaurant show ratings: %v", err)
+	}
+	restaurant.ShowRatings = enabled
+	return nil
+}
+
+// SetRestaurantCustomDomain associa un dominio al ristorante, da verificare con token
+// (dominio vuoto per rimuoverlo). Il dominio torna sempre non verificato
+func (m *MongoClient) SetRestaurantCustomDomain(ctx context.Context, restaurant *models.Restaurant, domain, token string) error {
+	update := bson.M{"$set": bson.M{"custom_domain": domain, "domain_token": token, "domain_verified": false}}
+	if domain == "" {
+		update = bson.M{
+			"$set":   bson.M{"domain_verified": false},
+			"$unset": bson.M{"custom_domain": "", "domain_token": ""},
+		}
+	}
+
+	if _, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurant.ID}, update); err != nil {
+		return fmt.Errorf("errore update restaurant custom domain: %v", err)
+	}
+	restaurant.CustomDomain = domain
+	restaurant.DomainToken = token
+	restaurant.DomainVerified = false
+	return nil
+}
+
+// MarkCustomDomainVerified segna come verificato il dominio del ristorante.
+// Restituisce ErrDuplicateCustomDomain se un altro ristorante l'ha già verificato
+func (m *MongoClient) MarkCustomDomainVerified(ctx context.Context, restaurant *models.Restaurant) error {
+	_, err := m.DB.Collection("restaurants").UpdateOne(ctx,
+		bson.M{"_id": restaurant.ID, "custom_domain": restaurant.CustomDomain},
+		bson.M{"$set": bson.M{"domain_verified": true}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateCustomDomain
+	}
+	if err != nil {
+		return fmt.Errorf("errore update restaurant domain verification: %v", err)
+	}
+	restaurant.DomainVerified = true
+	return nil
+}
+
+// SetRestaurantActiveMenus imposta i menu attivi del ristorante nell'ordine di visualizzazione
+// e allinea il flag is_active dei suoi menu. Con menuIDs vuoto nessun menu resta attivo
+func (m *MongoClient) SetRestaurantActiveMenus(ctx context.Context, restaurant *models.Restaurant, menuIDs []string) error {
+	if menuIDs == nil {
+		menuIDs = []string{} // $nin richiede un array, non null
+	}
+	primary := ""
+	if len(menuIDs) > 0 {
+		primary = menuIDs[0]
+	}
+
+	// $set esplicito: con omitempty UpdateRestaurant non azzererebbe i campi svuotati
+	_, err := m.DB.Collection("restaurants").UpdateOne(ctx,
+		bson.M{"_id": restaurant.ID},
+		bson.M{"$set": bson.M{"active_menu_id": primary, "active_menu_ids": menuIDs}},
+	)
+	if err != nil {
+		return fmt.Errorf("errore update restaurant active menus: %v", err)
+	}
+
+	menus := m.DB.Collection("menus")
+	if _, err := menus.UpdateMany(ctx,
+		bson.M{"restaurant_id": restaurant.ID, "id": bson.M{"$nin": menuIDs}},
+		bson.M{"$set": bson.M{"is_active": false}},
+	); err != nil {
+		return fmt.Errorf("errore update menu is_active: %v", err)
+	}
+	if len(menuIDs) > 0 {
+		if _, err := menus.UpdateMany(ctx,
+			bson.M{"restaurant_id": restaurant.ID, "id": bson.M{"$in": menuIDs}},
+			bson.M{"$set": bson.M{"is_active": true}},
+		); err != nil {
+			return fmt.Errorf("errore update menu is_active: %v", err)
+		}
+	}
+
+	restaurant.ActiveMenuID = primary
+	restaurant.ActiveMenuIDs = menuIDs
+	return nil
+}
+
 // GetAllRestaurants recupera tutti i ristoranti
 func (m *MongoClient) GetAllRestaurants(ctx context.Context) ([]*models.Restaurant, error) {
 	coll := m.DB.Collection("restaurants")
@@ -228,10 +485,94 @@ func (m *MongoClient) GetAllRestaurants(ctx context.Context) ([]*models.Restaura
 }
 // ==================== USERS ====================
 
-// CreateUser salva un nuovo utente
+var (
+	// ErrDuplicateUsername indica che lo username è già usato da un altro utente
+	ErrDuplicateUsername = errors.New("username già esistente")
+	// ErrDuplicateEmail indica che l'email è già registrata
+	ErrDuplicateEmail = errors.New("email già registrata")
+	// ErrDuplicateRestaurantUsername indica che lo username pubblico del ristorante è già in uso
+	ErrDuplicateRestaurantUsername = errors.New("username ristorante già in uso")
+	// ErrIdentityInUse indica che l'account OAuth è già collegato a un altro utente
+	ErrIdentityInUse = errors.New("account esterno già collegato a un altro utente")
+	// ErrDuplicateVanitySlug indica che l'indirizzo breve è già usato da un altro ristorante
+	ErrDuplicateVanitySlug = errors.New("indirizzo breve già in uso")
+	// ErrDuplicateCustomDomain indica che il dominio è già verificato da un altro ristorante
+	ErrDuplicateCustomDomain = errors.New("dominio già in uso")
+	// ErrDuplicateCouponCode indica che il codice è già usato da un altro coupon
+	ErrDuplicateCouponCode = errors.New("codice coupon già in uso")
+	// ErrDuplicateLoyaltyCode indica che il codice della visita o il numero della tessera
+	// fedeltà è già in uso nel ristorante: va generato un altro codice
+	ErrDuplicateLoyaltyCode = errors.New("codice fedeltà già in uso")
+	// ErrDuplicateVoucherCode indica che il codice del buono regalo è già in uso nel
+	// ristorante: va generato un altro codice
+	ErrDuplicateVoucherCode = errors.New("codice del buono già in uso")
+	// ErrDuplicateNFCTagCode indica che il codice del tag NFC è già in uso: va generato un
+	// altro codice
+	ErrDuplicateNFCTagCode = errors.New("codice del tag NFC già in uso")
+	// ErrDuplicateShortLinkCode indica che il codice del link breve è già in uso: va generato
+	// un altro codice
+	ErrDuplicateShortLinkCode = errors.New("codice del link breve già in uso")
+)
+
+// NormalizeCredential normalizza username ed email per i confronti di unicità
+func NormalizeCredential(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// CheckUserCredentials verifica che username ed email siano liberi (case-insensitive).
+// Il controllo serve a mostrare errori chiari nel form: la garanzia contro le
+// registrazioni concorrenti è data dagli indici unici usati da CreateUser.
+// Se entrambi sono occupati l'errore contiene sia ErrDuplicateUsername che ErrDuplicateEmail
+func (m *MongoClient) CheckUserCredentials(ctx context.Context, username, email string) error {
+	coll := m.DB.Collection("users")
+	normUsername := NormalizeCredential(username)
+	normEmail := NormalizeCredential(email)
+
+	cursor, err := coll.Find(ctx, bson.M{"$or": []bson.M{
+		{"username_normalized": normUsername},
+		{"email_normalized": normEmail},
+	}})
+	if err != nil {
+		return fmt.Errorf("errore controllo credenziali: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return fmt.Errorf("errore decode users: %v", err)
+	}
+
+	var usernameTaken, emailTaken bool
+	for _, user := range users {
+		usernameTaken = usernameTaken || user.UsernameNormalized == normUsername
+		emailTaken = emailTaken || user.EmailNormalized == normEmail
+	}
+
+	switch {
+	case usernameTaken && emailTaken:
+		return errors.Join(ErrDuplicateUsername, ErrDuplicateEmail)
+	case usernameTaken:
+		return ErrDuplicateUsername
+	case emailTaken:
+		return ErrDuplicateEmail
+	}
+	return nil
+}
+
+// CreateUser salva un nuovo utente.
+// Restituisce ErrDuplicateUsername o ErrDuplicateEmail se le credenziali sono già in uso
 func (m *MongoClient) CreateUser(ctx context.Context, user *models.User) error {
 	coll := m.DB.Collection("users")
+	user.UsernameNormalized = NormalizeCredential(user.Username)
+	user.EmailNormalized = NormalizeCredential(user.Email)
+
 	_, err := coll.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		if strings.Contains(err.Error(), "email") {
+			return ErrDuplicateEmail
+		}
+		return ErrDuplicateUsername
+	}
 	if err != nil {
 		return fmt.Errorf("errore insert user: %v", err)
 	}
@@ -256,7 +597,7 @@ func (m *MongoClient) GetUserByID(ctx context.Context, id string) (*models.User,
 func (m *MongoClient) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	coll := m.DB.Collection("users")
 	var user models.User
-	err := coll.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	err := coll.FindOne(ctx, bson.M{"username_normalized": NormalizeCredential(username)}).Decode(&user)
 	if err == mongo.ErrNoDocuments {
 		return nil, nil
 	}
@@ -270,7 +611,7 @@ func (m *MongoClient) GetUserByUsername(ctx context.Context, username string) (*
 func (m *MongoClient) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	coll := m.DB.Collection("users")
 	var user models.User
-	err := coll.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := coll.FindOne(ctx, bson.M{"email_normalized": NormalizeCredential(email)}).Decode(&user)
 	if err == mongo.ErrNoDocuments {
 		return nil, nil
 	}
@@ -296,190 +637,3735 @@ func (m *MongoClient) GetRestaurantsByOwnerID(ctx context.Context, ownerID strin
 	return restaurants, nil
 }
 
-// UpdateUserLastLogin aggiorna il timestamp di ultimo login
-func (m *MongoClient) UpdateUserLastLogin(ctx context.Context, userID string) error {
+// UpdateUserUsername cambia lo username di login di un utente.
+// Restituisce ErrDuplicateUsername se è già in uso
+func (m *MongoClient) UpdateUserUsername(ctx context.Context, userID, username string) error {
 	coll := m.DB.Collection("users")
-	_, err := coll.UpdateOne(
-		ctx,
+	_, err := coll.UpdateOne(ctx,
 		bson.M{"_id": userID},
-		bson.M{"$set": bson.M{"last_login": time.Now()}},
+		bson.M{"$set": bson.M{"username": username, "username_normalized": NormalizeCredential(username)}},
 	)
-	return err
-}
-// ==================== MENUS ====================
-
-// CreateMenu salva un menu
-func (m *MongoClient) CreateMenu(ctx context.Context, menu *models.Menu) error {
-	coll := m.DB.Collection("menus")
-	_, err := coll.InsertOne(ctx, menu)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateUsername
+	}
 	if err != nil {
-		return fmt.Errorf("errore insert menu: %v", err)
+		return fmt.Errorf("errore update username: %v", err)
 	}
 	return nil
 }
 
-// GetMenuByID recupera un menu per ID
-func (m *MongoClient) GetMenuByID(ctx context.Context, id string) (*models.Menu, error) {
-	coll := m.DB.Collection("menus")
-	var menu models.Menu
-	err := coll.FindOne(ctx, bson.M{"id": id}).Decode(&menu)
-	if err == mongo.ErrNoDocuments {
-		return nil, nil
+// UpdateUserEmail cambia l'email di login di un utente. L'email cambia solo dal link di
+// verifica inviato al nuovo indirizzo, quindi viene segnata come verificata.
+// Restituisce ErrDuplicateEmail se è già registrata
+func (m *MongoClient) UpdateUserEmail(ctx context.Context, userID, email string) error {
+	coll := m.DB.Collection("users")
+	_, err := coll.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"email": NormalizeCredential(email), "email_normalized": NormalizeCredential(email), "email_verified_at": time.Now()}},
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateEmail
 	}
 	if err != nil {
-		return nil, fmt.Errorf("errore find menu: %v", err)
+		return fmt.Errorf("errore update email: %v", err)
 	}
-	return &menu, nil
+	return nil
 }
 
-// GetMenusByRestaurantID recupera tutti i menu di un ristorante
-func (m *MongoClient) GetMenusByRestaurantID(ctx context.Context, restaurantID string) ([]*models.Menu, error) {
-	coll := m.DB.Collection("menus")
-	
-	// DEBUG: Log per capire cosa sta cercando
-	log.Printf("🔍 GetMenusByRestaurantID - Cercando menu per restaurant_id: %s", restaurantID)
-	
-	cursor, err := coll.Find(ctx, bson.M{"restaurant_id": restaurantID})
-	if err != nil {
-		log.Printf("❌ Errore Find: %v", err)
-		return nil, fmt.Errorf("errore find menus: %v", err)
+// SetUserEmailVerified segna come verificata l'email dell'utente, solo se è ancora quella
+// a cui è stato inviato il link
+func (m *MongoClient) SetUserEmailVerified(ctx context.Context, userID, email string, at time.Time) error {
+	coll := m.DB.Collection("users")
+	if _, err := coll.UpdateOne(ctx,
+		bson.M{"_id": userID, "email_normalized": NormalizeCredential(email)},
+		bson.M{"$set": bson.M{"email_verified_at": at}},
+	); err != nil {
+		return fmt.Errorf("errore verifica email: %v", err)
 	}
-	defer cursor.Close(ctx)
+	return nil
+}
 
-	var menus []*models.Menu
-	if err = cursor.All(ctx, &menus); err != nil {
-		log.Printf("❌ Errore Decode: %v", err)
-		return nil, fmt.Errorf("errore decode menus: %v", err)
+// UpdateUserLocale imposta la lingua di email e notifiche di un utente
+func (m *MongoClient) UpdateUserLocale(ctx context.Context, userID, locale string) error {
+	coll := m.DB.Collection("users")
+	_, err := coll.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"locale": locale}},
+	)
+	if err != nil {
+		return fmt.Errorf("errore update locale: %v", err)
 	}
-	
-	log.Printf("✅ Trovati %d menu per restaurant_id: %s", len(menus), restaurantID)
-	return menus, nil
+	return nil
 }
 
-// UpdateMenu aggiorna un menu
-func (m *MongoClient) UpdateMenu(ctx context.Context, menu *models.Menu) error {
-	coll := m.DB.Collection("menus")
-	result := coll.FindOneAndUpdate(ctx,
-		bson.M{"id": menu.ID},
-		bson.M{"$set": menu},
-		options.FindOneAndUpdate().SetReturnDocument(options.After),
+// UpdateUserNotificationPreferences salva canali e frequenza delle notifiche di un utente
+func (m *MongoClient) UpdateUserNotificationPreferences(ctx context.Context, userID string, prefs models.NotificationPreferences) error {
+	_, err := m.DB.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"notifications": prefs}},
 	)
-	if result.Err() != nil && result.Err() != mongo.ErrNoDocuments {
-		return fmt.Errorf("errore update menu: %v", result.Err())
+	if err != nil {
+		return fmt.Errorf("errore update notification preferences: %v", err)
 	}
 	return nil
 }
 
-// DeleteMenu elimina un menu
-func (m *MongoClient) DeleteMenu(ctx context.Context, id string) error {
-	coll := m.DB.Collection("menus")
-	result, err := coll.DeleteOne(ctx, bson.M{"id": id})
-	if err != nil {
-		return fmt.Errorf("errore delete menu: %v", err)
+// UpdateUserPhone imposta il numero per le notifiche SMS di un utente; vuoto lo rimuove
+func (m *MongoClient) UpdateUserPhone(ctx context.Context, userID, phone string) error {
+	update := bson.M{"$set": bson.M{"phone": phone}}
+	if phone == "" {
+		update = bson.M{"$unset": bson.M{"phone": ""}}
 	}
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("menu non trovato")
+	if _, err := m.DB.Collection("users").UpdateOne(ctx, bson.M{"_id": userID}, update); err != nil {
+		return fmt.Errorf("errore update phone: %v", err)
 	}
 	return nil
 }
 
-// GetAllMenus recupera tutti i menu
-func (m *MongoClient) GetAllMenus(ctx context.Context) ([]*models.Menu, error) {
-	coll := m.DB.Collection("menus")
-	cursor, err := coll.Find(ctx, bson.M{})
+// UpdateUserPassword sostituisce l'hash della password di un utente
+func (m *MongoClient) UpdateUserPassword(ctx context.Context, userID, passwordHash string) error {
+	coll := m.DB.Collection("users")
+	_, err := coll.UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"password_hash": passwordHash}},
+	)
 	if err != nil {
-		return nil, fmt.Errorf("errore find all menus: %v", err)
-	}
-	defer cursor.Close(ctx)
-
-	var menus []*models.Menu
-	if err = cursor.All(ctx, &menus); err != nil {
-		return nil, fmt.Errorf("errore decode menus: %v", err)
+		return fmt.Errorf("errore update password: %v", err)
 	}
-	return menus, nil
+	return nil
 }
 
-// ==================== SESSIONS ====================
-
-// CreateSession salva una sessione
+// UpdateUserLastLogin aggiorna il timestamp di ultimo login
+func (m *MongoClient) UpdateUserLastLogin(ctx context.Context, userID string) error {
+	coll := m.DB.Collection("users")
+	_, err := coll.UpdateOne(
+		ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"last_login": time.Now()}},
+	)
+	return err
+}
+
+// GetUserByIdentity recupera l'utente a cui è collegato l'account del provider OAuth
+func (m *MongoClient) GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	var user models.User
+	err := m.DB.Collection("users").FindOne(ctx, bson.M{
+		"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}},
+	}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find user by identity: %v", err)
+	}
+	return &user, nil
+}
+
+// AddUserIdentity collega un account OAuth all'utente. Restituisce false se l'utente ha già
+// un account collegato per lo stesso provider
+func (m *MongoClient) AddUserIdentity(ctx context.Context, userID string, identity models.ExternalIdentity) (bool, error) {
+	result, err := m.DB.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": userID, "identities.provider": bson.M{"$ne": identity.Provider}},
+		bson.M{"$push": bson.M{"identities": identity}})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, ErrIdentityInUse
+	}
+	if err != nil {
+		return false, fmt.Errorf("errore update user identities: %v", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// RemoveUserIdentity scollega l'account del provider dall'utente
+func (m *MongoClient) RemoveUserIdentity(ctx context.Context, userID, provider string) (bool, error) {
+	result, err := m.DB.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$pull": bson.M{"identities": bson.M{"provider": provider}}})
+	if err != nil {
+		return false, fmt.Errorf("errore update user identities: %v", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+// ==================== EMAIL VERIFICATIONS ====================
+
+// CreateEmailVerification salva una richiesta di cambio email, sostituendo quelle precedenti dello stesso utente
+func (m *MongoClient) CreateEmailVerification(ctx context.Context, verification *models.EmailVerification) error {
+	coll := m.DB.Collection("email_verifications")
+	if _, err := coll.DeleteMany(ctx, bson.M{"user_id": verification.UserID}); err != nil {
+		return fmt.Errorf("errore delete email verifications: %v", err)
+	}
+	if _, err := coll.InsertOne(ctx, verification); err != nil {
+		return fmt.Errorf("errore insert email verification: %v", err)
+	}
+	return nil
+}
+
+// ConsumeEmailVerification recupera ed elimina una richiesta di cambio email (uso singolo)
+func (m *MongoClient) ConsumeEmailVerification(ctx context.Context, id string) (*models.EmailVerification, error) {
+	coll := m.DB.Collection("email_verifications")
+	var verification models.EmailVerification
+	err := coll.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&verification)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find email verification: %v", err)
+	}
+	return &verification, nil
+}
+
+// ==================== PASSWORD RESETS ====================
+
+// CreatePasswordReset salva una richiesta di reset password, sostituendo quelle precedenti dello stesso utente
+func (m *MongoClient) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	coll := m.DB.Collection("password_resets")
+	if _, err := coll.DeleteMany(ctx, bson.M{"user_id": reset.UserID}); err != nil {
+		return fmt.Errorf("errore delete password resets: %v", err)
+	}
+	if _, err := coll.InsertOne(ctx, reset); err != nil {
+		return fmt.Errorf("errore insert password reset: %v", err)
+	}
+	return nil
+}
+
+// ConsumePasswordReset recupera ed elimina una richiesta di reset password (uso singolo)
+func (m *MongoClient) ConsumePasswordReset(ctx context.Context, id string) (*models.PasswordReset, error) {
+	coll := m.DB.Collection("password_resets")
+	var reset models.PasswordReset
+	err := coll.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&reset)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find password reset: %v", err)
+	}
+	return &reset, nil
+}
+
+// ==================== STAFF ====================
+
+// SaveRestaurantMember aggiunge un utente allo staff del ristorante o ne aggiorna il ruolo
+func (m *MongoClient) SaveRestaurantMember(ctx context.Context, member *models.RestaurantMember) error {
+	_, err := m.DB.Collection("restaurant_members").ReplaceOne(ctx,
+		bson.M{"_id": member.ID}, member, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("errore upsert restaurant member: %v", err)
+	}
+	return nil
+}
+
+// GetRestaurantMember recupera il ruolo di un utente nello staff del ristorante
+func (m *MongoClient) GetRestaurantMember(ctx context.Context, restaurantID, userID string) (*models.RestaurantMember, error) {
+	var member models.RestaurantMember
+	err := m.DB.Collection("restaurant_members").FindOne(ctx,
+		bson.M{"restaurant_id": restaurantID, "user_id": userID}).Decode(&member)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find restaurant member: %v", err)
+	}
+	return &member, nil
+}
+
+// GetRestaurantMembers recupera lo staff di un ristorante, dal membro più recente
+func (m *MongoClient) GetRestaurantMembers(ctx context.Context, restaurantID string) ([]*models.RestaurantMember, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := m.DB.Collection("restaurant_members").Find(ctx, bson.M{"restaurant_id": restaurantID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore find restaurant members: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var members []*models.RestaurantMember
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, fmt.Errorf("errore decode restaurant members: %v", err)
+	}
+	return members, nil
+}
+
+// GetRestaurantsByMemberID recupera i ristoranti attivi di cui l'utente fa parte dello staff
+func (m *MongoClient) GetRestaurantsByMemberID(ctx context.Context, userID string) ([]models.Restaurant, error) {
+	ids, err := m.DB.Collection("restaurant_members").Distinct(ctx, "restaurant_id", bson.M{"user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("errore find memberships: %v", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := m.DB.Collection("restaurants").Find(ctx, bson.M{"_id": bson.M{"$in": ids}, "is_active": true})
+	if err != nil {
+		return nil, fmt.Errorf("errore find restaurants by member: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var restaurants []models.Restaurant
+	if err := cursor.All(ctx, &restaurants); err != nil {
+		return nil, fmt.Errorf("errore decode restaurants: %v", err)
+	}
+	return restaurants, nil
+}
+
+// DeleteRestaurantMember rimuove l'utente dallo staff e chiude le sue sessioni sul ristorante.
+// Restituisce false se l'utente non faceva parte dello staff
+func (m *MongoClient) DeleteRestaurantMember(ctx context.Context, restaurantID, userID string) (bool, error) {
+	result, err := m.DB.Collection("restaurant_members").DeleteOne(ctx,
+		bson.M{"restaurant_id": restaurantID, "user_id": userID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete restaurant member: %v", err)
+	}
+	if _, err := m.DB.Collection("sessions").DeleteMany(ctx,
+		bson.M{"restaurant_id": restaurantID, "user_id": userID}); err != nil {
+		return false, fmt.Errorf("errore delete member sessions: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// CreateStaffInvitation salva un invito, sostituendo quello ancora pendente per la stessa email
+func (m *MongoClient) CreateStaffInvitation(ctx context.Context, invitation *models.StaffInvitation) error {
+	coll := m.DB.Collection("staff_invitations")
+	if _, err := coll.DeleteMany(ctx, bson.M{"restaurant_id": invitation.RestaurantID, "email": invitation.Email}); err != nil {
+		return fmt.Errorf("errore delete staff invitations: %v", err)
+	}
+	if _, err := coll.InsertOne(ctx, invitation); err != nil {
+		return fmt.Errorf("errore insert staff invitation: %v", err)
+	}
+	return nil
+}
+
+// GetStaffInvitation recupera un invito per hash del token
+func (m *MongoClient) GetStaffInvitation(ctx context.Context, id string) (*models.StaffInvitation, error) {
+	var invitation models.StaffInvitation
+	err := m.DB.Collection("staff_invitations").FindOne(ctx, bson.M{"_id": id}).Decode(&invitation)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find staff invitation: %v", err)
+	}
+	return &invitation, nil
+}
+
+// GetStaffInvitationsByRestaurant recupera gli inviti pendenti di un ristorante
+func (m *MongoClient) GetStaffInvitationsByRestaurant(ctx context.Context, restaurantID string) ([]*models.StaffInvitation, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := m.DB.Collection("staff_invitations").Find(ctx, bson.M{
+		"restaurant_id": restaurantID,
+		"expires_at":    bson.M{"$gt": time.Now()},
+	}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore find staff invitations: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var invitations []*models.StaffInvitation
+	if err := cursor.All(ctx, &invitations); err != nil {
+		return nil, fmt.Errorf("errore decode staff invitations: %v", err)
+	}
+	return invitations, nil
+}
+
+// DeleteStaffInvitation elimina un invito del ristorante (revoca o accettazione)
+func (m *MongoClient) DeleteStaffInvitation(ctx context.Context, id, restaurantID string) (bool, error) {
+	result, err := m.DB.Collection("staff_invitations").DeleteOne(ctx, bson.M{"_id": id, "restaurant_id": restaurantID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete staff invitation: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// ==================== API KEYS ====================
+
+// CreateAPIKey salva una nuova API key
+func (m *MongoClient) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	if _, err := m.DB.Collection("api_keys").InsertOne(ctx, key); err != nil {
+		return fmt.Errorf("errore insert api key: %v", err)
+	}
+	return nil
+}
+
+// GetAPIKeyByHash recupera una API key per hash del segreto
+func (m *MongoClient) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := m.DB.Collection("api_keys").FindOne(ctx, bson.M{"hash": hash}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find api key: %v", err)
+	}
+	return &key, nil
+}
+
+// GetAPIKeysByRestaurant recupera le API key di un ristorante, dalla più recente
+func (m *MongoClient) GetAPIKeysByRestaurant(ctx context.Context, restaurantID string) ([]*models.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := m.DB.Collection("api_keys").Find(ctx, bson.M{"restaurant_id": restaurantID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore find api keys: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var keys []*models.APIKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("errore decode api keys: %v", err)
+	}
+	return keys, nil
+}
+
+// TouchAPIKey aggiorna l'ultimo utilizzo della chiave
+func (m *MongoClient) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	if _, err := m.DB.Collection("api_keys").UpdateOne(ctx,
+		bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": usedAt}}); err != nil {
+		return fmt.Errorf("errore update api key: %v", err)
+	}
+	return nil
+}
+
+// DeleteAPIKey revoca una API key del ristorante. Restituisce false se non esiste
+func (m *MongoClient) DeleteAPIKey(ctx context.Context, id, restaurantID string) (bool, error) {
+	result, err := m.DB.Collection("api_keys").DeleteOne(ctx, bson.M{"_id": id, "restaurant_id": restaurantID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete api key: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// ==================== PIATTI DEL GIORNO ====================
+
+// SaveDailySpecial crea o sostituisce un piatto del giorno
+func (m *MongoClient) SaveDailySpecial(ctx context.Context, special *models.DailySpecial) error {
+	if _, err := m.DB.Collection("daily_specials").ReplaceOne(ctx,
+		bson.M{"_id": special.ID}, special, options.Replace().SetUpsert(true)); err != nil {
+		return fmt.Errorf("errore save daily special: %v", err)
+	}
+	return nil
+}
+
+// GetDailySpecial recupera un piatto del giorno del ristorante. Restituisce nil se non esiste
+func (m *MongoClient) GetDailySpecial(ctx context.Context, id, restaurantID string) (*models.DailySpecial, error) {
+	var special models.DailySpecial
+	err := m.DB.Collection("daily_specials").FindOne(ctx, bson.M{"_id": id, "restaurant_id": restaurantID}).Decode(&special)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find daily special: %v", err)
+	}
+	return &special, nil
+}
+
+// GetDailySpecials recupera i piatti del giorno del ristorante con data tra from e to
+// (YYYY-MM-DD, inclusi), in ordine di data
+func (m *MongoClient) GetDailySpecials(ctx context.Context, restaurantID, from, to string) ([]*models.DailySpecial, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "created_at", Value: 1}})
+	cursor, err := m.DB.Collection("daily_specials").Find(ctx, bson.M{
+		"restaurant_id": restaurantID,
+		"date":          bson.M{"$gte": from, "$lte": to},
+	}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore find daily specials: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var specials []*models.DailySpecial
+	if err := cursor.All(ctx, &specials); err != nil {
+		return nil, fmt.Errorf("errore decode daily specials: %v", err)
+	}
+	return specials, nil
+}
+
+// DeleteDailySpecial elimina un piatto del giorno del ristorante. Restituisce false se non esiste
+func (m *MongoClient) DeleteDailySpecial(ctx context.Context, id, restaurantID string) (bool, error) {
+	result, err := m.DB.Collection("daily_specials").DeleteOne(ctx, bson.M{"_id": id, "restaurant_id": restaurantID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete daily special: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// ==================== PROMOZIONI ====================
+
+// SavePromotion crea o sostituisce una promozione
+func (m *MongoClient) SavePromotion(ctx context.Context, promotion *models.Promotion) error {
+	if _, err := m.DB.Collection("promotions").ReplaceOne(ctx,
+		bson.M{"_id": promotion.ID}, promotion, options.Replace().SetUpsert(true)); err != nil {
+		return fmt.Errorf("errore save promotion: %v", err)
+	}
+	return nil
+}
+
+// GetPromotion recupera una promozione del ristorante. Restituisce nil se non esiste
+func (m *MongoClient) GetPromotion(ctx context.Context, id, restaurantID string) (*models.Promotion, error) {
+	var promotion models.Promotion
+	err := m.DB.Collection("promotions").FindOne(ctx, bson.M{"_id": id, "restaurant_id": restaurantID}).Decode(&promotion)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find promotion: %v", err)
+	}
+	return &promotion, nil
+}
+
+// PromotionFilter seleziona le promozioni di un ristorante. I campi vuoti non filtrano
+type PromotionFilter struct {
+	RestaurantID string
+	ActiveAt     time.Time // Promozioni attive e nel periodo di validità a quell'istante
+}
+
+func (f PromotionFilter) query() bson.M {
+	query := bson.M{"restaurant_id": f.RestaurantID}
+	if !f.ActiveAt.IsZero() {
+		query["enabled"] = true
+		query["starts_at"] = bson.M{"$lte": f.ActiveAt}
+		query["ends_at"] = bson.M{"$gt": f.ActiveAt}
+	}
+	return query
+}
+
+// FindPromotions recupera una pagina delle promozioni, dalla più recente a iniziare salvo
+// diverso ordinamento, e il numero totale di promozioni
+func (m *MongoClient) FindPromotions(ctx context.Context, filter PromotionFilter, opts ListOptions) ([]*models.Promotion, int64, error) {
+	promotions, total, err := findPage[models.Promotion](ctx, m.DB.Collection("promotions"), filter.query(), opts, "-starts_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore find promotions: %v", err)
+	}
+	return promotions, total, nil
+}
+
+// DeletePromotion elimina una promozione del ristorante. Restituisce false se non esiste
+func (m *MongoClient) DeletePromotion(ctx context.Context, id, restaurantID string) (bool, error) {
+	result, err := m.DB.Collection("promotions").DeleteOne(ctx, bson.M{"_id": id, "restaurant_id": restaurantID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete promotion: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// GetPromotionsToNotify recupera, di tutti i ristoranti, le promozioni attive a now per cui
+// non è ancora stato inviato l'avviso di inizio
+func (m *MongoClient) GetPromotionsToNotify(ctx context.Context, now time.Time) ([]*models.Promotion, error) {
+	cursor, err := m.DB.Collection("promotions").Find(ctx, bson.M{
+		"enabled":     true,
+		"starts_at":   bson.M{"$lte": now},
+		"ends_at":     bson.M{"$gt": now},
+		"notified_at": nil,
+	}, options.Find().SetSort(bson.D{{Key: "starts_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("errore find promotions to notify: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var promotions []*models.Promotion
+	if err := cursor.All(ctx, &promotions); err != nil {
+		return nil, fmt.Errorf("errore decode promotions to notify: %v", err)
+	}
+	return promotions, nil
+}
+
+// MarkPromotionNotified registra l'invio dell'avviso di inizio. Restituisce false se un'altra
+// istanza l'ha già inviato, così ogni promozione è notificata una volta sola
+func (m *MongoClient) MarkPromotionNotified(ctx context.Context, id string, at time.Time) (bool, error) {
+	result, err := m.DB.Collection("promotions").UpdateOne(ctx,
+		bson.M{"_id": id, "notified_at": nil},
+		bson.M{"$set": bson.M{"notified_at": at}})
+	if err != nil {
+		return false, fmt.Errorf("errore update promotion notified: %v", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// GetPromotionRestaurantsChanged restituisce i ristoranti con promozioni iniziate o concluse
+// tra from (escluso) e to (incluso), di cui va ricalcolato l'elenco delle promozioni attive
+func (m *MongoClient) GetPromotionRestaurantsChanged(ctx context.Context, from, to time.Time) ([]string, error) {
+	window := bson.M{"$gt": from, "$lte": to}
+	values, err := m.DB.Collection("promotions").Distinct(ctx, "restaurant_id", bson.M{
+		"enabled": true,
+		"$or":     []bson.M{{"starts_at": window}, {"ends_at": window}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("errore distinct promotion restaurants: %v", err)
+	}
+	ids := make([]string, 0, len(values))
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// SetRestaurantPromotions salva sul ristorante le promozioni attive mostrate nel menu pubblico
+func (m *MongoClient) SetRestaurantPromotions(ctx context.Context, restaurantID string, promotions []models.Promotion) error {
+	update := bson.M{"$set": bson.M{"promotions": promotions}}
+	if len(promotions) == 0 {
+		update = bson.M{"$unset": bson.M{"promotions": ""}}
+	}
+	if _, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurantID}, update); err != nil {
+		return fmt.Errorf("errore update restaurant promotions: %v", err)
+	}
+	return nil
+}
+
+// ==================== ORGANIZZAZIONI ====================
+
+// CreateOrganization salva una nuova organizzazione
+func (m *MongoClient) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	if _, err := m.DB.Collection("organizations").InsertOne(ctx, org); err != nil {
+		return fmt.Errorf("errore insert organization: %v", err)
+	}
+	return nil
+}
+
+// GetOrganizationByID recupera un'organizzazione. Restituisce nil se non esiste
+func (m *MongoClient) GetOrganizationByID(ctx context.Context, id string) (*models.Organization, error) {
+	var org models.Organization
+	err := m.DB.Collection("organizations").FindOne(ctx, bson.M{"_id": id}).Decode(&org)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find organization: %v", err)
+	}
+	return &org, nil
+}
+
+// GetOrganizationsByOwnerID recupera le organizzazioni di un utente in ordine di nome
+func (m *MongoClient) GetOrganizationsByOwnerID(ctx context.Context, ownerID string) ([]*models.Organization, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := m.DB.Collection("organizations").Find(ctx, bson.M{"owner_id": ownerID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore find organizations: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var orgs []*models.Organization
+	if err := cursor.All(ctx, &orgs); err != nil {
+		return nil, fmt.Errorf("errore decode organizations: %v", err)
+	}
+	return orgs, nil
+}
+
+// UpdateOrganization aggiorna il nome di un'organizzazione
+func (m *MongoClient) UpdateOrganization(ctx context.Context, org *models.Organization) error {
+	if _, err := m.DB.Collection("organizations").UpdateOne(ctx,
+		bson.M{"_id": org.ID},
+		bson.M{"$set": bson.M{"name": org.Name, "updated_at": org.UpdatedAt}},
+	); err != nil {
+		return fmt.Errorf("errore update organization: %v", err)
+	}
+	return nil
+}
+
+// DeleteOrganization elimina un'organizzazione con i suoi modelli di menu e scollega le
+// sedi, che tornano ristoranti singoli. I menu già distribuiti restano alle sedi
+func (m *MongoClient) DeleteOrganization(ctx context.Context, id string) error {
+	if _, err := m.DB.Collection("restaurants").UpdateMany(ctx,
+		bson.M{"organization_id": id},
+		bson.M{"$unset": bson.M{"organization_id": ""}},
+	); err != nil {
+		return fmt.Errorf("errore update restaurants organization: %v", err)
+	}
+	if _, err := m.DB.Collection("menu_templates").DeleteMany(ctx, bson.M{"organization_id": id}); err != nil {
+		return fmt.Errorf("errore delete menu templates: %v", err)
+	}
+	if _, err := m.DB.Collection("organizations").DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return fmt.Errorf("errore delete organization: %v", err)
+	}
+	return nil
+}
+
+// SetRestaurantOrganization collega il ristorante all'organizzazione; con orgID vuoto lo
+// scollega. $set/$unset espliciti: con omitempty UpdateRestaurant non azzererebbe il campo
+func (m *MongoClient) SetRestaurantOrganization(ctx context.Context, restaurant *models.Restaurant, orgID string) error {
+	update := bson.M{"$set": bson.M{"organization_id": orgID}}
+	if orgID == "" {
+		update = bson.M{"$unset": bson.M{"organization_id": ""}}
+	}
+	if _, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurant.ID}, update); err != nil {
+		return fmt.Errorf("errore update restaurant organization: %v", err)
+	}
+	restaurant.OrganizationID = orgID
+	return nil
+}
+
+// GetRestaurantsByOrganizationID recupera le sedi attive di un'organizzazione in ordine di nome
+func (m *MongoClient) GetRestaurantsByOrganizationID(ctx context.Context, orgID string) ([]models.Restaurant, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := m.DB.Collection("restaurants").Find(ctx, bson.M{"organization_id": orgID, "is_active": true}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore find restaurants by organization: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var restaurants []models.Restaurant
+	if err := cursor.All(ctx, &restaurants); err != nil {
+		return nil, fmt.Errorf("errore decode restaurants: %v", err)
+	}
+	return restaurants, nil
+}
+
+// SaveMenuTemplate crea o sostituisce un modello di menu
+func (m *MongoClient) SaveMenuTemplate(ctx context.Context, template *models.MenuTemplate) error {
+	if _, err := m.DB.Collection("menu_templates").ReplaceOne(ctx,
+		bson.M{"_id": template.ID}, template, options.Replace().SetUpsert(true)); err != nil {
+		return fmt.Errorf("errore save menu template: %v", err)
+	}
+	return nil
+}
+
+// GetMenuTemplate recupera un modello di menu dell'organizzazione. Restituisce nil se non esiste
+func (m *MongoClient) GetMenuTemplate(ctx context.Context, id, orgID string) (*models.MenuTemplate, error) {
+	var template models.MenuTemplate
+	err := m.DB.Collection("menu_templates").FindOne(ctx, bson.M{"_id": id, "organization_id": orgID}).Decode(&template)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find menu template: %v", err)
+	}
+	return &template, nil
+}
+
+// GetMenuTemplates recupera i modelli di menu dell'organizzazione in ordine di nome
+func (m *MongoClient) GetMenuTemplates(ctx context.Context, orgID string) ([]*models.MenuTemplate, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := m.DB.Collection("menu_templates").Find(ctx, bson.M{"organization_id": orgID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore find menu templates: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var templates []*models.MenuTemplate
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, fmt.Errorf("errore decode menu templates: %v", err)
+	}
+	return templates, nil
+}
+
+// DeleteMenuTemplate elimina un modello di menu. Restituisce false se non esiste
+func (m *MongoClient) DeleteMenuTemplate(ctx context.Context, id, orgID string) (bool, error) {
+	result, err := m.DB.Collection("menu_templates").DeleteOne(ctx, bson.M{"_id": id, "organization_id": orgID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete menu template: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// GetRestaurantMenuTemplate recupera un modello di menu privato del ristorante.
+// Restituisce nil se non esiste
+func (m *MongoClient) GetRestaurantMenuTemplate(ctx context.Context, id, restaurantID string) (*models.MenuTemplate, error) {
+	var template models.MenuTemplate
+	err := m.DB.Collection("menu_templates").FindOne(ctx, bson.M{"_id": id, "restaurant_id": restaurantID}).Decode(&template)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find menu template: %v", err)
+	}
+	return &template, nil
+}
+
+// GetRestaurantMenuTemplates recupera i modelli di menu privati del ristorante in ordine di nome
+func (m *MongoClient) GetRestaurantMenuTemplates(ctx context.Context, restaurantID string) ([]*models.MenuTemplate, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := m.DB.Collection("menu_templates").Find(ctx, bson.M{"restaurant_id": restaurantID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore find menu templates: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var templates []*models.MenuTemplate
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, fmt.Errorf("errore decode menu templates: %v", err)
+	}
+	return templates, nil
+}
+
+// DeleteRestaurantMenuTemplate elimina un modello di menu privato del ristorante.
+// Restituisce false se non esiste
+func (m *MongoClient) DeleteRestaurantMenuTemplate(ctx context.Context, id, restaurantID string) (bool, error) {
+	result, err := m.DB.Collection("menu_templates").DeleteOne(ctx, bson.M{"_id": id, "restaurant_id": restaurantID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete menu template: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// GetMenuByTemplateID recupera il menu della sede distribuito dal modello, escluso quello
+// nel cestino. Restituisce nil se la sede non l'ha ancora ricevuto
+func (m *MongoClient) GetMenuByTemplateID(ctx context.Context, restaurantID, templateID string) (*models.Menu, error) {
+	var menu models.Menu
+	err := m.DB.Collection("menus").FindOne(ctx, bson.M{
+		"restaurant_id": restaurantID,
+		"template_id":   templateID,
+		"deleted_at":    bson.M{"$exists": false},
+	}).Decode(&menu)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find menu by template: %v", err)
+	}
+	return &menu, nil
+}
+
+// ==================== JWT ====================
+
+// GetJWTSigningKeys recupera le chiavi di firma dei token dell'API
+func (m *MongoClient) GetJWTSigningKeys(ctx context.Context) ([]*models.JWTSigningKey, error) {
+	cursor, err := m.DB.Collection("jwt_keys").Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("errore find jwt keys: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var keys []*models.JWTSigningKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("errore decode jwt keys: %v", err)
+	}
+	return keys, nil
+}
+
+// CreateJWTSigningKey salva una nuova chiave di firma
+func (m *MongoClient) CreateJWTSigningKey(ctx context.Context, key *models.JWTSigningKey) error {
+	if _, err := m.DB.Collection("jwt_keys").InsertOne(ctx, key); err != nil {
+		return fmt.Errorf("errore insert jwt key: %v", err)
+	}
+	return nil
+}
+
+// RetireJWTSigningKey segna una chiave come sostituita da una rotazione
+func (m *MongoClient) RetireJWTSigningKey(ctx context.Context, id string, retiredAt time.Time) error {
+	if _, err := m.DB.Collection("jwt_keys").UpdateOne(ctx,
+		bson.M{"_id": id, "retired_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"retired_at": retiredAt}}); err != nil {
+		return fmt.Errorf("errore update jwt key: %v", err)
+	}
+	return nil
+}
+
+// DeleteJWTSigningKeysRetiredBefore elimina le chiavi sostituite prima di before, i cui
+// token sono ormai tutti scaduti
+func (m *MongoClient) DeleteJWTSigningKeysRetiredBefore(ctx context.Context, before time.Time) error {
+	if _, err := m.DB.Collection("jwt_keys").DeleteMany(ctx,
+		bson.M{"retired_at": bson.M{"$lt": before}}); err != nil {
+		return fmt.Errorf("errore delete jwt keys: %v", err)
+	}
+	return nil
+}
+
+// RevokeToken aggiunge un token alla lista di revoca. Revocare due volte lo stesso token
+// non è un errore
+func (m *MongoClient) RevokeToken(ctx context.Context, token *models.RevokedToken) error {
+	_, err := m.DB.Collection("revoked_tokens").UpdateOne(ctx,
+		bson.M{"_id": token.ID},
+		bson.M{"$setOnInsert": bson.M{"revoked_at": token.RevokedAt, "expires_at": token.ExpiresAt}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("errore upsert revoked token: %v", err)
+	}
+	return nil
+}
+
+// IsTokenRevoked indica se il token con l'hash indicato è stato revocato
+func (m *MongoClient) IsTokenRevoked(ctx context.Context, hash string) (bool, error) {
+	count, err := m.DB.Collection("revoked_tokens").CountDocuments(ctx, bson.M{"_id": hash}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("errore count revoked tokens: %v", err)
+	}
+	return count > 0, nil
+}
+
+// CountRevokedTokens conta i token revocati non ancora scaduti
+func (m *MongoClient) CountRevokedTokens(ctx context.Context) (int64, error) {
+	count, err := m.DB.Collection("revoked_tokens").CountDocuments(ctx, bson.M{"expires_at": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return 0, fmt.Errorf("errore count revoked tokens: %v", err)
+	}
+	return count, nil
+}
+
+// CreateRefreshToken salva un nuovo refresh token
+func (m *MongoClient) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	if _, err := m.DB.Collection("refresh_tokens").InsertOne(ctx, token); err != nil {
+		return fmt.Errorf("errore insert refresh token: %v", err)
+	}
+	return nil
+}
+
+// UseRefreshToken segna come usato il refresh token con l'hash indicato, solo se non è già
+// stato usato, revocato o scaduto. Restituisce nil se il token non può essere usato
+func (m *MongoClient) UseRefreshToken(ctx context.Context, hash string, usedAt time.Time) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := m.DB.Collection("refresh_tokens").FindOneAndUpdate(ctx,
+		bson.M{
+			"hash":       hash,
+			"used_at":    bson.M{"$exists": false},
+			"revoked_at": bson.M{"$exists": false},
+			"expires_at": bson.M{"$gt": usedAt},
+		},
+		bson.M{"$set": bson.M{"used_at": usedAt}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore update refresh token: %v", err)
+	}
+	return &token, nil
+}
+
+// GetRefreshTokenByHash recupera un refresh token per hash, anche se già usato o revocato
+func (m *MongoClient) GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := m.DB.Collection("refresh_tokens").FindOne(ctx, bson.M{"hash": hash}).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find refresh token: %v", err)
+	}
+	return &token, nil
+}
+
+// RevokeRefreshTokenFamily revoca tutti i refresh token di una famiglia (logout o riuso)
+func (m *MongoClient) RevokeRefreshTokenFamily(ctx context.Context, familyID string, revokedAt time.Time) error {
+	if _, err := m.DB.Collection("refresh_tokens").UpdateMany(ctx,
+		bson.M{"family_id": familyID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": revokedAt}}); err != nil {
+		return fmt.Errorf("errore update refresh tokens: %v", err)
+	}
+	return nil
+}
+
+// RevokeRefreshTokensByRestaurant revoca tutti i refresh token di un ristorante (cambio password)
+func (m *MongoClient) RevokeRefreshTokensByRestaurant(ctx context.Context, restaurantID string, revokedAt time.Time) error {
+	if _, err := m.DB.Collection("refresh_tokens").UpdateMany(ctx,
+		bson.M{"restaurant_id": restaurantID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": revokedAt}}); err != nil {
+		return fmt.Errorf("errore update refresh tokens: %v", err)
+	}
+	return nil
+}
+
+// RevokeRefreshTokensByUser revoca tutti i refresh token di un utente (reset della password)
+func (m *MongoClient) RevokeRefreshTokensByUser(ctx context.Context, userID string, revokedAt time.Time) error {
+	if _, err := m.DB.Collection("refresh_tokens").UpdateMany(ctx,
+		bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": revokedAt}}); err != nil {
+		return fmt.Errorf("errore update refresh tokens: %v", err)
+	}
+	return nil
+}
+
+// ==================== PUSH NOTIFICATIONS ====================
+
+// SavePushToken registra il token di un dispositivo, riassegnandolo all'utente se era
+// già associato a un altro account
+func (m *MongoClient) SavePushToken(ctx context.Context, token *models.PushToken) error {
+	_, err := m.DB.Collection("push_tokens").UpdateOne(ctx,
+		bson.M{"_id": token.ID},
+		bson.M{
+			"$set":         bson.M{"user_id": token.UserID, "platform": token.Platform, "last_seen_at": token.LastSeenAt},
+			"$setOnInsert": bson.M{"created_at": token.CreatedAt},
+		},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("errore upsert push token: %v", err)
+	}
+	return nil
+}
+
+// GetPushTokensByUserID recupera i dispositivi registrati di un utente
+func (m *MongoClient) GetPushTokensByUserID(ctx context.Context, userID string) ([]*models.PushToken, error) {
+	cursor, err := m.DB.Collection("push_tokens").Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("errore find push tokens: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []*models.PushToken
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, fmt.Errorf("errore decode push tokens: %v", err)
+	}
+	return tokens, nil
+}
+
+// DeletePushToken elimina un token; con userID non vuoto solo se appartiene a quell'utente
+func (m *MongoClient) DeletePushToken(ctx context.Context, token, userID string) error {
+	filter := bson.M{"_id": token}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+	if _, err := m.DB.Collection("push_tokens").DeleteOne(ctx, filter); err != nil {
+		return fmt.Errorf("errore delete push token: %v", err)
+	}
+	return nil
+}
+
+// SaveWebPushSubscription registra la sottoscrizione di un browser, aggiornando chiavi,
+// utente e ristorante se l'endpoint era già registrato
+func (m *MongoClient) SaveWebPushSubscription(ctx context.Context, sub *models.WebPushSubscription) error {
+	_, err := m.DB.Collection("webpush_subscriptions").UpdateOne(ctx,
+		bson.M{"_id": sub.ID},
+		bson.M{
+			"$set": bson.M{
+				"user_id":       sub.UserID,
+				"restaurant_id": sub.RestaurantID,
+				"endpoint":      sub.Endpoint,
+				"p256dh":        sub.P256dh,
+				"auth":          sub.Auth,
+				"user_agent":    sub.UserAgent,
+			},
+			"$setOnInsert": bson.M{"created_at": sub.CreatedAt},
+		},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("errore upsert webpush subscription: %v", err)
+	}
+	return nil
+}
+
+// GetWebPushSubscriptionsByUserID recupera le sottoscrizioni Web Push di un utente
+func (m *MongoClient) GetWebPushSubscriptionsByUserID(ctx context.Context, userID string) ([]*models.WebPushSubscription, error) {
+	cursor, err := m.DB.Collection("webpush_subscriptions").Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, fmt.Errorf("errore find webpush subscriptions: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subs []*models.WebPushSubscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("errore decode webpush subscriptions: %v", err)
+	}
+	return subs, nil
+}
+
+// DeleteWebPushSubscription elimina una sottoscrizione; con userID non vuoto solo se
+// appartiene a quell'utente
+func (m *MongoClient) DeleteWebPushSubscription(ctx context.Context, id, userID string) error {
+	filter := bson.M{"_id": id}
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+	if _, err := m.DB.Collection("webpush_subscriptions").DeleteOne(ctx, filter); err != nil {
+		return fmt.Errorf("errore delete webpush subscription: %v", err)
+	}
+	return nil
+}
+
+// EnqueueNotification mette una notifica in attesa del prossimo digest dell'utente
+func (m *MongoClient) EnqueueNotification(ctx context.Context, n *models.PendingNotification) error {
+	if _, err := m.DB.Collection("notification_queue").InsertOne(ctx, n); err != nil {
+		return fmt.Errorf("errore insert pending notification: %v", err)
+	}
+	return nil
+}
+
+// GetUsersWithPendingNotifications restituisce gli utenti con notifiche in attesa di digest
+func (m *MongoClient) GetUsersWithPendingNotifications(ctx context.Context) ([]string, error) {
+	values, err := m.DB.Collection("notification_queue").Distinct(ctx, "user_id", bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("errore distinct pending notifications: %v", err)
+	}
+	userIDs := make([]string, 0, len(values))
+	for _, v := range values {
+		if id, ok := v.(string); ok {
+			userIDs = append(userIDs, id)
+		}
+	}
+	return userIDs, nil
+}
+
+// TakePendingNotifications recupera ed elimina, in ordine di arrivo, le notifiche in
+// attesa di un utente
+func (m *MongoClient) TakePendingNotifications(ctx context.Context, userID string) ([]*models.PendingNotification, error) {
+	coll := m.DB.Collection("notification_queue")
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := coll.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore find pending notifications: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var pending []*models.PendingNotification
+	if err := cursor.All(ctx, &pending); err != nil {
+		return nil, fmt.Errorf("errore decode pending notifications: %v", err)
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]string, len(pending))
+	for i, n := range pending {
+		ids[i] = n.ID
+	}
+	if _, err := coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		return nil, fmt.Errorf("errore delete pending notifications: %v", err)
+	}
+	return pending, nil
+}
+
+// RecordNotificationReceipt salva l'esito di una notifica push o di un SMS
+func (m *MongoClient) RecordNotificationReceipt(ctx context.Context, receipt *models.NotificationReceipt) error {
+	if _, err := m.DB.Collection("notification_history").InsertOne(ctx, receipt); err != nil {
+		return fmt.Errorf("errore insert notification receipt: %v", err)
+	}
+	return nil
+}
+
+// UpdateNotificationReceiptStatus aggiorna l'esito di un SMS con la ricevuta di consegna del
+// provider. Restituisce false se nessuna notifica ha quell'ID messaggio
+func (m *MongoClient) UpdateNotificationReceiptStatus(ctx context.Context, messageID, status, errorCode string, updatedAt time.Time) (bool, error) {
+	set := bson.M{"status": status, "updated_at": updatedAt}
+	if errorCode != "" {
+		set["error"] = errorCode
+	}
+	res, err := m.DB.Collection("notification_history").UpdateOne(ctx,
+		bson.M{"message_id": messageID, "channel": models.ChannelSMS},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return false, fmt.Errorf("errore update notification receipt: %v", err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// SetSMSOptOut registra che un numero non vuole più ricevere SMS
+func (m *MongoClient) SetSMSOptOut(ctx context.Context, optOut *models.SMSOptOut) error {
+	if _, err := m.DB.Collection("sms_opt_outs").ReplaceOne(ctx,
+		bson.M{"_id": optOut.Phone}, optOut, options.Replace().SetUpsert(true)); err != nil {
+		return fmt.Errorf("errore upsert sms opt-out: %v", err)
+	}
+	return nil
+}
+
+// DeleteSMSOptOut riattiva gli SMS verso un numero che aveva risposto STOP
+func (m *MongoClient) DeleteSMSOptOut(ctx context.Context, phone string) error {
+	if _, err := m.DB.Collection("sms_opt_outs").DeleteOne(ctx, bson.M{"_id": phone}); err != nil {
+		return fmt.Errorf("errore delete sms opt-out: %v", err)
+	}
+	return nil
+}
+
+// IsSMSOptedOut indica se un numero ha chiesto di non ricevere più SMS
+func (m *MongoClient) IsSMSOptedOut(ctx context.Context, phone string) (bool, error) {
+	n, err := m.DB.Collection("sms_opt_outs").CountDocuments(ctx, bson.M{"_id": phone}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("errore find sms opt-out: %v", err)
+	}
+	return n > 0, nil
+}
+
+// NotificationHistoryFilter seleziona gli esiti delle notifiche di un utente. I campi vuoti non filtrano
+type NotificationHistoryFilter struct {
+	UserID  string
+	Channel string
+	Status  string
+	Key     string
+}
+
+// FindNotificationHistory recupera una pagina degli esiti delle notifiche push e SMS di un utente,
+// dal più recente salvo diverso ordinamento, e il loro numero totale
+func (m *MongoClient) FindNotificationHistory(ctx context.Context, filter NotificationHistoryFilter, opts ListOptions) ([]*models.NotificationReceipt, int64, error) {
+	query := bson.M{"user_id": filter.UserID}
+	switch filter.Channel {
+	case "":
+	case models.ChannelPush:
+		// Le ricevute push meno recenti non hanno il canale
+		query["channel"] = bson.M{"$in": bson.A{models.ChannelPush, nil}}
+	default:
+		query["channel"] = filter.Channel
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.Key != "" {
+		query["key"] = filter.Key
+	}
+	receipts, total, err := findPage[models.NotificationReceipt](ctx, m.DB.Collection("notification_history"), query, opts, "-created_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore find notification history: %v", err)
+	}
+	return receipts, total, nil
+}
+
+// ==================== MENUS ====================
+
+// CreateMenu salva un menu
+func (m *MongoClient) CreateMenu(ctx context.Context, menu *models.Menu) error {
+	coll := m.DB.Collection("menus")
+	if menu.SchemaVersion == 0 {
+		menu.SchemaVersion = models.MenuSchemaVersion
+	}
+	_, err := coll.InsertOne(ctx, menu)
+	if err != nil {
+		return fmt.Errorf("errore insert menu: %v", err)
+	}
+	return nil
+}
+
+// GetMenuByID recupera un menu per ID
+func (m *MongoClient) GetMenuByID(ctx context.Context, id string) (*models.Menu, error) {
+	coll := m.DB.Collection("menus")
+	var menu models.Menu
+	// I menu nel cestino non sono visibili: si leggono con GetDeletedMenu
+	err := coll.FindOne(ctx, bson.M{"id": id, "deleted_at": bson.M{"$exists": false}}).Decode(&menu)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find menu: %v", err)
+	}
+	return &menu, nil
+}
+
+// GetRestaurantMenu recupera il menu solo se appartiene al ristorante indicato: i menu di
+// altri ristoranti risultano inesistenti. Come GetMenuByID esclude quelli nel cestino
+func (m *MongoClient) GetRestaurantMenu(ctx context.Context, id, restaurantID string) (*models.Menu, error) {
+	if restaurantID == "" {
+		return nil, nil
+	}
+	var menu models.Menu
+	err := m.DB.Collection("menus").FindOne(ctx, bson.M{
+		"id":            id,
+		"restaurant_id": restaurantID,
+		"deleted_at":    bson.M{"$exists": false},
+	}).Decode(&menu)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find menu: %v", err)
+	}
+	return &menu, nil
+}
+
+// GetMenusByRestaurantID recupera tutti i menu di un ristorante
+func (m *MongoClient) GetMenusByRestaurantID(ctx context.Context, restaurantID string) ([]*models.Menu, error) {
+	coll := m.DB.Collection("menus")
+	cursor, err := coll.Find(ctx, bson.M{"restaurant_id": restaurantID, "deleted_at": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, fmt.Errorf("errore find menus: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var menus []*models.Menu
+	if err = cursor.All(ctx, &menus); err != nil {
+		return nil, fmt.Errorf("errore decode menus: %v", err)
+	}
+	return menus, nil
+}
+
+// UpdateMenu aggiorna un menu
+func (m *MongoClient) UpdateMenu(ctx context.Context, menu *models.Menu) error {
+	coll := m.DB.Collection("menus")
+	result := coll.FindOneAndUpdate(ctx,
+		bson.M{"id": menu.ID},
+		bson.M{"$set": menu},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result.Err() != nil && result.Err() != mongo.ErrNoDocuments {
+		return fmt.Errorf("errore update menu: %v", result.Err())
+	}
+	return nil
+}
+
+// UpdateMenuIfUnchanged salva il menu solo se updated_at è ancora updatedAt, come letto dal
+// chiamante. Restituisce false se nel frattempo è stato modificato o spostato nel cestino
+func (m *MongoClient) UpdateMenuIfUnchanged(ctx context.Context, menu *models.Menu, updatedAt time.Time) (bool, error) {
+	result, err := m.DB.Collection("menus").UpdateOne(ctx,
+		bson.M{"id": menu.ID, "updated_at": updatedAt, "deleted_at": bson.M{"$exists": false}},
+		bson.M{"$set": menu},
+	)
+	if err != nil {
+		return false, fmt.Errorf("errore update menu: %v", err)
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// GetMenusChangedSince recupera i menu del ristorante modificati o spostati nel cestino dopo
+// since, dal meno recente
+func (m *MongoClient) GetMenusChangedSince(ctx context.Context, restaurantID string, since time.Time) ([]*models.Menu, error) {
+	cursor, err := m.DB.Collection("menus").Find(ctx,
+		bson.M{
+			"restaurant_id": restaurantID,
+			"$or": bson.A{
+				bson.M{"updated_at": bson.M{"$gt": since}},
+				bson.M{"deleted_at": bson.M{"$gt": since}},
+			},
+		},
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("errore find changed menus: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var menus []*models.Menu
+	if err = cursor.All(ctx, &menus); err != nil {
+		return nil, fmt.Errorf("errore decode changed menus: %v", err)
+	}
+	return menus, nil
+}
+
+// DeleteMenu elimina un menu
+func (m *MongoClient) DeleteMenu(ctx context.Context, id string) error {
+	coll := m.DB.Collection("menus")
+	result, err := coll.DeleteOne(ctx, bson.M{"id": id})
+	if err != nil {
+		return fmt.Errorf("errore delete menu: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("menu non trovato")
+	}
+	return nil
+}
+
+// GetAllMenus recupera tutti i menu
+func (m *MongoClient) GetAllMenus(ctx context.Context) ([]*models.Menu, error) {
+	coll := m.DB.Collection("menus")
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("errore find all menus: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var menus []*models.Menu
+	if err = cursor.All(ctx, &menus); err != nil {
+		return nil, fmt.Errorf("errore decode menus: %v", err)
+	}
+	return menus, nil
+}
+
+// ==================== CESTINO MENU ====================
+
+// SoftDeleteMenu sposta un menu nel cestino: resta nel database (con le analytics che lo
+// referenziano) ma non è più visibile né attivo
+func (m *MongoClient) SoftDeleteMenu(ctx context.Context, id string, deletedAt time.Time) error {
+	coll := m.DB.Collection("menus")
+	result, err := coll.UpdateOne(ctx,
+		bson.M{"id": id, "deleted_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"deleted_at": deletedAt, "is_active": false}},
+	)
+	if err != nil {
+		return fmt.Errorf("errore soft delete menu: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("menu non trovato")
+	}
+	return nil
+}
+
+// GetDeletedMenus recupera i menu nel cestino di un ristorante, dal più recente
+func (m *MongoClient) GetDeletedMenus(ctx context.Context, restaurantID string) ([]*models.Menu, error) {
+	coll := m.DB.Collection("menus")
+	cursor, err := coll.Find(ctx,
+		bson.M{"restaurant_id": restaurantID, "deleted_at": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.D{{Key: "deleted_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("errore find deleted menus: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var menus []*models.Menu
+	if err = cursor.All(ctx, &menus); err != nil {
+		return nil, fmt.Errorf("errore decode deleted menus: %v", err)
+	}
+	return menus, nil
+}
+
+// GetDeletedMenu recupera un menu nel cestino del ristorante
+func (m *MongoClient) GetDeletedMenu(ctx context.Context, id, restaurantID string) (*models.Menu, error) {
+	coll := m.DB.Collection("menus")
+	var menu models.Menu
+	err := coll.FindOne(ctx, bson.M{
+		"id":            id,
+		"restaurant_id": restaurantID,
+		"deleted_at":    bson.M{"$exists": true},
+	}).Decode(&menu)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find deleted menu: %v", err)
+	}
+	return &menu, nil
+}
+
+// RestoreDeletedMenu toglie un menu dal cestino. Restituisce false se non era nel cestino
+func (m *MongoClient) RestoreDeletedMenu(ctx context.Context, id string) (bool, error) {
+	coll := m.DB.Collection("menus")
+	result, err := coll.UpdateOne(ctx,
+		bson.M{"id": id, "deleted_at": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"deleted_at": ""}, "$set": bson.M{"updated_at": time.Now()}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("errore restore menu: %v", err)
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// GetMenusDeletedBefore recupera i menu nel cestino da prima di before, da eliminare definitivamente
+func (m *MongoClient) GetMenusDeletedBefore(ctx context.Context, before time.Time) ([]*models.Menu, error) {
+	return m.findMenus(ctx, bson.M{"deleted_at": bson.M{"$lt": before}})
+}
+
+// GetMenusWithDeletedItemsBefore recupera i menu (anche nel cestino) con piatti eliminati
+// da prima di before
+func (m *MongoClient) GetMenusWithDeletedItemsBefore(ctx context.Context, before time.Time) ([]*models.Menu, error) {
+	return m.findMenus(ctx, bson.M{"deleted_items.deleted_at": bson.M{"$lt": before}})
+}
+
+func (m *MongoClient) findMenus(ctx context.Context, filter bson.M) ([]*models.Menu, error) {
+	coll := m.DB.Collection("menus")
+	cursor, err := coll.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("errore find menus: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var menus []*models.Menu
+	if err = cursor.All(ctx, &menus); err != nil {
+		return nil, fmt.Errorf("errore decode menus: %v", err)
+	}
+	return menus, nil
+}
+
+// PurgeDeletedMenu elimina definitivamente un menu nel cestino e il suo storico. Le
+// analytics del menu non vengono toccate: seguono la loro retention
+func (m *MongoClient) PurgeDeletedMenu(ctx context.Context, id string) error {
+	coll := m.DB.Collection("menus")
+	result, err := coll.DeleteOne(ctx, bson.M{"id": id, "deleted_at": bson.M{"$exists": true}})
+	if err != nil {
+		return fmt.Errorf("errore purge menu: %v", err)
+	}
+	if result.DeletedCount > 0 {
+		if _, err := m.DB.Collection("menu_revisions").DeleteMany(ctx, bson.M{"menu_id": id}); err != nil {
+			return fmt.Errorf("errore delete menu revisions: %v", err)
+		}
+	}
+	return nil
+}
+
+// ==================== GIACENZE ====================
+
+// UpdateItemInventory salva giacenza e disponibilità di un piatto solo se la quantità è ancora
+// before, come letta dal chiamante. Restituisce false se nel frattempo è cambiata (o il piatto
+// non esiste più): il chiamante rilegge il menu e riprova. Aggiorna updated_at del menu, che
+// segnala la modifica alla sincronizzazione con le casse
+func (m *MongoClient) UpdateItemInventory(ctx context.Context, menuID string, item models.MenuItem, before *int) (bool, error) {
+	itemFilter := bson.M{"it.id": item.ID}
+	if before != nil {
+		itemFilter["it.inventory.quantity"] = *before
+	} else {
+		itemFilter["it.inventory"] = bson.M{"$exists": false}
+	}
+	set := bson.M{"categories.$[].items.$[it].available": item.Available, "updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	if item.Inventory != nil {
+		set["categories.$[].items.$[it].inventory"] = item.Inventory
+	} else {
+		update["$unset"] = bson.M{"categories.$[].items.$[it].inventory": ""}
+	}
+
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{itemFilter}})
+	result, err := m.DB.Collection("menus").UpdateOne(ctx, bson.M{"id": menuID}, update, opts)
+	if err != nil {
+		return false, fmt.Errorf("errore update item inventory: %v", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// CreateStockAdjustment registra una variazione di giacenza
+func (m *MongoClient) CreateStockAdjustment(ctx context.Context, adjustment *models.StockAdjustment) error {
+	if _, err := m.DB.Collection("stock_adjustments").InsertOne(ctx, adjustment); err != nil {
+		return fmt.Errorf("errore insert stock adjustment: %v", err)
+	}
+	return nil
+}
+
+// StockAdjustmentFilter seleziona le variazioni di giacenza di un ristorante. I campi vuoti
+// non filtrano
+type StockAdjustmentFilter struct {
+	RestaurantID string
+	ItemID       string
+	Reason       string
+	Since        time.Time
+}
+
+func (f StockAdjustmentFilter) query() bson.M {
+	query := bson.M{"restaurant_id": f.RestaurantID}
+	if f.ItemID != "" {
+		query["item_id"] = f.ItemID
+	}
+	if f.Reason != "" {
+		query["reason"] = f.Reason
+	}
+	if !f.Since.IsZero() {
+		query["created_at"] = bson.M{"$gte": f.Since}
+	}
+	return query
+}
+
+// FindStockAdjustments recupera una pagina dei movimenti di magazzino, dal più recente salvo
+// diverso ordinamento, e il numero totale di movimenti
+func (m *MongoClient) FindStockAdjustments(ctx context.Context, filter StockAdjustmentFilter, opts ListOptions) ([]*models.StockAdjustment, int64, error) {
+	adjustments, total, err := findPage[models.StockAdjustment](ctx, m.DB.Collection("stock_adjustments"), filter.query(), opts, "-created_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore find stock adjustments: %v", err)
+	}
+	return adjustments, total, nil
+}
+
+// GetStockConsumption somma per piatto le quantità scaricate da ordini e scarti dal momento
+// since: la base dei consumi medi e dei giorni di copertura delle giacenze
+func (m *MongoClient) GetStockConsumption(ctx context.Context, restaurantID string, since time.Time) (map[string]int, error) {
+	cursor, err := m.DB.Collection("stock_adjustments").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"restaurant_id": restaurantID,
+			"reason":        bson.M{"$in": []string{models.StockReasonOrder, models.StockReasonWaste}},
+			"created_at":    bson.M{"$gte": since},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$item_id", "consumed": bson.M{"$sum": "$delta"}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("errore aggregate stock consumption: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		ItemID   string `bson:"_id"`
+		Consumed int    `bson:"consumed"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("errore decode stock consumption: %v", err)
+	}
+	consumption := make(map[string]int, len(rows))
+	for _, row := range rows {
+		consumption[row.ItemID] = -row.Consumed // Gli scarichi hanno delta negativo
+	}
+	return consumption, nil
+}
+
+// ==================== ORDINI ====================
+
+// NextOrderNumber restituisce il prossimo numero di scontrino del ristorante nel giorno
+// indicato (formato 2006-01-02): la numerazione riparte ogni giorno da 1
+func (m *MongoClient) NextOrderNumber(ctx context.Context, restaurantID, day string) (int, error) {
+	var counter struct {
+		Seq int `bson:"seq"`
+	}
+	err := m.DB.Collection("order_counters").FindOneAndUpdate(ctx,
+		bson.M{"_id": restaurantID + ":" + day},
+		bson.M{"$inc": bson.M{"seq": 1}, "$setOnInsert": bson.M{"restaurant_id": restaurantID}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	if err != nil {
+		return 0, fmt.Errorf("errore increment order counter: %v", err)
+	}
+	return counter.Seq, nil
+}
+
+// ReserveSlot prenota un posto nella fascia oraria del ristorante che inizia a slot, se ha
+// ancora meno di capacity ordini. Restituisce false se la fascia è piena
+func (m *MongoClient) ReserveSlot(ctx context.Context, restaurantID string, slot time.Time, capacity int) (bool, error) {
+	_, err := m.DB.Collection("slot_bookings").UpdateOne(ctx,
+		bson.M{"_id": slotBookingID(restaurantID, slot), "count": bson.M{"$lt": capacity}},
+		bson.M{
+			"$inc": bson.M{"count": 1},
+			// La prenotazione scade un giorno dopo la fascia e viene rimossa dall'indice TTL
+			"$setOnInsert": bson.M{"restaurant_id": restaurantID, "slot": slot, "expires_at": slot.Add(24 * time.Hour)},
+		},
+		options.Update().SetUpsert(true),
+	)
+	// Con la fascia piena il filtro non trova il documento e l'upsert ne inserisce un altro
+	// con lo stesso _id
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("errore reserve slot: %v", err)
+	}
+	return true, nil
+}
+
+// ReleaseSlot libera il posto di un ordine annullato o non registrato
+func (m *MongoClient) ReleaseSlot(ctx context.Context, restaurantID string, slot time.Time) error {
+	_, err := m.DB.Collection("slot_bookings").UpdateOne(ctx,
+		bson.M{"_id": slotBookingID(restaurantID, slot), "count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"count": -1}})
+	if err != nil {
+		return fmt.Errorf("errore release slot: %v", err)
+	}
+	return nil
+}
+
+// SlotBookings restituisce il numero di ordini prenotati nelle fasce del ristorante che
+// iniziano tra from (incluso) e to (escluso), per inizio della fascia in secondi Unix
+func (m *MongoClient) SlotBookings(ctx context.Context, restaurantID string, from, to time.Time) (map[int64]int, error) {
+	cursor, err := m.DB.Collection("slot_bookings").Find(ctx, bson.M{
+		"restaurant_id": restaurantID,
+		"slot":          bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("errore find slot bookings: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Slot  time.Time `bson:"slot"`
+		Count int       `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("errore decode slot bookings: %v", err)
+	}
+	bookings := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		bookings[row.Slot.Unix()] = row.Count
+	}
+	return bookings, nil
+}
+
+func slotBookingID(restaurantID string, slot time.Time) string {
+	return restaurantID + ":" + slot.UTC().Format(time.RFC3339)
+}
+
+// GetOrderByTracking recupera l'ordine fatto in anticipo da un cliente con il token della sua
+// pagina di stato; nil se non esiste o il token non corrisponde
+func (m *MongoClient) GetOrderByTracking(ctx context.Context, id, token string) (*models.Order, error) {
+	if token == "" {
+		return nil, nil
+	}
+	var order models.Order
+	err := m.DB.Collection("orders").FindOne(ctx, bson.M{"_id": id, "fulfillment.tracking_token": token}).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find order: %v", err)
+	}
+	return &order, nil
+}
+
+// CreateOrder salva un nuovo ordine
+func (m *MongoClient) CreateOrder(ctx context.Context, order *models.Order) error {
+	if _, err := m.DB.Collection("orders").InsertOne(ctx, order); err != nil {
+		return fmt.Errorf("errore insert order: %v", err)
+	}
+	return nil
+}
+
+// GetOrder recupera un ordine del ristorante; nil se non esiste o è di un altro ristorante
+func (m *MongoClient) GetOrder(ctx context.Context, id, restaurantID string) (*models.Order, error) {
+	var order models.Order
+	err := m.DB.Collection("orders").FindOne(ctx, bson.M{"_id": id, "restaurant_id": restaurantID}).Decode(&order)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find order: %v", err)
+	}
+	return &order, nil
+}
+
+// UpdateOrder salva righe e stato dell'ordine solo se non è cambiato dopo la lettura
+// (updated_at uguale a before). Restituisce false se un'altra richiesta l'ha modificato: il
+// chiamante rilegge l'ordine e riprova
+func (m *MongoClient) UpdateOrder(ctx context.Context, order *models.Order, before time.Time) (bool, error) {
+	result, err := m.DB.Collection("orders").ReplaceOne(ctx,
+		bson.M{"_id": order.ID, "restaurant_id": order.RestaurantID, "updated_at": before}, order)
+	if err != nil {
+		return false, fmt.Errorf("errore update order: %v", err)
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// OrderFilter seleziona gli ordini di un ristorante
+type OrderFilter struct {
+	RestaurantID  string
+	Statuses      []string  // Vuoto = tutti gli stati
+	Table         string    // Vuoto = tutti i tavoli
+	PaymentStatus string    // Vuoto = qualsiasi stato del pagamento
+	Since         time.Time // Zero = nessun limite
+	Until         time.Time // Escluso; zero = nessun limite
+}
+
+func (f OrderFilter) query() bson.M {
+	query := bson.M{"restaurant_id": f.RestaurantID}
+	if len(f.Statuses) > 0 {
+		query["status"] = bson.M{"$in": f.Statuses}
+	}
+	if f.Table != "" {
+		query["table"] = f.Table
+	}
+	if f.PaymentStatus != "" {
+		query["payment_status"] = f.PaymentStatus
+	}
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		created := bson.M{}
+		if !f.Since.IsZero() {
+			created["$gte"] = f.Since
+		}
+		if !f.Until.IsZero() {
+			created["$lt"] = f.Until
+		}
+		query["created_at"] = created
+	}
+	return query
+}
+
+// FindOrders recupera una pagina degli ordini, dal più recente salvo diverso ordinamento, e il
+// numero totale di ordini
+func (m *MongoClient) FindOrders(ctx context.Context, filter OrderFilter, opts ListOptions) ([]*models.Order, int64, error) {
+	orders, total, err := findPage[models.Order](ctx, m.DB.Collection("orders"), filter.query(), opts, "-created_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore find orders: %v", err)
+	}
+	return orders, total, nil
+}
+
+// StreamOrders scorre gli ordini filtrati in ordine cronologico senza caricarli tutti in
+// memoria, chiamando fn per ciascuno. Si interrompe al primo errore di fn
+func (m *MongoClient) StreamOrders(ctx context.Context, filter OrderFilter, fn func(*models.Order) error) error {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetBatchSize(500)
+
+	cursor, err := m.DB.Collection("orders").Find(ctx, filter.query(), opts)
+	if err != nil {
+		return fmt.Errorf("errore find orders: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var order models.Order
+		if err := cursor.Decode(&order); err != nil {
+			return err
+		}
+		if err := fn(&order); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// ==================== FEEDBACK ====================
+
+// CreateFeedback salva il feedback di un cliente
+func (m *MongoClient) CreateFeedback(ctx context.Context, feedback *models.Feedback) error {
+	if _, err := m.DB.Collection("feedback").InsertOne(ctx, feedback); err != nil {
+		return fmt.Errorf("errore insert feedback: %v", err)
+	}
+	return nil
+}
+
+// ModerateFeedback approva o rifiuta un feedback del ristorante e lo restituisce aggiornato;
+// nil se non esiste o è di un altro ristorante
+func (m *MongoClient) ModerateFeedback(ctx context.Context, id, restaurantID, status, moderatorID string, at time.Time) (*models.Feedback, error) {
+	var feedback models.Feedback
+	err := m.DB.Collection("feedback").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "restaurant_id": restaurantID},
+		bson.M{"$set": bson.M{"status": status, "moderated_at": at, "moderated_by": moderatorID}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&feedback)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore moderate feedback: %v", err)
+	}
+	return &feedback, nil
+}
+
+// FeedbackFilter seleziona i feedback di un ristorante. I campi vuoti non filtrano
+type FeedbackFilter struct {
+	RestaurantID string
+	Status       string
+	ItemID       string // Feedback che valutano il piatto
+	OrderID      string
+	VisitorHash  string
+	Since        time.Time
+}
+
+func (f FeedbackFilter) query() bson.M {
+	query := bson.M{"restaurant_id": f.RestaurantID}
+	if f.Status != "" {
+		query["status"] = f.Status
+	}
+	if f.ItemID != "" {
+		query["items.item_id"] = f.ItemID
+	}
+	if f.OrderID != "" {
+		query["order_id"] = f.OrderID
+	}
+	if f.VisitorHash != "" {
+		query["visitor_hash"] = f.VisitorHash
+	}
+	if !f.Since.IsZero() {
+		query["created_at"] = bson.M{"$gte": f.Since}
+	}
+	return query
+}
+
+// FindFeedback recupera una pagina dei feedback, dal più recente salvo diverso ordinamento, e
+// il numero totale di feedback
+func (m *MongoClient) FindFeedback(ctx context.Context, filter FeedbackFilter, opts ListOptions) ([]*models.Feedback, int64, error) {
+	feedback, total, err := findPage[models.Feedback](ctx, m.DB.Collection("feedback"), filter.query(), opts, "-created_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore find feedback: %v", err)
+	}
+	return feedback, total, nil
+}
+
+// CountFeedback conta i feedback del ristorante che corrispondono al filtro
+func (m *MongoClient) CountFeedback(ctx context.Context, filter FeedbackFilter) (int64, error) {
+	count, err := m.DB.Collection("feedback").CountDocuments(ctx, filter.query())
+	if err != nil {
+		return 0, fmt.Errorf("errore count feedback: %v", err)
+	}
+	return count, nil
+}
+
+// GetRatingStats calcola media, distribuzione e medie per piatto dei feedback approvati del
+// ristorante dal momento since (zero per tutti)
+func (m *MongoClient) GetRatingStats(ctx context.Context, restaurantID string, since time.Time) (*models.RatingStats, error) {
+	match := bson.M{"restaurant_id": restaurantID, "status": models.FeedbackApproved}
+	if !since.IsZero() {
+		match["created_at"] = bson.M{"$gte": since}
+	}
+	coll := m.DB.Collection("feedback")
+
+	cursor, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": "$rating", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("errore aggregate ratings: %v", err)
+	}
+	var ratings []struct {
+		Rating int `bson:"_id"`
+		Count  int `bson:"count"`
+	}
+	err = cursor.All(ctx, &ratings)
+	cursor.Close(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("errore decode ratings: %v", err)
+	}
+
+	stats := &models.RatingStats{Items: make(map[string]models.ItemRating), UpdatedAt: time.Now()}
+	sum := 0
+	for _, row := range ratings {
+		if !models.ValidRating(row.Rating) {
+			continue
+		}
+		stats.Distribution[row.Rating-1] = row.Count
+		stats.Count += row.Count
+		sum += row.Rating * row.Count
+	}
+	if stats.Count > 0 {
+		stats.Average = roundRating(float64(sum) / float64(stats.Count))
+	}
+
+	cursor, err = coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$unwind", Value: "$items"}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$items.item_id",
+			"name":    bson.M{"$last": "$items.name"},
+			"average": bson.M{"$avg": "$items.rating"},
+			"count":   bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("errore aggregate item ratings: %v", err)
+	}
+	defer cursor.Close(ctx)
+	var items []struct {
+		ItemID  string  `bson:"_id"`
+		Name    string  `bson:"name"`
+		Average float64 `bson:"average"`
+		Count   int     `bson:"count"`
+	}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("errore decode item ratings: %v", err)
+	}
+	for _, row := range items {
+		stats.Items[row.ItemID] = models.ItemRating{
+			Name:          row.Name,
+			RatingSummary: models.RatingSummary{Average: roundRating(row.Average), Count: row.Count},
+		}
+	}
+	return stats, nil
+}
+
+// roundRating arrotonda una media di stelle a due decimali
+func roundRating(average float64) float64 {
+	return math.Round(average*100) / 100
+}
+
+// SetRestaurantRatings salva sul ristorante le valutazioni mostrate nel menu pubblico
+func (m *MongoClient) SetRestaurantRatings(ctx context.Context, restaurantID string, stats *models.RatingStats) error {
+	_, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurantID},
+		bson.M{"$set": bson.M{"ratings": stats}})
+	if err != nil {
+		return fmt.Errorf("errore update restaurant ratings: %v", err)
+	}
+	return nil
+}
+
+// ==================== FEDELTÀ ====================
+
+// SetRestaurantLoyalty salva la configurazione del programma fedeltà del ristorante
+func (m *MongoClient) SetRestaurantLoyalty(ctx context.Context, restaurantID string, program *models.LoyaltyProgram) error {
+	_, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurantID},
+		bson.M{"$set": bson.M{"loyalty": program}})
+	if err != nil {
+		return fmt.Errorf("errore update restaurant loyalty: %v", err)
+	}
+	return nil
+}
+
+// CreateLoyaltyVisit salva il codice di una visita. Restituisce ErrDuplicateLoyaltyCode se il
+// codice è già usato nel ristorante
+func (m *MongoClient) CreateLoyaltyVisit(ctx context.Context, visit *models.LoyaltyVisit) error {
+	_, err := m.DB.Collection("loyalty_visits").InsertOne(ctx, visit)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateLoyaltyCode
+	}
+	if err != nil {
+		return fmt.Errorf("errore insert loyalty visit: %v", err)
+	}
+	return nil
+}
+
+// GetLoyaltyVisit recupera il codice di una visita del ristorante. Restituisce nil se non esiste
+func (m *MongoClient) GetLoyaltyVisit(ctx context.Context, id, restaurantID string) (*models.LoyaltyVisit, error) {
+	return m.findLoyaltyVisit(ctx, bson.M{"_id": id, "restaurant_id": restaurantID})
+}
+
+// GetLoyaltyVisitByOrder recupera il codice della visita generato per un ordine. Restituisce
+// nil se non esiste
+func (m *MongoClient) GetLoyaltyVisitByOrder(ctx context.Context, restaurantID, orderID string) (*models.LoyaltyVisit, error) {
+	return m.findLoyaltyVisit(ctx, bson.M{"restaurant_id": restaurantID, "order_id": orderID})
+}
+
+func (m *MongoClient) findLoyaltyVisit(ctx context.Context, filter bson.M) (*models.LoyaltyVisit, error) {
+	var visit models.LoyaltyVisit
+	err := m.DB.Collection("loyalty_visits").FindOne(ctx, filter).Decode(&visit)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find loyalty visit: %v", err)
+	}
+	return &visit, nil
+}
+
+// ClaimLoyaltyVisit assegna alla tessera il codice della visita, se non è ancora stato usato
+// ed è valido a now, e lo restituisce aggiornato. Restituisce nil se il codice non esiste, è
+// scaduto o è già stato usato: con più richieste insieme vince una sola
+func (m *MongoClient) ClaimLoyaltyVisit(ctx context.Context, restaurantID, code, cardID string, now time.Time) (*models.LoyaltyVisit, error) {
+	var visit models.LoyaltyVisit
+	err := m.DB.Collection("loyalty_visits").FindOneAndUpdate(ctx,
+		bson.M{"restaurant_id": restaurantID, "code": code, "claimed_at": nil, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"claimed_at": now, "card_id": cardID}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&visit)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore claim loyalty visit: %v", err)
+	}
+	return &visit, nil
+}
+
+// CreateLoyaltyCard salva una nuova tessera fedeltà. Restituisce ErrDuplicateLoyaltyCode se il
+// numero è già usato nel ristorante
+func (m *MongoClient) CreateLoyaltyCard(ctx context.Context, card *models.LoyaltyCard) error {
+	_, err := m.DB.Collection("loyalty_cards").InsertOne(ctx, card)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateLoyaltyCode
+	}
+	if err != nil {
+		return fmt.Errorf("errore insert loyalty card: %v", err)
+	}
+	return nil
+}
+
+// GetLoyaltyCardByToken recupera la tessera del ristorante con l'hash del token indicato.
+// Restituisce nil se non esiste
+func (m *MongoClient) GetLoyaltyCardByToken(ctx context.Context, restaurantID, tokenHash string) (*models.LoyaltyCard, error) {
+	return m.findLoyaltyCard(ctx, bson.M{"restaurant_id": restaurantID, "token_hash": tokenHash})
+}
+
+// GetLoyaltyCardByNumber recupera la tessera del ristorante con il numero indicato.
+// Restituisce nil se non esiste
+func (m *MongoClient) GetLoyaltyCardByNumber(ctx context.Context, restaurantID, number string) (*models.LoyaltyCard, error) {
+	return m.findLoyaltyCard(ctx, bson.M{"restaurant_id": restaurantID, "number": number})
+}
+
+func (m *MongoClient) findLoyaltyCard(ctx context.Context, filter bson.M) (*models.LoyaltyCard, error) {
+	var card models.LoyaltyCard
+	err := m.DB.Collection("loyalty_cards").FindOne(ctx, filter).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find loyalty card: %v", err)
+	}
+	return &card, nil
+}
+
+// AddLoyaltyPoints aggiunge (o, se negativi, toglie) punti al saldo della tessera e la
+// restituisce aggiornata; visit conta anche una visita. Restituisce nil se il saldo non basta
+// per i punti da togliere
+func (m *MongoClient) AddLoyaltyPoints(ctx context.Context, cardID string, points int, visit bool, at time.Time) (*models.LoyaltyCard, error) {
+	filter := bson.M{"_id": cardID}
+	inc := bson.M{"points": points}
+	update := bson.M{"$inc": inc}
+	if points < 0 {
+		filter["points"] = bson.M{"$gte": -points}
+	} else {
+		inc["earned_points"] = points
+	}
+	if visit {
+		inc["visits"] = 1
+		update["$set"] = bson.M{"last_visit_at": at}
+	}
+
+	var card models.LoyaltyCard
+	err := m.DB.Collection("loyalty_cards").FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&card)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore update loyalty points: %v", err)
+	}
+	return &card, nil
+}
+
+// CreateLoyaltyTransaction registra un movimento di punti
+func (m *MongoClient) CreateLoyaltyTransaction(ctx context.Context, transaction *models.LoyaltyTransaction) error {
+	if _, err := m.DB.Collection("loyalty_transactions").InsertOne(ctx, transaction); err != nil {
+		return fmt.Errorf("errore insert loyalty transaction: %v", err)
+	}
+	return nil
+}
+
+// LoyaltyTransactionFilter seleziona i movimenti di punti di un ristorante. I campi vuoti non filtrano
+type LoyaltyTransactionFilter struct {
+	RestaurantID string
+	CardID       string
+	Type         string
+	VisitorHash  string
+	Since        time.Time
+}
+
+func (f LoyaltyTransactionFilter) query() bson.M {
+	query := bson.M{"restaurant_id": f.RestaurantID}
+	if f.CardID != "" {
+		query["card_id"] = f.CardID
+	}
+	if f.Type != "" {
+		query["type"] = f.Type
+	}
+	if f.VisitorHash != "" {
+		query["visitor_hash"] = f.VisitorHash
+	}
+	if !f.Since.IsZero() {
+		query["created_at"] = bson.M{"$gte": f.Since}
+	}
+	return query
+}
+
+// FindLoyaltyTransactions recupera una pagina dei movimenti di punti, dal più recente salvo
+// diverso ordinamento, e il numero totale di movimenti
+func (m *MongoClient) FindLoyaltyTransactions(ctx context.Context, filter LoyaltyTransactionFilter, opts ListOptions) ([]*models.LoyaltyTransaction, int64, error) {
+	transactions, total, err := findPage[models.LoyaltyTransaction](ctx, m.DB.Collection("loyalty_transactions"), filter.query(), opts, "-created_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore find loyalty transactions: %v", err)
+	}
+	return transactions, total, nil
+}
+
+// CountLoyaltyTransactions conta i movimenti di punti che corrispondono al filtro
+func (m *MongoClient) CountLoyaltyTransactions(ctx context.Context, filter LoyaltyTransactionFilter) (int64, error) {
+	count, err := m.DB.Collection("loyalty_transactions").CountDocuments(ctx, filter.query())
+	if err != nil {
+		return 0, fmt.Errorf("errore count loyalty transactions: %v", err)
+	}
+	return count, nil
+}
+
+// ==================== BUONI REGALO ====================
+
+// SetRestaurantVoucherSettings salva la configurazione dei buoni regalo del ristorante
+func (m *MongoClient) SetRestaurantVoucherSettings(ctx context.Context, restaurantID string, settings *models.VoucherSettings) error {
+	_, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurantID},
+		bson.M{"$set": bson.M{"vouchers": settings}})
+	if err != nil {
+		return fmt.Errorf("errore update restaurant vouchers: %v", err)
+	}
+	return nil
+}
+
+// SetRestaurantPaymentSettings salva il provider dei pagamenti online del ristorante; nil lo
+// rimuove
+func (m *MongoClient) SetRestaurantPaymentSettings(ctx context.Context, restaurantID string, settings *models.PaymentSettings) error {
+	update := bson.M{"$set": bson.M{"payments": settings}}
+	if settings == nil {
+		update = bson.M{"$unset": bson.M{"payments": ""}}
+	}
+	if _, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurantID}, update); err != nil {
+		return fmt.Errorf("errore update restaurant payments: %v", err)
+	}
+	return nil
+}
+
+// SetRestaurantFulfillment salva la configurazione degli ordini in anticipo del ristorante
+func (m *MongoClient) SetRestaurantFulfillment(ctx context.Context, restaurantID string, settings *models.FulfillmentSettings) error {
+	if _, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurantID}, bson.M{"$set": bson.M{"fulfillment": settings}}); err != nil {
+		return fmt.Errorf("errore update restaurant fulfillment: %v", err)
+	}
+	return nil
+}
+
+// SetRestaurantWhatsApp salva il numero WhatsApp Business del ristorante; nil lo scollega
+func (m *MongoClient) SetRestaurantWhatsApp(ctx context.Context, restaurantID string, settings *models.WhatsAppSettings) error {
+	update := bson.M{"$set": bson.M{"whatsapp": settings}}
+	if settings == nil {
+		update = bson.M{"$unset": bson.M{"whatsapp": ""}}
+	}
+	if _, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurantID}, update); err != nil {
+		return fmt.Errorf("errore update restaurant whatsapp: %v", err)
+	}
+	return nil
+}
+
+// GetRestaurantByWhatsAppNumber restituisce il ristorante collegato al numero WhatsApp Business
+// con l'ID indicato, nil se nessuno
+func (m *MongoClient) GetRestaurantByWhatsAppNumber(ctx context.Context, phoneNumberID string) (*models.Restaurant, error) {
+	var restaurant models.Restaurant
+	err := m.DB.Collection("restaurants").FindOne(ctx, bson.M{"whatsapp.phone_number_id": phoneNumberID}).Decode(&restaurant)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find restaurant by whatsapp number: %v", err)
+	}
+	return &restaurant, nil
+}
+
+// MarkWhatsAppBroadcast registra l'invio del menu del giorno day agli iscritti. Restituisce
+// false se per quel giorno è già stato inviato, così due richieste insieme non lo inviano due volte
+func (m *MongoClient) MarkWhatsAppBroadcast(ctx context.Context, restaurantID, day string) (bool, error) {
+	res, err := m.DB.Collection("restaurants").UpdateOne(ctx,
+		bson.M{"_id": restaurantID, "whatsapp": bson.M{"$ne": nil}, "whatsapp.last_broadcast": bson.M{"$ne": day}},
+		bson.M{"$set": bson.M{"whatsapp.last_broadcast": day}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("errore update whatsapp broadcast: %v", err)
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// SaveWhatsAppSubscriber iscrive un numero al menu del giorno del ristorante. Un numero già
+// iscritto mantiene ID e data di iscrizione
+func (m *MongoClient) SaveWhatsAppSubscriber(ctx context.Context, sub *models.WhatsAppSubscriber) error {
+	_, err := m.DB.Collection("whatsapp_subscribers").UpdateOne(ctx,
+		bson.M{"restaurant_id": sub.RestaurantID, "phone": sub.Phone},
+		bson.M{
+			"$set":         bson.M{"name": sub.Name},
+			"$setOnInsert": bson.M{"_id": sub.ID, "subscribed_at": sub.SubscribedAt},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("errore upsert whatsapp subscriber: %v", err)
+	}
+	return nil
+}
+
+// DeleteWhatsAppSubscriber cancella l'iscrizione di un numero. Restituisce false se non era iscritto
+func (m *MongoClient) DeleteWhatsAppSubscriber(ctx context.Context, restaurantID, phone string) (bool, error) {
+	res, err := m.DB.Collection("whatsapp_subscribers").DeleteOne(ctx, bson.M{"restaurant_id": restaurantID, "phone": phone})
+	if err != nil {
+		return false, fmt.Errorf("errore delete whatsapp subscriber: %v", err)
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// FindWhatsAppSubscribers restituisce una pagina degli iscritti al menu del giorno del
+// ristorante, dal più recente, e il loro numero totale. opts vuoto li restituisce tutti
+func (m *MongoClient) FindWhatsAppSubscribers(ctx context.Context, restaurantID string, opts ListOptions) ([]*models.WhatsAppSubscriber, int64, error) {
+	subscribers, total, err := findPage[models.WhatsAppSubscriber](ctx, m.DB.Collection("whatsapp_subscribers"),
+		bson.M{"restaurant_id": restaurantID}, opts, "-subscribed_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore find whatsapp subscribers: %v", err)
+	}
+	return subscribers, total, nil
+}
+
+// CreateTelegramLinkCode salva un codice di collegamento di una chat Telegram
+func (m *MongoClient) CreateTelegramLinkCode(ctx context.Context, code *models.TelegramLinkCode) error {
+	if _, err := m.DB.Collection("telegram_link_codes").InsertOne(ctx, code); err != nil {
+		return fmt.Errorf("errore insert telegram link code: %v", err)
+	}
+	return nil
+}
+
+// ConsumeTelegramLinkCode restituisce e cancella un codice di collegamento non scaduto, nil se
+// non esiste: lo stesso codice non collega due chat
+func (m *MongoClient) ConsumeTelegramLinkCode(ctx context.Context, code string) (*models.TelegramLinkCode, error) {
+	var link models.TelegramLinkCode
+	err := m.DB.Collection("telegram_link_codes").FindOneAndDelete(ctx,
+		bson.M{"_id": code, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore consume telegram link code: %v", err)
+	}
+	return &link, nil
+}
+
+// SaveTelegramChat collega una chat Telegram; una chat già collegata passa al nuovo ristorante
+func (m *MongoClient) SaveTelegramChat(ctx context.Context, chat *models.TelegramChat) error {
+	_, err := m.DB.Collection("telegram_chats").ReplaceOne(ctx, bson.M{"_id": chat.ID}, chat, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("errore upsert telegram chat: %v", err)
+	}
+	return nil
+}
+
+// GetTelegramChat restituisce una chat Telegram collegata, nil se non lo è
+func (m *MongoClient) GetTelegramChat(ctx context.Context, chatID int64) (*models.TelegramChat, error) {
+	var chat models.TelegramChat
+	err := m.DB.Collection("telegram_chats").FindOne(ctx, bson.M{"_id": chatID}).Decode(&chat)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find telegram chat: %v", err)
+	}
+	return &chat, nil
+}
+
+// SetTelegramChatDailySummary attiva o disattiva il riepilogo serale di una chat del
+// ristorante. Restituisce false se la chat non è collegata al ristorante
+func (m *MongoClient) SetTelegramChatDailySummary(ctx context.Context, restaurantID string, chatID int64, enabled bool) (bool, error) {
+	res, err := m.DB.Collection("telegram_chats").UpdateOne(ctx,
+		bson.M{"_id": chatID, "restaurant_id": restaurantID},
+		bson.M{"$set": bson.M{"daily_summary": enabled}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("errore update telegram chat: %v", err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// DeleteTelegramChat scollega una chat. Con restaurantID vuoto la scollega da qualunque
+// ristorante. Restituisce false se non era collegata
+func (m *MongoClient) DeleteTelegramChat(ctx context.Context, restaurantID string, chatID int64) (bool, error) {
+	filter := bson.M{"_id": chatID}
+	if restaurantID != "" {
+		filter["restaurant_id"] = restaurantID
+	}
+	res, err := m.DB.Collection("telegram_chats").DeleteOne(ctx, filter)
+	if err != nil {
+		return false, fmt.Errorf("errore delete telegram chat: %v", err)
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// GetTelegramChats restituisce le chat Telegram collegate al ristorante, dalla più recente
+func (m *MongoClient) GetTelegramChats(ctx context.Context, restaurantID string) ([]*models.TelegramChat, error) {
+	chats, _, err := findPage[models.TelegramChat](ctx, m.DB.Collection("telegram_chats"),
+		bson.M{"restaurant_id": restaurantID}, ListOptions{}, "-linked_at")
+	if err != nil {
+		return nil, fmt.Errorf("errore find telegram chats: %v", err)
+	}
+	return chats, nil
+}
+
+// StreamTelegramDailyChats chiama fn per ogni chat con il riepilogo serale attivo, ordinate
+// per ristorante. Si ferma al primo errore di fn
+func (m *MongoClient) StreamTelegramDailyChats(ctx context.Context, fn func(*models.TelegramChat) error) error {
+	cursor, err := m.DB.Collection("telegram_chats").Find(ctx, bson.M{"daily_summary": true},
+		options.Find().SetSort(bson.D{{Key: "restaurant_id", Value: 1}}))
+	if err != nil {
+		return fmt.Errorf("errore find telegram chats: %v", err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var chat models.TelegramChat
+		if err := cursor.Decode(&chat); err != nil {
+			return fmt.Errorf("errore decode telegram chat: %v", err)
+		}
+		if err := fn(&chat); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// CreateChatWebhook salva un webhook Slack o Discord del ristorante
+func (m *MongoClient) CreateChatWebhook(ctx context.Context, hook *models.ChatWebhook) error {
+	if _, err := m.DB.Collection("chat_webhooks").InsertOne(ctx, hook); err != nil {
+		return fmt.Errorf("errore insert chat webhook: %v", err)
+	}
+	return nil
+}
+
+// GetChatWebhooks restituisce i webhook Slack e Discord del ristorante, dal più recente
+func (m *MongoClient) GetChatWebhooks(ctx context.Context, restaurantID string) ([]*models.ChatWebhook, error) {
+	hooks, _, err := findPage[models.ChatWebhook](ctx, m.DB.Collection("chat_webhooks"),
+		bson.M{"restaurant_id": restaurantID}, ListOptions{}, "-created_at")
+	if err != nil {
+		return nil, fmt.Errorf("errore find chat webhooks: %v", err)
+	}
+	return hooks, nil
+}
+
+// GetChatWebhooksForEvent restituisce i webhook Slack e Discord attivi del ristorante iscritti
+// all'evento
+func (m *MongoClient) GetChatWebhooksForEvent(ctx context.Context, restaurantID, eventType string) ([]*models.ChatWebhook, error) {
+	cursor, err := m.DB.Collection("chat_webhooks").Find(ctx,
+		bson.M{"restaurant_id": restaurantID, "is_active": true, "events": eventType})
+	if err != nil {
+		return nil, fmt.Errorf("errore find chat webhooks: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var hooks []*models.ChatWebhook
+	if err := cursor.All(ctx, &hooks); err != nil {
+		return nil, fmt.Errorf("errore decode chat webhooks: %v", err)
+	}
+	return hooks, nil
+}
+
+// GetChatWebhook restituisce un webhook Slack o Discord del ristorante, nil se non esiste
+func (m *MongoClient) GetChatWebhook(ctx context.Context, id, restaurantID string) (*models.ChatWebhook, error) {
+	var hook models.ChatWebhook
+	err := m.DB.Collection("chat_webhooks").FindOne(ctx, bson.M{"id": id, "restaurant_id": restaurantID}).Decode(&hook)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find chat webhook: %v", err)
+	}
+	return &hook, nil
+}
+
+// UpdateChatWebhook salva nome, eventi, lingua e stato di un webhook del ristorante.
+// Restituisce false se non esiste
+func (m *MongoClient) UpdateChatWebhook(ctx context.Context, hook *models.ChatWebhook) (bool, error) {
+	set := bson.M{
+		"name":       hook.Name,
+		"events":     hook.Events,
+		"locale":     hook.Locale,
+		"is_active":  hook.IsActive,
+		"updated_at": hook.UpdatedAt,
+	}
+	update := bson.M{"$set": set}
+	if hook.IsActive {
+		// Riattivare un webhook disattivato dopo un errore ne azzera l'errore
+		update["$unset"] = bson.M{"last_error": ""}
+	}
+	res, err := m.DB.Collection("chat_webhooks").UpdateOne(ctx, bson.M{"id": hook.ID, "restaurant_id": hook.RestaurantID}, update)
+	if err != nil {
+		return false, fmt.Errorf("errore update chat webhook: %v", err)
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// RecordChatWebhookResult registra l'esito dell'ultimo invio a un webhook: lastError vuoto
+// azzera l'errore, disable disattiva il webhook, che non riceve più notifiche
+func (m *MongoClient) RecordChatWebhookResult(ctx context.Context, id, lastError string, disable bool) error {
+	update := bson.M{"$unset": bson.M{"last_error": ""}}
+	if lastError != "" {
+		set := bson.M{"last_error": lastError}
+		if disable {
+			set["is_active"] = false
+			set["updated_at"] = time.Now()
+		}
+		update = bson.M{"$set": set}
+	}
+	if _, err := m.DB.Collection("chat_webhooks").UpdateOne(ctx, bson.M{"id": id}, update); err != nil {
+		return fmt.Errorf("errore update chat webhook: %v", err)
+	}
+	return nil
+}
+
+// DeleteChatWebhook elimina un webhook del ristorante. Restituisce false se non esiste
+func (m *MongoClient) DeleteChatWebhook(ctx context.Context, id, restaurantID string) (bool, error) {
+	res, err := m.DB.Collection("chat_webhooks").DeleteOne(ctx, bson.M{"id": id, "restaurant_id": restaurantID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete chat webhook: %v", err)
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// SaveMenuIntegration crea o sostituisce l'integrazione del ristorante con la piattaforma
+func (m *MongoClient) SaveMenuIntegration(ctx context.Context, integration *models.MenuIntegration) error {
+	_, err := m.DB.Collection("menu_integrations").ReplaceOne(ctx,
+		bson.M{"restaurant_id": integration.RestaurantID, "platform": integration.Platform},
+		integration, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("errore upsert menu integration: %v", err)
+	}
+	return nil
+}
+
+// GetMenuIntegrations restituisce le integrazioni del ristorante con le piattaforme di delivery
+func (m *MongoClient) GetMenuIntegrations(ctx context.Context, restaurantID string) ([]*models.MenuIntegration, error) {
+	integrations, _, err := findPage[models.MenuIntegration](ctx, m.DB.Collection("menu_integrations"),
+		bson.M{"restaurant_id": restaurantID}, ListOptions{}, "platform")
+	if err != nil {
+		return nil, fmt.Errorf("errore find menu integrations: %v", err)
+	}
+	return integrations, nil
+}
+
+// GetMenuIntegration restituisce l'integrazione del ristorante con la piattaforma, nil se non
+// esiste
+func (m *MongoClient) GetMenuIntegration(ctx context.Context, restaurantID, platform string) (*models.MenuIntegration, error) {
+	return m.findMenuIntegration(ctx, bson.M{"restaurant_id": restaurantID, "platform": platform})
+}
+
+// GetMenuIntegrationByID restituisce un'integrazione dal suo ID, nil se non esiste
+func (m *MongoClient) GetMenuIntegrationByID(ctx context.Context, id string) (*models.MenuIntegration, error) {
+	return m.findMenuIntegration(ctx, bson.M{"id": id})
+}
+
+func (m *MongoClient) findMenuIntegration(ctx context.Context, filter bson.M) (*models.MenuIntegration, error) {
+	var integration models.MenuIntegration
+	err := m.DB.Collection("menu_integrations").FindOne(ctx, filter).Decode(&integration)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find menu integration: %v", err)
+	}
+	return &integration, nil
+}
+
+// DeleteMenuIntegration elimina l'integrazione del ristorante con la piattaforma.
+// Restituisce false se non esiste
+func (m *MongoClient) DeleteMenuIntegration(ctx context.Context, restaurantID, platform string) (bool, error) {
+	res, err := m.DB.Collection("menu_integrations").DeleteOne(ctx, bson.M{"restaurant_id": restaurantID, "platform": platform})
+	if err != nil {
+		return false, fmt.Errorf("errore delete menu integration: %v", err)
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// ClaimDueMenuIntegration restituisce un'integrazione con la sincronizzazione automatica da
+// eseguire entro now, spostandone la prossima a next: le altre istanze non la sincronizzano
+// di nuovo. Restituisce nil se non ce ne sono
+func (m *MongoClient) ClaimDueMenuIntegration(ctx context.Context, now, next time.Time) (*models.MenuIntegration, error) {
+	var integration models.MenuIntegration
+	err := m.DB.Collection("menu_integrations").FindOneAndUpdate(ctx,
+		bson.M{"auto_sync": true, "next_sync_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"next_sync_at": next}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_sync_at", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&integration)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore claim menu integration: %v", err)
+	}
+	return &integration, nil
+}
+
+// RecordMenuIntegrationSync registra l'esito di una sincronizzazione; items conta solo per
+// quelle riuscite
+func (m *MongoClient) RecordMenuIntegrationSync(ctx context.Context, id, status, lastError string, items int, at time.Time) error {
+	set := bson.M{"last_sync_at": at, "last_status": status, "last_error": lastError}
+	if status == models.IntegrationSyncSuccess {
+		set["last_items"] = items
+	}
+	if _, err := m.DB.Collection("menu_integrations").UpdateOne(ctx, bson.M{"id": id}, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("errore update menu integration: %v", err)
+	}
+	return nil
+}
+
+// SetRestaurantWallet salva le impostazioni del pass Wallet del ristorante
+func (m *MongoClient) SetRestaurantWallet(ctx context.Context, restaurantID string, settings *models.WalletPassSettings) error {
+	if _, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurantID}, bson.M{"$set": bson.M{"wallet": settings}}); err != nil {
+		return fmt.Errorf("errore update restaurant wallet: %v", err)
+	}
+	return nil
+}
+
+// SaveWalletRegistration registra un dispositivo Apple per gli aggiornamenti di un pass, o ne
+// aggiorna il token push. Restituisce true se il dispositivo non era registrato
+func (m *MongoClient) SaveWalletRegistration(ctx context.Context, reg *models.WalletRegistration) (bool, error) {
+	res, err := m.DB.Collection("wallet_registrations").UpdateOne(ctx,
+		bson.M{"_id": reg.ID},
+		bson.M{
+			"$set": bson.M{"push_token": reg.PushToken, "updated_at": reg.UpdatedAt},
+			"$setOnInsert": bson.M{
+				"device_id":     reg.DeviceID,
+				"pass_type_id":  reg.PassTypeID,
+				"serial_number": reg.SerialNumber,
+				"restaurant_id": reg.RestaurantID,
+				"created_at":    reg.CreatedAt,
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return false, fmt.Errorf("errore upsert wallet registration: %v", err)
+	}
+	return res.UpsertedCount > 0, nil
+}
+
+// DeleteWalletRegistration elimina la registrazione di un dispositivo. Restituisce false se
+// non esisteva
+func (m *MongoClient) DeleteWalletRegistration(ctx context.Context, id string) (bool, error) {
+	res, err := m.DB.Collection("wallet_registrations").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, fmt.Errorf("errore delete wallet registration: %v", err)
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// DeleteWalletPushToken elimina le registrazioni con il token push di un dispositivo che ha
+// rimosso il pass
+func (m *MongoClient) DeleteWalletPushToken(ctx context.Context, pushToken string) error {
+	if _, err := m.DB.Collection("wallet_registrations").DeleteMany(ctx, bson.M{"push_token": pushToken}); err != nil {
+		return fmt.Errorf("errore delete wallet registrations: %v", err)
+	}
+	return nil
+}
+
+// GetWalletRegistrations restituisce i dispositivi registrati per i pass del ristorante
+func (m *MongoClient) GetWalletRegistrations(ctx context.Context, restaurantID string) ([]*models.WalletRegistration, error) {
+	regs, _, err := findPage[models.WalletRegistration](ctx, m.DB.Collection("wallet_registrations"),
+		bson.M{"restaurant_id": restaurantID}, ListOptions{}, "created_at")
+	if err != nil {
+		return nil, fmt.Errorf("errore find wallet registrations: %v", err)
+	}
+	return regs, nil
+}
+
+// GetDeviceWalletRegistrations restituisce le registrazioni di un dispositivo per il tipo di pass
+func (m *MongoClient) GetDeviceWalletRegistrations(ctx context.Context, deviceID, passTypeID string) ([]*models.WalletRegistration, error) {
+	regs, _, err := findPage[models.WalletRegistration](ctx, m.DB.Collection("wallet_registrations"),
+		bson.M{"device_id": deviceID, "pass_type_id": passTypeID}, ListOptions{}, "created_at")
+	if err != nil {
+		return nil, fmt.Errorf("errore find wallet registrations: %v", err)
+	}
+	return regs, nil
+}
+
+// CreateNFCTag salva un nuovo tag NFC. Restituisce ErrDuplicateNFCTagCode se il codice è già
+// usato
+func (m *MongoClient) CreateNFCTag(ctx context.Context, tag *models.NFCTag) error {
+	_, err := m.DB.Collection("nfc_tags").InsertOne(ctx, tag)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateNFCTagCode
+	}
+	if err != nil {
+		return fmt.Errorf("errore insert nfc tag: %v", err)
+	}
+	return nil
+}
+
+// GetNFCTags restituisce i tag NFC del ristorante, dal primo creato
+func (m *MongoClient) GetNFCTags(ctx context.Context, restaurantID string) ([]*models.NFCTag, error) {
+	tags, _, err := findPage[models.NFCTag](ctx, m.DB.Collection("nfc_tags"),
+		bson.M{"restaurant_id": restaurantID}, ListOptions{}, "created_at")
+	if err != nil {
+		return nil, fmt.Errorf("errore find nfc tags: %v", err)
+	}
+	return tags, nil
+}
+
+// GetNFCTag recupera un tag NFC del ristorante. Restituisce nil se non esiste
+func (m *MongoClient) GetNFCTag(ctx context.Context, id, restaurantID string) (*models.NFCTag, error) {
+	return m.findNFCTag(ctx, bson.M{"_id": id, "restaurant_id": restaurantID})
+}
+
+// GetNFCTagByCode recupera il tag NFC con il codice indicato. Restituisce nil se non esiste
+func (m *MongoClient) GetNFCTagByCode(ctx context.Context, code string) (*models.NFCTag, error) {
+	return m.findNFCTag(ctx, bson.M{"code": code})
+}
+
+func (m *MongoClient) findNFCTag(ctx context.Context, filter bson.M) (*models.NFCTag, error) {
+	var tag models.NFCTag
+	err := m.DB.Collection("nfc_tags").FindOne(ctx, filter).Decode(&tag)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find nfc tag: %v", err)
+	}
+	return &tag, nil
+}
+
+// UpdateNFCTag salva etichetta, menu e stato di un tag NFC
+func (m *MongoClient) UpdateNFCTag(ctx context.Context, tag *models.NFCTag) error {
+	_, err := m.DB.Collection("nfc_tags").UpdateOne(ctx,
+		bson.M{"_id": tag.ID, "restaurant_id": tag.RestaurantID},
+		bson.M{"$set": bson.M{"label": tag.Label, "menu_id": tag.MenuID, "active": tag.Active, "updated_at": tag.UpdatedAt}},
+	)
+	if err != nil {
+		return fmt.Errorf("errore update nfc tag: %v", err)
+	}
+	return nil
+}
+
+// DeleteNFCTag elimina un tag NFC del ristorante. Restituisce false se non esisteva
+func (m *MongoClient) DeleteNFCTag(ctx context.Context, id, restaurantID string) (bool, error) {
+	res, err := m.DB.Collection("nfc_tags").DeleteOne(ctx, bson.M{"_id": id, "restaurant_id": restaurantID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete nfc tag: %v", err)
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// RecordNFCTagScan conta un'apertura del menu dal tag NFC
+func (m *MongoClient) RecordNFCTagScan(ctx context.Context, id string, at time.Time) error {
+	_, err := m.DB.Collection("nfc_tags").UpdateOne(ctx, bson.M{"_id": id},
+		bson.M{"$inc": bson.M{"scans": 1}, "$set": bson.M{"last_scan_at": at}})
+	if err != nil {
+		return fmt.Errorf("errore update nfc tag: %v", err)
+	}
+	return nil
+}
+
+// CreateShortLink salva un nuovo link breve. Restituisce ErrDuplicateShortLinkCode se il codice
+// è già usato
+func (m *MongoClient) CreateShortLink(ctx context.Context, link *models.ShortLink) error {
+	_, err := m.DB.Collection("short_links").InsertOne(ctx, link)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateShortLinkCode
+	}
+	if err != nil {
+		return fmt.Errorf("errore insert short link: %v", err)
+	}
+	return nil
+}
+
+// GetShortLinks restituisce i link brevi del ristorante, dal primo creato. Con source o
+// campaign non vuoti restituisce solo quelli con l'origine o la campagna indicata
+func (m *MongoClient) GetShortLinks(ctx context.Context, restaurantID, source, campaign string) ([]*models.ShortLink, error) {
+	filter := bson.M{"restaurant_id": restaurantID}
+	if source != "" {
+		filter["source"] = source
+	}
+	if campaign != "" {
+		filter["campaign"] = campaign
+	}
+	links, _, err := findPage[models.ShortLink](ctx, m.DB.Collection("short_links"), filter, ListOptions{}, "created_at")
+	if err != nil {
+		return nil, fmt.Errorf("errore find short links: %v", err)
+	}
+	return links, nil
+}
+
+// CountShortLinks conta i link brevi del ristorante
+func (m *MongoClient) CountShortLinks(ctx context.Context, restaurantID string) (int64, error) {
+	count, err := m.DB.Collection("short_links").CountDocuments(ctx, bson.M{"restaurant_id": restaurantID})
+	if err != nil {
+		return 0, fmt.Errorf("errore count short links: %v", err)
+	}
+	return count, nil
+}
+
+// GetShortLink recupera un link breve del ristorante. Restituisce nil se non esiste
+func (m *MongoClient) GetShortLink(ctx context.Context, id, restaurantID string) (*models.ShortLink, error) {
+	return m.findShortLink(ctx, bson.M{"_id": id, "restaurant_id": restaurantID})
+}
+
+// GetShortLinkByCode recupera il link breve con il codice indicato. Restituisce nil se non esiste
+func (m *MongoClient) GetShortLinkByCode(ctx context.Context, code string) (*models.ShortLink, error) {
+	return m.findShortLink(ctx, bson.M{"code": code})
+}
+
+func (m *MongoClient) findShortLink(ctx context.Context, filter bson.M) (*models.ShortLink, error) {
+	var link models.ShortLink
+	err := m.DB.Collection("short_links").FindOne(ctx, filter).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find short link: %v", err)
+	}
+	return &link, nil
+}
+
+// UpdateShortLink salva origine, campagna, menu e stato di un link breve
+func (m *MongoClient) UpdateShortLink(ctx context.Context, link *models.ShortLink) error {
+	_, err := m.DB.Collection("short_links").UpdateOne(ctx,
+		bson.M{"_id": link.ID, "restaurant_id": link.RestaurantID},
+		bson.M{"$set": bson.M{"source": link.Source, "campaign": link.Campaign, "menu_id": link.MenuID, "active": link.Active, "updated_at": link.UpdatedAt}},
+	)
+	if err != nil {
+		return fmt.Errorf("errore update short link: %v", err)
+	}
+	return nil
+}
+
+// DeleteShortLink elimina un link breve del ristorante. Restituisce false se non esisteva
+func (m *MongoClient) DeleteShortLink(ctx context.Context, id, restaurantID string) (bool, error) {
+	res, err := m.DB.Collection("short_links").DeleteOne(ctx, bson.M{"_id": id, "restaurant_id": restaurantID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete short link: %v", err)
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// RecordShortLinkClick conta un'apertura del link breve
+func (m *MongoClient) RecordShortLinkClick(ctx context.Context, id string, at time.Time) error {
+	_, err := m.DB.Collection("short_links").UpdateOne(ctx, bson.M{"_id": id},
+		bson.M{"$inc": bson.M{"clicks": 1}, "$set": bson.M{"last_click_at": at}})
+	if err != nil {
+		return fmt.Errorf("errore update short link: %v", err)
+	}
+	return nil
+}
+
+// SetRestaurantFiscalInfo salva i dati fiscali del ristorante
+func (m *MongoClient) SetRestaurantFiscalInfo(ctx context.Context, restaurantID string, info *models.FiscalInfo) error {
+	if _, err := m.DB.Collection("restaurants").UpdateOne(ctx, bson.M{"_id": restaurantID}, bson.M{"$set": bson.M{"fiscal": info}}); err != nil {
+		return fmt.Errorf("errore update restaurant fiscal: %v", err)
+	}
+	return nil
+}
+
+// CreateVoucher salva un nuovo buono regalo. Restituisce ErrDuplicateVoucherCode se il codice
+// è già usato nel ristorante
+func (m *MongoClient) CreateVoucher(ctx context.Context, voucher *models.Voucher) error {
+	_, err := m.DB.Collection("vouchers").InsertOne(ctx, voucher)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateVoucherCode
+	}
+	if err != nil {
+		return fmt.Errorf("errore insert voucher: %v", err)
+	}
+	return nil
+}
+
+// GetVoucher recupera un buono del ristorante. Restituisce nil se non esiste
+func (m *MongoClient) GetVoucher(ctx context.Context, id, restaurantID string) (*models.Voucher, error) {
+	return m.findVoucher(ctx, bson.M{"_id": id, "restaurant_id": restaurantID})
+}
+
+// GetVoucherByCode recupera il buono del ristorante con il codice indicato. Restituisce nil se
+// non esiste
+func (m *MongoClient) GetVoucherByCode(ctx context.Context, restaurantID, code string) (*models.Voucher, error) {
+	return m.findVoucher(ctx, bson.M{"restaurant_id": restaurantID, "code": code})
+}
+
+// GetVoucherByCheckout recupera il buono acquistato con la sessione di pagamento indicata, che
+// fa da credenziale della pagina del buono. Restituisce nil se non esiste
+func (m *MongoClient) GetVoucherByCheckout(ctx context.Context, id, checkoutID string) (*models.Voucher, error) {
+	return m.findVoucher(ctx, bson.M{"_id": id, "checkout_id": checkoutID})
+}
+
+func (m *MongoClient) findVoucher(ctx context.Context, filter bson.M) (*models.Voucher, error) {
+	var voucher models.Voucher
+	err := m.DB.Collection("vouchers").FindOne(ctx, filter).Decode(&voucher)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find voucher: %v", err)
+	}
+	return &voucher, nil
+}
+
+// VoucherFilter seleziona i buoni regalo di un ristorante. I campi vuoti non filtrano
+type VoucherFilter struct {
+	RestaurantID string
+	Status       string
+	Code         string
+}
+
+func (f VoucherFilter) query() bson.M {
+	query := bson.M{"restaurant_id": f.RestaurantID}
+	if f.Status != "" {
+		query["status"] = f.Status
+	}
+	if f.Code != "" {
+		query["code"] = f.Code
+	}
+	return query
+}
+
+// FindVouchers recupera una pagina dei buoni regalo, dal più recente salvo diverso
+// ordinamento, e il numero totale di buoni
+func (m *MongoClient) FindVouchers(ctx context.Context, filter VoucherFilter, opts ListOptions) ([]*models.Voucher, int64, error) {
+	vouchers, total, err := findPage[models.Voucher](ctx, m.DB.Collection("vouchers"), filter.query(), opts, "-created_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore find vouchers: %v", err)
+	}
+	return vouchers, total, nil
+}
+
+// ActivateVoucher attiva il buono acquistato con la sessione di pagamento indicata e lo
+// restituisce aggiornato. Restituisce nil se il buono non è in attesa di quel pagamento, ad
+// esempio perché la conferma è già arrivata
+func (m *MongoClient) ActivateVoucher(ctx context.Context, id, checkoutID string, at time.Time) (*models.Voucher, error) {
+	var voucher models.Voucher
+	err := m.DB.Collection("vouchers").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "checkout_id": checkoutID, "status": models.VoucherPending},
+		bson.M{"$set": bson.M{"status": models.VoucherActive, "activated_at": at, "updated_at": at}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&voucher)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore activate voucher: %v", err)
+	}
+	return &voucher, nil
+}
+
+// AdjustVoucherBalance aggiunge (o, se negativi, toglie) centesimi al credito di un buono
+// attivo e lo restituisce aggiornato. Il credito si spende solo prima della scadenza e fino a
+// esaurimento: restituisce nil se il buono non è attivo, è scaduto o il credito non basta
+func (m *MongoClient) AdjustVoucherBalance(ctx context.Context, id string, cents int64, now time.Time) (*models.Voucher, error) {
+	filter := bson.M{"_id": id, "status": models.VoucherActive}
+	if cents < 0 {
+		filter["balance_cents"] = bson.M{"$gte": -cents}
+		filter["expires_at"] = bson.M{"$gt": now}
+	}
+
+	var voucher models.Voucher
+	err := m.DB.Collection("vouchers").FindOneAndUpdate(ctx, filter,
+		bson.M{"$inc": bson.M{"balance_cents": cents}, "$set": bson.M{"updated_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&voucher)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore update voucher balance: %v", err)
+	}
+	return &voucher, nil
+}
+
+// VoidVoucher annulla un buono del ristorante azzerandone il credito e lo restituisce com'era
+// prima dell'annullamento. Restituisce nil se il buono non esiste o è già annullato
+func (m *MongoClient) VoidVoucher(ctx context.Context, id, restaurantID string, now time.Time) (*models.Voucher, error) {
+	var voucher models.Voucher
+	err := m.DB.Collection("vouchers").FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "restaurant_id": restaurantID, "status": bson.M{"$ne": models.VoucherVoid}},
+		bson.M{"$set": bson.M{"status": models.VoucherVoid, "balance_cents": 0, "updated_at": now}},
+	).Decode(&voucher)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore void voucher: %v", err)
+	}
+	return &voucher, nil
+}
+
+// CreateVoucherTransaction registra un movimento del credito di un buono
+func (m *MongoClient) CreateVoucherTransaction(ctx context.Context, transaction *models.VoucherTransaction) error {
+	if _, err := m.DB.Collection("voucher_transactions").InsertOne(ctx, transaction); err != nil {
+		return fmt.Errorf("errore insert voucher transaction: %v", err)
+	}
+	return nil
+}
+
+// GetVoucherTransactions recupera i movimenti di un buono, dal più recente
+func (m *MongoClient) GetVoucherTransactions(ctx context.Context, voucherID, restaurantID string) ([]*models.VoucherTransaction, error) {
+	cursor, err := m.DB.Collection("voucher_transactions").Find(ctx,
+		bson.M{"voucher_id": voucherID, "restaurant_id": restaurantID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("errore find voucher transactions: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	transactions := []*models.VoucherTransaction{}
+	if err := cursor.All(ctx, &transactions); err != nil {
+		return nil, fmt.Errorf("errore decode voucher transactions: %v", err)
+	}
+	return transactions, nil
+}
+
+// ==================== STORICO MENU ====================
+
+// CreateMenuRevision salva una modifica nello storico di un menu
+func (m *MongoClient) CreateMenuRevision(ctx context.Context, revision *models.MenuRevision) error {
+	if _, err := m.DB.Collection("menu_revisions").InsertOne(ctx, revision); err != nil {
+		return fmt.Errorf("errore insert menu revision: %v", err)
+	}
+	return nil
+}
+
+// MenuRevisionFilter seleziona le modifiche di un menu. I campi vuoti non filtrano
+type MenuRevisionFilter struct {
+	MenuID string
+	UserID string
+}
+
+// FindMenuRevisions recupera una pagina dello storico di un menu, dalla modifica più
+// recente salvo diverso ordinamento, e il numero totale di modifiche
+func (m *MongoClient) FindMenuRevisions(ctx context.Context, filter MenuRevisionFilter, opts ListOptions) ([]*models.MenuRevision, int64, error) {
+	query := bson.M{"menu_id": filter.MenuID}
+	if filter.UserID != "" {
+		query["user_id"] = filter.UserID
+	}
+	revisions, total, err := findPage[models.MenuRevision](ctx, m.DB.Collection("menu_revisions"), query, opts, "-created_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore find menu revisions: %v", err)
+	}
+	return revisions, total, nil
+}
+
+// GetMenuRevision recupera una modifica dello storico del menu
+func (m *MongoClient) GetMenuRevision(ctx context.Context, id, menuID string) (*models.MenuRevision, error) {
+	var revision models.MenuRevision
+	err := m.DB.Collection("menu_revisions").FindOne(ctx, bson.M{"_id": id, "menu_id": menuID}).Decode(&revision)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find menu revision: %v", err)
+	}
+	return &revision, nil
+}
+
+// ==================== SESSIONS ====================
+
+// CreateSession salva una sessione
 func (m *MongoClient) CreateSession(ctx context.Context, session *models.Session) error {
 	coll := m.DB.Collection("sessions")
-	_, err := coll.InsertOne(ctx, session)
+	_, err := coll.InsertOne(ctx, session)
+	if err != nil {
+		return fmt.Errorf("errore insert session: %v", err)
+	}
+	return nil
+}
+
+// GetSessionByID recupera una sessione per ID
+func (m *MongoClient) GetSessionByID(ctx context.Context, id string) (*models.Session, error) {
+	coll := m.DB.Collection("sessions")
+	var session models.Session
+	err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find session: %v", err)
+	}
+	return &session, nil
+}
+
+// GetSessionsByRestaurantID recupera tutte le sessioni di un ristorante
+func (m *MongoClient) GetSessionsByRestaurantID(ctx context.Context, restaurantID string) ([]*models.Session, error) {
+	coll := m.DB.Collection("sessions")
+	cursor, err := coll.Find(ctx, bson.M{
+		"restaurant_id": restaurantID,
+		"last_accessed": bson.M{
+			"$gt": time.Now().Add(-24 * time.Hour),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("errore find sessions: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []*models.Session
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("errore decode sessions: %v", err)
+	}
+	return sessions, nil
+}
+
+// UpdateSession aggiorna una sessione
+func (m *MongoClient) UpdateSession(ctx context.Context, session *models.Session) error {
+	coll := m.DB.Collection("sessions")
+	result := coll.FindOneAndUpdate(ctx,
+		bson.M{"_id": session.ID},
+		bson.M{"$set": session},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	)
+	if result.Err() != nil && result.Err() != mongo.ErrNoDocuments {
+		return fmt.Errorf("errore update session: %v", result.Err())
+	}
+	return nil
+}
+
+// DeleteSession elimina una sessione
+func (m *MongoClient) DeleteSession(ctx context.Context, id string) error {
+	coll := m.DB.Collection("sessions")
+	_, err := coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("errore delete session: %v", err)
+	}
+	return nil
+}
+
+// DeleteExpiredSessions elimina le sessioni inattive da più di idleTimeout e restituisce
+// quante ne ha eliminate
+func (m *MongoClient) DeleteExpiredSessions(ctx context.Context, idleTimeout time.Duration) (int64, error) {
+	coll := m.DB.Collection("sessions")
+	result, err := coll.DeleteMany(ctx, bson.M{
+		"last_accessed": bson.M{
+			"$lt": time.Now().Add(-idleTimeout),
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("errore delete expired sessions: %v", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// Indici TTL delle sessioni: sessionTTLIndex sostituisce il vecchio indice a 7 giorni creato
+// senza nome, che ha le stesse chiavi e impedirebbe di crearlo
+const (
+	sessionTTLIndex       = "idx_session_ttl"
+	legacySessionTTLIndex = "last_accessed_1"
+)
+
+// EnsureSessionTTL allinea l'indice TTL delle sessioni al timeout di inattività, così MongoDB
+// elimina le sessioni scadute come DeleteExpiredSessions: rimuove il vecchio indice a 7 giorni,
+// crea l'indice se manca e ne aggiorna la scadenza con collMod se il timeout è cambiato
+func (m *MongoClient) EnsureSessionTTL(ctx context.Context, idleTimeout time.Duration) error {
+	coll := m.DB.Collection("sessions")
+	seconds := int32(idleTimeout / time.Second)
+
+	specs, err := coll.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return fmt.Errorf("errore list indici sessions: %v", err)
+	}
+	var current *mongo.IndexSpecification
+	for _, spec := range specs {
+		switch spec.Name {
+		case legacySessionTTLIndex:
+			if _, err := coll.Indexes().DropOne(ctx, legacySessionTTLIndex); err != nil {
+				return fmt.Errorf("errore drop indice %s: %v", legacySessionTTLIndex, err)
+			}
+		case sessionTTLIndex:
+			current = spec
+		}
+	}
+
+	if current == nil {
+		_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys:    bson.D{{Key: "last_accessed", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(seconds).SetName(sessionTTLIndex),
+		})
+		if err != nil {
+			return fmt.Errorf("errore creazione indice %s: %v", sessionTTLIndex, err)
+		}
+		return nil
+	}
+	if current.ExpireAfterSeconds != nil && *current.ExpireAfterSeconds == seconds {
+		return nil
+	}
+	err = m.DB.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: "sessions"},
+		{Key: "index", Value: bson.D{{Key: "name", Value: sessionTTLIndex}, {Key: "expireAfterSeconds", Value: seconds}}},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("errore aggiornamento indice %s: %v", sessionTTLIndex, err)
+	}
+	return nil
+}
+
+// GetSessionsByUserID recupera le sessioni di un utente usate negli ultimi idleTimeout,
+// dalla più recente
+func (m *MongoClient) GetSessionsByUserID(ctx context.Context, userID string, idleTimeout time.Duration) ([]*models.Session, error) {
+	coll := m.DB.Collection("sessions")
+	opts := options.Find().SetSort(bson.D{{Key: "last_accessed", Value: -1}})
+	cursor, err := coll.Find(ctx, bson.M{
+		"user_id": userID,
+		"last_accessed": bson.M{
+			"$gt": time.Now().Add(-idleTimeout),
+		},
+	}, opts)
 	if err != nil {
-		return fmt.Errorf("errore insert session: %v", err)
+		return nil, fmt.Errorf("errore find user sessions: %v", err)
 	}
-	return nil
+	defer cursor.Close(ctx)
+
+	var sessions []*models.Session
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("errore decode sessions: %v", err)
+	}
+	return sessions, nil
 }
 
-// GetSessionByID recupera una sessione per ID
-func (m *MongoClient) GetSessionByID(ctx context.Context, id string) (*models.Session, error) {
+// DeleteUserSession elimina una sessione solo se appartiene all'utente. Restituisce false
+// se la sessione non esiste
+func (m *MongoClient) DeleteUserSession(ctx context.Context, id, userID string) (bool, error) {
 	coll := m.DB.Collection("sessions")
-	var session models.Session
-	err := coll.FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	result, err := coll.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete session: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// DeleteOtherSessions elimina tutte le sessioni dell'utente tranne keepID (logout dagli
+// altri dispositivi) e restituisce quante ne ha eliminate
+func (m *MongoClient) DeleteOtherSessions(ctx context.Context, userID, keepID string) (int64, error) {
+	coll := m.DB.Collection("sessions")
+	result, err := coll.DeleteMany(ctx, bson.M{"user_id": userID, "_id": bson.M{"$ne": keepID}})
+	if err != nil {
+		return 0, fmt.Errorf("errore delete user sessions: %v", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// DeleteSessionsByUserID elimina tutte le sessioni di un utente
+func (m *MongoClient) DeleteSessionsByUserID(ctx context.Context, userID string) error {
+	coll := m.DB.Collection("sessions")
+	_, err := coll.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return fmt.Errorf("errore delete user sessions: %v", err)
+	}
+	return nil
+}
+
+// ==================== BILLING ====================
+
+// CreateSubscription salva un nuovo abbonamento
+func (m *MongoClient) CreateSubscription(ctx context.Context, sub *models.BillingSubscription) error {
+	if _, err := m.DB.Collection("billing_subscriptions").InsertOne(ctx, sub); err != nil {
+		return fmt.Errorf("errore insert subscription: %v", err)
+	}
+	return nil
+}
+
+// HasTrialSubscription indica se il ristorante ha già usato la prova gratuita
+func (m *MongoClient) HasTrialSubscription(ctx context.Context, restaurantID string) (bool, error) {
+	count, err := m.DB.Collection("billing_subscriptions").CountDocuments(ctx,
+		bson.M{"restaurant_id": restaurantID, "trial_ends_at": bson.M{"$exists": true}})
+	if err != nil {
+		return false, fmt.Errorf("errore count subscriptions: %v", err)
+	}
+	return count > 0, nil
+}
+
+// GetTrialsEndingBefore recupera gli abbonamenti in prova che scadono entro until
+func (m *MongoClient) GetTrialsEndingBefore(ctx context.Context, until time.Time) ([]*models.BillingSubscription, error) {
+	cursor, err := m.DB.Collection("billing_subscriptions").Find(ctx,
+		bson.M{"status": models.SubscriptionTrialing, "trial_ends_at": bson.M{"$lte": until}})
+	if err != nil {
+		return nil, fmt.Errorf("errore find trials: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subs []*models.BillingSubscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("errore decode trials: %v", err)
+	}
+	return subs, nil
+}
+
+// SetTrialReminderSent registra l'invio del promemoria di scadenza della prova
+func (m *MongoClient) SetTrialReminderSent(ctx context.Context, id string, at time.Time) error {
+	if _, err := m.DB.Collection("billing_subscriptions").UpdateOne(ctx,
+		bson.M{"id": id}, bson.M{"$set": bson.M{"trial_reminder_sent_at": at}}); err != nil {
+		return fmt.Errorf("errore update subscription: %v", err)
+	}
+	return nil
+}
+
+// EndTrial riporta al piano gratuito un abbonamento in prova. Restituisce false se la
+// prova era già terminata (es. convertita in abbonamento nel frattempo)
+func (m *MongoClient) EndTrial(ctx context.Context, id string, now time.Time) (bool, error) {
+	result, err := m.DB.Collection("billing_subscriptions").UpdateOne(ctx,
+		bson.M{"id": id, "status": models.SubscriptionTrialing},
+		bson.M{"$set": bson.M{"plan_id": models.FreePlanID, "status": models.SubscriptionActive, "updated_at": now}})
+	if err != nil {
+		return false, fmt.Errorf("errore update subscription: %v", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// ApplySubscriptionCoupon collega il coupon all'abbonamento e, se trialEndsAt non è nil,
+// sposta la fine della prova (il promemoria verrà inviato di nuovo)
+func (m *MongoClient) ApplySubscriptionCoupon(ctx context.Context, id, code string, trialEndsAt *time.Time) error {
+	set := bson.M{"coupon_code": code, "updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	if trialEndsAt != nil {
+		set["trial_ends_at"] = *trialEndsAt
+		set["current_period_end"] = *trialEndsAt
+		update["$unset"] = bson.M{"trial_reminder_sent_at": ""}
+	}
+	if _, err := m.DB.Collection("billing_subscriptions").UpdateOne(ctx, bson.M{"id": id}, update); err != nil {
+		return fmt.Errorf("errore update subscription: %v", err)
+	}
+	return nil
+}
+
+// CreateCoupon salva un nuovo coupon. Restituisce ErrDuplicateCouponCode se il codice è già usato
+func (m *MongoClient) CreateCoupon(ctx context.Context, coupon *models.Coupon) error {
+	_, err := m.DB.Collection("coupons").InsertOne(ctx, coupon)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicateCouponCode
+	}
+	if err != nil {
+		return fmt.Errorf("errore insert coupon: %v", err)
+	}
+	return nil
+}
+
+// GetCoupons recupera tutti i coupon, dal più recente
+func (m *MongoClient) GetCoupons(ctx context.Context) ([]*models.Coupon, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := m.DB.Collection("coupons").Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("errore find coupons: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var coupons []*models.Coupon
+	if err := cursor.All(ctx, &coupons); err != nil {
+		return nil, fmt.Errorf("errore decode coupons: %v", err)
+	}
+	return coupons, nil
+}
+
+// GetCouponByID recupera un coupon per ID
+func (m *MongoClient) GetCouponByID(ctx context.Context, id string) (*models.Coupon, error) {
+	return m.findCoupon(ctx, bson.M{"_id": id})
+}
+
+// GetCouponByCode recupera un coupon per codice (già in maiuscolo)
+func (m *MongoClient) GetCouponByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	return m.findCoupon(ctx, bson.M{"code": code})
+}
+
+func (m *MongoClient) findCoupon(ctx context.Context, filter bson.M) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := m.DB.Collection("coupons").FindOne(ctx, filter).Decode(&coupon)
 	if err == mongo.ErrNoDocuments {
 		return nil, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("errore find session: %v", err)
+		return nil, fmt.Errorf("errore find coupon: %v", err)
 	}
-	return &session, nil
+	return &coupon, nil
 }
 
-// GetSessionsByRestaurantID recupera tutte le sessioni di un ristorante
-func (m *MongoClient) GetSessionsByRestaurantID(ctx context.Context, restaurantID string) ([]*models.Session, error) {
-	coll := m.DB.Collection("sessions")
-	cursor, err := coll.Find(ctx, bson.M{
+// UpdateCoupon aggiorna le condizioni di un coupon senza toccare il numero di utilizzi.
+// Restituisce false se il coupon non esiste
+func (m *MongoClient) UpdateCoupon(ctx context.Context, coupon *models.Coupon) (bool, error) {
+	result, err := m.DB.Collection("coupons").UpdateOne(ctx, bson.M{"_id": coupon.ID}, bson.M{"$set": bson.M{
+		"code":             coupon.Code,
+		"description":      coupon.Description,
+		"percent_off":      coupon.PercentOff,
+		"amount_off_cents": coupon.AmountOffCents,
+		"currency":         coupon.Currency,
+		"trial_days":       coupon.TrialDays,
+		"plan_ids":         coupon.PlanIDs,
+		"max_redemptions":  coupon.MaxRedemptions,
+		"expires_at":       coupon.ExpiresAt,
+		"is_active":        coupon.IsActive,
+		"updated_at":       coupon.UpdatedAt,
+	}})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, ErrDuplicateCouponCode
+	}
+	if err != nil {
+		return false, fmt.Errorf("errore update coupon: %v", err)
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// DeleteCoupon elimina un coupon. Restituisce false se non esiste
+func (m *MongoClient) DeleteCoupon(ctx context.Context, id string) (bool, error) {
+	result, err := m.DB.Collection("coupons").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return false, fmt.Errorf("errore delete coupon: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// RedeemCoupon conta un utilizzo del coupon se è attivo, non scaduto e non esaurito.
+// Il controllo e l'incremento sono atomici: restituisce false se il coupon non è più utilizzabile
+func (m *MongoClient) RedeemCoupon(ctx context.Context, id string, now time.Time) (bool, error) {
+	result, err := m.DB.Collection("coupons").UpdateOne(ctx,
+		bson.M{
+			"_id":       id,
+			"is_active": true,
+			"$and": bson.A{
+				bson.M{"$or": bson.A{
+					bson.M{"expires_at": nil},
+					bson.M{"expires_at": bson.M{"$gt": now}},
+				}},
+				bson.M{"$or": bson.A{
+					bson.M{"max_redemptions": 0},
+					bson.M{"$expr": bson.M{"$lt": bson.A{"$redemptions", "$max_redemptions"}}},
+				}},
+			},
+		},
+		bson.M{"$inc": bson.M{"redemptions": 1}, "$set": bson.M{"updated_at": now}})
+	if err != nil {
+		return false, fmt.Errorf("errore redeem coupon: %v", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// ==================== BILLING USAGE ====================
+
+// IncrementUsage aggiunge i contatori (metrica -> quantità) all'utilizzo del ristorante
+// nel periodo, creando il documento se non esiste
+func (m *MongoClient) IncrementUsage(ctx context.Context, restaurantID, period string, counts map[string]int64) error {
+	inc := bson.M{}
+	for metric, n := range counts {
+		inc[metric] = n
+	}
+	_, err := m.DB.Collection("billing_usage").UpdateOne(ctx,
+		bson.M{"_id": models.UsageID(restaurantID, period)},
+		bson.M{
+			"$inc":         inc,
+			"$set":         bson.M{"updated_at": time.Now()},
+			"$setOnInsert": bson.M{"restaurant_id": restaurantID, "period": period},
+		},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("errore upsert billing usage: %v", err)
+	}
+	return nil
+}
+
+// GetUsage recupera l'utilizzo di un ristorante in un periodo
+func (m *MongoClient) GetUsage(ctx context.Context, restaurantID, period string) (*models.BillingUsage, error) {
+	var usage models.BillingUsage
+	err := m.DB.Collection("billing_usage").FindOne(ctx, bson.M{"_id": models.UsageID(restaurantID, period)}).Decode(&usage)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find billing usage: %v", err)
+	}
+	return &usage, nil
+}
+
+// GetUsageByPeriod recupera l'utilizzo di tutti i ristoranti in un periodo
+func (m *MongoClient) GetUsageByPeriod(ctx context.Context, period string) ([]*models.BillingUsage, error) {
+	cursor, err := m.DB.Collection("billing_usage").Find(ctx, bson.M{"period": period})
+	if err != nil {
+		return nil, fmt.Errorf("errore find billing usage: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var usage []*models.BillingUsage
+	if err := cursor.All(ctx, &usage); err != nil {
+		return nil, fmt.Errorf("errore decode billing usage: %v", err)
+	}
+	return usage, nil
+}
+
+// SetUsageReported registra l'eccedenza già inviata al provider di billing. Il valore
+// non torna mai indietro, così un report concorrente più vecchio non lo sovrascrive
+func (m *MongoClient) SetUsageReported(ctx context.Context, restaurantID, period string, overage int64, at time.Time) error {
+	if _, err := m.DB.Collection("billing_usage").UpdateOne(ctx,
+		bson.M{"_id": models.UsageID(restaurantID, period), "reported_overage": bson.M{"$lt": overage}},
+		bson.M{"$set": bson.M{"reported_overage": overage, "reported_at": at}}); err != nil {
+		return fmt.Errorf("errore update billing usage: %v", err)
+	}
+	return nil
+}
+
+// GetActiveSubscription recupera l'abbonamento non cancellato più recente di un ristorante
+func (m *MongoClient) GetActiveSubscription(ctx context.Context, restaurantID string) (*models.BillingSubscription, error) {
+	var sub models.BillingSubscription
+	opts := options.FindOne().SetSort(bson.D{{Key: "updated_at", Value: -1}})
+	err := m.DB.Collection("billing_subscriptions").FindOne(ctx,
+		bson.M{"restaurant_id": restaurantID, "status": bson.M{"$ne": "canceled"}}, opts).Decode(&sub)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find subscription: %v", err)
+	}
+	return &sub, nil
+}
+
+// GetOpenSubscriptions recupera gli abbonamenti non cancellati dei ristoranti indicati
+func (m *MongoClient) GetOpenSubscriptions(ctx context.Context, restaurantIDs []string) ([]*models.BillingSubscription, error) {
+	if len(restaurantIDs) == 0 {
+		return nil, nil
+	}
+	cursor, err := m.DB.Collection("billing_subscriptions").Find(ctx, bson.M{
+		"restaurant_id": bson.M{"$in": restaurantIDs},
+		"status":        bson.M{"$ne": models.SubscriptionCanceled},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("errore find subscriptions: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var subs []*models.BillingSubscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return nil, fmt.Errorf("errore decode subscriptions: %v", err)
+	}
+	return subs, nil
+}
+
+// SetSubscriptionCanceled segna come cancellato un abbonamento già disdetto presso il provider
+func (m *MongoClient) SetSubscriptionCanceled(ctx context.Context, id string, at time.Time) error {
+	if _, err := m.DB.Collection("billing_subscriptions").UpdateOne(ctx,
+		bson.M{"id": id},
+		bson.M{"$set": bson.M{"status": models.SubscriptionCanceled, "updated_at": at}}); err != nil {
+		return fmt.Errorf("errore cancel subscription: %v", err)
+	}
+	return nil
+}
+
+// ==================== WEBHOOKS ====================
+
+// CreateWebhookEndpoint salva un nuovo endpoint webhook
+func (m *MongoClient) CreateWebhookEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	if _, err := m.DB.Collection("webhook_endpoints").InsertOne(ctx, endpoint); err != nil {
+		return fmt.Errorf("errore insert webhook: %v", err)
+	}
+	return nil
+}
+
+// GetWebhookEndpointsByRestaurant recupera gli endpoint webhook di un ristorante, dal più recente
+func (m *MongoClient) GetWebhookEndpointsByRestaurant(ctx context.Context, restaurantID string) ([]*models.WebhookEndpoint, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	return m.findWebhookEndpoints(ctx, bson.M{"restaurant_id": restaurantID}, opts)
+}
+
+// GetWebhookEndpointsForEvent recupera gli endpoint attivi del ristorante iscritti all'evento
+func (m *MongoClient) GetWebhookEndpointsForEvent(ctx context.Context, restaurantID, eventType string) ([]*models.WebhookEndpoint, error) {
+	return m.findWebhookEndpoints(ctx, bson.M{
 		"restaurant_id": restaurantID,
-		"last_accessed": bson.M{
-			"$gt": time.Now().Add(-24 * time.Hour),
+		"is_active":     true,
+		"events":        bson.M{"$in": bson.A{eventType, "*"}},
+	})
+}
+
+func (m *MongoClient) findWebhookEndpoints(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]*models.WebhookEndpoint, error) {
+	cursor, err := m.DB.Collection("webhook_endpoints").Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("errore find webhooks: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var endpoints []*models.WebhookEndpoint
+	if err := cursor.All(ctx, &endpoints); err != nil {
+		return nil, fmt.Errorf("errore decode webhooks: %v", err)
+	}
+	return endpoints, nil
+}
+
+// GetWebhookEndpoint recupera un endpoint webhook; con restaurantID non vuoto solo se
+// appartiene a quel ristorante
+func (m *MongoClient) GetWebhookEndpoint(ctx context.Context, id, restaurantID string) (*models.WebhookEndpoint, error) {
+	filter := bson.M{"id": id}
+	if restaurantID != "" {
+		filter["restaurant_id"] = restaurantID
+	}
+	var endpoint models.WebhookEndpoint
+	err := m.DB.Collection("webhook_endpoints").FindOne(ctx, filter).Decode(&endpoint)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore find webhook: %v", err)
+	}
+	return &endpoint, nil
+}
+
+// DeleteWebhookEndpoint elimina un endpoint del ristorante. Restituisce false se non esiste
+func (m *MongoClient) DeleteWebhookEndpoint(ctx context.Context, id, restaurantID string) (bool, error) {
+	result, err := m.DB.Collection("webhook_endpoints").DeleteOne(ctx, bson.M{"id": id, "restaurant_id": restaurantID})
+	if err != nil {
+		return false, fmt.Errorf("errore delete webhook: %v", err)
+	}
+	return result.DeletedCount > 0, nil
+}
+
+// RecordWebhookSuccess chiude il circuito dell'endpoint dopo una consegna riuscita
+func (m *MongoClient) RecordWebhookSuccess(ctx context.Context, id string) error {
+	if _, err := m.DB.Collection("webhook_endpoints").UpdateOne(ctx,
+		bson.M{"id": id, "consecutive_failures": bson.M{"$gt": 0}},
+		bson.M{"$set": bson.M{"consecutive_failures": 0}, "$unset": bson.M{"circuit_open_until": ""}}); err != nil {
+		return fmt.Errorf("errore update webhook: %v", err)
+	}
+	return nil
+}
+
+// RecordWebhookFailure conta un fallimento consecutivo dell'endpoint e restituisce il totale
+func (m *MongoClient) RecordWebhookFailure(ctx context.Context, id string) (int, error) {
+	var endpoint models.WebhookEndpoint
+	err := m.DB.Collection("webhook_endpoints").FindOneAndUpdate(ctx,
+		bson.M{"id": id}, bson.M{"$inc": bson.M{"consecutive_failures": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&endpoint)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("errore update webhook: %v", err)
+	}
+	return endpoint.ConsecutiveFailures, nil
+}
+
+// OpenWebhookCircuit sospende le consegne all'endpoint fino a until
+func (m *MongoClient) OpenWebhookCircuit(ctx context.Context, id string, until time.Time) error {
+	if _, err := m.DB.Collection("webhook_endpoints").UpdateOne(ctx,
+		bson.M{"id": id}, bson.M{"$set": bson.M{"circuit_open_until": until}}); err != nil {
+		return fmt.Errorf("errore update webhook: %v", err)
+	}
+	return nil
+}
+
+// CreateWebhookDeliveries accoda le consegne di un evento
+func (m *MongoClient) CreateWebhookDeliveries(ctx context.Context, deliveries []*models.WebhookDelivery) error {
+	docs := make([]interface{}, len(deliveries))
+	for i, d := range deliveries {
+		docs[i] = d
+	}
+	if _, err := m.DB.Collection("webhook_deliveries").InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("errore insert webhook deliveries: %v", err)
+	}
+	return nil
+}
+
+// ClaimDueWebhookDelivery prende in carico per lease una consegna da inviare, così con più
+// istanze ogni consegna è inviata da una sola. Restituisce nil se non ce ne sono
+func (m *MongoClient) ClaimDueWebhookDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := m.DB.Collection("webhook_deliveries").FindOneAndUpdate(ctx,
+		bson.M{
+			"status":        bson.M{"$in": bson.A{models.WebhookDeliveryPending, models.WebhookDeliveryRetrying}},
+			"next_retry_at": bson.M{"$lte": now},
+			"$or": bson.A{
+				bson.M{"locked_until": bson.M{"$exists": false}},
+				bson.M{"locked_until": bson.M{"$lt": now}},
+			},
+		},
+		bson.M{"$set": bson.M{"locked_until": now.Add(lease)}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_retry_at", Value: 1}}).
+			SetReturnDocument(options.After)).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("errore claim webhook delivery: %v", err)
+	}
+	return &delivery, nil
+}
+
+// UpdateWebhookDelivery salva l'esito di un tentativo e rilascia il lease
+func (m *MongoClient) UpdateWebhookDelivery(ctx context.Context, d *models.WebhookDelivery) error {
+	set := bson.M{
+		"status":          d.Status,
+		"attempt":         d.Attempt,
+		"response_status": d.ResponseStatus,
+		"last_error":      d.LastError,
+		"next_retry_at":   d.NextRetryAt,
+		"updated_at":      d.UpdatedAt,
+	}
+	if d.DeliveredAt != nil {
+		set["delivered_at"] = *d.DeliveredAt
+	}
+	if _, err := m.DB.Collection("webhook_deliveries").UpdateOne(ctx,
+		bson.M{"id": d.ID}, bson.M{"$set": set, "$unset": bson.M{"locked_until": ""}}); err != nil {
+		return fmt.Errorf("errore update webhook delivery: %v", err)
+	}
+	return nil
+}
+
+// WebhookDeliveryFilter seleziona le consegne webhook di un ristorante. I campi vuoti non filtrano
+type WebhookDeliveryFilter struct {
+	RestaurantID string
+	WebhookID    string
+	Status       string
+	EventType    string
+}
+
+// FindWebhookDeliveries recupera una pagina delle consegne del ristorante, dalla più recente
+// salvo diverso ordinamento, e il loro numero totale
+func (m *MongoClient) FindWebhookDeliveries(ctx context.Context, filter WebhookDeliveryFilter, opts ListOptions) ([]*models.WebhookDelivery, int64, error) {
+	query := bson.M{"restaurant_id": filter.RestaurantID}
+	if filter.WebhookID != "" {
+		query["webhook_id"] = filter.WebhookID
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.EventType != "" {
+		query["event_type"] = filter.EventType
+	}
+	deliveries, total, err := findPage[models.WebhookDelivery](ctx, m.DB.Collection("webhook_deliveries"), query, opts, "-created_at")
+	if err != nil {
+		return nil, 0, fmt.Errorf("errore find webhook deliveries: %v", err)
+	}
+	return deliveries, total, nil
+}
+
+// RequeueWebhookDelivery rimette in coda una consegna conclusa (riuscita o nella dead-letter
+// list) del ristorante, con i tentativi azzerati. Restituisce false se non esiste o è ancora in corso
+func (m *MongoClient) RequeueWebhookDelivery(ctx context.Context, id, restaurantID string, now time.Time) (bool, error) {
+	result, err := m.DB.Collection("webhook_deliveries").UpdateOne(ctx,
+		bson.M{
+			"id":            id,
+			"restaurant_id": restaurantID,
+			"status":        bson.M{"$in": bson.A{models.WebhookDeliverySuccess, models.WebhookDeliveryDead}},
 		},
+		bson.M{
+			"$set":   bson.M{"status": models.WebhookDeliveryPending, "attempt": 0, "next_retry_at": now, "updated_at": now},
+			"$unset": bson.M{"last_error": "", "response_status": "", "delivered_at": ""},
+		})
+	if err != nil {
+		return false, fmt.Errorf("errore requeue webhook delivery: %v", err)
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// ==================== ACCOUNT DELETIONS ====================
+
+// ScheduleAccountDeletion disattiva l'account e i suoi ristoranti, segna come cancellati gli
+// abbonamenti, chiude le sessioni e registra la cancellazione definitiva per
+// deletion.ScheduledAt. Gli abbonamenti del provider di billing vanno disdetti prima
+// (handlers.cancelProviderSubscriptions): qui cambia solo lo stato salvato
+func (m *MongoClient) ScheduleAccountDeletion(ctx context.Context, deletion *models.AccountDeletion) error {
+	_, err := m.DB.Collection("account_deletions").ReplaceOne(ctx,
+		bson.M{"_id": deletion.ID}, deletion, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("errore insert account deletion: %v", err)
+	}
+
+	if _, err := m.DB.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": deletion.ID}, bson.M{"$set": bson.M{"is_active": false}}); err != nil {
+		return fmt.Errorf("errore disable user: %v", err)
+	}
+
+	if len(deletion.RestaurantIDs) > 0 {
+		restaurantFilter := bson.M{"_id": bson.M{"$in": deletion.RestaurantIDs}}
+		if _, err := m.DB.Collection("restaurants").UpdateMany(ctx,
+			restaurantFilter, bson.M{"$set": bson.M{"is_active": false}}); err != nil {
+			return fmt.Errorf("errore disable restaurants: %v", err)
+		}
+
+		if _, err := m.DB.Collection("billing_subscriptions").UpdateMany(ctx,
+			bson.M{"restaurant_id": bson.M{"$in": deletion.RestaurantIDs}, "status": bson.M{"$ne": "canceled"}},
+			bson.M{"$set": bson.M{"status": "canceled", "updated_at": time.Now()}}); err != nil {
+			return fmt.Errorf("errore cancel subscriptions: %v", err)
+		}
+	}
+
+	return m.DeleteSessionsByUserID(ctx, deletion.ID)
+}
+
+// GetDueAccountDeletions restituisce le cancellazioni programmate già scadute
+func (m *MongoClient) GetDueAccountDeletions(ctx context.Context, now time.Time) ([]*models.AccountDeletion, error) {
+	coll := m.DB.Collection("account_deletions")
+	cursor, err := coll.Find(ctx, bson.M{
+		"status":       models.AccountDeletionScheduled,
+		"scheduled_at": bson.M{"$lte": now},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("errore find sessions: %v", err)
+		return nil, fmt.Errorf("errore find account deletions: %v", err)
 	}
 	defer cursor.Close(ctx)
 
-	var sessions []*models.Session
-	if err = cursor.All(ctx, &sessions); err != nil {
-		return nil, fmt.Errorf("errore decode sessions: %v", err)
+	var deletions []*models.AccountDeletion
+	if err = cursor.All(ctx, &deletions); err != nil {
+		return nil, fmt.Errorf("errore decode account deletions: %v", err)
 	}
-	return sessions, nil
+	return deletions, nil
 }
 
-// UpdateSession aggiorna una sessione
-func (m *MongoClient) UpdateSession(ctx context.Context, session *models.Session) error {
-	coll := m.DB.Collection("sessions")
-	result := coll.FindOneAndUpdate(ctx,
-		bson.M{"_id": session.ID},
-		bson.M{"$set": session},
-		options.FindOneAndUpdate().SetReturnDocument(options.After),
-	)
-	if result.Err() != nil && result.Err() != mongo.ErrNoDocuments {
-		return fmt.Errorf("errore update session: %v", result.Err())
+// RevokeAccountCredentials revoca tutte le credenziali dell'account: refresh token, API key,
+// sessioni e dispositivi registrati per le notifiche. È il primo passo della cancellazione
+// definitiva, così nessun client può più accedere mentre i dati vengono eliminati
+func (m *MongoClient) RevokeAccountCredentials(ctx context.Context, deletion *models.AccountDeletion, revokedAt time.Time) error {
+	if len(deletion.RestaurantIDs) > 0 {
+		restaurantFilter := bson.M{"restaurant_id": bson.M{"$in": deletion.RestaurantIDs}}
+		if _, err := m.DB.Collection("refresh_tokens").UpdateMany(ctx,
+			bson.M{"restaurant_id": bson.M{"$in": deletion.RestaurantIDs}, "revoked_at": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"revoked_at": revokedAt}}); err != nil {
+			return fmt.Errorf("errore update refresh tokens: %v", err)
+		}
+		if _, err := m.DB.Collection("api_keys").DeleteMany(ctx, restaurantFilter); err != nil {
+			return fmt.Errorf("errore delete api keys: %v", err)
+		}
+	}
+	for _, coll := range []string{"push_tokens", "webpush_subscriptions"} {
+		if _, err := m.DB.Collection(coll).DeleteMany(ctx, bson.M{"user_id": deletion.ID}); err != nil {
+			return fmt.Errorf("errore delete %s: %v", coll, err)
+		}
 	}
-	return nil
+	return m.DeleteSessionsByUserID(ctx, deletion.ID)
 }
 
-// DeleteSession elimina una sessione
-func (m *MongoClient) DeleteSession(ctx context.Context, id string) error {
-	coll := m.DB.Collection("sessions")
-	_, err := coll.DeleteOne(ctx, bson.M{"_id": id})
+// PurgeAccount elimina definitivamente utente, ristoranti, menu e dati collegati.
+// Il record di cancellazione resta (senza email) come prova dell'avvenuta cancellazione
+func (m *MongoClient) PurgeAccount(ctx context.Context, deletion *models.AccountDeletion) error {
+	if len(deletion.RestaurantIDs) > 0 {
+		if _, err := m.DB.Collection("menus").DeleteMany(ctx,
+			bson.M{"restaurant_id": bson.M{"$in": deletion.RestaurantIDs}}); err != nil {
+			return fmt.Errorf("errore delete menus: %v", err)
+		}
+		if _, err := m.DB.Collection("restaurants").DeleteMany(ctx,
+			bson.M{"_id": bson.M{"$in": deletion.RestaurantIDs}}); err != nil {
+			return fmt.Errorf("errore delete restaurants: %v", err)
+		}
+		for _, coll := range []string{"restaurant_members", "staff_invitations", "api_keys", "refresh_tokens", "billing_usage", "webhook_endpoints", "webhook_deliveries", "menu_revisions", "daily_specials", "menu_templates", "stock_adjustments", "orders", "order_counters", "slot_bookings", "feedback", "promotions", "loyalty_visits", "loyalty_cards", "loyalty_transactions", "vouchers", "voucher_transactions", "whatsapp_subscribers", "telegram_chats", "telegram_link_codes", "chat_webhooks", "menu_integrations", "wallet_registrations", "nfc_tags", "short_links"} {
+			if _, err := m.DB.Collection(coll).DeleteMany(ctx,
+				bson.M{"restaurant_id": bson.M{"$in": deletion.RestaurantIDs}}); err != nil {
+				return fmt.Errorf("errore delete %s: %v", coll, err)
+			}
+		}
+	}
+
+	if err := m.DeleteSessionsByUserID(ctx, deletion.ID); err != nil {
+		return err
+	}
+	if _, err := m.DB.Collection("email_verifications").DeleteMany(ctx, bson.M{"user_id": deletion.ID}); err != nil {
+		return fmt.Errorf("errore delete email verifications: %v", err)
+	}
+	if _, err := m.DB.Collection("password_resets").DeleteMany(ctx, bson.M{"user_id": deletion.ID}); err != nil {
+		return fmt.Errorf("errore delete password resets: %v", err)
+	}
+	for _, coll := range []string{"push_tokens", "webpush_subscriptions", "notification_history", "notification_queue", "restaurant_members"} {
+		if _, err := m.DB.Collection(coll).DeleteMany(ctx, bson.M{"user_id": deletion.ID}); err != nil {
+			return fmt.Errorf("errore delete %s: %v", coll, err)
+		}
+	}
+	orgs, err := m.GetOrganizationsByOwnerID(ctx, deletion.ID)
 	if err != nil {
-		return fmt.Errorf("errore delete session: %v", err)
+		return err
+	}
+	for _, org := range orgs {
+		if err := m.DeleteOrganization(ctx, org.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := m.DB.Collection("users").DeleteOne(ctx, bson.M{"_id": deletion.ID}); err != nil {
+		return fmt.Errorf("errore delete user: %v", err)
 	}
-	return nil
-}
 
-// DeleteExpiredSessions elimina sessioni scadute (>24h)
-func (m *MongoClient) DeleteExpiredSessions(ctx context.Context) error {
-	coll := m.DB.Collection("sessions")
-	_, err := coll.DeleteMany(ctx, bson.M{
-		"last_accessed": bson.M{
-			"$lt": time.Now().Add(-24 * time.Hour),
-		},
-	})
+	_, err = m.DB.Collection("account_deletions").UpdateOne(ctx,
+		bson.M{"_id": deletion.ID},
+		bson.M{
+			"$set":   bson.M{"status": models.AccountDeletionCompleted, "completed_at": time.Now()},
+			"$unset": bson.M{"email": "", "reason": ""},
+		})
 	if err != nil {
-		return fmt.Errorf("errore delete expired sessions: %v", err)
+		return fmt.Errorf("errore update account deletion: %v", err)
 	}
 	return nil
 }
@@ -520,6 +4406,9 @@ func (m *MongoClient) createIndexes() error {
 		{
 			Keys: bson.D{{Key: "created_at", Value: -1}},
 		},
+		{
+			Keys: bson.D{{Key: "deleted_at", Value: 1}},
+		},
 	}
 	if _, err := menuColl.Indexes().CreateMany(ctx, menuIndexModel); err != nil {
 		return fmt.Errorf("errore creazione indici menus: %v", err)
@@ -537,10 +4426,6 @@ func (m *MongoClient) createIndexes() error {
 		{
 			Keys: bson.D{{Key: "last_accessed", Value: -1}},
 		},
-		{
-			Keys:    bson.D{{Key: "last_accessed", Value: 1}},
-			Options: options.Index().SetExpireAfterSeconds(604800), // 7 giorni
-		},
 	}
 	if _, err := sessionColl.Indexes().CreateMany(ctx, sessionIndexModel); err != nil {
 		return fmt.Errorf("errore creazione indici sessions: %v", err)
@@ -581,6 +4466,13 @@ func (m *MongoClient) createIndexes() error {
 		{
 			Keys: bson.D{{Key: "user_id", Value: 1}},
 		},
+		{
+			Keys: bson.D{{Key: "restaurant_id", Value: 1}, {Key: "menu_id", Value: 1}, {Key: "timestamp", Value: -1}},
+		},
+		{
+			// Retention: eliminazione degli eventi più vecchi su tutti i ristoranti
+			Keys: bson.D{{Key: "timestamp", Value: 1}},
+		},
 	}
 	if _, err := analyticsColl.Indexes().CreateMany(ctx, analyticsIndexModel); err != nil {
 		return fmt.Errorf("errore creazione indici analytics_events: %v", err)
@@ -590,6 +4482,18 @@ func (m *MongoClient) createIndexes() error {
 	
 	// Indici per users (nuovo)
 	usersColl := m.DB.Collection("users")
+
+	// Popola i campi normalizzati per gli utenti creati prima dell'introduzione degli indici case-insensitive
+	if _, err := usersColl.UpdateMany(ctx,
+		bson.M{"username_normalized": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"username_normalized": bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$username"}}},
+			"email_normalized":    bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$email"}}},
+		}}}},
+	); err != nil {
+		log.Printf("⚠️ Attenzione: errore normalizzazione credenziali utenti: %v", err)
+	}
+
 	usersIndexModel := []mongo.IndexModel{
 		{
 			Keys:    bson.D{{Key: "username", Value: 1}},
@@ -599,6 +4503,14 @@ func (m *MongoClient) createIndexes() error {
 			Keys:    bson.D{{Key: "email", Value: 1}},
 			Options: options.Index().SetUnique(true).SetName("idx_email"),
 		},
+		{
+			Keys:    bson.D{{Key: "username_normalized", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_username_normalized"),
+		},
+		{
+			Keys:    bson.D{{Key: "email_normalized", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_email_normalized"),
+		},
 		{
 			Keys:    bson.D{{Key: "is_active", Value: 1}, {Key: "last_login", Value: -1}},
 			Options: options.Index().SetName("idx_active_login"),
@@ -607,6 +4519,12 @@ func (m *MongoClient) createIndexes() error {
 			Keys:    bson.D{{Key: "created_at", Value: -1}},
 			Options: options.Index().SetName("idx_created_at"),
 		},
+		{
+			// Un account Google o Apple può essere collegato a un solo utente
+			Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_user_identity").
+				SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}}),
+		},
 	}
 	if _, err := usersColl.Indexes().CreateMany(ctx, usersIndexModel); err != nil {
 		return fmt.Errorf("errore creazione indici users: %v", err)
@@ -623,13 +4541,47 @@ func (m *MongoClient) createIndexes() error {
 			Keys:    bson.D{{Key: "owner_id", Value: 1}, {Key: "created_at", Value: -1}},
 			Options: options.Index().SetName("idx_owner_created"),
 		},
+		{
+			Keys:    bson.D{{Key: "previous_usernames", Value: 1}},
+			Options: options.Index().SetName("idx_previous_usernames"),
+		},
+		{
+			// Username pubblico univoco senza distinzione maiuscole/minuscole (collation strength 2)
+			Keys: bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetName("idx_restaurant_username_ci").
+				SetCollation(&options.Collation{Locale: "en", Strength: 2}).
+				SetPartialFilterExpression(bson.M{"username": bson.M{"$type": "string", "$gt": ""}}),
+		},
+		{
+			Keys: bson.D{{Key: "vanity_slug", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetName("idx_restaurant_vanity_slug").
+				SetPartialFilterExpression(bson.M{"vanity_slug": bson.M{"$type": "string"}}),
+		},
+		{
+			// Solo i domini verificati sono univoci: un dominio non verificato non può essere "prenotato"
+			Keys: bson.D{{Key: "custom_domain", Value: 1}},
+			Options: options.Index().
+				SetUnique(true).
+				SetName("idx_restaurant_custom_domain").
+				SetPartialFilterExpression(bson.M{"domain_verified": true}),
+		},
+		{
+			// Webhook WhatsApp: il ristorante è riconosciuto dal numero che riceve il messaggio
+			Keys:    bson.D{{Key: "whatsapp.phone_number_id", Value: 1}},
+			Options: options.Index().SetSparse(true).SetName("idx_restaurant_whatsapp_number"),
+		},
 	}
 	if _, err := restaurantsColl.Indexes().CreateMany(ctx, restaurantsNewIndexModel); err != nil {
 		// Non è fatale se esistono già
 		log.Printf("⚠️ Attenzione: alcuni indici restaurants potrebbero esistere già: %v", err)
 	}
 	
-	// Indici per sessions (user_id + TTL)
+	// Indici per sessions (user_id); l'indice TTL è creato da EnsureSessionTTL con il timeout
+	// delle sessioni
 	sessionsColl := m.DB.Collection("sessions")
 	sessionsIndexModel := []mongo.IndexModel{
 		{
@@ -640,15 +4592,515 @@ func (m *MongoClient) createIndexes() error {
 			Keys:    bson.D{{Key: "restaurant_id", Value: 1}},
 			Options: options.Index().SetName("idx_restaurant_session"),
 		},
-		{
-			Keys:    bson.D{{Key: "last_accessed", Value: 1}},
-			Options: options.Index().SetExpireAfterSeconds(2592000).SetName("idx_session_ttl"), // 30 giorni
-		},
 	}
 	if _, err := sessionsColl.Indexes().CreateMany(ctx, sessionsIndexModel); err != nil {
 		log.Printf("⚠️ Attenzione: alcuni indici sessions potrebbero esistere già: %v", err)
 	}
 	
+	// Indici per email_verifications (scadenza automatica)
+	verificationsColl := m.DB.Collection("email_verifications")
+	verificationsIndexModel := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("idx_verification_user"),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("idx_verification_ttl"),
+		},
+	}
+	if _, err := verificationsColl.Indexes().CreateMany(ctx, verificationsIndexModel); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici email_verifications potrebbero esistere già: %v", err)
+	}
+
+	// Indici per password_resets (scadenza automatica)
+	resetsColl := m.DB.Collection("password_resets")
+	resetsIndexModel := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("idx_password_reset_user"),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("idx_password_reset_ttl"),
+		},
+	}
+	if _, err := resetsColl.Indexes().CreateMany(ctx, resetsIndexModel); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici password_resets potrebbero esistere già: %v", err)
+	}
+
+	// Indici per lo staff (gli inviti scadono automaticamente)
+	if _, err := m.DB.Collection("restaurant_members").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_member_restaurant_user"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("idx_member_user"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici restaurant_members potrebbero esistere già: %v", err)
+	}
+	if _, err := m.DB.Collection("staff_invitations").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "email", Value: 1}},
+			Options: options.Index().SetName("idx_staff_invitation_restaurant"),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("idx_staff_invitation_ttl"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici staff_invitations potrebbero esistere già: %v", err)
+	}
+
+	// Indici per le API key (autenticazione per hash del segreto)
+	if _, err := m.DB.Collection("api_keys").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_api_key_hash"),
+		},
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}},
+			Options: options.Index().SetName("idx_api_key_restaurant"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici api_keys potrebbero esistere già: %v", err)
+	}
+
+	// Indice per i piatti del giorno (feed e calendario per intervallo di date)
+	if _, err := m.DB.Collection("daily_specials").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "date", Value: 1}},
+		Options: options.Index().SetName("idx_daily_special_restaurant_date"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice daily_specials potrebbe esistere già: %v", err)
+	}
+
+	// Indici per le organizzazioni: per proprietario, sedi e modelli di menu condivisi
+	if _, err := m.DB.Collection("organizations").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "owner_id", Value: 1}},
+		Options: options.Index().SetName("idx_organization_owner"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice organizations potrebbe esistere già: %v", err)
+	}
+	if _, err := m.DB.Collection("restaurants").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "organization_id", Value: 1}},
+		Options: options.Index().SetSparse(true).SetName("idx_restaurant_organization"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice restaurants organization_id potrebbe esistere già: %v", err)
+	}
+	if _, err := m.DB.Collection("menu_templates").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "organization_id", Value: 1}},
+			Options: options.Index().SetSparse(true).SetName("idx_menu_template_organization"),
+		},
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}},
+			Options: options.Index().SetSparse(true).SetName("idx_menu_template_restaurant"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici menu_templates potrebbero esistere già: %v", err)
+	}
+	if _, err := m.DB.Collection("menus").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "template_id", Value: 1}},
+		Options: options.Index().SetSparse(true).SetName("idx_menu_template"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice menus template_id potrebbe esistere già: %v", err)
+	}
+
+	// Indice per lo storico delle modifiche di un menu, dalla più recente
+	if _, err := m.DB.Collection("menu_revisions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "menu_id", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("idx_menu_revision_menu_created"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice menu_revisions potrebbe esistere già: %v", err)
+	}
+
+	// Indice per i movimenti di magazzino di un piatto, dal più recente
+	if _, err := m.DB.Collection("stock_adjustments").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "item_id", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("idx_stock_adjustment_item_created"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice stock_adjustments potrebbe esistere già: %v", err)
+	}
+
+	// Indice per gli ordini di un ristorante per stato, dal più recente (KDS ed elenco ordini)
+	if _, err := m.DB.Collection("orders").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("idx_order_restaurant_status_created"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice orders potrebbe esistere già: %v", err)
+	}
+
+	// Iscritti al menu del giorno su WhatsApp, una volta per ristorante
+	if _, err := m.DB.Collection("whatsapp_subscribers").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "phone", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("idx_whatsapp_subscriber_restaurant_phone"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice whatsapp_subscribers potrebbe esistere già: %v", err)
+	}
+
+	// Chat Telegram collegate: per ristorante e per il riepilogo serale; i codici di
+	// collegamento vengono rimossi alla scadenza
+	if _, err := m.DB.Collection("telegram_chats").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "linked_at", Value: -1}},
+			Options: options.Index().SetName("idx_telegram_chat_restaurant_linked"),
+		},
+		{
+			Keys:    bson.D{{Key: "daily_summary", Value: 1}, {Key: "restaurant_id", Value: 1}},
+			Options: options.Index().SetName("idx_telegram_chat_daily_summary"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici telegram_chats potrebbero esistere già: %v", err)
+	}
+	if _, err := m.DB.Collection("telegram_link_codes").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0).SetName("idx_telegram_link_code_ttl"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice telegram_link_codes potrebbe esistere già: %v", err)
+	}
+
+	// Webhook Slack e Discord: per ID e per ristorante ed evento
+	if _, err := m.DB.Collection("chat_webhooks").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_chat_webhook_id"),
+		},
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "events", Value: 1}},
+			Options: options.Index().SetName("idx_chat_webhook_restaurant_events"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici chat_webhooks potrebbero esistere già: %v", err)
+	}
+
+	// Integrazioni con le piattaforme di delivery: una per piattaforma e ristorante, e quelle
+	// con la sincronizzazione automatica per scadenza
+	if _, err := m.DB.Collection("menu_integrations").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "platform", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_menu_integration_restaurant_platform"),
+		},
+		{
+			Keys:    bson.D{{Key: "id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_menu_integration_id"),
+		},
+		{
+			Keys:    bson.D{{Key: "auto_sync", Value: 1}, {Key: "next_sync_at", Value: 1}},
+			Options: options.Index().SetName("idx_menu_integration_next_sync"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici menu_integrations potrebbero esistere già: %v", err)
+	}
+
+	// Dispositivi Apple registrati ai pass Wallet: per ristorante, per dispositivo e per token push
+	if _, err := m.DB.Collection("wallet_registrations").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}},
+			Options: options.Index().SetName("idx_wallet_registration_restaurant"),
+		},
+		{
+			Keys:    bson.D{{Key: "device_id", Value: 1}, {Key: "pass_type_id", Value: 1}},
+			Options: options.Index().SetName("idx_wallet_registration_device"),
+		},
+		{
+			Keys:    bson.D{{Key: "push_token", Value: 1}},
+			Options: options.Index().SetName("idx_wallet_registration_push_token"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici wallet_registrations potrebbero esistere già: %v", err)
+	}
+
+	// Tag NFC: codice univoco tra tutti i ristoranti, elenco per ristorante
+	if _, err := m.DB.Collection("nfc_tags").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_nfc_tag_code"),
+		},
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "created_at", Value: 1}},
+			Options: options.Index().SetName("idx_nfc_tag_restaurant_created"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici nfc_tags potrebbero esistere già: %v", err)
+	}
+
+	// Link brevi: codice univoco tra tutti i ristoranti, elenco per ristorante
+	if _, err := m.DB.Collection("short_links").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_short_link_code"),
+		},
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "created_at", Value: 1}},
+			Options: options.Index().SetName("idx_short_link_restaurant_created"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici short_links potrebbero esistere già: %v", err)
+	}
+
+	// Le prenotazioni delle fasce orarie vengono rimosse un giorno dopo la fascia
+	if _, err := m.DB.Collection("slot_bookings").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "slot", Value: 1}},
+			Options: options.Index().SetName("idx_slot_booking_restaurant_slot"),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("idx_slot_booking_ttl"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici slot_bookings potrebbero esistere già: %v", err)
+	}
+
+	// Indice per la coda di moderazione dei feedback e per le valutazioni approvate
+	if _, err := m.DB.Collection("feedback").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("idx_feedback_restaurant_status_created"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice feedback potrebbe esistere già: %v", err)
+	}
+
+	// Indice per il limite di feedback per visitatore
+	if _, err := m.DB.Collection("feedback").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "visitor_hash", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("idx_feedback_restaurant_visitor_created"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice feedback potrebbe esistere già: %v", err)
+	}
+
+	// Indici per i codici delle visite (unici per ristorante) e per la visita di un ordine
+	if _, err := m.DB.Collection("loyalty_visits").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_loyalty_visit_restaurant_code"),
+		},
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "order_id", Value: 1}},
+			Options: options.Index().SetName("idx_loyalty_visit_restaurant_order"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici loyalty_visits potrebbero esistere già: %v", err)
+	}
+
+	// Indici per le tessere fedeltà: numero unico per ristorante e hash del token
+	if _, err := m.DB.Collection("loyalty_cards").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "number", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_loyalty_card_restaurant_number"),
+		},
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_loyalty_card_token"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici loyalty_cards potrebbero esistere già: %v", err)
+	}
+
+	// Indici per i movimenti di una tessera e per il limite di raccolte per dispositivo
+	if _, err := m.DB.Collection("loyalty_transactions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "card_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("idx_loyalty_transaction_card_created"),
+		},
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "visitor_hash", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("idx_loyalty_transaction_visitor_created"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici loyalty_transactions potrebbero esistere già: %v", err)
+	}
+
+	// Indici per i buoni regalo: codice unico per ristorante ed elenco per stato
+	if _, err := m.DB.Collection("vouchers").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_voucher_restaurant_code"),
+		},
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("idx_voucher_restaurant_status_created"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici vouchers potrebbero esistere già: %v", err)
+	}
+
+	// Indice per i movimenti di un buono
+	if _, err := m.DB.Collection("voucher_transactions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "voucher_id", Value: 1}, {Key: "created_at", Value: -1}},
+		Options: options.Index().SetName("idx_voucher_transaction_voucher_created"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici voucher_transactions potrebbero esistere già: %v", err)
+	}
+
+	// Indici per le promozioni del ristorante e per inizio e fine dei periodi di validità
+	if _, err := m.DB.Collection("promotions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "starts_at", Value: -1}},
+			Options: options.Index().SetName("idx_promotion_restaurant_starts"),
+		},
+		{
+			Keys:    bson.D{{Key: "starts_at", Value: 1}},
+			Options: options.Index().SetName("idx_promotion_starts"),
+		},
+		{
+			Keys:    bson.D{{Key: "ends_at", Value: 1}},
+			Options: options.Index().SetName("idx_promotion_ends"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici promotions potrebbero esistere già: %v", err)
+	}
+
+	// Indice TTL per la lista di revoca dei token dell'API (il token scade comunque)
+	if _, err := m.DB.Collection("revoked_tokens").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0).SetName("idx_revoked_token_ttl"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice revoked_tokens potrebbe esistere già: %v", err)
+	}
+
+	// Indici per i refresh token dell'API (hash, famiglia, utente, ristorante e scadenza)
+	if _, err := m.DB.Collection("refresh_tokens").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_refresh_token_hash"),
+		},
+		{
+			Keys:    bson.D{{Key: "family_id", Value: 1}},
+			Options: options.Index().SetName("idx_refresh_token_family"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("idx_refresh_token_user"),
+		},
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}},
+			Options: options.Index().SetName("idx_refresh_token_restaurant"),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("idx_refresh_token_ttl"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici refresh_tokens potrebbero esistere già: %v", err)
+	}
+
+	if _, err := m.DB.Collection("billing_usage").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "period", Value: 1}},
+			Options: options.Index().SetName("idx_billing_usage_period"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici billing_usage potrebbero esistere già: %v", err)
+	}
+
+	if _, err := m.DB.Collection("billing_subscriptions").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}},
+			Options: options.Index().SetName("idx_subscription_restaurant"),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "trial_ends_at", Value: 1}},
+			Options: options.Index().SetName("idx_subscription_trial"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici billing_subscriptions potrebbero esistere già: %v", err)
+	}
+
+	if _, err := m.DB.Collection("coupons").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("idx_coupon_code"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice coupons potrebbe esistere già: %v", err)
+	}
+
+	if _, err := m.DB.Collection("webhook_endpoints").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_webhook_id"),
+		},
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}},
+			Options: options.Index().SetName("idx_webhook_restaurant"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici webhook_endpoints potrebbero esistere già: %v", err)
+	}
+
+	// Le consegne (anche quelle nella dead-letter list) scadono dopo 30 giorni
+	if _, err := m.DB.Collection("webhook_deliveries").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("idx_webhook_delivery_id"),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_retry_at", Value: 1}},
+			Options: options.Index().SetName("idx_webhook_delivery_due"),
+		},
+		{
+			Keys:    bson.D{{Key: "restaurant_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("idx_webhook_delivery_restaurant"),
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(30 * 24 * 3600).SetName("idx_webhook_delivery_ttl"),
+		},
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici webhook_deliveries potrebbero esistere già: %v", err)
+	}
+
+	// Indici per le notifiche push (lo storico scade dopo 90 giorni)
+	pushTokensColl := m.DB.Collection("push_tokens")
+	if _, err := pushTokensColl.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetName("idx_push_token_user"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice push_tokens potrebbe esistere già: %v", err)
+	}
+	if _, err := m.DB.Collection("webpush_subscriptions").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetName("idx_webpush_user"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice webpush_subscriptions potrebbe esistere già: %v", err)
+	}
+	if _, err := m.DB.Collection("notification_queue").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}},
+		Options: options.Index().SetName("idx_notification_queue_user"),
+	}); err != nil {
+		log.Printf("⚠️ Attenzione: indice notification_queue potrebbe esistere già: %v", err)
+	}
+	historyColl := m.DB.Collection("notification_history")
+	historyIndexModel := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("idx_notification_history_user"),
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(90 * 24 * 3600).SetName("idx_notification_history_ttl"),
+		},
+		{
+			// Ricevute di consegna degli SMS
+			Keys:    bson.D{{Key: "message_id", Value: 1}},
+			Options: options.Index().SetSparse(true).SetName("idx_notification_history_message"),
+		},
+	}
+	if _, err := historyColl.Indexes().CreateMany(ctx, historyIndexModel); err != nil {
+		log.Printf("⚠️ Attenzione: alcuni indici notification_history potrebbero esistere già: %v", err)
+	}
+
+	// Indice per le cancellazioni account programmate
+	deletionsColl := m.DB.Collection("account_deletions")
+	deletionsIndexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "status", Value: 1}, {Key: "scheduled_at", Value: 1}},
+		Options: options.Index().SetName("idx_deletion_due"),
+	}
+	if _, err := deletionsColl.Indexes().CreateOne(ctx, deletionsIndexModel); err != nil {
+		log.Printf("⚠️ Attenzione: indice account_deletions potrebbe esistere già: %v", err)
+	}
+
 	log.Println("✅ Indici multi-ristorante creati con successo")
 
 	return nil
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -37,10 +38,66 @@ type AnalyticsEvent struct {
 	Data         map[string]interface{} `bson:"data"`
 	IPAddress    string                 `bson:"ip_address"`
 	UserAgent    string                 `bson:"user_agent"`
+	DeviceType   string                 `bson:"device_type,omitempty"` // mobile, tablet, desktop
+	Browser      string                 `bson:"browser,omitempty"`
+	OS           string                 `bson:"os,omitempty"`
+	Country      string                 `bson:"country,omitempty"`
+	City         string                 `bson:"city,omitempty"`
 	Timestamp    time.Time              `bson:"timestamp"`
 	DayDate      string                 `bson:"day_date"` // YYYY-MM-DD per aggregazioni
 }
 
+// AnalyticsEventFilter seleziona gli eventi grezzi di un ristorante. I campi vuoti non filtrano
+type AnalyticsEventFilter struct {
+	RestaurantID string
+	EventType    string
+	MenuID       string
+	DeviceType   string
+	Source       string    // Origine delle scansioni: qr (anche gli eventi precedenti ai tag NFC), nfc o link
+	Campaign     string    // Campagna dei link brevi o utm_campaign delle visualizzazioni
+	UTMSource    string    // utm_source delle visualizzazioni
+	From         time.Time // Incluso
+	To           time.Time // Escluso
+}
+
+func (f AnalyticsEventFilter) query() bson.M {
+	query := bson.M{"restaurant_id": f.RestaurantID}
+	if f.EventType != "" {
+		query["event_type"] = f.EventType
+	}
+	if f.MenuID != "" {
+		query["menu_id"] = f.MenuID
+	}
+	if f.DeviceType != "" {
+		query["device_type"] = f.DeviceType
+	}
+	switch f.Source {
+	case "":
+	case "qr":
+		// Le scansioni registrate prima dei tag NFC non hanno l'origine
+		query["data.source"] = bson.M{"$in": []interface{}{"qr", nil}}
+	default:
+		query["data.source"] = f.Source
+	}
+	if f.Campaign != "" {
+		query["$or"] = bson.A{bson.M{"data.campaign": f.Campaign}, bson.M{"data.utm_campaign": f.Campaign}}
+	}
+	if f.UTMSource != "" {
+		query["data.utm_source"] = f.UTMSource
+	}
+	timeRange := bson.M{}
+	if !f.From.IsZero() {
+		timeRange["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		timeRange["$lt"] = f.To
+	}
+	if len(timeRange) > 0 {
+		query["timestamp"] = timeRange
+	}
+	return query
+}
+
 // ==================== AUDIT LOGS ====================
 
 // CreateAuditLog crea un nuovo log di audit
@@ -78,6 +135,96 @@ func (m *MongoClient) GetAuditLogs(ctx context.Context, restaurantID string, lim
 	return logs, nil
 }
 
+// AuditLogFilter seleziona i log di audit di un ristorante. I campi vuoti non filtrano
+type AuditLogFilter struct {
+	RestaurantID string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Status       string
+	From         time.Time // Incluso
+	To           time.Time // Escluso
+}
+
+// FindAuditLogs recupera una pagina dei log di audit, dal più recente salvo diverso
+// ordinamento, e il loro numero totale
+func (m *MongoClient) FindAuditLogs(ctx context.Context, filter AuditLogFilter, opts ListOptions) ([]*AuditLog, int64, error) {
+	query := bson.M{"restaurant_id": filter.RestaurantID}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.ResourceType != "" {
+		query["resource_type"] = filter.ResourceType
+	}
+	if filter.ResourceID != "" {
+		query["resource_id"] = filter.ResourceID
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	timeRange := bson.M{}
+	if !filter.From.IsZero() {
+		timeRange["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		timeRange["$lt"] = filter.To
+	}
+	if len(timeRange) > 0 {
+		query["timestamp"] = timeRange
+	}
+	return findPage[AuditLog](ctx, m.DB.Collection("audit_logs"), query, opts, "-timestamp")
+}
+
+// accountAuditLogQuery seleziona i log di audit di un account: quelli dei suoi ristoranti
+// e quelli registrati dall'utente senza ristorante (es. export e cancellazione account)
+func accountAuditLogQuery(userID string, restaurantIDs []string) bson.M {
+	or := bson.A{
+		bson.M{"user_id": userID},
+		bson.M{"resource_type": "user", "resource_id": userID},
+	}
+	if len(restaurantIDs) > 0 {
+		or = append(or, bson.M{"restaurant_id": bson.M{"$in": restaurantIDs}})
+	}
+	return bson.M{"$or": or}
+}
+
+// StreamAccountAuditLogs scorre in ordine cronologico i log di audit dell'account,
+// chiamando fn per ciascuno senza caricarli tutti in memoria
+func (m *MongoClient) StreamAccountAuditLogs(ctx context.Context, userID string, restaurantIDs []string, fn func(*AuditLog) error) error {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: 1}}).
+		SetBatchSize(500)
+
+	cursor, err := m.DB.Collection("audit_logs").Find(ctx, accountAuditLogQuery(userID, restaurantIDs), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var log AuditLog
+		if err := cursor.Decode(&log); err != nil {
+			return err
+		}
+		if err := fn(&log); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// AnonymizeAccountAuditLogs rimuove utente, IP e User-Agent dai log di audit dell'account.
+// Le azioni restano, senza più riferimenti alla persona. Restituisce il numero di log anonimizzati
+func (m *MongoClient) AnonymizeAccountAuditLogs(ctx context.Context, userID string, restaurantIDs []string) (int64, error) {
+	result, err := m.DB.Collection("audit_logs").UpdateMany(ctx,
+		accountAuditLogQuery(userID, restaurantIDs),
+		bson.M{"$set": bson.M{"user_id": "", "ip_address": "", "user_agent": ""}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
 // GetAuditLogsByAction filtra i log per azione
 func (m *MongoClient) GetAuditLogsByAction(ctx context.Context, restaurantID, action string, limit int64) ([]*AuditLog, error) {
 	coll := m.DB.Collection("audit_logs")
@@ -165,6 +312,150 @@ func (m *MongoClient) GetAnalyticsEvents(ctx context.Context, restaurantID strin
 	return events, nil
 }
 
+// FindAnalyticsEvents restituisce una pagina di eventi (dal più recente) e il totale degli eventi filtrati
+func (m *MongoClient) FindAnalyticsEvents(ctx context.Context, filter AnalyticsEventFilter, skip, limit int64) ([]*AnalyticsEvent, int64, error) {
+	coll := m.DB.Collection("analytics_events")
+	query := filter.query()
+
+	total, err := coll.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetSkip(skip).
+		SetLimit(limit)
+
+	cursor, err := coll.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	events := make([]*AnalyticsEvent, 0)
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// StreamAnalyticsEvents scorre gli eventi filtrati in ordine cronologico senza caricarli
+// tutti in memoria, chiamando fn per ciascuno. Si interrompe al primo errore di fn
+func (m *MongoClient) StreamAnalyticsEvents(ctx context.Context, filter AnalyticsEventFilter, fn func(*AnalyticsEvent) error) error {
+	coll := m.DB.Collection("analytics_events")
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: 1}}).
+		SetBatchSize(500)
+
+	cursor, err := coll.Find(ctx, filter.query(), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var event AnalyticsEvent
+		if err := cursor.Decode(&event); err != nil {
+			return err
+		}
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// DeleteAnalyticsEventsBefore elimina gli eventi grezzi precedenti a before (retention).
+// Restituisce il numero di eventi eliminati
+func (m *MongoClient) DeleteAnalyticsEventsBefore(ctx context.Context, before time.Time) (int64, error) {
+	coll := m.DB.Collection("analytics_events")
+
+	result, err := coll.DeleteMany(ctx, bson.M{"timestamp": bson.M{"$lt": before}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// AnonymizeAnalyticsEvents rimuove dagli eventi grezzi dei ristoranti i dati che possono
+// identificare un visitatore (IP, User-Agent, sessione, utente e città). Tipo, data, menu,
+// dispositivo e paese restano per le statistiche. Restituisce il numero di eventi anonimizzati
+func (m *MongoClient) AnonymizeAnalyticsEvents(ctx context.Context, restaurantIDs []string) (int64, error) {
+	if len(restaurantIDs) == 0 {
+		return 0, nil
+	}
+	result, err := m.DB.Collection("analytics_events").UpdateMany(ctx,
+		bson.M{"restaurant_id": bson.M{"$in": restaurantIDs}},
+		bson.M{
+			"$set":   bson.M{"ip_address": "", "user_agent": ""},
+			"$unset": bson.M{"user_id": "", "session_id": "", "city": ""},
+		})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// ScrubAnalyticsEvents scorre tutti gli eventi grezzi e salva IP, User-Agent, dispositivo,
+// browser e sistema operativo di quelli che scrub ha modificato (restituendo true).
+// Gli aggiornamenti sono inviati a blocchi. Restituisce il numero di eventi aggiornati
+func (m *MongoClient) ScrubAnalyticsEvents(ctx context.Context, scrub func(*AnalyticsEvent) bool) (int64, error) {
+	const batchSize = 500
+	coll := m.DB.Collection("analytics_events")
+
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetBatchSize(batchSize))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var updated int64
+	batch := make([]mongo.WriteModel, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		result, err := coll.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		updated += result.ModifiedCount
+		batch = batch[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var event AnalyticsEvent
+		if err := cursor.Decode(&event); err != nil {
+			return updated, err
+		}
+		if !scrub(&event) {
+			continue
+		}
+		// _id grezzo: gli eventi hanno ObjectID generati da MongoDB, che in ID diventano stringhe
+		batch = append(batch, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": cursor.Current.Lookup("_id")}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"ip_address":  event.IPAddress,
+				"user_agent":  event.UserAgent,
+				"device_type": event.DeviceType,
+				"browser":     event.Browser,
+				"os":          event.OS,
+			}}))
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return updated, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return updated, err
+	}
+	return updated, flush()
+}
+
 // GetAnalyticsEventsByType filtra gli eventi per tipo
 func (m *MongoClient) GetAnalyticsEventsByType(ctx context.Context, restaurantID, eventType string, limit int64) ([]*AnalyticsEvent, error) {
 	coll := m.DB.Collection("analytics_events")
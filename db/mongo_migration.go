@@ -3,6 +3,7 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"log"
 	"os"
@@ -19,6 +20,11 @@ func (m *MongoClient) MigrateFromFileStorage() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Aggiorna lo schema dei file JSON prima di importarli
+	if _, err := MigrateStorageSchema("storage"); err != nil {
+		return err
+	}
+
 	// Migra restaurants
 	if err := m.migrateRestaurants(ctx); err != nil {
 		return err
@@ -47,19 +53,11 @@ func (m *MongoClient) migrateRestaurants(ctx context.Context) error {
 
 	successCount := 0
 	for _, filename := range files {
-		file, err := os.Open(filename)
-		if err != nil {
-			log.Printf("⚠️  Errore apertura %s: %v", filename, err)
-			continue
-		}
-
 		var restaurant models.Restaurant
-		if err := json.NewDecoder(file).Decode(&restaurant); err != nil {
-			log.Printf("⚠️  Errore decode %s: %v", filename, err)
-			file.Close()
+		if err := ReadJSONFile(filename, &restaurant); err != nil {
+			skipStorageFile(filename, err)
 			continue
 		}
-		file.Close()
 
 		// Verifica se esiste già
 		existing, err := m.GetRestaurantByID(ctx, restaurant.ID)
@@ -91,20 +89,12 @@ func (m *MongoClient) migrateMenus(ctx context.Context) error {
 
 	successCount := 0
 	for _, filename := range files {
-		file, err := os.Open(filename)
+		menu, err := LoadMenuFile(filename)
 		if err != nil {
-			log.Printf("⚠️  Errore apertura %s: %v", filename, err)
+			skipStorageFile(filename, err)
 			continue
 		}
 
-		var menu models.Menu
-		if err := json.NewDecoder(file).Decode(&menu); err != nil {
-			log.Printf("⚠️  Errore decode %s: %v", filename, err)
-			file.Close()
-			continue
-		}
-		file.Close()
-
 		// Verifica se esiste già
 		existing, err := m.GetMenuByID(ctx, menu.ID)
 		if err == nil && existing != nil {
@@ -113,7 +103,7 @@ func (m *MongoClient) migrateMenus(ctx context.Context) error {
 		}
 
 		// Salva in MongoDB
-		if err := m.CreateMenu(ctx, &menu); err != nil {
+		if err := m.CreateMenu(ctx, menu); err != nil {
 			log.Printf("⚠️  Errore save menu %s: %v", menu.ID, err)
 			continue
 		}
@@ -135,19 +125,11 @@ func (m *MongoClient) migrateSessions(ctx context.Context) error {
 
 	successCount := 0
 	for _, filename := range files {
-		file, err := os.Open(filename)
-		if err != nil {
-			log.Printf("⚠️  Errore apertura %s: %v", filename, err)
-			continue
-		}
-
 		var session models.Session
-		if err := json.NewDecoder(file).Decode(&session); err != nil {
-			log.Printf("⚠️  Errore decode %s: %v", filename, err)
-			file.Close()
+		if err := ReadJSONFile(filename, &session); err != nil {
+			skipStorageFile(filename, err)
 			continue
 		}
-		file.Close()
 
 		// Salta sessioni scadute
 		if time.Since(session.LastAccessed) > 24*time.Hour {
@@ -176,6 +158,16 @@ func (m *MongoClient) migrateSessions(ctx context.Context) error {
 	return nil
 }
 
+// skipStorageFile registra un file che non è stato possibile importare e mette
+// in quarantena quelli corrotti, così non vengono riletti a ogni avvio
+func skipStorageFile(filename string, err error) {
+	if errors.Is(err, ErrCorruptFile) {
+		QuarantineCorruptFile(filename, err)
+		return
+	}
+	log.Printf("⚠️  Errore lettura %s: %v", filename, err)
+}
+
 // BackupToJSON esporta i dati da MongoDB a JSON (backup)
 func (m *MongoClient) BackupToJSON(backupDir string) error {
 	log.Println("💾 Backup in corso...")
@@ -0,0 +1,183 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"qr-menu/db"
+	"qr-menu/db/dbtest"
+	"qr-menu/models"
+)
+
+// TestMenuLifecycle tests the menu queries of the db package against MongoDB
+func TestMenuLifecycle(t *testing.T) {
+	s := dbtest.New(t)
+	ctx := context.Background()
+
+	for _, menu := range []*models.Menu{
+		{ID: "m1", RestaurantID: "r1", Name: "Pranzo"},
+		{ID: "m2", RestaurantID: "r1", Name: "Cena"},
+		{ID: "m3", RestaurantID: "r2", Name: "Altro"},
+	} {
+		if err := db.MongoInstance.CreateMenu(ctx, menu); err != nil {
+			t.Fatalf("CreateMenu(%s) failed: %v", menu.ID, err)
+		}
+	}
+
+	menu, err := db.MongoInstance.GetRestaurantMenu(ctx, "m1", "r1")
+	if err != nil || menu == nil || menu.Name != "Pranzo" {
+		t.Fatalf("Expected menu m1 of r1, got %+v (err %v)", menu, err)
+	}
+	if menu.SchemaVersion != models.MenuSchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", models.MenuSchemaVersion, menu.SchemaVersion)
+	}
+	if other, err := db.MongoInstance.GetRestaurantMenu(ctx, "m3", "r1"); err != nil || other != nil {
+		t.Errorf("Expected no menu of another restaurant, got %+v (err %v)", other, err)
+	}
+
+	menu.Name = "Pranzo di lavoro"
+	if err := db.MongoInstance.UpdateMenu(ctx, menu); err != nil {
+		t.Fatalf("UpdateMenu failed: %v", err)
+	}
+	if err := db.MongoInstance.DeleteMenu(ctx, "m2"); err != nil {
+		t.Fatalf("DeleteMenu failed: %v", err)
+	}
+	if err := db.MongoInstance.DeleteMenu(ctx, "m2"); err == nil {
+		t.Error("Expected an error deleting a missing menu")
+	}
+
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, "r1")
+	if err != nil {
+		t.Fatalf("GetMenusByRestaurantID failed: %v", err)
+	}
+	if len(menus) != 1 || menus[0].Name != "Pranzo di lavoro" {
+		t.Errorf("Expected only the updated menu m1, got %+v", menus)
+	}
+	if n := s.Count(t, "menus", bson.M{"restaurant_id": "r2"}); n != 1 {
+		t.Errorf("Expected 1 menu of r2, got %d", n)
+	}
+}
+
+// TestAPIKeyQueries tests inserts, lookups and updates by _id on seeded documents
+func TestAPIKeyQueries(t *testing.T) {
+	s := dbtest.New(t)
+	ctx := context.Background()
+	s.Insert(t, "api_keys", &models.APIKey{ID: "k1", RestaurantID: "r1", Hash: "h1", Scopes: []string{"menu:read"}})
+
+	key, err := db.MongoInstance.GetAPIKeyByHash(ctx, "h1")
+	if err != nil || key == nil || key.RestaurantID != "r1" || !key.HasScope("menu:read") {
+		t.Fatalf("Expected key k1, got %+v (err %v)", key, err)
+	}
+	if missing, err := db.MongoInstance.GetAPIKeyByHash(ctx, "h2"); err != nil || missing != nil {
+		t.Errorf("Expected no key for an unknown hash, got %+v (err %v)", missing, err)
+	}
+
+	usedAt := time.Now().UTC().Truncate(time.Millisecond)
+	if err := db.MongoInstance.TouchAPIKey(ctx, "k1", usedAt); err != nil {
+		t.Fatalf("TouchAPIKey failed: %v", err)
+	}
+	var keys []models.APIKey
+	s.Find(t, "api_keys", bson.M{"_id": "k1"}, &keys)
+	if len(keys) != 1 || keys[0].LastUsedAt == nil || !keys[0].LastUsedAt.Equal(usedAt) {
+		t.Errorf("Expected last_used_at %v, got %+v", usedAt, keys)
+	}
+
+	if err := db.MongoInstance.CreateAPIKey(ctx, &models.APIKey{ID: "k1", Hash: "h3"}); err == nil {
+		t.Error("Expected a duplicate key error for an existing _id")
+	}
+}
+
+// TestCreateUserUniqueCredentials tests that the unique indexes reject usernames and emails
+// that differ only in case, as concurrent registrations would bypass CheckUserCredentials
+func TestCreateUserUniqueCredentials(t *testing.T) {
+	dbtest.New(t)
+	ctx := context.Background()
+	if err := db.MongoInstance.CreateUser(ctx, &models.User{ID: "u1", Username: "Mario", Email: "mario@example.com"}); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+
+	err := db.MongoInstance.CreateUser(ctx, &models.User{ID: "u2", Username: "mario", Email: "altro@example.com"})
+	if !errors.Is(err, db.ErrDuplicateUsername) {
+		t.Errorf("Expected ErrDuplicateUsername, got %v", err)
+	}
+	err = db.MongoInstance.CreateUser(ctx, &models.User{ID: "u3", Username: "luigi", Email: " Mario@Example.com"})
+	if !errors.Is(err, db.ErrDuplicateEmail) {
+		t.Errorf("Expected ErrDuplicateEmail, got %v", err)
+	}
+	if err := db.MongoInstance.CreateUser(ctx, &models.User{ID: "u4", Username: "luigi", Email: "luigi@example.com"}); err != nil {
+		t.Errorf("Expected distinct credentials to be accepted, got %v", err)
+	}
+}
+
+// TestAggregate tests the $match, $unwind and $group stages used by the rating statistics
+func TestAggregate(t *testing.T) {
+	s := dbtest.New(t)
+	now := time.Now()
+	s.Insert(t, "feedback",
+		&models.Feedback{ID: "f1", RestaurantID: "r1", Rating: 5, Status: models.FeedbackApproved, CreatedAt: now,
+			Items: []models.ItemFeedback{{ItemID: "i1", Name: "Carbonara", Rating: 4}, {ItemID: "i2", Name: "Tiramisù", Rating: 5}}},
+		&models.Feedback{ID: "f2", RestaurantID: "r1", Rating: 3, Status: models.FeedbackApproved, CreatedAt: now,
+			Items: []models.ItemFeedback{{ItemID: "i1", Name: "Carbonara", Rating: 2}}},
+		&models.Feedback{ID: "f3", RestaurantID: "r1", Rating: 1, Status: models.FeedbackPending, CreatedAt: now},
+		&models.Feedback{ID: "f4", RestaurantID: "r2", Rating: 1, Status: models.FeedbackApproved, CreatedAt: now},
+	)
+
+	stats, err := db.MongoInstance.GetRatingStats(context.Background(), "r1", time.Time{})
+	if err != nil {
+		t.Fatalf("GetRatingStats failed: %v", err)
+	}
+	if stats.Count != 2 || stats.Average != 4 {
+		t.Errorf("Expected 2 approved ratings averaging 4, got %d averaging %v", stats.Count, stats.Average)
+	}
+	if item := stats.Items["i1"]; item.Count != 2 || item.Average != 3 || item.Name != "Carbonara" {
+		t.Errorf("Expected i1 rated twice averaging 3, got %+v", item)
+	}
+	if item := stats.Items["i2"]; item.Count != 1 || item.Average != 5 {
+		t.Errorf("Expected i2 rated once with 5, got %+v", item)
+	}
+}
+
+// TestEnsureSessionTTL tests that the sessions keep a single TTL index on last_accessed, with
+// the session timeout as expiry, replacing the old 7 day index
+func TestEnsureSessionTTL(t *testing.T) {
+	dbtest.New(t)
+	ctx := context.Background()
+	indexes := db.MongoInstance.DB.Collection("sessions").Indexes()
+	if _, err := indexes.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "last_accessed", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(604800),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// ttlIndexes returns the expiry of the TTL indexes by name
+	ttlIndexes := func() map[string]int32 {
+		specs, err := indexes.ListSpecifications(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ttl := map[string]int32{}
+		for _, spec := range specs {
+			if spec.ExpireAfterSeconds != nil {
+				ttl[spec.Name] = *spec.ExpireAfterSeconds
+			}
+		}
+		return ttl
+	}
+
+	for _, timeout := range []time.Duration{24 * time.Hour, 24 * time.Hour, 2 * time.Hour} {
+		if err := db.MongoInstance.EnsureSessionTTL(ctx, timeout); err != nil {
+			t.Fatalf("EnsureSessionTTL(%v) failed: %v", timeout, err)
+		}
+		ttl := ttlIndexes()
+		if len(ttl) != 1 || ttl["idx_session_ttl"] != int32(timeout.Seconds()) {
+			t.Fatalf("Expected only idx_session_ttl with %v, got %v", timeout, ttl)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"qr-menu/models"
+)
+
+// ErrCorruptFile indica un file JSON dello storage illeggibile (troncato da un
+// crash o modificato a mano): va messo in quarantena invece di essere ignorato
+var ErrCorruptFile = errors.New("file JSON corrotto")
+
+// corruptDirName è la sottocartella dello storage in cui finiscono i file corrotti
+const corruptDirName = "corrupted"
+
+// storageSchemaStep rappresenta un singolo passo di aggiornamento dello schema
+// dei menu salvati su file. Ogni step porta il record dalla versione
+// precedente a Version lavorando sulla mappa JSON grezza, così i campi
+// sconosciuti non vengono persi durante l'aggiornamento.
+type storageSchemaStep struct {
+	Version     int
+	Description string
+	Apply       func(menu map[string]interface{})
+}
+
+// menuSchemaSteps elenca gli step in ordine crescente di versione.
+// L'ultimo step deve corrispondere a models.MenuSchemaVersion
+var menuSchemaSteps = []storageSchemaStep{
+	{
+		Version:     1,
+		Description: "ordine di visualizzazione per categorie e piatti",
+		Apply: func(menu map[string]interface{}) {
+			forEachCategory(menu, func(i int, category map[string]interface{}) {
+				if _, ok := category["display_order"]; !ok {
+					category["display_order"] = i
+				}
+				forEachItem(category, func(j int, item map[string]interface{}) {
+					if _, ok := item["display_order"]; !ok {
+						item["display_order"] = j
+					}
+				})
+			})
+		},
+	},
+	{
+		Version:     2,
+		Description: "tag e traduzioni",
+		Apply: func(menu map[string]interface{}) {
+			forEachCategory(menu, func(_ int, category map[string]interface{}) {
+				if category["translations"] == nil {
+					category["translations"] = map[string]interface{}{}
+				}
+				forEachItem(category, func(_ int, item map[string]interface{}) {
+					if item["tags"] == nil {
+						item["tags"] = []interface{}{}
+					}
+					if item["translations"] == nil {
+						item["translations"] = map[string]interface{}{}
+					}
+				})
+			})
+		},
+	},
+}
+
+// StorageMigrationReport riassume l'esito della migrazione dello schema dei file JSON
+type StorageMigrationReport struct {
+	Dir         string                   `json:"dir"`
+	StartedAt   time.Time                `json:"started_at"`
+	CompletedAt time.Time                `json:"completed_at"`
+	Scanned     int                      `json:"scanned"`
+	UpToDate    int                      `json:"up_to_date"`
+	Migrated    []StorageMigratedFile    `json:"migrated"`
+	Failed      []StorageMigrationFailed `json:"failed"`
+}
+
+// StorageMigratedFile descrive un file aggiornato a una nuova versione dello schema
+type StorageMigratedFile struct {
+	File        string `json:"file"`
+	FromVersion int    `json:"from_version"`
+	ToVersion   int    `json:"to_version"`
+}
+
+// StorageMigrationFailed descrive un file che non è stato possibile migrare.
+// I file corrotti vengono spostati in QuarantinedTo
+type StorageMigrationFailed struct {
+	File          string `json:"file"`
+	Error         string `json:"error"`
+	QuarantinedTo string `json:"quarantined_to,omitempty"`
+}
+
+// UpgradeMenuJSON decodifica un menu salvato su file applicando gli step di
+// schema mancanti. Restituisce il menu aggiornato e la versione di partenza
+func UpgradeMenuJSON(data []byte) (*models.Menu, int, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, 0, fmt.Errorf("%w: errore decode menu: %v", ErrCorruptFile, err)
+	}
+	if id, _ := raw["id"].(string); id == "" {
+		return nil, 0, fmt.Errorf("%w: menu senza id", ErrCorruptFile)
+	}
+
+	fromVersion := 0
+	if v, ok := raw["schema_version"].(float64); ok {
+		fromVersion = int(v)
+	}
+	if fromVersion > models.MenuSchemaVersion {
+		return nil, fromVersion, fmt.Errorf("versione schema %d più recente di quella supportata (%d)", fromVersion, models.MenuSchemaVersion)
+	}
+
+	for _, step := range menuSchemaSteps {
+		if step.Version > fromVersion {
+			step.Apply(raw)
+		}
+	}
+	raw["schema_version"] = models.MenuSchemaVersion
+
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fromVersion, fmt.Errorf("errore encode menu: %v", err)
+	}
+
+	var menu models.Menu
+	if err := json.Unmarshal(upgraded, &menu); err != nil {
+		return nil, fromVersion, fmt.Errorf("errore decode menu aggiornato: %v", err)
+	}
+
+	return &menu, fromVersion, nil
+}
+
+// LoadMenuFile legge un menu da file aggiornandolo in memoria all'ultima
+// versione dello schema. Il file su disco non viene modificato; se è illeggibile
+// l'errore avvolge ErrCorruptFile
+func LoadMenuFile(filename string) (*models.Menu, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	menu, _, err := UpgradeMenuJSON(data)
+	return menu, err
+}
+
+// MigrateStorageSchema aggiorna tutti i file menu_*.json presenti in dir
+// all'ultima versione dello schema, riscrivendoli in modo atomico
+func MigrateStorageSchema(dir string) (*StorageMigrationReport, error) {
+	report := &StorageMigrationReport{
+		Dir:       dir,
+		StartedAt: time.Now(),
+		Migrated:  []StorageMigratedFile{},
+		Failed:    []StorageMigrationFailed{},
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "menu_*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura storage: %v", err)
+	}
+
+	// Un crash durante WriteFileAtomic lascia solo il file temporaneo: l'originale è intatto
+	removeStaleTempFiles(dir)
+
+	for _, filename := range files {
+		report.Scanned++
+
+		if err := migrateMenuFile(filename, report); err != nil {
+			failed := StorageMigrationFailed{
+				File:  filename,
+				Error: err.Error(),
+			}
+			if errors.Is(err, ErrCorruptFile) {
+				failed.QuarantinedTo, _ = QuarantineCorruptFile(filename, err)
+			}
+			report.Failed = append(report.Failed, failed)
+			log.Printf("⚠️  Migrazione schema fallita per %s: %v", filename, err)
+		}
+	}
+
+	report.CompletedAt = time.Now()
+	log.Printf("📊 Schema storage: %d file analizzati, %d migrati, %d già aggiornati, %d errori",
+		report.Scanned, len(report.Migrated), report.UpToDate, len(report.Failed))
+
+	return report, nil
+}
+
+// migrateMenuFile aggiorna un singolo file e registra l'esito nel report
+func migrateMenuFile(filename string, report *StorageMigrationReport) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	menu, fromVersion, err := UpgradeMenuJSON(data)
+	if err != nil {
+		return err
+	}
+
+	if fromVersion == models.MenuSchemaVersion {
+		report.UpToDate++
+		return nil
+	}
+
+	upgraded, err := json.MarshalIndent(menu, "", "  ")
+	if err != nil {
+		return fmt.Errorf("errore encode menu: %v", err)
+	}
+
+	if err := WriteFileAtomic(filename, upgraded, 0644); err != nil {
+		return err
+	}
+
+	report.Migrated = append(report.Migrated, StorageMigratedFile{
+		File:        filename,
+		FromVersion: fromVersion,
+		ToVersion:   models.MenuSchemaVersion,
+	})
+	log.Printf("✓ Schema aggiornato: %s (v%d → v%d)", filename, fromVersion, models.MenuSchemaVersion)
+
+	return nil
+}
+
+// WriteFileAtomic scrive su un file temporaneo nella stessa cartella, ne fa il
+// fsync e poi lo rinomina sul file di destinazione, così un crash non lascia
+// file troncati: dopo il riavvio si trova la versione precedente o quella nuova
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("errore creazione file temporaneo: %v", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op dopo il rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("errore scrittura file temporaneo: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("errore sync file temporaneo: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("errore chiusura file temporaneo: %v", err)
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		return fmt.Errorf("errore permessi file temporaneo: %v", err)
+	}
+
+	if err := os.Rename(tmpName, filename); err != nil {
+		return fmt.Errorf("errore rename file temporaneo: %v", err)
+	}
+	syncDir(filepath.Dir(filename))
+
+	return nil
+}
+
+// WriteJSONAtomic codifica v in JSON indentato e lo scrive con WriteFileAtomic
+func WriteJSONAtomic(filename string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("errore encode %s: %v", filepath.Base(filename), err)
+	}
+	return WriteFileAtomic(filename, data, 0644)
+}
+
+// ReadJSONFile decodifica il file JSON in v. Gli errori di decodifica avvolgono
+// ErrCorruptFile, quelli di lettura no
+func ReadJSONFile(filename string, v interface{}) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorruptFile, err)
+	}
+	return nil
+}
+
+// QuarantineCorruptFile sposta un file corrotto nella cartella corrupted accanto
+// allo storage, con un suffisso temporale, così non viene più caricato ma resta
+// disponibile per il recupero manuale. Restituisce il nuovo percorso
+func QuarantineCorruptFile(filename string, cause error) (string, error) {
+	dir := filepath.Join(filepath.Dir(filename), corruptDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Printf("⚠️  Impossibile creare la cartella di quarantena %s: %v", dir, err)
+		return "", err
+	}
+
+	dst := filepath.Join(dir, fmt.Sprintf("%s.%s", filepath.Base(filename), time.Now().Format("20060102-150405")))
+	if err := os.Rename(filename, dst); err != nil {
+		log.Printf("⚠️  Impossibile mettere in quarantena %s: %v", filename, err)
+		return "", err
+	}
+
+	log.Printf("🚧 File corrotto messo in quarantena: %s → %s (%v)", filename, dst, cause)
+	return dst, nil
+}
+
+// removeStaleTempFiles elimina i file temporanei lasciati da scritture interrotte
+func removeStaleTempFiles(dir string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp-*"))
+	for _, tmp := range matches {
+		if err := os.Remove(tmp); err == nil {
+			log.Printf("🧹 Rimosso file temporaneo orfano: %s", tmp)
+		}
+	}
+}
+
+// syncDir rende persistente il rename sulla cartella. È best effort: su alcuni
+// sistemi (Windows) le cartelle non si possono aprire per il sync
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+// forEachCategory invoca fn per ogni categoria della mappa grezza del menu
+func forEachCategory(menu map[string]interface{}, fn func(int, map[string]interface{})) {
+	categories, _ := menu["categories"].([]interface{})
+	for i, c := range categories {
+		if category, ok := c.(map[string]interface{}); ok {
+			fn(i, category)
+		}
+	}
+}
+
+// forEachItem invoca fn per ogni piatto della mappa grezza di una categoria
+func forEachItem(category map[string]interface{}, fn func(int, map[string]interface{})) {
+	items, _ := category["items"].([]interface{})
+	for i, it := range items {
+		if item, ok := it.(map[string]interface{}); ok {
+			fn(i, item)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"qr-menu/models"
+)
+
+const legacyMenuJSON = `{
+  "id": "m1",
+  "restaurant_id": "r1",
+  "name": "Pranzo",
+  "categories": [
+    {"id": "c1", "name": "Primi", "items": [{"id": "i1", "name": "Carbonara", "price": 12}]},
+    {"id": "c2", "name": "Secondi", "items": [{"id": "i2", "name": "Tagliata", "price": 18}, {"id": "i3", "name": "Branzino", "price": 20}]}
+  ]
+}`
+
+// TestUpgradeMenuJSON tests that legacy menus are upgraded to the current schema
+func TestUpgradeMenuJSON(t *testing.T) {
+	menu, from, err := UpgradeMenuJSON([]byte(legacyMenuJSON))
+	if err != nil {
+		t.Fatalf("UpgradeMenuJSON failed: %v", err)
+	}
+
+	if from != 0 {
+		t.Errorf("Expected from version 0, got %d", from)
+	}
+	if menu.SchemaVersion != models.MenuSchemaVersion {
+		t.Errorf("Expected schema version %d, got %d", models.MenuSchemaVersion, menu.SchemaVersion)
+	}
+	if menu.Categories[1].DisplayOrder != 1 {
+		t.Errorf("Expected category display order 1, got %d", menu.Categories[1].DisplayOrder)
+	}
+	if menu.Categories[1].Items[1].DisplayOrder != 1 {
+		t.Errorf("Expected item display order 1, got %d", menu.Categories[1].Items[1].DisplayOrder)
+	}
+	if menu.Categories[0].Items[0].Tags == nil {
+		t.Error("Expected tags to be initialized")
+	}
+}
+
+// TestUpgradeMenuJSONRejectsNewerSchema tests that files from a newer release are not downgraded
+func TestUpgradeMenuJSONRejectsNewerSchema(t *testing.T) {
+	if _, _, err := UpgradeMenuJSON([]byte(`{"id": "m1", "schema_version": 999}`)); err == nil {
+		t.Error("Expected error for newer schema version")
+	}
+}
+
+// TestMigrateStorageSchema tests that files are rewritten once and reported
+func TestMigrateStorageSchema(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "menu_m1.json")
+	if err := os.WriteFile(filename, []byte(legacyMenuJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "menu_bad.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// File temporaneo lasciato da una scrittura interrotta
+	if err := os.WriteFile(filename+".tmp-123", []byte(`{"id": "m1"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := MigrateStorageSchema(dir)
+	if err != nil {
+		t.Fatalf("MigrateStorageSchema failed: %v", err)
+	}
+	if len(report.Migrated) != 1 || len(report.Failed) != 1 {
+		t.Fatalf("Expected 1 migrated and 1 failed, got %d and %d", len(report.Migrated), len(report.Failed))
+	}
+	quarantined := report.Failed[0].QuarantinedTo
+	if filepath.Dir(quarantined) != filepath.Join(dir, corruptDirName) {
+		t.Errorf("Expected corrupt file in quarantine, got %q", quarantined)
+	}
+	if _, err := os.Stat(quarantined); err != nil {
+		t.Errorf("Expected quarantined copy: %v", err)
+	}
+
+	// Una seconda esecuzione non deve riscrivere nulla
+	report, err = MigrateStorageSchema(dir)
+	if err != nil {
+		t.Fatalf("MigrateStorageSchema failed: %v", err)
+	}
+	if len(report.Migrated) != 0 || report.UpToDate != 1 || len(report.Failed) != 0 {
+		t.Errorf("Expected file to be up to date, got %d migrated, %d up to date and %d failed", len(report.Migrated), report.UpToDate, len(report.Failed))
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp-*"))
+	if len(matches) != 0 {
+		t.Errorf("Expected no leftover temp files, found %v", matches)
+	}
+}
+
+// TestUpgradeMenuJSONCorrupt tests that unreadable menus are reported as corrupt
+func TestUpgradeMenuJSONCorrupt(t *testing.T) {
+	for _, data := range []string{"", `{"id": "m1", "categories": [`, `{"name": "Pranzo"}`} {
+		if _, _, err := UpgradeMenuJSON([]byte(data)); !errors.Is(err, ErrCorruptFile) {
+			t.Errorf("UpgradeMenuJSON(%q): expected ErrCorruptFile, got %v", data, err)
+		}
+	}
+	if _, _, err := UpgradeMenuJSON([]byte(`{"id": "m1", "schema_version": 999}`)); errors.Is(err, ErrCorruptFile) {
+		t.Error("A newer schema is not a corrupt file")
+	}
+}
+
+// TestWriteJSONAtomic tests that files are replaced in one step and read back
+func TestWriteJSONAtomic(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "restaurant_r1.json")
+	for _, name := range []string{"Trattoria", "Trattoria da Mario"} {
+		if err := WriteJSONAtomic(filename, models.Restaurant{ID: "r1", Name: name}); err != nil {
+			t.Fatalf("WriteJSONAtomic failed: %v", err)
+		}
+	}
+
+	var restaurant models.Restaurant
+	if err := ReadJSONFile(filename, &restaurant); err != nil {
+		t.Fatalf("ReadJSONFile failed: %v", err)
+	}
+	if restaurant.Name != "Trattoria da Mario" {
+		t.Errorf("Expected last write, got %q", restaurant.Name)
+	}
+
+	matches, _ := filepath.Glob(filename + ".tmp-*")
+	if len(matches) != 0 {
+		t.Errorf("Expected no leftover temp files, found %v", matches)
+	}
+}
+
+// TestReadJSONFileCorrupt tests that truncated files are told apart from missing ones
+func TestReadJSONFileCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "session_s1.json")
+	if err := os.WriteFile(filename, []byte(`{"id": "s1", "user_`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var session models.Session
+	err := ReadJSONFile(filename, &session)
+	if !errors.Is(err, ErrCorruptFile) {
+		t.Fatalf("Expected ErrCorruptFile, got %v", err)
+	}
+	if err := ReadJSONFile(filepath.Join(dir, "missing.json"), &session); errors.Is(err, ErrCorruptFile) || !os.IsNotExist(err) {
+		t.Errorf("Expected not exist error, got %v", err)
+	}
+
+	dst, qerr := QuarantineCorruptFile(filename, err)
+	if qerr != nil {
+		t.Fatalf("QuarantineCorruptFile failed: %v", qerr)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Error("Expected corrupt file to be moved")
+	}
+	if data, _ := os.ReadFile(dst); string(data) != `{"id": "s1", "user_` {
+		t.Errorf("Expected original content in quarantine, got %q", data)
+	}
+}
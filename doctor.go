@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"qr-menu/db"
+	"qr-menu/pkg/config"
+	"qr-menu/pkg/doctor"
+)
+
+// doctorTimeReference è il server il cui header Date viene usato per misurare lo
+// sfasamento dell'orologio (sovrascrivibile con DOCTOR_TIME_URL, "off" per saltare il controllo)
+const doctorTimeReference = "https://www.google.com"
+
+// runDoctor esegue "qr-menu doctor": valida configurazione, directory, URL pubblico,
+// certificati, email, database e orologio e stampa i risultati. Fallisce se almeno un
+// controllo è fallito
+func runDoctor(configPath string) error {
+	// I log di connessione del package db sporcherebbero il report
+	log.SetOutput(io.Discard)
+
+	fmt.Printf("qr-menu doctor (config: %s)\n\n", configPath)
+
+	settings, err := config.LoadFile(configPath)
+	if err != nil {
+		doctor.ConfigErrors(err).Print(os.Stdout)
+		return cliFail(errors.New("configurazione non valida"))
+	}
+
+	timeURL := os.Getenv("DOCTOR_TIME_URL")
+	if timeURL == "" {
+		timeURL = doctorTimeReference
+	} else if timeURL == "off" {
+		timeURL = ""
+	}
+
+	report := doctor.Run(context.Background(), settings, doctor.Options{
+		DBCheck:          db.CheckConnection,
+		TimeReferenceURL: timeURL,
+	})
+	report.Print(os.Stdout)
+
+	if report.HasErrors() {
+		return cliFail(errors.New("alcuni controlli sono falliti"))
+	}
+	return nil
+}
@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/i18n"
+	"qr-menu/pkg/mailer"
+	"qr-menu/pkg/metrics"
+	"qr-menu/pkg/phone"
+)
+
+// emailVerificationTTL è la validità del link di conferma per il cambio email
+const emailVerificationTTL = 24 * time.Hour
+
+// mailSender consegna le email transazionali (di norma la coda con retry davanti al
+// provider); finché non è configurato il messaggio viene solo registrato nei log
+var mailSender mailer.Mailer = mailer.Log{}
+
+// SetMailer imposta il mailer usato per le email transazionali (chiamato dall'initializer)
+func SetMailer(m mailer.Mailer) {
+	mailSender = m
+}
+
+// sendMail invia una email transazionale tramite il mailer configurato
+var sendMail = func(ctx context.Context, to, subject, body string) error {
+	return mailSender.Send(ctx, mailer.Message{To: to, Subject: subject, Body: body})
+}
+
+var notificationsSent = metrics.NewCounter("qrmenu_notifications_total",
+	"Notifications by message key and result (sent to the mailer or error).", "key", "result")
+
+// notifyUser invia una notifica email nella lingua dell'utente, renderizzando il
+// messaggio key del catalogo di localizzazione (con fallback sulla lingua di default)
+func notifyUser(ctx context.Context, to, locale, key string, data map[string]interface{}) (err error) {
+	defer func() {
+		result := "sent"
+		if err != nil {
+			result = "error"
+		}
+		notificationsSent.Inc(key, result)
+	}()
+
+	msg, err := i18n.Default().Render(locale, key, data)
+	if err != nil {
+		logger.ErrorCtx(ctx, "Errore nella localizzazione della notifica", map[string]interface{}{
+			"error":  err.Error(),
+			"key":    key,
+			"locale": locale,
+		})
+		return err
+	}
+	return sendMail(ctx, to, msg.Subject, msg.Body)
+}
+
+// getCurrentUser recupera l'utente loggato e la sua sessione
+func getCurrentUser(r *http.Request) (*models.User, *models.Session, error) {
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := db.MongoInstance.GetUserByID(ctx, session.UserID)
+	if err != nil || user == nil || !user.IsActive {
+		return nil, nil, fmt.Errorf("utente non trovato o disattivato")
+	}
+
+	return user, session, nil
+}
+
+// hashVerificationToken restituisce l'hash del token usato come chiave nel database
+func hashVerificationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AccountHandler mostra la pagina delle impostazioni account (username, email, URL pubblico)
+func AccountHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, session, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var restaurant *models.Restaurant
+	if session.RestaurantID != "" {
+		restaurant, _ = db.MongoInstance.GetRestaurantByID(ctx, session.RestaurantID)
+	}
+
+	sessions, err := listActiveSessions(ctx, user.ID, session.ID)
+	if err != nil {
+		logger.WarnCtx(r.Context(), "Errore nel recupero delle sessioni attive", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+	}
+
+	data := struct {
+		User        *models.User
+		Restaurant  *models.Restaurant
+		BaseURL     string
+		Locale      string
+		Events      []notificationEventRow
+		Sessions    []activeSession
+		Identities  []linkedIdentityRow
+		HasPassword bool
+		Digest      string
+		DigestHour  int
+		SMSEnabled  bool
+		Phone       string
+		Success     string
+		Error       string
+		CSRFToken   string
+	}{
+		User:        user,
+		Restaurant:  restaurant,
+		BaseURL:     getBaseURL(r),
+		Locale:      i18n.Default().Resolve(user.Locale),
+		Events:      notificationEventRows(user.Notifications),
+		Sessions:    sessions,
+		Identities:  linkedIdentityRows(user),
+		HasPassword: user.PasswordHash != "",
+		Digest:      user.Notifications.Digest,
+		DigestHour:  user.Notifications.DigestHour,
+		SMSEnabled:  smsSender != nil,
+		Phone:       formatPhone(user.Phone),
+		Success:     r.URL.Query().Get("success"),
+		Error:       r.URL.Query().Get("error"),
+		CSRFToken:   csrfToken(w, r),
+	}
+
+	renderTemplate(w, "account", data)
+}
+
+// ChangeUsernameHandler cambia lo username di login dopo aver verificato la password
+func ChangeUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, _, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	newUsername := strings.TrimSpace(r.FormValue("new_username"))
+	if len(newUsername) < 3 {
+		http.Redirect(w, r, "/account?error=username_invalid", http.StatusSeeOther)
+		return
+	}
+	if !checkPassword(user.PasswordHash, r.FormValue("password")) {
+		http.Redirect(w, r, "/account?error=wrong_password", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err = db.MongoInstance.UpdateUserUsername(ctx, user.ID, newUsername)
+	if err == db.ErrDuplicateUsername {
+		http.Redirect(w, r, "/account?error=username_taken", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel cambio username", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		http.Error(w, "Errore nel cambio username", http.StatusInternalServerError)
+		return
+	}
+
+	RecordAuditLogAsync("USERNAME_CHANGED", "user", user.ID, "", getClientIP(r), r.UserAgent(), "success")
+	notifyOwner(ctx, user, i18n.KeyUsernameChanged, map[string]interface{}{
+		"OldUsername": user.Username,
+		"NewUsername": newUsername,
+	})
+
+	http.Redirect(w, r, "/account?success=username_changed", http.StatusSeeOther)
+}
+
+// ChangeLocaleHandler imposta la lingua di email e notifiche dell'account
+func ChangeLocaleHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, _, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	locale := r.FormValue("locale")
+	if !i18n.Default().Supported(locale) {
+		http.Redirect(w, r, "/account?error=locale_invalid", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.UpdateUserLocale(ctx, user.ID, i18n.Default().Resolve(locale)); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel cambio lingua", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		http.Error(w, "Errore nel cambio lingua", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/account?success=locale_changed", http.StatusSeeOther)
+}
+
+// ChangePhoneHandler imposta il numero a cui inviare le notifiche SMS; vuoto lo rimuove.
+// I numeri senza prefisso internazionale sono considerati italiani
+func ChangePhoneHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, _, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	number := ""
+	if input := strings.TrimSpace(r.FormValue("phone")); input != "" {
+		if number = phone.Normalize(input, "39"); number == "" {
+			http.Redirect(w, r, "/account?error=phone_invalid", http.StatusSeeOther)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.UpdateUserPhone(ctx, user.ID, number); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel cambio numero di telefono", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		http.Error(w, "Errore nel cambio numero di telefono", http.StatusInternalServerError)
+		return
+	}
+
+	RecordAuditLogAsync("PHONE_CHANGED", "user", user.ID, "", getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/account?success=phone_changed", http.StatusSeeOther)
+}
+
+// formatPhone restituisce il numero normalizzato con il + iniziale, come va digitato
+func formatPhone(number string) string {
+	if number == "" {
+		return ""
+	}
+	return "+" + number
+}
+
+// ChangeEmailHandler avvia il cambio email: dopo la verifica della password invia
+// un link di conferma al nuovo indirizzo. L'email cambia solo dopo la conferma
+func ChangeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, _, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	newEmail := db.NormalizeCredential(r.FormValue("new_email"))
+	if !strings.Contains(newEmail, "@") || newEmail == user.EmailNormalized {
+		http.Redirect(w, r, "/account?error=email_invalid", http.StatusSeeOther)
+		return
+	}
+	if !checkPassword(user.PasswordHash, r.FormValue("password")) {
+		http.Redirect(w, r, "/account?error=wrong_password", http.StatusSeeOther)
+		return
+	}
+	baseURL, err := emailBaseURL()
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Email di verifica non inviata", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		http.Redirect(w, r, "/account?error=email_send_failed", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if existing, _ := db.MongoInstance.GetUserByEmail(ctx, newEmail); existing != nil {
+		http.Redirect(w, r, "/account?error=email_taken", http.StatusSeeOther)
+		return
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		http.Error(w, "Errore nella generazione del token", http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	verification := &models.EmailVerification{
+		ID:        hashVerificationToken(token),
+		UserID:    user.ID,
+		NewEmail:  newEmail,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(emailVerificationTTL),
+	}
+	if err := db.MongoInstance.CreateEmailVerification(ctx, verification); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio della verifica email", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		http.Error(w, "Errore nel cambio email", http.StatusInternalServerError)
+		return
+	}
+
+	verifyURL := fmt.Sprintf("%s/account/email/verify?token=%s", baseURL, url.QueryEscape(token))
+	if err := notifyUser(ctx, newEmail, user.Locale, i18n.KeyEmailVerification, map[string]interface{}{
+		"VerifyURL": verifyURL,
+	}); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'invio della email di verifica", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		http.Redirect(w, r, "/account?error=email_send_failed", http.StatusSeeOther)
+		return
+	}
+
+	// Avvisa anche il vecchio indirizzo
+	notifyOwner(ctx, user, i18n.KeyEmailChangeRequested, nil)
+
+	RecordAuditLogAsync("EMAIL_CHANGE_REQUESTED", "user", user.ID, "", getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/account?success=email_verification_sent", http.StatusSeeOther)
+}
+
+// VerifyEmailChangeHandler conferma il cambio email tramite il token ricevuto
+func VerifyEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Redirect(w, r, "/account?error=invalid_token", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	verification, err := db.MongoInstance.ConsumeEmailVerification(ctx, hashVerificationToken(token))
+	if err != nil || verification == nil || time.Now().After(verification.ExpiresAt) {
+		http.Redirect(w, r, "/account?error=invalid_token", http.StatusSeeOther)
+		return
+	}
+
+	err = db.MongoInstance.UpdateUserEmail(ctx, verification.UserID, verification.NewEmail)
+	if err == db.ErrDuplicateEmail {
+		http.Redirect(w, r, "/account?error=email_taken", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel cambio email", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": verification.UserID,
+		})
+		http.Error(w, "Errore nel cambio email", http.StatusInternalServerError)
+		return
+	}
+
+	RecordAuditLogAsync("EMAIL_CHANGED", "user", verification.UserID, "", getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/account?success=email_changed", http.StatusSeeOther)
+}
+
+// ChangeRestaurantUsernameHandler cambia l'URL pubblico (/r/{username}) del ristorante.
+// Il vecchio username resta come redirect, così i QR già stampati continuano a funzionare
+func ChangeRestaurantUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, _, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	if !checkPassword(user.PasswordHash, r.FormValue("password")) {
+		http.Redirect(w, r, "/account?error=wrong_password", http.StatusSeeOther)
+		return
+	}
+
+	newUsername := normalizeRestaurantUsername(r.FormValue("new_restaurant_username"))
+	if newUsername == restaurant.Username {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Lo username non deve essere usato (ora o in passato) da un altro ristorante
+	if other, _ := db.MongoInstance.GetRestaurantByPreviousUsername(ctx, newUsername); other != nil && other.ID != restaurant.ID {
+		http.Redirect(w, r, "/account?error=restaurant_username_taken", http.StatusSeeOther)
+		return
+	}
+
+	oldUsername := restaurant.Username
+	err = db.MongoInstance.ChangeRestaurantUsername(ctx, restaurant, newUsername)
+	if err == db.ErrDuplicateRestaurantUsername {
+		http.Redirect(w, r, "/account?error=restaurant_username_taken", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel cambio username ristorante", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nel cambio URL pubblico", http.StatusInternalServerError)
+		return
+	}
+
+	// Rigenera il QR code e aggiorna l'URL pubblico dei menu
+	refreshRestaurantQRCode(ctx, restaurant, getBaseURL(r))
+
+	logger.InfoCtx(r.Context(), "Username ristorante cambiato", map[string]interface{}{
+		"restaurant_id": restaurant.ID,
+		"old_username":  oldUsername,
+		"new_username":  newUsername,
+	})
+	RecordAuditLogAsync("RESTAURANT_USERNAME_CHANGED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+
+	http.Redirect(w, r, "/account?success=restaurant_username_changed", http.StatusSeeOther)
+}
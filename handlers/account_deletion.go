@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"qr-menu/analytics"
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/billing"
+	"qr-menu/pkg/i18n"
+)
+
+// accountDeletionGracePeriod è il tempo prima della cancellazione definitiva dei dati.
+// Nel frattempo i dati restano recuperabili contattando il supporto
+const accountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// subscriptionCanceler disdice gli abbonamenti presso il provider di billing; nil se Stripe
+// non è configurato, e allora un account con abbonamenti Stripe non si può cancellare
+var subscriptionCanceler billing.Canceler
+
+// SetSubscriptionCanceler imposta il provider per la disdetta degli abbonamenti (chiamato dall'initializer)
+func SetSubscriptionCanceler(canceler billing.Canceler) {
+	subscriptionCanceler = canceler
+}
+
+// DeleteAccountHandler mostra la pagina di cancellazione account, che propone prima l'export dei dati
+func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, _, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restaurants, _ := db.MongoInstance.GetRestaurantsByOwnerID(ctx, user.ID)
+
+	data := struct {
+		User        *models.User
+		Restaurants []models.Restaurant
+		GraceDays   int
+		Error       string
+		CSRFToken   string
+	}{
+		User:        user,
+		Restaurants: restaurants,
+		GraceDays:   int(accountDeletionGracePeriod.Hours() / 24),
+		Error:       r.URL.Query().Get("error"),
+		CSRFToken:   csrfToken(w, r),
+	}
+
+	renderTemplate(w, "delete_account", data)
+}
+
+// DeleteAccountPostHandler programma la cancellazione dell'account: disdice gli abbonamenti
+// presso il provider di billing, disattiva subito utente, ristoranti e QR code e conferma via email
+func DeleteAccountPostHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, _, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(r.FormValue("confirm")) != "ELIMINA" {
+		http.Redirect(w, r, "/account/delete?error=confirm", http.StatusSeeOther)
+		return
+	}
+	if !checkPassword(user.PasswordHash, r.FormValue("password")) {
+		http.Redirect(w, r, "/account/delete?error=wrong_password", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	restaurants, err := db.MongoInstance.GetRestaurantsByOwnerID(ctx, user.ID)
+	if err != nil {
+		http.Error(w, "Errore nella cancellazione dell'account", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	deletion := &models.AccountDeletion{
+		ID:            user.ID,
+		Email:         user.Email,
+		Locale:        user.Locale,
+		RestaurantIDs: make([]string, 0, len(restaurants)),
+		Reason:        strings.TrimSpace(sanitizeInput(r.FormValue("reason"))),
+		Status:        models.AccountDeletionScheduled,
+		RequestedAt:   now,
+		ScheduledAt:   now.Add(accountDeletionGracePeriod),
+	}
+	names := make([]string, 0, len(restaurants))
+	for _, restaurant := range restaurants {
+		deletion.RestaurantIDs = append(deletion.RestaurantIDs, restaurant.ID)
+		names = append(names, restaurant.Name)
+	}
+
+	// Gli abbonamenti vanno disdetti prima di chiudere l'account: se il provider non risponde
+	// l'utente resta attivo e può riprovare, invece di continuare a pagare un account chiuso
+	canceled, err := cancelProviderSubscriptions(ctx, deletion.RestaurantIDs)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella disdetta degli abbonamenti", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		http.Redirect(w, r, "/account/delete?error=billing", http.StatusSeeOther)
+		return
+	}
+
+	if err := db.MongoInstance.ScheduleAccountDeletion(ctx, deletion); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella programmazione della cancellazione account", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		http.Error(w, "Errore nella cancellazione dell'account", http.StatusInternalServerError)
+		return
+	}
+
+	logger.InfoCtx(r.Context(), "Cancellazione account programmata", map[string]interface{}{
+		"user_id":      user.ID,
+		"restaurants":  len(deletion.RestaurantIDs),
+		"scheduled_at": deletion.ScheduledAt,
+	})
+	RecordAuditLogAsync("ACCOUNT_DELETION_SCHEDULED", "user", user.ID, "", getClientIP(r), r.UserAgent(), "success")
+
+	notifyOwner(ctx, user, i18n.KeyAccountDeletionPending, map[string]interface{}{
+		"ScheduledAt": deletion.ScheduledAt,
+	})
+
+	// Cancella il cookie di sessione (le sessioni su MongoDB sono già state eliminate)
+	if session, err := sessionStore().Get(r, SessionCookieName); err == nil {
+		session.Values["session_id"] = ""
+		session.Options.MaxAge = -1
+		session.Save(r, w)
+	}
+
+	data := struct {
+		Username              string
+		Email                 string
+		Restaurants           []string
+		CanceledSubscriptions int
+		ScheduledAt           time.Time
+	}{
+		Username:              user.Username,
+		Email:                 user.Email,
+		Restaurants:           names,
+		CanceledSubscriptions: canceled,
+		ScheduledAt:           deletion.ScheduledAt,
+	}
+	renderTemplate(w, "account_deleted", data)
+}
+
+// cancelProviderSubscriptions disdice presso il provider di billing gli abbonamenti ancora
+// aperti dei ristoranti e li segna come cancellati. Gli abbonamenti senza riferimento al
+// provider (prove gratuite, piano free) non generano addebiti e restano a ScheduleAccountDeletion.
+// Restituisce il numero di abbonamenti disdetti
+func cancelProviderSubscriptions(ctx context.Context, restaurantIDs []string) (int, error) {
+	subs, err := db.MongoInstance.GetOpenSubscriptions(ctx, restaurantIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	canceled := 0
+	for _, sub := range subs {
+		if sub.ProviderSubscriptionID == "" {
+			continue
+		}
+		if sub.Provider == "stripe" {
+			if subscriptionCanceler == nil {
+				return canceled, fmt.Errorf("abbonamento %s: provider di billing non configurato", sub.ID)
+			}
+			if err := subscriptionCanceler.CancelSubscription(ctx, sub.ProviderSubscriptionID); err != nil {
+				return canceled, fmt.Errorf("errore disdetta abbonamento %s: %w", sub.ID, err)
+			}
+		}
+		if err := db.MongoInstance.SetSubscriptionCanceled(ctx, sub.ID, time.Now()); err != nil {
+			return canceled, err
+		}
+		canceled++
+	}
+	return canceled, nil
+}
+
+// renderRestaurantUnavailable mostra la pagina pubblica per un ristorante chiuso o eliminato
+func renderRestaurantUnavailable(w http.ResponseWriter) {
+	data := struct {
+		Title   string
+		Message string
+	}{
+		Title:   "Ristorante non più disponibile",
+		Message: "Questo ristorante non utilizza più QR Menu. Chiedi al personale il menu aggiornato.",
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusGone)
+	renderTemplate(w, "404", data)
+}
+
+// ProcessScheduledAccountDeletions elimina definitivamente gli account la cui
+// cancellazione è scaduta. Restituisce il numero di account eliminati
+func ProcessScheduledAccountDeletions(ctx context.Context) int {
+	deletions, err := db.MongoInstance.GetDueAccountDeletions(ctx, time.Now())
+	if err != nil {
+		logger.Error("Errore nella lettura delle cancellazioni programmate", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return 0
+	}
+
+	purged := 0
+	for _, deletion := range deletions {
+		if err := executeAccountDeletion(ctx, deletion); err != nil {
+			logger.Error("Errore nella cancellazione definitiva dell'account", map[string]interface{}{
+				"error":   err.Error(),
+				"user_id": deletion.ID,
+			})
+			continue
+		}
+
+		notifyUser(ctx, deletion.Email, deletion.Locale, i18n.KeyAccountDeleted, nil)
+		RecordAuditLogAsync("ACCOUNT_DELETED", "user", deletion.ID, "", "", "", "success")
+		purged++
+	}
+
+	if purged > 0 {
+		logger.Info("Cancellazioni account completate", map[string]interface{}{
+			"count": purged,
+		})
+	}
+	return purged
+}
+
+// executeAccountDeletion cancella definitivamente un account. Disdice prima gli abbonamenti
+// rimasti aperti presso il provider e revoca le credenziali (refresh token, API key,
+// sessioni, dispositivi), poi elimina i file dei ristoranti,
+// anonimizza statistiche e log di audit che restano come dati aggregati e infine elimina
+// i dati dal database. Ogni passo si può ripetere: se uno fallisce la cancellazione resta
+// programmata e viene ritentata al giro successivo del worker
+func executeAccountDeletion(ctx context.Context, deletion *models.AccountDeletion) error {
+	if _, err := cancelProviderSubscriptions(ctx, deletion.RestaurantIDs); err != nil {
+		return err
+	}
+	if err := db.MongoInstance.RevokeAccountCredentials(ctx, deletion, time.Now()); err != nil {
+		return err
+	}
+
+	files := 0
+	for _, restaurantID := range deletion.RestaurantIDs {
+		deleted, err := deleteRestaurantFiles(ctx, restaurantID)
+		if err != nil {
+			return err
+		}
+		files += deleted
+		analytics.GetAnalytics().AnonymizeRestaurant(restaurantID)
+	}
+
+	events, err := db.MongoInstance.AnonymizeAnalyticsEvents(ctx, deletion.RestaurantIDs)
+	if err != nil {
+		return fmt.Errorf("errore anonimizzazione eventi di analytics: %v", err)
+	}
+	logs, err := db.MongoInstance.AnonymizeAccountAuditLogs(ctx, deletion.ID, deletion.RestaurantIDs)
+	if err != nil {
+		return fmt.Errorf("errore anonimizzazione log di audit: %v", err)
+	}
+
+	// Menu e ristoranti vanno eliminati per ultimi: servono per trovare i file
+	if err := db.MongoInstance.PurgeAccount(ctx, deletion); err != nil {
+		return err
+	}
+
+	logger.Info("Account eliminato definitivamente", map[string]interface{}{
+		"user_id":          deletion.ID,
+		"restaurants":      len(deletion.RestaurantIDs),
+		"files":            files,
+		"analytics_events": events,
+		"audit_logs":       logs,
+	})
+	return nil
+}
+
+// deleteRestaurantFiles elimina i file di un ristorante: immagini dei piatti (anche nel
+// cestino), QR code e copie statiche dei menu. Restituisce il numero di file eliminati
+func deleteRestaurantFiles(ctx context.Context, restaurantID string) (int, error) {
+	menus, err := accountMenus(ctx, restaurantID)
+	if err != nil {
+		return 0, err
+	}
+	keys, err := accountBlobKeys(ctx, restaurantID, menus)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if err := blobStore.Delete(ctx, key); err != nil {
+			return 0, fmt.Errorf("errore eliminazione %s: %w", key, err)
+		}
+	}
+
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, restaurantID)
+	if err != nil {
+		return 0, err
+	}
+	if restaurant != nil {
+		removeMenuSnapshots(restaurant.Username, menus)
+	}
+	return len(keys), nil
+}
+
+// accountMenus restituisce tutti i menu di un ristorante, compresi quelli nel cestino
+func accountMenus(ctx context.Context, restaurantID string) ([]*models.Menu, error) {
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := db.MongoInstance.GetDeletedMenus(ctx, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	return append(menus, deleted...), nil
+}
+
+// accountBlobKeys restituisce i file di un ristorante nel blob store: quelli del backup
+// (QR code e immagini dei piatti) più le immagini dei piatti nel cestino
+func accountBlobKeys(ctx context.Context, restaurantID string, menus []*models.Menu) ([]string, error) {
+	// I piatti nel cestino vengono trattati come una categoria in più
+	trashed := &models.Menu{Categories: []models.MenuCategory{{}}}
+	for _, menu := range menus {
+		for _, deleted := range menu.DeletedItems {
+			trashed.Categories[0].Items = append(trashed.Categories[0].Items, deleted.Item)
+		}
+	}
+	return restaurantBlobKeys(ctx, restaurantID, append(menus[:len(menus):len(menus)], trashed))
+}
+
+// RunAccountDeletionWorker esegue periodicamente le cancellazioni programmate
+// finché ctx non viene annullato. È bloccante: va avviato in una goroutine
+func RunAccountDeletionWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			ProcessScheduledAccountDeletions(runCtx)
+			cancel()
+		}
+	}
+}
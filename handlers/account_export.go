@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"time"
+
+	"qr-menu/analytics"
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/storage"
+)
+
+// accountExportFormat identifica la struttura dell'archivio di export, da incrementare
+// se cambiano i file o il loro contenuto
+const accountExportFormat = "qr-menu-account-export/1"
+
+// accountExport contiene i dati dell'account letti dal database prima di scrivere l'archivio.
+// Eventi di analytics, log di audit e file vengono invece letti in streaming durante la scrittura
+type accountExport struct {
+	ExportedAt  time.Time
+	Profile     accountExportProfile
+	Restaurants []models.Restaurant
+	Menus       []*models.Menu // Compresi quelli nel cestino
+	Specials    []*models.DailySpecial
+	Promotions  []*models.Promotion
+	History     []*models.MenuRevision
+	BlobKeys    []string
+}
+
+// accountExportProfile sono i dati personali dell'utente (profile.json)
+type accountExportProfile struct {
+	User        *models.User                  `json:"user"`
+	PushDevices []*models.PushToken           `json:"push_devices"`
+	WebPush     []*models.WebPushSubscription `json:"web_push_subscriptions"`
+}
+
+// accountExportManifest descrive l'archivio (manifest.json) ed elenca gli altri file
+type accountExportManifest struct {
+	Format      string    `json:"format"`
+	ExportedAt  time.Time `json:"exported_at"`
+	UserID      string    `json:"user_id"`
+	Restaurants []string  `json:"restaurants"`
+	Files       []string  `json:"files"`
+}
+
+// accountExportAuditLog è una voce di audit_logs.ndjson, con il ristorante a cui si riferisce
+type accountExportAuditLog struct {
+	RestaurantID string `json:"restaurant_id,omitempty"`
+	auditLogResponse
+}
+
+// AccountExportHandler scarica tutti i dati dell'account in un archivio ZIP (GDPR, portabilità):
+// profilo, ristoranti, menu (anche nel cestino), piatti del giorno, promozioni, storico delle
+// modifiche, log di audit, statistiche ed eventi di analytics per ristorante, immagini e QR code
+func AccountExportHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, _, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	export, err := loadAccountExport(ctx, user)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'esportazione dei dati dell'account", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		http.Error(w, "Errore nell'esportazione dei dati", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="qr-menu-export-%s.zip"`, export.ExportedAt.Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Nessun timeout breve: l'archivio può essere grande, si interrompe se il client chiude la connessione
+	archive := zip.NewWriter(w)
+	err = export.write(r.Context(), archive)
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		// Gli header sono già stati inviati: si può solo registrare l'interruzione
+		logger.ErrorCtx(r.Context(), "Export dell'account interrotto", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		return
+	}
+
+	RecordAuditLogAsync("ACCOUNT_EXPORTED", "user", user.ID, "", getClientIP(r), r.UserAgent(), "success")
+}
+
+// loadAccountExport legge dal database i dati dell'account da esportare
+func loadAccountExport(ctx context.Context, user *models.User) (*accountExport, error) {
+	export := &accountExport{
+		ExportedAt: time.Now(),
+		Profile:    accountExportProfile{User: user},
+		Menus:      []*models.Menu{},
+		Specials:   []*models.DailySpecial{},
+		Promotions: []*models.Promotion{},
+		History:    []*models.MenuRevision{},
+	}
+
+	var err error
+	if export.Restaurants, err = db.MongoInstance.GetRestaurantsByOwnerID(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	for _, restaurant := range export.Restaurants {
+		menus, err := accountMenus(ctx, restaurant.ID)
+		if err != nil {
+			return nil, err
+		}
+		export.Menus = append(export.Menus, menus...)
+
+		for _, menu := range menus {
+			revisions, _, err := db.MongoInstance.FindMenuRevisions(ctx, db.MenuRevisionFilter{MenuID: menu.ID}, db.ListOptions{Sort: []string{"created_at"}})
+			if err != nil {
+				return nil, err
+			}
+			export.History = append(export.History, revisions...)
+		}
+
+		specials, err := db.MongoInstance.GetDailySpecials(ctx, restaurant.ID, "0000-01-01", "9999-12-31")
+		if err != nil {
+			return nil, err
+		}
+		export.Specials = append(export.Specials, specials...)
+
+		promotions, _, err := db.MongoInstance.FindPromotions(ctx, db.PromotionFilter{RestaurantID: restaurant.ID}, db.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		export.Promotions = append(export.Promotions, promotions...)
+
+		keys, err := accountBlobKeys(ctx, restaurant.ID, menus)
+		if err != nil {
+			return nil, err
+		}
+		export.BlobKeys = append(export.BlobKeys, keys...)
+	}
+
+	if export.Profile.PushDevices, err = db.MongoInstance.GetPushTokensByUserID(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	if export.Profile.WebPush, err = db.MongoInstance.GetWebPushSubscriptionsByUserID(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// write scrive l'archivio: i dati già letti in JSON, log di audit ed eventi di analytics in
+// NDJSON (un oggetto per riga), i file del blob store sotto files/<chiave> e per ultimo
+// manifest.json con l'elenco dei file
+func (e *accountExport) write(ctx context.Context, archive *zip.Writer) error {
+	manifest := accountExportManifest{
+		Format:     accountExportFormat,
+		ExportedAt: e.ExportedAt,
+		UserID:     e.Profile.User.ID,
+	}
+	create := func(name string) (io.Writer, error) {
+		manifest.Files = append(manifest.Files, name)
+		return archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: e.ExportedAt})
+	}
+	writeJSON := func(name string, v interface{}) error {
+		f, err := create(name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+
+	restaurantIDs := make([]string, 0, len(e.Restaurants))
+	for _, restaurant := range e.Restaurants {
+		restaurantIDs = append(restaurantIDs, restaurant.ID)
+	}
+	manifest.Restaurants = restaurantIDs
+
+	for _, doc := range []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", e.Profile},
+		{"restaurants.json", e.Restaurants},
+		{"menus.json", e.Menus},
+		{"daily_specials.json", e.Specials},
+		{"promotions.json", e.Promotions},
+		{"menu_history.json", e.History},
+	} {
+		if err := writeJSON(doc.name, doc.data); err != nil {
+			return err
+		}
+	}
+
+	f, err := create("audit_logs.ndjson")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	err = db.MongoInstance.StreamAccountAuditLogs(ctx, e.Profile.User.ID, restaurantIDs, func(entry *db.AuditLog) error {
+		return encoder.Encode(accountExportAuditLog{RestaurantID: entry.RestaurantID, auditLogResponse: toAuditLogResponse(entry)})
+	})
+	if err != nil {
+		return fmt.Errorf("errore export log di audit: %w", err)
+	}
+
+	for _, restaurantID := range restaurantIDs {
+		stats, err := analytics.GetAnalytics().MarshalRestaurantStats(restaurantID)
+		if err != nil {
+			return err
+		}
+		f, err := create(path.Join("analytics", restaurantID, "stats.json"))
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(stats); err != nil {
+			return err
+		}
+
+		// Gli eventi sono quelli dei visitatori del menu: come nell'export analytics,
+		// IP e User-Agent completi non vengono esposti
+		if f, err = create(path.Join("analytics", restaurantID, "events.ndjson")); err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		err = db.MongoInstance.StreamAnalyticsEvents(ctx, db.AnalyticsEventFilter{RestaurantID: restaurantID}, func(event *db.AnalyticsEvent) error {
+			return encoder.Encode(toAnalyticsEventResponse(event))
+		})
+		if err != nil {
+			return fmt.Errorf("errore export eventi di analytics: %w", err)
+		}
+	}
+
+	for _, key := range e.BlobKeys {
+		if err := copyBlobToArchive(ctx, key, create); err != nil {
+			return err
+		}
+	}
+
+	f, err = archive.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: e.ExportedAt})
+	if err != nil {
+		return err
+	}
+	encoder = json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
+
+// copyBlobToArchive copia nell'archivio, sotto files/<chiave>, il file del blob store con la
+// chiave indicata. I file elencati ma non più presenti vengono saltati
+func copyBlobToArchive(ctx context.Context, key string, create func(name string) (io.Writer, error)) error {
+	blob, err := blobStore.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("errore lettura %s: %w", key, err)
+	}
+	defer blob.Close()
+
+	f, err := create(path.Join("files", key))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, blob)
+	return err
+}
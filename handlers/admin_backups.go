@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"qr-menu/backup"
+	"qr-menu/db"
+	"qr-menu/logger"
+	httputil "qr-menu/pkg/http"
+)
+
+// AdminListBackupsHandler elenca i backup del blob store e di ogni destinazione remota
+// (GET /api/admin/backups). Una destinazione irraggiungibile riporta l'errore al posto
+// dell'elenco, senza nascondere le altre
+func AdminListBackupsHandler(w http.ResponseWriter, r *http.Request) {
+	bm := backup.GetBackupManager()
+	local, err := bm.ListBackups()
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore lettura backup locali", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nella lettura dei backup")
+		return
+	}
+
+	targets := map[string]interface{}{}
+	for _, name := range bm.TargetNames() {
+		backups, err := bm.ListTargetBackups(name)
+		if err != nil {
+			targets[name] = map[string]string{"error": err.Error()}
+			continue
+		}
+		targets[name] = map[string]interface{}{"backups": backups}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.JSON(w, http.StatusOK, map[string]interface{}{
+		"local":   local,
+		"targets": targets,
+	})
+}
+
+// AdminCreateBackupHandler avvia un backup manuale (POST /api/backup/create, anche come
+// POST /api/admin/backups). Con ?restaurant_id= salva solo i dati di quel ristorante, con
+// ?mode=incremental solo i file cambiati dall'ultimo backup. Il backup può durare minuti: la
+// richiesta termina subito e l'esito finisce nei log e nell'audit log
+func AdminCreateBackupHandler(w http.ResponseWriter, r *http.Request) {
+	restaurantID := r.URL.Query().Get("restaurant_id")
+	mode := r.URL.Query().Get("mode")
+	if mode != "" && mode != backup.KindFull && mode != backup.KindIncremental {
+		httputil.BadRequest(w, "Modalità di backup non valida: usare full o incremental")
+		return
+	}
+	if restaurantID != "" {
+		if mode == backup.KindIncremental {
+			httputil.BadRequest(w, "I backup di un ristorante sono sempre completi")
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, restaurantID)
+		cancel()
+		if err != nil {
+			httputil.InternalServerError(w, "Errore nella lettura del ristorante")
+			return
+		}
+		if restaurant == nil {
+			httputil.NotFound(w, "Ristorante")
+			return
+		}
+	}
+
+	ip, userAgent := getClientIP(r), r.UserAgent()
+	go func() {
+		bm := backup.GetBackupManager()
+		var backupID string
+		var err error
+		switch {
+		case restaurantID != "":
+			backupID, err = bm.CreateRestaurantBackup(restaurantID)
+		case mode == backup.KindIncremental:
+			backupID, err = bm.CreateIncrementalBackup()
+		default:
+			backupID, err = bm.CreateBackup()
+		}
+		status := "success"
+		if err != nil {
+			status = "failure"
+		}
+		RecordAuditLogAsync("BACKUP_REQUESTED", "backup", backupID, restaurantID, ip, userAgent, status)
+	}()
+	httputil.Accepted(w, "Backup avviato", map[string]string{
+		"restaurant_id": restaurantID,
+		"mode":          mode,
+	})
+}
+
+// AdminDownloadBackupHandler scarica l'archivio di un backup
+// (GET /api/admin/backups/{id}/download?target=). Senza target l'archivio viene letto dal
+// blob store o, se assente, dalla prima destinazione remota che lo conserva
+func AdminDownloadBackupHandler(w http.ResponseWriter, r *http.Request) {
+	backupID := mux.Vars(r)["id"]
+	if !backup.ValidBackupID(backupID) {
+		httputil.BadRequest(w, "ID backup non valido")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Minute)
+	defer cancel()
+	archive, source, err := backup.GetBackupManager().OpenBackup(ctx, backupID, r.URL.Query().Get("target"))
+	if err != nil {
+		logger.WarnCtx(r.Context(), "Download backup non riuscito", map[string]interface{}{
+			"backup_id": backupID,
+			"error":     err.Error(),
+		})
+		httputil.NotFound(w, "Backup")
+		return
+	}
+	defer archive.Close()
+
+	RecordAuditLogAsync("BACKUP_DOWNLOADED", "backup", backupID, "", getClientIP(r), r.UserAgent(), "success")
+	if source == "" {
+		source = "local"
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, backupID))
+	w.Header().Set("X-Backup-Source", source)
+	w.Header().Set("Cache-Control", "no-store")
+	if _, err := io.Copy(w, archive); err != nil {
+		logger.WarnCtx(r.Context(), "Download backup interrotto", map[string]interface{}{
+			"backup_id": backupID,
+			"error":     err.Error(),
+		})
+	}
+}
+
+// AdminRestoreBackupHandler ripristina un backup (POST /api/admin/backups/{id}/restore o
+// POST /api/backup/restore?backup_id=), scaricandolo dalla destinazione remota indicata con
+// ?target= o, senza target, come il download. Per un backup di un ristorante (restaurant_id
+// facoltativo) i suoi dati vengono sostituiti con quelli del backup; per gli altri il backup
+// viene estratto in restoreDir/<id> senza toccare i dati in uso, che l'operatore sostituisce a
+// server fermo, limitato ai percorsi ?path= (ripetibile) o ai file di ?restaurant_id=.
+// Con ?dry_run=true la risposta elenca le modifiche previste senza applicarle; altrimenti il
+// restore avviene in background dopo una copia di sicurezza di quanto verrebbe sostituito
+func AdminRestoreBackupHandler(restoreDir string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		backupID := mux.Vars(r)["id"]
+		if backupID == "" {
+			backupID = query.Get("backup_id")
+		}
+		if !backup.ValidBackupID(backupID) {
+			httputil.BadRequest(w, "ID backup non valido")
+			return
+		}
+		opts := backup.RestoreOptions{
+			Target:       query.Get("target"),
+			Paths:        query["path"],
+			RestaurantID: query.Get("restaurant_id"),
+			DryRun:       query.Get("dry_run") == "true",
+		}
+		if opts.Target != "" && !slices.Contains(backup.GetBackupManager().TargetNames(), opts.Target) {
+			httputil.BadRequest(w, "Destinazione di backup sconosciuta: "+opts.Target)
+			return
+		}
+		for _, p := range opts.Paths {
+			if !filepath.IsLocal(p) {
+				httputil.BadRequest(w, "Percorso non valido: "+p)
+				return
+			}
+		}
+		kind, owner := backup.ParseBackupID(backupID)
+		if kind == backup.KindRestaurant {
+			if opts.RestaurantID == "" {
+				opts.RestaurantID = owner
+			}
+			if opts.RestaurantID != owner {
+				httputil.BadRequest(w, "Il backup appartiene al ristorante "+owner)
+				return
+			}
+			if len(opts.Paths) > 0 {
+				httputil.BadRequest(w, "Il restore di un ristorante non accetta path")
+				return
+			}
+		}
+
+		restore := func() (*backup.RestoreResult, error) {
+			if kind == backup.KindRestaurant {
+				return backup.GetBackupManager().RestoreRestaurant(backupID, opts.RestaurantID, opts)
+			}
+			return backup.GetBackupManager().Restore(backupID, restoreDir, opts)
+		}
+
+		if opts.DryRun {
+			result, err := restore()
+			if err != nil {
+				logger.WarnCtx(r.Context(), "Simulazione restore non riuscita", map[string]interface{}{
+					"backup_id": backupID,
+					"error":     err.Error(),
+				})
+				httputil.BadRequest(w, "Simulazione restore non riuscita: "+err.Error())
+				return
+			}
+			w.Header().Set("Cache-Control", "no-store")
+			httputil.JSON(w, http.StatusOK, result)
+			return
+		}
+
+		ip, userAgent := getClientIP(r), r.UserAgent()
+		go func() {
+			status := "success"
+			result, err := restore()
+			if err != nil {
+				logger.Error("Restore backup richiesto da admin non riuscito", map[string]interface{}{
+					"backup_id":     backupID,
+					"target":        opts.Target,
+					"restaurant_id": opts.RestaurantID,
+					"error":         err.Error(),
+				})
+				status = "failure"
+			} else if result.Snapshot != "" {
+				logger.Info("Copia di sicurezza creata prima del restore", map[string]interface{}{
+					"backup_id": backupID,
+					"snapshot":  result.Snapshot,
+				})
+			}
+			RecordAuditLogAsync("BACKUP_RESTORED", "backup", backupID, opts.RestaurantID, ip, userAgent, status)
+		}()
+
+		data := map[string]string{
+			"backup_id": backupID,
+			"target":    opts.Target,
+		}
+		if opts.RestaurantID != "" {
+			data["restaurant_id"] = opts.RestaurantID
+		}
+		if kind != backup.KindRestaurant {
+			data["path"] = filepath.Join(restoreDir, backupID)
+		}
+		httputil.Accepted(w, "Restore avviato", data)
+	}
+}
+
+// GetBackupStatusHandler restituisce lo stato dei backup (GET /api/backup/status): ultimo
+// backup, spazio occupato e, per ogni pianificazione, la prossima e l'ultima esecuzione
+func GetBackupStatusHandler(w http.ResponseWriter, r *http.Request) {
+	bm := backup.GetBackupManager()
+	status := bm.ScheduleStatus()
+
+	var lastBackup *time.Time
+	if last := bm.GetLastBackupTime(); !last.IsZero() {
+		lastBackup = &last
+	}
+	var nextRun *time.Time
+	for _, s := range status.Schedules {
+		if !s.NextRun.IsZero() && (nextRun == nil || s.NextRun.Before(*nextRun)) {
+			next := s.NextRun
+			nextRun = &next
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.JSON(w, http.StatusOK, map[string]interface{}{
+		"last_backup":       lastBackup,
+		"next_backup":       nextRun,
+		"total_size":        bm.GetTotalBackupSize(),
+		"scheduler_running": status.Running,
+		"custom_schedules":  status.Custom,
+		"schedules":         status.Schedules,
+	})
+}
+
+// AdminUpdateBackupSchedulesHandler sostituisce le pianificazioni dei backup
+// (PUT /api/backup/schedules, corpo {"schedules": [{"name", "cron", "kind"}]}). Le nuove
+// pianificazioni vengono salvate e prevalgono sulla configurazione anche dopo un riavvio
+func AdminUpdateBackupSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Schedules []backup.Schedule `json:"schedules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Richiesta non valida")
+		return
+	}
+	if len(req.Schedules) == 0 {
+		httputil.BadRequest(w, "Indicare almeno una pianificazione (per disattivare i backup usare backup.enabled)")
+		return
+	}
+	if err := backup.ValidateSchedules(req.Schedules); err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	updateBackupSchedules(w, r, func(bm *backup.BackupManager) error { return bm.SetSchedules(req.Schedules) })
+}
+
+// AdminResetBackupSchedulesHandler ripristina le pianificazioni dei backup della configurazione
+// (DELETE /api/backup/schedules)
+func AdminResetBackupSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	updateBackupSchedules(w, r, (*backup.BackupManager).ResetSchedules)
+}
+
+// updateBackupSchedules applica una modifica alle pianificazioni e risponde con il nuovo stato
+func updateBackupSchedules(w http.ResponseWriter, r *http.Request, update func(bm *backup.BackupManager) error) {
+	bm := backup.GetBackupManager()
+	if !bm.ScheduleStatus().Running {
+		httputil.Conflict(w, "Backup automatici disattivati (backup.enabled)")
+		return
+	}
+	if err := update(bm); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore aggiornamento pianificazioni backup", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nell'aggiornamento delle pianificazioni")
+		return
+	}
+
+	RecordAuditLogAsync("BACKUP_SCHEDULES_UPDATED", "backup", "", "", getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Pianificazioni aggiornate", bm.ScheduleStatus())
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"qr-menu/logger"
+	"qr-menu/pkg/config"
+)
+
+// RequireAdminToken protegge le API di amministrazione della piattaforma con un
+// bearer token statico. Se il token non è configurato le route rispondono 404
+func RequireAdminToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			logger.WarnCtx(r.Context(), "Accesso negato ad API admin", map[string]interface{}{
+				"ip":  getClientIP(r),
+				"url": r.URL.Path,
+			})
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// AdminConfigHandler restituisce la configurazione effettiva (default, config.yaml
+// e variabili d'ambiente) in sola lettura, con i segreti oscurati
+func AdminConfigHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := cfg.Redacted().AsMap()
+		if err != nil {
+			http.Error(w, "Errore nella lettura della configurazione", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(data)
+	}
+}
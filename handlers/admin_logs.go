@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"qr-menu/logger"
+	httputil "qr-menu/pkg/http"
+)
+
+// Limiti della ricerca nei log
+const (
+	adminLogsDefaultLimit = 200
+	adminLogsMaxLimit     = 1000
+)
+
+// AdminLogsHandler cerca nei file di log, dal più recente, le voci di una richiesta
+// (GET /api/admin/logs?request_id=&level=&from=&to=&limit=). from e to accettano
+// YYYY-MM-DD (giorni inclusi) o RFC3339; le voci sono restituite in ordine cronologico
+func AdminLogsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := logger.SearchQuery{
+		RequestID: strings.TrimSpace(q.Get("request_id")),
+		Level:     q.Get("level"),
+		Limit:     adminLogsDefaultLimit,
+	}
+
+	var err error
+	if value := q.Get("from"); value != "" {
+		if query.From, _, err = parseEventTime(value); err != nil {
+			httputil.BadRequest(w, "from non valido: "+value)
+			return
+		}
+	}
+	if value := q.Get("to"); value != "" {
+		var dateOnly bool
+		if query.To, dateOnly, err = parseEventTime(value); err != nil {
+			httputil.BadRequest(w, "to non valido: "+value)
+			return
+		}
+		if dateOnly {
+			query.To = query.To.AddDate(0, 0, 1)
+		}
+	}
+	if value := q.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			httputil.BadRequest(w, "limit non valido: "+value)
+			return
+		}
+		query.Limit = min(limit, adminLogsMaxLimit)
+	}
+	if query.RequestID == "" && query.From.IsZero() {
+		httputil.BadRequest(w, "Specificare request_id oppure from")
+		return
+	}
+
+	entries, err := logger.Search(query)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella ricerca nei log", map[string]interface{}{
+			"error":      err.Error(),
+			"request_id": query.RequestID,
+		})
+		httputil.InternalServerError(w, "Errore nella ricerca nei log")
+		return
+	}
+	if entries == nil {
+		entries = []logger.LogEntry{}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.JSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+)
+
+// analyticsConsentCookie è il cookie first-party con la scelta del visitatore sul banner delle
+// statistiche ("granted" o "denied"). Lo imposta il banner dei menu pubblici dei ristoranti
+// con le analytics privacy-first
+const analyticsConsentCookie = "qrm_consent"
+
+// trackingAllowed indica se per la richiesta si possono registrare IP, User-Agent e
+// identificativo del visitatore. Non lo è mai se il browser chiede di non essere tracciato
+// (DNT o Global Privacy Control); con le analytics privacy-first serve anche il consenso
+func trackingAllowed(r *http.Request, privacyFirst bool) bool {
+	if r.Header.Get("DNT") == "1" || r.Header.Get("Sec-GPC") == "1" {
+		return false
+	}
+	if !privacyFirst {
+		return true
+	}
+	cookie, err := r.Cookie(analyticsConsentCookie)
+	return err == nil && cookie.Value == "granted"
+}
+
+// SetPrivacyFirstAnalyticsHandler attiva o disattiva le analytics privacy-first del ristorante:
+// i menu pubblici mostrano il banner del consenso e senza consenso si contano solo le viste
+func SetPrivacyFirstAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	enabled := r.FormValue("privacy_first_analytics") == "on"
+	if enabled == restaurant.PrivacyFirstAnalytics {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.SetRestaurantPrivacyFirstAnalytics(ctx, restaurant, enabled); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'impostazione delle analytics privacy-first", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nell'impostazione delle statistiche", http.StatusInternalServerError)
+		return
+	}
+
+	RecordAuditLogAsync("RESTAURANT_PRIVACY_ANALYTICS_CHANGED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+
+	http.Redirect(w, r, "/account?success=privacy_analytics_changed", http.StatusSeeOther)
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"qr-menu/analytics"
+	"qr-menu/db"
+	"qr-menu/logger"
+	httputil "qr-menu/pkg/http"
+)
+
+// Limiti di paginazione per l'interrogazione degli eventi grezzi
+const (
+	analyticsEventsDefaultPerPage = 50
+	analyticsEventsMaxPerPage     = 500
+)
+
+// analyticsEventResponse è la rappresentazione pubblica di un evento grezzo.
+// IP e User-Agent completi non vengono esposti
+type analyticsEventResponse struct {
+	ID          string    `json:"id"`
+	Type        string    `json:"type"`
+	Timestamp   time.Time `json:"timestamp"`
+	MenuID      string    `json:"menu_id,omitempty"`
+	ItemID      string    `json:"item_id,omitempty"`
+	DeviceType  string    `json:"device_type,omitempty"`
+	Browser     string    `json:"browser,omitempty"`
+	OS          string    `json:"os,omitempty"`
+	Country     string    `json:"country,omitempty"`
+	City        string    `json:"city,omitempty"`
+	Platform    string    `json:"platform,omitempty"`
+	Referrer    string    `json:"referrer,omitempty"`
+	Source      string    `json:"source,omitempty"` // Solo per le scansioni: qr, nfc o link
+	LinkSource  string    `json:"link_source,omitempty"`
+	Campaign    string    `json:"campaign,omitempty"`
+	UTMSource   string    `json:"utm_source,omitempty"` // Solo per le visualizzazioni
+	UTMMedium   string    `json:"utm_medium,omitempty"`
+	UTMCampaign string    `json:"utm_campaign,omitempty"`
+}
+
+// analyticsEventCSVHeader sono le colonne dell'export CSV, nello stesso ordine di analyticsEventRecord
+var analyticsEventCSVHeader = []string{
+	"id", "type", "timestamp", "menu_id", "item_id", "device_type", "browser", "os", "country", "city", "platform", "referrer", "source",
+	"link_source", "campaign", "utm_source", "utm_medium", "utm_campaign",
+}
+
+// StoreAnalyticsEvent salva un evento grezzo nella collection analytics_events.
+// È il sink registrato su analytics.Analytics all'avvio
+func StoreAnalyticsEvent(ctx context.Context, event analytics.RawEvent) error {
+	if db.MongoInstance == nil {
+		return fmt.Errorf("database non disponibile")
+	}
+
+	data := map[string]interface{}{}
+	if event.ItemID != "" {
+		data["item_id"] = event.ItemID
+	}
+	if event.Platform != "" {
+		data["platform"] = event.Platform
+	}
+	if event.Referrer != "" {
+		data["referrer"] = event.Referrer
+	}
+	if event.Source != "" {
+		data["source"] = event.Source
+	}
+	if event.LinkSource != "" {
+		data["link_source"] = event.LinkSource
+	}
+	if event.Campaign != "" {
+		data["campaign"] = event.Campaign
+	}
+	if event.UTMSource != "" {
+		data["utm_source"] = event.UTMSource
+	}
+	if event.UTMMedium != "" {
+		data["utm_medium"] = event.UTMMedium
+	}
+	if event.UTMCampaign != "" {
+		data["utm_campaign"] = event.UTMCampaign
+	}
+
+	return db.MongoInstance.CreateAnalyticsEvent(ctx, &db.AnalyticsEvent{
+		EventType:    event.Type,
+		RestaurantID: event.RestaurantID,
+		SessionID:    event.SessionID,
+		MenuID:       event.MenuID,
+		Data:         data,
+		IPAddress:    event.UserIP,
+		UserAgent:    event.UserAgent,
+		DeviceType:   event.DeviceType,
+		Browser:      event.Browser,
+		OS:           event.OS,
+		Country:      event.Country,
+		City:         event.City,
+		Timestamp:    event.Timestamp,
+	})
+}
+
+// toAnalyticsEventResponse converte un evento salvato nella rappresentazione pubblica
+func toAnalyticsEventResponse(event *db.AnalyticsEvent) analyticsEventResponse {
+	str := func(key string) string {
+		value, _ := event.Data[key].(string)
+		return value
+	}
+	return analyticsEventResponse{
+		ID:          event.ID,
+		Type:        event.EventType,
+		Timestamp:   event.Timestamp,
+		MenuID:      event.MenuID,
+		ItemID:      str("item_id"),
+		DeviceType:  event.DeviceType,
+		Browser:     event.Browser,
+		OS:          event.OS,
+		Country:     event.Country,
+		City:        event.City,
+		Platform:    str("platform"),
+		Referrer:    str("referrer"),
+		Source:      str("source"),
+		LinkSource:  str("link_source"),
+		Campaign:    str("campaign"),
+		UTMSource:   str("utm_source"),
+		UTMMedium:   str("utm_medium"),
+		UTMCampaign: str("utm_campaign"),
+	}
+}
+
+func (e analyticsEventResponse) record() []string {
+	return []string{
+		e.ID, e.Type, e.Timestamp.UTC().Format(time.RFC3339), e.MenuID, e.ItemID,
+		e.DeviceType, e.Browser, e.OS, e.Country, e.City, e.Platform, e.Referrer, e.Source,
+		e.LinkSource, e.Campaign, e.UTMSource, e.UTMMedium, e.UTMCampaign,
+	}
+}
+
+// parseAnalyticsEventFilter legge i filtri dalla query string: from/to (YYYY-MM-DD, giorni
+// inclusi, oppure RFC3339), type (view, share, scan), device, menu_id, source (qr, nfc o link,
+// solo per le scansioni), campaign (campagna dei link brevi o utm_campaign delle
+// visualizzazioni) e utm_source
+func parseAnalyticsEventFilter(r *http.Request, restaurantID string) (db.AnalyticsEventFilter, error) {
+	q := r.URL.Query()
+	filter := db.AnalyticsEventFilter{
+		RestaurantID: restaurantID,
+		EventType:    q.Get("type"),
+		MenuID:       q.Get("menu_id"),
+		DeviceType:   q.Get("device"),
+		Source:       q.Get("source"),
+		Campaign:     strings.ToLower(strings.TrimSpace(q.Get("campaign"))),
+		UTMSource:    strings.ToLower(strings.TrimSpace(q.Get("utm_source"))),
+	}
+
+	switch filter.EventType {
+	case "", analytics.EventView, analytics.EventShare, analytics.EventScan:
+	default:
+		return filter, fmt.Errorf("tipo di evento non valido: %s", filter.EventType)
+	}
+	switch filter.Source {
+	case "", analytics.ScanSourceQR, analytics.ScanSourceNFC, analytics.ScanSourceLink:
+	default:
+		return filter, fmt.Errorf("origine non valida: %s", filter.Source)
+	}
+
+	var err error
+	if value := q.Get("from"); value != "" {
+		if filter.From, _, err = parseEventTime(value); err != nil {
+			return filter, fmt.Errorf("from non valido: %s", value)
+		}
+	}
+	if value := q.Get("to"); value != "" {
+		var dateOnly bool
+		if filter.To, dateOnly, err = parseEventTime(value); err != nil {
+			return filter, fmt.Errorf("to non valido: %s", value)
+		}
+		if dateOnly {
+			filter.To = filter.To.AddDate(0, 0, 1)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("from deve precedere to")
+	}
+
+	return filter, nil
+}
+
+// parseEventTime accetta una data (YYYY-MM-DD, in UTC) o un timestamp RFC3339
+func parseEventTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// AnalyticsEventsHandler restituisce gli eventi grezzi del ristorante, filtrati e paginati
+// (GET /api/v1/analytics/events?from=&to=&type=&device=&menu_id=&page=&per_page=)
+func AnalyticsEventsHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSessionFromRequest(r)
+	if err != nil || session.RestaurantID == "" {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	filter, err := parseAnalyticsEventFilter(r, session.RestaurantID)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	page := 1
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && parsed > 0 {
+		page = parsed
+	}
+	perPage := analyticsEventsDefaultPerPage
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("per_page")); err == nil && parsed > 0 {
+		perPage = parsed
+	}
+	if perPage > analyticsEventsMaxPerPage {
+		perPage = analyticsEventsMaxPerPage
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	events, total, err := db.MongoInstance.FindAnalyticsEvents(ctx, filter, int64((page-1)*perPage), int64(perPage))
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella lettura degli eventi analytics", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": session.RestaurantID,
+		})
+		httputil.InternalServerError(w, "Errore nella lettura degli eventi")
+		return
+	}
+
+	items := make([]analyticsEventResponse, 0, len(events))
+	for _, event := range events {
+		items = append(items, toAnalyticsEventResponse(event))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Paginated(w, items, page, perPage, total)
+}
+
+// AnalyticsExportHandler esporta in streaming gli eventi grezzi del ristorante per strumenti
+// di BI esterni (GET /api/v1/analytics/export?format=csv, stessi filtri di AnalyticsEventsHandler)
+func AnalyticsExportHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSessionFromRequest(r)
+	if err != nil || session.RestaurantID == "" {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		httputil.BadRequest(w, "Formato non supportato: usare csv o ndjson")
+		return
+	}
+
+	filter, err := parseAnalyticsEventFilter(r, session.RestaurantID)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	// Nessun timeout breve: l'export può durare a lungo, si interrompe se il client chiude la connessione
+	ctx := r.Context()
+
+	filename := fmt.Sprintf("analytics-%s.%s", time.Now().Format("2006-01-02"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	count := 0
+	if format == "ndjson" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		err = db.MongoInstance.StreamAnalyticsEvents(ctx, filter, func(event *db.AnalyticsEvent) error {
+			count++
+			return encoder.Encode(toAnalyticsEventResponse(event))
+		})
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer := csv.NewWriter(w)
+		writer.Write(analyticsEventCSVHeader)
+		err = db.MongoInstance.StreamAnalyticsEvents(ctx, filter, func(event *db.AnalyticsEvent) error {
+			count++
+			if err := writer.Write(toAnalyticsEventResponse(event).record()); err != nil {
+				return err
+			}
+			// Svuota il buffer periodicamente per non tenere in memoria export grandi
+			if count%500 == 0 {
+				writer.Flush()
+				return writer.Error()
+			}
+			return nil
+		})
+		writer.Flush()
+	}
+
+	if err != nil {
+		// Gli header sono già stati inviati: si può solo registrare l'interruzione
+		logger.ErrorCtx(r.Context(), "Export analytics interrotto", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": session.RestaurantID,
+			"events":        count,
+		})
+		return
+	}
+
+	RecordAuditLogAsync("ANALYTICS_EXPORTED", "analytics", session.RestaurantID, session.RestaurantID, getClientIP(r), r.UserAgent(), "success")
+}
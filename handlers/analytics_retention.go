@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"qr-menu/analytics"
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/pkg/anonymize"
+	"qr-menu/pkg/config"
+)
+
+// analyticsSettings contiene retention e opzioni di tracciamento delle analytics, impostate all'avvio
+var (
+	analyticsSettings   = config.Default().Analytics
+	analyticsSettingsMu sync.Mutex // Evita anche compattazioni concorrenti (job periodico e API admin)
+)
+
+// SetAnalyticsSettings imposta retention, frequenza della compattazione e cookie visitatore delle analytics
+func SetAnalyticsSettings(cfg config.AnalyticsConfig) {
+	analyticsSettingsMu.Lock()
+	defer analyticsSettingsMu.Unlock()
+	analyticsSettings = cfg
+}
+
+// AnalyticsCompactionResult riassume un'esecuzione della retention
+type AnalyticsCompactionResult struct {
+	analytics.CompactionResult
+	EventsDeleted int64 `json:"events_deleted"`
+	DurationMs    int64 `json:"duration_ms"`
+}
+
+// CompactAnalytics applica la retention: compatta per mese i conteggi giornalieri più
+// vecchi di analytics.retention_days, elimina gli aggregati mensili oltre
+// monthly_retention_months e gli eventi grezzi più vecchi della retention
+func CompactAnalytics(ctx context.Context) (AnalyticsCompactionResult, error) {
+	analyticsSettingsMu.Lock()
+	defer analyticsSettingsMu.Unlock()
+
+	start := time.Now()
+	cfg := analyticsSettings
+
+	result := AnalyticsCompactionResult{
+		CompactionResult: analytics.GetAnalytics().Compact(analytics.RetentionPolicy{
+			DailyDays:     cfg.RetentionDays,
+			MonthlyMonths: cfg.MonthlyRetentionMonths,
+		}, start),
+	}
+
+	var err error
+	if db.MongoInstance != nil && cfg.RetentionDays > 0 {
+		result.EventsDeleted, err = db.MongoInstance.DeleteAnalyticsEventsBefore(ctx, start.AddDate(0, 0, -cfg.RetentionDays))
+	}
+	result.DurationMs = time.Since(start).Milliseconds()
+
+	logger.Info("Retention analytics applicata", map[string]interface{}{
+		"restaurants":    result.Restaurants,
+		"days_rolled_up": result.DaysRolledUp,
+		"months_dropped": result.MonthsDropped,
+		"events_deleted": result.EventsDeleted,
+	})
+	return result, err
+}
+
+// ScrubAnalyticsEvents applica l'anonimizzazione a IP e User-Agent degli eventi grezzi già
+// salvati, come avviene per i nuovi eventi. Dispositivo, browser e sistema operativo degli
+// eventi che non li hanno vengono prima estratti dal User-Agent completo.
+// Restituisce il numero di eventi aggiornati
+func ScrubAnalyticsEvents(ctx context.Context, anonymizer *anonymize.Anonymizer) (int64, error) {
+	if db.MongoInstance == nil {
+		return 0, fmt.Errorf("database non disponibile")
+	}
+
+	updated, err := db.MongoInstance.ScrubAnalyticsEvents(ctx, func(event *db.AnalyticsEvent) bool {
+		ip, userAgent := anonymizer.IP(event.IPAddress), anonymizer.UserAgent(event.UserAgent)
+		if ip == event.IPAddress && userAgent == event.UserAgent {
+			return false
+		}
+		if event.DeviceType == "" && !anonymize.IsHashed(event.UserAgent) {
+			event.DeviceType, event.Browser, event.OS = analytics.ParseUserAgent(event.UserAgent)
+		}
+		event.IPAddress, event.UserAgent = ip, userAgent
+		return true
+	})
+
+	logger.Info("Anonimizzazione degli eventi analytics salvati", map[string]interface{}{
+		"events_updated": updated,
+	})
+	return updated, err
+}
+
+// RunAnalyticsRetentionWorker applica la retention all'avvio e poi ogni
+// analytics.cleanup_interval, finché ctx non viene annullato. È bloccante: va avviato in una goroutine
+func RunAnalyticsRetentionWorker(ctx context.Context) {
+	analyticsSettingsMu.Lock()
+	interval := analyticsSettings.CleanupInterval
+	analyticsSettingsMu.Unlock()
+	if interval <= 0 {
+		return
+	}
+
+	run := func() {
+		runCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+		defer cancel()
+		if _, err := CompactAnalytics(runCtx); err != nil {
+			logger.Error("Errore nella retention degli eventi analytics", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	run()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
+
+// AdminAnalyticsCompactHandler avvia subito la retention delle analytics
+// (POST /api/admin/analytics/compact) e ne restituisce il riepilogo
+func AdminAnalyticsCompactHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
+	defer cancel()
+
+	result, err := CompactAnalytics(ctx)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella compattazione analytics richiesta da admin", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Errore nella compattazione delle analytics", http.StatusInternalServerError)
+		return
+	}
+
+	RecordAuditLogAsync("ANALYTICS_COMPACTED", "analytics", "", "", getClientIP(r), r.UserAgent(), "success")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(result)
+}
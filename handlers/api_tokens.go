@@ -0,0 +1,600 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/config"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/jwtkeys"
+	"qr-menu/security"
+)
+
+var (
+	// Chiavi di firma degli access token dell'API; nil senza security.jwt_secret
+	apiTokenKeys *jwtkeys.Keyring
+	// Durata degli access token: è anche la finestra in cui una chiave sostituita resta valida
+	apiTokenExpiry = 15 * time.Minute
+	// Durata dei refresh token, rinnovata a ogni refresh
+	apiRefreshExpiry = 30 * 24 * time.Hour
+	apiTokenIssuer   = "qr-menu"
+)
+
+var (
+	errAPITokensDisabled  = errors.New("token dell'API non configurati")
+	errAPITokenRevoked    = errors.New("token revocato")
+	errRefreshTokenReused = errors.New("refresh token già utilizzato")
+)
+
+// apiTokenPair è la risposta di login e refresh: l'access token autentica le richieste, il
+// refresh token serve solo a ottenere una nuova coppia e vale una volta sola
+type apiTokenPair struct {
+	Token            string `json:"token"`
+	TokenType        string `json:"token_type"`
+	ExpiresAt        string `json:"expires_at"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt string `json:"refresh_expires_at"`
+	RestaurantID     string `json:"restaurant_id"`
+}
+
+type apiTokenContextKey struct{}
+
+// apiTokenClaims sono i claim degli access token: l'utente (sub) e il ristorante su cui agisce
+type apiTokenClaims struct {
+	RestaurantID string `json:"restaurant_id"`
+	jwt.RegisteredClaims
+}
+
+// ConfigureAPITokens carica dal database le chiavi di firma degli access token, creando la
+// prima se non ne esistono. I segreti sono salvati cifrati con security.jwt_secret, che deve
+// restare lo stesso tra i riavvii e tra le istanze. Senza jwt_secret i token sono disattivati
+func ConfigureAPITokens(ctx context.Context, settings config.SecurityConfig) error {
+	if settings.JWTSecret == "" {
+		apiTokenKeys = nil
+		return nil
+	}
+	if settings.JWTExpiry > 0 {
+		apiTokenExpiry = settings.JWTExpiry
+	}
+	if settings.JWTRefreshExpiry > 0 {
+		apiRefreshExpiry = settings.JWTRefreshExpiry
+	}
+	if settings.JWTIssuer != "" {
+		apiTokenIssuer = settings.JWTIssuer
+	}
+
+	keys, err := jwtkeys.New(ctx, &mongoKeyStore{enc: security.NewEncryption(settings.JWTSecret)}, apiTokenExpiry)
+	if err != nil {
+		return err
+	}
+	apiTokenKeys = keys
+	return nil
+}
+
+// mongoKeyStore salva le chiavi di firma nella collection jwt_keys
+type mongoKeyStore struct {
+	enc *security.Encryption
+}
+
+func (s *mongoKeyStore) LoadKeys(ctx context.Context) ([]jwtkeys.Key, error) {
+	stored, err := db.MongoInstance.GetJWTSigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]jwtkeys.Key, 0, len(stored))
+	for _, k := range stored {
+		plain, err := s.enc.Decrypt(k.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("chiave JWT %s non decifrabile (jwt_secret cambiato?): %v", k.ID, err)
+		}
+		secret, err := base64.StdEncoding.DecodeString(plain)
+		if err != nil {
+			return nil, fmt.Errorf("chiave JWT %s non valida: %v", k.ID, err)
+		}
+		key := jwtkeys.Key{ID: k.ID, Secret: secret, CreatedAt: k.CreatedAt}
+		if k.RetiredAt != nil {
+			key.RetiredAt = *k.RetiredAt
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *mongoKeyStore) SaveKey(ctx context.Context, key jwtkeys.Key) error {
+	sealed, err := s.enc.Encrypt(base64.StdEncoding.EncodeToString(key.Secret))
+	if err != nil {
+		return err
+	}
+	return db.MongoInstance.CreateJWTSigningKey(ctx, &models.JWTSigningKey{
+		ID:        key.ID,
+		Secret:    sealed,
+		CreatedAt: key.CreatedAt,
+	})
+}
+
+func (s *mongoKeyStore) RetireKey(ctx context.Context, id string, at time.Time) error {
+	return db.MongoInstance.RetireJWTSigningKey(ctx, id, at)
+}
+
+func (s *mongoKeyStore) DeleteKeysRetiredBefore(ctx context.Context, before time.Time) error {
+	return db.MongoInstance.DeleteJWTSigningKeysRetiredBefore(ctx, before)
+}
+
+// apiTokenFromRequest estrae l'access token dall'header Authorization (Bearer). Le API key,
+// inviate nello stesso header, non sono access token: restituisce "" anche per quelle
+func apiTokenFromRequest(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	token = strings.TrimSpace(token)
+	if !ok || token == "" || strings.HasPrefix(token, models.APIKeyPrefix) {
+		return ""
+	}
+	return token
+}
+
+// issueAPIToken firma un access token dell'utente per il ristorante indicato
+func issueAPIToken(userID, restaurantID string, now time.Time) (string, time.Time, error) {
+	if apiTokenKeys == nil {
+		return "", time.Time{}, errAPITokensDisabled
+	}
+	key, err := apiTokenKeys.Current()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := now.Add(apiTokenExpiry)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &apiTokenClaims{
+		RestaurantID: restaurantID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			// Un ID per token: due token emessi nello stesso secondo vanno revocati separatamente
+			ID:        uuid.New().String(),
+			Subject:   userID,
+			Issuer:    apiTokenIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Secret)
+	return signed, expiresAt, err
+}
+
+// issueAPITokens emette un access token e un refresh token della famiglia indicata; familyID
+// vuoto avvia una nuova famiglia (login)
+func issueAPITokens(ctx context.Context, userID, restaurantID, familyID string) (*apiTokenPair, error) {
+	now := time.Now()
+	token, expiresAt, err := issueAPIToken(userID, restaurantID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	refreshToken := hex.EncodeToString(secret)
+	if familyID == "" {
+		familyID = uuid.New().String()
+	}
+	refreshExpiresAt := now.Add(apiRefreshExpiry)
+	if err := db.MongoInstance.CreateRefreshToken(ctx, &models.RefreshToken{
+		ID:           uuid.New().String(),
+		Hash:         hashVerificationToken(refreshToken),
+		FamilyID:     familyID,
+		UserID:       userID,
+		RestaurantID: restaurantID,
+		CreatedAt:    now,
+		ExpiresAt:    refreshExpiresAt,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &apiTokenPair{
+		Token:            token,
+		TokenType:        "Bearer",
+		ExpiresAt:        expiresAt.UTC().Format(time.RFC3339),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt.UTC().Format(time.RFC3339),
+		RestaurantID:     restaurantID,
+	}, nil
+}
+
+// useRefreshToken consuma un refresh token e restituisce il record. Se il token era già stato
+// usato o revocato qualcuno ne ha una copia: l'intera famiglia viene revocata e restituisce
+// errRefreshTokenReused. Restituisce nil, nil per token sconosciuti o scaduti
+func useRefreshToken(ctx context.Context, r *http.Request, refreshToken string) (*models.RefreshToken, error) {
+	hash := hashVerificationToken(refreshToken)
+	now := time.Now()
+
+	token, err := db.MongoInstance.UseRefreshToken(ctx, hash, now)
+	if err != nil || token != nil {
+		return token, err
+	}
+
+	previous, err := db.MongoInstance.GetRefreshTokenByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil || (previous.UsedAt == nil && previous.RevokedAt == nil) {
+		return nil, nil
+	}
+
+	if err := db.MongoInstance.RevokeRefreshTokenFamily(ctx, previous.FamilyID, now); err != nil {
+		return nil, err
+	}
+	logger.SecurityEventCtx(r.Context(), "REFRESH_TOKEN_REUSE", "Refresh token riutilizzato: sessione revocata", previous.UserID,
+		map[string]interface{}{
+			"family_id":     previous.FamilyID,
+			"restaurant_id": previous.RestaurantID,
+			"ip":            getClientIP(r),
+		})
+	return nil, errRefreshTokenReused
+}
+
+// restaurantAccessible indica se restaurantID è tra i ristoranti attivi dell'elenco
+func restaurantAccessible(restaurants []models.Restaurant, restaurantID string) bool {
+	for _, restaurant := range restaurants {
+		if restaurant.ID == restaurantID && restaurant.IsActive {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAPIToken verifica firma, emittente e scadenza di un access token e che non sia
+// stato revocato. La chiave è scelta dal kid: dopo una rotazione i token firmati con la
+// chiave precedente restano validi fino alla scadenza
+func validateAPIToken(ctx context.Context, raw string) (*apiTokenClaims, error) {
+	if apiTokenKeys == nil {
+		return nil, errAPITokensDisabled
+	}
+
+	claims := &apiTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return apiTokenKeys.Lookup(ctx, kid, time.Now())
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(apiTokenIssuer),
+		jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject == "" || claims.RestaurantID == "" {
+		return nil, fmt.Errorf("token senza utente o ristorante")
+	}
+
+	revoked, err := db.MongoInstance.IsTokenRevoked(ctx, hashVerificationToken(raw))
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, errAPITokenRevoked
+	}
+	return claims, nil
+}
+
+// apiTokenSession restituisce la sessione equivalente all'access token autenticato da
+// RequireAPIAccess: ruolo e permessi sono poi letti come per la sessione dell'admin
+func apiTokenSession(r *http.Request) *models.Session {
+	claims, ok := r.Context().Value(apiTokenContextKey{}).(*apiTokenClaims)
+	if !ok {
+		return nil
+	}
+	session := &models.Session{
+		ID:           "token:" + claims.Subject,
+		UserID:       claims.Subject,
+		RestaurantID: claims.RestaurantID,
+		LastAccessed: time.Now(),
+		IPAddress:    getClientIP(r),
+		UserAgent:    r.UserAgent(),
+	}
+	if claims.IssuedAt != nil {
+		session.CreatedAt = claims.IssuedAt.Time
+	}
+	return session
+}
+
+// withAPIToken autentica la richiesta con l'access token e la passa a next con i claim nel
+// contesto. Token non validi, scaduti o revocati ricevono 401
+func withAPIToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		claims, err := validateAPIToken(ctx, apiTokenFromRequest(r))
+		cancel()
+		if err != nil {
+			logger.SecurityEventCtx(r.Context(), "API_TOKEN_REJECTED", "Access token non valido", "", map[string]interface{}{
+				"error":    err.Error(),
+				"endpoint": r.URL.Path,
+				"ip":       getClientIP(r),
+			})
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			httputil.Unauthorized(w, "Token non valido o scaduto")
+			return
+		}
+
+		// L'utente disattivato perde subito l'accesso, anche con token non ancora scaduti
+		ctx, cancel = context.WithTimeout(r.Context(), 5*time.Second)
+		user, err := db.MongoInstance.GetUserByID(ctx, claims.Subject)
+		cancel()
+		if err != nil || user == nil || !user.IsActive {
+			httputil.Unauthorized(w, "Token non valido o scaduto")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), apiTokenContextKey{}, claims)))
+	}
+}
+
+// APITokenHandler emette un access token e un refresh token con username (o email) e
+// password (POST /api/v1/auth/token). restaurant_id è il ristorante su cui agisce il token e
+// va indicato se l'utente ne ha più di uno
+func APITokenHandler(w http.ResponseWriter, r *http.Request) {
+	if apiTokenKeys == nil {
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Token dell'API non configurati")
+		return
+	}
+
+	var req struct {
+		Username     string `json:"username"`
+		Password     string `json:"password"`
+		RestaurantID string `json:"restaurant_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	username := strings.TrimSpace(req.Username)
+	if username == "" || req.Password == "" {
+		httputil.BadRequest(w, "Specificare username e password")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	user, err := db.MongoInstance.GetUserByUsername(ctx, username)
+	if err != nil || user == nil {
+		user, _ = db.MongoInstance.GetUserByEmail(ctx, strings.ToLower(username))
+	}
+	if user == nil || !user.IsActive || !checkPassword(user.PasswordHash, req.Password) {
+		logger.SecurityEventCtx(r.Context(), "LOGIN_FAILED", "Credenziali non valide", "", map[string]interface{}{
+			"username": username,
+			"reason":   "invalid_credentials",
+			"method":   "api_token",
+		})
+		httputil.Unauthorized(w, "Username o password non validi")
+		return
+	}
+
+	restaurants, err := accessibleRestaurants(ctx, user.ID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero ristoranti", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		httputil.InternalServerError(w, "Errore nel recupero dei ristoranti")
+		return
+	}
+	restaurantID := req.RestaurantID
+	if restaurantID == "" {
+		if len(restaurants) != 1 {
+			httputil.BadRequest(w, "Specificare restaurant_id")
+			return
+		}
+		restaurantID = restaurants[0].ID
+	}
+	if !restaurantAccessible(restaurants, restaurantID) {
+		logger.SecurityEventCtx(r.Context(), "ACCESS_DENIED", "Token richiesto per un ristorante non accessibile", user.ID, map[string]interface{}{
+			"restaurant_id": restaurantID,
+		})
+		httputil.Forbidden(w, "Ristorante non accessibile")
+		return
+	}
+
+	tokens, err := issueAPITokens(ctx, user.ID, restaurantID, "")
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella generazione dell'access token", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		httputil.InternalServerError(w, "Errore nella generazione del token")
+		return
+	}
+
+	logger.AuditLogCtx(r.Context(), "LOGIN_SUCCESS", "authentication",
+		"Access token dell'API emesso", user.ID,
+		map[string]interface{}{
+			"restaurant_id": restaurantID,
+			"method":        "api_token",
+		})
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", tokens)
+}
+
+// APIRefreshTokenHandler scambia un refresh token con una nuova coppia di token
+// (POST /api/v1/auth/refresh). Il refresh token presentato viene sostituito: riusarlo revoca
+// l'intera sessione, anche il token ottenuto al suo posto
+func APIRefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if apiTokenKeys == nil {
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Token dell'API non configurati")
+		return
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if req.RefreshToken == "" {
+		httputil.BadRequest(w, "Specificare refresh_token")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	previous, err := useRefreshToken(ctx, r, req.RefreshToken)
+	if err == errRefreshTokenReused {
+		httputil.Unauthorized(w, "Refresh token già utilizzato: la sessione è stata revocata, effettuare di nuovo il login")
+		return
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella verifica del refresh token", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nel rinnovo del token")
+		return
+	}
+	if previous == nil {
+		httputil.Unauthorized(w, "Refresh token non valido o scaduto")
+		return
+	}
+
+	// L'utente disattivato o rimosso dallo staff non può rinnovare il token
+	user, err := db.MongoInstance.GetUserByID(ctx, previous.UserID)
+	if err != nil || user == nil || !user.IsActive {
+		httputil.Unauthorized(w, "Refresh token non valido o scaduto")
+		return
+	}
+	restaurants, err := accessibleRestaurants(ctx, user.ID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero ristoranti", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		httputil.InternalServerError(w, "Errore nel rinnovo del token")
+		return
+	}
+	if !restaurantAccessible(restaurants, previous.RestaurantID) {
+		httputil.Forbidden(w, "Ristorante non accessibile")
+		return
+	}
+
+	tokens, err := issueAPITokens(ctx, user.ID, previous.RestaurantID, previous.FamilyID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella generazione dell'access token", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		httputil.InternalServerError(w, "Errore nel rinnovo del token")
+		return
+	}
+
+	logger.AuditLogCtx(r.Context(), "TOKEN_REFRESHED", "authentication",
+		"Access token dell'API rinnovato", user.ID,
+		map[string]interface{}{
+			"restaurant_id": previous.RestaurantID,
+			"family_id":     previous.FamilyID,
+		})
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", tokens)
+}
+
+// APILogoutHandler revoca l'access token della richiesta fino alla sua scadenza, anche
+// dopo un riavvio (POST /api/v1/auth/logout). Con {"refresh_token": "..."} nel corpo revoca
+// anche la sessione di quel refresh token
+func APILogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if apiTokenKeys == nil {
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Token dell'API non configurati")
+		return
+	}
+	raw := apiTokenFromRequest(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	claims, err := validateAPIToken(ctx, raw)
+	if err != nil {
+		httputil.Unauthorized(w, "Token non valido o scaduto")
+		return
+	}
+	if err := db.MongoInstance.RevokeToken(ctx, &models.RevokedToken{
+		ID:        hashVerificationToken(raw),
+		RevokedAt: time.Now(),
+		ExpiresAt: claims.ExpiresAt.Time,
+	}); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella revoca dell'access token", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": claims.Subject,
+		})
+		httputil.InternalServerError(w, "Errore nella revoca del token")
+		return
+	}
+
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if json.NewDecoder(r.Body).Decode(&req) == nil && req.RefreshToken != "" {
+		token, err := db.MongoInstance.GetRefreshTokenByHash(ctx, hashVerificationToken(req.RefreshToken))
+		// Solo le sessioni dello stesso utente: un token altrui non va revocato
+		if err == nil && token != nil && token.UserID == claims.Subject {
+			err = db.MongoInstance.RevokeRefreshTokenFamily(ctx, token.FamilyID, time.Now())
+		}
+		if err != nil {
+			logger.ErrorCtx(r.Context(), "Errore nella revoca del refresh token", map[string]interface{}{
+				"error":   err.Error(),
+				"user_id": claims.Subject,
+			})
+			httputil.InternalServerError(w, "Errore nella revoca del refresh token")
+			return
+		}
+	}
+
+	logger.AuditLogCtx(r.Context(), "TOKEN_REVOKED", "authentication",
+		"Access token dell'API revocato", claims.Subject,
+		map[string]interface{}{
+			"restaurant_id": claims.RestaurantID,
+		})
+	httputil.Success(w, "Logout effettuato", nil)
+}
+
+// AdminRotateAPITokenKeysHandler forza la rotazione delle chiavi di firma degli access token
+// (POST /api/admin/jwt/rotate). I nuovi token sono firmati con la nuova chiave; quelli già
+// emessi restano validi fino alla scadenza. Da usare subito se si sospetta che una chiave sia
+// stata compromessa
+func AdminRotateAPITokenKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if apiTokenKeys == nil {
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Token dell'API non configurati")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	key, err := apiTokenKeys.Rotate(ctx)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella rotazione delle chiavi JWT", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nella rotazione delle chiavi")
+		return
+	}
+
+	logger.AuditLogCtx(r.Context(), "JWT_KEYS_ROTATED", "authentication",
+		"Chiavi di firma JWT ruotate", "",
+		map[string]interface{}{
+			"kid": key.ID,
+			"ip":  getClientIP(r),
+		})
+	httputil.Success(w, "Chiavi ruotate", map[string]interface{}{
+		"kid":               key.ID,
+		"created_at":        key.CreatedAt.UTC().Format(time.RFC3339),
+		"previous_valid_to": key.CreatedAt.Add(apiTokenExpiry).UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/tenancy"
+	"qr-menu/security"
+)
+
+// apiKeyHeader è l'header alternativo a "Authorization: Bearer" per inviare la API key
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyTouchInterval evita di scrivere l'ultimo utilizzo della chiave a ogni richiesta
+const apiKeyTouchInterval = time.Minute
+
+// apiKeyLimiter applica i limiti di richieste al minuto delle chiavi; nil disattiva i limiti
+var apiKeyLimiter *security.RateLimiter
+
+// SetAPIKeyLimiter imposta il rate limiter usato per le quote delle API key
+func SetAPIKeyLimiter(limiter *security.RateLimiter) {
+	apiKeyLimiter = limiter
+}
+
+type apiKeyContextKey struct{}
+
+// apiKeyFromRequest estrae la API key dall'header Authorization (Bearer) o X-API-Key.
+// Restituisce "" se la richiesta non ne contiene una
+func apiKeyFromRequest(r *http.Request) string {
+	return apiKeyFromHeader(r.Header)
+}
+
+// apiKeyFromHeader estrae la API key dagli header, o dai metadata di una chiamata gRPC
+func apiKeyFromHeader(header http.Header) string {
+	raw := header.Get(apiKeyHeader)
+	if raw == "" {
+		if token, ok := strings.CutPrefix(header.Get("Authorization"), "Bearer "); ok {
+			raw = strings.TrimSpace(token)
+		}
+	}
+	if !strings.HasPrefix(raw, models.APIKeyPrefix) {
+		return ""
+	}
+	return raw
+}
+
+// apiKeySession restituisce la sessione equivalente alla API key autenticata dalla richiesta,
+// così gli handler condivisi con l'admin leggono ristorante e utente come per una sessione
+func apiKeySession(r *http.Request) *models.Session {
+	key, ok := r.Context().Value(apiKeyContextKey{}).(*models.APIKey)
+	if !ok {
+		return nil
+	}
+	return &models.Session{
+		ID:           "apikey:" + key.ID,
+		UserID:       key.CreatedBy,
+		RestaurantID: key.RestaurantID,
+		CreatedAt:    key.CreatedAt,
+		LastAccessed: time.Now(),
+		IPAddress:    getClientIP(r),
+		UserAgent:    r.UserAgent(),
+	}
+}
+
+// RequireAPIAccess protegge le API usate dalle integrazioni: le richieste con una API key
+// devono avere lo scope perm e rispettare il limite della chiave, le altre passano da
+// RequireAuth e RequirePermissions come nell'admin, con la sessione del cookie o quella
+// dell'access token (api_tokens.go)
+func RequireAPIAccess(perm string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		withSession := RequireAuth(RequirePermissions(perm)(next))
+		withToken := withAPIToken(withSession)
+		return func(w http.ResponseWriter, r *http.Request) {
+			raw := apiKeyFromRequest(r)
+			if raw == "" {
+				if apiTokenFromRequest(r) != "" {
+					withToken(w, r)
+					return
+				}
+				withSession(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			key, err := db.MongoInstance.GetAPIKeyByHash(ctx, hashVerificationToken(raw))
+			cancel()
+			if err != nil {
+				logger.ErrorCtx(r.Context(), "Errore nella verifica della API key", map[string]interface{}{
+					"error": err.Error(),
+				})
+				httputil.InternalServerError(w, "Errore nella verifica della API key")
+				return
+			}
+			if key == nil {
+				logger.SecurityEventCtx(r.Context(), "API_KEY_REJECTED", "API key non valida", "", map[string]interface{}{
+					"endpoint": r.URL.Path,
+					"ip":       getClientIP(r),
+				})
+				httputil.Unauthorized(w, "API key non valida")
+				return
+			}
+			if !key.HasScope(perm) {
+				logger.SecurityEventCtx(r.Context(), "ACCESS_DENIED", "Scope mancante nella API key", key.CreatedBy, map[string]interface{}{
+					"api_key_id":    key.ID,
+					"permission":    perm,
+					"restaurant_id": key.RestaurantID,
+					"endpoint":      r.URL.Path,
+					"method":        r.Method,
+				})
+				httputil.Forbidden(w, "La API key non ha lo scope "+perm)
+				return
+			}
+			allowed, remaining := apiKeyAllowed(r.Context(), key)
+			if apiKeyLimiter != nil {
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(key.RateLimit))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			}
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(60/max(key.RateLimit, 1)+1))
+				httputil.ErrorMessage(w, http.StatusTooManyRequests, "Limite di richieste della API key superato")
+				return
+			}
+
+			touchAPIKey(key)
+
+			meterUsage(key.RestaurantID, models.UsageAPICalls)
+			scoped := tenancy.WithRestaurant(context.WithValue(r.Context(), apiKeyContextKey{}, key), key.RestaurantID)
+			next(w, r.WithContext(scoped))
+		}
+	}
+}
+
+// apiKeyAllowed consuma una richiesta dalla quota al minuto della chiave e restituisce quelle
+// rimaste. La quota sostituisce il limite del gruppo "api", che non si applica alle chiavi
+func apiKeyAllowed(ctx context.Context, key *models.APIKey) (bool, int) {
+	if apiKeyLimiter == nil {
+		return true, key.RateLimit
+	}
+	return apiKeyLimiter.Take(ctx, "apikey:"+key.ID, security.RateLimitConfig{
+		RequestsPerSecond: float64(key.RateLimit) / 60,
+		BurstSize:         key.RateLimit,
+	})
+}
+
+// touchAPIKey aggiorna in background l'ultimo utilizzo della chiave, al massimo una volta
+// per apiKeyTouchInterval
+func touchAPIKey(key *models.APIKey) {
+	now := time.Now()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) <= apiKeyTouchInterval {
+		return
+	}
+	// Letto prima di avviare la goroutine, che può terminare dopo la chiusura del database
+	client := db.MongoInstance
+	if client == nil {
+		return
+	}
+	go func(id string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := client.TouchAPIKey(ctx, id, now); err != nil {
+			logger.Warn("Errore nell'aggiornamento dell'ultimo utilizzo della API key", map[string]interface{}{
+				"error":      err.Error(),
+				"api_key_id": id,
+			})
+		}
+	}(key.ID)
+}
+
+// ListAPIKeysHandler restituisce le API key del ristorante selezionato (GET /api/v1/apikeys)
+func ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	keys, err := db.MongoInstance.GetAPIKeysByRestaurant(ctx, restaurant.ID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero delle API key", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		httputil.InternalServerError(w, "Errore nel recupero delle API key")
+		return
+	}
+	if keys == nil {
+		keys = []*models.APIKey{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", keys)
+}
+
+// CreateAPIKeyHandler crea una API key per il ristorante selezionato (POST /api/v1/apikeys).
+// Il segreto è restituito solo in questa risposta
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user, session, err := getCurrentUser(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+	restaurant, err := getCurrentRestaurant(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	var req struct {
+		Name      string   `json:"name"`
+		Scopes    []string `json:"scopes"`
+		RateLimit int      `json:"rate_limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Richiesta non valida")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		httputil.BadRequest(w, "Specificare un nome di massimo 100 caratteri")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		httputil.BadRequest(w, "Specificare almeno uno scope: "+strings.Join(models.APIKeyScopes, ", "))
+		return
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !models.IsAPIKeyScope(scope) {
+			httputil.BadRequest(w, "Scope non valido: "+scope)
+			return
+		}
+		if !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if req.RateLimit == 0 {
+		req.RateLimit = models.DefaultAPIKeyRateLimit
+	}
+	if req.RateLimit < 1 || req.RateLimit > models.MaxAPIKeyRateLimit {
+		httputil.BadRequest(w, "Il limite deve essere tra 1 e "+strconv.Itoa(models.MaxAPIKeyRateLimit)+" richieste al minuto")
+		return
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		httputil.InternalServerError(w, "Errore nella generazione della API key")
+		return
+	}
+	secret := models.APIKeyPrefix + hex.EncodeToString(secretBytes)
+
+	key := &models.APIKey{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurant.ID,
+		Name:         req.Name,
+		Prefix:       secret[:len(models.APIKeyPrefix)+8],
+		Hash:         hashVerificationToken(secret),
+		Scopes:       scopes,
+		RateLimit:    req.RateLimit,
+		CreatedBy:    user.ID,
+		CreatedAt:    time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.CreateAPIKey(ctx, key); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio della API key", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		httputil.InternalServerError(w, "Errore nel salvataggio della API key")
+		return
+	}
+
+	RecordAuditLogAsync("API_KEY_CREATED", "api_key", key.ID, session.RestaurantID, getClientIP(r), r.UserAgent(), "success")
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Created(w, "API key creata: conserva la chiave, non sarà più mostrata", map[string]interface{}{
+		"api_key": key,
+		"key":     secret,
+	})
+}
+
+// RevokeAPIKeyHandler revoca una API key del ristorante (DELETE /api/v1/apikeys/{id})
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := db.MongoInstance.DeleteAPIKey(ctx, id, restaurant.ID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella revoca della API key", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		httputil.InternalServerError(w, "Errore nella revoca della API key")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "API key")
+		return
+	}
+
+	RecordAuditLogAsync("API_KEY_REVOKED", "api_key", id, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
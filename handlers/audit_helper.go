@@ -16,6 +16,11 @@ import (
 // userAgent: user agent del client
 // status: "success", "failure", o "warning"
 func RecordAuditLog(ctx context.Context, action, resourceType, resourceID, restaurantID, clientIP, userAgent, status string) {
+	recordAuditLog(db.MongoInstance, action, resourceType, resourceID, restaurantID, clientIP, userAgent, status)
+}
+
+// recordAuditLog registra l'evento sull'istanza indicata (nil se il database non è disponibile)
+func recordAuditLog(client *db.MongoClient, action, resourceType, resourceID, restaurantID, clientIP, userAgent, status string) {
 	// Crea context con timeout per non bloccare la request
 	auditCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -33,8 +38,8 @@ func RecordAuditLog(ctx context.Context, action, resourceType, resourceID, resta
 	}
 
 	// Registra nel database
-	if db.MongoInstance != nil {
-		err := db.MongoInstance.CreateAuditLog(auditCtx, auditLog)
+	if client != nil {
+		err := client.CreateAuditLog(auditCtx, auditLog)
 		if err != nil {
 			// Non blocchiamo la response se l'audit fail, solo log
 			log.Printf("⚠️  Errore registrazione audit log: %v", err)
@@ -45,12 +50,15 @@ func RecordAuditLog(ctx context.Context, action, resourceType, resourceID, resta
 // RecordAuditLogAsync registra un evento di audit in background senza bloccare la response
 // Utile per operazioni non-critical
 func RecordAuditLogAsync(action, resourceType, resourceID, restaurantID, clientIP, userAgent, status string) {
+	// L'istanza si legge prima di avviare la goroutine: db.MongoInstance può essere sostituita
+	// nel frattempo (nei test, alla fine di ciascuno)
+	client := db.MongoInstance
 	go func() {
 		defer func() {
 			if r := recover(); r != nil {
 				log.Printf("Panic in audit logging: %v", r)
 			}
 		}()
-		RecordAuditLog(context.Background(), action, resourceType, resourceID, restaurantID, clientIP, userAgent, status)
+		recordAuditLog(client, action, resourceType, resourceID, restaurantID, clientIP, userAgent, status)
 	}()
 }
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	httputil "qr-menu/pkg/http"
+)
+
+// auditLogsQuery descrive paginazione, ordinamento e filtri dei log di audit
+var auditLogsQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     500,
+	DefaultSort:    "-timestamp",
+	Sortable:       []string{"timestamp", "action", "resource_type", "status"},
+	Filterable:     []string{"action", "resource_type", "resource_id", "status", "from", "to"},
+}
+
+// auditLogResponse è una voce del log di audit restituita dall'API
+type auditLogResponse struct {
+	ID           string    `json:"id"`
+	Action       string    `json:"action"`
+	ResourceType string    `json:"resource_type"`
+	ResourceID   string    `json:"resource_id"`
+	UserID       string    `json:"user_id,omitempty"`
+	IPAddress    string    `json:"ip_address"`
+	UserAgent    string    `json:"user_agent"`
+	Status       string    `json:"status"`
+	ErrorMessage string    `json:"error_message,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// AuditLogsHandler restituisce il log di audit del ristorante, dalla voce più recente
+// (GET /api/v1/audit-logs?filter[action]=&filter[resource_type]=&filter[resource_id]=
+// &filter[status]=&filter[from]=&filter[to]=&page=&per_page=&sort=). from e to accettano
+// YYYY-MM-DD (giorni inclusi) o RFC3339
+func AuditLogsHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSessionFromRequest(r)
+	if err != nil || session.RestaurantID == "" {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+	query, err := httputil.ParseListQuery(r, auditLogsQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	filter := db.AuditLogFilter{
+		RestaurantID: session.RestaurantID,
+		Action:       query.Filter("action"),
+		ResourceType: query.Filter("resource_type"),
+		ResourceID:   query.Filter("resource_id"),
+		Status:       query.Filter("status"),
+	}
+	if value := query.Filter("from"); value != "" {
+		if filter.From, _, err = parseEventTime(value); err != nil {
+			httputil.BadRequest(w, "filter[from] non valido: "+value)
+			return
+		}
+	}
+	if value := query.Filter("to"); value != "" {
+		var dateOnly bool
+		if filter.To, dateOnly, err = parseEventTime(value); err != nil {
+			httputil.BadRequest(w, "filter[to] non valido: "+value)
+			return
+		}
+		if dateOnly {
+			filter.To = filter.To.AddDate(0, 0, 1)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	logs, total, err := db.MongoInstance.FindAuditLogs(ctx, filter, dbListOptions(query))
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella lettura del log di audit", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": session.RestaurantID,
+		})
+		httputil.InternalServerError(w, "Errore nella lettura del log di audit")
+		return
+	}
+
+	items := make([]auditLogResponse, 0, len(logs))
+	for _, entry := range logs {
+		items = append(items, toAuditLogResponse(entry))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, items, query, total)
+}
+
+// toAuditLogResponse converte una voce salvata nella rappresentazione dell'API
+func toAuditLogResponse(entry *db.AuditLog) auditLogResponse {
+	return auditLogResponse{
+		ID:           entry.ID,
+		Action:       entry.Action,
+		ResourceType: entry.ResourceType,
+		ResourceID:   entry.ResourceID,
+		UserID:       entry.UserID,
+		IPAddress:    entry.IPAddress,
+		UserAgent:    entry.UserAgent,
+		Status:       entry.Status,
+		ErrorMessage: entry.ErrorMessage,
+		Timestamp:    entry.Timestamp,
+	}
+}
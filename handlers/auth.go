@@ -4,18 +4,20 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"qr-menu/db"
 	"qr-menu/logger"
 	"qr-menu/models"
+	"qr-menu/pkg/i18n"
 	"qr-menu/security"
 
 	"github.com/google/uuid"
@@ -24,14 +26,25 @@ import (
 )
 
 var (
-	// Store per le sessioni (usa cookie sicuri)
-	store *sessions.CookieStore
-	// Storage locale per backwards compatibility (in fase di migrazione a MongoDB)
-	restaurants = make(map[string]*models.Restaurant)
+	// Store per le sessioni (usa cookie sicuri), da usare tramite sessionStore
+	store     *sessions.CookieStore
+	storeOnce sync.Once
+
+	// secureCookies imposta Secure sui cookie di sessione e CSRF (TLS nativo, staging o produzione)
+	secureCookies bool
 )
 
+// SetSecureCookies indica se i cookie vanno inviati solo su HTTPS. Va chiamata all'avvio,
+// prima che il session store venga creato
+func SetSecureCookies(secure bool) {
+	secureCookies = secure
+}
+
 const defaultRestaurantRole = "owner"
 
+// SessionCookieName è il nome del cookie della sessione dell'admin
+const SessionCookieName = "qr-menu-session"
+
 func seedTestUsers() {
 	// Create test users with credentials from TESTING_GUIDE.md
 	testUsers := []struct {
@@ -88,36 +101,37 @@ func seedTestUsers() {
 
 	logger.Info("Seeding utenti di test completato", map[string]interface{}{
 		"total_users": len(testUsers),
-		//"restaurants": len(restaurants), // COMMENTATO
 	})
 }
 
-func init() {
-	// Inizializza il session store con una chiave segreta
+// sessionStore restituisce lo store delle sessioni, creandolo al primo utilizzo. La chiave
+// (SESSION_SECRET o storage/session_key.txt) serve solo al server: i comandi della CLI che
+// importano il package non devono leggerla né crearla
+func sessionStore() *sessions.CookieStore {
+	storeOnce.Do(initSessionStore)
+	return store
+}
+
+// initSessionStore inizializza il session store e la chiave CSRF con la chiave segreta
+func initSessionStore() {
 	sessionKey := getOrCreateSessionKey()
 	store = sessions.NewCookieStore([]byte(sessionKey))
-	
-	// Determina ambiente (Railway/Cloud usa ENVIRONMENT o PORT)
-	env := os.Getenv("ENVIRONMENT")
-	isProduction := env == "production" || env == "staging" || os.Getenv("PORT") != ""
-	
+	setCSRFKey(sessionKey)
+
 	store.Options = &sessions.Options{
 		Path:     "/",
 		MaxAge:   86400 * 7, // 7 giorni
 		HttpOnly: true,
-		Secure:   isProduction, // ⭐ Secure=true su Railway (HTTPS), false in locale
+		Secure:   secureCookies, // true con HTTPS (TLS nativo o proxy in staging/produzione), false in locale
 		SameSite: http.SameSiteLaxMode,
 	}
 
 	// Seed test data se necessario (MongoDB-only, no file storage)
-	if len(restaurants) == 0 {
-		seedTestUsers()
-	}
+	seedTestUsers()
 
 	logger.Info("Sistema di autenticazione inizializzato", map[string]interface{}{
-		"session_max_age":    86400 * 7,
-		"restaurants_count": len(restaurants),
-		"secure_cookies":    isProduction,
+		"session_max_age": 86400 * 7,
+		"secure_cookies":  secureCookies,
 	})
 }
 
@@ -182,7 +196,7 @@ func createSession(userID string, restaurantID string, r *http.Request) (*models
 		RestaurantID: restaurantID, // ⭐ Ristorante selezionato (può essere vuoto)
 		CreatedAt:    time.Now(),
 		LastAccessed: time.Now(),
-		IPAddress:    r.RemoteAddr,
+		IPAddress:    getClientIP(r),
 		UserAgent:    r.UserAgent(),
 	}
 
@@ -191,7 +205,7 @@ func createSession(userID string, restaurantID string, r *http.Request) (*models
 	defer cancel()
 	
 	if err := db.MongoInstance.CreateSession(ctx, session); err != nil {
-		logger.Error("Errore nel salvataggio della sessione in MongoDB", map[string]interface{}{
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio della sessione in MongoDB", map[string]interface{}{
 			"error":      err.Error(),
 			"session_id": session.ID,
 			"user_id":    userID,
@@ -199,7 +213,7 @@ func createSession(userID string, restaurantID string, r *http.Request) (*models
 		return nil, fmt.Errorf("errore salvataggio sessione: %v", err)
 	}
 	
-	logger.Info("Sessione creata in MongoDB", map[string]interface{}{
+	logger.InfoCtx(r.Context(), "Sessione creata in MongoDB", map[string]interface{}{
 		"session_id":    session.ID,
 		"user_id":       userID,
 		"restaurant_id": restaurantID,
@@ -210,34 +224,42 @@ func createSession(userID string, restaurantID string, r *http.Request) (*models
 
 // getSessionFromRequest recupera la sessione dalla richiesta HTTP
 func getSessionFromRequest(r *http.Request) (*models.Session, error) {
-	logger.Debug("=== SESSION RETRIEVAL START ===", map[string]interface{}{
+	// Le richieste autenticate con API key o access token (RequireAPIAccess) non hanno cookie di sessione
+	if session := apiKeySession(r); session != nil {
+		return session, nil
+	}
+	if session := apiTokenSession(r); session != nil {
+		return session, nil
+	}
+
+	logger.DebugCtx(r.Context(), "=== SESSION RETRIEVAL START ===", map[string]interface{}{
 		"path": r.URL.Path,
 		"method": r.Method,
 	})
 	
-	session, err := store.Get(r, "qr-menu-session")
+	session, err := sessionStore().Get(r, SessionCookieName)
 	if err != nil {
-		logger.Error("Errore nel recupero del cookie store", map[string]interface{}{
+		logger.ErrorCtx(r.Context(), "Errore nel recupero del cookie store", map[string]interface{}{
 			"error": err.Error(),
 		})
 		return nil, err
 	}
 
-	logger.Debug("Cookie store.Get result", map[string]interface{}{
+	logger.DebugCtx(r.Context(), "Cookie store.Get result", map[string]interface{}{
 		"has_values": len(session.Values) > 0,
 		"is_new": session.IsNew,
 	})
 
 	sessionID, ok := session.Values["session_id"].(string)
 	if !ok || sessionID == "" {
-		logger.Warn("Session ID non trovato nel cookie", map[string]interface{}{
+		logger.WarnCtx(r.Context(), "Session ID non trovato nel cookie", map[string]interface{}{
 			"ok": ok,
 			"session_id": sessionID,
 		})
 		return nil, fmt.Errorf("nessuna sessione trovata")
 	}
 
-	logger.Debug("Session ID estratto dal cookie", map[string]interface{}{
+	logger.DebugCtx(r.Context(), "Session ID estratto dal cookie", map[string]interface{}{
 		"session_id": sessionID,
 	})
 
@@ -247,7 +269,7 @@ func getSessionFromRequest(r *http.Request) (*models.Session, error) {
 	
 	userSession, err := db.MongoInstance.GetSessionByID(ctx, sessionID)
 	if err != nil {
-		logger.Error("Errore nel recupero della sessione da MongoDB", map[string]interface{}{
+		logger.ErrorCtx(r.Context(), "Errore nel recupero della sessione da MongoDB", map[string]interface{}{
 			"error":      err.Error(),
 			"session_id": sessionID,
 		})
@@ -255,13 +277,24 @@ func getSessionFromRequest(r *http.Request) (*models.Session, error) {
 	}
 	
 	if userSession == nil {
-		logger.Error("Sessione non trovata in MongoDB", map[string]interface{}{
+		logger.ErrorCtx(r.Context(), "Sessione non trovata in MongoDB", map[string]interface{}{
 			"session_id": sessionID,
 		})
 		return nil, fmt.Errorf("sessione non trovata")
 	}
 
-	logger.Debug("Sessione recuperata con successo da MongoDB", map[string]interface{}{
+	// Scadenza scorrevole: la sessione inattiva da troppo tempo viene chiusa
+	if sessionExpired(userSession.LastAccessed, time.Now()) {
+		if err := db.MongoInstance.DeleteSession(ctx, sessionID); err != nil {
+			logger.WarnCtx(r.Context(), "Errore nella cancellazione della sessione scaduta", map[string]interface{}{
+				"error":      err.Error(),
+				"session_id": sessionID,
+			})
+		}
+		return nil, fmt.Errorf("sessione scaduta")
+	}
+
+	logger.DebugCtx(r.Context(), "Sessione recuperata con successo da MongoDB", map[string]interface{}{
 		"session_id": sessionID,
 		"user_id": userSession.UserID,
 		"restaurant_id": userSession.RestaurantID,
@@ -270,13 +303,13 @@ func getSessionFromRequest(r *http.Request) (*models.Session, error) {
 	// Aggiorna il timestamp dell'ultimo accesso
 	userSession.LastAccessed = time.Now()
 	if err := db.MongoInstance.UpdateSession(ctx, userSession); err != nil {
-		logger.Warn("Errore nell'aggiornamento LastAccessed della sessione", map[string]interface{}{
+		logger.WarnCtx(r.Context(), "Errore nell'aggiornamento LastAccessed della sessione", map[string]interface{}{
 			"error":      err.Error(),
 			"session_id": sessionID,
 		})
 	}
 
-	logger.Debug("=== SESSION RETRIEVAL END ===", nil)
+	logger.DebugCtx(r.Context(), "=== SESSION RETRIEVAL END ===", nil)
 	return userSession, nil
 }
 
@@ -322,11 +355,36 @@ func handleAuthError(w http.ResponseWriter, r *http.Request, err error) bool {
 }
 
 
+// loginPageData sono i dati del template login
+type loginPageData struct {
+	Error          string
+	Username       string
+	Success        string
+	CSRFToken      string
+	OAuthProviders []oauthProviderOption
+}
+
+// registerPageData sono i dati del template register
+type registerPageData struct {
+	Errors         []string
+	Username       string
+	Email          string
+	RestaurantName string
+	Description    string
+	Address        string
+	Phone          string
+	CSRFToken      string
+}
+
 // LoginHandler gestisce il login con supporto multi-ristorante
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	setSecurityHeaders(w)
 	if r.Method == "GET" {
-		renderTemplate(w, "login", nil)
+		renderTemplate(w, "login", loginPageData{
+			Success:        r.URL.Query().Get("success"),
+			CSRFToken:      csrfToken(w, r),
+			OAuthProviders: oauthProviderOptions(),
+		})
 		return
 	}
 
@@ -339,12 +397,9 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	username := strings.TrimSpace(r.FormValue("username"))
 	password := r.FormValue("password")
 
-	ip := getClientIP(r)
-	userAgent := r.UserAgent()
-
 	// Log tentativo di login
-	logger.AuditLog("LOGIN_ATTEMPT", "authentication",
-		"Tentativo di login", "", ip, userAgent,
+	logger.AuditLogCtx(r.Context(), "LOGIN_ATTEMPT", "authentication",
+		"Tentativo di login", "",
 		map[string]interface{}{
 			"username": username,
 		})
@@ -362,33 +417,43 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	// ⭐ STEP 2: Verifica credenziali su User
 	if user == nil || !user.IsActive || !checkPassword(user.PasswordHash, password) {
 		// Log login fallito
-		logger.SecurityEvent("LOGIN_FAILED", "Credenziali non valide",
-			"", ip, userAgent,
+		logger.SecurityEventCtx(r.Context(), "LOGIN_FAILED", "Credenziali non valide", "",
 			map[string]interface{}{
 				"username": username,
 				"reason":   "invalid_credentials",
 			})
 
-		data := struct {
-			Error    string
-			Username string
-		}{
-			Error:    "Username o password non validi",
-			Username: username,
-		}
-		renderTemplate(w, "login", data)
+		renderTemplate(w, "login", loginPageData{
+			Error:          "Username o password non validi",
+			Username:       username,
+			CSRFToken:      csrfToken(w, r),
+			OAuthProviders: oauthProviderOptions(),
+		})
 		return
 	}
 
-	// ⭐ STEP 3: Ottieni tutti i ristoranti dell'utente
-	restaurants, err := db.MongoInstance.GetRestaurantsByOwnerID(ctx, user.ID)
+	redirectURL, err := startUserSession(ctx, w, r, user, "password")
 	if err != nil {
-		logger.Error("Errore nel recupero ristoranti", map[string]interface{}{
+		http.Error(w, "Errore nella creazione della sessione", http.StatusInternalServerError)
+		return
+	}
+
+	// Redirect appropriato
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// startUserSession crea la sessione dell'utente autenticato (con password o con un provider
+// OAuth), imposta il cookie e restituisce la pagina a cui reindirizzarlo secondo i ristoranti
+// a cui ha accesso
+func startUserSession(ctx context.Context, w http.ResponseWriter, r *http.Request, user *models.User, method string) (string, error) {
+	// ⭐ STEP 3: Ottieni tutti i ristoranti dell'utente, compresi quelli in cui fa parte dello staff
+	restaurants, err := accessibleRestaurants(ctx, user.ID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero ristoranti", map[string]interface{}{
 			"error":   err.Error(),
 			"user_id": user.ID,
 		})
-		http.Error(w, "Errore nel recupero dei ristoranti", http.StatusInternalServerError)
-		return
+		return "", err
 	}
 
 	// ⭐ STEP 4: Gestisci multi-ristorante
@@ -400,7 +465,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		userSession, err = createSession(user.ID, "", r)
 		redirectURL = "/add-restaurant"
 
-		logger.Warn("Utente senza ristoranti", map[string]interface{}{
+		logger.WarnCtx(r.Context(), "Utente senza ristoranti", map[string]interface{}{
 			"user_id":  user.ID,
 			"username": user.Username,
 		})
@@ -410,7 +475,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		userSession, err = createSession(user.ID, restaurants[0].ID, r)
 		redirectURL = "/admin"
 
-		logger.Info("Login con ristorante singolo", map[string]interface{}{
+		logger.InfoCtx(r.Context(), "Login con ristorante singolo", map[string]interface{}{
 			"user_id":       user.ID,
 			"restaurant_id": restaurants[0].ID,
 		})
@@ -420,71 +485,80 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		userSession, err = createSession(user.ID, "", r) // ⭐ RestaurantID vuoto
 		redirectURL = "/select-restaurant"
 
-		logger.Info("Login multi-ristorante", map[string]interface{}{
+		logger.InfoCtx(r.Context(), "Login multi-ristorante", map[string]interface{}{
 			"user_id":          user.ID,
 			"restaurant_count": len(restaurants),
 		})
 	}
 
 	if err != nil {
-		http.Error(w, "Errore nella creazione della sessione", http.StatusInternalServerError)
-		return
+		return "", err
 	}
 
 	// Imposta il cookie di sessione
-	session, err := store.Get(r, "qr-menu-session")
+	session, err := sessionStore().Get(r, SessionCookieName)
 	if err != nil {
-		logger.Error("Errore nel recupero della sessione cookie", map[string]interface{}{
+		logger.ErrorCtx(r.Context(), "Errore nel recupero della sessione cookie", map[string]interface{}{
 			"error":   err.Error(),
 			"user_id": user.ID,
 		})
-		http.Error(w, "Errore nella gestione della sessione", http.StatusInternalServerError)
-		return
+		return "", err
 	}
 	
 	session.Values["session_id"] = userSession.ID
 	
 	// ⚠️ IMPORTANTE: Salva la sessione PRIMA del redirect
 	if err := session.Save(r, w); err != nil {
-		logger.Error("Errore nel salvataggio della sessione cookie", map[string]interface{}{
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio della sessione cookie", map[string]interface{}{
 			"error":   err.Error(),
 			"user_id": user.ID,
 		})
-		http.Error(w, "Errore nel salvataggio della sessione", http.StatusInternalServerError)
-		return
+		return "", err
 	}
 	
-	logger.Info("Sessione cookie salvata con successo", map[string]interface{}{
+	logger.InfoCtx(r.Context(), "Sessione cookie salvata con successo", map[string]interface{}{
 		"session_id": userSession.ID,
 		"user_id":    user.ID,
 	})
 
 	// ⭐ STEP 5: Aggiorna ultimo login su User (non Restaurant)
 	if err := db.MongoInstance.UpdateUserLastLogin(ctx, user.ID); err != nil {
-		logger.Error("Errore nell'aggiornamento LastLogin", map[string]interface{}{
+		logger.ErrorCtx(r.Context(), "Errore nell'aggiornamento LastLogin", map[string]interface{}{
 			"error":   err.Error(),
 			"user_id": user.ID,
 		})
 	}
 
 	// Log login riuscito
-	logger.AuditLog("LOGIN_SUCCESS", "authentication",
-		"Login completato con successo", user.ID, ip, userAgent,
+	logger.AuditLogCtx(r.Context(), "LOGIN_SUCCESS", "authentication",
+		"Login completato con successo", user.ID,
 		map[string]interface{}{
 			"user_id":         user.ID,
 			"username":        user.Username,
 			"restaurant_count": len(restaurants),
+			"method":           method,
 		})
 
-	// Redirect appropriato
-	http.Redirect(w, r, redirectURL, http.StatusFound)
+	return redirectURL, nil
+}
+
+// credentialErrorMessages traduce gli errori di unicità delle credenziali in messaggi per il form
+func credentialErrorMessages(err error) []string {
+	var messages []string
+	if errors.Is(err, db.ErrDuplicateUsername) {
+		messages = append(messages, "Username già esistente")
+	}
+	if errors.Is(err, db.ErrDuplicateEmail) {
+		messages = append(messages, "Email già registrata")
+	}
+	return messages
 }
 
 // RegisterHandler gestisce la registrazione (User + Restaurant separati + GDPR)
 func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	setSecurityHeaders(w)
 	if r.Method == "GET" {
-		renderTemplate(w, "register", nil)
+		renderTemplate(w, "register", registerPageData{CSRFToken: csrfToken(w, r)})
 		return
 	}
 
@@ -539,26 +613,12 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	existingUser, _ := db.MongoInstance.GetUserByUsername(ctx, username)
-	if existingUser != nil {
-		errors = append(errors, "Username già esistente")
+	if err := db.MongoInstance.CheckUserCredentials(ctx, username, email); err != nil {
+		errors = append(errors, credentialErrorMessages(err)...)
 	}
 
-	existingEmail, _ := db.MongoInstance.GetUserByEmail(ctx, strings.ToLower(email))
-	if existingEmail != nil {
-		errors = append(errors, "Email già registrata")
-	}
-
-	if len(errors) > 0 {
-		data := struct {
-			Errors         []string
-			Username       string
-			Email          string
-			RestaurantName string
-			Description    string
-			Address        string
-			Phone          string
-		}{
+	renderRegisterErrors := func(errors []string) {
+		data := registerPageData{
 			Errors:         errors,
 			Username:       username,
 			Email:          email,
@@ -566,8 +626,13 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			Description:    description,
 			Address:        address,
 			Phone:          phone,
+			CSRFToken:      csrfToken(w, r),
 		}
 		renderTemplate(w, "register", data)
+	}
+
+	if len(errors) > 0 {
+		renderRegisterErrors(errors)
 		return
 	}
 
@@ -590,11 +655,16 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		ConsentDate:      time.Now(),
 		CreatedAt:        time.Now(),
 		IsActive:         true,
+		Locale:           i18n.Default().Negotiate(r.Header.Get("Accept-Language")),
 	}
 
-	// Salva User in MongoDB
+	// Salva User in MongoDB (gli indici unici bloccano le registrazioni concorrenti)
 	if err := db.MongoInstance.CreateUser(ctx, user); err != nil {
-		logger.Error("Errore nel salvataggio dell'utente", map[string]interface{}{
+		if messages := credentialErrorMessages(err); len(messages) > 0 {
+			renderRegisterErrors(messages)
+			return
+		}
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio dell'utente", map[string]interface{}{
 			"error":    err.Error(),
 			"username": username,
 		})
@@ -604,19 +674,8 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 	// ⭐ STEP 2: Crea primo Restaurant dell'utente
 	restaurantID := uuid.New().String()
-	restaurantUsername, err := generateUniqueRestaurantUsername(ctx, restaurantName)
-	if err != nil {
-		logger.Error("Errore nella generazione username ristorante", map[string]interface{}{
-			"error":    err.Error(),
-			"username": username,
-		})
-		http.Error(w, "Errore nella creazione dell'account", http.StatusInternalServerError)
-		return
-	}
-
 	restaurant := &models.Restaurant{
 		ID:          restaurantID,
-		Username:    restaurantUsername,
 		OwnerID:     userID, // ⭐ Link a User
 		Name:        restaurantName,
 		Description: description,
@@ -627,8 +686,8 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Salva Restaurant in MongoDB
-	if err := db.MongoInstance.CreateRestaurant(ctx, restaurant); err != nil {
-		logger.Error("Errore nel salvataggio del ristorante", map[string]interface{}{
+	if err := createRestaurantWithUniqueUsername(ctx, restaurant); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio del ristorante", map[string]interface{}{
 			"error":    err.Error(),
 			"username": username,
 		})
@@ -639,7 +698,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	// ⭐ STEP 3: Auto-login dopo registrazione (crea session con user_id)
 	userSession, err := createSession(userID, restaurantID, r)
 	if err != nil {
-		logger.Error("Errore nella creazione della sessione dopo registrazione", map[string]interface{}{
+		logger.ErrorCtx(r.Context(), "Errore nella creazione della sessione dopo registrazione", map[string]interface{}{
 			"error":   err.Error(),
 			"user_id": userID,
 		})
@@ -647,9 +706,9 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, err := store.Get(r, "qr-menu-session")
+	session, err := sessionStore().Get(r, SessionCookieName)
 	if err != nil {
-		logger.Error("Errore nel recupero del cookie store dopo registrazione", map[string]interface{}{
+		logger.ErrorCtx(r.Context(), "Errore nel recupero del cookie store dopo registrazione", map[string]interface{}{
 			"error":   err.Error(),
 			"user_id": userID,
 		})
@@ -660,7 +719,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	session.Values["session_id"] = userSession.ID
 	
 	if err := session.Save(r, w); err != nil {
-		logger.Error("Errore nel salvataggio del cookie dopo registrazione", map[string]interface{}{
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio del cookie dopo registrazione", map[string]interface{}{
 			"error":      err.Error(),
 			"user_id":    userID,
 			"session_id": userSession.ID,
@@ -670,7 +729,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Log successo registrazione GDPR
-	logger.Info("Nuova registrazione completata", map[string]interface{}{
+	logger.InfoCtx(r.Context(), "Nuova registrazione completata", map[string]interface{}{
 		"user_id":           userID,
 		"username":          username,
 		"email":             email,
@@ -679,13 +738,29 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		"marketing_consent": marketingConsent,
 	})
 
+	if baseURL, err := emailBaseURL(); err != nil {
+		logger.ErrorCtx(r.Context(), "Email di benvenuto non inviata", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": userID,
+		})
+	} else if err := notifyUser(ctx, user.Email, user.Locale, i18n.KeyWelcome, map[string]interface{}{
+		"Username":       username,
+		"RestaurantName": restaurantName,
+		"LoginURL":       baseURL + "/login",
+	}); err != nil {
+		logger.WarnCtx(r.Context(), "Errore nell'invio della email di benvenuto", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": userID,
+		})
+	}
+
 	// Redirect all'admin con messaggio di benvenuto
 	http.Redirect(w, r, "/admin?welcome=1", http.StatusFound)
 }
 
 // LogoutHandler gestisce il logout
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	session, err := store.Get(r, "qr-menu-session")
+	session, err := sessionStore().Get(r, SessionCookieName)
 	if err == nil {
 		// Rimuovi la sessione da MongoDB
 		if sessionID, ok := session.Values["session_id"].(string); ok {
@@ -693,12 +768,12 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 			defer cancel()
 			
 			if err := db.MongoInstance.DeleteSession(ctx, sessionID); err != nil {
-				logger.Error("Errore nella cancellazione della sessione da MongoDB", map[string]interface{}{
+				logger.ErrorCtx(r.Context(), "Errore nella cancellazione della sessione da MongoDB", map[string]interface{}{
 					"error":      err.Error(),
 					"session_id": sessionID,
 				})
 			} else {
-				logger.Info("Sessione eliminata da MongoDB", map[string]interface{}{
+				logger.InfoCtx(r.Context(), "Sessione eliminata da MongoDB", map[string]interface{}{
 					"session_id": sessionID,
 				})
 			}
@@ -714,22 +789,14 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // RequireAuth middleware per proteggere le route
-// RequireAuth middleware per proteggere le route che richiedono un ristorante selezionato
+// RequireAuth middleware per proteggere le route che richiedono un ristorante selezionato.
+// Il ristorante viene messo nel contesto della richiesta (pkg/tenancy)
 func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	scoped := requireTenant(next)
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger.AuditLog("ACCESS_ATTEMPT", "protected_route",
-			"Tentativo di accesso a risorsa protetta", "", getClientIP(r), r.UserAgent(), nil)
-		
-		_, err := getCurrentRestaurant(r)
-		if err != nil {
-			logger.Warn("Accesso negato: ristorante non selezionato", map[string]interface{}{
-				"error": err.Error(),
-				"url":   r.URL.Path,
-			})
-			http.Redirect(w, r, "/login", http.StatusFound)
-			return
-		}
-		next(w, r)
+		logger.AuditLogCtx(r.Context(), "ACCESS_ATTEMPT", "protected_route",
+			"Tentativo di accesso a risorsa protetta", "", nil)
+		scoped(w, r)
 	}
 }
 
@@ -737,12 +804,12 @@ func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 // Usato per /select-restaurant, /add-restaurant, ecc.
 func RequireUser(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger.AuditLog("USER_ACCESS_ATTEMPT", "user_route",
-			"Tentativo di accesso a risorsa utente", "", getClientIP(r), r.UserAgent(), nil)
+		logger.AuditLogCtx(r.Context(), "USER_ACCESS_ATTEMPT", "user_route",
+			"Tentativo di accesso a risorsa utente", "", nil)
 		
 		userSession, err := getSessionFromRequest(r)
 		if err != nil || userSession == nil {
-			logger.Warn("Accesso negato: sessione non trovata", map[string]interface{}{
+			logger.WarnCtx(r.Context(), "Accesso negato: sessione non trovata", map[string]interface{}{
 				"error": err.Error(),
 				"url":   r.URL.Path,
 			})
@@ -756,7 +823,7 @@ func RequireUser(next http.HandlerFunc) http.HandlerFunc {
 		
 		user, err := db.MongoInstance.GetUserByID(ctx, userSession.UserID)
 		if err != nil || user == nil || !user.IsActive {
-			logger.Warn("Accesso negato: utente non trovato o non attivo", map[string]interface{}{
+			logger.WarnCtx(r.Context(), "Accesso negato: utente non trovato o non attivo", map[string]interface{}{
 				"error":   err,
 				"user_id": userSession.UserID,
 				"url":     r.URL.Path,
@@ -765,7 +832,7 @@ func RequireUser(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 		
-		logger.Info("Accesso utente autorizzato", map[string]interface{}{
+		logger.InfoCtx(r.Context(), "Accesso utente autorizzato", map[string]interface{}{
 			"user_id":  user.ID,
 			"username": user.Username,
 			"url":      r.URL.Path,
@@ -779,26 +846,16 @@ func RequireUser(next http.HandlerFunc) http.HandlerFunc {
 
 func saveRestaurantToStorage(restaurant *models.Restaurant) {
 	filename := filepath.Join("storage", fmt.Sprintf("restaurant_%s.json", restaurant.ID))
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Printf("Errore nella creazione del file restaurant %s: %v", filename, err)
-		return
+	if err := db.WriteJSONAtomic(filename, restaurant); err != nil {
+		log.Printf("Errore nel salvataggio del file restaurant %s: %v", filename, err)
 	}
-	defer file.Close()
-
-	json.NewEncoder(file).Encode(restaurant)
 }
 
 func saveSessionToStorage(session *models.Session) {
 	filename := filepath.Join("storage", fmt.Sprintf("session_%s.json", session.ID))
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Printf("Errore nella creazione del file session %s: %v", filename, err)
-		return
+	if err := db.WriteJSONAtomic(filename, session); err != nil {
+		log.Printf("Errore nel salvataggio del file session %s: %v", filename, err)
 	}
-	defer file.Close()
-
-	json.NewEncoder(file).Encode(session)
 }
 
 func deleteSessionFromStorage(sessionID string) {
@@ -806,56 +863,14 @@ func deleteSessionFromStorage(sessionID string) {
 	os.Remove(filename)
 }
 
-func loadRestaurantsFromStorage() {
-	files, err := filepath.Glob("storage/restaurant_*.json")
-	if err != nil {
-		log.Printf("Errore nella lettura dei file restaurant: %v", err)
-		return
-	}
-
-	for _, filename := range files {
-		file, err := os.Open(filename)
-		if err != nil {
-			log.Printf("Errore nell'apertura del file %s: %v", filename, err)
-			continue
-		}
-
-		var restaurant models.Restaurant
-		if err := json.NewDecoder(file).Decode(&restaurant); err != nil {
-			log.Printf("Errore nel decode del restaurant da %s: %v", filename, err)
-			file.Close()
-			continue
-		}
-
-		// NOTA: Role rimosso dalla struttura Restaurant
-		// TODO: Aggiornare load per usare MongoDB
-
-		restaurants[restaurant.ID] = &restaurant
-		file.Close()
-	}
-
-	log.Printf("Caricati %d ristoranti dallo storage", len(restaurants))
-
-	// ⭐ Sessioni ora gestite direttamente da MongoDB - non serve più caricare da file
-	// loadSessionsFromStorage() - DEPRECATO
-}
-
 // ⭐ DEPRECATA - Le sessioni ora sono in MongoDB
 // func loadSessionsFromStorage() {
 // 	Le sessioni vengono ora recuperate dinamicamente da MongoDB
 // 	tramite GetSessionByID quando necessario
 // }
 
-// getClientIP estrae l'IP reale del client considerando proxy e load balancer
+// getClientIP estrae l'IP del client; gli header del proxy contano solo se abilitati
+// (server.trust_proxy_headers), vedi security.ClientIP
 func getClientIP(r *http.Request) string {
-	headers := []string{"X-Forwarded-For", "X-Real-Ip", "X-Client-Ip"}
-
-	for _, header := range headers {
-		ip := r.Header.Get(header)
-		if ip != "" {
-			return ip
-		}
-	}
-
-	return r.RemoteAddr
+	return security.ClientIP(r)
 }
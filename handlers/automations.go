@@ -0,0 +1,461 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+)
+
+// Trigger e azioni per le piattaforme no-code (Zapier, Make): rispondono con oggetti piatti e,
+// per i trigger, con un array dal più recente, senza l'involucro delle altre API. Zapier e Make
+// interrogano periodicamente i trigger e riconoscono i nuovi elementi dal campo id
+
+const (
+	// automationDefaultLimit e automationMaxLimit sono gli elementi restituiti dai trigger
+	automationDefaultLimit = 25
+	automationMaxLimit     = 100
+)
+
+// Trigger disponibili
+const (
+	triggerNewOrder    = "new-order"
+	triggerNewFeedback = "new-feedback"
+	triggerMenuUpdated = "menu-updated"
+)
+
+// automationOrder è un ordine nella forma dei trigger
+type automationOrder struct {
+	ID            string    `json:"id"`
+	Number        int       `json:"number"`
+	Status        string    `json:"status"`
+	Source        string    `json:"source"`
+	Table         string    `json:"table"`
+	Total         float64   `json:"total"`
+	Currency      string    `json:"currency"`
+	ItemsCount    int       `json:"items_count"`
+	ItemsSummary  string    `json:"items_summary"` // es. "2× Margherita, 1× Tiramisù"
+	Notes         string    `json:"notes"`
+	Mode          string    `json:"mode"` // Ritiro, consegna o tavolo prenotati; vuoto per gli ordini al tavolo
+	CustomerName  string    `json:"customer_name"`
+	CustomerPhone string    `json:"customer_phone"`
+	CustomerEmail string    `json:"customer_email"`
+	Address       string    `json:"address"`
+	SlotStart     string    `json:"slot_start"`
+	PaymentStatus string    `json:"payment_status"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// automationFeedback è un feedback nella forma dei trigger
+type automationFeedback struct {
+	ID         string    `json:"id"`
+	Rating     int       `json:"rating"`
+	Comment    string    `json:"comment"`
+	Status     string    `json:"status"`
+	MenuID     string    `json:"menu_id"`
+	OrderID    string    `json:"order_id"`
+	ItemsRated int       `json:"items_rated"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// automationMenu è una modifica a un menu nella forma dei trigger. L'id cambia a ogni
+// modifica, così ogni salvataggio è un nuovo elemento per Zapier e Make
+type automationMenu struct {
+	ID         string    `json:"id"`
+	MenuID     string    `json:"menu_id"`
+	Name       string    `json:"name"`
+	IsActive   bool      `json:"is_active"`
+	Categories int       `json:"categories"`
+	ItemsCount int       `json:"items_count"`
+	PublicURL  string    `json:"public_url"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// automationItem è un piatto nella risposta delle azioni
+type automationItem struct {
+	ID          string  `json:"id"`
+	MenuID      string  `json:"menu_id"`
+	CategoryID  string  `json:"category_id"`
+	Category    string  `json:"category"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Available   bool    `json:"available"`
+}
+
+func newAutomationOrder(order *models.Order, currency string) automationOrder {
+	out := automationOrder{
+		ID:            order.ID,
+		Number:        order.Number,
+		Status:        order.Status,
+		Source:        order.Source,
+		Table:         order.Table,
+		Total:         order.Total,
+		Currency:      currency,
+		Notes:         order.Notes,
+		PaymentStatus: order.PaymentStatus,
+		CreatedAt:     order.CreatedAt,
+	}
+	var lines []string
+	for _, line := range order.Lines {
+		out.ItemsCount += line.Quantity
+		lines = append(lines, fmt.Sprintf("%d× %s", line.Quantity, line.Name))
+	}
+	out.ItemsSummary = strings.Join(lines, ", ")
+	if f := order.Fulfillment; f != nil {
+		out.Mode = f.Mode
+		out.CustomerName = f.CustomerName
+		out.CustomerPhone = f.CustomerPhone
+		out.CustomerEmail = f.CustomerEmail
+		out.Address = f.Address
+		out.SlotStart = f.SlotStart.Format(time.RFC3339)
+	}
+	return out
+}
+
+func newAutomationFeedback(feedback *models.Feedback) automationFeedback {
+	return automationFeedback{
+		ID:         feedback.ID,
+		Rating:     feedback.Rating,
+		Comment:    feedback.Comment,
+		Status:     feedback.Status,
+		MenuID:     feedback.MenuID,
+		OrderID:    feedback.OrderID,
+		ItemsRated: len(feedback.Items),
+		CreatedAt:  feedback.CreatedAt,
+	}
+}
+
+func newAutomationMenu(menu *models.Menu) automationMenu {
+	out := automationMenu{
+		ID:         menu.ID + "-" + strconv.FormatInt(menu.UpdatedAt.UnixMilli(), 10),
+		MenuID:     menu.ID,
+		Name:       menu.Name,
+		IsActive:   menu.IsActive,
+		Categories: len(menu.Categories),
+		PublicURL:  menu.PublicURL,
+		UpdatedAt:  menu.UpdatedAt,
+	}
+	for _, category := range menu.Categories {
+		out.ItemsCount += len(category.Items)
+	}
+	return out
+}
+
+func newAutomationItem(menu *models.Menu, category *models.MenuCategory, item *models.MenuItem) automationItem {
+	return automationItem{
+		ID:          item.ID,
+		MenuID:      menu.ID,
+		CategoryID:  category.ID,
+		Category:    category.Name,
+		Name:        item.Name,
+		Description: item.Description,
+		Price:       item.Price,
+		Available:   item.Available,
+	}
+}
+
+// automationLimit legge il numero di elementi richiesti da ?limit=
+func automationLimit(r *http.Request) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		return automationDefaultLimit
+	}
+	return min(limit, automationMaxLimit)
+}
+
+// respondAutomation invia la risposta di un trigger o di un'azione senza cache
+func respondAutomation(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.JSON(w, status, data)
+}
+
+// AutomationAuthTestHandler restituisce il ristorante della API key, usato da Zapier e Make
+// per verificare la connessione (GET /api/v1/automations/me)
+func AutomationAuthTestHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	respondAutomation(w, http.StatusOK, map[string]string{
+		"id":       restaurant.ID,
+		"name":     restaurant.Name,
+		"username": restaurant.Username,
+	})
+}
+
+// NewOrdersTriggerHandler restituisce gli ultimi ordini, dal più recente
+// (GET /api/v1/automations/triggers/new-order)
+func NewOrdersTriggerHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	orders, _, err := db.MongoInstance.FindOrders(ctx, db.OrderFilter{RestaurantID: restaurant.ID}, db.ListOptions{Limit: int64(automationLimit(r))})
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero degli ordini")
+		return
+	}
+	currency := orderCurrency(restaurant)
+	out := make([]automationOrder, 0, len(orders))
+	for _, order := range orders {
+		out = append(out, newAutomationOrder(order, currency))
+	}
+	respondAutomation(w, http.StatusOK, out)
+}
+
+// NewFeedbackTriggerHandler restituisce gli ultimi feedback, dal più recente; ?status= filtra
+// per stato di moderazione (GET /api/v1/automations/triggers/new-feedback)
+func NewFeedbackTriggerHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	filter := db.FeedbackFilter{RestaurantID: restaurant.ID, Status: r.URL.Query().Get("status")}
+	feedback, _, err := db.MongoInstance.FindFeedback(ctx, filter, db.ListOptions{Limit: int64(automationLimit(r))})
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei feedback")
+		return
+	}
+	out := make([]automationFeedback, 0, len(feedback))
+	for _, f := range feedback {
+		out = append(out, newAutomationFeedback(f))
+	}
+	respondAutomation(w, http.StatusOK, out)
+}
+
+// MenuUpdatedTriggerHandler restituisce i menu dal modificato più di recente
+// (GET /api/v1/automations/triggers/menu-updated)
+func MenuUpdatedTriggerHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei menu")
+		return
+	}
+	sort.Slice(menus, func(i, j int) bool { return menus[i].UpdatedAt.After(menus[j].UpdatedAt) })
+	if limit := automationLimit(r); len(menus) > limit {
+		menus = menus[:limit]
+	}
+	out := make([]automationMenu, 0, len(menus))
+	for _, menu := range menus {
+		out = append(out, newAutomationMenu(menu))
+	}
+	respondAutomation(w, http.StatusOK, out)
+}
+
+// TriggerSampleHandler restituisce un elemento di esempio del trigger, con gli stessi campi
+// dei dati reali, per configurare gli zap prima che arrivino ordini o feedback
+// (GET /api/v1/automations/triggers/{trigger}/sample)
+func TriggerSampleHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	at := time.Date(2024, time.May, 17, 20, 30, 0, 0, time.UTC)
+	var sample interface{}
+	switch mux.Vars(r)["trigger"] {
+	case triggerNewOrder:
+		sample = newAutomationOrder(&models.Order{
+			ID:     "sample-order",
+			Number: 42,
+			Status: models.OrderStatusNew,
+			Source: models.OrderSourceOnline,
+			Lines: []models.OrderLine{
+				{Name: "Margherita", Quantity: 2, Price: 8},
+				{Name: "Tiramisù", Quantity: 1, Price: 6},
+			},
+			Total: 22,
+			Fulfillment: &models.OrderFulfillment{
+				Mode:          models.FulfillmentTakeaway,
+				SlotStart:     at.Add(30 * time.Minute),
+				CustomerName:  "Mario Rossi",
+				CustomerPhone: "393331234567",
+				CustomerEmail: "mario.rossi@example.com",
+			},
+			CreatedAt: at,
+		}, orderCurrency(restaurant))
+	case triggerNewFeedback:
+		sample = newAutomationFeedback(&models.Feedback{
+			ID:        "sample-feedback",
+			MenuID:    "sample-menu",
+			Rating:    5,
+			Comment:   "Pizza ottima, servizio veloce",
+			Items:     []models.ItemFeedback{{ItemID: "sample-item", Rating: 5}},
+			Status:    models.FeedbackPending,
+			CreatedAt: at,
+		})
+	case triggerMenuUpdated:
+		sample = newAutomationMenu(&models.Menu{
+			ID:         "sample-menu",
+			Name:       "Menu cena",
+			IsActive:   true,
+			Categories: []models.MenuCategory{{Items: make([]models.MenuItem, 12)}, {Items: make([]models.MenuItem, 6)}},
+			PublicURL:  getBaseURL(r) + "/menu/sample-menu",
+			UpdatedAt:  at,
+		})
+	default:
+		httputil.NotFound(w, "Trigger")
+		return
+	}
+	respondAutomation(w, http.StatusOK, []interface{}{sample})
+}
+
+// CreateItemActionHandler aggiunge un piatto al menu indicato o, se manca, al menu attivo. La
+// categoria è cercata per nome (o ID) e creata se non esiste
+// (POST /api/v1/automations/actions/create-item)
+func CreateItemActionHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req struct {
+		itemV2Request
+		MenuID   string `json:"menu_id"`
+		Category string `json:"category"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	categoryName := strings.TrimSpace(req.Category)
+	if categoryName == "" {
+		httputil.BadRequest(w, "category è obbligatorio")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var menu *models.Menu
+	var err error
+	if req.MenuID != "" {
+		menu, err = db.MongoInstance.GetRestaurantMenu(ctx, req.MenuID, restaurant.ID)
+	} else {
+		menu, err = activeRestaurantMenu(ctx, restaurant.ID)
+	}
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+		return
+	}
+	if menu == nil {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+	if rejectArchivedMenuV2(w, menu) {
+		return
+	}
+
+	ci := -1
+	for i, category := range menu.Categories {
+		if category.ID == categoryName || strings.EqualFold(category.Name, categoryName) {
+			ci = i
+			break
+		}
+	}
+	if ci < 0 {
+		menu.Categories = append(menu.Categories, models.MenuCategory{
+			ID:           uuid.New().String(),
+			Name:         categoryName,
+			Items:        []models.MenuItem{},
+			DisplayOrder: len(menu.Categories),
+		})
+		ci = len(menu.Categories) - 1
+	}
+	category := &menu.Categories[ci]
+	item, err := newItemV2(req.itemV2Request, category.Name)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	item.DisplayOrder = len(category.Items)
+	category.Items = append(category.Items, item)
+	if !saveMenuV2(ctx, w, r, menu) {
+		return
+	}
+
+	publishItemEvent(r, menu, &item, "created")
+	respondAutomation(w, http.StatusCreated, newAutomationItem(menu, category, &item))
+}
+
+// ToggleAvailabilityActionHandler rende disponibile o esaurito un piatto dei menu del
+// ristorante; senza available inverte la disponibilità attuale
+// (POST /api/v1/automations/actions/toggle-availability)
+func ToggleAvailabilityActionHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req struct {
+		ItemID    string `json:"item_id"`
+		Available *bool  `json:"available"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if req.ItemID == "" {
+		httputil.BadRequest(w, "item_id è obbligatorio")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei menu")
+		return
+	}
+	for _, menu := range menus {
+		for ci := range menu.Categories {
+			category := &menu.Categories[ci]
+			for ii := range category.Items {
+				item := &category.Items[ii]
+				if item.ID != req.ItemID {
+					continue
+				}
+				if rejectArchivedMenuV2(w, menu) {
+					return
+				}
+				if req.Available != nil {
+					item.Available = *req.Available
+				} else {
+					item.Available = !item.Available
+				}
+				if !saveMenuV2(ctx, w, r, menu) {
+					return
+				}
+				publishItemEvent(r, menu, item, "updated")
+				respondAutomation(w, http.StatusOK, newAutomationItem(menu, category, item))
+				return
+			}
+		}
+	}
+	httputil.NotFound(w, "Piatto")
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+)
+
+var (
+	// configuredBaseURL è l'URL pubblico configurato (server.base_url); se vuoto
+	// viene ricavato da ogni richiesta
+	configuredBaseURL string
+	// trustProxyHeaders abilita X-Forwarded-Proto/Host impostati dal reverse proxy
+	trustProxyHeaders bool
+)
+
+// SetBaseURL configura come vengono generati link e QR code
+func SetBaseURL(baseURL string, trustProxy bool) {
+	configuredBaseURL = strings.TrimRight(baseURL, "/")
+	trustProxyHeaders = trustProxy
+}
+
+// getBaseURL restituisce l'URL pubblico dell'applicazione: quello configurato oppure,
+// dietro un reverse proxy, quello ricostruito dagli header X-Forwarded-*
+func getBaseURL(r *http.Request) string {
+	if configuredBaseURL != "" {
+		return configuredBaseURL
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	host := r.Host
+
+	if trustProxyHeaders {
+		if proto := forwardedValue(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if forwardedHost := forwardedValue(r.Header.Get("X-Forwarded-Host")); forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, host)
+}
+
+// errBaseURLRequired indica che server.base_url non è configurato e un link non può
+// essere inviato per email
+var errBaseURLRequired = errors.New("server.base_url non configurato: impossibile generare il link da inviare")
+
+// emailBaseURL restituisce l'URL pubblico da usare nei link inviati per email (reset
+// password, verifica email, inviti). A differenza di getBaseURL non ricava mai l'indirizzo
+// dalla richiesta: Host e X-Forwarded-Host li sceglie il client, e un link con un token
+// che punta a un dominio dell'attaccante gli consegnerebbe il token
+func emailBaseURL() (string, error) {
+	if configuredBaseURL == "" {
+		return "", errBaseURLRequired
+	}
+	return configuredBaseURL, nil
+}
+
+// sharedCacheBaseURL restituisce l'URL pubblico per le risposte che le cache condivise (CDN,
+// proxy) servono a tutti. Se server.base_url non è configurato lo ricava dalla richiesta e
+// rende la risposta privata: altrimenti un solo Host o X-Forwarded-Host falsificato finirebbe
+// nella copia servita a ogni visitatore
+func sharedCacheBaseURL(w http.ResponseWriter, r *http.Request) string {
+	if configuredBaseURL != "" {
+		return configuredBaseURL
+	}
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	return getBaseURL(r)
+}
+
+// forwardedValue restituisce il primo valore di un header X-Forwarded-* (quello impostato
+// dal proxy più vicino al client)
+func forwardedValue(header string) string {
+	if i := strings.Index(header, ","); i >= 0 {
+		header = header[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(header))
+}
+
+// MigratePublicURLs rigenera URL pubblico e QR code dei menu salvati con un indirizzo
+// diverso da quello attuale (es. dopo il cambio di server.base_url). Restituisce il
+// numero di ristoranti aggiornati
+func MigratePublicURLs(ctx context.Context) (int, error) {
+	if configuredBaseURL == "" || db.MongoInstance == nil {
+		return 0, nil
+	}
+
+	restaurants, err := db.MongoInstance.GetAllRestaurants(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("errore recupero ristoranti: %v", err)
+	}
+
+	updated := 0
+	for _, restaurant := range restaurants {
+		if ctx.Err() != nil {
+			return updated, ctx.Err()
+		}
+		if restaurant.Username == "" {
+			continue
+		}
+
+		menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurant.ID)
+		if err != nil {
+			return updated, fmt.Errorf("errore recupero menu del ristorante %s: %v", restaurant.ID, err)
+		}
+
+		expected := restaurantPublicURL(configuredBaseURL, restaurant)
+		stale := false
+		for _, menu := range menus {
+			if menu.IsCompleted && menu.PublicURL != expected {
+				stale = true
+				break
+			}
+		}
+		if !stale {
+			continue
+		}
+
+		refreshRestaurantQRCode(ctx, restaurant, configuredBaseURL)
+		updated++
+	}
+
+	return updated, nil
+}
+
+// RunPublicURLMigration esegue MigratePublicURLs all'avvio. È bloccante: va avviato in una goroutine
+func RunPublicURLMigration(ctx context.Context) {
+	runCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	updated, err := MigratePublicURLs(runCtx)
+	if err != nil {
+		logger.Warn("Migrazione degli URL pubblici non completata", map[string]interface{}{
+			"error":   err.Error(),
+			"updated": updated,
+		})
+		return
+	}
+	if updated > 0 {
+		logger.Info("URL pubblici e QR code aggiornati al nuovo indirizzo", map[string]interface{}{
+			"base_url":    configuredBaseURL,
+			"restaurants": updated,
+		})
+	}
+}
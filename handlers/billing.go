@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+)
+
+// trialCheckInterval è ogni quanto vengono inviati i promemoria e chiuse le prove scadute
+const trialCheckInterval = time.Hour
+
+// couponCodePattern limita i codici a lettere maiuscole, cifre, trattino e underscore
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// normalizeCouponCode porta il codice nel formato salvato, così i clienti possono
+// inserirlo senza badare alle maiuscole
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// couponRequest è il corpo di creazione e modifica di un coupon
+type couponRequest struct {
+	Code           string     `json:"code"`
+	Description    string     `json:"description"`
+	PercentOff     int        `json:"percent_off"`
+	AmountOffCents int64      `json:"amount_off_cents"`
+	Currency       string     `json:"currency"`
+	TrialDays      int        `json:"trial_days"`
+	PlanIDs        []string   `json:"plan_ids"`
+	MaxRedemptions int        `json:"max_redemptions"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	IsActive       *bool      `json:"is_active"` // Default true
+}
+
+// applyTo valida la richiesta e ne copia i campi nel coupon. Restituisce il messaggio
+// d'errore da mostrare all'operatore
+func (req *couponRequest) applyTo(coupon *models.Coupon) error {
+	code := normalizeCouponCode(req.Code)
+	switch {
+	case !couponCodePattern.MatchString(code):
+		return errors.New("Il codice deve avere da 3 a 32 caratteri tra lettere, cifre, - e _")
+	case req.PercentOff < 0 || req.PercentOff > 100:
+		return errors.New("Lo sconto percentuale deve essere tra 0 e 100")
+	case req.AmountOffCents < 0:
+		return errors.New("Lo sconto non può essere negativo")
+	case req.PercentOff > 0 && req.AmountOffCents > 0:
+		return errors.New("Indicare uno sconto percentuale o un importo, non entrambi")
+	case req.AmountOffCents > 0 && len(req.Currency) != 3:
+		return errors.New("Lo sconto a importo richiede la valuta (es. eur)")
+	case req.TrialDays < 0 || req.TrialDays > 365:
+		return errors.New("I giorni di prova devono essere tra 0 e 365")
+	case req.PercentOff == 0 && req.AmountOffCents == 0 && req.TrialDays == 0:
+		return errors.New("Il coupon deve dare uno sconto o giorni di prova")
+	case req.MaxRedemptions < 0:
+		return errors.New("Il numero massimo di utilizzi non può essere negativo")
+	}
+
+	coupon.Code = code
+	coupon.Description = strings.TrimSpace(req.Description)
+	coupon.PercentOff = req.PercentOff
+	coupon.AmountOffCents = req.AmountOffCents
+	coupon.Currency = strings.ToLower(req.Currency)
+	coupon.TrialDays = req.TrialDays
+	coupon.PlanIDs = req.PlanIDs
+	coupon.MaxRedemptions = req.MaxRedemptions
+	coupon.ExpiresAt = req.ExpiresAt
+	coupon.IsActive = req.IsActive == nil || *req.IsActive
+	return nil
+}
+
+// AdminListCouponsHandler elenca i coupon (GET /api/admin/billing/coupons)
+func AdminListCouponsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	coupons, err := db.MongoInstance.GetCoupons(ctx)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero dei coupon", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nel recupero dei coupon")
+		return
+	}
+	if coupons == nil {
+		coupons = []*models.Coupon{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", coupons)
+}
+
+// AdminCreateCouponHandler crea un coupon (POST /api/admin/billing/coupons)
+func AdminCreateCouponHandler(w http.ResponseWriter, r *http.Request) {
+	var req couponRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Richiesta non valida")
+		return
+	}
+	now := time.Now()
+	coupon := &models.Coupon{ID: uuid.New().String(), CreatedAt: now, UpdatedAt: now}
+	if err := req.applyTo(coupon); err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.CreateCoupon(ctx, coupon); err != nil {
+		if errors.Is(err, db.ErrDuplicateCouponCode) {
+			httputil.Conflict(w, "Esiste già un coupon con questo codice")
+			return
+		}
+		logger.ErrorCtx(r.Context(), "Errore nella creazione del coupon", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nella creazione del coupon")
+		return
+	}
+
+	RecordAuditLogAsync("COUPON_CREATED", "coupon", coupon.ID, "", getClientIP(r), r.UserAgent(), "success")
+	httputil.Created(w, "Coupon creato", coupon)
+}
+
+// AdminUpdateCouponHandler modifica un coupon (PUT /api/admin/billing/coupons/{id}). Gli
+// utilizzi già conteggiati restano invariati
+func AdminUpdateCouponHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var req couponRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Richiesta non valida")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	coupon, err := db.MongoInstance.GetCouponByID(ctx, id)
+	if err == nil && coupon == nil {
+		httputil.NotFound(w, "Coupon")
+		return
+	}
+	if err == nil {
+		if verr := req.applyTo(coupon); verr != nil {
+			httputil.BadRequest(w, verr.Error())
+			return
+		}
+		coupon.UpdatedAt = time.Now()
+		_, err = db.MongoInstance.UpdateCoupon(ctx, coupon)
+	}
+	if errors.Is(err, db.ErrDuplicateCouponCode) {
+		httputil.Conflict(w, "Esiste già un coupon con questo codice")
+		return
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella modifica del coupon", map[string]interface{}{
+			"error":     err.Error(),
+			"coupon_id": id,
+		})
+		httputil.InternalServerError(w, "Errore nella modifica del coupon")
+		return
+	}
+
+	RecordAuditLogAsync("COUPON_UPDATED", "coupon", coupon.ID, "", getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Coupon aggiornato", coupon)
+}
+
+// AdminDeleteCouponHandler elimina un coupon (DELETE /api/admin/billing/coupons/{id}). Gli
+// abbonamenti che lo hanno già usato ne conservano il codice
+func AdminDeleteCouponHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := db.MongoInstance.DeleteCoupon(ctx, id)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'eliminazione del coupon", map[string]interface{}{
+			"error":     err.Error(),
+			"coupon_id": id,
+		})
+		httputil.InternalServerError(w, "Errore nell'eliminazione del coupon")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "Coupon")
+		return
+	}
+
+	RecordAuditLogAsync("COUPON_DELETED", "coupon", id, "", getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// redeemCoupon verifica il coupon per il piano e ne conta un utilizzo. Restituisce un
+// errore da mostrare al cliente se il codice non è utilizzabile
+func redeemCoupon(ctx context.Context, code, planID string) (*models.Coupon, error) {
+	coupon, err := db.MongoInstance.GetCouponByCode(ctx, normalizeCouponCode(code))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if coupon == nil || !coupon.Redeemable(now) {
+		return nil, errCouponInvalid
+	}
+	if !coupon.AppliesTo(planID) {
+		return nil, fmt.Errorf("%w: il coupon non vale per il piano %s", errCouponInvalid, planID)
+	}
+	redeemed, err := db.MongoInstance.RedeemCoupon(ctx, coupon.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !redeemed {
+		return nil, errCouponInvalid
+	}
+	return coupon, nil
+}
+
+// errCouponInvalid indica un coupon inesistente, scaduto, disattivato o esaurito
+var errCouponInvalid = errors.New("Coupon non valido o esaurito")
+
+// StartTrialHandler avvia la prova gratuita del piano billing.trial_plan per il ristorante
+// selezionato (POST /api/v1/billing/trial). Un coupon opzionale ne allunga la durata
+func StartTrialHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	billingSettingsMu.Lock()
+	cfg := billingSettings
+	billingSettingsMu.Unlock()
+	if cfg.TrialDays <= 0 {
+		httputil.NotFound(w, "Prova gratuita")
+		return
+	}
+
+	var req struct {
+		Coupon string `json:"coupon"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httputil.BadRequest(w, "Richiesta non valida")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	current, err := db.MongoInstance.GetActiveSubscription(ctx, restaurant.ID)
+	if err != nil {
+		respondBillingError(w, r, err, restaurant.ID)
+		return
+	}
+	if current != nil && current.PlanID != models.FreePlanID {
+		httputil.Conflict(w, "Il ristorante ha già un abbonamento attivo")
+		return
+	}
+	used, err := db.MongoInstance.HasTrialSubscription(ctx, restaurant.ID)
+	if err != nil {
+		respondBillingError(w, r, err, restaurant.ID)
+		return
+	}
+	if used {
+		httputil.Conflict(w, "La prova gratuita è già stata usata")
+		return
+	}
+
+	days := cfg.TrialDays
+	var couponCode string
+	if strings.TrimSpace(req.Coupon) != "" {
+		coupon, err := redeemCoupon(ctx, req.Coupon, cfg.TrialPlan)
+		if err != nil {
+			respondBillingError(w, r, err, restaurant.ID)
+			return
+		}
+		days += coupon.TrialDays
+		couponCode = coupon.Code
+	}
+
+	now := time.Now()
+	trialEndsAt := now.AddDate(0, 0, days)
+	sub := &models.BillingSubscription{
+		ID:               uuid.New().String(),
+		RestaurantID:     restaurant.ID,
+		PlanID:           cfg.TrialPlan,
+		Status:           models.SubscriptionTrialing,
+		Provider:         "trial",
+		CurrentPeriodEnd: trialEndsAt,
+		TrialEndsAt:      &trialEndsAt,
+		CouponCode:       couponCode,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := db.MongoInstance.CreateSubscription(ctx, sub); err != nil {
+		respondBillingError(w, r, err, restaurant.ID)
+		return
+	}
+
+	RecordAuditLogAsync("TRIAL_STARTED", "subscription", sub.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	emitSubscriptionUpdated(sub)
+	httputil.Created(w, "Prova gratuita attivata", sub)
+}
+
+// RedeemCouponHandler applica un coupon all'abbonamento del ristorante selezionato
+// (POST /api/v1/billing/coupons/redeem). Durante la prova i giorni del coupon la allungano;
+// lo sconto resta sull'abbonamento per il pagamento presso il provider
+func RedeemCouponHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		httputil.BadRequest(w, "Specificare il codice del coupon")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sub, err := db.MongoInstance.GetActiveSubscription(ctx, restaurant.ID)
+	if err != nil {
+		respondBillingError(w, r, err, restaurant.ID)
+		return
+	}
+	if sub == nil {
+		httputil.BadRequest(w, "Nessun abbonamento a cui applicare il coupon")
+		return
+	}
+	if sub.CouponCode != "" {
+		httputil.Conflict(w, "All'abbonamento è già applicato un coupon")
+		return
+	}
+
+	coupon, err := redeemCoupon(ctx, req.Code, sub.PlanID)
+	if err != nil {
+		respondBillingError(w, r, err, restaurant.ID)
+		return
+	}
+	var trialEndsAt *time.Time
+	if sub.Status == models.SubscriptionTrialing && sub.TrialEndsAt != nil && coupon.TrialDays > 0 {
+		extended := sub.TrialEndsAt.AddDate(0, 0, coupon.TrialDays)
+		trialEndsAt = &extended
+		sub.TrialEndsAt = trialEndsAt
+		sub.CurrentPeriodEnd = extended
+	}
+	if err := db.MongoInstance.ApplySubscriptionCoupon(ctx, sub.ID, coupon.Code, trialEndsAt); err != nil {
+		respondBillingError(w, r, err, restaurant.ID)
+		return
+	}
+	sub.CouponCode = coupon.Code
+
+	RecordAuditLogAsync("COUPON_REDEEMED", "subscription", sub.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	emitSubscriptionUpdated(sub)
+	httputil.Success(w, "Coupon applicato", sub)
+}
+
+// emitSubscriptionUpdated pubblica il nuovo stato dell'abbonamento
+func emitSubscriptionUpdated(sub *models.BillingSubscription) {
+	data := map[string]interface{}{
+		"subscription_id": sub.ID,
+		"plan_id":         sub.PlanID,
+		"status":          sub.Status,
+		"coupon_code":     sub.CouponCode,
+	}
+	if sub.TrialEndsAt != nil {
+		data["trial_ends_at"] = sub.TrialEndsAt.UTC().Format(time.RFC3339)
+	}
+	eventBus.Publish(events.Event{Type: events.BillingSubscriptionUpdated, RestaurantID: sub.RestaurantID, Data: data})
+}
+
+// respondBillingError risponde 400 per i coupon non utilizzabili e 500 per gli altri errori
+func respondBillingError(w http.ResponseWriter, r *http.Request, err error, restaurantID string) {
+	if errors.Is(err, errCouponInvalid) {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	logger.ErrorCtx(r.Context(), "Errore nella gestione dell'abbonamento", map[string]interface{}{
+		"error":         err.Error(),
+		"restaurant_id": restaurantID,
+	})
+	httputil.InternalServerError(w, "Errore nella gestione dell'abbonamento")
+}
+
+// ProcessTrials avvisa i proprietari delle prove in scadenza entro billing.trial_reminder e
+// riporta al piano gratuito quelle scadute. Restituisce promemoria inviati e prove chiuse
+func ProcessTrials(ctx context.Context, now time.Time) (reminded, expired int, err error) {
+	billingSettingsMu.Lock()
+	reminder := billingSettings.TrialReminder
+	billingSettingsMu.Unlock()
+
+	subs, err := db.MongoInstance.GetTrialsEndingBefore(ctx, now.Add(reminder))
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, sub := range subs {
+		if ctx.Err() != nil {
+			return reminded, expired, ctx.Err()
+		}
+
+		if !sub.TrialEndsAt.After(now) {
+			ended, err := db.MongoInstance.EndTrial(ctx, sub.ID, now)
+			if err != nil {
+				return reminded, expired, err
+			}
+			if ended {
+				expired++
+				notifyTrialOwner(ctx, sub, i18n.KeyTrialExpired)
+				downgraded := *sub
+				downgraded.PlanID, downgraded.Status = models.FreePlanID, models.SubscriptionActive
+				emitSubscriptionUpdated(&downgraded)
+			}
+			continue
+		}
+
+		if sub.TrialReminderSentAt == nil {
+			if err := db.MongoInstance.SetTrialReminderSent(ctx, sub.ID, now); err != nil {
+				return reminded, expired, err
+			}
+			reminded++
+			notifyTrialOwner(ctx, sub, i18n.KeyTrialEnding)
+		}
+	}
+	return reminded, expired, nil
+}
+
+// notifyTrialOwner avvisa il proprietario del ristorante sulla sua prova gratuita
+func notifyTrialOwner(ctx context.Context, sub *models.BillingSubscription, key string) {
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, sub.RestaurantID)
+	if err != nil || restaurant == nil || !restaurant.IsActive || restaurant.OwnerID == "" {
+		return
+	}
+	owner, err := db.MongoInstance.GetUserByID(ctx, restaurant.OwnerID)
+	if err != nil || owner == nil || !owner.IsActive {
+		return
+	}
+
+	// sub è stato letto prima della scadenza: PlanID è il piano della prova anche dopo il downgrade
+	if err := notifyOwner(ctx, owner, key, map[string]interface{}{
+		"RestaurantName": restaurant.Name,
+		"PlanID":         sub.PlanID,
+		"TrialEndsAt":    *sub.TrialEndsAt,
+		"AccountURL":     configuredBaseURL + "/account",
+	}); err != nil {
+		logger.WarnCtx(ctx, "Errore nell'avviso sulla prova gratuita", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": sub.RestaurantID,
+			"event":         key,
+		})
+	}
+}
+
+// RunTrialWorker invia i promemoria e chiude le prove gratuite scadute all'avvio e poi ogni
+// trialCheckInterval, finché ctx non viene annullato. È bloccante: va avviato in una goroutine
+func RunTrialWorker(ctx context.Context) {
+	run := func() {
+		runCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+		defer cancel()
+		reminded, expired, err := ProcessTrials(runCtx, time.Now())
+		if err != nil {
+			logger.Error("Errore nella gestione delle prove gratuite", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		if reminded > 0 || expired > 0 {
+			logger.Info("Prove gratuite aggiornate", map[string]interface{}{
+				"reminded": reminded,
+				"expired":  expired,
+			})
+		}
+	}
+
+	run()
+
+	ticker := time.NewTicker(trialCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
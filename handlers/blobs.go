@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"qr-menu/models"
+	"qr-menu/pkg/avscan"
+	"qr-menu/pkg/imaging"
+	"qr-menu/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
+)
+
+// blobStore contiene immagini e QR code. Di default usa la cartella static locale,
+// in produzione viene sostituito da SetBlobStore (es. S3/MinIO)
+var blobStore storage.BlobStore = storage.NewLocalStore("static", "/static")
+
+// SetBlobStore imposta lo storage usato per immagini e QR code
+func SetBlobStore(store storage.BlobStore) {
+	blobStore = store
+	log.Printf("✅ Blob store impostato in handlers package")
+}
+
+// uploadGuard scansiona con l'antivirus i file caricati prima di salvarli (nil = scansione disattivata)
+var uploadGuard *avscan.Guard
+
+// SetUploadGuard imposta la scansione antivirus dei file caricati
+func SetUploadGuard(guard *avscan.Guard) {
+	uploadGuard = guard
+}
+
+// restaurantQRKey restituisce la chiave del QR code permanente di un ristorante
+func restaurantQRKey(restaurantID string) string {
+	return fmt.Sprintf("qrcodes/restaurant_%s.png", restaurantID)
+}
+
+// saveRestaurantQRCode genera il QR code che punta al ristorante e lo salva nel blob store.
+// Restituisce l'URL pubblico dell'immagine
+func saveRestaurantQRCode(ctx context.Context, restaurantID, restaurantURL string) (string, error) {
+	png, err := qrcode.Encode(restaurantURL, qrcode.Medium, 256)
+	if err != nil {
+		return "", fmt.Errorf("errore generazione QR code: %v", err)
+	}
+
+	key := restaurantQRKey(restaurantID)
+	if err := blobStore.Put(ctx, key, bytes.NewReader(png), int64(len(png)), "image/png"); err != nil {
+		return "", fmt.Errorf("errore salvataggio QR code: %v", err)
+	}
+
+	return blobStore.URL(key), nil
+}
+
+// blobKeyFromURL ricava la chiave del blob da un URL salvato su un menu.
+// Gestisce anche i percorsi legacy relativi ("static/qrcodes/...", "images/dishes/...")
+func blobKeyFromURL(url string) string {
+	if base := blobStore.URL(""); base != "" && strings.HasPrefix(url, base) {
+		return strings.TrimPrefix(url, base)
+	}
+	url = strings.TrimPrefix(url, "/")
+	return strings.TrimPrefix(url, "static/")
+}
+
+// AssetURL converte un percorso salvato (URL assoluto o percorso legacy) in un URL
+// utilizzabile nei template
+func AssetURL(url string) string {
+	switch {
+	case url == "":
+		return ""
+	case strings.HasPrefix(url, "http://"), strings.HasPrefix(url, "https://"), strings.HasPrefix(url, "/"):
+		return url
+	case strings.HasPrefix(url, "static/"):
+		return "/" + url
+	default:
+		return "/static/" + url
+	}
+}
+
+// imageVariantKey restituisce la chiave di una variante dell'immagine di un piatto
+func imageVariantKey(imageID, size, format string) string {
+	return fmt.Sprintf("images/dishes/%s/%s.%s", imageID, size, format)
+}
+
+// deleteImageVariants elimina tutte le varianti di un'immagine
+func deleteImageVariants(ctx context.Context, imageID string) {
+	blobs, err := blobStore.List(ctx, fmt.Sprintf("images/dishes/%s/", imageID))
+	if err != nil {
+		log.Printf("Errore nella lettura delle varianti dell'immagine %s: %v", imageID, err)
+		return
+	}
+	for _, blob := range blobs {
+		if err := blobStore.Delete(ctx, blob.Key); err != nil {
+			log.Printf("Errore nell'eliminazione di %s: %v", blob.Key, err)
+		}
+	}
+}
+
+// deleteItemImage elimina l'immagine di un piatto (varianti o file legacy singolo)
+func deleteItemImage(ctx context.Context, item models.MenuItem) {
+	if item.ImageID != "" {
+		deleteImageVariants(ctx, item.ImageID)
+		return
+	}
+	if item.ImageURL != "" {
+		if err := blobStore.Delete(ctx, blobKeyFromURL(item.ImageURL)); err != nil {
+			log.Printf("Errore nell'eliminazione dell'immagine precedente: %v", err)
+		}
+	}
+}
+
+// ServeImageHandler serve le immagini dei piatti su /img/{id}/{size},
+// scegliendo il formato migliore supportato dal browser (header Accept)
+func ServeImageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	imageID := vars["id"]
+	size := vars["size"]
+
+	if _, err := uuid.Parse(imageID); err != nil || !imaging.IsValidSize(size) {
+		http.NotFound(w, r)
+		return
+	}
+
+	// La risposta dipende dal formato accettato: le cache devono distinguere per Accept
+	w.Header().Set("Vary", "Accept")
+
+	for _, format := range imaging.NegotiateFormats(r.Header.Get("Accept")) {
+		blob, err := blobStore.Get(r.Context(), imageVariantKey(imageID, size, format))
+		if err == storage.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			log.Printf("Errore lettura immagine %s/%s: %v", imageID, size, err)
+			http.Error(w, "Errore nel caricamento dell'immagine", http.StatusInternalServerError)
+			return
+		}
+		defer blob.Close()
+
+		// Le immagini hanno un ID univoco per upload: l'ETag dipende solo dalla variante
+		if checkNotModified(w, r, fmt.Sprintf(`"%s-%s-%s"`, imageID, size, format), time.Time{}) {
+			return
+		}
+
+		w.Header().Set("Content-Type", imaging.ContentTypeFor(format))
+		io.Copy(w, blob)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// ServeQRHandler serve i QR code dal blob store su /qr/{file}
+func ServeQRHandler(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(mux.Vars(r)["file"])
+	if name == "." || name == "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	blob, err := blobStore.Get(r.Context(), "qrcodes/"+name)
+	if err == storage.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Errore lettura QR code %s: %v", name, err)
+		http.Error(w, "Errore nel caricamento del QR code", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	// Il QR code può essere rigenerato con lo stesso nome: l'ETag deriva dal contenuto
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		log.Printf("Errore lettura QR code %s: %v", name, err)
+		http.Error(w, "Errore nel caricamento del QR code", http.StatusInternalServerError)
+		return
+	}
+	if checkNotModified(w, r, contentETag(data), time.Time{}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(data)
+}
@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/chatwebhook"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+	"qr-menu/pkg/metrics"
+)
+
+// chatEvent descrive un evento che il ristorante può inviare ai suoi canali Slack e Discord
+type chatEvent struct {
+	Type  string `json:"type"`
+	Label string `json:"label"`
+	Level string `json:"-"` // Colore del messaggio
+}
+
+// chatEvents elenca gli eventi inviabili a Slack e Discord, nell'ordine mostrato nel pannello
+var chatEvents = []chatEvent{
+	{Type: events.OrderCreated, Label: "Nuovo ordine", Level: chatwebhook.LevelInfo},
+	{Type: events.ItemLowStock, Label: "Scorta bassa di un piatto", Level: chatwebhook.LevelWarning},
+	{Type: events.ItemSoldOut, Label: "Piatto esaurito", Level: chatwebhook.LevelAlert},
+	{Type: events.BackupFailed, Label: "Backup non riuscito", Level: chatwebhook.LevelAlert},
+}
+
+// maxChatWebhooks è il numero massimo di canali Slack e Discord di un ristorante
+const maxChatWebhooks = 10
+
+// chatWebhookClient invia i messaggi agli incoming webhook di Slack e Discord
+var chatWebhookClient = chatwebhook.New(0)
+
+var chatMessages = metrics.NewCounter("qrmenu_chat_notifications_total",
+	"Slack and Discord notifications by platform and result (sent, failed or gone).", "platform", "result")
+
+func findChatEvent(eventType string) (chatEvent, bool) {
+	for _, event := range chatEvents {
+		if event.Type == eventType {
+			return event, true
+		}
+	}
+	return chatEvent{}, false
+}
+
+// chatWebhookURLHint restituisce la parte dell'URL del webhook mostrata nel pannello: host e
+// inizio del percorso, senza il token
+func chatWebhookURLHint(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	return u.Host + "/" + strings.Join(parts, "/") + "/…"
+}
+
+// chatEventRestaurant restituisce il ristorante a cui notificare l'evento. I backup non
+// riusciti sono eventi della piattaforma: sono notificati solo quelli di un ristorante
+func chatEventRestaurant(event events.Event) string {
+	if event.Type == events.BackupFailed {
+		restaurantID, _ := event.Data["restaurant_id"].(string)
+		return restaurantID
+	}
+	return event.RestaurantID
+}
+
+// chatEventData restituisce i dati del messaggio dell'evento; nil se l'evento non va più
+// notificato, ad esempio perché l'ordine non esiste più
+func chatEventData(ctx context.Context, event events.Event, restaurant *models.Restaurant) (map[string]interface{}, error) {
+	switch event.Type {
+	case events.OrderCreated:
+		orderID, _ := event.Data["order_id"].(string)
+		order, err := db.MongoInstance.GetOrder(ctx, orderID, restaurant.ID)
+		if err != nil || order == nil {
+			return nil, err
+		}
+		return orderNoticeData(order, restaurant), nil
+	case events.ItemLowStock, events.ItemSoldOut:
+		menuName := ""
+		if menuID, ok := event.Data["menu_id"].(string); ok {
+			if menu, err := db.MongoInstance.GetMenuByID(ctx, menuID); err == nil && menu != nil {
+				menuName = menu.Name
+			}
+		}
+		return map[string]interface{}{
+			"RestaurantName": restaurant.Name,
+			"MenuName":       menuName,
+			"ItemName":       event.Data["name"],
+			"Quantity":       event.Data["quantity"],
+			"Threshold":      event.Data["threshold"],
+		}, nil
+	case events.BackupFailed:
+		return map[string]interface{}{
+			"RestaurantName": restaurant.Name,
+			"BackupID":       event.Data["backup_id"],
+			"Error":          event.Data["error"],
+		}, nil
+	}
+	return nil, nil
+}
+
+// renderChatMessage localizza il messaggio key per il canale
+func renderChatMessage(hook *models.ChatWebhook, key, level string, restaurant *models.Restaurant, data map[string]interface{}) (chatwebhook.Message, error) {
+	msg, err := i18n.Default().Render(hook.Locale, key, data)
+	if err != nil {
+		return chatwebhook.Message{}, err
+	}
+	return chatwebhook.Message{
+		Title:  msg.Subject,
+		Text:   msg.Body,
+		URL:    configuredBaseURL + "/admin",
+		Level:  level,
+		Footer: restaurant.Name,
+	}, nil
+}
+
+// postChatMessage invia il messaggio al canale e ne registra l'esito. Un webhook eliminato
+// su Slack o Discord viene disattivato: l'errore corrisponde allora a chatwebhook.ErrGone
+func postChatMessage(ctx context.Context, hook *models.ChatWebhook, msg chatwebhook.Message) error {
+	err := chatWebhookClient.Post(ctx, hook.Platform, hook.URL, msg)
+	gone := errors.Is(err, chatwebhook.ErrGone)
+	switch {
+	case gone:
+		chatMessages.Inc(hook.Platform, "gone")
+	case err != nil:
+		chatMessages.Inc(hook.Platform, "failed")
+	default:
+		chatMessages.Inc(hook.Platform, "sent")
+	}
+
+	if err != nil || hook.LastError != "" {
+		lastError := ""
+		if err != nil {
+			lastError = err.Error()
+		}
+		if rerr := db.MongoInstance.RecordChatWebhookResult(ctx, hook.ID, lastError, gone); rerr != nil {
+			logger.Warn("Esito del webhook Slack/Discord non salvato", map[string]interface{}{
+				"chat_webhook_id": hook.ID,
+				"error":           rerr.Error(),
+			})
+		}
+	}
+	if gone {
+		logger.Warn("Webhook Slack/Discord eliminato, disattivato", map[string]interface{}{
+			"chat_webhook_id": hook.ID,
+			"restaurant_id":   hook.RestaurantID,
+			"platform":        hook.Platform,
+		})
+	}
+	return err
+}
+
+// notifyChatWebhooks invia l'evento ai canali Slack e Discord del ristorante iscritti
+func notifyChatWebhooks(ctx context.Context, event events.Event) error {
+	restaurantID := chatEventRestaurant(event)
+	spec, ok := findChatEvent(event.Type)
+	if db.MongoInstance == nil || restaurantID == "" || !ok {
+		return nil
+	}
+	hooks, err := db.MongoInstance.GetChatWebhooksForEvent(ctx, restaurantID, event.Type)
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, restaurantID)
+	if err != nil || restaurant == nil {
+		return err
+	}
+	data, err := chatEventData(ctx, event, restaurant)
+	if err != nil || data == nil {
+		return err
+	}
+
+	var errs []error
+	for _, hook := range hooks {
+		msg, err := renderChatMessage(hook, i18n.ChatKey(event.Type), spec.Level, restaurant, data)
+		if err != nil {
+			return err
+		}
+		if err := postChatMessage(ctx, hook, msg); err != nil && !errors.Is(err, chatwebhook.ErrGone) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// chatWebhookRequest è il corpo delle richieste di creazione e modifica di un canale
+type chatWebhookRequest struct {
+	Platform string   `json:"platform"`
+	URL      string   `json:"url"`
+	Name     string   `json:"name"`
+	Events   []string `json:"events"`
+	Locale   string   `json:"locale"`
+	Active   *bool    `json:"active"`
+}
+
+// validateChatEvents controlla gli eventi scelti e ne toglie i doppioni
+func validateChatEvents(requested []string) ([]string, error) {
+	selected := make([]string, 0, len(requested))
+	for _, event := range requested {
+		event = strings.TrimSpace(event)
+		if _, ok := findChatEvent(event); !ok {
+			types := make([]string, 0, len(chatEvents))
+			for _, e := range chatEvents {
+				types = append(types, e.Type)
+			}
+			return nil, errors.New("Evento non valido: " + event + " (eventi: " + strings.Join(types, ", ") + ")")
+		}
+		if !containsString(selected, event) {
+			selected = append(selected, event)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("Specificare almeno un evento")
+	}
+	return selected, nil
+}
+
+// ListChatWebhooksHandler restituisce gli eventi inviabili e i canali Slack e Discord del
+// ristorante (GET /api/v1/chat-notifications)
+func ListChatWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	hooks, err := db.MongoInstance.GetChatWebhooks(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei canali Slack e Discord")
+		return
+	}
+	for _, hook := range hooks {
+		hook.URLHint = chatWebhookURLHint(hook.URL)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Canali Slack e Discord", map[string]interface{}{
+		"platforms": chatwebhook.Platforms,
+		"events":    chatEvents,
+		"channels":  hooks,
+	})
+}
+
+// CreateChatWebhookHandler collega un canale Slack o Discord tramite il suo incoming webhook
+// (POST /api/v1/chat-notifications)
+func CreateChatWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	var req chatWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+
+	platform := strings.ToLower(strings.TrimSpace(req.Platform))
+	if !containsString(chatwebhook.Platforms, platform) {
+		httputil.BadRequest(w, "Piattaforma non valida: usare slack o discord")
+		return
+	}
+	hookURL := strings.TrimSpace(req.URL)
+	if err := chatwebhook.ValidateURL(platform, hookURL); err != nil {
+		httputil.BadRequest(w, "URL non valido: indicare l'URL di un incoming webhook di "+platform)
+		return
+	}
+	selected, err := validateChatEvents(req.Events)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	locale := strings.TrimSpace(req.Locale)
+	if locale != "" && !i18n.Default().Supported(locale) {
+		httputil.BadRequest(w, "Lingua non supportata: "+locale)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if len(name) > 100 {
+		httputil.BadRequest(w, "Il nome può avere al massimo 100 caratteri")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	existing, err := db.MongoInstance.GetChatWebhooks(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei canali Slack e Discord")
+		return
+	}
+	if len(existing) >= maxChatWebhooks {
+		httputil.Conflict(w, "Raggiunto il numero massimo di canali Slack e Discord")
+		return
+	}
+
+	now := time.Now()
+	hook := &models.ChatWebhook{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurant.ID,
+		Platform:     platform,
+		Name:         name,
+		URL:          hookURL,
+		URLHint:      chatWebhookURLHint(hookURL),
+		Events:       selected,
+		Locale:       i18n.Default().Resolve(locale),
+		IsActive:     req.Active == nil || *req.Active,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := db.MongoInstance.CreateChatWebhook(ctx, hook); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel collegamento del canale")
+		return
+	}
+
+	RecordAuditLogAsync("CHAT_WEBHOOK_CREATED", "chat_webhook", hook.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Created(w, "Canale collegato", hook)
+}
+
+// UpdateChatWebhookHandler modifica nome, eventi, lingua o stato di un canale
+// (PUT /api/v1/chat-notifications/{id}). Per cambiare l'URL si collega un nuovo canale
+func UpdateChatWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	var req chatWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if req.URL != "" || req.Platform != "" {
+		httputil.BadRequest(w, "URL e piattaforma non sono modificabili: collegare un nuovo canale")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	hook, err := db.MongoInstance.GetChatWebhook(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del canale")
+		return
+	}
+	if hook == nil {
+		httputil.NotFound(w, "Canale")
+		return
+	}
+
+	if name := strings.TrimSpace(req.Name); name != "" {
+		if len(name) > 100 {
+			httputil.BadRequest(w, "Il nome può avere al massimo 100 caratteri")
+			return
+		}
+		hook.Name = name
+	}
+	if req.Events != nil {
+		if hook.Events, err = validateChatEvents(req.Events); err != nil {
+			httputil.BadRequest(w, err.Error())
+			return
+		}
+	}
+	if locale := strings.TrimSpace(req.Locale); locale != "" {
+		if !i18n.Default().Supported(locale) {
+			httputil.BadRequest(w, "Lingua non supportata: "+locale)
+			return
+		}
+		hook.Locale = i18n.Default().Resolve(locale)
+	}
+	if req.Active != nil {
+		hook.IsActive = *req.Active
+		if hook.IsActive {
+			hook.LastError = ""
+		}
+	}
+	hook.UpdatedAt = time.Now()
+
+	found, err := db.MongoInstance.UpdateChatWebhook(ctx, hook)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'aggiornamento del canale")
+		return
+	}
+	if !found {
+		httputil.NotFound(w, "Canale")
+		return
+	}
+
+	RecordAuditLogAsync("CHAT_WEBHOOK_UPDATED", "chat_webhook", hook.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	hook.URLHint = chatWebhookURLHint(hook.URL)
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Canale aggiornato", hook)
+}
+
+// DeleteChatWebhookHandler scollega un canale (DELETE /api/v1/chat-notifications/{id})
+func DeleteChatWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := db.MongoInstance.DeleteChatWebhook(ctx, id, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nello scollegamento del canale")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "Canale")
+		return
+	}
+
+	RecordAuditLogAsync("CHAT_WEBHOOK_DELETED", "chat_webhook", id, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// TestChatWebhookHandler invia al canale un messaggio di prova, anche se è disattivato, e
+// risponde con l'errore di Slack o Discord se l'invio non riesce
+// (POST /api/v1/chat-notifications/{id}/test)
+func TestChatWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	hook, err := db.MongoInstance.GetChatWebhook(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del canale")
+		return
+	}
+	if hook == nil {
+		httputil.NotFound(w, "Canale")
+		return
+	}
+
+	name := hook.Name
+	if name == "" {
+		name = hook.Platform
+	}
+	msg, err := renderChatMessage(hook, i18n.KeyChatTest, chatwebhook.LevelInfo, restaurant, map[string]interface{}{
+		"RestaurantName": restaurant.Name,
+		"Name":           name,
+	})
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella preparazione del messaggio di prova")
+		return
+	}
+	if err := postChatMessage(ctx, hook, msg); err != nil {
+		if errors.Is(err, chatwebhook.ErrGone) {
+			httputil.BadRequest(w, "Il webhook non esiste più su "+hook.Platform+": il canale è stato disattivato")
+			return
+		}
+		httputil.BadRequest(w, "Invio non riuscito: "+err.Error())
+		return
+	}
+	httputil.Success(w, "Messaggio di prova inviato", nil)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"qr-menu/models"
+)
+
+// menuETag calcola un ETag debole per la pagina pubblica di un menu.
+// Include i dati del ristorante mostrati nella pagina, che non hanno un UpdatedAt proprio
+func menuETag(menu *models.Menu, restaurant *models.Restaurant) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%d|%s|%s|%s|%s|%s|%t|%+v|%t",
+		menu.ID, menu.UpdatedAt.UnixNano(),
+		restaurant.Name, restaurant.Description, restaurant.Address, restaurant.Phone, restaurant.Logo,
+		restaurant.PrivacyFirstAnalytics, restaurant.NutritionDisplay, restaurant.ShowRatings)
+	if restaurant.ShowRatings && restaurant.Ratings != nil {
+		fmt.Fprintf(h, "|%d", restaurant.Ratings.UpdatedAt.UnixNano())
+	}
+	for _, promotion := range restaurant.Promotions {
+		fmt.Fprintf(h, "|%s|%d", promotion.ID, promotion.UpdatedAt.UnixNano())
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+}
+
+// contentETag calcola un ETag forte dal contenuto di una risposta
+func contentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:])[:32] + `"`
+}
+
+// checkNotModified imposta ETag e Last-Modified e, se la richiesta condizionale
+// corrisponde alla versione corrente, risponde 304 restituendo true
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-None-Match ha la precedenza su If-Modified-Since (RFC 9110)
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag != "" && etagMatches(inm, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err == nil && !lastModified.Truncate(time.Second).After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// etagMatches confronta (in modo debole) l'header If-None-Match con l'ETag corrente
+func etagMatches(header, etag string) bool {
+	current := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == current {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"qr-menu/logger"
+	httputil "qr-menu/pkg/http"
+)
+
+// Protezione CSRF con double-submit cookie firmato: il token è nonce.HMAC(sessione|nonce),
+// viaggia nel cookie csrf_token e nel campo csrf_token (o nell'header X-CSRF-Token) e vale
+// solo per la sessione che lo ha ottenuto
+const (
+	csrfCookieName = "csrf_token"
+	csrfFieldName  = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// csrfKey firma i token; derivata dalla chiave di sessione da initSessionStore (auth.go)
+var csrfKey []byte
+
+// csrfExemptPrefixes sono le route modificanti che non usano il cookie di sessione:
+// il beacon pubblico di condivisione, le API pubbliche (feedback dei clienti), le API di recupero
+// password, le API admin con bearer token, le notifiche firmate del provider di billing e il
+// callback form_post dei provider OAuth (protetto dallo state)
+var csrfExemptPrefixes = []string{
+	"/api/track/share",
+	"/api/v1/public/",
+	"/api/v1/auth/",
+	"/api/admin/",
+	"/api/v1/billing/webhook",
+	"/auth/oauth/",
+}
+
+// setCSRFKey deriva la chiave dei token CSRF dalla chiave di sessione, così le due
+// firme restano indipendenti
+func setCSRFKey(sessionKey string) {
+	mac := hmac.New(sha256.New, []byte(sessionKey))
+	mac.Write([]byte("qr-menu csrf"))
+	csrfKey = mac.Sum(nil)
+}
+
+// csrfSigningKey restituisce csrfKey, creata insieme allo store delle sessioni
+func csrfSigningKey() []byte {
+	sessionStore()
+	return csrfKey
+}
+
+// csrfSessionID restituisce l'ID della sessione a cui legare il token, "" se anonima
+func csrfSessionID(r *http.Request) string {
+	session, err := sessionStore().Get(r, SessionCookieName)
+	if err != nil {
+		return ""
+	}
+	sessionID, _ := session.Values["session_id"].(string)
+	return sessionID
+}
+
+// signCSRF calcola la firma del nonce per la sessione
+func signCSRF(sessionID, nonce string) []byte {
+	mac := hmac.New(sha256.New, csrfSigningKey())
+	mac.Write([]byte(sessionID))
+	mac.Write([]byte{'|'})
+	mac.Write([]byte(nonce))
+	return mac.Sum(nil)
+}
+
+// validCSRFToken verifica che il token sia stato firmato per la sessione
+func validCSRFToken(token, sessionID string) bool {
+	nonce, signature, ok := strings.Cut(token, ".")
+	if !ok || nonce == "" {
+		return false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(sig, signCSRF(sessionID, nonce))
+}
+
+// csrfToken restituisce il token CSRF della sessione corrente da inserire nei form,
+// riusando quello del cookie se ancora valido e altrimenti emettendone uno nuovo
+func csrfToken(w http.ResponseWriter, r *http.Request) string {
+	sessionID := csrfSessionID(r)
+	if cookie, err := r.Cookie(csrfCookieName); err == nil && validCSRFToken(cookie.Value, sessionID) {
+		return cookie.Value
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella generazione del token CSRF", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return ""
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(buf)
+	token := nonce + "." + base64.RawURLEncoding.EncodeToString(signCSRF(sessionID, nonce))
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   sessionStore().Options.MaxAge,
+		HttpOnly: true,
+		Secure:   sessionStore().Options.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+// CSRFMiddleware rifiuta con 403 le richieste modificanti (POST, PUT, PATCH, DELETE) il cui
+// token non coincide con il cookie csrf_token o non è firmato per la sessione corrente
+func CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+		for _, prefix := range csrfExemptPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		// Le integrazioni si autenticano con la API key o l'access token e non con il cookie,
+		// che viene scartato: una richiesta così non può agire con la sessione del browser
+		if strings.HasPrefix(r.URL.Path, "/api/") && (apiKeyFromRequest(r) != "" || apiTokenFromRequest(r) != "") {
+			r.Header.Del("Cookie")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		submitted := r.Header.Get(csrfHeaderName)
+		if submitted == "" {
+			submitted = r.PostFormValue(csrfFieldName)
+		}
+		cookie, err := r.Cookie(csrfCookieName)
+		if submitted == "" || err != nil ||
+			subtle.ConstantTimeCompare([]byte(submitted), []byte(cookie.Value)) != 1 ||
+			!validCSRFToken(submitted, csrfSessionID(r)) {
+			logger.SecurityEventCtx(r.Context(), "CSRF_REJECTED", "Token CSRF mancante o non valido", "",
+				map[string]interface{}{
+					"method":     r.Method,
+					"path":       r.URL.Path,
+					"has_token":  submitted != "",
+					"has_cookie": err == nil,
+				})
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				httputil.Forbidden(w, "Token CSRF non valido")
+				return
+			}
+			http.Error(w, "Token CSRF non valido o scaduto: ricarica la pagina e riprova", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
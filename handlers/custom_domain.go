@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// domainVerificationPrefix è il sottodominio del record TXT che dimostra il possesso del dominio
+const domainVerificationPrefix = "_qr-menu-verify."
+
+// customDomainCacheTTL è per quanto viene ricordato l'esito della ricerca di un host
+const customDomainCacheTTL = 5 * time.Minute
+
+var (
+	// lookupTXT risolve i record TXT (sostituibile nei test)
+	lookupTXT = net.LookupTXT
+
+	domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+	customDomainCache   = make(map[string]customDomainEntry)
+	customDomainCacheMu sync.RWMutex
+)
+
+// customDomainEntry è l'esito in cache della ricerca di un host: username vuoto se
+// l'host non è un dominio personalizzato verificato
+type customDomainEntry struct {
+	username  string
+	expiresAt time.Time
+}
+
+// normalizeDomain estrae il nome host da quanto inserito dall'utente (anche un URL completo).
+// Restituisce "" se non è un dominio valido
+func normalizeDomain(input string) string {
+	domain := strings.ToLower(strings.TrimSpace(input))
+	if strings.Contains(domain, "://") {
+		if u, err := url.Parse(domain); err == nil {
+			domain = u.Host
+		}
+	}
+	if i := strings.IndexAny(domain, "/?#"); i >= 0 {
+		domain = domain[:i]
+	}
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+	domain = strings.TrimSuffix(domain, ".")
+	if len(domain) > 253 || !domainPattern.MatchString(domain) {
+		return ""
+	}
+	return domain
+}
+
+// restaurantPublicURL restituisce l'URL pubblico a cui punta il QR code del ristorante:
+// dominio personalizzato verificato, altrimenti indirizzo breve, altrimenti /r/{username}
+func restaurantPublicURL(baseURL string, restaurant *models.Restaurant) string {
+	switch {
+	case restaurant.CustomDomain != "" && restaurant.DomainVerified:
+		return "https://" + restaurant.CustomDomain
+	case restaurant.VanitySlug != "":
+		return fmt.Sprintf("%s/m/%s", baseURL, restaurant.VanitySlug)
+	default:
+		return fmt.Sprintf("%s/r/%s", baseURL, restaurant.Username)
+	}
+}
+
+// refreshRestaurantQRCode rigenera il QR code del ristorante sull'URL pubblico attuale
+// e aggiorna URL e QR code dei menu completati
+func refreshRestaurantQRCode(ctx context.Context, restaurant *models.Restaurant, baseURL string) {
+	restaurantURL := restaurantPublicURL(baseURL, restaurant)
+	qrCodePath, err := saveRestaurantQRCode(ctx, restaurant.ID, restaurantURL)
+	if err != nil {
+		logger.WarnCtx(ctx, "Errore nella rigenerazione del QR code", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+	}
+	updateMenusPublicURL(ctx, restaurant.ID, restaurantURL, qrCodePath)
+}
+
+// updateMenusPublicURL aggiorna URL pubblico e, se indicato, QR code dei menu completati
+func updateMenusPublicURL(ctx context.Context, restaurantID, restaurantURL, qrCodePath string) {
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurantID)
+	if err != nil {
+		return
+	}
+	for _, menu := range menus {
+		if !menu.IsCompleted {
+			continue
+		}
+		menu.PublicURL = restaurantURL
+		if qrCodePath != "" {
+			menu.QRCodePath = qrCodePath
+		}
+		if err := db.MongoInstance.UpdateMenu(ctx, menu); err != nil {
+			logger.WarnCtx(ctx, "Errore nell'aggiornamento URL pubblico del menu", map[string]interface{}{
+				"error":   err.Error(),
+				"menu_id": menu.ID,
+			})
+		}
+	}
+}
+
+// forgetCustomDomain rimuove un dominio dalla cache degli host
+func forgetCustomDomain(domain string) {
+	if domain == "" {
+		return
+	}
+	customDomainCacheMu.Lock()
+	delete(customDomainCache, domain)
+	customDomainCacheMu.Unlock()
+}
+
+// customDomainUsername restituisce lo username del ristorante che ha verificato l'host,
+// oppure "" se l'host non è un dominio personalizzato
+func customDomainUsername(ctx context.Context, host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" || host == "localhost" || net.ParseIP(host) != nil || db.MongoInstance == nil {
+		return ""
+	}
+
+	customDomainCacheMu.RLock()
+	entry, ok := customDomainCache[host]
+	customDomainCacheMu.RUnlock()
+	hit := ok && time.Now().Before(entry.expiresAt)
+	metrics.CacheLookup("custom_domain", hit)
+	if hit {
+		return entry.username
+	}
+
+	restaurant, err := db.MongoInstance.GetRestaurantByCustomDomain(ctx, host)
+	if err != nil {
+		// Errore temporaneo: non memorizza l'esito
+		return entry.username
+	}
+	entry = customDomainEntry{expiresAt: time.Now().Add(customDomainCacheTTL)}
+	if restaurant != nil && restaurant.IsActive {
+		entry.username = restaurant.Username
+	}
+
+	customDomainCacheMu.Lock()
+	customDomainCache[host] = entry
+	customDomainCacheMu.Unlock()
+	return entry.username
+}
+
+// CustomDomainAllowed indica se host è un dominio personalizzato verificato
+// (usato per autorizzare l'emissione dei certificati Let's Encrypt)
+func CustomDomainAllowed(ctx context.Context, host string) bool {
+	return customDomainUsername(ctx, host) != ""
+}
+
+// CustomDomainMiddleware serve il menu attivo del ristorante sulla home di un dominio
+// personalizzato verificato. Le altre pagine (/menu/{id}, immagini...) restano quelle standard
+func CustomDomainMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			if username := customDomainUsername(r.Context(), r.Host); username != "" {
+				GetActiveMenuHandler(w, mux.SetURLVars(r, map[string]string{"username": username}))
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// VanityMenuHandler mostra il menu attivo del ristorante dall'indirizzo breve /m/{slug}
+func VanityMenuHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restaurant, err := db.MongoInstance.GetRestaurantByVanitySlug(ctx, strings.ToLower(mux.Vars(r)["slug"]))
+	if err != nil || restaurant == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	GetActiveMenuHandler(w, mux.SetURLVars(r, map[string]string{"username": restaurant.Username}))
+}
+
+// SetVanitySlugHandler imposta (o rimuove, se vuoto) l'indirizzo breve del ristorante
+func SetVanitySlugHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	slug := ""
+	if strings.TrimSpace(r.FormValue("vanity_slug")) != "" {
+		slug = normalizeRestaurantUsername(r.FormValue("vanity_slug"))
+	}
+	if slug == restaurant.VanitySlug {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	err = db.MongoInstance.SetRestaurantVanitySlug(ctx, restaurant, slug)
+	if err == db.ErrDuplicateVanitySlug {
+		http.Redirect(w, r, "/account?error=vanity_slug_taken", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'impostazione dell'indirizzo breve", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nell'impostazione dell'indirizzo breve", http.StatusInternalServerError)
+		return
+	}
+
+	refreshRestaurantQRCode(ctx, restaurant, getBaseURL(r))
+	RecordAuditLogAsync("RESTAURANT_VANITY_SLUG_CHANGED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+
+	http.Redirect(w, r, "/account?success=vanity_slug_changed", http.StatusSeeOther)
+}
+
+// SetCustomDomainHandler associa un dominio al ristorante e genera il token da pubblicare
+// nel record DNS TXT. Il dominio viene servito solo dopo la verifica
+func SetCustomDomainHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	domain := normalizeDomain(r.FormValue("custom_domain"))
+	if domain == "" {
+		http.Redirect(w, r, "/account?error=domain_invalid", http.StatusSeeOther)
+		return
+	}
+	if domain == restaurant.CustomDomain {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+
+	tokenBytes := make([]byte, 16)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		http.Error(w, "Errore nella generazione del token", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	previous := restaurant.CustomDomain
+	wasVerified := restaurant.DomainVerified
+	if err := db.MongoInstance.SetRestaurantCustomDomain(ctx, restaurant, domain, hex.EncodeToString(tokenBytes)); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'impostazione del dominio personalizzato", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nell'impostazione del dominio", http.StatusInternalServerError)
+		return
+	}
+	forgetCustomDomain(previous)
+
+	// Il QR code puntava al vecchio dominio: torna all'indirizzo standard fino alla nuova verifica
+	if wasVerified {
+		refreshRestaurantQRCode(ctx, restaurant, getBaseURL(r))
+	}
+
+	RecordAuditLogAsync("RESTAURANT_DOMAIN_ADDED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/account?success=domain_added", http.StatusSeeOther)
+}
+
+// VerifyCustomDomainHandler controlla il record DNS TXT del dominio e, se corretto, lo attiva
+// e rigenera il QR code sul nuovo indirizzo
+func VerifyCustomDomainHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+	if restaurant.CustomDomain == "" {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	records, err := lookupTXT(domainVerificationPrefix + restaurant.CustomDomain)
+	found := false
+	for _, record := range records {
+		if strings.TrimSpace(record) == restaurant.DomainToken {
+			found = true
+			break
+		}
+	}
+	if !found {
+		logger.InfoCtx(r.Context(), "Verifica dominio non riuscita", map[string]interface{}{
+			"restaurant_id": restaurant.ID,
+			"domain":        restaurant.CustomDomain,
+			"dns_error":     fmt.Sprint(err),
+		})
+		http.Redirect(w, r, "/account?error=domain_not_verified", http.StatusSeeOther)
+		return
+	}
+
+	err = db.MongoInstance.MarkCustomDomainVerified(ctx, restaurant)
+	if err == db.ErrDuplicateCustomDomain {
+		http.Redirect(w, r, "/account?error=domain_taken", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella verifica del dominio", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nella verifica del dominio", http.StatusInternalServerError)
+		return
+	}
+	forgetCustomDomain(restaurant.CustomDomain)
+
+	refreshRestaurantQRCode(ctx, restaurant, getBaseURL(r))
+
+	logger.InfoCtx(r.Context(), "Dominio personalizzato verificato", map[string]interface{}{
+		"restaurant_id": restaurant.ID,
+		"domain":        restaurant.CustomDomain,
+	})
+	RecordAuditLogAsync("RESTAURANT_DOMAIN_VERIFIED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+
+	http.Redirect(w, r, "/account?success=domain_verified", http.StatusSeeOther)
+}
+
+// RemoveCustomDomainHandler scollega il dominio personalizzato e riporta il QR code all'indirizzo standard
+func RemoveCustomDomainHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	domain := restaurant.CustomDomain
+	wasVerified := restaurant.DomainVerified
+	if err := db.MongoInstance.SetRestaurantCustomDomain(ctx, restaurant, "", ""); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella rimozione del dominio personalizzato", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nella rimozione del dominio", http.StatusInternalServerError)
+		return
+	}
+	forgetCustomDomain(domain)
+
+	if wasVerified {
+		refreshRestaurantQRCode(ctx, restaurant, getBaseURL(r))
+	}
+
+	RecordAuditLogAsync("RESTAURANT_DOMAIN_REMOVED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/account?success=domain_removed", http.StatusSeeOther)
+}
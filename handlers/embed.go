@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+)
+
+// embedCurrency è la valuta dei prezzi mostrati dal widget, come nelle pagine pubbliche
+const embedCurrency = "EUR"
+
+// embedItem, embedCategory ed embedMenu sono la forma del menu per i siti dei ristoranti:
+// solo i campi visibili al pubblico, con i testi già tradotti nella lingua richiesta
+type embedItem struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Price       float64  `json:"price"`
+	Available   bool     `json:"available"`
+	ImageURL    string   `json:"image_url,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+
+	Nutrition *publicNutrition `json:"nutrition,omitempty"` // Solo se il ristorante la pubblica
+}
+
+type embedCategory struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Items       []embedItem `json:"items"`
+}
+
+type embedMenu struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	MealType    string          `json:"meal_type,omitempty"`
+	Categories  []embedCategory `json:"categories"`
+}
+
+type embedRestaurant struct {
+	Name        string `json:"name"`
+	Username    string `json:"username"`
+	Description string `json:"description,omitempty"`
+	Address     string `json:"address,omitempty"`
+	Phone       string `json:"phone,omitempty"`
+	Logo        string `json:"logo,omitempty"`
+}
+
+// embedPromotion è una promozione in corso, con gli ID dei piatti in evidenza presenti nei menu
+type embedPromotion struct {
+	ID         string    `json:"id"`
+	Title      string    `json:"title"`
+	BannerText string    `json:"banner_text,omitempty"`
+	ItemIDs    []string  `json:"item_ids,omitempty"`
+	EndsAt     time.Time `json:"ends_at"`
+}
+
+type embedResponse struct {
+	Restaurant embedRestaurant  `json:"restaurant"`
+	Promotions []embedPromotion `json:"promotions,omitempty"`
+	Menus      []embedMenu      `json:"menus"`
+	Lang       string           `json:"lang,omitempty"`
+	Currency   string           `json:"currency"`
+	MenuURL    string           `json:"menu_url"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+// allowEmbedOrigin rende la risposta leggibile da qualsiasi sito: i dati sono pubblici
+// e la richiesta non usa cookie, quindi le credenziali non vengono mai condivise
+func allowEmbedOrigin(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Del("Access-Control-Allow-Credentials")
+}
+
+// loadEmbedRestaurant trova il ristorante attivo e i suoi menu attivi; risponde 404 e
+// restituisce nil se non esiste
+func loadEmbedRestaurant(w http.ResponseWriter, r *http.Request) (*models.Restaurant, []*models.Menu) {
+	username := mux.Vars(r)["username"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restaurant, err := db.MongoInstance.GetRestaurantByUsername(ctx, username)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero del ristorante per l'embed", map[string]interface{}{
+			"error":    err.Error(),
+			"username": username,
+		})
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Menu temporaneamente non disponibile")
+		return nil, nil
+	}
+	if restaurant == nil || !restaurant.IsActive {
+		httputil.NotFound(w, "Ristorante")
+		return nil, nil
+	}
+
+	menus, err := loadDisplayMenus(ctx, restaurant)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero dei menu per l'embed", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Menu temporaneamente non disponibile")
+		return nil, nil
+	}
+	return restaurant, menus
+}
+
+// EmbedMenuHandler restituisce i menu attivi del ristorante per il widget dei siti esterni
+// (GET /embed/{username}.json). Non richiede token e accetta richieste da qualsiasi origine;
+// ?lang= sceglie la lingua delle traduzioni, con il testo originale come ripiego
+func EmbedMenuHandler(w http.ResponseWriter, r *http.Request) {
+	allowEmbedOrigin(w)
+
+	restaurant, menus := loadEmbedRestaurant(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	lang := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("lang")))
+	baseURL := sharedCacheBaseURL(w, r)
+	resp := embedResponse{
+		Restaurant: embedRestaurant{
+			Name:        restaurant.Name,
+			Username:    restaurant.Username,
+			Description: restaurant.Description,
+			Address:     restaurant.Address,
+			Phone:       restaurant.Phone,
+			Logo:        absoluteURL(baseURL, restaurant.Logo),
+		},
+		Menus:    make([]embedMenu, 0, len(menus)),
+		Lang:     lang,
+		Currency: embedCurrency,
+		MenuURL:  baseURL + "/r/" + url.PathEscape(restaurant.Username),
+	}
+	var shown []*models.Menu
+	for _, menu := range menus {
+		if !menu.IsCompleted || menu.IsArchived {
+			continue
+		}
+		shown = append(shown, menu)
+		resp.Menus = append(resp.Menus, newEmbedMenu(menu, lang, baseURL, restaurant.NutritionDisplay))
+		if menu.UpdatedAt.After(resp.UpdatedAt) {
+			resp.UpdatedAt = menu.UpdatedAt
+		}
+	}
+	for _, promotion := range featuredPromotions(restaurant, shown, time.Now()) {
+		out := embedPromotion{
+			ID:         promotion.ID,
+			Title:      promotion.Title,
+			BannerText: promotion.BannerText,
+			EndsAt:     promotion.EndsAt,
+		}
+		for _, item := range promotion.Items {
+			out.ItemIDs = append(out.ItemIDs, item.ID)
+		}
+		resp.Promotions = append(resp.Promotions, out)
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		httputil.InternalServerError(w, "Errore nella preparazione del menu")
+		return
+	}
+	if checkNotModified(w, r, contentETag(data), resp.UpdatedAt) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+// newEmbedMenu converte un menu nella forma dell'embed, traducendo i testi in lang e
+// includendo le informazioni nutrizionali che il ristorante pubblica
+func newEmbedMenu(menu *models.Menu, lang, baseURL string, nutrition models.NutritionDisplay) embedMenu {
+	out := embedMenu{
+		ID:          menu.ID,
+		Name:        menu.Name,
+		Description: menu.Description,
+		MealType:    menu.MealType,
+		Categories:  make([]embedCategory, 0, len(menu.Categories)),
+	}
+	for _, category := range menu.Categories {
+		name, description := translated(category.Translations, lang, category.Name, category.Description)
+		c := embedCategory{
+			ID:          category.ID,
+			Name:        name,
+			Description: description,
+			Items:       make([]embedItem, 0, len(category.Items)),
+		}
+		for _, item := range category.Items {
+			name, description := translated(item.Translations, lang, item.Name, item.Description)
+			c.Items = append(c.Items, embedItem{
+				ID:          item.ID,
+				Name:        name,
+				Description: description,
+				Price:       item.Price,
+				Available:   item.Available,
+				ImageURL:    absoluteURL(baseURL, item.ImageURL),
+				Tags:        item.Tags,
+				Nutrition:   newPublicNutrition(item.Nutrition, nutrition),
+			})
+		}
+		out.Categories = append(out.Categories, c)
+	}
+	return out
+}
+
+// translated restituisce nome e descrizione nella lingua richiesta, campo per campo,
+// ricadendo sul testo originale quando la traduzione manca
+func translated(translations map[string]models.Translation, lang, name, description string) (string, string) {
+	t, ok := translations[lang]
+	if !ok {
+		return name, description
+	}
+	if t.Name != "" {
+		name = t.Name
+	}
+	if t.Description != "" {
+		description = t.Description
+	}
+	return name, description
+}
+
+// absoluteURL rende assoluti i percorsi locali (es. /img/...), che sul sito del
+// ristorante punterebbero al dominio sbagliato
+func absoluteURL(baseURL, path string) string {
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") {
+		return baseURL + path
+	}
+	return path
+}
+
+// embedScript è il widget servito da /embed/{username}.js. Inserisce il menu in uno
+// shadow DOM, così gli stili del sito ospite non lo alterano, e usa solo textContent
+// per i dati del ristorante
+var embedScript = textTemplate.Must(textTemplate.New("embed").Parse(`(function () {
+  "use strict";
+  var config = {{.Config}};
+  var script = document.currentScript;
+  var attr = function (name) { return script ? script.getAttribute("data-" + name) : null; };
+  var lang = attr("lang") || (navigator.language || "").slice(0, 2).toLowerCase();
+  var host = attr("target") ? document.querySelector(attr("target")) : null;
+  if (!host) {
+    if (!script) return;
+    host = document.createElement("div");
+    script.parentNode.insertBefore(host, script);
+  }
+  var root = host.attachShadow ? host.attachShadow({ mode: "open" }) : host;
+
+  var el = function (tag, className, text) {
+    var node = document.createElement(tag);
+    if (className) node.className = className;
+    if (text) node.textContent = text;
+    return node;
+  };
+
+  var render = function (data) {
+    var price = new Intl.NumberFormat(data.lang || undefined, { style: "currency", currency: data.currency });
+    var style = el("style");
+    style.textContent = ".qrm{font-family:system-ui,sans-serif;color:#222;max-width:720px}" +
+      ".qrm h2{margin:1.2em 0 .4em}.qrm h3{margin:1em 0 .3em;border-bottom:1px solid #ddd}" +
+      ".qrm-item{display:flex;justify-content:space-between;gap:1em;padding:.4em 0}" +
+      ".qrm-item p{margin:.2em 0 0;color:#666;font-size:.9em}.qrm-off{opacity:.5}" +
+      ".qrm-price{white-space:nowrap;font-weight:600}.qrm-link{display:block;margin-top:1em;font-size:.85em}" +
+      ".qrm-promo{margin:.6em 0;padding:.6em .8em;border-radius:8px;background:#fff4e0}.qrm-promo p{margin:.2em 0 0}";
+    var box = el("div", "qrm");
+    (data.promotions || []).forEach(function (promotion) {
+      var banner = el("div", "qrm-promo");
+      banner.appendChild(el("strong", "", promotion.title));
+      if (promotion.banner_text) banner.appendChild(el("p", "", promotion.banner_text));
+      box.appendChild(banner);
+    });
+    data.menus.forEach(function (menu) {
+      if (data.menus.length > 1) box.appendChild(el("h2", "", menu.name));
+      menu.categories.forEach(function (category) {
+        box.appendChild(el("h3", "", category.name));
+        category.items.forEach(function (item) {
+          var row = el("div", "qrm-item" + (item.available ? "" : " qrm-off"));
+          var text = el("div");
+          text.appendChild(el("strong", "", item.name));
+          if (item.description) text.appendChild(el("p", "", item.description));
+          row.appendChild(text);
+          row.appendChild(el("span", "qrm-price", price.format(item.price)));
+          box.appendChild(row);
+        });
+      });
+    });
+    var link = el("a", "qrm-link", data.restaurant.name);
+    link.href = data.menu_url;
+    link.target = "_blank";
+    link.rel = "noopener";
+    box.appendChild(link);
+    root.appendChild(style);
+    root.appendChild(box);
+  };
+
+  fetch(config.menuURL + (lang ? "?lang=" + encodeURIComponent(lang) : ""))
+    .then(function (resp) { if (!resp.ok) throw new Error(resp.status); return resp.json(); })
+    .then(render)
+    .catch(function () {
+      var link = el("a", "", config.fallbackText);
+      link.href = config.publicURL;
+      root.appendChild(link);
+    });
+})();
+`))
+
+// EmbedScriptHandler restituisce il widget JavaScript del ristorante (GET /embed/{username}.js).
+// Attributi opzionali del tag script: data-target (selettore del contenitore) e data-lang
+func EmbedScriptHandler(w http.ResponseWriter, r *http.Request) {
+	allowEmbedOrigin(w)
+	username := mux.Vars(r)["username"]
+	baseURL := sharedCacheBaseURL(w, r)
+
+	// json.Marshal esegue l'escape di <, > e &, quindi i valori sono sicuri nello script
+	config, err := json.Marshal(map[string]string{
+		"menuURL":      baseURL + "/embed/" + url.PathEscape(username) + ".json",
+		"publicURL":    baseURL + "/r/" + url.PathEscape(username),
+		"fallbackText": "Vedi il menu",
+	})
+	if err != nil {
+		httputil.InternalServerError(w, "Errore nella generazione del widget")
+		return
+	}
+	var buf bytes.Buffer
+	if err := embedScript.Execute(&buf, map[string]string{"Config": string(config)}); err != nil {
+		httputil.InternalServerError(w, "Errore nella generazione del widget")
+		return
+	}
+	if checkNotModified(w, r, contentETag(buf.Bytes()), time.Time{}) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+var embedFrame = template.Must(template.New("embed_frame").Parse(`<!DOCTYPE html>
+<html lang="it">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Menu</title>
+</head>
+<body>
+<div id="qr-menu-embed"></div>
+<script src="{{.ScriptURL}}" data-target="#qr-menu-embed"{{if .Lang}} data-lang="{{.Lang}}"{{end}}></script>
+</body>
+</html>
+`))
+
+// EmbedFrameHandler è la pagina da includere in un iframe (GET /embed/{username}): a
+// differenza delle pagine pubbliche può essere incorniciata da qualsiasi sito
+func EmbedFrameHandler(w http.ResponseWriter, r *http.Request) {
+	username := mux.Vars(r)["username"]
+	w.Header().Del("X-Frame-Options")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'self' 'unsafe-inline'; img-src * data:; frame-ancestors *")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	embedFrame.Execute(w, map[string]string{
+		"ScriptURL": "/embed/" + url.PathEscape(username) + ".js",
+		"Lang":      r.URL.Query().Get("lang"),
+	})
+}
+
+// EmbedSnippetHandler restituisce i frammenti HTML da incollare nel sito del ristorante
+// selezionato (GET /api/v1/embed)
+func EmbedSnippetHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	base := getBaseURL(r) + "/embed/" + url.PathEscape(restaurant.Username)
+	escaped := template.HTMLEscapeString(base)
+	httputil.Success(w, "Codice di incorporamento", map[string]string{
+		"json_url":   base + ".json",
+		"script_url": base + ".js",
+		"frame_url":  base,
+		"script":     `<script src="` + escaped + `.js" async></script>`,
+		"iframe":     `<iframe src="` + escaped + `" title="Menu" loading="lazy" style="width:100%;min-height:600px;border:0"></iframe>`,
+	})
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"qr-menu/analytics"
+	"qr-menu/db"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	"qr-menu/pkg/i18n"
+)
+
+// eventBus è il bus su cui i handler pubblicano gli eventi di dominio
+var eventBus = events.Default()
+
+// RegisterEventSubscribers iscrive al bus i destinatari degli eventi: webhook dei ristoranti,
+// analytics, notifiche ai proprietari (anche per le scorte dei piatti e le promozioni) e
+// audit log degli eventi della piattaforma. Le modifiche ai menu fatte da altre istanze
+// aggiornano la cache dei menu pubblici di questa; gli ordini, di questa e delle altre
+// istanze, arrivano ai KDS collegati; i clienti degli ordini in anticipo sono avvisati quando
+// l'ordine è pronto o annullato; gli eventi scelti dai ristoranti arrivano ai loro canali
+// Slack e Discord; i pass Wallet dei clienti seguono il menu attivo. Va chiamata una volta
+// all'avvio
+func RegisterEventSubscribers(bus *events.Bus) {
+	eventBus = bus
+	bus.Subscribe("webhooks", deliverEventToWebhooks)
+	bus.Subscribe("analytics", trackEventInAnalytics, events.QRScanned)
+	bus.Subscribe("notifications", notifyEventToOwner, events.MenuActivated)
+	bus.Subscribe("stock-alerts", notifyStockAlert, events.ItemLowStock, events.ItemSoldOut)
+	bus.Subscribe("chat-notifications", notifyChatWebhooks,
+		events.OrderCreated, events.ItemLowStock, events.ItemSoldOut, events.BackupFailed)
+	bus.Subscribe("promotion-alerts", notifyPromotionActive, events.PromotionActive)
+	bus.Subscribe("audit", auditPlatformEvent, events.BackupCompleted, events.BackupFailed)
+	bus.SubscribeRemote("menu-cache", refreshMenuCacheOnEvent,
+		events.MenuCreated, events.MenuUpdated, events.MenuActivated, events.ItemUpdated)
+	bus.Subscribe("kds", refreshKDSOnEvent, events.OrderCreated, events.OrderUpdated)
+	bus.Subscribe("customer-notifications", notifyCustomerOnEvent, events.OrderUpdated)
+	bus.Subscribe("wallet", refreshWalletPassesOnEvent, events.MenuActivated)
+	bus.SubscribeRemote("kds", refreshKDSOnEvent, events.OrderCreated, events.OrderUpdated)
+	if telegramBot != nil {
+		telegramBot.Subscribe(bus, "telegram", telegramOrderNotice, events.OrderCreated)
+	}
+}
+
+// publishEvent pubblica un evento del ristorante attribuendolo all'utente della richiesta
+func publishEvent(r *http.Request, eventType, restaurantID string, data map[string]interface{}) {
+	event := events.Event{Type: eventType, RestaurantID: restaurantID, Data: data}
+	if session, err := getSessionFromRequest(r); err == nil {
+		event.ActorID = session.UserID
+	}
+	eventBus.Publish(event)
+}
+
+// publishMenuEvent pubblica un evento su un menu con i suoi dati essenziali
+func publishMenuEvent(r *http.Request, eventType string, menu *models.Menu) {
+	publishEvent(r, eventType, menu.RestaurantID, map[string]interface{}{
+		"menu_id": menu.ID,
+		"name":    menu.Name,
+	})
+}
+
+// publishItemEvent pubblica la modifica di un piatto; change vale created, updated o deleted
+func publishItemEvent(r *http.Request, menu *models.Menu, item *models.MenuItem, change string) {
+	publishEvent(r, events.ItemUpdated, menu.RestaurantID, map[string]interface{}{
+		"menu_id":   menu.ID,
+		"item_id":   item.ID,
+		"name":      item.Name,
+		"price":     item.Price,
+		"available": item.Available,
+		"change":    change,
+	})
+}
+
+// deliverEventToWebhooks accoda l'evento per gli endpoint del ristorante iscritti al suo tipo.
+// Gli eventi della piattaforma (senza ristorante) non hanno webhook
+func deliverEventToWebhooks(ctx context.Context, event events.Event) error {
+	if event.RestaurantID == "" {
+		return nil
+	}
+	return EmitWebhookEvent(ctx, event)
+}
+
+// trackEventInAnalytics registra nelle statistiche le scansioni del QR code e le aperture
+// dai tag NFC e dai link brevi
+func trackEventInAnalytics(_ context.Context, event events.Event) error {
+	scan := analytics.QRScanEvent{
+		RestaurantID: event.RestaurantID,
+		Timestamp:    event.OccurredAt,
+	}
+	if menuID, ok := event.Data["menu_id"].(string); ok {
+		scan.MenuID = menuID
+	}
+	if source, ok := event.Data["source"].(string); ok {
+		scan.Source = source
+	}
+	if linkSource, ok := event.Data["link_source"].(string); ok {
+		scan.LinkSource = linkSource
+	}
+	if campaign, ok := event.Data["campaign"].(string); ok {
+		scan.Campaign = campaign
+	}
+	if event.Visitor != nil {
+		scan.UserIP = event.Visitor.IP
+		scan.UserAgent = event.Visitor.UserAgent
+	}
+	analytics.GetAnalytics().TrackQRScan(scan)
+	return nil
+}
+
+// notifyEventToOwner avvisa il proprietario delle modifiche fatte dallo staff. Le azioni del
+// proprietario stesso non vengono notificate
+func notifyEventToOwner(ctx context.Context, event events.Event) error {
+	if db.MongoInstance == nil || event.RestaurantID == "" {
+		return nil
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, event.RestaurantID)
+	if err != nil || restaurant == nil || restaurant.OwnerID == "" || restaurant.OwnerID == event.ActorID {
+		return err
+	}
+	owner, err := db.MongoInstance.GetUserByID(ctx, restaurant.OwnerID)
+	if err != nil || owner == nil || !owner.IsActive {
+		return err
+	}
+
+	actorName := "Un membro dello staff"
+	if event.ActorID != "" {
+		if actor, err := db.MongoInstance.GetUserByID(ctx, event.ActorID); err == nil && actor != nil {
+			actorName = actor.Username
+		}
+	}
+	menuName, _ := event.Data["name"].(string)
+	return notifyOwner(ctx, owner, i18n.KeyMenuActivated, map[string]interface{}{
+		"RestaurantName": restaurant.Name,
+		"MenuName":       menuName,
+		"ActorName":      actorName,
+		"OccurredAt":     event.OccurredAt,
+		"AdminURL":       configuredBaseURL + "/admin",
+	})
+}
+
+// refreshMenuCacheOnEvent rimuove dalla cache il menu modificato su un'altra istanza e
+// programma il warm-up dei menu del ristorante, come PublicMenuCacheMiddleware per le
+// modifiche ricevute da questa
+func refreshMenuCacheOnEvent(_ context.Context, event events.Event) error {
+	if publicMenuCache == nil || event.RestaurantID == "" {
+		return nil
+	}
+	if menuID, ok := event.Data["menu_id"].(string); ok {
+		publicMenuCache.InvalidateKey(publicMenuCacheKey(menuID))
+	}
+	scheduleMenuWarmUp(event.RestaurantID)
+	return nil
+}
+
+// auditPlatformEvent registra nell'audit log i backup completati e quelli non riusciti
+func auditPlatformEvent(ctx context.Context, event events.Event) error {
+	backupID, _ := event.Data["backup_id"].(string)
+	if event.Type == events.BackupFailed {
+		RecordAuditLog(ctx, "BACKUP_FAILED", "backup", backupID, "", "", "", "failure")
+		return nil
+	}
+	RecordAuditLog(ctx, "BACKUP_COMPLETED", "backup", backupID, "", "", "", "success")
+	return nil
+}
+
+// publishQRScan pubblica la scansione del QR code di un ristorante con i dati del visitatore,
+// usati solo dalle analytics. Senza il consenso del visitatore (vedi trackingAllowed) i dati
+// del visitatore non vengono inclusi
+func publishQRScan(r *http.Request, restaurant *models.Restaurant) {
+	publishScan(r, restaurant, map[string]interface{}{
+		"menu_id": restaurant.ActiveMenuID,
+		"source":  analytics.ScanSourceQR,
+	})
+}
+
+// publishNFCScan pubblica l'apertura del menu da un tag NFC, come le scansioni del QR code
+// ma con origine nfc e il tag
+func publishNFCScan(r *http.Request, restaurant *models.Restaurant, tag *models.NFCTag, menuID string) {
+	publishScan(r, restaurant, map[string]interface{}{
+		"menu_id": menuID,
+		"source":  analytics.ScanSourceNFC,
+		"tag_id":  tag.ID,
+		"label":   tag.Label,
+	})
+}
+
+// publishShortLinkClick pubblica l'apertura del menu da un link breve, con origine e campagna
+// del link
+func publishShortLinkClick(r *http.Request, restaurant *models.Restaurant, link *models.ShortLink, menuID string) {
+	publishScan(r, restaurant, map[string]interface{}{
+		"menu_id":     menuID,
+		"source":      analytics.ScanSourceLink,
+		"link_id":     link.ID,
+		"link_source": link.Source,
+		"campaign":    link.Campaign,
+	})
+}
+
+func publishScan(r *http.Request, restaurant *models.Restaurant, data map[string]interface{}) {
+	event := events.Event{
+		Type:         events.QRScanned,
+		RestaurantID: restaurant.ID,
+		Data:         data,
+		OccurredAt:   time.Now(),
+	}
+	if trackingAllowed(r, restaurant.PrivacyFirstAnalytics) {
+		event.Visitor = &events.Visitor{
+			IP:        getClientIP(r),
+			UserAgent: r.UserAgent(),
+			Referrer:  r.Referer(),
+		}
+	}
+	eventBus.Publish(event)
+}
@@ -0,0 +1,581 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+)
+
+const (
+	// feedbackPerVisitorDay è il numero massimo di feedback che lo stesso visitatore può
+	// lasciare a un ristorante in un giorno
+	feedbackPerVisitorDay = 3
+	// maxFeedbackBody è la dimensione massima del corpo di un feedback
+	maxFeedbackBody = 16 << 10
+)
+
+// feedbackQuery descrive paginazione, ordinamento e filtri dell'elenco dei feedback
+var feedbackQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     200,
+	DefaultSort:    "-created_at",
+	Sortable:       []string{"created_at", "rating"},
+	Filterable:     []string{"status", "item_id", "order_id"},
+}
+
+// feedbackItemRequest è la valutazione di un piatto in un feedback
+type feedbackItemRequest struct {
+	ItemID string `json:"item_id"`
+	Rating int    `json:"rating"`
+}
+
+// feedbackRequest è il corpo di POST /api/v1/public/menus/{id}/feedback
+type feedbackRequest struct {
+	Rating  int                   `json:"rating"`
+	Comment string                `json:"comment"`
+	OrderID string                `json:"order_id"`
+	Items   []feedbackItemRequest `json:"items"`
+
+	// Website è un campo trappola nascosto ai clienti: lo compilano solo i bot
+	Website string `json:"website"`
+}
+
+// newFeedback valida la richiesta sul menu e compone il feedback, copiando il nome dei piatti
+// valutati. I feedback senza commento non hanno nulla da moderare e vengono approvati subito.
+// Gli errori restituiti sono messaggi per il client
+func newFeedback(menu *models.Menu, req feedbackRequest) (*models.Feedback, error) {
+	if !models.ValidRating(req.Rating) {
+		return nil, errors.New("la valutazione deve essere da 1 a 5 stelle")
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if utf8.RuneCountInString(comment) > models.MaxFeedbackComment {
+		return nil, fmt.Errorf("il commento può contenere al massimo %d caratteri", models.MaxFeedbackComment)
+	}
+	if len(req.Items) > models.MaxFeedbackItems {
+		return nil, fmt.Errorf("si possono valutare al massimo %d piatti", models.MaxFeedbackItems)
+	}
+
+	feedback := &models.Feedback{
+		ID:           uuid.New().String(),
+		RestaurantID: menu.RestaurantID,
+		MenuID:       menu.ID,
+		OrderID:      strings.TrimSpace(req.OrderID),
+		Rating:       req.Rating,
+		Comment:      comment,
+		Status:       models.FeedbackApproved,
+		CreatedAt:    time.Now(),
+	}
+	if comment != "" {
+		feedback.Status = models.FeedbackPending
+	}
+
+	seen := make(map[string]bool, len(req.Items))
+	for _, reqItem := range req.Items {
+		if !models.ValidRating(reqItem.Rating) {
+			return nil, errors.New("la valutazione dei piatti deve essere da 1 a 5 stelle")
+		}
+		item := locateMenuItem(menu, reqItem.ItemID)
+		if item == nil {
+			return nil, fmt.Errorf("piatto %s non presente nel menu", reqItem.ItemID)
+		}
+		if seen[item.ID] {
+			return nil, fmt.Errorf("piatto %s valutato più volte", item.Name)
+		}
+		seen[item.ID] = true
+		feedback.Items = append(feedback.Items, models.ItemFeedback{ItemID: item.ID, Name: item.Name, Rating: reqItem.Rating})
+	}
+	return feedback, nil
+}
+
+// dailyVisitorHash identifica il visitatore per i limiti giornalieri di feedback e raccolte di
+// punti, senza salvarne IP e User-Agent: l'hash cambia ogni giorno e per ogni ristorante
+func dailyVisitorHash(r *http.Request, restaurantID string, day time.Time) string {
+	sum := sha256.Sum256([]byte(restaurantID + "|" + getClientIP(r) + "|" + r.UserAgent() + "|" + day.Format("2006-01-02")))
+	return hex.EncodeToString(sum[:])
+}
+
+// SubmitFeedbackHandler riceve il feedback di un cliente dopo la visita
+// (POST /api/v1/public/menus/{id}/feedback): stelle, commento facoltativo e, se vuole, il voto
+// di singoli piatti. I commenti restano in moderazione fino all'approvazione del ristorante
+func SubmitFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	var req feedbackRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxFeedbackBody)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	// Ai bot si risponde come a un cliente, così non imparano a evitare la trappola
+	if req.Website != "" {
+		httputil.Created(w, "Grazie per il feedback", nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, err := db.MongoInstance.GetMenuByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'invio del feedback")
+		return
+	}
+	if menu == nil || menu.IsArchived {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, menu.RestaurantID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'invio del feedback")
+		return
+	}
+	if restaurant == nil || !restaurant.IsActive {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+
+	feedback, err := newFeedback(menu, req)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	today := feedback.CreatedAt.UTC().Truncate(24 * time.Hour)
+	feedback.VisitorHash = dailyVisitorHash(r, restaurant.ID, today)
+	sent, err := db.MongoInstance.CountFeedback(ctx, db.FeedbackFilter{
+		RestaurantID: restaurant.ID,
+		VisitorHash:  feedback.VisitorHash,
+		Since:        today,
+	})
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'invio del feedback")
+		return
+	}
+	if sent >= feedbackPerVisitorDay {
+		logger.WarnCtx(r.Context(), "Limite giornaliero di feedback superato", map[string]interface{}{
+			"restaurant_id": restaurant.ID,
+			"menu_id":       menu.ID,
+		})
+		httputil.ErrorMessage(w, http.StatusTooManyRequests, "Hai già lasciato un feedback oggi, grazie!")
+		return
+	}
+
+	// Un feedback per ordine: l'ordine deve essere del ristorante
+	if feedback.OrderID != "" {
+		order, err := db.MongoInstance.GetOrder(ctx, feedback.OrderID, restaurant.ID)
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nell'invio del feedback")
+			return
+		}
+		if order == nil {
+			httputil.BadRequest(w, "Ordine non trovato")
+			return
+		}
+		existing, err := db.MongoInstance.CountFeedback(ctx, db.FeedbackFilter{RestaurantID: restaurant.ID, OrderID: order.ID})
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nell'invio del feedback")
+			return
+		}
+		if existing > 0 {
+			httputil.Conflict(w, "Feedback già inviato per questo ordine")
+			return
+		}
+	}
+
+	if err := db.MongoInstance.CreateFeedback(ctx, feedback); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'invio del feedback")
+		return
+	}
+	if feedback.Status == models.FeedbackApproved {
+		if err := refreshRestaurantRatings(ctx, restaurant); err != nil {
+			logger.ErrorCtx(r.Context(), "Errore nell'aggiornamento delle valutazioni", map[string]interface{}{
+				"error":         err.Error(),
+				"restaurant_id": restaurant.ID,
+			})
+		}
+	}
+
+	eventBus.Publish(events.Event{Type: events.FeedbackReceived, RestaurantID: restaurant.ID, Data: feedbackEventData(feedback)})
+	httputil.Created(w, "Grazie per il feedback", map[string]string{"id": feedback.ID, "status": feedback.Status})
+}
+
+// feedbackEventData è il payload dell'evento feedback.received
+func feedbackEventData(feedback *models.Feedback) map[string]interface{} {
+	items := make([]map[string]interface{}, 0, len(feedback.Items))
+	for _, item := range feedback.Items {
+		items = append(items, map[string]interface{}{"item_id": item.ItemID, "name": item.Name, "rating": item.Rating})
+	}
+	return map[string]interface{}{
+		"feedback_id": feedback.ID,
+		"menu_id":     feedback.MenuID,
+		"order_id":    feedback.OrderID,
+		"rating":      feedback.Rating,
+		"comment":     feedback.Comment,
+		"items":       items,
+		"status":      feedback.Status,
+	}
+}
+
+// refreshRestaurantRatings ricalcola le valutazioni approvate salvate sul ristorante e, se il
+// ristorante le mostra, aggiorna i menu pubblici in cache
+func refreshRestaurantRatings(ctx context.Context, restaurant *models.Restaurant) error {
+	stats, err := db.MongoInstance.GetRatingStats(ctx, restaurant.ID, time.Time{})
+	if err != nil {
+		return err
+	}
+	if err := db.MongoInstance.SetRestaurantRatings(ctx, restaurant.ID, stats); err != nil {
+		return err
+	}
+	restaurant.Ratings = stats
+
+	if restaurant.ShowRatings && publicMenuCache != nil {
+		for _, menuID := range restaurant.DisplayMenuIDs() {
+			publicMenuCache.InvalidateKey(publicMenuCacheKey(menuID))
+		}
+		scheduleMenuWarmUp(restaurant.ID)
+	}
+	return nil
+}
+
+// moderateFeedback approva o rifiuta un feedback e ricalcola le valutazioni del ristorante.
+// Restituisce nil se il feedback non esiste
+func moderateFeedback(ctx context.Context, r *http.Request, restaurant *models.Restaurant, id, status string) (*models.Feedback, error) {
+	feedback, err := db.MongoInstance.ModerateFeedback(ctx, id, restaurant.ID, status, requestActorID(r), time.Now())
+	if err != nil || feedback == nil {
+		return nil, err
+	}
+	if err := refreshRestaurantRatings(ctx, restaurant); err != nil {
+		return nil, err
+	}
+
+	action := "FEEDBACK_APPROVED"
+	if status == models.FeedbackRejected {
+		action = "FEEDBACK_REJECTED"
+	}
+	RecordAuditLogAsync(action, "feedback", feedback.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	return feedback, nil
+}
+
+// ListFeedbackHandler elenca i feedback del ristorante, dal più recente (GET /api/v1/feedback).
+// ?status=pending restituisce la coda di moderazione
+func ListFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	query, err := httputil.ParseListQuery(r, feedbackQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	feedback, total, err := db.MongoInstance.FindFeedback(ctx, db.FeedbackFilter{
+		RestaurantID: restaurant.ID,
+		Status:       query.Filter("status"),
+		ItemID:       query.Filter("item_id"),
+		OrderID:      query.Filter("order_id"),
+	}, dbListOptions(query))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei feedback")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, feedback, query, total)
+}
+
+// ApproveFeedbackHandler approva un feedback (POST /api/v1/feedback/{id}/approve): il voto
+// entra nelle valutazioni del ristorante e dei piatti
+func ApproveFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	moderateFeedbackAPI(w, r, models.FeedbackApproved)
+}
+
+// RejectFeedbackHandler rifiuta un feedback come spam o abuso
+// (POST /api/v1/feedback/{id}/reject): il voto esce dalle valutazioni
+func RejectFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	moderateFeedbackAPI(w, r, models.FeedbackRejected)
+}
+
+func moderateFeedbackAPI(w http.ResponseWriter, r *http.Request, status string) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	feedback, err := moderateFeedback(ctx, r, restaurant, mux.Vars(r)["id"], status)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella moderazione del feedback")
+		return
+	}
+	if feedback == nil {
+		httputil.NotFound(w, "Feedback")
+		return
+	}
+	httputil.Success(w, "Feedback moderato", feedback)
+}
+
+// FeedbackPageHandler mostra la coda di moderazione dei feedback (GET /admin/feedback);
+// ?status= mostra i feedback approvati o rifiutati
+func FeedbackPageHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != models.FeedbackApproved && status != models.FeedbackRejected {
+		status = models.FeedbackPending
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	const perPage = 50
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	feedback, total, err := db.MongoInstance.FindFeedback(ctx, db.FeedbackFilter{RestaurantID: restaurant.ID, Status: status},
+		db.ListOptions{Skip: int64((page - 1) * perPage), Limit: perPage})
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero dei feedback", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nel caricamento dei feedback", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Restaurant *models.Restaurant
+		Feedback   []*models.Feedback
+		Status     string
+		PrevPage   int // 0 se non c'è una pagina precedente
+		NextPage   int // 0 se non c'è una pagina successiva
+		Success    string
+		CSRFToken  string
+	}{
+		Restaurant: restaurant,
+		Feedback:   feedback,
+		Status:     status,
+		PrevPage:   page - 1,
+		Success:    r.URL.Query().Get("success"),
+		CSRFToken:  csrfToken(w, r),
+	}
+	if int64(page*perPage) < total {
+		data.NextPage = page + 1
+	}
+	renderTemplate(w, "feedback", data)
+}
+
+// ModerateFeedbackFormHandler approva o rifiuta un feedback dalla coda di moderazione
+// (POST /admin/feedback/{id}/approve e /admin/feedback/{id}/reject)
+func ModerateFeedbackFormHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	status := models.FeedbackApproved
+	if strings.HasSuffix(r.URL.Path, "/reject") {
+		status = models.FeedbackRejected
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	feedback, err := moderateFeedback(ctx, r, restaurant, mux.Vars(r)["id"], status)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella moderazione del feedback", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nella moderazione del feedback", http.StatusInternalServerError)
+		return
+	}
+	if feedback == nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.Redirect(w, r, "/admin/feedback?success="+status, http.StatusSeeOther)
+}
+
+// RatingsAnalyticsHandler restituisce le valutazioni approvate degli ultimi giorni: media,
+// distribuzione delle stelle, medie per piatto e feedback in attesa di moderazione
+// (GET /api/v1/analytics/ratings?days=30, days=0 per tutte)
+func RatingsAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	days := 30
+	if param := r.URL.Query().Get("days"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 0 || parsed > 365 {
+			httputil.BadRequest(w, "days deve essere tra 0 e 365")
+			return
+		}
+		days = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	ratings, pending, err := loadRatingAnalytics(ctx, restaurant.ID, days)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel calcolo delle valutazioni")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", map[string]interface{}{
+		"days":    days,
+		"ratings": ratings,
+		"pending": pending,
+	})
+}
+
+// loadRatingAnalytics calcola le valutazioni approvate degli ultimi days giorni (0 per tutte)
+// e conta i feedback in attesa di moderazione
+func loadRatingAnalytics(ctx context.Context, restaurantID string, days int) (*models.RatingStats, int64, error) {
+	var since time.Time
+	if days > 0 {
+		since = time.Now().AddDate(0, 0, -days)
+	}
+	ratings, err := db.MongoInstance.GetRatingStats(ctx, restaurantID, since)
+	if err != nil {
+		return nil, 0, err
+	}
+	pending, err := db.MongoInstance.CountFeedback(ctx, db.FeedbackFilter{RestaurantID: restaurantID, Status: models.FeedbackPending})
+	if err != nil {
+		return nil, 0, err
+	}
+	return ratings, pending, nil
+}
+
+// topRatedItems restituisce i piatti con la media più alta, al massimo n, tra quelli con
+// abbastanza valutazioni da essere mostrate nel menu pubblico
+func topRatedItems(stats *models.RatingStats, n int) []models.ItemRating {
+	if stats == nil {
+		return nil
+	}
+	items := make([]models.ItemRating, 0, len(stats.Items))
+	for _, item := range stats.Items {
+		if item.Count >= models.MinPublicRatings {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Average != items[j].Average {
+			return items[i].Average > items[j].Average
+		}
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Name < items[j].Name
+	})
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
+
+// SetShowRatingsHandler mostra o nasconde le valutazioni dei clienti nel menu pubblico
+// (POST /account/ratings-display)
+func SetShowRatingsHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	enabled := r.FormValue("show_ratings") == "on"
+	if enabled == restaurant.ShowRatings {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.SetRestaurantShowRatings(ctx, restaurant, enabled); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'impostazione delle valutazioni nel menu", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nell'impostazione delle valutazioni nel menu", http.StatusInternalServerError)
+		return
+	}
+
+	RecordAuditLogAsync("RESTAURANT_SHOW_RATINGS_CHANGED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+
+	http.Redirect(w, r, "/account?success=ratings_display_changed", http.StatusSeeOther)
+}
+
+// itemRating restituisce la valutazione del piatto mostrata nel menu pubblico ("4,6 (23)"):
+// vuota se il ristorante non mostra le valutazioni o il piatto ne ha troppo poche
+func itemRating(restaurant *models.Restaurant, itemID string) string {
+	if restaurant == nil || !restaurant.ShowRatings || restaurant.Ratings == nil {
+		return ""
+	}
+	rating, ok := restaurant.Ratings.Items[itemID]
+	if !ok {
+		return ""
+	}
+	return formatRating(rating.RatingSummary)
+}
+
+// restaurantRating restituisce la valutazione complessiva del ristorante mostrata nel menu
+// pubblico, con le stesse regole di itemRating
+func restaurantRating(restaurant *models.Restaurant) string {
+	if restaurant == nil || !restaurant.ShowRatings || restaurant.Ratings == nil {
+		return ""
+	}
+	return formatRating(restaurant.Ratings.RatingSummary)
+}
+
+func formatRating(rating models.RatingSummary) string {
+	if rating.Count < models.MinPublicRatings {
+		return ""
+	}
+	average := strings.Replace(fmt.Sprintf("%.1f", rating.Average), ".", ",", 1)
+	return fmt.Sprintf("%s (%d)", average, rating.Count)
+}
+
+// stars disegna un voto da 1 a 5 come stelle piene e vuote
+func stars(rating int) string {
+	if rating < 0 {
+		rating = 0
+	}
+	if rating > 5 {
+		rating = 5
+	}
+	return strings.Repeat("★", rating) + strings.Repeat("☆", 5-rating)
+}
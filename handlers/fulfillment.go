@@ -0,0 +1,732 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	"qr-menu/pkg/fulfillment"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+	"qr-menu/pkg/phone"
+	"qr-menu/pkg/sms"
+	"qr-menu/pkg/whatsapp"
+)
+
+const (
+	// maxSlotMinutes è la durata massima di una fascia oraria
+	maxSlotMinutes = 240
+	// maxSlotCapacity è il numero massimo di ordini configurabile per fascia
+	maxSlotCapacity = 500
+	// maxLeadMinutes è il preavviso massimo configurabile
+	maxLeadMinutes = 24 * 60
+	// maxDeliveryRadiusKm è il raggio di consegna massimo
+	maxDeliveryRadiusKm = 50
+	// maxPublicOrderBody è la dimensione massima di un ordine inviato da un cliente
+	maxPublicOrderBody = 32 << 10
+)
+
+// errSlotFull indica che la fascia scelta dal cliente ha raggiunto il numero massimo di ordini
+var errSlotFull = errors.New("la fascia oraria scelta è al completo, scegline un'altra")
+
+// defaultFulfillmentSettings è la configurazione di un ristorante che non l'ha ancora salvata:
+// nessun ordine in anticipo
+func defaultFulfillmentSettings() *models.FulfillmentSettings {
+	return &models.FulfillmentSettings{SlotMinutes: 15, SlotCapacity: 5, LeadMinutes: 30, CountryCode: "39", Windows: []models.FulfillmentWindow{}}
+}
+
+// restaurantFulfillment restituisce la configurazione degli ordini in anticipo del ristorante,
+// quella predefinita se non è configurata
+func restaurantFulfillment(restaurant *models.Restaurant) *models.FulfillmentSettings {
+	if restaurant.Fulfillment == nil {
+		return defaultFulfillmentSettings()
+	}
+	return restaurant.Fulfillment
+}
+
+// fulfillmentWindows converte le fasce di apertura per il calcolo delle fasce orarie. Gli
+// orari sono già stati validati al salvataggio
+func fulfillmentWindows(settings *models.FulfillmentSettings) []fulfillment.Window {
+	windows := make([]fulfillment.Window, 0, len(settings.Windows))
+	for _, w := range settings.Windows {
+		open, err1 := fulfillment.ParseClock(w.Open)
+		closing, err2 := fulfillment.ParseClock(w.Close)
+		if err1 == nil && err2 == nil {
+			windows = append(windows, fulfillment.Window{Weekday: time.Weekday(w.Weekday), Open: open, Close: closing})
+		}
+	}
+	return windows
+}
+
+// validateFulfillmentSettings controlla la configurazione inviata dal ristorante. Gli errori
+// restituiti sono messaggi per il client
+func validateFulfillmentSettings(settings *models.FulfillmentSettings) error {
+	settings.CountryCode = strings.TrimPrefix(strings.TrimSpace(settings.CountryCode), "+")
+	switch {
+	case settings.SlotMinutes < 5 || settings.SlotMinutes > maxSlotMinutes:
+		return fmt.Errorf("slot_minutes deve essere tra 5 e %d", maxSlotMinutes)
+	case settings.SlotCapacity < 1 || settings.SlotCapacity > maxSlotCapacity:
+		return fmt.Errorf("slot_capacity deve essere tra 1 e %d", maxSlotCapacity)
+	case settings.LeadMinutes < 0 || settings.LeadMinutes > maxLeadMinutes:
+		return fmt.Errorf("lead_minutes deve essere tra 0 e %d", maxLeadMinutes)
+	case settings.DaysAhead < 0 || settings.DaysAhead > models.MaxDaysAhead:
+		return fmt.Errorf("days_ahead deve essere tra 0 e %d", models.MaxDaysAhead)
+	case !validCountryCode(settings.CountryCode):
+		return errors.New("country_code deve essere un prefisso internazionale, es. 39")
+	case len(settings.Windows) > models.MaxFulfillmentWindows:
+		return fmt.Errorf("massimo %d fasce di apertura", models.MaxFulfillmentWindows)
+	}
+	for _, w := range settings.Windows {
+		open, err := fulfillment.ParseClock(w.Open)
+		if err != nil {
+			return fmt.Errorf("orario di apertura %q non valido: usa il formato HH:MM", w.Open)
+		}
+		closing, err := fulfillment.ParseClock(w.Close)
+		if err != nil {
+			return fmt.Errorf("orario di chiusura %q non valido: usa il formato HH:MM", w.Close)
+		}
+		if w.Weekday < 0 || w.Weekday > 6 {
+			return errors.New("weekday deve essere tra 0 (domenica) e 6 (sabato)")
+		}
+		if closing-open < time.Duration(settings.SlotMinutes)*time.Minute {
+			return fmt.Errorf("la fascia %s-%s non contiene nemmeno una fascia oraria da %d minuti", w.Open, w.Close, settings.SlotMinutes)
+		}
+	}
+	if (settings.DineIn || settings.Takeaway || settings.Delivery) && len(settings.Windows) == 0 {
+		return errors.New("gli ordini in anticipo richiedono almeno una fascia di apertura")
+	}
+	if settings.Delivery {
+		if !fulfillment.ValidCoordinates(settings.Latitude, settings.Longitude) {
+			return errors.New("la consegna richiede latitude e longitude del ristorante")
+		}
+		if settings.DeliveryRadiusKm <= 0 || settings.DeliveryRadiusKm > maxDeliveryRadiusKm {
+			return fmt.Errorf("delivery_radius_km deve essere tra 0 e %d", maxDeliveryRadiusKm)
+		}
+	}
+	if settings.Windows == nil {
+		settings.Windows = []models.FulfillmentWindow{}
+	}
+	return nil
+}
+
+// validCountryCode indica se code è un prefisso internazionale, da 1 a 3 cifre senza zeri iniziali
+func validCountryCode(code string) bool {
+	if len(code) < 1 || len(code) > 3 || code[0] == '0' {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// GetFulfillmentSettingsHandler restituisce la configurazione degli ordini in anticipo
+// (GET /api/v1/fulfillment/settings)
+func GetFulfillmentSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	httputil.Success(w, "", restaurantFulfillment(restaurant))
+}
+
+// UpdateFulfillmentSettingsHandler configura gli ordini in anticipo: modi offerti, raggio di
+// consegna, fasce di apertura, durata e capienza delle fasce orarie
+// (PUT /api/v1/fulfillment/settings)
+func UpdateFulfillmentSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var settings models.FulfillmentSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if err := validateFulfillmentSettings(&settings); err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	settings.UpdatedAt = time.Now()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.SetRestaurantFulfillment(ctx, restaurant.ID, &settings); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio della configurazione degli ordini")
+		return
+	}
+
+	RecordAuditLogAsync("FULFILLMENT_SETTINGS_UPDATED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Configurazione degli ordini in anticipo aggiornata", settings)
+}
+
+// fulfillmentRestaurant trova il ristorante del percorso e verifica che accetti ordini in
+// anticipo nel modo indicato; risponde 404 e restituisce nil altrimenti
+func fulfillmentRestaurant(ctx context.Context, w http.ResponseWriter, r *http.Request, mode string) *models.Restaurant {
+	restaurant, err := db.MongoInstance.GetRestaurantByUsername(ctx, mux.Vars(r)["username"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del ristorante")
+		return nil
+	}
+	if restaurant == nil || !restaurant.IsActive || !restaurant.Fulfillment.Offers(mode) {
+		httputil.NotFound(w, "Ordini in anticipo")
+		return nil
+	}
+	return restaurant
+}
+
+// slotView è una fascia oraria proposta al cliente, con i posti ancora liberi
+type slotView struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Available int       `json:"available"`
+}
+
+// bookableDays restituisce il primo e l'ultimo giorno (esclusi) in cui si può ordinare
+func bookableDays(settings *models.FulfillmentSettings, now time.Time) (time.Time, time.Time) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return today, today.AddDate(0, 0, settings.DaysAhead+1)
+}
+
+// availableSlots restituisce le fasce orarie del giorno di day con i posti liberi. La capienza
+// è condivisa tra asporto, consegna e tavolo, perché la cucina è la stessa
+func availableSlots(ctx context.Context, restaurantID string, settings *models.FulfillmentSettings, day, now time.Time) ([]slotView, error) {
+	length := time.Duration(settings.SlotMinutes) * time.Minute
+	earliest := now.Add(time.Duration(settings.LeadMinutes) * time.Minute)
+	starts := fulfillment.Slots(day, fulfillmentWindows(settings), length, earliest)
+	slots := make([]slotView, 0, len(starts))
+	if len(starts) == 0 {
+		return slots, nil
+	}
+	bookings, err := db.MongoInstance.SlotBookings(ctx, restaurantID, starts[0], starts[len(starts)-1].Add(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	for _, start := range starts {
+		available := settings.SlotCapacity - bookings[start.Unix()]
+		if available < 0 {
+			available = 0
+		}
+		slots = append(slots, slotView{Start: start, End: start.Add(length), Available: available})
+	}
+	return slots, nil
+}
+
+// PublicSlotsHandler elenca al cliente le fasce orarie di un giorno per ritiro, consegna o
+// tavolo (GET /api/v1/public/restaurants/{username}/slots?mode=takeaway&date=2026-10-16).
+// Senza data restituisce quelle di oggi
+func PublicSlotsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	mode := r.URL.Query().Get("mode")
+	restaurant := fulfillmentRestaurant(ctx, w, r, mode)
+	if restaurant == nil {
+		return
+	}
+	settings := restaurant.Fulfillment
+
+	now := time.Now()
+	first, last := bookableDays(settings, now)
+	day := first
+	if date := r.URL.Query().Get("date"); date != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", date, time.Local)
+		if err != nil {
+			httputil.BadRequest(w, "date deve essere nel formato AAAA-MM-GG")
+			return
+		}
+		if parsed.Before(first) || !parsed.Before(last) {
+			httputil.BadRequest(w, fmt.Sprintf("Si può ordinare al massimo %d giorni in anticipo", settings.DaysAhead))
+			return
+		}
+		day = parsed
+	}
+
+	slots, err := availableSlots(ctx, restaurant.ID, settings, day, now)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel calcolo delle fasce orarie")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", map[string]interface{}{
+		"mode":                  mode,
+		"date":                  day.Format("2006-01-02"),
+		"slots":                 slots,
+		"whatsapp_confirmation": whatsAppConfirmsOrders(restaurant),
+	})
+}
+
+// publicOrderRequest è il corpo di POST /api/v1/public/restaurants/{username}/orders
+type publicOrderRequest struct {
+	MenuID   string             `json:"menu_id"` // Vuoto = primo menu attivo
+	Mode     string             `json:"mode"`
+	Slot     time.Time          `json:"slot"` // Inizio della fascia scelta, come restituito dalle fasce
+	Table    string             `json:"table"`
+	Notes    string             `json:"notes"`
+	Lines    []orderLineRequest `json:"lines"`
+	Customer struct {
+		Name          string `json:"name"`
+		Phone         string `json:"phone"`
+		Email         string `json:"email"`
+		WhatsAppOptIn bool   `json:"whatsapp_opt_in"` // Conferma dell'ordine su WhatsApp invece che per SMS
+	} `json:"customer"`
+	Address   string  `json:"address"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// newOrderFulfillment valida fascia, contatti e indirizzo del cliente. Gli errori restituiti
+// sono messaggi per il client
+func newOrderFulfillment(settings *models.FulfillmentSettings, req publicOrderRequest, now time.Time) (*models.OrderFulfillment, error) {
+	f := &models.OrderFulfillment{
+		Mode:          req.Mode,
+		CustomerName:  strings.TrimSpace(req.Customer.Name),
+		CustomerEmail: strings.TrimSpace(req.Customer.Email),
+	}
+	if f.CustomerName == "" || len(f.CustomerName) > 100 {
+		return nil, errors.New("il nome del cliente è obbligatorio (massimo 100 caratteri)")
+	}
+	if req.Customer.Phone != "" {
+		if f.CustomerPhone = phone.Normalize(req.Customer.Phone, settings.CountryCode); f.CustomerPhone == "" {
+			return nil, errors.New("numero di telefono non valido")
+		}
+		f.WhatsAppOptIn = req.Customer.WhatsAppOptIn
+	}
+	if f.CustomerEmail != "" {
+		if addr, err := mail.ParseAddress(f.CustomerEmail); err != nil || addr.Address != f.CustomerEmail || len(f.CustomerEmail) > 254 {
+			return nil, errors.New("indirizzo email non valido")
+		}
+	}
+	if f.CustomerPhone == "" && f.CustomerEmail == "" {
+		return nil, errors.New("indica un telefono o un'email per ricevere gli aggiornamenti dell'ordine")
+	}
+
+	length := time.Duration(settings.SlotMinutes) * time.Minute
+	slot := req.Slot.In(time.Local)
+	first, last := bookableDays(settings, now)
+	switch {
+	case req.Slot.IsZero():
+		return nil, errors.New("scegli una fascia oraria")
+	case !fulfillment.IsSlot(slot, fulfillmentWindows(settings), length):
+		return nil, errors.New("fascia oraria non disponibile")
+	case slot.Before(now.Add(time.Duration(settings.LeadMinutes)*time.Minute)) || slot.Before(first) || !slot.Before(last):
+		return nil, errors.New("la fascia oraria scelta non è più prenotabile")
+	}
+	f.SlotStart = slot
+	f.SlotEnd = slot.Add(length)
+
+	if req.Mode == models.FulfillmentDelivery {
+		f.Address = strings.TrimSpace(req.Address)
+		if f.Address == "" || len(f.Address) > 300 {
+			return nil, errors.New("l'indirizzo di consegna è obbligatorio (massimo 300 caratteri)")
+		}
+		if !fulfillment.ValidCoordinates(req.Latitude, req.Longitude) {
+			return nil, errors.New("posizione dell'indirizzo di consegna mancante")
+		}
+		if fulfillment.Distance(settings.Latitude, settings.Longitude, req.Latitude, req.Longitude) > settings.DeliveryRadiusKm {
+			return nil, fmt.Errorf("l'indirizzo è fuori dalla zona di consegna (%.1f km)", settings.DeliveryRadiusKm)
+		}
+		f.Latitude = req.Latitude
+		f.Longitude = req.Longitude
+	}
+	return f, nil
+}
+
+// newTrackingToken genera il token della pagina di stato di un ordine
+func newTrackingToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("errore generazione token ordine: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// orderTrackingURL è il link alla pagina di stato dell'ordine mandato al cliente
+func orderTrackingURL(baseURL string, order *models.Order) string {
+	return baseURL + "/order/" + url.PathEscape(order.ID) + "?token=" + url.QueryEscape(order.Fulfillment.TrackingToken)
+}
+
+// releaseOrderSlot libera il posto nella fascia di un ordine in anticipo annullato o non
+// registrato
+func releaseOrderSlot(ctx context.Context, order *models.Order) {
+	if order.Fulfillment == nil {
+		return
+	}
+	if err := db.MongoInstance.ReleaseSlot(ctx, order.RestaurantID, order.Fulfillment.SlotStart); err != nil {
+		logger.ErrorCtx(ctx, "Errore nel rilascio della fascia oraria", map[string]interface{}{
+			"error":    err.Error(),
+			"order_id": order.ID,
+		})
+	}
+}
+
+// PublicOrderHandler registra l'ordine in anticipo di un cliente per una fascia oraria, al
+// tavolo, da asporto o con consegna (POST /api/v1/public/restaurants/{username}/orders con
+// mode, slot, lines e customer; la consegna richiede address, latitude e longitude). Il
+// cliente riceve per email il link alla pagina di stato dell'ordine; la risposta propone i
+// piatti ordinati spesso insieme a quelli scelti
+func PublicOrderHandler(w http.ResponseWriter, r *http.Request) {
+	var req publicOrderRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxPublicOrderBody)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	restaurant := fulfillmentRestaurant(ctx, w, r, req.Mode)
+	if restaurant == nil {
+		return
+	}
+	settings := restaurant.Fulfillment
+
+	menuIDs := restaurant.DisplayMenuIDs()
+	menuID := req.MenuID
+	if menuID == "" && len(menuIDs) > 0 {
+		menuID = menuIDs[0]
+	}
+	active := false
+	for _, id := range menuIDs {
+		active = active || id == menuID
+	}
+	if !active {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+	menu, err := db.MongoInstance.GetRestaurantMenu(ctx, menuID, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+		return
+	}
+	if menu == nil || menu.IsArchived {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+
+	table := ""
+	if req.Mode == models.FulfillmentDineIn {
+		table = req.Table
+	}
+	order, err := newOrder(menu, orderRequest{MenuID: menu.ID, Table: table, Notes: req.Notes, Lines: req.Lines})
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	order.Fulfillment, err = newOrderFulfillment(settings, req, order.CreatedAt)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	order.Source = models.OrderSourceOnline
+	order.Fulfillment.Locale = i18n.Default().Negotiate(r.Header.Get("Accept-Language"))
+	if order.Fulfillment.TrackingToken, err = newTrackingToken(); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella registrazione dell'ordine")
+		return
+	}
+
+	reserved, err := db.MongoInstance.ReserveSlot(ctx, restaurant.ID, order.Fulfillment.SlotStart, settings.SlotCapacity)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella prenotazione della fascia oraria")
+		return
+	}
+	if !reserved {
+		httputil.Conflict(w, errSlotFull.Error())
+		return
+	}
+	if err := placeOrder(ctx, order); err != nil {
+		releaseOrderSlot(ctx, order)
+		respondOrderError(w, r, err, "Errore nella registrazione dell'ordine")
+		return
+	}
+
+	RecordAuditLogAsync("ORDER_CREATED", "order", order.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	// Il link inviato al cliente usa solo server.base_url: Host e numero di telefono li sceglie
+	// chi fa la richiesta, che altrimenti farebbe arrivare dal ristorante un link al suo dominio.
+	// Senza base_url il cliente riceve il link relativo solo nella risposta
+	baseURL, baseURLErr := emailBaseURL()
+	trackingURL := orderTrackingURL(baseURL, order)
+	if customerReachable(order.Fulfillment) || (order.Fulfillment.WhatsAppOptIn && whatsAppConfirmsOrders(restaurant)) {
+		if baseURLErr != nil {
+			logger.ErrorCtx(r.Context(), "Conferma dell'ordine al cliente non inviata", map[string]interface{}{
+				"error":    baseURLErr.Error(),
+				"order_id": order.ID,
+			})
+		} else if err := notifyOrderCustomer(ctx, restaurant, order, i18n.KeyOrderConfirmed, trackingURL); err != nil {
+			logger.ErrorCtx(r.Context(), "Errore nella conferma dell'ordine al cliente", map[string]interface{}{
+				"error":    err.Error(),
+				"order_id": order.ID,
+			})
+		}
+	}
+
+	httputil.Created(w, "Ordine ricevuto", map[string]interface{}{
+		"order_id":     order.ID,
+		"number":       order.Number,
+		"status":       order.Status,
+		"total":        order.Total,
+		"fulfillment":  order.Fulfillment,
+		"tracking_url": trackingURL,
+		"suggestions":  orderSuggestions(ctx, menu, order),
+	})
+}
+
+// orderCurrency è la valuta degli importi comunicati al cliente
+func orderCurrency(restaurant *models.Restaurant) string {
+	if restaurant.Payments != nil && restaurant.Payments.Currency != "" {
+		return restaurant.Payments.Currency
+	}
+	return "EUR"
+}
+
+// customerMessageData sono i dati dei messaggi al cliente di un ordine in anticipo
+func customerMessageData(restaurant *models.Restaurant, order *models.Order, trackingURL string) map[string]interface{} {
+	slot := order.Fulfillment.SlotStart.In(time.Local)
+	return map[string]interface{}{
+		"RestaurantName":  restaurant.Name,
+		"RestaurantPhone": restaurant.Phone,
+		"CustomerName":    order.Fulfillment.CustomerName,
+		"Number":          order.Number,
+		"Total":           formatCents(toCents(order.Total), orderCurrency(restaurant)),
+		"Mode":            order.Fulfillment.Mode,
+		"Slot":            slot,
+		"SlotTime":        slot.Format("15:04"),
+		"TrackingURL":     trackingURL,
+	}
+}
+
+// customerMessageKey restituisce il messaggio al cliente per lo stato dell'ordine: conferma
+// finché è in cucina, pronto, annullato
+func customerMessageKey(status string) string {
+	switch status {
+	case models.OrderStatusReady:
+		return i18n.KeyOrderReady
+	case models.OrderStatusCancelled:
+		return i18n.KeyOrderCancelled
+	}
+	return i18n.KeyOrderConfirmed
+}
+
+// customerReachable indica se il cliente può essere avvisato: per email o, se è configurato
+// un provider SMS, al suo numero
+func customerReachable(f *models.OrderFulfillment) bool {
+	return f != nil && (f.CustomerEmail != "" || (f.CustomerPhone != "" && smsSender != nil))
+}
+
+// notifyOrderCustomer manda al cliente il messaggio key sul suo ordine per email e per SMS,
+// su entrambi i canali se ha lasciato sia l'email sia il numero. La conferma dell'ordine arriva
+// invece su WhatsApp se il cliente l'ha chiesto e il ristorante la invia, e per SMS solo se
+// l'invio su WhatsApp non riesce
+func notifyOrderCustomer(ctx context.Context, restaurant *models.Restaurant, order *models.Order, key, trackingURL string) error {
+	f := order.Fulfillment
+	data := customerMessageData(restaurant, order, trackingURL)
+	var errs []error
+	if f.CustomerEmail != "" {
+		errs = append(errs, notifyUser(ctx, f.CustomerEmail, f.Locale, key, data))
+	}
+	viaWhatsApp := false
+	if key == i18n.KeyOrderConfirmed && f.WhatsAppOptIn && whatsAppConfirmsOrders(restaurant) {
+		err := sendOrderWhatsApp(ctx, restaurant, order, data)
+		viaWhatsApp = err == nil
+		if err != nil && smsSender == nil && !errors.Is(err, whatsapp.ErrOptedOut) {
+			errs = append(errs, err)
+		}
+	}
+	if f.CustomerPhone != "" && smsSender != nil && !viaWhatsApp {
+		if _, err := sendSMS(ctx, f.CustomerPhone, f.Locale, key, data); err != nil && !errors.Is(err, sms.ErrOptedOut) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// errCustomerNotified indica che il cliente è già stato avvisato dello stato dell'ordine
+var errCustomerNotified = errors.New("cliente già avvisato")
+
+// notifyCustomerOnEvent avvisa per email o SMS il cliente di un ordine in anticipo quando
+// l'ordine è pronto o viene annullato. Lo stato avvisato è salvato prima dell'invio, così un
+// ordine richiamato in cucina e di nuovo pronto non genera un secondo avviso
+func notifyCustomerOnEvent(ctx context.Context, event events.Event) error {
+	status, _ := event.Data["status"].(string)
+	orderID, _ := event.Data["order_id"].(string)
+	if db.MongoInstance == nil || orderID == "" || (status != models.OrderStatusReady && status != models.OrderStatusCancelled) {
+		return nil
+	}
+	baseURL, err := emailBaseURL()
+	if err != nil {
+		return err
+	}
+	order, err := changeOrder(ctx, event.RestaurantID, orderID, func(order *models.Order) error {
+		f := order.Fulfillment
+		if !customerReachable(f) || order.Status != status || f.Notified == status {
+			return errCustomerNotified
+		}
+		f.Notified = status
+		order.UpdatedAt = time.Now()
+		return nil
+	})
+	if errors.Is(err, errCustomerNotified) || order == nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, order.RestaurantID)
+	if err != nil || restaurant == nil {
+		return err
+	}
+	return notifyOrderCustomer(ctx, restaurant, order, customerMessageKey(status), orderTrackingURL(baseURL, order))
+}
+
+// OrderContactHandler restituisce i contatti del cliente di un ordine in anticipo con il
+// messaggio sullo stato dell'ordine già scritto, e i link che lo aprono in un SMS o in una chat
+// WhatsApp dal telefono del ristorante (GET /api/v1/orders/{id}/contact)
+func OrderContactHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	order, err := db.MongoInstance.GetOrder(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dell'ordine")
+		return
+	}
+	if order == nil || order.Fulfillment == nil {
+		httputil.NotFound(w, "Ordine in anticipo")
+		return
+	}
+
+	baseURL, err := emailBaseURL()
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella preparazione del messaggio")
+		return
+	}
+	f := order.Fulfillment
+	msg, err := i18n.Default().Render(f.Locale, customerMessageKey(order.Status), customerMessageData(restaurant, order, orderTrackingURL(baseURL, order)))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella preparazione del messaggio")
+		return
+	}
+	contact := map[string]interface{}{
+		"name":    f.CustomerName,
+		"email":   f.CustomerEmail,
+		"message": msg.Body,
+	}
+	if f.CustomerPhone != "" {
+		contact["phone"] = "+" + f.CustomerPhone
+		contact["sms_url"] = phone.SMSLink(f.CustomerPhone, msg.Body)
+		contact["whatsapp_url"] = phone.WhatsAppLink(f.CustomerPhone, msg.Body)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", contact)
+}
+
+// trackedOrder trova l'ordine in anticipo dal token della sua pagina di stato
+func trackedOrder(ctx context.Context, r *http.Request) (*models.Order, *models.Restaurant, error) {
+	order, err := db.MongoInstance.GetOrderByTracking(ctx, mux.Vars(r)["id"], r.URL.Query().Get("token"))
+	if err != nil || order == nil {
+		return nil, nil, err
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, order.RestaurantID)
+	if err != nil || restaurant == nil {
+		return nil, nil, err
+	}
+	return order, restaurant, nil
+}
+
+// PublicOrderStatusHandler restituisce al cliente lo stato del suo ordine in anticipo
+// (GET /api/v1/public/orders/{id}?token=...)
+func PublicOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	order, restaurant, err := trackedOrder(ctx, r)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", map[string]interface{}{
+		"restaurant":  restaurant.Name,
+		"number":      order.Number,
+		"status":      order.Status,
+		"total":       order.Total,
+		"lines":       order.Lines,
+		"fulfillment": order.Fulfillment,
+		"updated_at":  order.UpdatedAt,
+	})
+}
+
+// OrderStatusPageHandler mostra al cliente lo stato del suo ordine in anticipo
+// (GET /order/{id}?token=...). Il token, ricevuto solo da chi ha ordinato, fa da credenziale
+func OrderStatusPageHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	order, restaurant, err := trackedOrder(ctx, r)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero dell'ordine", map[string]interface{}{
+			"error":    err.Error(),
+			"order_id": mux.Vars(r)["id"],
+		})
+		http.Error(w, "Servizio temporaneamente non disponibile", http.StatusServiceUnavailable)
+		return
+	}
+	if order == nil {
+		w.WriteHeader(http.StatusNotFound)
+		renderTemplate(w, "404", struct {
+			Title   string
+			Message string
+		}{
+			Title:   "Ordine non trovato",
+			Message: "Il link dell'ordine non è valido.",
+		})
+		return
+	}
+
+	slot := order.Fulfillment.SlotStart.In(time.Local)
+	data := struct {
+		Restaurant *models.Restaurant
+		Order      *models.Order
+		Slot       string
+		SlotEnd    string
+		Total      string
+	}{
+		Restaurant: restaurant,
+		Order:      order,
+		Slot:       slot.Format("02/01/2006 15:04"),
+		SlotEnd:    order.Fulfillment.SlotEnd.In(time.Local).Format("15:04"),
+		Total:      formatCents(toCents(order.Total), orderCurrency(restaurant)),
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	renderTemplate(w, "order_status", data)
+}
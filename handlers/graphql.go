@@ -0,0 +1,667 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+
+	"qr-menu/analytics"
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/tenancy"
+)
+
+// Limiti delle richieste GraphQL: profondità massima dei campi annidati e dimensione del corpo
+const (
+	graphQLMaxDepth    = 8
+	graphQLMaxBodySize = 64 << 10
+	graphQLMaxOrders   = 100 // Ordini restituiti al massimo da una query orders
+)
+
+// graphQLSchemaSource espone in sola lettura ristorante, menu, categorie, piatti, ordini e
+// statistiche. I nomi dei campi sono quelli delle API REST
+const graphQLSchemaSource = `
+schema {
+	query: Query
+}
+
+type Query {
+	restaurant: Restaurant
+	menus(active: Boolean, archived: Boolean): [Menu!]
+	menu(id: ID!): Menu
+	orders(status: [String!], table: String, limit: Int = 50): [Order!]
+	order(id: ID!): Order
+	analytics(days: Int = 7): Analytics
+}
+
+type Restaurant {
+	id: ID!
+	username: String!
+	name: String!
+	description: String!
+	address: String!
+	phone: String!
+	logo: String!
+	is_active: Boolean!
+	created_at: String
+	menus(active: Boolean, archived: Boolean): [Menu!]
+	orders(status: [String!], table: String, limit: Int = 50): [Order!]
+	analytics(days: Int = 7): Analytics
+}
+
+type Menu {
+	id: ID!
+	name: String!
+	description: String!
+	meal_type: String!
+	is_active: Boolean!
+	is_completed: Boolean!
+	is_archived: Boolean!
+	season: String!
+	public_url: String!
+	created_at: String
+	updated_at: String
+	categories: [Category!]!
+	items(available: Boolean, tag: String): [Item!]!
+	analytics(days: Int = 7): MenuAnalytics
+}
+
+type Category {
+	id: ID!
+	name: String!
+	description: String!
+	display_order: Int!
+	translations: [Translation!]!
+	items(available: Boolean, tag: String): [Item!]!
+}
+
+type Item {
+	id: ID!
+	name: String!
+	description: String!
+	price: Float!
+	category: String!
+	available: Boolean!
+	image_url: String!
+	display_order: Int!
+	tags: [String!]!
+	translations: [Translation!]!
+}
+
+type Translation {
+	locale: String!
+	name: String!
+	description: String!
+}
+
+type Order {
+	id: ID!
+	number: Int!
+	menu_id: ID!
+	table: String!
+	notes: String!
+	source: String!
+	status: String!
+	payment_status: String!
+	total: Float!
+	lines: [OrderLine!]!
+	created_at: String
+	updated_at: String
+	ready_at: String
+	closed_at: String
+}
+
+type OrderLine {
+	id: ID!
+	item_id: ID!
+	name: String!
+	category: String!
+	quantity: Int!
+	price: Float!
+	notes: String!
+	status: String!
+	ready_at: String
+}
+
+type Analytics {
+	total_views: Int!
+	unique_views: Int!
+	total_shares: Int!
+	qr_scans: Int!
+	unique_visitors: UniqueVisitors!
+	daily_trend: [DailyStats!]!
+	popular_items: [PopularItem!]!
+}
+
+type UniqueVisitors {
+	today: Int!
+	week: Int!
+	month: Int!
+}
+
+type DailyStats {
+	date: String!
+	views: Int!
+	unique_visitors: Int!
+	qr_scans: Int!
+}
+
+type MenuAnalytics {
+	views: Int!
+	restaurant_views: Int!
+	qr_scans: Int!
+	top_items: [PopularItem!]!
+}
+
+type PopularItem {
+	item_id: ID!
+	item_name: String!
+	category_id: ID!
+	price: Float!
+	views: Int!
+}
+`
+
+// graphQLSchema risolve le query con i tipi graphQL* qui sotto; i tipi senza metodi
+// (traduzioni, statistiche) espongono direttamente i propri campi
+var graphQLSchema = graphql.MustParseSchema(graphQLSchemaSource, &graphQLQuery{},
+	graphql.UseFieldResolvers(),
+	graphql.MaxDepth(graphQLMaxDepth),
+	graphql.DisableIntrospection(),
+	graphql.PanicHandler(graphQLPanicHandler{}),
+)
+
+// graphQLPanicHandler risponde con un errore generico ai resolver andati in panic, che la
+// libreria registra nel log
+type graphQLPanicHandler struct{}
+
+func (graphQLPanicHandler) MakePanicError(ctx context.Context, value interface{}) *gqlerrors.QueryError {
+	return gqlerrors.Errorf("internal error")
+}
+
+// graphQLRequest è il corpo di una richiesta GraphQL
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// graphQLAuthorizerKey è la chiave del contesto con la verifica dei permessi della richiesta
+type graphQLAuthorizerKey struct{}
+
+// GraphQLHandler esegue una query GraphQL sui dati del ristorante autenticato
+// (POST /api/graphql, {"query": "...", "variables": {...}}). Le statistiche richiedono il
+// permesso analytics:read e gli ordini orders:manage: senza, i campi restano null con un
+// errore e il resto della query viene eseguito. Le richieste non valide o troppo annidate rispondono 400 senza dati
+func GraphQLHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := tenancy.RestaurantID(r.Context()); !ok {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	var req graphQLRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, graphQLMaxBodySize)).Decode(&req); err != nil || strings.TrimSpace(req.Query) == "" {
+		httputil.BadRequest(w, "Richiesta GraphQL non valida")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	ctx = context.WithValue(ctx, graphQLAuthorizerKey{}, graphQLAuthorizer(r))
+
+	resp := graphQLSchema.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	status := http.StatusOK
+	if resp.Data == nil {
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.JSON(w, status, resp)
+}
+
+// graphQLAuthorizer verifica i permessi dei campi: gli scope per le API key, il ruolo sul
+// ristorante per le sessioni (letto una volta per richiesta)
+func graphQLAuthorizer(r *http.Request) func(string) bool {
+	if key, ok := r.Context().Value(apiKeyContextKey{}).(*models.APIKey); ok {
+		return key.HasScope
+	}
+	var once sync.Once
+	var role string
+	return func(perm string) bool {
+		once.Do(func() { _, role, _ = currentRole(r) })
+		return models.RoleHasPermission(role, perm)
+	}
+}
+
+// graphQLRequire restituisce un errore se la richiesta non ha il permesso del campo
+func graphQLRequire(ctx context.Context, field, permission string) error {
+	authorize, _ := ctx.Value(graphQLAuthorizerKey{}).(func(string) bool)
+	if authorize == nil || !authorize(permission) {
+		return fmt.Errorf("forbidden: %s requires the %s permission", field, permission)
+	}
+	return nil
+}
+
+// graphQLRestaurantID restituisce il ristorante della richiesta, messo nel contesto da
+// RequireAPIAccess
+func graphQLRestaurantID(ctx context.Context) string {
+	id, _ := tenancy.RestaurantID(ctx)
+	return id
+}
+
+// graphQLInternalError registra l'errore e restituisce al client solo il messaggio
+func graphQLInternalError(ctx context.Context, message string, err error) error {
+	logger.ErrorCtx(ctx, message, map[string]interface{}{
+		"error": err.Error(),
+	})
+	return errors.New(message)
+}
+
+// graphQLTime formatta una data in RFC3339; la data zero è null
+func graphQLTime(t time.Time) *string {
+	if t.IsZero() {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
+
+// graphQLTimePtr formatta una data facoltativa in RFC3339
+func graphQLTimePtr(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	return graphQLTime(*t)
+}
+
+// Argomenti dei campi
+type (
+	graphQLMenusArgs struct {
+		Active   *bool
+		Archived *bool
+	}
+	graphQLItemsArgs struct {
+		Available *bool
+		Tag       *string
+	}
+	graphQLDaysArgs struct {
+		Days int32
+	}
+	graphQLOrdersArgs struct {
+		Status *[]string
+		Table  *string
+		Limit  int32
+	}
+)
+
+// graphQLQuery risolve le radici delle query
+type graphQLQuery struct{}
+
+func (graphQLQuery) Restaurant(ctx context.Context) (*graphQLRestaurant, error) {
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, graphQLRestaurantID(ctx))
+	if err != nil {
+		return nil, graphQLInternalError(ctx, "Errore nel recupero del ristorante", err)
+	}
+	return &graphQLRestaurant{restaurant}, nil
+}
+
+func (graphQLQuery) Menus(ctx context.Context, args graphQLMenusArgs) (*[]*graphQLMenu, error) {
+	return resolveGraphQLMenus(ctx, args)
+}
+
+func (graphQLQuery) Menu(ctx context.Context, args struct{ ID graphql.ID }) (*graphQLMenu, error) {
+	menu, err := tenantMenu(ctx, string(args.ID))
+	if err != nil {
+		return nil, graphQLInternalError(ctx, "Errore nel recupero del menu", err)
+	}
+	if menu == nil {
+		return nil, nil
+	}
+	return &graphQLMenu{menu}, nil
+}
+
+func (graphQLQuery) Orders(ctx context.Context, args graphQLOrdersArgs) (*[]*graphQLOrder, error) {
+	return resolveGraphQLOrders(ctx, args)
+}
+
+// Order restituisce un ordine del ristorante (permesso orders:manage)
+func (graphQLQuery) Order(ctx context.Context, args struct{ ID graphql.ID }) (*graphQLOrder, error) {
+	if err := graphQLRequire(ctx, "order", models.PermOrdersManage); err != nil {
+		return nil, err
+	}
+	order, err := db.MongoInstance.GetOrder(ctx, string(args.ID), graphQLRestaurantID(ctx))
+	if err != nil {
+		return nil, graphQLInternalError(ctx, "Errore nel recupero dell'ordine", err)
+	}
+	if order == nil {
+		return nil, nil
+	}
+	return &graphQLOrder{order}, nil
+}
+
+func (graphQLQuery) Analytics(ctx context.Context, args graphQLDaysArgs) (*graphQLAnalytics, error) {
+	return resolveGraphQLAnalytics(ctx, args)
+}
+
+type graphQLRestaurant struct {
+	r *models.Restaurant
+}
+
+func (g *graphQLRestaurant) ID() graphql.ID      { return graphql.ID(g.r.ID) }
+func (g *graphQLRestaurant) Username() string    { return g.r.Username }
+func (g *graphQLRestaurant) Name() string        { return g.r.Name }
+func (g *graphQLRestaurant) Description() string { return g.r.Description }
+func (g *graphQLRestaurant) Address() string     { return g.r.Address }
+func (g *graphQLRestaurant) Phone() string       { return g.r.Phone }
+func (g *graphQLRestaurant) Logo() string        { return g.r.Logo }
+func (g *graphQLRestaurant) IsActive() bool      { return g.r.IsActive }
+func (g *graphQLRestaurant) CreatedAt() *string  { return graphQLTime(g.r.CreatedAt) }
+
+func (g *graphQLRestaurant) Menus(ctx context.Context, args graphQLMenusArgs) (*[]*graphQLMenu, error) {
+	return resolveGraphQLMenus(ctx, args)
+}
+
+func (g *graphQLRestaurant) Orders(ctx context.Context, args graphQLOrdersArgs) (*[]*graphQLOrder, error) {
+	return resolveGraphQLOrders(ctx, args)
+}
+
+func (g *graphQLRestaurant) Analytics(ctx context.Context, args graphQLDaysArgs) (*graphQLAnalytics, error) {
+	return resolveGraphQLAnalytics(ctx, args)
+}
+
+type graphQLMenu struct {
+	m *models.Menu
+}
+
+func (g *graphQLMenu) ID() graphql.ID      { return graphql.ID(g.m.ID) }
+func (g *graphQLMenu) Name() string        { return g.m.Name }
+func (g *graphQLMenu) Description() string { return g.m.Description }
+func (g *graphQLMenu) MealType() string    { return g.m.MealType }
+func (g *graphQLMenu) IsActive() bool      { return g.m.IsActive }
+func (g *graphQLMenu) IsCompleted() bool   { return g.m.IsCompleted }
+func (g *graphQLMenu) IsArchived() bool    { return g.m.IsArchived }
+func (g *graphQLMenu) Season() string      { return g.m.Season }
+func (g *graphQLMenu) PublicURL() string   { return g.m.PublicURL }
+func (g *graphQLMenu) CreatedAt() *string  { return graphQLTime(g.m.CreatedAt) }
+func (g *graphQLMenu) UpdatedAt() *string  { return graphQLTime(g.m.UpdatedAt) }
+
+func (g *graphQLMenu) Categories() []*graphQLCategory {
+	categories := make([]*graphQLCategory, len(g.m.Categories))
+	for i := range g.m.Categories {
+		categories[i] = &graphQLCategory{&g.m.Categories[i]}
+	}
+	return categories
+}
+
+func (g *graphQLMenu) Items(args graphQLItemsArgs) []*graphQLItem {
+	items := []*graphQLItem{}
+	for i := range g.m.Categories {
+		items = append(items, filterGraphQLItems(g.m.Categories[i].Items, args)...)
+	}
+	return items
+}
+
+// Analytics restituisce le statistiche del menu negli ultimi days giorni (permesso analytics:read)
+func (g *graphQLMenu) Analytics(ctx context.Context, args graphQLDaysArgs) (*graphQLMenuAnalytics, error) {
+	if err := graphQLRequire(ctx, "analytics", models.PermAnalyticsRead); err != nil {
+		return nil, err
+	}
+	days, err := graphQLDays(args)
+	if err != nil {
+		return nil, err
+	}
+	var itemIDs []string
+	for _, category := range g.m.Categories {
+		for _, item := range category.Items {
+			itemIDs = append(itemIDs, item.ID)
+		}
+	}
+	now := time.Now()
+	stats := analytics.GetAnalytics().GetMenuPeriodStats(g.m.RestaurantID, g.m.ID, itemIDs, now.AddDate(0, 0, -(days-1)), now)
+	result := &graphQLMenuAnalytics{
+		Views:           int32(stats.MenuViews),
+		RestaurantViews: int32(stats.RestaurantViews),
+		QRScans:         int32(stats.QRScans),
+	}
+	if err := graphQLConvert(stats.TopItems, &result.TopItems); err != nil {
+		return nil, graphQLInternalError(ctx, "Errore nel calcolo delle statistiche", err)
+	}
+	return result, nil
+}
+
+type graphQLCategory struct {
+	c *models.MenuCategory
+}
+
+func (g *graphQLCategory) ID() graphql.ID      { return graphql.ID(g.c.ID) }
+func (g *graphQLCategory) Name() string        { return g.c.Name }
+func (g *graphQLCategory) Description() string { return g.c.Description }
+func (g *graphQLCategory) DisplayOrder() int32 { return int32(g.c.DisplayOrder) }
+
+func (g *graphQLCategory) Translations() []graphQLTranslation {
+	return graphQLTranslations(g.c.Translations)
+}
+
+func (g *graphQLCategory) Items(args graphQLItemsArgs) []*graphQLItem {
+	return filterGraphQLItems(g.c.Items, args)
+}
+
+type graphQLItem struct {
+	i *models.MenuItem
+}
+
+func (g *graphQLItem) ID() graphql.ID      { return graphql.ID(g.i.ID) }
+func (g *graphQLItem) Name() string        { return g.i.Name }
+func (g *graphQLItem) Description() string { return g.i.Description }
+func (g *graphQLItem) Price() float64      { return g.i.Price }
+func (g *graphQLItem) Category() string    { return g.i.Category }
+func (g *graphQLItem) Available() bool     { return g.i.Available }
+func (g *graphQLItem) ImageURL() string    { return g.i.ImageURL }
+func (g *graphQLItem) DisplayOrder() int32 { return int32(g.i.DisplayOrder) }
+
+func (g *graphQLItem) Tags() []string {
+	if g.i.Tags == nil {
+		return []string{}
+	}
+	return g.i.Tags
+}
+
+func (g *graphQLItem) Translations() []graphQLTranslation {
+	return graphQLTranslations(g.i.Translations)
+}
+
+type graphQLOrder struct {
+	o *models.Order
+}
+
+func (g *graphQLOrder) ID() graphql.ID        { return graphql.ID(g.o.ID) }
+func (g *graphQLOrder) Number() int32         { return int32(g.o.Number) }
+func (g *graphQLOrder) MenuID() graphql.ID    { return graphql.ID(g.o.MenuID) }
+func (g *graphQLOrder) Table() string         { return g.o.Table }
+func (g *graphQLOrder) Notes() string         { return g.o.Notes }
+func (g *graphQLOrder) Source() string        { return g.o.Source }
+func (g *graphQLOrder) Status() string        { return g.o.Status }
+func (g *graphQLOrder) PaymentStatus() string { return g.o.PaymentStatus }
+func (g *graphQLOrder) Total() float64        { return g.o.Total }
+func (g *graphQLOrder) CreatedAt() *string    { return graphQLTime(g.o.CreatedAt) }
+func (g *graphQLOrder) UpdatedAt() *string    { return graphQLTime(g.o.UpdatedAt) }
+func (g *graphQLOrder) ReadyAt() *string      { return graphQLTimePtr(g.o.ReadyAt) }
+func (g *graphQLOrder) ClosedAt() *string     { return graphQLTimePtr(g.o.ClosedAt) }
+
+func (g *graphQLOrder) Lines() []*graphQLOrderLine {
+	lines := make([]*graphQLOrderLine, len(g.o.Lines))
+	for i := range g.o.Lines {
+		lines[i] = &graphQLOrderLine{&g.o.Lines[i]}
+	}
+	return lines
+}
+
+type graphQLOrderLine struct {
+	l *models.OrderLine
+}
+
+func (g *graphQLOrderLine) ID() graphql.ID     { return graphql.ID(g.l.ID) }
+func (g *graphQLOrderLine) ItemID() graphql.ID { return graphql.ID(g.l.ItemID) }
+func (g *graphQLOrderLine) Name() string       { return g.l.Name }
+func (g *graphQLOrderLine) Category() string   { return g.l.Category }
+func (g *graphQLOrderLine) Quantity() int32    { return int32(g.l.Quantity) }
+func (g *graphQLOrderLine) Price() float64     { return g.l.Price }
+func (g *graphQLOrderLine) Notes() string      { return g.l.Notes }
+func (g *graphQLOrderLine) Status() string     { return g.l.Status }
+func (g *graphQLOrderLine) ReadyAt() *string   { return graphQLTimePtr(g.l.ReadyAt) }
+
+// graphQLTranslation è una traduzione di categoria o piatto, con la lingua
+type graphQLTranslation struct {
+	Locale      string
+	Name        string
+	Description string
+}
+
+// graphQLTranslations converte la mappa delle traduzioni in un elenco ordinato per lingua
+func graphQLTranslations(source map[string]models.Translation) []graphQLTranslation {
+	translations := make([]graphQLTranslation, 0, len(source))
+	for locale, t := range source {
+		translations = append(translations, graphQLTranslation{Locale: locale, Name: t.Name, Description: t.Description})
+	}
+	sort.Slice(translations, func(i, j int) bool { return translations[i].Locale < translations[j].Locale })
+	return translations
+}
+
+// Statistiche: i campi seguono i tag json dei dati di analytics, da cui vengono convertiti
+type (
+	graphQLAnalytics struct {
+		TotalViews     int32 `json:"total_views"`
+		UniqueViews    int32 `json:"unique_views"`
+		TotalShares    int32 `json:"total_shares"`
+		QRScans        int32 `json:"qr_scans"`
+		UniqueVisitors struct {
+			Today int32 `json:"today"`
+			Week  int32 `json:"week"`
+			Month int32 `json:"month"`
+		} `json:"unique_visitors"`
+		DailyTrend []struct {
+			Date           string `json:"date"`
+			Views          int32  `json:"views"`
+			UniqueVisitors int32  `json:"unique_visitors"`
+			QRScans        int32  `json:"qr_scans"`
+		} `json:"daily_trend"`
+		PopularItems []graphQLPopularItem `json:"popular_items"`
+	}
+	graphQLMenuAnalytics struct {
+		Views           int32
+		RestaurantViews int32
+		QRScans         int32
+		TopItems        []graphQLPopularItem
+	}
+	graphQLPopularItem struct {
+		ItemID     graphql.ID `json:"item_id"`
+		ItemName   string     `json:"item_name"`
+		CategoryID graphql.ID `json:"category_id"`
+		Price      float64    `json:"price"`
+		Views      int32      `json:"views"`
+	}
+)
+
+// graphQLConvert copia i dati di analytics nei tipi dello schema passando per JSON
+func graphQLConvert(source, target interface{}) error {
+	data, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func resolveGraphQLMenus(ctx context.Context, args graphQLMenusArgs) (*[]*graphQLMenu, error) {
+	restaurantMenus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, graphQLRestaurantID(ctx))
+	if err != nil {
+		return nil, graphQLInternalError(ctx, "Errore nel recupero dei menu", err)
+	}
+	matching := make([]*models.Menu, 0, len(restaurantMenus))
+	for _, menu := range restaurantMenus {
+		if (args.Active != nil && menu.IsActive != *args.Active) || (args.Archived != nil && menu.IsArchived != *args.Archived) {
+			continue
+		}
+		matching = append(matching, menu)
+	}
+	sort.SliceStable(matching, func(i, j int) bool { return matching[i].CreatedAt.After(matching[j].CreatedAt) })
+	menus := make([]*graphQLMenu, len(matching))
+	for i, menu := range matching {
+		menus[i] = &graphQLMenu{menu}
+	}
+	return &menus, nil
+}
+
+func filterGraphQLItems(items []models.MenuItem, args graphQLItemsArgs) []*graphQLItem {
+	matching := make([]*graphQLItem, 0, len(items))
+	for i := range items {
+		item := &items[i]
+		if (args.Available != nil && item.Available != *args.Available) || (args.Tag != nil && !slices.Contains(item.Tags, *args.Tag)) {
+			continue
+		}
+		matching = append(matching, &graphQLItem{item})
+	}
+	return matching
+}
+
+// resolveGraphQLOrders restituisce gli ordini più recenti del ristorante, filtrati per stato e
+// tavolo (permesso orders:manage)
+func resolveGraphQLOrders(ctx context.Context, args graphQLOrdersArgs) (*[]*graphQLOrder, error) {
+	if err := graphQLRequire(ctx, "orders", models.PermOrdersManage); err != nil {
+		return nil, err
+	}
+	if args.Limit < 1 || args.Limit > graphQLMaxOrders {
+		return nil, fmt.Errorf("limit deve essere compreso tra 1 e %d", graphQLMaxOrders)
+	}
+	filter := db.OrderFilter{RestaurantID: graphQLRestaurantID(ctx)}
+	if args.Status != nil {
+		filter.Statuses = *args.Status
+	}
+	if args.Table != nil {
+		filter.Table = *args.Table
+	}
+	found, _, err := db.MongoInstance.FindOrders(ctx, filter, db.ListOptions{Limit: int64(args.Limit)})
+	if err != nil {
+		return nil, graphQLInternalError(ctx, "Errore nel recupero degli ordini", err)
+	}
+	orders := make([]*graphQLOrder, len(found))
+	for i, order := range found {
+		orders[i] = &graphQLOrder{order}
+	}
+	return &orders, nil
+}
+
+// graphQLDays legge l'argomento days delle statistiche (1-365)
+func graphQLDays(args graphQLDaysArgs) (int, error) {
+	if args.Days < 1 || args.Days > 365 {
+		return 0, errors.New("days deve essere compreso tra 1 e 365")
+	}
+	return int(args.Days), nil
+}
+
+// resolveGraphQLAnalytics restituisce le statistiche del ristorante negli ultimi days giorni
+// (permesso analytics:read)
+func resolveGraphQLAnalytics(ctx context.Context, args graphQLDaysArgs) (*graphQLAnalytics, error) {
+	if err := graphQLRequire(ctx, "analytics", models.PermAnalyticsRead); err != nil {
+		return nil, err
+	}
+	days, err := graphQLDays(args)
+	if err != nil {
+		return nil, err
+	}
+	var result graphQLAnalytics
+	if err := graphQLConvert(analytics.GetAnalytics().GetDashboardData(graphQLRestaurantID(ctx), days), &result); err != nil {
+		return nil, graphQLInternalError(ctx, "Errore nel calcolo delle statistiche", err)
+	}
+	return &result, nil
+}
@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	qrmenuv1 "qr-menu/proto/qrmenu/v1"
+)
+
+// grpcMenuService implementa qrmenu.v1.MenuService
+type grpcMenuService struct {
+	qrmenuv1.UnimplementedMenuServiceServer
+}
+
+// grpcOrderService implementa qrmenu.v1.OrderService
+type grpcOrderService struct {
+	qrmenuv1.UnimplementedOrderServiceServer
+}
+
+// RegisterGRPCServices registra MenuService e OrderService sul server gRPC
+func RegisterGRPCServices(s grpc.ServiceRegistrar) {
+	qrmenuv1.RegisterMenuServiceServer(s, grpcMenuService{})
+	qrmenuv1.RegisterOrderServiceServer(s, grpcOrderService{})
+}
+
+// grpcHeader copia i metadata della chiamata in un http.Header, così la API key si legge
+// con apiKeyFromHeader come per le API REST
+func grpcHeader(ctx context.Context) http.Header {
+	header := http.Header{}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for name, values := range md {
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+	return header
+}
+
+// grpcInternal registra l'errore e lo restituisce come INTERNAL senza dettagli per il
+// client; scadenza e annullamento della chiamata mantengono il proprio codice
+func grpcInternal(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return status.FromContextError(err).Err()
+	}
+	logger.Error("Errore nella chiamata gRPC", map[string]interface{}{"error": err.Error()})
+	return status.Error(codes.Internal, "errore interno")
+}
+
+// grpcAPIKey autentica la chiamata con la API key nei metadata e verifica lo scope perm,
+// con gli stessi controlli di RequireAPIAccess
+func grpcAPIKey(ctx context.Context, perm string) (*models.APIKey, error) {
+	header := grpcHeader(ctx)
+	raw := apiKeyFromHeader(header)
+	userAgent := header.Get("User-Agent")
+	if raw == "" {
+		return nil, status.Errorf(codes.Unauthenticated, "API key mancante")
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	key, err := db.MongoInstance.GetAPIKeyByHash(lookupCtx, hashVerificationToken(raw))
+	cancel()
+	if err != nil {
+		logger.Error("Errore nella verifica della API key", map[string]interface{}{
+			"error": err.Error(),
+			"grpc":  true,
+		})
+		return nil, status.Errorf(codes.Internal, "errore nella verifica della API key")
+	}
+	if key == nil {
+		logger.SecurityEvent("API_KEY_REJECTED", "API key non valida", "", "", userAgent, map[string]interface{}{
+			"grpc": true,
+		})
+		return nil, status.Errorf(codes.Unauthenticated, "API key non valida")
+	}
+	if !key.HasScope(perm) {
+		logger.SecurityEvent("ACCESS_DENIED", "Scope mancante nella API key", key.CreatedBy, "", userAgent, map[string]interface{}{
+			"api_key_id":    key.ID,
+			"permission":    perm,
+			"restaurant_id": key.RestaurantID,
+			"grpc":          true,
+		})
+		return nil, status.Errorf(codes.PermissionDenied, "la API key non ha lo scope %s", perm)
+	}
+	if allowed, _ := apiKeyAllowed(ctx, key); !allowed {
+		return nil, status.Errorf(codes.ResourceExhausted, "limite di richieste della API key superato")
+	}
+
+	touchAPIKey(key)
+	meterUsage(key.RestaurantID, models.UsageAPICalls)
+	return key, nil
+}
+
+// ListMenus restituisce i menu non archiviati del ristorante della API key
+func (grpcMenuService) ListMenus(ctx context.Context, req *qrmenuv1.ListMenusRequest) (*qrmenuv1.ListMenusResponse, error) {
+	key, err := grpcAPIKey(ctx, models.PermMenusRead)
+	if err != nil {
+		return nil, err
+	}
+
+	// server_time è letto prima della query e il confronto include lo stesso secondo, così
+	// le modifiche concorrenti rientrano nella sincronizzazione successiva
+	serverTime := time.Now().Unix()
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(dbCtx, key.RestaurantID)
+	if err != nil {
+		return nil, grpcInternal(err)
+	}
+
+	resp := &qrmenuv1.ListMenusResponse{ServerTime: serverTime}
+	for _, menu := range menus {
+		if menu.IsArchived || (req.ActiveOnly && !menu.IsActive) {
+			continue
+		}
+		if req.UpdatedSince > 0 && menu.UpdatedAt.Unix() < req.UpdatedSince {
+			continue
+		}
+		resp.Menus = append(resp.Menus, grpcMenu(menu))
+	}
+	return resp, nil
+}
+
+// GetMenu restituisce un menu completo del ristorante della API key
+func (grpcMenuService) GetMenu(ctx context.Context, req *qrmenuv1.GetMenuRequest) (*qrmenuv1.Menu, error) {
+	key, err := grpcAPIKey(ctx, models.PermMenusRead)
+	if err != nil {
+		return nil, err
+	}
+	if req.Id == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "id obbligatorio")
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	// I menu degli altri ristoranti risultano inesistenti
+	menu, err := db.MongoInstance.GetRestaurantMenu(dbCtx, req.Id, key.RestaurantID)
+	if err != nil {
+		return nil, grpcInternal(err)
+	}
+	if menu == nil {
+		return nil, status.Errorf(codes.NotFound, "menu non trovato")
+	}
+	return grpcMenu(menu), nil
+}
+
+// CreateOrder registra un ordine con le stesse regole di POST /api/v1/orders
+func (grpcOrderService) CreateOrder(ctx context.Context, req *qrmenuv1.CreateOrderRequest) (*qrmenuv1.Order, error) {
+	key, err := grpcAPIKey(ctx, models.PermOrdersManage)
+	if err != nil {
+		return nil, err
+	}
+	if req.MenuId == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "menu_id obbligatorio")
+	}
+	orderReq := orderRequest{MenuID: req.MenuId, Table: req.Table}
+	for _, line := range req.Lines {
+		orderReq.Lines = append(orderReq.Lines, orderLineRequest{
+			ItemID:   line.ItemId,
+			Quantity: int(line.Quantity),
+			Notes:    line.Notes,
+		})
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	menu, err := db.MongoInstance.GetRestaurantMenu(dbCtx, orderReq.MenuID, key.RestaurantID)
+	if err != nil {
+		return nil, grpcInternal(err)
+	}
+	if menu == nil || menu.IsArchived {
+		return nil, status.Errorf(codes.NotFound, "menu non trovato")
+	}
+	order, err := newOrder(menu, orderReq)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	order.Source = models.OrderSourceGRPC
+	order.CreatedBy = key.CreatedBy
+	if err := placeOrder(dbCtx, order); err != nil {
+		if errors.Is(err, models.ErrInsufficientStock) {
+			return nil, status.Errorf(codes.FailedPrecondition, "giacenza insufficiente per uno dei piatti ordinati")
+		}
+		if errors.Is(err, errStockConflict) {
+			return nil, status.Errorf(codes.Aborted, "%v", err)
+		}
+		return nil, grpcInternal(err)
+	}
+	return grpcOrder(order), nil
+}
+
+// GetOrder restituisce un ordine del ristorante della API key
+func (grpcOrderService) GetOrder(ctx context.Context, req *qrmenuv1.GetOrderRequest) (*qrmenuv1.Order, error) {
+	key, err := grpcAPIKey(ctx, models.PermOrdersManage)
+	if err != nil {
+		return nil, err
+	}
+	if req.Id == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "id obbligatorio")
+	}
+
+	dbCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	order, err := db.MongoInstance.GetOrder(dbCtx, req.Id, key.RestaurantID)
+	if err != nil {
+		return nil, grpcInternal(err)
+	}
+	if order == nil {
+		return nil, status.Errorf(codes.NotFound, "ordine non trovato")
+	}
+	return grpcOrder(order), nil
+}
+
+// grpcOrder converte un ordine nel messaggio qrmenu.v1.Order
+func grpcOrder(order *models.Order) *qrmenuv1.Order {
+	msg := &qrmenuv1.Order{
+		Id:        order.ID,
+		MenuId:    order.MenuID,
+		Table:     order.Table,
+		Status:    order.Status,
+		Total:     order.Total,
+		CreatedAt: unixOrZero(order.CreatedAt),
+		Number:    int32(order.Number),
+	}
+	for _, line := range order.Lines {
+		msg.Lines = append(msg.Lines, &qrmenuv1.OrderLine{
+			ItemId:   line.ItemID,
+			Quantity: int32(line.Quantity),
+			Notes:    line.Notes,
+		})
+	}
+	return msg
+}
+
+// grpcMenu converte un menu nel messaggio qrmenu.v1.Menu
+func grpcMenu(menu *models.Menu) *qrmenuv1.Menu {
+	msg := &qrmenuv1.Menu{
+		Id:           menu.ID,
+		RestaurantId: menu.RestaurantID,
+		Name:         menu.Name,
+		Description:  menu.Description,
+		MealType:     menu.MealType,
+		IsActive:     menu.IsActive,
+		CreatedAt:    unixOrZero(menu.CreatedAt),
+		UpdatedAt:    unixOrZero(menu.UpdatedAt),
+	}
+	for _, category := range menu.Categories {
+		c := &qrmenuv1.Category{
+			Id:           category.ID,
+			Name:         category.Name,
+			Description:  category.Description,
+			Translations: grpcTranslations(category.Translations),
+			DisplayOrder: int32(category.DisplayOrder),
+		}
+		for _, item := range category.Items {
+			c.Items = append(c.Items, grpcItem(item))
+		}
+		msg.Categories = append(msg.Categories, c)
+	}
+	return msg
+}
+
+// grpcItem converte un piatto nel messaggio qrmenu.v1.MenuItem
+func grpcItem(item models.MenuItem) *qrmenuv1.MenuItem {
+	return &qrmenuv1.MenuItem{
+		Id:           item.ID,
+		Name:         item.Name,
+		Description:  item.Description,
+		Price:        item.Price,
+		Available:    item.Available,
+		ImageUrl:     item.ImageURL,
+		Tags:         item.Tags,
+		Translations: grpcTranslations(item.Translations),
+		DisplayOrder: int32(item.DisplayOrder),
+	}
+}
+
+// grpcTranslations converte le traduzioni in messaggi qrmenu.v1.Translation, ordinate per lingua
+func grpcTranslations(translations map[string]models.Translation) []*qrmenuv1.Translation {
+	locales := make([]string, 0, len(translations))
+	for locale := range translations {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	msgs := make([]*qrmenuv1.Translation, 0, len(locales))
+	for _, locale := range locales {
+		msgs = append(msgs, &qrmenuv1.Translation{
+			Locale:      locale,
+			Name:        translations[locale].Name,
+			Description: translations[locale].Description,
+		})
+	}
+	return msgs
+}
+
+// unixOrZero restituisce i secondi Unix di t, 0 per l'istante zero
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -1,22 +1,23 @@
 package handlers
 
 import (
+	"bytes"
+	"cmp"
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
 	"html/template"
 	"image"
-	"image/jpeg"
-	"image/png"
+	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -25,17 +26,20 @@ import (
 	"qr-menu/db"
 	"qr-menu/logger"
 	"qr-menu/models"
+	"qr-menu/pkg/avscan"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/imaging"
+	"qr-menu/pkg/phone"
+	"qr-menu/pkg/storage"
+	"qr-menu/pkg/tenancy"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/skip2/go-qrcode"
-	"golang.org/x/image/draw"
 )
 
 var (
 	templates         *template.Template
-	menus             = make(map[string]*models.Menu) // Storage in memoria (temporaneo)
-	csrfTokens        = make(map[string]time.Time)    // CSRF protection
 	maxFileSize       = int64(5 << 20)                // 5MB max file size
 	allowedImageTypes = map[string]bool{
 		"image/jpeg": true,
@@ -51,46 +55,23 @@ func SetTemplates(t *template.Template) {
 	log.Printf("✅ Templates impostati in handlers package")
 }
 
+// TemplateFuncs restituisce le funzioni disponibili nei template
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"assetURL":         AssetURL,
+		"withRestaurant":   withRestaurant,
+		"nutritionFacts":   nutritionFacts,
+		"itemRating":       itemRating,
+		"restaurantRating": restaurantRating,
+		"stars":            stars,
+	}
+}
+
 func init() {
 	// Crea le directory necessarie se non esistono
 	createDirectories()
 	// Templates sono ora caricati da main.InitTemplates()
 	// Nota: loadMenusFromStorage() rimosso - i menu sono ora caricati direttamente da MongoDB
-	// Pulisci i token CSRF scaduti periodicamente
-	go cleanupCSRFTokens()
-}
-
-// generateCSRFToken genera un token CSRF sicuro
-func generateCSRFToken() string {
-	bytes := make([]byte, 32)
-	rand.Read(bytes)
-	token := base64.URLEncoding.EncodeToString(bytes)
-	csrfTokens[token] = time.Now().Add(1 * time.Hour)
-	return token
-}
-
-// validateCSRFToken valida un token CSRF
-func validateCSRFToken(token string) bool {
-	expiry, exists := csrfTokens[token]
-	if !exists || time.Now().After(expiry) {
-		delete(csrfTokens, token)
-		return false
-	}
-	delete(csrfTokens, token) // Usa il token una sola volta
-	return true
-}
-
-// cleanupCSRFTokens pulisce i token scaduti
-func cleanupCSRFTokens() {
-	ticker := time.NewTicker(30 * time.Minute)
-	for range ticker.C {
-		now := time.Now()
-		for token, expiry := range csrfTokens {
-			if now.After(expiry) {
-				delete(csrfTokens, token)
-			}
-		}
-	}
 }
 
 // sanitizeInput pulisce e valida l'input utente
@@ -149,6 +130,26 @@ func generateUniqueRestaurantUsername(ctx context.Context, name string) (string,
 	return "", fmt.Errorf("impossibile generare username univoco per il ristorante")
 }
 
+// createRestaurantWithUniqueUsername assegna uno username pubblico al ristorante e lo salva.
+// Se una registrazione concorrente occupa lo stesso username tra il controllo e
+// l'inserimento, l'indice unico lo segnala e si riprova con un nuovo candidato
+func createRestaurantWithUniqueUsername(ctx context.Context, restaurant *models.Restaurant) error {
+	for attempt := 0; attempt < 3; attempt++ {
+		username, err := generateUniqueRestaurantUsername(ctx, restaurant.Name)
+		if err != nil {
+			return err
+		}
+
+		restaurant.Username = username
+		err = db.MongoInstance.CreateRestaurant(ctx, restaurant)
+		if err != db.ErrDuplicateRestaurantUsername {
+			return err
+		}
+	}
+
+	return fmt.Errorf("impossibile generare username univoco per il ristorante")
+}
+
 func ensureRestaurantUsername(ctx context.Context, restaurant *models.Restaurant) (string, error) {
 	if restaurant == nil {
 		return "", fmt.Errorf("ristorante non valido")
@@ -241,8 +242,14 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Converti slice in map per compatibilità con il template
+	// (i menu archiviati sono nella pagina dell'archivio stagioni)
 	restaurantMenus := make(map[string]*models.Menu)
+	archivedCount := 0
 	for _, menu := range menusFromDB {
+		if menu.IsArchived {
+			archivedCount++
+			continue
+		}
 		restaurantMenus[menu.ID] = menu
 	}
 	
@@ -263,28 +270,76 @@ func AdminHandler(w http.ResponseWriter, r *http.Request) {
 		if menu.IsCompleted {
 			stats.CompletedCount++
 		}
-		if menu.IsActive {
+		if menu.IsActive && activeMenuID == "" {
 			activeMenuID = id
 		}
 		stats.TotalCategories += len(menu.Categories)
 	}
 
+	// Menu attivi nell'ordine di visualizzazione della pagina pubblica
+	var activeMenus []*models.Menu
+	for _, id := range restaurant.DisplayMenuIDs() {
+		if menu, ok := restaurantMenus[id]; ok {
+			activeMenus = append(activeMenus, menu)
+		}
+	}
+	if len(activeMenus) > 0 {
+		activeMenuID = activeMenus[0].ID
+	} else if activeMenuID != "" {
+		activeMenus = append(activeMenus, restaurantMenus[activeMenuID])
+	}
+
+	// Ruolo sul ristorante, per nascondere le azioni non consentite allo staff
+	session, role, _ := currentRole(r)
+
+	// Sedi dell'utente per il selettore rapido (le catene gestiscono più ristoranti)
+	var locations []models.Restaurant
+	if session != nil {
+		if locations, err = accessibleRestaurants(ctx, session.UserID); err != nil {
+			log.Printf("Errore nel recupero delle sedi: %v", err)
+		}
+	}
+
 	data := struct {
-		Restaurant   *models.Restaurant
-		Menus        map[string]*models.Menu
-		Welcome      bool
-		Success      string
-		Stats        interface{}
-		ActiveMenuID string
-		BaseURL      string
+		Restaurant       *models.Restaurant
+		Menus            map[string]*models.Menu
+		Welcome          bool
+		Success          string
+		Stats            interface{}
+		ActiveMenuID     string
+		ActiveMenus      []*models.Menu
+		Archived         int
+		BaseURL          string
+		Role             string
+		RoleLabel        string
+		CanEditMenus     bool
+		CanViewAnalytics bool
+		CanManageStaff   bool
+		CanManageOrders  bool
+		CanModerate      bool
+		CanViewBilling   bool
+		Locations        []models.Restaurant
+		CSRFToken        string
 	}{
-		Restaurant:   restaurant,
-		Menus:        restaurantMenus,
-		Welcome:      welcome == "1",
-		Success:      success,
-		Stats:        stats,
-		ActiveMenuID: activeMenuID,
-		BaseURL:      getBaseURL(r),
+		Restaurant:       restaurant,
+		Menus:            restaurantMenus,
+		Welcome:          welcome == "1",
+		Success:          success,
+		Stats:            stats,
+		ActiveMenuID:     activeMenuID,
+		ActiveMenus:      activeMenus,
+		Archived:         archivedCount,
+		BaseURL:          getBaseURL(r),
+		Role:             role,
+		RoleLabel:        models.RoleLabel(role),
+		CanEditMenus:     models.RoleHasPermission(role, models.PermMenusWrite),
+		CanViewAnalytics: models.RoleHasPermission(role, models.PermAnalyticsRead),
+		CanManageStaff:   models.RoleHasPermission(role, models.PermStaffManage),
+		CanManageOrders:  models.RoleHasPermission(role, models.PermOrdersManage),
+		CanModerate:      models.RoleHasPermission(role, models.PermFeedbackModerate),
+		CanViewBilling:   models.RoleHasPermission(role, models.PermBillingRead),
+		Locations:        locations,
+		CSRFToken:        csrfToken(w, r),
 	}
 	
 	log.Printf("✅ AdminHandler: Rendering template 'admin' con %d menu, ActiveMenuID=%s", len(data.Menus), data.ActiveMenuID)
@@ -302,11 +357,11 @@ func SelectRestaurantHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// Recupera tutti i ristoranti dell'utente
+	// Recupera tutti i ristoranti dell'utente, compresi quelli in cui fa parte dello staff
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	
-	restaurants, err := db.MongoInstance.GetRestaurantsByOwnerID(ctx, session.UserID)
+	restaurants, err := accessibleRestaurants(ctx, session.UserID)
 	if err != nil {
 		log.Printf("Errore nel recupero ristoranti: %v", err)
 		http.Error(w, "Errore nel recupero dei ristoranti", http.StatusInternalServerError)
@@ -326,9 +381,11 @@ func SelectRestaurantHandler(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Restaurants     []models.Restaurant
 		RestaurantCount int
+		CSRFToken       string
 	}{
 		Restaurants:     restaurants,
 		RestaurantCount: len(restaurants),
+		CSRFToken:       csrfToken(w, r),
 	}
 	
 	renderTemplate(w, "select_restaurant", data)
@@ -362,7 +419,7 @@ func SelectRestaurantPostHandler(w http.ResponseWriter, r *http.Request) {
 	
 	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, restaurantID)
 	if err != nil {
-		logger.Error("Errore nel recupero del ristorante", map[string]interface{}{
+		logger.ErrorCtx(r.Context(), "Errore nel recupero del ristorante", map[string]interface{}{
 			"error":         err.Error(),
 			"restaurant_id": restaurantID,
 			"user_id":       session.UserID,
@@ -372,7 +429,7 @@ func SelectRestaurantPostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if restaurant == nil {
-		logger.Warn("Ristorante non trovato", map[string]interface{}{
+		logger.WarnCtx(r.Context(), "Ristorante non trovato", map[string]interface{}{
 			"restaurant_id": restaurantID,
 			"user_id":       session.UserID,
 		})
@@ -380,16 +437,28 @@ func SelectRestaurantPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	logger.Debug("Verifica ownership ristorante", map[string]interface{}{
+	// Il ristorante deve appartenere all'utente o averlo nello staff
+	role, err := restaurantRole(ctx, restaurant, session.UserID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella verifica del ruolo", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurantID,
+			"user_id":       session.UserID,
+		})
+		http.Error(w, "Errore nel recupero del ristorante", http.StatusInternalServerError)
+		return
+	}
+
+	logger.DebugCtx(r.Context(), "Verifica accesso ristorante", map[string]interface{}{
 		"restaurant_id":      restaurantID,
 		"restaurant_name":    restaurant.Name,
 		"restaurant_ownerid": restaurant.OwnerID,
 		"session_userid":     session.UserID,
-		"match":              restaurant.OwnerID == session.UserID,
+		"role":               role,
 	})
 	
-	if restaurant.OwnerID != session.UserID {
-		logger.Warn("Tentativo di accesso non autorizzato al ristorante", map[string]interface{}{
+	if role == "" {
+		logger.WarnCtx(r.Context(), "Tentativo di accesso non autorizzato al ristorante", map[string]interface{}{
 			"restaurant_id":      restaurantID,
 			"restaurant_ownerid": restaurant.OwnerID,
 			"user_id":            session.UserID,
@@ -430,7 +499,10 @@ func AddRestaurantHandler(w http.ResponseWriter, r *http.Request) {
 			Address     string
 			Phone       string
 		}
-	}{}
+		CSRFToken string
+	}{
+		CSRFToken: csrfToken(w, r),
+	}
 	
 	renderTemplate(w, "add_restaurant", data)
 }
@@ -489,8 +561,10 @@ func AddRestaurantPostHandler(w http.ResponseWriter, r *http.Request) {
 				Address     string
 				Phone       string
 			}
+			CSRFToken string
 		}{
-			Errors: errors,
+			Errors:    errors,
+			CSRFToken: csrfToken(w, r),
 		}
 		data.FormData.Name = name
 		data.FormData.Description = description
@@ -505,34 +579,8 @@ func AddRestaurantPostHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	restaurantUsername, err := generateUniqueRestaurantUsername(ctx, name)
-	if err != nil {
-		log.Printf("Errore nella generazione username ristorante: %v", err)
-		errors = append(errors, "Errore durante la creazione del ristorante. Riprova.")
-
-		data := struct {
-			Errors   []string
-			FormData struct {
-				Name        string
-				Description string
-				Address     string
-				Phone       string
-			}
-		}{
-			Errors: errors,
-		}
-		data.FormData.Name = name
-		data.FormData.Description = description
-		data.FormData.Address = address
-		data.FormData.Phone = phone
-
-		renderTemplate(w, "add_restaurant", data)
-		return
-	}
-	
 	restaurant := &models.Restaurant{
 		ID:          uuid.New().String(),
-		Username:    restaurantUsername,
 		OwnerID:     session.UserID, // ⭐ Collega al user loggato
 		Name:        name,
 		Description: description,
@@ -542,7 +590,7 @@ func AddRestaurantPostHandler(w http.ResponseWriter, r *http.Request) {
 		IsActive:    true,
 	}
 	
-	if err := db.MongoInstance.CreateRestaurant(ctx, restaurant); err != nil {
+	if err := createRestaurantWithUniqueUsername(ctx, restaurant); err != nil {
 		log.Printf("Errore nella creazione del ristorante: %v", err)
 		errors = append(errors, "Errore durante la creazione del ristorante. Riprova.")
 		
@@ -554,8 +602,10 @@ func AddRestaurantPostHandler(w http.ResponseWriter, r *http.Request) {
 				Address     string
 				Phone       string
 			}
+			CSRFToken string
 		}{
-			Errors: errors,
+			Errors:    errors,
+			CSRFToken: csrfToken(w, r),
 		}
 		data.FormData.Name = name
 		data.FormData.Description = description
@@ -598,7 +648,12 @@ func updateSessionInMemory(session *models.Session) {
 // CreateMenuHandler mostra il form per creare un nuovo menu
 func CreateMenuHandler(w http.ResponseWriter, r *http.Request) {
 	setSecurityHeaders(w)
-	renderTemplate(w, "create_menu", nil)
+	data := struct {
+		CSRFToken string
+	}{
+		CSRFToken: csrfToken(w, r),
+	}
+	renderTemplate(w, "create_menu", data)
 }
 
 // CreateMenuPostHandler gestisce la creazione di un nuovo menu
@@ -691,6 +746,7 @@ func CreateMenuPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	publishMenuEvent(r, events.MenuCreated, menu)
 	http.Redirect(w, r, fmt.Sprintf("/admin/menu/%s", menu.ID), http.StatusFound)
 }
 
@@ -709,8 +765,8 @@ func EditMenuHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil || menu.RestaurantID != restaurant.ID {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil {
 		// Usa il template 404 personalizzato per menu non trovati
 		data := struct {
 			Title   string
@@ -723,6 +779,9 @@ func EditMenuHandler(w http.ResponseWriter, r *http.Request) {
 		renderTemplate(w, "404", data)
 		return
 	}
+	if rejectArchivedMenu(w, r, menu) {
+		return
+	}
 
 	// Genera URL pubblico se non esiste
 	if menu.PublicURL == "" {
@@ -736,9 +795,11 @@ func EditMenuHandler(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Menu       *models.Menu
 		Restaurant *models.Restaurant
+		CSRFToken  string
 	}{
 		Menu:       menu,
 		Restaurant: restaurant,
+		CSRFToken:  csrfToken(w, r),
 	}
 
 	renderTemplate(w, "edit_menu", data)
@@ -746,23 +807,20 @@ func EditMenuHandler(w http.ResponseWriter, r *http.Request) {
 
 // UpdateMenuHandler aggiorna un menu esistente
 func UpdateMenuHandler(w http.ResponseWriter, r *http.Request) {
-	// Verifica autenticazione
-	restaurant, err := getCurrentRestaurant(r)
-	if handleAuthError(w, r, err) {
-		return
-	}
-
 	vars := mux.Vars(r)
 	menuID := vars["id"]
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil || menu.RestaurantID != restaurant.ID {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil {
 		http.NotFound(w, r)
 		return
 	}
+	if rejectArchivedMenu(w, r, menu) {
+		return
+	}
 
 	if err := r.ParseForm(); err != nil {
 		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
@@ -781,6 +839,7 @@ func UpdateMenuHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	publishMenuEvent(r, events.MenuUpdated, menu)
 	http.Redirect(w, r, fmt.Sprintf("/admin/menu/%s", menu.ID), http.StatusFound)
 }
 
@@ -798,50 +857,48 @@ func CompleteMenuHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil || menu.RestaurantID != restaurant.ID {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil {
 		http.NotFound(w, r)
 		return
 	}
+	if rejectArchivedMenu(w, r, menu) {
+		return
+	}
 
-	username, err := ensureRestaurantUsername(ctx, restaurant)
-	if err != nil {
-		log.Printf("Errore nella gestione username ristorante: %v", err)
+	if err := completeMenu(ctx, restaurant, menu, getBaseURL(r)); err != nil {
+		log.Printf("Errore nel completamento del menu: %v", err)
 		http.Error(w, "Errore nella generazione del QR code", http.StatusInternalServerError)
 		return
 	}
 
-	// Genera l'URL pubblico del ristorante (non del menu specifico)
-	// Il QR code punta al ristorante, che mostrerà sempre il menu attivo
-	baseURL := getBaseURL(r)
-	restaurantURL := fmt.Sprintf("%s/r/%s", baseURL, username)
+	publishMenuEvent(r, events.MenuUpdated, menu)
 
-	// Genera il QR code che punta al ristorante (permanente)
-	qrCodePath := fmt.Sprintf("static/qrcodes/restaurant_%s.png", restaurant.ID)
-	err = qrcode.WriteFile(restaurantURL, qrcode.Medium, 256, qrCodePath)
+	// Redirect all'admin con messaggio di successo
+	http.Redirect(w, r, "/admin?success=menu_completed", http.StatusFound)
+}
+
+// completeMenu marca il menu come completato e genera il QR code del ristorante.
+// Il QR code punta al ristorante (non al menu specifico), che mostrerà sempre il menu attivo
+func completeMenu(ctx context.Context, restaurant *models.Restaurant, menu *models.Menu, baseURL string) error {
+	if _, err := ensureRestaurantUsername(ctx, restaurant); err != nil {
+		return fmt.Errorf("errore username ristorante: %v", err)
+	}
+
+	restaurantURL := restaurantPublicURL(baseURL, restaurant)
+	qrCodePath, err := saveRestaurantQRCode(ctx, restaurant.ID, restaurantURL)
 	if err != nil {
-		http.Error(w, "Errore nella generazione del QR code", http.StatusInternalServerError)
-		return
+		return fmt.Errorf("errore generazione QR code: %v", err)
 	}
 
-	// Aggiorna il menu
 	menu.IsCompleted = true
 	menu.QRCodePath = qrCodePath
 	menu.PublicURL = restaurantURL // URL del ristorante, non del menu specifico
 	menu.UpdatedAt = time.Now()
-
-	// Salva le modifiche in MongoDB
-	if err := db.MongoInstance.UpdateMenu(ctx, menu); err != nil {
-		log.Printf("Errore nell'aggiornamento del menu: %v", err)
-		http.Error(w, "Errore nell'aggiornamento del menu", http.StatusInternalServerError)
-		return
-	}
-
-	// Redirect all'admin con messaggio di successo
-	http.Redirect(w, r, "/admin?success=menu_completed", http.StatusFound)
+	return db.MongoInstance.UpdateMenu(ctx, menu)
 }
 
-// DeleteMenuHandler elimina un menu
+// DeleteMenuHandler sposta un menu nel cestino, da cui si può ripristinare per 30 giorni
 func DeleteMenuHandler(w http.ResponseWriter, r *http.Request) {
 	// Verifica autenticazione
 	restaurant, err := getCurrentRestaurant(r)
@@ -855,27 +912,13 @@ func DeleteMenuHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil || menu.RestaurantID != restaurant.ID {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil {
 		http.NotFound(w, r)
 		return
 	}
 
-	// Se era il menu attivo, rimuovi il riferimento
-	if restaurant.ActiveMenuID == menuID {
-		restaurant.ActiveMenuID = ""
-		if err := db.MongoInstance.UpdateRestaurant(ctx, restaurant); err != nil {
-			log.Printf("Errore nell'aggiornamento ristorante: %v", err)
-		}
-	}
-
-	// Elimina il file QR se esiste
-	if menu.QRCodePath != "" {
-		os.Remove(menu.QRCodePath)
-	}
-
-	// Elimina il menu da MongoDB
-	if err := db.MongoInstance.DeleteMenu(ctx, menuID); err != nil {
+	if err := deleteMenu(ctx, restaurant, menu); err != nil {
 		log.Printf("Errore nell'eliminazione del menu: %v", err)
 		http.Error(w, "Errore nell'eliminazione del menu", http.StatusInternalServerError)
 		return
@@ -884,6 +927,21 @@ func DeleteMenuHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/admin?success=menu_deleted", http.StatusFound)
 }
 
+// deleteMenu sposta il menu nel cestino, togliendolo da quelli attivi del ristorante.
+// QR code e dati vengono eliminati da PurgeMenuTrash alla scadenza del cestino
+func deleteMenu(ctx context.Context, restaurant *models.Restaurant, menu *models.Menu) error {
+	// Se era tra i menu attivi, rimuovi il riferimento
+	if active := restaurant.DisplayMenuIDs(); containsMenuID(active, menu.ID) {
+		if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, removeMenuID(active, menu.ID)); err != nil {
+			log.Printf("Errore nell'aggiornamento ristorante: %v", err)
+		}
+	}
+
+	menu.DeletedAt = time.Now()
+	menu.IsActive = false
+	return db.MongoInstance.SoftDeleteMenu(ctx, menu.ID, menu.DeletedAt)
+}
+
 // SetActiveMenuHandler imposta un menu come attivo
 func SetActiveMenuHandler(w http.ResponseWriter, r *http.Request) {
 	// Verifica autenticazione
@@ -898,43 +956,23 @@ func SetActiveMenuHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil || menu.RestaurantID != restaurant.ID || !menu.IsCompleted {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil || !menu.IsCompleted {
 		http.NotFound(w, r)
 		return
 	}
-
-	// Disattiva tutti i menu del ristorante
-	allMenus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurant.ID)
-	if err != nil {
-		log.Printf("Errore nel recupero menu: %v", err)
-		http.Error(w, "Errore nell'operazione", http.StatusInternalServerError)
+	if rejectArchivedMenu(w, r, menu) {
 		return
 	}
 
-	for _, m := range allMenus {
-		if m.IsActive {
-			m.IsActive = false
-			if err := db.MongoInstance.UpdateMenu(ctx, m); err != nil {
-				log.Printf("Errore nell'aggiornamento menu: %v", err)
-			}
-		}
-	}
-
-	// Attiva il menu selezionato
-	menu.IsActive = true
-	if err := db.MongoInstance.UpdateMenu(ctx, menu); err != nil {
+	// Il menu diventa l'unico attivo: per affiancarne altri si usa /admin/menu/{id}/display
+	if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, []string{menu.ID}); err != nil {
 		log.Printf("Errore nell'attivazione del menu: %v", err)
 		http.Error(w, "Errore nell'attivazione del menu", http.StatusInternalServerError)
 		return
 	}
 
-	// Aggiorna il ristorante
-	restaurant.ActiveMenuID = menuID
-	if err := db.MongoInstance.UpdateRestaurant(ctx, restaurant); err != nil {
-		log.Printf("Errore nell'aggiornamento ristorante: %v", err)
-	}
-
+	publishMenuEvent(r, events.MenuActivated, menu)
 	http.Redirect(w, r, "/admin?success=menu_activated", http.StatusFound)
 }
 
@@ -948,27 +986,78 @@ func GetActiveMenuHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Trova il ristorante per username da MongoDB
 	restaurant, err := db.MongoInstance.GetRestaurantByUsername(ctx, restaurantUsername)
-	if err != nil || restaurant == nil || !restaurant.IsActive {
+	if err != nil {
+		// Database non disponibile: usa il menu attivo registrato nell'ultimo snapshot
+		if menuID := snapshotMenuIDForUsername(restaurantUsername); menuID != "" {
+			if strings.HasPrefix(menuID, restaurantSnapshotPrefix) && serveMenuSnapshot(w, menuID) {
+				return
+			}
+			http.Redirect(w, r, fmt.Sprintf("/menu/%s", menuID), http.StatusFound)
+			return
+		}
+	}
+	if err == nil && restaurant == nil {
+		// Username cambiato: reindirizza permanentemente al nuovo URL
+		previous, err := db.MongoInstance.GetRestaurantByPreviousUsername(ctx, restaurantUsername)
+		if err == nil && previous != nil && previous.IsActive {
+			http.Redirect(w, r, fmt.Sprintf("/r/%s", previous.Username), http.StatusMovedPermanently)
+			return
+		}
+	}
+	if err != nil || restaurant == nil {
 		http.NotFound(w, r)
 		return
 	}
+	if !restaurant.IsActive {
+		// Account chiuso: i QR code già stampati mostrano una pagina esplicativa
+		renderRestaurantUnavailable(w)
+		return
+	}
 
 	// Track della scansione QR code
-	go func() {
-		userAgent := r.Header.Get("User-Agent")
-		clientIP := getClientIP(r)
-		event := analytics.QRScanEvent{
-			RestaurantID: restaurant.ID,
-			MenuID:       restaurant.ActiveMenuID,
-			Timestamp:    time.Now(),
-			UserIP:       clientIP,
-			UserAgent:    userAgent,
+	meterUsage(restaurant.ID, models.UsageQRScans)
+	publishQRScan(r, restaurant)
+
+	serveActiveMenus(ctx, w, r, restaurant)
+}
+
+// serveActiveMenus mostra i menu attivi del ristorante: la pagina con una scheda per menu se
+// sono più di uno, altrimenti il redirect al menu attivo
+func serveActiveMenus(ctx context.Context, w http.ResponseWriter, r *http.Request, restaurant *models.Restaurant) {
+	// Più menu attivi (es. cibo + bevande): pagina unica con una scheda per menu
+	if len(restaurant.DisplayMenuIDs()) > 1 {
+		menus, err := loadDisplayMenus(ctx, restaurant)
+		if err != nil {
+			log.Printf("Errore nel caricamento dei menu attivi di %s: %v", restaurant.Username, err)
+			if serveMenuSnapshot(w, restaurantSnapshotKey(restaurant.Username)) {
+				return
+			}
+			http.Error(w, "Menu temporaneamente non disponibile, riprova tra poco", http.StatusServiceUnavailable)
+			return
 		}
-		analytics.GetAnalytics().TrackQRScan(event)
-	}()
+		if len(menus) > 1 {
+			setSecurityHeaders(w)
+			html, err := executeTemplate("public_menus", publicMenuData{Menus: menus, Restaurant: restaurant})
+			if err != nil {
+				log.Printf("Errore nel rendering dei menu attivi di %s: %v", restaurant.Username, err)
+				if serveMenuSnapshot(w, restaurantSnapshotKey(restaurant.Username)) {
+					return
+				}
+				http.Error(w, "Errore nella visualizzazione del menu", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(html)
+			return
+		}
+		if len(menus) == 1 {
+			http.Redirect(w, r, menuRedirectPath(r, menus[0].ID), http.StatusFound)
+			return
+		}
+	}
 
 	// Redirect al menu attivo
-	http.Redirect(w, r, fmt.Sprintf("/menu/%s", restaurant.ActiveMenuID), http.StatusFound)
+	http.Redirect(w, r, menuRedirectPath(r, restaurant.ActiveMenuID), http.StatusFound)
 }
 
 // PublicMenuHandler mostra il menu pubblico
@@ -977,12 +1066,25 @@ func PublicMenuHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	menuID := vars["id"]
 
+	if servePublicMenuFromCache(w, r, menuID) {
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
 	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil {
-		// Usa il template 404 personalizzato
+	if err != nil {
+		// Database non disponibile: serve l'ultima copia statica del menu, se presente
+		log.Printf("Errore nel caricamento del menu pubblico %s: %v", menuID, err)
+		if serveMenuSnapshot(w, menuID) {
+			return
+		}
+		http.Error(w, "Menu temporaneamente non disponibile, riprova tra poco", http.StatusServiceUnavailable)
+		return
+	}
+	if menu == nil || menu.IsArchived {
+		// Usa il template 404 personalizzato (i menu archiviati non sono più pubblici)
 		data := struct {
 			Title   string
 			Message string
@@ -990,57 +1092,173 @@ func PublicMenuHandler(w http.ResponseWriter, r *http.Request) {
 			Title:   "Menu Non Trovato",
 			Message: "Il menu che stai cercando non esiste più o è stato rimosso dal ristorante.",
 		}
+		w.Header().Set("Cache-Control", "no-cache")
 		w.WriteHeader(http.StatusNotFound)
 		renderTemplate(w, "404", data)
 		return
 	}
 
-	// Track della visualizzazione del menu
+	// Ottieni i dati del ristorante da MongoDB
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, menu.RestaurantID)
+
+	// Track della visualizzazione del menu. Se il ristorante non è disponibile non si sa se
+	// ha le analytics privacy-first: si contano solo le viste
+	trackMenuView(w, r, menu.RestaurantID, menuID, restaurant == nil || restaurant.PrivacyFirstAnalytics)
+	if err == nil && restaurant != nil && !restaurant.IsActive {
+		renderRestaurantUnavailable(w)
+		return
+	}
+	if err != nil || restaurant == nil {
+		log.Printf("Ristorante non trovato per menu pubblico: %s", menu.RestaurantID)
+		// Continua anche se non troviamo il ristorante
+		restaurant = &models.Restaurant{
+			ID:   menu.RestaurantID,
+			Name: "Ristorante",
+		}
+	}
+
+	// Revalidazione per browser e CDN: 304 se il menu non è cambiato
+	if checkNotModified(w, r, menuETag(menu, restaurant), menu.UpdatedAt) {
+		return
+	}
+
+	html, err := executeTemplate("public_menu", publicMenuData{Menu: menu, Restaurant: restaurant})
+	if err != nil {
+		log.Printf("Errore nel rendering del menu pubblico %s: %v", menuID, err)
+		if serveMenuSnapshot(w, menuID) {
+			return
+		}
+		renderTemplate(w, "public_menu", publicMenuData{Menu: menu, Restaurant: restaurant})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(html)
+}
+
+// trackMenuView registra in background la visualizzazione di un menu pubblico, con i
+// parametri UTM dell'indirizzo. Senza il consenso del visitatore (vedi trackingAllowed) si
+// contano solo le viste e le campagne
+func trackMenuView(w http.ResponseWriter, r *http.Request, restaurantID, menuID string, privacyFirst bool) {
+	meterUsage(restaurantID, models.UsageMenuViews)
+	query := r.URL.Query()
+	if !trackingAllowed(r, privacyFirst) {
+		go analytics.GetAnalytics().TrackView(analytics.ViewEvent{
+			RestaurantID:  restaurantID,
+			MenuID:        menuID,
+			Timestamp:     time.Now(),
+			UTMSource:     query.Get("utm_source"),
+			UTMMedium:     query.Get("utm_medium"),
+			UTMCampaign:   query.Get("utm_campaign"),
+			AggregateOnly: true,
+		})
+		return
+	}
+
+	visitorID := ensureVisitorCookie(w, r)
 	go func() {
 		userAgent := r.Header.Get("User-Agent")
 		clientIP := getClientIP(r)
 		event := analytics.ViewEvent{
-			RestaurantID: menu.RestaurantID,
+			RestaurantID: restaurantID,
 			MenuID:       menuID,
 			Timestamp:    time.Now(),
 			UserIP:       clientIP,
 			UserAgent:    userAgent,
 			Referrer:     r.Header.Get("Referer"),
+			VisitorID:    visitorID,
+			UTMSource:    query.Get("utm_source"),
+			UTMMedium:    query.Get("utm_medium"),
+			UTMCampaign:  query.Get("utm_campaign"),
 		}
 		analytics.GetAnalytics().TrackView(event)
 	}()
+}
 
-	// Ottieni i dati del ristorante da MongoDB
-	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, menu.RestaurantID)
-	if err != nil || restaurant == nil {
-		log.Printf("Ristorante non trovato per menu pubblico: %s", menu.RestaurantID)
-		// Continua anche se non troviamo il ristorante
-		restaurant = &models.Restaurant{
-			ID:   menu.RestaurantID,
-			Name: "Ristorante",
+// API Handlers
+
+// menusQuery descrive paginazione, ordinamento e filtri dei menu
+var menusQuery = httputil.ListOptions{
+	DefaultPerPage: 20,
+	MaxPerPage:     100,
+	DefaultSort:    "-created_at",
+	Sortable:       []string{"name", "created_at", "updated_at"},
+	Filterable:     []string{"active", "completed", "archived", "meal_type", "season"},
+}
+
+// menuSort confronta i menu per i campi ordinabili di menusQuery
+var menuSort = map[string]func(a, b *models.Menu) int{
+	"name":       func(a, b *models.Menu) int { return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) },
+	"created_at": func(a, b *models.Menu) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"updated_at": func(a, b *models.Menu) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+}
+
+// GetMenusHandler restituisce i menu del ristorante autenticato
+// (GET /api/menus?filter[active]=&filter[completed]=&filter[archived]=&filter[meal_type]=
+// &filter[season]=&page=&per_page=&sort=)
+func GetMenusHandler(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := tenancy.RestaurantID(r.Context())
+	if !ok {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+	query, err := httputil.ParseListQuery(r, menusQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	flags := make(map[string]bool, 3) // Filtri true/false impostati nella richiesta
+	for _, field := range []string{"active", "completed", "archived"} {
+		value, set, err := query.BoolFilter(field)
+		if err != nil {
+			httputil.BadRequest(w, err.Error())
+			return
+		}
+		if set {
+			flags[field] = value
 		}
 	}
 
-	data := struct {
-		Menu       *models.Menu
-		Restaurant *models.Restaurant
-	}{
-		Menu:       menu,
-		Restaurant: restaurant,
-	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
-	renderTemplate(w, "public_menu", data)
-}
+	restaurantMenus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurantID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero dei menu", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurantID,
+		})
+		httputil.InternalServerError(w, "Errore nel recupero dei menu")
+		return
+	}
 
-// API Handlers
+	matching := make([]*models.Menu, 0, len(restaurantMenus))
+	for _, menu := range restaurantMenus {
+		if value, set := flags["active"]; set && menu.IsActive != value {
+			continue
+		}
+		if value, set := flags["completed"]; set && menu.IsCompleted != value {
+			continue
+		}
+		if value, set := flags["archived"]; set && menu.IsArchived != value {
+			continue
+		}
+		if mealType := query.Filter("meal_type"); mealType != "" && menu.MealType != mealType {
+			continue
+		}
+		if season := query.Filter("season"); season != "" && menu.Season != season {
+			continue
+		}
+		matching = append(matching, menu)
+	}
+	httputil.SortSlice(matching, query, menuSort)
 
-// GetMenusHandler restituisce tutti i menu in formato JSON
-func GetMenusHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(menus)
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, httputil.PageOf(matching, query), query, int64(len(matching)))
 }
 
-// GetMenuHandler restituisce un singolo menu in formato JSON
+// GetMenuHandler restituisce in formato JSON un menu del ristorante autenticato; i menu
+// degli altri ristoranti risultano inesistenti
 func GetMenuHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	menuID := vars["id"]
@@ -1048,16 +1266,107 @@ func GetMenuHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil {
-		http.Error(w, "Menu non trovato", http.StatusNotFound)
+	menu, err := tenantMenu(ctx, menuID)
+	if err == tenancy.ErrNoScope {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero del menu", map[string]interface{}{
+			"error":   err.Error(),
+			"menu_id": menuID,
+		})
+		httputil.InternalServerError(w, "Errore nel recupero del menu")
+		return
+	}
+	if menu == nil {
+		httputil.NotFound(w, "Menu")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
 	json.NewEncoder(w).Encode(menu)
 }
 
+// menuItemsQuery descrive paginazione, ordinamento e filtri dei piatti di un menu. Senza
+// sort i piatti restano nell'ordine del menu
+var menuItemsQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     500,
+	Sortable:       []string{"name", "price"},
+	Filterable:     []string{"category_id", "available", "tag"},
+}
+
+// menuItemSort confronta i piatti per i campi ordinabili di menuItemsQuery
+var menuItemSort = map[string]func(a, b menuItemResponse) int{
+	"name":  func(a, b menuItemResponse) int { return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) },
+	"price": func(a, b menuItemResponse) int { return cmp.Compare(a.Price, b.Price) },
+}
+
+// menuItemResponse è un piatto restituito dall'API, con la categoria a cui appartiene
+type menuItemResponse struct {
+	models.MenuItem
+	CategoryID   string `json:"category_id"`
+	CategoryName string `json:"category_name"`
+}
+
+// GetMenuItemsHandler restituisce i piatti di un menu del ristorante autenticato
+// (GET /api/menu/{id}/items?filter[category_id]=&filter[available]=&filter[tag]=&page=&per_page=&sort=)
+func GetMenuItemsHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := tenancy.RestaurantID(r.Context()); !ok {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+	query, err := httputil.ParseListQuery(r, menuItemsQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	available, filterAvailable, err := query.BoolFilter("available")
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, err := tenantMenu(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero del menu", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nel recupero del menu")
+		return
+	}
+	if menu == nil {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+
+	categoryID, tag := query.Filter("category_id"), query.Filter("tag")
+	matching := make([]menuItemResponse, 0)
+	for _, category := range menu.Categories {
+		if categoryID != "" && category.ID != categoryID {
+			continue
+		}
+		for _, item := range category.Items {
+			if filterAvailable && item.Available != available {
+				continue
+			}
+			if tag != "" && !slices.Contains(item.Tags, tag) {
+				continue
+			}
+			matching = append(matching, menuItemResponse{MenuItem: item, CategoryID: category.ID, CategoryName: category.Name})
+		}
+	}
+	httputil.SortSlice(matching, query, menuItemSort)
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, httputil.PageOf(matching, query), query, int64(len(matching)))
+}
+
 // CreateMenuAPIHandler crea un nuovo menu tramite API JSON
 func CreateMenuAPIHandler(w http.ResponseWriter, r *http.Request) {
 	// Verifica autenticazione per API
@@ -1098,6 +1407,7 @@ func CreateMenuAPIHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	publishMenuEvent(r, events.MenuCreated, menu)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(menu)
@@ -1124,8 +1434,8 @@ func GenerateQRHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil || menu.RestaurantID != restaurant.ID {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil {
 		response := models.QRCodeResponse{
 			Success: false,
 			Message: "Menu non trovato",
@@ -1136,7 +1446,7 @@ func GenerateQRHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	username, err := ensureRestaurantUsername(ctx, restaurant)
+	_, err = ensureRestaurantUsername(ctx, restaurant)
 	if err != nil {
 		response := models.QRCodeResponse{
 			Success: false,
@@ -1150,11 +1460,10 @@ func GenerateQRHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Genera l'URL pubblico del ristorante (permanente)
 	baseURL := getBaseURL(r)
-	restaurantURL := fmt.Sprintf("%s/r/%s", baseURL, username)
+	restaurantURL := restaurantPublicURL(baseURL, restaurant)
 
 	// Genera il QR code del ristorante
-	qrCodePath := fmt.Sprintf("static/qrcodes/restaurant_%s.png", restaurant.ID)
-	err = qrcode.WriteFile(restaurantURL, qrcode.Medium, 256, qrCodePath)
+	qrCodePath, err := saveRestaurantQRCode(ctx, restaurant.ID, restaurantURL)
 	if err != nil {
 		response := models.QRCodeResponse{
 			Success: false,
@@ -1247,66 +1556,8 @@ func renderFallbackTemplate(w http.ResponseWriter, tmpl string, data interface{}
 	}
 }
 
-func getBaseURL(r *http.Request) string {
-	scheme := "http"
-	if r.TLS != nil {
-		scheme = "https"
-	}
-	return fmt.Sprintf("%s://%s", scheme, r.Host)
-}
-
-func saveMenuToStorage(menu *models.Menu) {
-	filename := filepath.Join("storage", fmt.Sprintf("menu_%s.json", menu.ID))
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Printf("Errore nella creazione del file %s: %v", filename, err)
-		return
-	}
-	defer file.Close()
-
-	json.NewEncoder(file).Encode(menu)
-}
-
-func deleteMenuFromStorage(menuID string) {
-	filename := filepath.Join("storage", fmt.Sprintf("menu_%s.json", menuID))
-	os.Remove(filename)
-}
-
-func loadMenusFromStorage() {
-	files, err := filepath.Glob("storage/menu_*.json")
-	if err != nil {
-		log.Printf("Errore nella lettura dei file di storage: %v", err)
-		return
-	}
-
-	for _, filename := range files {
-		file, err := os.Open(filename)
-		if err != nil {
-			log.Printf("Errore nell'apertura del file %s: %v", filename, err)
-			continue
-		}
-
-		var menu models.Menu
-		if err := json.NewDecoder(file).Decode(&menu); err != nil {
-			log.Printf("Errore nel decode del menu da %s: %v", filename, err)
-			file.Close()
-			continue
-		}
-
-		menus[menu.ID] = &menu
-		file.Close()
-	}
-}
-
 // DuplicateItemHandler duplica un piatto esistente
 func DuplicateItemHandler(w http.ResponseWriter, r *http.Request) {
-	// Verifica autenticazione
-	restaurant, err := getCurrentRestaurant(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
 	vars := mux.Vars(r)
 	menuID := vars["menuId"]
 	categoryID := vars["categoryId"]
@@ -1315,11 +1566,14 @@ func DuplicateItemHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil || menu.RestaurantID != restaurant.ID {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil {
 		http.NotFound(w, r)
 		return
 	}
+	if rejectArchivedMenu(w, r, menu) {
+		return
+	}
 
 	// Trova la categoria e il piatto
 	var targetCategory *models.MenuCategory
@@ -1344,15 +1598,7 @@ func DuplicateItemHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Crea una copia del piatto
-	duplicatedItem := models.MenuItem{
-		ID:          uuid.New().String(),
-		Name:        fmt.Sprintf("%s (Copia)", targetItem.Name),
-		Description: targetItem.Description,
-		Price:       targetItem.Price,
-		Category:    targetItem.Category,
-		Available:   true, // Assicura che il piatto duplicato sia disponibile
-		ImageURL:    targetItem.ImageURL,
-	}
+	duplicatedItem := duplicateMenuItem(*targetItem)
 
 	// Aggiungi il piatto duplicato alla categoria
 	targetCategory.Items = append(targetCategory.Items, duplicatedItem)
@@ -1368,46 +1614,77 @@ func DuplicateItemHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	publishItemEvent(r, menu, &duplicatedItem, "created")
+
 	// Redirect back to edit menu
 	http.Redirect(w, r, fmt.Sprintf("/admin/menu/%s", menuID), http.StatusSeeOther)
 }
 
-// DuplicateMenuHandler duplica un menu completo
-func DuplicateMenuHandler(w http.ResponseWriter, r *http.Request) {
-	// Verifica autenticazione
-	restaurant, err := getCurrentRestaurant(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
+// duplicateMenuItem crea la copia disponibile di un piatto, con un nuovo ID
+func duplicateMenuItem(item models.MenuItem) models.MenuItem {
+	return models.MenuItem{
+		ID:          uuid.New().String(),
+		Name:        fmt.Sprintf("%s (Copia)", item.Name),
+		Description: item.Description,
+		Price:       item.Price,
+		Category:    item.Category,
+		Available:   true, // Assicura che il piatto duplicato sia disponibile
+		ImageURL:    item.ImageURL,
+
+		ImageID:       item.ImageID,
+		ImageVariants: item.ImageVariants,
 	}
+}
 
+// DuplicateMenuHandler duplica un menu completo
+func DuplicateMenuHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	menuID := vars["id"]
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	originalMenu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || originalMenu == nil || originalMenu.RestaurantID != restaurant.ID {
+	originalMenu, err := tenantMenu(ctx, menuID)
+	if err != nil || originalMenu == nil {
 		http.NotFound(w, r)
 		return
 	}
 
 	// Crea una copia del menu
-	duplicatedMenu := &models.Menu{
+	duplicatedMenu := duplicateMenu(originalMenu)
+
+	// Salva il menu duplicato in MongoDB
+	err = db.MongoInstance.CreateMenu(ctx, duplicatedMenu)
+	if err != nil {
+		log.Printf("Errore nella creazione del menu duplicato: %v", err)
+		http.Error(w, "Errore nella duplicazione del menu", http.StatusInternalServerError)
+		return
+	}
+
+	// Redirect alla modifica del menu duplicato
+	publishMenuEvent(r, events.MenuCreated, duplicatedMenu)
+	http.Redirect(w, r, fmt.Sprintf("/admin/menu/%s", duplicatedMenu.ID), http.StatusSeeOther)
+}
+
+// duplicateMenu crea la copia in bozza di un menu, con nuovi ID per categorie e piatti
+func duplicateMenu(original *models.Menu) *models.Menu {
+	return &models.Menu{
 		ID:           uuid.New().String(),
-		RestaurantID: restaurant.ID,
-		Name:         fmt.Sprintf("%s (Copia)", originalMenu.Name),
-		Description:  originalMenu.Description,
-		Categories:   make([]models.MenuCategory, len(originalMenu.Categories)),
+		RestaurantID: original.RestaurantID,
+		Name:         fmt.Sprintf("%s (Copia)", original.Name),
+		Description:  original.Description,
+		Categories:   cloneMenuCategories(original.Categories),
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 		IsCompleted:  false, // Il menu duplicato inizia come bozza
 		IsActive:     false,
 	}
+}
 
-	// Duplica tutte le categorie e i piatti
-	for i, category := range originalMenu.Categories {
+// cloneMenuCategories copia categorie e piatti assegnando nuovi ID
+func cloneMenuCategories(categories []models.MenuCategory) []models.MenuCategory {
+	cloned := make([]models.MenuCategory, len(categories))
+	for i, category := range categories {
 		newCategory := models.MenuCategory{
 			ID:          uuid.New().String(),
 			Name:        category.Name,
@@ -1425,34 +1702,20 @@ func DuplicateMenuHandler(w http.ResponseWriter, r *http.Request) {
 				Category:    item.Category,
 				Available:   item.Available,
 				ImageURL:    item.ImageURL,
+
+				ImageID:       item.ImageID,
+				ImageVariants: item.ImageVariants,
 			}
 			newCategory.Items[j] = newItem
 		}
 
-		duplicatedMenu.Categories[i] = newCategory
+		cloned[i] = newCategory
 	}
-
-	// Salva il menu duplicato in MongoDB
-	err = db.MongoInstance.CreateMenu(ctx, duplicatedMenu)
-	if err != nil {
-		log.Printf("Errore nella creazione del menu duplicato: %v", err)
-		http.Error(w, "Errore nella duplicazione del menu", http.StatusInternalServerError)
-		return
-	}
-
-	// Redirect alla modifica del menu duplicato
-	http.Redirect(w, r, fmt.Sprintf("/admin/menu/%s", duplicatedMenu.ID), http.StatusSeeOther)
+	return cloned
 }
 
 // EditItemHandler modifica un piatto esistente
 func EditItemHandler(w http.ResponseWriter, r *http.Request) {
-	// Verifica autenticazione
-	restaurant, err := getCurrentRestaurant(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
 	vars := mux.Vars(r)
 	menuID := vars["menuId"]
 	categoryID := vars["categoryId"]
@@ -1461,11 +1724,14 @@ func EditItemHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil || menu.RestaurantID != restaurant.ID {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil {
 		http.NotFound(w, r)
 		return
 	}
+	if rejectArchivedMenu(w, r, menu) {
+		return
+	}
 
 	if err := r.ParseForm(); err != nil {
 		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
@@ -1498,6 +1764,8 @@ func EditItemHandler(w http.ResponseWriter, r *http.Request) {
 						return
 					}
 
+					publishItemEvent(r, menu, &menu.Categories[i].Items[j], "updated")
+
 					// Redirect back to edit menu
 					http.Redirect(w, r, fmt.Sprintf("/admin/menu/%s", menuID), http.StatusSeeOther)
 					return
@@ -1509,15 +1777,8 @@ func EditItemHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Piatto non trovato", http.StatusNotFound)
 }
 
-// DeleteItemHandler elimina un piatto
+// DeleteItemHandler sposta un piatto nel cestino del menu
 func DeleteItemHandler(w http.ResponseWriter, r *http.Request) {
-	// Verifica autenticazione
-	restaurant, err := getCurrentRestaurant(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
 	vars := mux.Vars(r)
 	menuID := vars["menuId"]
 	categoryID := vars["categoryId"]
@@ -1526,21 +1787,22 @@ func DeleteItemHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil || menu.RestaurantID != restaurant.ID {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil {
 		http.NotFound(w, r)
 		return
 	}
+	if rejectArchivedMenu(w, r, menu) {
+		return
+	}
 
 	// Trova ed elimina il piatto
 	for i, category := range menu.Categories {
 		if category.ID == categoryID {
 			for j, item := range category.Items {
 				if item.ID == itemID {
-					// Rimuovi il piatto dalla lista
-					menu.Categories[i].Items = append(
-						menu.Categories[i].Items[:j],
-						menu.Categories[i].Items[j+1:]...)
+					// Sposta il piatto nel cestino del menu
+					trashMenuItem(menu, i, j)
 
 					// Aggiorna timestamp
 					menu.UpdatedAt = time.Now()
@@ -1553,6 +1815,8 @@ func DeleteItemHandler(w http.ResponseWriter, r *http.Request) {
 						return
 					}
 
+					publishItemEvent(r, menu, &item, "deleted")
+
 					// Redirect back to edit menu
 					http.Redirect(w, r, fmt.Sprintf("/admin/menu/%s", menuID), http.StatusSeeOther)
 					return
@@ -1566,24 +1830,20 @@ func DeleteItemHandler(w http.ResponseWriter, r *http.Request) {
 
 // AddItemHandler aggiunge un nuovo piatto a una categoria esistente
 func AddItemHandler(w http.ResponseWriter, r *http.Request) {
-	// Verifica autenticazione
-	restaurant, err := getCurrentRestaurant(r)
-	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusFound)
-		return
-	}
-
 	vars := mux.Vars(r)
 	menuID := vars["id"]
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil || menu.RestaurantID != restaurant.ID {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil {
 		http.NotFound(w, r)
 		return
 	}
+	if rejectArchivedMenu(w, r, menu) {
+		return
+	}
 
 	if err := r.ParseForm(); err != nil {
 		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
@@ -1632,6 +1892,8 @@ func AddItemHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
+			publishItemEvent(r, menu, &newItem, "created")
+
 			// Redirect back to edit menu
 			http.Redirect(w, r, fmt.Sprintf("/admin/menu/%s", menuID), http.StatusSeeOther)
 			return
@@ -1641,72 +1903,73 @@ func AddItemHandler(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, "Categoria non trovata", http.StatusNotFound)
 }
 
-// processImageUpload gestisce l'upload e l'ottimizzazione delle immagini
-func processImageUpload(file multipart.File, header *multipart.FileHeader) (string, error) {
+// uploadedImage contiene il risultato dell'elaborazione di un'immagine caricata
+type uploadedImage struct {
+	ID       string
+	URL      string
+	Variants []models.ImageVariant
+}
+
+// processImageUpload gestisce l'upload e l'ottimizzazione delle immagini.
+// Per ogni dimensione (thumb, medium, full) salva il formato di fallback
+// (JPEG o PNG) e i formati moderni (WebP) quando risultano più leggeri
+func processImageUpload(ctx context.Context, file multipart.File, header *multipart.FileHeader) (*uploadedImage, error) {
 	// Verifica dimensione file
 	if header.Size > maxFileSize {
-		return "", fmt.Errorf("file troppo grande: max 5MB")
+		return nil, fmt.Errorf("file troppo grande: max 5MB")
 	}
 
 	// Verifica tipo di file
 	contentType := header.Header.Get("Content-Type")
 	if !allowedImageTypes[contentType] {
-		return "", fmt.Errorf("tipo di file non supportato: %s", contentType)
-	}
-
-	// Genera nome file unico
-	fileExt := filepath.Ext(header.Filename)
-	if fileExt == "" {
-		fileExt = ".jpg"
+		return nil, fmt.Errorf("tipo di file non supportato: %s", contentType)
 	}
-	filename := fmt.Sprintf("%s%s", uuid.New().String(), fileExt)
-	filepath := filepath.Join("static", "images", "dishes", filename)
 
-	// Decodifica l'immagine
-	img, format, err := image.Decode(file)
+	data, err := io.ReadAll(io.LimitReader(file, maxFileSize+1))
 	if err != nil {
-		return "", fmt.Errorf("errore nel decoding dell'immagine: %v", err)
+		return nil, fmt.Errorf("errore nella lettura del file: %v", err)
+	}
+	if int64(len(data)) > maxFileSize {
+		return nil, fmt.Errorf("file troppo grande: max 5MB")
 	}
 
-	// Ridimensiona l'immagine per ottimizzazione (max 800x600)
-	bounds := img.Bounds()
-	width, height := bounds.Max.X, bounds.Max.Y
-
-	if width > 800 || height > 600 {
-		ratio := float64(width) / float64(height)
-		if width > height {
-			width = 800
-			height = int(800 / ratio)
-		} else {
-			height = 600
-			width = int(600 * ratio)
-		}
-
-		// Crea nuova immagine ridimensionata
-		resized := image.NewRGBA(image.Rect(0, 0, width, height))
-		draw.BiLinear.Scale(resized, resized.Bounds(), img, bounds, draw.Over, nil)
-		img = resized
+	// Scansione antivirus prima di qualsiasi elaborazione: i file segnalati finiscono in quarantena
+	if err := uploadGuard.CheckBytes(ctx, header.Filename, data); err != nil {
+		return nil, err
 	}
 
-	// Salva l'immagine ottimizzata
-	outFile, err := os.Create(filepath)
+	// Decodifica l'immagine
+	img, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
-		return "", fmt.Errorf("errore nella creazione del file: %v", err)
+		return nil, fmt.Errorf("errore nel decoding dell'immagine: %v", err)
 	}
-	defer outFile.Close()
 
-	// Encoding basato sul formato originale o come JPEG per ottimizzazione
-	if format == "png" {
-		err = png.Encode(outFile, img)
-	} else {
-		err = jpeg.Encode(outFile, img, &jpeg.Options{Quality: 85})
+	// Genera tutte le varianti (dimensioni e formati)
+	variants, err := imaging.Process(img, format)
+	if err != nil {
+		return nil, fmt.Errorf("errore nell'encoding dell'immagine: %v", err)
 	}
 
-	if err != nil {
-		return "", fmt.Errorf("errore nell'encoding dell'immagine: %v", err)
+	// Salva le varianti nel blob store sotto images/dishes/{id}/
+	result := &uploadedImage{ID: uuid.New().String()}
+	for _, v := range variants {
+		key := imageVariantKey(result.ID, v.Size, v.Format)
+		if err := blobStore.Put(ctx, key, bytes.NewReader(v.Data), int64(len(v.Data)), v.ContentType); err != nil {
+			deleteImageVariants(ctx, result.ID)
+			return nil, fmt.Errorf("errore nel salvataggio dell'immagine: %v", err)
+		}
+
+		result.Variants = append(result.Variants, models.ImageVariant{
+			Size:   v.Size,
+			Format: v.Format,
+			Width:  v.Width,
+			Height: v.Height,
+			URL:    blobStore.URL(key),
+		})
 	}
+	result.URL = fmt.Sprintf("/img/%s/full", result.ID)
 
-	return fmt.Sprintf("images/dishes/%s", filename), nil
+	return result, nil
 }
 
 // UploadItemImageHandler gestisce l'upload di immagini per i piatti
@@ -1728,11 +1991,14 @@ func UploadItemImageHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
-	if err != nil || menu == nil || menu.RestaurantID != restaurant.ID {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil {
 		http.NotFound(w, r)
 		return
 	}
+	if rejectArchivedMenu(w, r, menu) {
+		return
+	}
 
 	// Parse multipart form
 	err = r.ParseMultipartForm(maxFileSize)
@@ -1750,7 +2016,16 @@ func UploadItemImageHandler(w http.ResponseWriter, r *http.Request) {
 	defer file.Close()
 
 	// Processa l'upload
-	imagePath, err := processImageUpload(file, header)
+	uploaded, err := processImageUpload(ctx, file, header)
+	if errors.Is(err, avscan.ErrInfected) {
+		RecordAuditLogAsync("UPLOAD_QUARANTINED", "item", itemID, restaurant.ID, getClientIP(r), r.UserAgent(), "failure")
+		http.Error(w, "Il file è stato bloccato dal controllo antivirus", http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, avscan.ErrUnavailable) {
+		http.Error(w, "Controllo antivirus non disponibile, riprova più tardi", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -1762,13 +2037,12 @@ func UploadItemImageHandler(w http.ResponseWriter, r *http.Request) {
 			for j, item := range category.Items {
 				if item.ID == itemID {
 					// Rimuovi immagine precedente se esiste
-					if item.ImageURL != "" {
-						oldPath := filepath.Join("static", item.ImageURL)
-						os.Remove(oldPath)
-					}
+					deleteItemImage(ctx, item)
 
 					// Aggiorna con nuova immagine
-					menu.Categories[i].Items[j].ImageURL = imagePath
+					menu.Categories[i].Items[j].ImageURL = uploaded.URL
+					menu.Categories[i].Items[j].ImageID = uploaded.ID
+					menu.Categories[i].Items[j].ImageVariants = uploaded.Variants
 					menu.UpdatedAt = time.Now()
 
 					// Salva le modifiche in MongoDB
@@ -1779,6 +2053,8 @@ func UploadItemImageHandler(w http.ResponseWriter, r *http.Request) {
 						return
 					}
 
+					publishItemEvent(r, menu, &menu.Categories[i].Items[j], "updated")
+
 					// Redirect back to edit menu
 					http.Redirect(w, r, fmt.Sprintf("/admin/menu/%s", menuID), http.StatusSeeOther)
 					return
@@ -1828,16 +2104,15 @@ func ShareMenuHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	baseURL := getBaseURL(r)
-	restaurantURL := fmt.Sprintf("%s/r/%s", baseURL, restaurant.Username)
+	restaurantURL := restaurantPublicURL(baseURL, restaurant)
 	// Genera il QR code che punta al ristorante (permanente)
-	qrCodePath := fmt.Sprintf("static/qrcodes/restaurant_%s.png", restaurant.ID)
-	err = qrcode.WriteFile(restaurantURL, qrcode.Medium, 256, qrCodePath)
-	if err != nil {
+	if _, err := saveRestaurantQRCode(ctx, restaurant.ID, restaurantURL); err != nil {
 		log.Printf("Errore nella generazione del QR code: %v", err)
 	}
 
 	menuURL := restaurantURL
 	shareText := fmt.Sprintf("Guarda il menu di %s", restaurant.Name)
+	shareMessage := url.QueryEscape(shareText + " " + menuURL)
 
 	data := struct {
 		Menu        *models.Menu
@@ -1848,15 +2123,24 @@ func ShareMenuHandler(w http.ResponseWriter, r *http.Request) {
 		TelegramURL string
 		FacebookURL string
 		TwitterURL  string
+		// Link click-to-chat al numero WhatsApp Business del ristorante, se collegato
+		WhatsAppChatURL      string
+		WhatsAppSubscribeURL string
 	}{
 		Menu:        menu,
 		Restaurant:  restaurant,
 		MenuURL:     menuURL,
 		ShareText:   shareText,
-		WhatsAppURL: fmt.Sprintf("https://wa.me/?text=%s%%20%s", strings.ReplaceAll(shareText, " ", "%%20"), menuURL),
-		TelegramURL: fmt.Sprintf("https://t.me/share/url?url=%s&text=%s", menuURL, strings.ReplaceAll(shareText, " ", "%%20")),
-		FacebookURL: fmt.Sprintf("https://www.facebook.com/sharer/sharer.php?u=%s", menuURL),
-		TwitterURL:  fmt.Sprintf("https://twitter.com/intent/tweet?text=%s%%20%s", strings.ReplaceAll(shareText, " ", "%%20"), menuURL),
+		WhatsAppURL: "https://wa.me/?text=" + shareMessage,
+		TelegramURL: "https://t.me/share/url?url=" + url.QueryEscape(menuURL) + "&text=" + url.QueryEscape(shareText),
+		FacebookURL: "https://www.facebook.com/sharer/sharer.php?u=" + url.QueryEscape(menuURL),
+		TwitterURL:  "https://twitter.com/intent/tweet?text=" + shareMessage,
+	}
+	if wa := restaurant.WhatsApp; wa != nil && wa.DisplayNumber != "" {
+		data.WhatsAppChatURL = phone.WhatsAppLink(wa.DisplayNumber, shareText)
+		if whatsAppClient != nil && wa.MenuTemplate != "" {
+			data.WhatsAppSubscribeURL = phone.WhatsAppLink(wa.DisplayNumber, whatsAppSubscribeKeyword)
+		}
 	}
 
 	renderTemplate(w, "share_menu", data)
@@ -1896,13 +2180,25 @@ func AnalyticsDashboardHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Valutazioni dei clienti nello stesso periodo
+	ratings, pendingFeedback, err := loadRatingAnalytics(ctx, session.RestaurantID, days)
+	if err != nil {
+		log.Printf("Errore nel calcolo delle valutazioni: %v", err)
+	}
+
 	// Prepara i dati per il template
 	data := struct {
-		Restaurant *models.Restaurant
-		Analytics  map[string]interface{}
+		Restaurant      *models.Restaurant
+		Analytics       map[string]interface{}
+		Ratings         *models.RatingStats
+		TopRatedItems   []models.ItemRating
+		PendingFeedback int64
 	}{
-		Restaurant: restaurant,
-		Analytics:  dashboardData,
+		Restaurant:      restaurant,
+		Analytics:       dashboardData,
+		Ratings:         ratings,
+		TopRatedItems:   topRatedItems(ratings, 5),
+		PendingFeedback: pendingFeedback,
 	}
 
 	// Render del template
@@ -2041,15 +2337,21 @@ func DownloadQRHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verifica che il QR code esista
-	qrCodePath := fmt.Sprintf("static/qrcodes/menu_%s.png", menuID)
-	if _, err := os.Stat(qrCodePath); os.IsNotExist(err) {
+	// Il QR code è quello permanente del ristorante proprietario del menu
+	blob, err := blobStore.Get(ctx, restaurantQRKey(menu.RestaurantID))
+	if err == storage.ErrNotFound {
 		http.Error(w, "QR Code non trovato", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		log.Printf("Errore lettura QR code: %v", err)
+		http.Error(w, "Errore nel caricamento del QR code", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
 
 	// Leggi il file
-	fileData, err := os.ReadFile(qrCodePath)
+	fileData, err := io.ReadAll(blob)
 	if err != nil {
 		log.Printf("Errore lettura QR code: %v", err)
 		http.Error(w, "Errore nel caricamento del QR code", http.StatusInternalServerError)
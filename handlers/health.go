@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"qr-menu/pkg/health"
+	httputil "qr-menu/pkg/http"
+)
+
+// healthChecker esegue i controlli delle dipendenze (database, storage, cache, coda email,
+// spazio su disco); nil finché il server non è inizializzato
+var healthChecker *health.Checker
+
+// SetHealthChecker configura i controlli usati da HealthHandler e ReadyHandler
+func SetHealthChecker(checker *health.Checker) {
+	healthChecker = checker
+}
+
+// HealthHandler restituisce lo stato del servizio e di ogni dipendenza (GET /api/v1/health):
+// 200 se ok o degraded, 503 se una dipendenza critica non risponde. I messaggi di errore
+// finiscono solo nei log, perché l'endpoint è pubblico
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if healthChecker == nil {
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Servizio in avvio")
+		return
+	}
+
+	report := healthChecker.Run(r.Context())
+	for name, result := range report.Checks {
+		result.Error = ""
+		report.Checks[name] = result
+	}
+	httputil.JSON(w, report.HTTPStatus(), report)
+}
+
+// ReadyHandler indica agli orchestratori se l'istanza può ricevere traffico (GET /ready):
+// 503 finché una dipendenza critica non risponde. Un servizio degraded resta pronto
+func ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if healthChecker == nil {
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Servizio in avvio")
+		return
+	}
+
+	report := healthChecker.Run(r.Context())
+	httputil.JSON(w, report.HTTPStatus(), map[string]interface{}{
+		"status":  report.Status,
+		"failing": report.Failing(),
+	})
+}
@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/config"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+	"qr-menu/pkg/integrations"
+	"qr-menu/pkg/metrics"
+)
+
+// errNoMenuToExport indica che l'integrazione non ha un menu da esportare
+var errNoMenuToExport = errors.New("nessun menu da esportare: attivare un menu o sceglierne uno nell'integrazione")
+
+// integrationSettings sono intervallo di sincronizzazione e timeout delle integrazioni
+var integrationSettings = config.Default().Integrations
+
+var integrationSyncs = metrics.NewCounter("qrmenu_integration_syncs_total",
+	"Menu exports to the delivery platforms by platform and result (success or failed).", "platform", "result")
+
+// SetIntegrationSettings imposta intervallo di sincronizzazione e timeout delle integrazioni
+// con le piattaforme di delivery
+func SetIntegrationSettings(cfg config.IntegrationsConfig) {
+	integrationSettings = cfg
+}
+
+// integrationConnector restituisce il connettore della piattaforma dell'integrazione,
+// decifrandone le credenziali
+func integrationConnector(integration *models.MenuIntegration) (integrations.Connector, error) {
+	if paymentCredentials == nil {
+		return nil, errors.New("le integrazioni richiedono security.jwt_secret su questa istanza")
+	}
+	plain, err := paymentCredentials.Decrypt(integration.Credentials)
+	if err != nil {
+		return nil, fmt.Errorf("credenziali dell'integrazione non leggibili: %v", err)
+	}
+	var cfg integrations.Config
+	if err := json.Unmarshal([]byte(plain), &cfg); err != nil {
+		return nil, fmt.Errorf("credenziali dell'integrazione non valide: %v", err)
+	}
+	cfg.Timeout = integrationSettings.Timeout
+	return integrations.New(cfg)
+}
+
+// integrationExportURL è l'indirizzo pubblico del menu esportato per l'integrazione, da cui
+// lo scaricano le piattaforme come Glovo
+func integrationExportURL(baseURL, integrationID string) string {
+	return baseURL + "/api/v1/public/integrations/" + url.PathEscape(integrationID) + "/menu"
+}
+
+// integrationMenu restituisce il menu esportato dall'integrazione: quello scelto o, se non
+// indicato, il menu attivo del ristorante. Restituisce errNoMenuToExport se non c'è
+func integrationMenu(ctx context.Context, integration *models.MenuIntegration) (*models.Menu, error) {
+	if integration.MenuID == "" {
+		menu, err := activeRestaurantMenu(ctx, integration.RestaurantID)
+		if err == nil && menu == nil {
+			err = errNoMenuToExport
+		}
+		return menu, err
+	}
+	menu, err := db.MongoInstance.GetRestaurantMenu(ctx, integration.MenuID, integration.RestaurantID)
+	if err == nil && (menu == nil || menu.IsArchived) {
+		err = errNoMenuToExport
+	}
+	return menu, err
+}
+
+// newIntegrationMenu converte il menu nella forma esportata alle piattaforme, con i prezzi
+// in centesimi e le immagini con indirizzo assoluto
+func newIntegrationMenu(menu *models.Menu, restaurant *models.Restaurant, baseURL, exportURL string) integrations.Menu {
+	out := integrations.Menu{
+		ID:          menu.ID,
+		Name:        menu.Name,
+		Description: menu.Description,
+		Currency:    orderCurrency(restaurant),
+		Language:    i18n.Default().Resolve(""),
+		URL:         exportURL,
+	}
+	for _, category := range menu.Categories {
+		c := integrations.Category{ID: category.ID, Name: category.Name, Description: category.Description}
+		for _, item := range category.Items {
+			c.Items = append(c.Items, integrations.Item{
+				ID:          item.ID,
+				Name:        item.Name,
+				Description: item.Description,
+				PriceCents:  toCents(item.Price),
+				ImageURL:    absoluteURL(baseURL, item.ImageURL),
+				Available:   item.Available,
+				Tags:        item.Tags,
+				Hidden:      item.HiddenChannels,
+			})
+		}
+		out.Categories = append(out.Categories, c)
+	}
+	return out
+}
+
+// loadIntegrationMenu carica il ristorante e il menu dell'integrazione nella forma esportata
+func loadIntegrationMenu(ctx context.Context, integration *models.MenuIntegration, baseURL string) (integrations.Menu, error) {
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, integration.RestaurantID)
+	if err != nil {
+		return integrations.Menu{}, err
+	}
+	if restaurant == nil {
+		return integrations.Menu{}, errors.New("ristorante non trovato")
+	}
+	menu, err := integrationMenu(ctx, integration)
+	if err != nil {
+		return integrations.Menu{}, err
+	}
+	exportURL := ""
+	if baseURL != "" {
+		exportURL = integrationExportURL(baseURL, integration.ID)
+	}
+	return newIntegrationMenu(menu, restaurant, baseURL, exportURL), nil
+}
+
+// SyncMenuIntegration invia il menu alla piattaforma dell'integrazione e ne registra l'esito
+func SyncMenuIntegration(ctx context.Context, integration *models.MenuIntegration) (*integrations.Result, error) {
+	result, err := pushIntegrationMenu(ctx, integration)
+	status, lastError, items := models.IntegrationSyncSuccess, "", 0
+	if err != nil {
+		status, lastError = models.IntegrationSyncFailed, err.Error()
+		logger.Warn("Sincronizzazione del menu non riuscita", map[string]interface{}{
+			"integration_id": integration.ID,
+			"restaurant_id":  integration.RestaurantID,
+			"platform":       integration.Platform,
+			"error":          err.Error(),
+		})
+	} else {
+		items = result.Items
+	}
+	integrationSyncs.Inc(integration.Platform, status)
+
+	if rerr := db.MongoInstance.RecordMenuIntegrationSync(ctx, integration.ID, status, lastError, items, time.Now()); rerr != nil {
+		logger.Warn("Esito della sincronizzazione del menu non salvato", map[string]interface{}{
+			"integration_id": integration.ID,
+			"error":          rerr.Error(),
+		})
+	}
+	return result, err
+}
+
+func pushIntegrationMenu(ctx context.Context, integration *models.MenuIntegration) (*integrations.Result, error) {
+	connector, err := integrationConnector(integration)
+	if err != nil {
+		return nil, err
+	}
+	menu, err := loadIntegrationMenu(ctx, integration, configuredBaseURL)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Push(ctx, menu)
+}
+
+// SyncDueMenuIntegrations sincronizza le integrazioni con la sincronizzazione automatica
+// scaduta. Restituisce quante ne ha sincronizzate con successo
+func SyncDueMenuIntegrations(ctx context.Context, now time.Time) (int, error) {
+	if db.MongoInstance == nil || integrationSettings.SyncInterval <= 0 {
+		return 0, nil
+	}
+	synced := 0
+	for ctx.Err() == nil {
+		integration, err := db.MongoInstance.ClaimDueMenuIntegration(ctx, now, now.Add(integrationSettings.SyncInterval))
+		if err != nil || integration == nil {
+			return synced, err
+		}
+		if _, err := SyncMenuIntegration(ctx, integration); err == nil {
+			synced++
+		}
+	}
+	return synced, ctx.Err()
+}
+
+// RunMenuIntegrationsWorker sincronizza periodicamente i menu con le piattaforme di delivery
+// delle integrazioni con la sincronizzazione automatica; si ferma alla cancellazione di ctx
+func RunMenuIntegrationsWorker(ctx context.Context) {
+	if integrationSettings.SyncInterval <= 0 {
+		return
+	}
+	run := func() {
+		runCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+		defer cancel()
+		synced, err := SyncDueMenuIntegrations(runCtx, time.Now())
+		if err != nil {
+			logger.Error("Errore nella sincronizzazione dei menu con le piattaforme di delivery", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		if synced > 0 {
+			logger.Info("Menu sincronizzati con le piattaforme di delivery", map[string]interface{}{
+				"integrations": synced,
+			})
+		}
+	}
+
+	run()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
+
+// integrationPlatform legge la piattaforma dal percorso; risponde 400 se non è supportata
+func integrationPlatform(w http.ResponseWriter, r *http.Request) (string, bool) {
+	platform := mux.Vars(r)["platform"]
+	if !slices.Contains(integrations.Platforms, platform) {
+		httputil.BadRequest(w, "Piattaforma non supportata: "+platform+" (piattaforme: "+strings.Join(integrations.Platforms, ", ")+")")
+		return "", false
+	}
+	return platform, true
+}
+
+// validateHiddenChannels controlla i canali su cui nascondere un piatto e ne toglie i doppioni
+func validateHiddenChannels(channels []string) ([]string, error) {
+	var out []string
+	for _, channel := range channels {
+		channel = strings.ToLower(strings.TrimSpace(channel))
+		if !slices.Contains(integrations.Channels, channel) {
+			return nil, errors.New("Canale non valido: " + channel + " (canali: " + strings.Join(integrations.Channels, ", ") + ")")
+		}
+		if !slices.Contains(out, channel) {
+			out = append(out, channel)
+		}
+	}
+	return out, nil
+}
+
+// ListMenuIntegrationsHandler restituisce le piattaforme supportate e le integrazioni del
+// ristorante (GET /api/v1/integrations)
+func ListMenuIntegrationsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	list, err := db.MongoInstance.GetMenuIntegrations(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero delle integrazioni")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Integrazioni", map[string]interface{}{
+		"enabled":       paymentCredentials != nil,
+		"platforms":     integrations.Platforms,
+		"channels":      integrations.Channels,
+		"sync_interval": integrationSettings.SyncInterval.String(),
+		"integrations":  list,
+	})
+}
+
+// SaveMenuIntegrationHandler configura l'integrazione con una piattaforma
+// (PUT /api/v1/integrations/{platform} con credentials, menu_id e auto_sync). Le credenziali
+// sono obbligatorie alla creazione, cifrate e non vengono più restituite; omesse in una
+// modifica restano quelle salvate
+func SaveMenuIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	platform, ok := integrationPlatform(w, r)
+	if !ok {
+		return
+	}
+	if paymentCredentials == nil {
+		httputil.Conflict(w, "Le integrazioni richiedono security.jwt_secret su questa istanza")
+		return
+	}
+
+	var req struct {
+		Credentials integrations.Config `json:"credentials"`
+		MenuID      *string             `json:"menu_id"`
+		AutoSync    *bool               `json:"auto_sync"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	integration, err := db.MongoInstance.GetMenuIntegration(ctx, restaurant.ID, platform)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dell'integrazione")
+		return
+	}
+	now := time.Now()
+	if integration == nil {
+		if req.Credentials == (integrations.Config{}) {
+			httputil.BadRequest(w, "credentials è obbligatorio")
+			return
+		}
+		integration = &models.MenuIntegration{
+			ID:           uuid.New().String(),
+			RestaurantID: restaurant.ID,
+			Platform:     platform,
+			AutoSync:     true,
+			CreatedAt:    now,
+		}
+	}
+
+	if req.Credentials != (integrations.Config{}) {
+		cfg := req.Credentials
+		cfg.Platform = platform
+		if _, err := integrations.New(cfg); err != nil {
+			httputil.BadRequest(w, err.Error())
+			return
+		}
+		plain, err := json.Marshal(cfg)
+		if err == nil {
+			integration.Credentials, err = paymentCredentials.Encrypt(string(plain))
+		}
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nella cifratura delle credenziali")
+			return
+		}
+	}
+	if req.MenuID != nil {
+		integration.MenuID = strings.TrimSpace(*req.MenuID)
+		if integration.MenuID != "" {
+			menu, err := db.MongoInstance.GetRestaurantMenu(ctx, integration.MenuID, restaurant.ID)
+			if err != nil {
+				respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+				return
+			}
+			if menu == nil || menu.IsArchived {
+				httputil.NotFound(w, "Menu")
+				return
+			}
+		}
+	}
+	if req.AutoSync != nil {
+		integration.AutoSync = *req.AutoSync
+	}
+	integration.NextSyncAt = nil
+	if integration.AutoSync && integrationSettings.SyncInterval > 0 {
+		integration.NextSyncAt = &now
+	}
+	integration.UpdatedAt = now
+
+	if err := db.MongoInstance.SaveMenuIntegration(ctx, integration); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio dell'integrazione")
+		return
+	}
+
+	RecordAuditLogAsync("INTEGRATION_SAVED", "menu_integration", integration.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Integrazione salvata", integration)
+}
+
+// DeleteMenuIntegrationHandler rimuove l'integrazione con una piattaforma e le sue credenziali
+// (DELETE /api/v1/integrations/{platform}). Il menu già inviato resta sulla piattaforma
+func DeleteMenuIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	platform, ok := integrationPlatform(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := db.MongoInstance.DeleteMenuIntegration(ctx, restaurant.ID, platform)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella rimozione dell'integrazione")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "Integrazione")
+		return
+	}
+	RecordAuditLogAsync("INTEGRATION_DELETED", "menu_integration", platform, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// SyncMenuIntegrationHandler invia subito il menu alla piattaforma
+// (POST /api/v1/integrations/{platform}/sync) e risponde con l'esito
+func SyncMenuIntegrationHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	platform, ok := integrationPlatform(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+
+	integration, err := db.MongoInstance.GetMenuIntegration(ctx, restaurant.ID, platform)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dell'integrazione")
+		return
+	}
+	if integration == nil {
+		httputil.NotFound(w, "Integrazione")
+		return
+	}
+
+	result, err := SyncMenuIntegration(ctx, integration)
+	if errors.Is(err, errNoMenuToExport) {
+		httputil.Conflict(w, err.Error())
+		return
+	}
+	if err != nil {
+		RecordAuditLogAsync("INTEGRATION_SYNCED", "menu_integration", integration.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "failure")
+		httputil.BadRequest(w, "Sincronizzazione non riuscita: "+err.Error())
+		return
+	}
+	RecordAuditLogAsync("INTEGRATION_SYNCED", "menu_integration", integration.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Menu sincronizzato", map[string]interface{}{
+		"platform":   platform,
+		"categories": result.Categories,
+		"items":      result.Items,
+	})
+}
+
+// PublicIntegrationMenuHandler restituisce il menu dell'integrazione nel formato della sua
+// piattaforma (GET /api/v1/public/integrations/{id}/menu). È l'indirizzo da cui Glovo scarica
+// il menu; l'ID dell'integrazione non è indovinabile
+func PublicIntegrationMenuHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	integration, err := db.MongoInstance.GetMenuIntegrationByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+		return
+	}
+	if integration == nil {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+	connector, err := integrationConnector(integration)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'esportazione del menu")
+		return
+	}
+	baseURL := getBaseURL(r)
+	menu, err := loadIntegrationMenu(ctx, integration, baseURL)
+	if errors.Is(err, errNoMenuToExport) {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+		return
+	}
+	doc, err := connector.Build(menu)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'esportazione del menu")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	httputil.JSON(w, http.StatusOK, doc)
+}
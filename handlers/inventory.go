@@ -0,0 +1,598 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+)
+
+const (
+	// inventoryConsumptionDays è il periodo su cui si calcola il consumo medio giornaliero
+	inventoryConsumptionDays = 14
+	// stockUpdateAttempts è il numero di tentativi di salvare una giacenza modificata nel
+	// frattempo da un'altra richiesta (ordini e rettifiche concorrenti)
+	stockUpdateAttempts = 5
+)
+
+// errStockConflict indica che la giacenza è cambiata a ogni tentativo di aggiornarla
+var errStockConflict = errors.New("giacenza modificata da un'altra richiesta, riprova")
+
+// inventoryQuery descrive ordinamento e filtri dell'elenco delle giacenze
+var inventoryQuery = httputil.ListOptions{
+	DefaultPerPage: 100,
+	MaxPerPage:     500,
+	DefaultSort:    "name",
+	Sortable:       []string{"name", "quantity", "days_remaining"},
+	Filterable:     []string{"menu_id", "low"},
+}
+
+// stockAdjustmentsQuery descrive paginazione e filtri dei movimenti di magazzino di un piatto
+var stockAdjustmentsQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     200,
+	DefaultSort:    "-created_at",
+	Sortable:       []string{"created_at"},
+	Filterable:     []string{"reason"},
+}
+
+// inventoryItem è un piatto a magazzino nell'elenco delle giacenze, con il consumo medio degli
+// ultimi giorni (ordini e scarti) e i giorni di copertura che ne risultano
+type inventoryItem struct {
+	MenuID           string                `json:"menu_id"`
+	MenuName         string                `json:"menu_name"`
+	CategoryID       string                `json:"category_id"`
+	ItemID           string                `json:"item_id"`
+	Name             string                `json:"name"`
+	Available        bool                  `json:"available"`
+	Inventory        *models.ItemInventory `json:"inventory"`
+	Low              bool                  `json:"low"`
+	DailyConsumption float64               `json:"daily_consumption"`
+	DaysRemaining    *float64              `json:"days_remaining,omitempty"` // Assente senza consumi nel periodo
+}
+
+// stockLine è la quantità di un piatto da scaricare dal magazzino
+type stockLine struct {
+	ItemID   string
+	Quantity int
+}
+
+// stockUpdate descrive chi e perché modifica una giacenza, per lo storico dei movimenti
+type stockUpdate struct {
+	Reason  string
+	OrderID string
+	Note    string
+	ActorID string
+}
+
+// changeItemStock applica apply al piatto itemID del menu e salva giacenza e disponibilità
+// solo se nessun'altra richiesta le ha cambiate nel frattempo, altrimenti rilegge il menu e
+// riprova. Restituisce il menu riletto e il piatto aggiornato; nil se il piatto non esiste
+func changeItemStock(ctx context.Context, menuID, itemID string, apply func(item *models.MenuItem) (models.StockChange, error)) (*models.Menu, *models.MenuItem, models.StockChange, error) {
+	for attempt := 0; attempt < stockUpdateAttempts; attempt++ {
+		menu, err := db.MongoInstance.GetMenuByID(ctx, menuID)
+		if err != nil || menu == nil {
+			return nil, nil, models.StockChange{}, err
+		}
+		item := locateMenuItem(menu, itemID)
+		if item == nil {
+			return menu, nil, models.StockChange{}, nil
+		}
+
+		var before *int
+		if item.Inventory != nil {
+			quantity := item.Inventory.Quantity
+			before = &quantity
+			inventory := *item.Inventory
+			item.Inventory = &inventory
+		}
+		change, err := apply(item)
+		if err != nil || (before == nil && item.Inventory == nil) {
+			return menu, item, change, err // Piatto senza giacenza: non c'è nulla da salvare
+		}
+		saved, err := db.MongoInstance.UpdateItemInventory(ctx, menu.ID, *item, before)
+		if err != nil {
+			return menu, item, change, err
+		}
+		if saved {
+			return menu, item, change, nil
+		}
+	}
+	return nil, nil, models.StockChange{}, errStockConflict
+}
+
+// locateMenuItem restituisce il piatto del menu con l'ID indicato, nil se non c'è
+func locateMenuItem(menu *models.Menu, itemID string) *models.MenuItem {
+	for ci := range menu.Categories {
+		for ii := range menu.Categories[ci].Items {
+			if menu.Categories[ci].Items[ii].ID == itemID {
+				return &menu.Categories[ci].Items[ii]
+			}
+		}
+	}
+	return nil
+}
+
+// recordStockChange registra il movimento di magazzino e avvisa di scorta bassa, esaurimento
+// e cambi di disponibilità: eventi sul bus e aggiornamento dei menu pubblici in cache
+func recordStockChange(ctx context.Context, menu *models.Menu, item *models.MenuItem, change models.StockChange, update stockUpdate) {
+	if change.After != change.Before {
+		adjustment := &models.StockAdjustment{
+			ID:           uuid.New().String(),
+			RestaurantID: menu.RestaurantID,
+			MenuID:       menu.ID,
+			ItemID:       item.ID,
+			Reason:       update.Reason,
+			Delta:        change.After - change.Before,
+			Quantity:     change.After,
+			OrderID:      update.OrderID,
+			Note:         update.Note,
+			ActorID:      update.ActorID,
+			CreatedAt:    time.Now(),
+		}
+		if err := db.MongoInstance.CreateStockAdjustment(ctx, adjustment); err != nil {
+			logger.WarnCtx(ctx, "Errore nella registrazione del movimento di magazzino", map[string]interface{}{
+				"error":   err.Error(),
+				"item_id": item.ID,
+			})
+		}
+	}
+
+	data := map[string]interface{}{
+		"menu_id":  menu.ID,
+		"item_id":  item.ID,
+		"name":     item.Name,
+		"quantity": change.After,
+	}
+	if item.Inventory != nil {
+		data["threshold"] = item.Inventory.LowStockThreshold
+	}
+	switch {
+	case change.SoldOut:
+		eventBus.Publish(events.Event{Type: events.ItemSoldOut, RestaurantID: menu.RestaurantID, ActorID: update.ActorID, Data: data})
+	case change.LowStock:
+		eventBus.Publish(events.Event{Type: events.ItemLowStock, RestaurantID: menu.RestaurantID, ActorID: update.ActorID, Data: data})
+	}
+
+	if change.AvailabilityChanged() {
+		eventBus.Publish(events.Event{Type: events.ItemUpdated, RestaurantID: menu.RestaurantID, ActorID: update.ActorID, Data: map[string]interface{}{
+			"menu_id":   menu.ID,
+			"item_id":   item.ID,
+			"name":      item.Name,
+			"price":     item.Price,
+			"available": item.Available,
+			"change":    "updated",
+		}})
+		if publicMenuCache != nil {
+			publicMenuCache.InvalidateKey(publicMenuCacheKey(menu.ID))
+			scheduleMenuWarmUp(menu.RestaurantID)
+		}
+	}
+}
+
+// consumeStock scarica dal magazzino le quantità di un ordine sul menu. I piatti senza
+// giacenza non vengono toccati. Se un piatto non basta restituisce models.ErrInsufficientStock
+// e ripristina i piatti già scaricati, così l'ordine resta tutto o niente
+func consumeStock(ctx context.Context, menuID string, lines []stockLine, update stockUpdate) error {
+	update.Reason = models.StockReasonOrder
+	var consumed []stockLine
+	for _, line := range lines {
+		menu, item, change, err := changeItemStock(ctx, menuID, line.ItemID, func(item *models.MenuItem) (models.StockChange, error) {
+			if item.Inventory == nil {
+				return models.StockChange{}, nil
+			}
+			return item.AdjustStock(-line.Quantity, time.Now())
+		})
+		if err != nil {
+			restoreStock(ctx, menuID, consumed, update)
+			return err
+		}
+		if item != nil && item.Inventory != nil {
+			consumed = append(consumed, line)
+			recordStockChange(ctx, menu, item, change, update)
+		}
+	}
+	return nil
+}
+
+// restoreStock rimette in magazzino le quantità scaricate da un ordine non concluso
+func restoreStock(ctx context.Context, menuID string, lines []stockLine, update stockUpdate) {
+	update.Note = "Ripristino: ordine non concluso"
+	for _, line := range lines {
+		menu, item, change, err := changeItemStock(ctx, menuID, line.ItemID, func(item *models.MenuItem) (models.StockChange, error) {
+			if item.Inventory == nil {
+				return models.StockChange{}, nil
+			}
+			return item.AdjustStock(line.Quantity, time.Now())
+		})
+		if err != nil {
+			logger.WarnCtx(ctx, "Errore nel ripristino della giacenza", map[string]interface{}{
+				"error":   err.Error(),
+				"item_id": line.ItemID,
+			})
+			continue
+		}
+		if item != nil && item.Inventory != nil {
+			recordStockChange(ctx, menu, item, change, update)
+		}
+	}
+}
+
+// notifyStockAlert avvisa il proprietario della scorta bassa o dell'esaurimento di un piatto
+func notifyStockAlert(ctx context.Context, event events.Event) error {
+	if db.MongoInstance == nil || event.RestaurantID == "" {
+		return nil
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, event.RestaurantID)
+	if err != nil || restaurant == nil || restaurant.OwnerID == "" {
+		return err
+	}
+	owner, err := db.MongoInstance.GetUserByID(ctx, restaurant.OwnerID)
+	if err != nil || owner == nil || !owner.IsActive {
+		return err
+	}
+
+	key := i18n.KeyItemLowStock
+	if event.Type == events.ItemSoldOut {
+		key = i18n.KeyItemSoldOut
+	}
+	menuName := ""
+	if menuID, ok := event.Data["menu_id"].(string); ok {
+		if menu, err := db.MongoInstance.GetMenuByID(ctx, menuID); err == nil && menu != nil {
+			menuName = menu.Name
+		}
+	}
+	return notifyOwner(ctx, owner, key, map[string]interface{}{
+		"RestaurantName": restaurant.Name,
+		"MenuName":       menuName,
+		"ItemName":       event.Data["name"],
+		"Quantity":       event.Data["quantity"],
+		"Threshold":      event.Data["threshold"],
+		"AdminURL":       configuredBaseURL + "/admin",
+	})
+}
+
+// loadInventoryItem carica il menu del ristorante che contiene il piatto {id}; risponde 404 e
+// restituisce nil se non esiste
+func loadInventoryItem(ctx context.Context, w http.ResponseWriter, r *http.Request, restaurant *models.Restaurant) (*models.Menu, *models.MenuItem) {
+	menu, _, item, err := findRestaurantItem(ctx, restaurant.ID, mux.Vars(r)["id"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del piatto")
+		return nil, nil
+	}
+	if item == nil || menu.IsArchived || !menu.DeletedAt.IsZero() {
+		httputil.NotFound(w, "Piatto")
+		return nil, nil
+	}
+	return menu, item
+}
+
+// respondStockError risponde all'errore di un aggiornamento di giacenza
+func respondStockError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrInsufficientStock):
+		httputil.Conflict(w, "La giacenza non può diventare negativa")
+	case errors.Is(err, errStockConflict):
+		httputil.Conflict(w, err.Error())
+	default:
+		respondMenuV2Error(w, r, err, "Errore nell'aggiornamento della giacenza")
+	}
+}
+
+// requestActorID restituisce l'utente della richiesta, per lo storico dei movimenti e degli ordini
+func requestActorID(r *http.Request) string {
+	if session, err := getSessionFromRequest(r); err == nil {
+		return session.UserID
+	}
+	return ""
+}
+
+// ListInventoryHandler elenca i piatti a magazzino dei menu del ristorante con giacenza,
+// consumo medio e giorni di copertura (GET /api/v1/inventory)
+func ListInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	query, err := httputil.ParseListQuery(r, inventoryQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	lowOnly, filterLow, err := query.BoolFilter("low")
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei menu")
+		return
+	}
+	consumption, err := db.MongoInstance.GetStockConsumption(ctx, restaurant.ID,
+		time.Now().AddDate(0, 0, -inventoryConsumptionDays))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel calcolo dei consumi")
+		return
+	}
+
+	items := []inventoryItem{}
+	menuFilter := query.Filter("menu_id")
+	for _, menu := range menus {
+		if menu.IsArchived || (menuFilter != "" && menu.ID != menuFilter) {
+			continue
+		}
+		for _, category := range menu.Categories {
+			for _, item := range category.Items {
+				if item.Inventory == nil || (filterLow && item.Inventory.IsLow() != lowOnly) {
+					continue
+				}
+				row := inventoryItem{
+					MenuID:           menu.ID,
+					MenuName:         menu.Name,
+					CategoryID:       category.ID,
+					ItemID:           item.ID,
+					Name:             item.Name,
+					Available:        item.Available,
+					Inventory:        item.Inventory,
+					Low:              item.Inventory.IsLow(),
+					DailyConsumption: math.Round(float64(consumption[item.ID])/inventoryConsumptionDays*100) / 100,
+				}
+				if row.DailyConsumption > 0 {
+					days := math.Round(float64(item.Inventory.Quantity)/row.DailyConsumption*10) / 10
+					row.DaysRemaining = &days
+				}
+				items = append(items, row)
+			}
+		}
+	}
+
+	httputil.SortSlice(items, query, map[string]func(a, b inventoryItem) int{
+		"name":     func(a, b inventoryItem) int { return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)) },
+		"quantity": func(a, b inventoryItem) int { return a.Inventory.Quantity - b.Inventory.Quantity },
+		"days_remaining": func(a, b inventoryItem) int {
+			// Senza consumi la copertura è illimitata: in fondo all'ordine crescente
+			left, right := math.Inf(1), math.Inf(1)
+			if a.DaysRemaining != nil {
+				left = *a.DaysRemaining
+			}
+			if b.DaysRemaining != nil {
+				right = *b.DaysRemaining
+			}
+			switch {
+			case left < right:
+				return -1
+			case left > right:
+				return 1
+			}
+			return 0
+		},
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, httputil.PageOf(items, query), query, int64(len(items)))
+}
+
+// SetItemInventoryHandler attiva o modifica la giacenza di un piatto
+// (PUT /api/v1/items/{id}/inventory con {"quantity": 20, "low_stock_threshold": 5}).
+// La quantità indicata sostituisce quella attuale, come dopo un inventario fisico
+func SetItemInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req struct {
+		Quantity          *int `json:"quantity"`
+		LowStockThreshold *int `json:"low_stock_threshold"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if req.Quantity != nil && *req.Quantity < 0 {
+		httputil.BadRequest(w, "La quantità non può essere negativa")
+		return
+	}
+	if req.LowStockThreshold != nil && *req.LowStockThreshold < 0 {
+		httputil.BadRequest(w, "La soglia di scorta bassa non può essere negativa")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, item := loadInventoryItem(ctx, w, r, restaurant)
+	if item == nil {
+		return
+	}
+	if item.Inventory == nil && req.Quantity == nil {
+		httputil.BadRequest(w, "La quantità è obbligatoria per attivare la giacenza")
+		return
+	}
+
+	menu, item, change, err := changeItemStock(ctx, menu.ID, item.ID, func(item *models.MenuItem) (models.StockChange, error) {
+		if item.Inventory == nil {
+			item.Inventory = &models.ItemInventory{}
+		}
+		if req.LowStockThreshold != nil {
+			item.Inventory.LowStockThreshold = *req.LowStockThreshold
+		}
+		quantity := item.Inventory.Quantity
+		if req.Quantity != nil {
+			quantity = *req.Quantity
+		}
+		return item.SetStock(quantity, time.Now()), nil
+	})
+	if err != nil {
+		respondStockError(w, r, err)
+		return
+	}
+	if item == nil {
+		httputil.NotFound(w, "Piatto")
+		return
+	}
+
+	recordStockChange(ctx, menu, item, change, stockUpdate{Reason: models.StockReasonCount, ActorID: requestActorID(r)})
+	RecordAuditLogAsync("INVENTORY_UPDATED", "item", item.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Giacenza aggiornata", item)
+}
+
+// DeleteItemInventoryHandler smette di tenere la giacenza di un piatto; se era esaurito torna
+// disponibile (DELETE /api/v1/items/{id}/inventory)
+func DeleteItemInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, item := loadInventoryItem(ctx, w, r, restaurant)
+	if item == nil {
+		return
+	}
+	if item.Inventory == nil {
+		httputil.NotFound(w, "Giacenza")
+		return
+	}
+
+	menu, item, change, err := changeItemStock(ctx, menu.ID, item.ID, func(item *models.MenuItem) (models.StockChange, error) {
+		var change models.StockChange
+		if item.Inventory != nil && item.Inventory.SoldOut {
+			item.Available = true
+			change.Restocked = true
+		}
+		item.Inventory = nil
+		return change, nil
+	})
+	if err != nil {
+		respondStockError(w, r, err)
+		return
+	}
+	if item != nil {
+		recordStockChange(ctx, menu, item, change, stockUpdate{ActorID: requestActorID(r)})
+	}
+
+	RecordAuditLogAsync("INVENTORY_DISABLED", "item", mux.Vars(r)["id"], restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// AdjustItemInventoryHandler registra un movimento di magazzino di un piatto
+// (POST /api/v1/items/{id}/inventory/adjustments con {"delta": 12, "reason": "restock"}).
+// Con reason "count" si indica invece la quantità contata ({"quantity": 8})
+func AdjustItemInventoryHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req struct {
+		Delta    int    `json:"delta"`
+		Quantity *int   `json:"quantity"`
+		Reason   string `json:"reason"`
+		Note     string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if !containsString(models.StockReasons, req.Reason) {
+		httputil.BadRequest(w, "Motivo non valido ("+strings.Join(models.StockReasons, ", ")+")")
+		return
+	}
+	switch {
+	case req.Reason == models.StockReasonCount && (req.Quantity == nil || *req.Quantity < 0):
+		httputil.BadRequest(w, "La quantità contata è obbligatoria e non può essere negativa")
+		return
+	case req.Reason != models.StockReasonCount && req.Delta == 0:
+		httputil.BadRequest(w, "La variazione è obbligatoria")
+		return
+	case req.Reason == models.StockReasonRestock && req.Delta < 0:
+		httputil.BadRequest(w, "Il rifornimento deve essere positivo")
+		return
+	case req.Reason == models.StockReasonWaste && req.Delta > 0:
+		req.Delta = -req.Delta // Lo scarto toglie sempre dal magazzino
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, item := loadInventoryItem(ctx, w, r, restaurant)
+	if item == nil {
+		return
+	}
+	if item.Inventory == nil {
+		httputil.Conflict(w, "Il piatto non ha una giacenza: attivala prima di registrare movimenti")
+		return
+	}
+
+	menu, item, change, err := changeItemStock(ctx, menu.ID, item.ID, func(item *models.MenuItem) (models.StockChange, error) {
+		if item.Inventory == nil {
+			return models.StockChange{}, errors.New("giacenza disattivata")
+		}
+		if req.Reason == models.StockReasonCount {
+			return item.SetStock(*req.Quantity, time.Now()), nil
+		}
+		return item.AdjustStock(req.Delta, time.Now())
+	})
+	if err != nil {
+		respondStockError(w, r, err)
+		return
+	}
+	if item == nil {
+		httputil.NotFound(w, "Piatto")
+		return
+	}
+
+	recordStockChange(ctx, menu, item, change, stockUpdate{
+		Reason:  req.Reason,
+		Note:    strings.TrimSpace(req.Note),
+		ActorID: requestActorID(r),
+	})
+	httputil.Success(w, "Giacenza aggiornata", item)
+}
+
+// ItemInventoryAdjustmentsHandler elenca i movimenti di magazzino di un piatto, dal più
+// recente (GET /api/v1/items/{id}/inventory/adjustments)
+func ItemInventoryAdjustmentsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	query, err := httputil.ParseListQuery(r, stockAdjustmentsQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	adjustments, total, err := db.MongoInstance.FindStockAdjustments(ctx, db.StockAdjustmentFilter{
+		RestaurantID: restaurant.ID,
+		ItemID:       mux.Vars(r)["id"],
+		Reason:       query.Filter("reason"),
+	}, dbListOptions(query))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei movimenti di magazzino")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, adjustments, query, total)
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/ai"
+	"qr-menu/pkg/config"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+	"qr-menu/security"
+)
+
+// aiProvider genera i testi suggeriti ai ristoranti; nil disattiva i suggerimenti.
+// aiSettings contiene i piani abilitati e il limite orario per ristorante
+var (
+	aiProvider   ai.Provider
+	aiSettings   = config.Default().AI
+	aiSettingsMu sync.RWMutex
+)
+
+// SetAIProvider imposta il modello linguistico dei suggerimenti (nil per disattivarli)
+func SetAIProvider(provider ai.Provider, cfg config.AIConfig) {
+	aiSettingsMu.Lock()
+	defer aiSettingsMu.Unlock()
+	aiProvider = provider
+	aiSettings = cfg
+}
+
+// suggestDescriptionRequest è il corpo opzionale della richiesta di suggerimenti
+type suggestDescriptionRequest struct {
+	Locale string `json:"locale"` // Lingua delle descrizioni; predefinita quella del proprietario
+	Count  int    `json:"count"`  // Numero di alternative, al massimo ai.MaxSuggestions
+}
+
+// aiPlanAllowed indica se il piano del ristorante include i suggerimenti
+func aiPlanAllowed(ctx context.Context, restaurantID string, plans []string) (bool, error) {
+	if len(plans) == 0 {
+		return true, nil
+	}
+	planID := models.FreePlanID
+	sub, err := db.MongoInstance.GetActiveSubscription(ctx, restaurantID)
+	if err != nil {
+		return false, err
+	}
+	if sub != nil {
+		planID = sub.PlanID
+	}
+	for _, plan := range plans {
+		if plan == planID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// findRestaurantItem cerca il piatto tra i menu del ristorante; restituisce nil se non esiste
+func findRestaurantItem(ctx context.Context, restaurantID, itemID string) (*models.Menu, *models.MenuCategory, *models.MenuItem, error) {
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurantID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for _, menu := range menus {
+		for i := range menu.Categories {
+			category := &menu.Categories[i]
+			for j := range category.Items {
+				if category.Items[j].ID == itemID {
+					return menu, category, &category.Items[j], nil
+				}
+			}
+		}
+	}
+	return nil, nil, nil, nil
+}
+
+// suggestionLocale sceglie la lingua dei suggerimenti: quella richiesta, altrimenti quella
+// del proprietario del ristorante, altrimenti la lingua predefinita
+func suggestionLocale(ctx context.Context, restaurant *models.Restaurant, requested string) string {
+	if requested = strings.ToLower(strings.TrimSpace(requested)); requested != "" {
+		if i := strings.IndexAny(requested, "-_"); i > 0 {
+			requested = requested[:i]
+		}
+		return requested
+	}
+	if owner, err := db.MongoInstance.GetUserByID(ctx, restaurant.OwnerID); err == nil && owner != nil {
+		return i18n.Default().Resolve(owner.Locale)
+	}
+	return i18n.Default().DefaultLanguage()
+}
+
+// SuggestItemDescriptionHandler propone descrizioni alternative di un piatto generate dal
+// modello linguistico configurato, nella lingua del ristorante. È riservato ai piani abilitati
+// e limitato a un numero di richieste orarie per ristorante
+// (POST /api/v1/items/{id}/suggest-description)
+func SuggestItemDescriptionHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	aiSettingsMu.RLock()
+	provider, settings := aiProvider, aiSettings
+	aiSettingsMu.RUnlock()
+	if provider == nil {
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Suggerimenti automatici non disponibili")
+		return
+	}
+
+	var req suggestDescriptionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httputil.BadRequest(w, "Formato JSON non valido")
+			return
+		}
+	}
+	if req.Count < 0 || req.Count > ai.MaxSuggestions {
+		httputil.BadRequest(w, "Il numero di suggerimenti deve essere compreso tra 1 e "+strconv.Itoa(ai.MaxSuggestions))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	allowed, err := aiPlanAllowed(ctx, restaurant.ID, settings.Plans)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dell'abbonamento")
+		return
+	}
+	if !allowed {
+		httputil.ErrorMessage(w, http.StatusPaymentRequired, "I suggerimenti automatici non sono inclusi nel piano attuale")
+		return
+	}
+
+	menu, category, item, err := findRestaurantItem(ctx, restaurant.ID, mux.Vars(r)["id"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del piatto")
+		return
+	}
+	if item == nil {
+		httputil.NotFound(w, "Piatto")
+		return
+	}
+
+	// Il limite vale per ristorante, qualunque sia l'utente o la chiave API che chiede
+	if groupLimiter != nil && settings.HourlyLimit > 0 {
+		limit := security.RateLimitConfig{RequestsPerSecond: float64(settings.HourlyLimit) / 3600, BurstSize: settings.HourlyLimit}
+		ok, remaining := groupLimiter.Take(r.Context(), "ai:restaurant:"+restaurant.ID, limit)
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.BurstSize))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(security.RetryAfter(limit)))
+			httputil.ErrorMessage(w, http.StatusTooManyRequests, "Limite orario di suggerimenti raggiunto, riprova più tardi")
+			return
+		}
+	}
+
+	locale := suggestionLocale(ctx, restaurant, req.Locale)
+	genCtx, genCancel := context.WithTimeout(r.Context(), settings.Timeout+5*time.Second)
+	defer genCancel()
+	suggestions, err := ai.SuggestItemDescriptions(genCtx, provider, ai.ItemDescriptionRequest{
+		RestaurantName: restaurant.Name,
+		MenuName:       menu.Name,
+		Category:       category.Name,
+		ItemName:       item.Name,
+		Current:        item.Description,
+		Tags:           item.Tags,
+		Price:          item.Price,
+		Language:       locale,
+		Count:          req.Count,
+	})
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella generazione dei suggerimenti", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+			"item_id":       item.ID,
+		})
+		if errors.Is(err, ai.ErrNoSuggestions) {
+			httputil.ErrorMessage(w, http.StatusBadGateway, "Il modello non ha restituito suggerimenti")
+		} else {
+			httputil.ErrorMessage(w, http.StatusBadGateway, "Servizio di suggerimenti non raggiungibile")
+		}
+		return
+	}
+
+	RecordAuditLogAsync("ITEM_DESCRIPTION_SUGGESTED", "menu_item", item.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Suggerimenti generati", map[string]interface{}{
+		"item_id":     item.ID,
+		"menu_id":     menu.ID,
+		"locale":      locale,
+		"suggestions": suggestions,
+	})
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/net/websocket"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+)
+
+const (
+	// kdsMaxOrders è il numero massimo di ordini in preparazione mostrati dal KDS
+	kdsMaxOrders = 200
+	// kdsRecentReady è il numero di ordini pronti che il KDS tiene per poterli richiamare
+	kdsRecentReady = 12
+	// kdsPingInterval è ogni quanto il feed manda un messaggio di keep-alive, così proxy e
+	// tablet non chiudono la connessione nei momenti senza ordini
+	kdsPingInterval = 30 * time.Second
+	// kdsWriteTimeout è il tempo massimo per consegnare un messaggio a un tablet
+	kdsWriteTimeout = 10 * time.Second
+	// kdsSendBuffer è il numero di messaggi in attesa per tablet: oltre, il tablet è troppo
+	// lento e viene disconnesso (al ricollegamento riceve di nuovo tutti gli ordini)
+	kdsSendBuffer = 32
+)
+
+// kdsMessage è un messaggio del feed del KDS: "snapshot" con gli ordini aperti alla
+// connessione, "order" a ogni ordine nuovo o aggiornato, "ping" come keep-alive
+type kdsMessage struct {
+	Type   string          `json:"type"`
+	Orders []*models.Order `json:"orders,omitempty"`
+	Order  *models.Order   `json:"order,omitempty"`
+}
+
+// kdsClient è un tablet collegato al feed del KDS
+type kdsClient struct {
+	send chan []byte
+}
+
+// kdsHub tiene i tablet collegati al feed, per ristorante
+type kdsHub struct {
+	mu      sync.Mutex
+	clients map[string]map[*kdsClient]bool
+}
+
+var kitchenDisplays = &kdsHub{clients: make(map[string]map[*kdsClient]bool)}
+
+func (h *kdsHub) add(restaurantID string, client *kdsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[restaurantID] == nil {
+		h.clients[restaurantID] = make(map[*kdsClient]bool)
+	}
+	h.clients[restaurantID][client] = true
+}
+
+func (h *kdsHub) remove(restaurantID string, client *kdsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.clients[restaurantID][client] {
+		return
+	}
+	delete(h.clients[restaurantID], client)
+	if len(h.clients[restaurantID]) == 0 {
+		delete(h.clients, restaurantID)
+	}
+	close(client.send)
+}
+
+// connected indica se il ristorante ha almeno un tablet collegato
+func (h *kdsHub) connected(restaurantID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients[restaurantID]) > 0
+}
+
+// broadcast manda il messaggio ai tablet del ristorante, disconnettendo quelli che non
+// riescono a starci dietro
+func (h *kdsHub) broadcast(restaurantID string, payload []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients[restaurantID] {
+		select {
+		case client.send <- payload:
+		default:
+			delete(h.clients[restaurantID], client)
+			close(client.send)
+		}
+	}
+	if len(h.clients[restaurantID]) == 0 {
+		delete(h.clients, restaurantID)
+	}
+}
+
+// refreshKDSOnEvent manda ai tablet del ristorante l'ordine creato o aggiornato, anche da
+// un'altra istanza
+func refreshKDSOnEvent(ctx context.Context, event events.Event) error {
+	if db.MongoInstance == nil || !kitchenDisplays.connected(event.RestaurantID) {
+		return nil
+	}
+	orderID, _ := event.Data["order_id"].(string)
+	order, err := db.MongoInstance.GetOrder(ctx, orderID, event.RestaurantID)
+	if err != nil || order == nil {
+		return err
+	}
+	payload, err := json.Marshal(kdsMessage{Type: "order", Order: order})
+	if err != nil {
+		return err
+	}
+	kitchenDisplays.broadcast(event.RestaurantID, payload)
+	return nil
+}
+
+// loadKDSOrders carica gli ordini da mostrare al collegamento di un tablet: quelli in
+// preparazione, dal più vecchio, e gli ultimi pronti, che si possono ancora richiamare
+func loadKDSOrders(ctx context.Context, restaurantID string) ([]*models.Order, error) {
+	since := time.Now().Add(-24 * time.Hour)
+	open, _, err := db.MongoInstance.FindOrders(ctx, db.OrderFilter{
+		RestaurantID: restaurantID,
+		Statuses:     []string{models.OrderStatusNew, models.OrderStatusPreparing},
+		Since:        since,
+	}, db.ListOptions{Limit: kdsMaxOrders, Sort: []string{"created_at"}})
+	if err != nil {
+		return nil, err
+	}
+	ready, _, err := db.MongoInstance.FindOrders(ctx, db.OrderFilter{
+		RestaurantID: restaurantID,
+		Statuses:     []string{models.OrderStatusReady},
+		Since:        since,
+	}, db.ListOptions{Limit: kdsRecentReady, Sort: []string{"-updated_at"}})
+	if err != nil {
+		return nil, err
+	}
+	return append(open, ready...), nil
+}
+
+// KDSHandler mostra il Kitchen Display System (GET /kds): gli ordini in arrivo raggruppati per
+// postazione, pensato per i tablet della cucina. ?station= mostra una sola postazione
+func KDSHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	data := struct {
+		Restaurant *models.Restaurant
+		Station    string
+		CSRFToken  string
+	}{
+		Restaurant: restaurant,
+		Station:    r.URL.Query().Get("station"),
+		CSRFToken:  csrfToken(w, r),
+	}
+	renderTemplate(w, "kds", data)
+}
+
+// KDSFeedHandler apre il feed WebSocket del KDS (GET /kds/ws): alla connessione manda gli
+// ordini aperti, poi ogni ordine nuovo o aggiornato del ristorante
+func KDSFeedHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+	server := websocket.Server{
+		Handshake: checkKDSOrigin,
+		Handler: func(ws *websocket.Conn) {
+			serveKDSFeed(ws, restaurant.ID)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// checkKDSOrigin accetta solo le connessioni aperte dalle pagine dell'applicazione: il feed
+// usa il cookie di sessione, e un altro sito non deve poterlo leggere
+func checkKDSOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	if origin == nil || origin.Host != r.Host {
+		return errors.New("origine del WebSocket non consentita")
+	}
+	config.Origin = origin
+	return nil
+}
+
+func serveKDSFeed(ws *websocket.Conn, restaurantID string) {
+	defer ws.Close()
+	// La connessione presa dal server HTTP ne conserva i timeout: il feed resta aperto
+	ws.SetDeadline(time.Time{})
+
+	client := &kdsClient{send: make(chan []byte, kdsSendBuffer)}
+	kitchenDisplays.add(restaurantID, client)
+	defer kitchenDisplays.remove(restaurantID, client)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	orders, err := loadKDSOrders(ctx, restaurantID)
+	cancel()
+	if err != nil {
+		logger.Error("Errore nel caricamento degli ordini del KDS", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurantID,
+		})
+		return
+	}
+	if !sendKDSMessage(ws, kdsMessage{Type: "snapshot", Orders: orders}) {
+		return
+	}
+
+	// Il tablet non manda messaggi: la lettura serve ad accorgersi della disconnessione
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	ping := time.NewTicker(kdsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case payload, ok := <-client.send:
+			if !ok {
+				return
+			}
+			ws.SetWriteDeadline(time.Now().Add(kdsWriteTimeout))
+			if websocket.Message.Send(ws, string(payload)) != nil {
+				return
+			}
+		case <-ping.C:
+			if !sendKDSMessage(ws, kdsMessage{Type: "ping"}) {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func sendKDSMessage(ws *websocket.Conn, msg kdsMessage) bool {
+	ws.SetWriteDeadline(time.Now().Add(kdsWriteTimeout))
+	return websocket.JSON.Send(ws, msg) == nil
+}
+
+// BumpOrderHandler segna come pronte righe di un ordine (POST /api/v1/orders/{id}/bump con
+// {"line_ids": ["..."]}); senza righe segna pronto l'intero ordine
+func BumpOrderHandler(w http.ResponseWriter, r *http.Request) {
+	changeOrderLines(w, r, true)
+}
+
+// RecallOrderHandler riporta in preparazione righe segnate pronte per errore
+// (POST /api/v1/orders/{id}/recall); senza righe richiama l'intero ordine
+func RecallOrderHandler(w http.ResponseWriter, r *http.Request) {
+	changeOrderLines(w, r, false)
+}
+
+func changeOrderLines(w http.ResponseWriter, r *http.Request, bump bool) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	var req struct {
+		LineIDs []string `json:"line_ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httputil.BadRequest(w, "Formato JSON non valido")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	order, err := changeOrder(ctx, restaurant.ID, mux.Vars(r)["id"], func(order *models.Order) error {
+		if bump {
+			return order.BumpLines(req.LineIDs, time.Now())
+		}
+		return order.RecallLines(req.LineIDs, time.Now())
+	})
+	if err != nil {
+		respondOrderError(w, r, err, "Errore nell'aggiornamento dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+
+	publishOrderEvent(events.OrderUpdated, order, requestActorID(r))
+	httputil.Success(w, "Ordine aggiornato", order)
+}
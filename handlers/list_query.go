@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"qr-menu/db"
+	httputil "qr-menu/pkg/http"
+)
+
+// dbListOptions converte paginazione e ordinamento di una richiesta di elenco nelle opzioni
+// di ricerca del database. I campi ordinabili degli endpoint coincidono con quelli bson
+func dbListOptions(query httputil.ListQuery) db.ListOptions {
+	return db.ListOptions{
+		Skip:  int64(query.Offset()),
+		Limit: int64(query.PerPage),
+		Sort:  query.SortKeys(),
+	}
+}
@@ -0,0 +1,757 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+)
+
+const (
+	// loyaltyVisitTTL è la validità del codice di una visita: il cliente lo raccoglie al tavolo
+	// o appena uscito, non giorni dopo
+	loyaltyVisitTTL = 2 * time.Hour
+	// loyaltyCollectsPerDevice è il numero massimo di raccolte di punti dallo stesso dispositivo
+	// in un giorno, per qualunque tessera: limita chi raccoglie i codici di altri tavoli
+	loyaltyCollectsPerDevice = 3
+	// maxLoyaltyVisitsPerDay è il valore massimo di visite al giorno per tessera configurabile
+	maxLoyaltyVisitsPerDay = 10
+	// loyaltyCardTransactions è il numero di movimenti recenti mostrati con la tessera
+	loyaltyCardTransactions = 20
+	// maxLoyaltyBody è la dimensione massima del corpo delle richieste pubbliche
+	maxLoyaltyBody = 4 << 10
+
+	// Lunghezza dei codici delle visite e dei numeri delle tessere
+	loyaltyVisitCodeLength  = 6
+	loyaltyCardNumberLength = 8
+)
+
+const (
+	// codeAttempts è il numero di tentativi di generare un codice non ancora usato
+	codeAttempts = 5
+	// codeAlphabet è l'alfabeto dei codici da digitare (visite, tessere, buoni regalo): esclude
+	// i caratteri che si confondono (0/O, 1/I) e ha 32 simboli, così ogni byte casuale ne
+	// sceglie uno senza distorsioni
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// loyaltyTokenHeader è l'header con cui il dispositivo del cliente presenta il token della tessera
+const loyaltyTokenHeader = "X-Loyalty-Token"
+
+var loyaltyTransactionQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     200,
+	DefaultSort:    "-created_at",
+	Sortable:       []string{"created_at", "points"},
+	Filterable:     []string{"type", "card_id"},
+}
+
+// defaultLoyaltyProgram è il programma di un ristorante che non l'ha ancora configurato
+func defaultLoyaltyProgram() *models.LoyaltyProgram {
+	return &models.LoyaltyProgram{PointsPerVisit: 10, VisitsPerDay: 1, Rewards: []models.LoyaltyReward{}}
+}
+
+// restaurantLoyalty restituisce il programma fedeltà del ristorante, quello predefinito (non
+// attivo) se non è configurato
+func restaurantLoyalty(restaurant *models.Restaurant) *models.LoyaltyProgram {
+	if restaurant.Loyalty == nil {
+		return defaultLoyaltyProgram()
+	}
+	return restaurant.Loyalty
+}
+
+// randomCode genera un codice casuale di n caratteri dell'alfabeto dei codici
+func randomCode(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// normalizeCode rende confrontabile un codice digitato dal cliente o dalla cassa: maiuscolo,
+// senza spazi e trattini
+func normalizeCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+}
+
+// loyaltyCollectURL è la pagina pubblica della tessera che raccoglie i punti della visita.
+// baseURL viene da emailBaseURL: il link finisce al cliente e non deve dipendere dall'Host
+// della richiesta
+func loyaltyCollectURL(baseURL string, restaurant *models.Restaurant, code string) string {
+	return baseURL + "/loyalty/" + url.PathEscape(restaurant.Username) + "?code=" + url.QueryEscape(code)
+}
+
+// loyaltyProgramRequest è il corpo della configurazione del programma fedeltà
+type loyaltyProgramRequest struct {
+	Enabled        bool                   `json:"enabled"`
+	PointsPerVisit int                    `json:"points_per_visit"`
+	VisitsPerDay   int                    `json:"visits_per_day"`
+	Rewards        []models.LoyaltyReward `json:"rewards"`
+}
+
+// newLoyaltyProgram valida la configurazione richiesta. I premi senza ID ne ricevono uno nuovo;
+// quelli esistenti lo mantengono, così i movimenti passati restano collegati
+func newLoyaltyProgram(req loyaltyProgramRequest) (*models.LoyaltyProgram, error) {
+	if req.PointsPerVisit < 1 || req.PointsPerVisit > models.MaxLoyaltyVisitPoints {
+		return nil, fmt.Errorf("points_per_visit deve essere tra 1 e %d", models.MaxLoyaltyVisitPoints)
+	}
+	if req.VisitsPerDay < 1 || req.VisitsPerDay > maxLoyaltyVisitsPerDay {
+		return nil, fmt.Errorf("visits_per_day deve essere tra 1 e %d", maxLoyaltyVisitsPerDay)
+	}
+	if len(req.Rewards) > models.MaxLoyaltyRewards {
+		return nil, fmt.Errorf("massimo %d premi", models.MaxLoyaltyRewards)
+	}
+
+	program := &models.LoyaltyProgram{
+		Enabled:        req.Enabled,
+		PointsPerVisit: req.PointsPerVisit,
+		VisitsPerDay:   req.VisitsPerDay,
+		Rewards:        make([]models.LoyaltyReward, 0, len(req.Rewards)),
+	}
+	seen := make(map[string]bool)
+	for _, reward := range req.Rewards {
+		reward.Name = strings.TrimSpace(reward.Name)
+		reward.Description = strings.TrimSpace(reward.Description)
+		if reward.Name == "" || utf8.RuneCountInString(reward.Name) > 100 {
+			return nil, errors.New("Il nome del premio è obbligatorio (massimo 100 caratteri)")
+		}
+		if utf8.RuneCountInString(reward.Description) > 500 {
+			return nil, errors.New("La descrizione del premio supera i 500 caratteri")
+		}
+		if reward.Points < 1 {
+			return nil, fmt.Errorf("Il premio %q deve costare almeno un punto", reward.Name)
+		}
+		if reward.ID == "" {
+			reward.ID = uuid.New().String()
+		}
+		if seen[reward.ID] {
+			return nil, fmt.Errorf("ID premio duplicato: %s", reward.ID)
+		}
+		seen[reward.ID] = true
+		program.Rewards = append(program.Rewards, reward)
+	}
+	return program, nil
+}
+
+// GetLoyaltyProgramHandler restituisce il programma fedeltà del ristorante
+// (GET /api/v1/loyalty/program)
+func GetLoyaltyProgramHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	httputil.Success(w, "", restaurantLoyalty(restaurant))
+}
+
+// UpdateLoyaltyProgramHandler configura il programma fedeltà del ristorante: punti per visita,
+// visite al giorno per tessera e premi (PUT /api/v1/loyalty/program)
+func UpdateLoyaltyProgramHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req loyaltyProgramRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	program, err := newLoyaltyProgram(req)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.SetRestaurantLoyalty(ctx, restaurant.ID, program); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio del programma fedeltà")
+		return
+	}
+
+	RecordAuditLogAsync("LOYALTY_PROGRAM_UPDATED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Programma fedeltà aggiornato", program)
+}
+
+// loyaltyVisitView è il codice di una visita con i link da mostrare al cliente
+type loyaltyVisitView struct {
+	*models.LoyaltyVisit
+	CollectURL string `json:"collect_url"`
+	QRURL      string `json:"qr_url"`
+}
+
+func newLoyaltyVisitView(baseURL string, restaurant *models.Restaurant, visit *models.LoyaltyVisit) loyaltyVisitView {
+	return loyaltyVisitView{
+		LoyaltyVisit: visit,
+		CollectURL:   loyaltyCollectURL(baseURL, restaurant, visit.Code),
+		QRURL:        "/api/v1/loyalty/visits/" + url.PathEscape(visit.ID) + "/qr",
+	}
+}
+
+// CreateLoyaltyVisitHandler genera alla cassa il codice di una visita, da mostrare al cliente
+// come QR code o da digitare (POST /api/v1/loyalty/visits). Con order_id è idempotente: lo
+// stesso ordine restituisce sempre la stessa visita
+func CreateLoyaltyVisitHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	program := restaurantLoyalty(restaurant)
+	if !program.Enabled {
+		httputil.Conflict(w, "Il programma fedeltà non è attivo")
+		return
+	}
+
+	var req struct {
+		Points  int    `json:"points"` // Se omesso, i punti per visita del programma
+		OrderID string `json:"order_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if req.Points == 0 {
+		req.Points = program.PointsPerVisit
+	}
+	if req.Points < 1 || req.Points > models.MaxLoyaltyVisitPoints {
+		httputil.BadRequest(w, fmt.Sprintf("points deve essere tra 1 e %d", models.MaxLoyaltyVisitPoints))
+		return
+	}
+	baseURL, err := emailBaseURL()
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella creazione della visita")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if req.OrderID != "" {
+		order, err := db.MongoInstance.GetOrder(ctx, req.OrderID, restaurant.ID)
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nella creazione della visita")
+			return
+		}
+		if order == nil {
+			httputil.BadRequest(w, "Ordine non trovato")
+			return
+		}
+		existing, err := db.MongoInstance.GetLoyaltyVisitByOrder(ctx, restaurant.ID, order.ID)
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nella creazione della visita")
+			return
+		}
+		if existing != nil {
+			httputil.Success(w, "Visita già registrata per l'ordine", newLoyaltyVisitView(baseURL, restaurant, existing))
+			return
+		}
+	}
+
+	now := time.Now()
+	visit := &models.LoyaltyVisit{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurant.ID,
+		Points:       req.Points,
+		OrderID:      req.OrderID,
+		CreatedBy:    requestActorID(r),
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(loyaltyVisitTTL),
+	}
+	err = createWithRandomCode(loyaltyVisitCodeLength, db.ErrDuplicateLoyaltyCode, func(code string) error {
+		visit.Code = code
+		return db.MongoInstance.CreateLoyaltyVisit(ctx, visit)
+	})
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella creazione della visita")
+		return
+	}
+
+	RecordAuditLogAsync("LOYALTY_VISIT_CREATED", "loyalty_visit", visit.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Created(w, "Visita creata", newLoyaltyVisitView(baseURL, restaurant, visit))
+}
+
+// createWithRandomCode salva un documento con un nuovo codice casuale, riprovando finché
+// create restituisce duplicate perché il codice è già usato nel ristorante
+func createWithRandomCode(length int, duplicate error, create func(code string) error) error {
+	for attempt := 0; attempt < codeAttempts; attempt++ {
+		code, err := randomCode(length)
+		if err != nil {
+			return fmt.Errorf("errore generazione codice: %v", err)
+		}
+		err = create(code)
+		if !errors.Is(err, duplicate) {
+			return err
+		}
+	}
+	return errors.New("impossibile generare un codice univoco")
+}
+
+// LoyaltyVisitQRHandler restituisce il QR code PNG della visita, che apre la tessera del
+// cliente e raccoglie i punti (GET /api/v1/loyalty/visits/{id}/qr)
+func LoyaltyVisitQRHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	visit, err := db.MongoInstance.GetLoyaltyVisit(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero della visita")
+		return
+	}
+	if visit == nil {
+		httputil.NotFound(w, "Visita")
+		return
+	}
+
+	baseURL, err := emailBaseURL()
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella generazione del QR code")
+		return
+	}
+	png, err := qrcode.Encode(loyaltyCollectURL(baseURL, restaurant, visit.Code), qrcode.Medium, 256)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella generazione del QR code")
+		return
+	}
+	// Il codice è monouso: il QR non deve restare nelle cache
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+// loyaltyCardView è la tessera come la vede il cliente: saldo e premi, con quelli già
+// raggiungibili. Il token compare solo alla creazione della tessera
+type loyaltyCardView struct {
+	Number      string              `json:"number"`
+	Points      int                 `json:"points"`
+	Visits      int                 `json:"visits"`
+	LastVisitAt *time.Time          `json:"last_visit_at,omitempty"`
+	Token       string              `json:"token,omitempty"`
+	Rewards     []loyaltyRewardView `json:"rewards"`
+}
+
+type loyaltyRewardView struct {
+	models.LoyaltyReward
+	Available bool `json:"available"`
+}
+
+func newLoyaltyCardView(program *models.LoyaltyProgram, card *models.LoyaltyCard) loyaltyCardView {
+	view := loyaltyCardView{Rewards: make([]loyaltyRewardView, 0, len(program.Rewards))}
+	if card != nil {
+		view.Number = card.Number
+		view.Points = card.Points
+		view.Visits = card.Visits
+		view.LastVisitAt = card.LastVisitAt
+	}
+	for _, reward := range program.Rewards {
+		view.Rewards = append(view.Rewards, loyaltyRewardView{LoyaltyReward: reward, Available: view.Points >= reward.Points})
+	}
+	return view
+}
+
+// loyaltyRestaurant trova il ristorante pubblico con il programma fedeltà attivo; risponde 404
+// e restituisce nil se non esiste
+func loyaltyRestaurant(ctx context.Context, w http.ResponseWriter, r *http.Request) *models.Restaurant {
+	restaurant, err := db.MongoInstance.GetRestaurantByUsername(ctx, mux.Vars(r)["username"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del programma fedeltà")
+		return nil
+	}
+	if restaurant == nil || !restaurant.IsActive || !restaurantLoyalty(restaurant).Enabled {
+		httputil.NotFound(w, "Programma fedeltà")
+		return nil
+	}
+	return restaurant
+}
+
+// loyaltyCardFromToken trova la tessera del token presentato dal dispositivo. Restituisce nil
+// se il token manca o non corrisponde a una tessera del ristorante
+func loyaltyCardFromToken(ctx context.Context, restaurantID, token string) (*models.LoyaltyCard, error) {
+	if token == "" {
+		return nil, nil
+	}
+	return db.MongoInstance.GetLoyaltyCardByToken(ctx, restaurantID, hashVerificationToken(token))
+}
+
+// CollectLoyaltyPointsHandler raccoglie i punti di una visita sulla tessera del cliente
+// (POST /api/v1/public/loyalty/{username}/collect). Senza card_token, o con un token non
+// valido, crea una nuova tessera e ne restituisce il token, che il dispositivo conserva.
+// Il codice vale una volta sola; la stessa tessera e lo stesso dispositivo raccolgono un
+// numero limitato di visite al giorno
+func CollectLoyaltyPointsHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code      string `json:"code"`
+		CardToken string `json:"card_token"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxLoyaltyBody)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	code := normalizeCode(req.Code)
+	if code == "" {
+		httputil.BadRequest(w, "Il codice della visita è obbligatorio")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restaurant := loyaltyRestaurant(ctx, w, r)
+	if restaurant == nil {
+		return
+	}
+	program := restaurantLoyalty(restaurant)
+
+	now := time.Now()
+	today := now.UTC().Truncate(24 * time.Hour)
+	visitorHash := dailyVisitorHash(r, restaurant.ID, today)
+	collected, err := db.MongoInstance.CountLoyaltyTransactions(ctx, db.LoyaltyTransactionFilter{
+		RestaurantID: restaurant.ID,
+		Type:         models.LoyaltyEarn,
+		VisitorHash:  visitorHash,
+		Since:        today,
+	})
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella raccolta dei punti")
+		return
+	}
+	if collected >= loyaltyCollectsPerDevice {
+		logger.WarnCtx(r.Context(), "Limite giornaliero di raccolte punti per dispositivo superato", map[string]interface{}{
+			"restaurant_id": restaurant.ID,
+		})
+		httputil.ErrorMessage(w, http.StatusTooManyRequests, "Hai già raccolto troppi punti oggi da questo dispositivo")
+		return
+	}
+
+	card, err := loyaltyCardFromToken(ctx, restaurant.ID, req.CardToken)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella raccolta dei punti")
+		return
+	}
+	if card != nil {
+		visits, err := db.MongoInstance.CountLoyaltyTransactions(ctx, db.LoyaltyTransactionFilter{
+			RestaurantID: restaurant.ID,
+			CardID:       card.ID,
+			Type:         models.LoyaltyEarn,
+			Since:        today,
+		})
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nella raccolta dei punti")
+			return
+		}
+		if visits >= int64(program.VisitsPerDay) {
+			httputil.ErrorMessage(w, http.StatusTooManyRequests, "Questa tessera ha già raccolto i punti di oggi")
+			return
+		}
+	}
+
+	// La tessera nuova si crea solo se il codice è valido: l'ID serve già per riservare la visita
+	cardID := uuid.New().String()
+	if card != nil {
+		cardID = card.ID
+	}
+	visit, err := db.MongoInstance.ClaimLoyaltyVisit(ctx, restaurant.ID, code, cardID, now)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella raccolta dei punti")
+		return
+	}
+	if visit == nil {
+		httputil.BadRequest(w, "Codice non valido, scaduto o già usato")
+		return
+	}
+
+	var token string
+	if card == nil {
+		token, err = newLoyaltyToken()
+		if err == nil {
+			card = &models.LoyaltyCard{
+				ID:           cardID,
+				RestaurantID: restaurant.ID,
+				TokenHash:    hashVerificationToken(token),
+				CreatedAt:    now,
+			}
+			err = createWithRandomCode(loyaltyCardNumberLength, db.ErrDuplicateLoyaltyCode, func(number string) error {
+				card.Number = number
+				return db.MongoInstance.CreateLoyaltyCard(ctx, card)
+			})
+		}
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nella creazione della tessera")
+			return
+		}
+	}
+
+	card, err = db.MongoInstance.AddLoyaltyPoints(ctx, card.ID, visit.Points, true, now)
+	if err == nil && card == nil {
+		err = errors.New("tessera fedeltà non trovata")
+	}
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella raccolta dei punti")
+		return
+	}
+	transaction := &models.LoyaltyTransaction{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurant.ID,
+		CardID:       card.ID,
+		Type:         models.LoyaltyEarn,
+		Points:       visit.Points,
+		Balance:      card.Points,
+		VisitID:      visit.ID,
+		CreatedAt:    now,
+		VisitorHash:  visitorHash,
+	}
+	if err := db.MongoInstance.CreateLoyaltyTransaction(ctx, transaction); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella registrazione del movimento di punti", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+			"card_id":       card.ID,
+		})
+	}
+
+	view := newLoyaltyCardView(program, card)
+	view.Token = token
+	httputil.Success(w, fmt.Sprintf("Hai raccolto %d punti", visit.Points), view)
+}
+
+// newLoyaltyToken genera il token di una nuova tessera
+func newLoyaltyToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("errore generazione token tessera: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// PublicLoyaltyCardHandler restituisce al cliente la sua tessera, indicata dal token
+// nell'header X-Loyalty-Token (GET /api/v1/public/loyalty/{username}/card). Senza tessera
+// restituisce comunque i premi del programma
+func PublicLoyaltyCardHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restaurant := loyaltyRestaurant(ctx, w, r)
+	if restaurant == nil {
+		return
+	}
+	card, err := loyaltyCardFromToken(ctx, restaurant.ID, r.Header.Get(loyaltyTokenHeader))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero della tessera")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", newLoyaltyCardView(restaurantLoyalty(restaurant), card))
+}
+
+// staffLoyaltyCard trova la tessera del ristorante dal numero nel percorso; risponde 404 e
+// restituisce nil se non esiste
+func staffLoyaltyCard(ctx context.Context, w http.ResponseWriter, r *http.Request, restaurant *models.Restaurant) *models.LoyaltyCard {
+	card, err := db.MongoInstance.GetLoyaltyCardByNumber(ctx, restaurant.ID, normalizeCode(mux.Vars(r)["number"]))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero della tessera")
+		return nil
+	}
+	if card == nil {
+		httputil.NotFound(w, "Tessera")
+		return nil
+	}
+	return card
+}
+
+// GetLoyaltyCardHandler restituisce alla cassa la tessera con il saldo e gli ultimi movimenti
+// (GET /api/v1/loyalty/cards/{number})
+func GetLoyaltyCardHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	card := staffLoyaltyCard(ctx, w, r, restaurant)
+	if card == nil {
+		return
+	}
+	transactions, _, err := db.MongoInstance.FindLoyaltyTransactions(ctx,
+		db.LoyaltyTransactionFilter{RestaurantID: restaurant.ID, CardID: card.ID},
+		db.ListOptions{Limit: loyaltyCardTransactions})
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero della tessera")
+		return
+	}
+	httputil.Success(w, "", map[string]interface{}{
+		"card":         card,
+		"rewards":      newLoyaltyCardView(restaurantLoyalty(restaurant), card).Rewards,
+		"transactions": transactions,
+	})
+}
+
+// RedeemLoyaltyRewardHandler riscatta alla cassa un premio con i punti della tessera
+// (POST /api/v1/loyalty/cards/{number}/redeem). Risponde 409 se il saldo non basta
+func RedeemLoyaltyRewardHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req struct {
+		RewardID string `json:"reward_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	program := restaurantLoyalty(restaurant)
+	reward := program.Reward(req.RewardID)
+	if reward == nil {
+		httputil.BadRequest(w, "Premio non trovato")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	card := staffLoyaltyCard(ctx, w, r, restaurant)
+	if card == nil {
+		return
+	}
+	// Il saldo si controlla nello stesso aggiornamento: due riscatti insieme non lo mandano sotto zero
+	updated, err := db.MongoInstance.AddLoyaltyPoints(ctx, card.ID, -reward.Points, false, time.Now())
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel riscatto del premio")
+		return
+	}
+	if updated == nil {
+		httputil.Conflict(w, fmt.Sprintf("Punti insufficienti: servono %d punti, la tessera ne ha %d", reward.Points, card.Points))
+		return
+	}
+
+	transaction := &models.LoyaltyTransaction{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurant.ID,
+		CardID:       updated.ID,
+		Type:         models.LoyaltyRedeem,
+		Points:       -reward.Points,
+		Balance:      updated.Points,
+		RewardID:     reward.ID,
+		RewardName:   reward.Name,
+		ActorID:      requestActorID(r),
+		CreatedAt:    time.Now(),
+	}
+	if err := db.MongoInstance.CreateLoyaltyTransaction(ctx, transaction); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella registrazione del movimento di punti", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+			"card_id":       updated.ID,
+		})
+	}
+
+	RecordAuditLogAsync("LOYALTY_REWARD_REDEEMED", "loyalty_card", updated.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Premio riscattato", map[string]interface{}{
+		"card":        updated,
+		"transaction": transaction,
+	})
+}
+
+// ListLoyaltyTransactionsHandler elenca i movimenti di punti del ristorante, filtrabili per
+// tipo e tessera (GET /api/v1/loyalty/transactions)
+func ListLoyaltyTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	query, err := httputil.ParseListQuery(r, loyaltyTransactionQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	transactionType := query.Filter("type")
+	if transactionType != "" && transactionType != models.LoyaltyEarn && transactionType != models.LoyaltyRedeem {
+		httputil.BadRequest(w, "type deve essere earn o redeem")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	transactions, total, err := db.MongoInstance.FindLoyaltyTransactions(ctx, db.LoyaltyTransactionFilter{
+		RestaurantID: restaurant.ID,
+		CardID:       query.Filter("card_id"),
+		Type:         transactionType,
+	}, dbListOptions(query))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei movimenti")
+		return
+	}
+	httputil.List(w, transactions, query, total)
+}
+
+// LoyaltyPageHandler mostra la pagina pubblica della tessera fedeltà (GET /loyalty/{username}).
+// Con ?code= la pagina raccoglie subito i punti della visita
+func LoyaltyPageHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restaurant, err := db.MongoInstance.GetRestaurantByUsername(ctx, mux.Vars(r)["username"])
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero del ristorante", map[string]interface{}{
+			"error":    err.Error(),
+			"username": mux.Vars(r)["username"],
+		})
+		http.Error(w, "Servizio temporaneamente non disponibile", http.StatusServiceUnavailable)
+		return
+	}
+	if restaurant == nil || !restaurant.IsActive || !restaurantLoyalty(restaurant).Enabled {
+		data := struct {
+			Title   string
+			Message string
+		}{
+			Title:   "Programma fedeltà non disponibile",
+			Message: "Il ristorante non ha un programma fedeltà attivo.",
+		}
+		w.WriteHeader(http.StatusNotFound)
+		renderTemplate(w, "404", data)
+		return
+	}
+
+	data := struct {
+		Restaurant *models.Restaurant
+		Program    *models.LoyaltyProgram
+		Code       string
+	}{
+		Restaurant: restaurant,
+		Program:    restaurantLoyalty(restaurant),
+		Code:       normalizeCode(r.URL.Query().Get("code")),
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	renderTemplate(w, "loyalty_card", data)
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"qr-menu/analytics"
+	"qr-menu/db"
+	"qr-menu/models"
+
+	"github.com/gorilla/mux"
+)
+
+// maxSeasonLength è la lunghezza massima dell'etichetta di una stagione archiviata
+const maxSeasonLength = 80
+
+var italianMonths = [...]string{"Gennaio", "Febbraio", "Marzo", "Aprile", "Maggio", "Giugno",
+	"Luglio", "Agosto", "Settembre", "Ottobre", "Novembre", "Dicembre"}
+
+// seasonLabel restituisce l'etichetta di default di una stagione, es. "Giugno – Settembre 2026"
+func seasonLabel(from, to time.Time) string {
+	if from.Year() == to.Year() {
+		if from.Month() == to.Month() {
+			return fmt.Sprintf("%s %d", italianMonths[to.Month()-1], to.Year())
+		}
+		return fmt.Sprintf("%s – %s %d", italianMonths[from.Month()-1], italianMonths[to.Month()-1], to.Year())
+	}
+	return fmt.Sprintf("%s %d – %s %d", italianMonths[from.Month()-1], from.Year(), italianMonths[to.Month()-1], to.Year())
+}
+
+// rejectArchivedMenu blocca le modifiche ai menu archiviati, che restano congelati.
+// Restituisce true se la richiesta è stata gestita
+func rejectArchivedMenu(w http.ResponseWriter, r *http.Request, menu *models.Menu) bool {
+	if !menu.IsArchived {
+		return false
+	}
+	http.Redirect(w, r, "/admin/archive?error=archived", http.StatusSeeOther)
+	return true
+}
+
+// ArchiveMenuHandler archivia un menu stagionale: lo toglie dai menu attivi, lo congela
+// e salva l'istantanea delle statistiche del periodo in cui è stato in uso
+func ArchiveMenuHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Solo i menu completati hanno una stagione da archiviare: le bozze si eliminano
+	menu := loadOwnedCompletedMenu(ctx, mux.Vars(r)["id"])
+	if menu == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if menu.IsArchived {
+		http.Redirect(w, r, "/admin/archive", http.StatusSeeOther)
+		return
+	}
+
+	if err := archiveMenu(ctx, restaurant, menu, r.FormValue("season")); err != nil {
+		log.Printf("Errore nell'archiviazione del menu: %v", err)
+		http.Error(w, "Errore nell'archiviazione del menu", http.StatusInternalServerError)
+		return
+	}
+
+	RecordAuditLogAsync("MENU_ARCHIVED", "menu", menu.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/admin/archive?success=menu_archived", http.StatusSeeOther)
+}
+
+// archiveMenu toglie il menu da quelli attivi, lo congela e salva l'istantanea delle
+// statistiche dalla creazione a oggi. Senza season usa l'etichetta del periodo
+func archiveMenu(ctx context.Context, restaurant *models.Restaurant, menu *models.Menu, season string) error {
+	if active := restaurant.DisplayMenuIDs(); containsMenuID(active, menu.ID) {
+		if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, removeMenuID(active, menu.ID)); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	from := menu.CreatedAt
+	if from.IsZero() {
+		from = now
+	}
+
+	var itemIDs []string
+	items := make(map[string]models.MenuItem)
+	for _, category := range menu.Categories {
+		for _, item := range category.Items {
+			itemIDs = append(itemIDs, item.ID)
+			items[item.ID] = item
+		}
+	}
+
+	period := analytics.GetAnalytics().GetMenuPeriodStats(restaurant.ID, menu.ID, itemIDs, from, now)
+	stats := &models.MenuArchiveStats{
+		PeriodStart:     from,
+		PeriodEnd:       now,
+		MenuViews:       period.MenuViews,
+		RestaurantViews: period.RestaurantViews,
+		QRScans:         period.QRScans,
+		DailyViews:      period.DailyViews,
+	}
+	for _, popular := range period.TopItems {
+		item := items[popular.ItemID]
+		stats.TopItems = append(stats.TopItems, models.ArchivedItemStat{
+			ItemID: popular.ItemID,
+			Name:   item.Name,
+			Views:  popular.Views,
+			Price:  item.Price,
+		})
+	}
+
+	season = strings.TrimSpace(sanitizeInput(season))
+	if season == "" {
+		season = seasonLabel(from, now)
+	}
+	if runes := []rune(season); len(runes) > maxSeasonLength {
+		season = string(runes[:maxSeasonLength])
+	}
+
+	menu.IsActive = false
+	menu.IsArchived = true
+	menu.ArchivedAt = now
+	menu.Season = season
+	menu.ArchiveStats = stats
+	return db.MongoInstance.UpdateMenu(ctx, menu)
+}
+
+// RestoreMenuHandler riporta un menu archiviato tra i menu completati, senza attivarlo.
+// Le statistiche dell'ultima stagione restano salvate sul menu
+func RestoreMenuHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, err := tenantMenu(ctx, mux.Vars(r)["id"])
+	if err != nil || menu == nil || !menu.IsArchived {
+		http.NotFound(w, r)
+		return
+	}
+
+	menu.IsArchived = false
+	menu.UpdatedAt = time.Now()
+	if err := db.MongoInstance.UpdateMenu(ctx, menu); err != nil {
+		log.Printf("Errore nel ripristino del menu: %v", err)
+		http.Error(w, "Errore nel ripristino del menu", http.StatusInternalServerError)
+		return
+	}
+
+	RecordAuditLogAsync("MENU_RESTORED", "menu", menu.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/admin?success=menu_restored", http.StatusSeeOther)
+}
+
+// MenuArchiveHandler mostra le stagioni archiviate, dalla più recente
+func MenuArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurant.ID)
+	if err != nil {
+		log.Printf("Errore nel recupero menu: %v", err)
+		http.Error(w, "Errore nel caricamento dell'archivio", http.StatusInternalServerError)
+		return
+	}
+
+	var archived []*models.Menu
+	for _, menu := range menus {
+		if menu.IsArchived {
+			archived = append(archived, menu)
+		}
+	}
+	sort.Slice(archived, func(i, j int) bool {
+		return archived[i].ArchivedAt.After(archived[j].ArchivedAt)
+	})
+
+	data := struct {
+		Restaurant *models.Restaurant
+		Menus      []*models.Menu
+		Success    string
+		Error      string
+		CSRFToken  string
+	}{
+		Restaurant: restaurant,
+		Menus:      archived,
+		Success:    r.URL.Query().Get("success"),
+		Error:      r.URL.Query().Get("error"),
+		CSRFToken:  csrfToken(w, r),
+	}
+
+	renderTemplate(w, "archive", data)
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/pkg/cache"
+
+	"github.com/gorilla/mux"
+)
+
+// publicMenuCache contiene le pagine renderizzate dei menu pubblici; nil le renderizza a ogni richiesta
+var (
+	publicMenuCache *cache.ResponseCache
+	publicMenuTTL   time.Duration
+)
+
+// cachedMenuRestaurantHeader porta nella voce in cache il ristorante del menu, usato per il
+// tracking delle visite. Non viene mai scritto nella risposta
+const cachedMenuRestaurantHeader = "X-Menu-Restaurant"
+
+// cachedMenuPrivacyHeader indica nella voce in cache che il ristorante ha le analytics
+// privacy-first. Come cachedMenuRestaurantHeader non viene mai scritto nella risposta
+const cachedMenuPrivacyHeader = "X-Menu-Privacy-First"
+
+// menuWarmUpRoutes sono i prefissi delle route le cui modifiche possono cambiare le pagine
+// pubbliche dei menu (menu, item, dati del ristorante)
+var menuWarmUpRoutes = []string{"/admin/", "/api/menu", "/api/v1/menus", "/api/v2/menus", "/api/v2/trash", "/account/"}
+
+// menuWarmUps tiene i ristoranti con un warm-up in corso: true se nel frattempo è arrivata
+// un'altra modifica e il warm-up va ripetuto
+var (
+	menuWarmUps   = make(map[string]bool)
+	menuWarmUpsMu sync.Mutex
+)
+
+// SetPublicMenuCache imposta la cache delle pagine dei menu pubblici e la loro durata
+func SetPublicMenuCache(c *cache.ResponseCache, ttl time.Duration) {
+	publicMenuCache = c
+	publicMenuTTL = ttl
+}
+
+// publicMenuCacheKey restituisce la chiave della pagina pubblica di un menu
+func publicMenuCacheKey(menuID string) string {
+	return "menu:" + menuID
+}
+
+// renderPublicMenuPage carica e renderizza la pagina pubblica di un menu. Restituisce nil se
+// la pagina non va messa in cache (menu inesistente o archiviato, ristorante non trovato o
+// disattivato): la richiesta segue allora il percorso senza cache
+func renderPublicMenuPage(ctx context.Context, client *db.MongoClient, menuID string) (*cache.CachedResponse, error) {
+	menu, err := client.GetMenuByID(ctx, menuID)
+	if err != nil {
+		return nil, err
+	}
+	if menu == nil || menu.IsArchived {
+		return nil, nil
+	}
+	restaurant, err := client.GetRestaurantByID(ctx, menu.RestaurantID)
+	if err != nil || restaurant == nil || !restaurant.IsActive {
+		return nil, nil
+	}
+
+	html, err := executeTemplate("public_menu", publicMenuData{Menu: menu, Restaurant: restaurant})
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", menuETag(menu, restaurant))
+	headers.Set("Last-Modified", menu.UpdatedAt.UTC().Format(http.TimeFormat))
+	headers.Set(cachedMenuRestaurantHeader, restaurant.ID)
+	if restaurant.PrivacyFirstAnalytics {
+		headers.Set(cachedMenuPrivacyHeader, "1")
+	}
+	return &cache.CachedResponse{StatusCode: http.StatusOK, Headers: headers, Body: html}, nil
+}
+
+// loadPublicMenuPage restituisce la pagina di un menu dalla cache, renderizzandola una sola
+// volta anche se molte richieste arrivano insieme alla scadenza
+func loadPublicMenuPage(client *db.MongoClient, menuID string) (*cache.CachedResponse, error) {
+	return publicMenuCache.GetOrLoad(publicMenuCacheKey(menuID), publicMenuTTL, func() (*cache.CachedResponse, error) {
+		// Il rendering è condiviso tra le richieste in attesa: non dipende dal contesto di una sola
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return renderPublicMenuPage(ctx, client, menuID)
+	})
+}
+
+// servePublicMenuFromCache serve la pagina pubblica di un menu dalla cache. Restituisce
+// false se la richiesta va gestita senza cache
+func servePublicMenuFromCache(w http.ResponseWriter, r *http.Request, menuID string) bool {
+	if publicMenuCache == nil {
+		return false
+	}
+	page, err := loadPublicMenuPage(db.MongoInstance, menuID)
+	if err != nil {
+		logger.Warn("Errore nel caricamento del menu pubblico in cache", map[string]interface{}{
+			"error":   err.Error(),
+			"menu_id": menuID,
+		})
+		return false
+	}
+	if page == nil {
+		return false
+	}
+
+	trackMenuView(w, r, page.Headers.Get(cachedMenuRestaurantHeader), menuID, page.Headers.Get(cachedMenuPrivacyHeader) != "")
+
+	lastModified, _ := http.ParseTime(page.Headers.Get("Last-Modified"))
+	if checkNotModified(w, r, page.Headers.Get("ETag"), lastModified) {
+		return true
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page.Body)
+	return true
+}
+
+// WarmPublicMenus rimuove dalla cache le pagine dei menu di un ristorante e renderizza di
+// nuovo quelle dei menu attivi, così la prima visita dopo una modifica non attende il rendering
+func WarmPublicMenus(ctx context.Context, restaurantID string) error {
+	return warmPublicMenus(ctx, db.MongoInstance, restaurantID)
+}
+
+// warmPublicMenus esegue il warm-up sul client indicato, letto prima di avviare la goroutine
+func warmPublicMenus(ctx context.Context, client *db.MongoClient, restaurantID string) error {
+	if publicMenuCache == nil || client == nil {
+		return nil
+	}
+
+	menus, err := client.GetMenusByRestaurantID(ctx, restaurantID)
+	if err != nil {
+		return err
+	}
+	for _, menu := range menus {
+		publicMenuCache.InvalidateKey(publicMenuCacheKey(menu.ID))
+	}
+
+	restaurant, err := client.GetRestaurantByID(ctx, restaurantID)
+	if err != nil || restaurant == nil || !restaurant.IsActive {
+		return err
+	}
+	active, err := loadDisplayMenusFrom(ctx, client, restaurant)
+	if err != nil {
+		return err
+	}
+	for _, menu := range active {
+		if _, err := loadPublicMenuPage(client, menu.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scheduleMenuWarmUp avvia in background il warm-up dei menu di un ristorante. Le modifiche
+// arrivate durante un warm-up in corso vengono raccolte in un solo warm-up successivo
+func scheduleMenuWarmUp(restaurantID string) {
+	// Letto qui e non nella goroutine, che può terminare dopo la chiusura del database
+	client := db.MongoInstance
+	if client == nil {
+		return
+	}
+
+	menuWarmUpsMu.Lock()
+	if _, running := menuWarmUps[restaurantID]; running {
+		menuWarmUps[restaurantID] = true
+		menuWarmUpsMu.Unlock()
+		return
+	}
+	menuWarmUps[restaurantID] = false
+	menuWarmUpsMu.Unlock()
+
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			if err := warmPublicMenus(ctx, client, restaurantID); err != nil {
+				logger.Warn("Warm-up dei menu pubblici non riuscito", map[string]interface{}{
+					"error":         err.Error(),
+					"restaurant_id": restaurantID,
+				})
+			}
+			cancel()
+
+			menuWarmUpsMu.Lock()
+			if !menuWarmUps[restaurantID] {
+				delete(menuWarmUps, restaurantID)
+				menuWarmUpsMu.Unlock()
+				return
+			}
+			menuWarmUps[restaurantID] = false
+			menuWarmUpsMu.Unlock()
+		}
+	}()
+}
+
+// mutationRecorder registra lo status della risposta di una modifica
+type mutationRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (m *mutationRecorder) WriteHeader(status int) {
+	m.status = status
+	m.ResponseWriter.WriteHeader(status)
+}
+
+// PublicMenuCacheMiddleware aggiorna la cache dei menu pubblici dopo le modifiche riuscite:
+// la pagina del menu modificato viene rimossa subito, poi quelle dei menu attivi del
+// ristorante vengono renderizzate di nuovo in background
+func PublicMenuCacheMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicMenuCache == nil || r.Method == http.MethodGet || r.Method == http.MethodHead || !isMenuWarmUpRoute(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &mutationRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if recorder.status >= http.StatusBadRequest {
+			return
+		}
+
+		vars := mux.Vars(r)
+		for _, name := range []string{"id", "menuId"} {
+			if id := vars[name]; id != "" && strings.Contains(r.URL.Path, "/menu") {
+				publicMenuCache.InvalidateKey(publicMenuCacheKey(id))
+			}
+		}
+		if session, err := getSessionFromRequest(r); err == nil && session != nil && session.RestaurantID != "" {
+			scheduleMenuWarmUp(session.RestaurantID)
+		}
+	})
+}
+
+// isMenuWarmUpRoute indica se una modifica sul percorso può cambiare le pagine dei menu
+func isMenuWarmUpRoute(path string) bool {
+	for _, prefix := range menuWarmUpRoutes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
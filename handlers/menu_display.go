@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+
+	"github.com/gorilla/mux"
+)
+
+// containsMenuID verifica se menuID è nella lista
+func containsMenuID(ids []string, menuID string) bool {
+	for _, id := range ids {
+		if id == menuID {
+			return true
+		}
+	}
+	return false
+}
+
+// removeMenuID restituisce una copia della lista senza menuID
+func removeMenuID(ids []string, menuID string) []string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id != menuID {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// moveMenuID restituisce una copia della lista con menuID spostato di una posizione
+// (delta -1 = prima, +1 = dopo). Ai bordi la lista resta invariata
+func moveMenuID(ids []string, menuID string, delta int) []string {
+	out := append([]string(nil), ids...)
+	for i, id := range out {
+		if id != menuID {
+			continue
+		}
+		j := i + delta
+		if j >= 0 && j < len(out) {
+			out[i], out[j] = out[j], out[i]
+		}
+		break
+	}
+	return out
+}
+
+// loadOwnedCompletedMenu carica un menu completato del ristorante della richiesta
+func loadOwnedCompletedMenu(ctx context.Context, menuID string) *models.Menu {
+	menu, err := tenantMenu(ctx, menuID)
+	if err != nil || menu == nil || !menu.IsCompleted {
+		return nil
+	}
+	return menu
+}
+
+// DisplayMenuHandler aggiunge un menu a quelli attivi, in coda: la pagina pubblica
+// del QR code li mostra come schede (es. cibo + bevande)
+func DisplayMenuHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadOwnedCompletedMenu(ctx, mux.Vars(r)["id"])
+	if menu == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if rejectArchivedMenu(w, r, menu) {
+		return
+	}
+
+	active := restaurant.DisplayMenuIDs()
+	if !containsMenuID(active, menu.ID) {
+		active = append(append([]string(nil), active...), menu.ID)
+		if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, active); err != nil {
+			log.Printf("Errore nell'attivazione del menu: %v", err)
+			http.Error(w, "Errore nell'attivazione del menu", http.StatusInternalServerError)
+			return
+		}
+		publishMenuEvent(r, events.MenuActivated, menu)
+	}
+
+	http.Redirect(w, r, "/admin?success=menu_displayed", http.StatusFound)
+}
+
+// HideMenuHandler rimuove un menu da quelli attivi
+func HideMenuHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menuID := mux.Vars(r)["id"]
+	active := restaurant.DisplayMenuIDs()
+	if !containsMenuID(active, menuID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, removeMenuID(active, menuID)); err != nil {
+		log.Printf("Errore nella disattivazione del menu: %v", err)
+		http.Error(w, "Errore nella disattivazione del menu", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin?success=menu_hidden", http.StatusFound)
+}
+
+// MoveMenuHandler sposta un menu attivo prima o dopo nell'ordine di visualizzazione.
+// Il primo menu è anche quello usato come ActiveMenuID
+func MoveMenuHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	var delta int
+	switch r.FormValue("direction") {
+	case "up":
+		delta = -1
+	case "down":
+		delta = 1
+	default:
+		http.Error(w, "Direzione non valida", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menuID := mux.Vars(r)["id"]
+	active := restaurant.DisplayMenuIDs()
+	if !containsMenuID(active, menuID) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, moveMenuID(active, menuID, delta)); err != nil {
+		log.Printf("Errore nel riordino dei menu: %v", err)
+		http.Error(w, "Errore nel riordino dei menu", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin?success=menus_reordered", http.StatusFound)
+}
+
+// loadDisplayMenus carica i menu attivi del ristorante in ordine di visualizzazione,
+// saltando quelli eliminati nel frattempo
+func loadDisplayMenus(ctx context.Context, restaurant *models.Restaurant) ([]*models.Menu, error) {
+	return loadDisplayMenusFrom(ctx, db.MongoInstance, restaurant)
+}
+
+// loadDisplayMenusFrom è loadDisplayMenus sul client indicato, per i job in background
+func loadDisplayMenusFrom(ctx context.Context, client *db.MongoClient, restaurant *models.Restaurant) ([]*models.Menu, error) {
+	var menus []*models.Menu
+	for _, id := range restaurant.DisplayMenuIDs() {
+		menu, err := client.GetRestaurantMenu(ctx, id, restaurant.ID)
+		if err != nil {
+			return nil, err
+		}
+		if menu != nil {
+			menus = append(menus, menu)
+		}
+	}
+	return menus, nil
+}
@@ -0,0 +1,549 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Campi confrontati nello storico. Del menu contano solo i testi: attivazione, completamento,
+// archivio e cestino sono passaggi di stato già registrati nell'audit log e non si annullano
+// dallo storico. Dei piatti restano fuori i dati derivati dalla foto
+var (
+	menuHistoryMenuFields      = map[string]bool{"name": true, "description": true, "meal_type": true}
+	menuHistoryCategoryIgnored = map[string]bool{"items": true}
+	menuHistoryItemIgnored     = map[string]bool{"image_id": true, "image_variants": true}
+)
+
+// menuHistoryQuery descrive paginazione, ordinamento e filtri dello storico di un menu
+var menuHistoryQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     200,
+	DefaultSort:    "-created_at",
+	Sortable:       []string{"created_at"},
+	Filterable:     []string{"user_id"},
+}
+
+var (
+	// errMenuChangedSince: la revisione tocca dati modificati di nuovo in seguito
+	errMenuChangedSince = errors.New("il menu è stato modificato dopo questa revisione: annulla prima le modifiche successive")
+	// errPhotoNotRevertible: la foto sostituita è già stata eliminata dallo storage
+	errPhotoNotRevertible = errors.New("la foto sostituita non è più disponibile: caricala di nuovo")
+)
+
+// diffMenus restituisce le differenze tra due versioni dello stesso menu: campi del menu,
+// categorie e piatti aggiunti, rimossi o modificati. Un piatto spostato di categoria risulta
+// rimosso da una e aggiunto all'altra
+func diffMenus(before, after *models.Menu) []models.MenuChange {
+	var changes []models.MenuChange
+	for _, change := range diffJSONFields(before, after, nil, models.MenuChange{Scope: models.MenuChangeScopeMenu, Name: after.Name}) {
+		if menuHistoryMenuFields[change.Field] {
+			changes = append(changes, change)
+		}
+	}
+
+	previous := make(map[string]*models.MenuCategory, len(before.Categories))
+	for i := range before.Categories {
+		previous[before.Categories[i].ID] = &before.Categories[i]
+	}
+	current := make(map[string]bool, len(after.Categories))
+	for i := range after.Categories {
+		category := &after.Categories[i]
+		current[category.ID] = true
+		base := models.MenuChange{Scope: models.MenuChangeScopeCategory, CategoryID: category.ID, Name: category.Name}
+
+		old, ok := previous[category.ID]
+		if !ok {
+			base.Op, base.After = models.MenuChangeAdded, marshalChangeValue(category)
+			changes = append(changes, base)
+			continue
+		}
+		changes = append(changes, diffJSONFields(old, category, menuHistoryCategoryIgnored, base)...)
+		changes = append(changes, diffCategoryItems(old, category)...)
+	}
+	for i := range before.Categories {
+		category := &before.Categories[i]
+		if !current[category.ID] {
+			changes = append(changes, models.MenuChange{
+				Scope:      models.MenuChangeScopeCategory,
+				Op:         models.MenuChangeRemoved,
+				CategoryID: category.ID,
+				Name:       category.Name,
+				Before:     marshalChangeValue(category),
+			})
+		}
+	}
+	return changes
+}
+
+// diffCategoryItems confronta i piatti di due versioni della stessa categoria
+func diffCategoryItems(before, after *models.MenuCategory) []models.MenuChange {
+	var changes []models.MenuChange
+	previous := make(map[string]*models.MenuItem, len(before.Items))
+	for i := range before.Items {
+		previous[before.Items[i].ID] = &before.Items[i]
+	}
+	current := make(map[string]bool, len(after.Items))
+	for i := range after.Items {
+		item := &after.Items[i]
+		current[item.ID] = true
+		base := models.MenuChange{Scope: models.MenuChangeScopeItem, CategoryID: after.ID, ItemID: item.ID, Name: item.Name}
+
+		old, ok := previous[item.ID]
+		if !ok {
+			base.Op, base.After = models.MenuChangeAdded, marshalChangeValue(item)
+			changes = append(changes, base)
+			continue
+		}
+		changes = append(changes, diffJSONFields(old, item, menuHistoryItemIgnored, base)...)
+	}
+	for i := range before.Items {
+		item := &before.Items[i]
+		if !current[item.ID] {
+			changes = append(changes, models.MenuChange{
+				Scope:      models.MenuChangeScopeItem,
+				Op:         models.MenuChangeRemoved,
+				CategoryID: before.ID,
+				ItemID:     item.ID,
+				Name:       item.Name,
+				Before:     marshalChangeValue(item),
+			})
+		}
+	}
+	return changes
+}
+
+// diffJSONFields confronta campo per campo la forma JSON di before e after: ogni campo
+// diverso diventa una modifica "updated" che parte da base
+func diffJSONFields(before, after interface{}, ignored map[string]bool, base models.MenuChange) []models.MenuChange {
+	oldFields, newFields := jsonFields(before), jsonFields(after)
+	keys := make([]string, 0, len(newFields))
+	for key := range newFields {
+		keys = append(keys, key)
+	}
+	for key := range oldFields {
+		if _, ok := newFields[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var changes []models.MenuChange
+	for _, key := range keys {
+		if ignored[key] || bytes.Equal(oldFields[key], newFields[key]) {
+			continue
+		}
+		change := base
+		change.Op, change.Field = models.MenuChangeUpdated, key
+		change.Before, change.After = oldFields[key], newFields[key]
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func jsonFields(v interface{}) map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	if data, err := json.Marshal(v); err == nil {
+		json.Unmarshal(data, &fields)
+	}
+	return fields
+}
+
+func marshalChangeValue(v interface{}) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// revertMenuRevision annulla sul menu le modifiche della revisione, dall'ultima alla prima.
+// Ogni modifica si annulla solo se il menu ha ancora il valore che aveva introdotto
+func revertMenuRevision(menu *models.Menu, revision *models.MenuRevision) error {
+	for i := len(revision.Changes) - 1; i >= 0; i-- {
+		if err := revertMenuChange(menu, revision.Changes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func revertMenuChange(menu *models.Menu, change models.MenuChange) error {
+	if change.Field == "image_url" {
+		return errPhotoNotRevertible
+	}
+	if change.Scope == models.MenuChangeScopeMenu {
+		return setJSONField(menu, change)
+	}
+
+	ci := -1
+	for i, category := range menu.Categories {
+		if category.ID == change.CategoryID {
+			ci = i
+			break
+		}
+	}
+
+	if change.Scope == models.MenuChangeScopeCategory {
+		switch {
+		case change.Op == models.MenuChangeRemoved:
+			var category models.MenuCategory
+			if ci >= 0 || json.Unmarshal(change.Before, &category) != nil {
+				return errMenuChangedSince
+			}
+			menu.Categories = append(menu.Categories, category)
+			return nil
+		case ci < 0:
+			return errMenuChangedSince
+		case change.Op == models.MenuChangeAdded:
+			menu.Categories = append(menu.Categories[:ci], menu.Categories[ci+1:]...)
+			return nil
+		}
+		return setJSONField(&menu.Categories[ci], change)
+	}
+
+	if ci < 0 {
+		return errMenuChangedSince
+	}
+	category := &menu.Categories[ci]
+	ii := -1
+	for i, item := range category.Items {
+		if item.ID == change.ItemID {
+			ii = i
+			break
+		}
+	}
+	switch {
+	case change.Op == models.MenuChangeRemoved:
+		var item models.MenuItem
+		if ii >= 0 || json.Unmarshal(change.Before, &item) != nil {
+			return errMenuChangedSince
+		}
+		category.Items = append(category.Items, item)
+		return nil
+	case ii < 0:
+		return errMenuChangedSince
+	case change.Op == models.MenuChangeAdded:
+		category.Items = append(category.Items[:ii], category.Items[ii+1:]...)
+		return nil
+	}
+	return setJSONField(&category.Items[ii], change)
+}
+
+// setJSONField riporta il campo change.Field di target al valore precedente, se ha ancora
+// il valore introdotto dalla modifica
+func setJSONField[T any](target *T, change models.MenuChange) error {
+	fields := jsonFields(target)
+	if !bytes.Equal(fields[change.Field], change.After) {
+		return errMenuChangedSince
+	}
+	if len(change.Before) == 0 {
+		delete(fields, change.Field)
+	} else {
+		fields[change.Field] = change.Before
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	var reverted T
+	if err := json.Unmarshal(data, &reverted); err != nil {
+		return err
+	}
+	*target = reverted
+	return nil
+}
+
+// revisionActor identifica chi ha fatto una modifica: l'utente della sessione o chi ha
+// creato la API key usata, con l'ID della chiave. Restituisce nil se la richiesta non è autenticata
+func revisionActor(ctx context.Context, r *http.Request) (*models.Session, string) {
+	if raw := apiKeyFromRequest(r); raw != "" {
+		key, err := db.MongoInstance.GetAPIKeyByHash(ctx, hashVerificationToken(raw))
+		if err != nil || key == nil {
+			return nil, ""
+		}
+		return &models.Session{UserID: key.CreatedBy, RestaurantID: key.RestaurantID}, key.ID
+	}
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		return nil, ""
+	}
+	return session, ""
+}
+
+// recordMenuRevision salva nello storico le differenze tra before e after, se ce ne sono
+func recordMenuRevision(ctx context.Context, r *http.Request, session *models.Session, apiKeyID string, before, after *models.Menu, revertOf string) {
+	changes := diffMenus(before, after)
+	if len(changes) == 0 {
+		return
+	}
+
+	revision := &models.MenuRevision{
+		ID:           uuid.New().String(),
+		MenuID:       after.ID,
+		RestaurantID: after.RestaurantID,
+		UserID:       session.UserID,
+		APIKeyID:     apiKeyID,
+		Method:       r.Method,
+		Path:         r.URL.Path,
+		Changes:      changes,
+		RevertOf:     revertOf,
+		CreatedAt:    time.Now(),
+	}
+	if user, err := db.MongoInstance.GetUserByID(ctx, session.UserID); err == nil && user != nil {
+		revision.Username = user.Username
+	}
+	if err := db.MongoInstance.CreateMenuRevision(ctx, revision); err != nil {
+		logger.WarnCtx(r.Context(), "Errore nel salvataggio dello storico del menu", map[string]interface{}{
+			"error":   err.Error(),
+			"menu_id": after.ID,
+		})
+	}
+}
+
+// mutatedMenuID restituisce il menu toccato da una richiesta di modifica, "" per le altre
+// richieste. Le route dello storico registrano da sé gli annullamenti
+func mutatedMenuID(r *http.Request) string {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions ||
+		!strings.Contains(r.URL.Path, "/menu") || strings.Contains(r.URL.Path, "/history") {
+		return ""
+	}
+	vars := mux.Vars(r)
+	if id := vars["menuId"]; id != "" {
+		return id
+	}
+	return vars["id"]
+}
+
+// MenuHistoryMiddleware registra nello storico del menu le differenze introdotte da ogni
+// modifica riuscita al menu, alle sue categorie o ai suoi piatti, da qualunque route
+// arrivi (form del pannello, API v1 e v2)
+func MenuHistoryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		menuID := mutatedMenuID(r)
+		if menuID == "" || db.MongoInstance == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		before, err := db.MongoInstance.GetMenuByID(ctx, menuID)
+		cancel()
+		if err != nil || before == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &mutationRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		if recorder.status >= http.StatusBadRequest {
+			return
+		}
+
+		// La risposta è già partita: lo storico si salva anche se il client si disconnette
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+		defer cancel()
+		after, err := db.MongoInstance.GetMenuByID(ctx, menuID)
+		if err != nil || after == nil {
+			return
+		}
+		session, apiKeyID := revisionActor(ctx, r)
+		if session == nil || session.RestaurantID != after.RestaurantID {
+			return
+		}
+		recordMenuRevision(ctx, r, session, apiKeyID, before, after, "")
+	})
+}
+
+// undoMenuRevision annulla la revisione sul menu, lo salva e registra l'annullamento nello
+// storico. Gli errori errMenuChangedSince e errPhotoNotRevertible vanno mostrati all'utente
+func undoMenuRevision(ctx context.Context, r *http.Request, menu *models.Menu, revision *models.MenuRevision) error {
+	before := new(models.Menu)
+	if err := json.Unmarshal(marshalChangeValue(menu), before); err != nil {
+		return err
+	}
+	if err := revertMenuRevision(menu, revision); err != nil {
+		return err
+	}
+	menu.UpdatedAt = time.Now()
+	if err := db.MongoInstance.UpdateMenu(ctx, menu); err != nil {
+		return err
+	}
+
+	if session, err := getSessionFromRequest(r); err == nil {
+		recordMenuRevision(ctx, r, session, "", before, menu, revision.ID)
+	}
+	RecordAuditLogAsync("MENU_REVERTED", "menu", menu.ID, menu.RestaurantID, getClientIP(r), r.UserAgent(), "success")
+	publishMenuEvent(r, events.MenuUpdated, menu)
+	return nil
+}
+
+// MenuHistoryHandler restituisce lo storico delle modifiche di un menu, dalla più recente
+// (GET /api/v1/menus/{id}/history?filter[user_id]=&page=&per_page=)
+func MenuHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	query, err := httputil.ParseListQuery(r, menuHistoryQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil {
+		return
+	}
+	revisions, total, err := db.MongoInstance.FindMenuRevisions(ctx, db.MenuRevisionFilter{
+		MenuID: menu.ID,
+		UserID: query.Filter("user_id"),
+	}, dbListOptions(query))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dello storico del menu")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, revisions, query, total)
+}
+
+// RevertMenuRevisionHandler annulla una modifica dello storico
+// (POST /api/v1/menus/{id}/history/{revisionId}/revert)
+func RevertMenuRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil || rejectArchivedMenuV2(w, menu) {
+		return
+	}
+	revision, err := db.MongoInstance.GetMenuRevision(ctx, mux.Vars(r)["revisionId"], menu.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dello storico del menu")
+		return
+	}
+	if revision == nil {
+		httputil.NotFound(w, "Revisione")
+		return
+	}
+
+	if err := undoMenuRevision(ctx, r, menu, revision); err != nil {
+		if errors.Is(err, errMenuChangedSince) || errors.Is(err, errPhotoNotRevertible) {
+			httputil.Conflict(w, "Impossibile annullare la modifica: "+err.Error())
+			return
+		}
+		respondMenuV2Error(w, r, err, "Errore nell'annullamento della modifica")
+		return
+	}
+	httputil.Success(w, "Modifica annullata", menu)
+}
+
+// MenuHistoryPageHandler mostra lo storico delle modifiche di un menu con le differenze
+// (GET /admin/menu/{id}/history)
+func MenuHistoryPageHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	_, role, err := currentRole(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, err := tenantMenu(ctx, mux.Vars(r)["id"])
+	if err != nil || menu == nil {
+		http.NotFound(w, r)
+		return
+	}
+	revisions, _, err := db.MongoInstance.FindMenuRevisions(ctx, db.MenuRevisionFilter{MenuID: menu.ID}, db.ListOptions{Limit: 100})
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero dello storico del menu", map[string]interface{}{
+			"error":   err.Error(),
+			"menu_id": menu.ID,
+		})
+		http.Error(w, "Errore nel caricamento dello storico", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Restaurant *models.Restaurant
+		Menu       *models.Menu
+		Revisions  []*models.MenuRevision
+		CanRevert  bool
+		Success    string
+		Error      string
+		CSRFToken  string
+	}{
+		Restaurant: restaurant,
+		Menu:       menu,
+		Revisions:  revisions,
+		CanRevert:  models.RoleHasPermission(role, models.PermMenusRevert) && !menu.IsArchived,
+		Success:    r.URL.Query().Get("success"),
+		Error:      r.URL.Query().Get("error"),
+		CSRFToken:  csrfToken(w, r),
+	}
+
+	renderTemplate(w, "menu_history", data)
+}
+
+// RevertMenuRevisionFormHandler annulla una modifica dalla pagina dello storico
+// (POST /admin/menu/{id}/history/{revisionId}/revert)
+func RevertMenuRevisionFormHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, err := tenantMenu(ctx, vars["id"])
+	if err != nil || menu == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if rejectArchivedMenu(w, r, menu) {
+		return
+	}
+	revision, err := db.MongoInstance.GetMenuRevision(ctx, vars["revisionId"], menu.ID)
+	if err != nil || revision == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	historyURL := fmt.Sprintf("/admin/menu/%s/history", menu.ID)
+	switch err := undoMenuRevision(ctx, r, menu, revision); {
+	case errors.Is(err, errMenuChangedSince):
+		http.Redirect(w, r, historyURL+"?error=changed", http.StatusSeeOther)
+	case errors.Is(err, errPhotoNotRevertible):
+		http.Redirect(w, r, historyURL+"?error=photo", http.StatusSeeOther)
+	case err != nil:
+		logger.ErrorCtx(r.Context(), "Errore nell'annullamento della modifica", map[string]interface{}{
+			"error":   err.Error(),
+			"menu_id": menu.ID,
+		})
+		http.Error(w, "Errore nell'annullamento della modifica", http.StatusInternalServerError)
+	default:
+		http.Redirect(w, r, historyURL+"?success=reverted", http.StatusSeeOther)
+	}
+}
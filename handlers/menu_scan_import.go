@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"qr-menu/logger"
+	"qr-menu/pkg/avscan"
+	"qr-menu/pkg/config"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/ocr"
+)
+
+// scanCategoryName è la categoria dei piatti che nel menu cartaceo precedono la prima intestazione
+const scanCategoryName = "Piatti"
+
+// ocrEngine riconosce il testo delle foto e dei PDF dei menu cartacei; nil disattiva l'import
+var (
+	ocrEngine     ocr.Engine
+	ocrSettings   = config.Default().OCR
+	ocrSettingsMu sync.RWMutex
+)
+
+// SetOCREngine imposta il motore OCR dell'import dei menu cartacei (nil per disattivarlo)
+func SetOCREngine(engine ocr.Engine, cfg config.OCRConfig) {
+	ocrSettingsMu.Lock()
+	defer ocrSettingsMu.Unlock()
+	ocrEngine = engine
+	ocrSettings = cfg
+}
+
+// menuScanResponse è la bozza riconosciuta, da rivedere e poi salvare con POST /api/v2/menus
+type menuScanResponse struct {
+	ocr.Draft
+	Items int    `json:"items"`
+	Text  string `json:"text"` // Testo riconosciuto, per correggere a mano quanto non interpretato
+}
+
+// ImportMenuScanHandler riconosce con l'OCR la foto o il PDF di un menu cartaceo (campo
+// multipart "file") e restituisce una bozza di categorie, piatti e prezzi. Non salva nulla:
+// la bozza rivista si invia a POST /api/v2/menus (POST /api/v1/menus/import/scan)
+func ImportMenuScanHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ocrSettingsMu.RLock()
+	engine, settings := ocrEngine, ocrSettings
+	ocrSettingsMu.RUnlock()
+	if engine == nil {
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Import da foto non disponibile")
+		return
+	}
+
+	maxSize := int64(settings.MaxUploadMB) << 20
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	if err := r.ParseMultipartForm(maxSize); err != nil {
+		httputil.BadRequest(w, "Richiesta multipart non valida o file troppo grande")
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		httputil.BadRequest(w, "Nessun file caricato")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		httputil.BadRequest(w, "Errore nella lettura del file")
+		return
+	}
+	if int64(len(data)) > maxSize {
+		httputil.ErrorMessage(w, http.StatusRequestEntityTooLarge, "File troppo grande")
+		return
+	}
+	contentType, err := ocr.DetectType(data)
+	if err != nil {
+		httputil.ErrorMessage(w, http.StatusUnsupportedMediaType, "Formato non supportato: carica una foto JPEG o PNG oppure un PDF")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), settings.Timeout)
+	defer cancel()
+
+	switch err := uploadGuard.CheckBytes(ctx, header.Filename, data); {
+	case errors.Is(err, avscan.ErrInfected):
+		RecordAuditLogAsync("UPLOAD_QUARANTINED", "menu", "", restaurant.ID, getClientIP(r), r.UserAgent(), "failure")
+		httputil.ErrorMessage(w, http.StatusUnprocessableEntity, "Il file è stato bloccato dal controllo antivirus")
+		return
+	case errors.Is(err, avscan.ErrUnavailable):
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Controllo antivirus non disponibile, riprova più tardi")
+		return
+	}
+
+	text, err := engine.Recognize(ctx, data, contentType)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel riconoscimento del menu cartaceo", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+			"content_type":  contentType,
+		})
+		httputil.ErrorMessage(w, http.StatusBadGateway, "Riconoscimento del testo non riuscito")
+		return
+	}
+
+	draft := ocr.ParseMenu(text, scanCategoryName)
+	if draft.Categories == nil {
+		draft.Categories = []ocr.DraftCategory{}
+	}
+	RecordAuditLogAsync("MENU_SCAN_IMPORTED", "menu", "", restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Menu riconosciuto, controlla la bozza prima di salvarla", menuScanResponse{
+		Draft: draft,
+		Items: draft.ItemCount(),
+		Text:  text,
+	})
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/menutemplates"
+)
+
+// Origini dei modelli da cui creare un menu
+const (
+	menuTemplateBuiltin      = "builtin"      // Catalogo incluso nell'applicazione (pizzeria, sushi, ...)
+	menuTemplatePrivate      = "private"      // Menu salvato come modello dal ristorante
+	menuTemplateOrganization = "organization" // Modello condiviso dell'organizzazione del ristorante
+)
+
+// menuTemplateSummary descrive un modello nell'elenco di quelli disponibili, senza i piatti
+type menuTemplateSummary struct {
+	ID          string `json:"id"`
+	Source      string `json:"source"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	MealType    string `json:"meal_type"`
+	Categories  int    `json:"categories"`
+	Items       int    `json:"items"`
+}
+
+// menuFromTemplateRequest è il corpo opzionale della creazione di un menu da un modello
+type menuFromTemplateRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+func summarizeMenuTemplate(template *models.MenuTemplate, source string) menuTemplateSummary {
+	summary := menuTemplateSummary{
+		ID:          template.ID,
+		Source:      source,
+		Name:        template.Name,
+		Description: template.Description,
+		MealType:    template.MealType,
+		Categories:  len(template.Categories),
+	}
+	for _, category := range template.Categories {
+		summary.Items += len(category.Items)
+	}
+	return summary
+}
+
+// builtinMenuTemplate converte un modello del catalogo incluso nell'applicazione
+func builtinMenuTemplate(starter menutemplates.Template) *models.MenuTemplate {
+	template := &models.MenuTemplate{
+		ID:          starter.ID,
+		Name:        starter.Name,
+		Description: starter.Description,
+		MealType:    starter.MealType,
+		Categories:  make([]models.MenuCategory, 0, len(starter.Categories)),
+	}
+	for i, starterCategory := range starter.Categories {
+		category := models.MenuCategory{
+			Name:         starterCategory.Name,
+			Description:  starterCategory.Description,
+			Items:        make([]models.MenuItem, 0, len(starterCategory.Items)),
+			DisplayOrder: i,
+		}
+		for j, starterItem := range starterCategory.Items {
+			category.Items = append(category.Items, models.MenuItem{
+				Name:         starterItem.Name,
+				Description:  starterItem.Description,
+				Price:        starterItem.Price,
+				Category:     starterCategory.Name,
+				Available:    true,
+				DisplayOrder: j,
+				Tags:         append([]string(nil), starterItem.Tags...),
+			})
+		}
+		template.Categories = append(template.Categories, category)
+	}
+	return template
+}
+
+// copyTemplateCategories copia categorie e piatti con nuovi ID, mantenendo a differenza
+// di cloneMenuCategories anche traduzioni, tag e ordinamento. Le giacenze non vengono
+// copiate: i piatti esauriti tornano disponibili
+func copyTemplateCategories(categories []models.MenuCategory) []models.MenuCategory {
+	copied := make([]models.MenuCategory, len(categories))
+	for i, category := range categories {
+		category.ID = uuid.New().String()
+		items := make([]models.MenuItem, len(category.Items))
+		for j, item := range category.Items {
+			item.ID = uuid.New().String()
+			if item.Inventory != nil && item.Inventory.SoldOut {
+				item.Available = true
+			}
+			item.Inventory = nil
+			items[j] = item
+		}
+		category.Items = items
+		copied[i] = category
+	}
+	return copied
+}
+
+// findMenuTemplate cerca un modello disponibile per il ristorante: nel catalogo incluso,
+// tra i modelli privati e tra quelli della sua organizzazione. Restituisce nil se non esiste
+func findMenuTemplate(ctx context.Context, restaurant *models.Restaurant, id string) (*models.MenuTemplate, error) {
+	if starter, ok := menutemplates.Get(id); ok {
+		return builtinMenuTemplate(starter), nil
+	}
+	template, err := db.MongoInstance.GetRestaurantMenuTemplate(ctx, id, restaurant.ID)
+	if err != nil || template != nil || restaurant.OrganizationID == "" {
+		return template, err
+	}
+	return db.MongoInstance.GetMenuTemplate(ctx, id, restaurant.OrganizationID)
+}
+
+// ListMenuTemplatesForRestaurantHandler elenca i modelli da cui il ristorante può creare un
+// menu: catalogo incluso, modelli privati e modelli dell'organizzazione
+// (GET /api/v1/menu-templates)
+func ListMenuTemplatesForRestaurantHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	summaries := []menuTemplateSummary{}
+	for _, starter := range menutemplates.All() {
+		summaries = append(summaries, summarizeMenuTemplate(builtinMenuTemplate(starter), menuTemplateBuiltin))
+	}
+
+	private, err := db.MongoInstance.GetRestaurantMenuTemplates(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei modelli di menu")
+		return
+	}
+	for _, template := range private {
+		summaries = append(summaries, summarizeMenuTemplate(template, menuTemplatePrivate))
+	}
+
+	if restaurant.OrganizationID != "" {
+		shared, err := db.MongoInstance.GetMenuTemplates(ctx, restaurant.OrganizationID)
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nel recupero dei modelli di menu")
+			return
+		}
+		for _, template := range shared {
+			summaries = append(summaries, summarizeMenuTemplate(template, menuTemplateOrganization))
+		}
+	}
+
+	httputil.Success(w, "Modelli di menu", summaries)
+}
+
+// SaveMenuAsTemplateHandler salva un menu del ristorante come modello privato, da cui
+// crearne di nuovi (POST /api/v1/menus/{id}/save-as-template)
+func SaveMenuAsTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req menuFromTemplateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httputil.BadRequest(w, "Formato JSON non valido")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil {
+		return
+	}
+	session, _ := revisionActor(ctx, r)
+
+	now := time.Now()
+	template := &models.MenuTemplate{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurant.ID,
+		Name:         menu.Name,
+		Description:  menu.Description,
+		MealType:     menu.MealType,
+		Categories:   copyTemplateCategories(menu.Categories),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if session != nil {
+		template.CreatedBy = session.UserID
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		template.Name = name
+	}
+	if description := strings.TrimSpace(req.Description); description != "" {
+		template.Description = description
+	}
+	if err := db.MongoInstance.SaveMenuTemplate(ctx, template); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio del modello di menu")
+		return
+	}
+
+	RecordAuditLogAsync("MENU_TEMPLATE_CREATED", "menu_template", template.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Created(w, "Modello di menu salvato", template)
+}
+
+// DeleteRestaurantMenuTemplateHandler elimina un modello privato; i menu già creati dal
+// modello restano (DELETE /api/v1/menu-templates/{id})
+func DeleteRestaurantMenuTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id := mux.Vars(r)["id"]
+	deleted, err := db.MongoInstance.DeleteRestaurantMenuTemplate(ctx, id, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'eliminazione del modello di menu")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "Modello di menu")
+		return
+	}
+
+	RecordAuditLogAsync("MENU_TEMPLATE_DELETED", "menu_template", id, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// CreateMenuFromTemplateHandler crea un menu in bozza da un modello, con nuovi ID per
+// categorie e piatti. Nome e descrizione del modello si possono sostituire nel corpo
+// (POST /api/v1/menus/from-template/{templateId})
+func CreateMenuFromTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req menuFromTemplateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httputil.BadRequest(w, "Formato JSON non valido")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	template, err := findMenuTemplate(ctx, restaurant, mux.Vars(r)["templateId"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del modello di menu")
+		return
+	}
+	if template == nil {
+		httputil.NotFound(w, "Modello di menu")
+		return
+	}
+
+	now := time.Now()
+	menu := &models.Menu{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurant.ID,
+		Name:         template.Name,
+		Description:  template.Description,
+		MealType:     template.MealType,
+		Categories:   copyTemplateCategories(template.Categories),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		menu.Name = name
+	}
+	if description := strings.TrimSpace(req.Description); description != "" {
+		menu.Description = description
+	}
+	if err := db.MongoInstance.CreateMenu(ctx, menu); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella creazione del menu")
+		return
+	}
+
+	publishMenuEvent(r, events.MenuCreated, menu)
+	w.Header().Set("Location", "/api/v2/menus/"+menu.ID)
+	httputil.Created(w, "Menu creato dal modello", menu)
+}
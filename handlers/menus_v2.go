@@ -0,0 +1,751 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/avscan"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+)
+
+// API v2: le stesse operazioni dei form del pannello (/admin/menu/...) in JSON, per i
+// frontend headless. Rispondono con lo stato HTTP dell'esito invece dei redirect e
+// accettano sia la sessione sia le API key
+
+// itemV2Request è il corpo di creazione e modifica di un piatto. Nella modifica i campi
+// assenti restano invariati
+type itemV2Request struct {
+	Name        *string   `json:"name"`
+	Description *string   `json:"description"`
+	Price       *float64  `json:"price"`
+	Available   *bool     `json:"available"`
+	Tags        *[]string `json:"tags"`
+
+	// Valori nutrizionali; un oggetto vuoto li rimuove
+	Nutrition *models.Nutrition `json:"nutrition"`
+
+	// Canali su cui il piatto è nascosto: delivery o una piattaforma (es. glovo)
+	HiddenChannels *[]string `json:"hidden_channels"`
+}
+
+// categoryV2Request è una categoria con i suoi piatti nella creazione di un menu
+type categoryV2Request struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Items       []itemV2Request `json:"items"`
+}
+
+// menuV2Request è il corpo di creazione e modifica di un menu. Le categorie sono lette
+// solo nella creazione; nella modifica i campi assenti restano invariati
+type menuV2Request struct {
+	Name        *string             `json:"name"`
+	Description *string             `json:"description"`
+	Categories  []categoryV2Request `json:"categories"`
+}
+
+// apply applica la richiesta al piatto e lo valida
+func (req itemV2Request) apply(item *models.MenuItem) error {
+	if req.Name != nil {
+		item.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		item.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Price != nil {
+		item.Price = *req.Price
+	}
+	if req.Available != nil {
+		item.Available = *req.Available
+	}
+	if req.Tags != nil {
+		item.Tags = append([]string(nil), *req.Tags...)
+	}
+	if req.Nutrition != nil {
+		if req.Nutrition.IsEmpty() {
+			item.Nutrition = nil
+		} else {
+			if err := req.Nutrition.Validate(); err != nil {
+				return err
+			}
+			nutrition := *req.Nutrition
+			nutrition.Ingredients = append([]models.NutritionIngredient(nil), req.Nutrition.Ingredients...)
+			nutrition.Normalize()
+			item.Nutrition = &nutrition
+		}
+	}
+	if req.HiddenChannels != nil {
+		channels, err := validateHiddenChannels(*req.HiddenChannels)
+		if err != nil {
+			return err
+		}
+		item.HiddenChannels = channels
+	}
+
+	if item.Name == "" {
+		return errors.New("Il nome del piatto è obbligatorio")
+	}
+	if item.Price < 0 {
+		return errors.New("Il prezzo non può essere negativo")
+	}
+	return nil
+}
+
+// newItemV2 crea un piatto dalla richiesta, disponibile se non indicato diversamente
+func newItemV2(req itemV2Request, category string) (models.MenuItem, error) {
+	item := models.MenuItem{
+		ID:        uuid.New().String(),
+		Category:  category,
+		Available: true,
+	}
+	err := req.apply(&item)
+	return item, err
+}
+
+// findMenuItem restituisce la posizione della categoria e del piatto nel menu; ok è false
+// se non esistono
+func findMenuItem(menu *models.Menu, categoryID, itemID string) (ci, ii int, ok bool) {
+	for ci, category := range menu.Categories {
+		if category.ID != categoryID {
+			continue
+		}
+		for ii, item := range category.Items {
+			if item.ID == itemID {
+				return ci, ii, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// respondMenuV2Error registra l'errore e risponde 500 con il messaggio
+func respondMenuV2Error(w http.ResponseWriter, r *http.Request, err error, message string) {
+	logger.ErrorCtx(r.Context(), message, map[string]interface{}{
+		"error": err.Error(),
+		"path":  r.URL.Path,
+	})
+	httputil.InternalServerError(w, message)
+}
+
+// currentRestaurantV2 restituisce il ristorante della sessione o della API key; risponde
+// 401 e restituisce nil se manca
+func currentRestaurantV2(w http.ResponseWriter, r *http.Request) *models.Restaurant {
+	restaurant, err := getCurrentRestaurant(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Autenticazione richiesta")
+		return nil
+	}
+	return restaurant
+}
+
+// loadMenuV2 carica il menu {id} del ristorante della richiesta; risponde 404 e
+// restituisce nil se non esiste o è di un altro ristorante
+func loadMenuV2(ctx context.Context, w http.ResponseWriter, r *http.Request) *models.Menu {
+	menu, err := tenantMenu(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+		return nil
+	}
+	if menu == nil {
+		httputil.NotFound(w, "Menu")
+		return nil
+	}
+	return menu
+}
+
+// rejectArchivedMenuV2 risponde 409 se il menu è archiviato: i menu archiviati sono
+// congelati finché non vengono ripristinati
+func rejectArchivedMenuV2(w http.ResponseWriter, menu *models.Menu) bool {
+	if !menu.IsArchived {
+		return false
+	}
+	httputil.Conflict(w, "Il menu è archiviato: ripristinalo per modificarlo")
+	return true
+}
+
+// rejectDraftMenuV2 risponde 409 se il menu non è completato e quindi non può essere
+// mostrato o archiviato
+func rejectDraftMenuV2(w http.ResponseWriter, menu *models.Menu) bool {
+	if menu.IsCompleted {
+		return false
+	}
+	httputil.Conflict(w, "Il menu non è completato")
+	return true
+}
+
+// saveMenuV2 salva le modifiche al menu; risponde 500 e restituisce false in caso di errore
+func saveMenuV2(ctx context.Context, w http.ResponseWriter, r *http.Request, menu *models.Menu) bool {
+	menu.UpdatedAt = time.Now()
+	if err := db.MongoInstance.UpdateMenu(ctx, menu); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'aggiornamento del menu")
+		return false
+	}
+	return true
+}
+
+// GetMenuV2Handler restituisce un menu del ristorante (GET /api/v2/menus/{id})
+func GetMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Menu", menu)
+}
+
+// CreateMenuV2Handler crea un menu in bozza, con categorie e piatti opzionali
+// (POST /api/v2/menus)
+func CreateMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req menuV2Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if req.Name == nil || strings.TrimSpace(*req.Name) == "" {
+		httputil.BadRequest(w, "Il nome del menu è obbligatorio")
+		return
+	}
+
+	now := time.Now()
+	menu := &models.Menu{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurant.ID,
+		Name:         strings.TrimSpace(*req.Name),
+		Categories:   []models.MenuCategory{},
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if req.Description != nil {
+		menu.Description = strings.TrimSpace(*req.Description)
+	}
+	for _, categoryReq := range req.Categories {
+		category := models.MenuCategory{
+			ID:          uuid.New().String(),
+			Name:        strings.TrimSpace(categoryReq.Name),
+			Description: strings.TrimSpace(categoryReq.Description),
+			Items:       []models.MenuItem{},
+		}
+		if category.Name == "" {
+			httputil.BadRequest(w, "Il nome della categoria è obbligatorio")
+			return
+		}
+		for _, itemReq := range categoryReq.Items {
+			item, err := newItemV2(itemReq, category.Name)
+			if err != nil {
+				httputil.BadRequest(w, err.Error())
+				return
+			}
+			category.Items = append(category.Items, item)
+		}
+		menu.Categories = append(menu.Categories, category)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.CreateMenu(ctx, menu); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella creazione del menu")
+		return
+	}
+
+	publishMenuEvent(r, events.MenuCreated, menu)
+	w.Header().Set("Location", "/api/v2/menus/"+menu.ID)
+	httputil.Created(w, "Menu creato", menu)
+}
+
+// UpdateMenuV2Handler modifica nome e descrizione di un menu (PATCH /api/v2/menus/{id})
+func UpdateMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req menuV2Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil || rejectArchivedMenuV2(w, menu) {
+		return
+	}
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			httputil.BadRequest(w, "Il nome del menu è obbligatorio")
+			return
+		}
+		menu.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		menu.Description = strings.TrimSpace(*req.Description)
+	}
+	if !saveMenuV2(ctx, w, r, menu) {
+		return
+	}
+
+	publishMenuEvent(r, events.MenuUpdated, menu)
+	httputil.Success(w, "Menu aggiornato", menu)
+}
+
+// DeleteMenuV2Handler sposta un menu nel cestino (DELETE /api/v2/menus/{id})
+func DeleteMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil {
+		return
+	}
+	if err := deleteMenu(ctx, restaurant, menu); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'eliminazione del menu")
+		return
+	}
+	httputil.NoContent(w)
+}
+
+// CompleteMenuV2Handler completa un menu e genera il QR code del ristorante
+// (POST /api/v2/menus/{id}/complete)
+func CompleteMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil || rejectArchivedMenuV2(w, menu) {
+		return
+	}
+	if err := completeMenu(ctx, restaurant, menu, getBaseURL(r)); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella generazione del QR code")
+		return
+	}
+
+	publishMenuEvent(r, events.MenuUpdated, menu)
+	httputil.Success(w, "Menu completato", menu)
+}
+
+// ActivateMenuV2Handler rende il menu l'unico attivo del ristorante
+// (POST /api/v2/menus/{id}/activate)
+func ActivateMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil || rejectArchivedMenuV2(w, menu) || rejectDraftMenuV2(w, menu) {
+		return
+	}
+	if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, []string{menu.ID}); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'attivazione del menu")
+		return
+	}
+
+	publishMenuEvent(r, events.MenuActivated, menu)
+	httputil.Success(w, "Menu attivato", map[string]interface{}{"active_menu_ids": restaurant.DisplayMenuIDs()})
+}
+
+// DisplayMenuV2Handler aggiunge il menu in coda a quelli attivi
+// (POST /api/v2/menus/{id}/display)
+func DisplayMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil || rejectArchivedMenuV2(w, menu) || rejectDraftMenuV2(w, menu) {
+		return
+	}
+	if active := restaurant.DisplayMenuIDs(); !containsMenuID(active, menu.ID) {
+		active = append(append([]string(nil), active...), menu.ID)
+		if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, active); err != nil {
+			respondMenuV2Error(w, r, err, "Errore nell'attivazione del menu")
+			return
+		}
+		publishMenuEvent(r, events.MenuActivated, menu)
+	}
+	httputil.Success(w, "Menu mostrato", map[string]interface{}{"active_menu_ids": restaurant.DisplayMenuIDs()})
+}
+
+// HideMenuV2Handler toglie il menu da quelli attivi (POST /api/v2/menus/{id}/hide)
+func HideMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menuID := mux.Vars(r)["id"]
+	active := restaurant.DisplayMenuIDs()
+	if !containsMenuID(active, menuID) {
+		httputil.NotFound(w, "Menu attivo")
+		return
+	}
+	if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, removeMenuID(active, menuID)); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella disattivazione del menu")
+		return
+	}
+	httputil.Success(w, "Menu nascosto", map[string]interface{}{"active_menu_ids": restaurant.DisplayMenuIDs()})
+}
+
+// MoveMenuV2Handler sposta un menu attivo nell'ordine di visualizzazione
+// (POST /api/v2/menus/{id}/move con {"direction": "up"|"down"})
+func MoveMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req struct {
+		Direction string `json:"direction"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	var delta int
+	switch req.Direction {
+	case "up":
+		delta = -1
+	case "down":
+		delta = 1
+	default:
+		httputil.BadRequest(w, "Direzione non valida (up, down)")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menuID := mux.Vars(r)["id"]
+	active := restaurant.DisplayMenuIDs()
+	if !containsMenuID(active, menuID) {
+		httputil.NotFound(w, "Menu attivo")
+		return
+	}
+	if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, moveMenuID(active, menuID, delta)); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel riordino dei menu")
+		return
+	}
+	httputil.Success(w, "Menu riordinati", map[string]interface{}{"active_menu_ids": restaurant.DisplayMenuIDs()})
+}
+
+// ArchiveMenuV2Handler archivia un menu completato con le statistiche della stagione
+// (POST /api/v2/menus/{id}/archive con {"season": "..."} opzionale)
+func ArchiveMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req struct {
+		Season string `json:"season"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httputil.BadRequest(w, "Formato JSON non valido")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil || rejectArchivedMenuV2(w, menu) || rejectDraftMenuV2(w, menu) {
+		return
+	}
+	if err := archiveMenu(ctx, restaurant, menu, req.Season); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'archiviazione del menu")
+		return
+	}
+
+	RecordAuditLogAsync("MENU_ARCHIVED", "menu", menu.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Menu archiviato", menu)
+}
+
+// RestoreMenuV2Handler riporta un menu archiviato tra i completati
+// (POST /api/v2/menus/{id}/restore)
+func RestoreMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil {
+		return
+	}
+	if !menu.IsArchived {
+		httputil.Conflict(w, "Il menu non è archiviato")
+		return
+	}
+	menu.IsArchived = false
+	if !saveMenuV2(ctx, w, r, menu) {
+		return
+	}
+
+	RecordAuditLogAsync("MENU_RESTORED", "menu", menu.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Menu ripristinato", menu)
+}
+
+// DuplicateMenuV2Handler crea una copia in bozza del menu (POST /api/v2/menus/{id}/duplicate)
+func DuplicateMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	original := loadMenuV2(ctx, w, r)
+	if original == nil {
+		return
+	}
+	menu := duplicateMenu(original)
+	if err := db.MongoInstance.CreateMenu(ctx, menu); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella duplicazione del menu")
+		return
+	}
+
+	publishMenuEvent(r, events.MenuCreated, menu)
+	w.Header().Set("Location", "/api/v2/menus/"+menu.ID)
+	httputil.Created(w, "Menu duplicato", menu)
+}
+
+// AddItemV2Handler aggiunge un piatto a una categoria
+// (POST /api/v2/menus/{id}/categories/{categoryId}/items)
+func AddItemV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req itemV2Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu := loadMenuV2(ctx, w, r)
+	if menu == nil || rejectArchivedMenuV2(w, menu) {
+		return
+	}
+	categoryID := mux.Vars(r)["categoryId"]
+	for i, category := range menu.Categories {
+		if category.ID != categoryID {
+			continue
+		}
+		item, err := newItemV2(req, category.Name)
+		if err != nil {
+			httputil.BadRequest(w, err.Error())
+			return
+		}
+		menu.Categories[i].Items = append(menu.Categories[i].Items, item)
+		if !saveMenuV2(ctx, w, r, menu) {
+			return
+		}
+
+		publishItemEvent(r, menu, &item, "created")
+		httputil.Created(w, "Piatto aggiunto", menuItemResponse{MenuItem: item, CategoryID: category.ID, CategoryName: category.Name})
+		return
+	}
+	httputil.NotFound(w, "Categoria")
+}
+
+// loadMenuItemV2 carica il menu modificabile e la posizione del piatto {itemId} nella
+// categoria {categoryId}; risponde con l'errore e restituisce ok false se non esistono
+func loadMenuItemV2(ctx context.Context, w http.ResponseWriter, r *http.Request, restaurant *models.Restaurant) (menu *models.Menu, ci, ii int, ok bool) {
+	menu = loadMenuV2(ctx, w, r)
+	if menu == nil || rejectArchivedMenuV2(w, menu) {
+		return nil, 0, 0, false
+	}
+	vars := mux.Vars(r)
+	ci, ii, ok = findMenuItem(menu, vars["categoryId"], vars["itemId"])
+	if !ok {
+		httputil.NotFound(w, "Piatto")
+	}
+	return menu, ci, ii, ok
+}
+
+// UpdateItemV2Handler modifica un piatto; i campi assenti restano invariati
+// (PATCH /api/v2/menus/{id}/categories/{categoryId}/items/{itemId})
+func UpdateItemV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req itemV2Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, ci, ii, ok := loadMenuItemV2(ctx, w, r, restaurant)
+	if !ok {
+		return
+	}
+	item := menu.Categories[ci].Items[ii]
+	if err := req.apply(&item); err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	menu.Categories[ci].Items[ii] = item
+	if !saveMenuV2(ctx, w, r, menu) {
+		return
+	}
+
+	publishItemEvent(r, menu, &item, "updated")
+	category := menu.Categories[ci]
+	httputil.Success(w, "Piatto aggiornato", menuItemResponse{MenuItem: item, CategoryID: category.ID, CategoryName: category.Name})
+}
+
+// DeleteItemV2Handler sposta un piatto nel cestino del menu
+// (DELETE /api/v2/menus/{id}/categories/{categoryId}/items/{itemId})
+func DeleteItemV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, ci, ii, ok := loadMenuItemV2(ctx, w, r, restaurant)
+	if !ok {
+		return
+	}
+	item := trashMenuItem(menu, ci, ii)
+	if !saveMenuV2(ctx, w, r, menu) {
+		return
+	}
+
+	publishItemEvent(r, menu, &item, "deleted")
+	httputil.NoContent(w)
+}
+
+// DuplicateItemV2Handler aggiunge alla categoria la copia di un piatto
+// (POST /api/v2/menus/{id}/categories/{categoryId}/items/{itemId}/duplicate)
+func DuplicateItemV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, ci, ii, ok := loadMenuItemV2(ctx, w, r, restaurant)
+	if !ok {
+		return
+	}
+	item := duplicateMenuItem(menu.Categories[ci].Items[ii])
+	menu.Categories[ci].Items = append(menu.Categories[ci].Items, item)
+	if !saveMenuV2(ctx, w, r, menu) {
+		return
+	}
+
+	publishItemEvent(r, menu, &item, "created")
+	category := menu.Categories[ci]
+	httputil.Created(w, "Piatto duplicato", menuItemResponse{MenuItem: item, CategoryID: category.ID, CategoryName: category.Name})
+}
+
+// UploadItemImageV2Handler carica l'immagine di un piatto (campo multipart "image")
+// (POST /api/v2/menus/{id}/categories/{categoryId}/items/{itemId}/image)
+func UploadItemImageV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	menu, ci, ii, ok := loadMenuItemV2(ctx, w, r, restaurant)
+	if !ok {
+		return
+	}
+
+	if err := r.ParseMultipartForm(maxFileSize); err != nil {
+		httputil.BadRequest(w, "Richiesta multipart non valida")
+		return
+	}
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		httputil.BadRequest(w, "Nessuna immagine caricata")
+		return
+	}
+	defer file.Close()
+
+	item := menu.Categories[ci].Items[ii]
+	uploaded, err := processImageUpload(ctx, file, header)
+	switch {
+	case errors.Is(err, avscan.ErrInfected):
+		RecordAuditLogAsync("UPLOAD_QUARANTINED", "item", item.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "failure")
+		httputil.ErrorMessage(w, http.StatusUnprocessableEntity, "Il file è stato bloccato dal controllo antivirus")
+		return
+	case errors.Is(err, avscan.ErrUnavailable):
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Controllo antivirus non disponibile, riprova più tardi")
+		return
+	case err != nil:
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	deleteItemImage(ctx, item)
+	item.ImageURL = uploaded.URL
+	item.ImageID = uploaded.ID
+	item.ImageVariants = uploaded.Variants
+	menu.Categories[ci].Items[ii] = item
+	if !saveMenuV2(ctx, w, r, menu) {
+		return
+	}
+
+	publishItemEvent(r, menu, &item, "updated")
+	category := menu.Categories[ci]
+	httputil.Success(w, "Immagine caricata", menuItemResponse{MenuItem: item, CategoryID: category.ID, CategoryName: category.Name})
+}
@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/nfc"
+)
+
+const (
+	// nfcTagCodeLength è la lunghezza del codice dei tag NFC: corto, così l'indirizzo sta
+	// anche nei tag più piccoli
+	nfcTagCodeLength = 8
+	// maxNFCTags è il numero massimo di tag NFC di un ristorante
+	maxNFCTags = 500
+	// maxNFCTagsPerRequest è il numero massimo di tag creati con una richiesta
+	maxNFCTagsPerRequest = 100
+	// maxNFCTagLabel è la lunghezza massima dell'etichetta di un tag, in caratteri
+	maxNFCTagLabel = 100
+)
+
+// errNFCTagMenu indica che il menu scelto per il tag non può essere aperto dai clienti
+var errNFCTagMenu = errors.New("Il menu del tag deve essere un menu completato e non archiviato")
+
+// nfcTagURL è l'indirizzo scritto sul tag NFC
+func nfcTagURL(baseURL, code string) string {
+	return baseURL + "/n/" + code
+}
+
+// nfcTagView è un tag NFC con l'indirizzo e il messaggio NDEF da scrivere, e i chip in cui
+// il messaggio entra
+type nfcTagView struct {
+	*models.NFCTag
+	URL   string     `json:"url"`
+	NDEF  string     `json:"ndef"`      // Messaggio NDEF in esadecimale, per le app di scrittura
+	Bytes int        `json:"ndef_size"` // Memoria occupata sui tag Type 2, TLV inclusi
+	Chips []nfc.Chip `json:"chips"`
+}
+
+func newNFCTagView(tag *models.NFCTag, baseURL string) nfcTagView {
+	view := nfcTagView{NFCTag: tag, URL: nfcTagURL(baseURL, tag.Code), Chips: []nfc.Chip{}}
+	if msg, err := nfc.URIMessage(view.URL); err == nil {
+		view.NDEF = hex.EncodeToString(msg)
+		view.Bytes = len(nfc.Type2TLV(msg))
+		if chips := nfc.Fits(view.Bytes); chips != nil {
+			view.Chips = chips
+		}
+	}
+	return view
+}
+
+// nfcTagRequest è il corpo delle richieste di creazione e modifica dei tag. Con Count i tag
+// creati sono numerati dopo l'etichetta, es. "Tavolo 1", "Tavolo 2"
+type nfcTagRequest struct {
+	Label  *string `json:"label"`
+	MenuID *string `json:"menu_id"` // Vuoto: i menu attivi
+	Active *bool   `json:"active"`
+	Count  int     `json:"count"` // Solo in creazione, default 1
+}
+
+// validateNFCTagLabel restituisce l'etichetta senza spazi iniziali e finali
+func validateNFCTagLabel(label string) (string, error) {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return "", errors.New("L'etichetta è obbligatoria")
+	}
+	if utf8.RuneCountInString(label) > maxNFCTagLabel {
+		return "", fmt.Errorf("L'etichetta può avere al massimo %d caratteri", maxNFCTagLabel)
+	}
+	return label, nil
+}
+
+// validateNFCTagMenu controlla che il menu scelto per il tag sia un menu completato e non
+// archiviato del ristorante
+func validateNFCTagMenu(ctx context.Context, restaurantID, menuID string) (string, error) {
+	if menuID == "" {
+		return "", nil
+	}
+	menu, err := db.MongoInstance.GetRestaurantMenu(ctx, menuID, restaurantID)
+	if err != nil {
+		return "", err
+	}
+	if menu == nil || !menu.IsCompleted || menu.IsArchived {
+		return "", errNFCTagMenu
+	}
+	return menu.ID, nil
+}
+
+// ListNFCTagsHandler restituisce i tag NFC del ristorante con le aperture del menu
+// (GET /api/v1/nfc/tags)
+func ListNFCTagsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tags, err := db.MongoInstance.GetNFCTags(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei tag NFC")
+		return
+	}
+	baseURL := getBaseURL(r)
+	views := make([]nfcTagView, 0, len(tags))
+	for _, tag := range tags {
+		views = append(views, newNFCTagView(tag, baseURL))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Tag NFC", views)
+}
+
+// CreateNFCTagsHandler crea uno o più tag NFC, ciascuno con il suo indirizzo breve
+// (POST /api/v1/nfc/tags)
+func CreateNFCTagsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	var req nfcTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if req.Label == nil {
+		httputil.BadRequest(w, "L'etichetta è obbligatoria")
+		return
+	}
+	label, err := validateNFCTagLabel(*req.Label)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	count := req.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 1 || count > maxNFCTagsPerRequest {
+		httputil.BadRequest(w, fmt.Sprintf("count deve essere tra 1 e %d", maxNFCTagsPerRequest))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	menuID := ""
+	if req.MenuID != nil {
+		if menuID, err = validateNFCTagMenu(ctx, restaurant.ID, *req.MenuID); err == errNFCTagMenu {
+			httputil.BadRequest(w, err.Error())
+			return
+		}
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+			return
+		}
+	}
+	existing, err := db.MongoInstance.GetNFCTags(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei tag NFC")
+		return
+	}
+	if len(existing)+count > maxNFCTags {
+		httputil.Conflict(w, fmt.Sprintf("Un ristorante può avere al massimo %d tag NFC", maxNFCTags))
+		return
+	}
+
+	baseURL := getBaseURL(r)
+	views := make([]nfcTagView, 0, count)
+	now := time.Now()
+	for i := 1; i <= count; i++ {
+		tag := &models.NFCTag{
+			ID:           uuid.New().String(),
+			RestaurantID: restaurant.ID,
+			Label:        label,
+			MenuID:       menuID,
+			Active:       req.Active == nil || *req.Active,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if count > 1 {
+			tag.Label = fmt.Sprintf("%s %d", label, i)
+		}
+		err := createWithRandomCode(nfcTagCodeLength, db.ErrDuplicateNFCTagCode, func(code string) error {
+			tag.Code = code
+			return db.MongoInstance.CreateNFCTag(ctx, tag)
+		})
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nella creazione del tag NFC")
+			return
+		}
+		RecordAuditLogAsync("NFC_TAG_CREATED", "nfc_tag", tag.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+		views = append(views, newNFCTagView(tag, baseURL))
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Created(w, "Tag NFC creati", views)
+}
+
+// nfcTagFromRequest carica il tag NFC del ristorante indicato nel percorso
+func nfcTagFromRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, restaurant *models.Restaurant) *models.NFCTag {
+	tag, err := db.MongoInstance.GetNFCTag(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del tag NFC")
+		return nil
+	}
+	if tag == nil {
+		httputil.NotFound(w, "Tag NFC")
+		return nil
+	}
+	return tag
+}
+
+// UpdateNFCTagHandler modifica etichetta, menu o stato di un tag NFC; il codice, già scritto
+// sul tag, non cambia (PUT /api/v1/nfc/tags/{id})
+func UpdateNFCTagHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	var req nfcTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tag := nfcTagFromRequest(ctx, w, r, restaurant)
+	if tag == nil {
+		return
+	}
+	var err error
+	if req.Label != nil {
+		if tag.Label, err = validateNFCTagLabel(*req.Label); err != nil {
+			httputil.BadRequest(w, err.Error())
+			return
+		}
+	}
+	if req.MenuID != nil {
+		if tag.MenuID, err = validateNFCTagMenu(ctx, restaurant.ID, *req.MenuID); err == errNFCTagMenu {
+			httputil.BadRequest(w, err.Error())
+			return
+		}
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+			return
+		}
+	}
+	if req.Active != nil {
+		tag.Active = *req.Active
+	}
+	tag.UpdatedAt = time.Now()
+	if err := db.MongoInstance.UpdateNFCTag(ctx, tag); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio del tag NFC")
+		return
+	}
+
+	RecordAuditLogAsync("NFC_TAG_UPDATED", "nfc_tag", tag.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Tag NFC aggiornato", newNFCTagView(tag, getBaseURL(r)))
+}
+
+// DeleteNFCTagHandler elimina un tag NFC: il suo indirizzo smette di aprire il menu
+// (DELETE /api/v1/nfc/tags/{id})
+func DeleteNFCTagHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id := mux.Vars(r)["id"]
+	deleted, err := db.MongoInstance.DeleteNFCTag(ctx, id, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'eliminazione del tag NFC")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "Tag NFC")
+		return
+	}
+	RecordAuditLogAsync("NFC_TAG_DELETED", "nfc_tag", id, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// NFCTagNDEFHandler scarica il messaggio NDEF del tag da scrivere con le app e gli
+// encoder NFC; con format=tlv lo restituisce nei blocchi TLV dei tag Type 2 (NTAG21x)
+// (GET /api/v1/nfc/tags/{id}/ndef)
+func NFCTagNDEFHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "ndef" && format != "tlv" {
+		httputil.BadRequest(w, "Formato non supportato: usare ndef o tlv")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tag := nfcTagFromRequest(ctx, w, r, restaurant)
+	if tag == nil {
+		return
+	}
+	msg, err := nfc.URIMessage(nfcTagURL(getBaseURL(r), tag.Code))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella creazione del messaggio NDEF")
+		return
+	}
+	if format == "tlv" {
+		msg = nfc.Type2TLV(msg)
+	} else {
+		format = "ndef"
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, tag.Code, format))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(msg)
+}
+
+// NFCTagRedirectHandler apre il menu dal tag NFC (GET /n/{code}): il menu scelto per il tag
+// o i menu attivi del ristorante. L'apertura è contata sul tag e nelle analytics con origine
+// nfc, a parte rispetto alle scansioni del QR code
+func NFCTagRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tag, err := db.MongoInstance.GetNFCTagByCode(ctx, normalizeCode(mux.Vars(r)["code"]))
+	if err != nil || tag == nil || !tag.Active {
+		http.NotFound(w, r)
+		return
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, tag.RestaurantID)
+	if err != nil || restaurant == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !restaurant.IsActive {
+		renderRestaurantUnavailable(w)
+		return
+	}
+
+	menuID := restaurant.ActiveMenuID
+	if tag.MenuID != "" {
+		if _, err := validateNFCTagMenu(ctx, restaurant.ID, tag.MenuID); err == nil {
+			menuID = tag.MenuID
+		} else {
+			// Menu eliminato o archiviato dopo la scrittura del tag: si aprono i menu attivi
+			tag.MenuID = ""
+		}
+	}
+
+	meterUsage(restaurant.ID, models.UsageQRScans)
+	publishNFCScan(r, restaurant, tag, menuID)
+	if err := db.MongoInstance.RecordNFCTagScan(ctx, tag.ID, time.Now()); err != nil {
+		log.Printf("Errore nel conteggio dell'apertura del tag NFC %s: %v", tag.ID, err)
+	}
+
+	if tag.MenuID != "" {
+		http.Redirect(w, r, menuRedirectPath(r, tag.MenuID), http.StatusFound)
+		return
+	}
+	serveActiveMenus(ctx, w, r, restaurant)
+}
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/i18n"
+)
+
+// ownerEvent descrive un tipo di notifica al proprietario e i canali su cui è inviata
+// finché l'utente non li cambia dalla pagina account
+type ownerEvent struct {
+	Key      string // Chiave i18n del messaggio, usata anche come tipo di evento
+	Label    string
+	Urgent   bool // Avvisi di sicurezza: sempre via email e mai raggruppati nel digest
+	Channels []string
+}
+
+// ownerEvents elenca gli eventi notificati ai proprietari, nell'ordine mostrato nella pagina account
+var ownerEvents = []ownerEvent{
+	{Key: i18n.KeyUsernameChanged, Label: "Username modificato", Urgent: true, Channels: []string{models.ChannelEmail, models.ChannelPush}},
+	{Key: i18n.KeyEmailChangeRequested, Label: "Richiesta di cambio email", Urgent: true, Channels: []string{models.ChannelEmail, models.ChannelPush}},
+	{Key: i18n.KeyPasswordChanged, Label: "Password modificata", Urgent: true, Channels: []string{models.ChannelEmail, models.ChannelPush}},
+	{Key: i18n.KeyIdentityLinked, Label: "Accesso social collegato", Urgent: true, Channels: []string{models.ChannelEmail, models.ChannelPush}},
+	{Key: i18n.KeyAccountDeletionPending, Label: "Eliminazione account programmata", Urgent: true, Channels: []string{models.ChannelEmail, models.ChannelPush}},
+	{Key: i18n.KeyTrialEnding, Label: "Prova gratuita in scadenza", Channels: []string{models.ChannelEmail, models.ChannelPush}},
+	{Key: i18n.KeyTrialExpired, Label: "Prova gratuita terminata", Channels: []string{models.ChannelEmail}},
+	{Key: i18n.KeyMenuActivated, Label: "Menu attivato dallo staff", Channels: []string{models.ChannelPush}},
+	{Key: i18n.KeyItemLowStock, Label: "Scorta bassa di un piatto", Channels: []string{models.ChannelEmail, models.ChannelPush}},
+	{Key: i18n.KeyItemSoldOut, Label: "Piatto esaurito", Channels: []string{models.ChannelPush}},
+	{Key: i18n.KeyPromotionActive, Label: "Promozione attiva nel menu", Channels: []string{models.ChannelPush}},
+	{Key: i18n.KeyWeeklyDigest, Label: "Riepilogo settimanale delle statistiche", Channels: []string{models.ChannelEmail}},
+}
+
+var notificationChannels = []string{models.ChannelEmail, models.ChannelPush, models.ChannelSMS}
+
+// findOwnerEvent restituisce l'evento con la chiave indicata; gli eventi non registrati
+// sono trattati come urgenti e inviati su tutti i canali
+func findOwnerEvent(key string) ownerEvent {
+	for _, event := range ownerEvents {
+		if event.Key == key {
+			return event
+		}
+	}
+	return ownerEvent{Key: key, Urgent: true, Channels: notificationChannels}
+}
+
+// channelsFor restituisce i canali su cui inviare l'evento secondo le preferenze dell'utente.
+// Gli eventi urgenti sono sempre inviati anche via email
+func (e ownerEvent) channelsFor(prefs models.NotificationPreferences) []string {
+	channels, ok := prefs.Channels[e.Key]
+	if !ok {
+		channels = e.Channels
+	}
+	if e.Urgent && !containsString(channels, models.ChannelEmail) {
+		channels = append([]string{models.ChannelEmail}, channels...)
+	}
+	return channels
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyOwner avvisa il proprietario sui canali scelti per il tipo di evento. Se l'utente ha
+// attivato il digest, le notifiche non urgenti sono accodate e inviate nel riepilogo orario o
+// giornaliero. Restituisce l'errore dell'email o dell'accodamento: push e SMS sono inviati in
+// background
+func notifyOwner(ctx context.Context, user *models.User, key string, data map[string]interface{}) error {
+	event := findOwnerEvent(key)
+	pushEnabled := (pushSender != nil || webPushSender != nil) && db.MongoInstance != nil
+	smsEnabled := smsSender != nil && user.Phone != "" && db.MongoInstance != nil
+	digest := user.Notifications.Digest != models.DigestOff && !event.Urgent && db.MongoInstance != nil
+
+	var err error
+	for _, channel := range event.channelsFor(user.Notifications) {
+		if (channel == models.ChannelPush && !pushEnabled) || (channel == models.ChannelSMS && !smsEnabled) {
+			continue
+		}
+		switch {
+		case digest:
+			if qerr := enqueueNotification(ctx, user, channel, key, data); qerr != nil {
+				err = qerr
+			}
+		case channel == models.ChannelEmail:
+			err = notifyUser(ctx, user.Email, user.Locale, key, data)
+		case channel == models.ChannelPush:
+			go pushToUser(context.WithoutCancel(ctx), user.ID, user.Locale, key, data)
+		case channel == models.ChannelSMS:
+			go smsToUser(context.WithoutCancel(ctx), user, key, data)
+		}
+	}
+	return err
+}
+
+// enqueueNotification localizza la notifica e la mette in attesa del prossimo digest
+func enqueueNotification(ctx context.Context, user *models.User, channel, key string, data map[string]interface{}) error {
+	msg, err := i18n.Default().Render(user.Locale, key, data)
+	if err != nil {
+		return err
+	}
+	return db.MongoInstance.EnqueueNotification(ctx, &models.PendingNotification{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Channel:   channel,
+		Key:       key,
+		Subject:   msg.Subject,
+		Body:      msg.Body,
+		CreatedAt: time.Now(),
+	})
+}
+
+// digestDue indica se all'ora di now va inviato il riepilogo dell'utente. Chi ha disattivato
+// il digest riceve subito le notifiche rimaste in coda
+func digestDue(prefs models.NotificationPreferences, now time.Time) bool {
+	switch prefs.Digest {
+	case models.DigestHourly:
+		return true
+	case models.DigestDaily:
+		return now.Hour() == prefs.DigestHour
+	}
+	return true
+}
+
+// SendNotificationDigests invia i riepiloghi delle notifiche in coda degli utenti per cui
+// è l'ora del digest, un messaggio per canale. Restituisce il numero di riepiloghi inviati
+func SendNotificationDigests(ctx context.Context, now time.Time) (int, error) {
+	if db.MongoInstance == nil {
+		return 0, nil
+	}
+
+	userIDs, err := db.MongoInstance.GetUsersWithPendingNotifications(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		user, err := db.MongoInstance.GetUserByID(ctx, userID)
+		if err == nil && user != nil && user.IsActive && !digestDue(user.Notifications, now) {
+			continue
+		}
+
+		pending, err := db.MongoInstance.TakePendingNotifications(ctx, userID)
+		if err != nil {
+			logger.WarnCtx(ctx, "Errore nel recupero delle notifiche in coda", map[string]interface{}{
+				"error":   err.Error(),
+				"user_id": userID,
+			})
+			continue
+		}
+		if user == nil || !user.IsActive {
+			continue // Account eliminato o disattivato: le notifiche in coda sono scartate
+		}
+
+		byChannel := make(map[string][]*models.PendingNotification)
+		for _, n := range pending {
+			byChannel[n.Channel] = append(byChannel[n.Channel], n)
+		}
+		for channel, items := range byChannel {
+			if err := sendDigest(ctx, user, channel, items); err != nil {
+				logger.WarnCtx(ctx, "Errore nell'invio del riepilogo notifiche", map[string]interface{}{
+					"error":   err.Error(),
+					"user_id": userID,
+					"channel": channel,
+				})
+				continue
+			}
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendDigest invia su un canale il riepilogo delle notifiche accodate
+func sendDigest(ctx context.Context, user *models.User, channel string, items []*models.PendingNotification) error {
+	data := map[string]interface{}{
+		"Count": len(items),
+		"Items": items,
+	}
+	switch channel {
+	case models.ChannelEmail:
+		return notifyUser(ctx, user.Email, user.Locale, i18n.KeyNotificationDigest, data)
+	case models.ChannelPush:
+		if pushSender != nil || webPushSender != nil {
+			pushToUser(ctx, user.ID, user.Locale, i18n.KeyNotificationDigest, data)
+		}
+	case models.ChannelSMS:
+		if smsSender != nil && user.Phone != "" {
+			return smsToUser(ctx, user, i18n.KeyNotificationDigest, data)
+		}
+	}
+	return nil
+}
+
+func nextHour(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day(), now.Hour()+1, 0, 0, 0, now.Location())
+}
+
+// RunNotificationDigestWorker invia allo scoccare di ogni ora i riepiloghi delle notifiche
+// in coda, finché ctx non viene annullato. È bloccante: va avviato in una goroutine
+func RunNotificationDigestWorker(ctx context.Context) {
+	for {
+		timer := time.NewTimer(time.Until(nextHour(time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, 15*time.Minute)
+		sent, err := SendNotificationDigests(runCtx, time.Now())
+		cancel()
+		if err != nil {
+			logger.Error("Errore nell'invio dei riepiloghi delle notifiche", map[string]interface{}{
+				"error": err.Error(),
+				"sent":  sent,
+			})
+			continue
+		}
+		if sent > 0 {
+			logger.Info("Riepiloghi delle notifiche inviati", map[string]interface{}{
+				"sent": sent,
+			})
+		}
+	}
+}
+
+// notificationEventRow è una riga della tabella delle preferenze nella pagina account
+type notificationEventRow struct {
+	Key    string
+	Label  string
+	Urgent bool
+	Email  bool
+	Push   bool
+	SMS    bool
+}
+
+// notificationEventRows restituisce i canali attivi per ogni evento, per la pagina account
+func notificationEventRows(prefs models.NotificationPreferences) []notificationEventRow {
+	rows := make([]notificationEventRow, 0, len(ownerEvents))
+	for _, event := range ownerEvents {
+		channels := event.channelsFor(prefs)
+		rows = append(rows, notificationEventRow{
+			Key:    event.Key,
+			Label:  event.Label,
+			Urgent: event.Urgent,
+			Email:  containsString(channels, models.ChannelEmail),
+			Push:   containsString(channels, models.ChannelPush),
+			SMS:    containsString(channels, models.ChannelSMS),
+		})
+	}
+	return rows
+}
+
+// ChangeNotificationPreferencesHandler salva canali e frequenza delle notifiche. Il form invia
+// per ogni evento le checkbox "<evento>" con i canali scelti
+func ChangeNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, _, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	prefs := models.NotificationPreferences{
+		Channels: make(map[string][]string, len(ownerEvents)),
+		Digest:   r.FormValue("digest"),
+	}
+	switch prefs.Digest {
+	case models.DigestOff, models.DigestHourly:
+	case models.DigestDaily:
+		hour, err := strconv.Atoi(r.FormValue("digest_hour"))
+		if err != nil || hour < 0 || hour > 23 {
+			http.Redirect(w, r, "/account?error=notifications_invalid", http.StatusSeeOther)
+			return
+		}
+		prefs.DigestHour = hour
+	default:
+		http.Redirect(w, r, "/account?error=notifications_invalid", http.StatusSeeOther)
+		return
+	}
+	for _, event := range ownerEvents {
+		channels := []string{}
+		for _, channel := range r.Form[event.Key] {
+			if containsString(notificationChannels, channel) && !containsString(channels, channel) {
+				channels = append(channels, channel)
+			}
+		}
+		prefs.Channels[event.Key] = channels
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.UpdateUserNotificationPreferences(ctx, user.ID, prefs); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio delle preferenze di notifica", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		http.Error(w, "Errore nel salvataggio delle preferenze", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/account?success=notifications_changed", http.StatusSeeOther)
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+)
+
+// publicNutrition sono le informazioni nutrizionali di un piatto nelle API pubbliche: solo
+// quelle che il ristorante ha scelto di pubblicare, arrotondate come nelle etichette
+type publicNutrition struct {
+	PortionGrams    float64                 `json:"portion_grams,omitempty"`
+	Calories        *float64                `json:"calories,omitempty"` // kcal per porzione
+	PerPortion      *models.NutritionValues `json:"per_portion,omitempty"`
+	Per100g         *models.NutritionValues `json:"per_100g,omitempty"`
+	CaloriesPer100g *float64                `json:"calories_per_100g,omitempty"`
+}
+
+// newPublicNutrition filtra le informazioni nutrizionali secondo le opzioni del ristorante;
+// nil se non c'è nulla da pubblicare
+func newPublicNutrition(nutrition *models.Nutrition, display models.NutritionDisplay) *publicNutrition {
+	if nutrition == nil || nutrition.IsEmpty() || !display.Enabled() {
+		return nil
+	}
+	out := &publicNutrition{PortionGrams: nutrition.Portion()}
+	totals := nutrition.Totals().Rounded()
+	per100, hasPer100 := nutrition.Per100g()
+	per100 = per100.Rounded()
+	hasPer100 = hasPer100 && display.Per100g
+
+	if display.Macros {
+		out.PerPortion = &totals
+		if hasPer100 {
+			out.Per100g = &per100
+		}
+	} else {
+		out.Calories = &totals.Calories
+		if hasPer100 {
+			out.CaloriesPer100g = &per100.Calories
+		}
+	}
+	return out
+}
+
+// publicMenuSection è il menu passato al template delle categorie insieme al ristorante,
+// per le opzioni di visualizzazione
+type publicMenuSection struct {
+	*models.Menu
+	Restaurant *models.Restaurant
+}
+
+// withRestaurant affianca al menu il suo ristorante nei template delle pagine pubbliche
+func withRestaurant(menu *models.Menu, restaurant *models.Restaurant) publicMenuSection {
+	return publicMenuSection{Menu: menu, Restaurant: restaurant}
+}
+
+// nutritionFacts restituisce la riga con le informazioni nutrizionali del piatto mostrata nel
+// menu pubblico (es. "520 kcal · proteine 21 g · ..."), vuota se il ristorante non le pubblica
+func nutritionFacts(restaurant *models.Restaurant, item models.MenuItem) string {
+	if restaurant == nil {
+		return ""
+	}
+	facts := newPublicNutrition(item.Nutrition, restaurant.NutritionDisplay)
+	if facts == nil {
+		return ""
+	}
+
+	var parts []string
+	if facts.PerPortion != nil {
+		parts = append(parts, formatNutritionValues(*facts.PerPortion)...)
+	} else {
+		parts = append(parts, fmt.Sprintf("%.0f kcal", *facts.Calories))
+	}
+	line := strings.Join(parts, " · ")
+	if facts.PortionGrams > 0 {
+		line = fmt.Sprintf("Porzione %.0f g: %s", facts.PortionGrams, line)
+	}
+	switch {
+	case facts.Per100g != nil:
+		line += fmt.Sprintf(" (per 100 g: %s)", strings.Join(formatNutritionValues(*facts.Per100g), " · "))
+	case facts.CaloriesPer100g != nil:
+		line += fmt.Sprintf(" (%.0f kcal per 100 g)", *facts.CaloriesPer100g)
+	}
+	return line
+}
+
+// formatNutritionValues descrive calorie e macronutrienti, tralasciando i valori opzionali assenti
+func formatNutritionValues(v models.NutritionValues) []string {
+	parts := []string{
+		fmt.Sprintf("%.0f kcal", v.Calories),
+		fmt.Sprintf("proteine %s g", formatGrams(v.Protein)),
+		fmt.Sprintf("carboidrati %s g", formatGrams(v.Carbohydrates)),
+		fmt.Sprintf("grassi %s g", formatGrams(v.Fat)),
+	}
+	if v.Fiber > 0 {
+		parts = append(parts, fmt.Sprintf("fibre %s g", formatGrams(v.Fiber)))
+	}
+	if v.Salt > 0 {
+		parts = append(parts, fmt.Sprintf("sale %s g", formatGrams(v.Salt)))
+	}
+	return parts
+}
+
+// formatGrams scrive i grammi con al più un decimale e la virgola decimale
+func formatGrams(value float64) string {
+	s := strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0")
+	return strings.Replace(s, ".", ",", 1)
+}
+
+// SetNutritionDisplayHandler imposta quali informazioni nutrizionali dei piatti il ristorante
+// pubblica nel menu e nelle API pubbliche (POST /account/nutrition-display)
+func SetNutritionDisplayHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	display := models.NutritionDisplay{
+		Calories: r.FormValue("calories") == "on",
+		Macros:   r.FormValue("macros") == "on",
+		Per100g:  r.FormValue("per_100g") == "on",
+	}
+	if display == restaurant.NutritionDisplay {
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.SetRestaurantNutritionDisplay(ctx, restaurant, display); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'impostazione delle informazioni nutrizionali", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nell'impostazione delle informazioni nutrizionali", http.StatusInternalServerError)
+		return
+	}
+
+	RecordAuditLogAsync("RESTAURANT_NUTRITION_DISPLAY_CHANGED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+
+	http.Redirect(w, r, "/account?success=nutrition_display_changed", http.StatusSeeOther)
+}
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/i18n"
+	"qr-menu/pkg/oauth"
+)
+
+// Accesso con Google e Apple (OpenID Connect). Il cookie oauth_state lega la risposta del
+// provider al browser che ha avviato l'accesso e contiene state, nonce e modalità
+// (login o collegamento dalla pagina account)
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStateTTL    = 10 * time.Minute
+	oauthModeLogin   = "login"
+	oauthModeLink    = "link"
+)
+
+// oauthProviderOrder e oauthProviderLabels definiscono ordine e nome dei provider nelle pagine
+var (
+	oauthProviderOrder  = []string{"google", "apple"}
+	oauthProviderLabels = map[string]string{"google": "Google", "apple": "Apple"}
+)
+
+var oauthProviders = map[string]*oauth.Provider{}
+
+// SetOAuthProviders abilita l'accesso con i provider configurati (sezione oauth)
+func SetOAuthProviders(providers ...*oauth.Provider) {
+	oauthProviders = make(map[string]*oauth.Provider, len(providers))
+	for _, p := range providers {
+		oauthProviders[p.Name] = p
+	}
+}
+
+// oauthProviderOption è un pulsante "Continua con ..." della pagina di login
+type oauthProviderOption struct {
+	ID    string
+	Label string
+}
+
+// oauthProviderOptions restituisce i provider abilitati, nell'ordine mostrato nel login
+func oauthProviderOptions() []oauthProviderOption {
+	var options []oauthProviderOption
+	for _, id := range oauthProviderOrder {
+		if oauthProviders[id] != nil {
+			options = append(options, oauthProviderOption{ID: id, Label: oauthProviderLabels[id]})
+		}
+	}
+	return options
+}
+
+// linkedIdentityRow è un provider come mostrato nella pagina account
+type linkedIdentityRow struct {
+	ID       string
+	Label    string
+	Linked   bool
+	Email    string
+	LinkedAt time.Time
+}
+
+// linkedIdentityRows restituisce i provider abilitati o già collegati all'utente
+func linkedIdentityRows(user *models.User) []linkedIdentityRow {
+	var rows []linkedIdentityRow
+	for _, id := range oauthProviderOrder {
+		identity := user.Identity(id)
+		if identity == nil && oauthProviders[id] == nil {
+			continue
+		}
+		row := linkedIdentityRow{ID: id, Label: oauthProviderLabels[id]}
+		if identity != nil {
+			row.Linked = true
+			row.Email = identity.Email
+			row.LinkedAt = identity.LinkedAt
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func oauthRedirectURI(r *http.Request, provider string) string {
+	return getBaseURL(r) + "/auth/oauth/" + provider + "/callback"
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// OAuthStartHandler reindirizza alla pagina di consenso del provider (GET /auth/oauth/{provider}).
+// Con ?link=1 collega il provider all'utente già autenticato invece di fare il login
+func OAuthStartHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	name := mux.Vars(r)["provider"]
+	provider := oauthProviders[name]
+	if provider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	mode := oauthModeLogin
+	if r.URL.Query().Get("link") == "1" {
+		if _, err := getSessionFromRequest(r); err != nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		mode = oauthModeLink
+	}
+
+	state, err := randomHex(16)
+	if err != nil {
+		http.Error(w, "Errore nell'avvio dell'accesso", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		http.Error(w, "Errore nell'avvio dell'accesso", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state + "." + nonce + "." + mode,
+		Path:     "/auth/oauth/",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   sessionStore().Options.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, provider.AuthCodeURL(state, nonce, oauthRedirectURI(r, name)), http.StatusFound)
+}
+
+// OAuthFormPostHandler riceve la risposta inviata in POST dal provider (Apple, response_mode
+// form_post) e la ripete in GET: una POST cross-site non porta i cookie SameSite=Lax di
+// sessione e di state, una navigazione GET sì
+func OAuthFormPostHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+	params := url.Values{}
+	for _, key := range []string{"code", "state", "error"} {
+		if value := r.PostFormValue(key); value != "" {
+			params.Set(key, value)
+		}
+	}
+	http.Redirect(w, r, r.URL.Path+"?"+params.Encode(), http.StatusSeeOther)
+}
+
+// OAuthCallbackHandler completa l'accesso con il provider (GET /auth/oauth/{provider}/callback):
+// accede con l'utente collegato, collega l'account all'utente con la stessa email (se verificata
+// da entrambe le parti) o registra un nuovo utente. In modalità collegamento aggiunge il provider all'utente corrente
+func OAuthCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	name := mux.Vars(r)["provider"]
+	provider := oauthProviders[name]
+	if provider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Il cookie di state vale per un solo tentativo
+	cookie, cookieErr := r.Cookie(oauthStateCookie)
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: "/auth/oauth/", MaxAge: -1, HttpOnly: true, Secure: sessionStore().Options.Secure})
+
+	var state, nonce, mode string
+	if cookieErr == nil {
+		parts := strings.Split(cookie.Value, ".")
+		if len(parts) == 3 {
+			state, nonce, mode = parts[0], parts[1], parts[2]
+		}
+	}
+	query := r.URL.Query()
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(query.Get("state"))) != 1 {
+		logger.SecurityEventCtx(r.Context(), "OAUTH_STATE_MISMATCH", "State OAuth mancante o non valido", "", map[string]interface{}{
+			"provider": name,
+			"ip":       getClientIP(r),
+		})
+		renderOAuthLoginError(w, r, "Sessione di accesso scaduta, riprova")
+		return
+	}
+	if query.Get("error") != "" || query.Get("code") == "" {
+		if mode == oauthModeLink {
+			http.Redirect(w, r, "/account?error=identity_cancelled", http.StatusSeeOther)
+			return
+		}
+		renderOAuthLoginError(w, r, "Accesso con "+oauthProviderLabels[name]+" annullato")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+
+	identity, err := provider.Exchange(ctx, query.Get("code"), oauthRedirectURI(r, name), nonce)
+	if err != nil {
+		logger.WarnCtx(r.Context(), "Errore nello scambio del codice OAuth", map[string]interface{}{
+			"error":    err.Error(),
+			"provider": name,
+		})
+		if mode == oauthModeLink {
+			http.Redirect(w, r, "/account?error=identity_failed", http.StatusSeeOther)
+			return
+		}
+		renderOAuthLoginError(w, r, "Accesso con "+oauthProviderLabels[name]+" non riuscito, riprova")
+		return
+	}
+
+	if mode == oauthModeLink {
+		linkOAuthIdentity(ctx, w, r, identity)
+		return
+	}
+
+	user, err := db.MongoInstance.GetUserByIdentity(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero dell'utente collegato", map[string]interface{}{
+			"error":    err.Error(),
+			"provider": name,
+		})
+		http.Error(w, "Errore durante l'accesso", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		// L'email deve essere verificata dal provider prima di collegarla o registrarla
+		if !identity.EmailVerified || identity.Email == "" {
+			renderOAuthLoginError(w, r, "L'account "+oauthProviderLabels[name]+" non ha un indirizzo email verificato")
+			return
+		}
+		user, err = db.MongoInstance.GetUserByEmail(ctx, identity.Email)
+		if err == nil && user != nil && user.EmailVerifiedAt == nil {
+			// La registrazione locale non verifica l'email: chiunque può aver registrato
+			// l'indirizzo prima del proprietario. Il collegamento va fatto dopo l'accesso con
+			// la password, dalla pagina account
+			logger.SecurityEventCtx(r.Context(), "OAUTH_LINK_REFUSED", "Email locale non verificata: collegamento automatico negato", user.ID, map[string]interface{}{
+				"provider": name,
+			})
+			renderOAuthLoginError(w, r, "Esiste già un account con l'email "+identity.Email+": accedi con username e password e collega "+oauthProviderLabels[name]+" dalla pagina Account")
+			return
+		}
+		if err == nil && user != nil {
+			err = addOAuthIdentity(ctx, r, user, identity)
+		} else if err == nil {
+			user, err = createOAuthUser(ctx, r, identity)
+		}
+		if err != nil {
+			logger.ErrorCtx(r.Context(), "Errore nel collegamento dell'account esterno", map[string]interface{}{
+				"error":    err.Error(),
+				"provider": name,
+			})
+			renderOAuthLoginError(w, r, "Impossibile completare l'accesso con "+oauthProviderLabels[name])
+			return
+		}
+	}
+
+	if !user.IsActive {
+		logger.SecurityEventCtx(r.Context(), "LOGIN_FAILED", "Accesso OAuth con account disattivato", user.ID, map[string]interface{}{
+			"provider": name,
+		})
+		renderOAuthLoginError(w, r, "Account disattivato")
+		return
+	}
+
+	redirectURL, err := startUserSession(ctx, w, r, user, name)
+	if err != nil {
+		http.Error(w, "Errore nella creazione della sessione", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+// renderOAuthLoginError mostra la pagina di login con l'errore dell'accesso social
+func renderOAuthLoginError(w http.ResponseWriter, r *http.Request, message string) {
+	renderTemplate(w, "login", loginPageData{
+		Error:          message,
+		CSRFToken:      csrfToken(w, r),
+		OAuthProviders: oauthProviderOptions(),
+	})
+}
+
+// addOAuthIdentity collega l'account del provider all'utente e lo avvisa, perché da quel
+// momento il provider permette di accedere al suo account
+func addOAuthIdentity(ctx context.Context, r *http.Request, user *models.User, identity *oauth.Identity) error {
+	linked := models.ExternalIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		LinkedAt: time.Now(),
+	}
+	added, err := db.MongoInstance.AddUserIdentity(ctx, user.ID, linked)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return fmt.Errorf("account %s già collegato", identity.Provider)
+	}
+	user.Identities = append(user.Identities, linked)
+
+	RecordAuditLogAsync("OAUTH_IDENTITY_LINKED", "user", user.ID, "", getClientIP(r), r.UserAgent(), "success")
+	if err := notifyOwner(ctx, user, i18n.KeyIdentityLinked, map[string]interface{}{
+		"Provider": oauthProviderLabels[identity.Provider],
+		"Email":    identity.Email,
+	}); err != nil {
+		logger.WarnCtx(ctx, "Errore nell'invio dell'avviso di collegamento", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+	}
+	return nil
+}
+
+// linkOAuthIdentity collega il provider all'utente autenticato dalla pagina account
+func linkOAuthIdentity(ctx context.Context, w http.ResponseWriter, r *http.Request, identity *oauth.Identity) {
+	user, _, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	owner, err := db.MongoInstance.GetUserByIdentity(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		http.Redirect(w, r, "/account?error=identity_failed", http.StatusSeeOther)
+		return
+	}
+	if owner != nil {
+		if owner.ID == user.ID {
+			http.Redirect(w, r, "/account?success=identity_linked", http.StatusSeeOther)
+		} else {
+			http.Redirect(w, r, "/account?error=identity_in_use", http.StatusSeeOther)
+		}
+		return
+	}
+	if user.Identity(identity.Provider) != nil {
+		http.Redirect(w, r, "/account?error=identity_already_linked", http.StatusSeeOther)
+		return
+	}
+
+	if err := addOAuthIdentity(ctx, r, user, identity); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel collegamento dell'account esterno", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		if errors.Is(err, db.ErrIdentityInUse) {
+			http.Redirect(w, r, "/account?error=identity_in_use", http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/account?error=identity_failed", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/account?success=identity_linked", http.StatusSeeOther)
+}
+
+var oauthUsernameInvalid = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// oauthUsername ricava lo username di un nuovo utente dalla parte locale dell'email
+func oauthUsername(email string) string {
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	username := strings.Trim(oauthUsernameInvalid.ReplaceAllString(local, ""), "._-")
+	if len(username) > 30 {
+		username = username[:30]
+	}
+	if len(username) < 3 {
+		username = "utente"
+	}
+	return username
+}
+
+// createOAuthUser registra un nuovo utente senza password con l'account del provider collegato.
+// Il consenso alla Privacy Policy è dato continuando dalla pagina di login
+func createOAuthUser(ctx context.Context, r *http.Request, identity *oauth.Identity) (*models.User, error) {
+	base := oauthUsername(identity.Email)
+	now := time.Now()
+	user := &models.User{
+		ID:             uuid.New().String(),
+		Email:          identity.Email,
+		PrivacyConsent: true,
+		ConsentDate:    now,
+		CreatedAt:      now,
+		IsActive:       true,
+		Locale:         i18n.Default().Negotiate(r.Header.Get("Accept-Language")),
+		// Il provider ha verificato l'email prima della registrazione
+		EmailVerifiedAt: &now,
+		Identities: []models.ExternalIdentity{{
+			Provider: identity.Provider,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+			LinkedAt: now,
+		}},
+	}
+
+	// Lo username è univoco: in caso di conflitto si aggiunge un suffisso casuale
+	for attempt := 0; attempt < 5; attempt++ {
+		user.Username = base
+		if attempt > 0 {
+			suffix, err := randomHex(2)
+			if err != nil {
+				return nil, err
+			}
+			user.Username = base + "-" + suffix
+		}
+		err := db.MongoInstance.CreateUser(ctx, user)
+		if errors.Is(err, db.ErrDuplicateUsername) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		logger.InfoCtx(r.Context(), "Nuova registrazione con account esterno", map[string]interface{}{
+			"user_id":  user.ID,
+			"username": user.Username,
+			"provider": identity.Provider,
+		})
+		RecordAuditLogAsync("OAUTH_SIGNUP", "user", user.ID, "", getClientIP(r), r.UserAgent(), "success")
+		return user, nil
+	}
+	return nil, fmt.Errorf("username non disponibile per %s", base)
+}
+
+// UnlinkOAuthIdentityHandler scollega un provider dall'account. Non è consentito se è l'unico
+// modo di accedere rimasto all'utente
+func UnlinkOAuthIdentityHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, _, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	provider := mux.Vars(r)["provider"]
+	if user.Identity(provider) == nil {
+		http.Redirect(w, r, "/account?error=identity_not_linked", http.StatusSeeOther)
+		return
+	}
+	if user.PasswordHash == "" && len(user.Identities) == 1 {
+		http.Redirect(w, r, "/account?error=identity_last_login", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := db.MongoInstance.RemoveUserIdentity(ctx, user.ID, provider); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nello scollegamento dell'account esterno", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		http.Redirect(w, r, "/account?error=identity_failed", http.StatusSeeOther)
+		return
+	}
+
+	RecordAuditLogAsync("OAUTH_IDENTITY_UNLINKED", "user", user.ID, "", getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/account?success=identity_unlinked", http.StatusSeeOther)
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"qr-menu/db"
+	"qr-menu/models"
+)
+
+// Operazioni di amministrazione usate dalla riga di comando (qr-menu create-admin,
+// reset-password, import-menu, generate-qr): applicano le stesse regole dei form web senza
+// passare da una richiesta HTTP
+
+// OperatorClient identifica la riga di comando nell'audit log al posto di IP e user agent
+const OperatorClient = "cli"
+
+// CreateAccount crea un account con il suo primo ristorante, come la registrazione dal sito.
+// Il consenso privacy è dato dall'operatore che crea l'account per conto del titolare
+func CreateAccount(ctx context.Context, username, email, password, restaurantName string) (*models.User, *models.Restaurant, error) {
+	switch {
+	case len(username) < 3:
+		return nil, nil, fmt.Errorf("username deve essere di almeno 3 caratteri")
+	case email == "":
+		return nil, nil, fmt.Errorf("email è richiesta")
+	case len(password) < 8:
+		return nil, nil, fmt.Errorf("password deve essere di almeno 8 caratteri")
+	case restaurantName == "":
+		return nil, nil, fmt.Errorf("nome ristorante è richiesto")
+	}
+
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	user := &models.User{
+		ID:             uuid.New().String(),
+		Username:       username,
+		Email:          strings.ToLower(email),
+		PasswordHash:   passwordHash,
+		PrivacyConsent: true,
+		ConsentDate:    now,
+		CreatedAt:      now,
+		IsActive:       true,
+	}
+	if err := db.MongoInstance.CreateUser(ctx, user); err != nil {
+		if messages := credentialErrorMessages(err); len(messages) > 0 {
+			return nil, nil, errors.New(strings.Join(messages, ", "))
+		}
+		return nil, nil, fmt.Errorf("errore nel salvataggio dell'utente: %v", err)
+	}
+
+	restaurant := &models.Restaurant{
+		ID:        uuid.New().String(),
+		OwnerID:   user.ID,
+		Name:      restaurantName,
+		CreatedAt: now,
+		IsActive:  true,
+	}
+	if err := createRestaurantWithUniqueUsername(ctx, restaurant); err != nil {
+		return user, nil, fmt.Errorf("errore nel salvataggio del ristorante: %v", err)
+	}
+
+	RecordAuditLog(ctx, "USER_CREATED", "user", user.ID, restaurant.ID, OperatorClient, OperatorClient, "success")
+	return user, restaurant, nil
+}
+
+// SetUserPassword imposta la password dell'utente indicato per username o email e chiude
+// tutte le sue sessioni
+func SetUserPassword(ctx context.Context, login, password string) (*models.User, error) {
+	if len(password) < 8 {
+		return nil, fmt.Errorf("password deve essere di almeno 8 caratteri")
+	}
+
+	user, err := findUserByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.MongoInstance.UpdateUserPassword(ctx, user.ID, passwordHash); err != nil {
+		return nil, err
+	}
+	if err := db.MongoInstance.DeleteSessionsByUserID(ctx, user.ID); err != nil {
+		return user, fmt.Errorf("password aggiornata ma errore nella chiusura delle sessioni: %v", err)
+	}
+	if err := db.MongoInstance.RevokeRefreshTokensByUser(ctx, user.ID, time.Now()); err != nil {
+		return user, fmt.Errorf("password aggiornata ma errore nella revoca dei refresh token: %v", err)
+	}
+
+	RecordAuditLog(ctx, "PASSWORD_RESET", "user", user.ID, "", OperatorClient, OperatorClient, "success")
+	return user, nil
+}
+
+// findUserByLogin cerca un utente per username o, se contiene @, per email
+func findUserByLogin(ctx context.Context, login string) (*models.User, error) {
+	var user *models.User
+	var err error
+	if strings.Contains(login, "@") {
+		user, err = db.MongoInstance.GetUserByEmail(ctx, strings.ToLower(login))
+	} else {
+		user, err = db.MongoInstance.GetUserByUsername(ctx, login)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("utente %s non trovato", login)
+	}
+	return user, nil
+}
+
+// FindRestaurant cerca un ristorante per ID o per username pubblico
+func FindRestaurant(ctx context.Context, ref string) (*models.Restaurant, error) {
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, ref)
+	if err == nil && restaurant == nil {
+		restaurant, err = db.MongoInstance.GetRestaurantByUsername(ctx, ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if restaurant == nil {
+		return nil, fmt.Errorf("ristorante %s non trovato", ref)
+	}
+	return restaurant, nil
+}
+
+// ImportMenu salva una copia del menu esportato nel ristorante, con nuovi ID per menu,
+// categorie e piatti. Il menu resta una bozza, a meno di activate: in quel caso viene
+// completato con il QR code del ristorante e diventa l'unico attivo
+func ImportMenu(ctx context.Context, restaurant *models.Restaurant, source *models.Menu, activate bool) (*models.Menu, error) {
+	if strings.TrimSpace(source.Name) == "" {
+		return nil, fmt.Errorf("il menu non ha un nome")
+	}
+
+	now := time.Now()
+	menu := &models.Menu{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurant.ID,
+		Name:         source.Name,
+		Description:  source.Description,
+		MealType:     source.MealType,
+		Categories:   cloneMenuCategories(source.Categories),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if activate {
+		if configuredBaseURL == "" {
+			return nil, fmt.Errorf("server.base_url non configurato: serve per il QR code del menu attivo")
+		}
+		if _, err := ensureRestaurantUsername(ctx, restaurant); err != nil {
+			return nil, err
+		}
+		restaurantURL := restaurantPublicURL(configuredBaseURL, restaurant)
+		qrCodePath, err := saveRestaurantQRCode(ctx, restaurant.ID, restaurantURL)
+		if err != nil {
+			return nil, err
+		}
+		menu.IsCompleted = true
+		menu.QRCodePath = qrCodePath
+		menu.PublicURL = restaurantURL
+	}
+
+	if err := db.MongoInstance.CreateMenu(ctx, menu); err != nil {
+		return nil, fmt.Errorf("errore nel salvataggio del menu: %v", err)
+	}
+	if activate {
+		if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, []string{menu.ID}); err != nil {
+			return menu, fmt.Errorf("menu importato ma errore nell'attivazione: %v", err)
+		}
+	}
+
+	RecordAuditLog(ctx, "MENU_IMPORTED", "menu", menu.ID, restaurant.ID, OperatorClient, OperatorClient, "success")
+	return menu, nil
+}
+
+// RegenerateRestaurantQRCode rigenera il QR code del ristorante sull'URL pubblico configurato
+// in server.base_url e aggiorna i menu completati. Restituisce l'URL a cui punta il QR code
+func RegenerateRestaurantQRCode(ctx context.Context, restaurant *models.Restaurant) (string, error) {
+	if configuredBaseURL == "" {
+		return "", fmt.Errorf("server.base_url non configurato")
+	}
+	if _, err := ensureRestaurantUsername(ctx, restaurant); err != nil {
+		return "", err
+	}
+
+	restaurantURL := restaurantPublicURL(configuredBaseURL, restaurant)
+	qrCodePath, err := saveRestaurantQRCode(ctx, restaurant.ID, restaurantURL)
+	if err != nil {
+		return "", err
+	}
+	updateMenusPublicURL(ctx, restaurant.ID, restaurantURL, qrCodePath)
+	return restaurantURL, nil
+}
@@ -0,0 +1,383 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+)
+
+const (
+	// maxOrderLineQuantity è la quantità massima di una riga d'ordine
+	maxOrderLineQuantity = 99
+	// orderUpdateAttempts è il numero di tentativi di salvare un ordine modificato nel
+	// frattempo da un'altra richiesta (due tablet che segnano pronte righe dello stesso ordine)
+	orderUpdateAttempts = 5
+)
+
+// errOrderConflict indica che l'ordine è cambiato a ogni tentativo di aggiornarlo
+var errOrderConflict = errors.New("ordine modificato da un'altra richiesta, riprova")
+
+// ordersQuery descrive paginazione, ordinamento e filtri dell'elenco degli ordini
+var ordersQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     200,
+	DefaultSort:    "-created_at",
+	Sortable:       []string{"created_at", "number"},
+	Filterable:     []string{"status", "table", "payment_status"},
+}
+
+// orderLineRequest è una riga di un nuovo ordine
+type orderLineRequest struct {
+	ItemID   string `json:"item_id"`
+	Quantity int    `json:"quantity"`
+	Notes    string `json:"notes"`
+}
+
+// orderRequest è il corpo di POST /api/v1/orders
+type orderRequest struct {
+	MenuID string             `json:"menu_id"`
+	Table  string             `json:"table"`
+	Notes  string             `json:"notes"`
+	Lines  []orderLineRequest `json:"lines"`
+	// VoucherCode è il codice di un buono regalo con cui pagare l'ordine, in tutto o in parte
+	VoucherCode string `json:"voucher_code"`
+}
+
+// newOrder valida la richiesta sul menu e compone l'ordine, copiando nome, prezzo e categoria
+// dei piatti. Gli errori restituiti sono messaggi per il client
+func newOrder(menu *models.Menu, req orderRequest) (*models.Order, error) {
+	if len(req.Lines) == 0 {
+		return nil, errors.New("l'ordine deve contenere almeno un piatto")
+	}
+	if len(req.Lines) > models.MaxOrderLines {
+		return nil, fmt.Errorf("l'ordine può contenere al massimo %d righe", models.MaxOrderLines)
+	}
+	if len(req.Table) > 50 || len(req.Notes) > 500 {
+		return nil, errors.New("tavolo o note troppo lunghi")
+	}
+
+	now := time.Now()
+	order := &models.Order{
+		ID:           uuid.New().String(),
+		RestaurantID: menu.RestaurantID,
+		MenuID:       menu.ID,
+		Table:        strings.TrimSpace(req.Table),
+		Notes:        strings.TrimSpace(req.Notes),
+		Status:       models.OrderStatusNew,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	for _, lineReq := range req.Lines {
+		if lineReq.Quantity < 1 || lineReq.Quantity > maxOrderLineQuantity {
+			return nil, fmt.Errorf("la quantità deve essere tra 1 e %d", maxOrderLineQuantity)
+		}
+		if len(lineReq.Notes) > 200 {
+			return nil, errors.New("note del piatto troppo lunghe")
+		}
+		line, item := orderLineFromMenu(menu, lineReq.ItemID)
+		if item == nil {
+			return nil, fmt.Errorf("piatto %q non presente nel menu", lineReq.ItemID)
+		}
+		if !item.Available {
+			return nil, fmt.Errorf("il piatto %s non è disponibile", line.Name)
+		}
+		line.ID = uuid.New().String()
+		line.Quantity = lineReq.Quantity
+		line.Notes = strings.TrimSpace(lineReq.Notes)
+		line.Status = models.OrderLinePending
+		order.Lines = append(order.Lines, line)
+		order.Total += line.Price * float64(line.Quantity)
+	}
+	order.Total = math.Round(order.Total*100) / 100
+	return order, nil
+}
+
+// orderLineFromMenu compone la riga d'ordine del piatto itemID con i dati del menu e
+// restituisce il piatto, nil se non è nel menu
+func orderLineFromMenu(menu *models.Menu, itemID string) (models.OrderLine, *models.MenuItem) {
+	for ci := range menu.Categories {
+		category := &menu.Categories[ci]
+		for ii := range category.Items {
+			if item := &category.Items[ii]; item.ID == itemID {
+				return models.OrderLine{
+					ItemID:     item.ID,
+					Name:       item.Name,
+					CategoryID: category.ID,
+					Category:   category.Name,
+					Price:      item.Price,
+				}, item
+			}
+		}
+	}
+	return models.OrderLine{}, nil
+}
+
+// orderStockLines somma per piatto le quantità dell'ordine da scaricare dal magazzino
+func orderStockLines(order *models.Order) []stockLine {
+	var lines []stockLine
+	index := make(map[string]int)
+	for _, line := range order.Lines {
+		if i, ok := index[line.ItemID]; ok {
+			lines[i].Quantity += line.Quantity
+			continue
+		}
+		index[line.ItemID] = len(lines)
+		lines = append(lines, stockLine{ItemID: line.ItemID, Quantity: line.Quantity})
+	}
+	return lines
+}
+
+// placeOrder scarica le giacenze dei piatti, numera e salva l'ordine e lo annuncia sul bus.
+// Restituisce models.ErrInsufficientStock, senza salvare nulla, se un piatto non basta
+func placeOrder(ctx context.Context, order *models.Order) error {
+	update := stockUpdate{OrderID: order.ID, ActorID: order.CreatedBy}
+	if err := consumeStock(ctx, order.MenuID, orderStockLines(order), update); err != nil {
+		return err
+	}
+
+	number, err := db.MongoInstance.NextOrderNumber(ctx, order.RestaurantID, order.CreatedAt.Format("2006-01-02"))
+	if err == nil {
+		order.Number = number
+		err = db.MongoInstance.CreateOrder(ctx, order)
+	}
+	if err != nil {
+		update.Reason = models.StockReasonOrder
+		restoreStock(ctx, order.MenuID, orderStockLines(order), update)
+		return err
+	}
+
+	publishOrderEvent(events.OrderCreated, order, order.CreatedBy)
+	return nil
+}
+
+// publishOrderEvent pubblica la creazione o un cambio di stato di un ordine
+func publishOrderEvent(eventType string, order *models.Order, actorID string) {
+	lines := make([]map[string]interface{}, 0, len(order.Lines))
+	for _, line := range order.Lines {
+		lines = append(lines, map[string]interface{}{
+			"item_id":  line.ItemID,
+			"name":     line.Name,
+			"quantity": line.Quantity,
+			"price":    line.Price,
+			"status":   line.Status,
+		})
+	}
+	eventBus.Publish(events.Event{Type: eventType, RestaurantID: order.RestaurantID, ActorID: actorID, Data: map[string]interface{}{
+		"order_id":       order.ID,
+		"menu_id":        order.MenuID,
+		"number":         order.Number,
+		"table":          order.Table,
+		"status":         order.Status,
+		"total":          order.Total,
+		"lines":          lines,
+		"payment_status": order.PaymentStatus,
+	}})
+}
+
+// changeOrder applica apply all'ordine e lo salva solo se nessun'altra richiesta l'ha
+// modificato nel frattempo, altrimenti lo rilegge e riprova. Restituisce nil se l'ordine non
+// esiste
+func changeOrder(ctx context.Context, restaurantID, orderID string, apply func(order *models.Order) error) (*models.Order, error) {
+	for attempt := 0; attempt < orderUpdateAttempts; attempt++ {
+		order, err := db.MongoInstance.GetOrder(ctx, orderID, restaurantID)
+		if err != nil || order == nil {
+			return nil, err
+		}
+		before := order.UpdatedAt
+		if err := apply(order); err != nil {
+			return order, err
+		}
+		saved, err := db.MongoInstance.UpdateOrder(ctx, order, before)
+		if err != nil {
+			return order, err
+		}
+		if saved {
+			return order, nil
+		}
+	}
+	return nil, errOrderConflict
+}
+
+// respondOrderError risponde all'errore di creazione o aggiornamento di un ordine
+func respondOrderError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case errors.Is(err, models.ErrInsufficientStock):
+		httputil.Conflict(w, "Giacenza insufficiente per uno dei piatti ordinati")
+	case errors.Is(err, models.ErrOrderClosed), errors.Is(err, errOrderConflict), errors.Is(err, errStockConflict),
+		errors.Is(err, errVoucherNotRedeemable):
+		httputil.Conflict(w, err.Error())
+	case errors.Is(err, models.ErrOrderLineNotFound):
+		httputil.BadRequest(w, err.Error())
+	default:
+		respondMenuV2Error(w, r, err, message)
+	}
+}
+
+// CreateOrderHandler registra un ordine, ad esempio inviato da una cassa (POST /api/v1/orders
+// con {"menu_id": "...", "table": "12", "lines": [{"item_id": "...", "quantity": 2}]})
+func CreateOrderHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req orderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if req.MenuID == "" {
+		httputil.BadRequest(w, "menu_id obbligatorio")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	menu, err := db.MongoInstance.GetRestaurantMenu(ctx, req.MenuID, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+		return
+	}
+	if menu == nil || menu.IsArchived {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+	order, err := newOrder(menu, req)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	order.Source = models.OrderSourceAPI
+	order.CreatedBy = requestActorID(r)
+	if req.VoucherCode != "" {
+		if err := payWithVoucher(ctx, r, order, req.VoucherCode); err != nil {
+			respondOrderError(w, r, err, "Errore nel pagamento con il buono")
+			return
+		}
+	}
+	if err := placeOrder(ctx, order); err != nil {
+		refundOrderVoucher(ctx, r, order)
+		respondOrderError(w, r, err, "Errore nella registrazione dell'ordine")
+		return
+	}
+
+	RecordAuditLogAsync("ORDER_CREATED", "order", order.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	w.Header().Set("Location", "/api/v1/orders/"+order.ID)
+	httputil.Created(w, "Ordine registrato", order)
+}
+
+// ListOrdersHandler elenca gli ordini del ristorante (GET /api/v1/orders), filtrabili per stato
+// e tavolo
+func ListOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	query, err := httputil.ParseListQuery(r, ordersQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	filter := db.OrderFilter{
+		RestaurantID:  restaurant.ID,
+		Table:         query.Filter("table"),
+		PaymentStatus: query.Filter("payment_status"),
+	}
+	if status := query.Filter("status"); status != "" {
+		filter.Statuses = strings.Split(status, ",")
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	orders, total, err := db.MongoInstance.FindOrders(ctx, filter, dbListOptions(query))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero degli ordini")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, orders, query, total)
+}
+
+// GetOrderHandler restituisce un ordine (GET /api/v1/orders/{id})
+func GetOrderHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	order, err := db.MongoInstance.GetOrder(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", order)
+}
+
+// CompleteOrderHandler segna l'ordine come servito o consegnato (POST /api/v1/orders/{id}/complete)
+func CompleteOrderHandler(w http.ResponseWriter, r *http.Request) {
+	closeOrder(w, r, models.OrderStatusCompleted)
+}
+
+// CancelOrderHandler annulla l'ordine, rimette in magazzino i piatti scaricati, restituisce al
+// buono regalo la parte pagata con il credito e libera il posto nella fascia oraria prenotata
+// (POST /api/v1/orders/{id}/cancel)
+func CancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	closeOrder(w, r, models.OrderStatusCancelled)
+}
+
+func closeOrder(w http.ResponseWriter, r *http.Request, status string) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	order, err := changeOrder(ctx, restaurant.ID, mux.Vars(r)["id"], func(order *models.Order) error {
+		return order.Close(status, time.Now())
+	})
+	if err != nil {
+		respondOrderError(w, r, err, "Errore nell'aggiornamento dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+
+	actorID := requestActorID(r)
+	if status == models.OrderStatusCancelled {
+		restoreStock(ctx, order.MenuID, orderStockLines(order), stockUpdate{
+			Reason:  models.StockReasonOrder,
+			OrderID: order.ID,
+			ActorID: actorID,
+		})
+		refundOrderVoucher(ctx, r, order)
+		releaseOrderSlot(ctx, order)
+	}
+	publishOrderEvent(events.OrderUpdated, order, actorID)
+	RecordAuditLogAsync("ORDER_"+strings.ToUpper(status), "order", order.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Ordine aggiornato", order)
+}
@@ -0,0 +1,770 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/analytics"
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+)
+
+// Organizzazioni: un account gestisce più sedi (una catena). Le sedi restano ristoranti
+// indipendenti, ognuno con menu, staff e statistiche propri e selezionabile dal pannello;
+// l'organizzazione aggiunge i modelli di menu distribuiti a tutte le sedi e un cruscotto
+// aggregato. Solo il proprietario dell'account gestisce le sue organizzazioni
+
+// Esiti della distribuzione di un modello a una sede
+const (
+	templatePushCreated = "created"
+	templatePushUpdated = "updated"
+	templatePushSkipped = "skipped"
+	templatePushFailed  = "failed"
+)
+
+// organizationRequest è il corpo di creazione e modifica di un'organizzazione
+type organizationRequest struct {
+	Name          string   `json:"name"`
+	RestaurantIDs []string `json:"restaurant_ids"`
+}
+
+// menuTemplateRequest è il corpo di creazione e modifica di un modello di menu. Le
+// categorie si possono copiare da un menu di una sede (from_menu_id); nella modifica le
+// categorie assenti restano invariate
+type menuTemplateRequest struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	MealType    string              `json:"meal_type"`
+	FromMenuID  string              `json:"from_menu_id"`
+	Categories  []categoryV2Request `json:"categories"`
+}
+
+// organizationDetail è un'organizzazione con le sue sedi e i suoi modelli di menu
+type organizationDetail struct {
+	*models.Organization
+	Locations []models.Restaurant    `json:"locations"`
+	Templates []*models.MenuTemplate `json:"templates,omitempty"`
+}
+
+// templatePushResult è l'esito della distribuzione di un modello a una sede
+type templatePushResult struct {
+	RestaurantID string `json:"restaurant_id"`
+	Name         string `json:"name"`
+	MenuID       string `json:"menu_id,omitempty"`
+	Status       string `json:"status"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// currentOrganizationUser restituisce la sessione dell'utente; risponde 401 e restituisce
+// nil se manca
+func currentOrganizationUser(w http.ResponseWriter, r *http.Request) *models.Session {
+	session, err := getSessionFromRequest(r)
+	if err != nil || session.UserID == "" {
+		httputil.Unauthorized(w, "Autenticazione richiesta")
+		return nil
+	}
+	return session
+}
+
+func respondOrganizationError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	logger.ErrorCtx(r.Context(), message, map[string]interface{}{
+		"error": err.Error(),
+		"path":  r.URL.Path,
+	})
+	httputil.InternalServerError(w, message)
+}
+
+// loadOrganization carica l'organizzazione {id} dell'utente; risponde 404 e restituisce
+// nil se non esiste o è di un altro utente
+func loadOrganization(ctx context.Context, w http.ResponseWriter, r *http.Request, session *models.Session) *models.Organization {
+	org, err := db.MongoInstance.GetOrganizationByID(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		respondOrganizationError(w, r, err, "Errore nel recupero dell'organizzazione")
+		return nil
+	}
+	if org == nil || org.OwnerID != session.UserID {
+		httputil.NotFound(w, "Organizzazione")
+		return nil
+	}
+	return org
+}
+
+// loadOwnedRestaurant carica un ristorante dell'utente da collegare a un'organizzazione;
+// risponde 404 e restituisce nil se non esiste o non è suo: lo staff non può spostare le
+// sedi altrui
+func loadOwnedRestaurant(ctx context.Context, w http.ResponseWriter, r *http.Request, session *models.Session, id string) *models.Restaurant {
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, id)
+	if err != nil {
+		respondOrganizationError(w, r, err, "Errore nel recupero del ristorante")
+		return nil
+	}
+	if restaurant == nil || !restaurant.IsActive || restaurant.OwnerID != session.UserID {
+		httputil.NotFound(w, "Ristorante")
+		return nil
+	}
+	return restaurant
+}
+
+// addOrganizationLocation collega il ristorante all'organizzazione; risponde 409 e
+// restituisce false se è già una sede di un'altra organizzazione
+func addOrganizationLocation(ctx context.Context, w http.ResponseWriter, r *http.Request, org *models.Organization, restaurant *models.Restaurant) bool {
+	if restaurant.OrganizationID != "" && restaurant.OrganizationID != org.ID {
+		httputil.Conflict(w, "Il ristorante "+restaurant.Name+" appartiene già a un'altra organizzazione")
+		return false
+	}
+	if err := db.MongoInstance.SetRestaurantOrganization(ctx, restaurant, org.ID); err != nil {
+		respondOrganizationError(w, r, err, "Errore nel collegamento della sede")
+		return false
+	}
+	RecordAuditLogAsync("ORGANIZATION_LOCATION_ADDED", "organization", org.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	return true
+}
+
+// ListOrganizationsHandler restituisce le organizzazioni dell'utente con le loro sedi
+// (GET /api/v1/organizations)
+func ListOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	orgs, err := db.MongoInstance.GetOrganizationsByOwnerID(ctx, session.UserID)
+	if err != nil {
+		respondOrganizationError(w, r, err, "Errore nel recupero delle organizzazioni")
+		return
+	}
+	details := make([]organizationDetail, 0, len(orgs))
+	for _, org := range orgs {
+		locations, err := db.MongoInstance.GetRestaurantsByOrganizationID(ctx, org.ID)
+		if err != nil {
+			respondOrganizationError(w, r, err, "Errore nel recupero delle sedi")
+			return
+		}
+		if locations == nil {
+			locations = []models.Restaurant{}
+		}
+		details = append(details, organizationDetail{Organization: org, Locations: locations})
+	}
+	httputil.Success(w, "Organizzazioni", details)
+}
+
+// CreateOrganizationHandler crea un'organizzazione, opzionalmente con le prime sedi tra i
+// ristoranti dell'utente (POST /api/v1/organizations)
+func CreateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+
+	var req organizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		httputil.BadRequest(w, "Il nome dell'organizzazione è obbligatorio")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// Le sedi sono verificate prima di creare l'organizzazione
+	var restaurants []*models.Restaurant
+	for _, id := range req.RestaurantIDs {
+		restaurant := loadOwnedRestaurant(ctx, w, r, session, id)
+		if restaurant == nil {
+			return
+		}
+		if restaurant.OrganizationID != "" {
+			httputil.Conflict(w, "Il ristorante "+restaurant.Name+" appartiene già a un'altra organizzazione")
+			return
+		}
+		restaurants = append(restaurants, restaurant)
+	}
+
+	now := time.Now()
+	org := &models.Organization{
+		ID:        uuid.New().String(),
+		Name:      name,
+		OwnerID:   session.UserID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := db.MongoInstance.CreateOrganization(ctx, org); err != nil {
+		respondOrganizationError(w, r, err, "Errore nella creazione dell'organizzazione")
+		return
+	}
+	RecordAuditLogAsync("ORGANIZATION_CREATED", "organization", org.ID, "", getClientIP(r), r.UserAgent(), "success")
+
+	locations := []models.Restaurant{}
+	for _, restaurant := range restaurants {
+		if !addOrganizationLocation(ctx, w, r, org, restaurant) {
+			return
+		}
+		locations = append(locations, *restaurant)
+	}
+
+	w.Header().Set("Location", "/api/v1/organizations/"+org.ID)
+	httputil.Created(w, "Organizzazione creata", organizationDetail{Organization: org, Locations: locations})
+}
+
+// GetOrganizationHandler restituisce un'organizzazione con sedi e modelli di menu
+// (GET /api/v1/organizations/{id})
+func GetOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	org := loadOrganization(ctx, w, r, session)
+	if org == nil {
+		return
+	}
+	locations, err := db.MongoInstance.GetRestaurantsByOrganizationID(ctx, org.ID)
+	if err != nil {
+		respondOrganizationError(w, r, err, "Errore nel recupero delle sedi")
+		return
+	}
+	templates, err := db.MongoInstance.GetMenuTemplates(ctx, org.ID)
+	if err != nil {
+		respondOrganizationError(w, r, err, "Errore nel recupero dei modelli di menu")
+		return
+	}
+	if locations == nil {
+		locations = []models.Restaurant{}
+	}
+	httputil.Success(w, "Organizzazione", organizationDetail{Organization: org, Locations: locations, Templates: templates})
+}
+
+// UpdateOrganizationHandler rinomina un'organizzazione (PATCH /api/v1/organizations/{id})
+func UpdateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+
+	var req organizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		httputil.BadRequest(w, "Il nome dell'organizzazione è obbligatorio")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	org := loadOrganization(ctx, w, r, session)
+	if org == nil {
+		return
+	}
+	org.Name = name
+	org.UpdatedAt = time.Now()
+	if err := db.MongoInstance.UpdateOrganization(ctx, org); err != nil {
+		respondOrganizationError(w, r, err, "Errore nell'aggiornamento dell'organizzazione")
+		return
+	}
+	httputil.Success(w, "Organizzazione aggiornata", org)
+}
+
+// DeleteOrganizationHandler elimina un'organizzazione e i suoi modelli di menu. Le sedi
+// tornano ristoranti singoli e conservano i menu già distribuiti
+// (DELETE /api/v1/organizations/{id})
+func DeleteOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	org := loadOrganization(ctx, w, r, session)
+	if org == nil {
+		return
+	}
+	if err := db.MongoInstance.DeleteOrganization(ctx, org.ID); err != nil {
+		respondOrganizationError(w, r, err, "Errore nell'eliminazione dell'organizzazione")
+		return
+	}
+	RecordAuditLogAsync("ORGANIZATION_DELETED", "organization", org.ID, "", getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// AddOrganizationLocationHandler aggiunge un ristorante dell'utente alle sedi
+// (POST /api/v1/organizations/{id}/locations)
+func AddOrganizationLocationHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+
+	var req struct {
+		RestaurantID string `json:"restaurant_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RestaurantID == "" {
+		httputil.BadRequest(w, "restaurant_id è obbligatorio")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	org := loadOrganization(ctx, w, r, session)
+	if org == nil {
+		return
+	}
+	restaurant := loadOwnedRestaurant(ctx, w, r, session, req.RestaurantID)
+	if restaurant == nil || !addOrganizationLocation(ctx, w, r, org, restaurant) {
+		return
+	}
+	httputil.Success(w, "Sede aggiunta", restaurant)
+}
+
+// RemoveOrganizationLocationHandler scollega una sede, che torna un ristorante singolo
+// con i suoi menu (DELETE /api/v1/organizations/{id}/locations/{restaurantID})
+func RemoveOrganizationLocationHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	org := loadOrganization(ctx, w, r, session)
+	if org == nil {
+		return
+	}
+	restaurant := loadOwnedRestaurant(ctx, w, r, session, mux.Vars(r)["restaurantID"])
+	if restaurant == nil {
+		return
+	}
+	if restaurant.OrganizationID != org.ID {
+		httputil.NotFound(w, "Sede")
+		return
+	}
+	if err := db.MongoInstance.SetRestaurantOrganization(ctx, restaurant, ""); err != nil {
+		respondOrganizationError(w, r, err, "Errore nella rimozione della sede")
+		return
+	}
+	RecordAuditLogAsync("ORGANIZATION_LOCATION_REMOVED", "organization", org.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// applyMenuTemplateRequest legge e valida il corpo della richiesta e lo applica al modello.
+// Il menu da cui copiare le categorie deve essere di una sede dell'organizzazione. Risponde
+// con l'errore e restituisce false se la richiesta non è valida
+func applyMenuTemplateRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, org *models.Organization, template *models.MenuTemplate) bool {
+	var req menuTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return false
+	}
+
+	if req.FromMenuID != "" {
+		menu, err := db.MongoInstance.GetMenuByID(ctx, req.FromMenuID)
+		if err != nil {
+			respondOrganizationError(w, r, err, "Errore nel recupero del menu")
+			return false
+		}
+		var restaurant *models.Restaurant
+		if menu != nil {
+			if restaurant, err = db.MongoInstance.GetRestaurantByID(ctx, menu.RestaurantID); err != nil {
+				respondOrganizationError(w, r, err, "Errore nel recupero del ristorante")
+				return false
+			}
+		}
+		if restaurant == nil || restaurant.OrganizationID != org.ID {
+			httputil.BadRequest(w, "Menu non trovato tra le sedi dell'organizzazione")
+			return false
+		}
+		template.Name, template.Description, template.MealType = menu.Name, menu.Description, menu.MealType
+		template.Categories = menu.Categories
+	}
+
+	if name := strings.TrimSpace(req.Name); name != "" {
+		template.Name = name
+	}
+	if template.Name == "" {
+		httputil.BadRequest(w, "Il nome del modello è obbligatorio")
+		return false
+	}
+	if description := strings.TrimSpace(req.Description); description != "" {
+		template.Description = description
+	}
+	if mealType := strings.TrimSpace(req.MealType); mealType != "" {
+		template.MealType = mealType
+	}
+	if template.MealType == "" {
+		template.MealType = "generic"
+	}
+
+	if req.Categories != nil {
+		categories := make([]models.MenuCategory, 0, len(req.Categories))
+		for _, categoryReq := range req.Categories {
+			category := models.MenuCategory{
+				ID:          uuid.New().String(),
+				Name:        strings.TrimSpace(categoryReq.Name),
+				Description: strings.TrimSpace(categoryReq.Description),
+				Items:       []models.MenuItem{},
+			}
+			if category.Name == "" {
+				httputil.BadRequest(w, "Il nome della categoria è obbligatorio")
+				return false
+			}
+			for _, itemReq := range categoryReq.Items {
+				item, err := newItemV2(itemReq, category.Name)
+				if err != nil {
+					httputil.BadRequest(w, err.Error())
+					return false
+				}
+				category.Items = append(category.Items, item)
+			}
+			categories = append(categories, category)
+		}
+		template.Categories = categories
+	}
+	if template.Categories == nil {
+		template.Categories = []models.MenuCategory{}
+	}
+	return true
+}
+
+// loadMenuTemplate carica il modello {templateID} dell'organizzazione; risponde 404 e
+// restituisce nil se non esiste
+func loadMenuTemplate(ctx context.Context, w http.ResponseWriter, r *http.Request, org *models.Organization) *models.MenuTemplate {
+	template, err := db.MongoInstance.GetMenuTemplate(ctx, mux.Vars(r)["templateID"], org.ID)
+	if err != nil {
+		respondOrganizationError(w, r, err, "Errore nel recupero del modello di menu")
+		return nil
+	}
+	if template == nil {
+		httputil.NotFound(w, "Modello di menu")
+		return nil
+	}
+	return template
+}
+
+// ListMenuTemplatesHandler restituisce i modelli di menu dell'organizzazione
+// (GET /api/v1/organizations/{id}/templates)
+func ListMenuTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	org := loadOrganization(ctx, w, r, session)
+	if org == nil {
+		return
+	}
+	templates, err := db.MongoInstance.GetMenuTemplates(ctx, org.ID)
+	if err != nil {
+		respondOrganizationError(w, r, err, "Errore nel recupero dei modelli di menu")
+		return
+	}
+	if templates == nil {
+		templates = []*models.MenuTemplate{}
+	}
+	httputil.Success(w, "Modelli di menu", templates)
+}
+
+// CreateMenuTemplateHandler crea un modello di menu, nuovo o copiato dal menu di una sede
+// (POST /api/v1/organizations/{id}/templates)
+func CreateMenuTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	org := loadOrganization(ctx, w, r, session)
+	if org == nil {
+		return
+	}
+	now := time.Now()
+	template := &models.MenuTemplate{
+		ID:             uuid.New().String(),
+		OrganizationID: org.ID,
+		CreatedBy:      session.UserID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if !applyMenuTemplateRequest(ctx, w, r, org, template) {
+		return
+	}
+	if err := db.MongoInstance.SaveMenuTemplate(ctx, template); err != nil {
+		respondOrganizationError(w, r, err, "Errore nel salvataggio del modello di menu")
+		return
+	}
+
+	RecordAuditLogAsync("MENU_TEMPLATE_CREATED", "menu_template", template.ID, "", getClientIP(r), r.UserAgent(), "success")
+	w.Header().Set("Location", "/api/v1/organizations/"+org.ID+"/templates/"+template.ID)
+	httputil.Created(w, "Modello di menu creato", template)
+}
+
+// UpdateMenuTemplateHandler modifica un modello di menu. Le sedi ricevono le modifiche
+// alla successiva distribuzione (PUT /api/v1/organizations/{id}/templates/{templateID})
+func UpdateMenuTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	org := loadOrganization(ctx, w, r, session)
+	if org == nil {
+		return
+	}
+	template := loadMenuTemplate(ctx, w, r, org)
+	if template == nil || !applyMenuTemplateRequest(ctx, w, r, org, template) {
+		return
+	}
+	template.UpdatedAt = time.Now()
+	if err := db.MongoInstance.SaveMenuTemplate(ctx, template); err != nil {
+		respondOrganizationError(w, r, err, "Errore nel salvataggio del modello di menu")
+		return
+	}
+
+	RecordAuditLogAsync("MENU_TEMPLATE_UPDATED", "menu_template", template.ID, "", getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Modello di menu aggiornato", template)
+}
+
+// DeleteMenuTemplateHandler elimina un modello di menu; i menu già distribuiti restano
+// alle sedi (DELETE /api/v1/organizations/{id}/templates/{templateID})
+func DeleteMenuTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	org := loadOrganization(ctx, w, r, session)
+	if org == nil {
+		return
+	}
+	id := mux.Vars(r)["templateID"]
+	deleted, err := db.MongoInstance.DeleteMenuTemplate(ctx, id, org.ID)
+	if err != nil {
+		respondOrganizationError(w, r, err, "Errore nell'eliminazione del modello di menu")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "Modello di menu")
+		return
+	}
+
+	RecordAuditLogAsync("MENU_TEMPLATE_DELETED", "menu_template", id, "", getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// pushMenuTemplate distribuisce il modello a una sede: crea il menu in bozza se la sede
+// non l'ha ancora ricevuto, altrimenti ne sostituisce contenuto e categorie mantenendo
+// stato, QR code e pubblicazione. I menu archiviati sono congelati e vengono saltati
+func pushMenuTemplate(ctx context.Context, r *http.Request, session *models.Session, template *models.MenuTemplate, restaurant *models.Restaurant) templatePushResult {
+	result := templatePushResult{RestaurantID: restaurant.ID, Name: restaurant.Name}
+
+	menu, err := db.MongoInstance.GetMenuByTemplateID(ctx, restaurant.ID, template.ID)
+	if err == nil && menu == nil {
+		now := time.Now()
+		menu = &models.Menu{
+			ID:           uuid.New().String(),
+			RestaurantID: restaurant.ID,
+			TemplateID:   template.ID,
+			Name:         template.Name,
+			Description:  template.Description,
+			MealType:     template.MealType,
+			Categories:   template.Categories,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err = db.MongoInstance.CreateMenu(ctx, menu); err == nil {
+			publishMenuEvent(r, events.MenuCreated, menu)
+			result.MenuID, result.Status = menu.ID, templatePushCreated
+			return result
+		}
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella distribuzione del modello di menu", map[string]interface{}{
+			"error":         err.Error(),
+			"template_id":   template.ID,
+			"restaurant_id": restaurant.ID,
+		})
+		result.Status, result.Reason = templatePushFailed, "errore interno"
+		return result
+	}
+
+	result.MenuID = menu.ID
+	if menu.IsArchived {
+		result.Status, result.Reason = templatePushSkipped, "menu archiviato"
+		return result
+	}
+
+	before := *menu
+	menu.Name = template.Name
+	menu.Description = template.Description
+	menu.MealType = template.MealType
+	menu.Categories = template.Categories
+	menu.UpdatedAt = time.Now()
+	if err := db.MongoInstance.UpdateMenu(ctx, menu); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella distribuzione del modello di menu", map[string]interface{}{
+			"error":         err.Error(),
+			"template_id":   template.ID,
+			"restaurant_id": restaurant.ID,
+		})
+		result.Status, result.Reason = templatePushFailed, "errore interno"
+		return result
+	}
+	recordMenuRevision(ctx, r, session, "", &before, menu, "")
+	publishMenuEvent(r, events.MenuUpdated, menu)
+	if menu.IsActive {
+		scheduleMenuWarmUp(restaurant.ID)
+	}
+	result.Status = templatePushUpdated
+	return result
+}
+
+// PushMenuTemplateHandler distribuisce un modello di menu alle sedi: a tutte o solo a
+// quelle in restaurant_ids. Risponde con l'esito per ogni sede
+// (POST /api/v1/organizations/{id}/templates/{templateID}/push)
+func PushMenuTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+
+	var req struct {
+		RestaurantIDs []string `json:"restaurant_ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httputil.BadRequest(w, "Formato JSON non valido")
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	org := loadOrganization(ctx, w, r, session)
+	if org == nil {
+		return
+	}
+	template := loadMenuTemplate(ctx, w, r, org)
+	if template == nil {
+		return
+	}
+	locations, err := db.MongoInstance.GetRestaurantsByOrganizationID(ctx, org.ID)
+	if err != nil {
+		respondOrganizationError(w, r, err, "Errore nel recupero delle sedi")
+		return
+	}
+	for _, id := range req.RestaurantIDs {
+		if !slices.ContainsFunc(locations, func(location models.Restaurant) bool { return location.ID == id }) {
+			httputil.BadRequest(w, "Il ristorante "+id+" non è una sede dell'organizzazione")
+			return
+		}
+	}
+
+	results := []templatePushResult{}
+	for i := range locations {
+		location := &locations[i]
+		if len(req.RestaurantIDs) > 0 && !slices.Contains(req.RestaurantIDs, location.ID) {
+			continue
+		}
+		result := pushMenuTemplate(ctx, r, session, template, location)
+		results = append(results, result)
+		RecordAuditLogAsync("MENU_TEMPLATE_PUSHED", "menu_template", template.ID, location.ID, getClientIP(r), r.UserAgent(), result.Status)
+	}
+
+	template.PushedAt = time.Now()
+	if err := db.MongoInstance.SaveMenuTemplate(ctx, template); err != nil {
+		logger.WarnCtx(r.Context(), "Errore nel salvataggio della data di distribuzione", map[string]interface{}{
+			"error":       err.Error(),
+			"template_id": template.ID,
+		})
+	}
+	httputil.Success(w, "Modello di menu distribuito", results)
+}
+
+// OrganizationDashboardHandler restituisce le statistiche aggregate delle sedi negli
+// ultimi days giorni (default 30), con il dettaglio per sede
+// (GET /api/v1/organizations/{id}/dashboard)
+func OrganizationDashboardHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentOrganizationUser(w, r)
+	if session == nil {
+		return
+	}
+
+	days := 30
+	if daysParam := r.URL.Query().Get("days"); daysParam != "" {
+		parsed, err := strconv.Atoi(daysParam)
+		if err != nil || parsed <= 0 || parsed > 365 {
+			httputil.BadRequest(w, "Parametro days non valido (da 1 a 365)")
+			return
+		}
+		days = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	org := loadOrganization(ctx, w, r, session)
+	if org == nil {
+		return
+	}
+	locations, err := db.MongoInstance.GetRestaurantsByOrganizationID(ctx, org.ID)
+	if err != nil {
+		respondOrganizationError(w, r, err, "Errore nel recupero delle sedi")
+		return
+	}
+
+	ids := make([]string, 0, len(locations))
+	names := make(map[string]string, len(locations))
+	for _, location := range locations {
+		ids = append(ids, location.ID)
+		names[location.ID] = location.Name
+	}
+	dashboard := analytics.GetAnalytics().GetGroupDashboard(ids, days)
+
+	type locationStats struct {
+		analytics.LocationPeriodStats
+		Name string `json:"name"`
+	}
+	perLocation := make([]locationStats, 0, len(dashboard.Locations))
+	for _, stats := range dashboard.Locations {
+		perLocation = append(perLocation, locationStats{LocationPeriodStats: stats, Name: names[stats.RestaurantID]})
+	}
+
+	httputil.Success(w, "Statistiche dell'organizzazione", map[string]interface{}{
+		"organization_id": org.ID,
+		"days":            dashboard.Days,
+		"totals":          dashboard.Totals,
+		"locations":       perLocation,
+		"daily_trend":     dashboard.DailyTrend,
+		"top_items":       dashboard.TopItems,
+	})
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/memstore"
+	"qr-menu/pkg/pairing"
+)
+
+const (
+	// pairingHistoryDays sono i giorni di ordini usati per gli abbinamenti: i gusti e il menu
+	// cambiano, gli ordini più vecchi non dicono più molto
+	pairingHistoryDays = 90
+	// pairingCacheTTL è la durata degli abbinamenti calcolati di un ristorante
+	pairingCacheTTL = time.Hour
+	// defaultPairings e maxPairings sono il numero di suggerimenti restituiti di default e al
+	// massimo
+	defaultPairings = 3
+	maxPairings     = 10
+	// maxPairingItems è il numero massimo di piatti del carrello considerati
+	maxPairingItems = 20
+)
+
+// pairingEntry sono gli abbinamenti calcolati di un ristorante, validi fino a expiresAt
+type pairingEntry struct {
+	matrix    *pairing.Matrix
+	expiresAt time.Time
+}
+
+// pairingCache conserva gli abbinamenti per ristorante: ricalcolarli a ogni richiesta
+// vorrebbe dire rileggere gli ordini degli ultimi mesi
+var pairingCache = memstore.New[string, pairingEntry]()
+
+// pairingView è un piatto suggerito con quelli nel carrello, con i dati per mostrarlo
+type pairingView struct {
+	ItemID   string  `json:"item_id"`
+	Name     string  `json:"name"`
+	Category string  `json:"category,omitempty"`
+	Price    float64 `json:"price"`
+	ImageURL string  `json:"image_url,omitempty"`
+	Score    float64 `json:"score"` // Quota degli ordini con i piatti del carrello che contengono anche questo, 0-1
+}
+
+// restaurantPairings restituisce gli abbinamenti del ristorante calcolati sugli ordini non
+// annullati degli ultimi pairingHistoryDays giorni, dalla cache se ancora validi
+func restaurantPairings(ctx context.Context, restaurantID string) (*pairing.Matrix, error) {
+	now := time.Now()
+	if entry, ok := pairingCache.Get(restaurantID); ok && now.Before(entry.expiresAt) {
+		return entry.matrix, nil
+	}
+
+	matrix := pairing.New()
+	filter := db.OrderFilter{
+		RestaurantID: restaurantID,
+		Statuses:     []string{models.OrderStatusNew, models.OrderStatusPreparing, models.OrderStatusReady, models.OrderStatusCompleted},
+		Since:        now.AddDate(0, 0, -pairingHistoryDays),
+	}
+	err := db.MongoInstance.StreamOrders(ctx, filter, func(order *models.Order) error {
+		items := make([]string, 0, len(order.Lines))
+		for _, line := range order.Lines {
+			items = append(items, line.ItemID)
+		}
+		matrix.Add(items)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pairingCache.DeleteFunc(func(_ string, entry pairingEntry) bool { return now.After(entry.expiresAt) })
+	pairingCache.Set(restaurantID, pairingEntry{matrix: matrix, expiresAt: now.Add(pairingCacheTTL)})
+	return matrix, nil
+}
+
+// suggestPairings restituisce fino a limit piatti disponibili del menu ordinati spesso
+// insieme a quelli del carrello, dal più frequente. Senza ordini a sufficienza non ci sono
+// suggerimenti
+func suggestPairings(ctx context.Context, restaurantID string, menu *models.Menu, cart []string, limit int) ([]pairingView, error) {
+	matrix, err := restaurantPairings(ctx, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	available := make(map[string]pairingView)
+	for _, category := range menu.Categories {
+		for _, item := range category.Items {
+			if item.Available {
+				available[item.ID] = pairingView{ItemID: item.ID, Name: item.Name, Category: category.Name, Price: item.Price, ImageURL: item.ImageURL}
+			}
+		}
+	}
+	allow := func(itemID string) bool {
+		_, ok := available[itemID]
+		return ok
+	}
+
+	views := []pairingView{}
+	for _, s := range matrix.Suggest(cart, limit, pairing.DefaultMinSupport, allow) {
+		view := available[s.ItemID]
+		view.Score = math.Round(s.Score*1000) / 1000
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// orderSuggestions restituisce i piatti da proporre con un ordine appena ricevuto. Gli errori
+// vengono solo registrati: i suggerimenti non devono far fallire l'ordine
+func orderSuggestions(ctx context.Context, menu *models.Menu, order *models.Order) []pairingView {
+	cart := make([]string, 0, len(order.Lines))
+	for _, line := range order.Lines {
+		cart = append(cart, line.ItemID)
+	}
+	suggestions, err := suggestPairings(ctx, order.RestaurantID, menu, cart, defaultPairings)
+	if err != nil {
+		logger.ErrorCtx(ctx, "Errore nel calcolo degli abbinamenti", map[string]interface{}{
+			"error":    err.Error(),
+			"order_id": order.ID,
+		})
+		return []pairingView{}
+	}
+	return suggestions
+}
+
+// PublicPairingsHandler suggerisce i piatti che vanno bene con quelli scelti dal cliente,
+// calcolati sugli ordini ricevuti dal ristorante (GET /api/v1/public/restaurants/{username}/pairings
+// con items=id1,id2 e menu_id e limit facoltativi). Non usa dati del visitatore: la risposta
+// dipende solo dal carrello e può stare nelle cache. Gli abbinamenti vengono dall'euristica
+// di co-occorrenza di pkg/pairing, che sostituisce il motore di ML non presente nel progetto
+func PublicPairingsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var cart []string
+	for _, id := range strings.Split(q.Get("items"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			cart = append(cart, id)
+		}
+	}
+	if len(cart) == 0 {
+		httputil.BadRequest(w, "items obbligatorio: gli ID dei piatti separati da virgola")
+		return
+	}
+	if len(cart) > maxPairingItems {
+		httputil.BadRequest(w, fmt.Sprintf("items può contenere al massimo %d piatti", maxPairingItems))
+		return
+	}
+	limit := defaultPairings
+	if value := q.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPairings {
+			httputil.BadRequest(w, fmt.Sprintf("limit deve essere tra 1 e %d", maxPairings))
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	restaurant, err := db.MongoInstance.GetRestaurantByUsername(ctx, mux.Vars(r)["username"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del ristorante")
+		return
+	}
+	if restaurant == nil || !restaurant.IsActive {
+		httputil.NotFound(w, "Ristorante")
+		return
+	}
+	menuIDs := restaurant.DisplayMenuIDs()
+	menuID := q.Get("menu_id")
+	if menuID == "" && len(menuIDs) > 0 {
+		menuID = menuIDs[0]
+	}
+	active := false
+	for _, id := range menuIDs {
+		active = active || id == menuID
+	}
+	if !active {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+	menu, err := db.MongoInstance.GetRestaurantMenu(ctx, menuID, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+		return
+	}
+	if menu == nil || menu.IsArchived {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+
+	suggestions, err := suggestPairings(ctx, restaurant.ID, menu, cart, limit)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel calcolo degli abbinamenti")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	httputil.Success(w, "", map[string]interface{}{
+		"menu_id":     menu.ID,
+		"items":       cart,
+		"suggestions": suggestions,
+	})
+}
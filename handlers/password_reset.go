@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+)
+
+// passwordResetTTL è la validità del link di reset password
+const passwordResetTTL = time.Hour
+
+// Errori del reset password mostrati all'utente
+var (
+	errResetTokenInvalid = errors.New("Il link di reset non è valido o è scaduto. Richiedine uno nuovo")
+	errResetPasswordWeak = errors.New("Password deve essere di almeno 8 caratteri")
+)
+
+// requestPasswordReset invia il link di reset all'email indicata, se appartiene a un
+// utente attivo. Non segnala in alcun modo se l'email esiste, per non rivelare gli account
+func requestPasswordReset(ctx context.Context, r *http.Request, email string) {
+	email = db.NormalizeCredential(email)
+	if !strings.Contains(email, "@") {
+		return
+	}
+
+	user, err := db.MongoInstance.GetUserByEmail(ctx, email)
+	if err != nil || user == nil || !user.IsActive {
+		logger.InfoCtx(ctx, "Reset password richiesto per email non registrata", nil)
+		return
+	}
+	baseURL, err := emailBaseURL()
+	if err != nil {
+		logger.ErrorCtx(ctx, "Reset password non inviato", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		return
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		logger.ErrorCtx(ctx, "Errore nella generazione del token di reset", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	reset := &models.PasswordReset{
+		ID:        hashVerificationToken(token),
+		UserID:    user.ID,
+		Email:     user.Email,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	}
+	if err := db.MongoInstance.CreatePasswordReset(ctx, reset); err != nil {
+		logger.ErrorCtx(ctx, "Errore nel salvataggio del reset password", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		return
+	}
+
+	resetURL := fmt.Sprintf("%s/reset-password?token=%s", baseURL, url.QueryEscape(token))
+	if err := notifyUser(ctx, user.Email, user.Locale, i18n.KeyPasswordReset, map[string]interface{}{
+		"ResetURL": resetURL,
+	}); err != nil {
+		logger.ErrorCtx(ctx, "Errore nell'invio della email di reset password", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+		return
+	}
+
+	RecordAuditLogAsync("PASSWORD_RESET_REQUESTED", "user", user.ID, "", getClientIP(r), r.UserAgent(), "success")
+}
+
+// resetPassword imposta la nuova password consumando il token (uso singolo) e chiude
+// tutte le sessioni dell'utente
+func resetPassword(ctx context.Context, r *http.Request, token, password string) error {
+	if len(password) < 8 {
+		return errResetPasswordWeak
+	}
+	if token == "" {
+		return errResetTokenInvalid
+	}
+
+	reset, err := db.MongoInstance.ConsumePasswordReset(ctx, hashVerificationToken(token))
+	if err != nil {
+		return err
+	}
+	if reset == nil || time.Now().After(reset.ExpiresAt) {
+		logger.SecurityEventCtx(ctx, "PASSWORD_RESET_INVALID_TOKEN", "Token di reset password non valido o scaduto", "", nil)
+		return errResetTokenInvalid
+	}
+
+	user, err := db.MongoInstance.GetUserByID(ctx, reset.UserID)
+	if err != nil || user == nil || !user.IsActive {
+		return errResetTokenInvalid
+	}
+
+	passwordHash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	if err := db.MongoInstance.UpdateUserPassword(ctx, user.ID, passwordHash); err != nil {
+		return err
+	}
+	// Il link è arrivato all'indirizzo dell'utente: l'email è verificata
+	if reset.Email != "" {
+		if err := db.MongoInstance.SetUserEmailVerified(ctx, user.ID, reset.Email, time.Now()); err != nil {
+			logger.ErrorCtx(ctx, "Errore nella verifica dell'email dopo il reset password", map[string]interface{}{
+				"error":   err.Error(),
+				"user_id": user.ID,
+			})
+		}
+	}
+	if err := db.MongoInstance.DeleteSessionsByUserID(ctx, user.ID); err != nil {
+		logger.ErrorCtx(ctx, "Errore nella chiusura delle sessioni dopo il reset password", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+	}
+	if err := db.MongoInstance.RevokeRefreshTokensByUser(ctx, user.ID, time.Now()); err != nil {
+		logger.ErrorCtx(ctx, "Errore nella revoca dei refresh token dopo il reset password", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": user.ID,
+		})
+	}
+
+	notifyOwner(ctx, user, i18n.KeyPasswordChanged, nil)
+	logger.AuditLogCtx(ctx, "PASSWORD_RESET", "user", "Password reimpostata tramite link email", user.ID, nil)
+	RecordAuditLogAsync("PASSWORD_RESET", "user", user.ID, "", getClientIP(r), r.UserAgent(), "success")
+	return nil
+}
+
+// ForgotPasswordHandler mostra il form di richiesta del reset (GET) e invia il link (POST).
+// La risposta è la stessa che l'email esista o meno
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	data := struct {
+		Sent      bool
+		CSRFToken string
+	}{
+		CSRFToken: csrfToken(w, r),
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		requestPasswordReset(ctx, r, r.FormValue("email"))
+		data.Sent = true
+	}
+
+	renderTemplate(w, "forgot_password", data)
+}
+
+// ResetPasswordHandler mostra il form per la nuova password (GET) e la imposta (POST)
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+	w.Header().Set("Referrer-Policy", "no-referrer") // Il token è nella query string
+
+	data := struct {
+		Token     string
+		Error     string
+		CSRFToken string
+	}{
+		Token:     r.URL.Query().Get("token"),
+		CSRFToken: csrfToken(w, r),
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+			return
+		}
+		data.Token = r.FormValue("token")
+
+		if r.FormValue("password") != r.FormValue("confirm_password") {
+			data.Error = "Le password non coincidono"
+			renderTemplate(w, "reset_password", data)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		err := resetPassword(ctx, r, data.Token, r.FormValue("password"))
+		if err == nil {
+			http.Redirect(w, r, "/login?success=password_reset", http.StatusSeeOther)
+			return
+		}
+		if err != errResetTokenInvalid && err != errResetPasswordWeak {
+			logger.ErrorCtx(r.Context(), "Errore nel reset password", map[string]interface{}{
+				"error": err.Error(),
+			})
+			http.Error(w, "Errore nel reset della password", http.StatusInternalServerError)
+			return
+		}
+		data.Error = err.Error()
+	}
+
+	renderTemplate(w, "reset_password", data)
+}
+
+// ForgotPasswordAPIHandler gestisce POST /api/v1/auth/forgot-password con body
+// {"email": "..."} e risponde sempre 202, che l'email esista o meno
+func ForgotPasswordAPIHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		httputil.BadRequest(w, "Specificare email")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	requestPasswordReset(ctx, r, req.Email)
+	httputil.Accepted(w, "Se l'email è registrata riceverai un link per reimpostare la password", nil)
+}
+
+// ResetPasswordAPIHandler gestisce POST /api/v1/auth/reset-password con body
+// {"token": "...", "password": "..."}
+func ResetPasswordAPIHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err := resetPassword(ctx, r, req.Token, req.Password)
+	switch {
+	case err == nil:
+		httputil.Success(w, "Password reimpostata", nil)
+	case err == errResetTokenInvalid || err == errResetPasswordWeak:
+		httputil.BadRequest(w, err.Error())
+	default:
+		logger.ErrorCtx(r.Context(), "Errore nel reset password", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nel reset della password")
+	}
+}
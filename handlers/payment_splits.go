@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/payments"
+)
+
+// splitPartRequest è una quota di un conto diviso per piatti
+type splitPartRequest struct {
+	Label      string   `json:"label"`
+	LineIDs    []string `json:"line_ids"`
+	TipCents   int64    `json:"tip_cents"`
+	TipPercent float64  `json:"tip_percent"`
+}
+
+// splitRequest divide il conto in parti uguali tra diners commensali (mode even) o per piatti
+// (mode items, con parts). tip_percent è la mancia di tutte le quote, salvo quella indicata
+// nelle singole parti
+type splitRequest struct {
+	Mode       string             `json:"mode"`
+	Diners     int                `json:"diners"`
+	Parts      []splitPartRequest `json:"parts"`
+	TipPercent float64            `json:"tip_percent"`
+	ReturnURL  string             `json:"return_url"`
+}
+
+// plannedSplit è una quota calcolata, con la mancia da aggiungere al pagamento
+type plannedSplit struct {
+	split models.OrderSplit
+	tip   int64
+}
+
+// planSplits divide l'importo dovuto dell'ordine nelle quote richieste. Nei conti divisi per
+// piatti ogni piatto va in una sola quota e la parte pagata con un buono regalo è ripartita in
+// proporzione. Gli errori restituiti sono messaggi per il client
+func planSplits(order *models.Order, req splitRequest) ([]plannedSplit, error) {
+	var weights []int64
+	var parts []splitPartRequest
+	switch req.Mode {
+	case models.SplitEven:
+		if req.Diners < 2 || req.Diners > models.MaxOrderSplits {
+			return nil, fmt.Errorf("diners deve essere tra 2 e %d", models.MaxOrderSplits)
+		}
+		for i := 0; i < req.Diners; i++ {
+			weights = append(weights, 1)
+			parts = append(parts, splitPartRequest{Label: fmt.Sprintf("Commensale %d", i+1)})
+		}
+	case models.SplitItems:
+		if len(req.Parts) < 2 || len(req.Parts) > models.MaxOrderSplits {
+			return nil, fmt.Errorf("parts deve contenere tra 2 e %d quote", models.MaxOrderSplits)
+		}
+		assigned := make(map[string]bool, len(order.Lines))
+		for i, part := range req.Parts {
+			if len(part.LineIDs) == 0 {
+				return nil, errors.New("ogni quota deve contenere almeno un piatto")
+			}
+			var weight int64
+			for _, lineID := range part.LineIDs {
+				line := order.Line(lineID)
+				if line == nil {
+					return nil, fmt.Errorf("il piatto %q non è nell'ordine", lineID)
+				}
+				if assigned[lineID] {
+					return nil, fmt.Errorf("il piatto %s è in più quote", line.Name)
+				}
+				assigned[lineID] = true
+				weight += toCents(line.Price) * int64(line.Quantity)
+			}
+			if len(part.Label) > 50 {
+				return nil, errors.New("l'etichetta di una quota può contenere al massimo 50 caratteri")
+			}
+			part.Label = strings.TrimSpace(part.Label)
+			if part.Label == "" {
+				part.Label = fmt.Sprintf("Quota %d", i+1)
+			}
+			weights = append(weights, weight)
+			parts = append(parts, part)
+		}
+		if len(assigned) != len(order.Lines) {
+			return nil, errors.New("ogni piatto dell'ordine deve essere in una quota")
+		}
+	default:
+		return nil, errors.New("mode deve essere even o items")
+	}
+
+	amounts := payments.Allocate(orderAmountDue(order), weights)
+	planned := make([]plannedSplit, 0, len(parts))
+	for i, part := range parts {
+		if amounts[i] <= 0 {
+			return nil, fmt.Errorf("la quota %s non ha importo da pagare", part.Label)
+		}
+		tipReq := checkoutRequest{TipCents: part.TipCents, TipPercent: part.TipPercent}
+		if part.TipCents == 0 && part.TipPercent == 0 {
+			tipReq.TipPercent = req.TipPercent
+		}
+		tip, err := tipReq.tip(amounts[i])
+		if err != nil {
+			return nil, err
+		}
+		planned = append(planned, plannedSplit{
+			split: models.OrderSplit{
+				ID:          uuid.New().String(),
+				Label:       part.Label,
+				LineIDs:     part.LineIDs,
+				AmountCents: amounts[i],
+			},
+			tip: tip,
+		})
+	}
+	return planned, nil
+}
+
+// SplitOrderHandler divide il conto dell'ordine e apre una pagina di pagamento per ogni quota,
+// da mostrare a ciascun commensale come link o QR code (POST /api/v1/orders/{id}/split con
+// {"mode": "even", "diners": 3} o {"mode": "items", "parts": [{"line_ids": [...]}]}). Una
+// nuova divisione sostituisce quella precedente finché nessuna quota è pagata
+func SplitOrderHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	var req splitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	returnURL, err := checkoutRequest{ReturnURL: req.ReturnURL}.returnURL(restaurant)
+	if err != nil {
+		respondPaymentError(w, r, err, "")
+		return
+	}
+
+	provider, err := restaurantPaymentProvider(restaurant)
+	if err != nil {
+		respondPaymentError(w, r, err, "Errore nella configurazione dei pagamenti")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	order, err := db.MongoInstance.GetOrder(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+	if err := checkOrderPayable(order); err != nil {
+		respondPaymentError(w, r, err, "")
+		return
+	}
+	planned, err := planSplits(order, req)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	splits := make([]models.OrderSplit, 0, len(planned))
+	for i, p := range planned {
+		split := p.split
+		split.Payment, err = openCheckout(ctx, r, provider, restaurant, order.ID+"/"+split.ID,
+			fmt.Sprintf("%s - ordine %d, quota %d di %d", restaurant.Name, order.Number, i+1, len(planned)),
+			split.AmountCents, p.tip, returnURL)
+		if err != nil {
+			respondPaymentError(w, r, err, "")
+			return
+		}
+		split.PaymentStatus = models.PaymentPending
+		splits = append(splits, split)
+	}
+
+	order, err = changeOrder(ctx, restaurant.ID, order.ID, func(order *models.Order) error {
+		if err := checkOrderPayable(order); err != nil {
+			return err
+		}
+		order.SplitMode = req.Mode
+		order.Splits = splits
+		order.Payment = nil
+		order.PaymentStatus = models.PaymentPending
+		order.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		respondPaymentError(w, r, err, "Errore nell'aggiornamento dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+
+	publishOrderEvent(events.OrderUpdated, order, requestActorID(r))
+	RecordAuditLogAsync("ORDER_SPLIT", "order", order.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Created(w, "Conto diviso", order)
+}
+
+// SplitCheckoutHandler riapre la pagina di pagamento di una quota, ad esempio dopo un
+// pagamento rifiutato o per cambiare la mancia (POST /api/v1/orders/{id}/splits/{split_id}/checkout
+// con return_url, tip_cents o tip_percent facoltativi)
+func SplitCheckoutHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	req, err := decodeCheckoutRequest(r)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	returnURL, err := req.returnURL(restaurant)
+	if err != nil {
+		respondPaymentError(w, r, err, "")
+		return
+	}
+
+	provider, err := restaurantPaymentProvider(restaurant)
+	if err != nil {
+		respondPaymentError(w, r, err, "Errore nella configurazione dei pagamenti")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+
+	splitID := mux.Vars(r)["split_id"]
+	order, err := db.MongoInstance.GetOrder(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+	split, err := payableSplit(order, splitID)
+	if err != nil {
+		respondPaymentError(w, r, err, "")
+		return
+	}
+	tip, err := req.tip(split.AmountCents)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	payment, err := openCheckout(ctx, r, provider, restaurant, order.ID+"/"+split.ID,
+		fmt.Sprintf("%s - ordine %d, %s", restaurant.Name, order.Number, split.Label),
+		split.AmountCents, tip, returnURL)
+	if err != nil {
+		respondPaymentError(w, r, err, "")
+		return
+	}
+
+	order, err = changeOrder(ctx, restaurant.ID, order.ID, func(order *models.Order) error {
+		split, err := payableSplit(order, splitID)
+		if err != nil {
+			return err
+		}
+		split.Payment = payment
+		split.PaymentStatus = models.PaymentPending
+		order.RefreshPaymentStatus()
+		order.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		respondPaymentError(w, r, err, "Errore nell'aggiornamento dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+
+	RecordAuditLogAsync("ORDER_CHECKOUT_CREATED", "order", order.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Created(w, "Pagina di pagamento creata", order)
+}
+
+// payableSplit restituisce la quota dell'ordine se si può ancora pagare
+func payableSplit(order *models.Order, splitID string) (*models.OrderSplit, error) {
+	if order.Status == models.OrderStatusCancelled {
+		return nil, models.ErrOrderClosed
+	}
+	split := order.Split(splitID)
+	if split == nil {
+		return nil, errSplitNotFound
+	}
+	if models.IsPaid(split.PaymentStatus) {
+		return nil, errNothingToPay
+	}
+	return split, nil
+}
+
+// tipDay sono le mance di un giorno
+type tipDay struct {
+	Date      string `json:"date"`
+	TipsCents int64  `json:"tips_cents"`
+	Payments  int    `json:"payments"`
+}
+
+// TipsAnalyticsHandler riepiloga le mance dei pagamenti online confermati degli ultimi giorni:
+// totale, pagamenti con mancia, mancia media in percentuale e andamento giornaliero
+// (GET /api/v1/analytics/tips?days=30)
+func TipsAnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	days := 30
+	if param := r.URL.Query().Get("days"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed < 1 || parsed > 365 {
+			httputil.BadRequest(w, "days deve essere tra 1 e 365")
+			return
+		}
+		days = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	since := time.Now().AddDate(0, 0, -days)
+	var tips, paid int64
+	var count, withTip int
+	byDay := make(map[string]*tipDay)
+	err := db.MongoInstance.StreamOrders(ctx, db.OrderFilter{RestaurantID: restaurant.ID, Since: since}, func(order *models.Order) error {
+		for _, payment := range order.PaidPayments() {
+			count++
+			paid += payment.AmountCents - payment.TipCents
+			if payment.TipCents == 0 {
+				continue
+			}
+			withTip++
+			tips += payment.TipCents
+			date := payment.PaidAt.In(time.Local).Format("2006-01-02")
+			if byDay[date] == nil {
+				byDay[date] = &tipDay{Date: date}
+			}
+			byDay[date].TipsCents += payment.TipCents
+			byDay[date].Payments++
+		}
+		return nil
+	})
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel calcolo delle mance")
+		return
+	}
+
+	daily := make([]tipDay, 0, len(byDay))
+	for _, day := range byDay {
+		daily = append(daily, *day)
+	}
+	sort.Slice(daily, func(i, j int) bool { return daily[i].Date < daily[j].Date })
+	var averagePercent float64
+	if paid > 0 {
+		averagePercent = math.Round(float64(tips)*10000/float64(paid)) / 100
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", map[string]interface{}{
+		"days":                days,
+		"tips_cents":          tips,
+		"payments":            count,
+		"payments_with_tip":   withTip,
+		"paid_cents":          paid,
+		"average_tip_percent": averagePercent,
+		"daily":               daily,
+	})
+}
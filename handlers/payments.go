@@ -0,0 +1,673 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/payments"
+	"qr-menu/security"
+)
+
+var (
+	// errPaymentsNotConfigured indica che il ristorante non ha un provider di pagamento
+	errPaymentsNotConfigured = errors.New("pagamenti online non configurati per il ristorante")
+	// errNothingToPay indica che l'ordine è già pagato o non ha importo da pagare online
+	errNothingToPay = errors.New("l'ordine è già pagato o non ha importo da pagare")
+	// errNothingToRefund indica che l'ordine non ha un pagamento online rimborsabile
+	errNothingToRefund = errors.New("l'ordine non ha un pagamento online da rimborsare")
+	// errPaymentProvider indica che il provider non ha aperto la pagina di pagamento
+	errPaymentProvider = errors.New("il provider di pagamento non ha risposto, riprova")
+	// errOrderSplit indica che il conto è diviso e una quota è già pagata: si pagano le quote
+	errOrderSplit = errors.New("il conto è diviso e una quota è già pagata: si pagano le singole quote")
+	// errSplitRequired indica che il conto è diviso e serve la quota a cui si riferisce la richiesta
+	errSplitRequired = errors.New("il conto è diviso: indicare split_id")
+	// errSplitNotFound indica che la quota non appartiene all'ordine
+	errSplitNotFound = errors.New("quota del conto non trovata")
+	// errInvalidReturnURL indica un return_url che non è un URL http(s) assoluto
+	errInvalidReturnURL = errors.New("return_url deve essere un URL http(s) assoluto")
+)
+
+// maxTipPercentages è il numero massimo di mance proposte al pagamento
+const maxTipPercentages = 5
+
+// paymentCredentials cifra le credenziali dei provider di pagamento dei ristoranti; nil se
+// security.jwt_secret non è configurato, e allora i pagamenti degli ordini sono disabilitati
+var paymentCredentials *security.Encryption
+
+// SetPaymentCredentialsKey imposta la chiave che cifra le credenziali dei provider di
+// pagamento (chiamato dall'initializer con security.jwt_secret, che cifra anche le chiavi di
+// firma dei token)
+func SetPaymentCredentialsKey(secret string) {
+	if secret == "" {
+		paymentCredentials = nil
+		return
+	}
+	paymentCredentials = security.NewEncryption(secret)
+}
+
+// restaurantPaymentProvider restituisce il provider di pagamento del ristorante, decifrandone
+// le credenziali. Restituisce errPaymentsNotConfigured se il ristorante non ne ha uno
+func restaurantPaymentProvider(restaurant *models.Restaurant) (payments.Provider, error) {
+	if restaurant.Payments == nil || paymentCredentials == nil {
+		return nil, errPaymentsNotConfigured
+	}
+	plain, err := paymentCredentials.Decrypt(restaurant.Payments.Credentials)
+	if err != nil {
+		return nil, fmt.Errorf("credenziali di pagamento non leggibili: %v", err)
+	}
+	var cfg payments.Config
+	if err := json.Unmarshal([]byte(plain), &cfg); err != nil {
+		return nil, fmt.Errorf("credenziali di pagamento non valide: %v", err)
+	}
+	return payments.New(cfg)
+}
+
+// paymentWebhookURL è l'endpoint delle notifiche del provider di pagamento del ristorante.
+// Usa solo server.base_url: l'URL viene inviato al provider, e uno ricavato da Host o
+// X-Forwarded-Host, scelti dal client, gli farebbe consegnare le notifiche a un altro dominio
+func paymentWebhookURL(restaurantID string) (string, error) {
+	baseURL, err := emailBaseURL()
+	if err != nil {
+		return "", err
+	}
+	return baseURL + "/api/v1/public/payments/" + url.PathEscape(restaurantID) + "/webhook", nil
+}
+
+// paymentSettingsResponse descrive il provider configurato, senza le credenziali. webhook_url
+// manca se server.base_url non è configurato
+func paymentSettingsResponse(restaurant *models.Restaurant) map[string]interface{} {
+	response := map[string]interface{}{
+		"enabled":   paymentCredentials != nil,
+		"providers": payments.Providers,
+	}
+	if webhookURL, err := paymentWebhookURL(restaurant.ID); err == nil {
+		response["webhook_url"] = webhookURL
+	}
+	if restaurant.Payments != nil {
+		response["provider"] = restaurant.Payments.Provider
+		response["currency"] = restaurant.Payments.Currency
+		response["tip_percentages"] = restaurant.Payments.TipPercentages
+		response["updated_at"] = restaurant.Payments.UpdatedAt
+	}
+	return response
+}
+
+// GetPaymentSettingsHandler restituisce il provider dei pagamenti online configurato, senza le
+// credenziali (GET /api/v1/payments/settings)
+func GetPaymentSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	httputil.Success(w, "", paymentSettingsResponse(restaurant))
+}
+
+// UpdatePaymentSettingsHandler configura il provider dei pagamenti online del ristorante
+// (PUT /api/v1/payments/settings con provider, currency, credentials e tip_percentages). Le
+// credenziali sono verificate, cifrate e non vengono più restituite
+func UpdatePaymentSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	if paymentCredentials == nil {
+		httputil.Conflict(w, "I pagamenti online richiedono security.jwt_secret su questa istanza")
+		return
+	}
+
+	var req struct {
+		Provider       string          `json:"provider"`
+		Currency       string          `json:"currency"`
+		Credentials    payments.Config `json:"credentials"`
+		TipPercentages []float64       `json:"tip_percentages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		currency = "EUR"
+	}
+	if len(currency) != 3 {
+		httputil.BadRequest(w, "currency deve essere un codice ISO 4217, es. EUR")
+		return
+	}
+	if len(req.TipPercentages) > maxTipPercentages {
+		httputil.BadRequest(w, fmt.Sprintf("tip_percentages può contenere al massimo %d mance", maxTipPercentages))
+		return
+	}
+	for _, percent := range req.TipPercentages {
+		if percent <= 0 || percent > 100 {
+			httputil.BadRequest(w, "Le mance di tip_percentages devono essere tra 0 e 100")
+			return
+		}
+	}
+	cfg := req.Credentials
+	cfg.Provider = req.Provider
+	if _, err := payments.New(cfg); err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	plain, err := json.Marshal(cfg)
+	if err == nil {
+		var sealed string
+		sealed, err = paymentCredentials.Encrypt(string(plain))
+		restaurant.Payments = &models.PaymentSettings{
+			Provider:       cfg.Provider,
+			Currency:       currency,
+			Credentials:    sealed,
+			TipPercentages: req.TipPercentages,
+			UpdatedAt:      time.Now(),
+		}
+	}
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella cifratura delle credenziali")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.SetRestaurantPaymentSettings(ctx, restaurant.ID, restaurant.Payments); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio del provider di pagamento")
+		return
+	}
+
+	RecordAuditLogAsync("PAYMENT_SETTINGS_UPDATED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Provider di pagamento configurato", paymentSettingsResponse(restaurant))
+}
+
+// DeletePaymentSettingsHandler rimuove il provider e le credenziali dei pagamenti online
+// (DELETE /api/v1/payments/settings)
+func DeletePaymentSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.SetRestaurantPaymentSettings(ctx, restaurant.ID, nil); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella rimozione del provider di pagamento")
+		return
+	}
+	RecordAuditLogAsync("PAYMENT_SETTINGS_DELETED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// orderAmountDue restituisce la parte dell'ordine da pagare online, in centesimi: il totale
+// meno la parte pagata con un buono regalo
+func orderAmountDue(order *models.Order) int64 {
+	return int64((order.Total-order.VoucherPaid)*100 + 0.5)
+}
+
+// checkoutRequest è la richiesta di una pagina di pagamento, dell'intero conto o di una quota,
+// con la mancia scelta dal cliente in centesimi o in percentuale
+type checkoutRequest struct {
+	ReturnURL  string  `json:"return_url"`
+	TipCents   int64   `json:"tip_cents"`
+	TipPercent float64 `json:"tip_percent"`
+}
+
+// decodeCheckoutRequest legge la richiesta, che può mancare del tutto
+func decodeCheckoutRequest(r *http.Request) (checkoutRequest, error) {
+	var req checkoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, errors.New("Formato JSON non valido")
+		}
+	}
+	return req, nil
+}
+
+// returnURL restituisce la pagina su cui torna il cliente dopo il pagamento: return_url se
+// indicato, altrimenti il menu pubblico del ristorante su server.base_url (errBaseURLRequired
+// se non è configurato)
+func (req checkoutRequest) returnURL(restaurant *models.Restaurant) (string, error) {
+	if req.ReturnURL == "" {
+		baseURL, err := emailBaseURL()
+		if err != nil {
+			return "", err
+		}
+		return baseURL + "/r/" + url.PathEscape(restaurant.Username), nil
+	}
+	parsed, err := url.Parse(req.ReturnURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return "", errInvalidReturnURL
+	}
+	return req.ReturnURL, nil
+}
+
+// tip restituisce la mancia in centesimi su amountCents. La mancia non può superare l'importo
+func (req checkoutRequest) tip(amountCents int64) (int64, error) {
+	if req.TipCents < 0 || req.TipPercent < 0 || req.TipPercent > 100 {
+		return 0, errors.New("la mancia non può essere negativa e tip_percent è al massimo 100")
+	}
+	if req.TipCents > 0 && req.TipPercent > 0 {
+		return 0, errors.New("indicare la mancia con tip_cents o con tip_percent, non entrambi")
+	}
+	tip := req.TipCents
+	if req.TipPercent > 0 {
+		tip = payments.TipCents(amountCents, req.TipPercent)
+	}
+	if tip > amountCents {
+		return 0, errors.New("la mancia non può superare l'importo da pagare")
+	}
+	return tip, nil
+}
+
+// openCheckout apre presso il provider la pagina di pagamento di amountCents più la mancia e
+// restituisce il pagamento da salvare sull'ordine. reference identifica l'ordine, seguito
+// dalla quota per i conti divisi
+func openCheckout(ctx context.Context, r *http.Request, provider payments.Provider, restaurant *models.Restaurant,
+	reference, description string, amountCents, tipCents int64, returnURL string) (*models.OrderPayment, error) {
+	webhookURL, err := paymentWebhookURL(restaurant.ID)
+	if err != nil {
+		return nil, err
+	}
+	checkout, err := provider.CreateCheckout(ctx, payments.CheckoutRequest{
+		Reference:   reference,
+		Description: description,
+		AmountCents: amountCents + tipCents,
+		Currency:    restaurant.Payments.Currency,
+		ReturnURL:   returnURL,
+		WebhookURL:  webhookURL,
+	})
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella creazione del pagamento", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+			"provider":      provider.Name(),
+		})
+		return nil, errPaymentProvider
+	}
+	return &models.OrderPayment{
+		Provider:    provider.Name(),
+		CheckoutID:  checkout.ID,
+		CheckoutURL: checkout.URL,
+		AmountCents: amountCents + tipCents,
+		TipCents:    tipCents,
+		Currency:    restaurant.Payments.Currency,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// OrderCheckoutHandler apre la pagina di pagamento online dell'ordine, da mostrare al cliente
+// come link o QR code (POST /api/v1/orders/{id}/checkout con return_url, tip_cents o
+// tip_percent facoltativi). Una nuova pagina sostituisce quella ancora in attesa, anche di un
+// conto diviso di cui non è stata pagata nessuna quota
+func OrderCheckoutHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	req, err := decodeCheckoutRequest(r)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	returnURL, err := req.returnURL(restaurant)
+	if err != nil {
+		respondPaymentError(w, r, err, "")
+		return
+	}
+
+	provider, err := restaurantPaymentProvider(restaurant)
+	if err != nil {
+		respondPaymentError(w, r, err, "Errore nella configurazione dei pagamenti")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+
+	order, err := db.MongoInstance.GetOrder(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+	if err := checkOrderPayable(order); err != nil {
+		respondPaymentError(w, r, err, "")
+		return
+	}
+	amount := orderAmountDue(order)
+	tip, err := req.tip(amount)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	payment, err := openCheckout(ctx, r, provider, restaurant, order.ID,
+		fmt.Sprintf("%s - ordine %d", restaurant.Name, order.Number), amount, tip, returnURL)
+	if err != nil {
+		respondPaymentError(w, r, err, "")
+		return
+	}
+
+	order, err = changeOrder(ctx, restaurant.ID, order.ID, func(order *models.Order) error {
+		if err := checkOrderPayable(order); err != nil {
+			return err
+		}
+		order.PaymentStatus = models.PaymentPending
+		order.Payment = payment
+		order.SplitMode = ""
+		order.Splits = nil
+		order.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
+		respondPaymentError(w, r, err, "Errore nell'aggiornamento dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+
+	RecordAuditLogAsync("ORDER_CHECKOUT_CREATED", "order", order.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Created(w, "Pagina di pagamento creata", order)
+}
+
+// checkOrderPayable verifica che si possa aprire un nuovo pagamento dell'intero conto o
+// dividerlo: l'ordine non è annullato, resta un importo da pagare e nessun pagamento, né di
+// una quota, è già stato confermato
+func checkOrderPayable(order *models.Order) error {
+	if order.Status == models.OrderStatusCancelled {
+		return models.ErrOrderClosed
+	}
+	if orderAmountDue(order) <= 0 || models.IsPaid(order.PaymentStatus) {
+		return errNothingToPay
+	}
+	for _, split := range order.Splits {
+		if models.IsPaid(split.PaymentStatus) {
+			return errOrderSplit
+		}
+	}
+	return nil
+}
+
+// RefundOrderHandler rimborsa il pagamento online dell'ordine, per intero o in parte
+// (POST /api/v1/orders/{id}/refund con amount_cents facoltativo, default quanto resta). Nei
+// conti divisi split_id indica la quota da rimborsare
+func RefundOrderHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	var req struct {
+		AmountCents int64  `json:"amount_cents"`
+		SplitID     string `json:"split_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httputil.BadRequest(w, "Formato JSON non valido")
+			return
+		}
+	}
+	if req.AmountCents < 0 {
+		httputil.BadRequest(w, "amount_cents non può essere negativo")
+		return
+	}
+
+	provider, err := restaurantPaymentProvider(restaurant)
+	if err != nil {
+		respondPaymentError(w, r, err, "Errore nella configurazione dei pagamenti")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+
+	order, err := db.MongoInstance.GetOrder(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+	status, payment, err := orderPaymentTarget(order, req.SplitID)
+	if err != nil {
+		respondPaymentError(w, r, err, "")
+		return
+	}
+	if (*status != models.PaymentPaid && *status != models.PaymentPartiallyRefunded) ||
+		payment == nil || payment.PaymentID == "" || payment.Provider != provider.Name() {
+		respondPaymentError(w, r, errNothingToRefund, "")
+		return
+	}
+	remaining := payment.AmountCents - payment.RefundedCents
+	amount := req.AmountCents
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount > remaining {
+		httputil.BadRequest(w, fmt.Sprintf("Si possono rimborsare al massimo %d centesimi", remaining))
+		return
+	}
+
+	refundID, err := provider.Refund(ctx, payment.PaymentID, amount, payment.Currency)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel rimborso del pagamento", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+			"order_id":      order.ID,
+			"provider":      provider.Name(),
+		})
+		httputil.ErrorMessage(w, http.StatusBadGateway, "Il provider di pagamento ha rifiutato il rimborso")
+		return
+	}
+
+	actorID := requestActorID(r)
+	order, err = changeOrder(ctx, restaurant.ID, order.ID, func(order *models.Order) error {
+		status, payment, err := orderPaymentTarget(order, req.SplitID)
+		if err != nil || payment == nil {
+			return errNothingToRefund
+		}
+		now := time.Now()
+		payment.RefundedCents += amount
+		payment.Refunds = append(payment.Refunds, models.OrderRefund{
+			ID:          refundID,
+			AmountCents: amount,
+			ActorID:     actorID,
+			CreatedAt:   now,
+		})
+		*status = models.PaymentPartiallyRefunded
+		if payment.RefundedCents >= payment.AmountCents {
+			*status = models.PaymentRefunded
+		}
+		order.RefreshPaymentStatus()
+		order.UpdatedAt = now
+		return nil
+	})
+	if err != nil || order == nil {
+		// Il rimborso è già avvenuto presso il provider: va solo annotato a mano
+		logger.ErrorCtx(r.Context(), "Rimborso eseguito ma non registrato sull'ordine", map[string]interface{}{
+			"error":         fmt.Sprint(err),
+			"restaurant_id": restaurant.ID,
+			"order_id":      mux.Vars(r)["id"],
+			"split_id":      req.SplitID,
+			"refund_id":     refundID,
+			"amount_cents":  amount,
+		})
+	}
+	if err != nil {
+		respondPaymentError(w, r, err, "Errore nell'aggiornamento dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+
+	publishOrderEvent(events.OrderUpdated, order, actorID)
+	RecordAuditLogAsync("ORDER_REFUNDED", "order", order.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Rimborso eseguito", order)
+}
+
+// orderPaymentTarget restituisce lo stato e il pagamento dell'intero conto o, con splitID, di
+// una sua quota. Nei conti divisi la quota è obbligatoria
+func orderPaymentTarget(order *models.Order, splitID string) (*string, *models.OrderPayment, error) {
+	if splitID == "" {
+		if len(order.Splits) > 0 {
+			return nil, nil, errSplitRequired
+		}
+		return &order.PaymentStatus, order.Payment, nil
+	}
+	split := order.Split(splitID)
+	if split == nil {
+		return nil, nil, errSplitNotFound
+	}
+	return &split.PaymentStatus, split.Payment, nil
+}
+
+// respondPaymentError risponde agli errori dei pagamenti degli ordini
+func respondPaymentError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	switch {
+	case errors.Is(err, errPaymentsNotConfigured), errors.Is(err, errNothingToPay), errors.Is(err, errNothingToRefund),
+		errors.Is(err, errOrderSplit), errors.Is(err, errBaseURLRequired):
+		httputil.Conflict(w, err.Error())
+	case errors.Is(err, errSplitRequired), errors.Is(err, errInvalidReturnURL):
+		httputil.BadRequest(w, err.Error())
+	case errors.Is(err, errSplitNotFound):
+		httputil.NotFound(w, "Quota")
+	case errors.Is(err, errPaymentProvider):
+		httputil.ErrorMessage(w, http.StatusBadGateway, "Il provider di pagamento non ha risposto, riprova")
+	default:
+		respondOrderError(w, r, err, message)
+	}
+}
+
+// PaymentWebhookHandler riceve le notifiche del provider di pagamento del ristorante
+// (/api/v1/public/payments/{restaurant_id}/webhook). Le notifiche sono autenticate dalla firma
+// (Stripe) o rilette dall'API del provider (SumUp, Satispay); un pagamento confermato segna
+// l'ordine come pagato. Le notifiche ripetute non hanno effetto
+func PaymentWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 20*time.Second)
+	defer cancel()
+
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, mux.Vars(r)["restaurant_id"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella notifica di pagamento")
+		return
+	}
+	if restaurant == nil {
+		httputil.NotFound(w, "Endpoint")
+		return
+	}
+	provider, err := restaurantPaymentProvider(restaurant)
+	if err != nil {
+		httputil.NotFound(w, "Endpoint")
+		return
+	}
+	payment, err := provider.ParseWebhook(ctx, r)
+	if err != nil {
+		logger.SecurityEventCtx(r.Context(), "PAYMENT_WEBHOOK_REJECTED", "Notifica di pagamento non valida", "", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+			"provider":      provider.Name(),
+			"ip":            getClientIP(r),
+		})
+		httputil.BadRequest(w, "Notifica non valida")
+		return
+	}
+	if payment == nil || payment.Reference == "" || payment.Status == payments.StatusPending {
+		httputil.NoContent(w)
+		return
+	}
+
+	// I pagamenti delle quote di un conto diviso hanno come riferimento ordine/quota
+	orderID, splitID, _ := strings.Cut(payment.Reference, "/")
+	changed := false
+	var target *models.OrderPayment
+	order, err := changeOrder(ctx, restaurant.ID, orderID, func(order *models.Order) error {
+		status, current, err := orderPaymentTarget(order, splitID)
+		if err != nil {
+			changed, target = false, nil
+			return nil
+		}
+		now := time.Now()
+		changed, target = applyPayment(status, current, payment, provider.Name(), now), current
+		if changed {
+			order.RefreshPaymentStatus()
+			order.UpdatedAt = now
+		}
+		return nil
+	})
+	if err != nil {
+		// Il provider riprova la notifica finché non riceve una risposta positiva
+		respondMenuV2Error(w, r, err, "Errore nella registrazione del pagamento")
+		return
+	}
+	if order == nil || !changed {
+		if order != nil && payment.Status == payments.StatusPaid && (target == nil || target.CheckoutID != payment.CheckoutID) {
+			logger.ErrorCtx(r.Context(), "Pagamento ricevuto per un ordine già pagato: va rimborsato", map[string]interface{}{
+				"restaurant_id": restaurant.ID,
+				"order_id":      order.ID,
+				"split_id":      splitID,
+				"checkout_id":   payment.CheckoutID,
+				"payment_id":    payment.PaymentID,
+			})
+		}
+		httputil.NoContent(w)
+		return
+	}
+
+	publishOrderEvent(events.OrderUpdated, order, "")
+	action := "ORDER_PAID"
+	switch {
+	case payment.Status == payments.StatusFailed:
+		action = "ORDER_PAYMENT_FAILED"
+	case order.PaymentStatus != models.PaymentPaid:
+		action = "ORDER_SPLIT_PAID"
+	}
+	RecordAuditLogAsync(action, "order", order.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// applyPayment registra l'esito di un pagamento sul pagamento current dell'ordine o di una
+// quota, con stato status, e indica se è cambiato. Un pagamento confermato vale anche se
+// proviene da una pagina sostituita, purché l'importo corrisponda; un rifiuto conta solo per
+// la pagina in attesa
+func applyPayment(status *string, current *models.OrderPayment, payment *payments.Payment, provider string, now time.Time) bool {
+	if current == nil || (*status != models.PaymentPending && *status != models.PaymentFailed) {
+		return false
+	}
+	if payment.Status == payments.StatusFailed {
+		if *status != models.PaymentPending || current.CheckoutID != payment.CheckoutID {
+			return false
+		}
+		*status = models.PaymentFailed
+		return true
+	}
+	if payment.AmountCents != current.AmountCents || payment.Currency != strings.ToUpper(current.Currency) {
+		return false
+	}
+	paidAt := now
+	*status = models.PaymentPaid
+	current.Provider = provider
+	current.CheckoutID = payment.CheckoutID
+	current.PaymentID = payment.PaymentID
+	current.PaidAt = &paidAt
+	return true
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+)
+
+// Sincronizzazione con le casse (POS): la cassa legge i menu modificati dall'ultimo cursore
+// e invia prezzi e disponibilità, che restano della cassa. Ogni piatto ha un ETag: un
+// aggiornamento con un ETag superato è un conflitto, riportato alla cassa invece di
+// sovrascrivere la modifica fatta nel frattempo dal pannello
+
+const (
+	// posSyncCursorLag arretra il cursore restituito, così le modifiche salvate mentre la
+	// lettura era in corso (o con l'orologio di un'altra istanza indietro) non vanno perse:
+	// le ultime possono ripresentarsi alla lettura successiva
+	posSyncCursorLag = 5 * time.Second
+
+	// posSyncMaxUpdates è il numero massimo di piatti aggiornati in una richiesta
+	posSyncMaxUpdates = 500
+
+	// posSyncAttempts è il numero di tentativi di salvare gli aggiornamenti se il menu viene
+	// modificato da un'altra richiesta nel frattempo
+	posSyncAttempts = 5
+)
+
+// Strategie per i conflitti negli aggiornamenti dalla cassa
+const (
+	posConflictReject    = "reject"    // Il piatto modificato nel frattempo non viene aggiornato
+	posConflictOverwrite = "overwrite" // La cassa vince e sovrascrive la modifica
+)
+
+// Motivi dei conflitti
+const (
+	posConflictModified = "modified"  // Il piatto è cambiato dopo la lettura della cassa
+	posConflictNotFound = "not_found" // Il piatto non esiste più nel menu
+)
+
+// posItem è un piatto come lo vede la cassa
+type posItem struct {
+	ID           string  `json:"id"`
+	CategoryID   string  `json:"category_id"`
+	CategoryName string  `json:"category_name"`
+	Name         string  `json:"name"`
+	Price        float64 `json:"price"`
+	Available    bool    `json:"available"`
+	ETag         string  `json:"etag"`
+}
+
+// posMenu è un menu modificato dall'ultimo cursore; i menu nel cestino hanno solo ID e
+// deleted_at
+type posMenu struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name,omitempty"`
+	IsActive   bool       `json:"is_active"`
+	IsArchived bool       `json:"is_archived,omitempty"`
+	Deleted    bool       `json:"deleted,omitempty"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ETag       string     `json:"etag,omitempty"`
+	Items      []posItem  `json:"items,omitempty"`
+}
+
+// errPosSyncBusy indica che il menu è stato modificato da altre richieste a ogni tentativo
+var errPosSyncBusy = errors.New("menu modificato da un'altra richiesta, riprova")
+
+// posItemUpdate è un aggiornamento della cassa; i campi assenti restano invariati. Senza
+// etag l'aggiornamento si applica comunque
+type posItemUpdate struct {
+	ItemID    string   `json:"item_id"`
+	ETag      string   `json:"etag"`
+	Price     *float64 `json:"price"`
+	Available *bool    `json:"available"`
+}
+
+// posConflict è un aggiornamento non applicato, con i valori attuali del piatto
+type posConflict struct {
+	ItemID  string   `json:"item_id"`
+	Reason  string   `json:"reason"`
+	Current *posItem `json:"current,omitempty"`
+}
+
+// posSyncResult è l'esito di un invio della cassa
+type posSyncResult struct {
+	ETag        string        `json:"etag"`
+	Applied     []posItem     `json:"applied"`
+	Overwritten []string      `json:"overwritten,omitempty"` // Piatti in conflitto sovrascritti
+	Conflicts   []posConflict `json:"conflicts"`
+}
+
+// posItemETag calcola l'ETag di un piatto dai campi che la cassa legge e modifica
+func posItemETag(item *models.MenuItem) string {
+	return contentETag([]byte(fmt.Sprintf("%s|%s|%g|%t", item.ID, item.Name, item.Price, item.Available)))
+}
+
+// posMenuETag calcola l'ETag di un menu dalla sua ultima modifica
+func posMenuETag(menu *models.Menu) string {
+	return `"` + strconv.FormatInt(menu.UpdatedAt.UnixMilli(), 36) + `"`
+}
+
+// newPosItem converte il piatto nella forma letta dalla cassa
+func newPosItem(category *models.MenuCategory, item *models.MenuItem) posItem {
+	return posItem{
+		ID:           item.ID,
+		CategoryID:   category.ID,
+		CategoryName: category.Name,
+		Name:         item.Name,
+		Price:        item.Price,
+		Available:    item.Available,
+		ETag:         posItemETag(item),
+	}
+}
+
+// newPosMenu converte il menu nella forma letta dalla cassa
+func newPosMenu(menu *models.Menu) posMenu {
+	if !menu.DeletedAt.IsZero() {
+		deletedAt := menu.DeletedAt
+		return posMenu{ID: menu.ID, Deleted: true, DeletedAt: &deletedAt, UpdatedAt: menu.UpdatedAt}
+	}
+	out := posMenu{
+		ID:         menu.ID,
+		Name:       menu.Name,
+		IsActive:   menu.IsActive,
+		IsArchived: menu.IsArchived,
+		UpdatedAt:  menu.UpdatedAt,
+		ETag:       posMenuETag(menu),
+		Items:      []posItem{},
+	}
+	for ci := range menu.Categories {
+		category := &menu.Categories[ci]
+		for ii := range category.Items {
+			out.Items = append(out.Items, newPosItem(category, &category.Items[ii]))
+		}
+	}
+	return out
+}
+
+// parsePosCursor legge il cursore restituito dalla lettura precedente; vuoto legge tutti i menu
+func parsePosCursor(cursor string) (time.Time, error) {
+	if cursor == "" {
+		return time.Time{}, nil
+	}
+	ms, err := strconv.ParseInt(cursor, 36, 64)
+	if err != nil || ms < 0 {
+		return time.Time{}, fmt.Errorf("cursore non valido")
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// formatPosCursor restituisce il cursore per la lettura successiva a now
+func formatPosCursor(now time.Time) string {
+	return strconv.FormatInt(now.Add(-posSyncCursorLag).UnixMilli(), 36)
+}
+
+// validatePosUpdates controlla gli aggiornamenti inviati dalla cassa. Ogni piatto può comparire
+// una sola volta: due aggiornamenti dello stesso piatto nello stesso invio risulterebbero in
+// conflitto tra loro, perché il primo cambia l'ETag atteso dal secondo
+func validatePosUpdates(updates []posItemUpdate) error {
+	if len(updates) == 0 || len(updates) > posSyncMaxUpdates {
+		return fmt.Errorf("Indicare da 1 a %d aggiornamenti", posSyncMaxUpdates)
+	}
+	seen := make(map[string]bool, len(updates))
+	for _, update := range updates {
+		if update.ItemID == "" {
+			return errors.New("item_id è obbligatorio")
+		}
+		if seen[update.ItemID] {
+			return fmt.Errorf("item_id %s ripetuto: inviare un solo aggiornamento per piatto", update.ItemID)
+		}
+		seen[update.ItemID] = true
+		if update.Price != nil && *update.Price < 0 {
+			return errors.New("Il prezzo non può essere negativo")
+		}
+	}
+	return nil
+}
+
+// applyPosUpdates applica gli aggiornamenti della cassa al menu e restituisce l'esito.
+// Con la strategia reject i piatti modificati dopo la lettura della cassa restano invariati
+func applyPosUpdates(menu *models.Menu, updates []posItemUpdate, onConflict string) posSyncResult {
+	result := posSyncResult{Applied: []posItem{}, Conflicts: []posConflict{}}
+	for _, update := range updates {
+		var category *models.MenuCategory
+		var item *models.MenuItem
+		for ci := range menu.Categories {
+			for ii := range menu.Categories[ci].Items {
+				if menu.Categories[ci].Items[ii].ID == update.ItemID {
+					category, item = &menu.Categories[ci], &menu.Categories[ci].Items[ii]
+				}
+			}
+		}
+		if item == nil {
+			result.Conflicts = append(result.Conflicts, posConflict{ItemID: update.ItemID, Reason: posConflictNotFound})
+			continue
+		}
+		if update.ETag != "" && update.ETag != posItemETag(item) {
+			if onConflict != posConflictOverwrite {
+				current := newPosItem(category, item)
+				result.Conflicts = append(result.Conflicts, posConflict{ItemID: item.ID, Reason: posConflictModified, Current: &current})
+				continue
+			}
+			result.Overwritten = append(result.Overwritten, item.ID)
+		}
+		if update.Price != nil {
+			item.Price = *update.Price
+		}
+		if update.Available != nil {
+			item.Available = *update.Available
+		}
+		result.Applied = append(result.Applied, newPosItem(category, item))
+	}
+	return result
+}
+
+// syncPosMenu applica gli aggiornamenti al menu restituito da load e lo salva con save, che
+// restituisce false se il menu è cambiato dopo la lettura: in quel caso rilegge il menu e
+// riapplica gli aggiornamenti, fino a posSyncAttempts volte. Se load restituisce nil (menu
+// non trovato, risposta già inviata) restituisce un menu nil senza errore
+func syncPosMenu(load func() *models.Menu, save func(menu *models.Menu, readAt time.Time) (bool, error), updates []posItemUpdate, onConflict string) (*models.Menu, posSyncResult, error) {
+	for attempt := 0; attempt < posSyncAttempts; attempt++ {
+		menu := load()
+		if menu == nil {
+			return nil, posSyncResult{}, nil
+		}
+		result := applyPosUpdates(menu, updates, onConflict)
+		if len(result.Applied) > 0 {
+			readAt := menu.UpdatedAt
+			menu.UpdatedAt = time.Now()
+			saved, err := save(menu, readAt)
+			if err != nil {
+				return nil, posSyncResult{}, err
+			}
+			if !saved {
+				continue
+			}
+		}
+		result.ETag = posMenuETag(menu)
+		return menu, result, nil
+	}
+	return nil, posSyncResult{}, errPosSyncBusy
+}
+
+// PosChangesHandler restituisce i menu modificati dopo il cursore, con i piatti e i loro ETag
+// (GET /api/v1/pos/changes?cursor=...). Senza cursore restituisce tutti i menu; il cursore
+// della risposta va passato alla lettura successiva
+func PosChangesHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	since, err := parsePosCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		httputil.BadRequest(w, "Cursore non valido")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	menus, err := db.MongoInstance.GetMenusChangedSince(ctx, restaurant.ID, since)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei menu")
+		return
+	}
+	changes := make([]posMenu, 0, len(menus))
+	for _, menu := range menus {
+		changes = append(changes, newPosMenu(menu))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Modifiche ai menu", map[string]interface{}{
+		"cursor": formatPosCursor(now),
+		"menus":  changes,
+	})
+}
+
+// PosPushHandler applica prezzi e disponibilità inviati dalla cassa ai piatti del menu
+// (POST /api/v1/pos/menus/{id}/items). Risponde con i piatti aggiornati e i conflitti: con
+// on_conflict "overwrite" la cassa sovrascrive anche i piatti modificati dopo la sua lettura.
+// Un item_id ripetuto nello stesso invio risponde 400
+func PosPushHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req struct {
+		OnConflict string          `json:"on_conflict"`
+		Updates    []posItemUpdate `json:"updates"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if req.OnConflict == "" {
+		req.OnConflict = posConflictReject
+	}
+	if req.OnConflict != posConflictReject && req.OnConflict != posConflictOverwrite {
+		httputil.BadRequest(w, "on_conflict deve essere reject o overwrite")
+		return
+	}
+	if err := validatePosUpdates(req.Updates); err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	load := func() *models.Menu {
+		menu := loadMenuV2(ctx, w, r)
+		if menu == nil || rejectArchivedMenuV2(w, menu) {
+			return nil
+		}
+		return menu
+	}
+	save := func(menu *models.Menu, readAt time.Time) (bool, error) {
+		return db.MongoInstance.UpdateMenuIfUnchanged(ctx, menu, readAt)
+	}
+	menu, result, err := syncPosMenu(load, save, req.Updates, req.OnConflict)
+	switch {
+	case errors.Is(err, errPosSyncBusy):
+		httputil.Conflict(w, "Menu modificato da un'altra richiesta, riprova")
+		return
+	case err != nil:
+		respondMenuV2Error(w, r, err, "Errore nell'aggiornamento del menu")
+		return
+	case menu == nil:
+		return
+	}
+	for _, applied := range result.Applied {
+		if item := locateMenuItem(menu, applied.ID); item != nil {
+			publishItemEvent(r, menu, item, "updated")
+		}
+	}
+	w.Header().Set("ETag", result.ETag)
+	httputil.Success(w, "Sincronizzazione completata", result)
+}
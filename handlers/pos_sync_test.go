@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"qr-menu/models"
+)
+
+// posTestMenu builds a menu with Margherita (i1) and Diavola (i2)
+func posTestMenu(updatedAt time.Time, margherita, diavola float64) *models.Menu {
+	return &models.Menu{
+		ID:        "m1",
+		UpdatedAt: updatedAt,
+		Categories: []models.MenuCategory{{
+			ID:   "c1",
+			Name: "Pizze",
+			Items: []models.MenuItem{
+				{ID: "i1", Name: "Margherita", Price: margherita, Available: true},
+				{ID: "i2", Name: "Diavola", Price: diavola, Available: true},
+			},
+		}},
+	}
+}
+
+func posPrice(price float64) *float64 { return &price }
+
+func TestValidatePosUpdates(t *testing.T) {
+	tests := []struct {
+		name    string
+		updates []posItemUpdate
+		err     string
+	}{
+		{"valid", []posItemUpdate{{ItemID: "i1", Price: posPrice(9)}, {ItemID: "i2"}}, ""},
+		{"empty", nil, "Indicare da 1 a"},
+		{"too many", make([]posItemUpdate, posSyncMaxUpdates+1), "Indicare da 1 a"},
+		{"missing item_id", []posItemUpdate{{Price: posPrice(9)}}, "item_id è obbligatorio"},
+		{"negative price", []posItemUpdate{{ItemID: "i1", Price: posPrice(-1)}}, "negativo"},
+		{"duplicate item_id", []posItemUpdate{{ItemID: "i1", Price: posPrice(9)}, {ItemID: "i2"}, {ItemID: "i1", Price: posPrice(10)}}, "item_id i1 ripetuto"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePosUpdates(tt.updates)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+// TestApplyPosUpdates tests the ETag check of every update against the item as read from the menu
+func TestApplyPosUpdates(t *testing.T) {
+	read := posTestMenu(time.Now(), 8, 9)
+	etag := posItemETag(&read.Categories[0].Items[0])
+	stale := posItemETag(&posTestMenu(time.Now(), 7, 9).Categories[0].Items[0])
+
+	tests := []struct {
+		name        string
+		onConflict  string
+		update      posItemUpdate
+		price       float64 // Price of i1 after the update
+		applied     bool
+		overwritten []string
+		conflict    string
+	}{
+		{"without etag", posConflictReject, posItemUpdate{ItemID: "i1", Price: posPrice(10)}, 10, true, nil, ""},
+		{"current etag", posConflictReject, posItemUpdate{ItemID: "i1", ETag: etag, Price: posPrice(10)}, 10, true, nil, ""},
+		{"stale etag rejected", posConflictReject, posItemUpdate{ItemID: "i1", ETag: stale, Price: posPrice(10)}, 8, false, nil, posConflictModified},
+		{"stale etag overwritten", posConflictOverwrite, posItemUpdate{ItemID: "i1", ETag: stale, Price: posPrice(10)}, 10, true, []string{"i1"}, ""},
+		{"unknown item", posConflictReject, posItemUpdate{ItemID: "i9", Price: posPrice(10)}, 8, false, nil, posConflictNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			menu := posTestMenu(time.Now(), 8, 9)
+			result := applyPosUpdates(menu, []posItemUpdate{tt.update}, tt.onConflict)
+
+			if price := menu.Categories[0].Items[0].Price; price != tt.price {
+				t.Fatalf("Expected price %v, got %v", tt.price, price)
+			}
+			if applied := len(result.Applied) == 1; applied != tt.applied {
+				t.Fatalf("Expected applied %v, got %+v", tt.applied, result.Applied)
+			}
+			if tt.applied && result.Applied[0].ETag != posItemETag(&menu.Categories[0].Items[0]) {
+				t.Fatalf("Expected the new etag of the item, got %q", result.Applied[0].ETag)
+			}
+			if !reflect.DeepEqual(result.Overwritten, tt.overwritten) {
+				t.Fatalf("Expected overwritten %v, got %v", tt.overwritten, result.Overwritten)
+			}
+			if tt.conflict == "" {
+				if len(result.Conflicts) != 0 {
+					t.Fatalf("Expected no conflicts, got %+v", result.Conflicts)
+				}
+				return
+			}
+			if len(result.Conflicts) != 1 || result.Conflicts[0].Reason != tt.conflict {
+				t.Fatalf("Expected a %s conflict, got %+v", tt.conflict, result.Conflicts)
+			}
+			if tt.conflict == posConflictModified && (result.Conflicts[0].Current == nil || result.Conflicts[0].Current.ETag != etag) {
+				t.Fatalf("Expected the current item in the conflict, got %+v", result.Conflicts[0].Current)
+			}
+		})
+	}
+}
+
+// posMenuStore is the saved menu for syncPosMenu: save succeeds only if the menu has not
+// changed since it was read, like UpdateMenuIfUnchanged
+type posMenuStore struct {
+	margherita, diavola float64
+	updatedAt           time.Time
+	loads, saves        int
+
+	// changes are applied by other requests, one at each save, just before it
+	changes []func(s *posMenuStore)
+	err     error
+}
+
+func (s *posMenuStore) load() *models.Menu {
+	s.loads++
+	return posTestMenu(s.updatedAt, s.margherita, s.diavola)
+}
+
+func (s *posMenuStore) save(menu *models.Menu, readAt time.Time) (bool, error) {
+	s.saves++
+	if s.err != nil {
+		return false, s.err
+	}
+	if len(s.changes) > 0 {
+		s.changes[0](s)
+		s.changes = s.changes[1:]
+		s.updatedAt = s.updatedAt.Add(time.Second)
+	}
+	if !readAt.Equal(s.updatedAt) {
+		return false, nil
+	}
+	s.margherita = locateMenuItem(menu, "i1").Price
+	s.diavola = locateMenuItem(menu, "i2").Price
+	s.updatedAt = menu.UpdatedAt
+	return true, nil
+}
+
+// TestSyncPosMenu tests the retries when the menu is changed by another request between the
+// read and the save
+func TestSyncPosMenu(t *testing.T) {
+	read := posTestMenu(time.Time{}, 8, 9)
+	etag := posItemETag(&read.Categories[0].Items[0])
+	changeMargherita := func(s *posMenuStore) { s.margherita = 8.5 }
+	changeDiavola := func(s *posMenuStore) { s.diavola = 9.5 }
+	failure := errors.New("connection reset")
+
+	tests := []struct {
+		name       string
+		onConflict string
+		update     posItemUpdate
+		changes    []func(s *posMenuStore)
+		err        error
+		loads      int
+		saves      int
+		margherita float64 // Saved price of i1
+		conflict   bool
+	}{
+		{"saved at first attempt", posConflictReject, posItemUpdate{ItemID: "i1", ETag: etag, Price: posPrice(10)}, nil, nil, 1, 1, 10, false},
+		{"retried after a change to another item", posConflictReject, posItemUpdate{ItemID: "i1", ETag: etag, Price: posPrice(10)},
+			[]func(s *posMenuStore){changeDiavola}, nil, 2, 2, 10, false},
+		{"retry finds the item changed", posConflictReject, posItemUpdate{ItemID: "i1", ETag: etag, Price: posPrice(10)},
+			[]func(s *posMenuStore){changeMargherita}, nil, 2, 1, 8.5, true},
+		{"retry overwrites the changed item", posConflictOverwrite, posItemUpdate{ItemID: "i1", ETag: etag, Price: posPrice(10)},
+			[]func(s *posMenuStore){changeMargherita}, nil, 2, 2, 10, false},
+		{"gives up", posConflictReject, posItemUpdate{ItemID: "i1", Price: posPrice(10)},
+			[]func(s *posMenuStore){changeDiavola, changeDiavola, changeDiavola, changeDiavola, changeDiavola}, errPosSyncBusy, posSyncAttempts, posSyncAttempts, 8, false},
+		{"save error", posConflictReject, posItemUpdate{ItemID: "i1", Price: posPrice(10)}, nil, failure, 1, 1, 8, false},
+		{"nothing to save", posConflictReject, posItemUpdate{ItemID: "i9", Price: posPrice(10)}, nil, nil, 1, 0, 8, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &posMenuStore{margherita: 8, diavola: 9, changes: tt.changes}
+			if tt.err == failure {
+				store.err = failure
+			}
+			menu, result, err := syncPosMenu(store.load, store.save, []posItemUpdate{tt.update}, tt.onConflict)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if store.loads != tt.loads || store.saves != tt.saves {
+				t.Fatalf("Expected %d loads and %d saves, got %d and %d", tt.loads, tt.saves, store.loads, store.saves)
+			}
+			if store.margherita != tt.margherita {
+				t.Fatalf("Expected saved price %v, got %v", tt.margherita, store.margherita)
+			}
+			if tt.err != nil {
+				return
+			}
+			if result.ETag != posMenuETag(menu) {
+				t.Fatalf("Expected the etag of the returned menu, got %q", result.ETag)
+			}
+			if conflict := len(result.Conflicts) > 0; conflict != tt.conflict {
+				t.Fatalf("Expected conflict %v, got %+v", tt.conflict, result.Conflicts)
+			}
+		})
+	}
+}
+
+// TestSyncPosMenuNotFound tests that a menu not found stops the sync without error
+func TestSyncPosMenuNotFound(t *testing.T) {
+	saves := 0
+	menu, _, err := syncPosMenu(func() *models.Menu { return nil }, func(*models.Menu, time.Time) (bool, error) {
+		saves++
+		return true, nil
+	}, []posItemUpdate{{ItemID: "i1"}}, posConflictReject)
+	if menu != nil || err != nil || saves != 0 {
+		t.Fatalf("Expected nothing saved, got %v, %v after %d saves", menu, err, saves)
+	}
+}
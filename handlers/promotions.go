@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+)
+
+const (
+	// promotionCheckInterval è ogni quanto il worker controlla le promozioni che iniziano o
+	// finiscono: è anche il ritardo massimo con cui compaiono e spariscono dal menu pubblico
+	promotionCheckInterval = time.Minute
+	// promotionCatchUp è quanto indietro guarda il worker al primo giro, per le promozioni
+	// iniziate o finite mentre l'applicazione era ferma
+	promotionCatchUp = 24 * time.Hour
+	// maxPromotionTitle è la lunghezza massima del titolo di una promozione, in caratteri
+	maxPromotionTitle = 100
+)
+
+var promotionQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     200,
+	DefaultSort:    "-starts_at",
+	Sortable:       []string{"starts_at", "ends_at", "created_at"},
+	Filterable:     []string{"active"},
+}
+
+// promotionRequest è il corpo di creazione e modifica di una promozione
+type promotionRequest struct {
+	Title      string    `json:"title"`
+	BannerText string    `json:"banner_text"`
+	ItemIDs    []string  `json:"item_ids"`
+	StartsAt   time.Time `json:"starts_at"`
+	EndsAt     time.Time `json:"ends_at"`
+	Enabled    *bool     `json:"enabled"` // Se omesso resta com'è (attiva alla creazione)
+}
+
+// applyPromotionRequest legge e valida il corpo della richiesta e lo applica alla promozione.
+// I piatti devono essere nei menu del ristorante. Cambiando il periodo la promozione sarà
+// notificata di nuovo. Risponde con l'errore e restituisce false se la richiesta non è valida
+func applyPromotionRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, promotion *models.Promotion) bool {
+	var req promotionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido (date in formato RFC 3339)")
+		return false
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		httputil.BadRequest(w, "Il titolo è obbligatorio")
+		return false
+	}
+	if utf8.RuneCountInString(title) > maxPromotionTitle {
+		httputil.BadRequest(w, fmt.Sprintf("Il titolo può avere al massimo %d caratteri", maxPromotionTitle))
+		return false
+	}
+	banner := strings.TrimSpace(req.BannerText)
+	if utf8.RuneCountInString(banner) > models.MaxPromotionBanner {
+		httputil.BadRequest(w, fmt.Sprintf("Il testo del banner può avere al massimo %d caratteri", models.MaxPromotionBanner))
+		return false
+	}
+	if req.StartsAt.IsZero() || req.EndsAt.IsZero() {
+		httputil.BadRequest(w, "Inizio e fine della promozione sono obbligatori")
+		return false
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		httputil.BadRequest(w, "La fine della promozione deve essere successiva all'inizio")
+		return false
+	}
+
+	itemIDs := make([]string, 0, len(req.ItemIDs))
+	for _, id := range req.ItemIDs {
+		if id = strings.TrimSpace(id); id != "" && !containsString(itemIDs, id) {
+			itemIDs = append(itemIDs, id)
+		}
+	}
+	if len(itemIDs) > models.MaxPromotionItems {
+		httputil.BadRequest(w, fmt.Sprintf("Al massimo %d piatti per promozione", models.MaxPromotionItems))
+		return false
+	}
+	if len(itemIDs) > 0 {
+		menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, promotion.RestaurantID)
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nel recupero dei menu")
+			return false
+		}
+		for _, id := range itemIDs {
+			found := false
+			for _, menu := range menus {
+				if menu.DeletedAt.IsZero() && locateMenuItem(menu, id) != nil {
+					found = true
+					break
+				}
+			}
+			if !found {
+				httputil.BadRequest(w, "Piatto non trovato: "+id)
+				return false
+			}
+		}
+	}
+
+	startsAt, endsAt := req.StartsAt.UTC(), req.EndsAt.UTC()
+	if !startsAt.Equal(promotion.StartsAt) || !endsAt.Equal(promotion.EndsAt) {
+		promotion.NotifiedAt = nil
+	}
+	promotion.Title = title
+	promotion.BannerText = banner
+	promotion.ItemIDs = itemIDs
+	promotion.StartsAt = startsAt
+	promotion.EndsAt = endsAt
+	if req.Enabled != nil {
+		promotion.Enabled = *req.Enabled
+	}
+	return true
+}
+
+// refreshRestaurantPromotions ricalcola le promozioni attive salvate sul ristorante e
+// aggiorna i menu pubblici in cache
+func refreshRestaurantPromotions(ctx context.Context, restaurant *models.Restaurant, now time.Time) error {
+	active, _, err := db.MongoInstance.FindPromotions(ctx, db.PromotionFilter{
+		RestaurantID: restaurant.ID,
+		ActiveAt:     now,
+	}, db.ListOptions{Limit: models.MaxActivePromotions, Sort: []string{"starts_at"}})
+	if err != nil {
+		return err
+	}
+	promotions := make([]models.Promotion, 0, len(active))
+	for _, promotion := range active {
+		promotions = append(promotions, *promotion)
+	}
+	if len(promotions) == 0 && len(restaurant.Promotions) == 0 {
+		return nil
+	}
+	if err := db.MongoInstance.SetRestaurantPromotions(ctx, restaurant.ID, promotions); err != nil {
+		return err
+	}
+	restaurant.Promotions = promotions
+
+	if publicMenuCache != nil {
+		for _, menuID := range restaurant.DisplayMenuIDs() {
+			publicMenuCache.InvalidateKey(publicMenuCacheKey(menuID))
+		}
+		scheduleMenuWarmUp(restaurant.ID)
+	}
+	return nil
+}
+
+// savePromotion salva la promozione e aggiorna le promozioni attive del ristorante
+func savePromotion(ctx context.Context, restaurant *models.Restaurant, promotion *models.Promotion) error {
+	if err := db.MongoInstance.SavePromotion(ctx, promotion); err != nil {
+		return err
+	}
+	return refreshRestaurantPromotions(ctx, restaurant, time.Now())
+}
+
+// ListPromotionsHandler elenca le promozioni del ristorante, dalla più recente a iniziare
+// (GET /api/v1/promotions). ?filter[active]=true restituisce solo quelle visibili ora
+func ListPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	query, err := httputil.ParseListQuery(r, promotionQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	activeOnly, _, err := query.BoolFilter("active")
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	filter := db.PromotionFilter{RestaurantID: restaurant.ID}
+	if activeOnly {
+		filter.ActiveAt = time.Now()
+	}
+	promotions, total, err := db.MongoInstance.FindPromotions(ctx, filter, dbListOptions(query))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero delle promozioni")
+		return
+	}
+	httputil.List(w, promotions, query, total)
+}
+
+// GetPromotionHandler restituisce una promozione (GET /api/v1/promotions/{id})
+func GetPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	promotion, err := db.MongoInstance.GetPromotion(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero della promozione")
+		return
+	}
+	if promotion == nil {
+		httputil.NotFound(w, "Promozione")
+		return
+	}
+	httputil.Success(w, "Promozione", promotion)
+}
+
+// CreatePromotionHandler crea una promozione (POST /api/v1/promotions)
+func CreatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	promotion := &models.Promotion{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurant.ID,
+		Enabled:      true,
+		CreatedBy:    requestActorID(r),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if !applyPromotionRequest(ctx, w, r, promotion) {
+		return
+	}
+	if err := savePromotion(ctx, restaurant, promotion); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio della promozione")
+		return
+	}
+
+	RecordAuditLogAsync("PROMOTION_CREATED", "promotion", promotion.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Created(w, "Promozione creata", promotion)
+}
+
+// UpdatePromotionHandler modifica una promozione (PUT /api/v1/promotions/{id})
+func UpdatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	promotion, err := db.MongoInstance.GetPromotion(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero della promozione")
+		return
+	}
+	if promotion == nil {
+		httputil.NotFound(w, "Promozione")
+		return
+	}
+	if !applyPromotionRequest(ctx, w, r, promotion) {
+		return
+	}
+	promotion.UpdatedAt = time.Now()
+	if err := savePromotion(ctx, restaurant, promotion); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio della promozione")
+		return
+	}
+
+	RecordAuditLogAsync("PROMOTION_UPDATED", "promotion", promotion.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Promozione aggiornata", promotion)
+}
+
+// DeletePromotionHandler elimina una promozione (DELETE /api/v1/promotions/{id}); se era
+// attiva sparisce subito dal menu pubblico
+func DeletePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	deleted, err := db.MongoInstance.DeletePromotion(ctx, id, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'eliminazione della promozione")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "Promozione")
+		return
+	}
+	if err := refreshRestaurantPromotions(ctx, restaurant, time.Now()); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'aggiornamento delle promozioni attive")
+		return
+	}
+
+	RecordAuditLogAsync("PROMOTION_DELETED", "promotion", id, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// ProcessPromotions aggiorna le promozioni attive dei ristoranti con promozioni iniziate o
+// finite dopo from e pubblica promotion.active per quelle appena iniziate. Restituisce i
+// ristoranti aggiornati e le promozioni notificate
+func ProcessPromotions(ctx context.Context, from, now time.Time) (refreshed, notified int, err error) {
+	restaurantIDs, err := db.MongoInstance.GetPromotionRestaurantsChanged(ctx, from, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, id := range restaurantIDs {
+		if ctx.Err() != nil {
+			return refreshed, notified, ctx.Err()
+		}
+		restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, id)
+		if err != nil {
+			return refreshed, notified, err
+		}
+		if restaurant == nil {
+			continue
+		}
+		if err := refreshRestaurantPromotions(ctx, restaurant, now); err != nil {
+			return refreshed, notified, err
+		}
+		refreshed++
+	}
+
+	promotions, err := db.MongoInstance.GetPromotionsToNotify(ctx, now)
+	if err != nil {
+		return refreshed, notified, err
+	}
+	for _, promotion := range promotions {
+		marked, err := db.MongoInstance.MarkPromotionNotified(ctx, promotion.ID, now)
+		if err != nil {
+			return refreshed, notified, err
+		}
+		if !marked {
+			continue
+		}
+		notified++
+		eventBus.Publish(events.Event{
+			Type:         events.PromotionActive,
+			RestaurantID: promotion.RestaurantID,
+			Data: map[string]interface{}{
+				"promotion_id": promotion.ID,
+				"title":        promotion.Title,
+				"banner_text":  promotion.BannerText,
+				"item_ids":     promotion.ItemIDs,
+				"starts_at":    promotion.StartsAt,
+				"ends_at":      promotion.EndsAt,
+			},
+		})
+	}
+	return refreshed, notified, nil
+}
+
+// RunPromotionWorker mostra e nasconde le promozioni nel menu pubblico all'inizio e alla fine
+// del periodo di validità e ne avvisa i proprietari, all'avvio e poi ogni
+// promotionCheckInterval, finché ctx non viene annullato. È bloccante: va avviato in una goroutine
+func RunPromotionWorker(ctx context.Context) {
+	from := time.Now().Add(-promotionCatchUp)
+	run := func() {
+		runCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		defer cancel()
+		now := time.Now()
+		refreshed, notified, err := ProcessPromotions(runCtx, from, now)
+		if err != nil {
+			logger.Error("Errore nell'aggiornamento delle promozioni", map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		from = now
+		if refreshed > 0 || notified > 0 {
+			logger.Info("Promozioni aggiornate", map[string]interface{}{
+				"restaurants": refreshed,
+				"notified":    notified,
+			})
+		}
+	}
+
+	run()
+
+	ticker := time.NewTicker(promotionCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
+
+// notifyPromotionActive avvisa il proprietario che una promozione è comparsa nel menu pubblico
+func notifyPromotionActive(ctx context.Context, event events.Event) error {
+	if db.MongoInstance == nil || event.RestaurantID == "" {
+		return nil
+	}
+	promotionID, _ := event.Data["promotion_id"].(string)
+	promotion, err := db.MongoInstance.GetPromotion(ctx, promotionID, event.RestaurantID)
+	if err != nil || promotion == nil {
+		return err
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, event.RestaurantID)
+	if err != nil || restaurant == nil || restaurant.OwnerID == "" {
+		return err
+	}
+	owner, err := db.MongoInstance.GetUserByID(ctx, restaurant.OwnerID)
+	if err != nil || owner == nil || !owner.IsActive {
+		return err
+	}
+	return notifyOwner(ctx, owner, i18n.KeyPromotionActive, map[string]interface{}{
+		"RestaurantName": restaurant.Name,
+		"Title":          promotion.Title,
+		"StartsAt":       promotion.StartsAt,
+		"EndsAt":         promotion.EndsAt,
+		"AdminURL":       configuredBaseURL + "/admin",
+	})
+}
+
+// featuredPromotion è una promozione nella sezione "In evidenza" del menu pubblico, con i
+// piatti collegati disponibili nei menu mostrati
+type featuredPromotion struct {
+	ID         string
+	Title      string
+	BannerText string
+	EndsAt     time.Time
+	Items      []models.MenuItem
+}
+
+// featuredPromotions restituisce le promozioni del ristorante visibili a now. I piatti sono
+// presi dai menu mostrati, così prezzi e disponibilità sono quelli correnti; i piatti non
+// disponibili o di altri menu sono omessi
+func featuredPromotions(restaurant *models.Restaurant, menus []*models.Menu, now time.Time) []featuredPromotion {
+	if restaurant == nil {
+		return nil
+	}
+	var featured []featuredPromotion
+	for i := range restaurant.Promotions {
+		promotion := &restaurant.Promotions[i]
+		if !promotion.ActiveAt(now) {
+			continue
+		}
+		out := featuredPromotion{
+			ID:         promotion.ID,
+			Title:      promotion.Title,
+			BannerText: promotion.BannerText,
+			EndsAt:     promotion.EndsAt,
+		}
+		for _, id := range promotion.ItemIDs {
+			for _, menu := range menus {
+				if item := locateMenuItem(menu, id); item != nil {
+					if item.Available {
+						out.Items = append(out.Items, *item)
+					}
+					break
+				}
+			}
+		}
+		featured = append(featured, out)
+	}
+	return featured
+}
+
+// Promotions restituisce le promozioni della sezione "In evidenza" della pagina
+func (d publicMenuData) Promotions() []featuredPromotion {
+	menus := d.Menus
+	if d.Menu != nil {
+		menus = []*models.Menu{d.Menu}
+	}
+	return featuredPromotions(d.Restaurant, menus, time.Now())
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+	"qr-menu/pkg/metrics"
+	"qr-menu/pkg/push"
+)
+
+// pushSender invia le notifiche push ai dispositivi dei proprietari; nil se FCM non è configurato
+var pushSender push.Sender
+
+// webPushSender invia le notifiche ai browser che hanno attivato le notifiche dall'admin PWA;
+// nil se le chiavi VAPID non sono configurate
+var webPushSender *push.WebPush
+
+var pushDeliveries = metrics.NewCounter("qrmenu_push_notifications_total",
+	"Push notifications by result (sent, failed or unregistered).", "result")
+
+// SetPushSender imposta il client FCM usato per le notifiche push
+func SetPushSender(sender push.Sender) {
+	pushSender = sender
+}
+
+// SetWebPushSender imposta il client Web Push (VAPID) usato per le notifiche ai browser
+func SetWebPushSender(sender *push.WebPush) {
+	webPushSender = sender
+}
+
+// pushToUser invia la notifica a tutti i dispositivi (app via FCM e browser via Web Push)
+// dell'utente, elimina quelli che il servizio push non riconosce più e registra l'esito di
+// ogni invio nello storico
+func pushToUser(ctx context.Context, userID, locale, key string, data map[string]interface{}) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var tokens []*models.PushToken
+	var subs []*models.WebPushSubscription
+	var err error
+	if pushSender != nil {
+		if tokens, err = db.MongoInstance.GetPushTokensByUserID(ctx, userID); err != nil {
+			return
+		}
+	}
+	if webPushSender != nil {
+		if subs, err = db.MongoInstance.GetWebPushSubscriptionsByUserID(ctx, userID); err != nil {
+			return
+		}
+	}
+	if len(tokens) == 0 && len(subs) == 0 {
+		return
+	}
+
+	msg, err := i18n.Default().Render(locale, key, data)
+	if err != nil {
+		logger.ErrorCtx(ctx, "Errore nella localizzazione della notifica push", map[string]interface{}{
+			"error": err.Error(),
+			"key":   key,
+		})
+		return
+	}
+	notification := push.Message{
+		Title: msg.Subject,
+		Body:  truncateRunes(msg.Body, 240),
+		Data:  map[string]string{"key": key},
+	}
+
+	for _, token := range tokens {
+		notification.Token = token.ID
+		messageID, err := pushSender.Send(ctx, notification)
+		recordPush(ctx, userID, key, deviceLabel(token.ID), messageID, err, func() error {
+			return db.MongoInstance.DeletePushToken(ctx, token.ID, "")
+		})
+	}
+	for _, sub := range subs {
+		var subscription push.Subscription
+		subscription.Endpoint = sub.Endpoint
+		subscription.Keys.P256dh = sub.P256dh
+		subscription.Keys.Auth = sub.Auth
+		messageID, err := webPushSender.Send(ctx, subscription, notification)
+		recordPush(ctx, userID, key, "web "+endpointHost(sub.Endpoint), messageID, err, func() error {
+			return db.MongoInstance.DeleteWebPushSubscription(ctx, sub.ID, "")
+		})
+	}
+}
+
+// recordPush registra nello storico l'esito dell'invio a un dispositivo, eliminandolo con
+// prune se il servizio push lo ha dichiarato non più valido
+func recordPush(ctx context.Context, userID, key, device, messageID string, err error, prune func() error) {
+	receipt := &models.NotificationReceipt{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Channel:   models.ChannelPush,
+		Key:       key,
+		Device:    device,
+		Status:    models.PushStatusSent,
+		MessageID: messageID,
+		CreatedAt: time.Now(),
+	}
+	switch {
+	case errors.Is(err, push.ErrUnregistered):
+		receipt.Status = models.PushStatusUnregistered
+		receipt.Error = err.Error()
+		if err := prune(); err != nil {
+			logger.WarnCtx(ctx, "Errore nell'eliminazione del dispositivo push non valido", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	case err != nil:
+		receipt.Status = models.PushStatusFailed
+		receipt.Error = err.Error()
+		logger.WarnCtx(ctx, "Invio notifica push fallito", map[string]interface{}{
+			"error":   err.Error(),
+			"user_id": userID,
+			"device":  device,
+		})
+	}
+	pushDeliveries.Inc(receipt.Status)
+
+	if err := db.MongoInstance.RecordNotificationReceipt(ctx, receipt); err != nil {
+		logger.WarnCtx(ctx, "Errore nel salvataggio dello storico notifiche", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// endpointHost restituisce il servizio push del browser (es. fcm.googleapis.com), senza
+// esporre l'URL della sottoscrizione
+func endpointHost(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+// deviceLabel restituisce gli ultimi caratteri del token, sufficienti a riconoscere il dispositivo
+func deviceLabel(token string) string {
+	if len(token) <= 8 {
+		return token
+	}
+	return "…" + token[len(token)-8:]
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max-1]) + "…"
+}
+
+// RegisterPushTokenHandler registra il dispositivo dell'utente (POST /api/v1/push/tokens)
+// con body {"token": "...", "platform": "android|ios|web"}
+func RegisterPushTokenHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		Platform string `json:"platform"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" || len(req.Token) > 4096 {
+		httputil.BadRequest(w, "Specificare il token del dispositivo")
+		return
+	}
+	switch req.Platform {
+	case "", "android", "ios", "web":
+	default:
+		httputil.BadRequest(w, "Piattaforma non valida: android, ios o web")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	token := &models.PushToken{
+		ID:         req.Token,
+		UserID:     session.UserID,
+		Platform:   req.Platform,
+		CreatedAt:  now,
+		LastSeenAt: now,
+	}
+	if err := db.MongoInstance.SavePushToken(ctx, token); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella registrazione del dispositivo", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nella registrazione del dispositivo")
+		return
+	}
+	httputil.Created(w, "Dispositivo registrato", map[string]interface{}{
+		"device":       deviceLabel(token.ID),
+		"push_enabled": pushSender != nil,
+	})
+}
+
+// DeletePushTokenHandler rimuove un dispositivo dell'utente (DELETE /api/v1/push/tokens)
+// con body {"token": "..."}, ad esempio al logout dall'app
+func DeletePushTokenHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		httputil.BadRequest(w, "Specificare il token del dispositivo")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.DeletePushToken(ctx, req.Token, session.UserID); err != nil {
+		httputil.InternalServerError(w, "Errore nella rimozione del dispositivo")
+		return
+	}
+	httputil.NoContent(w)
+}
+
+// WebPushKeyHandler restituisce la chiave pubblica VAPID da passare a pushManager.subscribe
+// (GET /api/v1/push/vapid-public-key); 404 se le notifiche browser non sono configurate
+func WebPushKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if webPushSender == nil {
+		httputil.NotFound(w, "Notifiche browser")
+		return
+	}
+	httputil.Success(w, "", map[string]string{"public_key": webPushSender.PublicKey()})
+}
+
+// SubscribeWebPushHandler registra la sottoscrizione Web Push del browser per il ristorante
+// selezionato (POST /api/v1/push/subscriptions) con il body di PushSubscription.toJSON()
+func SubscribeWebPushHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSessionFromRequest(r)
+	if err != nil || session.RestaurantID == "" {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	var req push.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	endpoint, err := url.Parse(req.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" || internalHost(endpoint) ||
+		len(req.Endpoint) > 2048 || req.Keys.P256dh == "" || req.Keys.Auth == "" {
+		httputil.BadRequest(w, "Sottoscrizione push non valida")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sub := &models.WebPushSubscription{
+		ID:           hashVerificationToken(req.Endpoint),
+		UserID:       session.UserID,
+		RestaurantID: session.RestaurantID,
+		Endpoint:     req.Endpoint,
+		P256dh:       req.Keys.P256dh,
+		Auth:         req.Keys.Auth,
+		UserAgent:    truncateRunes(r.UserAgent(), 256),
+		CreatedAt:    time.Now(),
+	}
+	if err := db.MongoInstance.SaveWebPushSubscription(ctx, sub); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio della sottoscrizione push", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nell'attivazione delle notifiche")
+		return
+	}
+	httputil.Created(w, "Notifiche attivate", map[string]string{"id": sub.ID})
+}
+
+// UnsubscribeWebPushHandler rimuove la sottoscrizione del browser
+// (DELETE /api/v1/push/subscriptions) con body {"endpoint": "..."}
+func UnsubscribeWebPushHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	var req struct {
+		Endpoint string `json:"endpoint"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Endpoint == "" {
+		httputil.BadRequest(w, "Specificare l'endpoint della sottoscrizione")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.DeleteWebPushSubscription(ctx, hashVerificationToken(req.Endpoint), session.UserID); err != nil {
+		httputil.InternalServerError(w, "Errore nella disattivazione delle notifiche")
+		return
+	}
+	httputil.NoContent(w)
+}
+
+// notificationHistoryQuery descrive paginazione, ordinamento e filtri dello storico notifiche
+var notificationHistoryQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     200,
+	DefaultSort:    "-created_at",
+	Sortable:       []string{"created_at", "status", "key"},
+	Filterable:     []string{"channel", "status", "key"},
+}
+
+// NotificationHistoryHandler restituisce gli esiti delle notifiche push e SMS, dal più recente
+// (GET /api/v1/notifications/history?filter[channel]=&filter[status]=&filter[key]=&page=&per_page=&sort=)
+func NotificationHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+	query, err := httputil.ParseListQuery(r, notificationHistoryQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	receipts, total, err := db.MongoInstance.FindNotificationHistory(ctx, db.NotificationHistoryFilter{
+		UserID:  session.UserID,
+		Channel: query.Filter("channel"),
+		Status:  query.Filter("status"),
+		Key:     query.Filter("key"),
+	}, dbListOptions(query))
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero dello storico notifiche", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nel recupero dello storico notifiche")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, receipts, query, total)
+}
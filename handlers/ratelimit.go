@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"qr-menu/logger"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/security"
+)
+
+// groupLimiter conta le richieste dei gruppi di route; nil disattiva i limiti per gruppo
+var groupLimiter *security.RateLimiter
+
+// rateLimitGroups sono i limiti configurati per gruppo di route (api, auth, public, feedback)
+var rateLimitGroups map[string]security.RateLimitConfig
+
+// authenticatedGroups sono i gruppi registrati dopo l'autenticazione: le richieste sono
+// contate per API key o ristorante invece che per IP
+var authenticatedGroups = map[string]bool{"api": true}
+
+// SetRateLimits imposta il rate limiter e i limiti dei gruppi di route
+func SetRateLimits(limiter *security.RateLimiter, groups map[string]security.RateLimitConfig) {
+	groupLimiter = limiter
+	rateLimitGroups = groups
+}
+
+// rateLimitSubject identifica chi effettua la richiesta: il ristorante o l'utente della
+// sessione sulle route autenticate, altrimenti l'IP del client
+func rateLimitSubject(r *http.Request, authenticated bool) string {
+	if authenticated {
+		if session, err := getSessionFromRequest(r); err == nil && session != nil {
+			switch {
+			case session.RestaurantID != "":
+				return "restaurant:" + session.RestaurantID
+			default:
+				return "user:" + session.UserID
+			}
+		}
+	}
+	return "ip:" + security.ClientIP(r)
+}
+
+// RateLimit applica il limite del gruppo di route indicato. Sulle route autenticate va
+// applicato dopo RequireAuth o RequireAPIAccess: le richieste con una API key hanno già
+// consumato la quota della chiave (rate_limit), che prende il posto del limite del gruppo
+func RateLimit(group string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			config, ok := rateLimitGroups[group]
+			if groupLimiter == nil || !ok || (authenticatedGroups[group] && apiKeySession(r) != nil) {
+				next(w, r)
+				return
+			}
+
+			subject := rateLimitSubject(r, authenticatedGroups[group])
+			allowed, remaining := groupLimiter.Take(r.Context(), group+":"+subject, config)
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(config.BurstSize))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			if !allowed {
+				logger.WarnCtx(r.Context(), "Limite di richieste superato", map[string]interface{}{
+					"group":   group,
+					"subject": subject,
+					"path":    r.URL.Path,
+				})
+				w.Header().Set("Retry-After", strconv.Itoa(security.RetryAfter(config)))
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					httputil.ErrorMessage(w, http.StatusTooManyRequests, "Troppe richieste, riprova tra poco")
+				} else {
+					http.Error(w, "Troppe richieste, riprova tra poco", http.StatusTooManyRequests)
+				}
+				return
+			}
+			next(w, r)
+		}
+	}
+}
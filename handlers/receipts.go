@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/receipt"
+)
+
+// fiscalInfoRequest sono i dati fiscali inviati dall'API o dal form della contabilità
+type fiscalInfoRequest struct {
+	LegalName     string  `json:"legal_name"`
+	VATNumber     string  `json:"vat_number"`
+	TaxCode       string  `json:"tax_code"`
+	Address       string  `json:"address"`
+	VATRate       float64 `json:"vat_rate"`
+	ReceiptFooter string  `json:"receipt_footer"`
+}
+
+// fiscalInfo valida la richiesta e restituisce i dati fiscali da salvare
+func (req fiscalInfoRequest) fiscalInfo() (*models.FiscalInfo, error) {
+	info := &models.FiscalInfo{
+		LegalName:     strings.TrimSpace(req.LegalName),
+		VATNumber:     receipt.NormalizeVATNumber(req.VATNumber),
+		TaxCode:       strings.ToUpper(strings.TrimSpace(req.TaxCode)),
+		Address:       strings.TrimSpace(req.Address),
+		VATRate:       req.VATRate,
+		ReceiptFooter: strings.TrimSpace(req.ReceiptFooter),
+		UpdatedAt:     time.Now(),
+	}
+	if info.VATRate == 0 {
+		info.VATRate = models.DefaultVATRate
+	}
+	switch {
+	case info.LegalName == "" || len(info.LegalName) > 200:
+		return nil, fmt.Errorf("legal_name è obbligatoria (massimo 200 caratteri)")
+	case !receipt.ValidVATNumber(info.VATNumber):
+		return nil, fmt.Errorf("vat_number non è una partita IVA valida")
+	case len(info.TaxCode) > 16:
+		return nil, fmt.Errorf("tax_code non è un codice fiscale valido")
+	case info.Address == "" || len(info.Address) > 300:
+		return nil, fmt.Errorf("address è obbligatorio (massimo 300 caratteri)")
+	case info.VATRate < 0 || info.VATRate > 100:
+		return nil, fmt.Errorf("vat_rate deve essere una percentuale tra 0 e 100")
+	case len(info.ReceiptFooter) > 500:
+		return nil, fmt.Errorf("receipt_footer può contenere al massimo 500 caratteri")
+	}
+	return info, nil
+}
+
+// GetFiscalInfoHandler restituisce i dati fiscali del ristorante (GET /api/v1/fiscal/settings)
+func GetFiscalInfoHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	httputil.Success(w, "", map[string]interface{}{
+		"fiscal":           restaurant.Fiscal,
+		"default_vat_rate": models.DefaultVATRate,
+	})
+}
+
+// UpdateFiscalInfoHandler salva i dati fiscali stampati sulle ricevute (PUT
+// /api/v1/fiscal/settings con legal_name, vat_number, address e vat_rate)
+func UpdateFiscalInfoHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	var req fiscalInfoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	info, err := req.fiscalInfo()
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.SetRestaurantFiscalInfo(ctx, restaurant.ID, info); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio dei dati fiscali")
+		return
+	}
+	RecordAuditLogAsync("FISCAL_INFO_UPDATED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Dati fiscali salvati", map[string]interface{}{"fiscal": info})
+}
+
+// receiptSeller restituisce il ristorante come emittente di ricevute ed esportazioni
+func receiptSeller(restaurant *models.Restaurant) receipt.Seller {
+	seller := receipt.Seller{Name: restaurant.Name}
+	if fiscal := restaurant.Fiscal; fiscal != nil {
+		seller.LegalName = fiscal.LegalName
+		seller.VATNumber = fiscal.VATNumber
+		seller.TaxCode = fiscal.TaxCode
+		seller.Address = fiscal.Address
+	}
+	return seller
+}
+
+// receiptNumber è il numero della ricevuta: il giorno e il numero dello scontrino di cucina,
+// che riparte ogni giorno
+func receiptNumber(order *models.Order) string {
+	return order.CreatedAt.In(time.Local).Format("2006-01-02") + "/" + strconv.Itoa(order.Number)
+}
+
+// toCents converte un importo in euro in centesimi
+func toCents(amount float64) int64 {
+	if amount < 0 {
+		return int64(amount*100 - 0.5)
+	}
+	return int64(amount*100 + 0.5)
+}
+
+// orderOnlineCents restituisce quanto è stato pagato online per l'ordine, mance comprese, le
+// mance e i rimborsi, in centesimi
+func orderOnlineCents(order *models.Order) (paid, tips, refunded int64) {
+	for _, payment := range order.PaidPayments() {
+		paid += payment.AmountCents
+		tips += payment.TipCents
+		refunded += payment.RefundedCents
+	}
+	return paid, tips, refunded
+}
+
+// orderReceipt compone la ricevuta dell'ordine
+func orderReceipt(restaurant *models.Restaurant, order *models.Order) receipt.Receipt {
+	rcpt := receipt.Receipt{
+		Seller:       receiptSeller(restaurant),
+		Number:       receiptNumber(order),
+		IssuedAt:     order.CreatedAt.In(time.Local),
+		Table:        order.Table,
+		Currency:     "EUR",
+		VATRate:      restaurant.Fiscal.Rate(),
+		VoucherCents: toCents(order.VoucherPaid),
+	}
+	if restaurant.Fiscal != nil {
+		rcpt.Footer = restaurant.Fiscal.ReceiptFooter
+	}
+	if order.Payment != nil {
+		rcpt.Currency = order.Payment.Currency
+		rcpt.OnlineMethod = order.Payment.Provider
+	}
+	rcpt.OnlineCents, rcpt.TipCents, rcpt.RefundedCents = orderOnlineCents(order)
+	for _, line := range order.Lines {
+		rcpt.Lines = append(rcpt.Lines, receipt.Line{Name: line.Name, Quantity: line.Quantity, UnitCents: toCents(line.Price)})
+	}
+	return rcpt
+}
+
+// OrderReceiptHandler scarica la ricevuta dell'ordine in PDF, da stampare o inviare al cliente
+// (GET /api/v1/orders/{id}/receipt). Gli ordini annullati non hanno ricevuta
+func OrderReceiptHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	order, err := db.MongoInstance.GetOrder(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dell'ordine")
+		return
+	}
+	if order == nil {
+		httputil.NotFound(w, "Ordine")
+		return
+	}
+	if order.Status == models.OrderStatusCancelled {
+		httputil.Conflict(w, "L'ordine è annullato e non ha ricevuta")
+		return
+	}
+
+	var pdf bytes.Buffer
+	if err := receipt.WritePDF(&pdf, orderReceipt(restaurant, order)); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella generazione della ricevuta")
+		return
+	}
+	filename := "ricevuta-" + strings.ReplaceAll(receiptNumber(order), "/", "-") + ".pdf"
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(pdf.Bytes())
+}
+
+// orderExportEntry converte un ordine in una riga dell'esportazione
+func orderExportEntry(order *models.Order, vatRate float64) receipt.Entry {
+	entry := receipt.Entry{
+		Date:          order.CreatedAt.In(time.Local),
+		Number:        receiptNumber(order),
+		OrderID:       order.ID,
+		Table:         order.Table,
+		Status:        order.Status,
+		PaymentStatus: order.PaymentStatus,
+		TotalCents:    toCents(order.Total),
+		VATRate:       vatRate,
+		VoucherCents:  toCents(order.VoucherPaid),
+	}
+	if order.Payment != nil {
+		entry.PaymentMethod = order.Payment.Provider
+	}
+	entry.OnlineCents, entry.TipCents, entry.RefundedCents = orderOnlineCents(order)
+	return entry
+}
+
+// exportMonth interpreta il mese dell'esportazione (YYYY-MM, predefinito il mese precedente)
+// e restituisce inizio e fine del mese nel fuso orario del server, lo stesso della
+// numerazione degli ordini
+func exportMonth(param string, now time.Time) (time.Time, time.Time, error) {
+	if param == "" {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local).AddDate(0, -1, 0)
+		return start, start.AddDate(0, 1, 0), nil
+	}
+	start, err := time.ParseInLocation("2006-01", param, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("month deve essere nel formato YYYY-MM")
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// OrdersExportHandler esporta in streaming gli ordini completati di un mese per il
+// commercialista (GET /api/v1/orders/export?month=2026-10&format=csv|xml). Gli ordini annullati
+// non sono inclusi
+func OrdersExportHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "xml" {
+		httputil.BadRequest(w, "Formato non supportato: usare csv o xml")
+		return
+	}
+	start, end, err := exportMonth(r.URL.Query().Get("month"), time.Now())
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	streamOrdersExport(w, r, restaurant, start, end, format)
+}
+
+// streamOrdersExport scrive l'esportazione degli ordini completati tra start ed end
+func streamOrdersExport(w http.ResponseWriter, r *http.Request, restaurant *models.Restaurant, start, end time.Time, format string) {
+	period := start.Format("2006-01")
+	filename := fmt.Sprintf("ordini-%s.%s", period, format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	var writer receipt.ExportWriter
+	if format == "xml" {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		writer = receipt.NewXMLWriter(w, period, receiptSeller(restaurant))
+	} else {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer = receipt.NewCSVWriter(w)
+	}
+
+	// Nessun timeout breve: l'export può durare a lungo, si interrompe se il client chiude la connessione
+	ctx := r.Context()
+
+	vatRate := restaurant.Fiscal.Rate()
+	count := 0
+	filter := db.OrderFilter{
+		RestaurantID: restaurant.ID,
+		Statuses:     []string{models.OrderStatusCompleted},
+		Since:        start,
+		Until:        end,
+	}
+	err := db.MongoInstance.StreamOrders(ctx, filter, func(order *models.Order) error {
+		count++
+		return writer.Write(orderExportEntry(order, vatRate))
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		// Gli header sono già stati inviati: si può solo registrare l'interruzione
+		logger.ErrorCtx(r.Context(), "Export ordini interrotto", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+			"orders":        count,
+		})
+		return
+	}
+
+	RecordAuditLogAsync("ORDERS_EXPORTED", "order", period, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+}
+
+// AccountingPageHandler mostra la pagina della contabilità: esportazione mensile degli ordini
+// e dati fiscali delle ricevute (GET /admin/accounting)
+func AccountingPageHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+	renderAccountingPage(w, r, restaurant, restaurant.Fiscal, "")
+}
+
+// renderAccountingPage mostra la pagina della contabilità con i dati fiscali indicati e
+// l'eventuale errore di validazione del form
+func renderAccountingPage(w http.ResponseWriter, r *http.Request, restaurant *models.Restaurant, fiscal *models.FiscalInfo, formError string) {
+	if fiscal == nil {
+		fiscal = &models.FiscalInfo{VATRate: models.DefaultVATRate}
+	}
+	previous, _, _ := exportMonth("", time.Now())
+	data := struct {
+		Restaurant *models.Restaurant
+		Fiscal     *models.FiscalInfo
+		Month      string
+		Success    string
+		Error      string
+		CSRFToken  string
+	}{
+		Restaurant: restaurant,
+		Fiscal:     fiscal,
+		Month:      previous.Format("2006-01"),
+		Success:    r.URL.Query().Get("success"),
+		Error:      formError,
+		CSRFToken:  csrfToken(w, r),
+	}
+	if formError != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	renderTemplate(w, "accounting", data)
+}
+
+// AccountingExportHandler scarica l'esportazione del mese scelto nella pagina della
+// contabilità (GET /admin/accounting/export?month=2026-10&format=csv|xml)
+func AccountingExportHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "xml" {
+		format = "csv"
+	}
+	start, end, err := exportMonth(r.URL.Query().Get("month"), time.Now())
+	if err != nil {
+		http.Error(w, "Mese non valido", http.StatusBadRequest)
+		return
+	}
+	streamOrdersExport(w, r, restaurant, start, end, format)
+}
+
+// UpdateFiscalInfoFormHandler salva i dati fiscali dal form della pagina della contabilità
+// (POST /admin/accounting/fiscal)
+func UpdateFiscalInfoFormHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Form non valido", http.StatusBadRequest)
+		return
+	}
+	req := fiscalInfoRequest{
+		LegalName:     r.FormValue("legal_name"),
+		VATNumber:     r.FormValue("vat_number"),
+		TaxCode:       r.FormValue("tax_code"),
+		Address:       r.FormValue("address"),
+		ReceiptFooter: r.FormValue("receipt_footer"),
+	}
+	if rate := strings.TrimSpace(r.FormValue("vat_rate")); rate != "" {
+		if req.VATRate, err = strconv.ParseFloat(strings.Replace(rate, ",", ".", 1), 64); err != nil {
+			req.VATRate = -1
+		}
+	}
+	info, err := req.fiscalInfo()
+	if err != nil {
+		// Il form viene ripresentato con i dati inseriti
+		renderAccountingPage(w, r, restaurant, &models.FiscalInfo{
+			LegalName:     req.LegalName,
+			VATNumber:     req.VATNumber,
+			TaxCode:       req.TaxCode,
+			Address:       req.Address,
+			VATRate:       req.VATRate,
+			ReceiptFooter: req.ReceiptFooter,
+		}, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.SetRestaurantFiscalInfo(ctx, restaurant.ID, info); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio dei dati fiscali", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nel salvataggio dei dati fiscali", http.StatusInternalServerError)
+		return
+	}
+	RecordAuditLogAsync("FISCAL_INFO_UPDATED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/admin/accounting?success=fiscal", http.StatusSeeOther)
+}
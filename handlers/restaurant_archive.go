@@ -0,0 +1,666 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/avscan"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/imaging"
+	"qr-menu/pkg/storage"
+	"qr-menu/pkg/tenancy"
+
+	"github.com/google/uuid"
+)
+
+// Archivio portabile di un ristorante: scheda, menu (con le traduzioni) e immagini, per
+// spostare il ristorante tra istanze self-hosted o da staging a produzione. A differenza dei
+// backup per ristorante non contiene ID né URL dell'istanza di origine: all'import menu,
+// categorie, piatti e immagini ricevono nuovi ID e QR code e URL pubblici vengono rigenerati
+
+// restaurantArchiveFormat identifica la struttura dell'archivio, da incrementare se cambiano
+// i file o il loro contenuto
+const restaurantArchiveFormat = "qr-menu-restaurant/1"
+
+const (
+	restaurantArchiveMaxSize     = 256 << 20 // Dimensione massima dell'archivio da importare
+	restaurantArchiveMaxFileSize = 20 << 20  // Dimensione massima di ogni file estratto
+)
+
+// restaurantArchiveFiles è la cartella dell'archivio con i file del blob store. Nei menu e
+// nella scheda le immagini salvate con un percorso (non quelle con ImageID) sono riferite
+// come files/<chiave>
+const restaurantArchiveFiles = "files/"
+
+// restaurantArchiveManifest descrive l'archivio (manifest.json) ed elenca gli altri file
+type restaurantArchiveManifest struct {
+	Format       string    `json:"format"`
+	ExportedAt   time.Time `json:"exported_at"`
+	RestaurantID string    `json:"restaurant_id"`
+	Menus        int       `json:"menus"`
+	Files        []string  `json:"files"`
+}
+
+// restaurantArchiveProfile è la scheda del ristorante (restaurant.json). Username, dominio
+// personalizzato e proprietario appartengono all'istanza e non vengono esportati
+type restaurantArchiveProfile struct {
+	Name                  string   `json:"name"`
+	Description           string   `json:"description"`
+	Address               string   `json:"address"`
+	Phone                 string   `json:"phone"`
+	Logo                  string   `json:"logo,omitempty"`
+	ActiveMenuIDs         []string `json:"active_menu_ids,omitempty"`
+	PrivacyFirstAnalytics bool     `json:"privacy_first_analytics"`
+	ShowRatings           bool     `json:"show_ratings"`
+
+	NutritionDisplay models.NutritionDisplay `json:"nutrition_display"`
+	Loyalty          *models.LoyaltyProgram  `json:"loyalty,omitempty"` // Programma e premi; tessere e punti restano all'istanza
+}
+
+// restaurantArchive contiene i dati letti dal database prima di scrivere l'archivio
+type restaurantArchive struct {
+	ExportedAt   time.Time
+	RestaurantID string
+	Profile      restaurantArchiveProfile
+	Menus        []*models.Menu
+	BlobKeys     []string
+}
+
+// restaurantImportResult è la risposta dell'import
+type restaurantImportResult struct {
+	Menus       []string `json:"menus"`        // ID dei menu creati, nell'ordine dell'archivio
+	ActiveMenus []string `json:"active_menus"` // Menu attivati come nell'istanza di origine
+	Files       int      `json:"files"`        // File copiati nel blob store
+	PublicURL   string   `json:"public_url,omitempty"`
+	Warnings    []string `json:"warnings,omitempty"`
+}
+
+// RestaurantExportHandler scarica il ristorante in un archivio ZIP da importare in un'altra
+// istanza (GET /api/v1/restaurant/export): manifest.json, restaurant.json, menus.json e i file
+// sotto files/. Menu nel cestino, storico, statistiche e staff restano fuori
+func RestaurantExportHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurantID, ok := tenancy.RestaurantID(r.Context())
+	if !ok {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	archive, err := loadRestaurantArchive(ctx, restaurantID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'esportazione del ristorante", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurantID,
+		})
+		httputil.InternalServerError(w, "Errore nell'esportazione del ristorante")
+		return
+	}
+	if archive == nil {
+		httputil.NotFound(w, "Ristorante")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="qr-menu-restaurant-%s.zip"`, archive.ExportedAt.Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+
+	// Come per l'export dell'account, le immagini vengono copiate finché il client resta connesso
+	zw := zip.NewWriter(w)
+	err = archive.write(r.Context(), zw)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Export del ristorante interrotto", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurantID,
+		})
+		return
+	}
+
+	RecordAuditLogAsync("RESTAURANT_EXPORTED", "restaurant", restaurantID, restaurantID, getClientIP(r), r.UserAgent(), "success")
+}
+
+// loadRestaurantArchive legge scheda e menu del ristorante. Le immagini salvate con un
+// percorso vengono riscritte come files/<chiave>, QR code e URL pubblici vengono tolti.
+// Restituisce nil se il ristorante non esiste
+func loadRestaurantArchive(ctx context.Context, restaurantID string) (*restaurantArchive, error) {
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, restaurantID)
+	if err != nil || restaurant == nil {
+		return nil, err
+	}
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &restaurantArchive{
+		ExportedAt:   time.Now(),
+		RestaurantID: restaurantID,
+		Profile: restaurantArchiveProfile{
+			Name:                  restaurant.Name,
+			Description:           restaurant.Description,
+			Address:               restaurant.Address,
+			Phone:                 restaurant.Phone,
+			ActiveMenuIDs:         restaurant.DisplayMenuIDs(),
+			PrivacyFirstAnalytics: restaurant.PrivacyFirstAnalytics,
+			ShowRatings:           restaurant.ShowRatings,
+			NutritionDisplay:      restaurant.NutritionDisplay,
+			Loyalty:               restaurant.Loyalty,
+		},
+		Menus: menus,
+	}
+
+	seen := map[string]bool{}
+	addFile := func(url string) string {
+		key, ok := localBlobKey(url)
+		if !ok {
+			return url
+		}
+		if !seen[key] {
+			seen[key] = true
+			archive.BlobKeys = append(archive.BlobKeys, key)
+		}
+		return restaurantArchiveFiles + key
+	}
+
+	archive.Profile.Logo = addFile(restaurant.Logo)
+	for _, menu := range menus {
+		menu.QRCodePath, menu.PublicURL = "", ""
+		menu.DeletedItems = nil
+		for i := range menu.Categories {
+			for j := range menu.Categories[i].Items {
+				item := &menu.Categories[i].Items[j]
+				if item.ImageID == "" {
+					item.ImageURL = addFile(item.ImageURL)
+					continue
+				}
+				blobs, err := blobStore.List(ctx, fmt.Sprintf("images/dishes/%s/", item.ImageID))
+				if err != nil {
+					return nil, fmt.Errorf("errore lettura immagini del piatto %s: %w", item.ID, err)
+				}
+				for _, blob := range blobs {
+					if !seen[blob.Key] {
+						seen[blob.Key] = true
+						archive.BlobKeys = append(archive.BlobKeys, blob.Key)
+					}
+				}
+			}
+		}
+	}
+	return archive, nil
+}
+
+// localBlobKey restituisce la chiave nel blob store di un'immagine salvata con un percorso
+// locale o con l'URL del blob store. Le immagini esterne non hanno una chiave
+func localBlobKey(url string) (string, bool) {
+	if url == "" {
+		return "", false
+	}
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		if base := blobStore.URL(""); base == "" || !strings.HasPrefix(url, base) {
+			return "", false
+		}
+	}
+	key := blobKeyFromURL(url)
+	return key, key != "" && fs.ValidPath(key)
+}
+
+// write scrive restaurant.json, menus.json, i file del blob store e per ultimo manifest.json
+func (a *restaurantArchive) write(ctx context.Context, archive *zip.Writer) error {
+	manifest := restaurantArchiveManifest{
+		Format:       restaurantArchiveFormat,
+		ExportedAt:   a.ExportedAt,
+		RestaurantID: a.RestaurantID,
+		Menus:        len(a.Menus),
+	}
+	create := func(name string) (io.Writer, error) {
+		manifest.Files = append(manifest.Files, name)
+		return archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: a.ExportedAt})
+	}
+	writeJSON := func(name string, v interface{}) error {
+		f, err := create(name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+
+	if err := writeJSON("restaurant.json", a.Profile); err != nil {
+		return err
+	}
+	if err := writeJSON("menus.json", a.Menus); err != nil {
+		return err
+	}
+	for _, key := range a.BlobKeys {
+		if err := copyBlobToArchive(ctx, key, create); err != nil {
+			return err
+		}
+	}
+
+	f, err := archive.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: a.ExportedAt})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(manifest)
+}
+
+// RestaurantImportHandler importa nel ristorante corrente un archivio di RestaurantExportHandler
+// (POST /api/v1/restaurant/import, corpo application/zip). La scheda viene sovrascritta
+// mantenendo username e dominio; i menu dell'archivio si aggiungono a quelli esistenti e
+// quelli attivi nell'istanza di origine diventano i menu attivi
+func RestaurantImportHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurantID, ok := tenancy.RestaurantID(r.Context())
+	if !ok {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	// Lo zip richiede accesso casuale: l'archivio viene prima salvato su un file temporaneo
+	tmp, err := os.CreateTemp("", "qr-menu-import-*.zip")
+	if err != nil {
+		httputil.InternalServerError(w, "Errore nella lettura dell'archivio")
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, http.MaxBytesReader(w, r.Body, restaurantArchiveMaxSize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		httputil.ErrorMessage(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Archivio troppo grande (max %d MB)", restaurantArchiveMaxSize>>20))
+		return
+	}
+	if err != nil || size == 0 {
+		httputil.BadRequest(w, "Archivio mancante o incompleto")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), time.Minute)
+	defer cancel()
+
+	// Come per gli archivi di backup da ripristinare, i file segnalati finiscono in quarantena
+	err = uploadGuard.CheckFile(ctx, "restaurant-import.zip", tmp.Name())
+	if errors.Is(err, avscan.ErrInfected) {
+		RecordAuditLogAsync("UPLOAD_QUARANTINED", "restaurant", restaurantID, restaurantID, getClientIP(r), r.UserAgent(), "failure")
+		httputil.ErrorMessage(w, http.StatusUnprocessableEntity, "L'archivio è stato bloccato dal controllo antivirus")
+		return
+	}
+	if errors.Is(err, avscan.ErrUnavailable) {
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Controllo antivirus non disponibile, riprova più tardi")
+		return
+	}
+	if err != nil {
+		httputil.InternalServerError(w, "Errore nella lettura dell'archivio")
+		return
+	}
+
+	files, err := zip.NewReader(tmp, size)
+	if err != nil {
+		httputil.BadRequest(w, "L'archivio non è un file ZIP valido")
+		return
+	}
+	profile, menus, err := readRestaurantArchiveFiles(files)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, restaurantID)
+	if err != nil {
+		httputil.InternalServerError(w, "Errore nel recupero del ristorante")
+		return
+	}
+	if restaurant == nil {
+		httputil.NotFound(w, "Ristorante")
+		return
+	}
+
+	result, err := importRestaurantArchive(ctx, restaurant, files, profile, menus)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'importazione del ristorante", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurantID,
+		})
+		RecordAuditLogAsync("RESTAURANT_IMPORTED", "restaurant", restaurantID, restaurantID, getClientIP(r), r.UserAgent(), "failure")
+		httputil.InternalServerError(w, "Errore nell'importazione del ristorante: "+err.Error())
+		return
+	}
+
+	RecordAuditLogAsync("RESTAURANT_IMPORTED", "restaurant", restaurantID, restaurantID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Created(w, "Ristorante importato", result)
+}
+
+// readRestaurantArchiveFiles legge manifest, scheda e menu dall'archivio. I menu vengono
+// aggiornati all'ultima versione dello schema, come i file dello storage
+func readRestaurantArchiveFiles(files fs.FS) (*restaurantArchiveProfile, []*models.Menu, error) {
+	var manifest restaurantArchiveManifest
+	if err := readBackupJSON(files, "manifest.json", &manifest); err != nil {
+		return nil, nil, err
+	}
+	if manifest.Format != restaurantArchiveFormat {
+		return nil, nil, fmt.Errorf("formato dell'archivio %q non supportato (atteso %s)", manifest.Format, restaurantArchiveFormat)
+	}
+
+	var profile restaurantArchiveProfile
+	if err := readBackupJSON(files, "restaurant.json", &profile); err != nil {
+		return nil, nil, err
+	}
+	var raw []json.RawMessage
+	if err := readBackupJSON(files, "menus.json", &raw); err != nil {
+		return nil, nil, err
+	}
+
+	menus := make([]*models.Menu, 0, len(raw))
+	for i, data := range raw {
+		menu, _, err := db.UpgradeMenuJSON(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("menus.json: menu %d non valido: %v", i+1, err)
+		}
+		menus = append(menus, menu)
+	}
+	return &profile, menus, nil
+}
+
+// restaurantImport tiene traccia di quanto già scritto dall'import, per annullarlo se fallisce
+type restaurantImport struct {
+	ctx        context.Context
+	files      fs.FS
+	restaurant *models.Restaurant
+	imageIDs   map[string]string                // ID immagine nell'archivio → nuovo ID ("" se mancante)
+	variants   map[string][]models.ImageVariant // Nuovo ID immagine → varianti copiate
+	urls       map[string]string                // files/<chiave> → URL del file copiato ("" se mancante)
+	written    []string                         // Chiavi scritte nel blob store
+	menus      []string                         // Menu creati
+}
+
+// importRestaurantArchive crea i menu dell'archivio con le loro immagini, aggiorna la scheda,
+// attiva i menu attivi nell'origine e, con server.base_url, rigenera il QR code. Se la
+// creazione dei menu fallisce, menu e file già scritti vengono eliminati
+func importRestaurantArchive(ctx context.Context, restaurant *models.Restaurant, files fs.FS, profile *restaurantArchiveProfile, menus []*models.Menu) (result *restaurantImportResult, err error) {
+	imp := &restaurantImport{
+		ctx:        ctx,
+		files:      files,
+		restaurant: restaurant,
+		imageIDs:   map[string]string{},
+		variants:   map[string][]models.ImageVariant{},
+		urls:       map[string]string{},
+	}
+	defer func() {
+		if err != nil {
+			imp.rollback()
+		}
+	}()
+
+	now := time.Now()
+	newIDs := make(map[string]string, len(menus))
+	result = &restaurantImportResult{Menus: []string{}, ActiveMenus: []string{}}
+	for _, menu := range menus {
+		oldID := menu.ID
+		if err = imp.remapMenu(menu, now); err != nil {
+			return nil, err
+		}
+		if err = db.MongoInstance.CreateMenu(ctx, menu); err != nil {
+			return nil, err
+		}
+		imp.menus = append(imp.menus, menu.ID)
+		newIDs[oldID] = menu.ID
+		result.Menus = append(result.Menus, menu.ID)
+	}
+
+	if strings.TrimSpace(profile.Name) != "" {
+		restaurant.Name = profile.Name
+	}
+	restaurant.Description = profile.Description
+	restaurant.Address = profile.Address
+	restaurant.Phone = profile.Phone
+	restaurant.PrivacyFirstAnalytics = profile.PrivacyFirstAnalytics
+	restaurant.ShowRatings = profile.ShowRatings
+	restaurant.NutritionDisplay = profile.NutritionDisplay
+	if profile.Loyalty != nil {
+		restaurant.Loyalty = profile.Loyalty
+	}
+	if restaurant.Logo, err = imp.remapFile(profile.Logo); err != nil {
+		return nil, err
+	}
+	if err = db.MongoInstance.UpdateRestaurant(ctx, restaurant); err != nil {
+		return nil, err
+	}
+	result.Files = len(imp.written)
+
+	// Da qui i menu restano: attivazione e QR code si possono ripetere dal pannello
+	for _, oldID := range profile.ActiveMenuIDs {
+		if id, ok := newIDs[oldID]; ok {
+			result.ActiveMenus = append(result.ActiveMenus, id)
+		}
+	}
+	if len(result.ActiveMenus) > 0 {
+		if err := db.MongoInstance.SetRestaurantActiveMenus(ctx, restaurant, result.ActiveMenus); err != nil {
+			result.Warnings = append(result.Warnings, "menu importati ma non attivati: "+err.Error())
+			result.ActiveMenus = []string{}
+		}
+	}
+	if configuredBaseURL == "" {
+		result.Warnings = append(result.Warnings, "server.base_url non configurato: QR code e URL pubblici dei menu completati vanno rigenerati")
+	} else if result.PublicURL, err = RegenerateRestaurantQRCode(ctx, restaurant); err != nil {
+		result.Warnings = append(result.Warnings, "QR code non rigenerato: "+err.Error())
+		err = nil
+	}
+
+	scheduleMenuWarmUp(restaurant.ID)
+	return result, nil
+}
+
+// remapMenu prepara un menu dell'archivio per il ristorante: nuovi ID per menu, categorie e
+// piatti (lo stesso archivio può essere importato più volte nella stessa istanza) e immagini
+// copiate nel blob store. QR code e URL pubblico vengono rigenerati dopo l'import
+func (imp *restaurantImport) remapMenu(menu *models.Menu, now time.Time) error {
+	menu.ID = uuid.New().String()
+	menu.RestaurantID = imp.restaurant.ID
+	menu.CreatedAt, menu.UpdatedAt = now, now
+	menu.IsActive = false
+	menu.QRCodePath, menu.PublicURL = "", ""
+	menu.DeletedAt, menu.DeletedItems = time.Time{}, nil
+	menu.TemplateID = "" // I modelli dell'organizzazione non fanno parte dell'archivio
+
+	for i := range menu.Categories {
+		category := &menu.Categories[i]
+		category.ID = uuid.New().String()
+		for j := range category.Items {
+			item := &category.Items[j]
+			item.ID = uuid.New().String()
+
+			var err error
+			if item.ImageID != "" {
+				err = imp.remapImage(item)
+			} else {
+				item.ImageURL, err = imp.remapFile(item.ImageURL)
+			}
+			if err != nil {
+				return fmt.Errorf("menu %s, piatto %s: %w", menu.Name, item.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// remapImage copia le varianti dell'immagine di un piatto sotto un nuovo ID. Le immagini
+// condivise da più piatti (es. piatti duplicati) vengono copiate una volta sola; se l'archivio
+// non contiene l'immagine il piatto resta senza foto. Formato e dimensioni delle varianti
+// vengono dal contenuto dei file, non dai nomi nell'archivio né dal menu
+func (imp *restaurantImport) remapImage(item *models.MenuItem) error {
+	oldID := item.ImageID
+	newID, done := imp.imageIDs[oldID]
+	if !done {
+		if !fs.ValidPath(oldID) || strings.Contains(oldID, "/") {
+			return fmt.Errorf("ID immagine %q non valido", oldID)
+		}
+		dir := path.Join(restaurantArchiveFiles, "images", "dishes", oldID)
+		entries, err := fs.ReadDir(imp.files, dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		id := uuid.New().String()
+		var variants []models.ImageVariant
+		for _, entry := range entries {
+			size := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+			if entry.IsDir() || !imaging.IsValidSize(size) {
+				continue
+			}
+			v, err := imp.readImage(path.Join(dir, entry.Name()))
+			if err != nil {
+				return err
+			}
+			key := imageVariantKey(id, size, v.Format)
+			if imp.isWritten(key) {
+				continue
+			}
+			if err := imp.putImage(key, v); err != nil {
+				return err
+			}
+			variants = append(variants, models.ImageVariant{
+				Size:   size,
+				Format: v.Format,
+				Width:  v.Width,
+				Height: v.Height,
+				URL:    blobStore.URL(key),
+			})
+		}
+		if len(variants) > 0 {
+			newID = id
+			imp.variants[newID] = variants
+		}
+		imp.imageIDs[oldID] = newID
+	}
+
+	if newID == "" {
+		item.ImageID, item.ImageVariants = "", nil
+		if strings.HasPrefix(item.ImageURL, "/img/") {
+			item.ImageURL = ""
+		}
+		return nil
+	}
+
+	item.ImageID = newID
+	item.ImageVariants = append([]models.ImageVariant(nil), imp.variants[newID]...)
+	item.ImageURL = strings.Replace(item.ImageURL, "/img/"+oldID+"/", "/img/"+newID+"/", 1)
+	return nil
+}
+
+// remapFile copia nel blob store, sotto images/imported/, un'immagine riferita come
+// files/<chiave> e ne restituisce l'URL. L'estensione della chiave viene dal formato
+// riconosciuto, non dal nome nell'archivio. Gli URL esterni restano invariati, i file
+// mancanti diventano ""
+func (imp *restaurantImport) remapFile(ref string) (string, error) {
+	if !strings.HasPrefix(ref, restaurantArchiveFiles) {
+		return ref, nil
+	}
+	if url, done := imp.urls[ref]; done {
+		return url, nil
+	}
+
+	url := ""
+	v, err := imp.readImage(ref)
+	switch {
+	case err == nil:
+		key := path.Join("images", "imported", uuid.New().String()+"."+v.Format)
+		if err := imp.putImage(key, v); err != nil {
+			return "", err
+		}
+		url = blobStore.URL(key)
+	case !errors.Is(err, fs.ErrNotExist):
+		return "", err
+	}
+	imp.urls[ref] = url
+	return url, nil
+}
+
+// readImage legge un'immagine dell'archivio e la ricodifica con pkg/imaging: i file finiscono
+// su /static/, quindi sono ammessi solo PNG, JPEG e WebP (niente SVG o HTML sull'origine
+// dell'app)
+func (imp *restaurantImport) readImage(name string) (imaging.Variant, error) {
+	f, err := imp.files.Open(name)
+	if err != nil {
+		return imaging.Variant{}, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, restaurantArchiveMaxFileSize+1))
+	if err != nil {
+		return imaging.Variant{}, fmt.Errorf("errore lettura %s: %w", name, err)
+	}
+	if len(data) > restaurantArchiveMaxFileSize {
+		return imaging.Variant{}, fmt.Errorf("%s supera %d MB", name, restaurantArchiveMaxFileSize>>20)
+	}
+	v, err := imaging.Reencode(data)
+	if err != nil {
+		return imaging.Variant{}, fmt.Errorf("%s non è un'immagine PNG, JPEG o WebP valida: %v", name, err)
+	}
+	return v, nil
+}
+
+// putImage salva un'immagine ricodificata nel blob store con la chiave indicata
+func (imp *restaurantImport) putImage(key string, v imaging.Variant) error {
+	if err := blobStore.Put(imp.ctx, key, bytes.NewReader(v.Data), int64(len(v.Data)), v.ContentType); err != nil {
+		return fmt.Errorf("errore salvataggio %s: %w", key, err)
+	}
+	imp.written = append(imp.written, key)
+	return nil
+}
+
+// isWritten indica se l'import ha già scritto la chiave
+func (imp *restaurantImport) isWritten(key string) bool {
+	for _, written := range imp.written {
+		if written == key {
+			return true
+		}
+	}
+	return false
+}
+
+// rollback elimina menu e file creati dall'import, anche se la richiesta è già scaduta
+func (imp *restaurantImport) rollback() {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(imp.ctx), 30*time.Second)
+	defer cancel()
+
+	for _, id := range imp.menus {
+		if err := db.MongoInstance.DeleteMenu(ctx, id); err != nil {
+			logger.WarnCtx(ctx, "Errore nell'annullamento dell'import: menu non eliminato", map[string]interface{}{
+				"error":   err.Error(),
+				"menu_id": id,
+			})
+		}
+	}
+	for _, key := range imp.written {
+		if err := blobStore.Delete(ctx, key); err != nil && err != storage.ErrNotFound {
+			logger.WarnCtx(ctx, "Errore nell'annullamento dell'import: file non eliminato", map[string]interface{}{
+				"error": err.Error(),
+				"key":   key,
+			})
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"path"
+	"sort"
+	"strings"
+
+	"qr-menu/backup"
+	"qr-menu/db"
+	"qr-menu/models"
+	"qr-menu/pkg/storage"
+)
+
+// restaurantBackupData esporta e ripristina i dati di un ristorante per i backup per ristorante:
+// scheda del ristorante, menu e file nel blob store (QR code e immagini dei piatti).
+// Utenti, staff, abbonamento e statistiche restano fuori dal backup
+type restaurantBackupData struct{}
+
+// RestaurantBackupData restituisce i dati dei ristoranti da registrare con SetTenantData
+func RestaurantBackupData() backup.TenantData {
+	return restaurantBackupData{}
+}
+
+// Export salva restaurant.json, menus.json e i file del ristorante sotto blobs/<chiave>
+func (restaurantBackupData) Export(ctx context.Context, restaurantID string, add func(name string, r io.Reader) error) error {
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, restaurantID)
+	if err != nil {
+		return err
+	}
+	if restaurant == nil {
+		return fmt.Errorf("ristorante non trovato")
+	}
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurantID)
+	if err != nil {
+		return err
+	}
+
+	for name, doc := range map[string]interface{}{"restaurant.json": restaurant, "menus.json": menus} {
+		data, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := add(name, bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+
+	keys, err := restaurantBlobKeys(ctx, restaurantID, menus)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		blob, err := blobStore.Get(ctx, key)
+		if err == storage.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("errore lettura %s: %w", key, err)
+		}
+		err = add("blobs/"+key, blob)
+		blob.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restaurantBlobKeys restituisce le chiavi dei file del blob store usati dal ristorante
+func restaurantBlobKeys(ctx context.Context, restaurantID string, menus []*models.Menu) ([]string, error) {
+	seen := map[string]bool{}
+	var keys []string
+	addKey := func(key string) {
+		if key != "" && fs.ValidPath(key) && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	addKey(restaurantQRKey(restaurantID))
+	for _, menu := range menus {
+		if menu.QRCodePath != "" {
+			addKey(blobKeyFromURL(menu.QRCodePath))
+		}
+		for _, category := range menu.Categories {
+			for _, item := range category.Items {
+				switch {
+				case item.ImageID != "":
+					blobs, err := blobStore.List(ctx, fmt.Sprintf("images/dishes/%s/", item.ImageID))
+					if err != nil {
+						return nil, fmt.Errorf("errore lettura immagini del piatto %s: %w", item.ID, err)
+					}
+					for _, blob := range blobs {
+						addKey(blob.Key)
+					}
+				case item.ImageURL != "" && !strings.HasPrefix(item.ImageURL, "http"):
+					addKey(blobKeyFromURL(item.ImageURL))
+				}
+			}
+		}
+	}
+	return keys, nil
+}
+
+// restaurantBlobOwner restituisce un controllo che accetta solo le chiavi dei file del ristorante
+// e dei suoi menu, così un archivio alterato non può sovrascrivere i file di altri ristoranti
+func restaurantBlobOwner(restaurantID string, menus []*models.Menu) func(key string) bool {
+	keys := map[string]bool{restaurantQRKey(restaurantID): true}
+	var prefixes []string
+	for _, menu := range menus {
+		if menu.QRCodePath != "" {
+			keys[blobKeyFromURL(menu.QRCodePath)] = true
+		}
+		for _, category := range menu.Categories {
+			for _, item := range category.Items {
+				if item.ImageID != "" {
+					prefixes = append(prefixes, fmt.Sprintf("images/dishes/%s/", item.ImageID))
+				} else if item.ImageURL != "" {
+					keys[blobKeyFromURL(item.ImageURL)] = true
+				}
+			}
+		}
+	}
+	return func(key string) bool {
+		if keys[key] {
+			return true
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) && !strings.Contains(strings.TrimPrefix(key, prefix), "/") {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Import ripristina scheda, menu e file del ristorante, mantenendo username, dominio e
+// proprietario attuali (vedi keepRestaurantIdentity); i menu creati dopo il backup vengono eliminati
+func (restaurantBackupData) Import(ctx context.Context, restaurantID string, files fs.FS) error {
+	restaurant, menus, err := readRestaurantArchive(files, restaurantID)
+	if err != nil {
+		return err
+	}
+	backedUp := map[string]bool{}
+	for _, menu := range menus {
+		backedUp[menu.ID] = true
+	}
+
+	ownsBlob := restaurantBlobOwner(restaurantID, menus)
+	// Prima i file, così i menu ripristinati non puntano a immagini mancanti
+	err = fs.WalkDir(files, "blobs", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		key := strings.TrimPrefix(name, "blobs/")
+		if !ownsBlob(key) {
+			return fmt.Errorf("il file %s non appartiene al ristorante", key)
+		}
+		contentType := mime.TypeByExtension(path.Ext(key))
+		if err := blobStore.Put(ctx, key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+			return fmt.Errorf("errore ripristino %s: %w", key, err)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	current, err := db.MongoInstance.GetRestaurantByID(ctx, restaurantID)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		if err := db.MongoInstance.CreateRestaurant(ctx, restaurant); err != nil {
+			return err
+		}
+	} else {
+		keepRestaurantIdentity(restaurant, current)
+		if err := db.MongoInstance.UpdateRestaurant(ctx, restaurant); err != nil {
+			return err
+		}
+	}
+
+	for _, menu := range menus {
+		existing, err := db.MongoInstance.GetMenuByID(ctx, menu.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			// Il menu eliminato dopo il backup è ancora nel cestino: va ripristinato, non duplicato
+			if existing, err = restoreTrashedMenu(ctx, restaurantID, menu.ID); err != nil {
+				return err
+			}
+		}
+		switch {
+		case existing == nil:
+			err = db.MongoInstance.CreateMenu(ctx, menu)
+		case existing.RestaurantID != restaurantID:
+			err = fmt.Errorf("il menu %s appartiene ora a un altro ristorante", menu.ID)
+		default:
+			err = db.MongoInstance.UpdateMenu(ctx, menu)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	currentMenus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurantID)
+	if err != nil {
+		return err
+	}
+	for _, menu := range currentMenus {
+		if !backedUp[menu.ID] {
+			if err := db.MongoInstance.DeleteMenu(ctx, menu.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	scheduleMenuWarmUp(restaurantID)
+	return nil
+}
+
+// Plan confronta scheda, menu e file dell'archivio con quelli attuali del ristorante
+func (restaurantBackupData) Plan(ctx context.Context, restaurantID string, files fs.FS) ([]backup.RestoreChange, error) {
+	restaurant, menus, err := readRestaurantArchive(files, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := db.MongoInstance.GetRestaurantByID(ctx, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	change := backup.RestoreChange{Path: "restaurant", Action: backup.ChangeCreate}
+	if current != nil {
+		keepRestaurantIdentity(restaurant, current)
+		change.Action = compareDocuments(current, restaurant)
+	}
+	changes := []backup.RestoreChange{change}
+
+	currentMenus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	byID := map[string]*models.Menu{}
+	for _, menu := range currentMenus {
+		byID[menu.ID] = menu
+	}
+	for _, menu := range menus {
+		change := backup.RestoreChange{Path: "menus/" + menu.ID, Action: backup.ChangeCreate}
+		if existing, ok := byID[menu.ID]; ok {
+			change.Action = compareDocuments(existing, menu)
+			delete(byID, menu.ID)
+		}
+		changes = append(changes, change)
+	}
+	for id := range byID {
+		changes = append(changes, backup.RestoreChange{Path: "menus/" + id, Action: backup.ChangeDelete})
+	}
+
+	err = fs.WalkDir(files, "blobs", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(files, name)
+		if err != nil {
+			return err
+		}
+		change := backup.RestoreChange{Path: name, Action: backup.ChangeCreate, Size: int64(len(data))}
+		blob, err := blobStore.Get(ctx, strings.TrimPrefix(name, "blobs/"))
+		if err == nil {
+			existing, readErr := io.ReadAll(blob)
+			blob.Close()
+			if readErr != nil {
+				return readErr
+			}
+			change.Action = backup.ChangeOverwrite
+			if bytes.Equal(existing, data) {
+				change.Action = backup.ChangeUnchanged
+			}
+		} else if err != storage.ErrNotFound {
+			return err
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	sort.Slice(changes[1:], func(i, j int) bool { return changes[i+1].Path < changes[j+1].Path })
+	return changes, nil
+}
+
+// readRestaurantArchive legge scheda e menu dall'archivio, verificando che siano del ristorante
+func readRestaurantArchive(files fs.FS, restaurantID string) (*models.Restaurant, []*models.Menu, error) {
+	var restaurant models.Restaurant
+	if err := readBackupJSON(files, "restaurant.json", &restaurant); err != nil {
+		return nil, nil, err
+	}
+	var menus []*models.Menu
+	if err := readBackupJSON(files, "menus.json", &menus); err != nil {
+		return nil, nil, err
+	}
+	if restaurant.ID != restaurantID {
+		return nil, nil, fmt.Errorf("restaurant.json appartiene al ristorante %s", restaurant.ID)
+	}
+	for _, menu := range menus {
+		if menu.RestaurantID != restaurantID {
+			return nil, nil, fmt.Errorf("il menu %s appartiene al ristorante %s", menu.ID, menu.RestaurantID)
+		}
+	}
+	return &restaurant, menus, nil
+}
+
+// keepRestaurantIdentity mantiene nella scheda ripristinata username, dominio e proprietario
+// attuali, così link e QR code già distribuiti continuano a funzionare
+func keepRestaurantIdentity(restaurant, current *models.Restaurant) {
+	restaurant.OwnerID = current.OwnerID
+	restaurant.Username = current.Username
+	restaurant.PreviousUsernames = current.PreviousUsernames
+	restaurant.VanitySlug = current.VanitySlug
+	restaurant.CustomDomain = current.CustomDomain
+	restaurant.DomainToken = current.DomainToken
+	restaurant.DomainVerified = current.DomainVerified
+}
+
+// compareDocuments confronta un documento attuale con quello del backup tramite il loro JSON
+func compareDocuments(current, restored interface{}) string {
+	a, errA := json.Marshal(current)
+	b, errB := json.Marshal(restored)
+	if errA == nil && errB == nil && bytes.Equal(a, b) {
+		return backup.ChangeUnchanged
+	}
+	return backup.ChangeOverwrite
+}
+
+// readBackupJSON decodifica un file JSON dell'archivio
+func readBackupJSON(files fs.FS, name string, v interface{}) error {
+	data, err := fs.ReadFile(files, name)
+	if err != nil {
+		return fmt.Errorf("%s mancante nell'archivio: %w", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s non valido: %w", name, err)
+	}
+	return nil
+}
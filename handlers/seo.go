@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+)
+
+const (
+	// seoDescriptionMaxLen è la lunghezza massima della meta description, oltre la quale i
+	// motori di ricerca la troncano
+	seoDescriptionMaxLen = 160
+	// sitemapMaxURLs è il limite di URL di una sitemap secondo il protocollo sitemaps.org
+	sitemapMaxURLs = 50000
+)
+
+// menuSEO sono i metadati della pagina pubblica per motori di ricerca e anteprime dei
+// link (OpenGraph e Twitter card). Gli URL assoluti richiedono server.base_url: le pagine
+// sono in cache e nelle copie statiche, quindi non dipendono dall'host della richiesta
+type menuSEO struct {
+	Title       string
+	Description string
+	Canonical   string
+	Image       string
+	SiteName    string
+	Schema      map[string]interface{} // JSON-LD schema.org Restaurant con i menu
+}
+
+// SEO restituisce i metadati della pagina pubblica di uno o più menu
+func (d publicMenuData) SEO() menuSEO {
+	menus := d.Menus
+	if len(menus) == 0 && d.Menu != nil {
+		menus = []*models.Menu{d.Menu}
+	}
+	restaurant := d.Restaurant
+	if restaurant == nil {
+		restaurant = &models.Restaurant{}
+	}
+
+	seo := menuSEO{SiteName: restaurant.Name}
+	description := restaurant.Description
+	if d.Menu != nil && len(d.Menus) == 0 {
+		seo.Title = d.Menu.Name + " - " + restaurant.Name
+		if d.Menu.Description != "" {
+			description = d.Menu.Description
+		}
+		if configuredBaseURL != "" {
+			seo.Canonical = configuredBaseURL + "/menu/" + url.PathEscape(d.Menu.ID)
+		}
+	} else {
+		seo.Title = restaurant.Name + " - Menu"
+		if configuredBaseURL != "" && restaurant.Username != "" {
+			seo.Canonical = configuredBaseURL + "/r/" + url.PathEscape(restaurant.Username)
+		}
+	}
+	if description == "" {
+		description = "Menu digitale di " + restaurant.Name
+	}
+	seo.Description = truncateText(strings.Join(strings.Fields(description), " "), seoDescriptionMaxLen)
+	seo.Image = seoImageURL(restaurant, menus)
+	seo.Schema = restaurantSchema(restaurant, menus, seo)
+	return seo
+}
+
+// seoImageURL sceglie l'immagine di copertina: il logo del ristorante o, in mancanza, la
+// prima foto di un piatto. Restituisce "" se l'URL non può essere reso assoluto
+func seoImageURL(restaurant *models.Restaurant, menus []*models.Menu) string {
+	if restaurant.Logo != "" {
+		return seoAbsoluteURL(AssetURL(restaurant.Logo))
+	}
+	for _, menu := range menus {
+		for _, category := range menu.Categories {
+			for _, item := range category.Items {
+				if item.ImageURL != "" {
+					return seoAbsoluteURL(AssetURL(item.ImageURL))
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// seoAbsoluteURL rende assoluto un percorso locale con server.base_url; restituisce ""
+// se non è possibile
+func seoAbsoluteURL(path string) string {
+	path = absoluteURL(configuredBaseURL, path)
+	if strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://") {
+		return path
+	}
+	return ""
+}
+
+// restaurantSchema costruisce il JSON-LD schema.org del ristorante con i suoi menu, sezioni
+// e piatti, che i motori di ricerca mostrano nei risultati
+func restaurantSchema(restaurant *models.Restaurant, menus []*models.Menu, seo menuSEO) map[string]interface{} {
+	schema := map[string]interface{}{
+		"@context": "https://schema.org",
+		"@type":    "Restaurant",
+		"name":     restaurant.Name,
+	}
+	if restaurant.Description != "" {
+		schema["description"] = restaurant.Description
+	}
+	if restaurant.Address != "" {
+		schema["address"] = map[string]interface{}{"@type": "PostalAddress", "streetAddress": restaurant.Address}
+	}
+	if restaurant.Phone != "" {
+		schema["telephone"] = restaurant.Phone
+	}
+	if seo.Image != "" {
+		schema["image"] = seo.Image
+	}
+	if configuredBaseURL != "" && restaurant.Username != "" {
+		schema["url"] = configuredBaseURL + "/r/" + url.PathEscape(restaurant.Username)
+	}
+
+	var hasMenu []map[string]interface{}
+	for _, menu := range menus {
+		entry := map[string]interface{}{
+			"@type": "Menu",
+			"name":  menu.Name,
+		}
+		if menu.Description != "" {
+			entry["description"] = menu.Description
+		}
+		if configuredBaseURL != "" {
+			entry["url"] = configuredBaseURL + "/menu/" + url.PathEscape(menu.ID)
+		}
+
+		var sections []map[string]interface{}
+		for _, category := range menu.Categories {
+			section := map[string]interface{}{
+				"@type": "MenuSection",
+				"name":  category.Name,
+			}
+			if category.Description != "" {
+				section["description"] = category.Description
+			}
+			var items []map[string]interface{}
+			for _, item := range category.Items {
+				items = append(items, menuItemSchema(item))
+			}
+			if len(items) > 0 {
+				section["hasMenuItem"] = items
+			}
+			sections = append(sections, section)
+		}
+		if len(sections) > 0 {
+			entry["hasMenuSection"] = sections
+		}
+		hasMenu = append(hasMenu, entry)
+	}
+	if len(hasMenu) > 0 {
+		schema["hasMenu"] = hasMenu
+	}
+	return schema
+}
+
+// menuItemSchema è il piatto come schema.org MenuItem con prezzo e disponibilità
+func menuItemSchema(item models.MenuItem) map[string]interface{} {
+	availability := "https://schema.org/InStock"
+	if !item.Available {
+		availability = "https://schema.org/OutOfStock"
+	}
+	entry := map[string]interface{}{
+		"@type": "MenuItem",
+		"name":  item.Name,
+		"offers": map[string]interface{}{
+			"@type":         "Offer",
+			"price":         strconv.FormatFloat(item.Price, 'f', 2, 64),
+			"priceCurrency": embedCurrency,
+			"availability":  availability,
+		},
+	}
+	if item.Description != "" {
+		entry["description"] = item.Description
+	}
+	if image := seoAbsoluteURL(AssetURL(item.ImageURL)); image != "" {
+		entry["image"] = image
+	}
+	return entry
+}
+
+// truncateText accorcia s a max caratteri senza spezzare le parole, con i puntini di sospensione
+func truncateText(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)[:max-1]
+	cut := string(runes)
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// sitemapURLSet e sitemapURL sono il documento sitemaps.org
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+}
+
+// buildSitemap elenca le pagine pubbliche: per ogni ristorante attivo la pagina /r/{username}
+// e i suoi menu attivi
+func buildSitemap(ctx context.Context, baseURL string) (*sitemapURLSet, time.Time, error) {
+	restaurants, err := db.MongoInstance.GetAllRestaurants(ctx)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	set := &sitemapURLSet{}
+	var lastModified time.Time
+	for _, restaurant := range restaurants {
+		if !restaurant.IsActive || restaurant.Username == "" {
+			continue
+		}
+		menus, err := loadDisplayMenus(ctx, restaurant)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+
+		var restaurantUpdated time.Time
+		var menuURLs []sitemapURL
+		for _, menu := range menus {
+			if menu.IsArchived || !menu.IsCompleted {
+				continue
+			}
+			if menu.UpdatedAt.After(restaurantUpdated) {
+				restaurantUpdated = menu.UpdatedAt
+			}
+			menuURLs = append(menuURLs, sitemapURL{
+				Loc:        baseURL + "/menu/" + url.PathEscape(menu.ID),
+				LastMod:    sitemapDate(menu.UpdatedAt),
+				ChangeFreq: "weekly",
+			})
+		}
+		if len(menuURLs) == 0 {
+			continue
+		}
+		if restaurantUpdated.After(lastModified) {
+			lastModified = restaurantUpdated
+		}
+
+		if len(set.URLs)+1+len(menuURLs) > sitemapMaxURLs {
+			logger.Warn("Sitemap troncata al limite di URL", map[string]interface{}{
+				"limit": sitemapMaxURLs,
+			})
+			break
+		}
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:        baseURL + "/r/" + url.PathEscape(restaurant.Username),
+			LastMod:    sitemapDate(restaurantUpdated),
+			ChangeFreq: "daily",
+		})
+		set.URLs = append(set.URLs, menuURLs...)
+	}
+	return set, lastModified, nil
+}
+
+func sitemapDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+// SitemapHandler genera la sitemap dei menu pubblici per i motori di ricerca (GET /sitemap.xml).
+// Gli URL usano solo server.base_url: la sitemap resta nelle cache condivise e non può
+// contenere l'host scelto da un client. Senza base_url la sitemap non esiste
+func SitemapHandler(w http.ResponseWriter, r *http.Request) {
+	if configuredBaseURL == "" {
+		http.NotFound(w, r)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	set, lastModified, err := buildSitemap(ctx, configuredBaseURL)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella generazione della sitemap", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Sitemap temporaneamente non disponibile", http.StatusServiceUnavailable)
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(set); err != nil {
+		http.Error(w, "Errore nella generazione della sitemap", http.StatusInternalServerError)
+		return
+	}
+	if checkNotModified(w, r, contentETag(buf.Bytes()), lastModified) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// RobotsHandler indica ai motori di ricerca la sitemap ed esclude le pagine private (GET /robots.txt).
+// La riga Sitemap compare solo con server.base_url configurato
+func RobotsHandler(w http.ResponseWriter, r *http.Request) {
+	robots := "User-agent: *\n" +
+		"Disallow: /admin\n" +
+		"Disallow: /api/\n" +
+		"Allow: /\n"
+	if configuredBaseURL != "" {
+		robots += "\nSitemap: " + configuredBaseURL + "/sitemap.xml\n"
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(robots))
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"qr-menu/analytics"
+	"qr-menu/db"
+	"qr-menu/logger"
+	httputil "qr-menu/pkg/http"
+)
+
+// sessionTimeout è il tempo di inattività dopo cui una sessione scade. La scadenza è
+// scorrevole: ogni richiesta autenticata la sposta in avanti
+var sessionTimeout = 24 * time.Hour
+
+// SetSessionTimeout imposta la durata di inattività delle sessioni (security.session_timeout)
+func SetSessionTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		sessionTimeout = timeout
+	}
+}
+
+// sessionExpired indica se la sessione è rimasta inattiva oltre sessionTimeout
+func sessionExpired(lastAccessed, now time.Time) bool {
+	return now.Sub(lastAccessed) > sessionTimeout
+}
+
+// RunSessionCleanupWorker elimina periodicamente le sessioni scadute, finché ctx non viene
+// annullato. All'avvio allinea l'indice TTL delle sessioni a sessionTimeout. È bloccante: va
+// avviato in una goroutine
+func RunSessionCleanupWorker(ctx context.Context, interval time.Duration) {
+	if db.MongoInstance != nil {
+		ttlCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		if err := db.MongoInstance.EnsureSessionTTL(ttlCtx, sessionTimeout); err != nil {
+			logger.Warn("Indice TTL delle sessioni non aggiornato", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+		cancel()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			deleted, err := db.MongoInstance.DeleteExpiredSessions(runCtx, sessionTimeout)
+			cancel()
+			if err != nil {
+				logger.Error("Errore nella pulizia delle sessioni scadute", map[string]interface{}{
+					"error": err.Error(),
+				})
+				continue
+			}
+			if deleted > 0 {
+				logger.Info("Sessioni scadute eliminate", map[string]interface{}{
+					"deleted": deleted,
+				})
+			}
+		}
+	}
+}
+
+// activeSession è una sessione come mostrata all'utente, con il dispositivo ricavato
+// dallo User-Agent
+type activeSession struct {
+	ID           string    `json:"id"`
+	Current      bool      `json:"current"`
+	RestaurantID string    `json:"restaurant_id,omitempty"`
+	Device       string    `json:"device"`
+	Browser      string    `json:"browser"`
+	OS           string    `json:"os"`
+	IPAddress    string    `json:"ip_address"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastAccessed time.Time `json:"last_accessed"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// listActiveSessions restituisce le sessioni attive dell'utente, dalla più recente
+func listActiveSessions(ctx context.Context, userID, currentID string) ([]activeSession, error) {
+	sessions, err := db.MongoInstance.GetSessionsByUserID(ctx, userID, sessionTimeout)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]activeSession, 0, len(sessions))
+	for _, s := range sessions {
+		device, browser, os := analytics.ParseUserAgent(s.UserAgent)
+		result = append(result, activeSession{
+			ID:           s.ID,
+			Current:      s.ID == currentID,
+			RestaurantID: s.RestaurantID,
+			Device:       device,
+			Browser:      browser,
+			OS:           os,
+			IPAddress:    s.IPAddress,
+			CreatedAt:    s.CreatedAt,
+			LastAccessed: s.LastAccessed,
+			ExpiresAt:    s.LastAccessed.Add(sessionTimeout),
+		})
+	}
+	return result, nil
+}
+
+// ListSessionsHandler restituisce le sessioni attive dell'utente (GET /api/v1/sessions)
+func ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sessions, err := listActiveSessions(ctx, session.UserID, session.ID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero delle sessioni", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nel recupero delle sessioni")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", sessions)
+}
+
+// RevokeSessionHandler chiude una sessione dell'utente su un altro dispositivo
+// (DELETE /api/v1/sessions/{id})
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	if id == session.ID {
+		httputil.BadRequest(w, "Per chiudere la sessione corrente usa il logout")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := db.MongoInstance.DeleteUserSession(ctx, id, session.UserID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella chiusura della sessione", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nella chiusura della sessione")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "Sessione")
+		return
+	}
+
+	RecordAuditLogAsync("SESSION_REVOKED", "session", id, session.RestaurantID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// logoutOtherSessions chiude tutte le sessioni dell'utente tranne quella corrente
+func logoutOtherSessions(r *http.Request) (int64, error) {
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := db.MongoInstance.DeleteOtherSessions(ctx, session.UserID, session.ID)
+	if err != nil {
+		return 0, err
+	}
+	RecordAuditLogAsync("SESSIONS_REVOKED", "session", session.UserID, session.RestaurantID, getClientIP(r), r.UserAgent(), "success")
+	return deleted, nil
+}
+
+// LogoutOtherSessionsAPIHandler chiude le sessioni sugli altri dispositivi
+// (POST /api/v1/sessions/logout-others)
+func LogoutOtherSessionsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	deleted, err := logoutOtherSessions(r)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel logout dagli altri dispositivi", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nel logout dagli altri dispositivi")
+		return
+	}
+	httputil.Success(w, "Sessioni chiuse", map[string]interface{}{"revoked": deleted})
+}
+
+// LogoutOtherSessionsHandler chiude le sessioni sugli altri dispositivi dalla pagina account
+func LogoutOtherSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	if _, err := logoutOtherSessions(r); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel logout dagli altri dispositivi", map[string]interface{}{
+			"error": err.Error(),
+		})
+		http.Error(w, "Errore nel logout dagli altri dispositivi", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/account?success=sessions_revoked", http.StatusSeeOther)
+}
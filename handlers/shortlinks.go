@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
+
+	"qr-menu/db"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+)
+
+const (
+	// shortLinkCodeLength è la lunghezza del codice dei link brevi
+	shortLinkCodeLength = 6
+	// maxShortLinks è il numero massimo di link brevi di un ristorante
+	maxShortLinks = 200
+	// maxShortLinkLabel è la lunghezza massima di origine e campagna, in caratteri
+	maxShortLinkLabel = 50
+)
+
+// shortLinkURL è l'indirizzo del link breve
+func shortLinkURL(baseURL, code string) string {
+	return baseURL + "/s/" + code
+}
+
+// shortLinkView è un link breve con il suo indirizzo completo
+type shortLinkView struct {
+	*models.ShortLink
+	URL string `json:"url"`
+}
+
+// shortLinkInvalidError è un errore di validazione della richiesta, da restituire al client
+type shortLinkInvalidError struct{ msg string }
+
+func (e *shortLinkInvalidError) Error() string { return e.msg }
+
+// shortLinkRequest è il corpo delle richieste di creazione e modifica dei link brevi
+type shortLinkRequest struct {
+	Source   *string `json:"source"`
+	Campaign *string `json:"campaign"`
+	MenuID   *string `json:"menu_id"` // Vuoto: i menu attivi
+	Active   *bool   `json:"active"`
+}
+
+// normalizeShortLinkLabel restituisce origine o campagna in minuscolo e senza spazi iniziali
+// e finali, così "Instagram" e "instagram" finiscono nella stessa voce delle statistiche
+func normalizeShortLinkLabel(name, value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if utf8.RuneCountInString(value) > maxShortLinkLabel {
+		return "", &shortLinkInvalidError{fmt.Sprintf("%s può avere al massimo %d caratteri", name, maxShortLinkLabel)}
+	}
+	return value, nil
+}
+
+// applyShortLinkRequest copia nel link i campi presenti nella richiesta, validandoli. Gli
+// errori di validazione sono *shortLinkInvalidError
+func applyShortLinkRequest(ctx context.Context, link *models.ShortLink, req shortLinkRequest) (err error) {
+	if req.Source != nil {
+		if link.Source, err = normalizeShortLinkLabel("L'origine", *req.Source); err != nil {
+			return err
+		}
+	}
+	if link.Source == "" {
+		return &shortLinkInvalidError{"L'origine è obbligatoria (es. tavolo, volantino, instagram)"}
+	}
+	if req.Campaign != nil {
+		if link.Campaign, err = normalizeShortLinkLabel("La campagna", *req.Campaign); err != nil {
+			return err
+		}
+	}
+	if req.MenuID != nil {
+		// Stesse regole dei tag NFC: solo menu completati e non archiviati
+		if link.MenuID, err = validateNFCTagMenu(ctx, link.RestaurantID, *req.MenuID); err == errNFCTagMenu {
+			return &shortLinkInvalidError{"Il menu del link deve essere un menu completato e non archiviato"}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if req.Active != nil {
+		link.Active = *req.Active
+	}
+	return nil
+}
+
+// ListShortLinksHandler restituisce i link brevi del ristorante con le aperture, filtrabili
+// per source e campaign (GET /api/v1/links)
+func ListShortLinksHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	q := r.URL.Query()
+	source, err := normalizeShortLinkLabel("L'origine", q.Get("source"))
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	campaign, err := normalizeShortLinkLabel("La campagna", q.Get("campaign"))
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	links, err := db.MongoInstance.GetShortLinks(ctx, restaurant.ID, source, campaign)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei link brevi")
+		return
+	}
+	baseURL := getBaseURL(r)
+	views := make([]shortLinkView, 0, len(links))
+	for _, link := range links {
+		views = append(views, shortLinkView{ShortLink: link, URL: shortLinkURL(baseURL, link.Code)})
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Link brevi", views)
+}
+
+// CreateShortLinkHandler crea un link breve con origine e campagna (POST /api/v1/links)
+func CreateShortLinkHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	var req shortLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	link := &models.ShortLink{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurant.ID,
+		Active:       true,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := applyShortLinkRequest(ctx, link, req); err != nil {
+		respondShortLinkRequestError(w, r, err)
+		return
+	}
+	count, err := db.MongoInstance.CountShortLinks(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei link brevi")
+		return
+	}
+	if count >= maxShortLinks {
+		httputil.Conflict(w, fmt.Sprintf("Un ristorante può avere al massimo %d link brevi", maxShortLinks))
+		return
+	}
+
+	err = createWithRandomCode(shortLinkCodeLength, db.ErrDuplicateShortLinkCode, func(code string) error {
+		link.Code = code
+		return db.MongoInstance.CreateShortLink(ctx, link)
+	})
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella creazione del link breve")
+		return
+	}
+
+	RecordAuditLogAsync("SHORT_LINK_CREATED", "short_link", link.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Created(w, "Link breve creato", shortLinkView{ShortLink: link, URL: shortLinkURL(getBaseURL(r), link.Code)})
+}
+
+// respondShortLinkRequestError risponde 400 agli errori di validazione della richiesta e 500
+// agli errori del database
+func respondShortLinkRequestError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid *shortLinkInvalidError
+	if errors.As(err, &invalid) {
+		httputil.BadRequest(w, invalid.Error())
+		return
+	}
+	respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+}
+
+// shortLinkFromRequest carica il link breve del ristorante indicato nel percorso
+func shortLinkFromRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, restaurant *models.Restaurant) *models.ShortLink {
+	link, err := db.MongoInstance.GetShortLink(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del link breve")
+		return nil
+	}
+	if link == nil {
+		httputil.NotFound(w, "Link breve")
+		return nil
+	}
+	return link
+}
+
+// UpdateShortLinkHandler modifica origine, campagna, menu o stato di un link breve; il codice,
+// già stampato, non cambia (PUT /api/v1/links/{id})
+func UpdateShortLinkHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	var req shortLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	link := shortLinkFromRequest(ctx, w, r, restaurant)
+	if link == nil {
+		return
+	}
+	if err := applyShortLinkRequest(ctx, link, req); err != nil {
+		respondShortLinkRequestError(w, r, err)
+		return
+	}
+	link.UpdatedAt = time.Now()
+	if err := db.MongoInstance.UpdateShortLink(ctx, link); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio del link breve")
+		return
+	}
+
+	RecordAuditLogAsync("SHORT_LINK_UPDATED", "short_link", link.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Link breve aggiornato", shortLinkView{ShortLink: link, URL: shortLinkURL(getBaseURL(r), link.Code)})
+}
+
+// DeleteShortLinkHandler elimina un link breve: il suo indirizzo smette di aprire il menu
+// (DELETE /api/v1/links/{id})
+func DeleteShortLinkHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id := mux.Vars(r)["id"]
+	deleted, err := db.MongoInstance.DeleteShortLink(ctx, id, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'eliminazione del link breve")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "Link breve")
+		return
+	}
+	RecordAuditLogAsync("SHORT_LINK_DELETED", "short_link", id, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// ShortLinkQRHandler restituisce il QR code PNG del link breve: con l'indirizzo corto il QR
+// ha meno moduli ed è più facile da stampare piccolo (GET /api/v1/links/{id}/qr)
+func ShortLinkQRHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	link := shortLinkFromRequest(ctx, w, r, restaurant)
+	if link == nil {
+		return
+	}
+	png, err := qrcode.Encode(shortLinkURL(getBaseURL(r), link.Code), qrcode.Medium, 256)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella generazione del QR code")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s.png"`, link.Code))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	w.Write(png)
+}
+
+// ShortLinkRedirectHandler apre il menu dal link breve (GET /s/{code}): il menu scelto per il
+// link o i menu attivi del ristorante. L'apertura è contata sul link e nelle analytics con
+// origine link, insieme all'origine e alla campagna del link
+func ShortLinkRedirectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	link, err := db.MongoInstance.GetShortLinkByCode(ctx, normalizeCode(mux.Vars(r)["code"]))
+	if err != nil || link == nil || !link.Active {
+		http.NotFound(w, r)
+		return
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, link.RestaurantID)
+	if err != nil || restaurant == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if !restaurant.IsActive {
+		renderRestaurantUnavailable(w)
+		return
+	}
+
+	menuID := restaurant.ActiveMenuID
+	if link.MenuID != "" {
+		if _, err := validateNFCTagMenu(ctx, restaurant.ID, link.MenuID); err == nil {
+			menuID = link.MenuID
+		} else {
+			// Menu eliminato o archiviato dopo la stampa del link: si aprono i menu attivi
+			link.MenuID = ""
+		}
+	}
+
+	meterUsage(restaurant.ID, models.UsageQRScans)
+	publishShortLinkClick(r, restaurant, link, menuID)
+	if err := db.MongoInstance.RecordShortLinkClick(ctx, link.ID, time.Now()); err != nil {
+		log.Printf("Errore nel conteggio dell'apertura del link breve %s: %v", link.ID, err)
+	}
+
+	// Le visite al menu dopo il redirect sono attribuite all'origine e alla campagna del link
+	r = withShortLinkUTM(r, link)
+	if link.MenuID != "" {
+		http.Redirect(w, r, menuRedirectPath(r, link.MenuID), http.StatusFound)
+		return
+	}
+	serveActiveMenus(ctx, w, r, restaurant)
+}
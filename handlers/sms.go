@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+	"qr-menu/pkg/metrics"
+	"qr-menu/pkg/sms"
+)
+
+// smsSender invia gli SMS ai proprietari e ai clienti degli ordini in anticipo; nil se nessun
+// provider SMS è configurato
+var smsSender sms.Provider
+
+var smsDeliveries = metrics.NewCounter("qrmenu_sms_total",
+	"Text messages by result (sent, failed or opted_out).", "result")
+
+// SetSMSSender imposta il provider (Twilio, Vonage o solo log) usato per gli SMS
+func SetSMSSender(sender sms.Provider) {
+	smsSender = sender
+}
+
+// renderSMS localizza il messaggio key nella versione breve per SMS, se esiste, altrimenti
+// come oggetto e testo della notifica, accorciato a pochi segmenti
+func renderSMS(locale, key string, data map[string]interface{}) (string, error) {
+	if i18n.Default().Has(i18n.SMSKey(key)) {
+		msg, err := i18n.Default().Render(locale, i18n.SMSKey(key), data)
+		if err != nil {
+			return "", err
+		}
+		return sms.Fit(msg.Body), nil
+	}
+	msg, err := i18n.Default().Render(locale, key, data)
+	if err != nil {
+		return "", err
+	}
+	body := msg.Body
+	if msg.Subject != "" {
+		body = msg.Subject + ": " + body
+	}
+	return sms.Fit(body), nil
+}
+
+// sendSMS invia il messaggio key al numero, salvo che abbia risposto STOP, e restituisce l'ID
+// del messaggio presso il provider. Se il provider rifiuta il numero perché ha revocato il
+// consenso, il numero è registrato tra quelli da non contattare
+func sendSMS(ctx context.Context, to, locale, key string, data map[string]interface{}) (string, error) {
+	optedOut, err := db.MongoInstance.IsSMSOptedOut(ctx, to)
+	if err != nil {
+		return "", err
+	}
+	if optedOut {
+		smsDeliveries.Inc("opted_out")
+		return "", sms.ErrOptedOut
+	}
+
+	body, err := renderSMS(locale, key, data)
+	if err != nil {
+		logger.ErrorCtx(ctx, "Errore nella localizzazione dell'SMS", map[string]interface{}{
+			"error": err.Error(),
+			"key":   key,
+		})
+		return "", err
+	}
+
+	messageID, err := smsSender.Send(ctx, sms.Message{To: to, Body: body})
+	switch {
+	case errors.Is(err, sms.ErrOptedOut):
+		smsDeliveries.Inc("opted_out")
+		if serr := db.MongoInstance.SetSMSOptOut(ctx, &models.SMSOptOut{
+			Phone:      to,
+			Provider:   smsSender.Name(),
+			OptedOutAt: time.Now(),
+		}); serr != nil {
+			logger.WarnCtx(ctx, "Errore nel salvataggio della revoca del consenso SMS", map[string]interface{}{
+				"error": serr.Error(),
+			})
+		}
+	case err != nil:
+		smsDeliveries.Inc("failed")
+		logger.WarnCtx(ctx, "Invio SMS fallito", map[string]interface{}{
+			"error":    err.Error(),
+			"key":      key,
+			"provider": smsSender.Name(),
+		})
+	default:
+		smsDeliveries.Inc("sent")
+	}
+	return messageID, err
+}
+
+// smsToUser invia la notifica al numero dell'utente e ne registra l'esito nello storico, dove
+// le ricevute di consegna del provider lo aggiornano
+func smsToUser(ctx context.Context, user *models.User, key string, data map[string]interface{}) error {
+	messageID, err := sendSMS(ctx, user.Phone, user.Locale, key, data)
+
+	receipt := &models.NotificationReceipt{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Channel:   models.ChannelSMS,
+		Key:       key,
+		Device:    phoneLabel(user.Phone),
+		Status:    models.PushStatusSent,
+		MessageID: messageID,
+		CreatedAt: time.Now(),
+	}
+	switch {
+	case errors.Is(err, sms.ErrOptedOut):
+		receipt.Status = models.SMSStatusOptedOut
+	case err != nil:
+		receipt.Status = models.PushStatusFailed
+		receipt.Error = err.Error()
+	}
+	if rerr := db.MongoInstance.RecordNotificationReceipt(ctx, receipt); rerr != nil {
+		logger.WarnCtx(ctx, "Errore nel salvataggio dello storico notifiche", map[string]interface{}{
+			"error": rerr.Error(),
+		})
+	}
+	if errors.Is(err, sms.ErrOptedOut) {
+		return nil // Scelta dell'utente, non un errore di invio
+	}
+	return err
+}
+
+// phoneLabel restituisce le ultime cifre del numero, sufficienti a riconoscerlo nello storico
+func phoneLabel(number string) string {
+	if len(number) <= 4 {
+		return number
+	}
+	return "…" + number[len(number)-4:]
+}
+
+// SMSStatusHandler riceve le ricevute di consegna degli SMS dal provider e aggiorna l'esito
+// nello storico notifiche (/api/v1/public/sms/status). Le richieste sono autenticate dalla
+// firma di Twilio o dal token nell'URL di callback di Vonage
+func SMSStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if smsSender == nil {
+		httputil.NotFound(w, "Endpoint")
+		return
+	}
+	update, err := smsSender.ParseStatus(r)
+	if err != nil {
+		logger.SecurityEventCtx(r.Context(), "SMS_CALLBACK_REJECTED", "Ricevuta SMS non valida", "", map[string]interface{}{
+			"error":    err.Error(),
+			"provider": smsSender.Name(),
+			"ip":       getClientIP(r),
+		})
+		httputil.BadRequest(w, "Ricevuta non valida")
+		return
+	}
+	if update.Status == "" {
+		httputil.NoContent(w) // Stati intermedi, es. in coda presso il provider
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	status := update.Status
+	switch status {
+	case sms.StatusDelivered:
+		status = models.SMSStatusDelivered
+	case sms.StatusUndelivered:
+		status = models.SMSStatusUndelivered
+	case sms.StatusFailed:
+		status = models.PushStatusFailed
+	default:
+		status = models.PushStatusSent
+	}
+	if _, err := db.MongoInstance.UpdateNotificationReceiptStatus(ctx, update.MessageID, status, update.ErrorCode, time.Now()); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'aggiornamento dell'esito dell'SMS", map[string]interface{}{
+			"error":      err.Error(),
+			"message_id": update.MessageID,
+		})
+		httputil.InternalServerError(w, "Errore nell'aggiornamento dell'esito")
+		return
+	}
+	httputil.NoContent(w)
+}
+
+// SMSInboundHandler riceve gli SMS inviati dai destinatari al numero del servizio
+// (/api/v1/public/sms/inbound): STOP e simili revocano il consenso del numero, START lo
+// ripristina. Gli altri messaggi sono ignorati
+func SMSInboundHandler(w http.ResponseWriter, r *http.Request) {
+	if smsSender == nil {
+		httputil.NotFound(w, "Endpoint")
+		return
+	}
+	inbound, err := smsSender.ParseInbound(r)
+	if err != nil {
+		logger.SecurityEventCtx(r.Context(), "SMS_CALLBACK_REJECTED", "SMS in arrivo non valido", "", map[string]interface{}{
+			"error":    err.Error(),
+			"provider": smsSender.Name(),
+			"ip":       getClientIP(r),
+		})
+		httputil.BadRequest(w, "Messaggio non valido")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var action string
+	switch {
+	case sms.IsOptOut(inbound.Body):
+		action = "SMS_OPTED_OUT"
+		err = db.MongoInstance.SetSMSOptOut(ctx, &models.SMSOptOut{
+			Phone:      inbound.From,
+			Keyword:    strings.ToUpper(strings.TrimSpace(inbound.Body)),
+			Provider:   smsSender.Name(),
+			OptedOutAt: time.Now(),
+		})
+	case sms.IsOptIn(inbound.Body):
+		action = "SMS_OPTED_IN"
+		err = db.MongoInstance.DeleteSMSOptOut(ctx, inbound.From)
+	default:
+		httputil.NoContent(w)
+		return
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio del consenso SMS", map[string]interface{}{
+			"error": err.Error(),
+		})
+		httputil.InternalServerError(w, "Errore nel salvataggio del consenso")
+		return
+	}
+	RecordAuditLogAsync(action, "phone", phoneLabel(inbound.From), "", getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
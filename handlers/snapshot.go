@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+)
+
+// menuSnapshotInterval è ogni quanto vengono rigenerate le copie statiche dei menu attivi
+const menuSnapshotInterval = 15 * time.Minute
+
+// snapshotDir contiene le copie HTML statiche dei menu attivi, servite quando
+// database o storage non rispondono. È su disco locale per non dipendere da servizi esterni
+var (
+	snapshotDir   = filepath.Join("storage", "snapshots")
+	snapshotIndex = make(map[string]string) // username ristorante -> ID menu attivo o chiave della pagina combinata
+	snapshotMu    sync.RWMutex
+)
+
+// restaurantSnapshotPrefix distingue nell'indice le pagine combinate (più menu attivi) dai singoli menu
+const restaurantSnapshotPrefix = "r-"
+
+// publicMenuData sono i dati dei template public_menu e public_menus
+type publicMenuData struct {
+	Menu       *models.Menu
+	Menus      []*models.Menu // Menu attivi insieme, in ordine (solo public_menus)
+	Restaurant *models.Restaurant
+	SnapshotAt time.Time // Valorizzato solo nelle copie statiche: mostra l'avviso di dati non aggiornati
+}
+
+// restaurantSnapshotKey restituisce la chiave della copia statica della pagina combinata di un ristorante
+func restaurantSnapshotKey(username string) string {
+	return restaurantSnapshotPrefix + username
+}
+
+// SetSnapshotDir imposta la directory delle copie statiche dei menu e carica l'indice esistente
+func SetSnapshotDir(dir string) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	snapshotDir = dir
+
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err == nil {
+		index := make(map[string]string)
+		if json.Unmarshal(data, &index) == nil {
+			snapshotIndex = index
+		}
+	}
+}
+
+// menuSnapshotPath restituisce il percorso della copia statica di un menu (o di una pagina combinata)
+func menuSnapshotPath(key string) string {
+	snapshotMu.RLock()
+	defer snapshotMu.RUnlock()
+	return filepath.Join(snapshotDir, filepath.Base(key)+".html")
+}
+
+// executeTemplate esegue un template in memoria, così un errore di rendering non
+// lascia una risposta scritta a metà
+func executeTemplate(tmpl string, data interface{}) ([]byte, error) {
+	if templates == nil {
+		return nil, fmt.Errorf("template non caricati")
+	}
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, tmpl+".html", data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// serveMenuSnapshot serve la copia statica di un menu. Restituisce false se non esiste
+func serveMenuSnapshot(w http.ResponseWriter, key string) bool {
+	path := menuSnapshotPath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		w.Header().Set("X-Menu-Snapshot", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+	// La copia può essere vecchia: i CDN non devono conservarla né usarla per le revalidazioni
+	w.Header().Del("ETag")
+	w.Header().Del("Last-Modified")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(data)
+	return true
+}
+
+// snapshotMenuIDForUsername restituisce il menu attivo di un ristorante secondo l'ultimo snapshot,
+// oppure la chiave della pagina combinata se il ristorante ha più menu attivi
+func snapshotMenuIDForUsername(username string) string {
+	snapshotMu.RLock()
+	defer snapshotMu.RUnlock()
+	return snapshotIndex[username]
+}
+
+// RefreshMenuSnapshots rigenera le copie statiche dei menu attivi di tutti i ristoranti
+func RefreshMenuSnapshots(ctx context.Context) error {
+	restaurants, err := db.MongoInstance.GetAllRestaurants(ctx)
+	if err != nil {
+		return err
+	}
+
+	snapshotMu.RLock()
+	dir := snapshotDir
+	snapshotMu.RUnlock()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("errore creazione directory snapshot: %v", err)
+	}
+
+	index := make(map[string]string)
+	keep := make(map[string]bool)
+	now := time.Now()
+	for _, restaurant := range restaurants {
+		if !restaurant.IsActive {
+			continue
+		}
+
+		menus, err := loadDisplayMenus(ctx, restaurant)
+		if err != nil || len(menus) == 0 {
+			continue
+		}
+
+		// Ogni menu attivo ha la sua copia, così anche /menu/{id} resta disponibile
+		for _, menu := range menus {
+			if writeMenuSnapshot(menu.ID, "public_menu", publicMenuData{Menu: menu, Restaurant: restaurant, SnapshotAt: now}) {
+				keep[menu.ID] = true
+			}
+		}
+		if keep[menus[0].ID] {
+			index[restaurant.Username] = menus[0].ID
+		}
+
+		if len(menus) > 1 {
+			key := restaurantSnapshotKey(restaurant.Username)
+			if writeMenuSnapshot(key, "public_menus", publicMenuData{Menus: menus, Restaurant: restaurant, SnapshotAt: now}) {
+				keep[key] = true
+				index[restaurant.Username] = key
+			}
+		}
+	}
+
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := db.WriteFileAtomic(filepath.Join(dir, "index.json"), data, 0644); err != nil {
+		return err
+	}
+
+	snapshotMu.Lock()
+	snapshotIndex = index
+	snapshotMu.Unlock()
+
+	// Rimuove le copie di menu non più attivi (o di ristoranti chiusi)
+	if files, err := filepath.Glob(filepath.Join(dir, "*.html")); err == nil {
+		for _, file := range files {
+			if !keep[strings.TrimSuffix(filepath.Base(file), ".html")] {
+				os.Remove(file)
+			}
+		}
+	}
+
+	logger.Info("Snapshot dei menu aggiornati", map[string]interface{}{
+		"menus": len(keep),
+	})
+	return nil
+}
+
+// writeMenuSnapshot renderizza un template e lo salva come copia statica con la chiave indicata
+func writeMenuSnapshot(key, tmpl string, data publicMenuData) bool {
+	html, err := executeTemplate(tmpl, data)
+	if err != nil {
+		logger.Warn("Errore nel rendering dello snapshot del menu", map[string]interface{}{
+			"error": err.Error(),
+			"key":   key,
+		})
+		return false
+	}
+	if err := db.WriteFileAtomic(menuSnapshotPath(key), html, 0644); err != nil {
+		logger.Warn("Errore nel salvataggio dello snapshot del menu", map[string]interface{}{
+			"error": err.Error(),
+			"key":   key,
+		})
+		return false
+	}
+	return true
+}
+
+// removeMenuSnapshots elimina subito le copie statiche dei menu di un ristorante e la sua voce
+// nell'indice, senza attendere il prossimo aggiornamento degli snapshot
+func removeMenuSnapshots(username string, menus []*models.Menu) {
+	keys := []string{restaurantSnapshotKey(username)}
+	for _, menu := range menus {
+		keys = append(keys, menu.ID)
+	}
+	for _, key := range keys {
+		if err := os.Remove(menuSnapshotPath(key)); err != nil && !os.IsNotExist(err) {
+			logger.Warn("Errore nell'eliminazione dello snapshot del menu", map[string]interface{}{
+				"error": err.Error(),
+				"key":   key,
+			})
+		}
+	}
+
+	snapshotMu.Lock()
+	delete(snapshotIndex, username)
+	snapshotMu.Unlock()
+}
+
+// RunMenuSnapshotWorker aggiorna le copie statiche all'avvio e poi periodicamente,
+// finché ctx non viene annullato. È bloccante: va avviato in una goroutine
+func RunMenuSnapshotWorker(ctx context.Context) {
+	refresh := func() {
+		runCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		defer cancel()
+		if err := RefreshMenuSnapshots(runCtx); err != nil {
+			logger.Warn("Aggiornamento snapshot dei menu non riuscito", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	refresh()
+
+	ticker := time.NewTicker(menuSnapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/feed"
+	httputil "qr-menu/pkg/http"
+)
+
+const (
+	// specialsFeedPast e specialsFeedAhead delimitano i giorni pubblicati nei feed: una
+	// settimana di storico e i due mesi successivi
+	specialsFeedPast  = 7
+	specialsFeedAhead = 60
+	// specialsFeedRefresh è l'intervallo di aggiornamento suggerito a calendari e aggregatori
+	specialsFeedRefresh = 6 * time.Hour
+	// specialsMaxRange è l'intervallo massimo in giorni della lista dei piatti del giorno
+	specialsMaxRange = 366
+)
+
+// specialRequest è il corpo di creazione e modifica di un piatto del giorno
+type specialRequest struct {
+	Date        string   `json:"date"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Courses     []string `json:"courses"`
+	Price       float64  `json:"price"`
+	MenuID      string   `json:"menu_id"`
+}
+
+// currentSpecialsSession restituisce la sessione (o la API key) con il ristorante
+// selezionato; risponde 401 e restituisce nil se manca
+func currentSpecialsSession(w http.ResponseWriter, r *http.Request) *models.Session {
+	session, err := getSessionFromRequest(r)
+	if err != nil || session.RestaurantID == "" {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return nil
+	}
+	return session
+}
+
+func respondSpecialError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	logger.ErrorCtx(r.Context(), message, map[string]interface{}{
+		"error": err.Error(),
+	})
+	httputil.InternalServerError(w, message)
+}
+
+// applySpecialRequest legge e valida il corpo della richiesta e lo applica al piatto del
+// giorno. Il menu collegato deve appartenere al ristorante; senza titolo si usa il nome del
+// menu. Risponde con l'errore e restituisce false se la richiesta non è valida
+func applySpecialRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, special *models.DailySpecial) bool {
+	var req specialRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Richiesta non valida")
+		return false
+	}
+
+	date := strings.TrimSpace(req.Date)
+	if _, err := time.Parse(models.DailySpecialDateLayout, date); err != nil {
+		httputil.BadRequest(w, "Data non valida (formato YYYY-MM-DD)")
+		return false
+	}
+	if req.Price < 0 {
+		httputil.BadRequest(w, "Il prezzo non può essere negativo")
+		return false
+	}
+
+	title := strings.TrimSpace(req.Title)
+	menuID := strings.TrimSpace(req.MenuID)
+	if menuID != "" {
+		menu, err := tenantMenu(ctx, menuID)
+		if err != nil {
+			respondSpecialError(w, r, err, "Errore nel recupero del menu")
+			return false
+		}
+		if menu == nil || menu.IsArchived {
+			httputil.BadRequest(w, "Menu non trovato")
+			return false
+		}
+		if title == "" {
+			title = menu.Name
+		}
+	}
+	if title == "" {
+		httputil.BadRequest(w, "Il titolo è obbligatorio")
+		return false
+	}
+
+	courses := make([]string, 0, len(req.Courses))
+	for _, course := range req.Courses {
+		if course = strings.TrimSpace(course); course != "" {
+			courses = append(courses, course)
+		}
+	}
+
+	special.Date = date
+	special.Title = title
+	special.Description = strings.TrimSpace(req.Description)
+	special.Courses = courses
+	special.Price = req.Price
+	special.MenuID = menuID
+	return true
+}
+
+// ListSpecialsHandler restituisce i piatti del giorno del ristorante (GET /api/v1/specials).
+// from e to (YYYY-MM-DD) delimitano l'intervallo; di default da oggi ai prossimi 30 giorni
+func ListSpecialsHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentSpecialsSession(w, r)
+	if session == nil {
+		return
+	}
+	restaurantID := session.RestaurantID
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today, today.AddDate(0, 0, 30)
+	for param, day := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(models.DailySpecialDateLayout, value)
+		if err != nil {
+			httputil.BadRequest(w, "Parametro "+param+" non valido (formato YYYY-MM-DD)")
+			return
+		}
+		*day = parsed
+	}
+	if to.Before(from) || to.Sub(from) > specialsMaxRange*24*time.Hour {
+		httputil.BadRequest(w, fmt.Sprintf("Intervallo non valido (massimo %d giorni)", specialsMaxRange))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	specials, err := db.MongoInstance.GetDailySpecials(ctx, restaurantID,
+		from.Format(models.DailySpecialDateLayout), to.Format(models.DailySpecialDateLayout))
+	if err != nil {
+		respondSpecialError(w, r, err, "Errore nel recupero dei piatti del giorno")
+		return
+	}
+	if specials == nil {
+		specials = []*models.DailySpecial{}
+	}
+	httputil.Success(w, "Piatti del giorno", specials)
+}
+
+// CreateSpecialHandler programma un piatto del giorno (POST /api/v1/specials)
+func CreateSpecialHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentSpecialsSession(w, r)
+	if session == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	special := &models.DailySpecial{
+		ID:           uuid.New().String(),
+		RestaurantID: session.RestaurantID,
+		CreatedBy:    session.UserID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if !applySpecialRequest(ctx, w, r, special) {
+		return
+	}
+	if err := db.MongoInstance.SaveDailySpecial(ctx, special); err != nil {
+		respondSpecialError(w, r, err, "Errore nel salvataggio del piatto del giorno")
+		return
+	}
+
+	RecordAuditLogAsync("SPECIAL_CREATED", "daily_special", special.ID, special.RestaurantID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Created(w, "Piatto del giorno creato", special)
+}
+
+// UpdateSpecialHandler modifica un piatto del giorno (PUT /api/v1/specials/{id})
+func UpdateSpecialHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentSpecialsSession(w, r)
+	if session == nil {
+		return
+	}
+	restaurantID := session.RestaurantID
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	special, err := db.MongoInstance.GetDailySpecial(ctx, id, restaurantID)
+	if err != nil {
+		respondSpecialError(w, r, err, "Errore nel recupero del piatto del giorno")
+		return
+	}
+	if special == nil {
+		httputil.NotFound(w, "Piatto del giorno")
+		return
+	}
+	if !applySpecialRequest(ctx, w, r, special) {
+		return
+	}
+	special.UpdatedAt = time.Now()
+	if err := db.MongoInstance.SaveDailySpecial(ctx, special); err != nil {
+		respondSpecialError(w, r, err, "Errore nel salvataggio del piatto del giorno")
+		return
+	}
+
+	RecordAuditLogAsync("SPECIAL_UPDATED", "daily_special", special.ID, restaurantID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Piatto del giorno aggiornato", special)
+}
+
+// DeleteSpecialHandler elimina un piatto del giorno (DELETE /api/v1/specials/{id})
+func DeleteSpecialHandler(w http.ResponseWriter, r *http.Request) {
+	session := currentSpecialsSession(w, r)
+	if session == nil {
+		return
+	}
+	restaurantID := session.RestaurantID
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := db.MongoInstance.DeleteDailySpecial(ctx, id, restaurantID)
+	if err != nil {
+		respondSpecialError(w, r, err, "Errore nell'eliminazione del piatto del giorno")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "Piatto del giorno")
+		return
+	}
+
+	RecordAuditLogAsync("SPECIAL_DELETED", "daily_special", id, restaurantID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// loadFeedSpecials trova il ristorante attivo e i piatti del giorno della finestra del feed;
+// risponde 404 e restituisce nil se il ristorante non esiste
+func loadFeedSpecials(w http.ResponseWriter, r *http.Request) (*models.Restaurant, []*models.DailySpecial) {
+	username := mux.Vars(r)["username"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restaurant, err := db.MongoInstance.GetRestaurantByUsername(ctx, username)
+	if err == nil && restaurant != nil && restaurant.IsActive {
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		var specials []*models.DailySpecial
+		specials, err = db.MongoInstance.GetDailySpecials(ctx, restaurant.ID,
+			today.AddDate(0, 0, -specialsFeedPast).Format(models.DailySpecialDateLayout),
+			today.AddDate(0, 0, specialsFeedAhead).Format(models.DailySpecialDateLayout))
+		if err == nil {
+			return restaurant, specials
+		}
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero dei piatti del giorno per il feed", map[string]interface{}{
+			"error":    err.Error(),
+			"username": username,
+		})
+		httputil.ErrorMessage(w, http.StatusServiceUnavailable, "Feed temporaneamente non disponibile")
+		return nil, nil
+	}
+	httputil.NotFound(w, "Ristorante")
+	return nil, nil
+}
+
+// specialLink è la pagina pubblica del piatto del giorno: il menu collegato o, in
+// mancanza, il menu attivo del ristorante
+func specialLink(baseURL, username string, special *models.DailySpecial) string {
+	if special.MenuID != "" {
+		return baseURL + "/menu/" + url.PathEscape(special.MenuID)
+	}
+	return baseURL + "/r/" + url.PathEscape(username)
+}
+
+// specialText è la descrizione del piatto del giorno nei feed: descrizione, portate e prezzo
+func specialText(special *models.DailySpecial) string {
+	var lines []string
+	if special.Description != "" {
+		lines = append(lines, special.Description)
+	}
+	lines = append(lines, special.Courses...)
+	if special.Price > 0 {
+		lines = append(lines, fmt.Sprintf("Prezzo: %.2f %s", special.Price, embedCurrency))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// specialsLastModified è l'ultima modifica tra i piatti del giorno del feed
+func specialsLastModified(specials []*models.DailySpecial) time.Time {
+	var last time.Time
+	for _, special := range specials {
+		if special.UpdatedAt.After(last) {
+			last = special.UpdatedAt
+		}
+	}
+	return last
+}
+
+// writeFeed invia il feed con ETag, rispondendo 304 se il client ha già la versione corrente
+func writeFeed(w http.ResponseWriter, r *http.Request, contentType string, body []byte, lastModified time.Time) {
+	if checkNotModified(w, r, contentETag(body), lastModified) {
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	allowEmbedOrigin(w)
+	w.Write(body)
+}
+
+// SpecialsICalHandler pubblica i piatti del giorno come calendario iCal, a cui ci si può
+// iscrivere da Google Calendar, Apple Calendar o Outlook (GET /r/{username}/specials.ics)
+func SpecialsICalHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, specials := loadFeedSpecials(w, r)
+	if restaurant == nil {
+		return
+	}
+	baseURL := getBaseURL(r)
+	host := "qr-menu"
+	if u, err := url.Parse(baseURL); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+
+	cal := feed.Calendar{
+		ProductID:   "-//QR Menu//Piatti del giorno//IT",
+		Name:        restaurant.Name + " - Menu del giorno",
+		Description: restaurant.Description,
+		RefreshIn:   specialsFeedRefresh,
+	}
+	for _, special := range specials {
+		cal.Events = append(cal.Events, feed.Event{
+			UID:         "special-" + special.ID + "@" + host,
+			Date:        special.Day(),
+			Summary:     special.Title,
+			Description: specialText(special),
+			URL:         specialLink(baseURL, restaurant.Username, special),
+			Updated:     special.UpdatedAt,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := feed.WriteICal(&buf, cal); err != nil {
+		httputil.InternalServerError(w, "Errore nella generazione del calendario")
+		return
+	}
+	w.Header().Set("Content-Disposition", `inline; filename="specials.ics"`)
+	writeFeed(w, r, "text/calendar; charset=utf-8", buf.Bytes(), specialsLastModified(specials))
+}
+
+// SpecialsRSSHandler pubblica i piatti del giorno come feed RSS, dal più recente
+// (GET /r/{username}/specials.rss). I giorni futuri non sono ancora pubblicati
+func SpecialsRSSHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, specials := loadFeedSpecials(w, r)
+	if restaurant == nil {
+		return
+	}
+	baseURL := getBaseURL(r)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	ch := feed.Channel{
+		Title:       restaurant.Name + " - Menu del giorno",
+		Link:        baseURL + "/r/" + url.PathEscape(restaurant.Username),
+		Description: "I piatti del giorno di " + restaurant.Name,
+		Language:    "it",
+		TTL:         specialsFeedRefresh,
+	}
+	for _, special := range slices.Backward(specials) {
+		if special.Day().After(today) {
+			continue
+		}
+		ch.Items = append(ch.Items, feed.Item{
+			Title:       special.Date + " - " + special.Title,
+			Link:        specialLink(baseURL, restaurant.Username, special),
+			Description: specialText(special),
+			GUID:        "special-" + special.ID,
+			Published:   special.Day(),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := feed.WriteRSS(&buf, ch); err != nil {
+		httputil.InternalServerError(w, "Errore nella generazione del feed")
+		return
+	}
+	writeFeed(w, r, "application/rss+xml; charset=utf-8", buf.Bytes(), specialsLastModified(specials))
+}
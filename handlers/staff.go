@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+)
+
+// staffInvitationTTL è la validità del link di invito allo staff
+const staffInvitationTTL = 7 * 24 * time.Hour
+
+// restaurantRole restituisce il ruolo dell'utente sul ristorante: owner per il proprietario,
+// il ruolo assegnato per lo staff, vuoto se l'utente non ha accesso
+func restaurantRole(ctx context.Context, restaurant *models.Restaurant, userID string) (string, error) {
+	if restaurant.OwnerID == userID {
+		return models.RoleOwner, nil
+	}
+	member, err := db.MongoInstance.GetRestaurantMember(ctx, restaurant.ID, userID)
+	if err != nil || member == nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+// accessibleRestaurants restituisce i ristoranti dell'utente e quelli in cui fa parte dello staff
+func accessibleRestaurants(ctx context.Context, userID string) ([]models.Restaurant, error) {
+	owned, err := db.MongoInstance.GetRestaurantsByOwnerID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := db.MongoInstance.GetRestaurantsByMemberID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, restaurant := range shared {
+		if restaurant.OwnerID != userID {
+			owned = append(owned, restaurant)
+		}
+	}
+	return owned, nil
+}
+
+// currentRole restituisce la sessione e il ruolo dell'utente sul ristorante selezionato.
+// Se il ruolo non può essere letto è vuoto, cioè senza permessi
+func currentRole(r *http.Request) (*models.Session, string, error) {
+	session, err := getSessionFromRequest(r)
+	if err != nil {
+		return nil, "", err
+	}
+	restaurant, err := getCurrentRestaurant(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	role, err := restaurantRole(ctx, restaurant, session.UserID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella lettura del ruolo", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+	}
+	return session, role, nil
+}
+
+// RequirePermissions middleware che consente la richiesta solo se il ruolo dell'utente sul
+// ristorante selezionato concede tutti i permessi indicati. Va usato dopo RequireAuth.
+// Il ruolo è letto a ogni richiesta, così la rimozione dallo staff ha effetto subito
+func RequirePermissions(perms ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			session, role, err := currentRole(r)
+			if handleAuthError(w, r, err) {
+				return
+			}
+			for _, perm := range perms {
+				if models.RoleHasPermission(role, perm) {
+					continue
+				}
+				logger.SecurityEventCtx(r.Context(), "ACCESS_DENIED", "Permesso mancante", session.UserID, map[string]interface{}{
+					"role":          role,
+					"permission":    perm,
+					"restaurant_id": session.RestaurantID,
+					"endpoint":      r.URL.Path,
+					"method":        r.Method,
+				})
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					httputil.Forbidden(w, "Permessi insufficienti")
+				} else {
+					http.Error(w, "Permessi insufficienti per questa operazione", http.StatusForbidden)
+				}
+				return
+			}
+			next(w, r)
+		}
+	}
+}
+
+// staffMemberRow è un membro dello staff come mostrato nella pagina di gestione
+type staffMemberRow struct {
+	UserID    string
+	Username  string
+	Email     string
+	Role      string
+	RoleLabel string
+	CreatedAt time.Time
+}
+
+// staffInvitationRow è un invito pendente come mostrato nella pagina di gestione
+type staffInvitationRow struct {
+	ID        string
+	Email     string
+	RoleLabel string
+	ExpiresAt time.Time
+}
+
+// staffRoleOption è un ruolo selezionabile nei form dello staff
+type staffRoleOption struct {
+	Value string
+	Label string
+}
+
+// StaffHandler mostra lo staff del ristorante, gli inviti pendenti e il form di invito
+func StaffHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	members, err := db.MongoInstance.GetRestaurantMembers(ctx, restaurant.ID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero dello staff", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nel recupero dello staff", http.StatusInternalServerError)
+		return
+	}
+	invitations, err := db.MongoInstance.GetStaffInvitationsByRestaurant(ctx, restaurant.ID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero degli inviti", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nel recupero degli inviti", http.StatusInternalServerError)
+		return
+	}
+
+	memberRows := make([]staffMemberRow, 0, len(members))
+	for _, member := range members {
+		user, err := db.MongoInstance.GetUserByID(ctx, member.UserID)
+		if err != nil || user == nil {
+			continue
+		}
+		memberRows = append(memberRows, staffMemberRow{
+			UserID:    member.UserID,
+			Username:  user.Username,
+			Email:     user.Email,
+			Role:      member.Role,
+			RoleLabel: models.RoleLabel(member.Role),
+			CreatedAt: member.CreatedAt,
+		})
+	}
+	invitationRows := make([]staffInvitationRow, 0, len(invitations))
+	for _, invitation := range invitations {
+		invitationRows = append(invitationRows, staffInvitationRow{
+			ID:        invitation.ID,
+			Email:     invitation.Email,
+			RoleLabel: models.RoleLabel(invitation.Role),
+			ExpiresAt: invitation.ExpiresAt,
+		})
+	}
+	roles := make([]staffRoleOption, 0, len(models.StaffRoles))
+	for _, role := range models.StaffRoles {
+		roles = append(roles, staffRoleOption{Value: role, Label: models.RoleLabel(role)})
+	}
+
+	data := struct {
+		Restaurant  *models.Restaurant
+		Members     []staffMemberRow
+		Invitations []staffInvitationRow
+		Roles       []staffRoleOption
+		Success     string
+		Error       string
+		CSRFToken   string
+	}{
+		Restaurant:  restaurant,
+		Members:     memberRows,
+		Invitations: invitationRows,
+		Roles:       roles,
+		Success:     r.URL.Query().Get("success"),
+		Error:       r.URL.Query().Get("error"),
+		CSRFToken:   csrfToken(w, r),
+	}
+
+	renderTemplate(w, "staff", data)
+}
+
+// InviteStaffHandler invia via email l'invito a entrare nello staff con il ruolo scelto
+func InviteStaffHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, session, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+
+	email := db.NormalizeCredential(r.FormValue("email"))
+	role := r.FormValue("role")
+	if !strings.Contains(email, "@") || email == db.NormalizeCredential(user.Email) {
+		http.Redirect(w, r, "/admin/staff?error=email_invalid", http.StatusSeeOther)
+		return
+	}
+	if !models.IsStaffRole(role) {
+		http.Redirect(w, r, "/admin/staff?error=role_invalid", http.StatusSeeOther)
+		return
+	}
+	baseURL, err := emailBaseURL()
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Invito non inviato", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Redirect(w, r, "/admin/staff?error=email_send_failed", http.StatusSeeOther)
+		return
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		http.Error(w, "Errore nella generazione dell'invito", http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	invitation := &models.StaffInvitation{
+		ID:           hashVerificationToken(token),
+		RestaurantID: restaurant.ID,
+		Email:        email,
+		Role:         role,
+		InvitedBy:    user.ID,
+		CreatedAt:    time.Now(),
+		ExpiresAt:    time.Now().Add(staffInvitationTTL),
+	}
+	if err := db.MongoInstance.CreateStaffInvitation(ctx, invitation); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel salvataggio dell'invito", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nel salvataggio dell'invito", http.StatusInternalServerError)
+		return
+	}
+
+	acceptURL := fmt.Sprintf("%s/staff/accept?token=%s", baseURL, url.QueryEscape(token))
+	if err := notifyUser(ctx, email, user.Locale, i18n.KeyStaffInvitation, map[string]interface{}{
+		"RestaurantName": restaurant.Name,
+		"InviterName":    user.Username,
+		"Role":           models.RoleLabel(role),
+		"AcceptURL":      acceptURL,
+	}); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'invio dell'invito", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		db.MongoInstance.DeleteStaffInvitation(ctx, invitation.ID, restaurant.ID)
+		http.Redirect(w, r, "/admin/staff?error=email_send_failed", http.StatusSeeOther)
+		return
+	}
+
+	RecordAuditLogAsync("STAFF_INVITED", "restaurant", restaurant.ID, session.RestaurantID, getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/admin/staff?success=invitation_sent", http.StatusSeeOther)
+}
+
+// ChangeStaffRoleHandler cambia il ruolo di un membro dello staff
+func ChangeStaffRoleHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+	role := r.FormValue("role")
+	if !models.IsStaffRole(role) {
+		http.Redirect(w, r, "/admin/staff?error=role_invalid", http.StatusSeeOther)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	member, err := db.MongoInstance.GetRestaurantMember(ctx, restaurant.ID, mux.Vars(r)["userId"])
+	if err != nil || member == nil {
+		http.Redirect(w, r, "/admin/staff?error=member_not_found", http.StatusSeeOther)
+		return
+	}
+	member.Role = role
+	if err := db.MongoInstance.SaveRestaurantMember(ctx, member); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel cambio ruolo", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nel cambio ruolo", http.StatusInternalServerError)
+		return
+	}
+
+	RecordAuditLogAsync("STAFF_ROLE_CHANGED", "user", member.UserID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/admin/staff?success=role_changed", http.StatusSeeOther)
+}
+
+// RemoveStaffHandler rimuove un membro dallo staff e chiude le sue sessioni sul ristorante
+func RemoveStaffHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	userID := mux.Vars(r)["userId"]
+	removed, err := db.MongoInstance.DeleteRestaurantMember(ctx, restaurant.ID, userID)
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella rimozione dallo staff", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nella rimozione dallo staff", http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Redirect(w, r, "/admin/staff?error=member_not_found", http.StatusSeeOther)
+		return
+	}
+
+	RecordAuditLogAsync("STAFF_REMOVED", "user", userID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/admin/staff?success=member_removed", http.StatusSeeOther)
+}
+
+// RevokeStaffInvitationHandler annulla un invito non ancora accettato
+func RevokeStaffInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err := db.MongoInstance.DeleteStaffInvitation(ctx, mux.Vars(r)["id"], restaurant.ID); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella revoca dell'invito", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		http.Error(w, "Errore nella revoca dell'invito", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/staff?success=invitation_revoked", http.StatusSeeOther)
+}
+
+// loadStaffInvitation recupera l'invito valido del token insieme al ristorante
+func loadStaffInvitation(ctx context.Context, token string) (*models.StaffInvitation, *models.Restaurant) {
+	if token == "" {
+		return nil, nil
+	}
+	invitation, err := db.MongoInstance.GetStaffInvitation(ctx, hashVerificationToken(token))
+	if err != nil || invitation == nil || time.Now().After(invitation.ExpiresAt) {
+		return nil, nil
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, invitation.RestaurantID)
+	if err != nil || restaurant == nil || !restaurant.IsActive {
+		return nil, nil
+	}
+	return invitation, restaurant
+}
+
+// StaffInvitationHandler mostra l'invito: chi ha già effettuato l'accesso lo accetta con un
+// clic, gli altri accedono o si registrano con l'email invitata e riaprono il link
+func StaffInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	token := r.URL.Query().Get("token")
+	invitation, restaurant := loadStaffInvitation(ctx, token)
+	data := struct {
+		Valid          bool
+		Token          string
+		RestaurantName string
+		Email          string
+		RoleLabel      string
+		LoggedIn       bool
+		Error          string
+		CSRFToken      string
+	}{
+		Token:     token,
+		Error:     r.URL.Query().Get("error"),
+		CSRFToken: csrfToken(w, r),
+	}
+	if invitation != nil {
+		data.Valid = true
+		data.RestaurantName = restaurant.Name
+		data.Email = invitation.Email
+		data.RoleLabel = models.RoleLabel(invitation.Role)
+	}
+	if session, err := getSessionFromRequest(r); err == nil && session != nil {
+		data.LoggedIn = true
+	}
+
+	renderTemplate(w, "staff_invitation", data)
+}
+
+// AcceptStaffInvitationHandler aggiunge l'utente loggato allo staff. L'email dell'account
+// deve coincidere con quella invitata, così il link inoltrato a terzi non è utilizzabile
+func AcceptStaffInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	user, session, err := getCurrentUser(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Errore nel parsing del form", http.StatusBadRequest)
+		return
+	}
+	token := r.FormValue("token")
+	retry := "/staff/accept?token=" + url.QueryEscape(token)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	invitation, restaurant := loadStaffInvitation(ctx, token)
+	if invitation == nil {
+		http.Redirect(w, r, retry, http.StatusSeeOther)
+		return
+	}
+	if db.NormalizeCredential(user.Email) != invitation.Email {
+		http.Redirect(w, r, retry+"&error=email_mismatch", http.StatusSeeOther)
+		return
+	}
+	if restaurant.OwnerID == user.ID {
+		http.Redirect(w, r, retry+"&error=already_owner", http.StatusSeeOther)
+		return
+	}
+
+	member := &models.RestaurantMember{
+		ID:           restaurant.ID + ":" + user.ID,
+		RestaurantID: restaurant.ID,
+		UserID:       user.ID,
+		Role:         invitation.Role,
+		InvitedBy:    invitation.InvitedBy,
+		CreatedAt:    time.Now(),
+	}
+	if err := db.MongoInstance.SaveRestaurantMember(ctx, member); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'accettazione dell'invito", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+			"user_id":       user.ID,
+		})
+		http.Error(w, "Errore nell'accettazione dell'invito", http.StatusInternalServerError)
+		return
+	}
+	db.MongoInstance.DeleteStaffInvitation(ctx, invitation.ID, restaurant.ID)
+
+	// Entra direttamente nel ristorante appena condiviso
+	session.RestaurantID = restaurant.ID
+	updateSessionInMemory(session)
+
+	RecordAuditLogAsync("STAFF_JOINED", "user", user.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,655 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"qr-menu/analytics"
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/bots"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+)
+
+// telegramBot è il bot Telegram dei ristoratori; nil se telegram.bot_token non è configurato.
+// telegramBotUsername è il nome del bot, per i link di collegamento
+var (
+	telegramBot         *bots.Bot
+	telegramBotUsername string
+)
+
+// telegramLinkTTL è la validità del link con cui si collega una chat
+const telegramLinkTTL = 15 * time.Minute
+
+// telegramMaxItemButtons è il numero massimo di piatti nella tastiera di /piatti
+const telegramMaxItemButtons = 90
+
+// telegramAvailabilityAction è l'azione dei pulsanti che cambiano la disponibilità di un piatto
+const telegramAvailabilityAction = "avail"
+
+// telegramItemAttempts è il numero di tentativi di salvataggio della disponibilità quando
+// un'altra richiesta cambia il piatto nello stesso momento
+const telegramItemAttempts = 3
+
+// SetTelegramBot imposta il bot Telegram e ne registra comandi e pulsanti: /start collega la
+// chat con il codice del link, /piatti cambia la disponibilità dei piatti, /oggi riassume la
+// giornata, /stop scollega la chat
+func SetTelegramBot(bot *bots.Bot, username string) {
+	telegramBot = bot
+	telegramBotUsername = username
+
+	bot.Command("start", telegramStart)
+	bot.Command("help", telegramHelp)
+	bot.Command("piatti", telegramItems)
+	bot.Command("items", telegramItems)
+	bot.Command("oggi", telegramToday)
+	bot.Command("today", telegramToday)
+	bot.Command("stop", telegramStop)
+	bot.Fallback(telegramHelp)
+	bot.Action(telegramAvailabilityAction, telegramToggleItem)
+
+	// Le chat che hanno bloccato il bot non ricevono più nulla
+	bot.OnUnavailable = func(ctx context.Context, chatID int64) {
+		if _, err := db.MongoInstance.DeleteTelegramChat(ctx, "", chatID); err != nil {
+			logger.WarnCtx(ctx, "Errore nello scollegamento della chat Telegram", map[string]interface{}{
+				"error":   err.Error(),
+				"chat_id": chatID,
+			})
+		}
+	}
+}
+
+// TelegramWebhookHandler riceve gli aggiornamenti del bot (POST /api/v1/public/telegram/webhook),
+// autenticati dal secret registrato con il webhook
+func TelegramWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if telegramBot == nil {
+		httputil.NotFound(w, "Endpoint")
+		return
+	}
+	telegramBot.ServeHTTP(w, r)
+}
+
+// telegramText compone un messaggio del bot nella lingua della chat
+func telegramText(locale, key string, data map[string]interface{}) (string, error) {
+	msg, err := i18n.Default().Render(locale, key, data)
+	if err != nil {
+		return "", err
+	}
+	return msg.Body, nil
+}
+
+// telegramReply compone la risposta a un comando nella lingua della chat
+func telegramReply(locale, key string, data map[string]interface{}) (bots.Reply, error) {
+	text, err := telegramText(locale, key, data)
+	return bots.Reply{Text: text}, err
+}
+
+// linkedTelegramChat restituisce la chat collegata e il suo ristorante; nil se la chat non è
+// collegata o il ristorante non esiste più
+func linkedTelegramChat(ctx context.Context, chatID int64) (*models.TelegramChat, *models.Restaurant, error) {
+	chat, err := db.MongoInstance.GetTelegramChat(ctx, chatID)
+	if err != nil || chat == nil {
+		return nil, nil, err
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, chat.RestaurantID)
+	if err != nil || restaurant == nil {
+		return nil, nil, err
+	}
+	return chat, restaurant, nil
+}
+
+// telegramChatAllowed indica se l'utente che ha collegato la chat ha ancora il permesso sul
+// ristorante: i comandi agiscono con il suo ruolo attuale
+func telegramChatAllowed(ctx context.Context, chat *models.TelegramChat, restaurant *models.Restaurant, perm string) bool {
+	role, err := restaurantRole(ctx, restaurant, chat.UserID)
+	return err == nil && models.RoleHasPermission(role, perm)
+}
+
+// telegramStart collega la chat con il codice del link (/start <codice>); senza codice
+// mostra i comandi
+func telegramStart(ctx context.Context, c bots.Chat, args string) (bots.Reply, error) {
+	if args == "" {
+		return telegramHelp(ctx, c, args)
+	}
+	link, err := db.MongoInstance.ConsumeTelegramLinkCode(ctx, args)
+	if err != nil {
+		return bots.Reply{}, err
+	}
+	if link == nil {
+		return telegramReply(c.Language, i18n.KeyTelegramInvalidLink, nil)
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, link.RestaurantID)
+	if err != nil {
+		return bots.Reply{}, err
+	}
+	if restaurant == nil {
+		return telegramReply(c.Language, i18n.KeyTelegramInvalidLink, nil)
+	}
+
+	locale := c.Language
+	if user, err := db.MongoInstance.GetUserByID(ctx, link.UserID); err == nil && user != nil && user.Locale != "" {
+		locale = user.Locale
+	}
+	chat := &models.TelegramChat{
+		ID:           c.ID,
+		RestaurantID: restaurant.ID,
+		UserID:       link.UserID,
+		Username:     c.Username,
+		Name:         c.Name,
+		Locale:       i18n.Default().Resolve(locale),
+		LinkedAt:     time.Now(),
+	}
+	if err := db.MongoInstance.SaveTelegramChat(ctx, chat); err != nil {
+		return bots.Reply{}, err
+	}
+	logger.InfoCtx(ctx, "Chat Telegram collegata", map[string]interface{}{
+		"restaurant_id": restaurant.ID,
+		"user_id":       link.UserID,
+	})
+	return telegramReply(chat.Locale, i18n.KeyTelegramLinked, map[string]interface{}{"RestaurantName": restaurant.Name})
+}
+
+// telegramHelp mostra i comandi alle chat collegate e come collegarsi alle altre
+func telegramHelp(ctx context.Context, c bots.Chat, _ string) (bots.Reply, error) {
+	chat, restaurant, err := linkedTelegramChat(ctx, c.ID)
+	if err != nil {
+		return bots.Reply{}, err
+	}
+	if chat == nil {
+		return telegramReply(c.Language, i18n.KeyTelegramNotLinked, nil)
+	}
+	return telegramReply(chat.Locale, i18n.KeyTelegramHelp, map[string]interface{}{"RestaurantName": restaurant.Name})
+}
+
+// telegramStop scollega la chat
+func telegramStop(ctx context.Context, c bots.Chat, _ string) (bots.Reply, error) {
+	chat, restaurant, err := linkedTelegramChat(ctx, c.ID)
+	if err != nil {
+		return bots.Reply{}, err
+	}
+	if chat == nil {
+		return telegramReply(c.Language, i18n.KeyTelegramNotLinked, nil)
+	}
+	if _, err := db.MongoInstance.DeleteTelegramChat(ctx, "", c.ID); err != nil {
+		return bots.Reply{}, err
+	}
+	return telegramReply(chat.Locale, i18n.KeyTelegramUnlinked, map[string]interface{}{"RestaurantName": restaurant.Name})
+}
+
+// activeRestaurantMenu restituisce il menu attivo del ristorante, nil se non ce n'è uno
+func activeRestaurantMenu(ctx context.Context, restaurantID string) (*models.Menu, error) {
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	for _, menu := range menus {
+		if menu.IsActive {
+			return menu, nil
+		}
+	}
+	return nil, nil
+}
+
+// telegramItemButtons restituisce un pulsante per piatto del menu con la sua disponibilità,
+// al massimo telegramMaxItemButtons, e se ne ha esclusi
+func telegramItemButtons(menu *models.Menu) ([][]bots.Button, bool) {
+	var buttons [][]bots.Button
+	for _, category := range menu.Categories {
+		for _, item := range category.Items {
+			if len(buttons) == telegramMaxItemButtons {
+				return buttons, true
+			}
+			data, err := bots.ActionData(telegramAvailabilityAction, item.ID)
+			if err != nil {
+				continue
+			}
+			mark := "❌"
+			if item.Available {
+				mark = "✅"
+			}
+			buttons = append(buttons, []bots.Button{{Text: mark + " " + item.Name, Data: data}})
+		}
+	}
+	return buttons, false
+}
+
+// telegramItems mostra i piatti del menu attivo con un pulsante per cambiarne la disponibilità
+func telegramItems(ctx context.Context, c bots.Chat, _ string) (bots.Reply, error) {
+	chat, restaurant, err := linkedTelegramChat(ctx, c.ID)
+	if err != nil {
+		return bots.Reply{}, err
+	}
+	if chat == nil {
+		return telegramReply(c.Language, i18n.KeyTelegramNotLinked, nil)
+	}
+	if !telegramChatAllowed(ctx, chat, restaurant, models.PermMenusWrite) {
+		return telegramReply(chat.Locale, i18n.KeyTelegramForbidden, map[string]interface{}{"RestaurantName": restaurant.Name})
+	}
+
+	menu, err := activeRestaurantMenu(ctx, restaurant.ID)
+	if err != nil {
+		return bots.Reply{}, err
+	}
+	data := map[string]interface{}{"MenuName": "", "Truncated": false, "Shown": telegramMaxItemButtons}
+	var buttons [][]bots.Button
+	if menu != nil {
+		data["MenuName"] = menu.Name
+		buttons, data["Truncated"] = telegramItemButtons(menu)
+	}
+	reply, err := telegramReply(chat.Locale, i18n.KeyTelegramItems, data)
+	reply.Buttons = buttons
+	return reply, err
+}
+
+// telegramToggleItem cambia la disponibilità del piatto del pulsante premuto e aggiorna i
+// pulsanti del messaggio. Come le modifiche dal pannello, pubblica item.updated e aggiorna i
+// menu pubblici in cache
+func telegramToggleItem(ctx context.Context, c bots.Chat, itemID string) (string, [][]bots.Button, error) {
+	chat, restaurant, err := linkedTelegramChat(ctx, c.ID)
+	if err != nil || chat == nil {
+		return "", nil, err
+	}
+	if !telegramChatAllowed(ctx, chat, restaurant, models.PermMenusWrite) {
+		notice, err := telegramText(chat.Locale, i18n.KeyTelegramForbidden, map[string]interface{}{"RestaurantName": restaurant.Name})
+		return notice, nil, err
+	}
+	found, _, _, err := findRestaurantItem(ctx, restaurant.ID, itemID)
+	if err != nil || found == nil || found.IsArchived {
+		return "", nil, err
+	}
+
+	// Come per le giacenze, il salvataggio riesce solo se il piatto non è cambiato nel frattempo
+	for attempt := 0; attempt < telegramItemAttempts; attempt++ {
+		menu, err := db.MongoInstance.GetMenuByID(ctx, found.ID)
+		if err != nil || menu == nil {
+			return "", nil, err
+		}
+		item := locateMenuItem(menu, itemID)
+		if item == nil {
+			return "", nil, nil
+		}
+		var before *int
+		if item.Inventory != nil {
+			quantity := item.Inventory.Quantity
+			before = &quantity
+		}
+		item.Available = !item.Available
+		saved, err := db.MongoInstance.UpdateItemInventory(ctx, menu.ID, *item, before)
+		if err != nil {
+			return "", nil, err
+		}
+		if !saved {
+			continue
+		}
+
+		eventBus.Publish(events.Event{Type: events.ItemUpdated, RestaurantID: menu.RestaurantID, ActorID: chat.UserID, Data: map[string]interface{}{
+			"menu_id":   menu.ID,
+			"item_id":   item.ID,
+			"name":      item.Name,
+			"price":     item.Price,
+			"available": item.Available,
+			"change":    "updated",
+		}})
+		if publicMenuCache != nil {
+			publicMenuCache.InvalidateKey(publicMenuCacheKey(menu.ID))
+			scheduleMenuWarmUp(menu.RestaurantID)
+		}
+		RecordAuditLogAsync("ITEM_AVAILABILITY_TELEGRAM", "menu_item", item.ID, restaurant.ID, "", "telegram", "success")
+
+		key := i18n.KeyTelegramItemSoldOut
+		if item.Available {
+			key = i18n.KeyTelegramItemAvailable
+		}
+		notice, err := telegramText(chat.Locale, key, map[string]interface{}{"Name": item.Name})
+		buttons, _ := telegramItemButtons(menu)
+		return notice, buttons, err
+	}
+	return "", nil, errStockConflict
+}
+
+// telegramDailySummary riassume la giornata del ristorante fino a now: visite, scansioni QR
+// e ordini non annullati con il loro totale
+func telegramDailySummary(ctx context.Context, restaurant *models.Restaurant, now time.Time) (map[string]interface{}, error) {
+	day := truncateToDay(now)
+	stats := analytics.GetAnalytics().GetMenuPeriodStats(restaurant.ID, "", nil, day, day)
+
+	orders := 0
+	var revenue int64
+	err := db.MongoInstance.StreamOrders(ctx, db.OrderFilter{RestaurantID: restaurant.ID, Since: day, Until: now}, func(order *models.Order) error {
+		if order.Status != models.OrderStatusCancelled {
+			orders++
+			revenue += toCents(order.Total)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"RestaurantName": restaurant.Name,
+		"Day":            day,
+		"Views":          stats.RestaurantViews,
+		"QRScans":        stats.QRScans,
+		"Orders":         orders,
+		"Revenue":        formatCents(revenue, orderCurrency(restaurant)),
+	}, nil
+}
+
+// telegramToday mostra il riepilogo della giornata fino a ora
+func telegramToday(ctx context.Context, c bots.Chat, _ string) (bots.Reply, error) {
+	chat, restaurant, err := linkedTelegramChat(ctx, c.ID)
+	if err != nil {
+		return bots.Reply{}, err
+	}
+	if chat == nil {
+		return telegramReply(c.Language, i18n.KeyTelegramNotLinked, nil)
+	}
+	if !telegramChatAllowed(ctx, chat, restaurant, models.PermAnalyticsRead) {
+		return telegramReply(chat.Locale, i18n.KeyTelegramForbidden, map[string]interface{}{"RestaurantName": restaurant.Name})
+	}
+	data, err := telegramDailySummary(ctx, restaurant, time.Now())
+	if err != nil {
+		return bots.Reply{}, err
+	}
+	return telegramReply(chat.Locale, i18n.KeyTelegramDailySummary, data)
+}
+
+// orderNoticeData restituisce i dati dei messaggi che annunciano un nuovo ordine al
+// ristorante, su Telegram, Slack e Discord
+func orderNoticeData(order *models.Order, restaurant *models.Restaurant) map[string]interface{} {
+	data := map[string]interface{}{
+		"RestaurantName": restaurant.Name,
+		"Number":         order.Number,
+		"Table":          order.Table,
+		"Lines":          order.Lines,
+		"Total":          formatCents(toCents(order.Total), orderCurrency(restaurant)),
+		"Mode":           "",
+		"Slot":           time.Time{},
+	}
+	if f := order.Fulfillment; f != nil {
+		slot := f.SlotStart.In(time.Local)
+		data["Mode"] = f.Mode
+		data["Slot"] = slot
+		data["SlotTime"] = slot.Format("15:04")
+	}
+	return data
+}
+
+// telegramOrderNotice avvisa dei nuovi ordini le chat collegate al ristorante i cui utenti
+// gestiscono gli ordini
+func telegramOrderNotice(ctx context.Context, event events.Event) ([]bots.Notice, error) {
+	chats, err := db.MongoInstance.GetTelegramChats(ctx, event.RestaurantID)
+	if err != nil || len(chats) == 0 {
+		return nil, err
+	}
+	orderID, _ := event.Data["order_id"].(string)
+	order, err := db.MongoInstance.GetOrder(ctx, orderID, event.RestaurantID)
+	if err != nil || order == nil {
+		return nil, err
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, event.RestaurantID)
+	if err != nil || restaurant == nil {
+		return nil, err
+	}
+
+	data := orderNoticeData(order, restaurant)
+	var notices []bots.Notice
+	for _, chat := range chats {
+		if !telegramChatAllowed(ctx, chat, restaurant, models.PermOrdersManage) {
+			continue
+		}
+		text, err := telegramText(chat.Locale, i18n.KeyTelegramNewOrder, data)
+		if err != nil {
+			return nil, err
+		}
+		notices = append(notices, bots.Notice{ChatID: chat.ID, Reply: bots.Reply{Text: text}})
+	}
+	return notices, nil
+}
+
+// nextTelegramSummaryTime restituisce il prossimo orario del riepilogo serale, at nella forma HH:MM
+func nextTelegramSummaryTime(now time.Time, at string) time.Time {
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		clock = time.Date(0, 1, 1, 21, 0, 0, 0, time.UTC)
+	}
+	next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// SendTelegramDailySummaries invia il riepilogo della giornata alle chat che l'hanno attivato,
+// calcolandolo una volta per ristorante. Restituisce il numero di riepiloghi inviati
+func SendTelegramDailySummaries(ctx context.Context, now time.Time) (int, error) {
+	if telegramBot == nil || db.MongoInstance == nil {
+		return 0, nil
+	}
+
+	var (
+		restaurant *models.Restaurant
+		data       map[string]interface{}
+		sent       int
+	)
+	err := db.MongoInstance.StreamTelegramDailyChats(ctx, func(chat *models.TelegramChat) error {
+		if restaurant == nil || restaurant.ID != chat.RestaurantID {
+			var err error
+			if restaurant, err = db.MongoInstance.GetRestaurantByID(ctx, chat.RestaurantID); err != nil {
+				return err
+			}
+			if restaurant == nil {
+				return nil
+			}
+			if data, err = telegramDailySummary(ctx, restaurant, now); err != nil {
+				return err
+			}
+		}
+		if restaurant == nil || !telegramChatAllowed(ctx, chat, restaurant, models.PermAnalyticsRead) {
+			return nil
+		}
+		text, err := telegramText(chat.Locale, i18n.KeyTelegramDailySummary, data)
+		if err != nil {
+			return err
+		}
+		if err := telegramBot.Send(ctx, chat.ID, bots.Reply{Text: text}); err != nil {
+			if !errors.Is(err, bots.ErrChatUnavailable) {
+				logger.WarnCtx(ctx, "Errore nell'invio del riepilogo Telegram", map[string]interface{}{
+					"error":         err.Error(),
+					"restaurant_id": chat.RestaurantID,
+				})
+			}
+			return nil
+		}
+		sent++
+		return nil
+	})
+	return sent, err
+}
+
+// RunTelegramDailyWorker invia ogni giorno all'orario at (HH:MM) il riepilogo della giornata
+// alle chat Telegram che l'hanno attivato, finché ctx non viene annullato. È bloccante: va
+// avviato in una goroutine
+func RunTelegramDailyWorker(ctx context.Context, at string) {
+	for {
+		timer := time.NewTimer(time.Until(nextTelegramSummaryTime(time.Now(), at)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+		sent, err := SendTelegramDailySummaries(runCtx, time.Now())
+		cancel()
+		if err != nil {
+			logger.Error("Errore nell'invio dei riepiloghi Telegram", map[string]interface{}{
+				"error": err.Error(),
+				"sent":  sent,
+			})
+			continue
+		}
+		logger.Info("Riepiloghi Telegram inviati", map[string]interface{}{
+			"sent": sent,
+		})
+	}
+}
+
+// CreateTelegramLinkHandler crea il link con cui l'utente collega una chat Telegram al
+// ristorante (POST /api/v1/telegram/link). Il link vale telegramLinkTTL e una sola volta
+func CreateTelegramLinkHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	if telegramBot == nil {
+		httputil.Conflict(w, "Il bot Telegram non è configurato")
+		return
+	}
+	userID := requestActorID(r)
+	if userID == "" {
+		httputil.Forbidden(w, "Il collegamento di una chat richiede l'accesso con un utente")
+		return
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		respondMenuV2Error(w, r, fmt.Errorf("errore generazione codice Telegram: %v", err), "Errore nella creazione del link")
+		return
+	}
+	link := &models.TelegramLinkCode{
+		Code:         hex.EncodeToString(buf),
+		RestaurantID: restaurant.ID,
+		UserID:       userID,
+		ExpiresAt:    time.Now().Add(telegramLinkTTL),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.CreateTelegramLinkCode(ctx, link); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella creazione del link")
+		return
+	}
+	httputil.Created(w, "Link Telegram creato", map[string]interface{}{
+		"url":        "https://t.me/" + url.PathEscape(telegramBotUsername) + "?start=" + link.Code,
+		"expires_at": link.ExpiresAt,
+	})
+}
+
+// ListTelegramChatsHandler elenca le chat Telegram collegate al ristorante
+// (GET /api/v1/telegram/chats)
+func ListTelegramChatsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	chats, err := db.MongoInstance.GetTelegramChats(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero delle chat Telegram")
+		return
+	}
+	if chats == nil {
+		chats = []*models.TelegramChat{}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Chat Telegram", map[string]interface{}{
+		"enabled": telegramBot != nil,
+		"chats":   chats,
+	})
+}
+
+// telegramChatID legge l'ID della chat dal percorso; risponde 400 se non è valido
+func telegramChatID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		httputil.BadRequest(w, "ID della chat non valido")
+		return 0, false
+	}
+	return id, true
+}
+
+// UpdateTelegramChatHandler attiva o disattiva il riepilogo serale di una chat
+// (PUT /api/v1/telegram/chats/{id})
+func UpdateTelegramChatHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	chatID, ok := telegramChatID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		DailySummary *bool `json:"daily_summary"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if req.DailySummary == nil {
+		httputil.BadRequest(w, "daily_summary è obbligatorio")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	found, err := db.MongoInstance.SetTelegramChatDailySummary(ctx, restaurant.ID, chatID, *req.DailySummary)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'aggiornamento della chat Telegram")
+		return
+	}
+	if !found {
+		httputil.NotFound(w, "Chat")
+		return
+	}
+	httputil.Success(w, "Chat Telegram aggiornata", map[string]interface{}{
+		"id":            chatID,
+		"daily_summary": *req.DailySummary,
+	})
+}
+
+// DeleteTelegramChatHandler scollega una chat dal ristorante (DELETE /api/v1/telegram/chats/{id})
+func DeleteTelegramChatHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	chatID, ok := telegramChatID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	found, err := db.MongoInstance.DeleteTelegramChat(ctx, restaurant.ID, chatID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nello scollegamento della chat Telegram")
+		return
+	}
+	if !found {
+		httputil.NotFound(w, "Chat")
+		return
+	}
+	RecordAuditLogAsync("TELEGRAM_CHAT_UNLINKED", "telegram_chat", strconv.FormatInt(chatID, 10), restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
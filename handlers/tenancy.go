@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/tenancy"
+)
+
+// requireTenant limita la richiesta al ristorante della sessione (o della API key): i
+// dati dei ristoranti vanno letti con il ristorante del contesto, mai con ID presi dalla
+// richiesta. Senza ristorante selezionato la richiesta viene rimandata al login
+var requireTenant = tenancy.Middleware(
+	func(r *http.Request) (string, error) {
+		restaurant, err := getCurrentRestaurant(r)
+		if err != nil {
+			return "", err
+		}
+		return restaurant.ID, nil
+	},
+	func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.WarnCtx(r.Context(), "Accesso negato: ristorante non selezionato", map[string]interface{}{
+			"error": err.Error(),
+			"url":   r.URL.Path,
+		})
+		http.Redirect(w, r, "/login", http.StatusFound)
+	},
+)
+
+// tenantMenu carica il menu menuID del ristorante della richiesta. I menu di altri
+// ristoranti risultano inesistenti (nil, nil); senza ristorante nel contesto restituisce
+// tenancy.ErrNoScope
+func tenantMenu(ctx context.Context, menuID string) (*models.Menu, error) {
+	restaurantID, ok := tenancy.RestaurantID(ctx)
+	if !ok {
+		logger.WarnCtx(ctx, "Menu richiesto senza ristorante nel contesto", map[string]interface{}{
+			"menu_id": menuID,
+		})
+		return nil, tenancy.ErrNoScope
+	}
+	return db.MongoInstance.GetRestaurantMenu(ctx, menuID, restaurantID)
+}
@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// menuTrash è il cestino di un ristorante: i menu eliminati e i piatti eliminati dai menu
+// ancora in uso, dal più recente
+type menuTrash struct {
+	Menus []trashedMenu `json:"menus"`
+	Items []trashedItem `json:"items"`
+}
+
+// trashedMenu è un menu nel cestino con la data della cancellazione definitiva
+type trashedMenu struct {
+	*models.Menu
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// trashedItem è un piatto nel cestino con il menu a cui appartiene
+type trashedItem struct {
+	models.DeletedMenuItem
+	MenuID    string    `json:"menu_id"`
+	MenuName  string    `json:"menu_name"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// trashMenuItem sposta il piatto Items[ii] della categoria ci nel cestino del menu e lo restituisce
+func trashMenuItem(menu *models.Menu, ci, ii int) models.MenuItem {
+	category := &menu.Categories[ci]
+	item := category.Items[ii]
+	category.Items = append(category.Items[:ii], category.Items[ii+1:]...)
+	menu.DeletedItems = append(menu.DeletedItems, models.DeletedMenuItem{
+		Item:         item,
+		CategoryID:   category.ID,
+		CategoryName: category.Name,
+		DeletedAt:    time.Now(),
+	})
+	return item
+}
+
+// restoreMenuItem riporta un piatto dal cestino del menu nella sua categoria o, se nel
+// frattempo è stata eliminata, in una categoria con lo stesso nome (creata se manca).
+// Restituisce nil se il piatto non è nel cestino
+func restoreMenuItem(menu *models.Menu, itemID string) *models.MenuItem {
+	for i, deleted := range menu.DeletedItems {
+		if deleted.Item.ID != itemID {
+			continue
+		}
+		menu.DeletedItems = append(menu.DeletedItems[:i], menu.DeletedItems[i+1:]...)
+
+		ci := -1
+		for j, category := range menu.Categories {
+			if category.ID == deleted.CategoryID {
+				ci = j
+				break
+			}
+		}
+		if ci < 0 {
+			for j, category := range menu.Categories {
+				if category.Name == deleted.CategoryName {
+					ci = j
+					break
+				}
+			}
+		}
+		if ci < 0 {
+			menu.Categories = append(menu.Categories, models.MenuCategory{
+				ID:           uuid.New().String(),
+				Name:         deleted.CategoryName,
+				DisplayOrder: len(menu.Categories),
+			})
+			ci = len(menu.Categories) - 1
+		}
+
+		category := &menu.Categories[ci]
+		category.Items = append(category.Items, deleted.Item)
+		return &category.Items[len(category.Items)-1]
+	}
+	return nil
+}
+
+// loadMenuTrash legge il cestino del ristorante. Gli elementi già scaduti ma non ancora
+// eliminati dal job di pulizia non vengono mostrati
+func loadMenuTrash(ctx context.Context, restaurantID string) (*menuTrash, error) {
+	cutoff := time.Now().Add(-models.MenuTrashRetention)
+	trash := &menuTrash{Menus: []trashedMenu{}, Items: []trashedItem{}}
+
+	deleted, err := db.MongoInstance.GetDeletedMenus(ctx, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	for _, menu := range deleted {
+		if menu.DeletedAt.After(cutoff) {
+			trash.Menus = append(trash.Menus, trashedMenu{Menu: menu, ExpiresAt: menu.DeletedAt.Add(models.MenuTrashRetention)})
+		}
+	}
+
+	menus, err := db.MongoInstance.GetMenusByRestaurantID(ctx, restaurantID)
+	if err != nil {
+		return nil, err
+	}
+	for _, menu := range menus {
+		for _, item := range menu.DeletedItems {
+			if item.DeletedAt.After(cutoff) {
+				trash.Items = append(trash.Items, trashedItem{
+					DeletedMenuItem: item,
+					MenuID:          menu.ID,
+					MenuName:        menu.Name,
+					ExpiresAt:       item.DeletedAt.Add(models.MenuTrashRetention),
+				})
+			}
+		}
+	}
+	sort.Slice(trash.Items, func(i, j int) bool {
+		return trash.Items[i].DeletedAt.After(trash.Items[j].DeletedAt)
+	})
+	return trash, nil
+}
+
+// restoreTrashedMenu toglie dal cestino il menu id del ristorante. Il menu torna tra quelli
+// del ristorante senza essere attivato. Restituisce nil se il menu non è nel cestino
+func restoreTrashedMenu(ctx context.Context, restaurantID, id string) (*models.Menu, error) {
+	menu, err := db.MongoInstance.GetDeletedMenu(ctx, id, restaurantID)
+	if err != nil || menu == nil {
+		return nil, err
+	}
+	restored, err := db.MongoInstance.RestoreDeletedMenu(ctx, menu.ID)
+	if err != nil || !restored {
+		return nil, err
+	}
+	menu.DeletedAt = time.Time{}
+	menu.UpdatedAt = time.Now()
+	return menu, nil
+}
+
+// purgeDeletedMenu elimina definitivamente un menu nel cestino e il suo QR code. Le foto
+// dei piatti restano: possono essere condivise con le copie del menu
+func purgeDeletedMenu(ctx context.Context, menu *models.Menu) error {
+	if menu.QRCodePath != "" {
+		if err := blobStore.Delete(ctx, blobKeyFromURL(menu.QRCodePath)); err != nil {
+			log.Printf("Errore nell'eliminazione del QR code: %v", err)
+		}
+	}
+	return db.MongoInstance.PurgeDeletedMenu(ctx, menu.ID)
+}
+
+// PurgeMenuTrash elimina definitivamente menu e piatti nel cestino da più di
+// MenuTrashRetention. Le analytics che li referenziano restano e seguono la loro retention.
+// Restituisce quanti menu e piatti sono stati eliminati
+func PurgeMenuTrash(ctx context.Context) (menus, items int) {
+	cutoff := time.Now().Add(-models.MenuTrashRetention)
+
+	expired, err := db.MongoInstance.GetMenusDeletedBefore(ctx, cutoff)
+	if err != nil {
+		logger.Error("Errore nella lettura dei menu nel cestino", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return 0, 0
+	}
+	for _, menu := range expired {
+		if err := purgeDeletedMenu(ctx, menu); err != nil {
+			logger.Error("Errore nell'eliminazione definitiva del menu", map[string]interface{}{
+				"error":   err.Error(),
+				"menu_id": menu.ID,
+			})
+			continue
+		}
+		menus++
+	}
+
+	withItems, err := db.MongoInstance.GetMenusWithDeletedItemsBefore(ctx, cutoff)
+	if err != nil {
+		logger.Error("Errore nella lettura dei piatti nel cestino", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return menus, 0
+	}
+	for _, menu := range withItems {
+		kept := menu.DeletedItems[:0]
+		for _, item := range menu.DeletedItems {
+			if item.DeletedAt.After(cutoff) {
+				kept = append(kept, item)
+			}
+		}
+		purged := len(menu.DeletedItems) - len(kept)
+		menu.DeletedItems = kept
+		if err := db.MongoInstance.UpdateMenu(ctx, menu); err != nil {
+			logger.Error("Errore nell'eliminazione definitiva dei piatti", map[string]interface{}{
+				"error":   err.Error(),
+				"menu_id": menu.ID,
+			})
+			continue
+		}
+		items += purged
+	}
+
+	if menus > 0 || items > 0 {
+		logger.Info("Cestino dei menu svuotato", map[string]interface{}{
+			"menus": menus,
+			"items": items,
+		})
+	}
+	return menus, items
+}
+
+// RunMenuTrashWorker svuota periodicamente il cestino dei menu finché ctx non viene
+// annullato. È bloccante: va avviato in una goroutine
+func RunMenuTrashWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+			PurgeMenuTrash(runCtx)
+			cancel()
+		}
+	}
+}
+
+// MenuTrashHandler mostra il cestino: menu e piatti eliminati negli ultimi 30 giorni
+func MenuTrashHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	trash, err := loadMenuTrash(ctx, restaurant.ID)
+	if err != nil {
+		log.Printf("Errore nel recupero del cestino: %v", err)
+		http.Error(w, "Errore nel caricamento del cestino", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Restaurant *models.Restaurant
+		Trash      *menuTrash
+		Success    string
+		Error      string
+		CSRFToken  string
+	}{
+		Restaurant: restaurant,
+		Trash:      trash,
+		Success:    r.URL.Query().Get("success"),
+		Error:      r.URL.Query().Get("error"),
+		CSRFToken:  csrfToken(w, r),
+	}
+
+	renderTemplate(w, "trash", data)
+}
+
+// RestoreTrashedMenuHandler ripristina un menu dal cestino (POST /admin/trash/menus/{id}/restore)
+func RestoreTrashedMenuHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant, err := getCurrentRestaurant(r)
+	if handleAuthError(w, r, err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, err := restoreTrashedMenu(ctx, restaurant.ID, mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("Errore nel ripristino del menu dal cestino: %v", err)
+		http.Error(w, "Errore nel ripristino del menu", http.StatusInternalServerError)
+		return
+	}
+	if menu == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	RecordAuditLogAsync("MENU_UNDELETED", "menu", menu.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	publishMenuEvent(r, events.MenuUpdated, menu)
+	http.Redirect(w, r, "/admin/trash?success=menu_restored", http.StatusSeeOther)
+}
+
+// RestoreTrashedItemHandler riporta un piatto dal cestino nel suo menu
+// (POST /admin/trash/menus/{menuId}/items/{itemId}/restore)
+func RestoreTrashedItemHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, err := tenantMenu(ctx, vars["menuId"])
+	if err != nil || menu == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if menu.IsArchived {
+		http.Redirect(w, r, "/admin/trash?error=archived", http.StatusSeeOther)
+		return
+	}
+
+	item := restoreMenuItem(menu, vars["itemId"])
+	if item == nil {
+		http.NotFound(w, r)
+		return
+	}
+	menu.UpdatedAt = time.Now()
+	if err := db.MongoInstance.UpdateMenu(ctx, menu); err != nil {
+		log.Printf("Errore nel ripristino del piatto: %v", err)
+		http.Error(w, "Errore nel ripristino del piatto", http.StatusInternalServerError)
+		return
+	}
+
+	publishItemEvent(r, menu, item, "created")
+	http.Redirect(w, r, "/admin/trash?success=item_restored", http.StatusSeeOther)
+}
+
+// MenuTrashV2Handler restituisce il cestino del ristorante (GET /api/v2/trash)
+func MenuTrashV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	trash, err := loadMenuTrash(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del cestino")
+		return
+	}
+	httputil.Success(w, "Cestino", trash)
+}
+
+// RestoreTrashedMenuV2Handler ripristina un menu dal cestino
+// (POST /api/v2/trash/menus/{id}/restore)
+func RestoreTrashedMenuV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, err := restoreTrashedMenu(ctx, restaurant.ID, mux.Vars(r)["id"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel ripristino del menu")
+		return
+	}
+	if menu == nil {
+		httputil.NotFound(w, "Menu nel cestino")
+		return
+	}
+
+	RecordAuditLogAsync("MENU_UNDELETED", "menu", menu.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	publishMenuEvent(r, events.MenuUpdated, menu)
+	httputil.Success(w, "Menu ripristinato", menu)
+}
+
+// RestoreTrashedItemV2Handler riporta un piatto dal cestino nel suo menu
+// (POST /api/v2/trash/menus/{menuId}/items/{itemId}/restore)
+func RestoreTrashedItemV2Handler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	vars := mux.Vars(r)
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	menu, err := tenantMenu(ctx, vars["menuId"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del menu")
+		return
+	}
+	if menu == nil {
+		httputil.NotFound(w, "Menu")
+		return
+	}
+	if rejectArchivedMenuV2(w, menu) {
+		return
+	}
+
+	item := restoreMenuItem(menu, vars["itemId"])
+	if item == nil {
+		httputil.NotFound(w, "Piatto nel cestino")
+		return
+	}
+	if !saveMenuV2(ctx, w, r, menu) {
+		return
+	}
+
+	publishItemEvent(r, menu, item, "created")
+	httputil.Success(w, "Piatto ripristinato", item)
+}
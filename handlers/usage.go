@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/billing"
+	"qr-menu/pkg/config"
+	httputil "qr-menu/pkg/http"
+)
+
+// usageFlushInterval è ogni quanto i contatori di utilizzo in memoria vengono scritti nel database
+const usageFlushInterval = 30 * time.Second
+
+// usageCounterKey identifica un contatore di utilizzo: ristorante, periodo e metrica
+type usageCounterKey struct {
+	restaurantID string
+	period       string
+	metric       string
+}
+
+// usageCounters accumula in memoria l'utilizzo tra una scrittura e l'altra, così le visite
+// ai menu pubblici non fanno un update nel database per ogni richiesta
+var (
+	usageCounters   = make(map[usageCounterKey]int64)
+	usageCountersMu sync.Mutex
+)
+
+// billingSettings contiene le soglie dei piani e il reporter verso il provider di billing,
+// impostati all'avvio. Senza reporter l'utilizzo viene solo misurato
+var (
+	billingSettings   = config.Default().Billing
+	usageReporter     billing.Reporter
+	billingSettingsMu sync.Mutex
+)
+
+// SetBilling imposta la configurazione del billing a consumo e il reporter dell'eccedenza (nil per
+// non inviarla)
+func SetBilling(cfg config.BillingConfig, reporter billing.Reporter) {
+	billingSettingsMu.Lock()
+	defer billingSettingsMu.Unlock()
+	billingSettings = cfg
+	usageReporter = reporter
+}
+
+// meterUsage conta un'unità della metrica per il ristorante nel periodo corrente
+func meterUsage(restaurantID, metric string) {
+	if restaurantID == "" {
+		return
+	}
+	key := usageCounterKey{restaurantID: restaurantID, period: models.UsagePeriod(time.Now()), metric: metric}
+	usageCountersMu.Lock()
+	usageCounters[key]++
+	usageCountersMu.Unlock()
+}
+
+// FlushUsage scrive nel database i contatori accumulati. Quelli non scritti per un errore
+// tornano nei contatori e vengono ritentati alla scrittura successiva
+func FlushUsage(ctx context.Context) error {
+	usageCountersMu.Lock()
+	pending := usageCounters
+	usageCounters = make(map[usageCounterKey]int64)
+	usageCountersMu.Unlock()
+
+	type usageDoc struct{ restaurantID, period string }
+	grouped := make(map[usageDoc]map[string]int64)
+	for key, n := range pending {
+		doc := usageDoc{key.restaurantID, key.period}
+		if grouped[doc] == nil {
+			grouped[doc] = make(map[string]int64)
+		}
+		grouped[doc][key.metric] += n
+	}
+
+	var firstErr error
+	for doc, counts := range grouped {
+		if err := db.MongoInstance.IncrementUsage(ctx, doc.restaurantID, doc.period, counts); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			usageCountersMu.Lock()
+			for metric, n := range counts {
+				usageCounters[usageCounterKey{doc.restaurantID, doc.period, metric}] += n
+			}
+			usageCountersMu.Unlock()
+		}
+	}
+	return firstErr
+}
+
+// RunUsageMeterWorker scrive i contatori di utilizzo ogni usageFlushInterval e un'ultima volta
+// quando ctx viene annullato. È bloccante: va avviato in una goroutine
+func RunUsageMeterWorker(ctx context.Context) {
+	flush := func(ctx context.Context) {
+		runCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if err := FlushUsage(runCtx); err != nil {
+			logger.Error("Errore nella scrittura dei contatori di utilizzo", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flush(context.Background())
+			return
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// ReportUsageOverage invia al provider di billing le scansioni QR oltre la soglia del piano
+// non ancora fatturate, per il mese corrente e per quello precedente (i cui ultimi contatori
+// possono arrivare dopo il cambio di mese). Restituisce il numero di ristoranti aggiornati
+func ReportUsageOverage(ctx context.Context, now time.Time) (int, error) {
+	billingSettingsMu.Lock()
+	cfg, reporter := billingSettings, usageReporter
+	billingSettingsMu.Unlock()
+	if reporter == nil {
+		return 0, nil
+	}
+
+	allowances := billing.Allowances(cfg.IncludedScans)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	reported := 0
+	for _, start := range []time.Time{monthStart.AddDate(0, -1, 0), monthStart} {
+		period := models.UsagePeriod(start)
+		// L'eccedenza di un mese chiuso va attribuita a quel mese
+		at := now
+		if end := start.AddDate(0, 1, 0).Add(-time.Second); end.Before(at) {
+			at = end
+		}
+
+		usage, err := db.MongoInstance.GetUsageByPeriod(ctx, period)
+		if err != nil {
+			return reported, err
+		}
+		for _, u := range usage {
+			sub, err := db.MongoInstance.GetActiveSubscription(ctx, u.RestaurantID)
+			if err != nil {
+				return reported, err
+			}
+			if sub == nil || sub.Provider != "stripe" || sub.ProviderCustomerID == "" {
+				continue
+			}
+			overage := allowances.Overage(sub.PlanID, u.QRScans)
+			if overage <= u.ReportedOverage {
+				continue
+			}
+
+			// L'identificativo dipende dal totale raggiunto: un report ripetuto dopo un errore
+			// non viene conteggiato due volte dal provider
+			identifier := fmt.Sprintf("%s-%s-%d", u.RestaurantID, period, overage)
+			if err := reporter.ReportUsage(ctx, sub.ProviderCustomerID, identifier, overage-u.ReportedOverage, at); err != nil {
+				return reported, fmt.Errorf("report utilizzo %s: %w", u.RestaurantID, err)
+			}
+			if err := db.MongoInstance.SetUsageReported(ctx, u.RestaurantID, period, overage, now); err != nil {
+				return reported, err
+			}
+			reported++
+		}
+	}
+	return reported, nil
+}
+
+// RunUsageReportWorker invia l'eccedenza al provider di billing ogni billing.report_interval,
+// finché ctx non viene annullato. È bloccante: va avviato in una goroutine
+func RunUsageReportWorker(ctx context.Context) {
+	billingSettingsMu.Lock()
+	interval := billingSettings.ReportInterval
+	billingSettingsMu.Unlock()
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+		reported, err := ReportUsageOverage(runCtx, time.Now())
+		cancel()
+		if err != nil {
+			logger.Error("Errore nell'invio dell'utilizzo al provider di billing", map[string]interface{}{
+				"error":    err.Error(),
+				"reported": reported,
+			})
+			continue
+		}
+		if reported > 0 {
+			logger.Info("Utilizzo a consumo inviato al provider di billing", map[string]interface{}{
+				"reported": reported,
+			})
+		}
+	}
+}
+
+// billingUsageResponse è l'utilizzo di un ristorante in un mese rispetto al suo piano
+type billingUsageResponse struct {
+	*models.BillingUsage
+	PlanID        string `json:"plan_id"`
+	IncludedScans *int64 `json:"included_qr_scans"` // null se il piano non ha limiti
+	Overage       int64  `json:"overage_qr_scans"`
+}
+
+// BillingUsageHandler restituisce l'utilizzo del ristorante selezionato in un mese
+// (GET /api/v1/billing/usage?period=YYYY-MM, default il mese corrente)
+func BillingUsageHandler(w http.ResponseWriter, r *http.Request) {
+	session, err := getSessionFromRequest(r)
+	if err != nil || session.RestaurantID == "" {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return
+	}
+
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		period = models.UsagePeriod(time.Now())
+	} else if _, err := time.Parse("2006-01", period); err != nil {
+		httputil.BadRequest(w, "Periodo non valido: usare il formato YYYY-MM")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	usage, err := db.MongoInstance.GetUsage(ctx, session.RestaurantID, period)
+	if err == nil && usage == nil {
+		usage = &models.BillingUsage{RestaurantID: session.RestaurantID, Period: period}
+	}
+	var sub *models.BillingSubscription
+	if err == nil {
+		sub, err = db.MongoInstance.GetActiveSubscription(ctx, session.RestaurantID)
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero dell'utilizzo", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": session.RestaurantID,
+		})
+		httputil.InternalServerError(w, "Errore nel recupero dell'utilizzo")
+		return
+	}
+
+	// I contatori ancora in memoria non sono nel database: li somma per un dato aggiornato
+	usageCountersMu.Lock()
+	usage.MenuViews += usageCounters[usageCounterKey{session.RestaurantID, period, models.UsageMenuViews}]
+	usage.QRScans += usageCounters[usageCounterKey{session.RestaurantID, period, models.UsageQRScans}]
+	usage.APICalls += usageCounters[usageCounterKey{session.RestaurantID, period, models.UsageAPICalls}]
+	usageCountersMu.Unlock()
+
+	billingSettingsMu.Lock()
+	allowances := billing.Allowances(billingSettings.IncludedScans)
+	billingSettingsMu.Unlock()
+
+	resp := billingUsageResponse{BillingUsage: usage, PlanID: models.FreePlanID}
+	if sub != nil {
+		resp.PlanID = sub.PlanID
+	}
+	if included, limited := allowances.Included(resp.PlanID); limited {
+		resp.IncludedScans = &included
+	}
+	resp.Overage = allowances.Overage(resp.PlanID, usage.QRScans)
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", resp)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+
+	"qr-menu/analytics"
+	"qr-menu/models"
+)
+
+// utmParams sono i parametri UTM letti dalle visite ai menu pubblici e conservati nei redirect
+var utmParams = []string{"utm_source", "utm_medium", "utm_campaign"}
+
+// menuRedirectPath restituisce l'indirizzo del menu pubblico con i parametri UTM della
+// richiesta, così la visita dopo il redirect (es. da /r/{username}) resta attribuita alla
+// campagna
+func menuRedirectPath(r *http.Request, menuID string) string {
+	path := "/menu/" + menuID
+	query := r.URL.Query()
+	utm := url.Values{}
+	for _, param := range utmParams {
+		if value := query.Get(param); value != "" {
+			utm.Set(param, value)
+		}
+	}
+	if len(utm) == 0 {
+		return path
+	}
+	return path + "?" + utm.Encode()
+}
+
+// withShortLinkUTM aggiunge alla richiesta i parametri UTM del link breve (origine e campagna
+// del link, mezzo "link"), senza sostituire quelli già presenti nell'indirizzo
+func withShortLinkUTM(r *http.Request, link *models.ShortLink) *http.Request {
+	query := r.URL.Query()
+	defaults := map[string]string{
+		"utm_source":   link.Source,
+		"utm_medium":   analytics.ScanSourceLink,
+		"utm_campaign": link.Campaign,
+	}
+	for param, value := range defaults {
+		if query.Get(param) == "" && value != "" {
+			query.Set(param, value)
+		}
+	}
+	clone := r.Clone(r.Context())
+	clone.URL.RawQuery = query.Encode()
+	return clone
+}
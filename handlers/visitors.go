@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// visitorCookieName è il cookie first-party che identifica in modo anonimo un visitatore
+// dei menu pubblici, per contare i visitatori unici su settimana e mese
+const visitorCookieName = "qrm_vid"
+
+// visitorCookiePattern accetta solo identificativi generati da ensureVisitorCookie
+var visitorCookiePattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// ensureVisitorCookie restituisce l'identificativo casuale del visitatore, creando il cookie
+// alla prima visita. Non contiene dati personali. Restituisce "" se il cookie è disattivato:
+// in quel caso il visitatore viene contato con l'impronta giornaliera anonima. Va chiamato
+// solo se trackingAllowed consente di tracciare il visitatore
+func ensureVisitorCookie(w http.ResponseWriter, r *http.Request) string {
+	analyticsSettingsMu.Lock()
+	enabled := analyticsSettings.VisitorCookie
+	analyticsSettingsMu.Unlock()
+
+	if !enabled {
+		return ""
+	}
+
+	if cookie, err := r.Cookie(visitorCookieName); err == nil && visitorCookiePattern.MatchString(cookie.Value) {
+		return cookie.Value
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	id := hex.EncodeToString(buf)
+	http.SetCookie(w, &http.Cookie{
+		Name:     visitorCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	// Una risposta con Set-Cookie non deve finire nella cache condivisa di un CDN,
+	// altrimenti tutti i visitatori riceverebbero lo stesso identificativo
+	w.Header().Set("Cache-Control", "private, max-age=60")
+	return id
+}
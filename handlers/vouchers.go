@@ -0,0 +1,680 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/skip2/go-qrcode"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/billing"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+)
+
+const (
+	// voucherCodeLength è la lunghezza del codice di un buono: basta a renderlo impossibile da
+	// indovinare, visto che vale denaro
+	voucherCodeLength = 12
+	// maxVoucherValidityDays è la durata massima configurabile di un buono
+	maxVoucherValidityDays = 5 * 365
+	// maxVoucherMessage è la lunghezza massima della dedica, in caratteri
+	maxVoucherMessage = 300
+	// maxBillingWebhookBody è la dimensione massima di una notifica del provider di billing
+	maxBillingWebhookBody = 64 << 10
+)
+
+// errVoucherNotRedeemable indica che il buono non esiste, non è attivo, è scaduto o non ha credito
+var errVoucherNotRedeemable = errors.New("buono regalo non valido, scaduto o senza credito")
+
+var voucherQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     200,
+	DefaultSort:    "-created_at",
+	Sortable:       []string{"created_at", "expires_at", "balance_cents"},
+	Filterable:     []string{"status", "code"},
+}
+
+// paymentCheckout incassa i pagamenti online dei clienti; nil se il provider di billing non è
+// configurato, e allora i buoni si emettono solo alla cassa
+var paymentCheckout billing.Checkout
+
+// SetPaymentCheckout imposta il provider dei pagamenti online (chiamato dall'initializer)
+func SetPaymentCheckout(checkout billing.Checkout) {
+	paymentCheckout = checkout
+}
+
+// defaultVoucherSettings è la configurazione di un ristorante che non l'ha ancora salvata
+func defaultVoucherSettings() *models.VoucherSettings {
+	return &models.VoucherSettings{Amounts: []int64{2500, 5000, 10000}, Currency: "EUR", ValidityDays: 365}
+}
+
+// restaurantVoucherSettings restituisce la configurazione dei buoni del ristorante, quella
+// predefinita (senza vendita online) se non è configurata
+func restaurantVoucherSettings(restaurant *models.Restaurant) *models.VoucherSettings {
+	if restaurant.Vouchers == nil {
+		return defaultVoucherSettings()
+	}
+	return restaurant.Vouchers
+}
+
+// formatCents formatta un importo in centesimi, es. "50.00 EUR"
+func formatCents(cents int64, currency string) string {
+	return fmt.Sprintf("%d.%02d %s", cents/100, cents%100, currency)
+}
+
+// formatVoucherCode divide il codice in gruppi di quattro caratteri, più facili da leggere e
+// digitare; normalizeCode toglie i trattini
+func formatVoucherCode(code string) string {
+	var groups []string
+	for len(code) > 4 {
+		groups = append(groups, code[:4])
+		code = code[4:]
+	}
+	return strings.Join(append(groups, code), "-")
+}
+
+// GetVoucherSettingsHandler restituisce la configurazione dei buoni regalo
+// (GET /api/v1/vouchers/settings)
+func GetVoucherSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	httputil.Success(w, "", restaurantVoucherSettings(restaurant))
+}
+
+// UpdateVoucherSettingsHandler configura i buoni regalo: tagli, valuta, durata e vendita online
+// (PUT /api/v1/vouchers/settings)
+func UpdateVoucherSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var settings models.VoucherSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	settings.Currency = strings.ToUpper(strings.TrimSpace(settings.Currency))
+	if len(settings.Currency) != 3 {
+		httputil.BadRequest(w, "currency deve essere un codice ISO 4217, es. EUR")
+		return
+	}
+	if settings.ValidityDays < 1 || settings.ValidityDays > maxVoucherValidityDays {
+		httputil.BadRequest(w, fmt.Sprintf("validity_days deve essere tra 1 e %d", maxVoucherValidityDays))
+		return
+	}
+	if len(settings.Amounts) > models.MaxVoucherAmounts {
+		httputil.BadRequest(w, fmt.Sprintf("massimo %d tagli", models.MaxVoucherAmounts))
+		return
+	}
+	for _, amount := range settings.Amounts {
+		if amount < models.MinVoucherCents || amount > models.MaxVoucherCents {
+			httputil.BadRequest(w, fmt.Sprintf("i tagli devono essere tra %d e %d centesimi", models.MinVoucherCents, models.MaxVoucherCents))
+			return
+		}
+	}
+	if settings.Amounts == nil {
+		settings.Amounts = []int64{}
+	}
+	if settings.OnlineSales && len(settings.Amounts) == 0 {
+		httputil.BadRequest(w, "La vendita online richiede almeno un taglio")
+		return
+	}
+	if settings.OnlineSales && paymentCheckout == nil {
+		httputil.Conflict(w, "I pagamenti online non sono configurati su questa istanza")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.SetRestaurantVoucherSettings(ctx, restaurant.ID, &settings); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio della configurazione dei buoni")
+		return
+	}
+
+	RecordAuditLogAsync("VOUCHER_SETTINGS_UPDATED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Configurazione dei buoni aggiornata", settings)
+}
+
+// ListVouchersHandler elenca i buoni regalo del ristorante (GET /api/v1/vouchers), filtrabili
+// per stato e codice: la cassa trova così il buono letto dal QR code
+func ListVouchersHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	query, err := httputil.ParseListQuery(r, voucherQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	vouchers, total, err := db.MongoInstance.FindVouchers(ctx, db.VoucherFilter{
+		RestaurantID: restaurant.ID,
+		Status:       query.Filter("status"),
+		Code:         normalizeCode(query.Filter("code")),
+	}, dbListOptions(query))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei buoni")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, vouchers, query, total)
+}
+
+// voucherRequest è il corpo dell'emissione di un buono, alla cassa o con l'acquisto online
+type voucherRequest struct {
+	AmountCents   int64  `json:"amount_cents"`
+	RecipientName string `json:"recipient_name"`
+	Message       string `json:"message"`
+	Email         string `json:"email"` // Di chi acquista: riceve il link al buono
+}
+
+// newVoucher valida la richiesta e compone il buono, ancora senza codice. Gli errori
+// restituiti sono messaggi per il client
+func newVoucher(restaurant *models.Restaurant, req voucherRequest, now time.Time) (*models.Voucher, error) {
+	if req.AmountCents < models.MinVoucherCents || req.AmountCents > models.MaxVoucherCents {
+		return nil, fmt.Errorf("amount_cents deve essere tra %d e %d", models.MinVoucherCents, models.MaxVoucherCents)
+	}
+	req.RecipientName = strings.TrimSpace(req.RecipientName)
+	req.Message = strings.TrimSpace(req.Message)
+	req.Email = strings.TrimSpace(req.Email)
+	if utf8.RuneCountInString(req.RecipientName) > 100 || utf8.RuneCountInString(req.Message) > maxVoucherMessage {
+		return nil, fmt.Errorf("destinatario o dedica troppo lunghi (massimo 100 e %d caratteri)", maxVoucherMessage)
+	}
+	if req.Email != "" {
+		if address, err := mail.ParseAddress(req.Email); err != nil || address.Address != req.Email {
+			return nil, errors.New("email non valida")
+		}
+	}
+
+	settings := restaurantVoucherSettings(restaurant)
+	return &models.Voucher{
+		ID:             uuid.New().String(),
+		RestaurantID:   restaurant.ID,
+		AmountCents:    req.AmountCents,
+		BalanceCents:   req.AmountCents,
+		Currency:       settings.Currency,
+		RecipientName:  req.RecipientName,
+		Message:        req.Message,
+		PurchaserEmail: req.Email,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		ExpiresAt:      now.AddDate(0, 0, settings.ValidityDays),
+	}, nil
+}
+
+// createVoucher salva il buono con un nuovo codice
+func createVoucher(ctx context.Context, voucher *models.Voucher) error {
+	return createWithRandomCode(voucherCodeLength, db.ErrDuplicateVoucherCode, func(code string) error {
+		voucher.Code = code
+		return db.MongoInstance.CreateVoucher(ctx, voucher)
+	})
+}
+
+// recordVoucherTransaction registra un movimento del credito già applicato al buono, con la
+// sua voce nel log di audit
+func recordVoucherTransaction(ctx context.Context, r *http.Request, voucher *models.Voucher, transactionType string, cents int64, orderID string) {
+	transaction := &models.VoucherTransaction{
+		ID:           uuid.New().String(),
+		RestaurantID: voucher.RestaurantID,
+		VoucherID:    voucher.ID,
+		Type:         transactionType,
+		AmountCents:  cents,
+		BalanceCents: voucher.BalanceCents,
+		OrderID:      orderID,
+		ActorID:      requestActorID(r),
+		CreatedAt:    time.Now(),
+	}
+	if err := db.MongoInstance.CreateVoucherTransaction(ctx, transaction); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella registrazione del movimento del buono", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": voucher.RestaurantID,
+			"voucher_id":    voucher.ID,
+		})
+	}
+	RecordAuditLogAsync("VOUCHER_"+strings.ToUpper(transactionType), "voucher", voucher.ID, voucher.RestaurantID, getClientIP(r), r.UserAgent(), "success")
+}
+
+// CreateVoucherHandler emette un buono regalo venduto alla cassa, subito attivo
+// (POST /api/v1/vouchers)
+func CreateVoucherHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	var req voucherRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	now := time.Now()
+	voucher, err := newVoucher(restaurant, req, now)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	voucher.Status = models.VoucherActive
+	voucher.Source = models.VoucherSourceCounter
+	voucher.CreatedBy = requestActorID(r)
+	voucher.ActivatedAt = &now
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := createVoucher(ctx, voucher); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'emissione del buono")
+		return
+	}
+	recordVoucherTransaction(ctx, r, voucher, models.VoucherIssue, voucher.AmountCents, "")
+
+	w.Header().Set("Location", "/api/v1/vouchers/"+voucher.ID)
+	httputil.Created(w, "Buono emesso", voucher)
+}
+
+// GetVoucherHandler restituisce un buono con tutti i movimenti del credito
+// (GET /api/v1/vouchers/{id})
+func GetVoucherHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	voucher := restaurantVoucher(ctx, w, r, restaurant)
+	if voucher == nil {
+		return
+	}
+	transactions, err := db.MongoInstance.GetVoucherTransactions(ctx, voucher.ID, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del buono")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "", map[string]interface{}{
+		"voucher":      voucher,
+		"transactions": transactions,
+	})
+}
+
+// restaurantVoucher trova il buono del ristorante dall'ID nel percorso; risponde 404 e
+// restituisce nil se non esiste
+func restaurantVoucher(ctx context.Context, w http.ResponseWriter, r *http.Request, restaurant *models.Restaurant) *models.Voucher {
+	voucher, err := db.MongoInstance.GetVoucher(ctx, mux.Vars(r)["id"], restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del buono")
+		return nil
+	}
+	if voucher == nil {
+		httputil.NotFound(w, "Buono")
+		return nil
+	}
+	return voucher
+}
+
+// VoucherQRHandler restituisce il QR code PNG con il codice del buono, da stampare o
+// consegnare (GET /api/v1/vouchers/{id}/qr)
+func VoucherQRHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	voucher := restaurantVoucher(ctx, w, r, restaurant)
+	if voucher == nil {
+		return
+	}
+	png, err := qrcode.Encode(voucher.Code, qrcode.Medium, 256)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella generazione del QR code")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+// VoidVoucherHandler annulla un buono, ad esempio rimborsato o smarrito: il credito residuo è
+// azzerato (POST /api/v1/vouchers/{id}/void)
+func VoidVoucherHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	before, err := db.MongoInstance.VoidVoucher(ctx, mux.Vars(r)["id"], restaurant.ID, time.Now())
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'annullamento del buono")
+		return
+	}
+	if before == nil {
+		httputil.NotFound(w, "Buono")
+		return
+	}
+
+	voucher := *before
+	voucher.Status = models.VoucherVoid
+	voucher.BalanceCents = 0
+	recordVoucherTransaction(ctx, r, &voucher, models.VoucherVoided, -before.BalanceCents, "")
+	httputil.Success(w, "Buono annullato", voucher)
+}
+
+// payWithVoucher paga l'ordine con il credito del buono, fino al totale, e lo annota
+// sull'ordine. Restituisce errVoucherNotRedeemable se il buono non si può usare
+func payWithVoucher(ctx context.Context, r *http.Request, order *models.Order, code string) error {
+	voucher, err := db.MongoInstance.GetVoucherByCode(ctx, order.RestaurantID, normalizeCode(code))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if voucher == nil || !voucher.Redeemable(now) {
+		return errVoucherNotRedeemable
+	}
+
+	cents := int64(order.Total*100 + 0.5)
+	if voucher.BalanceCents < cents {
+		cents = voucher.BalanceCents
+	}
+	// Il credito si controlla nello stesso aggiornamento: due ordini insieme non lo mandano
+	// sotto zero
+	updated, err := db.MongoInstance.AdjustVoucherBalance(ctx, voucher.ID, -cents, now)
+	if err != nil {
+		return err
+	}
+	if updated == nil {
+		return errVoucherNotRedeemable
+	}
+	recordVoucherTransaction(ctx, r, updated, models.VoucherRedeem, -cents, order.ID)
+
+	order.VoucherID = updated.ID
+	order.VoucherPaid = float64(cents) / 100
+	return nil
+}
+
+// refundOrderVoucher restituisce al buono la parte dell'ordine pagata con il credito, quando
+// l'ordine è annullato o non è stato registrato
+func refundOrderVoucher(ctx context.Context, r *http.Request, order *models.Order) {
+	cents := int64(order.VoucherPaid*100 + 0.5)
+	if order.VoucherID == "" || cents <= 0 {
+		return
+	}
+	voucher, err := db.MongoInstance.AdjustVoucherBalance(ctx, order.VoucherID, cents, time.Now())
+	if err == nil && voucher == nil {
+		err = errors.New("buono non più attivo")
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella restituzione del credito del buono", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": order.RestaurantID,
+			"voucher_id":    order.VoucherID,
+			"order_id":      order.ID,
+		})
+		return
+	}
+	recordVoucherTransaction(ctx, r, voucher, models.VoucherRefund, cents, order.ID)
+}
+
+// VoucherCheckoutHandler avvia l'acquisto online di un buono regalo
+// (POST /api/v1/public/vouchers/{username}/checkout con amount_cents tra i tagli in vendita).
+// Il buono resta in attesa finché il provider di billing non conferma il pagamento; dopo il
+// pagamento il cliente torna alla pagina del buono
+func VoucherCheckoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req voucherRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxLoyaltyBody)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+	defer cancel()
+
+	restaurant, err := db.MongoInstance.GetRestaurantByUsername(ctx, mux.Vars(r)["username"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'acquisto del buono")
+		return
+	}
+	settings := defaultVoucherSettings()
+	if restaurant != nil {
+		settings = restaurantVoucherSettings(restaurant)
+	}
+	if restaurant == nil || !restaurant.IsActive || !settings.OnlineSales || paymentCheckout == nil {
+		httputil.NotFound(w, "Vendita dei buoni regalo")
+		return
+	}
+	if !settings.AllowsAmount(req.AmountCents) {
+		httputil.BadRequest(w, "Importo non disponibile")
+		return
+	}
+	voucher, err := newVoucher(restaurant, req, time.Now())
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	voucher.Status = models.VoucherPending
+	voucher.Source = models.VoucherSourceCheckout
+
+	baseURL := getBaseURL(r)
+	session, err := paymentCheckout.CreateCheckout(ctx, billing.CheckoutRequest{
+		Description:   "Buono regalo " + restaurant.Name,
+		AmountCents:   voucher.AmountCents,
+		Currency:      voucher.Currency,
+		CustomerEmail: voucher.PurchaserEmail,
+		SuccessURL:    baseURL + "/voucher/" + url.PathEscape(voucher.ID) + "?session_id={CHECKOUT_SESSION_ID}",
+		CancelURL:     baseURL + "/r/" + url.PathEscape(restaurant.Username),
+		Metadata:      map[string]string{"voucher_id": voucher.ID, "restaurant_id": restaurant.ID},
+	})
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nella creazione del pagamento", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+		httputil.ErrorMessage(w, http.StatusBadGateway, "Pagamento online temporaneamente non disponibile")
+		return
+	}
+	voucher.CheckoutID = session.ID
+	if err := createVoucher(ctx, voucher); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'acquisto del buono")
+		return
+	}
+
+	httputil.Created(w, "Completa il pagamento", map[string]interface{}{
+		"voucher_id":   voucher.ID,
+		"checkout_url": session.URL,
+		"expires_at":   session.ExpiresAt,
+	})
+}
+
+// BillingWebhookHandler riceve le notifiche firmate del provider di billing
+// (POST /api/v1/billing/webhook): un pagamento completato attiva il buono acquistato e ne
+// manda il link a chi l'ha comprato. Le notifiche ripetute non hanno effetto
+func BillingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if paymentCheckout == nil {
+		httputil.NotFound(w, "Endpoint")
+		return
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBillingWebhookBody))
+	if err != nil {
+		httputil.BadRequest(w, "Notifica troppo grande")
+		return
+	}
+	completed, err := paymentCheckout.ParseWebhook(payload, r.Header.Get("Stripe-Signature"))
+	if err != nil {
+		logger.SecurityEventCtx(r.Context(), "BILLING_WEBHOOK_REJECTED", "Notifica di billing con firma non valida", "", map[string]interface{}{
+			"error": err.Error(),
+			"ip":    getClientIP(r),
+		})
+		httputil.BadRequest(w, "Firma non valida")
+		return
+	}
+	if completed == nil || completed.Metadata["voucher_id"] == "" {
+		httputil.NoContent(w)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	voucher, err := db.MongoInstance.GetVoucher(ctx, completed.Metadata["voucher_id"], completed.Metadata["restaurant_id"])
+	if err != nil {
+		// Il provider riprova la notifica finché non riceve una risposta positiva
+		respondMenuV2Error(w, r, err, "Errore nell'attivazione del buono")
+		return
+	}
+	if voucher == nil || voucher.AmountCents != completed.AmountCents || voucher.Currency != completed.Currency {
+		logger.ErrorCtx(r.Context(), "Pagamento che non corrisponde a un buono in attesa", map[string]interface{}{
+			"voucher_id": completed.Metadata["voucher_id"],
+			"session_id": completed.SessionID,
+			"amount":     completed.AmountCents,
+		})
+		httputil.NoContent(w)
+		return
+	}
+	activated, err := db.MongoInstance.ActivateVoucher(ctx, voucher.ID, completed.SessionID, time.Now())
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nell'attivazione del buono")
+		return
+	}
+	if activated == nil {
+		httputil.NoContent(w)
+		return
+	}
+	recordVoucherTransaction(ctx, r, activated, models.VoucherIssue, activated.AmountCents, "")
+
+	email := activated.PurchaserEmail
+	if email == "" {
+		email = completed.CustomerEmail
+	}
+	if email != "" {
+		sendVoucherEmail(ctx, r, activated, email)
+	}
+	httputil.NoContent(w)
+}
+
+// sendVoucherEmail manda a chi l'ha acquistato il link alla pagina del buono
+func sendVoucherEmail(ctx context.Context, r *http.Request, voucher *models.Voucher, email string) {
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, voucher.RestaurantID)
+	if err != nil || restaurant == nil {
+		return
+	}
+	// Il link contiene la credenziale del buono: mai costruirlo dall'Host della richiesta
+	baseURL, err := emailBaseURL()
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Buono regalo non inviato", map[string]interface{}{
+			"error":      err.Error(),
+			"voucher_id": voucher.ID,
+		})
+		return
+	}
+	voucherURL := fmt.Sprintf("%s/voucher/%s?session_id=%s", baseURL, url.PathEscape(voucher.ID), url.QueryEscape(voucher.CheckoutID))
+	if err := notifyUser(ctx, email, "", i18n.KeyVoucherPurchased, map[string]interface{}{
+		"RestaurantName": restaurant.Name,
+		"Amount":         formatCents(voucher.AmountCents, voucher.Currency),
+		"Code":           formatVoucherCode(voucher.Code),
+		"ExpiresAt":      voucher.ExpiresAt,
+		"VoucherURL":     voucherURL,
+	}); err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nell'invio del buono regalo", map[string]interface{}{
+			"error":      err.Error(),
+			"voucher_id": voucher.ID,
+		})
+	}
+}
+
+// VoucherPageHandler mostra il buono acquistato online, con codice e QR code da presentare
+// alla cassa (GET /voucher/{id}?session_id=...). L'ID della sessione di pagamento, ricevuto
+// solo da chi ha pagato, fa da credenziale
+func VoucherPageHandler(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var voucher *models.Voucher
+	var restaurant *models.Restaurant
+	sessionID := r.URL.Query().Get("session_id")
+	var err error
+	if sessionID != "" {
+		voucher, err = db.MongoInstance.GetVoucherByCheckout(ctx, mux.Vars(r)["id"], sessionID)
+		if err == nil && voucher != nil {
+			restaurant, err = db.MongoInstance.GetRestaurantByID(ctx, voucher.RestaurantID)
+		}
+	}
+	if err != nil {
+		logger.ErrorCtx(r.Context(), "Errore nel recupero del buono", map[string]interface{}{
+			"error":      err.Error(),
+			"voucher_id": mux.Vars(r)["id"],
+		})
+		http.Error(w, "Servizio temporaneamente non disponibile", http.StatusServiceUnavailable)
+		return
+	}
+	if voucher == nil || restaurant == nil {
+		data := struct {
+			Title   string
+			Message string
+		}{
+			Title:   "Buono non trovato",
+			Message: "Il link del buono regalo non è valido.",
+		}
+		w.WriteHeader(http.StatusNotFound)
+		renderTemplate(w, "404", data)
+		return
+	}
+
+	data := struct {
+		Restaurant *models.Restaurant
+		Voucher    *models.Voucher
+		Code       string
+		Amount     string
+		Balance    string
+		Redeemable bool
+		QRCode     template.URL
+	}{
+		Restaurant: restaurant,
+		Voucher:    voucher,
+		Amount:     formatCents(voucher.AmountCents, voucher.Currency),
+		Balance:    formatCents(voucher.BalanceCents, voucher.Currency),
+		Redeemable: voucher.Redeemable(time.Now()),
+	}
+	// Il codice compare solo a pagamento confermato
+	if voucher.Status == models.VoucherActive {
+		data.Code = formatVoucherCode(voucher.Code)
+		if png, err := qrcode.Encode(voucher.Code, qrcode.Medium, 256); err == nil {
+			data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	renderTemplate(w, "voucher", data)
+}
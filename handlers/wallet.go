@@ -0,0 +1,585 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+	"qr-menu/pkg/metrics"
+	"qr-menu/pkg/wallet"
+)
+
+// Colori del pass finché il ristorante non li personalizza
+const (
+	walletDefaultBackground = "#1f2937"
+	walletDefaultForeground = "#ffffff"
+)
+
+// Emittenti dei pass, nil se la piattaforma non è configurata
+var (
+	walletApple  *wallet.Apple
+	walletGoogle *wallet.Google
+)
+
+var walletNotifications = metrics.NewCounter("qrmenu_wallet_notifications_total",
+	"Wallet pass update notifications by platform (apple or google) and result (success or failed).", "platform", "result")
+
+// SetWallet imposta gli emittenti dei pass Apple Wallet e Google Wallet; nil disattiva la
+// piattaforma
+func SetWallet(apple *wallet.Apple, google *wallet.Google) {
+	walletApple = apple
+	walletGoogle = google
+}
+
+// walletWebServiceURL è l'indirizzo del web service da cui i dispositivi Apple scaricano gli
+// aggiornamenti del pass
+func walletWebServiceURL(baseURL string) string {
+	return baseURL + "/api/v1/public/wallet"
+}
+
+// walletPassURL è il link pubblico per aggiungere il pass del ristorante; platform vale
+// apple o google
+func walletPassURL(baseURL string, restaurant *models.Restaurant, platform string) string {
+	return fmt.Sprintf("%s/api/v1/public/restaurants/%s/wallet/%s", baseURL, url.PathEscape(restaurant.Username), platform)
+}
+
+// ensureWalletSettings restituisce le impostazioni del pass del ristorante, creando al primo
+// pass emesso quelle predefinite con il token del web service
+func ensureWalletSettings(ctx context.Context, restaurant *models.Restaurant) (*models.WalletPassSettings, error) {
+	if restaurant.Wallet != nil && restaurant.Wallet.AuthToken != "" {
+		return restaurant.Wallet, nil
+	}
+	settings := &models.WalletPassSettings{
+		BackgroundColor: walletDefaultBackground,
+		ForegroundColor: walletDefaultForeground,
+		UpdatedAt:       time.Now(),
+	}
+	if restaurant.Wallet != nil {
+		*settings = *restaurant.Wallet
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("errore generazione token wallet: %v", err)
+	}
+	settings.AuthToken = hex.EncodeToString(buf)
+	if err := db.MongoInstance.SetRestaurantWallet(ctx, restaurant.ID, settings); err != nil {
+		return nil, err
+	}
+	restaurant.Wallet = settings
+	return settings, nil
+}
+
+// walletLogo carica il logo del ristorante dal blob store. I loghi esterni o illeggibili
+// vengono saltati: il pass Apple mostra allora solo il nome
+func walletLogo(ctx context.Context, logo string) image.Image {
+	key, ok := localBlobKey(logo)
+	if !ok {
+		return nil
+	}
+	blob, err := blobStore.Get(ctx, key)
+	if err != nil {
+		return nil
+	}
+	defer blob.Close()
+	img, _, err := image.Decode(io.LimitReader(blob, maxFileSize))
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+// buildWalletPass compone il pass del ristorante: QR code e link del menu pubblico, menu
+// attivo, contatti, colori e logo. Il numero di serie è l'ID del ristorante, così tutti i
+// clienti condividono lo stesso pass
+func buildWalletPass(ctx context.Context, restaurant *models.Restaurant, baseURL string) (wallet.Pass, error) {
+	settings, err := ensureWalletSettings(ctx, restaurant)
+	if err != nil {
+		return wallet.Pass{}, err
+	}
+	menuName := ""
+	menu, err := activeRestaurantMenu(ctx, restaurant.ID)
+	if err != nil {
+		return wallet.Pass{}, err
+	}
+	if menu != nil {
+		menuName = menu.Name
+	}
+
+	pass := wallet.Pass{
+		SerialNumber: restaurant.ID,
+		Name:         restaurant.Name,
+		Description:  "Menu di " + restaurant.Name,
+		Language:     i18n.Default().Resolve(""),
+		MenuName:     menuName,
+		MenuLabel:    "Menu",
+		MenuURL:      restaurantPublicURL(baseURL, restaurant),
+		Fields: []wallet.Field{
+			{Key: "address", Label: "Indirizzo", Value: restaurant.Address},
+			{Key: "phone", Label: "Telefono", Value: restaurant.Phone},
+		},
+		BackFields: []wallet.Field{
+			{Key: "description", Label: restaurant.Name, Value: restaurant.Description},
+			{Key: "menu_url", Label: "Menu online", Value: restaurantPublicURL(baseURL, restaurant)},
+		},
+		BackgroundColor: settings.BackgroundColor,
+		ForegroundColor: settings.ForegroundColor,
+		Logo:            walletLogo(ctx, restaurant.Logo),
+		LogoURL:         absoluteURL(baseURL, AssetURL(restaurant.Logo)),
+		AuthToken:       settings.AuthToken,
+	}
+	// Apple Wallet accetta solo web service HTTPS: in sviluppo i pass restano statici
+	if strings.HasPrefix(baseURL, "https://") {
+		pass.WebServiceURL = walletWebServiceURL(baseURL)
+	}
+	return pass, nil
+}
+
+// walletRestaurant carica il ristorante pubblico indicato dallo username del percorso
+func walletRestaurant(ctx context.Context, w http.ResponseWriter, r *http.Request) *models.Restaurant {
+	restaurant, err := db.MongoInstance.GetRestaurantByUsername(ctx, mux.Vars(r)["username"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del ristorante")
+		return nil
+	}
+	if restaurant == nil || !restaurant.IsActive {
+		httputil.NotFound(w, "Ristorante")
+		return nil
+	}
+	return restaurant
+}
+
+// AppleWalletPassHandler scarica il pass Apple Wallet (.pkpass) del ristorante
+func AppleWalletPassHandler(w http.ResponseWriter, r *http.Request) {
+	if walletApple == nil {
+		httputil.NotFound(w, "Apple Wallet")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restaurant := walletRestaurant(ctx, w, r)
+	if restaurant == nil {
+		return
+	}
+	pass, err := buildWalletPass(ctx, restaurant, getBaseURL(r))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella creazione del pass")
+		return
+	}
+	writeApplePass(w, r, pass, restaurant.Username)
+}
+
+// writeApplePass firma e invia il pass Apple Wallet
+func writeApplePass(w http.ResponseWriter, r *http.Request, pass wallet.Pass, filename string) {
+	data, err := walletApple.Build(pass)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella firma del pass")
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.apple.pkpass")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pkpass"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
+// GoogleWalletPassHandler reindirizza al link "Salva in Google Wallet" del pass del ristorante
+func GoogleWalletPassHandler(w http.ResponseWriter, r *http.Request) {
+	if walletGoogle == nil {
+		httputil.NotFound(w, "Google Wallet")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restaurant := walletRestaurant(ctx, w, r)
+	if restaurant == nil {
+		return
+	}
+	pass, err := buildWalletPass(ctx, restaurant, getBaseURL(r))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella creazione del pass")
+		return
+	}
+	saveURL, err := walletGoogle.SaveURL(pass)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella firma del pass")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, saveURL, http.StatusSeeOther)
+}
+
+// walletPassRestaurant autentica una richiesta del web service Apple Wallet: tipo di pass
+// configurato, ristorante del numero di serie e header "Authorization: ApplePass <token>"
+func walletPassRestaurant(ctx context.Context, w http.ResponseWriter, r *http.Request) *models.Restaurant {
+	vars := mux.Vars(r)
+	if walletApple == nil || vars["passType"] != walletApple.PassTypeID() {
+		httputil.NotFound(w, "Pass")
+		return nil
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, vars["serial"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del ristorante")
+		return nil
+	}
+	if restaurant == nil || restaurant.Wallet == nil || restaurant.Wallet.AuthToken == "" {
+		httputil.NotFound(w, "Pass")
+		return nil
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "ApplePass ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(restaurant.Wallet.AuthToken)) != 1 {
+		httputil.Unauthorized(w, "Token del pass non valido")
+		return nil
+	}
+	return restaurant
+}
+
+// walletRegistrationID identifica la registrazione di un dispositivo a un pass
+func walletRegistrationID(deviceID, passTypeID, serial string) string {
+	return deviceID + "/" + passTypeID + "/" + serial
+}
+
+// RegisterWalletDeviceHandler registra un dispositivo Apple per le notifiche di
+// aggiornamento del pass (web service di Apple Wallet)
+func RegisterWalletDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restaurant := walletPassRestaurant(ctx, w, r)
+	if restaurant == nil {
+		return
+	}
+	var req struct {
+		PushToken string `json:"pushToken"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || req.PushToken == "" {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+
+	vars := mux.Vars(r)
+	now := time.Now()
+	created, err := db.MongoInstance.SaveWalletRegistration(ctx, &models.WalletRegistration{
+		ID:           walletRegistrationID(vars["device"], vars["passType"], vars["serial"]),
+		DeviceID:     vars["device"],
+		PushToken:    req.PushToken,
+		PassTypeID:   vars["passType"],
+		SerialNumber: vars["serial"],
+		RestaurantID: restaurant.ID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	})
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella registrazione del dispositivo")
+		return
+	}
+	if created {
+		httputil.Created(w, "Dispositivo registrato", nil)
+		return
+	}
+	httputil.Success(w, "Dispositivo già registrato", nil)
+}
+
+// UnregisterWalletDeviceHandler cancella la registrazione di un dispositivo che ha rimosso
+// il pass
+func UnregisterWalletDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if walletPassRestaurant(ctx, w, r) == nil {
+		return
+	}
+	vars := mux.Vars(r)
+	if _, err := db.MongoInstance.DeleteWalletRegistration(ctx, walletRegistrationID(vars["device"], vars["passType"], vars["serial"])); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella cancellazione del dispositivo")
+		return
+	}
+	httputil.Success(w, "Dispositivo rimosso", nil)
+}
+
+// WalletDeviceSerialsHandler restituisce al dispositivo i numeri di serie dei suoi pass
+// modificati dopo passesUpdatedSince, il valore lastUpdated della risposta precedente
+func WalletDeviceSerialsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if walletApple == nil || vars["passType"] != walletApple.PassTypeID() {
+		httputil.NotFound(w, "Pass")
+		return
+	}
+	var since int64
+	if value := r.URL.Query().Get("passesUpdatedSince"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			httputil.BadRequest(w, "passesUpdatedSince non valido")
+			return
+		}
+		since = parsed
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	regs, err := db.MongoInstance.GetDeviceWalletRegistrations(ctx, vars["device"], vars["passType"])
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei pass")
+		return
+	}
+	serials := []string{}
+	lastUpdated := since
+	for _, reg := range regs {
+		restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, reg.RestaurantID)
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nel recupero dei pass")
+			return
+		}
+		if restaurant == nil || restaurant.Wallet == nil {
+			continue
+		}
+		if updated := restaurant.Wallet.UpdatedAt.UnixMilli(); updated > since {
+			serials = append(serials, reg.SerialNumber)
+			lastUpdated = max(lastUpdated, updated)
+		}
+	}
+	if len(serials) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	httputil.JSON(w, http.StatusOK, map[string]interface{}{
+		"serialNumbers": serials,
+		"lastUpdated":   strconv.FormatInt(lastUpdated, 10),
+	})
+}
+
+// WalletPassUpdateHandler invia al dispositivo la versione aggiornata del pass
+func WalletPassUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	restaurant := walletPassRestaurant(ctx, w, r)
+	if restaurant == nil {
+		return
+	}
+	updatedAt := restaurant.Wallet.UpdatedAt.UTC().Truncate(time.Second)
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !updatedAt.After(since) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	pass, err := buildWalletPass(ctx, restaurant, getBaseURL(r))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella creazione del pass")
+		return
+	}
+	w.Header().Set("Last-Modified", updatedAt.Format(http.TimeFormat))
+	writeApplePass(w, r, pass, restaurant.Username)
+}
+
+// WalletLogHandler registra gli errori che i dispositivi Apple segnalano sul web service
+func WalletLogHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Logs []string `json:"logs"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 16<<10)).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	for _, entry := range req.Logs {
+		logger.WarnCtx(r.Context(), "Errore segnalato da Apple Wallet", map[string]interface{}{"log": entry})
+	}
+	httputil.Success(w, "Log registrati", nil)
+}
+
+// walletSettingsView sono le impostazioni del pass mostrate al ristorante, con i link da
+// condividere ai clienti per le piattaforme attive
+type walletSettingsView struct {
+	BackgroundColor string     `json:"background_color"`
+	ForegroundColor string     `json:"foreground_color"`
+	UpdatedAt       *time.Time `json:"updated_at,omitempty"`
+	AppleEnabled    bool       `json:"apple_enabled"`
+	GoogleEnabled   bool       `json:"google_enabled"`
+	AppleURL        string     `json:"apple_url,omitempty"`
+	GoogleURL       string     `json:"google_url,omitempty"`
+	Devices         int        `json:"devices"` // Dispositivi Apple con il pass
+}
+
+func newWalletSettingsView(restaurant *models.Restaurant, baseURL string, devices int) walletSettingsView {
+	view := walletSettingsView{
+		BackgroundColor: walletDefaultBackground,
+		ForegroundColor: walletDefaultForeground,
+		AppleEnabled:    walletApple != nil,
+		GoogleEnabled:   walletGoogle != nil,
+		Devices:         devices,
+	}
+	if settings := restaurant.Wallet; settings != nil {
+		view.BackgroundColor = settings.BackgroundColor
+		view.ForegroundColor = settings.ForegroundColor
+		view.UpdatedAt = &settings.UpdatedAt
+	}
+	if view.AppleEnabled {
+		view.AppleURL = walletPassURL(baseURL, restaurant, "apple")
+	}
+	if view.GoogleEnabled {
+		view.GoogleURL = walletPassURL(baseURL, restaurant, "google")
+	}
+	return view
+}
+
+// GetWalletSettingsHandler restituisce le impostazioni del pass Wallet del ristorante
+func GetWalletSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	regs, err := db.MongoInstance.GetWalletRegistrations(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei dispositivi")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Pass Wallet", newWalletSettingsView(restaurant, getBaseURL(r), len(regs)))
+}
+
+// UpdateWalletSettingsHandler personalizza i colori del pass e aggiorna i pass già aggiunti
+// dai clienti
+func UpdateWalletSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	var req struct {
+		BackgroundColor string `json:"background_color"`
+		ForegroundColor string `json:"foreground_color"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	if !wallet.ValidColor(req.BackgroundColor) || !wallet.ValidColor(req.ForegroundColor) {
+		httputil.BadRequest(w, "I colori devono essere nel formato #rrggbb")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	settings, err := ensureWalletSettings(ctx, restaurant)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio del pass")
+		return
+	}
+	settings.BackgroundColor = req.BackgroundColor
+	settings.ForegroundColor = req.ForegroundColor
+	settings.UpdatedAt = time.Now()
+	if err := db.MongoInstance.SetRestaurantWallet(ctx, restaurant.ID, settings); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio del pass")
+		return
+	}
+
+	restaurantID := restaurant.ID
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := pushWalletUpdates(ctx, restaurantID); err != nil {
+			logger.Warn("Aggiornamento dei pass Wallet non riuscito", map[string]interface{}{
+				"restaurant_id": restaurantID,
+				"error":         err.Error(),
+			})
+		}
+	}()
+
+	RecordAuditLogAsync("WALLET_PASS_UPDATED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	regs, err := db.MongoInstance.GetWalletRegistrations(ctx, restaurant.ID)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero dei dispositivi")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Success(w, "Pass aggiornato", newWalletSettingsView(restaurant, getBaseURL(r), len(regs)))
+}
+
+// refreshWalletPassesOnEvent aggiorna i pass dei clienti quando cambia il menu attivo del
+// ristorante
+func refreshWalletPassesOnEvent(ctx context.Context, event events.Event) error {
+	if db.MongoInstance == nil || event.RestaurantID == "" {
+		return nil
+	}
+	restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, event.RestaurantID)
+	if err != nil || restaurant == nil || restaurant.Wallet == nil {
+		return err
+	}
+	settings := *restaurant.Wallet
+	settings.UpdatedAt = time.Now()
+	if err := db.MongoInstance.SetRestaurantWallet(ctx, restaurant.ID, &settings); err != nil {
+		return err
+	}
+	return pushWalletUpdates(ctx, restaurant.ID)
+}
+
+// pushWalletUpdates avvisa i dispositivi Apple registrati di scaricare il pass aggiornato,
+// eliminando quelli che l'hanno rimosso, e aggiorna il pass salvato su Google Wallet. Il pass
+// Google richiede server.base_url, perché non c'è una richiesta da cui ricavare l'indirizzo
+func pushWalletUpdates(ctx context.Context, restaurantID string) error {
+	var errs []error
+	if walletApple != nil {
+		regs, err := db.MongoInstance.GetWalletRegistrations(ctx, restaurantID)
+		if err != nil {
+			return err
+		}
+		notified := map[string]bool{}
+		for _, reg := range regs {
+			if notified[reg.PushToken] {
+				continue
+			}
+			notified[reg.PushToken] = true
+			err := walletApple.Notify(ctx, reg.PushToken)
+			switch {
+			case errors.Is(err, wallet.ErrUnregistered):
+				walletNotifications.Inc("apple", "failed")
+				if err := db.MongoInstance.DeleteWalletPushToken(ctx, reg.PushToken); err != nil {
+					errs = append(errs, err)
+				}
+			case err != nil:
+				walletNotifications.Inc("apple", "failed")
+				errs = append(errs, err)
+			default:
+				walletNotifications.Inc("apple", "success")
+			}
+		}
+	}
+
+	if walletGoogle != nil && configuredBaseURL != "" {
+		restaurant, err := db.MongoInstance.GetRestaurantByID(ctx, restaurantID)
+		if err != nil || restaurant == nil {
+			return errors.Join(append(errs, err)...)
+		}
+		pass, err := buildWalletPass(ctx, restaurant, configuredBaseURL)
+		if err == nil {
+			err = walletGoogle.Update(ctx, pass)
+		}
+		if err != nil {
+			walletNotifications.Inc("google", "failed")
+			errs = append(errs, err)
+		} else {
+			walletNotifications.Inc("google", "success")
+		}
+	}
+	return errors.Join(errs...)
+}
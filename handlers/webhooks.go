@@ -0,0 +1,643 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	"qr-menu/pkg/config"
+	"qr-menu/pkg/events"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+	"qr-menu/pkg/webhook"
+)
+
+// webhookEventTypes elenca gli eventi a cui un endpoint può iscriversi, oltre a "*" (tutti):
+// gli eventi del catalogo che riguardano un ristorante
+var webhookEventTypes = []string{
+	events.MenuCreated, events.MenuUpdated, events.MenuActivated, events.ItemUpdated, events.ItemLowStock,
+	events.ItemSoldOut, events.OrderCreated, events.OrderUpdated, events.FeedbackReceived, events.PromotionActive,
+	events.QRScanned, events.BillingSubscriptionUpdated, events.BillingSubscriptionCanceled, events.WebhookTest,
+}
+
+const (
+	// webhookPollInterval è ogni quanto il worker cerca consegne da inviare o ritentare
+	webhookPollInterval = 5 * time.Second
+	// webhookWorkers è il numero di consegne inviate in parallelo
+	webhookWorkers = 4
+)
+
+// webhookSender e webhookPolicy inviano le consegne secondo la configurazione webhooks,
+// impostata all'avvio
+var (
+	webhookSender   = webhook.NewSender(config.Default().Webhooks.Timeout)
+	webhookPolicy   = webhookPolicyFrom(config.Default().Webhooks)
+	webhookTimeout  = config.Default().Webhooks.Timeout
+	webhookSettings sync.Mutex
+)
+
+// webhookWake sveglia il worker quando vengono accodate nuove consegne
+var webhookWake = make(chan struct{}, 1)
+
+// SetWebhookSettings imposta timeout, retry e circuit breaker delle consegne webhook
+func SetWebhookSettings(cfg config.WebhookConfig) {
+	webhookSettings.Lock()
+	defer webhookSettings.Unlock()
+	webhookSender = webhook.NewSender(cfg.Timeout)
+	webhookPolicy = webhookPolicyFrom(cfg)
+	webhookTimeout = cfg.Timeout
+}
+
+func webhookPolicyFrom(cfg config.WebhookConfig) webhook.Policy {
+	return webhook.Policy{
+		MaxAttempts:      cfg.MaxAttempts,
+		BaseDelay:        cfg.RetryBaseDelay,
+		MaxDelay:         cfg.RetryMaxDelay,
+		BreakerThreshold: cfg.BreakerThreshold,
+		BreakerCooldown:  cfg.BreakerCooldown,
+	}
+}
+
+// webhookPayload è il corpo JSON di una consegna
+type webhookPayload struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	Locale    string      `json:"locale"`
+	Message   string      `json:"message,omitempty"` // Riepilogo leggibile nella lingua dell'endpoint
+	Data      interface{} `json:"data"`
+	CreatedAt string      `json:"created_at"`
+}
+
+// newWebhookDelivery prepara la consegna di un evento a un endpoint, con il payload già
+// renderizzato nella lingua dell'endpoint
+func newWebhookDelivery(endpoint *models.WebhookEndpoint, event *models.WebhookEvent) (*models.WebhookDelivery, error) {
+	payload := webhookPayload{
+		ID:        event.ID,
+		Type:      event.Type,
+		Locale:    i18n.Default().Resolve(endpoint.Locale),
+		Data:      event.Data,
+		CreatedAt: event.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if msg, err := renderWebhookMessage(endpoint.Locale, event); err == nil {
+		payload.Locale = msg.Locale
+		payload.Message = msg.Body
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.WebhookDelivery{
+		ID:           uuid.New().String(),
+		WebhookID:    endpoint.ID,
+		RestaurantID: endpoint.RestaurantID,
+		EventID:      event.ID,
+		EventType:    event.Type,
+		Locale:       payload.Locale,
+		Payload:      string(body),
+		Status:       models.WebhookDeliveryPending,
+		NextRetryAt:  event.CreatedAt,
+		CreatedAt:    event.CreatedAt,
+		UpdatedAt:    event.CreatedAt,
+	}, nil
+}
+
+// renderWebhookMessage renderizza il riepilogo dell'evento con il catalogo delle traduzioni.
+// I template leggono i dati dell'evento con i nomi dei campi JSON
+func renderWebhookMessage(locale string, event *models.WebhookEvent) (i18n.Message, error) {
+	var data map[string]interface{}
+	raw, err := json.Marshal(event.Data)
+	if err != nil {
+		return i18n.Message{}, err
+	}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		data = map[string]interface{}{}
+	}
+	return i18n.Default().Render(locale, i18n.WebhookKey(event.Type), data)
+}
+
+// EmitWebhookEvent accoda la consegna dell'evento agli endpoint attivi del ristorante iscritti
+// al suo tipo. L'invio avviene in background con retry; il payload ha l'ID dell'evento, così
+// chi riceve lo stesso evento da più endpoint può riconoscerlo
+func EmitWebhookEvent(ctx context.Context, event events.Event) error {
+	if db.MongoInstance == nil {
+		return nil
+	}
+	endpoints, err := db.MongoInstance.GetWebhookEndpointsForEvent(ctx, event.RestaurantID, event.Type)
+	if err != nil || len(endpoints) == 0 {
+		return err
+	}
+	return queueWebhookEvent(ctx, endpoints, &models.WebhookEvent{
+		ID:        event.ID,
+		Type:      event.Type,
+		Data:      event.Data,
+		CreatedAt: event.OccurredAt,
+	})
+}
+
+func queueWebhookEvent(ctx context.Context, endpoints []*models.WebhookEndpoint, event *models.WebhookEvent) error {
+	deliveries := make([]*models.WebhookDelivery, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		delivery, err := newWebhookDelivery(endpoint, event)
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := db.MongoInstance.CreateWebhookDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+	wakeWebhookWorker()
+	return nil
+}
+
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverWebhook esegue un tentativo di consegna e ne salva l'esito: riuscita, nuovo
+// tentativo con backoff esponenziale o dead-letter list. Se il circuito dell'endpoint è
+// aperto la consegna è rimandata alla riapertura senza consumare tentativi
+func deliverWebhook(ctx context.Context, d *models.WebhookDelivery) error {
+	webhookSettings.Lock()
+	sender, policy := webhookSender, webhookPolicy
+	webhookSettings.Unlock()
+
+	endpoint, err := db.MongoInstance.GetWebhookEndpoint(ctx, d.WebhookID, "")
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	d.UpdatedAt = now
+
+	switch {
+	case endpoint == nil || !endpoint.IsActive:
+		d.Status = models.WebhookDeliveryDead
+		d.LastError = "endpoint eliminato o disattivato"
+		return db.MongoInstance.UpdateWebhookDelivery(ctx, d)
+	case endpoint.CircuitOpenUntil != nil && endpoint.CircuitOpenUntil.After(now):
+		d.NextRetryAt = *endpoint.CircuitOpenUntil
+		return db.MongoInstance.UpdateWebhookDelivery(ctx, d)
+	}
+
+	d.Attempt++
+	status, sendErr := sender.Send(ctx, webhook.Request{
+		URL:        endpoint.URL,
+		Secret:     endpoint.Secret,
+		DeliveryID: d.ID,
+		EventType:  d.EventType,
+		Locale:     d.Locale,
+		Body:       []byte(d.Payload),
+	}, now)
+	d.ResponseStatus = status
+
+	if sendErr == nil {
+		d.Status = models.WebhookDeliverySuccess
+		d.LastError = ""
+		d.DeliveredAt = &now
+		if err := db.MongoInstance.RecordWebhookSuccess(ctx, endpoint.ID); err != nil {
+			return err
+		}
+		return db.MongoInstance.UpdateWebhookDelivery(ctx, d)
+	}
+
+	d.LastError = truncateRunes(sendErr.Error(), 500)
+	failures, err := db.MongoInstance.RecordWebhookFailure(ctx, endpoint.ID)
+	if err != nil {
+		return err
+	}
+	if until := policy.CircuitOpenUntil(failures, now); !until.IsZero() {
+		if err := db.MongoInstance.OpenWebhookCircuit(ctx, endpoint.ID, until); err != nil {
+			return err
+		}
+		if failures == policy.BreakerThreshold {
+			logger.SecurityEvent("WEBHOOK_CIRCUIT_OPEN", "Consegne al webhook sospese dopo errori consecutivi", endpoint.RestaurantID, "", "", map[string]interface{}{
+				"webhook_id": endpoint.ID,
+				"failures":   failures,
+				"until":      until,
+			})
+		}
+	}
+
+	if next, retry := policy.NextRetry(d.Attempt, now); retry {
+		d.Status = models.WebhookDeliveryRetrying
+		d.NextRetryAt = next
+	} else {
+		d.Status = models.WebhookDeliveryDead
+		logger.SecurityEvent("WEBHOOK_DELIVERY_FAILED", "Consegna webhook spostata nella dead-letter list", endpoint.RestaurantID, "", "", map[string]interface{}{
+			"webhook_id":  endpoint.ID,
+			"delivery_id": d.ID,
+			"event":       d.EventType,
+			"attempt":     d.Attempt,
+			"error":       d.LastError,
+		})
+	}
+	return db.MongoInstance.UpdateWebhookDelivery(ctx, d)
+}
+
+// processDueWebhooks invia le consegne scadute, webhookWorkers alla volta, finché ce ne sono
+func processDueWebhooks(ctx context.Context) error {
+	webhookSettings.Lock()
+	lease := webhookTimeout + 30*time.Second
+	webhookSettings.Unlock()
+
+	sem := make(chan struct{}, webhookWorkers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for ctx.Err() == nil {
+		delivery, err := db.MongoInstance.ClaimDueWebhookDelivery(ctx, time.Now(), lease)
+		if err != nil || delivery == nil {
+			return err
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(d *models.WebhookDelivery) {
+			defer func() { <-sem; wg.Done() }()
+			// Un tentativo già partito termina anche se il worker viene fermato
+			deliverCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lease)
+			defer cancel()
+			if err := deliverWebhook(deliverCtx, d); err != nil {
+				logger.Error("Errore nella consegna del webhook", map[string]interface{}{
+					"error":       err.Error(),
+					"delivery_id": d.ID,
+				})
+			}
+		}(delivery)
+	}
+	return ctx.Err()
+}
+
+// RunWebhookWorker invia le consegne webhook in coda e i retry scaduti ogni
+// webhookPollInterval, o subito quando viene accodato un evento, finché ctx non viene
+// annullato. È bloccante: va avviato in una goroutine
+func RunWebhookWorker(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+		if err := processDueWebhooks(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Errore nel recupero delle consegne webhook", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// validateWebhookURL accetta solo URL http(s) assoluti verso host pubblici. Rifiuta subito
+// gli indirizzi interni scritti nell'URL; quelli a cui un nome si risolve vengono bloccati
+// dal sender a ogni connessione
+func validateWebhookURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || value == "" {
+		return errors.New("URL non valido")
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return errors.New("L'URL deve iniziare con http:// o https://")
+	}
+	if parsed.Host == "" {
+		return errors.New("Host mancante nell'URL")
+	}
+	if internalHost(parsed) {
+		return errors.New("L'URL deve puntare a un indirizzo pubblico, non alla rete interna")
+	}
+	return nil
+}
+
+// internalHost riconosce gli URL che puntano esplicitamente alla rete interna: indirizzi IP
+// non pubblici e localhost
+func internalHost(parsed *url.URL) bool {
+	host := strings.ToLower(strings.TrimSuffix(parsed.Hostname(), "."))
+	ip := net.ParseIP(host)
+	return (ip != nil && !webhook.PublicAddress(ip)) || host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
+
+// currentWebhookRestaurant restituisce il ristorante della sessione o della API key
+func currentWebhookRestaurant(w http.ResponseWriter, r *http.Request) (string, bool) {
+	session, err := getSessionFromRequest(r)
+	if err != nil || session.RestaurantID == "" {
+		httputil.Unauthorized(w, "Non autorizzato")
+		return "", false
+	}
+	return session.RestaurantID, true
+}
+
+func respondWebhookError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	logger.ErrorCtx(r.Context(), message, map[string]interface{}{
+		"error": err.Error(),
+	})
+	httputil.InternalServerError(w, message)
+}
+
+// webhooksQuery descrive paginazione, ordinamento e filtri degli endpoint webhook
+var webhooksQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     200,
+	DefaultSort:    "-created_at",
+	Sortable:       []string{"created_at", "updated_at", "url"},
+	Filterable:     []string{"active", "event"},
+}
+
+// webhookSort confronta gli endpoint webhook per i campi ordinabili di webhooksQuery
+var webhookSort = map[string]func(a, b *models.WebhookEndpoint) int{
+	"created_at": func(a, b *models.WebhookEndpoint) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"updated_at": func(a, b *models.WebhookEndpoint) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+	"url":        func(a, b *models.WebhookEndpoint) int { return strings.Compare(a.URL, b.URL) },
+}
+
+// ListWebhooksHandler restituisce gli endpoint webhook del ristorante
+// (GET /api/v1/webhooks?filter[active]=&filter[event]=&page=&per_page=&sort=)
+func ListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := currentWebhookRestaurant(w, r)
+	if !ok {
+		return
+	}
+	query, err := httputil.ParseListQuery(r, webhooksQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	active, filterActive, err := query.BoolFilter("active")
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	endpoints, err := db.MongoInstance.GetWebhookEndpointsByRestaurant(ctx, restaurantID)
+	if err != nil {
+		respondWebhookError(w, r, err, "Errore nel recupero dei webhook")
+		return
+	}
+
+	event := query.Filter("event")
+	matching := make([]*models.WebhookEndpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if filterActive && endpoint.IsActive != active {
+			continue
+		}
+		if event != "" && !slices.Contains(endpoint.Events, event) && !slices.Contains(endpoint.Events, "*") {
+			continue
+		}
+		matching = append(matching, endpoint)
+	}
+	httputil.SortSlice(matching, query, webhookSort)
+
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, httputil.PageOf(matching, query), query, int64(len(matching)))
+}
+
+// CreateWebhookHandler registra un endpoint webhook (POST /api/v1/webhooks). Senza un
+// segreto ne viene generato uno, restituito nella risposta per verificare le firme
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := currentWebhookRestaurant(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+		Locale string   `json:"locale"`
+		Active *bool    `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Richiesta non valida")
+		return
+	}
+
+	endpointURL := strings.TrimSpace(req.URL)
+	if err := validateWebhookURL(endpointURL); err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	events := make([]string, 0, len(req.Events))
+	for _, event := range req.Events {
+		event = strings.TrimSpace(event)
+		if event != "*" && !containsString(webhookEventTypes, event) {
+			httputil.BadRequest(w, "Evento non valido: "+event+" (eventi: *, "+strings.Join(webhookEventTypes, ", ")+")")
+			return
+		}
+		if !containsString(events, event) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		httputil.BadRequest(w, "Specificare almeno un evento")
+		return
+	}
+	locale := strings.TrimSpace(req.Locale)
+	if locale != "" && !i18n.Default().Supported(locale) {
+		httputil.BadRequest(w, "Lingua non supportata: "+locale)
+		return
+	}
+
+	secret := strings.TrimSpace(req.Secret)
+	if secret == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			httputil.InternalServerError(w, "Errore nella generazione del segreto")
+			return
+		}
+		secret = "whsec_" + hex.EncodeToString(buf)
+	}
+
+	now := time.Now()
+	endpoint := &models.WebhookEndpoint{
+		ID:           uuid.New().String(),
+		RestaurantID: restaurantID,
+		URL:          endpointURL,
+		Events:       events,
+		Secret:       secret,
+		Locale:       i18n.Default().Resolve(locale),
+		IsActive:     req.Active == nil || *req.Active,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.CreateWebhookEndpoint(ctx, endpoint); err != nil {
+		respondWebhookError(w, r, err, "Errore nella creazione del webhook")
+		return
+	}
+
+	RecordAuditLogAsync("WEBHOOK_CREATED", "webhook", endpoint.ID, restaurantID, getClientIP(r), r.UserAgent(), "success")
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.Created(w, "Webhook creato", endpoint)
+}
+
+// DeleteWebhookHandler elimina un endpoint (DELETE /api/v1/webhooks/{id}). Le consegne
+// ancora in coda finiscono nella dead-letter list
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := currentWebhookRestaurant(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deleted, err := db.MongoInstance.DeleteWebhookEndpoint(ctx, id, restaurantID)
+	if err != nil {
+		respondWebhookError(w, r, err, "Errore nell'eliminazione del webhook")
+		return
+	}
+	if !deleted {
+		httputil.NotFound(w, "Webhook")
+		return
+	}
+
+	RecordAuditLogAsync("WEBHOOK_DELETED", "webhook", id, restaurantID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// TestWebhookHandler accoda un evento di prova per l'endpoint (POST /api/v1/webhooks/{id}/test),
+// anche se non è iscritto a webhook.test
+func TestWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := currentWebhookRestaurant(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	endpoint, err := db.MongoInstance.GetWebhookEndpoint(ctx, id, restaurantID)
+	if err != nil {
+		respondWebhookError(w, r, err, "Errore nel recupero del webhook")
+		return
+	}
+	if endpoint == nil {
+		httputil.NotFound(w, "Webhook")
+		return
+	}
+
+	if err := queueWebhookEvent(ctx, []*models.WebhookEndpoint{endpoint}, &models.WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      events.WebhookTest,
+		Data:      map[string]interface{}{"webhook_id": endpoint.ID},
+		CreatedAt: time.Now(),
+	}); err != nil {
+		respondWebhookError(w, r, err, "Errore nell'invio dell'evento di prova")
+		return
+	}
+	httputil.Accepted(w, "Evento di prova accodato", nil)
+}
+
+// webhookDeliveriesQuery descrive paginazione, ordinamento e filtri delle consegne webhook
+var webhookDeliveriesQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     500,
+	DefaultSort:    "-created_at",
+	Sortable:       []string{"created_at", "updated_at", "next_retry_at", "attempt", "status"},
+	Filterable:     []string{"status", "webhook_id", "event_type"},
+}
+
+// ListWebhookDeliveriesHandler restituisce le consegne del ristorante, dalla più recente
+// (GET /api/v1/webhooks/deliveries?filter[status]=&filter[webhook_id]=&filter[event_type]=&page=&per_page=&sort=)
+func ListWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	listWebhookDeliveries(w, r, webhookDeliveriesQuery, "")
+}
+
+// WebhookDeadLettersHandler restituisce la dead-letter list: le consegne che hanno esaurito
+// i tentativi (GET /api/v1/webhooks/dead-letters, stessi parametri tranne il filtro sullo stato)
+func WebhookDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	opts := webhookDeliveriesQuery
+	opts.Filterable = []string{"webhook_id", "event_type"}
+	listWebhookDeliveries(w, r, opts, models.WebhookDeliveryDead)
+}
+
+func listWebhookDeliveries(w http.ResponseWriter, r *http.Request, opts httputil.ListOptions, status string) {
+	restaurantID, ok := currentWebhookRestaurant(w, r)
+	if !ok {
+		return
+	}
+	query, err := httputil.ParseListQuery(r, opts)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+	if status == "" {
+		status = query.Filter("status")
+	}
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryRetrying, models.WebhookDeliverySuccess, models.WebhookDeliveryDead:
+	default:
+		httputil.BadRequest(w, "Stato non valido: "+status)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deliveries, total, err := db.MongoInstance.FindWebhookDeliveries(ctx, db.WebhookDeliveryFilter{
+		RestaurantID: restaurantID,
+		WebhookID:    query.Filter("webhook_id"),
+		Status:       status,
+		EventType:    query.Filter("event_type"),
+	}, dbListOptions(query))
+	if err != nil {
+		respondWebhookError(w, r, err, "Errore nel recupero delle consegne webhook")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, deliveries, query, total)
+}
+
+// RedeliverWebhookHandler rimette in coda una consegna conclusa, tipicamente dalla dead-letter
+// list dopo aver sistemato l'endpoint (POST /api/v1/webhooks/deliveries/{id}/redeliver). Il
+// payload e l'ID dell'evento restano quelli originali, così il destinatario può riconoscere i duplicati
+func RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	restaurantID, ok := currentWebhookRestaurant(w, r)
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	requeued, err := db.MongoInstance.RequeueWebhookDelivery(ctx, id, restaurantID, time.Now())
+	if err != nil {
+		respondWebhookError(w, r, err, "Errore nella nuova consegna del webhook")
+		return
+	}
+	if !requeued {
+		httputil.NotFound(w, "Consegna conclusa")
+		return
+	}
+	wakeWebhookWorker()
+
+	RecordAuditLogAsync("WEBHOOK_REDELIVERED", "webhook_delivery", id, restaurantID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Accepted(w, "Consegna rimessa in coda", nil)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"qr-menu/analytics"
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/pkg/i18n"
+)
+
+// nextDigestTime restituisce il prossimo lunedì alle 8:00 (ora locale) dopo now
+func nextDigestTime(now time.Time) time.Time {
+	days := (int(time.Monday) - int(now.Weekday()) + 7) % 7
+	next := time.Date(now.Year(), now.Month(), now.Day()+days, 8, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 7)
+	}
+	return next
+}
+
+// SendWeeklyDigests invia a ogni proprietario il riepilogo delle visite e delle scansioni QR
+// degli ultimi 7 giorni di ciascun ristorante, confrontate con la settimana precedente
+func SendWeeklyDigests(ctx context.Context, now time.Time) (int, error) {
+	if db.MongoInstance == nil {
+		return 0, nil
+	}
+
+	restaurants, err := db.MongoInstance.GetAllRestaurants(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	to := truncateToDay(now).AddDate(0, 0, -1)
+	from := to.AddDate(0, 0, -6)
+	sent := 0
+	for _, restaurant := range restaurants {
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		if !restaurant.IsActive || restaurant.OwnerID == "" {
+			continue
+		}
+		owner, err := db.MongoInstance.GetUserByID(ctx, restaurant.OwnerID)
+		if err != nil || owner == nil || !owner.IsActive || owner.Email == "" {
+			continue
+		}
+
+		current := analytics.GetAnalytics().GetMenuPeriodStats(restaurant.ID, "", nil, from, to)
+		previous := analytics.GetAnalytics().GetMenuPeriodStats(restaurant.ID, "", nil, from.AddDate(0, 0, -7), from.AddDate(0, 0, -1))
+
+		data := map[string]interface{}{
+			"RestaurantName": restaurant.Name,
+			"From":           from,
+			"To":             to,
+			"Views":          current.RestaurantViews,
+			"PreviousViews":  previous.RestaurantViews,
+			"QRScans":        current.QRScans,
+			"PreviousScans":  previous.QRScans,
+			"AnalyticsURL":   configuredBaseURL + "/admin/analytics",
+		}
+		if err := notifyOwner(ctx, owner, i18n.KeyWeeklyDigest, data); err != nil {
+			logger.WarnCtx(ctx, "Errore nell'invio del riepilogo settimanale", map[string]interface{}{
+				"error":         err.Error(),
+				"restaurant_id": restaurant.ID,
+			})
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// RunWeeklyDigestWorker invia il riepilogo settimanale delle analytics ogni lunedì alle 8:00,
+// finché ctx non viene annullato. È bloccante: va avviato in una goroutine
+func RunWeeklyDigestWorker(ctx context.Context) {
+	for {
+		timer := time.NewTimer(time.Until(nextDigestTime(time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+		sent, err := SendWeeklyDigests(runCtx, time.Now())
+		cancel()
+		if err != nil {
+			logger.Error("Errore nell'invio dei riepiloghi settimanali", map[string]interface{}{
+				"error": err.Error(),
+				"sent":  sent,
+			})
+			continue
+		}
+		logger.Info("Riepiloghi settimanali inviati", map[string]interface{}{
+			"sent": sent,
+		})
+	}
+}
@@ -0,0 +1,562 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"qr-menu/db"
+	"qr-menu/logger"
+	"qr-menu/models"
+	httputil "qr-menu/pkg/http"
+	"qr-menu/pkg/i18n"
+	"qr-menu/pkg/metrics"
+	"qr-menu/pkg/phone"
+	"qr-menu/pkg/sms"
+	"qr-menu/pkg/whatsapp"
+)
+
+// whatsAppClient invia i messaggi dei ristoranti collegati a WhatsApp Business; nil se l'app
+// Meta (whatsapp.app_secret) non è configurata. whatsAppAppSecret verifica la firma dei
+// webhook e whatsAppVerifyToken la loro registrazione
+var (
+	whatsAppClient      *whatsapp.Client
+	whatsAppAppSecret   string
+	whatsAppVerifyToken string
+)
+
+var whatsAppMessages = metrics.NewCounter("qrmenu_whatsapp_total",
+	"WhatsApp messages by kind (order, menu or reply) and result (sent, failed or opted_out).", "kind", "result")
+
+// errWhatsAppNotConfigured indica che il ristorante non ha collegato un numero WhatsApp Business
+var errWhatsAppNotConfigured = errors.New("WhatsApp non collegato al ristorante")
+
+// whatsAppTemplateName e whatsAppLanguage validano nome e lingua dei modelli di messaggio
+var (
+	whatsAppTemplateName = regexp.MustCompile(`^[a-z0-9_]{1,512}$`)
+	whatsAppLanguage     = regexp.MustCompile(`^[a-z]{2,3}(_[A-Z]{2})?$`)
+)
+
+// whatsAppSubscribeKeyword è il messaggio con cui i clienti si iscrivono al menu del giorno
+const whatsAppSubscribeKeyword = "MENU"
+
+// SetWhatsApp imposta il client della Cloud API, il secret dell'app Meta e il token di verifica
+// dei webhook
+func SetWhatsApp(client *whatsapp.Client, appSecret, verifyToken string) {
+	whatsAppClient = client
+	whatsAppAppSecret = appSecret
+	whatsAppVerifyToken = verifyToken
+}
+
+// restaurantWhatsAppAccount restituisce il numero WhatsApp Business del ristorante,
+// decifrandone il token. Restituisce errWhatsAppNotConfigured se il ristorante non ne ha uno
+func restaurantWhatsAppAccount(restaurant *models.Restaurant) (whatsapp.Account, error) {
+	if whatsAppClient == nil || paymentCredentials == nil || restaurant.WhatsApp == nil {
+		return whatsapp.Account{}, errWhatsAppNotConfigured
+	}
+	token, err := paymentCredentials.Decrypt(restaurant.WhatsApp.AccessToken)
+	if err != nil {
+		return whatsapp.Account{}, fmt.Errorf("token WhatsApp non leggibile: %v", err)
+	}
+	return whatsapp.Account{PhoneNumberID: restaurant.WhatsApp.PhoneNumberID, AccessToken: token}, nil
+}
+
+// whatsAppConfirmsOrders indica se il ristorante conferma gli ordini in anticipo su WhatsApp
+func whatsAppConfirmsOrders(restaurant *models.Restaurant) bool {
+	return whatsAppClient != nil && restaurant.WhatsApp != nil &&
+		restaurant.WhatsApp.OrderConfirmations && restaurant.WhatsApp.OrderTemplate != ""
+}
+
+// recordWhatsAppResult conta l'esito di un invio: i destinatari che hanno bloccato il numero
+// non sono errori
+func recordWhatsAppResult(kind string, err error) {
+	switch {
+	case errors.Is(err, whatsapp.ErrOptedOut):
+		whatsAppMessages.Inc(kind, "opted_out")
+	case err != nil:
+		whatsAppMessages.Inc(kind, "failed")
+	default:
+		whatsAppMessages.Inc(kind, "sent")
+	}
+}
+
+// sendOrderWhatsApp conferma l'ordine al cliente con il modello del ristorante: nome del
+// ristorante, numero dell'ordine, orario della fascia e link alla pagina di stato
+func sendOrderWhatsApp(ctx context.Context, restaurant *models.Restaurant, order *models.Order, data map[string]interface{}) error {
+	account, err := restaurantWhatsAppAccount(restaurant)
+	if err != nil {
+		return err
+	}
+	settings := restaurant.WhatsApp
+	_, err = whatsAppClient.SendTemplate(ctx, account, order.Fulfillment.CustomerPhone, whatsapp.Template{
+		Name:     settings.OrderTemplate,
+		Language: settings.TemplateLanguage,
+		Params: []string{
+			restaurant.Name,
+			fmt.Sprint(order.Number),
+			order.Fulfillment.SlotStart.In(time.Local).Format("02/01 15:04"),
+			fmt.Sprint(data["TrackingURL"]),
+		},
+	})
+	recordWhatsAppResult("order", err)
+	if err != nil && !errors.Is(err, whatsapp.ErrOptedOut) {
+		logger.WarnCtx(ctx, "Invio della conferma WhatsApp fallito", map[string]interface{}{
+			"error":    err.Error(),
+			"order_id": order.ID,
+		})
+	}
+	return err
+}
+
+// whatsAppSettingsResponse descrive il numero collegato, senza il token
+func whatsAppSettingsResponse(r *http.Request, restaurant *models.Restaurant) map[string]interface{} {
+	response := map[string]interface{}{
+		"enabled":     whatsAppClient != nil && paymentCredentials != nil,
+		"webhook_url": getBaseURL(r) + "/api/v1/public/whatsapp/webhook",
+	}
+	if s := restaurant.WhatsApp; s != nil {
+		response["phone_number_id"] = s.PhoneNumberID
+		response["display_number"] = s.DisplayNumber
+		response["order_confirmations"] = s.OrderConfirmations
+		response["order_template"] = s.OrderTemplate
+		response["menu_template"] = s.MenuTemplate
+		response["template_language"] = s.TemplateLanguage
+		response["last_broadcast"] = s.LastBroadcast
+		response["chat_url"] = phone.WhatsAppLink(s.DisplayNumber, "")
+		response["subscribe_url"] = phone.WhatsAppLink(s.DisplayNumber, whatsAppSubscribeKeyword)
+		response["updated_at"] = s.UpdatedAt
+	}
+	return response
+}
+
+// GetWhatsAppSettingsHandler restituisce il numero WhatsApp Business collegato, senza il token
+// (GET /api/v1/whatsapp/settings)
+func GetWhatsAppSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	httputil.Success(w, "", whatsAppSettingsResponse(r, restaurant))
+}
+
+// UpdateWhatsAppSettingsHandler collega il numero WhatsApp Business del ristorante
+// (PUT /api/v1/whatsapp/settings). access_token può mancare se il numero non cambia: resta
+// quello salvato, cifrato come le credenziali di pagamento e non più restituito
+func UpdateWhatsAppSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	if whatsAppClient == nil || paymentCredentials == nil {
+		httputil.Conflict(w, "WhatsApp richiede whatsapp.app_secret e security.jwt_secret su questa istanza")
+		return
+	}
+
+	var req struct {
+		PhoneNumberID      string `json:"phone_number_id"`
+		DisplayNumber      string `json:"display_number"`
+		AccessToken        string `json:"access_token"`
+		OrderConfirmations bool   `json:"order_confirmations"`
+		OrderTemplate      string `json:"order_template"`
+		MenuTemplate       string `json:"menu_template"`
+		TemplateLanguage   string `json:"template_language"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httputil.BadRequest(w, "Formato JSON non valido")
+		return
+	}
+	countryCode := "39"
+	if restaurant.Fulfillment != nil && restaurant.Fulfillment.CountryCode != "" {
+		countryCode = restaurant.Fulfillment.CountryCode
+	}
+	settings := &models.WhatsAppSettings{
+		PhoneNumberID:      strings.TrimSpace(req.PhoneNumberID),
+		DisplayNumber:      phone.Normalize(req.DisplayNumber, countryCode),
+		OrderConfirmations: req.OrderConfirmations,
+		OrderTemplate:      strings.TrimSpace(req.OrderTemplate),
+		MenuTemplate:       strings.TrimSpace(req.MenuTemplate),
+		TemplateLanguage:   strings.TrimSpace(req.TemplateLanguage),
+		UpdatedAt:          time.Now(),
+	}
+	if settings.TemplateLanguage == "" {
+		settings.TemplateLanguage = "it"
+	}
+	switch {
+	case settings.PhoneNumberID == "" || strings.Trim(settings.PhoneNumberID, "0123456789") != "":
+		httputil.BadRequest(w, "phone_number_id deve essere l'ID numerico del numero nella Cloud API")
+		return
+	case settings.DisplayNumber == "":
+		httputil.BadRequest(w, "display_number non è un numero di telefono valido")
+		return
+	case settings.OrderTemplate != "" && !whatsAppTemplateName.MatchString(settings.OrderTemplate),
+		settings.MenuTemplate != "" && !whatsAppTemplateName.MatchString(settings.MenuTemplate):
+		httputil.BadRequest(w, "I nomi dei modelli possono contenere solo lettere minuscole, cifre e _")
+		return
+	case settings.OrderConfirmations && settings.OrderTemplate == "":
+		httputil.BadRequest(w, "order_template è obbligatorio per confermare gli ordini su WhatsApp")
+		return
+	case !whatsAppLanguage.MatchString(settings.TemplateLanguage):
+		httputil.BadRequest(w, "template_language deve essere un codice lingua, es. it o en_US")
+		return
+	}
+
+	token := strings.TrimSpace(req.AccessToken)
+	switch {
+	case token != "":
+		sealed, err := paymentCredentials.Encrypt(token)
+		if err != nil {
+			respondMenuV2Error(w, r, err, "Errore nella cifratura del token")
+			return
+		}
+		settings.AccessToken = sealed
+	case restaurant.WhatsApp != nil && restaurant.WhatsApp.PhoneNumberID == settings.PhoneNumberID:
+		settings.AccessToken = restaurant.WhatsApp.AccessToken
+	default:
+		httputil.BadRequest(w, "access_token è obbligatorio per collegare un nuovo numero")
+		return
+	}
+	if restaurant.WhatsApp != nil {
+		settings.LastBroadcast = restaurant.WhatsApp.LastBroadcast
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if other, err := db.MongoInstance.GetRestaurantByWhatsAppNumber(ctx, settings.PhoneNumberID); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella verifica del numero")
+		return
+	} else if other != nil && other.ID != restaurant.ID {
+		httputil.Conflict(w, "Il numero WhatsApp è già collegato a un altro ristorante")
+		return
+	}
+	if err := db.MongoInstance.SetRestaurantWhatsApp(ctx, restaurant.ID, settings); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio del numero WhatsApp")
+		return
+	}
+	restaurant.WhatsApp = settings
+
+	RecordAuditLogAsync("WHATSAPP_SETTINGS_UPDATED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Success(w, "Numero WhatsApp collegato", whatsAppSettingsResponse(r, restaurant))
+}
+
+// DeleteWhatsAppSettingsHandler scollega il numero WhatsApp Business e ne cancella il token
+// (DELETE /api/v1/whatsapp/settings). Gli iscritti restano, per un numero collegato in seguito
+func DeleteWhatsAppSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := db.MongoInstance.SetRestaurantWhatsApp(ctx, restaurant.ID, nil); err != nil {
+		respondMenuV2Error(w, r, err, "Errore nello scollegamento del numero WhatsApp")
+		return
+	}
+	RecordAuditLogAsync("WHATSAPP_SETTINGS_DELETED", "restaurant", restaurant.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.NoContent(w)
+}
+
+// whatsAppSubscriberQuery è la paginazione dell'elenco degli iscritti
+var whatsAppSubscriberQuery = httputil.ListOptions{
+	DefaultPerPage: 50,
+	MaxPerPage:     200,
+	DefaultSort:    "-subscribed_at",
+	Sortable:       []string{"subscribed_at"},
+}
+
+// ListWhatsAppSubscribersHandler elenca gli iscritti al menu del giorno su WhatsApp
+// (GET /api/v1/whatsapp/subscribers)
+func ListWhatsAppSubscribersHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	query, err := httputil.ParseListQuery(r, whatsAppSubscriberQuery)
+	if err != nil {
+		httputil.BadRequest(w, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	subscribers, total, err := db.MongoInstance.FindWhatsAppSubscribers(ctx, restaurant.ID, dbListOptions(query))
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero degli iscritti")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	httputil.List(w, subscribers, query, total)
+}
+
+// WhatsAppBroadcastHandler invia il piatto del giorno di oggi agli iscritti con il modello del
+// ristorante: nome del ristorante, titolo, descrizione con portate e prezzo, link al menu
+// (POST /api/v1/whatsapp/broadcast). L'invio prosegue in background e si fa una volta al giorno
+func WhatsAppBroadcastHandler(w http.ResponseWriter, r *http.Request) {
+	restaurant := currentRestaurantV2(w, r)
+	if restaurant == nil {
+		return
+	}
+	account, err := restaurantWhatsAppAccount(restaurant)
+	if errors.Is(err, errWhatsAppNotConfigured) || (err == nil && restaurant.WhatsApp.MenuTemplate == "") {
+		httputil.Conflict(w, "Collega un numero WhatsApp con il modello del menu del giorno (menu_template)")
+		return
+	}
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella lettura del numero WhatsApp")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	today := time.Now().UTC().Format(models.DailySpecialDateLayout)
+	specials, err := db.MongoInstance.GetDailySpecials(ctx, restaurant.ID, today, today)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero del piatto del giorno")
+		return
+	}
+	if len(specials) == 0 {
+		httputil.Conflict(w, "Nessun piatto del giorno per oggi")
+		return
+	}
+	baseURL, err := emailBaseURL()
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nella preparazione del messaggio")
+		return
+	}
+	subscribers, total, err := db.MongoInstance.FindWhatsAppSubscribers(ctx, restaurant.ID, db.ListOptions{})
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel recupero degli iscritti")
+		return
+	}
+	marked, err := db.MongoInstance.MarkWhatsAppBroadcast(ctx, restaurant.ID, today)
+	if err != nil {
+		respondMenuV2Error(w, r, err, "Errore nel salvataggio dell'invio")
+		return
+	}
+	if !marked {
+		httputil.Conflict(w, "Il menu del giorno è già stato inviato oggi")
+		return
+	}
+
+	special := specials[0]
+	tmpl := whatsapp.Template{
+		Name:     restaurant.WhatsApp.MenuTemplate,
+		Language: restaurant.WhatsApp.TemplateLanguage,
+		Params: []string{
+			restaurant.Name,
+			special.Title,
+			strings.ReplaceAll(specialText(special), "\n", " · "),
+			specialLink(baseURL, restaurant.Username, special),
+		},
+	}
+	if tmpl.Params[2] == "" {
+		tmpl.Params[2] = "-" // Le variabili dei modelli non possono essere vuote
+	}
+	go broadcastWhatsApp(restaurant.ID, account, tmpl, subscribers)
+
+	RecordAuditLogAsync("WHATSAPP_MENU_BROADCAST", "daily_special", special.ID, restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+	httputil.Accepted(w, "Invio del menu del giorno avviato", map[string]interface{}{
+		"date":        today,
+		"special_id":  special.ID,
+		"subscribers": total,
+	})
+}
+
+// broadcastWhatsApp invia il modello agli iscritti uno alla volta, cancellando chi ha
+// bloccato i messaggi del ristorante
+func broadcastWhatsApp(restaurantID string, account whatsapp.Account, tmpl whatsapp.Template, subscribers []*models.WhatsAppSubscriber) {
+	sent := 0
+	for _, sub := range subscribers {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		_, err := whatsAppClient.SendTemplate(ctx, account, sub.Phone, tmpl)
+		recordWhatsAppResult("menu", err)
+		switch {
+		case errors.Is(err, whatsapp.ErrOptedOut):
+			if _, derr := db.MongoInstance.DeleteWhatsAppSubscriber(ctx, restaurantID, sub.Phone); derr != nil {
+				logger.Warn("Errore nella cancellazione dell'iscritto WhatsApp", map[string]interface{}{
+					"error": derr.Error(),
+				})
+			}
+		case errors.Is(err, whatsapp.ErrPermanent):
+			// Modello o token non validi: fallirebbe per tutti gli iscritti
+			cancel()
+			logger.Error("Invio del menu del giorno su WhatsApp interrotto", map[string]interface{}{
+				"error":         err.Error(),
+				"restaurant_id": restaurantID,
+				"sent":          sent,
+			})
+			return
+		case err != nil:
+			logger.Warn("Invio del menu del giorno su WhatsApp fallito", map[string]interface{}{
+				"error":         err.Error(),
+				"restaurant_id": restaurantID,
+			})
+		default:
+			sent++
+		}
+		cancel()
+	}
+	logger.Info("Menu del giorno inviato su WhatsApp", map[string]interface{}{
+		"restaurant_id": restaurantID,
+		"sent":          sent,
+		"subscribers":   len(subscribers),
+	})
+}
+
+// WhatsAppWebhookHandler riceve i webhook della Cloud API (/api/v1/public/whatsapp/webhook).
+// GET risponde alla verifica della registrazione; POST, firmato con il secret dell'app, porta
+// i messaggi dei clienti: MENU iscrive al menu del giorno del ristorante che li riceve, STOP
+// cancella l'iscrizione. Gli esiti di consegna cancellano gli iscritti che hanno bloccato i messaggi
+func WhatsAppWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if whatsAppClient == nil {
+		httputil.NotFound(w, "Endpoint")
+		return
+	}
+	if r.Method == http.MethodGet {
+		challenge, ok := whatsapp.VerifyChallenge(r, whatsAppVerifyToken)
+		if !ok {
+			httputil.Forbidden(w, "Token di verifica non valido")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, challenge)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	var notification *whatsapp.Notification
+	if err == nil {
+		if !whatsapp.VerifySignature(whatsAppAppSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+			err = errors.New("firma non valida")
+		} else {
+			notification, err = whatsapp.ParseWebhook(body)
+		}
+	}
+	if err != nil {
+		logger.SecurityEventCtx(r.Context(), "WHATSAPP_WEBHOOK_REJECTED", "Webhook WhatsApp non valido", "", map[string]interface{}{
+			"error": err.Error(),
+			"ip":    getClientIP(r),
+		})
+		httputil.BadRequest(w, "Webhook non valido")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	restaurants := map[string]*models.Restaurant{}
+	restaurantFor := func(phoneNumberID string) (*models.Restaurant, error) {
+		if restaurant, ok := restaurants[phoneNumberID]; ok {
+			return restaurant, nil
+		}
+		restaurant, err := db.MongoInstance.GetRestaurantByWhatsAppNumber(ctx, phoneNumberID)
+		if err == nil {
+			restaurants[phoneNumberID] = restaurant
+		}
+		return restaurant, err
+	}
+
+	for _, msg := range notification.Messages {
+		restaurant, err := restaurantFor(msg.PhoneNumberID)
+		if err == nil && restaurant != nil {
+			err = handleWhatsAppMessage(ctx, r, restaurant, msg)
+		}
+		if err != nil {
+			logger.ErrorCtx(r.Context(), "Errore nella gestione del messaggio WhatsApp", map[string]interface{}{
+				"error":      err.Error(),
+				"message_id": msg.ID,
+			})
+			httputil.InternalServerError(w, "Errore nella gestione del messaggio")
+			return
+		}
+	}
+	for _, status := range notification.Statuses {
+		if !status.OptedOut() {
+			continue
+		}
+		restaurant, err := restaurantFor(status.PhoneNumberID)
+		if err == nil && restaurant != nil {
+			_, err = db.MongoInstance.DeleteWhatsAppSubscriber(ctx, restaurant.ID, status.Recipient)
+		}
+		if err != nil {
+			logger.ErrorCtx(r.Context(), "Errore nella cancellazione dell'iscritto WhatsApp", map[string]interface{}{
+				"error":      err.Error(),
+				"message_id": status.MessageID,
+			})
+			httputil.InternalServerError(w, "Errore nella gestione dell'esito")
+			return
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleWhatsAppMessage iscrive o cancella il mittente dal menu del giorno e gli risponde.
+// Gli altri messaggi sono lasciati al ristorante, che li legge dalla sua app WhatsApp Business
+func handleWhatsAppMessage(ctx context.Context, r *http.Request, restaurant *models.Restaurant, msg whatsapp.Message) error {
+	keyword := strings.ToUpper(strings.Trim(strings.TrimSpace(msg.Text), ".!"))
+	var action, reply string
+	switch {
+	case sms.IsOptOut(msg.Text):
+		removed, err := db.MongoInstance.DeleteWhatsAppSubscriber(ctx, restaurant.ID, msg.From)
+		if err != nil || !removed {
+			return err
+		}
+		action, reply = "WHATSAPP_UNSUBSCRIBED", i18n.KeyWhatsAppUnsubscribed
+	case keyword == whatsAppSubscribeKeyword || sms.IsOptIn(msg.Text):
+		if err := db.MongoInstance.SaveWhatsAppSubscriber(ctx, &models.WhatsAppSubscriber{
+			ID:           uuid.New().String(),
+			RestaurantID: restaurant.ID,
+			Phone:        msg.From,
+			Name:         msg.Name,
+			SubscribedAt: time.Now(),
+		}); err != nil {
+			return err
+		}
+		action, reply = "WHATSAPP_SUBSCRIBED", i18n.KeyWhatsAppSubscribed
+	default:
+		return nil
+	}
+	RecordAuditLogAsync(action, "phone", phoneLabel(msg.From), restaurant.ID, getClientIP(r), r.UserAgent(), "success")
+
+	// La risposta arriva entro le 24 ore dal messaggio del cliente: non serve un modello. Ai
+	// numeri stranieri si risponde in inglese
+	locale := "en"
+	if strings.HasPrefix(msg.From, "39") {
+		locale = "it"
+	}
+	// Il link parte dal numero del ristorante: mai costruirlo dall'Host del webhook
+	baseURL, err := emailBaseURL()
+	var text i18n.Message
+	if err == nil {
+		text, err = i18n.Default().Render(locale, reply, map[string]interface{}{
+			"RestaurantName": restaurant.Name,
+			"MenuURL":        restaurantPublicURL(baseURL, restaurant),
+		})
+	}
+	if err == nil {
+		var account whatsapp.Account
+		if account, err = restaurantWhatsAppAccount(restaurant); err == nil {
+			_, err = whatsAppClient.SendText(ctx, account, msg.From, text.Body)
+			recordWhatsAppResult("reply", err)
+		}
+	}
+	if err != nil {
+		logger.WarnCtx(ctx, "Risposta WhatsApp non inviata", map[string]interface{}{
+			"error":         err.Error(),
+			"restaurant_id": restaurant.ID,
+		})
+	}
+	return nil
+}
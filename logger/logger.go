@@ -31,6 +31,17 @@ var levelNames = map[LogLevel]string{
 	FATAL: "FATAL",
 }
 
+// ParseLevel converte un livello testuale (es. "debug", "INFO") nel LogLevel corrispondente.
+// I valori sconosciuti restituiscono INFO
+func ParseLevel(level string) LogLevel {
+	for l, name := range levelNames {
+		if strings.EqualFold(name, level) {
+			return l
+		}
+	}
+	return INFO
+}
+
 // LogEntry rappresenta una singola voce di log strutturata
 type LogEntry struct {
 	Timestamp string                 `json:"timestamp"`
@@ -41,6 +52,7 @@ type LogEntry struct {
 	UserID    string                 `json:"user_id,omitempty"`
 	IP        string                 `json:"ip,omitempty"`
 	UserAgent string                 `json:"user_agent,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
 }
 
 // Logger rappresenta il logger personalizzato
@@ -121,7 +133,7 @@ func getSource() string {
 }
 
 // writeLog scrive una voce di log
-func (l *Logger) writeLog(level LogLevel, message string, data map[string]interface{}, userID, ip, userAgent string) {
+func (l *Logger) writeLog(level LogLevel, message string, data map[string]interface{}, userID, ip, userAgent, requestID string) {
 	if level < l.level {
 		return
 	}
@@ -135,6 +147,7 @@ func (l *Logger) writeLog(level LogLevel, message string, data map[string]interf
 		UserID:    userID,
 		IP:        ip,
 		UserAgent: userAgent,
+		RequestID: requestID,
 	}
 
 	// Serializza in JSON
@@ -153,35 +166,35 @@ func (l *Logger) writeLog(level LogLevel, message string, data map[string]interf
 // Debug scrive un log di debug
 func Debug(message string, data map[string]interface{}) {
 	if defaultLogger != nil {
-		defaultLogger.writeLog(DEBUG, message, data, "", "", "")
+		defaultLogger.writeLog(DEBUG, message, data, "", "", "", "")
 	}
 }
 
 // Info scrive un log informativo
 func Info(message string, data map[string]interface{}) {
 	if defaultLogger != nil {
-		defaultLogger.writeLog(INFO, message, data, "", "", "")
+		defaultLogger.writeLog(INFO, message, data, "", "", "", "")
 	}
 }
 
 // Warn scrive un log di warning
 func Warn(message string, data map[string]interface{}) {
 	if defaultLogger != nil {
-		defaultLogger.writeLog(WARN, message, data, "", "", "")
+		defaultLogger.writeLog(WARN, message, data, "", "", "", "")
 	}
 }
 
 // Error scrive un log di errore
 func Error(message string, data map[string]interface{}) {
 	if defaultLogger != nil {
-		defaultLogger.writeLog(ERROR, message, data, "", "", "")
+		defaultLogger.writeLog(ERROR, message, data, "", "", "", "")
 	}
 }
 
 // Fatal scrive un log critico e termina l'applicazione
 func Fatal(message string, data map[string]interface{}) {
 	if defaultLogger != nil {
-		defaultLogger.writeLog(FATAL, message, data, "", "", "")
+		defaultLogger.writeLog(FATAL, message, data, "", "", "", "")
 	}
 	os.Exit(1)
 }
@@ -191,21 +204,21 @@ func Fatal(message string, data map[string]interface{}) {
 // InfoWithContext scrive un log informativo con contesto utente
 func InfoWithContext(message string, data map[string]interface{}, userID, ip, userAgent string) {
 	if defaultLogger != nil {
-		defaultLogger.writeLog(INFO, message, data, userID, ip, userAgent)
+		defaultLogger.writeLog(INFO, message, data, userID, ip, userAgent, "")
 	}
 }
 
 // WarnWithContext scrive un log di warning con contesto utente
 func WarnWithContext(message string, data map[string]interface{}, userID, ip, userAgent string) {
 	if defaultLogger != nil {
-		defaultLogger.writeLog(WARN, message, data, userID, ip, userAgent)
+		defaultLogger.writeLog(WARN, message, data, userID, ip, userAgent, "")
 	}
 }
 
 // ErrorWithContext scrive un log di errore con contesto utente
 func ErrorWithContext(message string, data map[string]interface{}, userID, ip, userAgent string) {
 	if defaultLogger != nil {
-		defaultLogger.writeLog(ERROR, message, data, userID, ip, userAgent)
+		defaultLogger.writeLog(ERROR, message, data, userID, ip, userAgent, "")
 	}
 }
 
@@ -0,0 +1,99 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+)
+
+// RequestInfo identifica la richiesta HTTP in corso. Il middleware la salva nel context
+// e le funzioni *Ctx la aggiungono a ogni voce di log
+type RequestInfo struct {
+	ID        string
+	IP        string
+	UserAgent string
+}
+
+type requestKey struct{}
+
+// WithRequest restituisce un context che porta con sé info
+func WithRequest(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestKey{}, info)
+}
+
+// RequestFromContext restituisce le informazioni della richiesta salvate in ctx
+func RequestFromContext(ctx context.Context) (RequestInfo, bool) {
+	if ctx == nil {
+		return RequestInfo{}, false
+	}
+	info, ok := ctx.Value(requestKey{}).(RequestInfo)
+	return info, ok
+}
+
+// RequestID restituisce l'ID della richiesta salvato in ctx, oppure ""
+func RequestID(ctx context.Context) string {
+	info, _ := RequestFromContext(ctx)
+	return info.ID
+}
+
+// Funzioni di logging con il context della richiesta (request ID, IP e User-Agent)
+
+// DebugCtx scrive un log di debug con il context della richiesta
+func DebugCtx(ctx context.Context, message string, data map[string]interface{}) {
+	if defaultLogger != nil {
+		info, _ := RequestFromContext(ctx)
+		defaultLogger.writeLog(DEBUG, message, data, "", info.IP, info.UserAgent, info.ID)
+	}
+}
+
+// InfoCtx scrive un log informativo con il context della richiesta
+func InfoCtx(ctx context.Context, message string, data map[string]interface{}) {
+	if defaultLogger != nil {
+		info, _ := RequestFromContext(ctx)
+		defaultLogger.writeLog(INFO, message, data, "", info.IP, info.UserAgent, info.ID)
+	}
+}
+
+// WarnCtx scrive un log di warning con il context della richiesta
+func WarnCtx(ctx context.Context, message string, data map[string]interface{}) {
+	if defaultLogger != nil {
+		info, _ := RequestFromContext(ctx)
+		defaultLogger.writeLog(WARN, message, data, "", info.IP, info.UserAgent, info.ID)
+	}
+}
+
+// ErrorCtx scrive un log di errore con il context della richiesta
+func ErrorCtx(ctx context.Context, message string, data map[string]interface{}) {
+	if defaultLogger != nil {
+		info, _ := RequestFromContext(ctx)
+		defaultLogger.writeLog(ERROR, message, data, "", info.IP, info.UserAgent, info.ID)
+	}
+}
+
+// SecurityEventCtx registra un evento di sicurezza con il context della richiesta
+func SecurityEventCtx(ctx context.Context, eventType, message, userID string, data map[string]interface{}) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["security_event"] = true
+	data["event_type"] = eventType
+
+	if defaultLogger != nil {
+		info, _ := RequestFromContext(ctx)
+		defaultLogger.writeLog(WARN, fmt.Sprintf("SECURITY: %s - %s", eventType, message), data, userID, info.IP, info.UserAgent, info.ID)
+	}
+}
+
+// AuditLogCtx registra un evento di audit con il context della richiesta
+func AuditLogCtx(ctx context.Context, action, resource, message, userID string, data map[string]interface{}) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data["audit"] = true
+	data["action"] = action
+	data["resource"] = resource
+
+	if defaultLogger != nil {
+		info, _ := RequestFromContext(ctx)
+		defaultLogger.writeLog(INFO, fmt.Sprintf("AUDIT: %s on %s - %s", action, resource, message), data, userID, info.IP, info.UserAgent, info.ID)
+	}
+}
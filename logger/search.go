@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SearchQuery filtra le voci dei file di log. I campi vuoti non filtrano
+type SearchQuery struct {
+	RequestID string
+	Level     string    // DEBUG, INFO, WARN, ERROR, FATAL (case insensitive)
+	From      time.Time // Incluso
+	To        time.Time // Escluso
+	Limit     int       // Numero massimo di voci, le più recenti
+}
+
+// Search cerca nei file di log della directory configurata, dal più recente, e
+// restituisce al massimo q.Limit voci in ordine cronologico
+func Search(q SearchQuery) ([]LogEntry, error) {
+	if defaultLogger == nil {
+		return nil, fmt.Errorf("logger non inizializzato")
+	}
+	return searchDir(defaultLogger.logDir, q)
+}
+
+func searchDir(dir string, q SearchQuery) ([]LogEntry, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "qr-menu-*.log"))
+	if err != nil {
+		return nil, err
+	}
+	// Il nome contiene la data di apertura: in ordine inverso si parte dal più recente
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+
+	var results []LogEntry
+	for _, file := range files {
+		// Un file aperto dopo la fine dell'intervallo non può contenere voci utili
+		if !q.To.IsZero() {
+			opened, err := time.Parse("2006-01-02", strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "qr-menu-"), ".log"))
+			if err == nil && !opened.Before(q.To) {
+				continue
+			}
+		}
+
+		entries, err := searchFile(file, q)
+		if err != nil {
+			return nil, err
+		}
+		// Le voci del file sono cronologiche: vanno prima di quelle dei file più recenti
+		results = append(entries, results...)
+		if q.Limit > 0 && len(results) >= q.Limit {
+			return results[len(results)-q.Limit:], nil
+		}
+	}
+	return results, nil
+}
+
+func searchFile(path string, q SearchQuery) ([]LogEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []LogEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		// Scarta subito le righe che non possono corrispondere, senza decodificarle
+		if q.RequestID != "" && !strings.Contains(string(line), q.RequestID) {
+			continue
+		}
+
+		var entry LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		if q.RequestID != "" && entry.RequestID != q.RequestID {
+			continue
+		}
+		if q.Level != "" && !strings.EqualFold(entry.Level, q.Level) {
+			continue
+		}
+		if !q.From.IsZero() || !q.To.IsZero() {
+			ts, err := time.Parse(time.RFC3339, entry.Timestamp)
+			if err != nil || (!q.From.IsZero() && ts.Before(q.From)) || (!q.To.IsZero() && !ts.Before(q.To)) {
+				continue
+			}
+		}
+
+		entries = append(entries, entry)
+		// Con un limite basta tenere le ultime voci del file
+		if q.Limit > 0 && len(entries) > 2*q.Limit {
+			entries = append(entries[:0:0], entries[len(entries)-q.Limit:]...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("errore nella lettura di %s: %v", filepath.Base(path), err)
+	}
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[len(entries)-q.Limit:]
+	}
+	return entries, nil
+}
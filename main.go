@@ -1,30 +1,45 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
 
 	"qr-menu/db"
 	"qr-menu/logger"
 	"qr-menu/pkg/app"
+	"qr-menu/pkg/config"
 )
 
 func main() {
-	// Inizializza il logger PRIMA di tutto
-	logLevel := logger.INFO
-	if lvl := os.Getenv("LOG_LEVEL"); lvl == "DEBUG" {
-		logLevel = logger.DEBUG
+	// Carica la configurazione: default, config.yaml (o CONFIG_FILE) e variabili d'ambiente
+	configPath := os.Getenv("CONFIG_FILE")
+	if configPath == "" {
+		configPath = "config.yaml"
 	}
-	
-	// Su Railway/Cloud usa directory temporanea, in locale usa ./logs
-	logDir := "./logs"
-	if os.Getenv("PORT") != "" {
-		// In produzione (Railway) usa /tmp per i log
-		logDir = "/tmp/logs"
+
+	// Comandi di amministrazione ("qr-menu help" li elenca): non avviano il server
+	if len(os.Args) > 1 {
+		os.Exit(runCLI(configPath, os.Args[1:]))
 	}
-	
+
+	settings, err := config.LoadFile(configPath)
+	if err != nil {
+		log.Fatalf("❌ Errore nella configurazione: %v", err)
+	}
+
+	// Inizializza il logger PRIMA di tutto
+	// (su Railway/Cloud la directory di default è /tmp/logs, in locale ./logs)
+	logLevel := logger.ParseLevel(settings.Logger.Level)
+	logDir := settings.Paths.LogDir
+
 	if err := logger.Init(logLevel, logDir); err != nil {
 		log.Printf("⚠️ Errore nell'inizializzazione del logger: %v (continuo con log.Println)", err)
 	}
@@ -46,8 +61,8 @@ func main() {
 			"  - MONGODB_CERT_CONTENT: contenuto del certificato PEM (per Railway/Cloud)\n"+
 			"  - MONGODB_CERT_PATH: path al file certificato (per sviluppo locale)\n"+
 			"  - MONGODB_DB_NAME: nome del database (default: qr-menu)", err)
-		log.Fatalf(errMsg)
-		logger.Fatal("Errore connessione MongoDB", map[string]interface{}{"error": err.Error()})
+		logger.Error("Errore connessione MongoDB", map[string]interface{}{"error": err.Error()})
+		log.Fatal(errMsg)
 	}
 	log.Println("✓ MongoDB connesso con successo")
 	logger.Info("✅ MongoDB connesso con successo", nil)
@@ -72,46 +87,133 @@ func main() {
 	// Configurazione
 	cfg := app.DefaultConfig()
 	cfg.DatabaseURL = os.Getenv("DATABASE_URL")
+	cfg.LogLevel = logLevel
+	cfg.LogDir = logDir
+	cfg.Settings = settings
 
 	// Inizializza tutti i servizi
 	services, err := app.InitializeServices(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize services: %v", err)
 	}
-	defer services.Shutdown()
 
 	// Crea le directory necessarie
-	createDirectories()
+	createDirectories(settings)
 
 	// Setup router con tutte le route
 	router := app.SetupRouter(services)
 
-	// HTTPS Redirect Middleware (solo in staging/production)
-	env := os.Getenv("ENVIRONMENT")
-	if env == "production" || env == "staging" {
+	// HTTPS Redirect Middleware (solo in staging/production dietro proxy: con TLS
+	// nativo il redirect lo fa il listener in chiaro)
+	env := settings.Server.Environment
+	if (settings.IsProduction() || settings.IsStaging()) && !settings.TLSEnabled() {
 		router.Use(httpsRedirectMiddleware)
 		logger.Info("HTTPS redirect enabled", map[string]interface{}{"env": env})
 	}
 
-	// Determina porta
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Porta (server.port, SERVER_PORT o PORT)
+	port := strconv.Itoa(settings.Server.Port)
+
+	scheme := "http"
+	if settings.TLSEnabled() {
+		scheme = "https"
 	}
 
 	// Log startup
 	logger.Info("QR Menu System ready", map[string]interface{}{
 		"port":       port,
-		"admin_url":  "http://localhost:" + port + "/admin",
-		"login_url":  "http://localhost:" + port + "/login",
-		"api_docs":   "http://localhost:" + port + "/api/v1/docs",
-		"api_health": "http://localhost:" + port + "/api/v1/health",
+		"admin_url":  scheme + "://localhost:" + port + "/admin",
+		"login_url":  scheme + "://localhost:" + port + "/login",
+		"api_docs":   scheme + "://localhost:" + port + "/api/v1/docs",
+		"api_health": scheme + "://localhost:" + port + "/api/v1/health",
 	})
 
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           router,
+		ReadHeaderTimeout: settings.Server.ReadHeaderTimeout,
+		ReadTimeout:       settings.Server.ReadTimeout,
+		WriteTimeout:      settings.Server.WriteTimeout,
+		IdleTimeout:       settings.Server.IdleTimeout,
+		MaxHeaderBytes:    1 << 20,
+	}
+
+	// TLS nativo: certificati da file o Let's Encrypt, più il listener HTTP di redirect
+	redirectServer, err := app.ConfigureTLS(server, settings)
+	if err != nil {
+		log.Fatalf("❌ Errore nella configurazione TLS: %v", err)
+	}
+
+	// Listener gRPC per casse POS e totem (grpc.enabled)
+	grpcServer, err := app.NewGRPCServer(settings)
+	if err != nil {
+		log.Fatalf("❌ Errore nella configurazione gRPC: %v", err)
+	}
+
+	// SIGINT (Ctrl+C) e SIGTERM (Railway/Docker) avviano lo spegnimento graceful
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Avvia server
-	if err := http.ListenAndServe(":"+port, router); err != nil {
+	serverErr := make(chan error, 3)
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+	if redirectServer != nil {
+		logger.Info("Redirect HTTP → HTTPS attivo", map[string]interface{}{"addr": redirectServer.Addr})
+		go func() {
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+	}
+	if grpcServer != nil {
+		logger.Info("Server gRPC attivo", map[string]interface{}{"addr": grpcServer.Addr})
+		go func() {
+			if err := grpcServer.ListenAndServe(); err != nil {
+				serverErr <- err
+			}
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		services.Shutdown(context.Background())
 		logger.Fatal("Server failed", map[string]interface{}{"error": err.Error()})
+	case <-ctx.Done():
 	}
+	stop()
+
+	logger.Info("Segnale di arresto ricevuto, spegnimento in corso", map[string]interface{}{
+		"timeout": settings.Server.ShutdownTimeout.String(),
+	})
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), settings.Server.ShutdownTimeout)
+	defer cancel()
+
+	// Prima smette di accettare connessioni e attende le richieste in corso, poi ferma i servizi
+	if redirectServer != nil {
+		redirectServer.Shutdown(shutdownCtx)
+	}
+	if grpcServer != nil {
+		grpcServer.Shutdown(shutdownCtx)
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Richieste in corso interrotte allo spegnimento", map[string]interface{}{"error": err.Error()})
+	}
+	if err := services.Shutdown(shutdownCtx); err != nil {
+		log.Printf("⚠️ Spegnimento servizi incompleto: %v", err)
+	}
+
+	log.Println("👋 Server arrestato")
 }
 
 // httpsRedirectMiddleware forza HTTPS in produzione/staging
@@ -130,12 +232,12 @@ func httpsRedirectMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func createDirectories() {
+func createDirectories(settings *config.Config) {
 	dirs := []string{
-		"storage",
-		"static/qrcodes",
-		"static/css",
-		"static/js",
+		settings.Paths.StorageDir,
+		filepath.Join(settings.Paths.StaticDir, "qrcodes"),
+		filepath.Join(settings.Paths.StaticDir, "css"),
+		filepath.Join(settings.Paths.StaticDir, "js"),
 		"templates",
 	}
 
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// CachePolicies associa un prefisso di route al valore dell'header Cache-Control
+type CachePolicies map[string]string
+
+// DefaultCachePolicies restituisce le policy di default per le route pubbliche.
+// Le pagine dei menu usano un TTL breve con revalidazione via ETag, così un CDN
+// può servirle senza mostrare modifiche vecchie per più di un minuto
+func DefaultCachePolicies() CachePolicies {
+	return CachePolicies{
+		"/static/": "public, max-age=86400",
+		"/qr/":     "public, max-age=3600",
+		"/img/":    "public, max-age=31536000, immutable",
+		"/menu/":   "public, max-age=60, stale-while-revalidate=300",
+		"/r/":      "public, max-age=60",
+		"/embed/":  "public, max-age=300",
+
+		"/sitemap.xml": "public, max-age=3600",
+		"/robots.txt":  "public, max-age=86400",
+	}
+}
+
+// LoadCachePolicies restituisce le policy di default sovrascritte dalla variabile
+// CACHE_CONTROL_POLICIES, nel formato "/prefisso/=valore;/altro/=valore".
+// Un valore vuoto disabilita la policy per quel prefisso
+func LoadCachePolicies() CachePolicies {
+	policies := DefaultCachePolicies()
+
+	for _, entry := range strings.Split(os.Getenv("CACHE_CONTROL_POLICIES"), ";") {
+		prefix, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || prefix == "" {
+			continue
+		}
+		if value == "" {
+			delete(policies, prefix)
+			continue
+		}
+		policies[prefix] = strings.TrimSpace(value)
+	}
+
+	return policies
+}
+
+// Middleware imposta Cache-Control in base al prefisso più specifico che corrisponde
+// alla richiesta. Gli handler possono comunque sovrascrivere l'header
+func (p CachePolicies) Middleware(next http.Handler) http.Handler {
+	prefixes := make([]string, 0, len(p))
+	for prefix := range p {
+		prefixes = append(prefixes, prefix)
+	}
+	// Il prefisso più lungo vince
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					w.Header().Set("Cache-Control", p[prefix])
+					break
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
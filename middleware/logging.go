@@ -1,12 +1,58 @@
 package middleware
 
 import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
 	"net/http"
 	"qr-menu/logger"
+	"qr-menu/pkg/memstore"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// RequestIDHeader è l'header con cui l'ID della richiesta arriva da un proxy e torna al client
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDMiddleware assegna a ogni richiesta un ID di correlazione: quello ricevuto in
+// X-Request-ID se valido (es. generato dal proxy), altrimenti uno nuovo. L'ID torna nella
+// risposta e, insieme a IP e User-Agent, nel context usato dalle funzioni logger.*Ctx
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = generateRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := logger.WithRequest(r.Context(), logger.RequestInfo{
+			ID:        id,
+			IP:        getClientIP(r),
+			UserAgent: r.UserAgent(),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID accetta ID fino a 128 caratteri alfanumerici, '-', '_', '.' e ':',
+// così un valore arbitrario del client non può sporcare i log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // ResponseWriter wrapper per catturare status code e response size
 type responseWriter struct {
 	http.ResponseWriter
@@ -25,6 +71,11 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
+// Hijack passa la connessione a chi la chiede, come l'upgrade a WebSocket del KDS
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
 // LoggingMiddleware intercetta tutte le richieste HTTP e le logga
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -36,21 +87,17 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 			statusCode:     200, // default
 		}
 
-		// Estrae informazioni della richiesta
-		ip := getClientIP(r)
-		userAgent := r.UserAgent()
-
-		// Log della richiesta in arrivo
-		logger.InfoWithContext("HTTP Request", map[string]interface{}{
-			"method":     r.Method,
-			"url":        r.URL.String(),
-			"path":       r.URL.Path,
-			"query":      r.URL.RawQuery,
-			"referer":    r.Referer(),
-			"proto":      r.Proto,
-			"host":       r.Host,
-			"request_id": generateRequestID(),
-		}, "", ip, userAgent)
+		// Log della richiesta in arrivo (request ID, IP e User-Agent arrivano dal context)
+		ctx := r.Context()
+		logger.InfoCtx(ctx, "HTTP Request", map[string]interface{}{
+			"method":  r.Method,
+			"url":     r.URL.String(),
+			"path":    r.URL.Path,
+			"query":   r.URL.RawQuery,
+			"referer": r.Referer(),
+			"proto":   r.Proto,
+			"host":    r.Host,
+		})
 
 		// Esegue la richiesta
 		next.ServeHTTP(wrapped, r)
@@ -79,18 +126,19 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 
 		switch logLevel {
 		case "warn":
-			logger.WarnWithContext(message, logData, "", ip, userAgent)
+			logger.WarnCtx(ctx, message, logData)
 		case "error":
-			logger.ErrorWithContext(message, logData, "", ip, userAgent)
+			logger.ErrorCtx(ctx, message, logData)
 		default:
-			logger.InfoWithContext(message, logData, "", ip, userAgent)
+			logger.InfoCtx(ctx, message, logData)
 		}
 
 		// Log performance se la richiesta è lenta
 		if duration > time.Second {
 			logger.PerformanceLog("HTTP Request", duration, map[string]interface{}{
-				"method": r.Method,
-				"path":   r.URL.Path,
+				"method":     r.Method,
+				"path":       r.URL.Path,
+				"request_id": logger.RequestID(ctx),
 			})
 		}
 	})
@@ -113,9 +161,8 @@ func SecurityMiddleware(next http.Handler) http.Handler {
 		url := r.URL.String()
 		for _, pattern := range suspiciousPatterns {
 			if containsCaseInsensitive(url, pattern) {
-				logger.SecurityEvent("SUSPICIOUS_URL",
-					"Pattern sospetto rilevato nell'URL",
-					"", ip, userAgent,
+				logger.SecurityEventCtx(r.Context(), "SUSPICIOUS_URL",
+					"Pattern sospetto rilevato nell'URL", "",
 					map[string]interface{}{
 						"url":     url,
 						"pattern": pattern,
@@ -133,9 +180,8 @@ func SecurityMiddleware(next http.Handler) http.Handler {
 
 		for _, agent := range suspiciousAgents {
 			if containsCaseInsensitive(userAgent, agent) {
-				logger.SecurityEvent("SUSPICIOUS_USER_AGENT",
-					"User-Agent sospetto rilevato",
-					"", ip, userAgent,
+				logger.SecurityEventCtx(r.Context(), "SUSPICIOUS_USER_AGENT",
+					"User-Agent sospetto rilevato", "",
 					map[string]interface{}{
 						"detected_tool": agent,
 						"url":           url,
@@ -146,9 +192,8 @@ func SecurityMiddleware(next http.Handler) http.Handler {
 
 		// Rate limiting check (implementazione base)
 		if isRateLimitExceeded(ip) {
-			logger.SecurityEvent("RATE_LIMIT_EXCEEDED",
-				"Troppe richieste dal stesso IP",
-				"", ip, userAgent,
+			logger.SecurityEventCtx(r.Context(), "RATE_LIMIT_EXCEEDED",
+				"Troppe richieste dal stesso IP", "",
 				map[string]interface{}{
 					"url": url,
 				})
@@ -161,14 +206,10 @@ func SecurityMiddleware(next http.Handler) http.Handler {
 // AuthMiddleware logga eventi di autenticazione
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := getClientIP(r)
-		userAgent := r.UserAgent()
-
 		// Log tentativo di accesso a pagine protette
 		if isProtectedRoute(r.URL.Path) {
-			logger.AuditLog("ACCESS_ATTEMPT", "protected_route",
-				"Tentativo di accesso a risorsa protetta",
-				"", ip, userAgent,
+			logger.AuditLogCtx(r.Context(), "ACCESS_ATTEMPT", "protected_route",
+				"Tentativo di accesso a risorsa protetta", "",
 				map[string]interface{}{
 					"path":   r.URL.Path,
 					"method": r.Method,
@@ -195,10 +236,11 @@ func getClientIP(r *http.Request) string {
 	return r.RemoteAddr
 }
 
+// generateRequestID genera un ID casuale di 32 caratteri esadecimali
 func generateRequestID() string {
-	// Genera un ID univoco per la richiesta
-	return time.Now().Format("20060102150405") + "-" +
-		string(rune('A'+time.Now().Nanosecond()%26))
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
 
 func containsCaseInsensitive(s, substr string) bool {
@@ -214,9 +256,18 @@ func containsCaseInsensitiveHelper(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
 
-// Rate limiting semplice (in produzione usare Redis)
-var ipRequestCount = make(map[string]int)
-var ipLastReset = make(map[string]time.Time)
+// ipWindow conta le richieste di un IP nella finestra iniziata a start
+type ipWindow struct {
+	count int
+	start time.Time
+}
+
+// Rate limiting semplice (in produzione usare Redis). Le finestre sono condivise da tutte
+// le richieste concorrenti: vanno lette e aggiornate solo tramite memstore
+var (
+	ipWindows   = memstore.New[string, ipWindow]()
+	ipLastPrune atomic.Int64 // Ultima pulizia delle finestre scadute (UnixNano)
+)
 
 func isRateLimitExceeded(ip string) bool {
 	const maxRequests = 100 // max richieste per minuto
@@ -225,14 +276,24 @@ func isRateLimitExceeded(ip string) bool {
 	now := time.Now()
 
 	// Reset contatore se è passato troppo tempo
-	if lastReset, exists := ipLastReset[ip]; !exists || now.Sub(lastReset) > resetInterval {
-		ipRequestCount[ip] = 0
-		ipLastReset[ip] = now
-	}
+	window := ipWindows.Update(ip, func(w ipWindow, exists bool) ipWindow {
+		if !exists || now.Sub(w.start) > resetInterval {
+			w = ipWindow{start: now}
+		}
+		w.count++
+		return w
+	})
 
-	ipRequestCount[ip]++
+	// Le finestre scadute vengono eliminate al massimo una volta per intervallo,
+	// altrimenti la mappa crescerebbe con ogni IP mai visto
+	last := ipLastPrune.Load()
+	if now.UnixNano()-last > int64(resetInterval) && ipLastPrune.CompareAndSwap(last, now.UnixNano()) {
+		ipWindows.DeleteFunc(func(_ string, w ipWindow) bool {
+			return now.Sub(w.start) > resetInterval
+		})
+	}
 
-	return ipRequestCount[ip] > maxRequests
+	return window.count > maxRequests
 }
 
 func isProtectedRoute(path string) bool {
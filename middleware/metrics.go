@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"qr-menu/pkg/metrics"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	httpRequests = metrics.NewCounter("qrmenu_http_requests_total",
+		"HTTP requests by method, route template and status code.", "method", "route", "status")
+	httpDuration = metrics.NewHistogram("qrmenu_http_request_duration_seconds",
+		"HTTP request latency by method and route template.", nil, "method", "route")
+	httpInFlight = metrics.NewGauge("qrmenu_http_requests_in_flight",
+		"HTTP requests currently being served.")
+)
+
+// MetricsMiddleware misura richieste, latenza e richieste in corso per route. La route è
+// il template di gorilla/mux (es. /menu/{id}) e non il path, così le serie restano poche
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpInFlight.Inc()
+		defer httpInFlight.Dec()
+
+		wrapped := &responseWriter{
+			ResponseWriter: w,
+			statusCode:     200, // default
+		}
+		next.ServeHTTP(wrapped, r)
+
+		route := routeTemplate(r)
+		httpRequests.Inc(r.Method, route, strconv.Itoa(wrapped.statusCode))
+		httpDuration.ObserveDuration(start, r.Method, route)
+	})
+}
+
+// routeTemplate restituisce il template della route che ha gestito la richiesta
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+		if template, err := route.GetPathRegexp(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
@@ -103,6 +103,7 @@ func isPublicRoute(path string) bool {
 		"/r/",    // Active menu pubblici
 		"/api/track/", // Analytics pubblici
 		"/api/v1/health",
+		"/ready",
 	}
 
 	for _, prefix := range publicPrefixes {
@@ -196,31 +197,3 @@ func AuditLogMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
-
-// CSRFProtectionMiddleware verifica token CSRF per operazioni modificanti
-func CSRFProtectionMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Skip GET requests
-		if r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS" {
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		// Verifica CSRF token per POST/PUT/DELETE
-		token := r.Header.Get("X-CSRF-Token")
-		if token == "" {
-			token = r.FormValue("csrf_token")
-		}
-
-		if token == "" {
-			log.Printf("🚨 SECURITY: Richiesta senza CSRF token da %s", r.RemoteAddr)
-			http.Error(w, "CSRF token mancante", http.StatusForbidden)
-			return
-		}
-
-		// TODO: Implementare validazione CSRF token reale
-		// Per ora accetta qualsiasi token non vuoto
-
-		next.ServeHTTP(w, r)
-	})
-}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"qr-menu/db"
+	"qr-menu/pkg/config"
+)
+
+// newMigrateCommand crea "qr-menu migrate [up|down <versione>|status|new <nome>]" per il
+// database SQL configurato in database.*: up (anche senza sottocomando) applica le migrazioni
+// in attesa, down annulla l'ultima applicata (che va indicata, per evitare rollback
+// involontari), status elenca applicate e in attesa, new crea i file di una nuova migrazione
+// senza connettersi al database
+func newMigrateCommand(configPath string) *cobra.Command {
+	up := func(*cobra.Command, []string) error { return runMigrate(configPath, "up", nil) }
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "applica o annulla le migrazioni del database SQL",
+		Args:  cobra.NoArgs,
+		RunE:  up,
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "up",
+			Short: "applica le migrazioni in attesa",
+			Args:  cobra.NoArgs,
+			RunE:  up,
+		},
+		&cobra.Command{
+			Use:   "down <versione>",
+			Short: "annulla l'ultima migrazione applicata",
+			Args:  cobra.ExactArgs(1),
+			RunE:  func(_ *cobra.Command, args []string) error { return runMigrate(configPath, "down", args) },
+		},
+		&cobra.Command{
+			Use:   "status",
+			Short: "elenca le migrazioni applicate e in attesa",
+			Args:  cobra.NoArgs,
+			RunE:  func(*cobra.Command, []string) error { return runMigrate(configPath, "status", nil) },
+		},
+		&cobra.Command{
+			Use:   "new <nome>",
+			Short: "crea i file di una nuova migrazione",
+			Args:  cobra.MinimumNArgs(1),
+			RunE:  func(_ *cobra.Command, args []string) error { return runMigrate(configPath, "new", args) },
+		},
+	)
+	return cmd
+}
+
+// runMigrate esegue il sottocomando command di "qr-menu migrate" con i suoi argomenti
+func runMigrate(configPath, command string, args []string) error {
+	// I log dei package db finirebbero mescolati all'output
+	log.SetOutput(io.Discard)
+
+	settings, err := config.LoadFile(configPath)
+	if err != nil {
+		return cliFail(fmt.Errorf("errore nella configurazione: %w", err))
+	}
+
+	if command == "new" {
+		mm := db.GetMigrationManager()
+		if err := mm.Init(db.MigrationConfig{MigrationsPath: settings.Database.MigrationPath}); err != nil {
+			return cliFail(err)
+		}
+		up, down, err := mm.NewMigration(strings.Join(args, " "), time.Now())
+		if err != nil {
+			return cliFail(err)
+		}
+		fmt.Printf("✓ %s\n✓ %s\n", up, down)
+		return nil
+	}
+
+	dbm := db.GetDatabaseManager()
+	err = dbm.Init(db.DatabaseConfig{
+		Type:        settings.Database.Engine,
+		DSN:         settings.Database.DSN,
+		MaxOpen:     settings.Database.MaxOpenConns,
+		MaxIdle:     settings.Database.MaxIdleConns,
+		MaxLifetime: settings.Database.ConnMaxLifetime,
+	})
+	if err != nil {
+		return cliFail(err)
+	}
+	defer dbm.Close()
+
+	mm := db.GetMigrationManager()
+	err = mm.Init(db.MigrationConfig{
+		MigrationsPath: settings.Database.MigrationPath,
+		DatabaseType:   settings.Database.Engine,
+		DB:             dbm.GetConnection(),
+	})
+	if err != nil {
+		return cliFail(err)
+	}
+
+	switch command {
+	case "up":
+		applied, err := mm.ApplyPending(context.Background())
+		for _, m := range applied {
+			fmt.Printf("✓ %s\n", m.Name)
+		}
+		if err != nil {
+			return cliFail(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Nessuna migrazione in attesa")
+		}
+	case "down":
+		if err := mm.RollbackMigration(args[0]); err != nil {
+			return cliFail(err)
+		}
+		fmt.Printf("✓ Migrazione %s annullata\n", args[0])
+	case "status":
+		for _, m := range mm.GetAppliedMigrations() {
+			state := "applicata "
+			if m.Status == "modified" {
+				state = "MODIFICATA"
+			}
+			fmt.Printf("%s  %s  (%s)\n", state, m.Name, m.AppliedAt.Format("2006-01-02 15:04"))
+		}
+		for _, m := range mm.GetPendingMigrations() {
+			fmt.Printf("in attesa  %s\n", m.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// EmailVerification rappresenta una richiesta di cambio email in attesa di conferma.
+// Il token inviato via email non viene salvato: l'ID è il suo hash SHA-256
+type EmailVerification struct {
+	ID        string    `json:"id" bson:"_id"`
+	UserID    string    `json:"user_id" bson:"user_id"`
+	NewEmail  string    `json:"new_email" bson:"new_email"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// PasswordReset rappresenta una richiesta di reimpostazione password. Come per
+// EmailVerification l'ID è l'hash SHA-256 del token inviato via email
+type PasswordReset struct {
+	ID        string    `json:"id" bson:"_id"`
+	UserID    string    `json:"user_id" bson:"user_id"`
+	Email     string    `json:"email,omitempty" bson:"email,omitempty"` // Indirizzo a cui è stato inviato il link
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// Stati di una cancellazione account
+const (
+	AccountDeletionScheduled = "scheduled"
+	AccountDeletionCompleted = "completed"
+)
+
+// AccountDeletion rappresenta la cancellazione definitiva (GDPR, diritto all'oblio)
+// programmata per un account. L'ID coincide con quello dell'utente
+type AccountDeletion struct {
+	ID            string    `json:"id" bson:"_id"`
+	Email         string    `json:"email" bson:"email"` // Per la conferma finale, quando l'utente non esiste più
+	Locale        string    `json:"locale,omitempty" bson:"locale,omitempty"`
+	RestaurantIDs []string  `json:"restaurant_ids" bson:"restaurant_ids"`
+	Reason        string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	Status        string    `json:"status" bson:"status"`
+	RequestedAt   time.Time `json:"requested_at" bson:"requested_at"`
+	ScheduledAt   time.Time `json:"scheduled_at" bson:"scheduled_at"`
+	CompletedAt   time.Time `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// APIKeyPrefix precede ogni API key, così le chiavi si distinguono dai token di sessione
+// e si riconoscono se finiscono per errore in un repository o in un log
+const APIKeyPrefix = "qrm_"
+
+// Limiti di richieste al minuto di una API key
+const (
+	DefaultAPIKeyRateLimit = 60
+	MaxAPIKeyRateLimit     = 1200
+)
+
+// APIKeyScopes elenca i permessi che possono essere concessi a una API key. La gestione del
+// ristorante e dello staff resta riservata alle sessioni
+var APIKeyScopes = []string{PermMenusRead, PermMenusWrite, PermAnalyticsRead, PermBillingRead, PermWebhooksManage, PermInventoryManage, PermOrdersManage, PermFeedbackModerate}
+
+// APIKey è una chiave di lunga durata per le integrazioni (POS, gestionali) di un ristorante.
+// Il segreto è mostrato una sola volta alla creazione; nel database resta solo il suo hash
+type APIKey struct {
+	ID           string     `json:"id" bson:"_id"`
+	RestaurantID string     `json:"restaurant_id" bson:"restaurant_id"`
+	Name         string     `json:"name" bson:"name"`
+	Prefix       string     `json:"prefix" bson:"prefix"` // Primi caratteri della chiave, per riconoscerla nell'elenco
+	Hash         string     `json:"-" bson:"hash"`
+	Scopes       []string   `json:"scopes" bson:"scopes"`
+	RateLimit    int        `json:"rate_limit" bson:"rate_limit"` // Richieste al minuto
+	CreatedBy    string     `json:"created_by" bson:"created_by"`
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+}
+
+// HasScope indica se la chiave concede il permesso
+func (k *APIKey) HasScope(perm string) bool {
+	for _, scope := range k.Scopes {
+		if scope == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAPIKeyScope indica se il permesso può essere concesso a una API key
+func IsAPIKeyScope(perm string) bool {
+	for _, scope := range APIKeyScopes {
+		if scope == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// MenuArchiveStats è l'istantanea delle statistiche di un menu al momento dell'archiviazione,
+// consultabile per pianificare la stagione successiva
+type MenuArchiveStats struct {
+	PeriodStart     time.Time          `json:"period_start" bson:"period_start"`
+	PeriodEnd       time.Time          `json:"period_end" bson:"period_end"`
+	MenuViews       int                `json:"menu_views" bson:"menu_views"`             // Visualizzazioni del menu
+	RestaurantViews int                `json:"restaurant_views" bson:"restaurant_views"` // Visualizzazioni del ristorante nel periodo
+	QRScans         int                `json:"qr_scans" bson:"qr_scans"`                 // Scansioni QR nel periodo
+	DailyViews      map[string]int     `json:"daily_views,omitempty" bson:"daily_views,omitempty"`
+	TopItems        []ArchivedItemStat `json:"top_items,omitempty" bson:"top_items,omitempty"`
+}
+
+// ArchivedItemStat rappresenta un piatto tra i più visti del periodo archiviato
+type ArchivedItemStat struct {
+	ItemID string  `json:"item_id" bson:"item_id"`
+	Name   string  `json:"name" bson:"name"`
+	Views  int     `json:"views" bson:"views"`
+	Price  float64 `json:"price" bson:"price"`
+}
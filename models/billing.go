@@ -14,18 +14,72 @@ type BillingPlan struct {
 	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
 }
 
+// Subscription statuses
+const (
+	SubscriptionActive   = "active"
+	SubscriptionTrialing = "trialing"
+	SubscriptionPastDue  = "past_due"
+	SubscriptionCanceled = "canceled"
+)
+
+// FreePlanID is the plan restaurants fall back to when a trial lapses.
+const FreePlanID = "free"
+
 // BillingSubscription represents a restaurant subscription.
 type BillingSubscription struct {
-	ID                     string    `json:"id" bson:"id"`
-	RestaurantID           string    `json:"restaurant_id" bson:"restaurant_id"`
-	PlanID                 string    `json:"plan_id" bson:"plan_id"`
-	Status                 string    `json:"status" bson:"status"`     // active, canceled, past_due
-	Provider               string    `json:"provider" bson:"provider"` // stripe, mock
-	ProviderSubscriptionID string    `json:"provider_subscription_id,omitempty" bson:"provider_subscription_id,omitempty"`
-	ProviderCustomerID     string    `json:"provider_customer_id,omitempty" bson:"provider_customer_id,omitempty"`
-	CurrentPeriodEnd       time.Time `json:"current_period_end" bson:"current_period_end"`
-	CreatedAt              time.Time `json:"created_at" bson:"created_at"`
-	UpdatedAt              time.Time `json:"updated_at" bson:"updated_at"`
+	ID                     string     `json:"id" bson:"id"`
+	RestaurantID           string     `json:"restaurant_id" bson:"restaurant_id"`
+	PlanID                 string     `json:"plan_id" bson:"plan_id"`
+	Status                 string     `json:"status" bson:"status"`     // active, trialing, canceled, past_due
+	Provider               string     `json:"provider" bson:"provider"` // stripe, mock, trial
+	ProviderSubscriptionID string     `json:"provider_subscription_id,omitempty" bson:"provider_subscription_id,omitempty"`
+	ProviderCustomerID     string     `json:"provider_customer_id,omitempty" bson:"provider_customer_id,omitempty"`
+	CurrentPeriodEnd       time.Time  `json:"current_period_end" bson:"current_period_end"`
+	TrialEndsAt            *time.Time `json:"trial_ends_at,omitempty" bson:"trial_ends_at,omitempty"`
+	TrialReminderSentAt    *time.Time `json:"-" bson:"trial_reminder_sent_at,omitempty"`
+	CouponCode             string     `json:"coupon_code,omitempty" bson:"coupon_code,omitempty"`
+	CreatedAt              time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt              time.Time  `json:"updated_at" bson:"updated_at"`
+}
+
+// Coupon is a promo code managed by the platform operators. It can discount the
+// subscription price, extend the free trial, or both.
+type Coupon struct {
+	ID             string     `json:"id" bson:"_id"`
+	Code           string     `json:"code" bson:"code"` // Upper case, unique
+	Description    string     `json:"description,omitempty" bson:"description,omitempty"`
+	PercentOff     int        `json:"percent_off,omitempty" bson:"percent_off,omitempty"`
+	AmountOffCents int64      `json:"amount_off_cents,omitempty" bson:"amount_off_cents,omitempty"`
+	Currency       string     `json:"currency,omitempty" bson:"currency,omitempty"`
+	TrialDays      int        `json:"trial_days,omitempty" bson:"trial_days,omitempty"` // Added to the free trial
+	PlanIDs        []string   `json:"plan_ids,omitempty" bson:"plan_ids,omitempty"`     // Empty: every plan
+	MaxRedemptions int        `json:"max_redemptions,omitempty" bson:"max_redemptions"` // 0: unlimited
+	Redemptions    int        `json:"redemptions" bson:"redemptions"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	IsActive       bool       `json:"is_active" bson:"is_active"`
+	CreatedAt      time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" bson:"updated_at"`
+}
+
+// AppliesTo reports whether the coupon can be used with the plan.
+func (c *Coupon) AppliesTo(planID string) bool {
+	if len(c.PlanIDs) == 0 {
+		return true
+	}
+	for _, id := range c.PlanIDs {
+		if id == planID {
+			return true
+		}
+	}
+	return false
+}
+
+// Redeemable reports whether the coupon is active, not expired and not used up at the given time.
+func (c *Coupon) Redeemable(now time.Time) bool {
+	if !c.IsActive || (c.ExpiresAt != nil && !now.Before(*c.ExpiresAt)) {
+		return false
+	}
+	return c.MaxRedemptions == 0 || c.Redemptions < c.MaxRedemptions
 }
 
 // BillingPortalSession represents a customer portal session.
@@ -41,3 +95,33 @@ type BillingCheckoutSession struct {
 	Provider  string    `json:"provider"`
 	ExpiresAt time.Time `json:"expires_at"`
 }
+
+// Usage metrics metered per restaurant and billing period
+const (
+	UsageMenuViews = "menu_views"
+	UsageQRScans   = "qr_scans"
+	UsageAPICalls  = "api_calls"
+)
+
+// UsagePeriod returns the billing period of an instant: the calendar month in UTC, e.g. "2026-10".
+func UsagePeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// BillingUsage is the metered usage of a restaurant in a billing period.
+type BillingUsage struct {
+	ID              string     `json:"-" bson:"_id"` // restaurant_id:period
+	RestaurantID    string     `json:"restaurant_id" bson:"restaurant_id"`
+	Period          string     `json:"period" bson:"period"`
+	MenuViews       int64      `json:"menu_views" bson:"menu_views"`
+	QRScans         int64      `json:"qr_scans" bson:"qr_scans"`
+	APICalls        int64      `json:"api_calls" bson:"api_calls"`
+	ReportedOverage int64      `json:"reported_overage" bson:"reported_overage"` // QR scans beyond the allowance already sent to the billing provider
+	ReportedAt      *time.Time `json:"reported_at,omitempty" bson:"reported_at,omitempty"`
+	UpdatedAt       time.Time  `json:"updated_at" bson:"updated_at"`
+}
+
+// UsageID returns the ID of the usage record of a restaurant in a period.
+func UsageID(restaurantID, period string) string {
+	return restaurantID + ":" + period
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// ChatWebhook è un incoming webhook di Slack o Discord a cui il ristorante invia le notifiche
+// degli eventi scelti (nuovi ordini, scorte, backup non riusciti). L'URL è la credenziale del
+// webhook: non viene mai restituito dalle API, che ne mostrano solo URLHint
+type ChatWebhook struct {
+	ID           string    `json:"id" bson:"id"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	Platform     string    `json:"platform" bson:"platform"` // slack o discord
+	Name         string    `json:"name" bson:"name"`         // Ad esempio il nome del canale
+	URL          string    `json:"-" bson:"url"`
+	URLHint      string    `json:"url_hint" bson:"-"`
+	Events       []string  `json:"events" bson:"events"`
+	Locale       string    `json:"locale" bson:"locale"`
+	IsActive     bool      `json:"is_active" bson:"is_active"`
+	LastError    string    `json:"last_error,omitempty" bson:"last_error,omitempty"` // Ultimo invio non riuscito, vuoto dopo un invio riuscito
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// Stati di un feedback nella coda di moderazione
+const (
+	FeedbackPending  = "pending"  // Con commento, in attesa di moderazione
+	FeedbackApproved = "approved" // Conta nelle valutazioni del ristorante e dei piatti
+	FeedbackRejected = "rejected" // Spam o abuso: escluso dalle valutazioni
+)
+
+const (
+	// MaxFeedbackComment è la lunghezza massima del commento, in caratteri
+	MaxFeedbackComment = 1000
+	// MaxFeedbackItems è il numero massimo di piatti valutati in un feedback
+	MaxFeedbackItems = 20
+	// MinPublicRatings è il numero minimo di valutazioni approvate perché la media compaia
+	// sul menu pubblico: una media di uno o due voti dice poco
+	MinPublicRatings = 3
+)
+
+// ItemFeedback è la valutazione di un singolo piatto. Il nome è copiato dal menu al momento
+// del feedback
+type ItemFeedback struct {
+	ItemID string `json:"item_id" bson:"item_id"`
+	Name   string `json:"name" bson:"name"`
+	Rating int    `json:"rating" bson:"rating"`
+}
+
+// Feedback è la valutazione lasciata da un cliente dopo la visita
+type Feedback struct {
+	ID           string         `json:"id" bson:"_id"`
+	RestaurantID string         `json:"restaurant_id" bson:"restaurant_id"`
+	MenuID       string         `json:"menu_id" bson:"menu_id"`
+	OrderID      string         `json:"order_id,omitempty" bson:"order_id,omitempty"` // Ordine a cui si riferisce, se indicato
+	Rating       int            `json:"rating" bson:"rating"`                         // Da 1 a 5 stelle
+	Comment      string         `json:"comment,omitempty" bson:"comment,omitempty"`
+	Items        []ItemFeedback `json:"items,omitempty" bson:"items,omitempty"`
+	Status       string         `json:"status" bson:"status"`
+	CreatedAt    time.Time      `json:"created_at" bson:"created_at"`
+	ModeratedAt  *time.Time     `json:"moderated_at,omitempty" bson:"moderated_at,omitempty"`
+	ModeratedBy  string         `json:"moderated_by,omitempty" bson:"moderated_by,omitempty"`
+
+	// VisitorHash è un hash giornaliero di IP e User-Agent del cliente, usato solo per
+	// limitare i feedback ripetuti
+	VisitorHash string `json:"-" bson:"visitor_hash"`
+}
+
+// ValidRating indica se il voto è tra 1 e 5 stelle
+func ValidRating(rating int) bool {
+	return rating >= 1 && rating <= 5
+}
+
+// RatingSummary è la media delle valutazioni approvate
+type RatingSummary struct {
+	Average float64 `json:"average" bson:"average"`
+	Count   int     `json:"count" bson:"count"`
+}
+
+// ItemRating è la media delle valutazioni approvate di un piatto
+type ItemRating struct {
+	Name          string `json:"name" bson:"name"`
+	RatingSummary `bson:",inline"`
+}
+
+// RatingStats riassume le valutazioni approvate di un ristorante
+type RatingStats struct {
+	RatingSummary `bson:",inline"`
+	Distribution  [5]int                `json:"distribution" bson:"distribution"`       // Feedback per numero di stelle, da 1 a 5
+	Items         map[string]ItemRating `json:"items,omitempty" bson:"items,omitempty"` // Per ID del piatto
+	UpdatedAt     time.Time             `json:"updated_at" bson:"updated_at"`
+}
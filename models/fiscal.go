@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// DefaultVATRate è l'aliquota IVA della somministrazione di alimenti e bevande, usata se il
+// ristorante non ne indica un'altra
+const DefaultVATRate = 10.0
+
+// FiscalInfo sono i dati fiscali del ristorante stampati sulle ricevute e riportati
+// nell'esportazione mensile per il commercialista. I prezzi del menu sono IVA inclusa
+type FiscalInfo struct {
+	LegalName     string    `json:"legal_name" bson:"legal_name"`                             // Ragione sociale
+	VATNumber     string    `json:"vat_number" bson:"vat_number"`                             // Partita IVA
+	TaxCode       string    `json:"tax_code,omitempty" bson:"tax_code,omitempty"`             // Codice fiscale, se diverso dalla partita IVA
+	Address       string    `json:"address" bson:"address"`                                   // Sede legale
+	VATRate       float64   `json:"vat_rate" bson:"vat_rate"`                                 // Aliquota in percentuale
+	ReceiptFooter string    `json:"receipt_footer,omitempty" bson:"receipt_footer,omitempty"` // Testo in fondo alle ricevute
+	UpdatedAt     time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Rate restituisce l'aliquota IVA, quella predefinita se i dati fiscali mancano
+func (f *FiscalInfo) Rate() float64 {
+	if f == nil || f.VATRate <= 0 {
+		return DefaultVATRate
+	}
+	return f.VATRate
+}
@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// Modi in cui il cliente riceve un ordine
+const (
+	FulfillmentDineIn   = "dine_in"  // Al tavolo, anche prenotato in anticipo
+	FulfillmentTakeaway = "takeaway" // Ritiro al ristorante
+	FulfillmentDelivery = "delivery" // Consegna all'indirizzo del cliente
+)
+
+// Limiti della configurazione del ritiro e della consegna
+const (
+	MaxFulfillmentWindows = 28 // Fasce orarie di apertura, quattro al giorno
+	MaxDaysAhead          = 30 // Giorni per cui si può ordinare in anticipo
+)
+
+// FulfillmentWindow è una fascia oraria di un giorno della settimana in cui il ristorante
+// consegna o fa ritirare gli ordini
+type FulfillmentWindow struct {
+	Weekday int    `json:"weekday" bson:"weekday"` // 0 = domenica, come time.Weekday
+	Open    string `json:"open" bson:"open"`       // HH:MM
+	Close   string `json:"close" bson:"close"`     // HH:MM, 24:00 per mezzanotte
+}
+
+// FulfillmentSettings configura come il ristorante riceve gli ordini fatti in anticipo dai
+// clienti: al tavolo, da asporto o con consegna entro un raggio. Gli ordini si prenotano su
+// fasce di SlotMinutes minuti, ciascuna con al massimo SlotCapacity ordini
+type FulfillmentSettings struct {
+	DineIn           bool                `json:"dine_in" bson:"dine_in"`
+	Takeaway         bool                `json:"takeaway" bson:"takeaway"`
+	Delivery         bool                `json:"delivery" bson:"delivery"`
+	Latitude         float64             `json:"latitude,omitempty" bson:"latitude,omitempty"` // Posizione del ristorante, centro del raggio di consegna
+	Longitude        float64             `json:"longitude,omitempty" bson:"longitude,omitempty"`
+	DeliveryRadiusKm float64             `json:"delivery_radius_km,omitempty" bson:"delivery_radius_km,omitempty"`
+	SlotMinutes      int                 `json:"slot_minutes" bson:"slot_minutes"`
+	SlotCapacity     int                 `json:"slot_capacity" bson:"slot_capacity"` // Ordini per fascia
+	LeadMinutes      int                 `json:"lead_minutes" bson:"lead_minutes"`   // Preavviso minimo
+	DaysAhead        int                 `json:"days_ahead" bson:"days_ahead"`       // 0 = solo in giornata
+	CountryCode      string              `json:"country_code" bson:"country_code"`   // Prefisso dei numeri dei clienti senza prefisso, es. 39
+	Windows          []FulfillmentWindow `json:"windows" bson:"windows"`
+	UpdatedAt        time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// Offers indica se il ristorante accetta ordini in anticipo nel modo indicato
+func (s *FulfillmentSettings) Offers(mode string) bool {
+	if s == nil {
+		return false
+	}
+	switch mode {
+	case FulfillmentDineIn:
+		return s.DineIn
+	case FulfillmentTakeaway:
+		return s.Takeaway
+	case FulfillmentDelivery:
+		return s.Delivery
+	}
+	return false
+}
+
+// OrderFulfillment indica come e quando il cliente riceve un ordine fatto in anticipo e come
+// avvisarlo dei cambi di stato
+type OrderFulfillment struct {
+	Mode          string    `json:"mode" bson:"mode"`
+	SlotStart     time.Time `json:"slot_start" bson:"slot_start"`
+	SlotEnd       time.Time `json:"slot_end" bson:"slot_end"`
+	CustomerName  string    `json:"customer_name" bson:"customer_name"`
+	CustomerPhone string    `json:"customer_phone,omitempty" bson:"customer_phone,omitempty"` // Normalizzato con prefisso internazionale, senza +
+	CustomerEmail string    `json:"customer_email,omitempty" bson:"customer_email,omitempty"`
+	Locale        string    `json:"locale,omitempty" bson:"locale,omitempty"`   // Lingua degli avvisi al cliente
+	Address       string    `json:"address,omitempty" bson:"address,omitempty"` // Indirizzo di consegna
+	Latitude      float64   `json:"latitude,omitempty" bson:"latitude,omitempty"`
+	Longitude     float64   `json:"longitude,omitempty" bson:"longitude,omitempty"`
+	TrackingToken string    `json:"-" bson:"tracking_token"`                                    // Credenziale della pagina di stato del cliente
+	Notified      string    `json:"notified,omitempty" bson:"notified,omitempty"`               // Ultimo stato avvisato al cliente via email o SMS
+	WhatsAppOptIn bool      `json:"whatsapp_opt_in,omitempty" bson:"whatsapp_opt_in,omitempty"` // Conferma dell'ordine chiesta su WhatsApp
+}
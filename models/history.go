@@ -0,0 +1,99 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Ambiti e operazioni di una MenuChange
+const (
+	MenuChangeScopeMenu     = "menu"
+	MenuChangeScopeCategory = "category"
+	MenuChangeScopeItem     = "item"
+
+	MenuChangeAdded   = "added"
+	MenuChangeRemoved = "removed"
+	MenuChangeUpdated = "updated"
+)
+
+// MenuRevision è una modifica riuscita a un menu, con chi l'ha fatta e le differenze
+// rispetto alla versione precedente. RevertOf è valorizzato se annulla un'altra revisione
+type MenuRevision struct {
+	ID           string       `json:"id" bson:"_id"`
+	MenuID       string       `json:"menu_id" bson:"menu_id"`
+	RestaurantID string       `json:"restaurant_id" bson:"restaurant_id"`
+	UserID       string       `json:"user_id" bson:"user_id"`
+	Username     string       `json:"username,omitempty" bson:"username,omitempty"`
+	APIKeyID     string       `json:"api_key_id,omitempty" bson:"api_key_id,omitempty"`
+	Method       string       `json:"method" bson:"method"`
+	Path         string       `json:"path" bson:"path"`
+	Changes      []MenuChange `json:"changes" bson:"changes"`
+	RevertOf     string       `json:"revert_of,omitempty" bson:"revert_of,omitempty"`
+	CreatedAt    time.Time    `json:"created_at" bson:"created_at"`
+}
+
+// MenuChange è una singola differenza: un campo modificato del menu, di una categoria o di
+// un piatto, oppure una categoria o un piatto aggiunti o rimossi. Before e After sono i
+// valori JSON (il campo, o l'intera categoria/piatto per added e removed)
+type MenuChange struct {
+	Scope      string          `json:"scope" bson:"scope"`
+	Op         string          `json:"op" bson:"op"`
+	CategoryID string          `json:"category_id,omitempty" bson:"category_id,omitempty"`
+	ItemID     string          `json:"item_id,omitempty" bson:"item_id,omitempty"`
+	Name       string          `json:"name,omitempty" bson:"name,omitempty"` // Nome di menu, categoria o piatto
+	Field      string          `json:"field,omitempty" bson:"field,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty" bson:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty" bson:"after,omitempty"`
+}
+
+var menuChangeFieldLabels = map[string]string{
+	"name":          "nome",
+	"description":   "descrizione",
+	"meal_type":     "tipo di pasto",
+	"price":         "prezzo",
+	"available":     "disponibilità",
+	"category":      "categoria",
+	"image_url":     "foto",
+	"display_order": "ordine",
+	"tags":          "etichette",
+	"translations":  "traduzioni",
+}
+
+// ScopeLabel restituisce cosa è stato modificato (menu, categoria o piatto) come mostrato nell'admin
+func (c MenuChange) ScopeLabel() string {
+	switch c.Scope {
+	case MenuChangeScopeCategory:
+		return "Categoria"
+	case MenuChangeScopeItem:
+		return "Piatto"
+	}
+	return "Menu"
+}
+
+// FieldLabel restituisce il nome del campo modificato mostrato nell'admin
+func (c MenuChange) FieldLabel() string {
+	if label, ok := menuChangeFieldLabels[c.Field]; ok {
+		return label
+	}
+	return c.Field
+}
+
+// BeforeText e AfterText restituiscono i valori del campo come testo, senza virgolette
+// per le stringhe
+func (c MenuChange) BeforeText() string { return changeValueText(c.Before) }
+
+func (c MenuChange) AfterText() string { return changeValueText(c.After) }
+
+func changeValueText(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "—"
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		if s == "" {
+			return "—"
+		}
+		return s
+	}
+	return string(raw)
+}
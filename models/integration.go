@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Esiti della sincronizzazione di un'integrazione
+const (
+	IntegrationSyncSuccess = "success"
+	IntegrationSyncFailed  = "failed"
+)
+
+// MenuIntegration collega il ristorante a una piattaforma di delivery (Deliverect, Uber Eats,
+// Glovo) a cui viene esportato il menu. Le credenziali sono cifrate e non vengono mai
+// restituite; con AutoSync il menu viene reinviato periodicamente
+type MenuIntegration struct {
+	ID           string     `json:"id" bson:"id"`
+	RestaurantID string     `json:"restaurant_id" bson:"restaurant_id"`
+	Platform     string     `json:"platform" bson:"platform"`
+	MenuID       string     `json:"menu_id,omitempty" bson:"menu_id,omitempty"` // Vuoto: il menu attivo
+	Credentials  string     `json:"-" bson:"credentials"`
+	AutoSync     bool       `json:"auto_sync" bson:"auto_sync"`
+	NextSyncAt   *time.Time `json:"next_sync_at,omitempty" bson:"next_sync_at,omitempty"` // Solo con AutoSync
+	LastSyncAt   *time.Time `json:"last_sync_at,omitempty" bson:"last_sync_at,omitempty"`
+	LastStatus   string     `json:"last_status,omitempty" bson:"last_status,omitempty"`
+	LastError    string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	LastItems    int        `json:"last_items" bson:"last_items"` // Piatti esportati dall'ultima sincronizzazione riuscita
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" bson:"updated_at"`
+}
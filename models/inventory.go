@@ -0,0 +1,115 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Motivi di una variazione di giacenza
+const (
+	StockReasonOrder      = "order"      // Scaricata da un ordine
+	StockReasonRestock    = "restock"    // Rifornimento
+	StockReasonWaste      = "waste"      // Scarto o porzioni perse
+	StockReasonCount      = "count"      // Inventario fisico: la quantità viene impostata
+	StockReasonCorrection = "correction" // Correzione manuale
+)
+
+// StockReasons elenca i motivi accettati dall'API di rettifica, nell'ordine mostrato nell'admin
+var StockReasons = []string{StockReasonRestock, StockReasonWaste, StockReasonCount, StockReasonCorrection}
+
+// ErrInsufficientStock indica che la giacenza del piatto non basta a coprire lo scarico
+var ErrInsufficientStock = errors.New("giacenza insufficiente")
+
+// ItemInventory è la giacenza di un piatto di cui il ristorante tiene il magazzino. Quando la
+// quantità arriva a zero il piatto diventa non disponibile e torna disponibile al rifornimento
+type ItemInventory struct {
+	Quantity          int       `json:"quantity" bson:"quantity"`
+	LowStockThreshold int       `json:"low_stock_threshold" bson:"low_stock_threshold"` // 0 = nessun avviso di scorta bassa
+	UpdatedAt         time.Time `json:"updated_at" bson:"updated_at"`
+
+	// LowStockAlerted evita di ripetere l'avviso a ogni scarico: si riarma quando la
+	// quantità torna sopra la soglia
+	LowStockAlerted bool `json:"-" bson:"low_stock_alerted"`
+	// SoldOut indica che il piatto è stato reso non disponibile dall'esaurimento, e non a
+	// mano dal ristorante: solo in questo caso il rifornimento lo rende di nuovo disponibile
+	SoldOut bool `json:"sold_out" bson:"sold_out"`
+}
+
+// IsLow indica se la quantità è alla soglia di scorta bassa o sotto
+func (inv *ItemInventory) IsLow() bool {
+	return inv.LowStockThreshold > 0 && inv.Quantity <= inv.LowStockThreshold
+}
+
+// StockChange è l'esito di una variazione di giacenza di un piatto
+type StockChange struct {
+	Before    int
+	After     int
+	LowStock  bool // La quantità è scesa alla soglia di scorta bassa: va avvisato il ristorante
+	SoldOut   bool // Il piatto è esaurito ed è diventato non disponibile
+	Restocked bool // Il piatto esaurito è tornato disponibile
+}
+
+// AvailabilityChanged indica se la variazione ha cambiato la disponibilità del piatto
+func (c StockChange) AvailabilityChanged() bool {
+	return c.SoldOut || c.Restocked
+}
+
+// AdjustStock varia di delta la giacenza del piatto e ne aggiorna la disponibilità. Restituisce
+// ErrInsufficientStock, senza modificare il piatto, se la quantità diventerebbe negativa
+func (item *MenuItem) AdjustStock(delta int, now time.Time) (StockChange, error) {
+	if item.Inventory == nil {
+		return StockChange{}, errors.New("il piatto non ha una giacenza")
+	}
+	if item.Inventory.Quantity+delta < 0 {
+		return StockChange{}, ErrInsufficientStock
+	}
+	return item.SetStock(item.Inventory.Quantity+delta, now), nil
+}
+
+// SetStock imposta la giacenza del piatto (es. dopo un inventario fisico) e ne aggiorna la
+// disponibilità: a zero il piatto diventa non disponibile, al rifornimento torna disponibile
+// se era stato esaurito
+func (item *MenuItem) SetStock(quantity int, now time.Time) StockChange {
+	inv := item.Inventory
+	change := StockChange{Before: inv.Quantity, After: quantity}
+	inv.Quantity = quantity
+	inv.UpdatedAt = now
+
+	switch {
+	case quantity == 0 && item.Available:
+		item.Available = false
+		inv.SoldOut = true
+		change.SoldOut = true
+	case quantity > 0 && inv.SoldOut:
+		item.Available = true
+		inv.SoldOut = false
+		change.Restocked = true
+	}
+
+	// L'esaurimento ha un suo avviso e vale anche come avviso di scorta bassa
+	if inv.IsLow() || quantity == 0 {
+		if !inv.LowStockAlerted {
+			inv.LowStockAlerted = true
+			change.LowStock = !change.SoldOut
+		}
+	} else {
+		inv.LowStockAlerted = false
+	}
+	return change
+}
+
+// StockAdjustment registra una variazione di giacenza di un piatto: lo storico dei movimenti
+// da cui si ricavano consumi medi e giorni di copertura
+type StockAdjustment struct {
+	ID           string    `json:"id" bson:"_id"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	MenuID       string    `json:"menu_id" bson:"menu_id"`
+	ItemID       string    `json:"item_id" bson:"item_id"`
+	Reason       string    `json:"reason" bson:"reason"`
+	Delta        int       `json:"delta" bson:"delta"`
+	Quantity     int       `json:"quantity" bson:"quantity"` // Giacenza dopo la variazione
+	OrderID      string    `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	Note         string    `json:"note,omitempty" bson:"note,omitempty"`
+	ActorID      string    `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// JWTSigningKey è una chiave di firma dei token dell'API. Il segreto è cifrato con la
+// security.jwt_secret della configurazione; RetiredAt è valorizzato quando la chiave viene
+// sostituita da una rotazione
+type JWTSigningKey struct {
+	ID        string     `json:"id" bson:"_id"` // kid nell'header dei token
+	Secret    string     `json:"-" bson:"secret"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty" bson:"retired_at,omitempty"`
+}
+
+// RevokedToken è un token dell'API revocato prima della scadenza (logout o refresh). Il
+// documento è eliminato dall'indice TTL quando il token scade comunque
+type RevokedToken struct {
+	ID        string    `json:"id" bson:"_id"` // Hash SHA-256 del token
+	RevokedAt time.Time `json:"revoked_at" bson:"revoked_at"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// RefreshToken è un refresh token dell'API. Ogni refresh lo sostituisce con uno nuovo della
+// stessa famiglia (FamilyID, la sessione avviata dal login): se un token già usato viene
+// presentato di nuovo è stato copiato, e l'intera famiglia viene revocata
+type RefreshToken struct {
+	ID           string     `json:"id" bson:"_id"`
+	Hash         string     `json:"-" bson:"hash"`
+	FamilyID     string     `json:"family_id" bson:"family_id"`
+	UserID       string     `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	RestaurantID string     `json:"restaurant_id" bson:"restaurant_id"`
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at" bson:"expires_at"`
+	UsedAt       *time.Time `json:"used_at,omitempty" bson:"used_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
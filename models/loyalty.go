@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+// Tipi di movimento dei punti fedeltà
+const (
+	LoyaltyEarn   = "earn"   // Punti raccolti con il codice di una visita
+	LoyaltyRedeem = "redeem" // Punti spesi per un premio, alla cassa
+)
+
+const (
+	// MaxLoyaltyRewards è il numero massimo di premi di un programma fedeltà
+	MaxLoyaltyRewards = 20
+	// MaxLoyaltyVisitPoints è il numero massimo di punti assegnabili a una visita
+	MaxLoyaltyVisitPoints = 1000
+)
+
+// LoyaltyReward è un premio del programma fedeltà, riscattabile con i punti
+type LoyaltyReward struct {
+	ID          string `json:"id" bson:"id"`
+	Name        string `json:"name" bson:"name"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+	Points      int    `json:"points" bson:"points"`
+}
+
+// LoyaltyProgram è la configurazione del programma fedeltà di un ristorante
+type LoyaltyProgram struct {
+	Enabled        bool            `json:"enabled" bson:"enabled"`
+	PointsPerVisit int             `json:"points_per_visit" bson:"points_per_visit"` // Punti di una visita se il codice non ne indica altri
+	VisitsPerDay   int             `json:"visits_per_day" bson:"visits_per_day"`     // Visite accreditate alla stessa tessera in un giorno
+	Rewards        []LoyaltyReward `json:"rewards" bson:"rewards"`
+}
+
+// Reward restituisce il premio con l'ID indicato, nil se non esiste
+func (p *LoyaltyProgram) Reward(id string) *LoyaltyReward {
+	for i := range p.Rewards {
+		if p.Rewards[i].ID == id {
+			return &p.Rewards[i]
+		}
+	}
+	return nil
+}
+
+// LoyaltyVisit è il codice di una visita, generato dalla cassa e mostrato al cliente come QR
+// code o da digitare. Vale una volta sola ed entro la scadenza
+type LoyaltyVisit struct {
+	ID           string     `json:"id" bson:"_id"`
+	RestaurantID string     `json:"restaurant_id" bson:"restaurant_id"`
+	Code         string     `json:"code" bson:"code"`
+	Points       int        `json:"points" bson:"points"`
+	OrderID      string     `json:"order_id,omitempty" bson:"order_id,omitempty"` // Ordine della visita, se indicato
+	CreatedBy    string     `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at" bson:"expires_at"`
+	ClaimedAt    *time.Time `json:"claimed_at,omitempty" bson:"claimed_at,omitempty"`
+	CardID       string     `json:"card_id,omitempty" bson:"card_id,omitempty"` // Tessera che ha raccolto i punti
+}
+
+// LoyaltyCard è la tessera fedeltà di un cliente presso un ristorante. Il cliente non ha un
+// account: il dispositivo conserva il token della tessera, di cui il database tiene l'hash
+type LoyaltyCard struct {
+	ID           string     `json:"id" bson:"_id"`
+	RestaurantID string     `json:"restaurant_id" bson:"restaurant_id"`
+	Number       string     `json:"number" bson:"number"` // Mostrato al cliente e letto dalla cassa per riscattare i premi
+	TokenHash    string     `json:"-" bson:"token_hash"`
+	Points       int        `json:"points" bson:"points"`               // Saldo
+	EarnedPoints int        `json:"earned_points" bson:"earned_points"` // Punti raccolti in totale
+	Visits       int        `json:"visits" bson:"visits"`
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	LastVisitAt  *time.Time `json:"last_visit_at,omitempty" bson:"last_visit_at,omitempty"`
+}
+
+// LoyaltyTransaction è un movimento di punti di una tessera
+type LoyaltyTransaction struct {
+	ID           string    `json:"id" bson:"_id"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	CardID       string    `json:"card_id" bson:"card_id"`
+	Type         string    `json:"type" bson:"type"`
+	Points       int       `json:"points" bson:"points"`   // Positivi se raccolti, negativi se spesi
+	Balance      int       `json:"balance" bson:"balance"` // Saldo dopo il movimento
+	VisitID      string    `json:"visit_id,omitempty" bson:"visit_id,omitempty"`
+	RewardID     string    `json:"reward_id,omitempty" bson:"reward_id,omitempty"`
+	RewardName   string    `json:"reward_name,omitempty" bson:"reward_name,omitempty"`
+	ActorID      string    `json:"actor_id,omitempty" bson:"actor_id,omitempty"` // Membro dello staff che ha riscattato il premio
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+
+	// VisitorHash è un hash giornaliero di IP e User-Agent del cliente, usato solo per
+	// limitare le raccolte dallo stesso dispositivo
+	VisitorHash string `json:"-" bson:"visitor_hash,omitempty"`
+}
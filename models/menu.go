@@ -1,42 +1,112 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
+// MenuSchemaVersion è la versione corrente della struttura dei menu persistiti.
+// Va incrementata ogni volta che si aggiunge uno step in db/storage_migration.go
+const MenuSchemaVersion = 2
+
+// Translation contiene i testi tradotti di un piatto o di una categoria
+type Translation struct {
+	Name        string `json:"name" bson:"name"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+}
+
 // MenuItem rappresenta un singolo elemento del menu
 type MenuItem struct {
-	ID          string  `json:"id" bson:"id"`
-	Name        string  `json:"name" bson:"name"`
-	Description string  `json:"description" bson:"description"`
-	Price       float64 `json:"price" bson:"price"`
-	Category    string  `json:"category" bson:"category"`
-	Available   bool    `json:"available" bson:"available"`
-	ImageURL    string  `json:"image_url,omitempty" bson:"image_url,omitempty"`
+	ID            string                 `json:"id" bson:"id"`
+	Name          string                 `json:"name" bson:"name"`
+	Description   string                 `json:"description" bson:"description"`
+	Price         float64                `json:"price" bson:"price"`
+	Category      string                 `json:"category" bson:"category"`
+	Available     bool                   `json:"available" bson:"available"`
+	ImageURL      string                 `json:"image_url,omitempty" bson:"image_url,omitempty"`
+	DisplayOrder  int                    `json:"display_order" bson:"display_order"`
+	Tags          []string               `json:"tags,omitempty" bson:"tags,omitempty"`                     // es. vegano, piccante, senza glutine
+	Translations  map[string]Translation `json:"translations,omitempty" bson:"translations,omitempty"`     // chiave: codice lingua (en, de, ...)
+	ImageID       string                 `json:"image_id,omitempty" bson:"image_id,omitempty"`             // ID dell'immagine servita da /img/{id}/{size}
+	ImageVariants []ImageVariant         `json:"image_variants,omitempty" bson:"image_variants,omitempty"` // Dimensioni e formati generati all'upload
+	Nutrition     *Nutrition             `json:"nutrition,omitempty" bson:"nutrition,omitempty"`           // Calorie e valori nutrizionali, opzionali
+	Inventory     *ItemInventory         `json:"inventory,omitempty" bson:"inventory,omitempty"`           // Giacenza, solo per i piatti a magazzino
+
+	// Canali su cui il piatto non compare nei menu esportati: delivery (tutte le piattaforme di
+	// consegna) o una singola piattaforma, ad esempio per i piatti serviti solo al tavolo
+	HiddenChannels []string `json:"hidden_channels,omitempty" bson:"hidden_channels,omitempty"`
+}
+
+// ImageVariant descrive una versione ridimensionata/convertita dell'immagine di un piatto
+type ImageVariant struct {
+	Size   string `json:"size" bson:"size"`     // thumb, medium, full
+	Format string `json:"format" bson:"format"` // jpg, png, webp
+	Width  int    `json:"width" bson:"width"`
+	Height int    `json:"height" bson:"height"`
+	URL    string `json:"url" bson:"url"` // URL diretto del file nel blob store
+}
+
+// ImageSrcset restituisce il valore dell'attributo srcset per l'immagine del piatto.
+// Gli URL puntano a /img/{id}/{size}, che sceglie il formato in base all'header Accept
+func (item MenuItem) ImageSrcset() string {
+	if item.ImageID == "" {
+		return ""
+	}
+
+	var parts []string
+	seen := make(map[string]bool)
+	for _, v := range item.ImageVariants {
+		if seen[v.Size] {
+			continue
+		}
+		seen[v.Size] = true
+		parts = append(parts, fmt.Sprintf("/img/%s/%s %dw", item.ImageID, v.Size, v.Width))
+	}
+	return strings.Join(parts, ", ")
 }
 
 // MenuCategory rappresenta una categoria del menu
 type MenuCategory struct {
-	ID          string     `json:"id" bson:"id"`
-	Name        string     `json:"name" bson:"name"`
-	Description string     `json:"description" bson:"description"`
-	Items       []MenuItem `json:"items" bson:"items"`
+	ID           string                 `json:"id" bson:"id"`
+	Name         string                 `json:"name" bson:"name"`
+	Description  string                 `json:"description" bson:"description"`
+	Items        []MenuItem             `json:"items" bson:"items"`
+	DisplayOrder int                    `json:"display_order" bson:"display_order"`
+	Translations map[string]Translation `json:"translations,omitempty" bson:"translations,omitempty"`
 }
 
 // Menu rappresenta il menu completo
 type Menu struct {
-	ID           string         `json:"id" bson:"id"`
-	RestaurantID string         `json:"restaurant_id" bson:"restaurant_id"` // Ora è l'ID del ristorante proprietario
-	Name         string         `json:"name" bson:"name"`
-	Description  string         `json:"description" bson:"description"`
-	MealType     string         `json:"meal_type" bson:"meal_type"` // lunch, dinner, breakfast, generic
-	Categories   []MenuCategory `json:"categories" bson:"categories"`
-	CreatedAt    time.Time      `json:"created_at" bson:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at" bson:"updated_at"`
-	IsCompleted  bool           `json:"is_completed" bson:"is_completed"`
-	IsActive     bool           `json:"is_active" bson:"is_active"` // Se è il menu attivo per il QR code
-	QRCodePath   string         `json:"qr_code_path,omitempty" bson:"qr_code_path,omitempty"`
-	PublicURL    string         `json:"public_url,omitempty" bson:"public_url,omitempty"`
+	ID            string         `json:"id" bson:"id"`
+	RestaurantID  string         `json:"restaurant_id" bson:"restaurant_id"` // Ora è l'ID del ristorante proprietario
+	Name          string         `json:"name" bson:"name"`
+	Description   string         `json:"description" bson:"description"`
+	MealType      string         `json:"meal_type" bson:"meal_type"` // lunch, dinner, breakfast, generic
+	Categories    []MenuCategory `json:"categories" bson:"categories"`
+	CreatedAt     time.Time      `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at" bson:"updated_at"`
+	IsCompleted   bool           `json:"is_completed" bson:"is_completed"`
+	IsActive      bool           `json:"is_active" bson:"is_active"` // Se è il menu attivo per il QR code
+	QRCodePath    string         `json:"qr_code_path,omitempty" bson:"qr_code_path,omitempty"`
+	PublicURL     string         `json:"public_url,omitempty" bson:"public_url,omitempty"`
+	SchemaVersion int            `json:"schema_version" bson:"schema_version"` // Versione dello schema (vedi MenuSchemaVersion)
+
+	// Archivio stagionale: il menu archiviato è congelato (non modificabile né pubblico)
+	// e conserva le statistiche del periodo in cui è stato in uso
+	IsArchived   bool              `json:"is_archived" bson:"is_archived"`
+	ArchivedAt   time.Time         `json:"archived_at,omitempty" bson:"archived_at,omitempty"`
+	Season       string            `json:"season,omitempty" bson:"season,omitempty"`
+	ArchiveStats *MenuArchiveStats `json:"archive_stats,omitempty" bson:"archive_stats,omitempty"`
+
+	// Cestino: il menu eliminato resta recuperabile per MenuTrashRetention, così come i
+	// piatti eliminati da un menu (deleted_items senza omitempty: UpdateMenu deve poterla svuotare)
+	DeletedAt    time.Time         `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedItems []DeletedMenuItem `json:"deleted_items,omitempty" bson:"deleted_items"`
+
+	// Modello dell'organizzazione da cui è stato distribuito il menu: viene sovrascritto a
+	// ogni nuova distribuzione del modello
+	TemplateID string `json:"template_id,omitempty" bson:"template_id,omitempty"`
 }
 
 // User rappresenta un utente del sistema (autenticazione separata dal ristorante)
@@ -51,6 +121,44 @@ type User struct {
 	CreatedAt        time.Time `json:"created_at" bson:"created_at"`
 	LastLogin        time.Time `json:"last_login,omitempty" bson:"last_login,omitempty"`
 	IsActive         bool      `json:"is_active" bson:"is_active"` // Account attivo
+
+	// Copie normalizzate (minuscolo, senza spazi) usate dagli indici unici case-insensitive
+	UsernameNormalized string `json:"-" bson:"username_normalized"`
+	EmailNormalized    string `json:"-" bson:"email_normalized"`
+
+	// Lingua di email e notifiche (it, en, ...); vuota usa la lingua di default
+	Locale string `json:"locale,omitempty" bson:"locale,omitempty"`
+
+	// Numero per le notifiche SMS in forma internazionale senza +; vuoto disattiva il canale
+	Phone string `json:"phone,omitempty" bson:"phone,omitempty"`
+
+	// Canali e frequenza delle notifiche; i valori vuoti usano i default di ogni evento
+	Notifications NotificationPreferences `json:"notifications" bson:"notifications,omitempty"`
+
+	// Account Google o Apple collegati per l'accesso social
+	Identities []ExternalIdentity `json:"identities,omitempty" bson:"identities,omitempty"`
+
+	// Quando l'utente ha dimostrato di ricevere l'email (link di verifica o di reset password,
+	// registrazione con un provider che l'ha verificata); nil se non è mai stata verificata
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" bson:"email_verified_at,omitempty"`
+}
+
+// ExternalIdentity è un account di un provider OAuth collegato all'utente
+type ExternalIdentity struct {
+	Provider string    `json:"provider" bson:"provider"` // google, apple
+	Subject  string    `json:"-" bson:"subject"`         // ID stabile dell'utente presso il provider
+	Email    string    `json:"email" bson:"email"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+// Identity restituisce l'account del provider collegato all'utente, nil se non ce n'è uno
+func (u *User) Identity(provider string) *ExternalIdentity {
+	for i := range u.Identities {
+		if u.Identities[i].Provider == provider {
+			return &u.Identities[i]
+		}
+	}
+	return nil
 }
 
 // Restaurant rappresenta le informazioni del ristorante (SEPARATO dall'autenticazione)
@@ -66,6 +174,72 @@ type Restaurant struct {
 	ActiveMenuID string    `json:"active_menu_id,omitempty" bson:"active_menu_id,omitempty"` // ID del menu attivo per QR code
 	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
 	IsActive     bool      `json:"is_active" bson:"is_active"` // Ristorante attivo
+
+	// Username pubblici precedenti: /r/{vecchio} reindirizza a /r/{username} così i QR già stampati continuano a funzionare
+	PreviousUsernames []string `json:"previous_usernames,omitempty" bson:"previous_usernames,omitempty"`
+
+	// Menu attivi contemporaneamente (es. cibo + bevande), nell'ordine di visualizzazione.
+	// ActiveMenuID resta il primo della lista per compatibilità
+	ActiveMenuIDs []string `json:"active_menu_ids,omitempty" bson:"active_menu_ids,omitempty"`
+
+	// Indirizzi personalizzati: slug breve (/m/{slug}) e dominio proprio (es. menu.pizzeria-roma.it).
+	// Il dominio viene servito solo dopo la verifica del record DNS TXT con DomainToken
+	VanitySlug     string `json:"vanity_slug,omitempty" bson:"vanity_slug,omitempty"`
+	CustomDomain   string `json:"custom_domain,omitempty" bson:"custom_domain,omitempty"`
+	DomainToken    string `json:"domain_token,omitempty" bson:"domain_token,omitempty"`
+	DomainVerified bool   `json:"domain_verified" bson:"domain_verified"`
+
+	// Analytics privacy-first: IP, User-Agent e identificativo dei visitatori vengono registrati
+	// solo dopo il consenso dal banner del menu pubblico, altrimenti restano i soli conteggi
+	PrivacyFirstAnalytics bool `json:"privacy_first_analytics" bson:"privacy_first_analytics,omitempty"`
+
+	// Organizzazione (catena) di cui il ristorante è una sede, vuoto per i ristoranti singoli
+	OrganizationID string `json:"organization_id,omitempty" bson:"organization_id,omitempty"`
+
+	// Informazioni nutrizionali dei piatti mostrate nel menu pubblico e nelle API pubbliche
+	NutritionDisplay NutritionDisplay `json:"nutrition_display" bson:"nutrition_display"`
+
+	// Valutazioni dei clienti: ShowRatings le mostra sul menu pubblico. Ratings è ricalcolato a
+	// ogni feedback approvato o rifiutato, così il menu non interroga i feedback a ogni visita
+	ShowRatings bool         `json:"show_ratings" bson:"show_ratings,omitempty"`
+	Ratings     *RatingStats `json:"ratings,omitempty" bson:"ratings,omitempty"`
+
+	// Promozioni attive, dalla prima a iniziare. Ricalcolate a ogni modifica e all'inizio e alla
+	// fine di ogni periodo di validità, così il menu pubblico non le interroga a ogni visita
+	Promotions []Promotion `json:"promotions,omitempty" bson:"promotions,omitempty"`
+
+	// Programma fedeltà: punti raccolti a ogni visita e premi riscattabili alla cassa
+	Loyalty *LoyaltyProgram `json:"loyalty,omitempty" bson:"loyalty,omitempty"`
+
+	// Buoni regalo: tagli e vendita online
+	Vouchers *VoucherSettings `json:"vouchers,omitempty" bson:"vouchers,omitempty"`
+
+	// Pagamenti online degli ordini con il provider del ristorante
+	Payments *PaymentSettings `json:"payments,omitempty" bson:"payments,omitempty"`
+
+	// Dati fiscali per le ricevute e l'esportazione degli ordini
+	Fiscal *FiscalInfo `json:"fiscal,omitempty" bson:"fiscal,omitempty"`
+
+	// Ordini in anticipo dei clienti: al tavolo, da asporto o con consegna, su fasce orarie
+	Fulfillment *FulfillmentSettings `json:"fulfillment,omitempty" bson:"fulfillment,omitempty"`
+
+	// Numero WhatsApp Business per le conferme degli ordini e il menu del giorno
+	WhatsApp *WhatsAppSettings `json:"whatsapp,omitempty" bson:"whatsapp,omitempty"`
+
+	// Pass Apple Wallet / Google Wallet con il QR code del menu
+	Wallet *WalletPassSettings `json:"wallet,omitempty" bson:"wallet,omitempty"`
+}
+
+// DisplayMenuIDs restituisce i menu attivi in ordine di visualizzazione.
+// I ristoranti salvati prima dei menu multipli hanno solo ActiveMenuID
+func (r *Restaurant) DisplayMenuIDs() []string {
+	if len(r.ActiveMenuIDs) > 0 {
+		return r.ActiveMenuIDs
+	}
+	if r.ActiveMenuID != "" {
+		return []string{r.ActiveMenuID}
+	}
+	return nil
 }
 
 // MenuRequest rappresenta i dati per creare/modificare un menu
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// NFCTag è un tag NFC sui tavoli del ristorante. Il tag contiene l'indirizzo breve /n/{Code}
+// che apre il menu, così il tag non va riscritto quando cambia il menu attivo; le aperture
+// sono contate a parte rispetto alle scansioni del QR code
+type NFCTag struct {
+	ID           string     `json:"id" bson:"_id"`
+	RestaurantID string     `json:"restaurant_id" bson:"restaurant_id"`
+	Code         string     `json:"code" bson:"code"`                           // Univoco tra tutti i ristoranti
+	Label        string     `json:"label" bson:"label"`                         // Es. "Tavolo 4" o "Bancone"
+	MenuID       string     `json:"menu_id,omitempty" bson:"menu_id,omitempty"` // Vuoto: i menu attivi
+	Active       bool       `json:"active" bson:"active"`                       // I tag disattivati (es. persi) non aprono il menu
+	Scans        int        `json:"scans" bson:"scans"`
+	LastScanAt   *time.Time `json:"last_scan_at,omitempty" bson:"last_scan_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,97 @@
+package models
+
+import "time"
+
+// Canali di notifica
+const (
+	ChannelEmail = "email"
+	ChannelPush  = "push" // App (FCM) e browser (Web Push)
+	ChannelSMS   = "sms"  // Al numero dell'utente, se è configurato un provider SMS
+)
+
+// Frequenze del digest
+const (
+	DigestOff    = "" // Ogni notifica è inviata subito
+	DigestHourly = "hourly"
+	DigestDaily  = "daily"
+)
+
+// NotificationPreferences indica su quali canali inviare ogni tipo di evento e se
+// raggrupparli in un riepilogo orario o giornaliero invece di inviarli uno per uno
+type NotificationPreferences struct {
+	Channels   map[string][]string `json:"channels,omitempty" bson:"channels,omitempty"` // Tipo di evento → canali; gli eventi assenti usano i default
+	Digest     string              `json:"digest,omitempty" bson:"digest,omitempty"`
+	DigestHour int                 `json:"digest_hour" bson:"digest_hour"` // Ora (0-23) del riepilogo giornaliero
+}
+
+// PendingNotification è una notifica già localizzata in attesa del prossimo digest
+type PendingNotification struct {
+	ID        string    `json:"id" bson:"_id"`
+	UserID    string    `json:"-" bson:"user_id"`
+	Channel   string    `json:"channel" bson:"channel"`
+	Key       string    `json:"key" bson:"key"`
+	Subject   string    `json:"subject" bson:"subject"`
+	Body      string    `json:"body" bson:"body"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// PushToken è il token FCM di un dispositivo dell'utente. L'ID coincide con il token,
+// così la stessa app reinstallata non crea duplicati
+type PushToken struct {
+	ID         string    `json:"token" bson:"_id"`
+	UserID     string    `json:"-" bson:"user_id"`
+	Platform   string    `json:"platform,omitempty" bson:"platform,omitempty"` // android, ios o web
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at" bson:"last_seen_at"`
+}
+
+// WebPushSubscription è la sottoscrizione Web Push di un browser, registrata dall'admin
+// PWA per il ristorante selezionato. L'ID è l'hash dell'endpoint
+type WebPushSubscription struct {
+	ID           string    `json:"id" bson:"_id"`
+	UserID       string    `json:"-" bson:"user_id"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	Endpoint     string    `json:"endpoint" bson:"endpoint"`
+	P256dh       string    `json:"-" bson:"p256dh"`
+	Auth         string    `json:"-" bson:"auth"`
+	UserAgent    string    `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Esiti di una notifica push
+const (
+	PushStatusSent         = "sent"
+	PushStatusFailed       = "failed"
+	PushStatusUnregistered = "unregistered" // Token rifiutato da FCM ed eliminato
+)
+
+// Esiti di un SMS oltre a sent e failed, aggiornati dalle ricevute di consegna del provider
+const (
+	SMSStatusDelivered   = "delivered"
+	SMSStatusUndelivered = "undelivered"
+	SMSStatusOptedOut    = "opted_out" // Il destinatario ha risposto STOP: l'SMS non è stato inviato
+)
+
+// NotificationReceipt registra l'esito di una notifica push verso un dispositivo o di un SMS
+// verso un numero
+type NotificationReceipt struct {
+	ID        string    `json:"id" bson:"_id"`
+	UserID    string    `json:"-" bson:"user_id"`
+	Channel   string    `json:"channel" bson:"channel,omitempty"` // push o sms; vuoto nelle ricevute push meno recenti
+	Key       string    `json:"key" bson:"key"`                   // Chiave del messaggio nel catalogo i18n
+	Device    string    `json:"device" bson:"device"`             // Ultimi caratteri del token o del numero
+	Status    string    `json:"status" bson:"status"`
+	MessageID string    `json:"message_id,omitempty" bson:"message_id,omitempty"` // ID del messaggio restituito da FCM o dal provider SMS
+	Error     string    `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitempty" bson:"updated_at,omitempty"` // Ultima ricevuta di consegna
+}
+
+// SMSOptOut registra un numero che ha chiesto di non ricevere più SMS rispondendo STOP.
+// L'ID è il numero in forma internazionale senza +
+type SMSOptOut struct {
+	Phone      string    `json:"phone" bson:"_id"`
+	Keyword    string    `json:"keyword" bson:"keyword"` // Testo della risposta, es. STOP
+	Provider   string    `json:"provider" bson:"provider"`
+	OptedOutAt time.Time `json:"opted_out_at" bson:"opted_out_at"`
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// maxPortionGrams è il peso massimo accettato per una porzione (es. una pizza famiglia)
+const maxPortionGrams = 5000
+
+// NutritionValues sono i valori nutrizionali di una quantità di alimento: energia in kcal,
+// gli altri valori in grammi. Zuccheri e grassi saturi sono compresi in carboidrati e grassi
+type NutritionValues struct {
+	Calories      float64 `json:"calories" bson:"calories"`
+	Protein       float64 `json:"protein" bson:"protein"`
+	Carbohydrates float64 `json:"carbohydrates" bson:"carbohydrates"`
+	Sugars        float64 `json:"sugars,omitempty" bson:"sugars,omitempty"`
+	Fat           float64 `json:"fat" bson:"fat"`
+	SaturatedFat  float64 `json:"saturated_fat,omitempty" bson:"saturated_fat,omitempty"`
+	Fiber         float64 `json:"fiber,omitempty" bson:"fiber,omitempty"`
+	Salt          float64 `json:"salt,omitempty" bson:"salt,omitempty"`
+}
+
+// NutritionIngredient è un ingrediente del piatto con la quantità nella porzione e i valori
+// per 100 g, da cui si calcolano i valori del piatto
+type NutritionIngredient struct {
+	Name    string          `json:"name" bson:"name"`
+	Grams   float64         `json:"grams" bson:"grams"`
+	Per100g NutritionValues `json:"per_100g" bson:"per_100g"`
+}
+
+// Nutrition contiene le informazioni nutrizionali di un piatto. I valori della porzione si
+// inseriscono direttamente in PerPortion oppure si ricavano dalla composizione in Ingredients,
+// che ha la precedenza; PortionGrams serve per il calcolo per 100 g
+type Nutrition struct {
+	PortionGrams float64               `json:"portion_grams,omitempty" bson:"portion_grams,omitempty"`
+	PerPortion   NutritionValues       `json:"per_portion" bson:"per_portion"`
+	Ingredients  []NutritionIngredient `json:"ingredients,omitempty" bson:"ingredients,omitempty"`
+}
+
+// NutritionDisplay indica quali informazioni nutrizionali il ristorante pubblica nel menu e
+// nelle API pubbliche. Senza nessuna opzione attiva non viene mostrato nulla
+type NutritionDisplay struct {
+	Calories bool `json:"calories" bson:"calories"` // Calorie della porzione
+	Macros   bool `json:"macros" bson:"macros"`     // Proteine, carboidrati, grassi e gli altri valori
+	Per100g  bool `json:"per_100g" bson:"per_100g"` // Valori anche per 100 g, se è noto il peso della porzione
+}
+
+// Enabled indica se il ristorante pubblica almeno un'informazione nutrizionale
+func (d NutritionDisplay) Enabled() bool {
+	return d.Calories || d.Macros
+}
+
+// add somma a v i valori di o moltiplicati per factor
+func (v *NutritionValues) add(o NutritionValues, factor float64) {
+	v.Calories += o.Calories * factor
+	v.Protein += o.Protein * factor
+	v.Carbohydrates += o.Carbohydrates * factor
+	v.Sugars += o.Sugars * factor
+	v.Fat += o.Fat * factor
+	v.SaturatedFat += o.SaturatedFat * factor
+	v.Fiber += o.Fiber * factor
+	v.Salt += o.Salt * factor
+}
+
+// Rounded arrotonda le calorie all'unità e gli altri valori al decimo di grammo, come nelle
+// etichette nutrizionali
+func (v NutritionValues) Rounded() NutritionValues {
+	tenth := func(x float64) float64 { return math.Round(x*10) / 10 }
+	return NutritionValues{
+		Calories:      math.Round(v.Calories),
+		Protein:       tenth(v.Protein),
+		Carbohydrates: tenth(v.Carbohydrates),
+		Sugars:        tenth(v.Sugars),
+		Fat:           tenth(v.Fat),
+		SaturatedFat:  tenth(v.SaturatedFat),
+		Fiber:         tenth(v.Fiber),
+		Salt:          tenth(v.Salt),
+	}
+}
+
+// IsEmpty indica se non è stato inserito alcun valore
+func (n *Nutrition) IsEmpty() bool {
+	return n.PortionGrams == 0 && n.PerPortion == (NutritionValues{}) && len(n.Ingredients) == 0
+}
+
+// Portion restituisce il peso della porzione: quello indicato oppure la somma degli ingredienti
+func (n *Nutrition) Portion() float64 {
+	if n.PortionGrams > 0 || len(n.Ingredients) == 0 {
+		return n.PortionGrams
+	}
+	total := 0.0
+	for _, ingredient := range n.Ingredients {
+		total += ingredient.Grams
+	}
+	return total
+}
+
+// Totals restituisce i valori della porzione, calcolati dagli ingredienti quando presenti
+func (n *Nutrition) Totals() NutritionValues {
+	if len(n.Ingredients) == 0 {
+		return n.PerPortion
+	}
+	var total NutritionValues
+	for _, ingredient := range n.Ingredients {
+		total.add(ingredient.Per100g, ingredient.Grams/100)
+	}
+	return total
+}
+
+// Per100g restituisce i valori per 100 g; false se il peso della porzione non è noto
+func (n *Nutrition) Per100g() (NutritionValues, bool) {
+	portion := n.Portion()
+	if portion <= 0 {
+		return NutritionValues{}, false
+	}
+	var per100 NutritionValues
+	per100.add(n.Totals(), 100/portion)
+	return per100, true
+}
+
+// validate controlla che i valori siano plausibili; what descrive la quantità nei messaggi
+func (v NutritionValues) validate(what string, grams float64) error {
+	values := []struct {
+		name  string
+		value float64
+	}{
+		{"calorie", v.Calories}, {"proteine", v.Protein}, {"carboidrati", v.Carbohydrates}, {"zuccheri", v.Sugars},
+		{"grassi", v.Fat}, {"grassi saturi", v.SaturatedFat}, {"fibre", v.Fiber}, {"sale", v.Salt},
+	}
+	for _, field := range values {
+		if field.value < 0 || math.IsNaN(field.value) || math.IsInf(field.value, 0) {
+			return fmt.Errorf("Valore di %s non valido %s", field.name, what)
+		}
+	}
+	if v.Sugars > v.Carbohydrates {
+		return fmt.Errorf("Gli zuccheri non possono superare i carboidrati %s", what)
+	}
+	if v.SaturatedFat > v.Fat {
+		return fmt.Errorf("I grassi saturi non possono superare i grassi %s", what)
+	}
+	// 1 g di grassi, il macronutriente più calorico, ha circa 9 kcal
+	if grams > 0 && (v.Protein+v.Carbohydrates+v.Fat+v.Fiber+v.Salt > grams || v.Calories > grams*9.5) {
+		return fmt.Errorf("I valori nutrizionali superano il peso %s", what)
+	}
+	return nil
+}
+
+// Validate controlla le informazioni nutrizionali di un piatto. I messaggi sono pensati per
+// essere mostrati all'utente
+func (n *Nutrition) Validate() error {
+	if n.PortionGrams < 0 || n.PortionGrams > maxPortionGrams {
+		return fmt.Errorf("Il peso della porzione deve essere compreso tra 0 e %d g", maxPortionGrams)
+	}
+	if len(n.Ingredients) == 0 {
+		return n.PerPortion.validate("della porzione", n.PortionGrams)
+	}
+	for _, ingredient := range n.Ingredients {
+		name := strings.TrimSpace(ingredient.Name)
+		if name == "" {
+			return errors.New("Il nome dell'ingrediente è obbligatorio")
+		}
+		if ingredient.Grams <= 0 || ingredient.Grams > maxPortionGrams {
+			return fmt.Errorf("La quantità di %s deve essere positiva", name)
+		}
+		if err := ingredient.Per100g.validate("per 100 g di "+name, 100); err != nil {
+			return err
+		}
+	}
+	if n.Portion() > maxPortionGrams {
+		return fmt.Errorf("Il peso della porzione deve essere compreso tra 0 e %d g", maxPortionGrams)
+	}
+	return nil
+}
+
+// Normalize ripulisce i nomi degli ingredienti e, quando presenti, ricalcola dagli
+// ingredienti i valori della porzione, così chi legge PerPortion trova sempre il totale
+func (n *Nutrition) Normalize() {
+	for i := range n.Ingredients {
+		n.Ingredients[i].Name = strings.TrimSpace(n.Ingredients[i].Name)
+	}
+	if len(n.Ingredients) > 0 {
+		n.PerPortion = n.Totals().Rounded()
+	}
+}
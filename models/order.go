@@ -0,0 +1,232 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Stati di un ordine
+const (
+	OrderStatusNew       = "new"       // Appena arrivato in cucina
+	OrderStatusPreparing = "preparing" // Almeno un piatto è pronto, altri sono in preparazione
+	OrderStatusReady     = "ready"     // Tutti i piatti sono pronti
+	OrderStatusCompleted = "completed" // Servito o consegnato
+	OrderStatusCancelled = "cancelled" // Annullato: le giacenze scaricate vengono ripristinate
+)
+
+// Stati di una riga d'ordine in cucina
+const (
+	OrderLinePending = "pending" // In preparazione
+	OrderLineReady   = "ready"   // Segnata come pronta ("bump") dal KDS
+)
+
+// Origini di un ordine
+const (
+	OrderSourceAPI    = "api"    // API REST, es. una cassa
+	OrderSourceGRPC   = "grpc"   // OrderService gRPC, es. un totem
+	OrderSourceOnline = "online" // Ordine in anticipo del cliente, per asporto, consegna o al tavolo
+)
+
+// MaxOrderLines è il numero massimo di righe di un ordine
+const MaxOrderLines = 100
+
+var (
+	// ErrOrderLineNotFound indica che la riga non appartiene all'ordine
+	ErrOrderLineNotFound = errors.New("riga d'ordine non trovata")
+	// ErrOrderClosed indica che l'ordine è completato o annullato e non torna in cucina
+	ErrOrderClosed = errors.New("l'ordine è chiuso")
+)
+
+// OrderLine è un piatto ordinato. Nome, prezzo e categoria sono copiati dal menu al momento
+// dell'ordine: le modifiche successive al menu non cambiano gli ordini già ricevuti
+type OrderLine struct {
+	ID         string     `json:"id" bson:"id"`
+	ItemID     string     `json:"item_id" bson:"item_id"`
+	Name       string     `json:"name" bson:"name"`
+	CategoryID string     `json:"category_id" bson:"category_id"`
+	Category   string     `json:"category" bson:"category"` // Postazione della cucina che prepara il piatto
+	Quantity   int        `json:"quantity" bson:"quantity"`
+	Price      float64    `json:"price" bson:"price"` // Prezzo unitario
+	Notes      string     `json:"notes,omitempty" bson:"notes,omitempty"`
+	Status     string     `json:"status" bson:"status"`
+	ReadyAt    *time.Time `json:"ready_at,omitempty" bson:"ready_at,omitempty"`
+}
+
+// Order è un ordine ricevuto dal ristorante
+type Order struct {
+	ID            string            `json:"id" bson:"_id"`
+	RestaurantID  string            `json:"restaurant_id" bson:"restaurant_id"`
+	MenuID        string            `json:"menu_id" bson:"menu_id"`
+	Number        int               `json:"number" bson:"number"` // Numero dello scontrino di cucina, riparte ogni giorno
+	Table         string            `json:"table,omitempty" bson:"table,omitempty"`
+	Notes         string            `json:"notes,omitempty" bson:"notes,omitempty"`
+	Source        string            `json:"source" bson:"source"`
+	Lines         []OrderLine       `json:"lines" bson:"lines"`
+	Status        string            `json:"status" bson:"status"`
+	Total         float64           `json:"total" bson:"total"`
+	VoucherID     string            `json:"voucher_id,omitempty" bson:"voucher_id,omitempty"`         // Buono regalo usato per pagare
+	VoucherPaid   float64           `json:"voucher_paid,omitempty" bson:"voucher_paid,omitempty"`     // Parte del totale pagata con il buono
+	PaymentStatus string            `json:"payment_status,omitempty" bson:"payment_status,omitempty"` // Pagamento online, vuoto finché non si apre una pagina di pagamento
+	Payment       *OrderPayment     `json:"payment,omitempty" bson:"payment,omitempty"`
+	SplitMode     string            `json:"split_mode,omitempty" bson:"split_mode,omitempty"` // Conto diviso: even o items
+	Splits        []OrderSplit      `json:"splits,omitempty" bson:"splits,omitempty"`
+	Fulfillment   *OrderFulfillment `json:"fulfillment,omitempty" bson:"fulfillment,omitempty"` // Ritiro, consegna o tavolo prenotati in anticipo
+	CreatedBy     string            `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt     time.Time         `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at" bson:"updated_at"`
+	ReadyAt       *time.Time        `json:"ready_at,omitempty" bson:"ready_at,omitempty"`
+	ClosedAt      *time.Time        `json:"closed_at,omitempty" bson:"closed_at,omitempty"`
+}
+
+// IsClosed indica se l'ordine è completato o annullato
+func (o *Order) IsClosed() bool {
+	return o.Status == OrderStatusCompleted || o.Status == OrderStatusCancelled
+}
+
+// Line restituisce la riga con l'ID indicato, nil se non c'è
+func (o *Order) Line(lineID string) *OrderLine {
+	for i := range o.Lines {
+		if o.Lines[i].ID == lineID {
+			return &o.Lines[i]
+		}
+	}
+	return nil
+}
+
+// BumpLines segna come pronte le righe indicate; senza righe segna pronto l'intero ordine
+func (o *Order) BumpLines(lineIDs []string, now time.Time) error {
+	return o.setLines(lineIDs, OrderLineReady, now)
+}
+
+// RecallLines riporta in preparazione le righe segnate pronte per errore; senza righe
+// richiama l'intero ordine
+func (o *Order) RecallLines(lineIDs []string, now time.Time) error {
+	return o.setLines(lineIDs, OrderLinePending, now)
+}
+
+func (o *Order) setLines(lineIDs []string, status string, now time.Time) error {
+	if o.IsClosed() {
+		return ErrOrderClosed
+	}
+	selected := make(map[string]bool, len(lineIDs))
+	for _, id := range lineIDs {
+		if o.Line(id) == nil {
+			return ErrOrderLineNotFound
+		}
+		selected[id] = true
+	}
+	for i := range o.Lines {
+		line := &o.Lines[i]
+		if (len(selected) > 0 && !selected[line.ID]) || line.Status == status {
+			continue
+		}
+		line.Status = status
+		if status == OrderLineReady {
+			readyAt := now
+			line.ReadyAt = &readyAt
+		} else {
+			line.ReadyAt = nil
+		}
+	}
+	o.UpdatedAt = now
+	o.refreshStatus(now)
+	return nil
+}
+
+// refreshStatus ricava lo stato di un ordine aperto da quello delle sue righe
+func (o *Order) refreshStatus(now time.Time) {
+	ready := 0
+	for _, line := range o.Lines {
+		if line.Status == OrderLineReady {
+			ready++
+		}
+	}
+	switch {
+	case ready == len(o.Lines):
+		if o.Status != OrderStatusReady {
+			readyAt := now
+			o.ReadyAt = &readyAt
+		}
+		o.Status = OrderStatusReady
+	case ready > 0:
+		o.Status = OrderStatusPreparing
+		o.ReadyAt = nil
+	default:
+		o.Status = OrderStatusNew
+		o.ReadyAt = nil
+	}
+}
+
+// Close completa o annulla l'ordine
+func (o *Order) Close(status string, now time.Time) error {
+	if o.IsClosed() {
+		return ErrOrderClosed
+	}
+	if status != OrderStatusCompleted && status != OrderStatusCancelled {
+		return errors.New("stato di chiusura non valido")
+	}
+	o.Status = status
+	o.UpdatedAt = now
+	closedAt := now
+	o.ClosedAt = &closedAt
+	return nil
+}
+
+// Split restituisce la quota del conto con l'ID indicato, nil se non c'è
+func (o *Order) Split(splitID string) *OrderSplit {
+	for i := range o.Splits {
+		if o.Splits[i].ID == splitID {
+			return &o.Splits[i]
+		}
+	}
+	return nil
+}
+
+// PaidPayments restituisce i pagamenti online confermati dell'ordine: quello dell'intero conto
+// o quelli delle quote
+func (o *Order) PaidPayments() []*OrderPayment {
+	var paid []*OrderPayment
+	if o.Payment != nil && o.Payment.PaidAt != nil {
+		paid = append(paid, o.Payment)
+	}
+	for i := range o.Splits {
+		if p := o.Splits[i].Payment; p != nil && p.PaidAt != nil {
+			paid = append(paid, p)
+		}
+	}
+	return paid
+}
+
+// RefreshPaymentStatus ricava lo stato del pagamento di un conto diviso da quello delle quote:
+// pagato quando tutte le quote sono pagate, fallito se tutte sono fallite, altrimenti in attesa
+func (o *Order) RefreshPaymentStatus() {
+	if len(o.Splits) == 0 {
+		return
+	}
+	paid, failed, refunded, partial := 0, 0, 0, 0
+	for _, split := range o.Splits {
+		switch split.PaymentStatus {
+		case PaymentFailed:
+			failed++
+		case PaymentRefunded:
+			refunded++
+		case PaymentPartiallyRefunded:
+			partial++
+		}
+		if IsPaid(split.PaymentStatus) {
+			paid++
+		}
+	}
+	switch {
+	case paid == len(o.Splits) && refunded == paid:
+		o.PaymentStatus = PaymentRefunded
+	case paid == len(o.Splits) && refunded+partial > 0:
+		o.PaymentStatus = PaymentPartiallyRefunded
+	case paid == len(o.Splits):
+		o.PaymentStatus = PaymentPaid
+	case failed == len(o.Splits):
+		o.PaymentStatus = PaymentFailed
+	default:
+		o.PaymentStatus = PaymentPending
+	}
+}
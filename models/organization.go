@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// Organization raggruppa più ristoranti (le sedi di una catena) sotto lo stesso account:
+// il proprietario passa da una sede all'altra, gestisce i modelli di menu condivisi e
+// consulta le statistiche aggregate di tutte le sedi
+type Organization struct {
+	ID        string    `json:"id" bson:"_id"`
+	Name      string    `json:"name" bson:"name"`
+	OwnerID   string    `json:"owner_id" bson:"owner_id"` // Link a User.ID
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// MenuTemplate è un modello di menu riutilizzabile. Quello di un'organizzazione è condiviso
+// e distribuito a tutte le sedi: ogni sede riceve una propria copia (Menu.TemplateID) che
+// viene sovrascritta a ogni distribuzione; categorie e piatti mantengono gli ID del modello
+// così le statistiche dei piatti sono confrontabili tra le sedi. Quello privato di un
+// ristorante (RestaurantID) è un menu salvato da cui crearne di nuovi
+type MenuTemplate struct {
+	ID             string         `json:"id" bson:"_id"`
+	OrganizationID string         `json:"organization_id,omitempty" bson:"organization_id,omitempty"`
+	RestaurantID   string         `json:"restaurant_id,omitempty" bson:"restaurant_id,omitempty"`
+	Name           string         `json:"name" bson:"name"`
+	Description    string         `json:"description" bson:"description"`
+	MealType       string         `json:"meal_type" bson:"meal_type"`
+	Categories     []MenuCategory `json:"categories" bson:"categories"`
+	CreatedBy      string         `json:"created_by" bson:"created_by"`
+	CreatedAt      time.Time      `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at" bson:"updated_at"`
+	PushedAt       time.Time      `json:"pushed_at,omitempty" bson:"pushed_at,omitempty"` // Ultima distribuzione alle sedi
+}
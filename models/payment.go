@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// Stati del pagamento online di un ordine
+const (
+	PaymentPending           = "pending"            // Pagina di pagamento aperta, in attesa dell'esito
+	PaymentPaid              = "paid"               // Pagamento confermato dal provider
+	PaymentFailed            = "failed"             // Rifiutato, annullato o scaduto: serve un nuovo pagamento
+	PaymentPartiallyRefunded = "partially_refunded" // Rimborsato in parte
+	PaymentRefunded          = "refunded"           // Rimborsato per intero
+)
+
+// Modi di dividere il conto di un ordine
+const (
+	SplitEven  = "even"  // In parti uguali tra i commensali
+	SplitItems = "items" // Ognuno paga i propri piatti
+)
+
+// MaxOrderSplits è il numero massimo di quote in cui si può dividere un conto
+const MaxOrderSplits = 20
+
+// PaymentSettings è il provider dei pagamenti online degli ordini di un ristorante
+type PaymentSettings struct {
+	Provider       string    `json:"provider" bson:"provider"` // stripe, sumup o satispay
+	Currency       string    `json:"currency" bson:"currency"`
+	Credentials    string    `json:"-" bson:"credentials"`                                       // Credenziali del provider, cifrate
+	TipPercentages []float64 `json:"tip_percentages,omitempty" bson:"tip_percentages,omitempty"` // Mance proposte al pagamento, es. 5, 10, 15
+	UpdatedAt      time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// OrderPayment è il pagamento online di un ordine
+type OrderPayment struct {
+	Provider      string        `json:"provider" bson:"provider"`
+	CheckoutID    string        `json:"checkout_id" bson:"checkout_id"`
+	CheckoutURL   string        `json:"checkout_url,omitempty" bson:"checkout_url,omitempty"`
+	PaymentID     string        `json:"payment_id,omitempty" bson:"payment_id,omitempty"` // Pagamento da rimborsare, assegnato dal provider
+	AmountCents   int64         `json:"amount_cents" bson:"amount_cents"`                 // Importo addebitato, mancia compresa
+	TipCents      int64         `json:"tip_cents,omitempty" bson:"tip_cents,omitempty"`   // Mancia scelta dal cliente
+	Currency      string        `json:"currency" bson:"currency"`
+	RefundedCents int64         `json:"refunded_cents,omitempty" bson:"refunded_cents,omitempty"`
+	Refunds       []OrderRefund `json:"refunds,omitempty" bson:"refunds,omitempty"`
+	CreatedAt     time.Time     `json:"created_at" bson:"created_at"`
+	PaidAt        *time.Time    `json:"paid_at,omitempty" bson:"paid_at,omitempty"`
+}
+
+// OrderRefund è un rimborso di un pagamento online
+type OrderRefund struct {
+	ID          string    `json:"id,omitempty" bson:"id,omitempty"` // Assegnato dal provider, se lo prevede
+	AmountCents int64     `json:"amount_cents" bson:"amount_cents"`
+	ActorID     string    `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
+}
+
+// OrderSplit è una quota del conto di un ordine diviso, pagata con un proprio link
+type OrderSplit struct {
+	ID            string        `json:"id" bson:"id"`
+	Label         string        `json:"label" bson:"label"`                           // Es. "Commensale 1"
+	LineIDs       []string      `json:"line_ids,omitempty" bson:"line_ids,omitempty"` // Piatti della quota, se divisa per piatti
+	AmountCents   int64         `json:"amount_cents" bson:"amount_cents"`             // Quota del conto, mancia esclusa
+	PaymentStatus string        `json:"payment_status" bson:"payment_status"`         // Come Order.PaymentStatus
+	Payment       *OrderPayment `json:"payment,omitempty" bson:"payment,omitempty"`
+}
+
+// IsPaid indica se il pagamento è stato confermato, anche se poi rimborsato
+func IsPaid(paymentStatus string) bool {
+	return paymentStatus == PaymentPaid || paymentStatus == PaymentPartiallyRefunded || paymentStatus == PaymentRefunded
+}
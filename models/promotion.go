@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	// MaxPromotionBanner è la lunghezza massima del testo del banner, in caratteri
+	MaxPromotionBanner = 280
+	// MaxPromotionItems è il numero massimo di piatti collegati a una promozione
+	MaxPromotionItems = 20
+	// MaxActivePromotions è il numero massimo di promozioni mostrate insieme nel menu pubblico
+	MaxActivePromotions = 5
+)
+
+// Promotion è una promozione del ristorante: un banner con i piatti collegati, mostrato in
+// evidenza in cima al menu pubblico durante il periodo di validità
+type Promotion struct {
+	ID           string    `json:"id" bson:"_id"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	Title        string    `json:"title" bson:"title"`
+	BannerText   string    `json:"banner_text,omitempty" bson:"banner_text,omitempty"`
+	ItemIDs      []string  `json:"item_ids,omitempty" bson:"item_ids,omitempty"` // Piatti in evidenza, nei menu del ristorante
+	StartsAt     time.Time `json:"starts_at" bson:"starts_at"`
+	EndsAt       time.Time `json:"ends_at" bson:"ends_at"` // Esclusa: alle EndsAt la promozione non è più visibile
+	Enabled      bool      `json:"enabled" bson:"enabled"` // Disattivata, non compare anche se nel periodo
+	CreatedBy    string    `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+
+	// NotifiedAt è l'invio dell'avviso promotion.active per il periodo corrente: cambiando il
+	// periodo la promozione viene notificata di nuovo
+	NotifiedAt *time.Time `json:"notified_at,omitempty" bson:"notified_at,omitempty"`
+}
+
+// ActiveAt indica se la promozione è visibile nel menu pubblico all'istante t
+func (p *Promotion) ActiveAt(t time.Time) bool {
+	return p.Enabled && !t.Before(p.StartsAt) && t.Before(p.EndsAt)
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ShortLink è un link breve /s/{Code} che apre il menu del ristorante: un QR code con un
+// indirizzo corto è più semplice da leggere. Origine e campagna dicono da dove arriva il
+// visitatore (es. tavolo, volantino, Instagram) e finiscono nelle statistiche
+type ShortLink struct {
+	ID           string     `json:"id" bson:"_id"`
+	RestaurantID string     `json:"restaurant_id" bson:"restaurant_id"`
+	Code         string     `json:"code" bson:"code"`                             // Univoco tra tutti i ristoranti
+	Source       string     `json:"source" bson:"source"`                         // Es. "tavolo", "volantino", "instagram"
+	Campaign     string     `json:"campaign,omitempty" bson:"campaign,omitempty"` // Es. "estate-2026"
+	MenuID       string     `json:"menu_id,omitempty" bson:"menu_id,omitempty"`   // Vuoto: i menu attivi
+	Active       bool       `json:"active" bson:"active"`
+	Clicks       int        `json:"clicks" bson:"clicks"`
+	LastClickAt  *time.Time `json:"last_click_at,omitempty" bson:"last_click_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at" bson:"updated_at"`
+}
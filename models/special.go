@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// DailySpecialDateLayout è il formato della data di un piatto del giorno
+const DailySpecialDateLayout = "2006-01-02"
+
+// DailySpecial è il menu del giorno o un piatto speciale programmato per una data, pubblicato
+// anche nei feed iCal e RSS del ristorante. Può rimandare a un menu completo (es. il menu
+// del pranzo a prezzo fisso di quel giorno)
+type DailySpecial struct {
+	ID           string    `json:"id" bson:"_id"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	Date         string    `json:"date" bson:"date"` // YYYY-MM-DD, giorno del ristorante
+	Title        string    `json:"title" bson:"title"`
+	Description  string    `json:"description,omitempty" bson:"description,omitempty"`
+	Courses      []string  `json:"courses,omitempty" bson:"courses,omitempty"` // es. "Primo: lasagne"
+	Price        float64   `json:"price,omitempty" bson:"price,omitempty"`
+	MenuID       string    `json:"menu_id,omitempty" bson:"menu_id,omitempty"`
+	CreatedBy    string    `json:"created_by" bson:"created_by"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Day restituisce la data del piatto del giorno a mezzanotte UTC
+func (s *DailySpecial) Day() time.Time {
+	day, _ := time.Parse(DailySpecialDateLayout, s.Date)
+	return day
+}
@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// Ruoli di un utente su un ristorante. Il proprietario è Restaurant.OwnerID; gli altri
+// ruoli sono assegnati con un invito e salvati come RestaurantMember
+const (
+	RoleOwner        = "owner"
+	RoleMenuEditor   = "menu-editor"
+	RoleOrderManager = "order-manager"
+	RoleViewer       = "viewer"
+)
+
+// Permessi verificati dalle route dell'admin
+const (
+	PermMenusRead        = "menus:read"
+	PermMenusWrite       = "menus:write"
+	PermOrdersManage     = "orders:manage"
+	PermAnalyticsRead    = "analytics:read"
+	PermRestaurantWrite  = "restaurant:write"
+	PermStaffManage      = "staff:manage"
+	PermBillingRead      = "billing:read"
+	PermBillingManage    = "billing:manage"
+	PermWebhooksManage   = "webhooks:manage"
+	PermMenusRevert      = "menus:revert"      // Annullare una modifica dallo storico del menu
+	PermInventoryManage  = "inventory:manage"  // Rettificare le giacenze dei piatti
+	PermFeedbackModerate = "feedback:moderate" // Approvare o rifiutare i feedback dei clienti
+)
+
+var rolePermissions = map[string]map[string]bool{
+	RoleOwner: permissionSet(PermMenusRead, PermMenusWrite, PermOrdersManage, PermAnalyticsRead,
+		PermRestaurantWrite, PermStaffManage, PermBillingRead, PermBillingManage, PermWebhooksManage, PermMenusRevert, PermInventoryManage,
+		PermFeedbackModerate),
+	RoleMenuEditor:   permissionSet(PermMenusRead, PermMenusWrite, PermAnalyticsRead, PermInventoryManage, PermFeedbackModerate),
+	RoleOrderManager: permissionSet(PermMenusRead, PermOrdersManage, PermInventoryManage),
+	RoleViewer:       permissionSet(PermMenusRead, PermAnalyticsRead),
+}
+
+// StaffRoles elenca i ruoli assegnabili con un invito, nell'ordine mostrato nell'admin
+var StaffRoles = []string{RoleMenuEditor, RoleOrderManager, RoleViewer}
+
+// RoleHasPermission indica se il ruolo concede il permesso; i ruoli sconosciuti non ne concedono
+func RoleHasPermission(role, perm string) bool {
+	return rolePermissions[role][perm]
+}
+
+// IsStaffRole indica se role può essere assegnato a un membro dello staff
+func IsStaffRole(role string) bool {
+	for _, r := range StaffRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleLabel restituisce il nome del ruolo mostrato nell'admin
+func RoleLabel(role string) string {
+	switch role {
+	case RoleOwner:
+		return "Proprietario"
+	case RoleMenuEditor:
+		return "Editor menu"
+	case RoleOrderManager:
+		return "Gestione ordini"
+	case RoleViewer:
+		return "Solo lettura"
+	}
+	return role
+}
+
+func permissionSet(perms ...string) map[string]bool {
+	set := make(map[string]bool, len(perms))
+	for _, perm := range perms {
+		set[perm] = true
+	}
+	return set
+}
+
+// RestaurantMember collega un utente dello staff al ristorante con il suo ruolo
+type RestaurantMember struct {
+	ID           string    `json:"id" bson:"_id"` // restaurantID + ":" + userID
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	UserID       string    `json:"user_id" bson:"user_id"`
+	Role         string    `json:"role" bson:"role"`
+	InvitedBy    string    `json:"invited_by" bson:"invited_by"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
+
+// StaffInvitation è un invito a entrare nello staff di un ristorante. L'ID è l'hash del token
+// inviato via email, così il database non contiene token utilizzabili
+type StaffInvitation struct {
+	ID           string    `json:"-" bson:"_id"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	Email        string    `json:"email" bson:"email"`
+	Role         string    `json:"role" bson:"role"`
+	InvitedBy    string    `json:"invited_by" bson:"invited_by"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at" bson:"expires_at"`
+}
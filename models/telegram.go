@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// TelegramChat è una chat Telegram collegata al bot da un utente del ristorante. Riceve i
+// nuovi ordini e, se attivo, il riepilogo serale; i comandi agiscono con i permessi
+// dell'utente che l'ha collegata
+type TelegramChat struct {
+	ID           int64     `json:"id" bson:"_id"` // ID della chat Telegram
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	UserID       string    `json:"user_id" bson:"user_id"`
+	Username     string    `json:"username,omitempty" bson:"username,omitempty"` // Senza @
+	Name         string    `json:"name,omitempty" bson:"name,omitempty"`
+	Locale       string    `json:"locale" bson:"locale"`
+	DailySummary bool      `json:"daily_summary" bson:"daily_summary"`
+	LinkedAt     time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+// TelegramLinkCode è il codice monouso con cui un utente collega una chat al bot, inviato
+// dal link https://t.me/<bot>?start=<codice>
+type TelegramLinkCode struct {
+	Code         string    `json:"code" bson:"_id"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	UserID       string    `json:"user_id" bson:"user_id"`
+	ExpiresAt    time.Time `json:"expires_at" bson:"expires_at"`
+}
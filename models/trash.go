@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// MenuTrashRetention è per quanto tempo menu e piatti eliminati restano nel cestino
+// prima della cancellazione definitiva
+const MenuTrashRetention = 30 * 24 * time.Hour
+
+// DeletedMenuItem è un piatto eliminato da un menu, con la categoria da cui proviene
+// per poterlo ripristinare nella stessa posizione
+type DeletedMenuItem struct {
+	Item         MenuItem  `json:"item" bson:"item"`
+	CategoryID   string    `json:"category_id" bson:"category_id"`
+	CategoryName string    `json:"category_name" bson:"category_name"`
+	DeletedAt    time.Time `json:"deleted_at" bson:"deleted_at"`
+}
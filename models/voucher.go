@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+// Stati di un buono regalo
+const (
+	VoucherPending = "pending" // Acquistato online, in attesa della conferma del pagamento
+	VoucherActive  = "active"  // Utilizzabile fino alla scadenza, finché ha credito
+	VoucherVoid    = "void"    // Annullato dal ristorante: il credito residuo è perso
+)
+
+// Origini di un buono regalo
+const (
+	VoucherSourceCounter  = "counter"  // Emesso dal ristorante, es. venduto alla cassa
+	VoucherSourceCheckout = "checkout" // Acquistato online dal cliente
+)
+
+// Tipi di movimento del credito di un buono
+const (
+	VoucherIssue  = "issue"  // Credito iniziale, all'emissione o alla conferma del pagamento
+	VoucherRedeem = "redeem" // Speso per un ordine
+	VoucherRefund = "refund" // Restituito per un ordine annullato
+	VoucherVoided = "void"   // Credito residuo azzerato dall'annullamento
+)
+
+const (
+	// MinVoucherCents e MaxVoucherCents sono i limiti del valore di un buono, in centesimi
+	MinVoucherCents = 500
+	MaxVoucherCents = 100000
+	// MaxVoucherAmounts è il numero massimo di tagli proposti nella vendita online
+	MaxVoucherAmounts = 10
+)
+
+// VoucherSettings è la configurazione dei buoni regalo di un ristorante
+type VoucherSettings struct {
+	OnlineSales  bool    `json:"online_sales" bson:"online_sales"` // Acquisto online dal cliente, con pagamento tramite il provider di billing
+	Amounts      []int64 `json:"amounts" bson:"amounts"`           // Tagli in vendita online, in centesimi
+	Currency     string  `json:"currency" bson:"currency"`
+	ValidityDays int     `json:"validity_days" bson:"validity_days"` // Durata dall'emissione
+}
+
+// AllowsAmount indica se il taglio è in vendita online
+func (s *VoucherSettings) AllowsAmount(cents int64) bool {
+	for _, amount := range s.Amounts {
+		if amount == cents {
+			return true
+		}
+	}
+	return false
+}
+
+// Voucher è un buono regalo prepagato. Il codice, stampato o mostrato come QR code, si usa per
+// pagare gli ordini in tutto o in parte fino a esaurimento del credito
+type Voucher struct {
+	ID             string     `json:"id" bson:"_id"`
+	RestaurantID   string     `json:"restaurant_id" bson:"restaurant_id"`
+	Code           string     `json:"code" bson:"code"`
+	Status         string     `json:"status" bson:"status"`
+	Source         string     `json:"source" bson:"source"`
+	AmountCents    int64      `json:"amount_cents" bson:"amount_cents"`   // Valore iniziale
+	BalanceCents   int64      `json:"balance_cents" bson:"balance_cents"` // Credito residuo
+	Currency       string     `json:"currency" bson:"currency"`
+	RecipientName  string     `json:"recipient_name,omitempty" bson:"recipient_name,omitempty"`
+	Message        string     `json:"message,omitempty" bson:"message,omitempty"`
+	PurchaserEmail string     `json:"purchaser_email,omitempty" bson:"purchaser_email,omitempty"`
+	CheckoutID     string     `json:"checkout_id,omitempty" bson:"checkout_id,omitempty"` // Sessione di pagamento dell'acquisto online
+	CreatedBy      string     `json:"created_by,omitempty" bson:"created_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" bson:"updated_at"`
+	ActivatedAt    *time.Time `json:"activated_at,omitempty" bson:"activated_at,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at" bson:"expires_at"`
+}
+
+// Redeemable indica se all'istante t il buono è attivo, non scaduto e ha credito
+func (v *Voucher) Redeemable(t time.Time) bool {
+	return v.Status == VoucherActive && t.Before(v.ExpiresAt) && v.BalanceCents > 0
+}
+
+// VoucherTransaction è un movimento del credito di un buono
+type VoucherTransaction struct {
+	ID           string    `json:"id" bson:"_id"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	VoucherID    string    `json:"voucher_id" bson:"voucher_id"`
+	Type         string    `json:"type" bson:"type"`
+	AmountCents  int64     `json:"amount_cents" bson:"amount_cents"`   // Positivo se accreditato, negativo se speso
+	BalanceCents int64     `json:"balance_cents" bson:"balance_cents"` // Credito dopo il movimento
+	OrderID      string    `json:"order_id,omitempty" bson:"order_id,omitempty"`
+	ActorID      string    `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
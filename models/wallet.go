@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// WalletPassSettings personalizza il pass Apple Wallet / Google Wallet del ristorante, con il
+// QR code del menu. AuthToken autentica i dispositivi Apple verso il web service degli
+// aggiornamenti e viene creato al primo pass emesso
+type WalletPassSettings struct {
+	BackgroundColor string    `json:"background_color" bson:"background_color"` // #rrggbb
+	ForegroundColor string    `json:"foreground_color" bson:"foreground_color"` // #rrggbb
+	AuthToken       string    `json:"-" bson:"auth_token"`
+	UpdatedAt       time.Time `json:"updated_at" bson:"updated_at"` // Ultima modifica del contenuto del pass
+}
+
+// WalletRegistration è un dispositivo Apple che ha aggiunto il pass di un ristorante e
+// riceve le notifiche push quando il pass cambia
+type WalletRegistration struct {
+	ID           string    `json:"id" bson:"_id"` // Dispositivo e numero di serie
+	DeviceID     string    `json:"device_id" bson:"device_id"`
+	PushToken    string    `json:"-" bson:"push_token"`
+	PassTypeID   string    `json:"pass_type_id" bson:"pass_type_id"`
+	SerialNumber string    `json:"serial_number" bson:"serial_number"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+}
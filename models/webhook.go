@@ -9,9 +9,14 @@ type WebhookEndpoint struct {
 	URL          string    `json:"url" bson:"url"`
 	Events       []string  `json:"events" bson:"events"`
 	Secret       string    `json:"secret" bson:"secret"`
+	Locale       string    `json:"locale,omitempty" bson:"locale,omitempty"` // Language of the rendered message in payloads, empty uses the default
 	IsActive     bool      `json:"is_active" bson:"is_active"`
 	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+
+	// Circuit breaker: after too many consecutive failures the deliveries are paused
+	ConsecutiveFailures int        `json:"consecutive_failures" bson:"consecutive_failures"`
+	CircuitOpenUntil    *time.Time `json:"circuit_open_until,omitempty" bson:"circuit_open_until,omitempty"`
 }
 
 // WebhookEvent represents an event emitted by the system.
@@ -22,16 +27,31 @@ type WebhookEvent struct {
 	CreatedAt time.Time   `json:"created_at" bson:"created_at"`
 }
 
-// WebhookDelivery tracks a delivery attempt.
+// Webhook delivery statuses. Dead deliveries are the dead-letter list: they ran out of
+// attempts (or lost their endpoint) and are only sent again on request.
+const (
+	WebhookDeliveryPending  = "pending"
+	WebhookDeliveryRetrying = "retrying"
+	WebhookDeliverySuccess  = "success"
+	WebhookDeliveryDead     = "dead"
+)
+
+// WebhookDelivery tracks the delivery of an event to an endpoint across its attempts.
 type WebhookDelivery struct {
-	ID           string    `json:"id" bson:"id"`
-	WebhookID    string    `json:"webhook_id" bson:"webhook_id"`
-	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
-	EventType    string    `json:"event_type" bson:"event_type"`
-	Status       string    `json:"status" bson:"status"` // success, failed, retrying
-	Attempt      int       `json:"attempt" bson:"attempt"`
-	LastError    string    `json:"last_error,omitempty" bson:"last_error,omitempty"`
-	NextRetryAt  time.Time `json:"next_retry_at,omitempty" bson:"next_retry_at,omitempty"`
-	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" bson:"updated_at"`
+	ID             string     `json:"id" bson:"id"`
+	WebhookID      string     `json:"webhook_id" bson:"webhook_id"`
+	RestaurantID   string     `json:"restaurant_id" bson:"restaurant_id"`
+	EventID        string     `json:"event_id" bson:"event_id"`
+	EventType      string     `json:"event_type" bson:"event_type"`
+	Locale         string     `json:"locale" bson:"locale"` // Language the payload was rendered in
+	Payload        string     `json:"payload" bson:"payload"`
+	Status         string     `json:"status" bson:"status"` // pending, retrying, success, dead
+	Attempt        int        `json:"attempt" bson:"attempt"`
+	ResponseStatus int        `json:"response_status,omitempty" bson:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty" bson:"last_error,omitempty"`
+	NextRetryAt    time.Time  `json:"next_retry_at,omitempty" bson:"next_retry_at,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+	LockedUntil    *time.Time `json:"-" bson:"locked_until,omitempty"` // Lease of the worker sending it
+	CreatedAt      time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" bson:"updated_at"`
 }
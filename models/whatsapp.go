@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// WhatsAppSettings collega il ristorante al suo numero WhatsApp Business (Cloud API). I
+// messaggi che avvia il ristorante usano i modelli approvati da Meta sull'account WhatsApp
+// Business, con le variabili nell'ordine indicato per ciascun modello
+type WhatsAppSettings struct {
+	PhoneNumberID string `json:"phone_number_id" bson:"phone_number_id"` // ID del numero nella Cloud API
+	DisplayNumber string `json:"display_number" bson:"display_number"`   // Numero in forma internazionale senza +, per i link alla chat
+	AccessToken   string `json:"-" bson:"access_token"`                  // Token di accesso di sistema, cifrato
+
+	// Conferma degli ordini in anticipo ai clienti che l'hanno chiesta su WhatsApp. Variabili:
+	// nome del ristorante, numero dell'ordine, orario della fascia, link alla pagina di stato
+	OrderConfirmations bool   `json:"order_confirmations" bson:"order_confirmations"`
+	OrderTemplate      string `json:"order_template,omitempty" bson:"order_template,omitempty"`
+
+	// Invio del piatto del giorno agli iscritti. Variabili: nome del ristorante, titolo, portate
+	// e prezzo, link al menu
+	MenuTemplate string `json:"menu_template,omitempty" bson:"menu_template,omitempty"`
+
+	TemplateLanguage string    `json:"template_language" bson:"template_language"`               // Lingua dei modelli, es. it
+	LastBroadcast    string    `json:"last_broadcast,omitempty" bson:"last_broadcast,omitempty"` // Ultimo giorno inviato, YYYY-MM-DD
+	UpdatedAt        time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// WhatsAppSubscriber è un cliente iscritto al menu del giorno di un ristorante su WhatsApp,
+// iscritto scrivendo MENU al numero del ristorante e cancellato scrivendo STOP
+type WhatsAppSubscriber struct {
+	ID           string    `json:"id" bson:"_id"`
+	RestaurantID string    `json:"restaurant_id" bson:"restaurant_id"`
+	Phone        string    `json:"phone" bson:"phone"` // Forma internazionale senza +
+	Name         string    `json:"name,omitempty" bson:"name,omitempty"`
+	SubscribedAt time.Time `json:"subscribed_at" bson:"subscribed_at"`
+}
@@ -0,0 +1,76 @@
+// Package ai writes menu texts with a large language model behind a pluggable provider:
+// an OpenAI-compatible chat completions API or a self-hosted Ollama server.
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Provider types
+const (
+	ProviderNone   = ""
+	ProviderOpenAI = "openai"
+	ProviderOllama = "ollama"
+)
+
+// Default endpoints of the providers
+const (
+	DefaultOpenAIURL = "https://api.openai.com/v1"
+	DefaultOllamaURL = "http://localhost:11434"
+)
+
+// Prompt is a single-turn request to the model
+type Prompt struct {
+	System    string // Instructions
+	User      string
+	MaxTokens int // 0 uses the provider default
+}
+
+// Provider completes prompts with a language model
+type Provider interface {
+	// Complete returns the text generated for the prompt
+	Complete(ctx context.Context, prompt Prompt) (string, error)
+}
+
+// Config holds the provider settings
+type Config struct {
+	Provider string // "", openai, ollama
+	BaseURL  string // Empty uses the provider default
+	APIKey   string // Required by OpenAI, optional bearer token for Ollama behind a proxy
+	Model    string
+	Timeout  time.Duration
+}
+
+// New creates the provider selected by cfg.Provider, or nil when AI features are disabled
+func New(cfg Config) (Provider, error) {
+	if cfg.Provider != ProviderNone && cfg.Model == "" {
+		return nil, fmt.Errorf("ai provider %s requires a model", cfg.Provider)
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+	switch cfg.Provider {
+	case ProviderNone:
+		return nil, nil
+	case ProviderOpenAI:
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("openai provider requires an API key")
+		}
+		return NewOpenAI(cfg.BaseURL, cfg.APIKey, cfg.Model, client), nil
+	case ProviderOllama:
+		return NewOllama(cfg.BaseURL, cfg.APIKey, cfg.Model, client), nil
+	default:
+		return nil, fmt.Errorf("unknown ai provider: %s", cfg.Provider)
+	}
+}
+
+// apiError builds the error of a failed provider call, including the start of the body
+func apiError(provider string, status int, body []byte) error {
+	message := strings.TrimSpace(string(body))
+	if len(message) > 200 {
+		message = message[:200] + "..."
+	}
+	return fmt.Errorf("%s: unexpected status %d: %s", provider, status, message)
+}
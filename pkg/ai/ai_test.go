@@ -0,0 +1,162 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeProvider struct {
+	answer string
+	err    error
+	prompt Prompt
+}
+
+func (f *fakeProvider) Complete(ctx context.Context, prompt Prompt) (string, error) {
+	f.prompt = prompt
+	return f.answer, f.err
+}
+
+func TestNew(t *testing.T) {
+	p, err := New(Config{})
+	if err != nil || p != nil {
+		t.Fatalf("disabled provider: got %v, %v", p, err)
+	}
+	if _, err := New(Config{Provider: ProviderOpenAI, Model: "gpt-4o-mini"}); err == nil {
+		t.Error("openai without API key should fail")
+	}
+	if _, err := New(Config{Provider: ProviderOllama}); err == nil {
+		t.Error("provider without model should fail")
+	}
+	if _, err := New(Config{Provider: "bard", Model: "x"}); err == nil {
+		t.Error("unknown provider should fail")
+	}
+	if p, err := New(Config{Provider: ProviderOllama, Model: "llama3"}); err != nil || p == nil {
+		t.Errorf("ollama: got %v, %v", p, err)
+	}
+}
+
+func TestOpenAI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("unexpected authorization %q", got)
+		}
+		var body struct {
+			Model     string        `json:"model"`
+			Messages  []chatMessage `json:"messages"`
+			MaxTokens int           `json:"max_tokens"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Model != "gpt-4o-mini" || len(body.Messages) != 2 || body.Messages[0].Role != "system" || body.MaxTokens != 50 {
+			t.Errorf("unexpected request %+v", body)
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ciao"}}]}`))
+	}))
+	defer srv.Close()
+
+	p := NewOpenAI(srv.URL+"/v1/", "sk-test", "gpt-4o-mini", nil)
+	got, err := p.Complete(context.Background(), Prompt{System: "sys", User: "hi", MaxTokens: 50})
+	if err != nil || got != "ciao" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
+
+func TestOllama(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var body struct {
+			Stream  bool `json:"stream"`
+			Options struct {
+				NumPredict int `json:"num_predict"`
+			} `json:"options"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Stream || body.Options.NumPredict != 80 {
+			t.Errorf("unexpected request %+v", body)
+		}
+		w.Write([]byte(`{"message":{"role":"assistant","content":"hallo"},"done":true}`))
+	}))
+	defer srv.Close()
+
+	p := NewOllama(srv.URL, "", "llama3", nil)
+	got, err := p.Complete(context.Background(), Prompt{User: "hi", MaxTokens: 80})
+	if err != nil || got != "hallo" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
+
+func TestProviderError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"invalid api key"}`, http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	_, err := NewOpenAI(srv.URL, "bad", "m", nil).Complete(context.Background(), Prompt{User: "hi"})
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "invalid api key") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestSuggestItemDescriptions(t *testing.T) {
+	p := &fakeProvider{answer: "1. \"Impasto a lunga lievitazione con pomodoro San Marzano\"\n\n2) Fior di latte e basilico fresco\n- Classica napoletana\n- Di troppo"}
+	got, err := SuggestItemDescriptions(context.Background(), p, ItemDescriptionRequest{
+		ItemName: "Margherita",
+		Category: "Pizze",
+		Price:    7.5,
+		Tags:     []string{"vegetarian"},
+		Language: "it",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Impasto a lunga lievitazione con pomodoro San Marzano",
+		"Fior di latte e basilico fresco",
+		"Classica napoletana",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !strings.Contains(p.prompt.System, "Italian") || !strings.Contains(p.prompt.System, "3 alternative") {
+		t.Errorf("unexpected system prompt %q", p.prompt.System)
+	}
+	for _, part := range []string{"Item: Margherita", "Category: Pizze", "Price: 7.50", "Tags: vegetarian"} {
+		if !strings.Contains(p.prompt.User, part) {
+			t.Errorf("user prompt %q misses %q", p.prompt.User, part)
+		}
+	}
+}
+
+func TestSuggestItemDescriptionsErrors(t *testing.T) {
+	if _, err := SuggestItemDescriptions(context.Background(), &fakeProvider{answer: " \n- \n"}, ItemDescriptionRequest{ItemName: "x"}); !errors.Is(err, ErrNoSuggestions) {
+		t.Errorf("empty answer: got %v", err)
+	}
+	failure := errors.New("boom")
+	if _, err := SuggestItemDescriptions(context.Background(), &fakeProvider{err: failure}, ItemDescriptionRequest{ItemName: "x"}); !errors.Is(err, failure) {
+		t.Errorf("provider error: got %v", err)
+	}
+	if _, err := SuggestItemDescriptions(context.Background(), nil, ItemDescriptionRequest{ItemName: "x"}); err == nil {
+		t.Error("nil provider should fail")
+	}
+}
+
+func TestLanguageName(t *testing.T) {
+	if got := LanguageName("DE"); got != "German" {
+		t.Errorf("got %q", got)
+	}
+	if got := LanguageName("ro"); got != "ro" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,146 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxResponseSize bounds the provider responses read into memory
+const maxResponseSize = 1 << 20
+
+// chatMessage is a message of the OpenAI and Ollama chat APIs
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func chatMessages(prompt Prompt) []chatMessage {
+	var messages []chatMessage
+	if prompt.System != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: prompt.System})
+	}
+	return append(messages, chatMessage{Role: "user", Content: prompt.User})
+}
+
+// postJSON sends body as JSON and decodes the response into out
+func postJSON(ctx context.Context, client *http.Client, provider, url, token string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("%s: %w", provider, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return apiError(provider, resp.StatusCode, data)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s: invalid response: %w", provider, err)
+	}
+	return nil
+}
+
+// OpenAI completes prompts with the chat completions API of OpenAI or of a compatible
+// server (Azure OpenAI gateways, vLLM, LocalAI, ...)
+type OpenAI struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// NewOpenAI creates an OpenAI provider. An empty baseURL uses DefaultOpenAIURL
+func NewOpenAI(baseURL, apiKey, model string, client *http.Client) *OpenAI {
+	if baseURL == "" {
+		baseURL = DefaultOpenAIURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &OpenAI{baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey, model: model, client: client}
+}
+
+// Complete implements Provider
+func (p *OpenAI) Complete(ctx context.Context, prompt Prompt) (string, error) {
+	request := struct {
+		Model     string        `json:"model"`
+		Messages  []chatMessage `json:"messages"`
+		MaxTokens int           `json:"max_tokens,omitempty"`
+	}{Model: p.model, Messages: chatMessages(prompt), MaxTokens: prompt.MaxTokens}
+
+	var response struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+	}
+	if err := postJSON(ctx, p.client, "openai", p.baseURL+"/chat/completions", p.apiKey, request, &response); err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", errors.New("openai: empty response")
+	}
+	return response.Choices[0].Message.Content, nil
+}
+
+// Ollama completes prompts with the chat API of an Ollama server
+type Ollama struct {
+	baseURL string
+	token   string
+	model   string
+	client  *http.Client
+}
+
+// NewOllama creates an Ollama provider. An empty baseURL uses DefaultOllamaURL; token is
+// sent as bearer token when the server sits behind an authenticating proxy
+func NewOllama(baseURL, token, model string, client *http.Client) *Ollama {
+	if baseURL == "" {
+		baseURL = DefaultOllamaURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Ollama{baseURL: strings.TrimRight(baseURL, "/"), token: token, model: model, client: client}
+}
+
+// Complete implements Provider
+func (p *Ollama) Complete(ctx context.Context, prompt Prompt) (string, error) {
+	type options struct {
+		NumPredict int `json:"num_predict,omitempty"`
+	}
+	request := struct {
+		Model    string        `json:"model"`
+		Messages []chatMessage `json:"messages"`
+		Stream   bool          `json:"stream"`
+		Options  options       `json:"options"`
+	}{Model: p.model, Messages: chatMessages(prompt), Options: options{NumPredict: prompt.MaxTokens}}
+
+	var response struct {
+		Message chatMessage `json:"message"`
+	}
+	if err := postJSON(ctx, p.client, "ollama", p.baseURL+"/api/chat", p.token, request, &response); err != nil {
+		return "", err
+	}
+	return response.Message.Content, nil
+}
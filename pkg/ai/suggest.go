@@ -0,0 +1,143 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Suggestion count bounds
+const (
+	DefaultSuggestions = 3
+	MaxSuggestions     = 5
+)
+
+// languageNames maps the supported locales to the language name used in the prompt
+var languageNames = map[string]string{
+	"it": "Italian",
+	"en": "English",
+	"de": "German",
+	"fr": "French",
+	"es": "Spanish",
+	"pt": "Portuguese",
+	"nl": "Dutch",
+	"ja": "Japanese",
+	"zh": "Chinese",
+}
+
+// ErrNoSuggestions is returned when the model answer contains no usable description
+var ErrNoSuggestions = errors.New("ai: no suggestions in the model response")
+
+// ItemDescriptionRequest describes the menu item to write descriptions for
+type ItemDescriptionRequest struct {
+	RestaurantName string
+	MenuName       string
+	Category       string
+	ItemName       string
+	Current        string // Current description, used as a hint
+	Tags           []string
+	Price          float64
+	Language       string // Locale code, e.g. "it"
+	Count          int    // Number of alternatives, DefaultSuggestions when 0
+}
+
+// LanguageName returns the English name of a locale, or the locale itself when unknown
+func LanguageName(locale string) string {
+	if name, ok := languageNames[strings.ToLower(locale)]; ok {
+		return name
+	}
+	return locale
+}
+
+// SuggestItemDescriptions asks the provider for alternative descriptions of a menu item
+func SuggestItemDescriptions(ctx context.Context, provider Provider, req ItemDescriptionRequest) ([]string, error) {
+	if provider == nil {
+		return nil, errors.New("ai: provider not configured")
+	}
+	count := req.Count
+	if count <= 0 {
+		count = DefaultSuggestions
+	}
+	if count > MaxSuggestions {
+		count = MaxSuggestions
+	}
+
+	answer, err := provider.Complete(ctx, Prompt{
+		System:    itemDescriptionSystemPrompt(count, LanguageName(req.Language)),
+		User:      itemDescriptionUserPrompt(req),
+		MaxTokens: 120 * count,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := parseSuggestions(answer)
+	if len(suggestions) == 0 {
+		return nil, ErrNoSuggestions
+	}
+	if len(suggestions) > count {
+		suggestions = suggestions[:count]
+	}
+	return suggestions, nil
+}
+
+func itemDescriptionSystemPrompt(count int, language string) string {
+	return fmt.Sprintf("You write short, appetizing descriptions for restaurant menu items. "+
+		"Write %d alternative descriptions in %s, one per line, each at most 200 characters. "+
+		"Do not invent allergens, prices or ingredients that contradict the given details. "+
+		"Reply with the descriptions only, without numbering or comments.", count, language)
+}
+
+func itemDescriptionUserPrompt(req ItemDescriptionRequest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Item: %s\n", req.ItemName)
+	if req.Category != "" {
+		fmt.Fprintf(&b, "Category: %s\n", req.Category)
+	}
+	if req.MenuName != "" {
+		fmt.Fprintf(&b, "Menu: %s\n", req.MenuName)
+	}
+	if req.RestaurantName != "" {
+		fmt.Fprintf(&b, "Restaurant: %s\n", req.RestaurantName)
+	}
+	if req.Price > 0 {
+		fmt.Fprintf(&b, "Price: %.2f\n", req.Price)
+	}
+	if len(req.Tags) > 0 {
+		fmt.Fprintf(&b, "Tags: %s\n", strings.Join(req.Tags, ", "))
+	}
+	if req.Current != "" {
+		fmt.Fprintf(&b, "Current description: %s\n", req.Current)
+	}
+	return b.String()
+}
+
+// parseSuggestions splits the model answer into descriptions, dropping bullets, numbering
+// and surrounding quotes
+func parseSuggestions(answer string) []string {
+	var suggestions []string
+	for _, line := range strings.Split(answer, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimLeft(line, "-*•· \t")
+		line = trimNumbering(line)
+		line = strings.Trim(line, "\"'“”«» \t")
+		if line == "" {
+			continue
+		}
+		suggestions = append(suggestions, line)
+	}
+	return suggestions
+}
+
+// trimNumbering removes a leading "1." or "2)" list marker
+func trimNumbering(line string) string {
+	i := 0
+	for i < len(line) && line[i] >= '0' && line[i] <= '9' {
+		i++
+	}
+	if i == 0 || i >= len(line) || (line[i] != '.' && line[i] != ')') {
+		return line
+	}
+	return strings.TrimSpace(line[i+1:])
+}
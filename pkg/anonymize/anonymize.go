@@ -0,0 +1,129 @@
+// Package anonymize reduces visitor IP addresses and user agents before they are stored,
+// so analytics keep their statistical value without retaining personal data.
+package anonymize
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IP anonymization modes
+const (
+	ModeNone     = "none"     // Keep the address unchanged
+	ModeTruncate = "truncate" // Zero the host part: IPv4 /24, IPv6 /48
+	ModeHash     = "hash"     // Replace the address with a salted hash
+)
+
+// hashPrefix marks hashed values, so they are never hashed twice or parsed as addresses
+const hashPrefix = "h:"
+
+// hashLength is the number of hex characters kept from the HMAC: enough to tell visitors
+// apart within a salt period without storing the full digest
+const hashLength = 16
+
+// Config selects how IP addresses and user agents are anonymized
+type Config struct {
+	IPMode        string        // ModeNone, ModeTruncate or ModeHash; empty means ModeTruncate
+	HashUserAgent bool          // Replace user agents with a salted hash
+	SaltRotation  time.Duration // How often the hash salt is replaced, default 24h
+}
+
+// Anonymizer applies a Config. The hash salt is random, kept only in memory and replaced
+// every SaltRotation, so hashes cannot be reversed or linked across periods.
+// A nil Anonymizer keeps every value unchanged
+type Anonymizer struct {
+	cfg Config
+	now func() time.Time
+
+	mu     sync.Mutex
+	salt   []byte
+	period int64 // Salt period the current salt belongs to
+}
+
+// New validates cfg and creates an Anonymizer
+func New(cfg Config) (*Anonymizer, error) {
+	if cfg.IPMode == "" {
+		cfg.IPMode = ModeTruncate
+	}
+	switch cfg.IPMode {
+	case ModeNone, ModeTruncate, ModeHash:
+	default:
+		return nil, fmt.Errorf("unknown IP anonymization mode %q: expected none, truncate or hash", cfg.IPMode)
+	}
+	if cfg.SaltRotation < 0 {
+		return nil, fmt.Errorf("salt rotation must not be negative")
+	}
+	if cfg.SaltRotation == 0 {
+		cfg.SaltRotation = 24 * time.Hour
+	}
+	return &Anonymizer{cfg: cfg, now: time.Now}, nil
+}
+
+// Enabled reports whether the Anonymizer changes IP addresses or user agents
+func (a *Anonymizer) Enabled() bool {
+	return a != nil && (a.cfg.IPMode != ModeNone || a.cfg.HashUserAgent)
+}
+
+// IP anonymizes an IP address according to the configured mode. Values that are not
+// addresses are dropped, values already hashed are returned as they are
+func (a *Anonymizer) IP(ip string) string {
+	if a == nil || ip == "" || IsHashed(ip) {
+		return ip
+	}
+	switch a.cfg.IPMode {
+	case ModeTruncate:
+		return TruncateIP(ip)
+	case ModeHash:
+		return a.hash(strings.TrimSpace(ip))
+	}
+	return ip
+}
+
+// UserAgent returns a salted hash of userAgent when HashUserAgent is set
+func (a *Anonymizer) UserAgent(userAgent string) string {
+	if a == nil || !a.cfg.HashUserAgent || userAgent == "" || IsHashed(userAgent) {
+		return userAgent
+	}
+	return a.hash(userAgent)
+}
+
+// hash returns the prefixed HMAC of value with the salt of the current period
+func (a *Anonymizer) hash(value string) string {
+	a.mu.Lock()
+	period := a.now().UnixNano() / int64(a.cfg.SaltRotation)
+	if a.salt == nil || period != a.period {
+		a.salt = make([]byte, 32)
+		rand.Read(a.salt)
+		a.period = period
+	}
+	mac := hmac.New(sha256.New, a.salt)
+	a.mu.Unlock()
+
+	mac.Write([]byte(value))
+	return hashPrefix + hex.EncodeToString(mac.Sum(nil))[:hashLength]
+}
+
+// TruncateIP zeroes the host part of an address: the last octet of IPv4 (/24) and the
+// last 80 bits of IPv6 (/48). It returns "" if ip is not a valid address
+func TruncateIP(ip string) string {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// IsHashed reports whether value was produced by an Anonymizer hash
+func IsHashed(value string) bool {
+	return strings.HasPrefix(value, hashPrefix)
+}
@@ -0,0 +1,100 @@
+package anonymize
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTruncateIP(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.42":            "203.0.113.0",
+		" 203.0.113.42 ":          "203.0.113.0",
+		"203.0.113.0":             "203.0.113.0",
+		"::ffff:203.0.113.42":     "203.0.113.0",
+		"2001:db8:85a3:8d3::7334": "2001:db8:85a3::",
+		"2001:db8:85a3::":         "2001:db8:85a3::",
+		"not-an-ip":               "",
+		"203.0.113.42:8080":       "",
+	}
+	for ip, want := range tests {
+		if got := TruncateIP(ip); got != want {
+			t.Errorf("TruncateIP(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
+
+func TestNewValidatesMode(t *testing.T) {
+	if _, err := New(Config{IPMode: "mask"}); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+	if _, err := New(Config{SaltRotation: -time.Hour}); err == nil {
+		t.Error("expected error for negative salt rotation")
+	}
+	a, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := a.IP("198.51.100.7"); got != "198.51.100.0" {
+		t.Errorf("default mode should truncate, got %q", got)
+	}
+}
+
+func TestNilAnonymizerKeepsValues(t *testing.T) {
+	var a *Anonymizer
+	if a.Enabled() {
+		t.Error("nil anonymizer should not be enabled")
+	}
+	if got := a.IP("198.51.100.7"); got != "198.51.100.7" {
+		t.Errorf("IP = %q", got)
+	}
+	if got := a.UserAgent("Mozilla/5.0"); got != "Mozilla/5.0" {
+		t.Errorf("UserAgent = %q", got)
+	}
+}
+
+func TestNoneMode(t *testing.T) {
+	a, _ := New(Config{IPMode: ModeNone})
+	if a.Enabled() {
+		t.Error("none without user agent hashing should not be enabled")
+	}
+	if got := a.IP("198.51.100.7"); got != "198.51.100.7" {
+		t.Errorf("IP = %q", got)
+	}
+}
+
+func TestHashRotatesSalt(t *testing.T) {
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	a, _ := New(Config{IPMode: ModeHash, HashUserAgent: true, SaltRotation: 24 * time.Hour})
+	a.now = func() time.Time { return now }
+
+	first := a.IP("198.51.100.7")
+	if !IsHashed(first) || len(first) != len(hashPrefix)+hashLength {
+		t.Fatalf("unexpected hash %q", first)
+	}
+	if again := a.IP("198.51.100.7"); again != first {
+		t.Errorf("same period should give the same hash: %q != %q", again, first)
+	}
+	if other := a.IP("198.51.100.8"); other == first {
+		t.Error("different addresses should give different hashes")
+	}
+	if hashed := a.IP(first); hashed != first {
+		t.Errorf("hashed values should not be hashed again, got %q", hashed)
+	}
+
+	ua := a.UserAgent("Mozilla/5.0")
+	if !IsHashed(ua) {
+		t.Errorf("user agent not hashed: %q", ua)
+	}
+
+	now = now.Add(24 * time.Hour)
+	if next := a.IP("198.51.100.7"); next == first {
+		t.Error("hash should change after the salt rotation")
+	}
+}
+
+func TestUserAgentKeptWithoutHashing(t *testing.T) {
+	a, _ := New(Config{IPMode: ModeTruncate})
+	if got := a.UserAgent("Mozilla/5.0"); got != "Mozilla/5.0" {
+		t.Errorf("UserAgent = %q", got)
+	}
+}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/handlers"
+	"qr-menu/models"
+	"qr-menu/pkg/billing"
+)
+
+// fakeCanceler records the subscriptions it cancels and fails with err when set
+type fakeCanceler struct {
+	canceled []string
+	err      error
+}
+
+func (f *fakeCanceler) CancelSubscription(ctx context.Context, subscriptionID string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.canceled = append(f.canceled, subscriptionID)
+	return nil
+}
+
+// browser sends form requests to the router keeping the cookies like a browser
+type browser struct {
+	t       *testing.T
+	router  http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func (b *browser) do(method, path string, form url.Values) *httptest.ResponseRecorder {
+	b.t.Helper()
+	var body *strings.Reader
+	if form != nil {
+		if cookie := b.cookies["csrf_token"]; cookie != nil {
+			form.Set("csrf_token", cookie.Value)
+		}
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+	req := httptest.NewRequest(method, path, body)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, cookie := range b.cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	b.router.ServeHTTP(rec, req)
+	for _, cookie := range rec.Result().Cookies() {
+		b.cookies[cookie.Name] = cookie
+	}
+	return rec
+}
+
+// loginBrowser logs the user in through the login form and returns the browser with its
+// session and a CSRF token bound to it
+func loginBrowser(t *testing.T, router http.Handler, username string) *browser {
+	t.Helper()
+	b := &browser{t: t, router: router, cookies: map[string]*http.Cookie{}}
+	b.do("GET", "/login", nil)
+	if rec := b.do("POST", "/login", url.Values{"username": {username}, "password": {testPassword}}); rec.Code != http.StatusFound {
+		t.Fatalf("Login: expected 302, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := b.do("GET", "/account/delete", nil); rec.Code != http.StatusOK {
+		t.Fatalf("Delete page: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	return b
+}
+
+// TestAccountDeletionCancelsSubscriptions tests that closing an account cancels its Stripe
+// subscriptions at the provider first, and that the account stays open when that fails
+func TestAccountDeletionCancelsSubscriptions(t *testing.T) {
+	store := dbtest.New(t)
+	seedTokenUsers(t, store)
+	now := time.Now()
+	store.Insert(t, "billing_subscriptions",
+		&models.BillingSubscription{ID: "s1", RestaurantID: "r1", PlanID: "pro", Status: models.SubscriptionActive,
+			Provider: "stripe", ProviderSubscriptionID: "sub_r1", CreatedAt: now, UpdatedAt: now},
+		&models.BillingSubscription{ID: "s2", RestaurantID: "r2", PlanID: "pro", Status: models.SubscriptionActive,
+			Provider: "stripe", ProviderSubscriptionID: "sub_r2", CreatedAt: now, UpdatedAt: now},
+	)
+	router := SetupRouter(newTestServices(t))
+	t.Cleanup(func() { handlers.SetSubscriptionCanceler(nil) })
+	confirm := url.Values{"confirm": {"ELIMINA"}, "password": {testPassword}}
+
+	status := func(t *testing.T, id string) string {
+		t.Helper()
+		var subs []models.BillingSubscription
+		store.Find(t, "billing_subscriptions", bson.M{"id": id}, &subs)
+		if len(subs) != 1 {
+			t.Fatalf("Expected subscription %s, got %d", id, len(subs))
+		}
+		return subs[0].Status
+	}
+
+	for _, tt := range []struct {
+		name     string
+		canceler billing.Canceler
+	}{
+		{"provider error", &fakeCanceler{err: errors.New("stripe unavailable")}},
+		{"provider not configured", nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			handlers.SetSubscriptionCanceler(tt.canceler)
+			b := loginBrowser(t, router, "mario")
+			rec := b.do("POST", "/account/delete", confirm)
+			if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/account/delete?error=billing" {
+				t.Fatalf("Expected a redirect to the billing error, got %d %q", rec.Code, rec.Header().Get("Location"))
+			}
+			if n := store.Count(t, "users", bson.M{"_id": "u1", "is_active": true}); n != 1 {
+				t.Error("The account was closed with the subscription still active")
+			}
+			if got := status(t, "s1"); got != models.SubscriptionActive {
+				t.Errorf("Subscription status = %q, want %q", got, models.SubscriptionActive)
+			}
+		})
+	}
+
+	canceler := &fakeCanceler{}
+	handlers.SetSubscriptionCanceler(canceler)
+	b := loginBrowser(t, router, "mario")
+	rec := b.do("POST", "/account/delete", confirm)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(canceler.canceled) != 1 || canceler.canceled[0] != "sub_r1" {
+		t.Errorf("Canceled at the provider: %v, want [sub_r1]", canceler.canceled)
+	}
+	if got := status(t, "s1"); got != models.SubscriptionCanceled {
+		t.Errorf("Subscription status = %q, want %q", got, models.SubscriptionCanceled)
+	}
+	if got := status(t, "s2"); got != models.SubscriptionActive {
+		t.Errorf("Another owner's subscription status = %q, want %q", got, models.SubscriptionActive)
+	}
+	if n := store.Count(t, "users", bson.M{"_id": "u1", "is_active": false}); n != 1 {
+		t.Error("Expected the account to be closed")
+	}
+}
@@ -0,0 +1,399 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
+
+	"qr-menu/db"
+	"qr-menu/db/dbtest"
+	"qr-menu/handlers"
+	"qr-menu/models"
+)
+
+const (
+	testJWTSecret  = "api-tokens-test-secret-of-32-chars!"
+	testAdminToken = "api-tokens-test-admin-token"
+	testPassword   = "Password-123"
+)
+
+// newTokenServices returns test services with API tokens enabled and the admin token set
+func newTokenServices(t *testing.T) *Services {
+	t.Helper()
+	services := newTestServices(t)
+	services.Settings.Security.JWTSecret = testJWTSecret
+	services.Settings.Security.AdminToken = testAdminToken
+	configureAPITokens(t, services)
+	t.Cleanup(func() {
+		services.Settings.Security.JWTSecret = ""
+		configureAPITokens(t, services)
+	})
+	return services
+}
+
+// configureAPITokens loads the signing keys the way InitializeServices does at startup
+func configureAPITokens(t *testing.T, services *Services) {
+	t.Helper()
+	if err := handlers.ConfigureAPITokens(context.Background(), services.Settings.Security); err != nil {
+		t.Fatalf("ConfigureAPITokens failed: %v", err)
+	}
+}
+
+// seedTokenUsers stores the tenants of seedTenants with their users: u1 owns r1, u2 owns r2
+// and is a viewer of r1
+func seedTokenUsers(t *testing.T, store *dbtest.Store) {
+	t.Helper()
+	seedTenants(t, store)
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt failed: %v", err)
+	}
+	now := time.Now()
+	store.Insert(t, "users",
+		&models.User{ID: "u1", Username: "mario", Email: "mario@example.com", UsernameNormalized: "mario",
+			EmailNormalized: "mario@example.com", PasswordHash: string(hash), IsActive: true, CreatedAt: now},
+		&models.User{ID: "u2", Username: "luigi", Email: "luigi@example.com", UsernameNormalized: "luigi",
+			EmailNormalized: "luigi@example.com", PasswordHash: string(hash), IsActive: true, CreatedAt: now},
+	)
+	store.Insert(t, "restaurant_members", &models.RestaurantMember{
+		ID: "r1:u2", RestaurantID: "r1", UserID: "u2", Role: models.RoleViewer, CreatedAt: now,
+	})
+}
+
+// postJSON sends a POST request with a JSON body to the router
+func postJSON(router http.Handler, path string, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest("POST", path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// tokenResponse is the data of the token endpoints
+type tokenResponse struct {
+	Token            string `json:"token"`
+	ExpiresAt        string `json:"expires_at"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt string `json:"refresh_expires_at"`
+	RestaurantID     string `json:"restaurant_id"`
+	Kid              string `json:"kid"`
+}
+
+// decodeData decodes the data field of a successful response
+func decodeData(t *testing.T, rec *httptest.ResponseRecorder) tokenResponse {
+	t.Helper()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Data tokenResponse `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Invalid response: %v", err)
+	}
+	return resp.Data
+}
+
+// login requests an access token with the test password
+func login(t *testing.T, router http.Handler, username, restaurantID string) string {
+	t.Helper()
+	return loginTokens(t, router, username, restaurantID).Token
+}
+
+// loginTokens requests the token pair with the test password
+func loginTokens(t *testing.T, router http.Handler, username, restaurantID string) tokenResponse {
+	t.Helper()
+	rec := postJSON(router, "/api/v1/auth/token",
+		map[string]string{"username": username, "password": testPassword, "restaurant_id": restaurantID}, nil)
+	tokens := decodeData(t, rec)
+	if tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Fatalf("Expected a token pair, got %s", rec.Body.String())
+	}
+	return tokens
+}
+
+// bearer returns the Authorization header of a token
+func bearer(token string) map[string]string {
+	return map[string]string{"Authorization": "Bearer " + token}
+}
+
+// tokenKid returns the signing key ID in the header of a token
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("Invalid token: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// TestAPITokenAccess tests through the server router that an access token acts on the
+// restaurant it was issued for, with the role of the user on that restaurant
+func TestAPITokenAccess(t *testing.T) {
+	store := dbtest.New(t)
+	seedTokenUsers(t, store)
+	router := SetupRouter(newTokenServices(t))
+
+	owner := bearer(login(t, router, "mario", ""))
+	viewer := bearer(login(t, router, "luigi@example.com", "r1"))
+
+	rec := serve(router, "/api/menus", owner)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 with the token, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var list struct {
+		Data []models.Menu `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || len(list.Data) != 1 || list.Data[0].ID != "m1" {
+		t.Errorf("Expected only menu m1 of r1, got %s", rec.Body.String())
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		status  int
+	}{
+		{"own menu", "GET", "/api/menu/m1", owner, http.StatusOK},
+		{"other tenant's menu", "GET", "/api/menu/m2", owner, http.StatusNotFound},
+		{"write without CSRF token", "POST", "/api/v2/menus/m1/complete", owner, http.StatusOK},
+		{"viewer reads", "GET", "/api/menu/m1", viewer, http.StatusOK},
+		{"viewer writes", "DELETE", "/api/v2/menus/m1", viewer, http.StatusForbidden},
+		{"invalid token", "GET", "/api/menus", bearer("not-a-token"), http.StatusUnauthorized},
+		{"forged token", "GET", "/api/menus", bearer(forgeToken(t)), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := request(router, tt.method, tt.path, tt.headers)
+			if rec.Code != tt.status {
+				t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("token requests", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			body   map[string]string
+			status int
+		}{
+			{"wrong password", map[string]string{"username": "mario", "password": "wrong"}, http.StatusUnauthorized},
+			{"unknown user", map[string]string{"username": "nessuno", "password": testPassword}, http.StatusUnauthorized},
+			{"another tenant", map[string]string{"username": "mario", "password": testPassword, "restaurant_id": "r2"}, http.StatusForbidden},
+			{"restaurant required", map[string]string{"username": "luigi", "password": testPassword}, http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				rec := postJSON(router, "/api/v1/auth/token", tt.body, nil)
+				if rec.Code != tt.status {
+					t.Errorf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+				}
+			})
+		}
+	})
+
+	t.Run("deactivated user", func(t *testing.T) {
+		_, err := db.MongoInstance.DB.Collection("users").UpdateOne(context.Background(),
+			bson.M{"_id": "u2"}, bson.M{"$set": bson.M{"is_active": false}})
+		if err != nil {
+			t.Fatalf("Deactivating the user failed: %v", err)
+		}
+		if rec := serve(router, "/api/menus", viewer); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for a deactivated user, got %d", rec.Code)
+		}
+	})
+}
+
+// forgeToken signs a token with a key that the server never issued
+func forgeToken(t *testing.T) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":           "u1",
+		"restaurant_id": "r1",
+		"iss":           "qr-menu",
+		"exp":           time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "forged"
+	signed, err := token.SignedString([]byte("not-the-server-key"))
+	if err != nil {
+		t.Fatalf("Signing failed: %v", err)
+	}
+	return signed
+}
+
+// TestAPITokenRevocation tests that a token revoked by logout is rejected, also after the
+// keys are loaded again as on a restart, while the other tokens stay valid
+func TestAPITokenRevocation(t *testing.T) {
+	store := dbtest.New(t)
+	seedTokenUsers(t, store)
+	services := newTokenServices(t)
+	router := SetupRouter(services)
+
+	revoked := login(t, router, "mario", "")
+	kept := login(t, router, "mario", "")
+
+	if rec := postJSON(router, "/api/v1/auth/logout", nil, bearer(revoked)); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 on logout, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(router, "/api/menus", bearer(revoked)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 after logout, got %d", rec.Code)
+	}
+	if rec := postJSON(router, "/api/v1/auth/logout", nil, bearer(revoked)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 logging out a revoked token, got %d", rec.Code)
+	}
+	if n := store.Count(t, "revoked_tokens", bson.M{}); n != 1 {
+		t.Errorf("Expected 1 revoked token stored, got %d", n)
+	}
+
+	configureAPITokens(t, services)
+	router = SetupRouter(services)
+	if rec := serve(router, "/api/menus", bearer(revoked)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the revocation to survive a restart, got %d", rec.Code)
+	}
+	if rec := serve(router, "/api/menus", bearer(kept)); rec.Code != http.StatusOK {
+		t.Errorf("Expected the other token to stay valid after a restart, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestAPITokenKeyRotation tests the forced rotation of the signing keys: new tokens carry
+// the new kid, while those signed with the previous key stay valid until they expire
+func TestAPITokenKeyRotation(t *testing.T) {
+	store := dbtest.New(t)
+	seedTokenUsers(t, store)
+	router := SetupRouter(newTokenServices(t))
+
+	before := login(t, router, "mario", "")
+
+	if rec := postJSON(router, "/api/admin/jwt/rotate", nil, bearer(before)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 rotating with an access token, got %d", rec.Code)
+	}
+	rotated := decodeData(t, postJSON(router, "/api/admin/jwt/rotate", nil, bearer(testAdminToken)))
+	if rotated.Kid == "" || rotated.Kid == tokenKid(t, before) {
+		t.Fatalf("Expected a new kid, got %q (previous %q)", rotated.Kid, tokenKid(t, before))
+	}
+
+	after := login(t, router, "mario", "")
+	if got := tokenKid(t, after); got != rotated.Kid {
+		t.Errorf("Expected new tokens signed with %q, got %q", rotated.Kid, got)
+	}
+	for name, token := range map[string]string{"previous key": before, "new key": after} {
+		if rec := serve(router, "/api/menus", bearer(token)); rec.Code != http.StatusOK {
+			t.Errorf("Expected a token signed with the %s to be valid, got %d", name, rec.Code)
+		}
+	}
+	if n := store.Count(t, "jwt_keys", bson.M{}); n != 2 {
+		t.Errorf("Expected the current and the retired key stored, got %d", n)
+	}
+}
+
+// TestAPITokenRefresh tests the rotation of the refresh tokens: each refresh returns a new
+// pair and replaces the refresh token, and presenting a replaced one revokes the session
+func TestAPITokenRefresh(t *testing.T) {
+	store := dbtest.New(t)
+	seedTokenUsers(t, store)
+	router := SetupRouter(newTokenServices(t))
+	refresh := func(token string) *httptest.ResponseRecorder {
+		return postJSON(router, "/api/v1/auth/refresh", map[string]string{"refresh_token": token}, nil)
+	}
+
+	first := loginTokens(t, router, "mario", "")
+	expiresAt, err := time.Parse(time.RFC3339, first.ExpiresAt)
+	if err != nil || time.Until(expiresAt) > 15*time.Minute || time.Until(expiresAt) < 14*time.Minute {
+		t.Errorf("Expected an access token lasting 15 minutes, expires at %q", first.ExpiresAt)
+	}
+
+	second := decodeData(t, refresh(first.RefreshToken))
+	if second.RefreshToken == first.RefreshToken || second.Token == first.Token {
+		t.Fatal("Expected a new token pair on refresh")
+	}
+	if second.RestaurantID != "r1" {
+		t.Errorf("Expected the refreshed token for r1, got %q", second.RestaurantID)
+	}
+	if rec := serve(router, "/api/menus", bearer(second.Token)); rec.Code != http.StatusOK {
+		t.Errorf("Expected the refreshed access token to be valid, got %d", rec.Code)
+	}
+	third := decodeData(t, refresh(second.RefreshToken))
+
+	t.Run("reuse", func(t *testing.T) {
+		if rec := refresh(first.RefreshToken); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 reusing a replaced refresh token, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := refresh(third.RefreshToken); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the whole session revoked after a reuse, got %d", rec.Code)
+		}
+		if n := store.Count(t, "refresh_tokens", bson.M{"revoked_at": bson.M{"$exists": false}}); n != 0 {
+			t.Errorf("Expected every refresh token of the session revoked, %d still valid", n)
+		}
+	})
+
+	t.Run("other sessions", func(t *testing.T) {
+		other := loginTokens(t, router, "mario", "")
+		if rec := refresh(other.RefreshToken); rec.Code != http.StatusOK {
+			t.Errorf("Expected another session to be unaffected by the reuse, got %d", rec.Code)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if rec := refresh("unknown"); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for an unknown refresh token, got %d", rec.Code)
+		}
+		if rec := postJSON(router, "/api/v1/auth/refresh", map[string]string{}, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 without refresh token, got %d", rec.Code)
+		}
+	})
+
+	t.Run("logout", func(t *testing.T) {
+		session := loginTokens(t, router, "mario", "")
+		rec := postJSON(router, "/api/v1/auth/logout", map[string]string{"refresh_token": session.RefreshToken}, bearer(session.Token))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200 on logout, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := refresh(session.RefreshToken); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected the refresh token revoked by logout, got %d", rec.Code)
+		}
+	})
+
+	t.Run("removed from staff", func(t *testing.T) {
+		viewer := loginTokens(t, router, "luigi", "r1")
+		if _, err := db.MongoInstance.DB.Collection("restaurant_members").DeleteOne(context.Background(), bson.M{"_id": "r1:u2"}); err != nil {
+			t.Fatalf("Removing the member failed: %v", err)
+		}
+		if rec := refresh(viewer.RefreshToken); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403 refreshing a token of a former member, got %d", rec.Code)
+		}
+	})
+}
+
+// TestAPITokensDisabled tests that without security.jwt_secret the token endpoints answer
+// 503 and bearer tokens are not accepted
+func TestAPITokensDisabled(t *testing.T) {
+	store := dbtest.New(t)
+	seedTokenUsers(t, store)
+	router := SetupRouter(newTestServices(t))
+
+	rec := postJSON(router, "/api/v1/auth/token", map[string]string{"username": "mario", "password": testPassword}, nil)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(router, "/api/menus", bearer(forgeToken(t))); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a bearer token, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "token\":\"") {
+		t.Errorf("Expected no token issued, got %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/handlers"
+	"qr-menu/models"
+	"qr-menu/security"
+)
+
+// sendJSON sends a request with a JSON body and the CSRF token of the browser session
+func (b *browser) sendJSON(method, path string, body interface{}) *httptest.ResponseRecorder {
+	b.t.Helper()
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	for _, cookie := range b.cookies {
+		req.AddCookie(cookie)
+	}
+	if cookie := b.cookies["csrf_token"]; cookie != nil {
+		req.Header.Set("X-CSRF-Token", cookie.Value)
+	}
+	rec := httptest.NewRecorder()
+	b.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestAPIKeys tests through the router that the owner creates keys stored only as a hash,
+// that a key reaches only the scopes and the restaurant it was created for, that it has its
+// own per-minute limit in place of the one of the api group, and that revoking it is immediate
+func TestAPIKeys(t *testing.T) {
+	store := dbtest.New(t)
+	seedTokenUsers(t, store)
+	otherKey := seedAPIKey(t, store, "k2", "r2", models.PermMenusRead)
+	services := newTokenServices(t)
+	router := SetupRouter(services)
+	// A group limit stricter than the keys' own shows that keys are not counted against it
+	handlers.SetRateLimits(services.RateLimiter, map[string]security.RateLimitConfig{
+		"api": {RequestsPerSecond: 0.001, BurstSize: 2},
+	})
+	handlers.SetAPIKeyLimiter(services.RateLimiter)
+	t.Cleanup(func() {
+		handlers.SetRateLimits(nil, nil)
+		handlers.SetAPIKeyLimiter(nil)
+	})
+
+	owner := loginBrowser(t, router, "mario")
+	owner.do("POST", "/select-restaurant", url.Values{"restaurant_id": {"r1"}})
+
+	create := func(t *testing.T, body map[string]interface{}) (string, string) {
+		t.Helper()
+		rec := owner.sendJSON("POST", "/api/v1/apikeys", body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Create: expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Data struct {
+				APIKey models.APIKey `json:"api_key"`
+				Key    string        `json:"key"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || !strings.HasPrefix(resp.Data.Key, models.APIKeyPrefix) {
+			t.Fatalf("Expected the new key, got %s", rec.Body.String())
+		}
+		return resp.Data.APIKey.ID, resp.Data.Key
+	}
+	withKey := func(key string) map[string]string { return map[string]string{"X-API-Key": key} }
+
+	readID, readKey := create(t, map[string]interface{}{"name": "Cassa", "scopes": []string{models.PermMenusRead}})
+	limitedID, limitedKey := create(t, map[string]interface{}{"name": "Sito", "scopes": []string{models.PermMenusRead}, "rate_limit": 3})
+
+	t.Run("creation", func(t *testing.T) {
+		var keys []models.APIKey
+		store.Find(t, "api_keys", bson.M{"restaurant_id": "r1"}, &keys)
+		if len(keys) != 2 {
+			t.Fatalf("Expected 2 keys of r1, got %d", len(keys))
+		}
+		for _, key := range keys {
+			if key.Hash == "" || key.Hash == readKey || key.Hash == limitedKey || strings.Contains(readKey, key.Hash) {
+				t.Errorf("Key %s is not stored as a hash: %q", key.ID, key.Hash)
+			}
+			if key.CreatedBy != "u1" {
+				t.Errorf("Key %s created by %q, want u1", key.ID, key.CreatedBy)
+			}
+		}
+		for _, id := range []string{readID, limitedID} {
+			if n := store.Count(t, "api_keys", bson.M{"_id": id}); n != 1 {
+				t.Errorf("Key %s not stored", id)
+			}
+		}
+
+		rec := owner.do("GET", "/api/v1/apikeys", nil)
+		if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), readKey) || strings.Contains(rec.Body.String(), `"hash"`) {
+			t.Errorf("Expected the list without secrets, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		tests := []struct {
+			name string
+			body map[string]interface{}
+		}{
+			{"no scopes", map[string]interface{}{"name": "Cassa"}},
+			{"session-only scope", map[string]interface{}{"name": "Cassa", "scopes": []string{models.PermStaffManage}}},
+			{"limit over the maximum", map[string]interface{}{"name": "Cassa", "scopes": []string{models.PermMenusRead}, "rate_limit": models.MaxAPIKeyRateLimit + 1}},
+			{"no name", map[string]interface{}{"scopes": []string{models.PermMenusRead}}},
+		}
+		for _, tt := range tests {
+			if rec := owner.sendJSON("POST", "/api/v1/apikeys", tt.body); rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected 400, got %d: %s", tt.name, rec.Code, rec.Body.String())
+			}
+		}
+
+		viewer := loginBrowser(t, router, "luigi")
+		viewer.do("POST", "/select-restaurant", url.Values{"restaurant_id": {"r1"}})
+		if rec := viewer.sendJSON("POST", "/api/v1/apikeys", map[string]interface{}{"name": "Cassa", "scopes": []string{models.PermMenusRead}}); rec.Code != http.StatusForbidden {
+			t.Errorf("Viewer: expected 403, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("scoping", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			method  string
+			path    string
+			headers map[string]string
+			status  int
+		}{
+			{"granted scope", "GET", "/api/menu/m1", withKey(readKey), http.StatusOK},
+			{"missing scope", "POST", "/api/v2/menus/m1/complete", withKey(readKey), http.StatusForbidden},
+			{"session-only route", "GET", "/api/v1/apikeys", withKey(readKey), http.StatusFound},
+			{"other restaurant", "GET", "/api/menu/m1", withKey(otherKey), http.StatusNotFound},
+			{"unknown key", "GET", "/api/menu/m1", withKey(models.APIKeyPrefix + "unknown"), http.StatusUnauthorized},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				rec := request(router, tt.method, tt.path, tt.headers)
+				if rec.Code != tt.status {
+					t.Errorf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+				}
+			})
+		}
+	})
+
+	t.Run("limiting", func(t *testing.T) {
+		for i := 1; i <= 3; i++ {
+			rec := serve(router, "/api/menu/m1", withKey(limitedKey))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Request %d: expected 200, got %d: %s", i, rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get("X-RateLimit-Limit"); got != "3" {
+				t.Errorf("X-RateLimit-Limit = %q, want 3", got)
+			}
+		}
+		rec := serve(router, "/api/menu/m1", withKey(limitedKey))
+		if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Errorf("Expected 429 with Retry-After over the key limit, got %d", rec.Code)
+		}
+		if rec := serve(router, "/api/menu/m1", withKey(readKey)); rec.Code != http.StatusOK {
+			t.Errorf("Another key: expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("revocation", func(t *testing.T) {
+		if rec := owner.sendJSON("DELETE", "/api/v1/apikeys/k2", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("Other restaurant's key: expected 404, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := owner.sendJSON("DELETE", "/api/v1/apikeys/"+readID, nil); rec.Code != http.StatusNoContent {
+			t.Fatalf("Revoke: expected 204, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := serve(router, "/api/menu/m1", withKey(readKey)); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Revoked key: expected 401, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec := serve(router, "/api/menu/m2", withKey(otherKey)); rec.Code != http.StatusOK {
+			t.Errorf("Other restaurant's key: expected 200 after the revocation, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/models"
+)
+
+// TestRouterConcurrentRequests sends requests of two tenants from many clients at once
+// through the server router, so that the shared state of the middleware and handlers
+// (rate limit windows, API key quotas, usage counters, response cache, session store) is
+// exercised concurrently. Run with -race to detect unsynchronized access
+func TestRouterConcurrentRequests(t *testing.T) {
+	store := dbtest.New(t)
+	seedTenants(t, store)
+	keys := map[string]string{
+		"r1": seedAPIKey(t, store, "k1", "r1", models.PermMenusRead, models.PermAnalyticsRead),
+		"r2": seedAPIKey(t, store, "k2", "r2", models.PermMenusRead, models.PermAnalyticsRead),
+	}
+	ownMenu := map[string]string{"r1": "m1", "r2": "m2"}
+	otherMenu := map[string]string{"r1": "m2", "r2": "m1"}
+	router := SetupRouter(newTestServices(t))
+
+	const clients, rounds = 16, 10
+	var wg sync.WaitGroup
+	for c := 0; c < clients; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			tenant := "r1"
+			if c%2 == 1 {
+				tenant = "r2"
+			}
+			remoteAddr := fmt.Sprintf("198.51.100.%d:4000", c+1)
+			send := func(method, path string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(method, path, nil)
+				req.RemoteAddr = remoteAddr
+				req.Header.Set("X-API-Key", keys[tenant])
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				return rec
+			}
+
+			for i := 0; i < rounds; i++ {
+				rec := send("GET", "/api/menus")
+				var list struct {
+					Data []models.Menu `json:"data"`
+				}
+				if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &list) != nil {
+					t.Errorf("client %d: GET /api/menus returned %d: %s", c, rec.Code, rec.Body.String())
+					return
+				}
+				if len(list.Data) != 1 || list.Data[0].ID != ownMenu[tenant] {
+					t.Errorf("client %d: expected only menu %s, got %+v", c, ownMenu[tenant], list.Data)
+				}
+
+				if rec := send("GET", "/api/menu/"+otherMenu[tenant]); rec.Code != http.StatusNotFound {
+					t.Errorf("client %d: expected 404 for another tenant's menu, got %d", c, rec.Code)
+				}
+				if rec := send("GET", "/api/analytics?days=7"); rec.Code != http.StatusOK {
+					t.Errorf("client %d: GET /api/analytics returned %d", c, rec.Code)
+				}
+
+				// Anonymous page: creates the session store and issues a CSRF cookie
+				req := httptest.NewRequest("GET", "/login", nil)
+				req.RemoteAddr = remoteAddr
+				login := httptest.NewRecorder()
+				router.ServeHTTP(login, req)
+				if login.Code >= http.StatusInternalServerError {
+					t.Errorf("client %d: GET /login returned %d", c, login.Code)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+}
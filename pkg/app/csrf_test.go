@@ -0,0 +1,125 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/handlers"
+	"qr-menu/models"
+)
+
+// TestCSRFMiddleware tests through the router that writes with the session cookie need the
+// CSRF token of that session, while exempt routes, integrations and reads go through
+func TestCSRFMiddleware(t *testing.T) {
+	store := dbtest.New(t)
+	seedTokenUsers(t, store)
+	key := seedAPIKey(t, store, "k1", "r1", models.PermMenusWrite)
+	router := SetupRouter(newTokenServices(t))
+
+	mario := loginBrowser(t, router, "mario")
+	luigi := loginBrowser(t, router, "luigi")
+	anonymous := &browser{t: t, router: router, cookies: map[string]*http.Cookie{}}
+	anonymous.do("GET", "/login", nil)
+	token := mario.cookies["csrf_token"].Value
+	accessToken := loginTokens(t, router, "mario", "").Token
+
+	// send sends the request with the session of b, the CSRF cookie and the submitted token
+	send := func(method, path string, b *browser, cookie, submitted string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for name, c := range b.cookies {
+			if name != "csrf_token" {
+				req.AddCookie(c)
+			}
+		}
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "csrf_token", Value: cookie})
+		}
+		if submitted != "" {
+			req.Header.Set("X-CSRF-Token", submitted)
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	const write = "/api/v2/menus/m1/complete"
+	tests := []struct {
+		name      string
+		method    string
+		browser   *browser
+		cookie    string
+		submitted string
+		headers   map[string]string
+		status    int
+	}{
+		{"valid token", "POST", mario, token, token, nil, http.StatusOK},
+		{"missing token", "POST", mario, token, "", nil, http.StatusForbidden},
+		{"missing cookie", "POST", mario, "", token, nil, http.StatusForbidden},
+		{"mismatched token", "POST", mario, token, luigi.cookies["csrf_token"].Value, nil, http.StatusForbidden},
+		{"token of another session", "POST", luigi, token, token, nil, http.StatusForbidden},
+		{"anonymous token", "POST", mario, anonymous.cookies["csrf_token"].Value, anonymous.cookies["csrf_token"].Value, nil, http.StatusForbidden},
+		{"forged token", "POST", mario, "nonce.c2ln", "nonce.c2ln", nil, http.StatusForbidden},
+		{"API key", "POST", mario, "", "", map[string]string{"X-API-Key": key}, http.StatusOK},
+		{"bearer token", "POST", mario, "", "", bearer(accessToken), http.StatusOK},
+		{"read", "GET", mario, "", "", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := write
+			if tt.method == "GET" {
+				path = "/api/menu/m1"
+			}
+			rec := send(tt.method, path, tt.browser, tt.cookie, tt.submitted, tt.headers)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if rejected := strings.Contains(rec.Body.String(), "CSRF"); rejected != (tt.status == http.StatusForbidden) {
+				t.Errorf("Rejected for CSRF = %v: %s", rejected, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("exempt routes", func(t *testing.T) {
+		for _, path := range []string{
+			"/api/track/share",
+			"/api/v1/public/menus/m1/feedback",
+			"/api/v1/auth/logout",
+			"/api/admin/analytics/compact",
+			"/api/v1/billing/webhook",
+			"/auth/oauth/google/callback",
+		} {
+			rec := send("POST", path, mario, "", "", nil)
+			if strings.Contains(rec.Body.String(), "CSRF") {
+				t.Errorf("%s: rejected for CSRF with %d", path, rec.Code)
+			}
+		}
+	})
+
+	t.Run("integrations drop the session cookie", func(t *testing.T) {
+		for name, headers := range map[string]map[string]string{
+			"API key":      {"X-API-Key": key},
+			"bearer token": bearer(accessToken),
+		} {
+			var cookie string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { cookie = r.Header.Get("Cookie") })
+			req := httptest.NewRequest("POST", write, nil)
+			for _, c := range mario.cookies {
+				req.AddCookie(c)
+			}
+			for header, value := range headers {
+				req.Header.Set(header, value)
+			}
+			rec := httptest.NewRecorder()
+			handlers.CSRFMiddleware(next).ServeHTTP(rec, req)
+			if rec.Code != http.StatusOK || cookie != "" {
+				t.Errorf("%s: expected 200 without cookies, got %d with %q", name, rec.Code, cookie)
+			}
+		}
+	})
+}
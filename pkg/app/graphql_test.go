@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/models"
+)
+
+// graphQLResponse is the body of a GraphQL response
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string        `json:"message"`
+		Path    []interface{} `json:"path"`
+	} `json:"errors"`
+}
+
+// TestGraphQL tests through the router that a query reads the menus and orders of the key's
+// restaurant, that the analytics and orders fields need their permission without failing the
+// rest of the query, and that invalid queries are rejected without data
+func TestGraphQL(t *testing.T) {
+	store := dbtest.New(t)
+	seedTenants(t, store)
+	menusKey := seedAPIKey(t, store, "k1", "r1", models.PermMenusRead)
+	analyticsKey := seedAPIKey(t, store, "k2", "r1", models.PermMenusRead, models.PermAnalyticsRead)
+	ordersKey := seedAPIKey(t, store, "k3", "r1", models.PermMenusRead, models.PermOrdersManage)
+	now := time.Now()
+	store.Insert(t, "orders",
+		&models.Order{ID: "o1", RestaurantID: "r1", MenuID: "m1", Number: 1, Table: "4", Status: models.OrderStatusCompleted, Total: 24,
+			Lines:     []models.OrderLine{{ID: "l1", ItemID: "i1", Name: "Carbonara", Quantity: 2, Price: 12, Status: models.OrderLineReady}},
+			CreatedAt: now.Add(-time.Hour)},
+		&models.Order{ID: "o2", RestaurantID: "r1", MenuID: "m1", Number: 2, Table: "7", Status: models.OrderStatusNew, Total: 12, CreatedAt: now},
+		&models.Order{ID: "o3", RestaurantID: "r2", MenuID: "m2", Number: 1, Status: models.OrderStatusNew, Total: 20, CreatedAt: now},
+	)
+	router := SetupRouter(newTestServices(t))
+
+	query := func(t *testing.T, key, query string, variables map[string]interface{}) (int, graphQLResponse) {
+		t.Helper()
+		rec := postJSON(router, "/api/graphql", map[string]interface{}{"query": query, "variables": variables},
+			map[string]string{"X-API-Key": key})
+		var resp graphQLResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Invalid response %d: %s", rec.Code, rec.Body.String())
+		}
+		return rec.Code, resp
+	}
+
+	t.Run("menus", func(t *testing.T) {
+		code, resp := query(t, menusKey, `query($id: ID!) {
+			restaurant { name }
+			menu(id: $id) { ...menu }
+			other: menu(id: "m2") { id }
+		}
+		fragment menu on Menu { name categories { name items { name price tags } } }`, map[string]interface{}{"id": "m1"})
+		want := `{"restaurant":{"name":"Trattoria"},"menu":{"name":"Pranzo","categories":[{"name":"Primi","items":[{"name":"Carbonara","price":12,"tags":[]}]}]},"other":null}`
+		if code != http.StatusOK || len(resp.Errors) > 0 || string(resp.Data) != want {
+			t.Errorf("Expected the menu of r1 only, got %d: %s %v", code, resp.Data, resp.Errors)
+		}
+	})
+
+	t.Run("permissions", func(t *testing.T) {
+		const q = `{ menus { id analytics(days: 30) { views } } }`
+		code, resp := query(t, menusKey, q, nil)
+		if code != http.StatusOK || string(resp.Data) != `{"menus":[{"id":"m1","analytics":null}]}` {
+			t.Errorf("Expected null analytics, got %d: %s", code, resp.Data)
+		}
+		if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, models.PermAnalyticsRead) {
+			t.Errorf("Expected a permission error, got %v", resp.Errors)
+		}
+
+		code, resp = query(t, analyticsKey, q, nil)
+		if code != http.StatusOK || len(resp.Errors) > 0 || string(resp.Data) != `{"menus":[{"id":"m1","analytics":{"views":0}}]}` {
+			t.Errorf("Expected the analytics, got %d: %s %v", code, resp.Data, resp.Errors)
+		}
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		code, resp := query(t, ordersKey, `{
+			orders { id number }
+			completed: orders(status: ["completed"]) { table total lines { name quantity price status } }
+			order(id: "o3") { id }
+		}`, nil)
+		want := `{"orders":[{"id":"o2","number":2},{"id":"o1","number":1}],"completed":[{"table":"4","total":24,"lines":[{"name":"Carbonara","quantity":2,"price":12,"status":"ready"}]}],"order":null}`
+		if code != http.StatusOK || len(resp.Errors) > 0 || string(resp.Data) != want {
+			t.Errorf("Expected the orders of r1 only, got %d: %s %v", code, resp.Data, resp.Errors)
+		}
+
+		code, resp = query(t, menusKey, `{ restaurant { name orders { id } } order(id: "o1") { id } }`, nil)
+		if code != http.StatusOK || string(resp.Data) != `{"restaurant":{"name":"Trattoria","orders":null},"order":null}` {
+			t.Errorf("Expected null orders, got %d: %s", code, resp.Data)
+		}
+		if len(resp.Errors) != 2 || !strings.Contains(resp.Errors[0].Message, models.PermOrdersManage) {
+			t.Errorf("Expected permission errors, got %v", resp.Errors)
+		}
+
+		if _, resp := query(t, ordersKey, `{ orders(limit: 500) { id } }`, nil); len(resp.Errors) != 1 {
+			t.Errorf("Expected a limit error, got %v", resp.Errors)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, q := range []string{
+			`{ menus { id `,
+			`{ menus { price } }`,
+			`{ menu { id } }`,
+			`mutation { menus { id } }`,
+		} {
+			if code, resp := query(t, menusKey, q, nil); code != http.StatusBadRequest || resp.Data != nil || len(resp.Errors) == 0 {
+				t.Errorf("%s: expected 400 without data, got %d: %s", q, code, resp.Data)
+			}
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+
+	"qr-menu/handlers"
+	"qr-menu/logger"
+	"qr-menu/pkg/config"
+)
+
+// GRPCServer è il listener gRPC per casse POS e totem
+type GRPCServer struct {
+	Addr   string
+	server *grpc.Server
+}
+
+// NewGRPCServer crea il server gRPC per casse POS e totem, o nil se grpc.enabled è false.
+// Con grpc.cert_file il listener termina TLS (mTLS se grpc.client_ca_file è impostato),
+// altrimenti accetta HTTP/2 in chiaro
+func NewGRPCServer(settings *config.Config) (*GRPCServer, error) {
+	cfg := settings.GRPC
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(cfg.MaxMessageSize),
+		grpc.MaxSendMsgSize(cfg.MaxMessageSize),
+	}
+	if settings.Server.IdleTimeout > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{MaxConnectionIdle: settings.Server.IdleTimeout}))
+	}
+	if cfg.CertFile != "" {
+		tlsConfig, err := grpcTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	server := &GRPCServer{
+		Addr:   ":" + strconv.Itoa(cfg.Port),
+		server: grpc.NewServer(opts...),
+	}
+	handlers.RegisterGRPCServices(server.server)
+	if cfg.Reflection {
+		reflection.Register(server.server)
+	}
+
+	if cfg.CertFile == "" {
+		logger.Info("Server gRPC configurato senza TLS (h2c)", map[string]interface{}{"addr": server.Addr})
+	} else {
+		logger.Info("Server gRPC configurato con TLS", map[string]interface{}{
+			"addr": server.Addr,
+			"mtls": cfg.ClientCAFile != "",
+		})
+	}
+	return server, nil
+}
+
+// grpcTLSConfig carica il certificato del listener e, con grpc.client_ca_file, la CA che
+// deve firmare i certificati dei client
+func grpcTLSConfig(cfg config.GRPCConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("errore caricamento certificato gRPC: %v", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("errore lettura CA dei client gRPC: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("nessun certificato valido in %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// ListenAndServe ascolta su Addr e serve le chiamate fino a Shutdown
+func (s *GRPCServer) ListenAndServe() error {
+	lis, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(lis)
+}
+
+// Serve serve le chiamate sul listener fino a Shutdown
+func (s *GRPCServer) Serve(lis net.Listener) error {
+	return s.server.Serve(lis)
+}
+
+// Shutdown smette di accettare connessioni e attende le chiamate in corso; allo scadere di
+// ctx chiude le connessioni rimaste
+func (s *GRPCServer) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
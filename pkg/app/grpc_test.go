@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/models"
+	qrmenuv1 "qr-menu/proto/qrmenu/v1"
+)
+
+// dialGRPC starts the gRPC server of the settings on an in-memory listener and returns a
+// connection to it
+func dialGRPC(t *testing.T, services *Services) *grpc.ClientConn {
+	t.Helper()
+	services.Settings.GRPC.Enabled = true
+	services.Settings.GRPC.Reflection = true
+	server, err := NewGRPCServer(services.Settings)
+	if err != nil {
+		t.Fatalf("NewGRPCServer failed: %v", err)
+	}
+	lis := bufconn.Listen(1 << 20)
+	go server.Serve(lis)
+	t.Cleanup(func() { server.Shutdown(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// TestGRPCServices tests MenuService and OrderService through a client generated from
+// qrmenu.proto: the API key in the metadata reaches only its scopes and its restaurant
+func TestGRPCServices(t *testing.T) {
+	store := dbtest.New(t)
+	seedTenants(t, store)
+	readKey := seedAPIKey(t, store, "k1", "r1", models.PermMenusRead)
+	ordersKey := seedAPIKey(t, store, "k2", "r1", models.PermOrdersManage)
+	conn := dialGRPC(t, newTestServices(t))
+	menus := qrmenuv1.NewMenuServiceClient(conn)
+	orders := qrmenuv1.NewOrderServiceClient(conn)
+
+	withKey := func(key string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+key)
+	}
+
+	t.Run("menus", func(t *testing.T) {
+		resp, err := menus.ListMenus(withKey(readKey), &qrmenuv1.ListMenusRequest{})
+		if err != nil {
+			t.Fatalf("ListMenus failed: %v", err)
+		}
+		if len(resp.Menus) != 1 || resp.Menus[0].Id != "m1" || resp.ServerTime == 0 {
+			t.Fatalf("Expected only m1 with the server time, got %v", resp)
+		}
+		if items := resp.Menus[0].Categories[0].Items; len(items) != 1 || items[0].Name != "Carbonara" || items[0].Price != 12 {
+			t.Errorf("Unexpected items: %v", items)
+		}
+
+		menu, err := menus.GetMenu(withKey(readKey), &qrmenuv1.GetMenuRequest{Id: "m1"})
+		if err != nil || menu.RestaurantId != "r1" {
+			t.Errorf("GetMenu: got %v, %v", menu, err)
+		}
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		store.Insert(t, "menus", &models.Menu{ID: "m3", RestaurantID: "r1", Name: "Cena", IsActive: true,
+			Categories: []models.MenuCategory{{ID: "c3", Name: "Pizze", Items: []models.MenuItem{{ID: "i3", Name: "Margherita", Price: 8, Available: true}}}}})
+		order, err := orders.CreateOrder(withKey(ordersKey), &qrmenuv1.CreateOrderRequest{
+			MenuId: "m3",
+			Table:  "5",
+			Lines:  []*qrmenuv1.OrderLine{{ItemId: "i3", Quantity: 2}},
+		})
+		if err != nil {
+			t.Fatalf("CreateOrder failed: %v", err)
+		}
+		if order.Total != 16 || order.Table != "5" || len(order.Lines) != 1 {
+			t.Errorf("Unexpected order: %v", order)
+		}
+		got, err := orders.GetOrder(withKey(ordersKey), &qrmenuv1.GetOrderRequest{Id: order.Id})
+		if err != nil || got.Id != order.Id {
+			t.Errorf("GetOrder: got %v, %v", got, err)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name string
+			call func() error
+			code codes.Code
+		}{
+			{"missing key", func() error {
+				_, err := menus.ListMenus(context.Background(), &qrmenuv1.ListMenusRequest{})
+				return err
+			}, codes.Unauthenticated},
+			{"unknown key", func() error {
+				_, err := menus.ListMenus(withKey(models.APIKeyPrefix+"unknown"), &qrmenuv1.ListMenusRequest{})
+				return err
+			}, codes.Unauthenticated},
+			{"missing scope", func() error {
+				_, err := orders.CreateOrder(withKey(readKey), &qrmenuv1.CreateOrderRequest{MenuId: "m1"})
+				return err
+			}, codes.PermissionDenied},
+			{"other restaurant", func() error {
+				_, err := menus.GetMenu(withKey(readKey), &qrmenuv1.GetMenuRequest{Id: "m2"})
+				return err
+			}, codes.NotFound},
+			{"missing id", func() error {
+				_, err := menus.GetMenu(withKey(readKey), &qrmenuv1.GetMenuRequest{})
+				return err
+			}, codes.InvalidArgument},
+			{"unknown item", func() error {
+				_, err := orders.CreateOrder(withKey(ordersKey), &qrmenuv1.CreateOrderRequest{
+					MenuId: "m3",
+					Lines:  []*qrmenuv1.OrderLine{{ItemId: "i2", Quantity: 1}},
+				})
+				return err
+			}, codes.InvalidArgument},
+		}
+		for _, tt := range tests {
+			if code := status.Code(tt.call()); code != tt.code {
+				t.Errorf("%s: expected %s, got %s", tt.name, tt.code, code)
+			}
+		}
+	})
+
+	t.Run("reflection", func(t *testing.T) {
+		stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+		if err != nil {
+			t.Fatalf("Reflection failed: %v", err)
+		}
+		stream.Send(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: "qrmenu.v1.OrderService"},
+		})
+		resp, err := stream.Recv()
+		if err != nil || len(resp.GetFileDescriptorResponse().GetFileDescriptorProto()) == 0 {
+			t.Errorf("Expected the descriptor of qrmenu.proto, got %v, %v", resp, err)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"qr-menu/db"
+	"qr-menu/handlers"
+	"qr-menu/logger"
+	"qr-menu/pkg/health"
+	"qr-menu/pkg/mailer"
+)
+
+// healthProbeKey è il file scritto e cancellato per verificare che lo storage accetti scritture
+const healthProbeKey = ".health-probe"
+
+// initHealthChecks registra i controlli di /api/v1/health e /ready. Database e storage delle
+// immagini sono critici: senza di loro i menu non si possono servire né modificare. Cache
+// Redis, archivio dei backup, coda email e spazio su disco rendono il servizio degraded
+func (s *Services) initHealthChecks() {
+	settings := s.Settings.Health
+	checker := health.NewChecker(settings.CheckTimeout, settings.CacheFor)
+
+	checker.Add(health.Check{Name: "database", Critical: true, Run: func(ctx context.Context) error {
+		if db.MongoInstance == nil {
+			return errors.New("MongoDB non connesso")
+		}
+		return db.MongoInstance.Ping(ctx)
+	}})
+	checker.Add(health.Check{Name: "storage", Critical: true, Run: health.BlobWritable(s.Assets, healthProbeKey)})
+	checker.Add(health.Check{Name: "backup_storage", Run: health.BlobWritable(s.Backups, healthProbeKey)})
+
+	if len(s.cacheStores) > 0 {
+		checker.Add(health.Check{Name: "cache", Run: func(context.Context) error {
+			for _, store := range s.cacheStores {
+				if err := store.Ping(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}})
+	}
+	if queue, ok := s.Mail.(*mailer.Queue); ok {
+		checker.Add(health.Check{Name: "notifications", Run: health.QueueBelow(queue.Usage, settings.QueueThreshold)})
+	}
+	if settings.MinFreeDiskMB > 0 {
+		// Su piattaforme senza statfs il controllo fallirebbe sempre (storage_dir può non
+		// esistere ancora, quindi il supporto si verifica sulla directory corrente)
+		if _, err := health.FreeDiskSpace("."); err == nil {
+			checker.Add(health.Check{Name: "disk", Run: health.MinFreeDisk(s.Settings.Paths.StorageDir, uint64(settings.MinFreeDiskMB)<<20)})
+		} else {
+			logger.Warn("Controllo dello spazio su disco disattivato", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	handlers.SetHealthChecker(checker)
+}
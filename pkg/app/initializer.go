@@ -1,17 +1,51 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
 	"qr-menu/analytics"
+	"qr-menu/backup"
 	"qr-menu/db"
+	"qr-menu/handlers"
 	"qr-menu/logger"
+	"qr-menu/middleware"
+	"qr-menu/pkg/ai"
+	"qr-menu/pkg/anonymize"
+	"qr-menu/pkg/avscan"
+	"qr-menu/pkg/billing"
+	"qr-menu/pkg/bots"
+	"qr-menu/pkg/cache"
+	"qr-menu/pkg/config"
+	"qr-menu/pkg/events"
+	"qr-menu/pkg/geoip"
+	"qr-menu/pkg/i18n"
+	"qr-menu/pkg/mailer"
+	"qr-menu/pkg/oauth"
+	"qr-menu/pkg/ocr"
+	"qr-menu/pkg/push"
+	"qr-menu/pkg/sms"
+	"qr-menu/pkg/storage"
+	"qr-menu/pkg/wallet"
+	"qr-menu/pkg/whatsapp"
 	"qr-menu/security"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Services contiene i servizi core inizializzati
 type Services struct {
-	Analytics  *analytics.Analytics
-	Database   *db.DatabaseManager
+	Analytics *analytics.Analytics
+	Database  *db.DatabaseManager
+
+	// Configurazione effettiva (default + config.yaml + variabili d'ambiente)
+	Settings *config.Config
+
+	// Blob storage (immagini/QR code e archivi di backup)
+	Assets  storage.BlobStore
+	Backups storage.BlobStore
 
 	// Security services
 	RateLimiter     *security.RateLimiter
@@ -19,6 +53,25 @@ type Services struct {
 	GDPRManager     *security.GDPRManager
 	SecurityHeaders *security.SecurityHeadersMiddleware
 	CORSMiddleware  *security.CORSMiddleware
+
+	// Policy Cache-Control per route (CDN)
+	CachePolicies middleware.CachePolicies
+
+	// Risposte delle API e risultati delle query (nil con la cache disattivata)
+	ResponseCache *cache.ResponseCache
+	QueryCache    *cache.QueryResultCache
+	// Pagine renderizzate dei menu pubblici (nil con la cache disattivata)
+	MenuCache *cache.ResponseCache
+	// Connessioni Redis della cache, da chiudere allo shutdown
+	cacheStores []*cache.RedisCache
+
+	// Email transazionali; se è la coda va chiusa allo shutdown per consegnare i messaggi pendenti
+	Mail mailer.Mailer
+
+	// Job in background (es. cancellazioni account programmate): stopWorkers li
+	// ferma, workers permette di attenderne la terminazione
+	stopWorkers context.CancelFunc
+	workers     sync.WaitGroup
 }
 
 // Config contiene la configurazione per l'inizializzazione
@@ -26,6 +79,9 @@ type Config struct {
 	LogLevel    logger.LogLevel
 	LogDir      string
 	DatabaseURL string
+	Assets      storage.Config
+	Backups     storage.Config
+	Settings    *config.Config
 }
 
 // DefaultConfig ritorna la configurazione di default
@@ -33,6 +89,9 @@ func DefaultConfig() Config {
 	return Config{
 		LogLevel: logger.INFO,
 		LogDir:   "logs",
+		Assets:   storage.ConfigFromEnv("static"),
+		Backups:  storage.ConfigFromEnv("backups"),
+		Settings: config.Load(),
 	}
 }
 
@@ -51,32 +110,672 @@ func InitializeServices(cfg Config) (*Services, error) {
 
 	// 2. Analytics
 	services.Analytics = analytics.GetAnalytics()
+	services.Analytics.SetEventSink(handlers.StoreAnalyticsEvent)
 
 	// 3. Security Services
+	services.Settings = cfg.Settings
+	if services.Settings == nil {
+		services.Settings = config.Load()
+	}
 	services.RateLimiter = security.NewRateLimiter()
+	services.RateLimiter.SetDefaultLimit(security.RateLimitConfig{
+		RequestsPerSecond: float64(services.Settings.Security.RateLimitPerSecond),
+		BurstSize:         services.Settings.Security.RateLimitBurst,
+	})
+	if services.Settings.Security.RateLimitBackend == "redis" {
+		store, err := security.NewRedisRateLimitStore(services.Settings.Security.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize rate limit store: %w", err)
+		}
+		services.RateLimiter.SetStore(store)
+	}
+	rateLimitGroups := make(map[string]security.RateLimitConfig)
+	for name, group := range services.Settings.Security.RateLimitGroups {
+		rateLimitGroups[name] = security.RateLimitConfig{
+			RequestsPerSecond: float64(group.RequestsPerMinute) / 60,
+			BurstSize:         group.Burst,
+		}
+	}
+	handlers.SetRateLimits(services.RateLimiter, rateLimitGroups)
+	handlers.SetAPIKeyLimiter(services.RateLimiter)
+	// Chiavi di firma degli access token dell'API (salvate su MongoDB, condivise tra le istanze)
+	if err := handlers.ConfigureAPITokens(context.Background(), services.Settings.Security); err != nil {
+		return nil, fmt.Errorf("failed to initialize API token keys: %w", err)
+	}
 	services.AuditLogger = security.NewAuditLogger(10000)
 	services.GDPRManager = security.NewGDPRManager(services.AuditLogger)
 	services.SecurityHeaders = security.NewSecurityHeadersMiddleware(security.DefaultSecurityHeadersConfig())
 	services.CORSMiddleware = security.NewCORSMiddleware(security.DefaultCORSConfig())
+	services.CachePolicies = middleware.LoadCachePolicies()
+
+	// Localizzazione di email, notifiche e payload dei webhook
+	i18n.SetDefault(i18n.NewManager(services.Settings.Localization))
+
+	// Email transazionali (SMTP, SendGrid o Mailgun dietro la coda con retry)
+	mail, err := newMailer(services.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize mailer: %w", err)
+	}
+	services.Mail = mail
+	handlers.SetMailer(mail)
+
+	// Notifiche push FCM (solo se è configurato il service account)
+	if services.Settings.Notifications.Enabled && services.Settings.Notifications.FCMCredentialsURL != "" {
+		account, err := push.LoadServiceAccount(context.Background(), services.Settings.Notifications.FCMCredentialsURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load FCM credentials: %w", err)
+		}
+		fcm, err := push.NewFCM(account, "", 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize FCM: %w", err)
+		}
+		handlers.SetPushSender(fcm)
+		logger.Info("Notifiche push FCM attive", map[string]interface{}{
+			"project_id": account.ProjectID,
+		})
+	}
+	if services.Settings.Notifications.Enabled && services.Settings.Notifications.VAPIDPrivateKey != "" {
+		webPush, err := push.NewWebPush(push.VAPIDKeys{
+			PublicKey:  services.Settings.Notifications.VAPIDPublicKey,
+			PrivateKey: services.Settings.Notifications.VAPIDPrivateKey,
+		}, services.Settings.Notifications.VAPIDSubject, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize Web Push: %w", err)
+		}
+		handlers.SetWebPushSender(webPush)
+	}
+
+	// SMS ai proprietari e ai clienti degli ordini in anticipo (Twilio o Vonage)
+	if services.Settings.Notifications.Enabled && services.Settings.SMS.Provider != "" {
+		provider, err := newSMSProvider(services.Settings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize SMS provider: %w", err)
+		}
+		handlers.SetSMSSender(provider)
+	}
+
+	// Accesso con Google e Apple
+	providers, err := newOAuthProviders(services.Settings.OAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize social login: %w", err)
+	}
+	handlers.SetOAuthProviders(providers...)
+
+	// Billing a consumo: senza chiave Stripe l'utilizzo viene solo misurato
+	var usageReporter billing.Reporter
+	if services.Settings.Billing.StripeSecretKey != "" {
+		usageReporter = billing.NewStripeReporter(services.Settings.Billing.StripeSecretKey, services.Settings.Billing.MeterEventName)
+		logger.Info("Invio dell'utilizzo a Stripe attivo", map[string]interface{}{
+			"meter_event": services.Settings.Billing.MeterEventName,
+		})
+	}
+	handlers.SetBilling(services.Settings.Billing, usageReporter)
+	// Disdetta degli abbonamenti alla cancellazione dell'account
+	if services.Settings.Billing.StripeSecretKey != "" {
+		handlers.SetSubscriptionCanceler(billing.NewStripeSubscriptions(services.Settings.Billing.StripeSecretKey))
+	}
+	// Pagamenti online dei clienti (buoni regalo): servono anche le notifiche firmate del webhook
+	if services.Settings.Billing.StripeSecretKey != "" && services.Settings.Billing.StripeWebhookSecret != "" {
+		handlers.SetPaymentCheckout(billing.NewStripeCheckout(services.Settings.Billing.StripeSecretKey, services.Settings.Billing.StripeWebhookSecret))
+	}
+	// Pagamenti online degli ordini con il provider di ogni ristorante, le cui credenziali sono
+	// cifrate con jwt_secret
+	handlers.SetPaymentCredentialsKey(services.Settings.Security.JWTSecret)
+	// Numeri WhatsApp Business dei ristoranti, i cui token sono cifrati come le credenziali di
+	// pagamento
+	if wa := services.Settings.WhatsApp; wa.AppSecret != "" {
+		handlers.SetWhatsApp(whatsapp.New(whatsapp.Config{APIBase: wa.APIBase, Timeout: wa.Timeout}), wa.AppSecret, wa.VerifyToken)
+	}
+	// Bot Telegram dei ristoratori: va impostato prima degli iscritti agli eventi, tra cui c'è
+	// l'avviso dei nuovi ordini
+	var telegramBot *bots.Bot
+	if tg := services.Settings.Telegram; tg.BotToken != "" {
+		telegramBot = bots.New(bots.NewTelegram(bots.TelegramConfig{
+			Token:         tg.BotToken,
+			WebhookSecret: tg.WebhookSecret,
+			APIBase:       tg.APIBase,
+			Timeout:       tg.Timeout,
+		}))
+		handlers.SetTelegramBot(telegramBot, tg.BotUsername)
+	}
+	// Pass Apple Wallet / Google Wallet con il QR code del menu
+	walletApple, walletGoogle, err := newWalletIssuers(services.Settings.Wallet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize wallet passes: %w", err)
+	}
+	handlers.SetWallet(walletApple, walletGoogle)
+	if walletGoogle != nil && services.Settings.Server.BaseURL == "" {
+		logger.Warn("server.base_url non impostato: i pass Google Wallet non seguiranno il menu attivo", nil)
+	}
+	handlers.SetWebhookSettings(services.Settings.Webhooks)
+	handlers.RegisterEventSubscribers(events.Default())
+	broker, err := newEventBroker(services.Settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize event broker: %w", err)
+	}
+	if broker != nil {
+		events.Default().Connect(broker)
+		logger.Info("Eventi di dominio inoltrati alle altre istanze", map[string]interface{}{
+			"broker": services.Settings.Events.Broker,
+			"topic":  services.Settings.Events.Topic,
+		})
+	}
+
+	// 4. Blob storage (locale o S3/MinIO)
+	assets, err := storage.New(cfg.Assets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize asset storage: %w", err)
+	}
+	services.Assets = assets
+	handlers.SetBlobStore(assets)
 
-	// 4. Pulizia log vecchi
+	// Scansione antivirus opzionale (ClamAV o ICAP) di upload e archivi da ripristinare
+	guard, err := avscan.NewGuard(avscan.Config{
+		Backend:       services.Settings.Security.AVScanner,
+		Address:       services.Settings.Security.AVAddress,
+		Timeout:       services.Settings.Security.AVTimeout,
+		QuarantineDir: services.Settings.Paths.QuarantineDir,
+		FailClosed:    services.Settings.Security.AVFailClosed,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize anti-virus scanner: %w", err)
+	}
+	handlers.SetUploadGuard(guard)
+	backup.GetBackupManager().SetScanGuard(guard)
+
+	// Suggerimenti delle descrizioni dei piatti con un modello linguistico (OpenAI o Ollama)
+	aiProvider, err := ai.New(ai.Config{
+		Provider: services.Settings.AI.Provider,
+		BaseURL:  services.Settings.AI.BaseURL,
+		APIKey:   services.Settings.AI.APIKey,
+		Model:    services.Settings.AI.Model,
+		Timeout:  services.Settings.AI.Timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ai provider: %w", err)
+	}
+	handlers.SetAIProvider(aiProvider, services.Settings.AI)
+	if aiProvider != nil {
+		logger.Info("Suggerimenti automatici attivi", map[string]interface{}{
+			"provider": services.Settings.AI.Provider,
+			"model":    services.Settings.AI.Model,
+		})
+	}
+
+	// Import dei menu cartacei da foto o PDF (Tesseract o servizio OCR esterno)
+	ocrEngine, err := ocr.New(ocr.Config{
+		Engine:        services.Settings.OCR.Engine,
+		TesseractPath: services.Settings.OCR.TesseractPath,
+		PDFToPPMPath:  services.Settings.OCR.PDFToPPMPath,
+		Languages:     services.Settings.OCR.Languages,
+		APIURL:        services.Settings.OCR.APIURL,
+		APIKey:        services.Settings.OCR.APIKey,
+		Timeout:       services.Settings.OCR.Timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize ocr engine: %w", err)
+	}
+	handlers.SetOCREngine(ocrEngine, services.Settings.OCR)
+
+	backups, err := ConfigureBackups(services.Settings, cfg.Backups)
+	if err != nil {
+		return nil, err
+	}
+	services.Backups = backups
+	if services.Settings.Backup.Enabled {
+		var schedules []backup.Schedule
+		for _, s := range services.Settings.BackupSchedules() {
+			schedules = append(schedules, backup.Schedule{Name: s.Name, Cron: s.Cron, Kind: s.Kind})
+		}
+		if err := backup.GetBackupManager().StartScheduled(schedules); err != nil {
+			return nil, fmt.Errorf("failed to start backup scheduler: %w", err)
+		}
+	}
+
+	// 5. Job in background
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	services.stopWorkers = stopWorkers
+	services.startWorker(func() { handlers.RunAccountDeletionWorker(workersCtx, time.Hour) })
+	services.startWorker(func() { handlers.RunMenuTrashWorker(workersCtx, time.Hour) })
+	handlers.SetSecureCookies(services.Settings.TLSEnabled() || services.Settings.IsProduction() || services.Settings.IsStaging())
+	handlers.SetSessionTimeout(services.Settings.Security.SessionTimeout)
+	services.startWorker(func() { handlers.RunSessionCleanupWorker(workersCtx, 15*time.Minute) })
+	if err := services.initCache(); err != nil {
+		return nil, fmt.Errorf("failed to initialize cache: %w", err)
+	}
+	handlers.SetSnapshotDir(services.Settings.Paths.SnapshotDir)
+	services.startWorker(func() { handlers.RunMenuSnapshotWorker(workersCtx) })
+	handlers.SetBaseURL(services.Settings.Server.BaseURL, services.Settings.Server.TrustProxyHeaders)
+	security.SetTrustProxyHeaders(services.Settings.Server.TrustProxyHeaders)
+	services.startWorker(func() { handlers.RunPublicURLMigration(workersCtx) })
+	handlers.SetAnalyticsSettings(services.Settings.Analytics)
+	services.Analytics.SetGeoResolver(loadGeoResolver(services.Settings.Analytics.GeoIPDatabase))
+	anonymizer, err := NewAnonymizer(services.Settings.Analytics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize analytics anonymization: %w", err)
+	}
+	services.Analytics.SetAnonymizer(anonymizer)
+	if services.Settings.Analytics.Enabled {
+		services.startWorker(func() { handlers.RunAnalyticsRetentionWorker(workersCtx) })
+	}
+	if services.Settings.Mail.WeeklyDigest && services.Settings.Analytics.Enabled {
+		services.startWorker(func() { handlers.RunWeeklyDigestWorker(workersCtx) })
+	}
+	if telegramBot != nil {
+		services.startWorker(func() { registerTelegramWebhook(workersCtx, telegramBot.Client(), services.Settings.Server.BaseURL) })
+		services.startWorker(func() { handlers.RunTelegramDailyWorker(workersCtx, services.Settings.Telegram.DailySummaryAt) })
+	}
+	services.startWorker(func() { handlers.RunNotificationDigestWorker(workersCtx) })
+	services.startWorker(func() { handlers.RunUsageMeterWorker(workersCtx) })
+	services.startWorker(func() { handlers.RunTrialWorker(workersCtx) })
+	services.startWorker(func() { handlers.RunPromotionWorker(workersCtx) })
+	services.startWorker(func() { handlers.RunWebhookWorker(workersCtx) })
+	handlers.SetIntegrationSettings(services.Settings.Integrations)
+	services.startWorker(func() { handlers.RunMenuIntegrationsWorker(workersCtx) })
+	if usageReporter != nil {
+		services.startWorker(func() { handlers.RunUsageReportWorker(workersCtx) })
+	}
+
+	services.initHealthChecks()
+
+	// 6. Pulizia log vecchi
 	logger.CleanOldLogs(30)
 
 	logger.Info("All core services initialized successfully", map[string]interface{}{
 		"analytics": true,
 		"security":  true,
+		"blob":      cfg.Assets.Backend,
 	})
 
 	return services, nil
 }
 
-// Shutdown ferma gracefully tutti i servizi
-func (s *Services) Shutdown() {
+// newEventBroker crea il broker che inoltra gli eventi alle altre istanze, nil se disattivato
+func newEventBroker(cfg *config.Config) (events.Broker, error) {
+	switch cfg.Events.Broker {
+	case "redis":
+		return events.NewRedisBroker(cfg.EventsBrokerURL(), cfg.Events.Topic, cfg.Events.MaxLen)
+	case "nats":
+		return events.NewNATSBroker(cfg.EventsBrokerURL(), cfg.Events.Topic)
+	}
+	return nil, nil
+}
+
+// ConfigureBackups prepara il backup manager: archivio dei backup, destinazioni remote,
+// cadenza dei backup completi e dati dei ristoranti. Non avvia lo scheduler, così la riga di
+// comando può eseguire un backup senza pianificarne altri. Restituisce l'archivio dei backup
+func ConfigureBackups(settings *config.Config, storageCfg storage.Config) (storage.BlobStore, error) {
+	backups, err := storage.New(storageCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize backup storage: %w", err)
+	}
+	bm := backup.GetBackupManager()
+	bm.SetBlobStore(backups)
+	targets, err := newBackupTargets(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize backup targets: %w", err)
+	}
+	bm.SetTargets(targets)
+	bm.SetFullEvery(settings.Backup.FullEvery)
+	bm.SetTenantData(handlers.RestaurantBackupData())
+	if err := bm.Init(settings.Backup.StoragePath, settings.Backup.MaxBackups); err != nil {
+		return nil, fmt.Errorf("failed to initialize backup manager: %w", err)
+	}
+	return backups, nil
+}
+
+// newBackupTargets crea le destinazioni remote in cui vengono copiati gli archivi di backup
+func newBackupTargets(cfg *config.Config) ([]backup.Target, error) {
+	var targets []backup.Target
+	for _, t := range cfg.Backup.Targets {
+		store, err := storage.New(storage.Config{
+			Backend:              t.Type,
+			S3Endpoint:           t.Endpoint,
+			S3Region:             t.Region,
+			S3Bucket:             t.Bucket,
+			S3AccessKey:          t.AccessKey,
+			S3SecretKey:          t.SecretKey,
+			S3UseSSL:             t.UseSSL,
+			S3Prefix:             t.Prefix,
+			SFTPAddress:          t.Address,
+			SFTPUser:             t.User,
+			SFTPPassword:         t.Password,
+			SFTPKeyFile:          t.KeyFile,
+			SFTPHostKey:          t.HostKey,
+			SFTPDir:              t.Path,
+			DriveCredentialsFile: t.CredentialsFile,
+			DriveFolderID:        t.FolderID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t.Name, err)
+		}
+		targets = append(targets, backup.Target{
+			Name:      t.Name,
+			Store:     store,
+			Retention: backup.Retention{MaxBackups: t.MaxBackups, MaxAge: t.MaxAge},
+		})
+		logger.Info("Destinazione remota dei backup configurata", map[string]interface{}{
+			"target": t.Name,
+			"type":   t.Type,
+		})
+	}
+	return targets, nil
+}
+
+// startWorker avvia un job in background che termina quando stopWorkers viene chiamato
+func (s *Services) startWorker(run func()) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		run()
+	}()
+}
+
+// initCache crea le cache delle risposte, delle query e delle pagine dei menu pubblici. Con
+// il backend redis le cache sono condivise, così le modifiche servite da un'istanza
+// invalidano le voci di tutte
+func (s *Services) initCache() error {
+	settings := s.Settings.Cache
+	if !settings.Enabled {
+		return nil
+	}
+
+	responses, err := s.newCacheStore("responses")
+	if err != nil {
+		return err
+	}
+	queries, err := s.newCacheStore("queries")
+	if err != nil {
+		return err
+	}
+	s.ResponseCache = cache.NewResponseCache(responses)
+	s.QueryCache = cache.NewQueryResultCache(queries)
+
+	return s.initMenuCache()
+}
+
+// initMenuCache crea la cache delle pagine dei menu pubblici. La durata è
+// cache.route_ttl["/menu/"], o response_cache_ttl se non impostata
+func (s *Services) initMenuCache() error {
+	store, err := s.newCacheStore("menus")
+	if err != nil {
+		return err
+	}
+
+	settings := s.Settings.Cache
+	ttl := settings.ResponseCacheTTL
+	if routeTTL, ok := settings.RouteTTL["/menu/"]; ok {
+		ttl = routeTTL
+	}
+	s.MenuCache = cache.NewResponseCache(store)
+	handlers.SetPublicMenuCache(s.MenuCache, ttl)
+	return nil
+}
+
+// newCacheStore crea la cache di base del backend configurato. Con redis le voci hanno il
+// prefisso namespace e la connessione viene chiusa allo shutdown
+func (s *Services) newCacheStore(namespace string) (cache.Cache, error) {
+	if s.Settings.Cache.Backend != "redis" {
+		return cache.NewInMemoryCache(), nil
+	}
+	store, err := cache.NewRedisCache(s.Settings.CacheRedisURL(), namespace)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheStores = append(s.cacheStores, store)
+	return store, nil
+}
+
+// newMailer crea il mailer del provider configurato. Con le notifiche email attive i
+// messaggi passano dalla coda (workers, queue_size, max_retries, retry_delay), altrimenti
+// vengono solo registrati nei log
+func newMailer(settings *config.Config) (mailer.Mailer, error) {
+	if !settings.Notifications.Enabled || !settings.Notifications.EnableEmail {
+		logger.Warn("Notifiche email disattivate: le email saranno solo registrate nei log", nil)
+		return mailer.Log{}, nil
+	}
+
+	backend, err := mailer.New(mailer.Config{
+		Provider: settings.Mail.Provider,
+		From:     settings.Mail.From,
+		Timeout:  settings.Mail.Timeout,
+		Host:     settings.Mail.SMTPHost,
+		Port:     settings.Mail.SMTPPort,
+		Username: settings.Mail.SMTPUsername,
+		Password: settings.Mail.SMTPPassword,
+		APIKey:   settings.Mail.APIKey,
+		Domain:   settings.Mail.Domain,
+		APIBase:  settings.Mail.APIBase,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := backend.(mailer.Log); ok {
+		return backend, nil
+	}
+	return mailer.NewQueue(backend, mailer.QueueConfig{
+		Workers:    settings.Notifications.Workers,
+		Size:       settings.Notifications.QueueSize,
+		MaxRetries: settings.Notifications.MaxRetries,
+		RetryDelay: settings.Notifications.RetryDelay,
+	}), nil
+}
+
+// newSMSProvider crea il provider SMS configurato. Gli URL delle ricevute di consegna e delle
+// risposte STOP derivano da server.base_url: senza, gli SMS partono ma gli esiti restano "sent"
+func newSMSProvider(settings *config.Config) (sms.Provider, error) {
+	cfg := sms.Config{
+		Provider:     settings.SMS.Provider,
+		From:         settings.SMS.From,
+		Senders:      settings.SMS.Senders,
+		Timeout:      settings.SMS.Timeout,
+		AccountSID:   settings.SMS.AccountSID,
+		AuthToken:    settings.SMS.AuthToken,
+		APIKey:       settings.SMS.APIKey,
+		APISecret:    settings.SMS.APISecret,
+		WebhookToken: settings.SMS.WebhookToken,
+		APIBase:      settings.SMS.APIBase,
+	}
+	if base := strings.TrimRight(settings.Server.BaseURL, "/"); base != "" {
+		cfg.StatusURL = base + "/api/v1/public/sms/status"
+		cfg.InboundURL = base + "/api/v1/public/sms/inbound"
+	} else if cfg.Provider != sms.ProviderLog {
+		logger.Warn("server.base_url non impostato: ricevute di consegna e risposte STOP degli SMS disattivate", nil)
+	}
+	provider, err := sms.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Notifiche SMS attive", map[string]interface{}{
+		"provider": provider.Name(),
+	})
+	return provider, nil
+}
+
+// registerTelegramWebhook registra presso Telegram l'endpoint degli aggiornamenti del bot e
+// il menu dei comandi. Senza server.base_url il bot può solo inviare messaggi
+func registerTelegramWebhook(ctx context.Context, client *bots.Telegram, baseURL string) {
+	base := strings.TrimRight(baseURL, "/")
+	if base == "" {
+		logger.Warn("server.base_url non impostato: il bot Telegram non riceverà i comandi", nil)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := client.SetWebhook(ctx, base+"/api/v1/public/telegram/webhook"); err != nil {
+		logger.Error("Registrazione del webhook Telegram fallita", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err := client.SetCommands(ctx, [][2]string{
+		{"piatti", "Piatti disponibili ed esauriti"},
+		{"oggi", "Visite e ordini di oggi"},
+		{"help", "Comandi del bot"},
+		{"stop", "Scollega questa chat"},
+	}); err != nil {
+		logger.Warn("Registrazione dei comandi Telegram fallita", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	logger.Info("Bot Telegram attivo", nil)
+}
+
+// loadGeoResolver carica il database GeoIP delle analytics. Se path è vuoto o il file non è
+// leggibile restituisce nil: il server parte comunque, senza paese e città dei visitatori
+// newOAuthProviders crea i provider di accesso social configurati
+func newOAuthProviders(settings config.OAuthConfig) ([]*oauth.Provider, error) {
+	var providers []*oauth.Provider
+	if settings.GoogleClientID != "" {
+		providers = append(providers, oauth.NewGoogle(settings.GoogleClientID, settings.GoogleClientSecret))
+	}
+	if settings.AppleClientID != "" {
+		key, err := os.ReadFile(settings.ApplePrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("read apple private key: %w", err)
+		}
+		apple, err := oauth.NewApple(settings.AppleClientID, settings.AppleTeamID, settings.AppleKeyID, key)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, apple)
+	}
+	return providers, nil
+}
+
+// newWalletIssuers crea gli emittenti dei pass Apple Wallet e Google Wallet configurati; nil
+// per le piattaforme senza credenziali
+func newWalletIssuers(settings config.WalletConfig) (*wallet.Apple, *wallet.Google, error) {
+	var apple *wallet.Apple
+	if settings.ApplePassTypeID != "" {
+		pems := make([][]byte, 3)
+		for i, path := range []string{settings.AppleCertFile, settings.AppleKeyFile, settings.AppleWWDRFile} {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, nil, fmt.Errorf("read apple wallet certificate: %w", err)
+			}
+			pems[i] = data
+		}
+		var err error
+		apple, err = wallet.NewApple(wallet.AppleConfig{
+			PassTypeID: settings.ApplePassTypeID,
+			TeamID:     settings.AppleTeamID,
+			CertPEM:    pems[0],
+			KeyPEM:     pems[1],
+			WWDRPEM:    pems[2],
+			Timeout:    settings.Timeout,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	var google *wallet.Google
+	if settings.GoogleIssuerID != "" {
+		account, err := push.LoadServiceAccount(context.Background(), settings.GoogleCredentials)
+		if err != nil {
+			return nil, nil, err
+		}
+		google, err = wallet.NewGoogle(wallet.GoogleConfig{
+			IssuerID:    settings.GoogleIssuerID,
+			Credentials: account.Credentials,
+			Timeout:     settings.Timeout,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return apple, google, nil
+}
+
+func loadGeoResolver(path string) analytics.GeoResolver {
+	if path == "" {
+		return nil
+	}
+	resolver, err := geoip.Open(path)
+	if err != nil {
+		logger.Warn("Database GeoIP non caricato, paese e città non saranno disponibili", map[string]interface{}{
+			"path":  path,
+			"error": err.Error(),
+		})
+		return nil
+	}
+	logger.Info("Database GeoIP caricato", map[string]interface{}{
+		"path": path,
+	})
+	return geoip.NewCached(resolver, time.Hour)
+}
+
+// NewAnonymizer crea l'anonimizzazione di IP e User-Agent configurata in analytics.*,
+// usata sia per i nuovi eventi sia dal comando scrub-analytics
+func NewAnonymizer(cfg config.AnalyticsConfig) (*anonymize.Anonymizer, error) {
+	return anonymize.New(anonymize.Config{
+		IPMode:        cfg.AnonymizeIP,
+		HashUserAgent: cfg.HashUserAgent,
+		SaltRotation:  cfg.SaltRotation,
+	})
+}
+
+// Shutdown ferma gracefully tutti i servizi: job in background, scheduler dei backup
+// (attendendo un backup in corso) e salvataggio finale delle analytics.
+// Restituisce un errore se ctx scade prima che tutto sia terminato
+func (s *Services) Shutdown(ctx context.Context) error {
 	logger.Info("Shutting down services...", nil)
 
+	var errs []error
+
+	if s.stopWorkers != nil {
+		s.stopWorkers()
+		done := make(chan struct{})
+		go func() {
+			s.workers.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("background workers: %w", ctx.Err()))
+		}
+	}
+
+	if queue, ok := s.Mail.(*mailer.Queue); ok {
+		if err := queue.Close(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("email queue: %w", err))
+		}
+	}
+
+	if err := backup.GetBackupManager().Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Dopo i job e i backup, che pubblicano eventi: attende che i destinatari li abbiano gestiti
+	if err := events.Default().Close(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if s.Analytics != nil {
+		if err := s.Analytics.Flush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if s.RateLimiter != nil {
 		s.RateLimiter.Stop()
 	}
 
+	for _, store := range s.cacheStores {
+		if err := store.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("cache: %w", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		logger.Error("Shutdown incompleto", map[string]interface{}{
+			"error": errors.Join(errs...).Error(),
+		})
+	} else {
+		logger.Info("All services stopped", nil)
+	}
+
 	logger.Close()
+	return errors.Join(errs...)
 }
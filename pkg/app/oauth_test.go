@@ -0,0 +1,126 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/handlers"
+	"qr-menu/models"
+	"qr-menu/pkg/oauth"
+)
+
+// fakeGoogle configures a Google provider whose token endpoint answers with an ID token for
+// the email, signed with the key of its key set and echoing the nonce of the login attempt in
+// *nonce
+func fakeGoogle(t *testing.T, email string, nonce *string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "key-1", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss": "https://accounts.google.com", "sub": "google-1", "aud": "client-id",
+			"exp": time.Now().Add(time.Hour).Unix(), "nonce": *nonce,
+			"email": email, "email_verified": true,
+		})
+		token.Header["kid"] = "key-1"
+		idToken, _ := token.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	provider := oauth.NewGoogle("client-id", "secret")
+	provider.TokenURL = srv.URL + "/token"
+	provider.KeysURL = srv.URL + "/keys"
+	handlers.SetOAuthProviders(provider)
+	t.Cleanup(func() { handlers.SetOAuthProviders() })
+}
+
+// googleLogin goes through the Google login and returns the callback response
+func googleLogin(t *testing.T, router http.Handler, nonce *string) *httptest.ResponseRecorder {
+	t.Helper()
+	start := serve(router, "/auth/oauth/google", nil)
+	if start.Code != http.StatusFound {
+		t.Fatalf("Start: expected 302, got %d: %s", start.Code, start.Body.String())
+	}
+	var cookie *http.Cookie
+	for _, c := range start.Result().Cookies() {
+		if c.Name == "oauth_state" {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("Expected the OAuth state cookie")
+	}
+	parts := strings.Split(cookie.Value, ".")
+	*nonce = parts[1]
+
+	req := httptest.NewRequest("GET", "/auth/oauth/google/callback?"+url.Values{"state": {parts[0]}, "code": {"code-1"}}.Encode(), nil)
+	req.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestOAuthLinksOnlyVerifiedEmails tests that a Google login is linked to the local user with
+// the same email only when that user has verified it: an address registered by someone else
+// first must not capture the owner's Google account
+func TestOAuthLinksOnlyVerifiedEmails(t *testing.T) {
+	verified := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name       string
+		verifiedAt *time.Time
+		status     int
+		linked     int
+	}{
+		{"unverified local email", nil, http.StatusOK, 0},
+		{"verified local email", &verified, http.StatusFound, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := dbtest.New(t)
+			seedTenants(t, store)
+			store.Insert(t, "users", &models.User{ID: "u1", Username: "mario", Email: "mario@example.com",
+				UsernameNormalized: "mario", EmailNormalized: "mario@example.com", IsActive: true,
+				CreatedAt: time.Now(), EmailVerifiedAt: tt.verifiedAt})
+			var nonce string
+			fakeGoogle(t, "mario@example.com", &nonce)
+			router := SetupRouter(newTestServices(t))
+
+			rec := googleLogin(t, router, &nonce)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+			if n := store.Count(t, "users", bson.M{"_id": "u1", "identities.provider": "google"}); n != tt.linked {
+				t.Errorf("Google linked to u1: %d, want %d", n, tt.linked)
+			}
+			if n := store.Count(t, "users", bson.M{}); n != 1 {
+				t.Errorf("Expected no new user, got %d users", n)
+			}
+			if n := store.Count(t, "sessions", bson.M{"user_id": "u1"}); n != tt.linked {
+				t.Errorf("Sessions of u1: %d, want %d", n, tt.linked)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/handlers"
+	"qr-menu/security"
+)
+
+// TestRateLimitClientIP tests that the per-IP limit of the login page cannot be bypassed
+// by forging X-Forwarded-For: the headers count only behind a trusted proxy, and then only
+// the entry appended by the proxy
+func TestRateLimitClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		remoteAddr func(i int) string
+		xff        func(i int) string
+		limited    bool
+	}{
+		{"forged header without proxy",
+			false,
+			func(int) string { return "203.0.113.7:4000" },
+			func(i int) string { return fmt.Sprintf("10.0.0.%d", i+1) },
+			true},
+		{"forged leftmost entry behind proxy",
+			true,
+			func(int) string { return "10.0.0.1:4000" },
+			func(i int) string { return fmt.Sprintf("10.0.0.%d, 203.0.113.7", i+1) },
+			true},
+		{"different clients behind proxy",
+			true,
+			func(int) string { return "10.0.0.1:4000" },
+			func(i int) string { return fmt.Sprintf("203.0.113.%d", i+1) },
+			false},
+		{"different connections without proxy",
+			false,
+			func(i int) string { return fmt.Sprintf("203.0.113.%d:4000", i+1) },
+			func(int) string { return "198.51.100.1" },
+			false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbtest.New(t)
+			services := newTestServices(t)
+			router := SetupRouter(services)
+			handlers.SetRateLimits(services.RateLimiter, map[string]security.RateLimitConfig{
+				"auth": {RequestsPerSecond: 0.001, BurstSize: 2},
+			})
+			security.SetTrustProxyHeaders(tt.trustProxy)
+			t.Cleanup(func() {
+				handlers.SetRateLimits(nil, nil)
+				security.SetTrustProxyHeaders(false)
+			})
+
+			limited := false
+			for i := 0; i < 4; i++ {
+				req := httptest.NewRequest("GET", "/login", nil)
+				req.RemoteAddr = tt.remoteAddr(i)
+				req.Header.Set("X-Forwarded-For", tt.xff(i))
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				if rec.Code == http.StatusTooManyRequests {
+					limited = true
+				}
+			}
+			if limited != tt.limited {
+				t.Errorf("Rate limited = %v, want %v", limited, tt.limited)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/handlers"
+	"qr-menu/models"
+	"qr-menu/pkg/storage"
+)
+
+// archiveImage returns a small image encoded with encode
+func archiveImage(t *testing.T, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for x := 0; x < 8; x++ {
+		img.Set(x, x, color.RGBA{200, 30, 30, 255})
+	}
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// restaurantArchiveZip builds an import archive with the logo and a dish whose image
+// variants are the files under files/images/dishes/old/
+func restaurantArchiveZip(t *testing.T, logo string, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	write := func(name string, data []byte) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	writeJSON := func(name string, v interface{}) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		write(name, data)
+	}
+	writeJSON("manifest.json", map[string]interface{}{"format": "qr-menu-restaurant/1", "menus": 1})
+	writeJSON("restaurant.json", map[string]interface{}{"name": "Trattoria", "logo": logo})
+	writeJSON("menus.json", []*models.Menu{{ID: "old-menu", Name: "Pranzo", Categories: []models.MenuCategory{{
+		ID: "c1", Name: "Primi", Items: []models.MenuItem{{ID: "i1", Name: "Carbonara", Price: 12, ImageID: "old",
+			ImageURL: "/img/old/full", ImageVariants: []models.ImageVariant{{Size: "thumb", Format: "webp"}}}},
+	}}}})
+	for name, data := range files {
+		write(name, data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestRestaurantImportImages tests that imported files are stored only as re-encoded PNG,
+// JPEG or WebP images, with the extension of their content and not of the archive name
+func TestRestaurantImportImages(t *testing.T) {
+	pngData := archiveImage(t, func(b *bytes.Buffer, img image.Image) error { return png.Encode(b, img) })
+	jpegData := archiveImage(t, func(b *bytes.Buffer, img image.Image) error { return jpeg.Encode(b, img, nil) })
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(document.cookie)"/>`)
+
+	tests := []struct {
+		name    string
+		logo    string
+		files   map[string][]byte
+		status  int
+		written []string // Extensions of the stored files
+	}{
+		{"images with misleading names", "files/images/logo.html", map[string][]byte{
+			"files/images/logo.html":               pngData,
+			"files/images/dishes/old/thumb.webp":   jpegData,
+			"files/images/dishes/old/evil.html":    svg,
+			"files/images/dishes/old/medium.svg":   jpegData,
+			"files/images/dishes/old/ignored/full": pngData,
+		}, http.StatusCreated, []string{".jpg", ".jpg", ".png"}},
+		{"svg logo", "files/images/logo.svg", map[string][]byte{"files/images/logo.svg": svg}, http.StatusInternalServerError, nil},
+		{"html dish image", "", map[string][]byte{
+			"files/images/dishes/old/thumb.jpg": append([]byte("<!DOCTYPE html>"), svg...),
+		}, http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := dbtest.New(t)
+			seedTenants(t, store)
+			key := seedAPIKey(t, store, "k1", "r1", models.PermRestaurantWrite)
+			root := t.TempDir()
+			handlers.SetBlobStore(storage.NewLocalStore(root, "/static"))
+			t.Cleanup(func() { handlers.SetBlobStore(storage.NewLocalStore("static", "/static")) })
+			router := SetupRouter(newTestServices(t))
+
+			req := httptest.NewRequest("POST", "/api/v1/restaurant/import", bytes.NewReader(restaurantArchiveZip(t, tt.logo, tt.files)))
+			req.Header.Set("Content-Type", "application/zip")
+			req.Header.Set("X-API-Key", key)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("Expected %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+
+			var written []string
+			filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					written = append(written, filepath.Ext(path))
+				}
+				return nil
+			})
+			if strings.Join(written, ",") != strings.Join(tt.written, ",") {
+				t.Errorf("Stored files with extensions %v, want %v", written, tt.written)
+			}
+			if tt.status != http.StatusCreated {
+				if n := store.Count(t, "menus", bson.M{"name": "Pranzo"}); n != 1 {
+					t.Errorf("Expected the imported menu to be rolled back, got %d menus", n)
+				}
+				return
+			}
+
+			var restaurants []models.Restaurant
+			store.Find(t, "restaurants", bson.M{"_id": "r1"}, &restaurants)
+			if len(restaurants) != 1 || !strings.HasSuffix(restaurants[0].Logo, ".png") {
+				t.Errorf("Expected a .png logo, got %+v", restaurants)
+			}
+			var menus []models.Menu
+			store.Find(t, "menus", bson.M{"restaurant_id": "r1", "name": "Pranzo"}, &menus)
+			if len(menus) != 2 {
+				t.Fatalf("Expected the imported menu next to m1, got %d menus", len(menus))
+			}
+			imported := menus[0]
+			if imported.ID == "m1" {
+				imported = menus[1]
+			}
+			variants := imported.Categories[0].Items[0].ImageVariants
+			if len(variants) != 2 {
+				t.Fatalf("Expected the thumb and medium variants, got %+v", variants)
+			}
+			for _, v := range variants {
+				if v.Format != "jpg" || v.Width != 8 || !strings.HasSuffix(v.URL, "/"+v.Size+".jpg") {
+					t.Errorf("Expected a jpg variant from the content, got %+v", v)
+				}
+			}
+		})
+	}
+}
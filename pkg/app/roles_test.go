@@ -0,0 +1,124 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/models"
+)
+
+// seedStaff stores the users of seedTokenUsers plus anna, menu editor of r1 (u3), and paolo,
+// order manager of r1 (u4), next to luigi who is a viewer
+func seedStaff(t *testing.T, store *dbtest.Store) {
+	t.Helper()
+	seedTokenUsers(t, store)
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt failed: %v", err)
+	}
+	now := time.Now()
+	store.Insert(t, "users",
+		&models.User{ID: "u3", Username: "anna", Email: "anna@example.com", UsernameNormalized: "anna",
+			EmailNormalized: "anna@example.com", PasswordHash: string(hash), IsActive: true, CreatedAt: now},
+		&models.User{ID: "u4", Username: "paolo", Email: "paolo@example.com", UsernameNormalized: "paolo",
+			EmailNormalized: "paolo@example.com", PasswordHash: string(hash), IsActive: true, CreatedAt: now},
+	)
+	store.Insert(t, "restaurant_members",
+		&models.RestaurantMember{ID: "r1:u3", RestaurantID: "r1", UserID: "u3", Role: models.RoleMenuEditor, CreatedAt: now},
+		&models.RestaurantMember{ID: "r1:u4", RestaurantID: "r1", UserID: "u4", Role: models.RoleOrderManager, CreatedAt: now},
+	)
+}
+
+// TestRolePermissions tests through the router which routes each role of r1 can use: the
+// staff roles are denied with 403 everywhere outside their permissions, with the access
+// token of the API as with the session of the admin
+func TestRolePermissions(t *testing.T) {
+	store := dbtest.New(t)
+	seedStaff(t, store)
+	router := SetupRouter(newTokenServices(t))
+
+	users := map[string]string{
+		models.RoleOwner:        "mario",
+		models.RoleMenuEditor:   "anna",
+		models.RoleOrderManager: "paolo",
+		models.RoleViewer:       "luigi",
+	}
+	tokens := make(map[string]map[string]string)
+	browsers := make(map[string]*browser)
+	for role, username := range users {
+		tokens[role] = bearer(loginTokens(t, router, username, "r1").Token)
+		b := loginBrowser(t, router, username)
+		if rec := b.do("POST", "/select-restaurant", url.Values{"restaurant_id": {"r1"}}); rec.Code != http.StatusFound {
+			t.Fatalf("Selecting r1 as %s: expected 302, got %d: %s", username, rec.Code, rec.Body.String())
+		}
+		browsers[role] = b
+	}
+
+	const (
+		owner  = models.RoleOwner
+		editor = models.RoleMenuEditor
+		orders = models.RoleOrderManager
+		viewer = models.RoleViewer
+	)
+	tests := []struct {
+		method  string
+		path    string
+		allowed []string
+	}{
+		// API with the access token
+		{"GET", "/api/menu/m1", []string{owner, editor, orders, viewer}},
+		{"POST", "/api/v2/menus/m1/complete", []string{owner, editor}},
+		{"GET", "/api/analytics", []string{owner, editor, viewer}},
+		{"GET", "/api/v1/orders", []string{owner, orders}},
+		{"GET", "/api/v1/orders/export", []string{owner}},
+		{"PUT", "/api/v1/items/i1/inventory", []string{owner, editor, orders}},
+		{"GET", "/api/v1/automations/triggers/new-feedback", []string{owner, editor}},
+		{"PUT", "/api/v1/fulfillment/settings", []string{owner}},
+		{"GET", "/api/v1/chat-notifications", []string{owner}},
+		{"GET", "/api/v1/integrations", []string{owner}},
+		// Admin pages and forms with the session
+		{"GET", "/admin", []string{owner, editor, orders, viewer}},
+		{"GET", "/admin/analytics", []string{owner, editor, viewer}},
+		{"GET", "/admin/menu/create", []string{owner, editor}},
+		{"POST", "/admin/menu/m1/archive", []string{owner, editor}},
+		{"GET", "/admin/feedback", []string{owner, editor}},
+		{"GET", "/kds", []string{owner, orders}},
+		{"GET", "/admin/staff", []string{owner}},
+		{"POST", "/admin/staff/invite", []string{owner}},
+		{"GET", "/admin/accounting", []string{owner}},
+		{"POST", "/account/vanity-slug", []string{owner}},
+		{"POST", "/api/v1/billing/trial", []string{owner}},
+	}
+	for _, tt := range tests {
+		for _, role := range []string{owner, editor, orders, viewer} {
+			allowed := false
+			for _, r := range tt.allowed {
+				allowed = allowed || r == role
+			}
+			t.Run(role+" "+tt.method+" "+tt.path, func(t *testing.T) {
+				var rec *httptest.ResponseRecorder
+				switch {
+				// The billing routes under /api/ accept only the session
+				case strings.HasPrefix(tt.path, "/api/") && !strings.HasPrefix(tt.path, "/api/v1/billing/"):
+					rec = request(router, tt.method, tt.path, tokens[role])
+				case tt.method == "GET":
+					rec = browsers[role].do("GET", tt.path, nil)
+				default:
+					rec = browsers[role].do(tt.method, tt.path, url.Values{})
+				}
+				denied := rec.Code == http.StatusForbidden && strings.Contains(rec.Body.String(), "Permessi insufficienti")
+				signedOut := rec.Code == http.StatusUnauthorized || rec.Header().Get("Location") == "/login"
+				if denied == allowed || signedOut {
+					t.Errorf("Allowed = %v, got %d: %.200s", allowed, rec.Code, rec.Body.String())
+				}
+			})
+		}
+	}
+}
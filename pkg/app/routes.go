@@ -2,10 +2,15 @@ package app
 
 import (
 	"net/http"
+	"path/filepath"
 	// "qr-menu/api" // Temporaneamente disabilitato - API legacy non compatibili
 	"qr-menu/handlers"
 	"qr-menu/middleware"
+	"qr-menu/models"
+	"qr-menu/pkg/metrics"
+	responsecache "qr-menu/pkg/middleware"
 	"qr-menu/security"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -22,10 +27,14 @@ func SetupRouter(services *Services) *mux.Router {
 	r := mux.NewRouter()
 
 	// File statici
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static/"))))
-	r.PathPrefix("/qr/").Handler(http.StripPrefix("/qr/", http.FileServer(http.Dir("./static/qrcodes/"))))
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(services.Settings.Paths.StaticDir))))
+	r.HandleFunc("/qr/{file}", handlers.ServeQRHandler).Methods("GET")
+	r.HandleFunc("/img/{id}/{size}", handlers.ServeImageHandler).Methods("GET")
 
 	// Middleware stack (ordine importante!)
+	r.Use(middleware.RequestIDMiddleware)
+	r.Use(middleware.MetricsMiddleware)
+	r.Use(services.CachePolicies.Middleware)
 	r.Use(services.CORSMiddleware.Middleware)
 	r.Use(services.SecurityHeaders.Middleware)
 	r.Use(services.RateLimiter.RateLimitMiddleware)
@@ -33,6 +42,13 @@ func SetupRouter(services *Services) *mux.Router {
 	r.Use(middleware.LoggingMiddleware)
 	r.Use(middleware.SecurityMiddleware)
 	r.Use(middleware.AuthMiddleware)
+	r.Use(handlers.CSRFMiddleware)
+	r.Use(handlers.CustomDomainMiddleware)
+	if services.ResponseCache != nil {
+		setupResponseCache(r, services)
+	}
+	r.Use(handlers.PublicMenuCacheMiddleware)
+	r.Use(handlers.MenuHistoryMiddleware)
 
 	// Route pubbliche
 	setupPublicRoutes(r)
@@ -45,11 +61,86 @@ func SetupRouter(services *Services) *mux.Router {
 	// api.SetupSecurityRoutes(r, services.AuditLogger, services.GDPRManager)
 
 	// Route amministrative
-	setupAdminRoutes(r)
+	setupAdminRoutes(r, services)
 
 	return r
 }
 
+// setupResponseCache mette in cache le risposte delle route con una policy (vedi
+// registerCachePolicies) e svuota le voci interessate dopo le modifiche
+func setupResponseCache(r *mux.Router, services *Services) {
+	settings := services.Settings.Cache
+
+	caching := responsecache.NewResponseCachingMiddleware(services.ResponseCache, settings.ResponseCacheTTL)
+	caching.SetSubjectFunc(cacheSubject, "Authorization", "X-API-Key", "Cookie")
+	registerCachePolicies(caching, settings.RouteTTL)
+	r.Use(mux.MiddlewareFunc(caching.Middleware()))
+
+	invalidation := responsecache.NewCacheInvalidationMiddleware(services.ResponseCache, services.QueryCache)
+	invalidation.RegisterPattern("/api/v1/analytics", "analytics")
+	invalidation.RegisterPattern("/api/admin/analytics", "analytics")
+	// Cambiando ristorante la sessione resta la stessa ma i dati no
+	invalidation.RegisterPattern("/select-restaurant", "analytics")
+	r.Use(mux.MiddlewareFunc(invalidation.Middleware()))
+}
+
+// registerCachePolicies imposta quali route passano dalla cache delle risposte, per quanto e
+// con quali varianti. Le route non elencate non sono mai in cache: le pagine e gran parte
+// delle API dipendono dalla sessione, dall'host o cambiano a ogni richiesta. routeTTL
+// (cache.route_ttl) cambia il TTL delle route in cache ma non aggiunge route
+func registerCachePolicies(caching *responsecache.ResponseCachingMiddleware, routeTTL map[string]time.Duration) {
+	policies := map[string]responsecache.CachePolicy{
+		"/": {NoStore: true},
+
+		// Dati del ristorante selezionato: una voce per sessione o API key
+		"/api/analytics":                {PerSubject: true, TTL: time.Minute},
+		"/api/v1/analytics":             {PerSubject: true, TTL: time.Minute},
+		"/api/v1/push/vapid-public-key": {PerSubject: true, TTL: time.Hour},
+
+		// Gli export sono scaricati una volta e possono essere grandi
+		"/api/v1/analytics/export": {NoStore: true},
+	}
+
+	for prefix, ttl := range routeTTL {
+		if policy, ok := policies[prefix]; ok && !policy.NoStore {
+			policy.TTL = ttl
+			policies[prefix] = policy
+		}
+	}
+
+	for prefix, policy := range policies {
+		caching.SetPolicy(prefix, policy)
+	}
+}
+
+// cacheSubject identifica le credenziali di una richiesta per la cache delle risposte:
+// Authorization, X-API-Key o il cookie della sessione dell'admin
+func cacheSubject(r *http.Request) string {
+	if subject := responsecache.RequestSubject(r); subject != "" {
+		return subject
+	}
+	if cookie, err := r.Cookie(handlers.SessionCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// requirePermission protegge la route con un permesso sul ristorante selezionato
+func requirePermission(perm string, handler http.HandlerFunc) http.HandlerFunc {
+	return handlers.RequirePermissions(perm)(handler)
+}
+
+// requireAPIAccess protegge un'API usabile sia dall'admin (sessione e ruolo) sia dalle
+// integrazioni con una API key che abbia lo scope perm, con il limite del gruppo "api"
+func requireAPIAccess(perm string, handler http.HandlerFunc) http.HandlerFunc {
+	return handlers.RequireAPIAccess(perm)(handlers.RateLimit("api")(handler))
+}
+
+// rateLimited applica alla route il limite del gruppo (auth, public) per IP del client
+func rateLimited(group string, handler http.HandlerFunc) http.HandlerFunc {
+	return handlers.RateLimit(group)(handler)
+}
+
 // registerProtectedRoutes è un helper per registrare route protette con autenticazione
 func registerProtectedRoutes(r *mux.Router, routes []RouteDefinition) {
 	for _, route := range routes {
@@ -60,8 +151,21 @@ func registerProtectedRoutes(r *mux.Router, routes []RouteDefinition) {
 func setupPublicRoutes(r *mux.Router) {
 	// Pagine pubbliche
 	r.HandleFunc("/", handlers.HomeHandler).Methods("GET")
-	r.HandleFunc("/login", handlers.LoginHandler).Methods("GET", "POST")
-	r.HandleFunc("/register", handlers.RegisterHandler).Methods("GET", "POST")
+	r.HandleFunc("/login", rateLimited("auth", handlers.LoginHandler)).Methods("GET", "POST")
+	r.HandleFunc("/register", rateLimited("auth", handlers.RegisterHandler)).Methods("GET", "POST")
+	r.HandleFunc("/forgot-password", rateLimited("auth", handlers.ForgotPasswordHandler)).Methods("GET", "POST")
+	r.HandleFunc("/reset-password", rateLimited("auth", handlers.ResetPasswordHandler)).Methods("GET", "POST")
+	r.HandleFunc("/api/v1/auth/forgot-password", rateLimited("auth", handlers.ForgotPasswordAPIHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/auth/reset-password", rateLimited("auth", handlers.ResetPasswordAPIHandler)).Methods("POST")
+	// Access token delle integrazioni (Authorization: Bearer), con security.jwt_secret
+	r.HandleFunc("/api/v1/auth/token", rateLimited("auth", handlers.APITokenHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/auth/refresh", rateLimited("auth", handlers.APIRefreshTokenHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/auth/logout", handlers.APILogoutHandler).Methods("POST")
+	r.HandleFunc("/account/email/verify", handlers.VerifyEmailChangeHandler).Methods("GET")
+	r.HandleFunc("/staff/accept", handlers.StaffInvitationHandler).Methods("GET")
+	r.HandleFunc("/auth/oauth/{provider}", rateLimited("auth", handlers.OAuthStartHandler)).Methods("GET")
+	r.HandleFunc("/auth/oauth/{provider}/callback", rateLimited("auth", handlers.OAuthCallbackHandler)).Methods("GET")
+	r.HandleFunc("/auth/oauth/{provider}/callback", handlers.OAuthFormPostHandler).Methods("POST")
 
 	// Legal pages (Italian law compliance)
 	r.HandleFunc("/privacy", handlers.PrivacyPolicyHandler).Methods("GET")
@@ -70,20 +174,103 @@ func setupPublicRoutes(r *mux.Router) {
 	r.HandleFunc("/legal", handlers.LegalNotesHandler).Methods("GET")
 
 	// Menu pubblici
-	r.HandleFunc("/menu/{id}", handlers.PublicMenuHandler).Methods("GET")
-	r.HandleFunc("/r/{username}", handlers.GetActiveMenuHandler).Methods("GET")
-	r.HandleFunc("/menu/{id}/share", handlers.ShareMenuHandler).Methods("GET")
-	r.HandleFunc("/menu/{id}/qr-download", handlers.DownloadQRHandler).Methods("GET")
+	r.HandleFunc("/menu/{id}", rateLimited("public", handlers.PublicMenuHandler)).Methods("GET")
+	r.HandleFunc("/r/{username}", rateLimited("public", handlers.GetActiveMenuHandler)).Methods("GET")
+	r.HandleFunc("/m/{slug}", rateLimited("public", handlers.VanityMenuHandler)).Methods("GET")
+	r.HandleFunc("/n/{code}", rateLimited("public", handlers.NFCTagRedirectHandler)).Methods("GET")
+	r.HandleFunc("/s/{code}", rateLimited("public", handlers.ShortLinkRedirectHandler)).Methods("GET")
+	r.HandleFunc("/menu/{id}/share", rateLimited("public", handlers.ShareMenuHandler)).Methods("GET")
+	r.HandleFunc("/menu/{id}/qr-download", rateLimited("public", handlers.DownloadQRHandler)).Methods("GET")
+
+	// Widget per i siti dei ristoranti: le route .json e .js vanno prima della pagina per iframe
+	r.HandleFunc("/embed/{username}.json", rateLimited("public", handlers.EmbedMenuHandler)).Methods("GET")
+	r.HandleFunc("/embed/{username}.js", rateLimited("public", handlers.EmbedScriptHandler)).Methods("GET")
+	r.HandleFunc("/embed/{username}", rateLimited("public", handlers.EmbedFrameHandler)).Methods("GET")
+
+	// Indicizzazione dei menu pubblici nei motori di ricerca
+	r.HandleFunc("/sitemap.xml", rateLimited("public", handlers.SitemapHandler)).Methods("GET")
+	r.HandleFunc("/robots.txt", handlers.RobotsHandler).Methods("GET")
+
+	// Feed del menu del giorno per calendari (iCal) e aggregatori (RSS)
+	r.HandleFunc("/r/{username}/specials.ics", rateLimited("public", handlers.SpecialsICalHandler)).Methods("GET")
+	r.HandleFunc("/r/{username}/specials.rss", rateLimited("public", handlers.SpecialsRSSHandler)).Methods("GET")
 
 	// Analytics tracking
-	r.HandleFunc("/api/track/share", handlers.TrackShareHandler).Methods("POST")
+	r.HandleFunc("/api/track/share", rateLimited("public", handlers.TrackShareHandler)).Methods("POST")
+
+	// Feedback dei clienti dopo la visita
+	r.HandleFunc("/api/v1/public/menus/{id}/feedback", rateLimited("feedback", handlers.SubmitFeedbackHandler)).Methods("POST")
+
+	// Tessera fedeltà dei clienti: raccolta dei punti delle visite e saldo
+	r.HandleFunc("/loyalty/{username}", rateLimited("public", handlers.LoyaltyPageHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/public/loyalty/{username}/card", rateLimited("public", handlers.PublicLoyaltyCardHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/public/loyalty/{username}/collect", rateLimited("loyalty", handlers.CollectLoyaltyPointsHandler)).Methods("POST")
+
+	// Buoni regalo acquistati online: pagamento, conferma del provider di billing e pagina del buono
+	r.HandleFunc("/api/v1/public/vouchers/{username}/checkout", rateLimited("public", handlers.VoucherCheckoutHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/billing/webhook", handlers.BillingWebhookHandler).Methods("POST")
+	r.HandleFunc("/voucher/{id}", rateLimited("public", handlers.VoucherPageHandler)).Methods("GET")
+
+	// Ordini in anticipo dei clienti: fasce orarie, invio dell'ordine e pagina di stato
+	r.HandleFunc("/api/v1/public/restaurants/{username}/slots", rateLimited("public", handlers.PublicSlotsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/public/restaurants/{username}/orders", rateLimited("orders", handlers.PublicOrderHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/public/restaurants/{username}/pairings", rateLimited("public", handlers.PublicPairingsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/public/orders/{id}", rateLimited("public", handlers.PublicOrderStatusHandler)).Methods("GET")
+	r.HandleFunc("/order/{id}", rateLimited("public", handlers.OrderStatusPageHandler)).Methods("GET")
+
+	// Notifiche del provider di pagamento degli ordini di un ristorante (Satispay le invia in GET)
+	r.HandleFunc("/api/v1/public/payments/{restaurant_id}/webhook", rateLimited("public", handlers.PaymentWebhookHandler)).Methods("GET", "POST")
+
+	// Ricevute di consegna e risposte (STOP/START) del provider SMS (Vonage può usare GET)
+	r.HandleFunc("/api/v1/public/sms/status", rateLimited("public", handlers.SMSStatusHandler)).Methods("GET", "POST")
+	r.HandleFunc("/api/v1/public/sms/inbound", rateLimited("public", handlers.SMSInboundHandler)).Methods("GET", "POST")
+	r.HandleFunc("/api/v1/public/whatsapp/webhook", rateLimited("public", handlers.WhatsAppWebhookHandler)).Methods("GET", "POST")
+	r.HandleFunc("/api/v1/public/telegram/webhook", rateLimited("public", handlers.TelegramWebhookHandler)).Methods("POST")
+
+	// Menu esportato nel formato della piattaforma di delivery, scaricato da Glovo
+	r.HandleFunc("/api/v1/public/integrations/{id}/menu", rateLimited("public", handlers.PublicIntegrationMenuHandler)).Methods("GET")
+
+	// Pass Apple Wallet / Google Wallet con il QR code del menu e web service con cui i
+	// dispositivi Apple si registrano agli aggiornamenti (autenticato dal token del pass)
+	r.HandleFunc("/api/v1/public/restaurants/{username}/wallet/apple", rateLimited("public", handlers.AppleWalletPassHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/public/restaurants/{username}/wallet/google", rateLimited("public", handlers.GoogleWalletPassHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/public/wallet/v1/devices/{device}/registrations/{passType}/{serial}", rateLimited("public", handlers.RegisterWalletDeviceHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/public/wallet/v1/devices/{device}/registrations/{passType}/{serial}", rateLimited("public", handlers.UnregisterWalletDeviceHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/public/wallet/v1/devices/{device}/registrations/{passType}", rateLimited("public", handlers.WalletDeviceSerialsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/public/wallet/v1/passes/{passType}/{serial}", rateLimited("public", handlers.WalletPassUpdateHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/public/wallet/v1/log", rateLimited("public", handlers.WalletLogHandler)).Methods("POST")
+
+	// Stato delle dipendenze per monitoraggio e orchestratori
+	r.HandleFunc("/api/v1/health", handlers.HealthHandler).Methods("GET")
+	r.HandleFunc("/ready", handlers.ReadyHandler).Methods("GET")
 }
 
 func setupProtectedRoutes(r *mux.Router) {
 	// Dashboard e admin base
-	r.HandleFunc("/admin", handlers.RequireAuth(handlers.AdminHandler)).Methods("GET")
-	r.HandleFunc("/admin/analytics", handlers.RequireAuth(handlers.AnalyticsDashboardHandler)).Methods("GET")
+	r.HandleFunc("/admin", handlers.RequireAuth(requirePermission(models.PermMenusRead, handlers.AdminHandler))).Methods("GET")
+	r.HandleFunc("/admin/analytics", handlers.RequireAuth(requirePermission(models.PermAnalyticsRead, handlers.AnalyticsDashboardHandler))).Methods("GET")
 	r.HandleFunc("/logout", handlers.RequireUser(handlers.LogoutHandler)).Methods("GET", "POST")
+
+	// Impostazioni account (username, email, URL pubblico)
+	r.HandleFunc("/account", handlers.RequireUser(handlers.AccountHandler)).Methods("GET")
+	r.HandleFunc("/account/username", handlers.RequireUser(handlers.ChangeUsernameHandler)).Methods("POST")
+	r.HandleFunc("/account/email", handlers.RequireUser(handlers.ChangeEmailHandler)).Methods("POST")
+	r.HandleFunc("/account/locale", handlers.RequireUser(handlers.ChangeLocaleHandler)).Methods("POST")
+	r.HandleFunc("/account/phone", handlers.RequireUser(handlers.ChangePhoneHandler)).Methods("POST")
+	r.HandleFunc("/account/notifications", handlers.RequireUser(handlers.ChangeNotificationPreferencesHandler)).Methods("POST")
+	r.HandleFunc("/account/sessions/logout-others", handlers.RequireUser(handlers.LogoutOtherSessionsHandler)).Methods("POST")
+	r.HandleFunc("/account/identities/{provider}/unlink", handlers.RequireUser(handlers.UnlinkOAuthIdentityHandler)).Methods("POST")
+	r.HandleFunc("/account/restaurant-username", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.ChangeRestaurantUsernameHandler))).Methods("POST")
+	r.HandleFunc("/account/vanity-slug", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.SetVanitySlugHandler))).Methods("POST")
+	r.HandleFunc("/account/privacy-analytics", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.SetPrivacyFirstAnalyticsHandler))).Methods("POST")
+	r.HandleFunc("/account/nutrition-display", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.SetNutritionDisplayHandler))).Methods("POST")
+	r.HandleFunc("/account/ratings-display", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.SetShowRatingsHandler))).Methods("POST")
+	r.HandleFunc("/account/domain", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.SetCustomDomainHandler))).Methods("POST")
+	r.HandleFunc("/account/domain/verify", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.VerifyCustomDomainHandler))).Methods("POST")
+	r.HandleFunc("/account/domain/remove", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.RemoveCustomDomainHandler))).Methods("POST")
+	r.HandleFunc("/account/export", handlers.RequireUser(handlers.AccountExportHandler)).Methods("GET")
+	r.HandleFunc("/account/delete", handlers.RequireUser(handlers.DeleteAccountHandler)).Methods("GET")
+	r.HandleFunc("/account/delete", handlers.RequireUser(handlers.DeleteAccountPostHandler)).Methods("POST")
 	
 	// Multi-restaurant: selezione ristorante
 	r.HandleFunc("/select-restaurant", handlers.RequireUser(handlers.SelectRestaurantHandler)).Methods("GET")
@@ -93,38 +280,294 @@ func setupProtectedRoutes(r *mux.Router) {
 	r.HandleFunc("/add-restaurant", handlers.RequireUser(handlers.AddRestaurantHandler)).Methods("GET")
 	r.HandleFunc("/add-restaurant", handlers.RequireUser(handlers.AddRestaurantPostHandler)).Methods("POST")
 
+	// Staff del ristorante: inviti e ruoli
+	staffRoutes := []RouteDefinition{
+		{"/admin/staff", requirePermission(models.PermStaffManage, handlers.StaffHandler), []string{"GET"}},
+		{"/admin/staff/invite", requirePermission(models.PermStaffManage, handlers.InviteStaffHandler), []string{"POST"}},
+		{"/admin/staff/{userId}/role", requirePermission(models.PermStaffManage, handlers.ChangeStaffRoleHandler), []string{"POST"}},
+		{"/admin/staff/{userId}/remove", requirePermission(models.PermStaffManage, handlers.RemoveStaffHandler), []string{"POST"}},
+		{"/admin/staff/invitations/{id}/revoke", requirePermission(models.PermStaffManage, handlers.RevokeStaffInvitationHandler), []string{"POST"}},
+	}
+	registerProtectedRoutes(r, staffRoutes)
+	r.HandleFunc("/staff/accept", handlers.RequireUser(handlers.AcceptStaffInvitationHandler)).Methods("POST")
+
+	// Kitchen Display System: coda degli ordini per i tablet della cucina
+	r.HandleFunc("/kds", handlers.RequireAuth(requirePermission(models.PermOrdersManage, handlers.KDSHandler))).Methods("GET")
+	r.HandleFunc("/kds/ws", handlers.RequireAuth(requirePermission(models.PermOrdersManage, handlers.KDSFeedHandler))).Methods("GET")
+
+	// Coda di moderazione dei feedback dei clienti
+	feedbackRoutes := []RouteDefinition{
+		{"/admin/feedback", requirePermission(models.PermFeedbackModerate, handlers.FeedbackPageHandler), []string{"GET"}},
+		{"/admin/feedback/{id}/approve", requirePermission(models.PermFeedbackModerate, handlers.ModerateFeedbackFormHandler), []string{"POST"}},
+		{"/admin/feedback/{id}/reject", requirePermission(models.PermFeedbackModerate, handlers.ModerateFeedbackFormHandler), []string{"POST"}},
+	}
+	registerProtectedRoutes(r, feedbackRoutes)
+
+	// Contabilità: esportazione mensile degli ordini e dati fiscali delle ricevute
+	accountingRoutes := []RouteDefinition{
+		{"/admin/accounting", requirePermission(models.PermBillingRead, handlers.AccountingPageHandler), []string{"GET"}},
+		{"/admin/accounting/export", requirePermission(models.PermBillingRead, handlers.AccountingExportHandler), []string{"GET"}},
+		{"/admin/accounting/fiscal", requirePermission(models.PermRestaurantWrite, handlers.UpdateFiscalInfoFormHandler), []string{"POST"}},
+	}
+	registerProtectedRoutes(r, accountingRoutes)
+
 	// Gestione menu
 	menuRoutes := []RouteDefinition{
-		{"/admin/menu/create", handlers.CreateMenuHandler, []string{"GET"}},
-		{"/admin/menu/create", handlers.CreateMenuPostHandler, []string{"POST"}},
-		{"/admin/menu/{id}", handlers.EditMenuHandler, []string{"GET"}},
-		{"/admin/menu/{id}/update", handlers.UpdateMenuHandler, []string{"POST"}},
-		{"/admin/menu/{id}/complete", handlers.CompleteMenuHandler, []string{"POST"}},
-		{"/admin/menu/{id}/activate", handlers.SetActiveMenuHandler, []string{"POST"}},
-		{"/admin/menu/{id}/delete", handlers.DeleteMenuHandler, []string{"POST"}},
-		{"/admin/menu/{id}/duplicate", handlers.DuplicateMenuHandler, []string{"POST"}},
-		{"/admin/menu/{id}/add-item", handlers.AddItemHandler, []string{"POST"}},
+		{"/admin/menu/create", requirePermission(models.PermMenusWrite, handlers.CreateMenuHandler), []string{"GET"}},
+		{"/admin/menu/create", requirePermission(models.PermMenusWrite, handlers.CreateMenuPostHandler), []string{"POST"}},
+		{"/admin/menu/{id}", requirePermission(models.PermMenusWrite, handlers.EditMenuHandler), []string{"GET"}},
+		{"/admin/menu/{id}/update", requirePermission(models.PermMenusWrite, handlers.UpdateMenuHandler), []string{"POST"}},
+		{"/admin/menu/{id}/complete", requirePermission(models.PermMenusWrite, handlers.CompleteMenuHandler), []string{"POST"}},
+		{"/admin/menu/{id}/activate", requirePermission(models.PermMenusWrite, handlers.SetActiveMenuHandler), []string{"POST"}},
+		{"/admin/menu/{id}/display", requirePermission(models.PermMenusWrite, handlers.DisplayMenuHandler), []string{"POST"}},
+		{"/admin/menu/{id}/hide", requirePermission(models.PermMenusWrite, handlers.HideMenuHandler), []string{"POST"}},
+		{"/admin/menu/{id}/move", requirePermission(models.PermMenusWrite, handlers.MoveMenuHandler), []string{"POST"}},
+		{"/admin/menu/{id}/archive", requirePermission(models.PermMenusWrite, handlers.ArchiveMenuHandler), []string{"POST"}},
+		{"/admin/menu/{id}/unarchive", requirePermission(models.PermMenusWrite, handlers.RestoreMenuHandler), []string{"POST"}},
+		{"/admin/archive", requirePermission(models.PermMenusRead, handlers.MenuArchiveHandler), []string{"GET"}},
+		{"/admin/trash", requirePermission(models.PermMenusRead, handlers.MenuTrashHandler), []string{"GET"}},
+		{"/admin/trash/menus/{id}/restore", requirePermission(models.PermMenusWrite, handlers.RestoreTrashedMenuHandler), []string{"POST"}},
+		{"/admin/trash/menus/{menuId}/items/{itemId}/restore", requirePermission(models.PermMenusWrite, handlers.RestoreTrashedItemHandler), []string{"POST"}},
+		{"/admin/menu/{id}/delete", requirePermission(models.PermMenusWrite, handlers.DeleteMenuHandler), []string{"POST"}},
+		{"/admin/menu/{id}/history", requirePermission(models.PermMenusRead, handlers.MenuHistoryPageHandler), []string{"GET"}},
+		{"/admin/menu/{id}/history/{revisionId}/revert", requirePermission(models.PermMenusRevert, handlers.RevertMenuRevisionFormHandler), []string{"POST"}},
+		{"/admin/menu/{id}/duplicate", requirePermission(models.PermMenusWrite, handlers.DuplicateMenuHandler), []string{"POST"}},
+		{"/admin/menu/{id}/add-item", requirePermission(models.PermMenusWrite, handlers.AddItemHandler), []string{"POST"}},
 	}
 	registerProtectedRoutes(r, menuRoutes)
 
 	// Gestione item menu
 	r.HandleFunc("/admin/menu/{menuId}/category/{categoryId}/item/{itemId}/duplicate",
-		handlers.RequireAuth(handlers.DuplicateItemHandler)).Methods("POST")
+		handlers.RequireAuth(requirePermission(models.PermMenusWrite, handlers.DuplicateItemHandler))).Methods("POST")
 	r.HandleFunc("/admin/menu/{menuId}/category/{categoryId}/item/{itemId}/edit",
-		handlers.RequireAuth(handlers.EditItemHandler)).Methods("POST")
+		handlers.RequireAuth(requirePermission(models.PermMenusWrite, handlers.EditItemHandler))).Methods("POST")
 	r.HandleFunc("/admin/menu/{menuId}/category/{categoryId}/item/{itemId}/delete",
-		handlers.RequireAuth(handlers.DeleteItemHandler)).Methods("POST")
+		handlers.RequireAuth(requirePermission(models.PermMenusWrite, handlers.DeleteItemHandler))).Methods("POST")
 	r.HandleFunc("/admin/menu/{menuId}/category/{categoryId}/item/{itemId}/upload-image",
-		handlers.RequireAuth(handlers.UploadItemImageHandler)).Methods("POST")
+		handlers.RequireAuth(requirePermission(models.PermMenusWrite, handlers.UploadItemImageHandler))).Methods("POST")
 
 	// API JSON
-	r.HandleFunc("/api/analytics", handlers.RequireAuth(handlers.AnalyticsAPIHandler)).Methods("GET")
-	r.HandleFunc("/api/menus", handlers.RequireAuth(handlers.GetMenusHandler)).Methods("GET")
-	r.HandleFunc("/api/menu/{id}", handlers.GetMenuHandler).Methods("GET")
-	r.HandleFunc("/api/menu", handlers.RequireAuth(handlers.CreateMenuAPIHandler)).Methods("POST")
-	r.HandleFunc("/api/menu/{id}/generate-qr", handlers.RequireAuth(handlers.GenerateQRHandler)).Methods("POST")
+	r.HandleFunc("/api/analytics", requireAPIAccess(models.PermAnalyticsRead, handlers.AnalyticsAPIHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/analytics/events", requireAPIAccess(models.PermAnalyticsRead, handlers.AnalyticsEventsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/analytics/ratings", requireAPIAccess(models.PermAnalyticsRead, handlers.RatingsAnalyticsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/analytics/tips", requireAPIAccess(models.PermAnalyticsRead, handlers.TipsAnalyticsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/menus/{id}/history", requireAPIAccess(models.PermMenusRead, handlers.MenuHistoryHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/menus/{id}/save-as-template", requireAPIAccess(models.PermMenusWrite, handlers.SaveMenuAsTemplateHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/menus/import/scan", requireAPIAccess(models.PermMenusWrite, handlers.ImportMenuScanHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/menus/from-template/{templateId}", requireAPIAccess(models.PermMenusWrite, handlers.CreateMenuFromTemplateHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/menu-templates", requireAPIAccess(models.PermMenusRead, handlers.ListMenuTemplatesForRestaurantHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/menu-templates/{id}", requireAPIAccess(models.PermMenusWrite, handlers.DeleteRestaurantMenuTemplateHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/items/{id}/suggest-description", requireAPIAccess(models.PermMenusWrite, handlers.SuggestItemDescriptionHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/inventory", requireAPIAccess(models.PermMenusRead, handlers.ListInventoryHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/items/{id}/inventory", requireAPIAccess(models.PermInventoryManage, handlers.SetItemInventoryHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/items/{id}/inventory", requireAPIAccess(models.PermInventoryManage, handlers.DeleteItemInventoryHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/items/{id}/inventory/adjustments", requireAPIAccess(models.PermMenusRead, handlers.ItemInventoryAdjustmentsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/items/{id}/inventory/adjustments", requireAPIAccess(models.PermInventoryManage, handlers.AdjustItemInventoryHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/pos/changes", requireAPIAccess(models.PermMenusRead, handlers.PosChangesHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/pos/menus/{id}/items", requireAPIAccess(models.PermMenusWrite, handlers.PosPushHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/automations/me", requireAPIAccess(models.PermMenusRead, handlers.AutomationAuthTestHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/automations/triggers/new-order", requireAPIAccess(models.PermOrdersManage, handlers.NewOrdersTriggerHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/automations/triggers/new-feedback", requireAPIAccess(models.PermFeedbackModerate, handlers.NewFeedbackTriggerHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/automations/triggers/menu-updated", requireAPIAccess(models.PermMenusRead, handlers.MenuUpdatedTriggerHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/automations/triggers/{trigger}/sample", requireAPIAccess(models.PermMenusRead, handlers.TriggerSampleHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/automations/actions/create-item", requireAPIAccess(models.PermMenusWrite, handlers.CreateItemActionHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/automations/actions/toggle-availability", requireAPIAccess(models.PermMenusWrite, handlers.ToggleAvailabilityActionHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/orders", requireAPIAccess(models.PermOrdersManage, handlers.ListOrdersHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/orders", requireAPIAccess(models.PermOrdersManage, handlers.CreateOrderHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/orders/export", requireAPIAccess(models.PermBillingRead, handlers.OrdersExportHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/orders/{id}", requireAPIAccess(models.PermOrdersManage, handlers.GetOrderHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/orders/{id}/receipt", requireAPIAccess(models.PermOrdersManage, handlers.OrderReceiptHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/orders/{id}/contact", requireAPIAccess(models.PermOrdersManage, handlers.OrderContactHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/orders/{id}/bump", requireAPIAccess(models.PermOrdersManage, handlers.BumpOrderHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/orders/{id}/recall", requireAPIAccess(models.PermOrdersManage, handlers.RecallOrderHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/orders/{id}/complete", requireAPIAccess(models.PermOrdersManage, handlers.CompleteOrderHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/orders/{id}/cancel", requireAPIAccess(models.PermOrdersManage, handlers.CancelOrderHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/orders/{id}/checkout", requireAPIAccess(models.PermOrdersManage, handlers.OrderCheckoutHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/orders/{id}/refund", requireAPIAccess(models.PermOrdersManage, handlers.RefundOrderHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/orders/{id}/split", requireAPIAccess(models.PermOrdersManage, handlers.SplitOrderHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/orders/{id}/splits/{split_id}/checkout", requireAPIAccess(models.PermOrdersManage, handlers.SplitCheckoutHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/fulfillment/settings", requireAPIAccess(models.PermOrdersManage, handlers.GetFulfillmentSettingsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/fulfillment/settings", requireAPIAccess(models.PermRestaurantWrite, handlers.UpdateFulfillmentSettingsHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/payments/settings", requireAPIAccess(models.PermOrdersManage, handlers.GetPaymentSettingsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/payments/settings", requireAPIAccess(models.PermRestaurantWrite, handlers.UpdatePaymentSettingsHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/payments/settings", requireAPIAccess(models.PermRestaurantWrite, handlers.DeletePaymentSettingsHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/whatsapp/settings", requireAPIAccess(models.PermMenusRead, handlers.GetWhatsAppSettingsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/whatsapp/settings", requireAPIAccess(models.PermRestaurantWrite, handlers.UpdateWhatsAppSettingsHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/whatsapp/settings", requireAPIAccess(models.PermRestaurantWrite, handlers.DeleteWhatsAppSettingsHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/whatsapp/subscribers", requireAPIAccess(models.PermRestaurantWrite, handlers.ListWhatsAppSubscribersHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/whatsapp/broadcast", requireAPIAccess(models.PermMenusWrite, handlers.WhatsAppBroadcastHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/telegram/link", requireAPIAccess(models.PermMenusRead, handlers.CreateTelegramLinkHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/telegram/chats", requireAPIAccess(models.PermRestaurantWrite, handlers.ListTelegramChatsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/telegram/chats/{id}", requireAPIAccess(models.PermRestaurantWrite, handlers.UpdateTelegramChatHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/telegram/chats/{id}", requireAPIAccess(models.PermRestaurantWrite, handlers.DeleteTelegramChatHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/chat-notifications", requireAPIAccess(models.PermWebhooksManage, handlers.ListChatWebhooksHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/chat-notifications", requireAPIAccess(models.PermWebhooksManage, handlers.CreateChatWebhookHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/chat-notifications/{id}", requireAPIAccess(models.PermWebhooksManage, handlers.UpdateChatWebhookHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/chat-notifications/{id}", requireAPIAccess(models.PermWebhooksManage, handlers.DeleteChatWebhookHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/chat-notifications/{id}/test", requireAPIAccess(models.PermWebhooksManage, handlers.TestChatWebhookHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/integrations", requireAPIAccess(models.PermRestaurantWrite, handlers.ListMenuIntegrationsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/integrations/{platform}", requireAPIAccess(models.PermRestaurantWrite, handlers.SaveMenuIntegrationHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/integrations/{platform}", requireAPIAccess(models.PermRestaurantWrite, handlers.DeleteMenuIntegrationHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/integrations/{platform}/sync", requireAPIAccess(models.PermRestaurantWrite, handlers.SyncMenuIntegrationHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/nfc/tags", requireAPIAccess(models.PermMenusRead, handlers.ListNFCTagsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/nfc/tags", requireAPIAccess(models.PermRestaurantWrite, handlers.CreateNFCTagsHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/nfc/tags/{id}", requireAPIAccess(models.PermRestaurantWrite, handlers.UpdateNFCTagHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/nfc/tags/{id}", requireAPIAccess(models.PermRestaurantWrite, handlers.DeleteNFCTagHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/nfc/tags/{id}/ndef", requireAPIAccess(models.PermMenusRead, handlers.NFCTagNDEFHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/links", requireAPIAccess(models.PermMenusRead, handlers.ListShortLinksHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/links", requireAPIAccess(models.PermRestaurantWrite, handlers.CreateShortLinkHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/links/{id}", requireAPIAccess(models.PermRestaurantWrite, handlers.UpdateShortLinkHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/links/{id}", requireAPIAccess(models.PermRestaurantWrite, handlers.DeleteShortLinkHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/links/{id}/qr", requireAPIAccess(models.PermMenusRead, handlers.ShortLinkQRHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/wallet/settings", requireAPIAccess(models.PermMenusRead, handlers.GetWalletSettingsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/wallet/settings", requireAPIAccess(models.PermRestaurantWrite, handlers.UpdateWalletSettingsHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/fiscal/settings", requireAPIAccess(models.PermBillingRead, handlers.GetFiscalInfoHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/fiscal/settings", requireAPIAccess(models.PermRestaurantWrite, handlers.UpdateFiscalInfoHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/feedback", requireAPIAccess(models.PermFeedbackModerate, handlers.ListFeedbackHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/feedback/{id}/approve", requireAPIAccess(models.PermFeedbackModerate, handlers.ApproveFeedbackHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/feedback/{id}/reject", requireAPIAccess(models.PermFeedbackModerate, handlers.RejectFeedbackHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/menus/{id}/history/{revisionId}/revert",
+		handlers.RequireAuth(requirePermission(models.PermMenusRevert, handlers.RevertMenuRevisionHandler))).Methods("POST")
+	r.HandleFunc("/api/v1/push/tokens", handlers.RequireAuth(handlers.RegisterPushTokenHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/push/tokens", handlers.RequireAuth(handlers.DeletePushTokenHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/push/vapid-public-key", handlers.RequireAuth(handlers.WebPushKeyHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/push/subscriptions", handlers.RequireAuth(handlers.SubscribeWebPushHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/push/subscriptions", handlers.RequireAuth(handlers.UnsubscribeWebPushHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/notifications/history", handlers.RequireAuth(handlers.NotificationHistoryHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/sessions", handlers.RequireAuth(handlers.ListSessionsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/sessions/logout-others", handlers.RequireAuth(handlers.LogoutOtherSessionsAPIHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/sessions/{id}", handlers.RequireAuth(handlers.RevokeSessionHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/apikeys", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.ListAPIKeysHandler))).Methods("GET")
+	r.HandleFunc("/api/v1/apikeys", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.CreateAPIKeyHandler))).Methods("POST")
+	r.HandleFunc("/api/v1/apikeys/{id}", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.RevokeAPIKeyHandler))).Methods("DELETE")
+	r.HandleFunc("/api/v1/embed", handlers.RequireAuth(requirePermission(models.PermMenusRead, handlers.EmbedSnippetHandler))).Methods("GET")
+	r.HandleFunc("/api/v1/audit-logs", handlers.RequireAuth(requirePermission(models.PermRestaurantWrite, handlers.AuditLogsHandler))).Methods("GET")
+	r.HandleFunc("/api/v1/analytics/export", requireAPIAccess(models.PermAnalyticsRead, handlers.AnalyticsExportHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/restaurant/export", requireAPIAccess(models.PermRestaurantWrite, handlers.RestaurantExportHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/restaurant/import", requireAPIAccess(models.PermRestaurantWrite, handlers.RestaurantImportHandler)).Methods("POST")
+
+	// Organizzazioni (catene con più sedi): solo il proprietario dell'account, con la sessione
+	r.HandleFunc("/api/v1/organizations", handlers.RequireUser(handlers.ListOrganizationsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/organizations", handlers.RequireUser(handlers.CreateOrganizationHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/organizations/{id}", handlers.RequireUser(handlers.GetOrganizationHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/organizations/{id}", handlers.RequireUser(handlers.UpdateOrganizationHandler)).Methods("PATCH")
+	r.HandleFunc("/api/v1/organizations/{id}", handlers.RequireUser(handlers.DeleteOrganizationHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/organizations/{id}/locations", handlers.RequireUser(handlers.AddOrganizationLocationHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/organizations/{id}/locations/{restaurantID}", handlers.RequireUser(handlers.RemoveOrganizationLocationHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/organizations/{id}/dashboard", handlers.RequireUser(handlers.OrganizationDashboardHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/organizations/{id}/templates", handlers.RequireUser(handlers.ListMenuTemplatesHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/organizations/{id}/templates", handlers.RequireUser(handlers.CreateMenuTemplateHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/organizations/{id}/templates/{templateID}", handlers.RequireUser(handlers.UpdateMenuTemplateHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/organizations/{id}/templates/{templateID}", handlers.RequireUser(handlers.DeleteMenuTemplateHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/organizations/{id}/templates/{templateID}/push", handlers.RequireUser(handlers.PushMenuTemplateHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/billing/usage", requireAPIAccess(models.PermBillingRead, handlers.BillingUsageHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/billing/trial", handlers.RequireAuth(requirePermission(models.PermBillingManage, handlers.StartTrialHandler))).Methods("POST")
+	r.HandleFunc("/api/v1/billing/coupons/redeem", handlers.RequireAuth(requirePermission(models.PermBillingManage, handlers.RedeemCouponHandler))).Methods("POST")
+	r.HandleFunc("/api/v1/specials", requireAPIAccess(models.PermMenusRead, handlers.ListSpecialsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/specials", requireAPIAccess(models.PermMenusWrite, handlers.CreateSpecialHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/specials/{id}", requireAPIAccess(models.PermMenusWrite, handlers.UpdateSpecialHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/specials/{id}", requireAPIAccess(models.PermMenusWrite, handlers.DeleteSpecialHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/promotions", requireAPIAccess(models.PermMenusRead, handlers.ListPromotionsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/promotions", requireAPIAccess(models.PermMenusWrite, handlers.CreatePromotionHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/promotions/{id}", requireAPIAccess(models.PermMenusRead, handlers.GetPromotionHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/promotions/{id}", requireAPIAccess(models.PermMenusWrite, handlers.UpdatePromotionHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/promotions/{id}", requireAPIAccess(models.PermMenusWrite, handlers.DeletePromotionHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/loyalty/program", requireAPIAccess(models.PermOrdersManage, handlers.GetLoyaltyProgramHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/loyalty/program", requireAPIAccess(models.PermRestaurantWrite, handlers.UpdateLoyaltyProgramHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/loyalty/visits", requireAPIAccess(models.PermOrdersManage, handlers.CreateLoyaltyVisitHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/loyalty/visits/{id}/qr", requireAPIAccess(models.PermOrdersManage, handlers.LoyaltyVisitQRHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/loyalty/cards/{number}", requireAPIAccess(models.PermOrdersManage, handlers.GetLoyaltyCardHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/loyalty/cards/{number}/redeem", requireAPIAccess(models.PermOrdersManage, handlers.RedeemLoyaltyRewardHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/loyalty/transactions", requireAPIAccess(models.PermOrdersManage, handlers.ListLoyaltyTransactionsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/vouchers/settings", requireAPIAccess(models.PermOrdersManage, handlers.GetVoucherSettingsHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/vouchers/settings", requireAPIAccess(models.PermRestaurantWrite, handlers.UpdateVoucherSettingsHandler)).Methods("PUT")
+	r.HandleFunc("/api/v1/vouchers", requireAPIAccess(models.PermOrdersManage, handlers.ListVouchersHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/vouchers", requireAPIAccess(models.PermOrdersManage, handlers.CreateVoucherHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/vouchers/{id}", requireAPIAccess(models.PermOrdersManage, handlers.GetVoucherHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/vouchers/{id}/qr", requireAPIAccess(models.PermOrdersManage, handlers.VoucherQRHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/vouchers/{id}/void", requireAPIAccess(models.PermRestaurantWrite, handlers.VoidVoucherHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/webhooks/deliveries", requireAPIAccess(models.PermWebhooksManage, handlers.ListWebhookDeliveriesHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/webhooks/deliveries/{id}/redeliver", requireAPIAccess(models.PermWebhooksManage, handlers.RedeliverWebhookHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/webhooks/dead-letters", requireAPIAccess(models.PermWebhooksManage, handlers.WebhookDeadLettersHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/webhooks", requireAPIAccess(models.PermWebhooksManage, handlers.ListWebhooksHandler)).Methods("GET")
+	r.HandleFunc("/api/v1/webhooks", requireAPIAccess(models.PermWebhooksManage, handlers.CreateWebhookHandler)).Methods("POST")
+	r.HandleFunc("/api/v1/webhooks/{id}", requireAPIAccess(models.PermWebhooksManage, handlers.DeleteWebhookHandler)).Methods("DELETE")
+	r.HandleFunc("/api/v1/webhooks/{id}/test", requireAPIAccess(models.PermWebhooksManage, handlers.TestWebhookHandler)).Methods("POST")
+	r.HandleFunc("/api/menus", requireAPIAccess(models.PermMenusRead, handlers.GetMenusHandler)).Methods("GET")
+	r.HandleFunc("/api/graphql", requireAPIAccess(models.PermMenusRead, handlers.GraphQLHandler)).Methods("POST")
+	r.HandleFunc("/api/menu/{id}", requireAPIAccess(models.PermMenusRead, handlers.GetMenuHandler)).Methods("GET")
+	r.HandleFunc("/api/menu/{id}/items", requireAPIAccess(models.PermMenusRead, handlers.GetMenuItemsHandler)).Methods("GET")
+	r.HandleFunc("/api/menu", requireAPIAccess(models.PermMenusWrite, handlers.CreateMenuAPIHandler)).Methods("POST")
+	r.HandleFunc("/api/menu/{id}/generate-qr", requireAPIAccess(models.PermMenusWrite, handlers.GenerateQRHandler)).Methods("POST")
+
+	// API v2: le operazioni dei form del pannello in JSON, per i frontend headless
+	const item = "/api/v2/menus/{id}/categories/{categoryId}/items/{itemId}"
+	r.HandleFunc("/api/v2/menus", requireAPIAccess(models.PermMenusRead, handlers.GetMenusHandler)).Methods("GET")
+	r.HandleFunc("/api/v2/menus", requireAPIAccess(models.PermMenusWrite, handlers.CreateMenuV2Handler)).Methods("POST")
+	r.HandleFunc("/api/v2/menus/{id}", requireAPIAccess(models.PermMenusRead, handlers.GetMenuV2Handler)).Methods("GET")
+	r.HandleFunc("/api/v2/menus/{id}", requireAPIAccess(models.PermMenusWrite, handlers.UpdateMenuV2Handler)).Methods("PATCH")
+	r.HandleFunc("/api/v2/menus/{id}", requireAPIAccess(models.PermMenusWrite, handlers.DeleteMenuV2Handler)).Methods("DELETE")
+	r.HandleFunc("/api/v2/menus/{id}/complete", requireAPIAccess(models.PermMenusWrite, handlers.CompleteMenuV2Handler)).Methods("POST")
+	r.HandleFunc("/api/v2/menus/{id}/activate", requireAPIAccess(models.PermMenusWrite, handlers.ActivateMenuV2Handler)).Methods("POST")
+	r.HandleFunc("/api/v2/menus/{id}/display", requireAPIAccess(models.PermMenusWrite, handlers.DisplayMenuV2Handler)).Methods("POST")
+	r.HandleFunc("/api/v2/menus/{id}/hide", requireAPIAccess(models.PermMenusWrite, handlers.HideMenuV2Handler)).Methods("POST")
+	r.HandleFunc("/api/v2/menus/{id}/move", requireAPIAccess(models.PermMenusWrite, handlers.MoveMenuV2Handler)).Methods("POST")
+	r.HandleFunc("/api/v2/menus/{id}/archive", requireAPIAccess(models.PermMenusWrite, handlers.ArchiveMenuV2Handler)).Methods("POST")
+	r.HandleFunc("/api/v2/menus/{id}/restore", requireAPIAccess(models.PermMenusWrite, handlers.RestoreMenuV2Handler)).Methods("POST")
+	r.HandleFunc("/api/v2/menus/{id}/duplicate", requireAPIAccess(models.PermMenusWrite, handlers.DuplicateMenuV2Handler)).Methods("POST")
+	r.HandleFunc("/api/v2/menus/{id}/items", requireAPIAccess(models.PermMenusRead, handlers.GetMenuItemsHandler)).Methods("GET")
+	r.HandleFunc("/api/v2/menus/{id}/categories/{categoryId}/items", requireAPIAccess(models.PermMenusWrite, handlers.AddItemV2Handler)).Methods("POST")
+	r.HandleFunc(item, requireAPIAccess(models.PermMenusWrite, handlers.UpdateItemV2Handler)).Methods("PATCH")
+	r.HandleFunc(item, requireAPIAccess(models.PermMenusWrite, handlers.DeleteItemV2Handler)).Methods("DELETE")
+	r.HandleFunc(item+"/duplicate", requireAPIAccess(models.PermMenusWrite, handlers.DuplicateItemV2Handler)).Methods("POST")
+	r.HandleFunc(item+"/image", requireAPIAccess(models.PermMenusWrite, handlers.UploadItemImageV2Handler)).Methods("POST")
+	r.HandleFunc("/api/v2/trash", requireAPIAccess(models.PermMenusRead, handlers.MenuTrashV2Handler)).Methods("GET")
+	r.HandleFunc("/api/v2/trash/menus/{id}/restore", requireAPIAccess(models.PermMenusWrite, handlers.RestoreTrashedMenuV2Handler)).Methods("POST")
+	r.HandleFunc("/api/v2/trash/menus/{menuId}/items/{itemId}/restore", requireAPIAccess(models.PermMenusWrite, handlers.RestoreTrashedItemV2Handler)).Methods("POST")
 }
 
-func setupAdminRoutes(r *mux.Router) {
-	// Admin routes reserved for future features
+func setupAdminRoutes(r *mux.Router, services *Services) {
+	// API di amministrazione della piattaforma (bearer token, disabilitate se non configurato)
+	adminToken := services.Settings.Security.AdminToken
+	r.HandleFunc("/api/admin/config",
+		handlers.RequireAdminToken(adminToken, handlers.AdminConfigHandler(services.Settings))).Methods("GET")
+	r.HandleFunc("/api/admin/analytics/compact",
+		handlers.RequireAdminToken(adminToken, handlers.AdminAnalyticsCompactHandler)).Methods("POST")
+	r.HandleFunc("/api/admin/logs",
+		handlers.RequireAdminToken(adminToken, handlers.AdminLogsHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/jwt/rotate",
+		handlers.RequireAdminToken(adminToken, handlers.AdminRotateAPITokenKeysHandler)).Methods("POST")
+	r.HandleFunc("/api/admin/billing/coupons",
+		handlers.RequireAdminToken(adminToken, handlers.AdminListCouponsHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/billing/coupons",
+		handlers.RequireAdminToken(adminToken, handlers.AdminCreateCouponHandler)).Methods("POST")
+	r.HandleFunc("/api/admin/billing/coupons/{id}",
+		handlers.RequireAdminToken(adminToken, handlers.AdminUpdateCouponHandler)).Methods("PUT")
+	r.HandleFunc("/api/admin/billing/coupons/{id}",
+		handlers.RequireAdminToken(adminToken, handlers.AdminDeleteCouponHandler)).Methods("DELETE")
+	r.HandleFunc("/api/admin/backups",
+		handlers.RequireAdminToken(adminToken, handlers.AdminListBackupsHandler)).Methods("GET")
+	r.HandleFunc("/api/admin/backups",
+		handlers.RequireAdminToken(adminToken, handlers.AdminCreateBackupHandler)).Methods("POST")
+	r.HandleFunc("/api/admin/backups/{id}/download",
+		handlers.RequireAdminToken(adminToken, handlers.AdminDownloadBackupHandler)).Methods("GET")
+	restoreDir := filepath.Join(services.Settings.Backup.StoragePath, "restore")
+	r.HandleFunc("/api/admin/backups/{id}/restore",
+		handlers.RequireAdminToken(adminToken, handlers.AdminRestoreBackupHandler(restoreDir))).Methods("POST")
+	// Backup completi, incrementali (?mode=incremental) o di un solo ristorante (?restaurant_id=)
+	r.HandleFunc("/api/backup/create",
+		handlers.RequireAdminToken(adminToken, handlers.AdminCreateBackupHandler)).Methods("POST")
+	r.HandleFunc("/api/backup/restore",
+		handlers.RequireAdminToken(adminToken, handlers.AdminRestoreBackupHandler(restoreDir))).Methods("POST")
+	// Stato dei backup e pianificazioni cron (PUT le sostituisce, DELETE torna alla configurazione)
+	r.HandleFunc("/api/backup/status",
+		handlers.RequireAdminToken(adminToken, handlers.GetBackupStatusHandler)).Methods("GET")
+	r.HandleFunc("/api/backup/schedules",
+		handlers.RequireAdminToken(adminToken, handlers.AdminUpdateBackupSchedulesHandler)).Methods("PUT")
+	r.HandleFunc("/api/backup/schedules",
+		handlers.RequireAdminToken(adminToken, handlers.AdminResetBackupSchedulesHandler)).Methods("DELETE")
+
+	// Metriche Prometheus (token separato, da dare allo scraper al posto di quello admin)
+	r.Handle("/metrics",
+		handlers.RequireAdminToken(services.Settings.Security.MetricsToken, metrics.Handler().ServeHTTP)).Methods("GET")
 }
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/middleware"
+	"qr-menu/models"
+	"qr-menu/pkg/config"
+	"qr-menu/security"
+)
+
+// newTestServices builds the services SetupRouter needs the way InitializeServices does,
+// without external dependencies: in-memory caches and the default configuration
+func newTestServices(t *testing.T) *Services {
+	t.Helper()
+	// The session key would otherwise be created under storage/ in the package directory
+	t.Setenv("SESSION_SECRET", "routes-test-session-secret")
+	settings := config.Default()
+	settings.Cache.Enabled = true
+	settings.Cache.Backend = "memory"
+	settings.Paths.StaticDir = t.TempDir()
+
+	services := &Services{
+		Settings:        settings,
+		RateLimiter:     security.NewRateLimiter(),
+		AuditLogger:     security.NewAuditLogger(10000),
+		SecurityHeaders: security.NewSecurityHeadersMiddleware(security.DefaultSecurityHeadersConfig()),
+		CORSMiddleware:  security.NewCORSMiddleware(security.DefaultCORSConfig()),
+		CachePolicies:   middleware.LoadCachePolicies(),
+	}
+	if err := services.initCache(); err != nil {
+		t.Fatalf("initCache failed: %v", err)
+	}
+	return services
+}
+
+// seedAPIKey stores an API key of the restaurant with the given scopes and returns the raw key
+func seedAPIKey(t *testing.T, store *dbtest.Store, id, restaurantID string, scopes ...string) string {
+	t.Helper()
+	raw := models.APIKeyPrefix + "test-" + id
+	// A recent last use keeps the request from updating it in the background
+	usedAt := time.Now()
+	store.Insert(t, "api_keys", &models.APIKey{
+		ID:           id,
+		RestaurantID: restaurantID,
+		Name:         id,
+		Hash:         hashAPIKey(raw),
+		Scopes:       scopes,
+		RateLimit:    1000,
+		CreatedAt:    usedAt,
+		LastUsedAt:   &usedAt,
+	})
+	return raw
+}
+
+// hashAPIKey hashes a raw key the way API keys are stored
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// serve sends a GET request with the headers to the router
+func serve(router http.Handler, path string, headers map[string]string) *httptest.ResponseRecorder {
+	return request(router, "GET", path, headers)
+}
+
+// request sends a request without body with the headers to the router
+func request(router http.Handler, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestRouterResponseCache tests the response cache headers of the routes with a policy and
+// of those without one, through the router used by the server
+func TestRouterResponseCache(t *testing.T) {
+	store := dbtest.New(t)
+	key1 := seedAPIKey(t, store, "k1", "r1", models.PermAnalyticsRead, models.PermMenusRead)
+	key2 := seedAPIKey(t, store, "k2", "r2", models.PermAnalyticsRead)
+	router := SetupRouter(newTestServices(t))
+
+	t.Run("per subject", func(t *testing.T) {
+		first := serve(router, "/api/analytics?days=7", map[string]string{"X-API-Key": key1})
+		if first.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", first.Code, first.Body.String())
+		}
+		if got := first.Header().Get("X-Cache"); got != "MISS" {
+			t.Errorf("Expected X-Cache MISS on the first request, got %q", got)
+		}
+		vary := strings.Join(first.Header().Values("Vary"), ",")
+		for _, header := range []string{"Authorization", "X-API-Key", "Cookie"} {
+			if !strings.Contains(vary, header) {
+				t.Errorf("Expected Vary to list %s, got %q", header, vary)
+			}
+		}
+
+		second := serve(router, "/api/analytics?days=7", map[string]string{"X-API-Key": key1})
+		if got := second.Header().Get("X-Cache"); got != "HIT" {
+			t.Errorf("Expected X-Cache HIT for the same key, got %q", got)
+		}
+		if second.Body.String() != first.Body.String() {
+			t.Error("Expected the cached body to match the first response")
+		}
+
+		other := serve(router, "/api/analytics?days=7", map[string]string{"X-API-Key": key2})
+		if got := other.Header().Get("X-Cache"); got != "MISS" {
+			t.Errorf("Expected X-Cache MISS for another restaurant's key, got %q", got)
+		}
+	})
+
+	t.Run("rejected credentials", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			rec := serve(router, "/api/analytics", map[string]string{"X-API-Key": models.APIKeyPrefix + "unknown"})
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected 401 for an unknown key, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("X-Cache"); got != "" {
+				t.Errorf("Expected an error response not to be cached, got X-Cache %q", got)
+			}
+		}
+	})
+
+	t.Run("not cached", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			path    string
+			headers map[string]string
+		}{
+			{"no-store policy", "/api/v1/analytics/export?format=csv", map[string]string{"X-API-Key": key1}},
+			{"route without policy", "/api/menus", map[string]string{"X-API-Key": key1}},
+			{"anonymous page", "/login", nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				for i := 0; i < 2; i++ {
+					rec := serve(router, tt.path, tt.headers)
+					if got := rec.Header().Get("X-Cache"); got != "" {
+						t.Errorf("Expected %s not to be cached, got X-Cache %q (status %d)", tt.path, got, rec.Code)
+					}
+				}
+			})
+		}
+	})
+}
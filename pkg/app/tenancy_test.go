@@ -0,0 +1,92 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"qr-menu/db/dbtest"
+	"qr-menu/models"
+)
+
+// seedTenants stores two active restaurants with a menu each: m1 of r1 and m2 of r2. The
+// owners are the users u1 and u2, which are not stored
+func seedTenants(t *testing.T, store *dbtest.Store) {
+	t.Helper()
+	now := time.Now()
+	store.Insert(t, "restaurants",
+		&models.Restaurant{ID: "r1", OwnerID: "u1", Username: "trattoria", Name: "Trattoria", IsActive: true, CreatedAt: now},
+		&models.Restaurant{ID: "r2", OwnerID: "u2", Username: "osteria", Name: "Osteria", IsActive: true, CreatedAt: now},
+	)
+	store.Insert(t, "menus",
+		&models.Menu{ID: "m1", RestaurantID: "r1", Name: "Pranzo", CreatedAt: now, UpdatedAt: now,
+			Categories: []models.MenuCategory{{ID: "c1", Name: "Primi", Items: []models.MenuItem{{ID: "i1", Name: "Carbonara", Price: 12}}}}},
+		&models.Menu{ID: "m2", RestaurantID: "r2", Name: "Cena", CreatedAt: now, UpdatedAt: now,
+			Categories: []models.MenuCategory{{ID: "c2", Name: "Secondi", Items: []models.MenuItem{{ID: "i2", Name: "Tagliata", Price: 20}}}}},
+	)
+}
+
+// TestMenusTenantIsolation tests through the server router that an API key only reaches the
+// menus of its own restaurant: another tenant's menus are missing from the list and answer
+// 404, as if they did not exist, on reads and writes alike
+func TestMenusTenantIsolation(t *testing.T) {
+	store := dbtest.New(t)
+	seedTenants(t, store)
+	readWrite := seedAPIKey(t, store, "k1", "r1", models.PermMenusRead, models.PermMenusWrite)
+	analyticsOnly := seedAPIKey(t, store, "k2", "r1", models.PermAnalyticsRead)
+	router := SetupRouter(newTestServices(t))
+	auth := map[string]string{"X-API-Key": readWrite}
+
+	for _, path := range []string{"/api/menus", "/api/v2/menus"} {
+		t.Run("list "+path, func(t *testing.T) {
+			rec := serve(router, path, auth)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			var list struct {
+				Data []models.Menu `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+				t.Fatalf("Invalid list response: %v", err)
+			}
+			if len(list.Data) != 1 || list.Data[0].ID != "m1" {
+				t.Errorf("Expected only menu m1 of r1, got %+v", list.Data)
+			}
+		})
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		status  int
+	}{
+		{"own menu", "GET", "/api/menu/m1", auth, http.StatusOK},
+		{"other menu", "GET", "/api/menu/m2", auth, http.StatusNotFound},
+		{"other menu items", "GET", "/api/menu/m2/items", auth, http.StatusNotFound},
+		{"other menu v2", "GET", "/api/v2/menus/m2", auth, http.StatusNotFound},
+		{"other menu v2 items", "GET", "/api/v2/menus/m2/items", auth, http.StatusNotFound},
+		{"complete other menu", "POST", "/api/v2/menus/m2/complete", auth, http.StatusNotFound},
+		{"delete other menu", "DELETE", "/api/v2/menus/m2", auth, http.StatusNotFound},
+		{"missing scope", "GET", "/api/menu/m1", map[string]string{"X-API-Key": analyticsOnly}, http.StatusForbidden},
+		{"missing scope list", "GET", "/api/menus", map[string]string{"X-API-Key": analyticsOnly}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := request(router, tt.method, tt.path, tt.headers)
+			if rec.Code != tt.status {
+				t.Errorf("%s %s: expected %d, got %d: %s", tt.method, tt.path, tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	var menus []models.Menu
+	store.Find(t, "menus", bson.M{"id": "m2"}, &menus)
+	if len(menus) != 1 || !menus[0].DeletedAt.IsZero() || menus[0].IsCompleted {
+		t.Errorf("Expected menu m2 of r2 to be unchanged, got %+v", menus)
+	}
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"qr-menu/handlers"
+	"qr-menu/logger"
+	"qr-menu/pkg/config"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ConfigureTLS prepara server per terminare TLS con i certificati configurati
+// (file statici o Let's Encrypt) e restituisce il server HTTP in chiaro che
+// reindirizza a HTTPS e risponde alle challenge ACME. Restituisce nil se TLS
+// non è abilitato o se server.http_redirect_port è 0
+func ConfigureTLS(server *http.Server, settings *config.Config) (*http.Server, error) {
+	if !settings.TLSEnabled() {
+		return nil, nil
+	}
+
+	redirect := httpsRedirectHandler(settings.Server.Port)
+
+	if settings.Security.AutocertEnabled {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocertHostPolicy(settings.Security.AutocertDomains),
+			Cache:      autocert.DirCache(settings.Security.AutocertCacheDir),
+			Email:      settings.Security.AutocertEmail,
+		}
+		server.TLSConfig = manager.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+		// Le challenge HTTP-01 arrivano sulla porta in chiaro, tutto il resto viene reindirizzato
+		redirect = manager.HTTPHandler(redirect)
+
+		logger.Info("Certificati Let's Encrypt automatici abilitati", map[string]interface{}{
+			"domains":   settings.Security.AutocertDomains,
+			"cache_dir": settings.Security.AutocertCacheDir,
+		})
+	} else {
+		cert, err := tls.LoadX509KeyPair(settings.Security.CertFile, settings.Security.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("errore caricamento certificato TLS: %v", err)
+		}
+		server.TLSConfig = &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{cert},
+		}
+	}
+
+	if settings.Server.HTTPRedirectPort == 0 {
+		return nil, nil
+	}
+	return &http.Server{
+		Addr:              ":" + strconv.Itoa(settings.Server.HTTPRedirectPort),
+		Handler:           redirect,
+		ReadHeaderTimeout: settings.Server.ReadHeaderTimeout,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       settings.Server.IdleTimeout,
+		MaxHeaderBytes:    1 << 20,
+	}, nil
+}
+
+// autocertHostPolicy autorizza i certificati per i domini configurati e per
+// i domini personalizzati verificati dai ristoranti
+func autocertHostPolicy(domains []string) autocert.HostPolicy {
+	whitelist := autocert.HostWhitelist(domains...)
+	return func(ctx context.Context, host string) error {
+		if err := whitelist(ctx, host); err == nil {
+			return nil
+		}
+		if handlers.CustomDomainAllowed(ctx, host) {
+			return nil
+		}
+		return fmt.Errorf("dominio %q non autorizzato", host)
+	}
+}
+
+// httpsRedirectHandler reindirizza permanentemente ogni richiesta allo stesso URL in HTTPS
+func httpsRedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if host == "" {
+			http.Error(w, "Host mancante", http.StatusBadRequest)
+			return
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	})
+}
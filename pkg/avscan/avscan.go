@@ -0,0 +1,247 @@
+// Package avscan scans uploaded files and backup archives with an external
+// anti-virus engine (ClamAV's clamd or an ICAP server) and quarantines the
+// files it flags.
+package avscan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"qr-menu/logger"
+)
+
+// ErrInfected is matched (with errors.Is) by the error returned when a file is flagged
+var ErrInfected = errors.New("file flagged by anti-virus")
+
+// ErrUnavailable is matched by the error returned when the scanner cannot be reached
+// and the guard is configured to fail closed
+var ErrUnavailable = errors.New("anti-virus scanner unavailable")
+
+// Backend types
+const (
+	BackendNone   = ""
+	BackendClamAV = "clamav"
+	BackendICAP   = "icap"
+)
+
+// Result is the verdict of a scan
+type Result struct {
+	Infected  bool
+	Signature string // Name of the detected threat, if any
+}
+
+// Scanner scans a stream of content
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// Config holds anti-virus configuration
+type Config struct {
+	Backend       string        // "", clamav, icap
+	Address       string        // clamd: host:port or unix:/path/clamd.ctl; ICAP: icap://host:1344/service
+	Timeout       time.Duration // Per-scan timeout
+	QuarantineDir string        // Where flagged files are moved
+	FailClosed    bool          // Reject files when the scanner is unreachable
+}
+
+// New creates the scanner selected by cfg.Backend, or nil when scanning is disabled
+func New(cfg Config) (Scanner, error) {
+	switch cfg.Backend {
+	case BackendNone:
+		return nil, nil
+	case BackendClamAV:
+		if cfg.Address == "" {
+			return nil, fmt.Errorf("clamav scanner requires an address")
+		}
+		return NewClamAV(cfg.Address), nil
+	case BackendICAP:
+		return NewICAP(cfg.Address)
+	default:
+		return nil, fmt.Errorf("unknown anti-virus backend: %s", cfg.Backend)
+	}
+}
+
+// InfectedError describes a flagged file and where it was quarantined
+type InfectedError struct {
+	Name           string
+	Signature      string
+	QuarantinePath string
+}
+
+func (e *InfectedError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", ErrInfected, e.Name, e.Signature)
+}
+
+// Is makes errors.Is(err, ErrInfected) match
+func (e *InfectedError) Is(target error) bool {
+	return target == ErrInfected
+}
+
+// Guard applies the scan policy: flagged files are quarantined and logged as a security
+// event, scanner failures reject the file only when FailClosed is set.
+// A nil Guard accepts everything, so callers do not need to check whether scanning is enabled
+type Guard struct {
+	scanner       Scanner
+	timeout       time.Duration
+	quarantineDir string
+	failClosed    bool
+}
+
+// NewGuard creates a guard from cfg. It returns nil when scanning is disabled
+func NewGuard(cfg Config) (*Guard, error) {
+	scanner, err := New(cfg)
+	if err != nil || scanner == nil {
+		return nil, err
+	}
+	return NewGuardWithScanner(scanner, cfg), nil
+}
+
+// NewGuardWithScanner creates a guard around an existing scanner
+func NewGuardWithScanner(scanner Scanner, cfg Config) *Guard {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.QuarantineDir == "" {
+		cfg.QuarantineDir = filepath.Join("storage", "quarantine")
+	}
+	return &Guard{
+		scanner:       scanner,
+		timeout:       cfg.Timeout,
+		quarantineDir: cfg.QuarantineDir,
+		failClosed:    cfg.FailClosed,
+	}
+}
+
+// CheckBytes scans an in-memory upload. If it is flagged a copy is written to the
+// quarantine directory and an *InfectedError is returned
+func (g *Guard) CheckBytes(ctx context.Context, name string, data []byte) error {
+	if g == nil {
+		return nil
+	}
+	result, err := g.scan(ctx, bytes.NewReader(data))
+	if err != nil || !result.Infected {
+		return g.unavailable(name, err)
+	}
+
+	path, qerr := g.quarantine(name, result, func(dst string) error {
+		return os.WriteFile(dst, data, 0600)
+	})
+	return g.flagged(name, result, path, qerr)
+}
+
+// CheckFile scans a file on disk. If it is flagged the file is moved to the
+// quarantine directory and an *InfectedError is returned
+func (g *Guard) CheckFile(ctx context.Context, name, path string) error {
+	if g == nil {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	result, err := g.scan(ctx, f)
+	f.Close()
+	if err != nil || !result.Infected {
+		return g.unavailable(name, err)
+	}
+
+	qpath, qerr := g.quarantine(name, result, func(dst string) error {
+		if err := os.Rename(path, dst); err == nil {
+			return nil
+		}
+		// Different filesystem: copy and remove
+		if err := copyFile(path, dst); err != nil {
+			return err
+		}
+		return os.Remove(path)
+	})
+	return g.flagged(name, result, qpath, qerr)
+}
+
+func (g *Guard) scan(ctx context.Context, r io.Reader) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, g.timeout)
+	defer cancel()
+	return g.scanner.Scan(ctx, r)
+}
+
+// unavailable handles a scanner failure according to the fail-open/closed policy
+func (g *Guard) unavailable(name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	logger.Warn("Scansione antivirus non riuscita", map[string]interface{}{
+		"file":        name,
+		"error":       err.Error(),
+		"fail_closed": g.failClosed,
+	})
+	if g.failClosed {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return nil
+}
+
+// flagged logs the security event and builds the returned error
+func (g *Guard) flagged(name string, result Result, path string, qerr error) error {
+	data := map[string]interface{}{
+		"file":       name,
+		"signature":  result.Signature,
+		"quarantine": path,
+	}
+	if qerr != nil {
+		data["quarantine_error"] = qerr.Error()
+	}
+	logger.SecurityEvent("MALWARE_DETECTED", "file messo in quarantena", "", "", "", data)
+
+	return &InfectedError{Name: name, Signature: result.Signature, QuarantinePath: path}
+}
+
+// quarantineRecord is written next to each quarantined file
+type quarantineRecord struct {
+	Name       string    `json:"name"`
+	Signature  string    `json:"signature"`
+	DetectedAt time.Time `json:"detected_at"`
+}
+
+// quarantine stores a flagged file with store and writes its metadata alongside
+func (g *Guard) quarantine(name string, result Result, store func(dst string) error) (string, error) {
+	if err := os.MkdirAll(g.quarantineDir, 0700); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	dst := filepath.Join(g.quarantineDir, fmt.Sprintf("%s-%s", now.Format("20060102-150405.000000000"), filepath.Base(name)))
+	if err := store(dst); err != nil {
+		return "", err
+	}
+
+	record, _ := json.MarshalIndent(quarantineRecord{Name: name, Signature: result.Signature, DetectedAt: now}, "", "  ")
+	if err := os.WriteFile(dst+".json", record, 0600); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
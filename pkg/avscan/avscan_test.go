@@ -0,0 +1,216 @@
+package avscan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// eicar is the standard anti-virus test string
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd serves one INSTREAM request per connection, flagging content that contains eicar
+func fakeClamd(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				if cmd, _ := r.ReadString(0); cmd != "zINSTREAM\x00" {
+					conn.Write([]byte("UNKNOWN COMMAND\x00"))
+					return
+				}
+				var content bytes.Buffer
+				size := make([]byte, 4)
+				for {
+					if _, err := io.ReadFull(r, size); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					io.CopyN(&content, r, int64(n))
+				}
+				if strings.Contains(content.String(), eicar) {
+					conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+				} else {
+					conn.Write([]byte("stream: OK\x00"))
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// fakeICAP answers RESPMOD requests with 204, or 200 and X-Infection-Found for eicar
+func fakeICAP(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := textproto.NewReader(bufio.NewReader(conn))
+				if line, _ := r.ReadLine(); !strings.HasPrefix(line, "RESPMOD icap://") {
+					conn.Write([]byte("ICAP/1.0 400 Bad Request\r\n\r\n"))
+					return
+				}
+				r.ReadMIMEHeader() // ICAP headers
+				r.ReadLine()       // Encapsulated HTTP status line
+				r.ReadMIMEHeader() // Encapsulated HTTP response headers
+				body, _ := io.ReadAll(httpChunked(r.R))
+				if strings.Contains(string(body), eicar) {
+					conn.Write([]byte("ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Test-Signature;\r\n\r\n"))
+				} else {
+					conn.Write([]byte("ICAP/1.0 204 No Content\r\n\r\n"))
+				}
+			}(conn)
+		}
+	}()
+	return "icap://" + ln.Addr().String() + "/avscan"
+}
+
+// httpChunked decodes a chunked body up to the terminating zero-length chunk
+func httpChunked(r *bufio.Reader) io.Reader {
+	var out bytes.Buffer
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+		if err != nil || n == 0 {
+			r.ReadString('\n')
+			break
+		}
+		io.CopyN(&out, r, n)
+		r.ReadString('\n')
+	}
+	return &out
+}
+
+// TestClamAV tests clean and infected verdicts over the INSTREAM protocol
+func TestClamAV(t *testing.T) {
+	scanner := NewClamAV(fakeClamd(t))
+
+	result, err := scanner.Scan(context.Background(), strings.NewReader(strings.Repeat("a", 100000)))
+	if err != nil || result.Infected {
+		t.Fatalf("Expected clean result, got %+v, %v", result, err)
+	}
+
+	result, err = scanner.Scan(context.Background(), strings.NewReader("header "+eicar))
+	if err != nil || !result.Infected || result.Signature != "Eicar-Signature" {
+		t.Fatalf("Expected infected result, got %+v, %v", result, err)
+	}
+}
+
+// TestICAP tests clean and infected verdicts over RESPMOD
+func TestICAP(t *testing.T) {
+	scanner, err := NewICAP(fakeICAP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := scanner.Scan(context.Background(), strings.NewReader("just an image"))
+	if err != nil || result.Infected {
+		t.Fatalf("Expected clean result, got %+v, %v", result, err)
+	}
+
+	result, err = scanner.Scan(context.Background(), strings.NewReader(eicar))
+	if err != nil || !result.Infected || result.Signature != "Eicar-Test-Signature" {
+		t.Fatalf("Expected infected result, got %+v, %v", result, err)
+	}
+
+	if _, err := NewICAP("http://example.com"); err == nil {
+		t.Error("Expected error for non-icap URL")
+	}
+}
+
+// TestParseClamdReply tests the error reply of clamd
+func TestParseClamdReply(t *testing.T) {
+	if _, err := parseClamdReply("INSTREAM size limit exceeded. ERROR\x00"); err == nil {
+		t.Error("Expected error reply to fail")
+	}
+}
+
+// TestGuardQuarantine tests that flagged uploads and files are quarantined
+func TestGuardQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	guard := NewGuardWithScanner(NewClamAV(fakeClamd(t)), Config{QuarantineDir: filepath.Join(dir, "quarantine")})
+
+	if err := guard.CheckBytes(context.Background(), "photo.jpg", []byte("clean")); err != nil {
+		t.Fatalf("Expected clean upload to pass, got %v", err)
+	}
+
+	err := guard.CheckBytes(context.Background(), "photo.jpg", []byte(eicar))
+	var infected *InfectedError
+	if !errors.As(err, &infected) || !errors.Is(err, ErrInfected) {
+		t.Fatalf("Expected InfectedError, got %v", err)
+	}
+	if data, err := os.ReadFile(infected.QuarantinePath); err != nil || string(data) != eicar {
+		t.Errorf("Expected quarantined copy, got %q, %v", data, err)
+	}
+	if _, err := os.Stat(infected.QuarantinePath + ".json"); err != nil {
+		t.Errorf("Expected quarantine metadata: %v", err)
+	}
+
+	archive := filepath.Join(dir, "backup.zip")
+	os.WriteFile(archive, []byte(eicar), 0600)
+	if err := guard.CheckFile(context.Background(), "backup.zip", archive); !errors.Is(err, ErrInfected) {
+		t.Fatalf("Expected infected archive, got %v", err)
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Error("Expected archive to be moved out of place")
+	}
+}
+
+// TestGuardUnavailable tests the fail-open and fail-closed policies
+func TestGuardUnavailable(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	open := NewGuardWithScanner(NewClamAV(addr), Config{QuarantineDir: t.TempDir()})
+	if err := open.CheckBytes(context.Background(), "a.png", []byte("x")); err != nil {
+		t.Errorf("Expected fail-open guard to accept, got %v", err)
+	}
+
+	closed := NewGuardWithScanner(NewClamAV(addr), Config{QuarantineDir: t.TempDir(), FailClosed: true})
+	if err := closed.CheckBytes(context.Background(), "a.png", []byte("x")); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable, got %v", err)
+	}
+
+	var disabled *Guard
+	if err := disabled.CheckBytes(context.Background(), "a.png", []byte(eicar)); err != nil {
+		t.Errorf("Expected nil guard to accept, got %v", err)
+	}
+}
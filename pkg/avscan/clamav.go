@@ -0,0 +1,100 @@
+package avscan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the size of each INSTREAM chunk; clamd rejects chunks above StreamMaxLength
+const clamdChunkSize = 32 * 1024
+
+// ClamAV scans content through clamd's INSTREAM command
+type ClamAV struct {
+	network string
+	address string
+}
+
+// NewClamAV creates a clamd client. address is host:port or unix:/path/to/clamd.ctl
+func NewClamAV(address string) *ClamAV {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return &ClamAV{network: "unix", address: path}
+	}
+	return &ClamAV{network: "tcp", address: address}
+}
+
+// Scan streams r to clamd and parses its verdict
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamd connection failed: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+
+	w := bufio.NewWriter(conn)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return Result{}, err
+	}
+
+	buf := make([]byte, clamdChunkSize)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size, uint32(n))
+			if _, werr := w.Write(size); werr != nil {
+				return Result{}, werr
+			}
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return Result{}, werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	// A zero-length chunk terminates the stream
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := w.Write(size); err != nil {
+		return Result{}, err
+	}
+	if err := w.Flush(); err != nil {
+		return Result{}, err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && err != io.EOF {
+		return Result{}, fmt.Errorf("clamd reply: %w", err)
+	}
+	return parseClamdReply(reply)
+}
+
+// parseClamdReply parses "stream: OK", "stream: <signature> FOUND" or "<message> ERROR"
+func parseClamdReply(reply string) (Result, error) {
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	verdict := strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	default:
+		return Result{}, fmt.Errorf("clamd error: %s", reply)
+	}
+}
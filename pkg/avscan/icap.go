@@ -0,0 +1,136 @@
+package avscan
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// icapDefaultPort is the registered ICAP port
+const icapDefaultPort = "1344"
+
+// ICAP scans content by sending it as an HTTP response to an ICAP server (RESPMOD),
+// e.g. c-icap with squidclamav or a commercial anti-virus gateway
+type ICAP struct {
+	host    string
+	service *url.URL
+}
+
+// NewICAP creates an ICAP client for a service URL such as icap://av.internal:1344/avscan
+func NewICAP(address string) (*ICAP, error) {
+	u, err := url.Parse(address)
+	if err != nil || u.Scheme != "icap" || u.Host == "" {
+		return nil, fmt.Errorf("invalid ICAP service URL: %q", address)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), icapDefaultPort)
+	}
+	return &ICAP{host: host, service: u}, nil
+}
+
+// Scan sends r in a RESPMOD request. A 204 reply means the content is clean; a 200 reply
+// carrying an infection header means it was flagged
+func (c *ICAP) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.host)
+	if err != nil {
+		return Result{}, fmt.Errorf("ICAP connection failed: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(time.Minute))
+	}
+
+	httpHeader := "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\n\r\n"
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "RESPMOD %s ICAP/1.0\r\n", c.service.String())
+	fmt.Fprintf(w, "Host: %s\r\n", c.service.Host)
+	fmt.Fprintf(w, "Allow: 204\r\n")
+	fmt.Fprintf(w, "Encapsulated: res-hdr=0, res-body=%d\r\n\r\n", len(httpHeader))
+	w.WriteString(httpHeader)
+
+	buf := make([]byte, clamdChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			fmt.Fprintf(w, "%x\r\n", n)
+			w.Write(buf[:n])
+			w.WriteString("\r\n")
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	w.WriteString("0\r\n\r\n")
+	if err := w.Flush(); err != nil {
+		return Result{}, err
+	}
+
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	status, err := reader.ReadLine()
+	if err != nil {
+		return Result{}, fmt.Errorf("ICAP reply: %w", err)
+	}
+	header, err := reader.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return Result{}, fmt.Errorf("ICAP reply headers: %w", err)
+	}
+	return parseICAPReply(status, header)
+}
+
+// parseICAPReply interprets the status line and the de-facto infection headers
+// (X-Infection-Found, X-Virus-ID, X-Violations-Found)
+func parseICAPReply(status string, header textproto.MIMEHeader) (Result, error) {
+	fields := strings.Fields(status)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "ICAP/") {
+		return Result{}, fmt.Errorf("invalid ICAP status line: %q", status)
+	}
+	code, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid ICAP status line: %q", status)
+	}
+
+	switch code {
+	case 204:
+		return Result{}, nil
+	case 200:
+		if found := header.Get("X-Infection-Found"); found != "" {
+			return Result{Infected: true, Signature: icapThreat(found)}, nil
+		}
+		if id := header.Get("X-Virus-ID"); id != "" {
+			return Result{Infected: true, Signature: id}, nil
+		}
+		if header.Get("X-Violations-Found") != "" {
+			return Result{Infected: true, Signature: "policy violation"}, nil
+		}
+		// Content returned unmodified
+		return Result{}, nil
+	default:
+		return Result{}, fmt.Errorf("ICAP server error: %s", status)
+	}
+}
+
+// icapThreat extracts Threat from "Type=0; Resolution=2; Threat=Eicar-Test-Signature;"
+func icapThreat(value string) string {
+	for _, part := range strings.Split(value, ";") {
+		if threat, ok := strings.CutPrefix(strings.TrimSpace(part), "Threat="); ok {
+			return threat
+		}
+	}
+	return value
+}
@@ -0,0 +1,34 @@
+// Package billing computes the usage beyond the plan allowances and reports it to the
+// billing provider, which turns it into invoice line items
+package billing
+
+import (
+	"context"
+	"time"
+)
+
+// Allowances maps plan IDs to the QR scans included each month. Plans missing from the map
+// have no limit
+type Allowances map[string]int64
+
+// Included returns the scans included in the plan and whether the plan is limited
+func (a Allowances) Included(planID string) (int64, bool) {
+	included, ok := a[planID]
+	return included, ok
+}
+
+// Overage returns the scans beyond the allowance of the plan
+func (a Allowances) Overage(planID string, scans int64) int64 {
+	included, limited := a.Included(planID)
+	if !limited || scans <= included {
+		return 0
+	}
+	return scans - included
+}
+
+// Reporter sends metered usage to the billing provider
+type Reporter interface {
+	// ReportUsage adds quantity units to the customer's usage at the given time. Calls with
+	// the same identifier are counted once, so a failed report can be retried safely
+	ReportUsage(ctx context.Context, customerID, identifier string, quantity int64, at time.Time) error
+}
@@ -0,0 +1,76 @@
+package billing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/billing/meterevent"
+)
+
+func TestOverage(t *testing.T) {
+	allowances := Allowances{"free": 1000, "pro": 50000}
+
+	tests := []struct {
+		plan  string
+		scans int64
+		want  int64
+	}{
+		{"free", 999, 0},
+		{"free", 1000, 0},
+		{"free", 1250, 250},
+		{"pro", 50001, 1},
+		{"enterprise", 1000000, 0}, // Not listed: unlimited
+	}
+	for _, tt := range tests {
+		if got := allowances.Overage(tt.plan, tt.scans); got != tt.want {
+			t.Errorf("Overage(%s, %d) = %d, want %d", tt.plan, tt.scans, got, tt.want)
+		}
+	}
+}
+
+func TestStripeReporter(t *testing.T) {
+	var form map[string][]string
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/billing/meter_events" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		r.ParseForm()
+		form = r.PostForm
+		auth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object": "billing.meter_event", "event_name": "qr_scan_overage"}`))
+	}))
+	defer srv.Close()
+
+	backend := stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+		URL:               stripe.String(srv.URL),
+		MaxNetworkRetries: stripe.Int64(0),
+	})
+	reporter := &StripeReporter{client: meterevent.Client{B: backend, Key: "sk_test_123"}, eventName: "qr_scan_overage"}
+
+	at := time.Date(2026, 10, 31, 12, 0, 0, 0, time.UTC)
+	if err := reporter.ReportUsage(context.Background(), "cus_1", "r1-2026-10-250", 250, at); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"event_name":                  "qr_scan_overage",
+		"identifier":                  "r1-2026-10-250",
+		"payload[stripe_customer_id]": "cus_1",
+		"payload[value]":              "250",
+		"timestamp":                   "1793448000",
+	}
+	for key, value := range want {
+		if got := form[key]; len(got) != 1 || got[0] != value {
+			t.Errorf("%s = %v, want %s", key, got, value)
+		}
+	}
+	if auth != "Bearer sk_test_123" {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
@@ -0,0 +1,130 @@
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/checkout/session"
+	"github.com/stripe/stripe-go/v79/webhook"
+)
+
+// CheckoutRequest describes a one-off payment on a hosted payment page, such as a gift
+// voucher bought by a diner
+type CheckoutRequest struct {
+	Description   string // Shown to the buyer on the payment page
+	AmountCents   int64
+	Currency      string // ISO 4217, e.g. EUR
+	CustomerEmail string // Optional: prefills the payment page
+	SuccessURL    string // {CHECKOUT_SESSION_ID} is replaced with the session ID
+	CancelURL     string
+	Metadata      map[string]string // Returned with the completed payment
+}
+
+// CheckoutSession is a hosted payment page the buyer is redirected to
+type CheckoutSession struct {
+	ID        string
+	URL       string
+	ExpiresAt time.Time
+}
+
+// CompletedCheckout is a paid checkout session notified by the provider
+type CompletedCheckout struct {
+	SessionID     string
+	PaymentID     string // Payment to refund, e.g. the Stripe PaymentIntent
+	AmountCents   int64
+	Currency      string // Upper case
+	CustomerEmail string
+	Metadata      map[string]string
+}
+
+// Checkout takes one-off payments through the billing provider
+type Checkout interface {
+	// CreateCheckout opens a payment page for the request
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (*CheckoutSession, error)
+	// ParseWebhook verifies the signature of a provider webhook and returns the checkout it
+	// reports as paid; nil, without error, for any other event
+	ParseWebhook(payload []byte, signature string) (*CompletedCheckout, error)
+}
+
+// StripeCheckout takes payments with Stripe Checkout and reads their outcome from the
+// checkout.session.completed webhooks
+type StripeCheckout struct {
+	client        session.Client
+	webhookSecret string
+}
+
+// NewStripeCheckout creates a checkout with the API key and the signing secret of the
+// webhook endpoint
+func NewStripeCheckout(secretKey, webhookSecret string) *StripeCheckout {
+	return &StripeCheckout{
+		client:        session.Client{B: stripe.GetBackend(stripe.APIBackend), Key: secretKey},
+		webhookSecret: webhookSecret,
+	}
+}
+
+// CreateCheckout implements Checkout
+func (s *StripeCheckout) CreateCheckout(ctx context.Context, req CheckoutRequest) (*CheckoutSession, error) {
+	params := &stripe.CheckoutSessionParams{
+		Mode:       stripe.String(string(stripe.CheckoutSessionModePayment)),
+		SuccessURL: stripe.String(req.SuccessURL),
+		CancelURL:  stripe.String(req.CancelURL),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{{
+			Quantity: stripe.Int64(1),
+			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+				Currency:    stripe.String(strings.ToLower(req.Currency)),
+				UnitAmount:  stripe.Int64(req.AmountCents),
+				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{Name: stripe.String(req.Description)},
+			},
+		}},
+		Metadata: req.Metadata,
+	}
+	if req.CustomerEmail != "" {
+		params.CustomerEmail = stripe.String(req.CustomerEmail)
+	}
+	params.Context = ctx
+
+	cs, err := s.client.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckoutSession{ID: cs.ID, URL: cs.URL, ExpiresAt: time.Unix(cs.ExpiresAt, 0)}, nil
+}
+
+// ParseWebhook implements Checkout. Sessions paid with delayed methods are reported by
+// checkout.session.async_payment_succeeded once the payment clears
+func (s *StripeCheckout) ParseWebhook(payload []byte, signature string) (*CompletedCheckout, error) {
+	event, err := webhook.ConstructEventWithOptions(payload, signature, s.webhookSecret,
+		webhook.ConstructEventOptions{IgnoreAPIVersionMismatch: true})
+	if err != nil {
+		return nil, err
+	}
+	if event.Type != "checkout.session.completed" && event.Type != "checkout.session.async_payment_succeeded" {
+		return nil, nil
+	}
+
+	var cs stripe.CheckoutSession
+	if err := json.Unmarshal(event.Data.Raw, &cs); err != nil {
+		return nil, fmt.Errorf("invalid checkout session in event %s: %v", event.ID, err)
+	}
+	if cs.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+		return nil, nil
+	}
+	completed := &CompletedCheckout{
+		SessionID:     cs.ID,
+		AmountCents:   cs.AmountTotal,
+		Currency:      strings.ToUpper(string(cs.Currency)),
+		CustomerEmail: cs.CustomerEmail,
+		Metadata:      cs.Metadata,
+	}
+	if cs.PaymentIntent != nil {
+		completed.PaymentID = cs.PaymentIntent.ID
+	}
+	if cs.CustomerDetails != nil && cs.CustomerDetails.Email != "" {
+		completed.CustomerEmail = cs.CustomerDetails.Email
+	}
+	return completed, nil
+}
@@ -0,0 +1,97 @@
+package billing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/checkout/session"
+	"github.com/stripe/stripe-go/v79/webhook"
+)
+
+func TestStripeCheckoutCreate(t *testing.T) {
+	var form map[string][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/checkout/sessions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		r.ParseForm()
+		form = r.PostForm
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object": "checkout.session", "id": "cs_1", "url": "https://checkout.stripe.com/c/cs_1", "expires_at": 1793448000}`))
+	}))
+	defer srv.Close()
+
+	backend := stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+		URL:               stripe.String(srv.URL),
+		MaxNetworkRetries: stripe.Int64(0),
+	})
+	checkout := &StripeCheckout{client: session.Client{B: backend, Key: "sk_test_123"}}
+
+	cs, err := checkout.CreateCheckout(context.Background(), CheckoutRequest{
+		Description: "Buono regalo",
+		AmountCents: 5000,
+		Currency:    "EUR",
+		SuccessURL:  "https://menu.example.com/voucher/v1?session_id={CHECKOUT_SESSION_ID}",
+		CancelURL:   "https://menu.example.com/r/mario",
+		Metadata:    map[string]string{"voucher_id": "v1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs.ID != "cs_1" || cs.URL != "https://checkout.stripe.com/c/cs_1" || cs.ExpiresAt.Unix() != 1793448000 {
+		t.Errorf("session = %+v", cs)
+	}
+
+	want := map[string]string{
+		"mode":                                          "payment",
+		"line_items[0][quantity]":                       "1",
+		"line_items[0][price_data][currency]":           "eur",
+		"line_items[0][price_data][unit_amount]":        "5000",
+		"line_items[0][price_data][product_data][name]": "Buono regalo",
+		"metadata[voucher_id]":                          "v1",
+	}
+	for key, value := range want {
+		if got := form[key]; len(got) != 1 || got[0] != value {
+			t.Errorf("%s = %v, want %s", key, got, value)
+		}
+	}
+	if _, ok := form["customer_email"]; ok {
+		t.Error("customer_email sent without an email")
+	}
+}
+
+func TestStripeCheckoutParseWebhook(t *testing.T) {
+	checkout := NewStripeCheckout("sk_test_123", "whsec_test")
+	sign := func(payload string) (string, []byte) {
+		signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: []byte(payload), Secret: "whsec_test"})
+		return signed.Header, signed.Payload
+	}
+
+	header, payload := sign(`{"id": "evt_1", "type": "checkout.session.completed", "data": {"object": {"id": "cs_1", "payment_status": "paid", "payment_intent": "pi_1", "amount_total": 5000, "currency": "eur", "customer_details": {"email": "anna@example.com"}, "metadata": {"voucher_id": "v1"}}}}`)
+	completed, err := checkout.ParseWebhook(payload, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed == nil || completed.SessionID != "cs_1" || completed.PaymentID != "pi_1" || completed.AmountCents != 5000 || completed.Currency != "EUR" ||
+		completed.CustomerEmail != "anna@example.com" || completed.Metadata["voucher_id"] != "v1" {
+		t.Errorf("completed = %+v", completed)
+	}
+
+	// Pagamento ancora in corso ed eventi di altro tipo vengono ignorati
+	for _, body := range []string{
+		`{"id": "evt_2", "type": "checkout.session.completed", "data": {"object": {"id": "cs_2", "payment_status": "unpaid"}}}`,
+		`{"id": "evt_3", "type": "customer.created", "data": {"object": {"id": "cus_1"}}}`,
+	} {
+		header, payload := sign(body)
+		if completed, err := checkout.ParseWebhook(payload, header); err != nil || completed != nil {
+			t.Errorf("ParseWebhook(%s) = %+v, %v", body, completed, err)
+		}
+	}
+
+	if _, err := checkout.ParseWebhook(payload, "t=1,v1=deadbeef"); err == nil {
+		t.Error("accepted a webhook with an invalid signature")
+	}
+}
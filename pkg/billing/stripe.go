@@ -0,0 +1,41 @@
+package billing
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/billing/meterevent"
+)
+
+// StripeReporter reports usage as events of a Stripe billing meter. The meter aggregates the
+// events of the period into the metered price of the customer's subscription
+type StripeReporter struct {
+	client    meterevent.Client
+	eventName string
+}
+
+// NewStripeReporter creates a reporter for the meter with the given event name
+func NewStripeReporter(secretKey, eventName string) *StripeReporter {
+	return &StripeReporter{
+		client:    meterevent.Client{B: stripe.GetBackend(stripe.APIBackend), Key: secretKey},
+		eventName: eventName,
+	}
+}
+
+// ReportUsage implements Reporter
+func (s *StripeReporter) ReportUsage(ctx context.Context, customerID, identifier string, quantity int64, at time.Time) error {
+	params := &stripe.BillingMeterEventParams{
+		EventName:  stripe.String(s.eventName),
+		Identifier: stripe.String(identifier),
+		Payload: map[string]string{
+			"stripe_customer_id": customerID,
+			"value":              strconv.FormatInt(quantity, 10),
+		},
+		Timestamp: stripe.Int64(at.Unix()),
+	}
+	params.Context = ctx
+	_, err := s.client.New(params)
+	return err
+}
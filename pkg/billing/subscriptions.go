@@ -0,0 +1,41 @@
+package billing
+
+import (
+	"context"
+	"errors"
+
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/subscription"
+)
+
+// Canceler cancels subscriptions at the billing provider
+type Canceler interface {
+	// CancelSubscription ends the subscription immediately, with no further invoices.
+	// Subscriptions the provider no longer knows count as canceled, so a failed call can be
+	// retried safely
+	CancelSubscription(ctx context.Context, subscriptionID string) error
+}
+
+// StripeSubscriptions cancels Stripe subscriptions
+type StripeSubscriptions struct {
+	client subscription.Client
+}
+
+// NewStripeSubscriptions creates a Canceler for the Stripe account of the secret key
+func NewStripeSubscriptions(secretKey string) *StripeSubscriptions {
+	return &StripeSubscriptions{
+		client: subscription.Client{B: stripe.GetBackend(stripe.APIBackend), Key: secretKey},
+	}
+}
+
+// CancelSubscription implements Canceler
+func (s *StripeSubscriptions) CancelSubscription(ctx context.Context, subscriptionID string) error {
+	params := &stripe.SubscriptionCancelParams{}
+	params.Context = ctx
+	_, err := s.client.Cancel(subscriptionID, params)
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.Code == stripe.ErrorCodeResourceMissing {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package billing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/subscription"
+)
+
+func TestStripeSubscriptionsCancel(t *testing.T) {
+	var method, path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/subscriptions/sub_1":
+			w.Write([]byte(`{"id": "sub_1", "object": "subscription", "status": "canceled"}`))
+		case "/v1/subscriptions/sub_gone":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"type": "invalid_request_error", "code": "resource_missing", "message": "No such subscription"}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": {"type": "invalid_request_error", "message": "Invalid request"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	backend := stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+		URL:               stripe.String(srv.URL),
+		MaxNetworkRetries: stripe.Int64(0),
+	})
+	canceler := &StripeSubscriptions{client: subscription.Client{B: backend, Key: "sk_test_123"}}
+
+	if err := canceler.CancelSubscription(context.Background(), "sub_1"); err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodDelete || path != "/v1/subscriptions/sub_1" {
+		t.Errorf("request = %s %s, want DELETE /v1/subscriptions/sub_1", method, path)
+	}
+	if err := canceler.CancelSubscription(context.Background(), "sub_gone"); err != nil {
+		t.Errorf("missing subscription: got %v, want nil", err)
+	}
+	if err := canceler.CancelSubscription(context.Background(), "sub_bad"); err == nil {
+		t.Error("expected an error from a failed request")
+	}
+}
@@ -0,0 +1,238 @@
+// Package bots runs the chat bots through which restaurant owners follow their restaurant
+// from a messaging app. A Bot dispatches the commands and the inline button presses of the
+// chats to the registered handlers and turns the events of the bus into messages, so the
+// application only decides what to say and to whom. Telegram is the supported platform.
+package bots
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"qr-menu/logger"
+	"qr-menu/pkg/events"
+	"qr-menu/pkg/metrics"
+)
+
+// MaxActionData is the longest callback data Telegram accepts for an inline button, in bytes
+const MaxActionData = 64
+
+var (
+	// ErrChatUnavailable is matched (with errors.Is) by send errors of chats that blocked the
+	// bot or no longer exist
+	ErrChatUnavailable = errors.New("chat unavailable")
+	// ErrUnauthenticated is returned for webhook requests without the right secret
+	ErrUnauthenticated = errors.New("webhook secret missing or invalid")
+)
+
+var sent = metrics.NewCounter("qrmenu_bot_messages_total",
+	"Bot messages by kind (reply, action or the subscriber name of event notices) and result (sent, failed or unavailable).", "kind", "result")
+
+// Chat is the conversation of a user with the bot
+type Chat struct {
+	ID       int64
+	Private  bool   // One-to-one chat rather than a group
+	Username string // Without the leading @, may be empty
+	Name     string
+	Language string // IETF language tag of the user's app, e.g. it
+}
+
+// Update is a message or an inline button press received by the bot
+type Update struct {
+	ID         int64
+	Chat       Chat
+	Text       string
+	CallbackID string // Set for inline button presses
+	MessageID  int    // Message whose button was pressed
+	Data       string // Callback data of the pressed button
+}
+
+// Button is an inline button. Data is built with ActionData
+type Button struct {
+	Text string
+	Data string
+}
+
+// Reply is a text message with optional rows of inline buttons
+type Reply struct {
+	Text    string
+	Buttons [][]Button
+}
+
+// CommandHandler answers a /command; args is the text after the command
+type CommandHandler func(ctx context.Context, chat Chat, args string) (Reply, error)
+
+// ActionHandler handles the press of an inline button of the action. It returns the notice
+// shown to the user and, if not nil, the buttons that replace those of the message
+type ActionHandler func(ctx context.Context, chat Chat, args string) (notice string, buttons [][]Button, err error)
+
+// Notice is a message for a chat
+type Notice struct {
+	ChatID int64
+	Reply  Reply
+}
+
+// Notifier turns an event into the messages for the chats that should receive it
+type Notifier func(ctx context.Context, event events.Event) ([]Notice, error)
+
+// Bot dispatches updates to its handlers. Handlers must be registered before the bot serves
+// its webhook
+type Bot struct {
+	client   *Telegram
+	commands map[string]CommandHandler
+	actions  map[string]ActionHandler
+	fallback CommandHandler
+
+	// OnUnavailable, if set, is called when a chat blocked the bot or no longer exists, so
+	// the application can forget it
+	OnUnavailable func(ctx context.Context, chatID int64)
+}
+
+// New creates a bot without handlers
+func New(client *Telegram) *Bot {
+	return &Bot{client: client, commands: map[string]CommandHandler{}, actions: map[string]ActionHandler{}}
+}
+
+// Client returns the Telegram client of the bot
+func (b *Bot) Client() *Telegram {
+	return b.client
+}
+
+// Command registers the handler of /name
+func (b *Bot) Command(name string, handler CommandHandler) {
+	b.commands[strings.ToLower(name)] = handler
+}
+
+// Fallback registers the handler of text messages and unknown commands, which receives the
+// whole text as args
+func (b *Bot) Fallback(handler CommandHandler) {
+	b.fallback = handler
+}
+
+// Action registers the handler of the inline buttons built with ActionData(name, ...)
+func (b *Bot) Action(name string, handler ActionHandler) {
+	b.actions[name] = handler
+}
+
+// ActionData returns the callback data of a button of the action name. It returns an error
+// if the data is longer than MaxActionData
+func ActionData(name, args string) (string, error) {
+	data := name + ":" + args
+	if len(data) > MaxActionData {
+		return "", fmt.Errorf("bots: callback data of %s longer than %d bytes", name, MaxActionData)
+	}
+	return data, nil
+}
+
+// Send sends reply to a chat
+func (b *Bot) Send(ctx context.Context, chatID int64, reply Reply) error {
+	return b.send(ctx, "message", chatID, reply)
+}
+
+func (b *Bot) send(ctx context.Context, kind string, chatID int64, reply Reply) error {
+	_, err := b.client.Send(ctx, chatID, reply)
+	b.record(ctx, kind, chatID, err)
+	return err
+}
+
+// record counts the result of a call to a chat and forgets the chats that blocked the bot
+func (b *Bot) record(ctx context.Context, kind string, chatID int64, err error) {
+	switch {
+	case errors.Is(err, ErrChatUnavailable):
+		sent.Inc(kind, "unavailable")
+		if b.OnUnavailable != nil {
+			b.OnUnavailable(ctx, chatID)
+		}
+	case err != nil:
+		sent.Inc(kind, "failed")
+	default:
+		sent.Inc(kind, "sent")
+	}
+}
+
+// Subscribe sends the messages built by notifier for the events of the given types published
+// by this instance. The name identifies the subscriber in logs and metrics
+func (b *Bot) Subscribe(bus *events.Bus, name string, notifier Notifier, types ...string) {
+	bus.Subscribe(name, func(ctx context.Context, event events.Event) error {
+		notices, err := notifier(ctx, event)
+		if err != nil {
+			return err
+		}
+		var errs []error
+		for _, n := range notices {
+			if err := b.send(ctx, name, n.ChatID, n.Reply); err != nil && !errors.Is(err, ErrChatUnavailable) {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}, types...)
+}
+
+// ServeHTTP is the webhook endpoint of the bot. Handler errors are logged and answered with
+// 200 all the same, since Telegram would otherwise retry the update
+func (b *Bot) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	update, err := b.client.ParseUpdate(r)
+	if errors.Is(err, ErrUnauthenticated) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "invalid update", http.StatusBadRequest)
+		return
+	}
+	if update.Chat.ID != 0 {
+		if err := b.Handle(r.Context(), update); err != nil {
+			logger.ErrorCtx(r.Context(), "Bot update failed", map[string]interface{}{
+				"error":     err.Error(),
+				"update_id": update.ID,
+			})
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// Handle dispatches an update to its handler and sends the answer
+func (b *Bot) Handle(ctx context.Context, update *Update) error {
+	if update.CallbackID != "" {
+		return b.handleAction(ctx, update)
+	}
+
+	handler, args := b.fallback, strings.TrimSpace(update.Text)
+	if strings.HasPrefix(args, "/") {
+		name, rest, _ := strings.Cut(args[1:], " ")
+		name, _, _ = strings.Cut(name, "@") // /start@bot_name in groups
+		if h, ok := b.commands[strings.ToLower(name)]; ok {
+			handler, args = h, strings.TrimSpace(rest)
+		}
+	}
+	if handler == nil {
+		return nil
+	}
+	reply, err := handler(ctx, update.Chat, args)
+	if err != nil {
+		return err
+	}
+	if reply.Text == "" {
+		return nil
+	}
+	return b.send(ctx, "reply", update.Chat.ID, reply)
+}
+
+func (b *Bot) handleAction(ctx context.Context, update *Update) error {
+	name, args, _ := strings.Cut(update.Data, ":")
+	handler, ok := b.actions[name]
+	if !ok {
+		return b.client.AnswerCallback(ctx, update.CallbackID, "")
+	}
+	notice, buttons, err := handler(ctx, update.Chat, args)
+	if aerr := b.client.AnswerCallback(ctx, update.CallbackID, notice); err == nil {
+		err = aerr
+	}
+	if err == nil && buttons != nil {
+		err = b.client.EditButtons(ctx, update.Chat.ID, update.MessageID, buttons)
+		b.record(ctx, "action", update.Chat.ID, err)
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+package bots
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"qr-menu/pkg/events"
+)
+
+// fakeAPI records the Bot API calls and answers them like Telegram
+type fakeAPI struct {
+	mu    sync.Mutex
+	calls []map[string]interface{}
+}
+
+func (f *fakeAPI) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/botTOKEN/") {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var params map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&params)
+		params["method"] = strings.TrimPrefix(r.URL.Path, "/botTOKEN/")
+		f.mu.Lock()
+		f.calls = append(f.calls, params)
+		f.mu.Unlock()
+
+		if params["chat_id"] == float64(403) {
+			io.WriteString(w, `{"ok": false, "error_code": 403, "description": "Forbidden: bot was blocked by the user"}`)
+			return
+		}
+		io.WriteString(w, `{"ok": true, "result": {"message_id": 7}}`)
+	})
+}
+
+func (f *fakeAPI) methods() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var methods []string
+	for _, c := range f.calls {
+		methods = append(methods, c["method"].(string))
+	}
+	return methods
+}
+
+func newTestBot(t *testing.T) (*Bot, *fakeAPI) {
+	api := &fakeAPI{}
+	srv := httptest.NewServer(api.handler(t))
+	t.Cleanup(srv.Close)
+	return New(NewTelegram(TelegramConfig{Token: "TOKEN", WebhookSecret: "secret", APIBase: srv.URL})), api
+}
+
+func postUpdate(bot *Bot, secret, body string) int {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+	rec := httptest.NewRecorder()
+	bot.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestCommands(t *testing.T) {
+	bot, api := newTestBot(t)
+	var gotArgs string
+	bot.Command("start", func(ctx context.Context, chat Chat, args string) (Reply, error) {
+		gotArgs = args
+		data, _ := ActionData("avail", "item-1")
+		return Reply{Text: "hello " + chat.Name, Buttons: [][]Button{{{Text: "OK", Data: data}}}}, nil
+	})
+	bot.Fallback(func(ctx context.Context, chat Chat, args string) (Reply, error) {
+		return Reply{Text: "?"}, nil
+	})
+
+	if code := postUpdate(bot, "wrong", `{}`); code != http.StatusUnauthorized {
+		t.Fatalf("wrong secret answered %d", code)
+	}
+	body := `{"update_id": 1, "message": {"chat": {"id": 42, "type": "private", "first_name": "Mario"}, "from": {"language_code": "it"}, "text": "/start@qrmenu_bot ABC123"}}`
+	if code := postUpdate(bot, "secret", body); code != http.StatusOK {
+		t.Fatalf("update answered %d", code)
+	}
+	if gotArgs != "ABC123" {
+		t.Errorf("args = %q", gotArgs)
+	}
+	call := api.calls[0]
+	if call["method"] != "sendMessage" || call["chat_id"] != float64(42) || call["text"] != "hello Mario" {
+		t.Errorf("unexpected call %v", call)
+	}
+	markup := call["reply_markup"].(map[string]interface{})["inline_keyboard"].([]interface{})
+	if markup[0].([]interface{})[0].(map[string]interface{})["callback_data"] != "avail:item-1" {
+		t.Errorf("unexpected keyboard %v", markup)
+	}
+
+	postUpdate(bot, "secret", `{"update_id": 2, "message": {"chat": {"id": 42}, "text": "/unknown"}}`)
+	if api.calls[1]["text"] != "?" {
+		t.Errorf("unknown command should reach the fallback: %v", api.calls[1])
+	}
+}
+
+func TestActions(t *testing.T) {
+	bot, api := newTestBot(t)
+	bot.Action("avail", func(ctx context.Context, chat Chat, args string) (string, [][]Button, error) {
+		if args != "item-1" {
+			t.Errorf("args = %q", args)
+		}
+		return "done", [][]Button{{{Text: "❌", Data: "avail:item-1"}}}, nil
+	})
+
+	body := `{"update_id": 3, "callback_query": {"id": "cb1", "data": "avail:item-1", "message": {"message_id": 9, "chat": {"id": 42}}}}`
+	postUpdate(bot, "secret", body)
+	if methods := api.methods(); strings.Join(methods, ",") != "answerCallbackQuery,editMessageReplyMarkup" {
+		t.Fatalf("methods = %v", methods)
+	}
+	if api.calls[0]["text"] != "done" || api.calls[1]["message_id"] != float64(9) {
+		t.Errorf("unexpected calls %v", api.calls)
+	}
+
+	if _, err := ActionData("avail", strings.Repeat("x", MaxActionData)); err == nil {
+		t.Error("expected an error for oversized callback data")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	bot, api := newTestBot(t)
+	var forgotten []int64
+	bot.OnUnavailable = func(ctx context.Context, chatID int64) { forgotten = append(forgotten, chatID) }
+
+	bus := events.NewBus(time.Second)
+	done := make(chan error, 1)
+	bot.Subscribe(bus, "test", func(ctx context.Context, event events.Event) ([]Notice, error) {
+		defer func() { done <- nil }()
+		reply := Reply{Text: "order " + event.Data["number"].(string)}
+		return []Notice{{ChatID: 42, Reply: reply}, {ChatID: 403, Reply: reply}}, nil
+	}, events.OrderCreated)
+
+	bus.Publish(events.Event{Type: events.OrderCreated, RestaurantID: "r1", Data: map[string]interface{}{"number": "A1"}})
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("notifier not called")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(api.methods()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	bus.Close(context.Background())
+	if len(api.calls) != 2 || api.calls[0]["text"] != "order A1" {
+		t.Fatalf("unexpected calls %v", api.calls)
+	}
+	if len(forgotten) != 1 || forgotten[0] != 403 {
+		t.Errorf("forgotten = %v", forgotten)
+	}
+}
+
+func TestSendErrors(t *testing.T) {
+	bot, _ := newTestBot(t)
+	if err := bot.Client().AnswerCallback(context.Background(), "cb", ""); err != nil {
+		t.Fatal(err)
+	}
+	_, err := bot.Client().Send(context.Background(), 403, Reply{Text: "x"})
+	if !errors.Is(err, ErrChatUnavailable) {
+		t.Errorf("blocked chat: %v", err)
+	}
+	down := NewTelegram(TelegramConfig{Token: "TOKEN", APIBase: "http://127.0.0.1:1"})
+	if _, err := down.Send(context.Background(), 1, Reply{Text: "x"}); err == nil || strings.Contains(err.Error(), "TOKEN") {
+		t.Errorf("transport errors must not leak the token: %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package bots
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTelegramAPI is the endpoint of the Telegram Bot API
+const DefaultTelegramAPI = "https://api.telegram.org"
+
+// TelegramConfig holds the credentials of a Telegram bot
+type TelegramConfig struct {
+	Token         string        // Issued by @BotFather
+	WebhookSecret string        // Sent back by Telegram in X-Telegram-Bot-Api-Secret-Token
+	APIBase       string        // Defaults to DefaultTelegramAPI
+	Timeout       time.Duration // Defaults to 30 seconds
+}
+
+// Telegram is a client of the Telegram Bot API that receives updates through a webhook
+type Telegram struct {
+	token  string
+	secret string
+	base   string
+	http   *http.Client
+}
+
+// NewTelegram creates a Telegram Bot API client
+func NewTelegram(cfg TelegramConfig) *Telegram {
+	if cfg.APIBase == "" {
+		cfg.APIBase = DefaultTelegramAPI
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return &Telegram{
+		token:  cfg.Token,
+		secret: cfg.WebhookSecret,
+		base:   strings.TrimRight(cfg.APIBase, "/"),
+		http:   &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// call invokes a Bot API method and decodes its result into result, if not nil
+func (t *Telegram) call(ctx context.Context, method string, params map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.base+"/bot"+t.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.http.Do(req)
+	if err != nil {
+		// The URL contains the token: keep it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("telegram %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		ErrorCode   int             `json:"error_code"`
+		Description string          `json:"description"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("telegram %s: HTTP %d", method, resp.StatusCode)
+	}
+	if !envelope.OK {
+		err := fmt.Errorf("telegram %s: %d %s", method, envelope.ErrorCode, envelope.Description)
+		if envelope.ErrorCode == http.StatusForbidden ||
+			(envelope.ErrorCode == http.StatusBadRequest && strings.Contains(envelope.Description, "chat not found")) {
+			return fmt.Errorf("%w: %w", ErrChatUnavailable, err)
+		}
+		return err
+	}
+	if result != nil {
+		return json.Unmarshal(envelope.Result, result)
+	}
+	return nil
+}
+
+// keyboard encodes buttons as an inline keyboard
+func keyboard(buttons [][]Button) map[string]interface{} {
+	rows := make([][]map[string]string, 0, len(buttons))
+	for _, row := range buttons {
+		cells := make([]map[string]string, 0, len(row))
+		for _, b := range row {
+			cells = append(cells, map[string]string{"text": b.Text, "callback_data": b.Data})
+		}
+		rows = append(rows, cells)
+	}
+	return map[string]interface{}{"inline_keyboard": rows}
+}
+
+// Send sends reply to the chat as plain text and returns the ID of the message
+func (t *Telegram) Send(ctx context.Context, chatID int64, reply Reply) (int, error) {
+	params := map[string]interface{}{
+		"chat_id":                  chatID,
+		"text":                     reply.Text,
+		"disable_web_page_preview": true,
+	}
+	if len(reply.Buttons) > 0 {
+		params["reply_markup"] = keyboard(reply.Buttons)
+	}
+	var msg struct {
+		MessageID int `json:"message_id"`
+	}
+	err := t.call(ctx, "sendMessage", params, &msg)
+	return msg.MessageID, err
+}
+
+// EditButtons replaces the inline keyboard of a message sent by the bot
+func (t *Telegram) EditButtons(ctx context.Context, chatID int64, messageID int, buttons [][]Button) error {
+	err := t.call(ctx, "editMessageReplyMarkup", map[string]interface{}{
+		"chat_id":      chatID,
+		"message_id":   messageID,
+		"reply_markup": keyboard(buttons),
+	}, nil)
+	if err != nil && strings.Contains(err.Error(), "message is not modified") {
+		return nil
+	}
+	return err
+}
+
+// AnswerCallback acknowledges the press of an inline button, showing text as a notice
+func (t *Telegram) AnswerCallback(ctx context.Context, callbackID, text string) error {
+	return t.call(ctx, "answerCallbackQuery", map[string]interface{}{
+		"callback_query_id": callbackID,
+		"text":              text,
+	}, nil)
+}
+
+// SetWebhook registers url as the endpoint of the updates, signed with the webhook secret
+func (t *Telegram) SetWebhook(ctx context.Context, url string) error {
+	return t.call(ctx, "setWebhook", map[string]interface{}{
+		"url":             url,
+		"secret_token":    t.secret,
+		"allowed_updates": []string{"message", "callback_query"},
+	}, nil)
+}
+
+// SetCommands registers the command menu shown by the Telegram apps, by command name
+func (t *Telegram) SetCommands(ctx context.Context, commands [][2]string) error {
+	list := make([]map[string]string, 0, len(commands))
+	for _, c := range commands {
+		list = append(list, map[string]string{"command": c[0], "description": c[1]})
+	}
+	return t.call(ctx, "setMyCommands", map[string]interface{}{"commands": list}, nil)
+}
+
+// ParseUpdate verifies the secret of a webhook request and decodes its update. Updates
+// other than messages and inline button presses are returned with a zero Chat.ID
+func (t *Telegram) ParseUpdate(r *http.Request) (*Update, error) {
+	if t.secret == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(t.secret)) != 1 {
+		return nil, ErrUnauthenticated
+	}
+	type chat struct {
+		ID        int64  `json:"id"`
+		Type      string `json:"type"`
+		Username  string `json:"username"`
+		FirstName string `json:"first_name"`
+	}
+	type user struct {
+		LanguageCode string `json:"language_code"`
+	}
+	var payload struct {
+		UpdateID int64 `json:"update_id"`
+		Message  *struct {
+			Chat chat   `json:"chat"`
+			From user   `json:"from"`
+			Text string `json:"text"`
+		} `json:"message"`
+		CallbackQuery *struct {
+			ID      string `json:"id"`
+			From    user   `json:"from"`
+			Data    string `json:"data"`
+			Message *struct {
+				MessageID int  `json:"message_id"`
+				Chat      chat `json:"chat"`
+			} `json:"message"`
+		} `json:"callback_query"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("telegram: invalid update: %w", err)
+	}
+
+	update := &Update{ID: payload.UpdateID}
+	switch {
+	case payload.Message != nil:
+		m := payload.Message
+		update.Chat = Chat{ID: m.Chat.ID, Private: m.Chat.Type == "private", Username: m.Chat.Username, Name: m.Chat.FirstName, Language: m.From.LanguageCode}
+		update.Text = m.Text
+	case payload.CallbackQuery != nil && payload.CallbackQuery.Message != nil:
+		q := payload.CallbackQuery
+		c := q.Message.Chat
+		update.Chat = Chat{ID: c.ID, Private: c.Type == "private", Username: c.Username, Name: c.FirstName, Language: q.From.LanguageCode}
+		update.CallbackID = q.ID
+		update.MessageID = q.Message.MessageID
+		update.Data = q.Data
+	}
+	return update, nil
+}
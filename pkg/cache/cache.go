@@ -62,25 +62,22 @@ func NewInMemoryCache() *InMemoryCache {
 	return cache
 }
 
-// Get retrieves a value from cache
+// Get retrieves a value from cache. It takes the write lock because it updates the
+// access stats and removes expired entries
 func (c *InMemoryCache) Get(key string) (interface{}, bool) {
-	c.mu.RLock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	entry, exists := c.items[key]
 	if !exists {
-		c.mu.RUnlock()
-		c.mu.Lock()
 		c.stats.Misses++
-		c.mu.Unlock()
 		return nil, false
 	}
 
 	// Check if expired
 	if time.Now().After(entry.ExpiresAt) {
-		c.mu.RUnlock()
-		c.mu.Lock()
 		delete(c.items, key)
 		c.stats.Misses++
-		c.mu.Unlock()
 		return nil, false
 	}
 
@@ -88,7 +85,6 @@ func (c *InMemoryCache) Get(key string) (interface{}, bool) {
 	entry.AccessedAt = time.Now()
 	entry.HitCount++
 	c.stats.Hits++
-	c.mu.RUnlock()
 
 	return entry.Value, true
 }
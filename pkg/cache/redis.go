@@ -0,0 +1,234 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisTimeout bounds every cache command: a slow Redis must not slow down the requests
+const redisTimeout = 2 * time.Second
+
+// TaggedCache is implemented by caches shared between instances. The invalidation indexes
+// (which keys depend on a table) are stored with the values, so a mutation served by any
+// instance invalidates the entries cached by all of them
+type TaggedCache interface {
+	Cache
+
+	// SetTagged stores a value and adds its key to the given tags
+	SetTagged(key string, value interface{}, ttl time.Duration, tags ...string)
+
+	// InvalidateTag removes the values stored with the tag
+	InvalidateTag(tag string)
+}
+
+// RegisterType registers the concrete type of the values stored in a RedisCache, which are
+// serialized with encoding/gob. Basic types, maps and slices of basic types need no registration
+func RegisterType(value interface{}) {
+	gob.Register(value)
+}
+
+func init() {
+	RegisterType(&CachedResponse{})
+	RegisterType(map[string]interface{}{})
+	RegisterType([]interface{}{})
+}
+
+// RedisCache is a Cache stored in Redis, shared by all the instances of the application.
+// Errors are counted and reported in the log, and behave as cache misses
+type RedisCache struct {
+	client *redis.Client
+	prefix string // Keys are prefix+"k:"+key, tag sets prefix+"t:"+tag
+
+	mu        sync.Mutex
+	stats     CacheStats
+	errors    int
+	lastError time.Time
+}
+
+// NewRedisCache creates a cache for a URL such as redis://localhost:6379/0. namespace
+// separates caches sharing the same server (e.g. "responses" and "queries")
+func NewRedisCache(url, namespace string) (*RedisCache, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	return &RedisCache{client: redis.NewClient(options), prefix: "qr-menu:cache:" + namespace + ":"}, nil
+}
+
+// failed reports whether a command failed, counting the failure and logging it at most
+// once a minute. A missing key (redis.Nil) is not a failure
+func (c *RedisCache) failed(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return false
+	}
+	c.mu.Lock()
+	c.errors++
+	if time.Since(c.lastError) > time.Minute {
+		c.lastError = time.Now()
+		log.Printf("⚠️ Cache Redis non disponibile: %v", err)
+	}
+	c.mu.Unlock()
+	return true
+}
+
+// Get retrieves a value from cache
+func (c *RedisCache) Get(key string) (interface{}, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	data, err := c.client.Get(ctx, c.prefix+"k:"+key).Bytes()
+	if c.failed(err) || err != nil {
+		c.count(func(s *CacheStats) { s.Misses++ })
+		return nil, false
+	}
+
+	var entry struct{ Value interface{} }
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		log.Printf("⚠️ Valore in cache non decodificabile (%s): %v", key, err)
+		c.count(func(s *CacheStats) { s.Misses++ })
+		return nil, false
+	}
+	c.count(func(s *CacheStats) { s.Hits++ })
+	return entry.Value, true
+}
+
+// Set stores a value in cache with TTL
+func (c *RedisCache) Set(key string, value interface{}, ttl time.Duration) {
+	c.SetTagged(key, value, ttl)
+}
+
+// SetTagged stores a value and adds its key to the given tags. A tag set lives as long as
+// its longest-lived key
+func (c *RedisCache) SetTagged(key string, value interface{}, ttl time.Duration, tags ...string) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(struct{ Value interface{} }{value}); err != nil {
+		log.Printf("⚠️ Valore non memorizzabile in cache (%s), registrarne il tipo con cache.RegisterType: %v", key, err)
+		return
+	}
+	ttl = max(ttl, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if c.failed(c.client.Set(ctx, c.prefix+"k:"+key, buf.Bytes(), ttl).Err()) {
+		return
+	}
+	c.count(func(s *CacheStats) { s.Total++ })
+
+	for _, tag := range tags {
+		tagKey := c.prefix + "t:" + tag
+		if c.failed(c.client.SAdd(ctx, tagKey, key).Err()) {
+			return
+		}
+		// PTTL is negative for a set without expiration, which is then given one
+		if remaining, err := c.client.PTTL(ctx, tagKey).Result(); !c.failed(err) && remaining < ttl {
+			c.failed(c.client.PExpire(ctx, tagKey, ttl).Err())
+		}
+	}
+}
+
+// InvalidateTag removes the values stored with the tag
+func (c *RedisCache) InvalidateTag(tag string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	tagKey := c.prefix + "t:" + tag
+	members, err := c.client.SMembers(ctx, tagKey).Result()
+	if c.failed(err) {
+		return
+	}
+	keys := []string{tagKey}
+	for _, key := range members {
+		keys = append(keys, c.prefix+"k:"+key)
+	}
+	if n, err := c.client.Del(ctx, keys...).Result(); !c.failed(err) && n > 1 {
+		c.count(func(s *CacheStats) { s.Evictions += int(n) - 1 })
+	}
+}
+
+// Delete removes a value from cache
+func (c *RedisCache) Delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if !c.failed(c.client.Del(ctx, c.prefix+"k:"+key).Err()) {
+		c.count(func(s *CacheStats) { s.Evictions++ })
+	}
+}
+
+// Clear removes all the values and tags of this cache's namespace
+func (c *RedisCache) Clear() {
+	c.scan(c.prefix+"*", func(ctx context.Context, keys []string) {
+		c.failed(c.client.Del(ctx, keys...).Err())
+	})
+}
+
+// Size returns the number of items in cache. It scans the namespace, so it is meant for
+// statistics rather than the request path
+func (c *RedisCache) Size() int {
+	size := 0
+	c.scan(c.prefix+"k:*", func(_ context.Context, keys []string) { size += len(keys) })
+	return size
+}
+
+// Exists checks if a key exists and is not expired
+func (c *RedisCache) Exists(key string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	n, err := c.client.Exists(ctx, c.prefix+"k:"+key).Result()
+	return !c.failed(err) && n > 0
+}
+
+// GetStats returns cache statistics of this instance
+func (c *RedisCache) GetStats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Errors returns the number of failed Redis commands
+func (c *RedisCache) Errors() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.errors
+}
+
+// Ping checks that Redis answers within the command timeout
+func (c *RedisCache) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	err := c.client.Ping(ctx).Err()
+	c.failed(err)
+	return err
+}
+
+// Close closes the connections to Redis
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
+
+func (c *RedisCache) count(update func(*CacheStats)) {
+	c.mu.Lock()
+	update(&c.stats)
+	c.mu.Unlock()
+}
+
+// scan calls fn with every batch of keys matching pattern
+func (c *RedisCache) scan(pattern string, fn func(ctx context.Context, keys []string)) {
+	var cursor uint64
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+		keys, next, err := c.client.Scan(ctx, cursor, pattern, 500).Result()
+		if !c.failed(err) && len(keys) > 0 {
+			fn(ctx, keys)
+		}
+		cancel()
+		if err != nil || next == 0 {
+			return
+		}
+		cursor = next
+	}
+}
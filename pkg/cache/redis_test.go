@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// startRedis runs an in-memory Redis server for the test and returns it with its URL
+func startRedis(t *testing.T) (*miniredis.Miniredis, string) {
+	srv := miniredis.RunT(t)
+	return srv, "redis://" + srv.Addr()
+}
+
+// TestRedisCacheSetGet tests values of different types and TTL expiration
+func TestRedisCacheSetGet(t *testing.T) {
+	srv, url := startRedis(t)
+	c, err := NewRedisCache(url, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Ping(); err != nil {
+		t.Errorf("Ping failed: %v", err)
+	}
+	c.Set("string", "value", time.Hour)
+	c.Set("map", map[string]interface{}{"id": 1}, time.Hour)
+	c.Set("short", 42, 50*time.Millisecond)
+
+	if v, ok := c.Get("string"); !ok || v != "value" {
+		t.Errorf("Get(string) = %v, %v", v, ok)
+	}
+	if v, ok := c.Get("map"); !ok || v.(map[string]interface{})["id"] != 1 {
+		t.Errorf("Get(map) = %v, %v", v, ok)
+	}
+	if !c.Exists("short") || c.Size() != 3 {
+		t.Errorf("Exists(short) = %v, Size = %d", c.Exists("short"), c.Size())
+	}
+
+	srv.FastForward(80 * time.Millisecond)
+	if _, ok := c.Get("short"); ok {
+		t.Error("Expected short key to be expired")
+	}
+
+	c.Delete("string")
+	if _, ok := c.Get("string"); ok {
+		t.Error("Expected key to be deleted")
+	}
+	c.Clear()
+	if c.Size() != 0 {
+		t.Errorf("Expected empty cache after Clear, got %d", c.Size())
+	}
+	if stats := c.GetStats(); stats.Hits != 2 || stats.Misses != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+// TestRedisCacheSharedInvalidation tests that a mutation on one instance invalidates the
+// entries cached by another one
+func TestRedisCacheSharedInvalidation(t *testing.T) {
+	_, url := startRedis(t)
+	newInstance := func() (*ResponseCache, *QueryResultCache) {
+		responses, err := NewRedisCache(url, "responses")
+		if err != nil {
+			t.Fatal(err)
+		}
+		queries, _ := NewRedisCache(url, "queries")
+		return NewResponseCache(responses), NewQueryResultCache(queries)
+	}
+	respA, queryA := newInstance()
+	respB, queryB := newInstance()
+
+	key := GenerateResponseCacheKey("GET", "/api/v1/analytics", "")
+	respA.SetCachedResponse(key, &CachedResponse{StatusCode: http.StatusOK, Body: []byte("cached")}, time.Hour)
+	queryA.SetQueryResult("users 1", "alice", time.Hour, "users")
+	queryA.SetQueryResult("teams 1", "red", time.Hour, "teams")
+
+	cached, ok := respB.GetCachedResponse(key)
+	if !ok || string(cached.Body) != "cached" || cached.StatusCode != http.StatusOK {
+		t.Fatalf("instance B response = %+v, %v", cached, ok)
+	}
+
+	respB.InvalidatePattern("analytics")
+	queryB.InvalidateTable("users")
+
+	if _, ok := respA.GetCachedResponse(key); ok {
+		t.Error("Expected response to be invalidated on instance A")
+	}
+	if _, ok := queryA.GetQueryResult("users 1"); ok {
+		t.Error("Expected users query to be invalidated on instance A")
+	}
+	if v, ok := queryA.GetQueryResult("teams 1"); !ok || v != "red" {
+		t.Errorf("Expected teams query to survive, got %v, %v", v, ok)
+	}
+}
+
+// TestRedisCacheUnavailable tests that a Redis outage behaves as cache misses
+func TestRedisCacheUnavailable(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c, err := NewRedisCache("redis://"+addr, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("key", "value", time.Hour)
+	if _, ok := c.Get("key"); ok {
+		t.Error("Expected a miss with Redis unavailable")
+	}
+	if c.Errors() != 2 {
+		t.Errorf("Errors = %d, want 2", c.Errors())
+	}
+	if c.Ping() == nil {
+		t.Error("Expected Ping to fail with Redis unavailable")
+	}
+}
@@ -6,14 +6,20 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
+// responsesTag groups all the responses stored in a TaggedCache
+const responsesTag = "responses"
+
 // ResponseCache caches HTTP responses (GET requests)
 type ResponseCache struct {
 	cache Cache
 	mu    sync.RWMutex
 	keys  map[string]time.Time // Track key expiration times
 	stats CacheStats
+	loads singleflight.Group // In-flight GetOrLoad calls by key
 }
 
 // CachedResponse represents a cached HTTP response
@@ -55,12 +61,41 @@ func (rc *ResponseCache) GetCachedResponse(key string) (*CachedResponse, bool) {
 	return response, true
 }
 
+// GetOrLoad returns the cached response for key, calling load on a miss. Concurrent misses
+// for the same key share a single call to load, so a popular entry expiring reaches the
+// backend once. A nil response from load is returned to all the callers but not cached
+func (rc *ResponseCache) GetOrLoad(key string, ttl time.Duration, load func() (*CachedResponse, error)) (*CachedResponse, error) {
+	if response, ok := rc.GetCachedResponse(key); ok {
+		return response, nil
+	}
+
+	value, err, _ := rc.loads.Do(key, func() (interface{}, error) {
+		// A call that just finished may have stored the response
+		if value, ok := rc.cache.Get(key); ok {
+			if response, ok := value.(*CachedResponse); ok {
+				return response, nil
+			}
+		}
+		response, err := load()
+		if err == nil && response != nil {
+			rc.SetCachedResponse(key, response, ttl)
+		}
+		return response, err
+	})
+	response, _ := value.(*CachedResponse)
+	return response, err
+}
+
 // SetCachedResponse stores an HTTP response in cache
 func (rc *ResponseCache) SetCachedResponse(key string, response *CachedResponse, ttl time.Duration) {
 	response.CachedAt = time.Now()
 	response.ExpiresAt = time.Now().Add(ttl)
 
-	rc.cache.Set(key, response, ttl)
+	if tagged, ok := rc.cache.(TaggedCache); ok {
+		tagged.SetTagged(key, response, ttl, responsesTag)
+	} else {
+		rc.cache.Set(key, response, ttl)
+	}
 
 	rc.mu.Lock()
 	rc.keys[key] = response.ExpiresAt
@@ -80,6 +115,12 @@ func (rc *ResponseCache) InvalidateKey(key string) {
 
 // InvalidatePattern removes all cached responses matching a pattern
 func (rc *ResponseCache) InvalidatePattern(pattern string) {
+	// Keys are hashes and other instances' keys are not tracked here: a shared cache
+	// drops the responses cached by every instance
+	if tagged, ok := rc.cache.(TaggedCache); ok {
+		tagged.InvalidateTag(responsesTag)
+	}
+
 	rc.mu.Lock()
 	keysToDelete := []string{}
 
@@ -140,6 +181,21 @@ func GenerateResponseCacheKey(method, path, query string) string {
 	return fmt.Sprintf("resp:%x", h.Sum(nil))
 }
 
+// GenerateVariantCacheKey generates a cache key for a variant of a response. vary lists the
+// request values selecting the variant, such as "accept-language=it"; without them the key
+// equals GenerateResponseCacheKey
+func GenerateVariantCacheKey(method, path, query string, vary ...string) string {
+	if len(vary) == 0 {
+		return GenerateResponseCacheKey(method, path, query)
+	}
+	h := md5.New()
+	fmt.Fprintf(h, "%s:%s?%s", method, path, query)
+	for _, v := range vary {
+		fmt.Fprintf(h, "\n%s", v)
+	}
+	return fmt.Sprintf("resp:%x", h.Sum(nil))
+}
+
 // QueryResultCache caches database query results
 type QueryResultCache struct {
 	cache Cache
@@ -180,7 +236,15 @@ func (qrc *QueryResultCache) GetQueryResult(query string) (interface{}, bool) {
 // SetQueryResult caches a query result
 func (qrc *QueryResultCache) SetQueryResult(query string, result interface{}, ttl time.Duration, dependsOnTables ...string) {
 	key := generateQueryCacheKey(query)
-	qrc.cache.Set(key, result, ttl)
+	if tagged, ok := qrc.cache.(TaggedCache); ok {
+		tags := make([]string, len(dependsOnTables))
+		for i, table := range dependsOnTables {
+			tags[i] = "table:" + table
+		}
+		tagged.SetTagged(key, result, ttl, tags...)
+	} else {
+		qrc.cache.Set(key, result, ttl)
+	}
 
 	qrc.mu.Lock()
 	qrc.keys[key] = time.Now().Add(ttl)
@@ -198,6 +262,11 @@ func (qrc *QueryResultCache) SetQueryResult(query string, result interface{}, tt
 
 // InvalidateTable invalidates all cached queries depending on a table
 func (qrc *QueryResultCache) InvalidateTable(tableName string) {
+	// A shared cache also drops the queries cached by the other instances
+	if tagged, ok := qrc.cache.(TaggedCache); ok {
+		tagged.InvalidateTag("table:" + tableName)
+	}
+
 	qrc.mu.Lock()
 	if keys, exists := qrc.deps[tableName]; exists {
 		for _, key := range keys {
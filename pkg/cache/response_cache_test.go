@@ -1,8 +1,11 @@
 package cache
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -22,6 +25,23 @@ func TestGenerateResponseCacheKey(t *testing.T) {
 	}
 }
 
+// TestGenerateVariantCacheKey tests that variants of the same URL get different keys
+func TestGenerateVariantCacheKey(t *testing.T) {
+	plain := GenerateResponseCacheKey("GET", "/api/users", "page=1")
+	if GenerateVariantCacheKey("GET", "/api/users", "page=1") != plain {
+		t.Errorf("A key without variants should equal the plain key")
+	}
+
+	it := GenerateVariantCacheKey("GET", "/api/users", "page=1", "accept-language=it")
+	en := GenerateVariantCacheKey("GET", "/api/users", "page=1", "accept-language=en")
+	if it == plain || it == en {
+		t.Errorf("Different variants should generate different keys")
+	}
+	if it != GenerateVariantCacheKey("GET", "/api/users", "page=1", "accept-language=it") {
+		t.Errorf("Same variant should generate the same key")
+	}
+}
+
 // TestResponseCacheSetGet tests basic response caching
 func TestResponseCacheSetGet(t *testing.T) {
 	base := NewInMemoryCache()
@@ -56,6 +76,54 @@ func TestResponseCacheSetGet(t *testing.T) {
 	}
 }
 
+// TestResponseCacheGetOrLoad tests that concurrent misses share a single load
+func TestResponseCacheGetOrLoad(t *testing.T) {
+	rc := NewResponseCache(NewInMemoryCache())
+
+	var loads int32
+	release := make(chan struct{})
+	load := func() (*CachedResponse, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return &CachedResponse{StatusCode: http.StatusOK, Body: []byte("menu")}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, err := rc.GetOrLoad("menu:1", time.Hour, load)
+			if err != nil || string(response.Body) != "menu" {
+				t.Errorf("GetOrLoad = %v, %v", response, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("Expected a single load, got %d", loads)
+	}
+	if _, err := rc.GetOrLoad("menu:1", time.Hour, load); err != nil || loads != 1 {
+		t.Errorf("Expected the loaded response to be cached, got %d loads", loads)
+	}
+
+	// Errors and nil responses are not cached
+	failing := func() (*CachedResponse, error) { return nil, errors.New("database down") }
+	if _, err := rc.GetOrLoad("menu:2", time.Hour, failing); err == nil {
+		t.Error("Expected the load error to be returned")
+	}
+	empty := func() (*CachedResponse, error) { return nil, nil }
+	if response, err := rc.GetOrLoad("menu:3", time.Hour, empty); response != nil || err != nil {
+		t.Errorf("GetOrLoad = %v, %v; want nil, nil", response, err)
+	}
+	if rc.Size() != 1 {
+		t.Errorf("Expected only the successful load to be cached, got %d entries", rc.Size())
+	}
+}
+
 // TestResponseCacheMiss tests cache miss
 func TestResponseCacheMiss(t *testing.T) {
 	base := NewInMemoryCache()
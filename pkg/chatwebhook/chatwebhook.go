@@ -0,0 +1,210 @@
+// Package chatwebhook posts notifications to the incoming webhooks of Slack and Discord. A
+// Message is formatted for each platform (a Slack attachment, a Discord embed) with a
+// color for its level, so the same notice reads naturally in both.
+package chatwebhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Supported platforms
+const (
+	Slack   = "slack"
+	Discord = "discord"
+)
+
+// Platforms lists the supported platforms
+var Platforms = []string{Slack, Discord}
+
+// Message levels, shown as the color of the message
+const (
+	LevelInfo    = "info"
+	LevelWarning = "warning"
+	LevelAlert   = "alert"
+)
+
+var levelColors = map[string]int{
+	LevelInfo:    0x1E88E5,
+	LevelWarning: 0xFB8C00,
+	LevelAlert:   0xE53935,
+}
+
+var (
+	// ErrInvalidURL is returned for URLs that are not incoming webhooks of the platform
+	ErrInvalidURL = errors.New("not an incoming webhook URL of the platform")
+	// ErrGone is matched (with errors.Is) by post errors of webhooks that were deleted or
+	// revoked on the platform: posting again will not succeed
+	ErrGone = errors.New("webhook no longer exists")
+)
+
+// webhookHosts are the hosts and path prefixes of the incoming webhooks of each platform.
+// Only these are accepted, so a restaurant cannot make the server post to arbitrary hosts
+var webhookHosts = map[string]struct {
+	hosts  []string
+	prefix string
+}{
+	Slack:   {hosts: []string{"hooks.slack.com"}, prefix: "/services/"},
+	Discord: {hosts: []string{"discord.com", "discordapp.com", "ptb.discord.com", "canary.discord.com"}, prefix: "/api/webhooks/"},
+}
+
+// Message is a notification for a channel
+type Message struct {
+	Title  string
+	Text   string
+	URL    string // Link of the title, optional
+	Level  string // LevelInfo when empty
+	Footer string // E.g. the name of the restaurant, optional
+}
+
+// ValidateURL checks that raw is an incoming webhook URL of the platform
+func ValidateURL(platform, raw string) error {
+	allowed, ok := webhookHosts[platform]
+	if !ok {
+		return fmt.Errorf("unsupported platform %q", platform)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" {
+		return ErrInvalidURL
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range allowed.hosts {
+		if host == h && strings.HasPrefix(u.Path, allowed.prefix) && len(u.Path) > len(allowed.prefix) {
+			return nil
+		}
+	}
+	return ErrInvalidURL
+}
+
+// Client posts messages to incoming webhooks
+type Client struct {
+	http *http.Client
+}
+
+// New creates a client; timeout defaults to 10 seconds
+func New(timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &Client{http: &http.Client{Timeout: timeout}}
+}
+
+// Post sends msg to the webhook of the platform
+func (c *Client) Post(ctx context.Context, platform, webhookURL string, msg Message) error {
+	var payload interface{}
+	switch platform {
+	case Slack:
+		payload = slackPayload(msg)
+	case Discord:
+		payload = discordPayload(msg)
+	default:
+		return fmt.Errorf("unsupported platform %q", platform)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// The URL is the credential of the webhook: keep it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("%s webhook: %w", platform, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return nil
+	}
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s webhook: HTTP %d %s", platform, resp.StatusCode, strings.TrimSpace(string(detail)))
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return fmt.Errorf("%w: %w", ErrGone, err)
+	case resp.StatusCode == http.StatusForbidden && platform == Slack:
+		// Slack answers 403 for webhooks of removed apps or archived channels
+		return fmt.Errorf("%w: %w", ErrGone, err)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if after, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil {
+			return fmt.Errorf("%w (retry after %ds)", err, after)
+		}
+	}
+	return err
+}
+
+func levelColor(level string) int {
+	if color, ok := levelColors[level]; ok {
+		return color
+	}
+	return levelColors[LevelInfo]
+}
+
+// truncate shortens s to at most max runes, marking the cut
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max-1]) + "…"
+}
+
+// slackEscape escapes the characters Slack reads as markup: links and mentions such as
+// <!channel> cannot be injected through names typed by users
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func slackPayload(msg Message) map[string]interface{} {
+	attachment := map[string]interface{}{
+		"color":    fmt.Sprintf("#%06X", levelColor(msg.Level)),
+		"title":    slackEscape.Replace(truncate(msg.Title, 250)),
+		"text":     slackEscape.Replace(truncate(msg.Text, 3000)),
+		"fallback": slackEscape.Replace(truncate(msg.Title, 250)),
+	}
+	if msg.URL != "" {
+		attachment["title_link"] = msg.URL
+	}
+	if msg.Footer != "" {
+		attachment["footer"] = slackEscape.Replace(truncate(msg.Footer, 300))
+	}
+	return map[string]interface{}{
+		"text":        slackEscape.Replace(truncate(msg.Title, 250)),
+		"attachments": []interface{}{attachment},
+	}
+}
+
+func discordPayload(msg Message) map[string]interface{} {
+	embed := map[string]interface{}{
+		"title":       truncate(msg.Title, 256),
+		"description": truncate(msg.Text, 4096),
+		"color":       levelColor(msg.Level),
+	}
+	if msg.URL != "" {
+		embed["url"] = msg.URL
+	}
+	if msg.Footer != "" {
+		embed["footer"] = map[string]string{"text": truncate(msg.Footer, 2048)}
+	}
+	return map[string]interface{}{
+		"embeds": []interface{}{embed},
+		// Names typed by users must not ping @everyone or roles
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}
+}
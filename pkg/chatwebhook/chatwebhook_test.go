@@ -0,0 +1,103 @@
+package chatwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateURL(t *testing.T) {
+	valid := map[string]string{
+		"https://hooks.slack.com/services/T000/B000/XXXX":  Slack,
+		"https://discord.com/api/webhooks/123/token":       Discord,
+		"https://canary.discord.com/api/webhooks/123/tok":  Discord,
+		"https://discordapp.com/api/webhooks/123/token?x=": Discord,
+	}
+	for raw, platform := range valid {
+		if err := ValidateURL(platform, raw); err != nil {
+			t.Errorf("ValidateURL(%s, %s) = %v", platform, raw, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"http://hooks.slack.com/services/T000/B000/XXXX":      Slack,
+		"https://hooks.slack.com/services/":                   Slack,
+		"https://hooks.slack.com.evil.test/services/T/B/X":    Slack,
+		"https://discord.com/api/webhooks/123/token":          Slack,
+		"https://hooks.slack.com:8443/services/T000/B000/XXX": Slack,
+		"https://user@discord.com/api/webhooks/123/token":     Discord,
+		"https://discord.com/api/users/123":                   Discord,
+		"https://internal.local/api/webhooks/123/token":       Discord,
+	}
+	for raw, platform := range invalid {
+		if err := ValidateURL(platform, raw); err == nil {
+			t.Errorf("ValidateURL(%s, %s) accepted an invalid URL", platform, raw)
+		}
+	}
+	if err := ValidateURL("teams", "https://example.com"); err == nil {
+		t.Error("expected an error for an unsupported platform")
+	}
+}
+
+func TestPost(t *testing.T) {
+	var payload map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gone":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "/busy":
+			w.Header().Set("Retry-After", "3")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := New(0)
+	msg := Message{Title: "New order <!channel>", Text: "2× Margherita @everyone", URL: "https://menu.example.com/admin", Level: LevelAlert, Footer: "Da Mario"}
+
+	if err := client.Post(context.Background(), Slack, srv.URL+"/slack", msg); err != nil {
+		t.Fatal(err)
+	}
+	attachment := payload["attachments"].([]interface{})[0].(map[string]interface{})
+	if attachment["title"] != "New order &lt;!channel&gt;" || attachment["color"] != "#E53935" || attachment["title_link"] != msg.URL {
+		t.Errorf("unexpected Slack attachment %v", attachment)
+	}
+
+	if err := client.Post(context.Background(), Discord, srv.URL+"/discord", msg); err != nil {
+		t.Fatal(err)
+	}
+	embed := payload["embeds"].([]interface{})[0].(map[string]interface{})
+	if embed["title"] != msg.Title || embed["color"] != float64(0xE53935) || embed["footer"].(map[string]interface{})["text"] != "Da Mario" {
+		t.Errorf("unexpected Discord embed %v", embed)
+	}
+	if parse := payload["allowed_mentions"].(map[string]interface{})["parse"].([]interface{}); len(parse) != 0 {
+		t.Errorf("mentions should be disabled, got %v", parse)
+	}
+
+	if err := client.Post(context.Background(), Discord, srv.URL+"/gone", msg); !errors.Is(err, ErrGone) {
+		t.Errorf("deleted webhook: %v", err)
+	}
+	if err := client.Post(context.Background(), Slack, srv.URL+"/busy", msg); err == nil || errors.Is(err, ErrGone) || !strings.Contains(err.Error(), "retry after 3s") {
+		t.Errorf("rate limited webhook: %v", err)
+	}
+	if err := client.Post(context.Background(), Slack, "http://127.0.0.1:1/services/secret", msg); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("transport errors must not leak the URL: %v", err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("àèìòù", 3); got != "àè…" {
+		t.Errorf("truncate = %q", got)
+	}
+	if got := truncate("abc", 3); got != "abc" {
+		t.Errorf("truncate = %q", got)
+	}
+}
@@ -1,175 +1,497 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Config holds all application configuration
 type Config struct {
-	Server        ServerConfig
-	Database      DatabaseConfig
-	Backup        BackupConfig
-	Notifications NotificationConfig
-	Localization  LocalizationConfig
-	Logger        LoggerConfig
-	Analytics     AnalyticsConfig
-	Security      SecurityConfig
-	Cache         CacheConfig
+	Server        ServerConfig       `yaml:"server"`
+	Database      DatabaseConfig     `yaml:"database"`
+	Backup        BackupConfig       `yaml:"backup"`
+	Notifications NotificationConfig `yaml:"notifications"`
+	Mail          MailConfig         `yaml:"mail"`
+	SMS           SMSConfig          `yaml:"sms"`
+	WhatsApp      WhatsAppConfig     `yaml:"whatsapp"`
+	Telegram      TelegramConfig     `yaml:"telegram"`
+	Integrations  IntegrationsConfig `yaml:"integrations"`
+	Wallet        WalletConfig       `yaml:"wallet"`
+	Localization  LocalizationConfig `yaml:"localization"`
+	Logger        LoggerConfig       `yaml:"logger"`
+	Analytics     AnalyticsConfig    `yaml:"analytics"`
+	Security      SecurityConfig     `yaml:"security"`
+	OAuth         OAuthConfig        `yaml:"oauth"`
+	Billing       BillingConfig      `yaml:"billing"`
+	Webhooks      WebhookConfig      `yaml:"webhooks"`
+	Events        EventsConfig       `yaml:"events"`
+	Cache         CacheConfig        `yaml:"cache"`
+	Health        HealthConfig       `yaml:"health"`
+	GRPC          GRPCConfig         `yaml:"grpc"`
+	AI            AIConfig           `yaml:"ai"`
+	OCR           OCRConfig          `yaml:"ocr"`
+	Paths         PathsConfig        `yaml:"paths"`
 }
 
 // ServerConfig holds server-specific configuration
 type ServerConfig struct {
-	Port         int
-	Host         string
-	ReadTimeout  time.Duration
-	WriteTimeout time.Duration
-	IdleTimeout  time.Duration
-	MaxBodySize  int64
-	Environment  string // dev, staging, prod
+	Port         int           `yaml:"port"`
+	Host         string        `yaml:"host"`
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	MaxBodySize  int64         `yaml:"max_body_size"`
+	Environment  string        `yaml:"environment"` // dev, staging, prod
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`   // Max wait for in-flight requests and workers on SIGTERM
+	HTTPRedirectPort  int           `yaml:"http_redirect_port"` // Plain HTTP listener redirecting to HTTPS when TLS is enabled, 0 disables it
+
+	BaseURL           string `yaml:"base_url"`            // Public URL used in links and QR codes, e.g. https://menu.example.com; empty derives it from each request
+	TrustProxyHeaders bool   `yaml:"trust_proxy_headers"` // Honor X-Forwarded-* from the reverse proxy: base URL when BaseURL is empty, client IP
 }
 
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
-	DSN             string
-	MaxOpenConns    int
-	MaxIdleConns    int
-	ConnMaxLifetime time.Duration
-	ConnMaxIdleTime time.Duration
-	Engine          string // postgres, mysql, sqlite
-	MigrationPath   string
-	AutoMigrate     bool
+	DSN             string        `yaml:"dsn"`
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	Engine          string        `yaml:"engine"` // postgres or mysql, the drivers linked in the binary
+	MigrationPath   string        `yaml:"migration_path"`
+	AutoMigrate     bool          `yaml:"auto_migrate"`
 }
 
 // BackupConfig holds backup service configuration
 type BackupConfig struct {
-	QueueSize        int
-	MaxBackups       int
-	ScheduleTime     string // HH:MM format, default "02:00"
-	Enabled          bool
-	CompressionLevel int // 1-9
-	RetentionDays    int
-	RotationInterval time.Duration
-	StoragePath      string
+	QueueSize        int           `yaml:"queue_size"`
+	MaxBackups       int           `yaml:"max_backups"`
+	ScheduleTime     string        `yaml:"schedule_time"` // HH:MM format, default "02:00"
+	Enabled          bool          `yaml:"enabled"`
+	CompressionLevel int           `yaml:"compression_level"` // 1-9
+	RetentionDays    int           `yaml:"retention_days"`
+	RotationInterval time.Duration `yaml:"rotation_interval"`
+	StoragePath      string        `yaml:"storage_path"`
+	FullEvery        int           `yaml:"full_every"` // One incremental backup in full_every is taken in full, 0 = never
+
+	// Named cron schedules, e.g. a daily full backup and hourly incrementals. When empty, a
+	// daily full backup runs at schedule_time
+	Schedules []BackupScheduleConfig `yaml:"schedules"`
+
+	// Off-site copies of every archive, so backups survive the loss of the server disk
+	Targets []BackupTargetConfig `yaml:"targets"`
+}
+
+// BackupScheduleConfig is a named backup schedule
+type BackupScheduleConfig struct {
+	Name string `yaml:"name"`
+	Cron string `yaml:"cron"` // Five-field cron expression or macro (@hourly, @daily, ...), server local time
+	Kind string `yaml:"kind"` // full, incremental
+}
+
+// BackupTargetConfig is a remote destination the backup archives are uploaded to, with its own
+// retention. Only the fields of its type are used
+type BackupTargetConfig struct {
+	Name       string        `yaml:"name"`
+	Type       string        `yaml:"type"`        // s3, sftp, gdrive
+	MaxBackups int           `yaml:"max_backups"` // Newest archives kept on the target, 0 = no limit
+	MaxAge     time.Duration `yaml:"max_age"`     // Older archives are deleted (the newest is always kept), 0 = no limit
+
+	// s3 (AWS S3, MinIO, R2, ...)
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	UseSSL    bool   `yaml:"use_ssl"`
+	Prefix    string `yaml:"prefix"`
+
+	// sftp
+	Address  string `yaml:"address"` // host or host:port
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	KeyFile  string `yaml:"key_file"` // Private key file, instead of or in addition to the password
+	HostKey  string `yaml:"host_key"` // Server public key as in known_hosts, without the host name
+	Path     string `yaml:"path"`
+
+	// gdrive
+	CredentialsFile string `yaml:"credentials_file"` // Service account key file
+	FolderID        string `yaml:"folder_id"`        // Folder shared with the service account
 }
 
 // NotificationConfig holds notification service configuration
 type NotificationConfig struct {
-	Workers           int
-	QueueSize         int
-	BatchSize         int
-	BatchTimeout      time.Duration
-	MaxRetries        int
-	RetryDelay        time.Duration
-	FCMCredentialsURL string
-	Enabled           bool
+	Workers           int           `yaml:"workers"`
+	QueueSize         int           `yaml:"queue_size"`
+	BatchSize         int           `yaml:"batch_size"`
+	BatchTimeout      time.Duration `yaml:"batch_timeout"`
+	MaxRetries        int           `yaml:"max_retries"`
+	RetryDelay        time.Duration `yaml:"retry_delay"`
+	FCMCredentialsURL string        `yaml:"fcm_credentials_url"` // Service account key (path, file:// or https:// URL) for FCM push; empty disables push
+	VAPIDPublicKey    string        `yaml:"vapid_public_key"`    // Web Push key pair (qr-menu vapid-keys); empty disables browser notifications
+	VAPIDPrivateKey   string        `yaml:"vapid_private_key"`
+	VAPIDSubject      string        `yaml:"vapid_subject"` // Operator contact sent to the push services (mailto: or https: URL)
+	Enabled           bool          `yaml:"enabled"`
+	EnableEmail       bool          `yaml:"enable_email"` // Deliver emails through the send queue (workers, queue_size, max_retries, retry_delay); false only logs them
+}
+
+// MailConfig holds the provider used for transactional email (welcome, password reset, weekly digest)
+type MailConfig struct {
+	Provider     string        `yaml:"provider"`  // smtp, sendgrid, mailgun or log; empty uses smtp when smtp_host is set, log otherwise
+	SMTPHost     string        `yaml:"smtp_host"` // Empty only logs messages
+	SMTPPort     int           `yaml:"smtp_port"` // 587 (STARTTLS), 465 (implicit TLS) or 25
+	SMTPUsername string        `yaml:"smtp_username"`
+	SMTPPassword string        `yaml:"smtp_password"`
+	APIKey       string        `yaml:"api_key"`  // SendGrid or Mailgun API key
+	Domain       string        `yaml:"domain"`   // Mailgun sending domain
+	APIBase      string        `yaml:"api_base"` // Provider API endpoint, e.g. https://api.eu.mailgun.net; empty uses the default
+	From         string        `yaml:"from"`     // Sender address, e.g. "QR Menu <no-reply@example.com>"
+	Timeout      time.Duration `yaml:"timeout"`
+
+	WeeklyDigest bool `yaml:"weekly_digest"` // Email each owner a summary of last week's analytics on Monday morning
+}
+
+// SMSConfig holds the provider of the SMS notifications to owners and customers
+type SMSConfig struct {
+	Provider     string            `yaml:"provider"` // twilio, vonage or log; empty disables SMS
+	From         string            `yaml:"from"`     // Default sender: a number in international form (+...) or an alphanumeric ID
+	Senders      map[string]string `yaml:"senders"`  // Sender by country calling code of the recipient, e.g. "1": "+15551234567"
+	AccountSID   string            `yaml:"account_sid"`
+	AuthToken    string            `yaml:"auth_token"` // Twilio; also verifies the signature of the callbacks
+	APIKey       string            `yaml:"api_key"`
+	APISecret    string            `yaml:"api_secret"`
+	WebhookToken string            `yaml:"webhook_token"` // Vonage: "token" query parameter of the callback URLs
+	APIBase      string            `yaml:"api_base"`      // Provider API endpoint; empty uses the default
+	Timeout      time.Duration     `yaml:"timeout"`
+}
+
+// WhatsAppConfig holds the Meta app through which restaurants connect their WhatsApp
+// Business numbers. Each restaurant stores its own phone number ID and access token
+type WhatsAppConfig struct {
+	AppSecret   string        `yaml:"app_secret"`   // Verifies the signature of the webhooks; empty disables WhatsApp
+	VerifyToken string        `yaml:"verify_token"` // Echoed back by Meta when the webhook is registered
+	APIBase     string        `yaml:"api_base"`     // Graph API endpoint; empty uses the default
+	Timeout     time.Duration `yaml:"timeout"`
+}
+
+// TelegramConfig holds the Telegram bot through which owners receive new orders and the
+// summary of the day and mark items as sold out
+type TelegramConfig struct {
+	BotToken       string        `yaml:"bot_token"`      // Issued by @BotFather; empty disables the bot
+	BotUsername    string        `yaml:"bot_username"`   // Without @, for the links that connect a chat
+	WebhookSecret  string        `yaml:"webhook_secret"` // Sent back by Telegram with every update
+	APIBase        string        `yaml:"api_base"`       // Bot API endpoint; empty uses the default
+	Timeout        time.Duration `yaml:"timeout"`
+	DailySummaryAt string        `yaml:"daily_summary_at"` // Local time of the summary of the day, HH:MM
+}
+
+// IntegrationsConfig holds the export of the menus to the delivery platforms (Deliverect,
+// Uber Eats, Glovo), configured by each restaurant with its own credentials
+type IntegrationsConfig struct {
+	SyncInterval time.Duration `yaml:"sync_interval"` // Between automatic syncs of a restaurant; 0 disables them
+	Timeout      time.Duration `yaml:"timeout"`
+}
+
+// WalletConfig holds the Apple Wallet and Google Wallet passes with the menu QR code. Each
+// platform is enabled by its own credentials
+type WalletConfig struct {
+	ApplePassTypeID string `yaml:"apple_pass_type_id"` // e.g. pass.com.example.menu; empty disables Apple Wallet
+	AppleTeamID     string `yaml:"apple_team_id"`
+	AppleCertFile   string `yaml:"apple_cert_file"` // PEM Pass Type ID certificate
+	AppleKeyFile    string `yaml:"apple_key_file"`  // PEM private key of the certificate
+	AppleWWDRFile   string `yaml:"apple_wwdr_file"` // PEM Apple WWDR intermediate certificate
+
+	GoogleIssuerID    string `yaml:"google_issuer_id"`   // Google Wallet issuer; empty disables Google Wallet
+	GoogleCredentials string `yaml:"google_credentials"` // Service account key file or URL, as notifications.fcm_credentials_url
+
+	Timeout time.Duration `yaml:"timeout"`
 }
 
 // LocalizationConfig holds localization configuration
 type LocalizationConfig struct {
-	DefaultLanguage    string
-	SupportedLanguages []string
-	DateFormat         string
-	TimeFormat         string
-	TimezoneOffset     int // hours
-	CurrencySymbols    map[string]string
+	DefaultLanguage    string            `yaml:"default_language"`
+	SupportedLanguages []string          `yaml:"supported_languages"`
+	DateFormat         string            `yaml:"date_format"`
+	TimeFormat         string            `yaml:"time_format"`
+	TimezoneOffset     int               `yaml:"timezone_offset"` // hours
+	CurrencySymbols    map[string]string `yaml:"currency_symbols"`
 }
 
 // LoggerConfig holds logger configuration
 type LoggerConfig struct {
-	Level       string // debug, info, warn, error, fatal
-	Format      string // json, text
-	OutputFile  string // path to log file
-	MaxSize     int    // MB
-	MaxBackups  int
-	MaxAge      int // days
-	Compress    bool
-	Development bool // true for dev, false for prod
+	Level       string `yaml:"level"`       // debug, info, warn, error, fatal
+	Format      string `yaml:"format"`      // json, text
+	OutputFile  string `yaml:"output_file"` // path to log file
+	MaxSize     int    `yaml:"max_size"`    // MB
+	MaxBackups  int    `yaml:"max_backups"`
+	MaxAge      int    `yaml:"max_age"` // days
+	Compress    bool   `yaml:"compress"`
+	Development bool   `yaml:"development"` // true for dev, false for prod
 }
 
 // AnalyticsConfig holds analytics configuration
 type AnalyticsConfig struct {
-	Enabled         bool
-	TrackingEnabled bool
-	StoragePath     string
-	CleanupInterval time.Duration
-	RetentionDays   int
+	Enabled         bool          `yaml:"enabled"`
+	TrackingEnabled bool          `yaml:"tracking_enabled"`
+	StoragePath     string        `yaml:"storage_path"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval"` // How often the retention and rollup job runs
+	RetentionDays   int           `yaml:"retention_days"`   // Raw events and daily counters older than this are dropped or rolled up into months
+
+	MonthlyRetentionMonths int `yaml:"monthly_retention_months"` // Monthly aggregates older than this are dropped, 0 keeps them forever
+
+	VisitorCookie bool `yaml:"visitor_cookie"` // Set a random first-party cookie on public menus to count returning visitors
+
+	GeoIPDatabase string `yaml:"geoip_database"` // MaxMind .mmdb or IP2Location .csv file for country and city stats, empty disables GeoIP
+
+	AnonymizeIP   string        `yaml:"anonymize_ip"`    // How stored visitor IPs are anonymized: none, truncate (IPv4 /24, IPv6 /48) or hash
+	HashUserAgent bool          `yaml:"hash_user_agent"` // Store a salted hash instead of the full User-Agent
+	SaltRotation  time.Duration `yaml:"salt_rotation"`   // How often the in-memory hash salt is replaced
 }
 
 // SecurityConfig holds security configuration
 type SecurityConfig struct {
-	SessionTimeout         time.Duration
-	PasswordMinLen         int
-	PasswordRequireSpecial bool
-	PasswordRequireNumbers bool
-	RateLimitPerSecond     int
-	RateLimitBurst         int
-	CORSEnabled            bool
-	CORSAllowedOrigins     []string
-	EnableHTTPS            bool
-	CertFile               string
-	KeyFile                string
+	SessionTimeout         time.Duration `yaml:"session_timeout"`
+	PasswordMinLen         int           `yaml:"password_min_len"`
+	PasswordRequireSpecial bool          `yaml:"password_require_special"`
+	PasswordRequireNumbers bool          `yaml:"password_require_numbers"`
+	RateLimitPerSecond     int           `yaml:"rate_limit_per_second"`
+	RateLimitBurst         int           `yaml:"rate_limit_burst"`
+	CORSEnabled            bool          `yaml:"cors_enabled"`
+	CORSAllowedOrigins     []string      `yaml:"cors_allowed_origins"`
+	EnableHTTPS            bool          `yaml:"enable_https"`
+	CertFile               string        `yaml:"cert_file"`
+	KeyFile                string        `yaml:"key_file"`
+	JWTSecret              string        `yaml:"jwt_secret"`
+	JWTExpiry              time.Duration `yaml:"jwt_expiry"`         // Lifetime of API access tokens
+	JWTRefreshExpiry       time.Duration `yaml:"jwt_refresh_expiry"` // Lifetime of API refresh tokens, renewed at every refresh
+	JWTIssuer              string        `yaml:"jwt_issuer"`
+	AdminToken             string        `yaml:"admin_token"`   // Bearer token for /api/admin/*, empty disables the endpoints
+	MetricsToken           string        `yaml:"metrics_token"` // Bearer token for the Prometheus /metrics endpoint, empty disables it
+
+	// Automatic certificates from Let's Encrypt (alternative to cert_file/key_file)
+	AutocertEnabled  bool     `yaml:"autocert_enabled"`
+	AutocertDomains  []string `yaml:"autocert_domains"`
+	AutocertEmail    string   `yaml:"autocert_email"`
+	AutocertCacheDir string   `yaml:"autocert_cache_dir"`
+
+	// Optional anti-virus scan of image uploads and backup archives before restore
+	AVScanner    string        `yaml:"av_scanner"`     // "" (disabled), clamav or icap
+	AVAddress    string        `yaml:"av_address"`     // clamd host:port or unix:/path, or icap://host:1344/service
+	AVTimeout    time.Duration `yaml:"av_timeout"`     // Per-file scan timeout
+	AVFailClosed bool          `yaml:"av_fail_closed"` // Reject files when the scanner is unreachable
+
+	// Rate limits per route group (api, auth, public, feedback, loyalty), counted per API key,
+	// restaurant or client IP. The redis backend shares the counters between instances
+	RateLimitGroups  map[string]RateLimitGroup `yaml:"rate_limit_groups"`
+	RateLimitBackend string                    `yaml:"rate_limit_backend"` // memory or redis
+	RedisURL         string                    `yaml:"redis_url"`          // redis://[:password@]host:port/db, or rediss:// for TLS
+}
+
+// RateLimitGroup is the limit of a route group
+type RateLimitGroup struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	Burst             int `yaml:"burst"`
+}
+
+// RateLimitGroupNames lists the route groups that accept a rate limit
+var RateLimitGroupNames = []string{"api", "auth", "public", "feedback", "loyalty", "orders"}
+
+// OAuthConfig holds the client credentials for social login; a provider without client ID
+// is disabled
+type OAuthConfig struct {
+	GoogleClientID     string `yaml:"google_client_id"`
+	GoogleClientSecret string `yaml:"google_client_secret"`
+	AppleClientID      string `yaml:"apple_client_id"` // Services ID registered for Sign in with Apple
+	AppleTeamID        string `yaml:"apple_team_id"`
+	AppleKeyID         string `yaml:"apple_key_id"`
+	ApplePrivateKey    string `yaml:"apple_private_key"` // Path of the .p8 key that signs the client secret
+}
+
+// BillingConfig holds the usage metering configuration. QR scans beyond the plan allowance
+// are reported to a Stripe billing meter, which adds them to the next invoice. The same Stripe
+// account takes the online payments of the diners, such as gift vouchers
+type BillingConfig struct {
+	StripeSecretKey     string           `yaml:"stripe_secret_key"`     // Empty disables usage reporting and online payments
+	StripeWebhookSecret string           `yaml:"stripe_webhook_secret"` // Signing secret of the /api/v1/billing/webhook endpoint; empty disables online payments
+	MeterEventName      string           `yaml:"meter_event_name"`      // Event name of the Stripe meter
+	IncludedScans       map[string]int64 `yaml:"included_scans"`        // Monthly QR scans per plan ID; plans not listed are unlimited
+	ReportInterval      time.Duration    `yaml:"report_interval"`
+	TrialDays           int              `yaml:"trial_days"`     // Length of the free trial; 0 disables trials
+	TrialPlan           string           `yaml:"trial_plan"`     // Plan granted during the trial
+	TrialReminder       time.Duration    `yaml:"trial_reminder"` // How long before the trial ends the owner is reminded
+}
+
+// WebhookConfig holds the delivery rules of the outbound webhooks
+type WebhookConfig struct {
+	Timeout          time.Duration `yaml:"timeout"`          // Timeout of a single delivery attempt
+	MaxAttempts      int           `yaml:"max_attempts"`     // Attempts before a delivery goes to the dead-letter list
+	RetryBaseDelay   time.Duration `yaml:"retry_base_delay"` // Delay before the first retry, doubled at every attempt
+	RetryMaxDelay    time.Duration `yaml:"retry_max_delay"`
+	BreakerThreshold int           `yaml:"breaker_threshold"` // Consecutive failures that pause an endpoint; 0 disables
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+}
+
+// EventsConfig holds the broker that carries the domain events to the other instances, so
+// their caches follow the changes made elsewhere
+type EventsConfig struct {
+	Broker    string `yaml:"broker"`     // none, redis or nats
+	BrokerURL string `yaml:"broker_url"` // nats:// URL, or redis:// defaulting to security.redis_url
+	Topic     string `yaml:"topic"`      // Redis stream or NATS subject
+	MaxLen    int    `yaml:"max_len"`    // Entries kept in the Redis stream, approximately
 }
 
 // CacheConfig holds caching configuration
 type CacheConfig struct {
-	Enabled              bool
-	ResponseCacheTTL     time.Duration // Time-to-live for response cache entries
-	QueryCacheTTL        time.Duration // Time-to-live for query cache entries
-	MaxResponseCacheSize int           // Maximum number of cached responses
-	MaxQueryCacheSize    int           // Maximum number of cached query results
-	InvalidateOnMutation bool          // Whether to invalidate cache on mutations
+	Enabled              bool          `yaml:"enabled"`
+	ResponseCacheTTL     time.Duration `yaml:"response_cache_ttl"`      // Time-to-live for response cache entries
+	QueryCacheTTL        time.Duration `yaml:"query_cache_ttl"`         // Time-to-live for query cache entries
+	MaxResponseCacheSize int           `yaml:"max_response_cache_size"` // Maximum number of cached responses
+	MaxQueryCacheSize    int           `yaml:"max_query_cache_size"`    // Maximum number of cached query results
+	InvalidateOnMutation bool          `yaml:"invalidate_on_mutation"`  // Whether to invalidate cache on mutations
+
+	// Backend selects where cached entries live. The redis backend shares them, and their
+	// invalidation, between instances
+	Backend  string `yaml:"backend"`   // memory or redis
+	RedisURL string `yaml:"redis_url"` // Defaults to security.redis_url when empty
+
+	// RouteTTL overrides response_cache_ttl for the routes under a path prefix
+	RouteTTL map[string]time.Duration `yaml:"route_ttl"`
 }
 
-// Load loads configuration from environment variables and returns a Config struct
-func Load() *Config {
+// HealthConfig holds the dependency checks of the health and readiness probes
+type HealthConfig struct {
+	CheckTimeout   time.Duration `yaml:"check_timeout"`    // Time a single check may take before it counts as failed
+	CacheFor       time.Duration `yaml:"cache_for"`        // How long a result is reused, so frequent probes do not load the dependencies
+	MinFreeDiskMB  int           `yaml:"min_free_disk_mb"` // Free space on the storage volume below which the service is degraded; 0 disables
+	QueueThreshold int           `yaml:"queue_threshold"`  // Percentage of the email queue in use at which the service is degraded
+}
+
+// GRPCConfig holds the gRPC listener used by POS and kiosk integrations
+type GRPCConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	Port           int    `yaml:"port"`
+	CertFile       string `yaml:"cert_file"` // Without cert_file and key_file the listener speaks cleartext HTTP/2 (h2c)
+	KeyFile        string `yaml:"key_file"`
+	ClientCAFile   string `yaml:"client_ca_file"` // When set, clients must present a certificate signed by this CA (mTLS)
+	Reflection     bool   `yaml:"reflection"`     // Serve the reflection service, used by grpcurl and similar tools
+	MaxMessageSize int    `yaml:"max_message_size"`
+}
+
+// AIConfig holds the language model that suggests menu texts to the restaurants
+type AIConfig struct {
+	Provider    string        `yaml:"provider"` // Empty (disabled), openai or ollama
+	BaseURL     string        `yaml:"base_url"` // Empty uses the provider default; any OpenAI-compatible server works
+	APIKey      string        `yaml:"api_key"`  // Required by openai
+	Model       string        `yaml:"model"`
+	Timeout     time.Duration `yaml:"timeout"`
+	Plans       []string      `yaml:"plans"`        // Plans allowed to use the suggestions; empty allows every plan
+	HourlyLimit int           `yaml:"hourly_limit"` // Suggestions per restaurant per hour
+}
+
+// OCRConfig holds the text recognition used to import a menu from a photo or PDF of the
+// paper menu
+type OCRConfig struct {
+	Engine        string        `yaml:"engine"`         // Empty (disabled), tesseract or api
+	TesseractPath string        `yaml:"tesseract_path"` // tesseract binary
+	PDFToPPMPath  string        `yaml:"pdftoppm_path"`  // pdftoppm binary (poppler-utils), needed for PDFs
+	Languages     string        `yaml:"languages"`      // Tesseract languages, e.g. "ita+eng"
+	APIURL        string        `yaml:"api_url"`        // External OCR service, answering {"text": "..."}
+	APIKey        string        `yaml:"api_key"`
+	Timeout       time.Duration `yaml:"timeout"`       // Time to recognize a whole document
+	MaxUploadMB   int           `yaml:"max_upload_mb"` // Largest accepted photo or PDF
+}
+
+// PathsConfig holds the directories used by the application
+type PathsConfig struct {
+	StorageDir string `yaml:"storage_dir"`
+	StaticDir  string `yaml:"static_dir"`
+	LogDir     string `yaml:"log_dir"`
+
+	SnapshotDir   string `yaml:"snapshot_dir"`   // Static copies of public menus served when the DB is unavailable
+	QuarantineDir string `yaml:"quarantine_dir"` // Files flagged by the anti-virus scan
+}
+
+// Default returns the built-in configuration, before config.yaml and environment overrides
+func Default() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port:         getEnvInt("SERVER_PORT", 8080),
-			Host:         getEnv("SERVER_HOST", "localhost"),
-			ReadTimeout:  getEnvDuration("SERVER_READ_TIMEOUT", 10*time.Second),
-			WriteTimeout: getEnvDuration("SERVER_WRITE_TIMEOUT", 10*time.Second),
-			IdleTimeout:  getEnvDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
-			MaxBodySize:  getEnvInt64("SERVER_MAX_BODY_SIZE", 10*1024*1024), // 10MB
-			Environment:  getEnv("ENVIRONMENT", "dev"),
+			Port:              8080,
+			Host:              "localhost",
+			ReadTimeout:       30 * time.Second, // Include the body: image uploads from slow mobile networks
+			WriteTimeout:      60 * time.Second, // Image processing and data exports
+			IdleTimeout:       120 * time.Second,
+			MaxBodySize:       10 * 1024 * 1024, // 10MB
+			Environment:       "dev",
+			ReadHeaderTimeout: 10 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+			HTTPRedirectPort:  80,
+			TrustProxyHeaders: true,
 		},
 		Database: DatabaseConfig{
-			DSN:             getEnv("DATABASE_DSN", "host=localhost port=5432 user=postgres password=password dbname=qrmenu sslmode=disable"),
-			MaxOpenConns:    getEnvInt("DATABASE_MAX_OPEN_CONNS", 25),
-			MaxIdleConns:    getEnvInt("DATABASE_MAX_IDLE_CONNS", 5),
-			ConnMaxLifetime: getEnvDuration("DATABASE_CONN_MAX_LIFETIME", 5*time.Minute),
-			ConnMaxIdleTime: getEnvDuration("DATABASE_CONN_MAX_IDLE_TIME", 10*time.Minute),
-			Engine:          getEnv("DATABASE_ENGINE", "postgres"),
-			MigrationPath:   getEnv("DATABASE_MIGRATION_PATH", "./migrations"),
-			AutoMigrate:     getEnvBool("DATABASE_AUTO_MIGRATE", true),
+			DSN:             "host=localhost port=5432 user=postgres password=password dbname=qrmenu sslmode=disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnMaxIdleTime: 10 * time.Minute,
+			Engine:          "postgres",
+			MigrationPath:   "./db/migrations",
+			AutoMigrate:     true,
 		},
 		Backup: BackupConfig{
-			QueueSize:        getEnvInt("BACKUP_QUEUE_SIZE", 100),
-			MaxBackups:       getEnvInt("BACKUP_MAX_BACKUPS", 30),
-			ScheduleTime:     getEnv("BACKUP_SCHEDULE_TIME", "02:00"),
-			Enabled:          getEnvBool("BACKUP_ENABLED", true),
-			CompressionLevel: getEnvInt("BACKUP_COMPRESSION_LEVEL", 6),
-			RetentionDays:    getEnvInt("BACKUP_RETENTION_DAYS", 90),
-			RotationInterval: getEnvDuration("BACKUP_ROTATION_INTERVAL", 24*time.Hour),
-			StoragePath:      getEnv("BACKUP_STORAGE_PATH", "./backups"),
+			QueueSize:        100,
+			MaxBackups:       30,
+			ScheduleTime:     "02:00",
+			Enabled:          true,
+			CompressionLevel: 6,
+			RetentionDays:    90,
+			RotationInterval: 24 * time.Hour,
+			StoragePath:      "./backups",
+			FullEvery:        7,
 		},
 		Notifications: NotificationConfig{
-			Workers:           getEnvInt("NOTIFICATIONS_WORKERS", 3),
-			QueueSize:         getEnvInt("NOTIFICATIONS_QUEUE_SIZE", 100),
-			BatchSize:         getEnvInt("NOTIFICATIONS_BATCH_SIZE", 10),
-			BatchTimeout:      getEnvDuration("NOTIFICATIONS_BATCH_TIMEOUT", 5*time.Second),
-			MaxRetries:        getEnvInt("NOTIFICATIONS_MAX_RETRIES", 3),
-			RetryDelay:        getEnvDuration("NOTIFICATIONS_RETRY_DELAY", 10*time.Second),
-			FCMCredentialsURL: getEnv("NOTIFICATIONS_FCM_CREDENTIALS_URL", ""),
-			Enabled:           getEnvBool("NOTIFICATIONS_ENABLED", true),
+			Workers:           3,
+			QueueSize:         100,
+			BatchSize:         10,
+			BatchTimeout:      5 * time.Second,
+			MaxRetries:        3,
+			RetryDelay:        10 * time.Second,
+			FCMCredentialsURL: "",
+			Enabled:           true,
+			EnableEmail:       true,
+		},
+		Mail: MailConfig{
+			SMTPPort: 587,
+			Timeout:  30 * time.Second,
+		},
+		SMS: SMSConfig{
+			Timeout: 30 * time.Second,
+		},
+		WhatsApp: WhatsAppConfig{
+			Timeout: 30 * time.Second,
+		},
+		Telegram: TelegramConfig{
+			Timeout:        30 * time.Second,
+			DailySummaryAt: "21:00",
+		},
+		Integrations: IntegrationsConfig{
+			SyncInterval: time.Hour,
+			Timeout:      30 * time.Second,
+		},
+		Wallet: WalletConfig{
+			Timeout: 10 * time.Second,
 		},
 		Localization: LocalizationConfig{
-			DefaultLanguage:    getEnv("LOCALIZATION_DEFAULT_LANG", "it"),
+			DefaultLanguage:    "it",
 			SupportedLanguages: []string{"it", "en", "es", "fr", "de", "pt", "ja", "zh", "ar"},
-			DateFormat:         getEnv("LOCALIZATION_DATE_FORMAT", "2006-01-02"),
-			TimeFormat:         getEnv("LOCALIZATION_TIME_FORMAT", "15:04:05"),
-			TimezoneOffset:     getEnvInt("LOCALIZATION_TIMEZONE_OFFSET", 1),
+			DateFormat:         "2006-01-02",
+			TimeFormat:         "15:04:05",
+			TimezoneOffset:     1,
 			CurrencySymbols: map[string]string{
 				"EUR": "€",
 				"USD": "$",
@@ -178,46 +500,367 @@ func Load() *Config {
 			},
 		},
 		Logger: LoggerConfig{
-			Level:       getEnv("LOGGER_LEVEL", "info"),
-			Format:      getEnv("LOGGER_FORMAT", "json"),
-			OutputFile:  getEnv("LOGGER_OUTPUT_FILE", "./logs/qr-menu.log"),
-			MaxSize:     getEnvInt("LOGGER_MAX_SIZE", 100),
-			MaxBackups:  getEnvInt("LOGGER_MAX_BACKUPS", 10),
-			MaxAge:      getEnvInt("LOGGER_MAX_AGE", 30),
-			Compress:    getEnvBool("LOGGER_COMPRESS", true),
-			Development: getEnv("ENVIRONMENT", "dev") == "dev",
+			Level:       "info",
+			Format:      "json",
+			OutputFile:  "./logs/qr-menu.log",
+			MaxSize:     100,
+			MaxBackups:  10,
+			MaxAge:      30,
+			Compress:    true,
+			Development: true,
 		},
 		Analytics: AnalyticsConfig{
-			Enabled:         getEnvBool("ANALYTICS_ENABLED", true),
-			TrackingEnabled: getEnvBool("ANALYTICS_TRACKING_ENABLED", true),
-			StoragePath:     getEnv("ANALYTICS_STORAGE_PATH", "./analytics"),
-			CleanupInterval: getEnvDuration("ANALYTICS_CLEANUP_INTERVAL", 24*time.Hour),
-			RetentionDays:   getEnvInt("ANALYTICS_RETENTION_DAYS", 90),
+			Enabled:         true,
+			TrackingEnabled: true,
+			StoragePath:     "./analytics",
+			CleanupInterval: 24 * time.Hour,
+			RetentionDays:   365, // The dashboard shows up to one year of daily trend
+
+			MonthlyRetentionMonths: 36,
+			VisitorCookie:          true,
+			AnonymizeIP:            "truncate",
+			HashUserAgent:          true,
+			SaltRotation:           24 * time.Hour,
 		},
 		Security: SecurityConfig{
-			SessionTimeout:         getEnvDuration("SECURITY_SESSION_TIMEOUT", 24*time.Hour),
-			PasswordMinLen:         getEnvInt("SECURITY_PASSWORD_MIN_LEN", 8),
-			PasswordRequireSpecial: getEnvBool("SECURITY_PASSWORD_REQUIRE_SPECIAL", true),
-			PasswordRequireNumbers: getEnvBool("SECURITY_PASSWORD_REQUIRE_NUMBERS", true),
-			RateLimitPerSecond:     getEnvInt("SECURITY_RATE_LIMIT_PER_SEC", 10),
-			RateLimitBurst:         getEnvInt("SECURITY_RATE_LIMIT_BURST", 100),
-			CORSEnabled:            getEnvBool("SECURITY_CORS_ENABLED", true),
-			CORSAllowedOrigins:     []string{"http://localhost:3000", "http://localhost:8080"},
-			EnableHTTPS:            getEnvBool("SECURITY_ENABLE_HTTPS", false),
-			CertFile:               getEnv("SECURITY_CERT_FILE", ""),
-			KeyFile:                getEnv("SECURITY_KEY_FILE", ""),
+			SessionTimeout:         24 * time.Hour,
+			PasswordMinLen:         8,
+			PasswordRequireSpecial: true,
+			PasswordRequireNumbers: true,
+			RateLimitPerSecond:     10,
+			RateLimitBurst:         20,
+			RateLimitGroups: map[string]RateLimitGroup{
+				"api":      {RequestsPerMinute: 600, Burst: 120},
+				"auth":     {RequestsPerMinute: 30, Burst: 10},
+				"public":   {RequestsPerMinute: 1200, Burst: 300},
+				"feedback": {RequestsPerMinute: 5, Burst: 3},
+				"loyalty":  {RequestsPerMinute: 10, Burst: 5},
+				"orders":   {RequestsPerMinute: 10, Burst: 5},
+			},
+			RateLimitBackend:   "memory",
+			CORSEnabled:        true,
+			CORSAllowedOrigins: []string{"http://localhost:3000", "http://localhost:8080"},
+			EnableHTTPS:        false,
+			CertFile:           "",
+			KeyFile:            "",
+			JWTSecret:          "",
+			JWTExpiry:          15 * time.Minute,
+			JWTRefreshExpiry:   30 * 24 * time.Hour,
+			JWTIssuer:          "qr-menu",
+			AdminToken:         "",
+			AutocertCacheDir:   "./storage/autocert",
+			AVTimeout:          30 * time.Second,
+		},
+		Billing: BillingConfig{
+			MeterEventName: "qr_scan_overage",
+			IncludedScans:  map[string]int64{"free": 1000, "pro": 50000},
+			ReportInterval: time.Hour,
+			TrialDays:      14,
+			TrialPlan:      "pro",
+			TrialReminder:  72 * time.Hour,
+		},
+		Webhooks: WebhookConfig{
+			Timeout:          10 * time.Second,
+			MaxAttempts:      8,
+			RetryBaseDelay:   30 * time.Second,
+			RetryMaxDelay:    6 * time.Hour,
+			BreakerThreshold: 10,
+			BreakerCooldown:  time.Hour,
+		},
+		Events: EventsConfig{
+			Broker: "none",
+			Topic:  "qrmenu.events",
+			MaxLen: 10000,
 		},
 		Cache: CacheConfig{
-			Enabled:              getEnvBool("CACHE_ENABLED", true),
-			ResponseCacheTTL:     getEnvDuration("CACHE_RESPONSE_TTL", 5*time.Minute),
-			QueryCacheTTL:        getEnvDuration("CACHE_QUERY_TTL", 10*time.Minute),
-			MaxResponseCacheSize: getEnvInt("CACHE_MAX_RESPONSE_SIZE", 1000),
-			MaxQueryCacheSize:    getEnvInt("CACHE_MAX_QUERY_SIZE", 500),
-			InvalidateOnMutation: getEnvBool("CACHE_INVALIDATE_ON_MUTATION", true),
+			Enabled:              true,
+			ResponseCacheTTL:     5 * time.Minute,
+			QueryCacheTTL:        10 * time.Minute,
+			MaxResponseCacheSize: 1000,
+			MaxQueryCacheSize:    500,
+			InvalidateOnMutation: true,
+			Backend:              "memory",
+		},
+		Health: HealthConfig{
+			CheckTimeout:   2 * time.Second,
+			CacheFor:       5 * time.Second,
+			MinFreeDiskMB:  500,
+			QueueThreshold: 80,
+		},
+		GRPC: GRPCConfig{
+			Port:           9090,
+			Reflection:     true,
+			MaxMessageSize: 4 << 20,
+		},
+		AI: AIConfig{
+			Timeout:     30 * time.Second,
+			Plans:       []string{"pro"},
+			HourlyLimit: 30,
+		},
+		OCR: OCRConfig{
+			TesseractPath: "tesseract",
+			PDFToPPMPath:  "pdftoppm",
+			Languages:     "ita+eng",
+			Timeout:       time.Minute,
+			MaxUploadMB:   10,
+		},
+
+		Paths: PathsConfig{
+			StorageDir: "./storage",
+			StaticDir:  "./static",
+			LogDir:     defaultLogDir(),
+
+			SnapshotDir:   "./storage/snapshots",
+			QuarantineDir: "./storage/quarantine",
 		},
 	}
 }
 
+// Load returns the default configuration with environment overrides applied
+func Load() *Config {
+	cfg := Default()
+	cfg.applyEnv()
+	cfg.normalize()
+	return cfg
+}
+
+// LoadFile loads configuration in three layers: built-in defaults, the YAML file at
+// path (skipped if it does not exist) and environment variables. The result is validated
+func LoadFile(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if err := yaml.Unmarshal(data, cfg); err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+		case !os.IsNotExist(err):
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+
+	cfg.applyEnv()
+	cfg.normalize()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the current values with the environment variables that are set
+func (c *Config) applyEnv() {
+	c.Server.Port = getEnvInt("SERVER_PORT", c.Server.Port)
+	c.Server.Port = getEnvInt("PORT", c.Server.Port) // Railway/Heroku
+	c.Server.Host = getEnv("SERVER_HOST", c.Server.Host)
+	c.Server.ReadTimeout = getEnvDuration("SERVER_READ_TIMEOUT", c.Server.ReadTimeout)
+	c.Server.WriteTimeout = getEnvDuration("SERVER_WRITE_TIMEOUT", c.Server.WriteTimeout)
+	c.Server.IdleTimeout = getEnvDuration("SERVER_IDLE_TIMEOUT", c.Server.IdleTimeout)
+	c.Server.ReadHeaderTimeout = getEnvDuration("SERVER_READ_HEADER_TIMEOUT", c.Server.ReadHeaderTimeout)
+	c.Server.ShutdownTimeout = getEnvDuration("SERVER_SHUTDOWN_TIMEOUT", c.Server.ShutdownTimeout)
+	c.Server.HTTPRedirectPort = getEnvInt("SERVER_HTTP_REDIRECT_PORT", c.Server.HTTPRedirectPort)
+	c.Server.BaseURL = getEnv("SERVER_BASE_URL", c.Server.BaseURL)
+	c.Server.BaseURL = getEnv("BASE_URL", c.Server.BaseURL)
+	c.Server.TrustProxyHeaders = getEnvBool("SERVER_TRUST_PROXY_HEADERS", c.Server.TrustProxyHeaders)
+	c.Server.MaxBodySize = getEnvInt64("SERVER_MAX_BODY_SIZE", c.Server.MaxBodySize)
+	c.Server.Environment = getEnv("ENVIRONMENT", c.Server.Environment)
+	c.Database.DSN = getEnv("DATABASE_DSN", c.Database.DSN)
+	c.Database.MaxOpenConns = getEnvInt("DATABASE_MAX_OPEN_CONNS", c.Database.MaxOpenConns)
+	c.Database.MaxIdleConns = getEnvInt("DATABASE_MAX_IDLE_CONNS", c.Database.MaxIdleConns)
+	c.Database.ConnMaxLifetime = getEnvDuration("DATABASE_CONN_MAX_LIFETIME", c.Database.ConnMaxLifetime)
+	c.Database.ConnMaxIdleTime = getEnvDuration("DATABASE_CONN_MAX_IDLE_TIME", c.Database.ConnMaxIdleTime)
+	c.Database.Engine = getEnv("DATABASE_ENGINE", c.Database.Engine)
+	c.Database.MigrationPath = getEnv("DATABASE_MIGRATION_PATH", c.Database.MigrationPath)
+	c.Database.AutoMigrate = getEnvBool("DATABASE_AUTO_MIGRATE", c.Database.AutoMigrate)
+	c.Backup.QueueSize = getEnvInt("BACKUP_QUEUE_SIZE", c.Backup.QueueSize)
+	c.Backup.MaxBackups = getEnvInt("BACKUP_MAX_BACKUPS", c.Backup.MaxBackups)
+	c.Backup.ScheduleTime = getEnv("BACKUP_SCHEDULE_TIME", c.Backup.ScheduleTime)
+	c.Backup.Enabled = getEnvBool("BACKUP_ENABLED", c.Backup.Enabled)
+	c.Backup.CompressionLevel = getEnvInt("BACKUP_COMPRESSION_LEVEL", c.Backup.CompressionLevel)
+	c.Backup.RetentionDays = getEnvInt("BACKUP_RETENTION_DAYS", c.Backup.RetentionDays)
+	c.Backup.FullEvery = getEnvInt("BACKUP_FULL_EVERY", c.Backup.FullEvery)
+	c.Backup.RotationInterval = getEnvDuration("BACKUP_ROTATION_INTERVAL", c.Backup.RotationInterval)
+	c.Backup.StoragePath = getEnv("BACKUP_STORAGE_PATH", c.Backup.StoragePath)
+	c.Notifications.Workers = getEnvInt("NOTIFICATIONS_WORKERS", c.Notifications.Workers)
+	c.Notifications.QueueSize = getEnvInt("NOTIFICATIONS_QUEUE_SIZE", c.Notifications.QueueSize)
+	c.Notifications.BatchSize = getEnvInt("NOTIFICATIONS_BATCH_SIZE", c.Notifications.BatchSize)
+	c.Notifications.BatchTimeout = getEnvDuration("NOTIFICATIONS_BATCH_TIMEOUT", c.Notifications.BatchTimeout)
+	c.Notifications.MaxRetries = getEnvInt("NOTIFICATIONS_MAX_RETRIES", c.Notifications.MaxRetries)
+	c.Notifications.RetryDelay = getEnvDuration("NOTIFICATIONS_RETRY_DELAY", c.Notifications.RetryDelay)
+	c.Notifications.FCMCredentialsURL = getEnv("NOTIFICATIONS_FCM_CREDENTIALS_URL", c.Notifications.FCMCredentialsURL)
+	c.Notifications.VAPIDPublicKey = getEnv("NOTIFICATIONS_VAPID_PUBLIC_KEY", c.Notifications.VAPIDPublicKey)
+	c.Notifications.VAPIDPrivateKey = getEnv("NOTIFICATIONS_VAPID_PRIVATE_KEY", c.Notifications.VAPIDPrivateKey)
+	c.Notifications.VAPIDSubject = getEnv("NOTIFICATIONS_VAPID_SUBJECT", c.Notifications.VAPIDSubject)
+	c.Notifications.Enabled = getEnvBool("NOTIFICATIONS_ENABLED", c.Notifications.Enabled)
+	c.Notifications.EnableEmail = getEnvBool("NOTIFICATIONS_ENABLE_EMAIL", c.Notifications.EnableEmail)
+	c.Mail.Provider = getEnv("MAIL_PROVIDER", c.Mail.Provider)
+	c.Mail.SMTPHost = getEnv("MAIL_SMTP_HOST", c.Mail.SMTPHost)
+	c.Mail.SMTPPort = getEnvInt("MAIL_SMTP_PORT", c.Mail.SMTPPort)
+	c.Mail.SMTPUsername = getEnv("MAIL_SMTP_USERNAME", c.Mail.SMTPUsername)
+	c.Mail.SMTPPassword = getEnv("MAIL_SMTP_PASSWORD", c.Mail.SMTPPassword)
+	c.Mail.APIKey = getEnv("MAIL_API_KEY", c.Mail.APIKey)
+	c.Mail.Domain = getEnv("MAIL_DOMAIN", c.Mail.Domain)
+	c.Mail.APIBase = getEnv("MAIL_API_BASE", c.Mail.APIBase)
+	c.Mail.From = getEnv("MAIL_FROM", c.Mail.From)
+	c.Mail.WeeklyDigest = getEnvBool("MAIL_WEEKLY_DIGEST", c.Mail.WeeklyDigest)
+	c.Mail.Timeout = getEnvDuration("MAIL_TIMEOUT", c.Mail.Timeout)
+	c.SMS.Provider = getEnv("SMS_PROVIDER", c.SMS.Provider)
+	c.SMS.From = getEnv("SMS_FROM", c.SMS.From)
+	c.SMS.Senders = getEnvMap("SMS_SENDERS", c.SMS.Senders)
+	c.SMS.AccountSID = getEnv("SMS_ACCOUNT_SID", c.SMS.AccountSID)
+	c.SMS.AuthToken = getEnv("SMS_AUTH_TOKEN", c.SMS.AuthToken)
+	c.SMS.APIKey = getEnv("SMS_API_KEY", c.SMS.APIKey)
+	c.SMS.APISecret = getEnv("SMS_API_SECRET", c.SMS.APISecret)
+	c.SMS.WebhookToken = getEnv("SMS_WEBHOOK_TOKEN", c.SMS.WebhookToken)
+	c.SMS.APIBase = getEnv("SMS_API_BASE", c.SMS.APIBase)
+	c.SMS.Timeout = getEnvDuration("SMS_TIMEOUT", c.SMS.Timeout)
+	c.WhatsApp.AppSecret = getEnv("WHATSAPP_APP_SECRET", c.WhatsApp.AppSecret)
+	c.WhatsApp.VerifyToken = getEnv("WHATSAPP_VERIFY_TOKEN", c.WhatsApp.VerifyToken)
+	c.WhatsApp.APIBase = getEnv("WHATSAPP_API_BASE", c.WhatsApp.APIBase)
+	c.WhatsApp.Timeout = getEnvDuration("WHATSAPP_TIMEOUT", c.WhatsApp.Timeout)
+	c.Telegram.BotToken = getEnv("TELEGRAM_BOT_TOKEN", c.Telegram.BotToken)
+	c.Telegram.BotUsername = strings.TrimPrefix(getEnv("TELEGRAM_BOT_USERNAME", c.Telegram.BotUsername), "@")
+	c.Telegram.WebhookSecret = getEnv("TELEGRAM_WEBHOOK_SECRET", c.Telegram.WebhookSecret)
+	c.Telegram.APIBase = getEnv("TELEGRAM_API_BASE", c.Telegram.APIBase)
+	c.Telegram.Timeout = getEnvDuration("TELEGRAM_TIMEOUT", c.Telegram.Timeout)
+	c.Telegram.DailySummaryAt = getEnv("TELEGRAM_DAILY_SUMMARY_AT", c.Telegram.DailySummaryAt)
+	c.Integrations.SyncInterval = getEnvDuration("INTEGRATIONS_SYNC_INTERVAL", c.Integrations.SyncInterval)
+	c.Integrations.Timeout = getEnvDuration("INTEGRATIONS_TIMEOUT", c.Integrations.Timeout)
+	c.Wallet.ApplePassTypeID = getEnv("WALLET_APPLE_PASS_TYPE_ID", c.Wallet.ApplePassTypeID)
+	c.Wallet.AppleTeamID = getEnv("WALLET_APPLE_TEAM_ID", c.Wallet.AppleTeamID)
+	c.Wallet.AppleCertFile = getEnv("WALLET_APPLE_CERT_FILE", c.Wallet.AppleCertFile)
+	c.Wallet.AppleKeyFile = getEnv("WALLET_APPLE_KEY_FILE", c.Wallet.AppleKeyFile)
+	c.Wallet.AppleWWDRFile = getEnv("WALLET_APPLE_WWDR_FILE", c.Wallet.AppleWWDRFile)
+	c.Wallet.GoogleIssuerID = getEnv("WALLET_GOOGLE_ISSUER_ID", c.Wallet.GoogleIssuerID)
+	c.Wallet.GoogleCredentials = getEnv("WALLET_GOOGLE_CREDENTIALS", c.Wallet.GoogleCredentials)
+	c.Wallet.Timeout = getEnvDuration("WALLET_TIMEOUT", c.Wallet.Timeout)
+	c.Localization.DefaultLanguage = getEnv("LOCALIZATION_DEFAULT_LANG", c.Localization.DefaultLanguage)
+	c.Localization.DateFormat = getEnv("LOCALIZATION_DATE_FORMAT", c.Localization.DateFormat)
+	c.Localization.TimeFormat = getEnv("LOCALIZATION_TIME_FORMAT", c.Localization.TimeFormat)
+	c.Localization.TimezoneOffset = getEnvInt("LOCALIZATION_TIMEZONE_OFFSET", c.Localization.TimezoneOffset)
+	c.Logger.Level = getEnv("LOG_LEVEL", c.Logger.Level) // legacy name
+	c.Logger.Level = getEnv("LOGGER_LEVEL", c.Logger.Level)
+	c.Logger.Format = getEnv("LOGGER_FORMAT", c.Logger.Format)
+	c.Logger.OutputFile = getEnv("LOGGER_OUTPUT_FILE", c.Logger.OutputFile)
+	c.Logger.MaxSize = getEnvInt("LOGGER_MAX_SIZE", c.Logger.MaxSize)
+	c.Logger.MaxBackups = getEnvInt("LOGGER_MAX_BACKUPS", c.Logger.MaxBackups)
+	c.Logger.MaxAge = getEnvInt("LOGGER_MAX_AGE", c.Logger.MaxAge)
+	c.Logger.Compress = getEnvBool("LOGGER_COMPRESS", c.Logger.Compress)
+	c.Analytics.Enabled = getEnvBool("ANALYTICS_ENABLED", c.Analytics.Enabled)
+	c.Analytics.TrackingEnabled = getEnvBool("ANALYTICS_TRACKING_ENABLED", c.Analytics.TrackingEnabled)
+	c.Analytics.StoragePath = getEnv("ANALYTICS_STORAGE_PATH", c.Analytics.StoragePath)
+	c.Analytics.CleanupInterval = getEnvDuration("ANALYTICS_CLEANUP_INTERVAL", c.Analytics.CleanupInterval)
+	c.Analytics.RetentionDays = getEnvInt("ANALYTICS_RETENTION_DAYS", c.Analytics.RetentionDays)
+	c.Analytics.MonthlyRetentionMonths = getEnvInt("ANALYTICS_MONTHLY_RETENTION_MONTHS", c.Analytics.MonthlyRetentionMonths)
+	c.Analytics.VisitorCookie = getEnvBool("ANALYTICS_VISITOR_COOKIE", c.Analytics.VisitorCookie)
+	c.Analytics.GeoIPDatabase = getEnv("ANALYTICS_GEOIP_DATABASE", c.Analytics.GeoIPDatabase)
+	c.Analytics.AnonymizeIP = getEnv("ANALYTICS_ANONYMIZE_IP", c.Analytics.AnonymizeIP)
+	c.Analytics.HashUserAgent = getEnvBool("ANALYTICS_HASH_USER_AGENT", c.Analytics.HashUserAgent)
+	c.Analytics.SaltRotation = getEnvDuration("ANALYTICS_SALT_ROTATION", c.Analytics.SaltRotation)
+	c.Security.SessionTimeout = getEnvDuration("SECURITY_SESSION_TIMEOUT", c.Security.SessionTimeout)
+	c.Security.PasswordMinLen = getEnvInt("SECURITY_PASSWORD_MIN_LEN", c.Security.PasswordMinLen)
+	c.Security.PasswordRequireSpecial = getEnvBool("SECURITY_PASSWORD_REQUIRE_SPECIAL", c.Security.PasswordRequireSpecial)
+	c.Security.PasswordRequireNumbers = getEnvBool("SECURITY_PASSWORD_REQUIRE_NUMBERS", c.Security.PasswordRequireNumbers)
+	c.Security.RateLimitPerSecond = getEnvInt("SECURITY_RATE_LIMIT_PER_SEC", c.Security.RateLimitPerSecond)
+	c.Security.RateLimitBurst = getEnvInt("SECURITY_RATE_LIMIT_BURST", c.Security.RateLimitBurst)
+	c.Security.RateLimitBackend = getEnv("RATE_LIMIT_BACKEND", c.Security.RateLimitBackend)
+	c.Security.RedisURL = getEnv("REDIS_URL", c.Security.RedisURL)
+	c.Security.CORSEnabled = getEnvBool("SECURITY_CORS_ENABLED", c.Security.CORSEnabled)
+	c.Security.EnableHTTPS = getEnvBool("SECURITY_ENABLE_HTTPS", c.Security.EnableHTTPS)
+	c.Security.CertFile = getEnv("SECURITY_CERT_FILE", c.Security.CertFile)
+	c.Security.KeyFile = getEnv("SECURITY_KEY_FILE", c.Security.KeyFile)
+	c.Security.AutocertEnabled = getEnvBool("SECURITY_AUTOCERT_ENABLED", c.Security.AutocertEnabled)
+	c.Security.AutocertDomains = getEnvList("SECURITY_AUTOCERT_DOMAINS", c.Security.AutocertDomains)
+	c.Security.AutocertEmail = getEnv("SECURITY_AUTOCERT_EMAIL", c.Security.AutocertEmail)
+	c.Security.AutocertCacheDir = getEnv("SECURITY_AUTOCERT_CACHE_DIR", c.Security.AutocertCacheDir)
+	c.Security.AVScanner = getEnv("SECURITY_AV_SCANNER", c.Security.AVScanner)
+	c.Security.AVAddress = getEnv("SECURITY_AV_ADDRESS", c.Security.AVAddress)
+	c.Security.AVTimeout = getEnvDuration("SECURITY_AV_TIMEOUT", c.Security.AVTimeout)
+	c.Security.AVFailClosed = getEnvBool("SECURITY_AV_FAIL_CLOSED", c.Security.AVFailClosed)
+	c.Cache.Enabled = getEnvBool("CACHE_ENABLED", c.Cache.Enabled)
+	c.Cache.ResponseCacheTTL = getEnvDuration("CACHE_RESPONSE_TTL", c.Cache.ResponseCacheTTL)
+	c.Cache.QueryCacheTTL = getEnvDuration("CACHE_QUERY_TTL", c.Cache.QueryCacheTTL)
+	c.Cache.MaxResponseCacheSize = getEnvInt("CACHE_MAX_RESPONSE_SIZE", c.Cache.MaxResponseCacheSize)
+	c.Cache.MaxQueryCacheSize = getEnvInt("CACHE_MAX_QUERY_SIZE", c.Cache.MaxQueryCacheSize)
+	c.Cache.InvalidateOnMutation = getEnvBool("CACHE_INVALIDATE_ON_MUTATION", c.Cache.InvalidateOnMutation)
+	c.Cache.Backend = getEnv("CACHE_BACKEND", c.Cache.Backend)
+	c.Cache.RedisURL = getEnv("CACHE_REDIS_URL", c.Cache.RedisURL)
+	c.Health.CheckTimeout = getEnvDuration("HEALTH_CHECK_TIMEOUT", c.Health.CheckTimeout)
+	c.Health.CacheFor = getEnvDuration("HEALTH_CACHE_FOR", c.Health.CacheFor)
+	c.Health.MinFreeDiskMB = getEnvInt("HEALTH_MIN_FREE_DISK_MB", c.Health.MinFreeDiskMB)
+	c.Health.QueueThreshold = getEnvInt("HEALTH_QUEUE_THRESHOLD", c.Health.QueueThreshold)
+	c.GRPC.Enabled = getEnvBool("GRPC_ENABLED", c.GRPC.Enabled)
+	c.GRPC.Port = getEnvInt("GRPC_PORT", c.GRPC.Port)
+	c.GRPC.CertFile = getEnv("GRPC_CERT_FILE", c.GRPC.CertFile)
+	c.GRPC.KeyFile = getEnv("GRPC_KEY_FILE", c.GRPC.KeyFile)
+	c.GRPC.ClientCAFile = getEnv("GRPC_CLIENT_CA_FILE", c.GRPC.ClientCAFile)
+	c.GRPC.Reflection = getEnvBool("GRPC_REFLECTION", c.GRPC.Reflection)
+	c.AI.Provider = getEnv("AI_PROVIDER", c.AI.Provider)
+	c.AI.BaseURL = getEnv("AI_BASE_URL", c.AI.BaseURL)
+	c.AI.APIKey = getEnv("AI_API_KEY", c.AI.APIKey)
+	c.AI.Model = getEnv("AI_MODEL", c.AI.Model)
+	c.AI.Timeout = getEnvDuration("AI_TIMEOUT", c.AI.Timeout)
+	c.AI.Plans = getEnvList("AI_PLANS", c.AI.Plans)
+	c.AI.HourlyLimit = getEnvInt("AI_HOURLY_LIMIT", c.AI.HourlyLimit)
+	c.OCR.Engine = getEnv("OCR_ENGINE", c.OCR.Engine)
+	c.OCR.TesseractPath = getEnv("OCR_TESSERACT_PATH", c.OCR.TesseractPath)
+	c.OCR.Languages = getEnv("OCR_LANGUAGES", c.OCR.Languages)
+	c.OCR.APIURL = getEnv("OCR_API_URL", c.OCR.APIURL)
+	c.OCR.APIKey = getEnv("OCR_API_KEY", c.OCR.APIKey)
+	c.OCR.Timeout = getEnvDuration("OCR_TIMEOUT", c.OCR.Timeout)
+	c.Security.JWTSecret = getEnv("JWT_SECRET", c.Security.JWTSecret)
+	c.Security.JWTExpiry = getEnvDuration("JWT_EXPIRY", c.Security.JWTExpiry)
+	c.Security.JWTRefreshExpiry = getEnvDuration("JWT_REFRESH_EXPIRY", c.Security.JWTRefreshExpiry)
+	c.Security.JWTIssuer = getEnv("JWT_ISSUER", c.Security.JWTIssuer)
+	c.Security.AdminToken = getEnv("ADMIN_API_TOKEN", c.Security.AdminToken)
+	c.Security.MetricsToken = getEnv("METRICS_TOKEN", c.Security.MetricsToken)
+	c.OAuth.GoogleClientID = getEnv("OAUTH_GOOGLE_CLIENT_ID", c.OAuth.GoogleClientID)
+	c.OAuth.GoogleClientSecret = getEnv("OAUTH_GOOGLE_CLIENT_SECRET", c.OAuth.GoogleClientSecret)
+	c.OAuth.AppleClientID = getEnv("OAUTH_APPLE_CLIENT_ID", c.OAuth.AppleClientID)
+	c.OAuth.AppleTeamID = getEnv("OAUTH_APPLE_TEAM_ID", c.OAuth.AppleTeamID)
+	c.OAuth.AppleKeyID = getEnv("OAUTH_APPLE_KEY_ID", c.OAuth.AppleKeyID)
+	c.OAuth.ApplePrivateKey = getEnv("OAUTH_APPLE_PRIVATE_KEY", c.OAuth.ApplePrivateKey)
+	c.Billing.StripeSecretKey = getEnv("STRIPE_SECRET_KEY", c.Billing.StripeSecretKey)
+	c.Billing.StripeWebhookSecret = getEnv("STRIPE_WEBHOOK_SECRET", c.Billing.StripeWebhookSecret)
+	c.Billing.MeterEventName = getEnv("BILLING_METER_EVENT_NAME", c.Billing.MeterEventName)
+	c.Billing.ReportInterval = getEnvDuration("BILLING_REPORT_INTERVAL", c.Billing.ReportInterval)
+	c.Billing.TrialDays = getEnvInt("BILLING_TRIAL_DAYS", c.Billing.TrialDays)
+	c.Billing.TrialPlan = getEnv("BILLING_TRIAL_PLAN", c.Billing.TrialPlan)
+	c.Events.Broker = getEnv("EVENTS_BROKER", c.Events.Broker)
+	c.Events.BrokerURL = getEnv("EVENTS_BROKER_URL", c.Events.BrokerURL)
+	c.Events.Topic = getEnv("EVENTS_TOPIC", c.Events.Topic)
+	c.Paths.StorageDir = getEnv("STORAGE_DIR", c.Paths.StorageDir)
+	c.Paths.StaticDir = getEnv("STATIC_DIR", c.Paths.StaticDir)
+	c.Paths.LogDir = getEnv("LOG_DIR", c.Paths.LogDir)
+	c.Paths.SnapshotDir = getEnv("SNAPSHOT_DIR", c.Paths.SnapshotDir)
+	c.Paths.QuarantineDir = getEnv("QUARANTINE_DIR", c.Paths.QuarantineDir)
+}
+
+// normalize maps equivalent spellings to canonical values and derives dependent settings
+func (c *Config) normalize() {
+	switch strings.ToLower(c.Server.Environment) {
+	case "production", "prod":
+		c.Server.Environment = "prod"
+	case "development", "dev", "":
+		c.Server.Environment = "dev"
+	default:
+		c.Server.Environment = strings.ToLower(c.Server.Environment)
+	}
+	c.Server.BaseURL = strings.TrimRight(strings.TrimSpace(c.Server.BaseURL), "/")
+	c.Logger.Level = strings.ToLower(c.Logger.Level)
+	c.Logger.Development = c.Server.Environment == "dev"
+}
+
+// defaultLogDir uses /tmp on PaaS platforms (PORT set), where the working directory may be read-only
+func defaultLogDir() string {
+	if os.Getenv("PORT") != "" {
+		return "/tmp/logs"
+	}
+	return "./logs"
+}
+
 // Helper functions
 
 func getEnv(key, defaultValue string) string {
@@ -263,6 +906,36 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return boolVal
 }
 
+// getEnvList reads a comma-separated list, ignoring empty entries
+func getEnvList(key string, defaultValue []string) []string {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// getEnvMap reads comma-separated key=value pairs, e.g. "39=QRMenu,1=+15551234567"
+func getEnvMap(key string, defaultValue map[string]string) map[string]string {
+	list := getEnvList(key, nil)
+	if list == nil {
+		return defaultValue
+	}
+	m := make(map[string]string, len(list))
+	for _, item := range list {
+		if k, v, ok := strings.Cut(item, "="); ok {
+			m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return m
+}
+
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	value := getEnv(key, "")
 	if value == "" {
@@ -275,6 +948,41 @@ func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	return duration
 }
 
+// TLSEnabled returns true if the server terminates TLS itself, with static certificates or autocert
+func (c *Config) TLSEnabled() bool {
+	return c.Security.EnableHTTPS || c.Security.AutocertEnabled
+}
+
+// CacheRedisURL returns the Redis server of the cache, which defaults to the one of the rate limits
+func (c *Config) CacheRedisURL() string {
+	if c.Cache.RedisURL != "" {
+		return c.Cache.RedisURL
+	}
+	return c.Security.RedisURL
+}
+
+// EventsBrokerURL returns the server of the event broker; a Redis broker defaults to the server
+// of the rate limits
+func (c *Config) EventsBrokerURL() string {
+	if c.Events.BrokerURL == "" && c.Events.Broker == "redis" {
+		return c.Security.RedisURL
+	}
+	return c.Events.BrokerURL
+}
+
+// BackupSchedules returns the backup schedules, which default to a daily full backup at
+// schedule_time
+func (c *Config) BackupSchedules() []BackupScheduleConfig {
+	if len(c.Backup.Schedules) > 0 {
+		return c.Backup.Schedules
+	}
+	at, err := time.Parse("15:04", c.Backup.ScheduleTime)
+	if err != nil {
+		at = time.Date(0, 1, 1, 2, 0, 0, 0, time.UTC)
+	}
+	return []BackupScheduleConfig{{Name: "daily", Cron: fmt.Sprintf("%d %d * * *", at.Minute(), at.Hour()), Kind: "full"}}
+}
+
 // IsDevelopment returns true if environment is development
 func (c *Config) IsDevelopment() bool {
 	return c.Server.Environment == "dev"
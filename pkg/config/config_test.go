@@ -0,0 +1,159 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLoadFileLayers tests that environment variables override config.yaml, which overrides defaults
+func TestLoadFileLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yamlData := `
+server:
+  port: 9000
+  read_timeout: 30s
+backup:
+  schedule_time: "03:30"
+security:
+  rate_limit_per_second: 5
+  rate_limit_burst: 50
+`
+	if err := os.WriteFile(path, []byte(yamlData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SECURITY_RATE_LIMIT_BURST", "80")
+	t.Setenv("ENVIRONMENT", "production")
+
+	cfg, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+
+	if cfg.Server.Port != 9000 || cfg.Server.ReadTimeout != 30*time.Second {
+		t.Errorf("Expected YAML server values, got port %d timeout %v", cfg.Server.Port, cfg.Server.ReadTimeout)
+	}
+	if cfg.Backup.ScheduleTime != "03:30" {
+		t.Errorf("Expected schedule 03:30, got %s", cfg.Backup.ScheduleTime)
+	}
+	if schedules := cfg.BackupSchedules(); len(schedules) != 1 || schedules[0].Cron != "30 3 * * *" || schedules[0].Kind != "full" {
+		t.Errorf("Expected a daily full backup at 03:30, got %+v", schedules)
+	}
+	if cfg.Security.RateLimitPerSecond != 5 || cfg.Security.RateLimitBurst != 80 {
+		t.Errorf("Expected rate limit 5/80, got %d/%d", cfg.Security.RateLimitPerSecond, cfg.Security.RateLimitBurst)
+	}
+	if cfg.Server.WriteTimeout != 60*time.Second {
+		t.Errorf("Expected default write timeout, got %v", cfg.Server.WriteTimeout)
+	}
+	if !cfg.IsProduction() {
+		t.Errorf("Expected production environment, got %s", cfg.Server.Environment)
+	}
+}
+
+// TestLoadFileMissing tests that a missing file falls back to defaults
+func TestLoadFileMissing(t *testing.T) {
+	cfg, err := LoadFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if cfg.Server.Port == 0 {
+		t.Error("Expected default port")
+	}
+}
+
+// TestValidate tests that all invalid settings are reported
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = 70000
+	cfg.Backup.ScheduleTime = "2am"
+	cfg.Security.JWTSecret = "short"
+	cfg.Server.BaseURL = "menu.example.com"
+	cfg.Analytics.RetentionDays = 0
+	cfg.Analytics.AnonymizeIP = "mask"
+	cfg.Notifications.FCMCredentialsURL = "s3://bucket/fcm.json"
+	cfg.OAuth.AppleClientID = "com.example.menu"
+	cfg.Security.JWTRefreshExpiry = time.Minute
+	cfg.Security.RateLimitBackend = "redis"
+	cfg.Cache.Backend = "memcached"
+	cfg.Billing.ReportInterval = time.Second
+	cfg.Billing.TrialDays = -1
+	cfg.Webhooks.MaxAttempts = 0
+	cfg.Events.Broker = "nats"
+	cfg.Backup.Targets = []BackupTargetConfig{{Name: "offsite", Type: "sftp", Address: "backup.example.com", User: "qrmenu", Password: "secret"}}
+	cfg.Cache.RouteTTL = map[string]time.Duration{"api/v1/i18n": time.Hour}
+	cfg.Backup.FullEvery = -1
+	cfg.Backup.Schedules = []BackupScheduleConfig{{Name: "hourly", Cron: "0 * * *", Kind: "incremental"}}
+	cfg.Health.QueueThreshold = 0
+	cfg.GRPC.Enabled = true
+	cfg.GRPC.ClientCAFile = "/etc/qr-menu/pos-ca.pem"
+	cfg.AI.Provider = "openai"
+	cfg.AI.Model = "gpt-4o-mini"
+	cfg.OCR.Engine = "api"
+	cfg.Database.Engine = "sqlite"
+	cfg.SMS.Provider = "vonage"
+	cfg.SMS.Senders = map[string]string{"+39": "QRMenu"}
+	cfg.WhatsApp.AppSecret = "secret"
+	cfg.Telegram.BotToken = "123:token"
+	cfg.Telegram.BotUsername = "qrmenu_bot"
+	cfg.Telegram.WebhookSecret = "not a secret"
+	cfg.Telegram.DailySummaryAt = "25:00"
+	cfg.Integrations.SyncInterval = time.Minute
+	cfg.Wallet.GoogleIssuerID = "3388000000012345678"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	for _, field := range []string{"server.port", "backup.schedule_time", "security.jwt_secret", "server.base_url", "analytics.retention_days", "analytics.anonymize_ip", "notifications.fcm_credentials_url", "oauth.apple_team_id", "security.jwt_refresh_expiry", "security.redis_url", "cache.backend", "cache.route_ttl", "billing.report_interval", "billing.trial_days", "webhooks.max_attempts", "events.broker_url", "backup.targets[0].host_key", "backup.full_every", "backup.schedules[0].cron", "health.queue_threshold", "grpc.client_ca_file", "ai.api_key", "ocr.api_url", "sms.api_key", "sms.webhook_token", "sms.senders", "whatsapp.verify_token", "telegram.webhook_secret", "telegram.daily_summary_at", "integrations.sync_interval", "wallet.google_credentials", "database.engine"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected error for %s, got: %v", field, err)
+		}
+	}
+}
+
+// TestValidateMailBaseURL tests that an email provider requires the public base URL, since
+// emailed links must not be built from the request Host
+func TestValidateMailBaseURL(t *testing.T) {
+	cfg := Default()
+	cfg.Mail.Provider = "sendgrid"
+	cfg.Mail.APIKey = "SG.key"
+	cfg.Mail.From = "no-reply@example.com"
+
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "server.base_url") {
+		t.Fatalf("Expected server.base_url error, got %v", err)
+	}
+
+	cfg.Server.BaseURL = "https://menu.example.com"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+}
+
+// TestRedacted tests that secrets are masked without modifying the original
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Security.JWTSecret = strings.Repeat("x", 32)
+	cfg.Backup.Targets = []BackupTargetConfig{{Name: "offsite", Type: "s3", SecretKey: "s3-secret"}}
+
+	out, err := cfg.Redacted().AsMap()
+	if err != nil {
+		t.Fatalf("AsMap failed: %v", err)
+	}
+	security := out["security"].(map[string]interface{})
+	if security["jwt_secret"] != redacted {
+		t.Errorf("Expected masked secret, got %v", security["jwt_secret"])
+	}
+	target := out["backup"].(map[string]interface{})["targets"].([]interface{})[0].(map[string]interface{})
+	if target["secret_key"] != redacted {
+		t.Errorf("Expected masked backup target secret, got %v", target["secret_key"])
+	}
+	if cfg.Security.JWTSecret == redacted || cfg.Backup.Targets[0].SecretKey == redacted {
+		t.Error("Redacted modified the original config")
+	}
+	if out["server"].(map[string]interface{})["read_timeout"] != "30s" {
+		t.Errorf("Expected duration as string, got %v", out["server"].(map[string]interface{})["read_timeout"])
+	}
+}
@@ -0,0 +1,393 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"qr-menu/pkg/cron"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values in Redacted output
+const redacted = "[REDACTED]"
+
+// Validate checks the configuration and returns all problems found, joined in a single error
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	// Server
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.MaxBodySize > 0, "server.max_body_size must be positive")
+	check(oneOf(c.Server.Environment, "dev", "staging", "prod"), "server.environment must be dev, staging or prod, got %q", c.Server.Environment)
+	if c.Server.BaseURL != "" {
+		u, err := url.Parse(c.Server.BaseURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.RawQuery == "" && u.Fragment == "",
+			"server.base_url must be an absolute http(s) URL without query, got %q", c.Server.BaseURL)
+	}
+
+	// Database
+	check(oneOf(c.Database.Engine, "postgres", "mysql"), "database.engine must be postgres or mysql, got %q", c.Database.Engine)
+
+	// Backup
+	if c.Backup.Enabled {
+		_, err := time.Parse("15:04", c.Backup.ScheduleTime)
+		check(err == nil, "backup.schedule_time must be in HH:MM format, got %q", c.Backup.ScheduleTime)
+		check(c.Backup.MaxBackups > 0, "backup.max_backups must be positive")
+		check(c.Backup.RetentionDays > 0, "backup.retention_days must be positive")
+		check(c.Backup.StoragePath != "", "backup.storage_path is required")
+	}
+	check(c.Backup.FullEvery >= 0, "backup.full_every must not be negative")
+	check(c.Backup.CompressionLevel >= 1 && c.Backup.CompressionLevel <= 9, "backup.compression_level must be between 1 and 9, got %d", c.Backup.CompressionLevel)
+	targetNames := map[string]bool{}
+	for i, t := range c.Backup.Targets {
+		check(t.Name != "" && !targetNames[t.Name], "backup.targets[%d].name is required and must be unique", i)
+		targetNames[t.Name] = true
+		check(t.MaxBackups >= 0 && t.MaxAge >= 0, "backup.targets[%d] max_backups and max_age must not be negative", i)
+		switch t.Type {
+		case "s3":
+			check(t.Endpoint != "" && t.Bucket != "", "backup.targets[%d].endpoint and bucket are required for s3", i)
+		case "sftp":
+			check(t.Address != "" && t.User != "", "backup.targets[%d].address and user are required for sftp", i)
+			check(t.Password != "" || t.KeyFile != "", "backup.targets[%d].password or key_file is required for sftp", i)
+			check(t.HostKey != "", "backup.targets[%d].host_key is required for sftp", i)
+		case "gdrive":
+			check(t.CredentialsFile != "" && t.FolderID != "", "backup.targets[%d].credentials_file and folder_id are required for gdrive", i)
+		default:
+			check(false, "backup.targets[%d].type must be s3, sftp or gdrive, got %q", i, t.Type)
+		}
+	}
+	scheduleNames := map[string]bool{}
+	for i, sc := range c.Backup.Schedules {
+		check(sc.Name != "" && !scheduleNames[sc.Name], "backup.schedules[%d].name is required and must be unique", i)
+		scheduleNames[sc.Name] = true
+		_, err := cron.Parse(sc.Cron)
+		check(err == nil, "backup.schedules[%d].cron is not a valid cron expression: %v", i, err)
+		check(oneOf(sc.Kind, "full", "incremental"), "backup.schedules[%d].kind must be full or incremental, got %q", i, sc.Kind)
+	}
+
+	// Mail
+	check(oneOf(c.Mail.Provider, "", "log", "smtp", "sendgrid", "mailgun"), "mail.provider must be empty, log, smtp, sendgrid or mailgun, got %q", c.Mail.Provider)
+	if c.Mail.Provider == "smtp" || (c.Mail.Provider == "" && c.Mail.SMTPHost != "") {
+		check(c.Mail.SMTPHost != "", "mail.smtp_host is required when mail.provider is smtp")
+		check(c.Mail.SMTPPort > 0 && c.Mail.SMTPPort <= 65535, "mail.smtp_port must be between 1 and 65535, got %d", c.Mail.SMTPPort)
+	}
+	if c.Mail.Provider == "sendgrid" || c.Mail.Provider == "mailgun" {
+		check(c.Mail.APIKey != "", "mail.api_key is required when mail.provider is %s", c.Mail.Provider)
+	}
+	if c.Mail.Provider == "mailgun" {
+		check(c.Mail.Domain != "", "mail.domain is required when mail.provider is mailgun")
+	}
+	if !oneOf(c.Mail.Provider, "", "log") || (c.Mail.Provider == "" && c.Mail.SMTPHost != "") {
+		check(c.Mail.From != "", "mail.from is required when an email provider is configured")
+		check(c.Mail.Timeout > 0, "mail.timeout must be positive")
+		check(c.Server.BaseURL != "", "server.base_url is required when an email provider is configured: emailed links are never built from the request Host")
+	}
+	if u, err := url.Parse(c.Notifications.FCMCredentialsURL); err == nil && len(u.Scheme) > 1 { // A single letter is a Windows drive
+		check(oneOf(u.Scheme, "file", "http", "https"),
+			"notifications.fcm_credentials_url must be a path or a file://, http:// or https:// URL")
+	}
+	if c.Notifications.VAPIDPublicKey != "" || c.Notifications.VAPIDPrivateKey != "" {
+		check(c.Notifications.VAPIDPublicKey != "" && c.Notifications.VAPIDPrivateKey != "",
+			"notifications.vapid_public_key and vapid_private_key must be set together")
+		check(strings.HasPrefix(c.Notifications.VAPIDSubject, "mailto:") || strings.HasPrefix(c.Notifications.VAPIDSubject, "https://"),
+			"notifications.vapid_subject must be a mailto: or https:// URL when VAPID keys are set")
+	}
+	if c.Notifications.EnableEmail {
+		check(c.Notifications.Workers > 0, "notifications.workers must be positive when enable_email is true")
+		check(c.Notifications.QueueSize > 0, "notifications.queue_size must be positive when enable_email is true")
+		check(c.Notifications.MaxRetries >= 0, "notifications.max_retries must not be negative")
+		check(c.Notifications.RetryDelay > 0, "notifications.retry_delay must be positive when enable_email is true")
+	}
+
+	// SMS
+	check(oneOf(c.SMS.Provider, "", "log", "twilio", "vonage"), "sms.provider must be empty, log, twilio or vonage, got %q", c.SMS.Provider)
+	if c.SMS.Provider == "twilio" {
+		check(c.SMS.AccountSID != "" && c.SMS.AuthToken != "", "sms.account_sid and sms.auth_token are required when sms.provider is twilio")
+	}
+	if c.SMS.Provider == "vonage" {
+		check(c.SMS.APIKey != "" && c.SMS.APISecret != "", "sms.api_key and sms.api_secret are required when sms.provider is vonage")
+		check(len(c.SMS.WebhookToken) >= 16, "sms.webhook_token must be at least 16 characters when sms.provider is vonage")
+	}
+	if oneOf(c.SMS.Provider, "twilio", "vonage") {
+		check(c.SMS.From != "" || len(c.SMS.Senders) > 0, "sms.from or sms.senders is required when an SMS provider is configured")
+		check(c.SMS.Timeout > 0, "sms.timeout must be positive")
+	}
+	for code, sender := range c.SMS.Senders {
+		check(code != "" && len(code) <= 4 && strings.Trim(code, "0123456789") == "" && code[0] != '0',
+			"sms.senders keys must be country calling codes without +, got %q", code)
+		check(sender != "", "sms.senders[%s] must not be empty", code)
+	}
+
+	// WhatsApp
+	if c.WhatsApp.AppSecret != "" {
+		check(len(c.WhatsApp.VerifyToken) >= 16, "whatsapp.verify_token must be at least 16 characters when whatsapp.app_secret is set")
+		check(c.WhatsApp.Timeout > 0, "whatsapp.timeout must be positive")
+	}
+
+	// Telegram
+	if c.Telegram.BotToken != "" {
+		check(c.Telegram.BotUsername != "", "telegram.bot_username is required when telegram.bot_token is set")
+		check(len(c.Telegram.WebhookSecret) >= 16 && len(c.Telegram.WebhookSecret) <= 256 &&
+			strings.Trim(c.Telegram.WebhookSecret, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-") == "",
+			"telegram.webhook_secret must be 16-256 letters, digits, _ or - when telegram.bot_token is set")
+		check(c.Telegram.Timeout > 0, "telegram.timeout must be positive")
+		_, err := time.Parse("15:04", c.Telegram.DailySummaryAt)
+		check(err == nil, "telegram.daily_summary_at must be a time like 21:00, got %q", c.Telegram.DailySummaryAt)
+	}
+
+	// Delivery platform integrations
+	check(c.Integrations.SyncInterval == 0 || c.Integrations.SyncInterval >= 5*time.Minute,
+		"integrations.sync_interval must be 0 (disabled) or at least 5m, got %s", c.Integrations.SyncInterval)
+	check(c.Integrations.Timeout > 0, "integrations.timeout must be positive")
+
+	// Wallet passes
+	if c.Wallet.ApplePassTypeID != "" {
+		check(c.Wallet.AppleTeamID != "" && c.Wallet.AppleCertFile != "" && c.Wallet.AppleKeyFile != "" && c.Wallet.AppleWWDRFile != "",
+			"wallet.apple_team_id, wallet.apple_cert_file, wallet.apple_key_file and wallet.apple_wwdr_file are required when wallet.apple_pass_type_id is set")
+	}
+	check(c.Wallet.GoogleIssuerID == "" || c.Wallet.GoogleCredentials != "",
+		"wallet.google_credentials is required when wallet.google_issuer_id is set")
+	check(c.Wallet.Timeout > 0, "wallet.timeout must be positive")
+
+	// Analytics
+	if c.Analytics.Enabled {
+		check(c.Analytics.CleanupInterval > 0, "analytics.cleanup_interval must be positive")
+		check(c.Analytics.RetentionDays > 0, "analytics.retention_days must be positive")
+		check(c.Analytics.MonthlyRetentionMonths >= 0, "analytics.monthly_retention_months must not be negative")
+		check(oneOf(c.Analytics.AnonymizeIP, "none", "truncate", "hash"), "analytics.anonymize_ip must be none, truncate or hash, got %q", c.Analytics.AnonymizeIP)
+		check(c.Analytics.SaltRotation > 0, "analytics.salt_rotation must be positive")
+	}
+
+	// Logger
+	check(oneOf(c.Logger.Level, "debug", "info", "warn", "error", "fatal"), "logger.level must be debug, info, warn, error or fatal, got %q", c.Logger.Level)
+
+	// Security
+	check(c.Security.SessionTimeout > 0, "security.session_timeout must be positive")
+	check(c.Security.PasswordMinLen >= 8, "security.password_min_len must be at least 8, got %d", c.Security.PasswordMinLen)
+	check(c.Security.RateLimitPerSecond > 0, "security.rate_limit_per_second must be positive")
+	check(c.Security.RateLimitBurst >= c.Security.RateLimitPerSecond, "security.rate_limit_burst must be at least rate_limit_per_second")
+	for name, group := range c.Security.RateLimitGroups {
+		check(oneOf(name, RateLimitGroupNames...), "security.rate_limit_groups: unknown group %q, must be api, auth, public, feedback, loyalty or orders", name)
+		check(group.RequestsPerMinute > 0 && group.Burst > 0, "security.rate_limit_groups.%s: requests_per_minute and burst must be positive", name)
+	}
+	check(oneOf(c.Security.RateLimitBackend, "memory", "redis"), "security.rate_limit_backend must be memory or redis, got %q", c.Security.RateLimitBackend)
+	if c.Security.RateLimitBackend == "redis" {
+		check(strings.HasPrefix(c.Security.RedisURL, "redis://") || strings.HasPrefix(c.Security.RedisURL, "rediss://"),
+			"security.redis_url must be a redis:// or rediss:// URL when rate_limit_backend is redis")
+	}
+	for prefix, ttl := range c.Cache.RouteTTL {
+		check(strings.HasPrefix(prefix, "/"), "cache.route_ttl: prefix %q must start with /", prefix)
+		check(ttl > 0, "cache.route_ttl.%s must be positive", prefix)
+	}
+	check(oneOf(c.Cache.Backend, "memory", "redis"), "cache.backend must be memory or redis, got %q", c.Cache.Backend)
+	if c.Cache.Enabled && c.Cache.Backend == "redis" {
+		url := c.CacheRedisURL()
+		check(strings.HasPrefix(url, "redis://") || strings.HasPrefix(url, "rediss://"),
+			"cache.redis_url (or security.redis_url) must be a redis:// or rediss:// URL when cache.backend is redis")
+	}
+	if c.Security.EnableHTTPS {
+		check(c.Security.CertFile != "" && c.Security.KeyFile != "", "security.cert_file and security.key_file are required when enable_https is true")
+	}
+	if c.Security.AutocertEnabled {
+		check(!c.Security.EnableHTTPS, "security.autocert_enabled and security.enable_https are mutually exclusive")
+		check(len(c.Security.AutocertDomains) > 0, "security.autocert_domains is required when autocert_enabled is true")
+		check(c.Security.AutocertCacheDir != "", "security.autocert_cache_dir is required when autocert_enabled is true")
+	}
+	check(oneOf(c.Security.AVScanner, "", "clamav", "icap"), "security.av_scanner must be empty, clamav or icap, got %q", c.Security.AVScanner)
+	if c.Security.AVScanner != "" {
+		check(c.Security.AVAddress != "", "security.av_address is required when av_scanner is set")
+		check(c.Security.AVTimeout > 0, "security.av_timeout must be positive")
+		check(c.Paths.QuarantineDir != "", "paths.quarantine_dir is required when av_scanner is set")
+	}
+	if c.TLSEnabled() && c.Server.HTTPRedirectPort != 0 {
+		check(c.Server.HTTPRedirectPort > 0 && c.Server.HTTPRedirectPort <= 65535, "server.http_redirect_port must be between 1 and 65535, got %d", c.Server.HTTPRedirectPort)
+		check(c.Server.HTTPRedirectPort != c.Server.Port, "server.http_redirect_port must differ from server.port")
+	}
+	if c.Security.JWTSecret != "" {
+		check(len(c.Security.JWTSecret) >= 32, "security.jwt_secret must be at least 32 characters")
+	}
+	check(c.Security.JWTExpiry > 0, "security.jwt_expiry must be positive")
+	check(c.Security.JWTRefreshExpiry > c.Security.JWTExpiry, "security.jwt_refresh_expiry must be longer than security.jwt_expiry")
+	if c.Security.AdminToken != "" {
+		check(len(c.Security.AdminToken) >= 32, "security.admin_token must be at least 32 characters")
+	}
+	if c.Security.MetricsToken != "" {
+		check(len(c.Security.MetricsToken) >= 16, "security.metrics_token must be at least 16 characters")
+	}
+
+	// Social login
+	if c.OAuth.GoogleClientID != "" || c.OAuth.GoogleClientSecret != "" {
+		check(c.OAuth.GoogleClientID != "" && c.OAuth.GoogleClientSecret != "",
+			"oauth.google_client_id and oauth.google_client_secret must be set together")
+	}
+	if c.OAuth.AppleClientID != "" {
+		check(c.OAuth.AppleTeamID != "" && c.OAuth.AppleKeyID != "" && c.OAuth.ApplePrivateKey != "",
+			"oauth.apple_team_id, oauth.apple_key_id and oauth.apple_private_key are required when apple_client_id is set")
+	}
+	if c.OAuth.GoogleClientID != "" || c.OAuth.AppleClientID != "" {
+		check(c.Server.BaseURL != "", "server.base_url is required for social login redirect URIs")
+	}
+
+	// Billing
+	check(c.Billing.ReportInterval >= time.Minute, "billing.report_interval must be at least 1m, got %s", c.Billing.ReportInterval)
+	for plan, scans := range c.Billing.IncludedScans {
+		check(scans >= 0, "billing.included_scans.%s must not be negative", plan)
+	}
+	if c.Billing.StripeSecretKey != "" {
+		check(c.Billing.MeterEventName != "", "billing.meter_event_name is required when stripe_secret_key is set")
+	}
+	if c.Billing.StripeWebhookSecret != "" {
+		check(c.Billing.StripeSecretKey != "", "billing.stripe_secret_key is required when stripe_webhook_secret is set")
+	}
+	check(c.Billing.TrialDays >= 0, "billing.trial_days must not be negative, got %d", c.Billing.TrialDays)
+	if c.Billing.TrialDays > 0 {
+		check(c.Billing.TrialPlan != "", "billing.trial_plan is required when trial_days is set")
+		check(c.Billing.TrialReminder >= 0 && c.Billing.TrialReminder < time.Duration(c.Billing.TrialDays)*24*time.Hour,
+			"billing.trial_reminder must be shorter than the trial, got %s", c.Billing.TrialReminder)
+	}
+
+	// Webhooks
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout must be positive")
+	check(c.Webhooks.MaxAttempts >= 1, "webhooks.max_attempts must be at least 1, got %d", c.Webhooks.MaxAttempts)
+	check(c.Webhooks.RetryBaseDelay > 0 && c.Webhooks.RetryBaseDelay <= c.Webhooks.RetryMaxDelay,
+		"webhooks.retry_base_delay must be positive and not above retry_max_delay")
+	check(c.Webhooks.BreakerThreshold >= 0, "webhooks.breaker_threshold must not be negative")
+	if c.Webhooks.BreakerThreshold > 0 {
+		check(c.Webhooks.BreakerCooldown > 0, "webhooks.breaker_cooldown must be positive when breaker_threshold is set")
+	}
+
+	// Events
+	check(oneOf(c.Events.Broker, "none", "redis", "nats"), "events.broker must be none, redis or nats, got %q", c.Events.Broker)
+	if c.Events.Broker != "none" {
+		check(c.Events.Topic != "", "events.topic is required when events.broker is set")
+	}
+	switch url := c.EventsBrokerURL(); c.Events.Broker {
+	case "redis":
+		check(strings.HasPrefix(url, "redis://") || strings.HasPrefix(url, "rediss://"),
+			"events.broker_url (or security.redis_url) must be a redis:// or rediss:// URL when events.broker is redis")
+		check(c.Events.MaxLen >= 1, "events.max_len must be at least 1, got %d", c.Events.MaxLen)
+	case "nats":
+		check(strings.HasPrefix(url, "nats://"), "events.broker_url must be a nats:// URL when events.broker is nats")
+	}
+
+	// Health
+	check(c.Health.CheckTimeout > 0, "health.check_timeout must be positive")
+	check(c.Health.CacheFor >= 0, "health.cache_for must not be negative")
+	check(c.Health.MinFreeDiskMB >= 0, "health.min_free_disk_mb must not be negative")
+	check(c.Health.QueueThreshold >= 1 && c.Health.QueueThreshold <= 100,
+		"health.queue_threshold must be between 1 and 100, got %d", c.Health.QueueThreshold)
+
+	// gRPC
+	if c.GRPC.Enabled {
+		check(c.GRPC.Port >= 1 && c.GRPC.Port <= 65535 && c.GRPC.Port != c.Server.Port,
+			"grpc.port must be between 1 and 65535 and differ from server.port, got %d", c.GRPC.Port)
+		check((c.GRPC.CertFile == "") == (c.GRPC.KeyFile == ""), "grpc.cert_file and grpc.key_file must be set together")
+		check(c.GRPC.ClientCAFile == "" || c.GRPC.CertFile != "", "grpc.client_ca_file requires grpc.cert_file and grpc.key_file")
+		check(c.GRPC.MaxMessageSize >= 1024, "grpc.max_message_size must be at least 1024 bytes, got %d", c.GRPC.MaxMessageSize)
+	}
+
+	// AI
+	check(oneOf(c.AI.Provider, "", "openai", "ollama"), "ai.provider must be empty, openai or ollama, got %q", c.AI.Provider)
+	if c.AI.Provider != "" {
+		check(c.AI.Model != "", "ai.model is required when ai.provider is set")
+		check(c.AI.Provider != "openai" || c.AI.APIKey != "", "ai.api_key is required when ai.provider is openai")
+		check(c.AI.Timeout > 0, "ai.timeout must be positive")
+		check(c.AI.HourlyLimit >= 1, "ai.hourly_limit must be at least 1, got %d", c.AI.HourlyLimit)
+	}
+
+	// OCR
+	check(oneOf(c.OCR.Engine, "", "tesseract", "api"), "ocr.engine must be empty, tesseract or api, got %q", c.OCR.Engine)
+	if c.OCR.Engine != "" {
+		check(c.OCR.Engine != "api" || strings.HasPrefix(c.OCR.APIURL, "http://") || strings.HasPrefix(c.OCR.APIURL, "https://"),
+			"ocr.api_url must be an http:// or https:// URL when ocr.engine is api")
+		check(c.OCR.Timeout > 0, "ocr.timeout must be positive")
+		check(c.OCR.MaxUploadMB >= 1, "ocr.max_upload_mb must be at least 1, got %d", c.OCR.MaxUploadMB)
+	}
+
+	// Paths
+	check(c.Paths.StorageDir != "", "paths.storage_dir is required")
+	check(c.Paths.StaticDir != "", "paths.static_dir is required")
+	check(c.Paths.LogDir != "", "paths.log_dir is required")
+	check(c.Paths.SnapshotDir != "", "paths.snapshot_dir is required")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration with secrets masked, safe to log or expose
+func (c *Config) Redacted() *Config {
+	cp := *c
+	mask := func(value *string) {
+		if *value != "" {
+			*value = redacted
+		}
+	}
+	mask(&cp.Database.DSN)
+	mask(&cp.Notifications.FCMCredentialsURL)
+	mask(&cp.Notifications.VAPIDPrivateKey)
+	mask(&cp.Mail.SMTPPassword)
+	mask(&cp.Mail.APIKey)
+	mask(&cp.SMS.AuthToken)
+	mask(&cp.SMS.APISecret)
+	mask(&cp.SMS.WebhookToken)
+	mask(&cp.WhatsApp.AppSecret)
+	mask(&cp.WhatsApp.VerifyToken)
+	mask(&cp.Telegram.BotToken)
+	mask(&cp.Telegram.WebhookSecret)
+	mask(&cp.Security.JWTSecret)
+	mask(&cp.Security.AdminToken)
+	mask(&cp.Security.RedisURL)
+	mask(&cp.Cache.RedisURL)
+	mask(&cp.Events.BrokerURL)
+	mask(&cp.Security.MetricsToken)
+	mask(&cp.OAuth.GoogleClientSecret)
+	mask(&cp.Billing.StripeSecretKey)
+	mask(&cp.Billing.StripeWebhookSecret)
+	mask(&cp.AI.APIKey)
+	mask(&cp.OCR.APIKey)
+	cp.Backup.Targets = append([]BackupTargetConfig(nil), c.Backup.Targets...)
+	for i := range cp.Backup.Targets {
+		mask(&cp.Backup.Targets[i].SecretKey)
+		mask(&cp.Backup.Targets[i].Password)
+	}
+	return &cp
+}
+
+// AsMap returns the configuration as a generic map with the same keys as config.yaml
+// and durations rendered as strings (e.g. "10s"), suitable for JSON encoding
+func (c *Config) AsMap() (map[string]interface{}, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	if err := yaml.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
@@ -89,9 +89,28 @@ func (c *ServiceContainer) initCache() error {
 		return nil
 	}
 
-	// Initialize in-memory cache instances
-	responseCoreCache := cache.NewInMemoryCache()
-	queryCoreCache := cache.NewInMemoryCache()
+	var responseCoreCache, queryCoreCache cache.Cache
+	if c.config.Cache.Backend == "redis" {
+		// Shared cache instances, so that invalidations reach every instance
+		responses, err := cache.NewRedisCache(c.config.CacheRedisURL(), "responses")
+		if err != nil {
+			return errors.InitializationError("cache", err)
+		}
+		queries, err := cache.NewRedisCache(c.config.CacheRedisURL(), "queries")
+		if err != nil {
+			responses.Close()
+			return errors.InitializationError("cache", err)
+		}
+		c.registerShutdownHandler(func(ctx context.Context) error {
+			queries.Close()
+			return responses.Close()
+		})
+		responseCoreCache, queryCoreCache = responses, queries
+	} else {
+		// Initialize in-memory cache instances
+		responseCoreCache = cache.NewInMemoryCache()
+		queryCoreCache = cache.NewInMemoryCache()
+	}
 
 	// Initialize response cache wrapper
 	respCache := cache.NewResponseCache(responseCoreCache)
@@ -103,6 +122,7 @@ func (c *ServiceContainer) initCache() error {
 	c.queryCache = queryCache
 
 	logger.Info("Cache initialized successfully", map[string]interface{}{
+		"backend":                 c.config.Cache.Backend,
 		"response_cache_max_size": c.config.Cache.MaxResponseCacheSize,
 		"query_cache_max_size":    c.config.Cache.MaxQueryCacheSize,
 		"response_cache_ttl":      c.config.Cache.ResponseCacheTTL.String(),
@@ -0,0 +1,71 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNext tests the next activation of common expressions
+func TestNext(t *testing.T) {
+	from := time.Date(2026, 10, 16, 14, 37, 20, 0, time.UTC) // Friday
+	for _, tt := range []struct {
+		expr string
+		want string
+	}{
+		{"0 2 * * *", "2026-10-17 02:00"},
+		{"@hourly", "2026-10-16 15:00"},
+		{"*/15 * * * *", "2026-10-16 14:45"},
+		{"5/20 * * * *", "2026-10-16 14:45"},
+		{"30 9-17/4 * * 1-5", "2026-10-16 17:30"},
+		{"0 0 * * 7", "2026-10-18 00:00"},
+		{"0 3 1 * *", "2026-11-01 03:00"},
+		{"0 0 29 2 *", "2028-02-29 00:00"},
+		{"38 14 * * *", "2026-10-16 14:38"},
+		{"37 14 * * *", "2026-10-17 14:37"},
+	} {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+		}
+		if got := s.Next(from).Format("2006-01-02 15:04"); got != tt.want {
+			t.Errorf("Next(%q) = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	// Either day field matches when both are restricted
+	s, _ := Parse("0 12 13 * 5")
+	if got := s.Next(from).Format("2006-01-02 15:04"); got != "2026-10-23 12:00" {
+		t.Errorf("Next(Friday or 13th) = %s, want the next Friday", got)
+	}
+
+	s, _ = Parse("0 0 31 2 *")
+	if !s.Next(from).IsZero() {
+		t.Error("Next of an impossible date is not zero")
+	}
+}
+
+// TestNextDST tests that daily schedules keep their wall-clock time across DST changes
+func TestNextDST(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Skip("tzdata not available")
+	}
+	s, _ := Parse("30 2 * * *")
+	// 2026-10-25: 03:00 CEST goes back to 02:00 CET
+	next := s.Next(time.Date(2026, 10, 24, 12, 0, 0, 0, rome))
+	if next.Format("2006-01-02 15:04") != "2026-10-25 02:30" {
+		t.Errorf("Next across the DST change = %s", next)
+	}
+	next = s.Next(next)
+	if next.Format("2006-01-02 15:04") != "2026-10-26 02:30" {
+		t.Errorf("Next after the DST change = %s", next)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) accepted an invalid expression", expr)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+// Package doctor validates a self-hosted deployment before the server starts
+// serving traffic and reports actionable findings.
+package doctor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"qr-menu/pkg/avscan"
+	"qr-menu/pkg/config"
+	"qr-menu/pkg/geoip"
+)
+
+// Severity classifies a finding
+type Severity string
+
+const (
+	OK      Severity = "ok"
+	Warning Severity = "warning"
+	Error   Severity = "error"
+)
+
+// Thresholds used by the checks
+const (
+	certExpiryWarning = 14 * 24 * time.Hour
+	clockSkewWarning  = 30 * time.Second
+	clockSkewError    = 2 * time.Minute
+)
+
+// Finding is the outcome of a single check. Hint tells the operator how to fix it
+type Finding struct {
+	Check    string
+	Severity Severity
+	Message  string
+	Hint     string
+}
+
+// Report collects the findings of a run
+type Report struct {
+	Findings []Finding
+}
+
+func (r *Report) add(check string, severity Severity, message, hint string) {
+	r.Findings = append(r.Findings, Finding{Check: check, Severity: severity, Message: message, Hint: hint})
+}
+
+// HasErrors reports whether any check failed
+func (r *Report) HasErrors() bool {
+	for _, f := range r.Findings {
+		if f.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the findings in a human-readable form followed by a summary line
+func (r *Report) Print(w io.Writer) {
+	counts := map[Severity]int{}
+	for _, f := range r.Findings {
+		counts[f.Severity]++
+		fmt.Fprintf(w, "[%-7s] %-10s %s\n", strings.ToUpper(string(f.Severity)), f.Check, f.Message)
+		if f.Hint != "" && f.Severity != OK {
+			fmt.Fprintf(w, "%21s→ %s\n", "", f.Hint)
+		}
+	}
+	fmt.Fprintf(w, "\n%d ok, %d warnings, %d errors\n", counts[OK], counts[Warning], counts[Error])
+}
+
+// Options customizes the external dependencies of the checks
+type Options struct {
+	// DBCheck verifies database connectivity; nil skips the check
+	DBCheck func(ctx context.Context) error
+	// HTTPClient is used for base URL and clock checks; defaults to a client with a 5s timeout
+	HTTPClient *http.Client
+	// TimeReferenceURL is queried for its Date header to measure clock skew; empty skips the check
+	TimeReferenceURL string
+	// Now returns the local time; defaults to time.Now
+	Now func() time.Time
+}
+
+// ConfigErrors converts the error returned by config.LoadFile into findings, one per problem
+func ConfigErrors(err error) *Report {
+	report := &Report{}
+	errs := []error{err}
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		errs = joined.Unwrap()
+	}
+	for _, e := range errs {
+		report.add("config", Error, e.Error(), "Fix config.yaml (or CONFIG_FILE) and the matching environment variables")
+	}
+	return report
+}
+
+// Run executes all checks against cfg
+func Run(ctx context.Context, cfg *config.Config, opts Options) *Report {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	report := &Report{}
+	report.add("config", OK, "configuration is valid", "")
+	checkDirectories(report, cfg)
+	checkBaseURL(ctx, report, cfg, opts.HTTPClient)
+	checkTLS(report, cfg, opts.Now())
+	checkSMTP(report)
+	checkAntivirus(ctx, report, cfg)
+	checkGeoIP(report, cfg)
+	if opts.DBCheck != nil {
+		checkDatabase(ctx, report, opts.DBCheck)
+	}
+	if opts.TimeReferenceURL != "" {
+		checkClock(ctx, report, opts.HTTPClient, opts.TimeReferenceURL, opts.Now)
+	}
+	return report
+}
+
+// checkDirectories verifies that every directory the server writes to is writable.
+// Missing directories are fine as long as they can be created
+func checkDirectories(report *Report, cfg *config.Config) {
+	dirs := []struct{ name, path string }{
+		{"paths.storage_dir", cfg.Paths.StorageDir},
+		{"paths.static_dir", cfg.Paths.StaticDir},
+		{"paths.log_dir", cfg.Paths.LogDir},
+		{"paths.snapshot_dir", cfg.Paths.SnapshotDir},
+	}
+	if cfg.Backup.Enabled {
+		dirs = append(dirs, struct{ name, path string }{"backup.storage_path", cfg.Backup.StoragePath})
+	}
+	if cfg.Security.AutocertEnabled {
+		dirs = append(dirs, struct{ name, path string }{"security.autocert_cache_dir", cfg.Security.AutocertCacheDir})
+	}
+	if cfg.Security.AVScanner != "" {
+		dirs = append(dirs, struct{ name, path string }{"paths.quarantine_dir", cfg.Paths.QuarantineDir})
+	}
+
+	for _, dir := range dirs {
+		if err := checkWritable(dir.path); err != nil {
+			report.add("dirs", Error, fmt.Sprintf("%s (%s) is not writable: %v", dir.name, dir.path, err),
+				fmt.Sprintf("Create the directory and give the service user write access, e.g. mkdir -p %s && chown <user> %s", dir.path, dir.path))
+			continue
+		}
+		report.add("dirs", OK, fmt.Sprintf("%s (%s) is writable", dir.name, dir.path), "")
+	}
+}
+
+// checkWritable creates and removes a temporary file in path, or in its closest
+// existing parent when path does not exist yet
+func checkWritable(path string) error {
+	target := path
+	for {
+		info, err := os.Stat(target)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", target)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(target)
+		if parent == target {
+			return err
+		}
+		target = parent
+	}
+
+	f, err := os.CreateTemp(target, ".qr-menu-doctor-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// checkBaseURL resolves and requests server.base_url. An HTTP failure is only a
+// warning because the URL usually points at this very server, which is not running yet
+func checkBaseURL(ctx context.Context, report *Report, cfg *config.Config, client *http.Client) {
+	if cfg.Server.BaseURL == "" {
+		report.add("base_url", Warning, "server.base_url is not set: links and QR codes are derived from each request",
+			"Set server.base_url (or BASE_URL) to the public URL, e.g. https://menu.example.com")
+		return
+	}
+
+	u, err := url.Parse(cfg.Server.BaseURL)
+	if err != nil {
+		report.add("base_url", Error, fmt.Sprintf("server.base_url is invalid: %v", err), "Use an absolute http(s) URL")
+		return
+	}
+	if _, err := net.DefaultResolver.LookupHost(ctx, u.Hostname()); err != nil {
+		report.add("base_url", Error, fmt.Sprintf("%s does not resolve: %v", u.Hostname(), err),
+			"Create the DNS record pointing to this host before printing QR codes")
+		return
+	}
+	if u.Scheme == "http" && cfg.IsProduction() {
+		report.add("base_url", Warning, "server.base_url uses plain http in production",
+			"Serve the menu over https, directly (security.enable_https/autocert_enabled) or through a reverse proxy")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, cfg.Server.BaseURL, nil)
+	if err != nil {
+		report.add("base_url", Error, fmt.Sprintf("server.base_url is invalid: %v", err), "Use an absolute http(s) URL")
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		report.add("base_url", Warning, fmt.Sprintf("%s is not reachable: %v", cfg.Server.BaseURL, err),
+			"Expected if the URL points to this server before it starts; otherwise check the reverse proxy and firewall")
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		report.add("base_url", Warning, fmt.Sprintf("%s answered %s", cfg.Server.BaseURL, resp.Status),
+			"Check the reverse proxy configuration and upstream address")
+		return
+	}
+	report.add("base_url", OK, fmt.Sprintf("%s is reachable (%s)", cfg.Server.BaseURL, resp.Status), "")
+}
+
+// checkTLS validates the configured certificate files: they must load, be currently
+// valid, not expire soon and cover the base URL host
+func checkTLS(report *Report, cfg *config.Config, now time.Time) {
+	if cfg.Security.AutocertEnabled {
+		if cfg.Server.Port != 443 || cfg.Server.HTTPRedirectPort != 80 {
+			report.add("tls", Warning, fmt.Sprintf("Let's Encrypt is enabled but the server listens on %d/%d", cfg.Server.Port, cfg.Server.HTTPRedirectPort),
+				"ACME challenges need ports 443 and 80 reachable from the internet, forwarded to these ports")
+		} else {
+			report.add("tls", OK, fmt.Sprintf("Let's Encrypt enabled for %s", strings.Join(cfg.Security.AutocertDomains, ", ")), "")
+		}
+		return
+	}
+	if !cfg.Security.EnableHTTPS {
+		report.add("tls", OK, "TLS is not terminated by the server (expected behind a reverse proxy)", "")
+		return
+	}
+
+	pair, err := tls.LoadX509KeyPair(cfg.Security.CertFile, cfg.Security.KeyFile)
+	if err != nil {
+		report.add("tls", Error, fmt.Sprintf("cannot load certificate: %v", err),
+			"Check security.cert_file and security.key_file: both must be readable PEM files of the same key pair")
+		return
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		report.add("tls", Error, fmt.Sprintf("cannot parse certificate: %v", err), "Use a PEM-encoded X.509 certificate")
+		return
+	}
+
+	switch {
+	case now.Before(leaf.NotBefore):
+		report.add("tls", Error, fmt.Sprintf("certificate is not valid before %s", leaf.NotBefore.Format(time.RFC3339)),
+			"Check the system clock or reissue the certificate")
+		return
+	case now.After(leaf.NotAfter):
+		report.add("tls", Error, fmt.Sprintf("certificate expired on %s", leaf.NotAfter.Format(time.RFC3339)), "Renew the certificate")
+		return
+	case leaf.NotAfter.Sub(now) < certExpiryWarning:
+		report.add("tls", Warning, fmt.Sprintf("certificate expires on %s", leaf.NotAfter.Format(time.RFC3339)), "Renew the certificate soon")
+	}
+
+	if cfg.Server.BaseURL != "" {
+		if u, err := url.Parse(cfg.Server.BaseURL); err == nil {
+			if err := leaf.VerifyHostname(u.Hostname()); err != nil {
+				report.add("tls", Error, fmt.Sprintf("certificate does not cover %s: %v", u.Hostname(), err),
+					"Issue a certificate whose SAN includes the server.base_url host")
+				return
+			}
+		}
+	}
+	report.add("tls", OK, fmt.Sprintf("certificate valid until %s", leaf.NotAfter.Format(time.RFC3339)), "")
+}
+
+// checkSMTP reports on outgoing email. No provider is integrated yet: notification
+// emails are only written to the log
+func checkSMTP(report *Report) {
+	report.add("smtp", Warning, "no email provider is configured: notification emails are only logged",
+		"Owners will not receive verification and account emails until an email provider is configured")
+}
+
+// checkAntivirus scans an empty stream to verify the configured anti-virus engine answers
+func checkAntivirus(ctx context.Context, report *Report, cfg *config.Config) {
+	if cfg.Security.AVScanner == "" {
+		return
+	}
+
+	scanner, err := avscan.New(avscan.Config{Backend: cfg.Security.AVScanner, Address: cfg.Security.AVAddress})
+	if err != nil {
+		report.add("antivirus", Error, err.Error(), "Check security.av_scanner and security.av_address")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Security.AVTimeout)
+	defer cancel()
+	if _, err := scanner.Scan(ctx, strings.NewReader("")); err != nil {
+		severity, hint := Warning, "Uploads are accepted without scanning until the scanner is reachable"
+		if cfg.Security.AVFailClosed {
+			severity, hint = Error, "Uploads and backup restores are rejected until the scanner is reachable"
+		}
+		report.add("antivirus", severity, fmt.Sprintf("%s scanner at %s is not reachable: %v", cfg.Security.AVScanner, cfg.Security.AVAddress, err), hint)
+		return
+	}
+	report.add("antivirus", OK, fmt.Sprintf("%s scanner at %s answered", cfg.Security.AVScanner, cfg.Security.AVAddress), "")
+}
+
+// checkGeoIP verifies that the configured GeoIP database can be loaded. The server starts
+// without it, so a broken file is only a warning
+func checkGeoIP(report *Report, cfg *config.Config) {
+	path := cfg.Analytics.GeoIPDatabase
+	if path == "" {
+		return
+	}
+	if _, err := geoip.Open(path); err != nil {
+		report.add("geoip", Warning, fmt.Sprintf("cannot load %s: %v", path, err),
+			"Country and city stats stay empty until analytics.geoip_database points to a GeoLite2 .mmdb or IP2Location .csv file")
+		return
+	}
+	report.add("geoip", OK, fmt.Sprintf("%s loaded", path), "")
+}
+
+// checkDatabase runs the injected connectivity check
+func checkDatabase(ctx context.Context, report *Report, check func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	if err := check(ctx); err != nil {
+		report.add("database", Error, fmt.Sprintf("cannot connect: %v", err),
+			"Set MONGODB_URI and MONGODB_CERT_CONTENT or MONGODB_CERT_PATH, and allow this host's IP on the cluster")
+		return
+	}
+	report.add("database", OK, "connected", "")
+}
+
+// checkClock compares the local clock with the Date header of a reference server.
+// Skew breaks TLS validation, session expiry and scheduled jobs
+func checkClock(ctx context.Context, report *Report, client *http.Client, referenceURL string, now func() time.Time) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, referenceURL, nil)
+	if err != nil {
+		report.add("clock", Warning, fmt.Sprintf("invalid time reference %s: %v", referenceURL, err), "")
+		return
+	}
+	start := now()
+	resp, err := client.Do(req)
+	if err != nil {
+		report.add("clock", Warning, fmt.Sprintf("cannot reach time reference %s: %v", referenceURL, err),
+			"Make sure NTP is enabled (timedatectl status)")
+		return
+	}
+	resp.Body.Close()
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		report.add("clock", Warning, fmt.Sprintf("time reference %s sent no valid Date header", referenceURL), "")
+		return
+	}
+
+	// The Date header has a one second resolution: compare it with the midpoint of the request
+	local := start.Add(now().Sub(start) / 2)
+	skew := local.Sub(remote)
+	if skew < 0 {
+		skew = -skew
+	}
+	skew = skew.Round(time.Second)
+
+	hint := "Enable time synchronization (NTP), e.g. timedatectl set-ntp true"
+	switch {
+	case skew > clockSkewError:
+		report.add("clock", Error, fmt.Sprintf("local clock is off by %s", skew), hint)
+	case skew > clockSkewWarning:
+		report.add("clock", Warning, fmt.Sprintf("local clock is off by %s", skew), hint)
+	default:
+		report.add("clock", OK, fmt.Sprintf("local clock in sync (skew %s)", skew), "")
+	}
+}
@@ -0,0 +1,198 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"qr-menu/pkg/config"
+)
+
+func testConfig(t *testing.T) *config.Config {
+	cfg := config.Default()
+	dir := t.TempDir()
+	cfg.Paths.StorageDir = filepath.Join(dir, "storage")
+	cfg.Paths.StaticDir = filepath.Join(dir, "static")
+	cfg.Paths.LogDir = filepath.Join(dir, "logs")
+	cfg.Paths.SnapshotDir = filepath.Join(dir, "storage", "snapshots")
+	cfg.Backup.Enabled = false
+	return cfg
+}
+
+func findings(report *Report, check string) []Finding {
+	var out []Finding
+	for _, f := range report.Findings {
+		if f.Check == check {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// writeCert writes a self-signed certificate for host valid until notAfter
+func writeCert(t *testing.T, dir, host string, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+// TestDirectories tests that missing but creatable directories pass and files fail
+func TestDirectories(t *testing.T) {
+	cfg := testConfig(t)
+	blocker := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(blocker, []byte("x"), 0600)
+	cfg.Paths.LogDir = blocker
+
+	report := &Report{}
+	checkDirectories(report, cfg)
+
+	for _, f := range findings(report, "dirs") {
+		expected := OK
+		if strings.Contains(f.Message, "paths.log_dir") {
+			expected = Error
+		}
+		if f.Severity != expected {
+			t.Errorf("Expected %s, got %+v", expected, f)
+		}
+	}
+}
+
+// TestTLS tests certificate loading, expiry and host coverage
+func TestTLS(t *testing.T) {
+	cases := []struct {
+		name     string
+		host     string
+		notAfter time.Time
+		expected Severity
+	}{
+		{"valid", "menu.example.com", time.Now().AddDate(0, 6, 0), OK},
+		{"expiring", "menu.example.com", time.Now().AddDate(0, 0, 3), Warning},
+		{"expired", "menu.example.com", time.Now().Add(-time.Minute), Error},
+		{"wrong host", "other.example.com", time.Now().AddDate(0, 6, 0), Error},
+	}
+	for _, tc := range cases {
+		cfg := testConfig(t)
+		cfg.Server.BaseURL = "https://menu.example.com"
+		cfg.Security.EnableHTTPS = true
+		cfg.Security.CertFile, cfg.Security.KeyFile = writeCert(t, t.TempDir(), tc.host, tc.notAfter)
+
+		report := &Report{}
+		checkTLS(report, cfg, time.Now())
+		if !report.hasSeverity(tc.expected) {
+			t.Errorf("%s: expected a %s finding, got %+v", tc.name, tc.expected, report.Findings)
+		}
+	}
+
+	cfg := testConfig(t)
+	cfg.Security.EnableHTTPS = true
+	cfg.Security.CertFile = filepath.Join(t.TempDir(), "missing.pem")
+	cfg.Security.KeyFile = cfg.Security.CertFile
+	report := &Report{}
+	checkTLS(report, cfg, time.Now())
+	if !report.HasErrors() {
+		t.Errorf("Expected error for missing certificate, got %+v", report.Findings)
+	}
+}
+
+// TestClock tests skew detection against a reference Date header
+func TestClock(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	cases := map[time.Duration]Severity{
+		0:                OK,
+		time.Minute:      Warning,
+		-5 * time.Minute: Error,
+	}
+	for offset, expected := range cases {
+		report := &Report{}
+		now := func() time.Time { return time.Now().Add(offset) }
+		checkClock(context.Background(), report, server.Client(), server.URL, now)
+		if f := findings(report, "clock"); len(f) != 1 || f[0].Severity != expected {
+			t.Errorf("Offset %s: expected %s, got %+v", offset, expected, f)
+		}
+	}
+}
+
+// TestRun tests a full run with an injected database check and the printed summary
+func TestRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	cfg := testConfig(t)
+	cfg.Server.BaseURL = server.URL
+
+	report := Run(context.Background(), cfg, Options{
+		DBCheck:    func(ctx context.Context) error { return errors.New("connection refused") },
+		HTTPClient: server.Client(),
+	})
+	if !report.HasErrors() {
+		t.Error("Expected the database failure to be reported as an error")
+	}
+	if f := findings(report, "base_url"); len(f) != 1 || f[0].Severity != OK {
+		t.Errorf("Expected reachable base URL, got %+v", f)
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	if !strings.Contains(out.String(), "connection refused") || !strings.Contains(out.String(), "1 errors") {
+		t.Errorf("Unexpected output:\n%s", out.String())
+	}
+}
+
+// TestConfigErrors tests that each validation problem becomes a finding
+func TestConfigErrors(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.Port = 0
+	cfg.Logger.Level = "verbose"
+
+	report := ConfigErrors(cfg.Validate())
+	if len(report.Findings) != 2 {
+		t.Errorf("Expected 2 findings, got %+v", report.Findings)
+	}
+}
+
+func (r *Report) hasSeverity(severity Severity) bool {
+	for _, f := range r.Findings {
+		if f.Severity == severity {
+			return true
+		}
+	}
+	return false
+}
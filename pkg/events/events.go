@@ -0,0 +1,309 @@
+// Package events is the bus of the domain events: menu changes, QR scans, completed backups.
+// Publishers do not know who is listening: the webhooks, the owner notifications and the
+// analytics subscribe to the bus and receive the same event. With a Broker (Redis Streams or
+// NATS) the events also reach the other instances of a deployment, whose remote subscribers
+// keep their local state, such as caches, in sync.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"qr-menu/logger"
+	"qr-menu/pkg/metrics"
+)
+
+// Event types of the catalog. The type is also the name of the webhook event
+const (
+	MenuCreated                 = "menu.created"
+	MenuUpdated                 = "menu.updated"
+	MenuActivated               = "menu.activated"
+	ItemUpdated                 = "item.updated"
+	ItemLowStock                = "item.low_stock"
+	ItemSoldOut                 = "item.sold_out"
+	OrderCreated                = "order.created"
+	OrderUpdated                = "order.updated"
+	FeedbackReceived            = "feedback.received"
+	PromotionActive             = "promotion.active"
+	QRScanned                   = "qr.scanned"
+	BackupCompleted             = "backup.completed"
+	BackupFailed                = "backup.failed"
+	BillingSubscriptionUpdated  = "billing.subscription.updated"
+	BillingSubscriptionCanceled = "billing.subscription.canceled"
+	WebhookTest                 = "webhook.test"
+)
+
+// Catalog lists the event types in the order they are documented
+var Catalog = []string{
+	MenuCreated, MenuUpdated, MenuActivated, ItemUpdated, ItemLowStock, ItemSoldOut, OrderCreated,
+	OrderUpdated, FeedbackReceived, PromotionActive, QRScanned, BackupCompleted, BackupFailed,
+	BillingSubscriptionUpdated, BillingSubscriptionCanceled, WebhookTest,
+}
+
+var dispatches = metrics.NewCounter("qrmenu_events_dispatched_total",
+	"Domain events handed to the subscribers by subscriber and result (success or error).", "subscriber", "result")
+
+// Event is a domain event
+type Event struct {
+	ID           string                 `json:"id"`
+	Type         string                 `json:"type"`
+	RestaurantID string                 `json:"restaurant_id,omitempty"` // Empty for platform events such as backups
+	ActorID      string                 `json:"actor_id,omitempty"`      // User who caused the event, empty for visitors and jobs
+	Data         map[string]interface{} `json:"data"`                    // Public payload, sent as is to the webhooks
+	Visitor      *Visitor               `json:"-"`                       // Visitor of a public page, for the local subscribers only
+	OccurredAt   time.Time              `json:"occurred_at"`
+	Origin       string                 `json:"origin"` // Instance that published the event
+}
+
+// Visitor describes who triggered a public event. It is never sent outside the process
+type Visitor struct {
+	IP        string
+	UserAgent string
+	Referrer  string
+}
+
+// Handler receives the events of a subscription
+type Handler func(ctx context.Context, event Event) error
+
+type subscription struct {
+	name    string
+	types   map[string]bool // nil = every type
+	remote  bool            // Receives the events of the other instances instead of the local ones
+	handler Handler
+}
+
+// Broker carries the encoded events between the instances of a deployment. Every instance
+// receives every event, its own included
+type Broker interface {
+	Publish(ctx context.Context, payload []byte) error
+	// Subscribe passes the received events to deliver until ctx is canceled
+	Subscribe(ctx context.Context, deliver func(payload []byte)) error
+	Close() error
+}
+
+// Bus delivers every published event to the subscribers of its type. Each subscriber runs
+// in its own goroutine, so a slow or failing one delays neither the publisher nor the others.
+//
+// Local subscribers handle the events published by their instance, so side effects such as
+// webhook deliveries happen once per event in the deployment. Remote subscribers handle the
+// events published by the other instances through the broker
+type Bus struct {
+	timeout  time.Duration
+	instance string
+
+	mu         sync.RWMutex
+	subs       []subscription
+	broker     Broker
+	stopBroker context.CancelFunc
+	closed     bool
+	wg         sync.WaitGroup
+}
+
+// NewBus creates a bus whose subscribers get timeout to handle an event
+func NewBus(timeout time.Duration) *Bus {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &Bus{timeout: timeout, instance: uuid.New().String()}
+}
+
+var (
+	defaultBus  *Bus
+	defaultOnce sync.Once
+)
+
+// Default returns the bus shared by the application
+func Default() *Bus {
+	defaultOnce.Do(func() {
+		defaultBus = NewBus(10 * time.Second)
+	})
+	return defaultBus
+}
+
+// Subscribe registers handler for the events of the given types published by this instance,
+// or for every type if none is given. The name identifies the subscriber in logs and metrics
+func (b *Bus) Subscribe(name string, handler Handler, types ...string) {
+	b.subscribe(subscription{name: name, handler: handler}, types)
+}
+
+// SubscribeRemote registers handler for the events of the given types published by the other
+// instances. Without a broker it never receives anything
+func (b *Bus) SubscribeRemote(name string, handler Handler, types ...string) {
+	b.subscribe(subscription{name: name, handler: handler, remote: true}, types)
+}
+
+func (b *Bus) subscribe(sub subscription, types []string) {
+	if len(types) > 0 {
+		sub.types = make(map[string]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs = append(b.subs, sub)
+}
+
+// Publish hands the event to its local subscribers and to the broker, and returns its ID.
+// ID and OccurredAt are filled in when empty. Events published after Close are dropped
+func (b *Bus) Publish(event Event) string {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	if event.Data == nil {
+		event.Data = map[string]interface{}{}
+	}
+	event.Origin = b.instance
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		logger.Warn("Event published after shutdown, dropped", map[string]interface{}{
+			"event": event.Type,
+			"id":    event.ID,
+		})
+		return event.ID
+	}
+	b.dispatchAll(event, false)
+	if b.broker != nil {
+		b.wg.Add(1)
+		go b.forward(b.broker, event)
+	}
+	return event.ID
+}
+
+// dispatchAll hands the event to the local or to the remote subscribers of its type; it must
+// be called with b.mu held
+func (b *Bus) dispatchAll(event Event, remote bool) {
+	for _, sub := range b.subs {
+		if sub.remote != remote || (sub.types != nil && !sub.types[event.Type]) {
+			continue
+		}
+		b.wg.Add(1)
+		go b.dispatch(sub, event)
+	}
+}
+
+// forward sends the event to the other instances. A lost event only delays their state until
+// the next one, so failures are logged and not retried
+func (b *Bus) forward(broker Broker, event Event) {
+	defer b.wg.Done()
+	payload, err := json.Marshal(event)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+		err = broker.Publish(ctx, payload)
+		cancel()
+	}
+	if err != nil {
+		dispatches.Inc("broker", "error")
+		logger.Warn("Event not sent to the broker", map[string]interface{}{
+			"event": event.Type,
+			"id":    event.ID,
+			"error": err.Error(),
+		})
+		return
+	}
+	dispatches.Inc("broker", "success")
+}
+
+// Connect makes the bus publish its events to broker and hand the events of the other
+// instances to the remote subscribers, until Close
+func (b *Bus) Connect(broker Broker) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.mu.Lock()
+	b.broker = broker
+	b.stopBroker = cancel
+	b.mu.Unlock()
+
+	go func() {
+		if err := broker.Subscribe(ctx, b.receive); err != nil && ctx.Err() == nil {
+			logger.Error("Event broker subscription ended", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+}
+
+// receive decodes an event from the broker and hands it to the remote subscribers, unless
+// this instance published it
+func (b *Bus) receive(payload []byte) {
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		logger.Warn("Invalid event from the broker", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if event.Origin == b.instance {
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.closed {
+		b.dispatchAll(event, true)
+	}
+}
+
+func (b *Bus) dispatch(sub subscription, event Event) {
+	defer b.wg.Done()
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return sub.handler(ctx, event)
+	}()
+	if err != nil {
+		dispatches.Inc(sub.name, "error")
+		logger.Warn("Event subscriber failed", map[string]interface{}{
+			"subscriber":    sub.name,
+			"event":         event.Type,
+			"id":            event.ID,
+			"restaurant_id": event.RestaurantID,
+			"error":         err.Error(),
+		})
+		return
+	}
+	dispatches.Inc(sub.name, "success")
+}
+
+// Close stops accepting events, waits for the subscribers still handling one (or for ctx to
+// expire) and then closes the broker
+func (b *Bus) Close(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	broker, stopBroker := b.broker, b.stopBroker
+	b.mu.Unlock()
+	if stopBroker != nil {
+		stopBroker()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("event bus: %w", ctx.Err())
+	}
+	if broker != nil {
+		broker.Close()
+	}
+	return err
+}
@@ -0,0 +1,310 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+func TestPublishFansOut(t *testing.T) {
+	bus := NewBus(time.Second)
+	var mu sync.Mutex
+	got := map[string][]string{}
+	record := func(name string) Handler {
+		return func(_ context.Context, e Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got[name] = append(got[name], e.Type)
+			return nil
+		}
+	}
+	bus.Subscribe("all", record("all"))
+	bus.Subscribe("menus", record("menus"), MenuCreated, MenuUpdated)
+
+	bus.Publish(Event{Type: MenuCreated, RestaurantID: "r1"})
+	bus.Publish(Event{Type: QRScanned, RestaurantID: "r1"})
+	if err := bus.Close(context.Background()); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+
+	if len(got["all"]) != 2 {
+		t.Errorf("all received %v, want both events", got["all"])
+	}
+	if len(got["menus"]) != 1 || got["menus"][0] != MenuCreated {
+		t.Errorf("menus received %v, want only %s", got["menus"], MenuCreated)
+	}
+}
+
+func TestPublishFillsDefaults(t *testing.T) {
+	bus := NewBus(time.Second)
+	received := make(chan Event, 1)
+	bus.Subscribe("test", func(_ context.Context, e Event) error {
+		received <- e
+		return nil
+	})
+
+	id := bus.Publish(Event{Type: BackupCompleted})
+	e := <-received
+	if id == "" || e.ID != id {
+		t.Errorf("ID = %q, Publish returned %q", e.ID, id)
+	}
+	if e.OccurredAt.IsZero() || e.Data == nil {
+		t.Errorf("event = %+v, want OccurredAt and Data set", e)
+	}
+}
+
+func TestFailingSubscriberDoesNotAffectOthers(t *testing.T) {
+	bus := NewBus(time.Second)
+	delivered := make(chan struct{}, 1)
+	bus.Subscribe("panics", func(context.Context, Event) error { panic("boom") })
+	bus.Subscribe("fails", func(context.Context, Event) error { return errors.New("down") })
+	bus.Subscribe("works", func(context.Context, Event) error {
+		delivered <- struct{}{}
+		return nil
+	})
+
+	bus.Publish(Event{Type: MenuActivated})
+	if err := bus.Close(context.Background()); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+	select {
+	case <-delivered:
+	default:
+		t.Error("The working subscriber did not receive the event")
+	}
+}
+
+func TestCloseDropsLaterEvents(t *testing.T) {
+	bus := NewBus(time.Second)
+	called := false
+	bus.Subscribe("test", func(context.Context, Event) error {
+		called = true
+		return nil
+	})
+	bus.Close(context.Background())
+	bus.Publish(Event{Type: MenuUpdated})
+	bus.Close(context.Background())
+	if called {
+		t.Error("Event published after Close was delivered")
+	}
+}
+
+func TestCloseTimesOut(t *testing.T) {
+	bus := NewBus(time.Second)
+	release := make(chan struct{})
+	defer close(release)
+	bus.Subscribe("slow", func(context.Context, Event) error {
+		<-release
+		return nil
+	})
+	bus.Publish(Event{Type: ItemUpdated})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := bus.Close(ctx); err == nil {
+		t.Error("Close = nil, want a timeout error")
+	}
+}
+
+// hub is an in-memory broker shared by the buses of a test, like a Redis stream or a NATS
+// subject shared by the instances
+type hub struct {
+	mu   sync.Mutex
+	subs []func([]byte)
+}
+
+type hubBroker struct {
+	hub   *hub
+	ready chan struct{}
+}
+
+func (h *hub) broker() *hubBroker { return &hubBroker{hub: h, ready: make(chan struct{})} }
+
+func (b *hubBroker) Publish(_ context.Context, payload []byte) error {
+	b.hub.mu.Lock()
+	defer b.hub.mu.Unlock()
+	for _, deliver := range b.hub.subs {
+		deliver(payload)
+	}
+	return nil
+}
+
+func (b *hubBroker) Subscribe(ctx context.Context, deliver func([]byte)) error {
+	b.hub.mu.Lock()
+	b.hub.subs = append(b.hub.subs, deliver)
+	b.hub.mu.Unlock()
+	close(b.ready)
+	<-ctx.Done()
+	return nil
+}
+
+func (b *hubBroker) Close() error { return nil }
+
+func TestRemoteSubscribers(t *testing.T) {
+	h := &hub{}
+	a, b := NewBus(time.Second), NewBus(time.Second)
+	brokerA, brokerB := h.broker(), h.broker()
+	a.Connect(brokerA)
+	b.Connect(brokerB)
+	<-brokerA.ready
+	<-brokerB.ready
+
+	var mu sync.Mutex
+	got := map[string][]Event{}
+	record := func(name string) Handler {
+		return func(_ context.Context, e Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			got[name] = append(got[name], e)
+			return nil
+		}
+	}
+	a.Subscribe("a-local", record("a-local"))
+	a.SubscribeRemote("a-remote", record("a-remote"))
+	b.Subscribe("b-local", record("b-local"))
+	b.SubscribeRemote("b-remote", record("b-remote"), MenuUpdated)
+
+	a.Publish(Event{Type: MenuUpdated, RestaurantID: "r1", Data: map[string]interface{}{"menu_id": "m1"},
+		Visitor: &Visitor{IP: "203.0.113.1"}})
+	a.Publish(Event{Type: QRScanned, RestaurantID: "r1"})
+	a.Close(context.Background())
+	b.Close(context.Background())
+
+	if len(got["a-local"]) != 2 {
+		t.Errorf("a-local received %d events, want 2", len(got["a-local"]))
+	}
+	if len(got["a-remote"]) != 0 || len(got["b-local"]) != 0 {
+		t.Errorf("a-remote received %d, b-local %d events; want none", len(got["a-remote"]), len(got["b-local"]))
+	}
+	if len(got["b-remote"]) != 1 {
+		t.Fatalf("b-remote received %d events, want the menu update", len(got["b-remote"]))
+	}
+	e := got["b-remote"][0]
+	if e.RestaurantID != "r1" || e.Data["menu_id"] != "m1" || e.ID == "" {
+		t.Errorf("b-remote received %+v", e)
+	}
+	if e.Visitor != nil {
+		t.Error("The visitor crossed the broker")
+	}
+}
+
+func TestRedisBroker(t *testing.T) {
+	srv := miniredis.RunT(t)
+	srv.XAdd("qrmenu.events", "*", []string{"event", `{"id":"old"}`})
+	broker, err := NewRedisBroker("redis://"+srv.Addr(), "qrmenu.events", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+
+	received := make(chan string, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go broker.Subscribe(ctx, func(payload []byte) { received <- string(payload) })
+
+	// The subscription starts after the entries already in the stream
+	deadline := time.Now().Add(time.Second)
+	for {
+		if err := broker.Publish(context.Background(), []byte(`{"id":"e1"}`)); err != nil {
+			t.Fatalf("Publish = %v", err)
+		}
+		select {
+		case got := <-received:
+			if got != `{"id":"e1"}` {
+				t.Fatalf("received %q", got)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("The published event was not received")
+		}
+	}
+}
+
+func TestNewRedisBroker(t *testing.T) {
+	for _, bad := range []string{"nats://localhost", "redis://localhost/abc", "localhost:6379"} {
+		if _, err := NewRedisBroker(bad, "s", 0); err == nil {
+			t.Errorf("NewRedisBroker(%q) accepted an invalid URL", bad)
+		}
+	}
+}
+
+// runNATS starts an embedded NATS server accepting the token secret and returns its address
+func runNATS(t *testing.T) string {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, Authorization: "secret", NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	t.Cleanup(srv.Shutdown)
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+	return srv.Addr().String()
+}
+
+func TestNATSBroker(t *testing.T) {
+	addr := runNATS(t)
+	publisher, err := NewNATSBroker("nats://secret@"+addr, "qrmenu.events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+	subscriber, err := NewNATSBroker("nats://secret@"+addr, "qrmenu.events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Close()
+
+	received := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go subscriber.Subscribe(ctx, func(payload []byte) { received <- string(payload) })
+
+	// The subscription is registered asynchronously: publish until it receives
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if err := publisher.Publish(context.Background(), []byte(`{"id":"e1"}`)); err != nil {
+			t.Fatalf("Publish = %v", err)
+		}
+		select {
+		case got := <-received:
+			if got != `{"id":"e1"}` {
+				t.Errorf("received %q", got)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("The published event was not received")
+		}
+	}
+}
+
+func TestNATSBrokerAuthentication(t *testing.T) {
+	addr := runNATS(t)
+	broker, err := NewNATSBroker("nats://wrong@"+addr, "qrmenu.events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer broker.Close()
+	time.Sleep(100 * time.Millisecond)
+	if broker.conn.IsConnected() {
+		t.Error("Connected with a wrong token")
+	}
+}
+
+func TestNewNATSBroker(t *testing.T) {
+	for _, bad := range []string{"redis://localhost", "nats://", "localhost:4222"} {
+		if _, err := NewNATSBroker(bad, "s"); err == nil {
+			t.Errorf("NewNATSBroker(%q) accepted an invalid URL", bad)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"qr-menu/logger"
+)
+
+// brokerRetryDelay is the pause before reconnecting a broker subscription after an error
+const brokerRetryDelay = 2 * time.Second
+
+// RedisBroker carries the events over a Redis stream. Every instance reads the whole stream,
+// which Redis trims to about maxLen entries
+type RedisBroker struct {
+	client *redis.Client
+	stream string
+	maxLen int
+}
+
+// NewRedisBroker creates a broker on the stream of the Redis server at url
+func NewRedisBroker(url, stream string, maxLen int) (*RedisBroker, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	if maxLen <= 0 {
+		maxLen = 10000
+	}
+	return &RedisBroker{client: redis.NewClient(options), stream: stream, maxLen: maxLen}, nil
+}
+
+// Publish appends the event to the stream
+func (rb *RedisBroker) Publish(ctx context.Context, payload []byte) error {
+	return rb.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: rb.stream,
+		MaxLen: int64(rb.maxLen),
+		Approx: true,
+		Values: map[string]interface{}{"event": payload},
+	}).Err()
+}
+
+// Subscribe reads the events added to the stream after the call, reconnecting after errors,
+// until ctx is canceled
+func (rb *RedisBroker) Subscribe(ctx context.Context, deliver func(payload []byte)) error {
+	lastID := ""
+	for ctx.Err() == nil {
+		var err error
+		if lastID == "" {
+			lastID, err = rb.latestID(ctx)
+		}
+		if err == nil {
+			// BLOCK is short, so the read ends in time to check ctx
+			var streams []redis.XStream
+			streams, err = rb.client.XRead(ctx, &redis.XReadArgs{
+				Streams: []string{rb.stream, lastID},
+				Count:   100,
+				Block:   time.Second,
+			}).Result()
+			if errors.Is(err, redis.Nil) {
+				err = nil
+			}
+			for _, s := range streams {
+				for _, message := range s.Messages {
+					if payload, ok := message.Values["event"].(string); ok {
+						deliver([]byte(payload))
+					}
+					lastID = message.ID
+				}
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.Warn("Event stream read failed", map[string]interface{}{
+				"stream": rb.stream,
+				"error":  err.Error(),
+			})
+			select {
+			case <-ctx.Done():
+			case <-time.After(brokerRetryDelay):
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the connections to Redis
+func (rb *RedisBroker) Close() error {
+	return rb.client.Close()
+}
+
+// latestID returns the ID of the newest entry of the stream, or 0-0 if it is empty
+func (rb *RedisBroker) latestID(ctx context.Context) (string, error) {
+	messages, err := rb.client.XRevRangeN(ctx, rb.stream, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "0-0", nil
+	}
+	return messages[0].ID, nil
+}
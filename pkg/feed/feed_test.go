@@ -0,0 +1,121 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWriteICal(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteICal(&buf, Calendar{
+		ProductID: "-//QR Menu//Specials//IT",
+		Name:      "Trattoria, menu del giorno",
+		RefreshIn: 6 * time.Hour,
+		Events: []Event{{
+			UID:         "s1@example.com",
+			Date:        time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+			Summary:     "Lasagne; fatte in casa",
+			Description: "Primo: lasagne\nSecondo: " + strings.Repeat("à", 60),
+			URL:         "https://example.com/r/trattoria",
+			Updated:     time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:Trattoria\\, menu del giorno\r\n",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT6H\r\n",
+		"DTSTAMP:20261015T093000Z\r\n",
+		"DTSTART;VALUE=DATE:20261016\r\n",
+		"DTEND;VALUE=DATE:20261017\r\n",
+		"SUMMARY:Lasagne\\; fatte in casa\r\n",
+		"DESCRIPTION:Primo: lasagne\\nSecondo: ",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in\n%s", want, out)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if len(line) > maxLineOctets {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("fold split a UTF-8 sequence: %q", line)
+		}
+	}
+
+	// Unfolding restores the description
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	if !strings.Contains(unfolded, strings.Repeat("à", 60)+"\r\n") {
+		t.Error("folded description does not unfold to the original")
+	}
+}
+
+func TestICalDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		30 * time.Minute: "PT30M",
+		2 * time.Hour:    "PT2H",
+		48 * time.Hour:   "P2D",
+		90 * time.Minute: "PT90M",
+		time.Second:      "PT1M",
+	} {
+		if got := icalDuration(d); got != want {
+			t.Errorf("icalDuration(%v) = %s, want %s", d, got, want)
+		}
+	}
+}
+
+func TestWriteRSS(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteRSS(&buf, Channel{
+		Title:       "Trattoria <da Mario>",
+		Link:        "https://example.com/r/trattoria",
+		Description: "Menu del giorno",
+		Language:    "it",
+		TTL:         time.Hour,
+		Items: []Item{{
+			Title:     "Lasagne & vino",
+			Link:      "https://example.com/menu/m1",
+			GUID:      "s1",
+			Published: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Version string `xml:"version,attr"`
+		Channel struct {
+			Title string `xml:"title"`
+			TTL   int    `xml:"ttl"`
+			Items []struct {
+				Title   string `xml:"title"`
+				GUID    string `xml:"guid"`
+				PubDate string `xml:"pubDate"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if doc.Version != "2.0" || doc.Channel.Title != "Trattoria <da Mario>" || doc.Channel.TTL != 60 {
+		t.Errorf("channel = %+v", doc.Channel)
+	}
+	if len(doc.Channel.Items) != 1 || doc.Channel.Items[0].Title != "Lasagne & vino" ||
+		doc.Channel.Items[0].GUID != "s1" || doc.Channel.Items[0].PubDate != "Fri, 16 Oct 2026 00:00:00 +0000" {
+		t.Errorf("items = %+v", doc.Channel.Items)
+	}
+	if !strings.Contains(buf.String(), `<guid isPermaLink="false">s1</guid>`) {
+		t.Errorf("guid not marked as non-permalink:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,115 @@
+// Package feed writes iCalendar (RFC 5545) and RSS 2.0 feeds
+package feed
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Event is an all-day calendar event
+type Event struct {
+	UID         string // Globally unique, e.g. id@host
+	Date        time.Time
+	Summary     string
+	Description string
+	URL         string
+	Updated     time.Time // DTSTAMP; the zero time uses the time of writing
+}
+
+// Calendar is an iCalendar object with its events
+type Calendar struct {
+	ProductID   string // PRODID, e.g. -//QR Menu//Specials//IT
+	Name        string // Shown by most clients as the calendar name (X-WR-CALNAME)
+	Description string
+	RefreshIn   time.Duration // Suggested polling interval; 0 omits it
+	Events      []Event
+}
+
+// maxLineOctets is the longest content line before folding
+const maxLineOctets = 75
+
+// WriteICal writes the calendar in iCalendar format
+func WriteICal(w io.Writer, cal Calendar) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeFolded(bw, name+":"+value)
+	}
+
+	now := time.Now().UTC()
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", cal.ProductID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		line("X-WR-CALNAME", escapeText(cal.Name))
+	}
+	if cal.Description != "" {
+		line("X-WR-CALDESC", escapeText(cal.Description))
+	}
+	if cal.RefreshIn > 0 {
+		line("REFRESH-INTERVAL;VALUE=DURATION", icalDuration(cal.RefreshIn))
+		line("X-PUBLISHED-TTL", icalDuration(cal.RefreshIn))
+	}
+	for _, event := range cal.Events {
+		stamp := event.Updated
+		if stamp.IsZero() {
+			stamp = now
+		}
+		line("BEGIN", "VEVENT")
+		line("UID", escapeText(event.UID))
+		line("DTSTAMP", stamp.UTC().Format("20060102T150405Z"))
+		line("DTSTART;VALUE=DATE", event.Date.Format("20060102"))
+		line("DTEND;VALUE=DATE", event.Date.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY", escapeText(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION", escapeText(event.Description))
+		}
+		if event.URL != "" {
+			line("URL", event.URL)
+		}
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// escapeText escapes a TEXT value: backslashes, separators and newlines
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// writeFolded writes a content line, folding it at 75 octets without splitting UTF-8
+// sequences; continuation lines start with a space
+func writeFolded(w *bufio.Writer, s string) {
+	limit := maxLineOctets
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.WriteString(s[:cut])
+		w.WriteString("\r\n ")
+		s = s[cut:]
+		limit = maxLineOctets - 1 // The leading space counts
+	}
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// icalDuration formats d as an iCalendar duration in whole minutes or more
+func icalDuration(d time.Duration) string {
+	minutes := int64(d / time.Minute)
+	switch {
+	case minutes >= 24*60 && minutes%(24*60) == 0:
+		return "P" + strconv.FormatInt(minutes/(24*60), 10) + "D"
+	case minutes >= 60 && minutes%60 == 0:
+		return "PT" + strconv.FormatInt(minutes/60, 10) + "H"
+	}
+	return "PT" + strconv.FormatInt(max(minutes, 1), 10) + "M"
+}
@@ -0,0 +1,93 @@
+package feed
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// Channel is an RSS 2.0 channel
+type Channel struct {
+	Title       string
+	Link        string
+	Description string
+	Language    string        // e.g. it
+	TTL         time.Duration // Suggested caching time; 0 omits it
+	Items       []Item
+}
+
+// Item is an entry of a channel
+type Item struct {
+	Title       string
+	Link        string
+	Description string
+	GUID        string // Unique, not a URL
+	Published   time.Time
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	TTL           int       `xml:"ttl,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link,omitempty"`
+	Description string  `xml:"description,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// WriteRSS writes the channel as an RSS 2.0 document
+func WriteRSS(w io.Writer, ch Channel) error {
+	doc := rssDocument{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         ch.Title,
+			Link:          ch.Link,
+			Description:   ch.Description,
+			Language:      ch.Language,
+			LastBuildDate: time.Now().UTC().Format(time.RFC1123Z),
+			TTL:           int(ch.TTL / time.Minute),
+		},
+	}
+	for _, item := range ch.Items {
+		out := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			GUID:        rssGUID{Value: item.GUID},
+		}
+		if !item.Published.IsZero() {
+			out.PubDate = item.Published.Format(time.RFC1123Z)
+		}
+		doc.Channel.Items = append(doc.Channel.Items, out)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,103 @@
+// Package fulfillment computes the pickup and delivery time slots of a restaurant from its
+// opening windows and checks delivery addresses against the delivery radius
+package fulfillment
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+)
+
+// Window is a period of a weekday in which the restaurant hands over orders. Open and Close
+// are offsets from midnight
+type Window struct {
+	Weekday time.Weekday
+	Open    time.Duration
+	Close   time.Duration
+}
+
+// ParseClock parses a time of day in the form HH:MM, from 00:00 to 24:00
+func ParseClock(s string) (time.Duration, error) {
+	if len(s) != 5 || s[2] != ':' {
+		return 0, errors.New("time must be in the form HH:MM")
+	}
+	h, m := 0, 0
+	for i, c := range []byte(s[:2] + s[3:]) {
+		if c < '0' || c > '9' {
+			return 0, errors.New("time must be in the form HH:MM")
+		}
+		if i < 2 {
+			h = h*10 + int(c-'0')
+		} else {
+			m = m*10 + int(c-'0')
+		}
+	}
+	if m > 59 || h > 24 || (h == 24 && m > 0) {
+		return 0, errors.New("time out of range")
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// Slots returns, in chronological order, the start of the slots of the day of day that fit
+// entirely within the windows of its weekday and start no earlier than earliest. Slots of
+// overlapping windows are returned once
+func Slots(day time.Time, windows []Window, length time.Duration, earliest time.Time) []time.Time {
+	if length <= 0 {
+		return nil
+	}
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	seen := make(map[int64]bool)
+	var slots []time.Time
+	for _, w := range windows {
+		if w.Weekday != midnight.Weekday() {
+			continue
+		}
+		for offset := w.Open; offset+length <= w.Close; offset += length {
+			start := clock(midnight, offset)
+			if start.Before(earliest) || seen[start.Unix()] {
+				continue
+			}
+			seen[start.Unix()] = true
+			slots = append(slots, start)
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Before(slots[j]) })
+	return slots
+}
+
+// IsSlot reports whether start is the start of one of the slots of its day
+func IsSlot(start time.Time, windows []Window, length time.Duration) bool {
+	for _, slot := range Slots(start, windows, length, time.Time{}) {
+		if slot.Equal(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// clock returns the time of day offset of the day starting at midnight. The wall clock is
+// used, so that slots keep their time on the days daylight saving time starts or ends
+func clock(midnight time.Time, offset time.Duration) time.Time {
+	minutes := int(offset / time.Minute)
+	return time.Date(midnight.Year(), midnight.Month(), midnight.Day(), minutes/60, minutes%60, 0, 0, midnight.Location())
+}
+
+// earthRadiusKm is the mean radius of the Earth
+const earthRadiusKm = 6371.0
+
+// Distance returns the great-circle distance in kilometres between two points given in
+// decimal degrees
+func Distance(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(lat2 - lat1)
+	dLng := rad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(lat1))*math.Cos(rad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// ValidCoordinates reports whether lat and lng are a position on the Earth. The point 0,0 is
+// rejected, being what clients send when they have no position
+func ValidCoordinates(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 && (lat != 0 || lng != 0)
+}
@@ -0,0 +1,74 @@
+package fulfillment
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"00:00": 0,
+		"12:30": 12*time.Hour + 30*time.Minute,
+		"24:00": 24 * time.Hour,
+	} {
+		if got, err := ParseClock(in); err != nil || got != want {
+			t.Errorf("ParseClock(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "9:30", "12:60", "24:01", "25:00", "ab:cd", "12.30"} {
+		if _, err := ParseClock(in); err == nil {
+			t.Errorf("ParseClock(%q) should fail", in)
+		}
+	}
+}
+
+func TestSlots(t *testing.T) {
+	loc := time.FixedZone("CET", 3600)
+	friday := time.Date(2026, 10, 16, 10, 0, 0, 0, loc)
+	windows := []Window{
+		{Weekday: time.Friday, Open: 19 * time.Hour, Close: 20*time.Hour + 10*time.Minute},
+		{Weekday: time.Friday, Open: 12 * time.Hour, Close: 13 * time.Hour},
+		{Weekday: time.Friday, Open: 12*time.Hour + 30*time.Minute, Close: 13*time.Hour + 30*time.Minute},
+		{Weekday: time.Saturday, Open: 12 * time.Hour, Close: 14 * time.Hour},
+	}
+
+	slots := Slots(friday, windows, 30*time.Minute, time.Date(2026, 10, 16, 12, 15, 0, 0, loc))
+	var got []string
+	for _, slot := range slots {
+		got = append(got, slot.Format("15:04"))
+	}
+	want := []string{"12:30", "13:00", "19:00", "19:30"}
+	if len(got) != len(want) {
+		t.Fatalf("slots = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("slots = %v, want %v", got, want)
+		}
+	}
+
+	if !IsSlot(time.Date(2026, 10, 16, 19, 30, 0, 0, loc), windows, 30*time.Minute) {
+		t.Error("19:30 should be a slot")
+	}
+	if IsSlot(time.Date(2026, 10, 16, 19, 40, 0, 0, loc), windows, 30*time.Minute) {
+		t.Error("19:40 should not be a slot")
+	}
+	if IsSlot(time.Date(2026, 10, 18, 12, 0, 0, 0, loc), windows, 30*time.Minute) {
+		t.Error("sunday has no slots")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	// Piazza del Duomo to the Castello Sforzesco, in Milan
+	d := Distance(45.4642, 9.1900, 45.4705, 9.1795)
+	if math.Abs(d-1.06) > 0.05 {
+		t.Errorf("Distance = %.3f km", d)
+	}
+	if Distance(45, 9, 45, 9) != 0 {
+		t.Error("distance of a point from itself is not 0")
+	}
+	if ValidCoordinates(0, 0) || ValidCoordinates(91, 9) || !ValidCoordinates(45.46, 9.19) {
+		t.Error("ValidCoordinates")
+	}
+}
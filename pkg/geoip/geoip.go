@@ -0,0 +1,82 @@
+// Package geoip resolves visitor IP addresses to country and city using a local
+// database: MaxMind GeoLite2/GeoIP2 (.mmdb) or an IP2Location LITE CSV export.
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"qr-menu/pkg/cache"
+	"qr-menu/pkg/metrics"
+)
+
+// Location is the geographic position of an IP address. Empty fields mean unknown
+type Location struct {
+	CountryCode string `json:"country_code,omitempty"` // ISO 3166-1 alpha-2, e.g. IT
+	Country     string `json:"country,omitempty"`
+	City        string `json:"city,omitempty"`
+}
+
+// Resolver looks up the location of an IP address in a database
+type Resolver interface {
+	Lookup(ip net.IP) (Location, error)
+}
+
+// Open loads the database at path, choosing the reader from the file extension:
+// .mmdb for MaxMind, .csv for IP2Location
+func Open(path string) (Resolver, error) {
+	switch {
+	case strings.HasSuffix(strings.ToLower(path), ".mmdb"):
+		return OpenMMDB(path)
+	case strings.HasSuffix(strings.ToLower(path), ".csv"):
+		return OpenIP2LocationCSV(path)
+	default:
+		return nil, fmt.Errorf("unsupported GeoIP database %q: expected .mmdb or .csv", path)
+	}
+}
+
+// Cached wraps a Resolver with a TTL cache keyed by IP and never fails: private or
+// invalid addresses, lookup errors and a missing database all resolve to an empty Location
+type Cached struct {
+	resolver Resolver
+	cache    *cache.CacheWithTTL
+}
+
+// NewCached creates a cached resolver. resolver may be nil, in which case every lookup is empty
+func NewCached(resolver Resolver, ttl time.Duration) *Cached {
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return &Cached{
+		resolver: resolver,
+		cache:    cache.NewCacheWithTTL(cache.NewInMemoryCache(), ttl),
+	}
+}
+
+// Locate returns the location of ip, or an empty Location when it cannot be determined
+func (c *Cached) Locate(ip string) Location {
+	if c == nil || c.resolver == nil {
+		return Location{}
+	}
+
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil || parsed.IsLoopback() || parsed.IsPrivate() || parsed.IsUnspecified() || parsed.IsLinkLocalUnicast() {
+		return Location{}
+	}
+
+	key := parsed.String()
+	value, hit := c.cache.Get(key)
+	metrics.CacheLookup("geoip", hit)
+	if hit {
+		return value.(Location)
+	}
+
+	location, err := c.resolver.Lookup(parsed)
+	if err != nil {
+		location = Location{}
+	}
+	c.cache.Set(key, location)
+	return location
+}
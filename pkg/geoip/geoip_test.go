@@ -0,0 +1,407 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// MaxMind DB format: https://maxmind.github.io/MaxMind-DB/
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// mmdbDataSectionSeparator is the 16 zero bytes between the search tree and the data section
+const mmdbDataSectionSeparator = 16
+
+// MaxMind DB data types written by the tests
+const (
+	mmdbPointer = 1
+	mmdbString  = 2
+	mmdbUint32  = 6
+	mmdbMap     = 7
+	mmdbBool    = 14
+)
+
+// mmdbWriter builds tiny MaxMind DB files for tests
+type mmdbWriter struct {
+	data bytes.Buffer
+}
+
+// control writes a control byte, the extended type byte and the size bytes for sizes of
+// 29 and more
+func (w *mmdbWriter) control(kind, size int) {
+	var extra []byte
+	switch {
+	case size >= 65821:
+		n := size - 65821
+		extra = []byte{byte(n >> 16), byte(n >> 8), byte(n)}
+		size = 31
+	case size >= 285:
+		n := size - 285
+		extra = []byte{byte(n >> 8), byte(n)}
+		size = 30
+	case size >= 29:
+		extra = []byte{byte(size - 29)}
+		size = 29
+	}
+	if kind > 7 {
+		w.data.WriteByte(byte(size))
+		w.data.WriteByte(byte(kind - 7))
+	} else {
+		w.data.WriteByte(byte(kind<<5 | size))
+	}
+	w.data.Write(extra)
+}
+
+func (w *mmdbWriter) encode(value interface{}) {
+	switch v := value.(type) {
+	case string:
+		w.control(mmdbString, len(v))
+		w.data.WriteString(v)
+	case uint64:
+		w.control(mmdbUint32, 4)
+		binary.Write(&w.data, binary.BigEndian, uint32(v))
+	case bool:
+		b := 0
+		if v {
+			b = 1
+		}
+		w.control(mmdbBool, b)
+	case map[string]interface{}:
+		w.control(mmdbMap, len(v))
+		for key, item := range v {
+			w.encode(key)
+			w.encode(item)
+		}
+	case mmdbTestPointer:
+		w.data.WriteByte(byte(mmdbPointer<<5 | int(v)>>8))
+		w.data.WriteByte(byte(v))
+	}
+}
+
+// mmdbTestPointer is a pointer to a data section offset smaller than 2048
+type mmdbTestPointer int
+
+type mmdbTrieNode struct {
+	child [2]*mmdbTrieNode
+	data  [2]int // data section offset + 1, 0 for empty
+	id    int
+}
+
+// buildMMDB writes an IPv6 database mapping prefixes to records, encoded in prefix order
+func buildMMDB(recordSize int, prefixes map[string]interface{}) []byte {
+	cidrs := make([]string, 0, len(prefixes))
+	for cidr := range prefixes {
+		cidrs = append(cidrs, cidr)
+	}
+	sort.Strings(cidrs)
+
+	w := &mmdbWriter{}
+	root := &mmdbTrieNode{}
+	for _, cidr := range cidrs {
+		offset := w.data.Len()
+		w.encode(prefixes[cidr])
+
+		_, ipnet, _ := net.ParseCIDR(cidr)
+		ones, bits := ipnet.Mask.Size()
+		ip := ipnet.IP.To16()
+		if bits == 32 {
+			// IPv4 networks live under ::/96 in IPv6 trees
+			ip = append(make(net.IP, 12), ipnet.IP.To4()...)
+			ones += 96
+		}
+		node := root
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				node.data[bit] = offset + 1
+				break
+			}
+			if node.child[bit] == nil {
+				node.child[bit] = &mmdbTrieNode{}
+			}
+			node = node.child[bit]
+		}
+	}
+
+	var nodes []*mmdbTrieNode
+	queue := []*mmdbTrieNode{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		node.id = len(nodes)
+		nodes = append(nodes, node)
+		for _, child := range node.child {
+			if child != nil {
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	var tree bytes.Buffer
+	for _, node := range nodes {
+		var records [2]uint32
+		for i := range records {
+			switch {
+			case node.child[i] != nil:
+				records[i] = uint32(node.child[i].id)
+			case node.data[i] != 0:
+				records[i] = uint32(len(nodes) + mmdbDataSectionSeparator + node.data[i] - 1)
+			default:
+				records[i] = uint32(len(nodes))
+			}
+		}
+		switch recordSize {
+		case 24:
+			for _, r := range records {
+				tree.Write([]byte{byte(r >> 16), byte(r >> 8), byte(r)})
+			}
+		case 28:
+			tree.Write([]byte{byte(records[0] >> 16), byte(records[0] >> 8), byte(records[0])})
+			tree.WriteByte(byte(records[0]>>24)<<4 | byte(records[1]>>24)&0x0f)
+			tree.Write([]byte{byte(records[1] >> 16), byte(records[1] >> 8), byte(records[1])})
+		default:
+			binary.Write(&tree, binary.BigEndian, records)
+		}
+	}
+
+	meta := &mmdbWriter{}
+	meta.encode(map[string]interface{}{
+		"node_count":    uint64(len(nodes)),
+		"record_size":   uint64(recordSize),
+		"ip_version":    uint64(6),
+		"database_type": "Test-City",
+	})
+
+	var out bytes.Buffer
+	out.Write(tree.Bytes())
+	out.Write(make([]byte, mmdbDataSectionSeparator))
+	out.Write(w.data.Bytes())
+	out.Write(mmdbMetadataMarker)
+	out.Write(meta.data.Bytes())
+	return out.Bytes()
+}
+
+func cityRecord(code, country, city string) map[string]interface{} {
+	record := map[string]interface{}{
+		"country": map[string]interface{}{
+			"iso_code":             code,
+			"is_in_european_union": true,
+			"names":                map[string]interface{}{"en": country},
+		},
+	}
+	if city != "" {
+		record["city"] = map[string]interface{}{
+			"geoname_id": uint64(3169070),
+			"names":      map[string]interface{}{"en": city},
+		}
+	}
+	return record
+}
+
+// TestMMDBLookup tests IPv4 and IPv6 lookups with every record size
+func TestMMDBLookup(t *testing.T) {
+	for _, size := range []int{24, 28, 32} {
+		buf := buildMMDB(size, map[string]interface{}{
+			"81.0.0.0/8":      cityRecord("IT", "Italy", "Rome"),
+			"2.16.0.0/13":     cityRecord("FR", "France", ""),
+			"2001:db8::/32":   cityRecord("DE", "Germany", "Berlin"),
+			"93.184.216.0/24": mmdbTestPointer(0), // first record: 2.16.0.0/13
+		})
+		db, err := NewMMDB(buf)
+		if err != nil {
+			t.Fatalf("record size %d: %v", size, err)
+		}
+		if db.Type() != "Test-City" {
+			t.Errorf("Expected database type Test-City, got %q", db.Type())
+		}
+
+		cases := map[string]Location{
+			"81.20.30.40":   {CountryCode: "IT", Country: "Italy", City: "Rome"},
+			"2.17.1.1":      {CountryCode: "FR", Country: "France"},
+			"2001:db8::1":   {CountryCode: "DE", Country: "Germany", City: "Berlin"},
+			"93.184.216.34": {CountryCode: "FR", Country: "France"},
+			"8.8.8.8":       {},
+			"2a00:1450::1":  {},
+		}
+		for ip, want := range cases {
+			got, err := db.Lookup(net.ParseIP(ip))
+			if err != nil || got != want {
+				t.Errorf("record size %d: Lookup(%s) = %+v, %v; want %+v", size, ip, got, err, want)
+			}
+		}
+	}
+}
+
+// TestMMDBSizes tests the one, two and three byte size encodings around their boundaries
+func TestMMDBSizes(t *testing.T) {
+	for _, size := range []int{28, 29, 284, 285, 286, 600, 65820, 65821, 70000} {
+		city := strings.Repeat("x", size)
+		buf := buildMMDB(24, map[string]interface{}{"81.0.0.0/8": cityRecord("IT", "Italy", city)})
+		db, err := NewMMDB(buf)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		got, err := db.Lookup(net.ParseIP("81.1.1.1"))
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if got.City != city || got.CountryCode != "IT" || got.Country != "Italy" {
+			t.Errorf("size %d: decoded city of %d bytes, country %q %q", size, len(got.City), got.CountryCode, got.Country)
+		}
+	}
+
+	// Maps with more than 285 entries use the two byte size too
+	names := map[string]interface{}{"en": "Rome"}
+	for i := 0; i < 300; i++ {
+		names[fmt.Sprintf("l%03d", i)] = "x"
+	}
+	record := cityRecord("IT", "Italy", "")
+	record["city"] = map[string]interface{}{"names": names}
+	db, err := NewMMDB(buildMMDB(24, map[string]interface{}{"81.0.0.0/8": record}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Lookup(net.ParseIP("81.1.1.1")); err != nil || got.City != "Rome" {
+		t.Errorf("Lookup with a %d entry map = %+v, %v", len(names), got, err)
+	}
+}
+
+// TestMMDBInvalid tests that garbage is rejected
+func TestMMDBInvalid(t *testing.T) {
+	if _, err := NewMMDB([]byte("not a database")); err == nil {
+		t.Error("Expected error for missing metadata")
+	}
+	truncated := append([]byte{}, mmdbMetadataMarker...)
+	truncated = append(truncated, byte(mmdbMap<<5|3))
+	if _, err := NewMMDB(truncated); err == nil {
+		t.Error("Expected error for truncated metadata")
+	}
+
+	// A map whose value points back to the map itself must not recurse forever
+	loop := buildMMDB(24, map[string]interface{}{
+		"81.0.0.0/8": map[string]interface{}{"country": mmdbTestPointer(0)},
+	})
+	db, err := NewMMDB(loop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Lookup(net.ParseIP("81.1.1.1")); err == nil && got != (Location{}) {
+		t.Errorf("Expected error or empty location for pointer cycle, got %+v", got)
+	}
+}
+
+const ip2locationCSV = `"0","16777215","-","-","-","-"
+"1358954496","1375731711","IT","Italy","Lazio","Rome"
+"34603008","35127295","FR","France","-","-"
+"42540766411282592856903984951653826560","42540766490510755371168322545197776895","DE","Germany","Berlin","Berlin"
+`
+
+// TestIP2Location tests range lookups on IPv4 and IPv6 rows
+func TestIP2Location(t *testing.T) {
+	db, err := NewIP2Location(strings.NewReader(ip2locationCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]Location{
+		"81.0.0.1":       {CountryCode: "IT", Country: "Italy", City: "Rome"},
+		"81.255.255.255": {CountryCode: "IT", Country: "Italy", City: "Rome"},
+		"2.17.0.1":       {CountryCode: "FR", Country: "France"},
+		"0.0.0.1":        {},
+		"82.0.0.1":       {},
+		"2001:db8::1":    {CountryCode: "DE", Country: "Germany", City: "Berlin"},
+	}
+	for ip, want := range cases {
+		got, err := db.Lookup(net.ParseIP(ip))
+		if err != nil || got != want {
+			t.Errorf("Lookup(%s) = %+v, %v; want %+v", ip, got, err, want)
+		}
+	}
+
+	if _, err := NewIP2Location(strings.NewReader(`"x","1","IT","Italy"`)); err == nil {
+		t.Error("Expected error for invalid range")
+	}
+}
+
+// TestOpen tests the reader selection by extension
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	csvPath := filepath.Join(dir, "IP2LOCATION-LITE-DB3.CSV")
+	os.WriteFile(csvPath, []byte(ip2locationCSV), 0600)
+	if r, err := Open(csvPath); err != nil {
+		t.Errorf("Expected CSV to open, got %v", err)
+	} else if _, ok := r.(*IP2Location); !ok {
+		t.Errorf("Expected IP2Location reader, got %T", r)
+	}
+
+	mmdbPath := filepath.Join(dir, "GeoLite2-City.mmdb")
+	os.WriteFile(mmdbPath, buildMMDB(24, map[string]interface{}{"81.0.0.0/8": cityRecord("IT", "Italy", "Rome")}), 0600)
+	if r, err := Open(mmdbPath); err != nil {
+		t.Errorf("Expected MMDB to open, got %v", err)
+	} else if _, ok := r.(*MMDB); !ok {
+		t.Errorf("Expected MMDB reader, got %T", r)
+	}
+
+	if _, err := Open(filepath.Join(dir, "geo.dat")); err == nil {
+		t.Error("Expected error for unknown extension")
+	}
+	if _, err := Open(filepath.Join(dir, "missing.mmdb")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+type countingResolver struct {
+	calls int
+	err   error
+}
+
+func (r *countingResolver) Lookup(ip net.IP) (Location, error) {
+	r.calls++
+	return Location{CountryCode: "IT", City: "Rome"}, r.err
+}
+
+// TestCached tests caching, private address skipping and graceful fallback
+func TestCached(t *testing.T) {
+	inner := &countingResolver{}
+	cached := NewCached(inner, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if got := cached.Locate("81.1.2.3"); got.City != "Rome" {
+			t.Fatalf("Expected Rome, got %+v", got)
+		}
+	}
+	if inner.calls != 1 {
+		t.Errorf("Expected 1 lookup thanks to the cache, got %d", inner.calls)
+	}
+
+	for _, ip := range []string{"127.0.0.1", "192.168.1.10", "10.0.0.1", "::1", "not-an-ip", ""} {
+		if got := cached.Locate(ip); got != (Location{}) {
+			t.Errorf("Expected empty location for %q, got %+v", ip, got)
+		}
+	}
+	if inner.calls != 1 {
+		t.Errorf("Expected private addresses to skip the database, got %d lookups", inner.calls)
+	}
+
+	failing := NewCached(&countingResolver{err: errors.New("corrupt")}, time.Minute)
+	if got := failing.Locate("81.1.2.3"); got != (Location{}) {
+		t.Errorf("Expected empty location on error, got %+v", got)
+	}
+
+	var disabled *Cached
+	if got := disabled.Locate("81.1.2.3"); got != (Location{}) {
+		t.Errorf("Expected empty location without database, got %+v", got)
+	}
+	if got := NewCached(nil, 0).Locate("81.1.2.3"); got != (Location{}) {
+		t.Errorf("Expected empty location with nil resolver, got %+v", got)
+	}
+}
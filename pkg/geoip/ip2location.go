@@ -0,0 +1,119 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"sort"
+)
+
+// ip2locationRange is one row of an IP2Location CSV, with bounds as 16-byte addresses
+// (IPv4 rows are stored as IPv4-mapped IPv6 addresses)
+type ip2locationRange struct {
+	from, to [16]byte
+	location Location
+}
+
+// IP2Location looks up addresses in an IP2Location LITE CSV export (DB1, DB3, DB5, DB11...)
+// loaded in memory. Columns are ip_from, ip_to, country_code, country_name and, when
+// present, region_name and city_name. Both the IPv4 and the IPv6 editions are supported
+type IP2Location struct {
+	ranges []ip2locationRange
+}
+
+// OpenIP2LocationCSV loads an IP2Location CSV file
+func OpenIP2LocationCSV(path string) (*IP2Location, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewIP2Location(f)
+}
+
+// NewIP2Location parses an IP2Location CSV export
+func NewIP2Location(r io.Reader) (*IP2Location, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	db := &IP2Location{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("IP2Location CSV line %d: %w", line, err)
+		}
+		if len(record) < 4 {
+			return nil, fmt.Errorf("IP2Location CSV line %d: expected at least 4 columns", line)
+		}
+
+		from, ok1 := ip2locationAddr(record[0])
+		to, ok2 := ip2locationAddr(record[1])
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("IP2Location CSV line %d: invalid range", line)
+		}
+
+		entry := ip2locationRange{from: from, to: to}
+		if record[2] != "-" {
+			entry.location.CountryCode = record[2]
+			entry.location.Country = record[3]
+		}
+		if len(record) >= 6 && record[5] != "-" {
+			entry.location.City = record[5]
+		}
+		db.ranges = append(db.ranges, entry)
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].from[:], db.ranges[j].from[:]) < 0
+	})
+	return db, nil
+}
+
+// maxIPv4 is the largest value of an IPv4 CSV row; larger values come from the IPv6 edition
+var maxIPv4 = big.NewInt(0xffffffff)
+
+// ip2locationAddr converts a decimal IP number to a 16-byte address
+func ip2locationAddr(value string) ([16]byte, bool) {
+	var addr [16]byte
+	n, ok := new(big.Int).SetString(value, 10)
+	if !ok || n.Sign() < 0 || n.BitLen() > 128 {
+		return addr, false
+	}
+	if n.Cmp(maxIPv4) <= 0 {
+		// IPv4 edition: same representation as IPv4-mapped rows of the IPv6 edition
+		n = new(big.Int).Add(n, new(big.Int).Lsh(big.NewInt(0xffff), 32))
+	}
+	n.FillBytes(addr[:])
+	return addr, true
+}
+
+// Lookup returns the location of the range containing ip
+func (db *IP2Location) Lookup(ip net.IP) (Location, error) {
+	ip16 := ip.To16()
+	if ip16 == nil {
+		return Location{}, fmt.Errorf("invalid IP address %v", ip)
+	}
+	var addr [16]byte
+	copy(addr[:], ip16)
+
+	// First range starting after addr, the candidate is the one before it
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].from[:], addr[:]) > 0
+	})
+	if i == 0 {
+		return Location{}, nil
+	}
+	candidate := db.ranges[i-1]
+	if bytes.Compare(addr[:], candidate.to[:]) > 0 {
+		return Location{}, nil
+	}
+	return candidate.location, nil
+}
@@ -0,0 +1,66 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+)
+
+// MMDB reads a MaxMind DB file (GeoLite2-City, GeoLite2-Country, GeoIP2-City...)
+type MMDB struct {
+	reader *maxminddb.Reader
+}
+
+// mmdbRecord is the part of a GeoIP2/GeoLite2 City or Country record used by Location
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// OpenMMDB loads and validates a MaxMind DB file
+func OpenMMDB(path string) (*MMDB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MMDB{reader: reader}, nil
+}
+
+// NewMMDB parses a MaxMind DB from memory
+func NewMMDB(buf []byte) (*MMDB, error) {
+	reader, err := maxminddb.OpenBytes(buf)
+	if err != nil {
+		return nil, err
+	}
+	return &MMDB{reader: reader}, nil
+}
+
+// Type returns the database type from the metadata, e.g. GeoLite2-City
+func (db *MMDB) Type() string {
+	return db.reader.Metadata.DatabaseType
+}
+
+// Lookup returns the country and English city name of ip
+func (db *MMDB) Lookup(ip net.IP) (Location, error) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return Location{}, fmt.Errorf("invalid IP address %v", ip)
+	}
+
+	var record mmdbRecord
+	if err := db.reader.Lookup(addr.Unmap()).Decode(&record); err != nil {
+		return Location{}, err
+	}
+	return Location{
+		CountryCode: record.Country.ISOCode,
+		Country:     record.Country.Names["en"],
+		City:        record.City.Names["en"],
+	}, nil
+}
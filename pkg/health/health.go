@@ -0,0 +1,244 @@
+// Package health runs the dependency checks behind the health and readiness probes.
+// A failing critical check makes the service down; any other failure only degrades it
+package health
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"qr-menu/logger"
+	"qr-menu/pkg/storage"
+)
+
+// Status is the state of a check or of the whole service
+type Status string
+
+const (
+	StatusOK       Status = "ok"
+	StatusDegraded Status = "degraded" // Serving, with a non-critical dependency failing
+	StatusDown     Status = "down"     // A critical dependency is failing
+)
+
+// Check is a dependency check. Run returns nil when the dependency is usable
+type Check struct {
+	Name     string
+	Critical bool // A failure makes the service down instead of degraded
+	Run      func(ctx context.Context) error
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Status   Status `json:"status"`
+	Critical bool   `json:"critical"`
+	Error    string `json:"error,omitempty"`
+	Duration int64  `json:"duration_ms"`
+}
+
+// Report is the outcome of all the checks
+type Report struct {
+	Status    Status            `json:"status"`
+	Checks    map[string]Result `json:"checks"`
+	CheckedAt time.Time         `json:"checked_at"`
+}
+
+// HTTPStatus returns the status code of a probe: 503 when down, 200 otherwise, so a
+// degraded instance keeps receiving traffic
+func (r Report) HTTPStatus() int {
+	if r.Status == StatusDown {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// Failing returns the names of the checks that are not ok, sorted
+func (r Report) Failing() []string {
+	var names []string
+	for name, result := range r.Checks {
+		if result.Status != StatusOK {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Checker runs the registered checks concurrently. A report is reused for maxAge, so
+// frequent probes from several orchestrators do not load the dependencies
+type Checker struct {
+	timeout time.Duration
+	maxAge  time.Duration
+
+	mu     sync.Mutex
+	checks []Check
+	last   *Report
+}
+
+// NewChecker creates a checker giving every check at most timeout
+func NewChecker(timeout, maxAge time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return &Checker{timeout: timeout, maxAge: maxAge}
+}
+
+// Add registers a check
+func (c *Checker) Add(check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check)
+	c.last = nil
+}
+
+// Run returns a copy of the current report, running the checks if the last one is older
+// than maxAge. Checks whose status changed since the previous run are logged
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last != nil && time.Since(c.last.CheckedAt) < c.maxAge {
+		return c.last.clone()
+	}
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks)), CheckedAt: time.Now()}
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	for i, check := range c.checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		switch {
+		case result.Status == StatusDown:
+			report.Status = StatusDown
+		case result.Status == StatusDegraded && report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+		c.logChange(check.Name, result)
+	}
+
+	c.last = &report
+	return report.clone()
+}
+
+// clone copies the report, so callers can change the results of a shared report
+func (r Report) clone() Report {
+	checks := make(map[string]Result, len(r.Checks))
+	for name, result := range r.Checks {
+		checks[name] = result
+	}
+	r.Checks = checks
+	return r
+}
+
+// run executes a check with the checker timeout, turning a panic into a failure
+func (c *Checker) run(ctx context.Context, check Check) (result Result) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("no answer within %s", c.timeout)
+	}
+
+	result = Result{Status: StatusOK, Critical: check.Critical, Duration: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Error = err.Error()
+		result.Status = StatusDegraded
+		if check.Critical {
+			result.Status = StatusDown
+		}
+	}
+	return result
+}
+
+// logChange logs a check that changed status since the previous report; c.mu must be held
+func (c *Checker) logChange(name string, result Result) {
+	previous := StatusOK
+	if c.last != nil {
+		if r, ok := c.last.Checks[name]; ok {
+			previous = r.Status
+		}
+	}
+	if result.Status == previous {
+		return
+	}
+
+	data := map[string]interface{}{"check": name, "status": result.Status, "previous": previous}
+	if result.Error != "" {
+		data["error"] = result.Error
+	}
+	if result.Status == StatusOK {
+		logger.Info("Health check recovered", data)
+	} else {
+		logger.Warn("Health check failing", data)
+	}
+}
+
+// BlobWritable checks that store accepts writes by storing and deleting a small blob
+func BlobWritable(store storage.BlobStore, key string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		probe := []byte(time.Now().UTC().Format(time.RFC3339Nano))
+		if err := store.Put(ctx, key, bytes.NewReader(probe), int64(len(probe)), "text/plain"); err != nil {
+			return fmt.Errorf("write: %w", err)
+		}
+		if err := store.Delete(ctx, key); err != nil {
+			return fmt.Errorf("delete: %w", err)
+		}
+		return nil
+	}
+}
+
+// MinFreeDisk checks that the volume holding path has at least minFree bytes available
+func MinFreeDisk(path string, minFree uint64) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		free, err := FreeDiskSpace(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%d MB free on %s, below %d MB", free>>20, path, minFree>>20)
+		}
+		return nil
+	}
+}
+
+// ErrQueueSaturated is returned by QueueBelow when the queue is too full
+var ErrQueueSaturated = errors.New("queue saturated")
+
+// QueueBelow checks that a queue is filled less than percent of its size. usage returns
+// the queued items and the size
+func QueueBelow(usage func() (queued, size int), percent int) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		queued, size := usage()
+		if size > 0 && queued*100 >= size*percent {
+			return fmt.Errorf("%w: %d of %d", ErrQueueSaturated, queued, size)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,112 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"qr-menu/pkg/storage"
+)
+
+func ok(context.Context) error      { return nil }
+func failing(context.Context) error { return errors.New("unreachable") }
+
+// TestStatus tests how check failures combine into the service status
+func TestStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		checks []Check
+		want   Status
+		code   int
+	}{
+		{"all ok", []Check{{"db", true, ok}, {"cache", false, ok}}, StatusOK, http.StatusOK},
+		{"non-critical failing", []Check{{"db", true, ok}, {"cache", false, failing}}, StatusDegraded, http.StatusOK},
+		{"critical failing", []Check{{"db", true, failing}, {"cache", false, failing}}, StatusDown, http.StatusServiceUnavailable},
+		{"no checks", nil, StatusOK, http.StatusOK},
+	} {
+		c := NewChecker(time.Second, 0)
+		for _, check := range tt.checks {
+			c.Add(check)
+		}
+		report := c.Run(context.Background())
+		if report.Status != tt.want || report.HTTPStatus() != tt.code {
+			t.Errorf("%s: status %s (%d), want %s (%d)", tt.name, report.Status, report.HTTPStatus(), tt.want, tt.code)
+		}
+	}
+}
+
+// TestTimeoutAndPanic tests that slow and panicking checks fail instead of blocking the probe
+func TestTimeoutAndPanic(t *testing.T) {
+	c := NewChecker(20*time.Millisecond, 0)
+	c.Add(Check{Name: "slow", Critical: true, Run: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}})
+	c.Add(Check{Name: "panic", Run: func(context.Context) error { panic("boom") }})
+
+	start := time.Now()
+	report := c.Run(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Run waited for the slow check")
+	}
+	if report.Checks["slow"].Status != StatusDown || report.Checks["panic"].Status != StatusDegraded {
+		t.Errorf("Unexpected results: %+v", report.Checks)
+	}
+	if failing := report.Failing(); len(failing) != 2 || failing[0] != "panic" {
+		t.Errorf("Failing() = %v", failing)
+	}
+}
+
+// TestMaxAge tests that reports are reused for maxAge
+func TestMaxAge(t *testing.T) {
+	var calls atomic.Int32
+	c := NewChecker(time.Second, time.Hour)
+	c.Add(Check{Name: "db", Run: func(context.Context) error {
+		calls.Add(1)
+		return nil
+	}})
+	c.Run(context.Background())
+	c.Run(context.Background())
+	if calls.Load() != 1 {
+		t.Errorf("Check ran %d times, want 1", calls.Load())
+	}
+}
+
+func TestBlobWritable(t *testing.T) {
+	store := storage.NewLocalStore(t.TempDir(), "/static")
+	check := BlobWritable(store, "health/probe")
+	if err := check(context.Background()); err != nil {
+		t.Fatalf("BlobWritable failed: %v", err)
+	}
+	if exists, _ := store.Exists(context.Background(), "health/probe"); exists {
+		t.Error("Probe blob not deleted")
+	}
+}
+
+func TestMinFreeDisk(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := FreeDiskSpace(dir); err != nil {
+		t.Skipf("free disk space not available: %v", err)
+	}
+	if err := MinFreeDisk(dir, 1)(context.Background()); err != nil {
+		t.Errorf("MinFreeDisk(1 byte) failed: %v", err)
+	}
+	if err := MinFreeDisk(dir, 1<<62)(context.Background()); err == nil {
+		t.Error("MinFreeDisk accepted an impossible threshold")
+	}
+}
+
+func TestQueueBelow(t *testing.T) {
+	usage := func(queued int) func() (int, int) {
+		return func() (int, int) { return queued, 100 }
+	}
+	if err := QueueBelow(usage(79), 80)(context.Background()); err != nil {
+		t.Errorf("79%% full reported as saturated: %v", err)
+	}
+	if err := QueueBelow(usage(80), 80)(context.Background()); !errors.Is(err, ErrQueueSaturated) {
+		t.Errorf("80%% full: got %v, want ErrQueueSaturated", err)
+	}
+}
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ListOptions declares the query parameters accepted by a list endpoint
+type ListOptions struct {
+	DefaultPerPage int
+	MaxPerPage     int
+	DefaultSort    string   // Used without a sort parameter, e.g. "-created_at"
+	Sortable       []string // Fields accepted by sort
+	Filterable     []string // Fields accepted by filter[field]
+}
+
+// SortField is a field of the sort parameter
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ListQuery is the parsed query of a list request:
+// ?page=2&per_page=20&sort=-created_at,name&filter[status]=dead
+type ListQuery struct {
+	Page    int
+	PerPage int
+	Sort    []SortField
+	Filters map[string]string
+}
+
+// ParseListQuery parses page, per_page, sort and filter[field] against opts. per_page is
+// capped to MaxPerPage and limit is accepted as its older name. Filterable fields are also
+// read from plain parameters (status=dead), with filter[status] taking precedence. Unknown
+// sort or filter fields and malformed numbers are errors, to be reported as 400
+func ParseListQuery(r *http.Request, opts ListOptions) (ListQuery, error) {
+	values := r.URL.Query()
+	q := ListQuery{Page: 1, PerPage: opts.DefaultPerPage, Filters: map[string]string{}}
+	if q.PerPage <= 0 {
+		q.PerPage = 20
+	}
+
+	if value := values.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return q, fmt.Errorf("invalid page: %s", value)
+		}
+		q.Page = page
+	}
+
+	perPage := values.Get("per_page")
+	if perPage == "" {
+		perPage = values.Get("limit")
+	}
+	if perPage != "" {
+		n, err := strconv.Atoi(perPage)
+		if err != nil || n < 1 {
+			return q, fmt.Errorf("invalid per_page: %s", perPage)
+		}
+		q.PerPage = n
+	}
+	if opts.MaxPerPage > 0 && q.PerPage > opts.MaxPerPage {
+		q.PerPage = opts.MaxPerPage
+	}
+
+	sortParam := values.Get("sort")
+	if sortParam == "" {
+		sortParam = opts.DefaultSort
+	}
+	for _, field := range strings.Split(sortParam, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		s := SortField{Field: strings.TrimPrefix(field, "-"), Desc: strings.HasPrefix(field, "-")}
+		if !contains(opts.Sortable, s.Field) {
+			return q, fmt.Errorf("unsupported sort field: %s", s.Field)
+		}
+		q.Sort = append(q.Sort, s)
+	}
+
+	for key, vals := range values {
+		if !strings.HasPrefix(key, "filter[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		field := key[len("filter[") : len(key)-1]
+		if !contains(opts.Filterable, field) {
+			return q, fmt.Errorf("unsupported filter: %s", field)
+		}
+		if value := strings.TrimSpace(vals[0]); value != "" {
+			q.Filters[field] = value
+		}
+	}
+	for _, field := range opts.Filterable {
+		if _, ok := q.Filters[field]; ok {
+			continue
+		}
+		if value := strings.TrimSpace(values.Get(field)); value != "" {
+			q.Filters[field] = value
+		}
+	}
+
+	return q, nil
+}
+
+// Offset returns the number of items before the requested page
+func (q ListQuery) Offset() int {
+	return (q.Page - 1) * q.PerPage
+}
+
+// Filter returns the value of a filter, empty if not set
+func (q ListQuery) Filter(field string) string {
+	return q.Filters[field]
+}
+
+// BoolFilter returns the value of a true/false filter; ok is false if the filter is not set
+func (q ListQuery) BoolFilter(field string) (value bool, ok bool, err error) {
+	raw, set := q.Filters[field]
+	if !set {
+		return false, false, nil
+	}
+	value, err = strconv.ParseBool(raw)
+	if err != nil {
+		return false, false, fmt.Errorf("invalid filter[%s]: %s", field, raw)
+	}
+	return value, true, nil
+}
+
+// SortKeys returns the sort fields as strings, prefixed by "-" when descending
+func (q ListQuery) SortKeys() []string {
+	keys := make([]string, 0, len(q.Sort))
+	for _, s := range q.Sort {
+		if s.Desc {
+			keys = append(keys, "-"+s.Field)
+		} else {
+			keys = append(keys, s.Field)
+		}
+	}
+	return keys
+}
+
+// Metadata describes the page returned by a list endpoint
+type Metadata struct {
+	Page       int               `json:"page"`
+	PerPage    int               `json:"per_page"`
+	Total      int64             `json:"total"`
+	TotalPages int64             `json:"total_pages"`
+	Sort       string            `json:"sort,omitempty"`
+	Filters    map[string]string `json:"filters,omitempty"`
+}
+
+// ListResponse is the response of a list endpoint
+type ListResponse struct {
+	Status string      `json:"status"`
+	Data   interface{} `json:"data"`
+	Meta   Metadata    `json:"meta"`
+}
+
+// List sends a page of results with its metadata
+func List(w http.ResponseWriter, data interface{}, q ListQuery, total int64) error {
+	meta := Metadata{
+		Page:    q.Page,
+		PerPage: q.PerPage,
+		Total:   total,
+		Sort:    strings.Join(q.SortKeys(), ","),
+		Filters: q.Filters,
+	}
+	if q.PerPage > 0 {
+		meta.TotalPages = (total + int64(q.PerPage) - 1) / int64(q.PerPage)
+	}
+	return JSON(w, http.StatusOK, ListResponse{Status: "success", Data: data, Meta: meta})
+}
+
+// SortSlice sorts items in memory by q.Sort. compare has a function per sortable field,
+// returning a negative number when a comes before b in ascending order. The sort is
+// stable, so items equal on every field keep their order
+func SortSlice[T any](items []T, q ListQuery, compare map[string]func(a, b T) int) {
+	if len(q.Sort) == 0 {
+		return
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		for _, s := range q.Sort {
+			cmp, ok := compare[s.Field]
+			if !ok {
+				continue
+			}
+			c := cmp(items[i], items[j])
+			if s.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
+
+// PageOf returns the requested page of items already filtered and sorted in memory
+func PageOf[T any](items []T, q ListQuery) []T {
+	start := min(q.Offset(), len(items))
+	end := min(start+q.PerPage, len(items))
+	return items[start:end]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
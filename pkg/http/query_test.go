@@ -0,0 +1,143 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var testListOptions = ListOptions{
+	DefaultPerPage: 20,
+	MaxPerPage:     100,
+	DefaultSort:    "-created_at",
+	Sortable:       []string{"created_at", "name"},
+	Filterable:     []string{"status", "webhook_id"},
+}
+
+func parse(t *testing.T, rawQuery string) (ListQuery, error) {
+	t.Helper()
+	return ParseListQuery(httptest.NewRequest(http.MethodGet, "/items?"+rawQuery, nil), testListOptions)
+}
+
+func TestParseListQueryDefaults(t *testing.T) {
+	q, err := parse(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Page != 1 || q.PerPage != 20 || q.Offset() != 0 {
+		t.Errorf("page %d, per_page %d, offset %d", q.Page, q.PerPage, q.Offset())
+	}
+	if keys := q.SortKeys(); len(keys) != 1 || keys[0] != "-created_at" {
+		t.Errorf("SortKeys() = %v, want the default sort", keys)
+	}
+	if len(q.Filters) != 0 {
+		t.Errorf("Filters = %v, want none", q.Filters)
+	}
+}
+
+func TestParseListQuery(t *testing.T) {
+	q, err := parse(t, "page=3&per_page=500&sort=name,-created_at&filter[status]=dead&webhook_id=wh1&status=success")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Page != 3 || q.PerPage != 100 || q.Offset() != 200 {
+		t.Errorf("page %d, per_page %d, offset %d; per_page should be capped to 100", q.Page, q.PerPage, q.Offset())
+	}
+	if got := strings.Join(q.SortKeys(), ","); got != "name,-created_at" {
+		t.Errorf("SortKeys() = %s", got)
+	}
+	if q.Filter("status") != "dead" {
+		t.Errorf("filter[status] = %q, want it to win over status=", q.Filter("status"))
+	}
+	if q.Filter("webhook_id") != "wh1" {
+		t.Errorf("plain webhook_id not read as a filter: %v", q.Filters)
+	}
+
+	if q, err := parse(t, "limit=5"); err != nil || q.PerPage != 5 {
+		t.Errorf("limit=5: per_page %d, err %v", q.PerPage, err)
+	}
+}
+
+func TestParseListQueryErrors(t *testing.T) {
+	for _, rawQuery := range []string{
+		"page=0",
+		"page=abc",
+		"per_page=-1",
+		"sort=password",
+		"sort=-name,secret",
+		"filter[owner]=x",
+	} {
+		if _, err := parse(t, rawQuery); err == nil {
+			t.Errorf("%s: expected an error", rawQuery)
+		}
+	}
+}
+
+func TestBoolFilter(t *testing.T) {
+	q := ListQuery{Filters: map[string]string{"active": "false", "broken": "maybe"}}
+	if value, ok, err := q.BoolFilter("active"); err != nil || !ok || value {
+		t.Errorf("active: %v %v %v", value, ok, err)
+	}
+	if _, ok, err := q.BoolFilter("missing"); err != nil || ok {
+		t.Errorf("missing: %v %v", ok, err)
+	}
+	if _, _, err := q.BoolFilter("broken"); err == nil {
+		t.Error("broken: expected an error")
+	}
+}
+
+func TestSortSliceAndPageOf(t *testing.T) {
+	type item struct {
+		name  string
+		price int
+	}
+	items := []item{{"b", 2}, {"a", 2}, {"c", 1}, {"d", 3}}
+	compare := map[string]func(a, b item) int{
+		"name":  func(a, b item) int { return strings.Compare(a.name, b.name) },
+		"price": func(a, b item) int { return a.price - b.price },
+	}
+
+	SortSlice(items, ListQuery{Sort: []SortField{{Field: "price", Desc: true}, {Field: "name"}}}, compare)
+	var names []string
+	for _, it := range items {
+		names = append(names, it.name)
+	}
+	if got := strings.Join(names, ""); got != "dabc" {
+		t.Errorf("sorted %s, want dabc", got)
+	}
+
+	if page := PageOf(items, ListQuery{Page: 2, PerPage: 3}); len(page) != 1 || page[0].name != "c" {
+		t.Errorf("page 2 = %v", page)
+	}
+	if page := PageOf(items, ListQuery{Page: 5, PerPage: 3}); len(page) != 0 {
+		t.Errorf("page past the end = %v", page)
+	}
+}
+
+func TestList(t *testing.T) {
+	rec := httptest.NewRecorder()
+	q := ListQuery{Page: 2, PerPage: 10, Sort: []SortField{{Field: "created_at", Desc: true}}, Filters: map[string]string{"status": "dead"}}
+	if err := List(rec, []string{"x"}, q, 21); err != nil {
+		t.Fatal(err)
+	}
+
+	var resp struct {
+		Status string   `json:"status"`
+		Data   []string `json:"data"`
+		Meta   Metadata `json:"meta"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	want := Metadata{Page: 2, PerPage: 10, Total: 21, TotalPages: 3, Sort: "-created_at"}
+	if resp.Status != "success" || len(resp.Data) != 1 || resp.Meta.Filters["status"] != "dead" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	resp.Meta.Filters = nil
+	if resp.Meta.Page != want.Page || resp.Meta.PerPage != want.PerPage || resp.Meta.Total != want.Total ||
+		resp.Meta.TotalPages != want.TotalPages || resp.Meta.Sort != want.Sort {
+		t.Errorf("meta = %+v, want %+v", resp.Meta, want)
+	}
+}
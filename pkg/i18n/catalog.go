@@ -0,0 +1,511 @@
+package i18n
+
+// Message keys used by owner notifications and outbound webhooks
+const (
+	KeyUsernameChanged        = "account.username_changed"
+	KeyEmailVerification      = "account.email_verification"
+	KeyEmailChangeRequested   = "account.email_change_requested"
+	KeyAccountDeletionPending = "account.deletion_scheduled"
+	KeyAccountDeleted         = "account.deleted"
+	KeyPasswordReset          = "account.password_reset"
+	KeyPasswordChanged        = "account.password_changed"
+	KeyWelcome                = "account.welcome"
+	KeyWeeklyDigest           = "analytics.weekly_digest"
+	KeyNotificationDigest     = "account.notification_digest"
+	KeyStaffInvitation        = "staff.invitation"
+	KeyIdentityLinked         = "account.identity_linked"
+	KeyTrialEnding            = "billing.trial_ending"
+	KeyTrialExpired           = "billing.trial_expired"
+	KeyMenuActivated          = "menu.activated"
+	KeyItemLowStock           = "inventory.low_stock"
+	KeyItemSoldOut            = "inventory.sold_out"
+	KeyPromotionActive        = "promotion.active"
+	KeyVoucherPurchased       = "voucher.purchased"
+	KeyOrderConfirmed         = "order.confirmed"
+	KeyOrderReady             = "order.ready"
+	KeyOrderCancelled         = "order.cancelled"
+	KeyWhatsAppSubscribed     = "whatsapp.subscribed"
+	KeyWhatsAppUnsubscribed   = "whatsapp.unsubscribed"
+	KeyTelegramLinked         = "telegram.linked"
+	KeyTelegramHelp           = "telegram.help"
+	KeyTelegramUnlinked       = "telegram.unlinked"
+	KeyTelegramInvalidLink    = "telegram.invalid_link"
+	KeyTelegramNotLinked      = "telegram.not_linked"
+	KeyTelegramForbidden      = "telegram.forbidden"
+	KeyTelegramNewOrder       = "telegram.new_order"
+	KeyTelegramDailySummary   = "telegram.daily_summary"
+	KeyTelegramItems          = "telegram.items"
+	KeyTelegramItemAvailable  = "telegram.item_available"
+	KeyTelegramItemSoldOut    = "telegram.item_sold_out"
+	KeyChatTest               = "chat.test"
+)
+
+// SMSKey returns the key of the short text-message version of a message. Messages without
+// one are sent by SMS as subject and body, truncated
+func SMSKey(key string) string {
+	return "sms." + key
+}
+
+// WebhookKey returns the message key of the human-readable summary attached to a webhook event
+func WebhookKey(eventType string) string {
+	return "webhook." + eventType
+}
+
+// ChatKey returns the message key of the notification of an event posted to Slack or Discord:
+// the subject is the title of the message, the body its text
+func ChatKey(eventType string) string {
+	return "chat." + eventType
+}
+
+// builtinDateFormats holds the date layout used in messages for each language
+var builtinDateFormats = map[string]string{
+	"it": "02/01/2006",
+	"en": "January 2, 2006",
+	"es": "02/01/2006",
+	"fr": "02/01/2006",
+	"de": "02.01.2006",
+	"pt": "02/01/2006",
+}
+
+// builtinCatalogs contains the shipped translations. Italian is complete because it is
+// the default language; other languages fall back to it key by key
+var builtinCatalogs = map[string]map[string]Template{
+	"it": {
+		KeyUsernameChanged: {
+			Subject: "Username modificato",
+			Body:    "Lo username del tuo account QR Menu è stato cambiato da {{.OldUsername}} a {{.NewUsername}}. Se non sei stato tu, contatta subito il supporto.",
+		},
+		KeyEmailVerification: {
+			Subject: "Conferma il nuovo indirizzo email",
+			Body:    "Per confermare il nuovo indirizzo email del tuo account QR Menu apri questo link entro 24 ore:\n\n{{.VerifyURL}}",
+		},
+		KeyEmailChangeRequested: {
+			Subject: "Richiesta di cambio email",
+			Body:    "È stato richiesto il cambio dell'email del tuo account QR Menu. Se non sei stato tu, cambia subito la password.",
+		},
+		KeyAccountDeletionPending: {
+			Subject: "Il tuo account QR Menu è stato chiuso",
+			Body: "Abbiamo chiuso il tuo account QR Menu e disattivato i menu pubblici. " +
+				"I tuoi dati saranno eliminati definitivamente il {{date .ScheduledAt}}. " +
+				"Se hai cambiato idea contatta il supporto prima di questa data.",
+		},
+		KeyAccountDeleted: {
+			Subject: "I tuoi dati QR Menu sono stati eliminati",
+			Body:    "Come richiesto, tutti i dati del tuo account QR Menu sono stati eliminati definitivamente.",
+		},
+		KeyPasswordReset: {
+			Subject: "Reimposta la password",
+			Body: "Per scegliere una nuova password del tuo account QR Menu apri questo link entro un'ora:\n\n{{.ResetURL}}\n\n" +
+				"Se non hai richiesto il reset puoi ignorare questa email: la password attuale resta valida.",
+		},
+		KeyPasswordChanged: {
+			Subject: "Password modificata",
+			Body:    "La password del tuo account QR Menu è stata reimpostata e tutte le sessioni aperte sono state chiuse. Se non sei stato tu, contatta subito il supporto.",
+		},
+		KeyWelcome: {
+			Subject: "Benvenuto in QR Menu",
+			Body: "Ciao {{.Username}}, il tuo account QR Menu e il ristorante {{.RestaurantName}} sono pronti.\n\n" +
+				"Accedi per creare il primo menu e stampare il QR code: {{.LoginURL}}",
+		},
+		KeyWeeklyDigest: {
+			Subject: "{{.RestaurantName}}: riepilogo della settimana",
+			Body: "Dal {{date .From}} al {{date .To}} il menu di {{.RestaurantName}} ha ricevuto " +
+				"{{.Views}} visite (settimana precedente: {{.PreviousViews}}) e {{.QRScans}} scansioni del QR code " +
+				"(settimana precedente: {{.PreviousScans}}).\n\nStatistiche complete: {{.AnalyticsURL}}",
+		},
+		KeyNotificationDigest: {
+			Subject: "{{.Count}} nuove notifiche da QR Menu",
+			Body:    "{{range .Items}}• {{.Subject}}\n{{.Body}}\n\n{{end}}",
+		},
+		KeyStaffInvitation: {
+			Subject: "Invito allo staff di {{.RestaurantName}}",
+			Body: "{{.InviterName}} ti ha invitato a gestire {{.RestaurantName}} su QR Menu con il ruolo {{.Role}}.\n\n" +
+				"Per accettare apri questo link entro 7 giorni:\n\n{{.AcceptURL}}",
+		},
+		KeyIdentityLinked: {
+			Subject: "Accesso con {{.Provider}} collegato",
+			Body:    "Da ora puoi accedere al tuo account QR Menu anche con {{.Provider}} ({{.Email}}). Se non sei stato tu, scollega l'accesso dalla pagina account e cambia la password.",
+		},
+		KeyTrialEnding: {
+			Subject: "La prova gratuita di {{.RestaurantName}} scade il {{date .TrialEndsAt}}",
+			Body: "La prova gratuita del piano {{.PlanID}} per {{.RestaurantName}} scade il {{date .TrialEndsAt}}. " +
+				"Per non perdere le funzioni del piano attiva un abbonamento: {{.AccountURL}}",
+		},
+		KeyTrialExpired: {
+			Subject: "La prova gratuita di {{.RestaurantName}} è terminata",
+			Body: "La prova gratuita del piano {{.PlanID}} per {{.RestaurantName}} è terminata e il ristorante è passato al piano gratuito. " +
+				"I menu restano online; per tornare al piano {{.PlanID}} attiva un abbonamento: {{.AccountURL}}",
+		},
+		KeyMenuActivated: {
+			Subject: "{{.ActorName}} ha attivato il menu {{.MenuName}}",
+			Body:    "Il {{date .OccurredAt}} {{.ActorName}} ha attivato il menu {{.MenuName}} di {{.RestaurantName}}: è quello mostrato ora a chi scansiona il QR code. Gestisci i menu: {{.AdminURL}}",
+		},
+		KeyItemLowStock: {
+			Subject: "Scorta bassa: {{.ItemName}}",
+			Body:    "Restano {{.Quantity}} porzioni di {{.ItemName}} nel menu {{.MenuName}} di {{.RestaurantName}} (soglia {{.Threshold}}). Aggiorna la giacenza: {{.AdminURL}}",
+		},
+		KeyItemSoldOut: {
+			Subject: "{{.ItemName}} è esaurito",
+			Body:    "{{.ItemName}} del menu {{.MenuName}} di {{.RestaurantName}} è esaurito e non è più ordinabile. Tornerà disponibile con il prossimo rifornimento: {{.AdminURL}}",
+		},
+		KeyPromotionActive: {
+			Subject: "La promozione {{.Title}} è attiva",
+			Body:    "Da {{date .StartsAt}} la promozione {{.Title}} è in evidenza nel menu pubblico di {{.RestaurantName}}, fino al {{date .EndsAt}}. Gestisci le promozioni: {{.AdminURL}}",
+		},
+		KeyVoucherPurchased: {
+			Subject: "Il tuo buono regalo per {{.RestaurantName}}",
+			Body:    "Grazie per l'acquisto! Il buono regalo da {{.Amount}} per {{.RestaurantName}} ha il codice {{.Code}} ed è valido fino al {{date .ExpiresAt}}. Mostralo alla cassa o inseriscilo al momento dell'ordine: {{.VoucherURL}}",
+		},
+		KeyOrderConfirmed: {
+			Subject: "Ordine n. {{.Number}} ricevuto da {{.RestaurantName}}",
+			Body: "Grazie {{.CustomerName}}! {{.RestaurantName}} ha ricevuto il tuo ordine n. {{.Number}} da {{.Total}}" +
+				"{{if eq .Mode \"delivery\"}}, in consegna{{else if eq .Mode \"takeaway\"}}, da ritirare{{else}}, al tavolo{{end}} il {{date .Slot}} alle {{.SlotTime}}. " +
+				"Segui lo stato dell'ordine: {{.TrackingURL}}",
+		},
+		KeyOrderReady: {
+			Subject: "Il tuo ordine n. {{.Number}} è pronto",
+			Body: "Il tuo ordine n. {{.Number}} da {{.RestaurantName}} è pronto" +
+				"{{if eq .Mode \"delivery\"}} e sta per partire per la consegna{{else if eq .Mode \"takeaway\"}} per il ritiro{{else}}: ti aspettiamo al tavolo{{end}}. " +
+				"Stato dell'ordine: {{.TrackingURL}}",
+		},
+		KeyOrderCancelled: {
+			Subject: "Il tuo ordine n. {{.Number}} è stato annullato",
+			Body:    "{{.RestaurantName}} ha annullato il tuo ordine n. {{.Number}} del {{date .Slot}}. Per informazioni contatta il ristorante{{if .RestaurantPhone}} al {{.RestaurantPhone}}{{end}}.",
+		},
+		SMSKey(KeyNotificationDigest): {
+			Body: "QR Menu: {{.Count}} nuove notifiche.{{range .Items}} • {{.Subject}}{{end}}",
+		},
+		SMSKey(KeyOrderConfirmed): {
+			Body: "{{.RestaurantName}}: ordine n. {{.Number}} confermato per il {{date .Slot}} alle {{.SlotTime}}. Stato: {{.TrackingURL}}",
+		},
+		SMSKey(KeyOrderReady): {
+			Body: "{{.RestaurantName}}: il tuo ordine n. {{.Number}} è pronto{{if eq .Mode \"delivery\"}} e sta per partire{{end}}. Stato: {{.TrackingURL}}",
+		},
+		SMSKey(KeyOrderCancelled): {
+			Body: "{{.RestaurantName}}: il tuo ordine n. {{.Number}} è stato annullato.{{if .RestaurantPhone}} Info: {{.RestaurantPhone}}{{end}}",
+		},
+		KeyWhatsAppSubscribed: {
+			Body: "Ciao! Da ora riceverai qui il menu del giorno di {{.RestaurantName}}. Il menu completo: {{.MenuURL}}\n\nScrivi STOP per non riceverlo più.",
+		},
+		KeyWhatsAppUnsubscribed: {
+			Body: "Non riceverai più il menu del giorno di {{.RestaurantName}}. Scrivi MENU per iscriverti di nuovo.",
+		},
+		KeyTelegramLinked: {
+			Body: "Chat collegata a {{.RestaurantName}}. Qui riceverai i nuovi ordini e, se lo attivi dal pannello, il riepilogo della giornata.\n\nScrivi /help per i comandi.",
+		},
+		KeyTelegramHelp: {
+			Body: "Comandi di {{.RestaurantName}}:\n/piatti - segna i piatti del menu attivo come disponibili o esauriti\n/oggi - visite, scansioni e ordini di oggi\n/stop - scollega questa chat",
+		},
+		KeyTelegramUnlinked: {
+			Body: "Chat scollegata da {{.RestaurantName}}: non riceverai più messaggi.",
+		},
+		KeyTelegramInvalidLink: {
+			Body: "Il link di collegamento non è valido o è scaduto. Generane uno nuovo dal pannello di QR Menu.",
+		},
+		KeyTelegramNotLinked: {
+			Body: "Questa chat non è collegata a nessun ristorante. Apri il link di collegamento dal pannello di QR Menu.",
+		},
+		KeyTelegramForbidden: {
+			Body: "Non hai più i permessi per questa operazione su {{.RestaurantName}}.",
+		},
+		KeyTelegramNewOrder: {
+			Body: "🧾 Nuovo ordine n. {{.Number}}{{if .Table}} · tavolo {{.Table}}{{end}}" +
+				"{{if eq .Mode \"delivery\"}} · consegna il {{date .Slot}} alle {{.SlotTime}}{{else if eq .Mode \"takeaway\"}} · ritiro il {{date .Slot}} alle {{.SlotTime}}{{end}}\n" +
+				"{{range .Lines}}{{.Quantity}}× {{.Name}}{{if .Notes}} ({{.Notes}}){{end}}\n{{end}}Totale: {{.Total}}",
+		},
+		KeyTelegramDailySummary: {
+			Body: "📊 {{.RestaurantName}}, {{date .Day}}\nVisite al menu: {{.Views}}\nScansioni QR: {{.QRScans}}\nOrdini: {{.Orders}}{{if .Orders}} per {{.Revenue}}{{end}}",
+		},
+		KeyTelegramItems: {
+			Body: "{{if .MenuName}}Piatti di {{.MenuName}}: tocca un piatto per segnarlo come disponibile ✅ o esaurito ❌.{{if .Truncated}} Sono mostrati i primi {{.Shown}}.{{end}}{{else}}Non c'è un menu attivo.{{end}}",
+		},
+		KeyTelegramItemAvailable: {
+			Body: "{{.Name}} è di nuovo disponibile",
+		},
+		KeyTelegramItemSoldOut: {
+			Body: "{{.Name}} è segnato come esaurito",
+		},
+		ChatKey("order.created"): {
+			Subject: "🧾 Nuovo ordine n. {{.Number}}{{if .Table}} · tavolo {{.Table}}{{end}}",
+			Body: "{{if eq .Mode \"delivery\"}}Consegna il {{date .Slot}} alle {{.SlotTime}}\n{{else if eq .Mode \"takeaway\"}}Ritiro il {{date .Slot}} alle {{.SlotTime}}\n{{end}}" +
+				"{{range .Lines}}{{.Quantity}}× {{.Name}}{{if .Notes}} ({{.Notes}}){{end}}\n{{end}}Totale: {{.Total}}",
+		},
+		ChatKey("item.low_stock"): {
+			Subject: "Scorta bassa: {{.ItemName}}",
+			Body:    "Restano {{.Quantity}} porzioni di {{.ItemName}} nel menu {{.MenuName}} (soglia {{.Threshold}}).",
+		},
+		ChatKey("item.sold_out"): {
+			Subject: "Piatto esaurito: {{.ItemName}}",
+			Body:    "{{.ItemName}} del menu {{.MenuName}} è esaurito e non è più ordinabile. Aggiorna la giacenza dal pannello per renderlo di nuovo disponibile.",
+		},
+		ChatKey("backup.failed"): {
+			Subject: "Backup non riuscito",
+			Body:    "Il backup {{.BackupID}} dei dati di {{.RestaurantName}} non è riuscito: {{.Error}}",
+		},
+		KeyChatTest: {
+			Subject: "Notifiche di QR Menu collegate",
+			Body:    "Da ora {{.Name}} riceverà qui le notifiche di {{.RestaurantName}}.",
+		},
+		WebhookKey("menu.created"): {
+			Body: "È stato creato il menu {{.name}}.",
+		},
+		WebhookKey("menu.updated"): {
+			Body: "Il menu {{.name}} è stato modificato.",
+		},
+		WebhookKey("menu.activated"): {
+			Body: "Il menu {{.name}} è ora attivo.",
+		},
+		WebhookKey("item.updated"): {
+			Body: "{{if eq .change \"created\"}}Aggiunto{{else if eq .change \"deleted\"}}Eliminato{{else}}Modificato{{end}} il piatto {{.name}}.",
+		},
+		WebhookKey("item.low_stock"): {
+			Body: "Scorta bassa per il piatto {{.name}}: restano {{.quantity}} porzioni.",
+		},
+		WebhookKey("item.sold_out"): {
+			Body: "Il piatto {{.name}} è esaurito.",
+		},
+		WebhookKey("order.created"): {
+			Body: "Nuovo ordine n. {{.number}}{{if .table}} al tavolo {{.table}}{{end}}.",
+		},
+		WebhookKey("order.updated"): {
+			Body: "Ordine n. {{.number}} aggiornato: {{.status}}.",
+		},
+		WebhookKey("feedback.received"): {
+			Body: "Nuovo feedback da {{.rating}} stelle{{if .comment}}: {{.comment}}{{end}}.",
+		},
+		WebhookKey("promotion.active"): {
+			Body: "La promozione {{.title}} è ora in evidenza nel menu.",
+		},
+		WebhookKey("qr.scanned"): {
+			Body: "Il QR code del ristorante è stato scansionato.",
+		},
+		WebhookKey("webhook.test"): {
+			Body: "Evento di prova del webhook {{.webhook_id}}.",
+		},
+		WebhookKey("billing.subscription.updated"): {
+			Body: "L'abbonamento è stato aggiornato al piano {{.plan_id}} (stato: {{.status}}).",
+		},
+		WebhookKey("billing.subscription.canceled"): {
+			Body: "L'abbonamento è stato annullato.",
+		},
+	},
+	"en": {
+		KeyUsernameChanged: {
+			Subject: "Username changed",
+			Body:    "The username of your QR Menu account was changed from {{.OldUsername}} to {{.NewUsername}}. If this wasn't you, contact support immediately.",
+		},
+		KeyEmailVerification: {
+			Subject: "Confirm your new email address",
+			Body:    "To confirm the new email address of your QR Menu account, open this link within 24 hours:\n\n{{.VerifyURL}}",
+		},
+		KeyEmailChangeRequested: {
+			Subject: "Email change requested",
+			Body:    "A change of the email address of your QR Menu account was requested. If this wasn't you, change your password immediately.",
+		},
+		KeyAccountDeletionPending: {
+			Subject: "Your QR Menu account has been closed",
+			Body: "We closed your QR Menu account and disabled your public menus. " +
+				"Your data will be permanently deleted on {{date .ScheduledAt}}. " +
+				"If you changed your mind, contact support before that date.",
+		},
+		KeyAccountDeleted: {
+			Subject: "Your QR Menu data has been deleted",
+			Body:    "As requested, all the data of your QR Menu account has been permanently deleted.",
+		},
+		KeyPasswordReset: {
+			Subject: "Reset your password",
+			Body: "To choose a new password for your QR Menu account, open this link within one hour:\n\n{{.ResetURL}}\n\n" +
+				"If you didn't request a reset you can ignore this email: your current password still works.",
+		},
+		KeyPasswordChanged: {
+			Subject: "Password changed",
+			Body:    "The password of your QR Menu account was reset and all open sessions were signed out. If this wasn't you, contact support immediately.",
+		},
+		KeyWelcome: {
+			Subject: "Welcome to QR Menu",
+			Body: "Hi {{.Username}}, your QR Menu account and the restaurant {{.RestaurantName}} are ready.\n\n" +
+				"Sign in to create your first menu and print its QR code: {{.LoginURL}}",
+		},
+		KeyWeeklyDigest: {
+			Subject: "{{.RestaurantName}}: your week in review",
+			Body: "From {{date .From}} to {{date .To}} the menu of {{.RestaurantName}} received " +
+				"{{.Views}} views (previous week: {{.PreviousViews}}) and {{.QRScans}} QR code scans " +
+				"(previous week: {{.PreviousScans}}).\n\nFull statistics: {{.AnalyticsURL}}",
+		},
+		KeyNotificationDigest: {
+			Subject: "{{.Count}} new notifications from QR Menu",
+			Body:    "{{range .Items}}• {{.Subject}}\n{{.Body}}\n\n{{end}}",
+		},
+		KeyStaffInvitation: {
+			Subject: "Invitation to the {{.RestaurantName}} staff",
+			Body: "{{.InviterName}} invited you to manage {{.RestaurantName}} on QR Menu with the {{.Role}} role.\n\n" +
+				"To accept, open this link within 7 days:\n\n{{.AcceptURL}}",
+		},
+		KeyIdentityLinked: {
+			Subject: "Sign in with {{.Provider}} linked",
+			Body:    "You can now sign in to your QR Menu account with {{.Provider}} ({{.Email}}) as well. If this wasn't you, unlink it from the account page and change your password.",
+		},
+		KeyTrialEnding: {
+			Subject: "The free trial of {{.RestaurantName}} ends on {{date .TrialEndsAt}}",
+			Body: "The free trial of the {{.PlanID}} plan for {{.RestaurantName}} ends on {{date .TrialEndsAt}}. " +
+				"To keep the features of the plan, start a subscription: {{.AccountURL}}",
+		},
+		KeyTrialExpired: {
+			Subject: "The free trial of {{.RestaurantName}} has ended",
+			Body: "The free trial of the {{.PlanID}} plan for {{.RestaurantName}} has ended and the restaurant moved to the free plan. " +
+				"Your menus stay online; to go back to the {{.PlanID}} plan, start a subscription: {{.AccountURL}}",
+		},
+		KeyMenuActivated: {
+			Subject: "{{.ActorName}} activated the menu {{.MenuName}}",
+			Body:    "On {{date .OccurredAt}} {{.ActorName}} activated the menu {{.MenuName}} of {{.RestaurantName}}: it is the one now shown to whoever scans the QR code. Manage your menus: {{.AdminURL}}",
+		},
+		KeyItemLowStock: {
+			Subject: "Low stock: {{.ItemName}}",
+			Body:    "Only {{.Quantity}} portions of {{.ItemName}} are left in the menu {{.MenuName}} of {{.RestaurantName}} (threshold {{.Threshold}}). Update the stock: {{.AdminURL}}",
+		},
+		KeyItemSoldOut: {
+			Subject: "{{.ItemName}} is sold out",
+			Body:    "{{.ItemName}} in the menu {{.MenuName}} of {{.RestaurantName}} is sold out and can no longer be ordered. It becomes available again with the next restock: {{.AdminURL}}",
+		},
+		KeyPromotionActive: {
+			Subject: "The promotion {{.Title}} is live",
+			Body:    "Since {{date .StartsAt}} the promotion {{.Title}} is featured in the public menu of {{.RestaurantName}}, until {{date .EndsAt}}. Manage your promotions: {{.AdminURL}}",
+		},
+		KeyVoucherPurchased: {
+			Subject: "Your gift voucher for {{.RestaurantName}}",
+			Body:    "Thank you for your purchase! The {{.Amount}} gift voucher for {{.RestaurantName}} has the code {{.Code}} and is valid until {{date .ExpiresAt}}. Show it at the till or enter it when ordering: {{.VoucherURL}}",
+		},
+		KeyOrderConfirmed: {
+			Subject: "Order no. {{.Number}} received by {{.RestaurantName}}",
+			Body: "Thank you {{.CustomerName}}! {{.RestaurantName}} received your order no. {{.Number}} of {{.Total}}" +
+				"{{if eq .Mode \"delivery\"}}, to be delivered{{else if eq .Mode \"takeaway\"}}, to be picked up{{else}}, served at your table{{end}} on {{date .Slot}} at {{.SlotTime}}. " +
+				"Follow your order: {{.TrackingURL}}",
+		},
+		KeyOrderReady: {
+			Subject: "Your order no. {{.Number}} is ready",
+			Body: "Your order no. {{.Number}} from {{.RestaurantName}} is ready" +
+				"{{if eq .Mode \"delivery\"}} and about to leave for delivery{{else if eq .Mode \"takeaway\"}} to be picked up{{else}}: your table is waiting for you{{end}}. " +
+				"Order status: {{.TrackingURL}}",
+		},
+		KeyOrderCancelled: {
+			Subject: "Your order no. {{.Number}} was cancelled",
+			Body:    "{{.RestaurantName}} cancelled your order no. {{.Number}} of {{date .Slot}}. For information please contact the restaurant{{if .RestaurantPhone}} at {{.RestaurantPhone}}{{end}}.",
+		},
+		SMSKey(KeyNotificationDigest): {
+			Body: "QR Menu: {{.Count}} new notifications.{{range .Items}} • {{.Subject}}{{end}}",
+		},
+		SMSKey(KeyOrderConfirmed): {
+			Body: "{{.RestaurantName}}: order no. {{.Number}} confirmed for {{date .Slot}} at {{.SlotTime}}. Status: {{.TrackingURL}}",
+		},
+		SMSKey(KeyOrderReady): {
+			Body: "{{.RestaurantName}}: your order no. {{.Number}} is ready{{if eq .Mode \"delivery\"}} and about to leave{{end}}. Status: {{.TrackingURL}}",
+		},
+		SMSKey(KeyOrderCancelled): {
+			Body: "{{.RestaurantName}}: your order no. {{.Number}} was cancelled.{{if .RestaurantPhone}} Info: {{.RestaurantPhone}}{{end}}",
+		},
+		KeyWhatsAppSubscribed: {
+			Body: "Hi! From now on you will get the daily menu of {{.RestaurantName}} here. The full menu: {{.MenuURL}}\n\nReply STOP to unsubscribe.",
+		},
+		KeyWhatsAppUnsubscribed: {
+			Body: "You will no longer get the daily menu of {{.RestaurantName}}. Reply MENU to subscribe again.",
+		},
+		KeyTelegramLinked: {
+			Body: "Chat linked to {{.RestaurantName}}. You will get new orders here and, if you turn it on in the dashboard, the summary of the day.\n\nSend /help for the commands.",
+		},
+		KeyTelegramHelp: {
+			Body: "Commands for {{.RestaurantName}}:\n/items - mark the items of the active menu as available or sold out\n/today - today's views, scans and orders\n/stop - unlink this chat",
+		},
+		KeyTelegramUnlinked: {
+			Body: "Chat unlinked from {{.RestaurantName}}: you will no longer get messages.",
+		},
+		KeyTelegramInvalidLink: {
+			Body: "The link is invalid or has expired. Create a new one from the QR Menu dashboard.",
+		},
+		KeyTelegramNotLinked: {
+			Body: "This chat is not linked to any restaurant. Open the link from the QR Menu dashboard.",
+		},
+		KeyTelegramForbidden: {
+			Body: "You are no longer allowed to do this for {{.RestaurantName}}.",
+		},
+		KeyTelegramNewOrder: {
+			Body: "🧾 New order no. {{.Number}}{{if .Table}} · table {{.Table}}{{end}}" +
+				"{{if eq .Mode \"delivery\"}} · delivery on {{date .Slot}} at {{.SlotTime}}{{else if eq .Mode \"takeaway\"}} · pickup on {{date .Slot}} at {{.SlotTime}}{{end}}\n" +
+				"{{range .Lines}}{{.Quantity}}× {{.Name}}{{if .Notes}} ({{.Notes}}){{end}}\n{{end}}Total: {{.Total}}",
+		},
+		KeyTelegramDailySummary: {
+			Body: "📊 {{.RestaurantName}}, {{date .Day}}\nMenu views: {{.Views}}\nQR scans: {{.QRScans}}\nOrders: {{.Orders}}{{if .Orders}} for {{.Revenue}}{{end}}",
+		},
+		KeyTelegramItems: {
+			Body: "{{if .MenuName}}Items of {{.MenuName}}: tap an item to mark it as available ✅ or sold out ❌.{{if .Truncated}} Showing the first {{.Shown}}.{{end}}{{else}}There is no active menu.{{end}}",
+		},
+		KeyTelegramItemAvailable: {
+			Body: "{{.Name}} is available again",
+		},
+		KeyTelegramItemSoldOut: {
+			Body: "{{.Name}} is marked as sold out",
+		},
+		ChatKey("order.created"): {
+			Subject: "🧾 New order no. {{.Number}}{{if .Table}} · table {{.Table}}{{end}}",
+			Body: "{{if eq .Mode \"delivery\"}}Delivery on {{date .Slot}} at {{.SlotTime}}\n{{else if eq .Mode \"takeaway\"}}Pickup on {{date .Slot}} at {{.SlotTime}}\n{{end}}" +
+				"{{range .Lines}}{{.Quantity}}× {{.Name}}{{if .Notes}} ({{.Notes}}){{end}}\n{{end}}Total: {{.Total}}",
+		},
+		ChatKey("item.low_stock"): {
+			Subject: "Low stock: {{.ItemName}}",
+			Body:    "{{.Quantity}} portions of {{.ItemName}} left in the menu {{.MenuName}} (threshold {{.Threshold}}).",
+		},
+		ChatKey("item.sold_out"): {
+			Subject: "Sold out: {{.ItemName}}",
+			Body:    "{{.ItemName}} in the menu {{.MenuName}} is sold out and can no longer be ordered. Update the stock from the dashboard to make it available again.",
+		},
+		ChatKey("backup.failed"): {
+			Subject: "Backup failed",
+			Body:    "The backup {{.BackupID}} of the data of {{.RestaurantName}} failed: {{.Error}}",
+		},
+		KeyChatTest: {
+			Subject: "QR Menu notifications connected",
+			Body:    "From now on {{.Name}} will receive the notifications of {{.RestaurantName}} here.",
+		},
+		WebhookKey("menu.created"): {
+			Body: "The menu {{.name}} was created.",
+		},
+		WebhookKey("menu.updated"): {
+			Body: "The menu {{.name}} was updated.",
+		},
+		WebhookKey("menu.activated"): {
+			Body: "The menu {{.name}} is now active.",
+		},
+		WebhookKey("item.updated"): {
+			Body: "{{if eq .change \"created\"}}Added{{else if eq .change \"deleted\"}}Deleted{{else}}Updated{{end}} the dish {{.name}}.",
+		},
+		WebhookKey("item.low_stock"): {
+			Body: "Low stock for the dish {{.name}}: {{.quantity}} portions left.",
+		},
+		WebhookKey("item.sold_out"): {
+			Body: "The dish {{.name}} is sold out.",
+		},
+		WebhookKey("order.created"): {
+			Body: "New order no. {{.number}}{{if .table}} at table {{.table}}{{end}}.",
+		},
+		WebhookKey("order.updated"): {
+			Body: "Order no. {{.number}} updated: {{.status}}.",
+		},
+		WebhookKey("feedback.received"): {
+			Body: "New {{.rating}}-star feedback{{if .comment}}: {{.comment}}{{end}}.",
+		},
+		WebhookKey("promotion.active"): {
+			Body: "The promotion {{.title}} is now featured in the menu.",
+		},
+		WebhookKey("qr.scanned"): {
+			Body: "The QR code of the restaurant was scanned.",
+		},
+		WebhookKey("webhook.test"): {
+			Body: "Test event for webhook {{.webhook_id}}.",
+		},
+		WebhookKey("billing.subscription.updated"): {
+			Body: "The subscription was updated to the {{.plan_id}} plan (status: {{.status}}).",
+		},
+		WebhookKey("billing.subscription.canceled"): {
+			Body: "The subscription was canceled.",
+		},
+	},
+}
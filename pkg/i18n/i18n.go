@@ -0,0 +1,236 @@
+package i18n
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"qr-menu/pkg/config"
+)
+
+// Template is a localizable message: Subject is optional (webhook summaries only have a body)
+type Template struct {
+	Subject string
+	Body    string
+}
+
+// Message is a template rendered for a specific locale
+type Message struct {
+	Locale  string `json:"locale"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body"`
+}
+
+// Manager resolves locales and renders message templates with a fallback to the default language
+type Manager struct {
+	mu          sync.RWMutex
+	defaultLang string
+	supported   map[string]bool
+	dateFormats map[string]string
+	catalogs    map[string]map[string]Template
+	parsed      map[string]*template.Template
+}
+
+var (
+	defaultManager   *Manager
+	defaultManagerMu sync.RWMutex
+)
+
+// Default returns the process-wide manager, created from the default configuration on first use
+func Default() *Manager {
+	defaultManagerMu.RLock()
+	m := defaultManager
+	defaultManagerMu.RUnlock()
+	if m != nil {
+		return m
+	}
+
+	defaultManagerMu.Lock()
+	defer defaultManagerMu.Unlock()
+	if defaultManager == nil {
+		defaultManager = NewManager(config.Default().Localization)
+	}
+	return defaultManager
+}
+
+// SetDefault replaces the process-wide manager
+func SetDefault(m *Manager) {
+	defaultManagerMu.Lock()
+	defaultManager = m
+	defaultManagerMu.Unlock()
+}
+
+// NewManager creates a manager loaded with the built-in catalogs
+func NewManager(cfg config.LocalizationConfig) *Manager {
+	m := &Manager{
+		defaultLang: normalize(cfg.DefaultLanguage),
+		supported:   make(map[string]bool),
+		dateFormats: make(map[string]string),
+		catalogs:    make(map[string]map[string]Template),
+		parsed:      make(map[string]*template.Template),
+	}
+	if m.defaultLang == "" {
+		m.defaultLang = "it"
+	}
+	for _, lang := range cfg.SupportedLanguages {
+		m.supported[normalize(lang)] = true
+	}
+	m.supported[m.defaultLang] = true
+
+	for lang, layout := range builtinDateFormats {
+		m.dateFormats[lang] = layout
+	}
+	if cfg.DateFormat != "" {
+		if _, ok := m.dateFormats[m.defaultLang]; !ok {
+			m.dateFormats[m.defaultLang] = cfg.DateFormat
+		}
+	}
+
+	for lang, catalog := range builtinCatalogs {
+		for key, tmpl := range catalog {
+			m.Register(lang, key, tmpl)
+		}
+	}
+	return m
+}
+
+// DefaultLanguage returns the fallback language
+func (m *Manager) DefaultLanguage() string {
+	return m.defaultLang
+}
+
+// Register adds or replaces a template in the catalog of a language
+func (m *Manager) Register(lang, key string, tmpl Template) {
+	lang = normalize(lang)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.catalogs[lang] == nil {
+		m.catalogs[lang] = make(map[string]Template)
+	}
+	m.catalogs[lang][key] = tmpl
+	delete(m.parsed, lang+"/"+key+"/subject")
+	delete(m.parsed, lang+"/"+key+"/body")
+}
+
+// Resolve maps a locale such as "en-US" or "it_IT" to a supported language,
+// falling back to the default language
+func (m *Manager) Resolve(locale string) string {
+	lang := normalize(locale)
+	if lang != "" && m.supported[lang] {
+		return lang
+	}
+	return m.defaultLang
+}
+
+// Supported reports whether locale maps to one of the configured languages
+func (m *Manager) Supported(locale string) bool {
+	lang := normalize(locale)
+	return lang != "" && m.supported[lang]
+}
+
+// Negotiate picks the first supported language from an Accept-Language header
+func (m *Manager) Negotiate(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if m.Supported(tag) {
+			return normalize(tag)
+		}
+	}
+	return m.defaultLang
+}
+
+// Render renders the template key for locale. Languages without the key fall back
+// to the default language, so a missing translation never blocks a notification
+func (m *Manager) Render(locale, key string, data interface{}) (Message, error) {
+	lang := m.Resolve(locale)
+
+	tmpl, ok := m.lookup(lang, key)
+	if !ok && lang != m.defaultLang {
+		lang = m.defaultLang
+		tmpl, ok = m.lookup(lang, key)
+	}
+	if !ok {
+		return Message{}, fmt.Errorf("i18n: unknown message %q", key)
+	}
+
+	msg := Message{Locale: lang}
+	var err error
+	if tmpl.Subject != "" {
+		if msg.Subject, err = m.execute(lang, key+"/subject", tmpl.Subject, data); err != nil {
+			return Message{}, err
+		}
+	}
+	if msg.Body, err = m.execute(lang, key+"/body", tmpl.Body, data); err != nil {
+		return Message{}, err
+	}
+	return msg, nil
+}
+
+// Has reports whether key is in the catalog of the default language, which every other
+// language falls back to
+func (m *Manager) Has(key string) bool {
+	_, ok := m.lookup(m.defaultLang, key)
+	return ok
+}
+
+// FormatDate formats a date with the conventions of locale
+func (m *Manager) FormatDate(locale string, t time.Time) string {
+	lang := m.Resolve(locale)
+	m.mu.RLock()
+	layout, ok := m.dateFormats[lang]
+	m.mu.RUnlock()
+	if !ok {
+		layout = "2006-01-02"
+	}
+	return t.Format(layout)
+}
+
+func (m *Manager) lookup(lang, key string) (Template, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	tmpl, ok := m.catalogs[lang][key]
+	return tmpl, ok
+}
+
+func (m *Manager) execute(lang, name, text string, data interface{}) (string, error) {
+	cacheKey := lang + "/" + name
+
+	m.mu.RLock()
+	t := m.parsed[cacheKey]
+	m.mu.RUnlock()
+
+	if t == nil {
+		var err error
+		t, err = template.New(cacheKey).
+			Option("missingkey=zero").
+			Funcs(template.FuncMap{
+				"date": func(v time.Time) string { return m.FormatDate(lang, v) },
+			}).
+			Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("i18n: parse %s: %w", cacheKey, err)
+		}
+		m.mu.Lock()
+		m.parsed[cacheKey] = t
+		m.mu.Unlock()
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("i18n: render %s: %w", cacheKey, err)
+	}
+	return buf.String(), nil
+}
+
+// normalize reduces a locale tag to its lowercase primary language ("en-US" -> "en")
+func normalize(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	return locale
+}
@@ -0,0 +1,157 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"qr-menu/pkg/config"
+)
+
+func newTestManager() *Manager {
+	return NewManager(config.Default().Localization)
+}
+
+// TestResolve tests locale normalization and fallback to the default language
+func TestResolve(t *testing.T) {
+	m := newTestManager()
+
+	cases := map[string]string{
+		"en":    "en",
+		"en-US": "en",
+		"it_IT": "it",
+		"EN":    "en",
+		"":      "it",
+		"xx":    "it",
+	}
+	for input, expected := range cases {
+		if got := m.Resolve(input); got != expected {
+			t.Errorf("Resolve(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+// TestNegotiate tests picking a language from an Accept-Language header
+func TestNegotiate(t *testing.T) {
+	m := newTestManager()
+
+	if got := m.Negotiate("xx-YY, en-GB;q=0.8, it;q=0.5"); got != "en" {
+		t.Errorf("Expected en, got %s", got)
+	}
+	if got := m.Negotiate(""); got != "it" {
+		t.Errorf("Expected default language, got %s", got)
+	}
+}
+
+// TestRenderLocalized tests rendering the same message in two languages
+func TestRenderLocalized(t *testing.T) {
+	m := newTestManager()
+	data := map[string]interface{}{"OldUsername": "mario", "NewUsername": "mario.rossi"}
+
+	it, err := m.Render("it", KeyUsernameChanged, data)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if it.Subject != "Username modificato" || !strings.Contains(it.Body, "da mario a mario.rossi") {
+		t.Errorf("Unexpected italian message: %+v", it)
+	}
+
+	en, err := m.Render("en-US", KeyUsernameChanged, data)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if en.Locale != "en" || en.Subject != "Username changed" || !strings.Contains(en.Body, "from mario to mario.rossi") {
+		t.Errorf("Unexpected english message: %+v", en)
+	}
+}
+
+// TestRenderFallback tests that a language without the key falls back to the default one
+func TestRenderFallback(t *testing.T) {
+	m := newTestManager()
+
+	msg, err := m.Render("de", KeyAccountDeleted, nil)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if msg.Locale != "it" || msg.Subject != "I tuoi dati QR Menu sono stati eliminati" {
+		t.Errorf("Expected italian fallback, got %+v", msg)
+	}
+
+	if _, err := m.Render("en", "missing.key", nil); err == nil {
+		t.Error("Expected error for unknown key")
+	}
+}
+
+// TestSMSVersions tests that the short versions of the messages sent by SMS exist and render
+func TestSMSVersions(t *testing.T) {
+	m := newTestManager()
+
+	if !m.Has(SMSKey(KeyOrderReady)) || m.Has(SMSKey(KeyPasswordChanged)) {
+		t.Error("Unexpected SMS versions in the catalog")
+	}
+	msg, err := m.Render("en", SMSKey(KeyOrderReady), map[string]interface{}{
+		"RestaurantName": "Trattoria", "Number": 12, "Mode": "delivery", "TrackingURL": "https://example.com/order/1",
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if msg.Body != "Trattoria: your order no. 12 is ready and about to leave. Status: https://example.com/order/1" {
+		t.Errorf("Unexpected SMS body %q", msg.Body)
+	}
+}
+
+// TestChatMessages tests that every event sent to Slack and Discord has a title and a text
+func TestChatMessages(t *testing.T) {
+	m := newTestManager()
+
+	msg, err := m.Render("en", ChatKey("item.low_stock"), map[string]interface{}{
+		"ItemName": "Tiramisù", "MenuName": "Dinner", "Quantity": 3, "Threshold": 5,
+	})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if msg.Subject != "Low stock: Tiramisù" || msg.Body != "3 portions of Tiramisù left in the menu Dinner (threshold 5)." {
+		t.Errorf("Unexpected message %+v", msg)
+	}
+	for _, key := range []string{ChatKey("order.created"), ChatKey("item.sold_out"), ChatKey("backup.failed"), KeyChatTest} {
+		for _, locale := range []string{"it", "en"} {
+			if msg, err := m.Render(locale, key, map[string]interface{}{}); err != nil || msg.Subject == "" {
+				t.Errorf("%s in %s: %+v, %v", key, locale, msg, err)
+			}
+		}
+	}
+}
+
+// TestRenderDate tests locale-specific date formatting inside templates
+func TestRenderDate(t *testing.T) {
+	m := newTestManager()
+	data := map[string]interface{}{"ScheduledAt": time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC)}
+
+	it, _ := m.Render("it", KeyAccountDeletionPending, data)
+	if !strings.Contains(it.Body, "09/03/2026") {
+		t.Errorf("Expected italian date, got %q", it.Body)
+	}
+
+	en, _ := m.Render("en", KeyAccountDeletionPending, data)
+	if !strings.Contains(en.Body, "March 9, 2026") {
+		t.Errorf("Expected english date, got %q", en.Body)
+	}
+}
+
+// TestRegister tests overriding a template at runtime
+func TestRegister(t *testing.T) {
+	m := newTestManager()
+
+	if _, err := m.Render("en", KeyAccountDeleted, nil); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	m.Register("en", KeyAccountDeleted, Template{Subject: "Bye", Body: "Deleted {{.Name}}"})
+
+	msg, err := m.Render("en", KeyAccountDeleted, map[string]interface{}{"Name": "Trattoria"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if msg.Subject != "Bye" || msg.Body != "Deleted Trattoria" {
+		t.Errorf("Expected overridden template, got %+v", msg)
+	}
+}
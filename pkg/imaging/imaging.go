@@ -0,0 +1,236 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register the WebP decoder for uploads
+)
+
+// Size defines a responsive image size, bounded by its longest side
+type Size struct {
+	Name    string
+	MaxSide int
+}
+
+// Sizes are the variants generated for every uploaded image, smallest first
+var Sizes = []Size{
+	{Name: "thumb", MaxSide: 200},
+	{Name: "medium", MaxSide: 480},
+	{Name: "full", MaxSide: 1024},
+}
+
+// Encoder encodes an image in a specific format
+type Encoder struct {
+	Format      string // file extension, e.g. "webp"
+	ContentType string
+	Encode      func(w io.Writer, img image.Image) error
+}
+
+// ModernEncoders are tried for every size on top of the JPEG/PNG fallback.
+// They are listed in order of preference; an AVIF encoder can be appended
+// here once a pure-Go implementation is available for our toolchain.
+var ModernEncoders = []Encoder{webpEncoder}
+
+var (
+	webpEncoder = Encoder{
+		Format:      "webp",
+		ContentType: "image/webp",
+		Encode: func(w io.Writer, img image.Image) error {
+			return nativewebp.Encode(w, img, nil)
+		},
+	}
+	jpegEncoder = Encoder{
+		Format:      "jpg",
+		ContentType: "image/jpeg",
+		Encode: func(w io.Writer, img image.Image) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+		},
+	}
+	pngEncoder = Encoder{
+		Format:      "png",
+		ContentType: "image/png",
+		Encode:      png.Encode,
+	}
+)
+
+// Variant is an encoded image ready to be stored
+type Variant struct {
+	Size        string
+	Format      string
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+}
+
+// Process generates all size/format variants for img.
+// The fallback format is PNG for PNG sources and JPEG otherwise. Modern
+// formats are kept only when they are smaller than the fallback.
+func Process(img image.Image, sourceFormat string) ([]Variant, error) {
+	fallback := jpegEncoder
+	if sourceFormat == "png" {
+		fallback = pngEncoder
+	}
+
+	var variants []Variant
+	for _, size := range Sizes {
+		resized := Resize(img, size.MaxSide)
+		bounds := resized.Bounds()
+
+		base, err := encode(fallback, resized)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s/%s: %w", size.Name, fallback.Format, err)
+		}
+		variants = append(variants, Variant{
+			Size:        size.Name,
+			Format:      fallback.Format,
+			ContentType: fallback.ContentType,
+			Width:       bounds.Dx(),
+			Height:      bounds.Dy(),
+			Data:        base,
+		})
+
+		for _, enc := range ModernEncoders {
+			data, err := encode(enc, resized)
+			if err != nil || len(data) >= len(base) {
+				continue
+			}
+			variants = append(variants, Variant{
+				Size:        size.Name,
+				Format:      enc.Format,
+				ContentType: enc.ContentType,
+				Width:       bounds.Dx(),
+				Height:      bounds.Dy(),
+				Data:        data,
+			})
+		}
+	}
+
+	return variants, nil
+}
+
+// MaxPixels bounds the decoded size of untrusted images, so that a small file cannot
+// expand to gigabytes of pixels
+const MaxPixels = 40_000_000
+
+// Reencode decodes a PNG, JPEG or WebP image and encodes it again in the same format, so
+// that only the pixels are kept. Other formats (SVG, GIF, HTML disguised as an image) are
+// rejected and anything appended to a valid image is dropped. The variant has no Size
+func Reencode(data []byte) (Variant, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Variant{}, fmt.Errorf("unsupported image: %w", err)
+	}
+	var enc Encoder
+	switch format {
+	case "png":
+		enc = pngEncoder
+	case "jpeg":
+		enc = jpegEncoder
+	case "webp":
+		enc = webpEncoder
+	default:
+		return Variant{}, fmt.Errorf("unsupported image format %q", format)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return Variant{}, fmt.Errorf("image of %dx%d pixels not allowed", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Variant{}, fmt.Errorf("failed to decode %s: %w", format, err)
+	}
+	out, err := encode(enc, img)
+	if err != nil {
+		return Variant{}, fmt.Errorf("failed to encode %s: %w", enc.Format, err)
+	}
+	bounds := img.Bounds()
+	return Variant{
+		Format:      enc.Format,
+		ContentType: enc.ContentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Data:        out,
+	}, nil
+}
+
+// Resize scales img down so that its longest side is at most maxSide.
+// Images already smaller than maxSide are returned unchanged.
+func Resize(img image.Image, maxSide int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSide && height <= maxSide {
+		return img
+	}
+
+	if width >= height {
+		height = height * maxSide / width
+		width = maxSide
+	} else {
+		width = width * maxSide / height
+		height = maxSide
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.BiLinear.Scale(resized, resized.Bounds(), img, bounds, draw.Over, nil)
+	return resized
+}
+
+// NegotiateFormats returns the formats to try for an Accept header, in order of preference
+func NegotiateFormats(accept string) []string {
+	var formats []string
+	for _, enc := range ModernEncoders {
+		if strings.Contains(accept, enc.ContentType) {
+			formats = append(formats, enc.Format)
+		}
+	}
+	return append(formats, jpegEncoder.Format, pngEncoder.Format)
+}
+
+// ContentTypeFor returns the MIME type of a variant format
+func ContentTypeFor(format string) string {
+	for _, enc := range ModernEncoders {
+		if enc.Format == format {
+			return enc.ContentType
+		}
+	}
+	switch format {
+	case jpegEncoder.Format:
+		return jpegEncoder.ContentType
+	case pngEncoder.Format:
+		return pngEncoder.ContentType
+	}
+	return "application/octet-stream"
+}
+
+// IsValidSize checks if name is one of the configured sizes
+func IsValidSize(name string) bool {
+	for _, size := range Sizes {
+		if size.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func encode(enc Encoder, img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,122 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	return img
+}
+
+// TestResize tests that images are bounded by their longest side
+func TestResize(t *testing.T) {
+	resized := Resize(testImage(2000, 1000), 480)
+	if resized.Bounds().Dx() != 480 || resized.Bounds().Dy() != 240 {
+		t.Errorf("Expected 480x240, got %dx%d", resized.Bounds().Dx(), resized.Bounds().Dy())
+	}
+
+	small := testImage(100, 50)
+	if Resize(small, 480) != small {
+		t.Error("Expected small images to be returned unchanged")
+	}
+}
+
+// TestProcess tests that a fallback variant exists for every size
+func TestProcess(t *testing.T) {
+	variants, err := Process(testImage(1200, 800), "jpeg")
+	if err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	fallbacks := make(map[string]bool)
+	for _, v := range variants {
+		if v.Format == "jpg" {
+			fallbacks[v.Size] = true
+		}
+		if len(v.Data) == 0 {
+			t.Errorf("Variant %s/%s is empty", v.Size, v.Format)
+		}
+	}
+
+	for _, size := range Sizes {
+		if !fallbacks[size.Name] {
+			t.Errorf("Missing jpg variant for size %s", size.Name)
+		}
+	}
+}
+
+// TestNegotiateFormats tests format selection from the Accept header
+func TestNegotiateFormats(t *testing.T) {
+	formats := NegotiateFormats("image/avif,image/webp,*/*")
+	if formats[0] != "webp" {
+		t.Errorf("Expected webp first, got %v", formats)
+	}
+
+	formats = NegotiateFormats("*/*")
+	if formats[0] != "jpg" {
+		t.Errorf("Expected jpg first for legacy browsers, got %v", formats)
+	}
+}
+
+// TestReencode tests that only PNG, JPEG and WebP images are accepted and that they are
+// encoded again from their pixels
+func TestReencode(t *testing.T) {
+	var pngData, jpegData, gifData bytes.Buffer
+	if err := png.Encode(&pngData, testImage(40, 30)); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, testImage(40, 30), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.Encode(&gifData, testImage(40, 30), nil); err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("<script>alert(document.cookie)</script>")
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+	}{
+		{"png", pngData.Bytes(), "png"},
+		{"jpeg with trailing payload", append(jpegData.Bytes(), payload...), "jpg"},
+		{"gif", gifData.Bytes(), ""},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"/>`), ""},
+		{"html", append([]byte("<!DOCTYPE html>"), payload...), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := Reencode(tt.data)
+			if tt.format == "" {
+				if err == nil {
+					t.Fatalf("Expected %s to be rejected, got %s", tt.name, v.Format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Reencode failed: %v", err)
+			}
+			if v.Format != tt.format || v.ContentType != ContentTypeFor(tt.format) {
+				t.Errorf("Expected %s, got %s (%s)", tt.format, v.Format, v.ContentType)
+			}
+			if v.Width != 40 || v.Height != 30 {
+				t.Errorf("Expected 40x30, got %dx%d", v.Width, v.Height)
+			}
+			if bytes.Contains(v.Data, payload) {
+				t.Error("Expected the trailing payload to be dropped")
+			}
+		})
+	}
+}
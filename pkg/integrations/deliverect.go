@@ -0,0 +1,105 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DeliverectAPIBase is the endpoint of the Deliverect API
+const DeliverectAPIBase = "https://api.deliverect.com"
+
+// Deliverect uploads the menu as the products and categories of a location, which Deliverect
+// then publishes to the delivery channels connected to it
+type Deliverect struct {
+	cfg    Config
+	client *http.Client
+}
+
+// Platform implements Connector
+func (*Deliverect) Platform() string { return PlatformDeliverect }
+
+// Build implements Connector. Items are identified by their PLU, the item ID; sold-out items
+// are left out, since Deliverect only snoozes products from its own dashboard
+func (d *Deliverect) Build(menu Menu) (interface{}, error) {
+	doc, _ := d.build(menu)
+	return doc, nil
+}
+
+func (d *Deliverect) build(menu Menu) (map[string]interface{}, *Result) {
+	products := []map[string]interface{}{}
+	categories := []map[string]interface{}{}
+	for _, category := range visibleCategories(menu, PlatformDeliverect) {
+		count := len(products)
+		for _, item := range category.Items {
+			if !item.Available {
+				continue
+			}
+			product := map[string]interface{}{
+				"productType":    1,
+				"plu":            item.ID,
+				"name":           item.Name,
+				"description":    item.Description,
+				"price":          item.PriceCents,
+				"posCategoryIds": []string{category.ID},
+			}
+			if item.ImageURL != "" {
+				product["imageUrl"] = item.ImageURL
+			}
+			products = append(products, product)
+		}
+		if len(products) > count {
+			categories = append(categories, map[string]interface{}{
+				"posCategoryId": category.ID,
+				"name":          category.Name,
+				"description":   category.Description,
+			})
+		}
+	}
+	doc := map[string]interface{}{
+		"accountId":  d.cfg.AccountID,
+		"locationId": d.cfg.LocationID,
+		"products":   products,
+		"categories": categories,
+	}
+	return doc, &Result{Categories: len(categories), Items: len(products)}
+}
+
+// Push implements Connector
+func (d *Deliverect) Push(ctx context.Context, menu Menu) (*Result, error) {
+	doc, result := d.build(menu)
+	token, err := d.token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("deliverect: %w", err)
+	}
+	endpoint := strings.TrimRight(d.cfg.APIBase, "/") + "/productAndCategories"
+	if err := sendJSON(ctx, d.client, http.MethodPost, endpoint, "Bearer "+token, doc); err != nil {
+		return nil, fmt.Errorf("deliverect: %w", err)
+	}
+	return result, nil
+}
+
+// token requests an access token; Deliverect takes the client credentials as JSON
+func (d *Deliverect) token(ctx context.Context) (string, error) {
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	req, err := newJSONRequest(ctx, http.MethodPost, d.cfg.TokenURL, map[string]string{
+		"client_id":     d.cfg.ClientID,
+		"client_secret": d.cfg.ClientSecret,
+		"audience":      DeliverectAPIBase,
+		"grant_type":    "token",
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := do(d.client, req, &token); err != nil {
+		return "", fmt.Errorf("access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("access token: empty response")
+	}
+	return token.AccessToken, nil
+}
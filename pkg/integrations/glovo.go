@@ -0,0 +1,74 @@
+package integrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GlovoAPIBase is the endpoint of the Glovo Partners API
+const GlovoAPIBase = "https://api.glovoapp.com"
+
+// Glovo asks the Glovo Partners API to import the menu, which Glovo downloads from Menu.URL
+type Glovo struct {
+	cfg    Config
+	client *http.Client
+}
+
+// Platform implements Connector
+func (*Glovo) Platform() string { return PlatformGlovo }
+
+// Build implements Connector. The categories are the sections of a single collection
+func (g *Glovo) Build(menu Menu) (interface{}, error) {
+	categories := visibleCategories(menu, PlatformGlovo)
+	products := []map[string]interface{}{}
+	sections := []map[string]interface{}{}
+	for i, category := range categories {
+		ids := []string{}
+		for _, item := range category.Items {
+			product := map[string]interface{}{
+				"id":          item.ID,
+				"name":        item.Name,
+				"description": item.Description,
+				"price":       float64(item.PriceCents) / 100,
+				"available":   item.Available,
+			}
+			if item.ImageURL != "" {
+				product["image_url"] = item.ImageURL
+			}
+			products = append(products, product)
+			ids = append(ids, item.ID)
+		}
+		sections = append(sections, map[string]interface{}{
+			"name":     category.Name,
+			"position": i,
+			"products": ids,
+		})
+	}
+	return map[string]interface{}{
+		"products": products,
+		"collections": []map[string]interface{}{{
+			"name":     menu.Name,
+			"position": 0,
+			"sections": sections,
+		}},
+		"attributes":       []interface{}{},
+		"attribute_groups": []interface{}{},
+	}, nil
+}
+
+// Push implements Connector. Glovo imports the menu asynchronously: errors in the document are
+// reported on the Glovo dashboard
+func (g *Glovo) Push(ctx context.Context, menu Menu) (*Result, error) {
+	if menu.URL == "" {
+		return nil, errors.New("glovo: the menu has no public URL to import")
+	}
+	endpoint := strings.TrimRight(g.cfg.APIBase, "/") + "/webhook/stores/" + url.PathEscape(g.cfg.StoreID) + "/menu"
+	if err := sendJSON(ctx, g.client, http.MethodPost, endpoint, g.cfg.APIKey, map[string]string{"menuUrl": menu.URL}); err != nil {
+		return nil, fmt.Errorf("glovo: %w", err)
+	}
+	return countItems(visibleCategories(menu, PlatformGlovo)), nil
+}
@@ -0,0 +1,248 @@
+// Package integrations exports the menus of the restaurants to the delivery platforms:
+// Deliverect, Uber Eats and Glovo. A Connector maps a platform-neutral Menu into the
+// document of its platform and uploads it to the store of the restaurant, leaving out the
+// items hidden on that channel (e.g. dine-in only dishes).
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Platforms
+const (
+	PlatformDeliverect = "deliverect"
+	PlatformUberEats   = "ubereats"
+	PlatformGlovo      = "glovo"
+)
+
+// Platforms lists the supported platforms
+var Platforms = []string{PlatformDeliverect, PlatformUberEats, PlatformGlovo}
+
+// ChannelDelivery hides an item on every delivery platform
+const ChannelDelivery = "delivery"
+
+// Channels lists the values accepted in the hidden channels of an item: a platform, or
+// ChannelDelivery for all of them
+var Channels = []string{ChannelDelivery, PlatformDeliverect, PlatformUberEats, PlatformGlovo}
+
+// ErrInvalidConfig is matched by the errors of New for missing or malformed credentials
+var ErrInvalidConfig = errors.New("invalid integration configuration")
+
+// Config holds the platform credentials of a restaurant. It is stored encrypted
+type Config struct {
+	Platform string `json:"platform"`
+
+	// Deliverect and Uber Eats (OAuth client credentials)
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+
+	// Deliverect
+	AccountID  string `json:"account_id,omitempty"`
+	LocationID string `json:"location_id,omitempty"`
+
+	// Uber Eats and Glovo
+	StoreID string `json:"store_id,omitempty"`
+
+	// Glovo
+	APIKey string `json:"api_key,omitempty"`
+
+	APIBase  string        `json:"-"` // API endpoint, overrides the default
+	TokenURL string        `json:"-"` // OAuth token endpoint, overrides the default
+	Timeout  time.Duration `json:"-"`
+}
+
+// Menu is the menu to export, with prices in minor units
+type Menu struct {
+	ID          string
+	Name        string
+	Description string
+	Currency    string // ISO 4217, e.g. EUR
+	Language    string // Language of the texts, e.g. it
+	Categories  []Category
+	URL         string // Public URL of the exported document, fetched by the platforms that pull the menu (Glovo)
+}
+
+// Category is a section of the menu
+type Category struct {
+	ID          string
+	Name        string
+	Description string
+	Items       []Item
+}
+
+// Item is a dish of the menu
+type Item struct {
+	ID          string
+	Name        string
+	Description string
+	PriceCents  int64
+	ImageURL    string
+	Available   bool     // False for sold-out items, shown as unavailable
+	Tags        []string // e.g. vegan, spicy
+	Hidden      []string // Channels the item is hidden on, see Channels
+}
+
+// Result is the outcome of an upload
+type Result struct {
+	Categories int
+	Items      int
+}
+
+// Connector exports menus to a platform
+type Connector interface {
+	// Platform returns the platform, e.g. PlatformGlovo
+	Platform() string
+	// Build returns the document of the menu in the format of the platform, without the items
+	// hidden on it and the categories left empty
+	Build(menu Menu) (interface{}, error)
+	// Push uploads the menu to the store of the restaurant, replacing the previous one
+	Push(ctx context.Context, menu Menu) (*Result, error)
+}
+
+// New creates the connector selected by cfg.Platform
+func New(cfg Config) (Connector, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+
+	switch cfg.Platform {
+	case PlatformDeliverect:
+		if cfg.ClientID == "" || cfg.ClientSecret == "" || cfg.AccountID == "" || cfg.LocationID == "" {
+			return nil, fmt.Errorf("%w: deliverect requires client_id, client_secret, account_id and location_id", ErrInvalidConfig)
+		}
+		if cfg.APIBase == "" {
+			cfg.APIBase = DeliverectAPIBase
+		}
+		if cfg.TokenURL == "" {
+			cfg.TokenURL = strings.TrimRight(cfg.APIBase, "/") + "/oauth/token"
+		}
+		return &Deliverect{cfg: cfg, client: client}, nil
+	case PlatformUberEats:
+		if cfg.ClientID == "" || cfg.ClientSecret == "" || cfg.StoreID == "" {
+			return nil, fmt.Errorf("%w: ubereats requires client_id, client_secret and store_id", ErrInvalidConfig)
+		}
+		if cfg.APIBase == "" {
+			cfg.APIBase = UberEatsAPIBase
+		}
+		if cfg.TokenURL == "" {
+			cfg.TokenURL = UberEatsTokenURL
+		}
+		return &UberEats{cfg: cfg, client: client}, nil
+	case PlatformGlovo:
+		if cfg.APIKey == "" || cfg.StoreID == "" {
+			return nil, fmt.Errorf("%w: glovo requires api_key and store_id", ErrInvalidConfig)
+		}
+		if cfg.APIBase == "" {
+			cfg.APIBase = GlovoAPIBase
+		}
+		return &Glovo{cfg: cfg, client: client}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported platform %q", ErrInvalidConfig, cfg.Platform)
+	}
+}
+
+// VisibleOn reports whether the item is shown on the platform
+func (i Item) VisibleOn(platform string) bool {
+	return !slices.Contains(i.Hidden, ChannelDelivery) && !slices.Contains(i.Hidden, platform)
+}
+
+// visibleCategories returns the categories of the menu with the items shown on the
+// platform, dropping the categories left empty
+func visibleCategories(menu Menu, platform string) []Category {
+	var categories []Category
+	for _, category := range menu.Categories {
+		var items []Item
+		for _, item := range category.Items {
+			if item.VisibleOn(platform) {
+				items = append(items, item)
+			}
+		}
+		if len(items) > 0 {
+			category.Items = items
+			categories = append(categories, category)
+		}
+	}
+	return categories
+}
+
+// countItems returns the result of the upload of the categories
+func countItems(categories []Category) *Result {
+	result := &Result{Categories: len(categories)}
+	for _, category := range categories {
+		result.Items += len(category.Items)
+	}
+	return result
+}
+
+// clientCredentialsToken requests an OAuth access token with the client credentials grant
+func clientCredentialsToken(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := do(client, req, &token); err != nil {
+		return "", fmt.Errorf("access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", errors.New("access token: empty response")
+	}
+	return token.AccessToken, nil
+}
+
+// newJSONRequest creates a request with body encoded as JSON
+func newJSONRequest(ctx context.Context, method, endpoint string, body interface{}) (*http.Request, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// sendJSON sends body as JSON with the given authorization header
+func sendJSON(ctx context.Context, client *http.Client, method, endpoint, authorization string, body interface{}) error {
+	req, err := newJSONRequest(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	return do(client, req, nil)
+}
+
+// do sends the request and decodes the JSON answer into out, if not nil. Errors carry the
+// status and the beginning of the answer, which the platforms use to explain rejected menus
+func do(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	if out == nil {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
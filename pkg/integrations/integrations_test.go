@@ -0,0 +1,178 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func testMenu() Menu {
+	return Menu{
+		ID:       "m1",
+		Name:     "Cena",
+		Currency: "EUR",
+		Language: "it",
+		URL:      "https://menu.example.com/api/v1/public/integrations/i1/menu",
+		Categories: []Category{
+			{ID: "c1", Name: "Primi", Items: []Item{
+				{ID: "carbonara", Name: "Carbonara", PriceCents: 1200, Available: true},
+				{ID: "lasagne", Name: "Lasagne", PriceCents: 1300, Available: false},
+				{ID: "risotto", Name: "Risotto al tavolo", PriceCents: 1800, Available: true, Hidden: []string{ChannelDelivery}},
+			}},
+			{ID: "c2", Name: "Vini", Items: []Item{
+				{ID: "chianti", Name: "Chianti", PriceCents: 2500, Available: true, Hidden: []string{PlatformUberEats, PlatformGlovo}},
+			}},
+		},
+	}
+}
+
+func TestNew(t *testing.T) {
+	valid := []Config{
+		{Platform: PlatformDeliverect, ClientID: "id", ClientSecret: "secret", AccountID: "a", LocationID: "l"},
+		{Platform: PlatformUberEats, ClientID: "id", ClientSecret: "secret", StoreID: "s"},
+		{Platform: PlatformGlovo, APIKey: "key", StoreID: "s"},
+	}
+	for _, cfg := range valid {
+		connector, err := New(cfg)
+		if err != nil {
+			t.Fatalf("New(%s): %v", cfg.Platform, err)
+		}
+		if connector.Platform() != cfg.Platform {
+			t.Errorf("Platform() = %s, want %s", connector.Platform(), cfg.Platform)
+		}
+	}
+
+	invalid := []Config{
+		{Platform: PlatformDeliverect, ClientID: "id", ClientSecret: "secret"},
+		{Platform: PlatformUberEats, StoreID: "s"},
+		{Platform: PlatformGlovo, StoreID: "s"},
+		{Platform: "justeat"},
+	}
+	for _, cfg := range invalid {
+		if _, err := New(cfg); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("New(%+v) = %v, want ErrInvalidConfig", cfg, err)
+		}
+	}
+}
+
+// decode returns the document built by the connector as generic JSON
+func decode(t *testing.T, connector Connector, menu Menu) map[string]interface{} {
+	t.Helper()
+	doc, err := connector.Build(menu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(doc)
+	var out map[string]interface{}
+	json.Unmarshal(raw, &out)
+	return out
+}
+
+func TestBuild(t *testing.T) {
+	deliverect, _ := New(Config{Platform: PlatformDeliverect, ClientID: "id", ClientSecret: "secret", AccountID: "a", LocationID: "l"})
+	doc := decode(t, deliverect, testMenu())
+	products := doc["products"].([]interface{})
+	// Risotto is hidden on delivery and lasagne is sold out
+	if len(products) != 2 || products[0].(map[string]interface{})["plu"] != "carbonara" || products[0].(map[string]interface{})["price"] != float64(1200) {
+		t.Errorf("unexpected deliverect products %v", products)
+	}
+	if len(doc["categories"].([]interface{})) != 2 || doc["locationId"] != "l" {
+		t.Errorf("unexpected deliverect document %v", doc)
+	}
+
+	uber, _ := New(Config{Platform: PlatformUberEats, ClientID: "id", ClientSecret: "secret", StoreID: "s"})
+	doc = decode(t, uber, testMenu())
+	items := doc["items"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("unexpected uber eats items %v", items)
+	}
+	lasagne := items[1].(map[string]interface{})
+	if lasagne["id"] != "lasagne" || lasagne["suspension_info"] == nil || lasagne["title"].(map[string]interface{})["translations"].(map[string]interface{})["it"] != "Lasagne" {
+		t.Errorf("sold-out item should be suspended: %v", lasagne)
+	}
+	// The wine category is empty on Uber Eats and left out
+	if ids := doc["menus"].([]interface{})[0].(map[string]interface{})["category_ids"].([]interface{}); len(ids) != 1 || ids[0] != "c1" {
+		t.Errorf("unexpected uber eats categories %v", ids)
+	}
+
+	glovo, _ := New(Config{Platform: PlatformGlovo, APIKey: "key", StoreID: "s"})
+	doc = decode(t, glovo, testMenu())
+	products = doc["products"].([]interface{})
+	if len(products) != 2 || products[0].(map[string]interface{})["price"] != 12.0 || products[1].(map[string]interface{})["available"] != false {
+		t.Errorf("unexpected glovo products %v", products)
+	}
+}
+
+func TestPush(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests[r.Method+" "+r.URL.Path] = r.Header.Get("Authorization") + " " + string(body)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/oauth/token", "/token":
+			io.WriteString(w, `{"access_token": "tok", "expires_in": 3600}`)
+		case "/v2/eats/stores/missing/menus":
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"code": "not_found", "message": "store not found"}`)
+		default:
+			io.WriteString(w, `{}`)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	deliverect, _ := New(Config{Platform: PlatformDeliverect, ClientID: "id", ClientSecret: "secret", AccountID: "a", LocationID: "l", APIBase: srv.URL})
+	result, err := deliverect.Push(ctx, testMenu())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Items != 2 || result.Categories != 2 {
+		t.Errorf("deliverect result %+v", result)
+	}
+	if got := requests["POST /productAndCategories"]; !strings.HasPrefix(got, "Bearer tok ") {
+		t.Errorf("deliverect upload %q", got)
+	}
+	if got := requests["POST /oauth/token"]; !strings.Contains(got, `"client_secret":"secret"`) {
+		t.Errorf("deliverect token request %q", got)
+	}
+
+	uber, _ := New(Config{Platform: PlatformUberEats, ClientID: "id", ClientSecret: "secret", StoreID: "store-1", APIBase: srv.URL, TokenURL: srv.URL + "/token"})
+	if result, err = uber.Push(ctx, testMenu()); err != nil {
+		t.Fatal(err)
+	}
+	if result.Items != 2 || result.Categories != 1 {
+		t.Errorf("uber eats result %+v", result)
+	}
+	if got := requests["PUT /v2/eats/stores/store-1/menus"]; !strings.HasPrefix(got, "Bearer tok ") {
+		t.Errorf("uber eats upload %q", got)
+	}
+	if got := requests["POST /token"]; !strings.Contains(got, "scope=eats.store") {
+		t.Errorf("uber eats token request %q", got)
+	}
+	missing, _ := New(Config{Platform: PlatformUberEats, ClientID: "id", ClientSecret: "secret", StoreID: "missing", APIBase: srv.URL, TokenURL: srv.URL + "/token"})
+	if _, err := missing.Push(ctx, testMenu()); err == nil || !strings.Contains(err.Error(), "store not found") {
+		t.Errorf("rejected upload: %v", err)
+	}
+
+	glovo, _ := New(Config{Platform: PlatformGlovo, APIKey: "key", StoreID: "store-2", APIBase: srv.URL})
+	if _, err = glovo.Push(ctx, testMenu()); err != nil {
+		t.Fatal(err)
+	}
+	if got := requests["POST /webhook/stores/store-2/menu"]; got != `key {"menuUrl":"https://menu.example.com/api/v1/public/integrations/i1/menu"}` {
+		t.Errorf("glovo upload %q", got)
+	}
+	noURL := testMenu()
+	noURL.URL = ""
+	if _, err := glovo.Push(ctx, noURL); err == nil {
+		t.Error("glovo needs the public URL of the menu")
+	}
+}
@@ -0,0 +1,117 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Endpoints of the Uber Eats API
+const (
+	UberEatsAPIBase  = "https://api.uber.com"
+	UberEatsTokenURL = "https://auth.uber.com/oauth/v2/token"
+)
+
+// uberEatsDays are the days of the service availability of the menu
+var uberEatsDays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// UberEats uploads the menu to a store through the Uber Eats Menu API
+type UberEats struct {
+	cfg    Config
+	client *http.Client
+}
+
+// Platform implements Connector
+func (*UberEats) Platform() string { return PlatformUberEats }
+
+// Build implements Connector. The menu is available all week; the opening hours of the store
+// are managed on Uber Eats. Sold-out items are suspended for a day, until the next sync
+func (u *UberEats) Build(menu Menu) (interface{}, error) {
+	doc, _ := u.build(menu, time.Now())
+	return doc, nil
+}
+
+func (u *UberEats) build(menu Menu, now time.Time) (map[string]interface{}, *Result) {
+	lang := menu.Language
+	if lang == "" {
+		lang = "it"
+	}
+	text := func(s string) map[string]interface{} {
+		return map[string]interface{}{"translations": map[string]string{lang: s}}
+	}
+
+	categories := visibleCategories(menu, PlatformUberEats)
+	var availability []map[string]interface{}
+	for _, day := range uberEatsDays {
+		availability = append(availability, map[string]interface{}{
+			"day_of_week":  day,
+			"time_periods": []map[string]string{{"start_time": "00:00", "end_time": "23:59"}},
+		})
+	}
+	categoryIDs := []string{}
+	categoryDocs := []map[string]interface{}{}
+	items := []map[string]interface{}{}
+	for _, category := range categories {
+		categoryIDs = append(categoryIDs, category.ID)
+		var entities []map[string]string
+		for _, item := range category.Items {
+			entities = append(entities, map[string]string{"id": item.ID, "type": "ITEM"})
+			doc := map[string]interface{}{
+				"id":            item.ID,
+				"external_data": item.ID,
+				"title":         text(item.Name),
+				"description":   text(item.Description),
+				"price_info":    map[string]interface{}{"price": item.PriceCents},
+			}
+			if item.ImageURL != "" {
+				doc["image_url"] = item.ImageURL
+			}
+			if !item.Available {
+				doc["suspension_info"] = map[string]interface{}{
+					"suspension": map[string]interface{}{"suspend_until": now.Add(24 * time.Hour).Unix()},
+				}
+			}
+			items = append(items, doc)
+		}
+		categoryDocs = append(categoryDocs, map[string]interface{}{
+			"id":       category.ID,
+			"title":    text(category.Name),
+			"entities": entities,
+		})
+	}
+
+	doc := map[string]interface{}{
+		"menus": []map[string]interface{}{{
+			"id":                   menu.ID,
+			"title":                text(menu.Name),
+			"service_availability": availability,
+			"category_ids":         categoryIDs,
+		}},
+		"categories":      categoryDocs,
+		"items":           items,
+		"modifier_groups": []interface{}{},
+	}
+	return doc, countItems(categories)
+}
+
+// Push implements Connector
+func (u *UberEats) Push(ctx context.Context, menu Menu) (*Result, error) {
+	doc, result := u.build(menu, time.Now())
+	token, err := clientCredentialsToken(ctx, u.client, u.cfg.TokenURL, url.Values{
+		"client_id":     {u.cfg.ClientID},
+		"client_secret": {u.cfg.ClientSecret},
+		"grant_type":    {"client_credentials"},
+		"scope":         {"eats.store"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ubereats: %w", err)
+	}
+	endpoint := strings.TrimRight(u.cfg.APIBase, "/") + "/v2/eats/stores/" + url.PathEscape(u.cfg.StoreID) + "/menus"
+	if err := sendJSON(ctx, u.client, http.MethodPut, endpoint, "Bearer "+token, doc); err != nil {
+		return nil, fmt.Errorf("ubereats: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,174 @@
+// Package jwtkeys manages the HMAC keys that sign API tokens. Every key has an ID sent in the
+// token header (kid): after a rotation new tokens are signed with the new key, while tokens
+// signed with the previous ones stay valid for a grace window, so rotating does not log out
+// every client at once.
+package jwtkeys
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnknownKey is returned by Lookup for key IDs that were never issued or whose grace
+// window is over
+var ErrUnknownKey = errors.New("unknown or expired signing key")
+
+// Key is a signing key. RetiredAt is zero for the current key
+type Key struct {
+	ID        string
+	Secret    []byte
+	CreatedAt time.Time
+	RetiredAt time.Time
+}
+
+// Store persists the keys, so that tokens survive restarts and all instances share them
+type Store interface {
+	LoadKeys(ctx context.Context) ([]Key, error)
+	SaveKey(ctx context.Context, key Key) error
+	RetireKey(ctx context.Context, id string, at time.Time) error
+	DeleteKeysRetiredBefore(ctx context.Context, before time.Time) error
+}
+
+// reloadInterval limits how often a token signed with an unknown key triggers a reload
+const reloadInterval = 30 * time.Second
+
+// Keyring holds the current signing key and the retired keys still accepted
+type Keyring struct {
+	store Store
+	grace time.Duration
+
+	rotateMu   sync.Mutex
+	mu         sync.RWMutex
+	keys       []Key // Newest first
+	reloadedAt time.Time
+}
+
+// New loads the keys from store, creating the first one if there are none. Retired keys
+// are accepted for grace after their retirement, which should be at least the token lifetime
+func New(ctx context.Context, store Store, grace time.Duration) (*Keyring, error) {
+	k := &Keyring{store: store, grace: grace}
+	if err := k.Reload(ctx); err != nil {
+		return nil, err
+	}
+	if _, err := k.Current(); err != nil {
+		if _, err := k.Rotate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Reload reads the keys again from the store, to pick up rotations made by other instances
+func (k *Keyring) Reload(ctx context.Context) error {
+	keys, err := k.store.LoadKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("jwtkeys: load keys: %w", err)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+
+	k.mu.Lock()
+	k.keys = keys
+	k.reloadedAt = time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// Current returns the key that signs new tokens
+func (k *Keyring) Current() (Key, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.RetiredAt.IsZero() {
+			return key, nil
+		}
+	}
+	return Key{}, fmt.Errorf("jwtkeys: no current signing key")
+}
+
+// Lookup returns the secret of the key that signed a token, if still accepted at now. Unknown
+// keys may have been created by a rotation on another instance: the keys are reloaded from the
+// store, at most once every 30 seconds
+func (k *Keyring) Lookup(ctx context.Context, id string, now time.Time) ([]byte, error) {
+	secret, err := k.lookup(id, now)
+	if err == nil {
+		return secret, nil
+	}
+
+	k.mu.RLock()
+	stale := time.Since(k.reloadedAt) > reloadInterval
+	k.mu.RUnlock()
+	if !stale {
+		return nil, err
+	}
+	if err := k.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return k.lookup(id, now)
+}
+
+func (k *Keyring) lookup(id string, now time.Time) ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.ID != id {
+			continue
+		}
+		if !key.RetiredAt.IsZero() && now.After(key.RetiredAt.Add(k.grace)) {
+			break
+		}
+		return key.Secret, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// Rotate creates a new current key and retires the previous one, which stays valid for the
+// grace window. Keys whose grace window is over are deleted
+func (k *Keyring) Rotate(ctx context.Context) (Key, error) {
+	k.rotateMu.Lock()
+	defer k.rotateMu.Unlock()
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, fmt.Errorf("jwtkeys: generate key: %w", err)
+	}
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return Key{}, fmt.Errorf("jwtkeys: generate key id: %w", err)
+	}
+	now := time.Now()
+	key := Key{ID: hex.EncodeToString(idBytes), Secret: secret, CreatedAt: now}
+
+	previous, err := k.Current()
+	hasPrevious := err == nil
+	if err := k.store.SaveKey(ctx, key); err != nil {
+		return Key{}, fmt.Errorf("jwtkeys: save key: %w", err)
+	}
+	if hasPrevious {
+		if err := k.store.RetireKey(ctx, previous.ID, now); err != nil {
+			return Key{}, fmt.Errorf("jwtkeys: retire key: %w", err)
+		}
+	}
+	if err := k.store.DeleteKeysRetiredBefore(ctx, now.Add(-k.grace)); err != nil {
+		return Key{}, fmt.Errorf("jwtkeys: delete expired keys: %w", err)
+	}
+
+	k.mu.Lock()
+	kept := []Key{key}
+	for _, old := range k.keys {
+		if hasPrevious && old.ID == previous.ID {
+			old.RetiredAt = now
+		}
+		if old.RetiredAt.IsZero() || now.Before(old.RetiredAt.Add(k.grace)) {
+			kept = append(kept, old)
+		}
+	}
+	k.keys = kept
+	k.mu.Unlock()
+	return key, nil
+}
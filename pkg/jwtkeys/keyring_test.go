@@ -0,0 +1,159 @@
+package jwtkeys
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a Store shared by the keyrings of a test, like the database across instances
+type memoryStore struct {
+	mu   sync.Mutex
+	keys map[string]Key
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{keys: make(map[string]Key)}
+}
+
+func (s *memoryStore) LoadKeys(ctx context.Context) ([]Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []Key
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *memoryStore) SaveKey(ctx context.Context, key Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.ID] = key
+	return nil
+}
+
+func (s *memoryStore) RetireKey(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.keys[id]
+	key.RetiredAt = at
+	s.keys[id] = key
+	return nil
+}
+
+func (s *memoryStore) DeleteKeysRetiredBefore(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, key := range s.keys {
+		if !key.RetiredAt.IsZero() && key.RetiredAt.Before(before) {
+			delete(s.keys, id)
+		}
+	}
+	return nil
+}
+
+func TestNewCreatesFirstKey(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	k, err := New(ctx, store, time.Hour)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	current, err := k.Current()
+	if err != nil || len(current.Secret) != 32 || current.ID == "" {
+		t.Fatalf("Current = %+v, %v", current, err)
+	}
+
+	// A restart loads the same key instead of creating a new one
+	restarted, err := New(ctx, store, time.Hour)
+	if err != nil {
+		t.Fatalf("New after restart: %v", err)
+	}
+	if again, _ := restarted.Current(); again.ID != current.ID {
+		t.Errorf("key after restart = %s, want %s", again.ID, current.ID)
+	}
+}
+
+func TestRotateKeepsPreviousKeyForGraceWindow(t *testing.T) {
+	ctx := context.Background()
+	k, err := New(ctx, newMemoryStore(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _ := k.Current()
+
+	rotated, err := k.Rotate(ctx)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if current, _ := k.Current(); current.ID != rotated.ID || rotated.ID == old.ID {
+		t.Fatalf("current = %s, want new key %s", current.ID, rotated.ID)
+	}
+
+	now := time.Now()
+	if _, err := k.Lookup(ctx, old.ID, now.Add(30*time.Minute)); err != nil {
+		t.Errorf("old key within grace window: %v", err)
+	}
+	if _, err := k.Lookup(ctx, old.ID, now.Add(2*time.Hour)); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("old key after grace window: err = %v, want ErrUnknownKey", err)
+	}
+	if _, err := k.Lookup(ctx, rotated.ID, now.Add(2*time.Hour)); err != nil {
+		t.Errorf("current key: %v", err)
+	}
+	if _, err := k.Lookup(ctx, "unknown", now); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown key: err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestRotateDeletesExpiredKeys(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	k, err := New(ctx, store, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := k.Rotate(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Only the current key and the one retired by the last rotation are left
+	if keys, _ := store.LoadKeys(ctx); len(keys) != 2 {
+		t.Errorf("stored keys = %d, want 2", len(keys))
+	}
+	if keys := len(k.keys); keys != 1 {
+		t.Errorf("keyring keys = %d, want only the current one", keys)
+	}
+}
+
+func TestLookupReloadsKeysRotatedElsewhere(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	first, err := New(ctx, store, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := New(ctx, store, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := first.Rotate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The other instance reloaded just now, so the new key is found only after the interval
+	if _, err := second.Lookup(ctx, rotated.ID, time.Now()); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("lookup before reload interval: err = %v", err)
+	}
+	second.mu.Lock()
+	second.reloadedAt = time.Now().Add(-time.Minute)
+	second.mu.Unlock()
+	if _, err := second.Lookup(ctx, rotated.ID, time.Now()); err != nil {
+		t.Errorf("lookup after reload interval: %v", err)
+	}
+}
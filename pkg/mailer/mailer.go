@@ -0,0 +1,146 @@
+// Package mailer delivers transactional email (password resets, account notices,
+// analytics digests) through SMTP, SendGrid or Mailgun, optionally behind a send
+// queue with retries. Without a provider messages are only logged.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"qr-menu/logger"
+)
+
+// ErrInvalidMessage is matched (with errors.Is) by the error returned for messages
+// with a missing recipient or header values containing line breaks
+var ErrInvalidMessage = errors.New("invalid email message")
+
+// ErrPermanent is matched by delivery errors that would fail again on retry,
+// e.g. a rejected recipient or invalid API credentials
+var ErrPermanent = errors.New("permanent delivery failure")
+
+// Providers
+const (
+	ProviderLog      = "log"
+	ProviderSMTP     = "smtp"
+	ProviderSendGrid = "sendgrid"
+	ProviderMailgun  = "mailgun"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config holds the email provider configuration
+type Config struct {
+	Provider string        // log, smtp, sendgrid or mailgun; empty selects smtp when Host is set, log otherwise
+	From     string        // Sender address, e.g. "QR Menu <no-reply@example.com>"
+	Timeout  time.Duration // Connection and delivery timeout
+
+	// SMTP
+	Host     string
+	Port     int    // 587 (STARTTLS), 465 (implicit TLS) or 25
+	Username string // Empty disables authentication
+	Password string
+
+	// SendGrid and Mailgun
+	APIKey  string
+	Domain  string // Mailgun sending domain
+	APIBase string // API endpoint, defaults to SendGridAPIBase or MailgunAPIBase
+}
+
+// New creates the mailer selected by cfg.Provider
+func New(cfg Config) (Mailer, error) {
+	provider := cfg.Provider
+	if provider == "" {
+		provider = ProviderLog
+		if cfg.Host != "" {
+			provider = ProviderSMTP
+		}
+	}
+	if provider == ProviderLog {
+		return Log{}, nil
+	}
+
+	if cfg.From == "" {
+		return nil, fmt.Errorf("mailer: sender address is required")
+	}
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("mailer: invalid sender %q: %w", cfg.From, err)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+
+	switch provider {
+	case ProviderSMTP:
+		if cfg.Host == "" {
+			return nil, fmt.Errorf("mailer: SMTP host is required")
+		}
+		if cfg.Port == 0 {
+			cfg.Port = 587
+		}
+		return &SMTP{cfg: cfg}, nil
+	case ProviderSendGrid:
+		if cfg.APIKey == "" {
+			return nil, fmt.Errorf("mailer: SendGrid API key is required")
+		}
+		if cfg.APIBase == "" {
+			cfg.APIBase = SendGridAPIBase
+		}
+		cfg.APIBase = strings.TrimRight(cfg.APIBase, "/")
+		return &SendGrid{cfg: cfg, from: from, client: client}, nil
+	case ProviderMailgun:
+		if cfg.APIKey == "" || cfg.Domain == "" {
+			return nil, fmt.Errorf("mailer: Mailgun API key and domain are required")
+		}
+		if cfg.APIBase == "" {
+			cfg.APIBase = MailgunAPIBase
+		}
+		cfg.APIBase = strings.TrimRight(cfg.APIBase, "/")
+		return &Mailgun{cfg: cfg, client: client}, nil
+	default:
+		return nil, fmt.Errorf("mailer: unknown provider %q", provider)
+	}
+}
+
+// Log only records messages in the application log, for development and tests
+type Log struct{}
+
+// Send logs the message
+func (Log) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	logger.InfoCtx(ctx, "Email (provider non configurato)", map[string]interface{}{
+		"to":      msg.To,
+		"subject": msg.Subject,
+		"body":    msg.Body,
+	})
+	return nil
+}
+
+// validate rejects messages that would allow header injection
+func (m Message) validate() error {
+	if strings.TrimSpace(m.To) == "" {
+		return fmt.Errorf("%w: missing recipient", ErrInvalidMessage)
+	}
+	if strings.ContainsAny(m.To, "\r\n") || strings.ContainsAny(m.Subject, "\r\n") {
+		return fmt.Errorf("%w: line break in header", ErrInvalidMessage)
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP accepts one message per connection and sends the envelope and data on received
+func fakeSMTP(t *testing.T) (int, <-chan []string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received := make(chan []string, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				tp := textproto.NewConn(conn)
+				tp.PrintfLine("220 fake ESMTP")
+				var lines []string
+				for {
+					line, err := tp.ReadLine()
+					if err != nil {
+						return
+					}
+					cmd := strings.ToUpper(strings.Fields(line + " ")[0])
+					switch cmd {
+					case "EHLO", "HELO":
+						tp.PrintfLine("250 fake")
+					case "MAIL", "RCPT":
+						lines = append(lines, line)
+						tp.PrintfLine("250 OK")
+					case "DATA":
+						tp.PrintfLine("354 go ahead")
+						data, err := tp.ReadDotLines()
+						if err != nil {
+							return
+						}
+						lines = append(lines, data...)
+						tp.PrintfLine("250 queued")
+						received <- lines
+					case "QUIT":
+						tp.PrintfLine("221 bye")
+						return
+					default:
+						tp.PrintfLine("502 not implemented")
+					}
+				}
+			}(conn)
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, received
+}
+
+// TestSMTPSend tests envelope, headers and body of a delivered message
+func TestSMTPSend(t *testing.T) {
+	port, received := fakeSMTP(t)
+	m, err := New(Config{Host: "127.0.0.1", Port: port, From: "QR Menu <no-reply@example.com>", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send(context.Background(), Message{
+		To:      "mario@example.com",
+		Subject: "Reimposta la password",
+		Body:    "Apri il link:\n\nhttps://example.com/reset-password?token=abc",
+	})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	var lines []string
+	select {
+	case lines = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Message not received")
+	}
+	text := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"MAIL FROM:<no-reply@example.com>",
+		"RCPT TO:<mario@example.com>",
+		`From: "QR Menu" <no-reply@example.com>`,
+		"To: <mario@example.com>",
+		"Subject: Reimposta la password",
+		"Content-Type: text/plain; charset=UTF-8",
+		"https://example.com/reset-password?token=abc",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in message:\n%s", want, text)
+		}
+	}
+}
+
+// TestSMTPUnreachable tests that connection failures are reported
+func TestSMTPUnreachable(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	m, _ := New(Config{Host: "127.0.0.1", Port: port, From: "no-reply@example.com", Timeout: time.Second})
+	if err := m.Send(context.Background(), Message{To: "a@example.com", Subject: "x"}); err == nil {
+		t.Error("Expected error for unreachable server")
+	}
+}
+
+// TestInvalidMessage tests recipient and header injection checks
+func TestInvalidMessage(t *testing.T) {
+	for _, msg := range []Message{
+		{To: "", Subject: "x"},
+		{To: "a@example.com\r\nBcc: b@example.com", Subject: "x"},
+		{To: "a@example.com", Subject: "x\nBcc: b@example.com"},
+	} {
+		if err := (Log{}).Send(context.Background(), msg); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("Expected ErrInvalidMessage for %+v, got %v", msg, err)
+		}
+	}
+
+	m, _ := New(Config{Host: "127.0.0.1", Port: 1, From: "no-reply@example.com"})
+	if err := m.Send(context.Background(), Message{To: "not an address", Subject: "x"}); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Expected ErrInvalidMessage for malformed recipient, got %v", err)
+	}
+}
+
+// TestNew tests mailer selection and required settings
+func TestNew(t *testing.T) {
+	if m, err := New(Config{}); err != nil {
+		t.Error(err)
+	} else if _, ok := m.(Log); !ok {
+		t.Errorf("Expected Log mailer without host, got %T", m)
+	}
+	if _, err := New(Config{Host: "smtp.example.com"}); err == nil {
+		t.Error("Expected error without sender")
+	}
+	m, err := New(Config{Host: "smtp.example.com", From: "no-reply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := m.(*SMTP); s.cfg.Port != 587 || s.cfg.Timeout <= 0 {
+		t.Errorf("Expected default port and timeout, got %+v", s.cfg)
+	}
+}
+
+// TestCompose tests line endings and encoding of non-ASCII subjects
+func TestCompose(t *testing.T) {
+	from := &mail.Address{Address: "no-reply@example.com"}
+	to := &mail.Address{Address: "a@example.com"}
+	raw := string(compose(from, to, Message{Subject: "Città", Body: "riga 1\nriga 2"}, time.Unix(0, 0)))
+
+	if !strings.Contains(raw, "Subject: =?utf-8?q?Citt=C3=A0?=\r\n") {
+		t.Errorf("Expected encoded subject, got:\n%s", raw)
+	}
+	if !strings.HasSuffix(raw, "\r\n\r\nriga 1\r\nriga 2\r\n") {
+		t.Errorf("Expected CRLF body, got %q", raw)
+	}
+	if _, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(raw))); err != nil {
+		t.Errorf("Composed message does not parse: %v", err)
+	}
+}
+
+// TestSendGrid tests the request sent to the SendGrid API and permanent errors
+func TestSendGrid(t *testing.T) {
+	var got map[string]interface{}
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v3/mail/send" || r.Header.Get("Authorization") != "Bearer sg-key" {
+			t.Errorf("Unexpected request %s %s", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	m, err := New(Config{Provider: ProviderSendGrid, APIKey: "sg-key", APIBase: server.URL, From: "QR Menu <no-reply@example.com>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(context.Background(), Message{To: "mario@example.com", Subject: "Ciao", Body: "Testo"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if got["subject"] != "Ciao" || got["from"].(map[string]interface{})["email"] != "no-reply@example.com" {
+		t.Errorf("Unexpected payload %v", got)
+	}
+
+	status = http.StatusUnauthorized
+	if err := m.Send(context.Background(), Message{To: "mario@example.com", Subject: "Ciao"}); !errors.Is(err, ErrPermanent) {
+		t.Errorf("Expected permanent error on 401, got %v", err)
+	}
+	status = http.StatusServiceUnavailable
+	if err := m.Send(context.Background(), Message{To: "mario@example.com", Subject: "Ciao"}); err == nil || errors.Is(err, ErrPermanent) {
+		t.Errorf("Expected temporary error on 503, got %v", err)
+	}
+}
+
+// TestMailgun tests the request sent to the Mailgun API
+func TestMailgun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if r.URL.Path != "/v3/mg.example.com/messages" || user != "api" || pass != "mg-key" {
+			t.Errorf("Unexpected request %s %s:%s", r.URL.Path, user, pass)
+		}
+		if r.FormValue("to") != "mario@example.com" || r.FormValue("text") != "Testo" {
+			t.Errorf("Unexpected form %v", r.Form)
+		}
+		w.Write([]byte(`{"message":"Queued"}`))
+	}))
+	defer server.Close()
+
+	m, err := New(Config{Provider: ProviderMailgun, APIKey: "mg-key", Domain: "mg.example.com", APIBase: server.URL + "/", From: "no-reply@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(context.Background(), Message{To: "mario@example.com", Subject: "Ciao", Body: "Testo"}); err != nil {
+		t.Errorf("Send failed: %v", err)
+	}
+
+	if _, err := New(Config{Provider: ProviderMailgun, APIKey: "mg-key", From: "no-reply@example.com"}); err == nil {
+		t.Error("Expected error without domain")
+	}
+	if _, err := New(Config{Provider: "pigeon", From: "no-reply@example.com"}); err == nil {
+		t.Error("Expected error for unknown provider")
+	}
+}
+
+// flakyMailer fails its first `failures` sends with err
+type flakyMailer struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	calls    int
+	sent     []Message
+}
+
+func (f *flakyMailer) Send(ctx context.Context, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return f.err
+	}
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+// TestQueue tests retries of temporary errors, permanent errors and shutdown
+func TestQueue(t *testing.T) {
+	flaky := &flakyMailer{failures: 2, err: errors.New("connection refused")}
+	q := NewQueue(flaky, QueueConfig{Workers: 1, Size: 10, MaxRetries: 3, RetryDelay: time.Millisecond})
+	if err := q.Send(context.Background(), Message{To: "a@example.com", Subject: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if flaky.calls != 3 || len(flaky.sent) != 1 {
+		t.Errorf("Expected delivery at the third attempt, got %d calls and %d sent", flaky.calls, len(flaky.sent))
+	}
+	if err := q.Send(context.Background(), Message{To: "a@example.com", Subject: "x"}); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("Expected ErrQueueClosed after Close, got %v", err)
+	}
+
+	permanent := &flakyMailer{failures: 10, err: fmt.Errorf("%w: rejected", ErrPermanent)}
+	q = NewQueue(permanent, QueueConfig{MaxRetries: 5, RetryDelay: time.Millisecond})
+	q.Send(context.Background(), Message{To: "a@example.com", Subject: "x"})
+	q.Close(context.Background())
+	if permanent.calls != 1 {
+		t.Errorf("Expected no retry of permanent errors, got %d calls", permanent.calls)
+	}
+
+	if err := q.Send(context.Background(), Message{To: "", Subject: "x"}); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Expected invalid message to be rejected before queueing, got %v", err)
+	}
+}
+
+// TestQueueFullAndAbandon tests the queue limit and Close giving up on pending retries
+func TestQueueFullAndAbandon(t *testing.T) {
+	stuck := &flakyMailer{failures: 100, err: errors.New("timeout")}
+	q := NewQueue(stuck, QueueConfig{Workers: 1, Size: 1, MaxRetries: 100, RetryDelay: time.Hour})
+
+	q.Send(context.Background(), Message{To: "a@example.com", Subject: "1"})
+	for i := 0; i < 100; i++ { // Wait until the worker has taken the first message
+		stuck.mu.Lock()
+		calls := stuck.calls
+		stuck.mu.Unlock()
+		if calls > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	q.Send(context.Background(), Message{To: "a@example.com", Subject: "2"})
+	if err := q.Send(context.Background(), Message{To: "a@example.com", Subject: "3"}); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	if queued, size := q.Usage(); queued != 1 || size != 1 {
+		t.Errorf("Usage() = %d, %d, want 1, 1", queued, size)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := q.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Close to give up, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// Default API endpoints of the HTTP providers
+const (
+	SendGridAPIBase = "https://api.sendgrid.com"
+	MailgunAPIBase  = "https://api.mailgun.net" // https://api.eu.mailgun.net for EU domains
+)
+
+// SendGrid delivers messages through the SendGrid v3 Web API
+type SendGrid struct {
+	cfg    Config
+	from   *mail.Address
+	client *http.Client
+}
+
+// Send delivers the message with POST /v3/mail/send
+func (s *SendGrid) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("%w: invalid recipient %q", ErrInvalidMessage, msg.To)
+	}
+
+	type address struct {
+		Email string `json:"email"`
+		Name  string `json:"name,omitempty"`
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	payload := map[string]interface{}{
+		"personalizations": []map[string]interface{}{
+			{"to": []address{{Email: to.Address, Name: to.Name}}},
+		},
+		"from":    address{Email: s.from.Address, Name: s.from.Name},
+		"subject": msg.Subject,
+		"content": []content{{Type: "text/plain", Value: msg.Body}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.APIBase+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+	return doProviderRequest(s.client, req, "sendgrid")
+}
+
+// Mailgun delivers messages through the Mailgun Messages API
+type Mailgun struct {
+	cfg    Config
+	client *http.Client
+}
+
+// Send delivers the message with POST /v3/{domain}/messages
+func (m *Mailgun) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return fmt.Errorf("%w: invalid recipient %q", ErrInvalidMessage, msg.To)
+	}
+
+	form := url.Values{
+		"from":    {m.cfg.From},
+		"to":      {msg.To},
+		"subject": {msg.Subject},
+		"text":    {msg.Body},
+	}
+	endpoint := fmt.Sprintf("%s/v3/%s/messages", m.cfg.APIBase, url.PathEscape(m.cfg.Domain))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("api", m.cfg.APIKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doProviderRequest(m.client, req, "mailgun")
+}
+
+// doProviderRequest sends an API request and maps the status code to an error.
+// Client errors other than 429 are permanent: retrying would fail the same way
+func doProviderRequest(client *http.Client, req *http.Request, provider string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("mailer: %s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("mailer: %s: HTTP %d: %s", provider, resp.StatusCode, strings.TrimSpace(string(detail)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	return err
+}
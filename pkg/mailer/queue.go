@@ -0,0 +1,172 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"qr-menu/logger"
+	"qr-menu/pkg/metrics"
+)
+
+// Errors returned by Queue.Send
+var (
+	ErrQueueFull   = errors.New("email queue is full")
+	ErrQueueClosed = errors.New("email queue is closed")
+)
+
+var (
+	queueDepth = metrics.NewGauge("qrmenu_notification_queue_depth",
+		"Emails waiting in the send queue or being delivered.")
+	deliveries = metrics.NewCounter("qrmenu_email_deliveries_total",
+		"Email delivery attempts by result (sent, retry or failed).", "result")
+)
+
+// QueueConfig holds the send queue configuration
+type QueueConfig struct {
+	Workers    int           // Concurrent deliveries
+	Size       int           // Messages waiting before Send returns ErrQueueFull
+	MaxRetries int           // Further attempts after the first failure
+	RetryDelay time.Duration // Delay before the first retry, doubled at each attempt
+}
+
+type queuedMessage struct {
+	msg     Message
+	request logger.RequestInfo
+}
+
+// Queue delivers messages in the background through another Mailer, retrying
+// temporary failures with exponential backoff. Send only enqueues the message
+type Queue struct {
+	next Mailer
+	cfg  QueueConfig
+	jobs chan queuedMessage
+	stop chan struct{} // Closed when Close gives up waiting: pending retries are dropped
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewQueue starts cfg.Workers goroutines delivering through next
+func NewQueue(next Mailer, cfg QueueConfig) *Queue {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.Size <= 0 {
+		cfg.Size = 100
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = 10 * time.Second
+	}
+
+	q := &Queue{
+		next: next,
+		cfg:  cfg,
+		jobs: make(chan queuedMessage, cfg.Size),
+		stop: make(chan struct{}),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	return q
+}
+
+// Send validates and enqueues the message. Delivery errors are only logged
+func (q *Queue) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	request, _ := logger.RequestFromContext(ctx)
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	select {
+	case q.jobs <- queuedMessage{msg: msg, request: request}:
+		queueDepth.Inc()
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Usage returns the messages waiting to be delivered and the queue size. Messages being
+// delivered, including the ones waiting for a retry, are not counted
+func (q *Queue) Usage() (queued, size int) {
+	return len(q.jobs), cap(q.jobs)
+}
+
+// Close stops accepting messages and waits until the queued ones are delivered or
+// ctx expires, in which case pending retries are abandoned
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.jobs)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		close(q.stop)
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+	for job := range q.jobs {
+		q.deliver(job)
+		queueDepth.Dec()
+	}
+}
+
+// deliver sends one message, retrying temporary failures up to cfg.MaxRetries times
+func (q *Queue) deliver(job queuedMessage) {
+	ctx := logger.WithRequest(context.Background(), job.request)
+	delay := q.cfg.RetryDelay
+
+	for attempt := 0; ; attempt++ {
+		err := q.next.Send(ctx, job.msg)
+		if err == nil {
+			deliveries.Inc("sent")
+			return
+		}
+
+		data := map[string]interface{}{
+			"error":   err.Error(),
+			"to":      job.msg.To,
+			"subject": job.msg.Subject,
+			"attempt": attempt + 1,
+		}
+		if attempt >= q.cfg.MaxRetries || errors.Is(err, ErrPermanent) || errors.Is(err, ErrInvalidMessage) {
+			deliveries.Inc("failed")
+			logger.ErrorCtx(ctx, "Email non consegnata", data)
+			return
+		}
+		deliveries.Inc("retry")
+		data["retry_in"] = delay.String()
+		logger.WarnCtx(ctx, "Invio email fallito, nuovo tentativo", data)
+
+		select {
+		case <-time.After(delay):
+		case <-q.stop:
+			deliveries.Inc("failed")
+			logger.ErrorCtx(ctx, "Email non consegnata: coda chiusa durante i tentativi", data)
+			return
+		}
+		delay *= 2
+	}
+}
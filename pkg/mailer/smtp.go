@@ -0,0 +1,134 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP delivers messages through an SMTP server, upgrading the connection with
+// STARTTLS when the server supports it (or using implicit TLS on port 465)
+type SMTP struct {
+	cfg Config
+}
+
+// Send delivers the message, opening a new connection for each message
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	if err := msg.validate(); err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("mailer: invalid sender %q: %w", s.cfg.From, err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("%w: invalid recipient %q", ErrInvalidMessage, msg.To)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("mailer: connect to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: s.cfg.Host}
+	if s.cfg.Port == 465 {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mailer: handshake with %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && s.cfg.Port != 465 {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("mailer: starttls: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		auth := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return smtpError("auth", err)
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return smtpError("MAIL FROM", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return smtpError("RCPT TO", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("mailer: DATA: %w", err)
+	}
+	if _, err := w.Write(compose(from, to, msg, time.Now())); err != nil {
+		w.Close()
+		return fmt.Errorf("mailer: write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mailer: send message: %w", err)
+	}
+	return client.Quit()
+}
+
+// smtpError wraps err, marking 5xx replies (e.g. unknown recipient, bad credentials) as permanent
+func smtpError(step string, err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return fmt.Errorf("%w: mailer: %s: %w", ErrPermanent, step, err)
+	}
+	return fmt.Errorf("mailer: %s: %w", step, err)
+}
+
+// compose renders the message as a UTF-8 plain-text RFC 5322 message with CRLF line endings
+func compose(from, to *mail.Address, msg Message, now time.Time) []byte {
+	id := make([]byte, 16)
+	rand.Read(id)
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=UTF-8")
+	header("Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	if !strings.HasSuffix(body, "\n") {
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,96 @@
+// Package memstore provides a concurrency-safe in-memory map for state that a single
+// instance keeps outside the database: rate limit windows, short-lived tokens, pending
+// requests. Every access goes through a sync.RWMutex, so handlers and background jobs
+// can share a Map without their own locking.
+package memstore
+
+import "sync"
+
+// Map is a map guarded by a sync.RWMutex. The zero value is not usable: create one with New
+type Map[K comparable, V any] struct {
+	mu    sync.RWMutex
+	items map[K]V
+}
+
+// New creates an empty Map
+func New[K comparable, V any]() *Map[K, V] {
+	return &Map[K, V]{items: make(map[K]V)}
+}
+
+// Get returns the value stored for key
+func (m *Map[K, V]) Get(key K) (V, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v, ok := m.items[key]
+	return v, ok
+}
+
+// Set stores value for key, replacing any previous value
+func (m *Map[K, V]) Set(key K, value V) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = value
+}
+
+// SetIfAbsent stores value only if key has no value yet, or if replace returns true for
+// the current one. It reports whether value was stored
+func (m *Map[K, V]) SetIfAbsent(key K, value V, replace func(current V) bool) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if current, ok := m.items[key]; ok && (replace == nil || !replace(current)) {
+		return false
+	}
+	m.items[key] = value
+	return true
+}
+
+// Update replaces the value of key with the result of fn, which receives the current
+// value and whether it exists. Read and write happen under the same lock, so concurrent
+// updates of a counter or a slice are never lost. It returns the stored value
+func (m *Map[K, V]) Update(key K, fn func(current V, exists bool) V) V {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.items[key]
+	next := fn(current, ok)
+	m.items[key] = next
+	return next
+}
+
+// Delete removes key
+func (m *Map[K, V]) Delete(key K) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, key)
+}
+
+// DeleteFunc removes the entries for which del returns true and returns how many were removed
+func (m *Map[K, V]) DeleteFunc(del func(key K, value V) bool) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	for k, v := range m.items {
+		if del(k, v) {
+			delete(m.items, k)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Len returns the number of entries
+func (m *Map[K, V]) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.items)
+}
+
+// Snapshot returns a copy of the entries, safe to iterate while the Map keeps changing
+func (m *Map[K, V]) Snapshot() map[K]V {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[K]V, len(m.items))
+	for k, v := range m.items {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,120 @@
+package memstore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestGetSetDelete(t *testing.T) {
+	m := New[string, int]()
+	if _, ok := m.Get("a"); ok {
+		t.Fatal("empty map should not contain a")
+	}
+	m.Set("a", 1)
+	if v, ok := m.Get("a"); !ok || v != 1 {
+		t.Errorf("Get(a) = %d, %v", v, ok)
+	}
+	m.Delete("a")
+	if m.Len() != 0 {
+		t.Errorf("Len = %d after Delete", m.Len())
+	}
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	m := New[string, string]()
+	if !m.SetIfAbsent("user", "scheduled", nil) {
+		t.Fatal("first SetIfAbsent should store the value")
+	}
+	if m.SetIfAbsent("user", "scheduled", nil) {
+		t.Error("SetIfAbsent without replace should keep the existing value")
+	}
+	cancelled := func(current string) bool { return current == "cancelled" }
+	if m.SetIfAbsent("user", "again", cancelled) {
+		t.Error("replace returned false: value should be kept")
+	}
+	m.Set("user", "cancelled")
+	if !m.SetIfAbsent("user", "again", cancelled) {
+		t.Error("replace returned true: value should be stored")
+	}
+	if v, _ := m.Get("user"); v != "again" {
+		t.Errorf("Get = %q, want again", v)
+	}
+}
+
+func TestDeleteFuncAndSnapshot(t *testing.T) {
+	m := New[int, int]()
+	for i := 0; i < 10; i++ {
+		m.Set(i, i*i)
+	}
+	snapshot := m.Snapshot()
+	if removed := m.DeleteFunc(func(k, _ int) bool { return k%2 == 0 }); removed != 5 {
+		t.Errorf("DeleteFunc removed %d, want 5", removed)
+	}
+	if m.Len() != 5 || len(snapshot) != 10 {
+		t.Errorf("Len = %d, snapshot = %d: the snapshot must not change", m.Len(), len(snapshot))
+	}
+}
+
+// TestConcurrentUpdate must be run with -race: counters updated from many goroutines
+// must neither race nor lose increments
+func TestConcurrentUpdate(t *testing.T) {
+	const goroutines, increments = 32, 500
+	m := New[string, int]()
+	increment := func(current int, _ bool) int { return current + 1 }
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			key := fmt.Sprintf("ip-%d", g%4)
+			for i := 0; i < increments; i++ {
+				m.Update(key, increment)
+				m.Get(key)
+				m.Len()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, v := range m.Snapshot() {
+		total += v
+	}
+	if total != goroutines*increments {
+		t.Errorf("total = %d, want %d", total, goroutines*increments)
+	}
+}
+
+func TestConcurrentAppendAndPrune(t *testing.T) {
+	m := New[string, []int]()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				m.Update(fmt.Sprint(i%10), func(current []int, _ bool) []int { return append(current, g) })
+			}
+		}(g)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				m.DeleteFunc(func(_ string, v []int) bool { return len(v) > 1000 })
+				for _, v := range m.Snapshot() {
+					_ = len(v)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for _, v := range m.Snapshot() {
+		total += len(v)
+	}
+	if total != 8*200 {
+		t.Errorf("appended %d values, want %d", total, 8*200)
+	}
+}
@@ -0,0 +1,107 @@
+// Package menutemplates provides the starter menu catalogs shipped with the application
+// (pizzeria, sushi, café), used to create a new menu without starting from scratch.
+package menutemplates
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+)
+
+//go:embed catalog/*.json
+var catalogFS embed.FS
+
+// Item is a dish of a starter template
+type Item struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Price       float64  `json:"price"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// Category is a group of dishes of a starter template
+type Category struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Items       []Item `json:"items"`
+}
+
+// Template is a starter menu. IDs are short lowercase names (e.g. "pizzeria") and never
+// collide with the UUIDs of the templates saved by restaurants
+type Template struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	MealType    string     `json:"meal_type"`
+	Categories  []Category `json:"categories"`
+}
+
+// ItemCount returns the number of dishes in the template
+func (t Template) ItemCount() int {
+	count := 0
+	for _, category := range t.Categories {
+		count += len(category.Items)
+	}
+	return count
+}
+
+var catalog = mustLoad()
+
+// All returns the starter templates sorted by name
+func All() []Template {
+	return append([]Template(nil), catalog...)
+}
+
+// Get returns the starter template with the given ID
+func Get(id string) (Template, bool) {
+	for _, template := range catalog {
+		if template.ID == id {
+			return template, true
+		}
+	}
+	return Template{}, false
+}
+
+// mustLoad parses the embedded catalog. The files are part of the binary, so a broken
+// file is a build defect and panics at startup
+func mustLoad() []Template {
+	templates, err := load()
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+func load() ([]Template, error) {
+	files, err := catalogFS.ReadDir("catalog")
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]Template, 0, len(files))
+	seen := make(map[string]bool, len(files))
+	for _, file := range files {
+		name := path.Join("catalog", file.Name())
+		data, err := catalogFS.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		var template Template
+		if err := json.Unmarshal(data, &template); err != nil {
+			return nil, fmt.Errorf("menutemplates: %s: %w", name, err)
+		}
+		if template.ID == "" || template.Name == "" || len(template.Categories) == 0 {
+			return nil, fmt.Errorf("menutemplates: %s: id, name and categories are required", name)
+		}
+		if seen[template.ID] {
+			return nil, fmt.Errorf("menutemplates: %s: duplicate id %q", name, template.ID)
+		}
+		seen[template.ID] = true
+		templates = append(templates, template)
+	}
+
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
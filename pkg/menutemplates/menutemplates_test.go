@@ -0,0 +1,45 @@
+package menutemplates
+
+import "testing"
+
+func TestCatalog(t *testing.T) {
+	templates := All()
+	if len(templates) < 3 {
+		t.Fatalf("expected at least 3 starter templates, got %d", len(templates))
+	}
+	for i, template := range templates {
+		if i > 0 && templates[i-1].Name > template.Name {
+			t.Errorf("templates not sorted by name: %q before %q", templates[i-1].Name, template.Name)
+		}
+		if template.ItemCount() == 0 {
+			t.Errorf("%s: no items", template.ID)
+		}
+		for _, category := range template.Categories {
+			if category.Name == "" {
+				t.Errorf("%s: category without name", template.ID)
+			}
+			for _, item := range category.Items {
+				if item.Name == "" || item.Price < 0 {
+					t.Errorf("%s/%s: invalid item %+v", template.ID, category.Name, item)
+				}
+			}
+		}
+	}
+
+	for _, id := range []string{"pizzeria", "sushi", "cafe"} {
+		if _, ok := Get(id); !ok {
+			t.Errorf("starter template %q not found", id)
+		}
+	}
+	if _, ok := Get("missing"); ok {
+		t.Error("Get(missing) should fail")
+	}
+}
+
+func TestAllReturnsCopy(t *testing.T) {
+	templates := All()
+	templates[0].Name = "changed"
+	if All()[0].Name == "changed" {
+		t.Error("All must not expose the shared catalog")
+	}
+}
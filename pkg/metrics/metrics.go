@@ -0,0 +1,177 @@
+// Package metrics registers the Prometheus counters, gauges and histograms of the
+// application on top of client_golang, with label values passed positionally at each call.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DefaultBuckets are the histogram buckets, in seconds, used for request latencies
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds metric families. Registering a name twice panics
+type Registry struct {
+	reg *prometheus.Registry
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{reg: prometheus.NewRegistry()}
+}
+
+// Default is the registry served by Handler, with the Go runtime and process metrics.
+// Packages register their metrics on it at init
+var Default = newDefaultRegistry()
+
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return r
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func (r *Registry) Handler() http.Handler {
+	h := promhttp.HandlerFor(r.reg, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		h.ServeHTTP(w, req)
+	})
+}
+
+// Handler serves the Default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// Counter is a monotonically increasing value, optionally partitioned by labels
+type Counter struct {
+	vec *prometheus.CounterVec
+}
+
+// NewCounter registers a counter on r
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)}
+	r.reg.MustRegister(c.vec)
+	// Metrics without labels are exported as 0 from the start
+	if len(labels) == 0 {
+		c.vec.WithLabelValues()
+	}
+	return c
+}
+
+// NewCounter registers a counter on the Default registry
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// Inc adds one to the series identified by labelValues
+func (c *Counter) Inc(labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Inc()
+}
+
+// Add adds delta, which must not be negative, to the series identified by labelValues
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+// Gauge is a value that can go up and down, optionally partitioned by labels
+type Gauge struct {
+	vec *prometheus.GaugeVec
+}
+
+// NewGauge registers a gauge on r
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)}
+	r.reg.MustRegister(g.vec)
+	if len(labels) == 0 {
+		g.vec.WithLabelValues()
+	}
+	return g
+}
+
+// NewGauge registers a gauge on the Default registry
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// Set sets the series identified by labelValues
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Set(value)
+}
+
+// Add adds delta (possibly negative) to the series identified by labelValues
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+// Inc adds one to the series identified by labelValues
+func (g *Gauge) Inc(labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Inc()
+}
+
+// Dec subtracts one from the series identified by labelValues
+func (g *Gauge) Dec(labelValues ...string) {
+	g.vec.WithLabelValues(labelValues...).Dec()
+}
+
+// NewGaugeFunc registers on r a gauge computed by fn at every scrape
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, fn))
+}
+
+// NewGaugeFunc registers on the Default registry a gauge computed by fn at every scrape
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.NewGaugeFunc(name, help, fn)
+}
+
+// Histogram counts observations in cumulative buckets, optionally partitioned by labels
+type Histogram struct {
+	vec *prometheus.HistogramVec
+}
+
+// NewHistogram registers a histogram on r. Nil buckets means DefaultBuckets
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{vec: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: buckets}, labels)}
+	r.reg.MustRegister(h.vec)
+	return h
+}
+
+// NewHistogram registers a histogram on the Default registry
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// Observe records value in the series identified by labelValues
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.vec.WithLabelValues(labelValues...).Observe(value)
+}
+
+// ObserveDuration records the time elapsed since start, in seconds
+func (h *Histogram) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// cacheRequests counts lookups in the application caches, see CacheLookup
+var cacheRequests = NewCounter("qrmenu_cache_requests_total",
+	"Lookups in application caches by cache and result (hit or miss).", "cache", "result")
+
+// CacheLookup records a hit or miss of the named cache. The hit rate is
+// rate(qrmenu_cache_requests_total{result="hit"}) / rate(qrmenu_cache_requests_total)
+func CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequests.Inc(cache, result)
+}
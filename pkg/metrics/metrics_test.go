@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestExposition tests the text format of every metric type
+func TestExposition(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("http_requests_total", "Requests.", "route", "status")
+	depth := r.NewGauge("queue_depth", "Queued jobs.")
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	r.NewGaugeFunc("answer", "The answer.", func() float64 { return 42 })
+
+	requests.Inc("/menu/{id}", "200")
+	requests.Add(2, "/menu/{id}", "200")
+	requests.Inc(`/quote"d`, "500")
+	depth.Inc()
+	depth.Inc()
+	depth.Dec()
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.5, "/a")
+	latency.Observe(3, "/a")
+
+	text := scrape(t, r.Handler())
+
+	for _, want := range []string{
+		"# TYPE http_requests_total counter\n",
+		`http_requests_total{route="/menu/{id}",status="200"} 3` + "\n",
+		`http_requests_total{route="/quote\"d",status="500"} 1` + "\n",
+		"# TYPE queue_depth gauge\nqueue_depth 1\n",
+		"# TYPE latency_seconds histogram\n",
+		`latency_seconds_bucket{route="/a",le="0.1"} 1` + "\n",
+		`latency_seconds_bucket{route="/a",le="1"} 2` + "\n",
+		`latency_seconds_bucket{route="/a",le="+Inf"} 3` + "\n",
+		`latency_seconds_sum{route="/a"} 3.55` + "\n",
+		`latency_seconds_count{route="/a"} 3` + "\n",
+		"answer 42\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, text)
+		}
+	}
+
+}
+
+// scrape returns the text exposition served by h
+func scrape(t *testing.T, h http.Handler) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+	return rec.Body.String()
+}
+
+// TestRegistryPanics tests duplicate names, wrong label counts and decreasing counters
+func TestRegistryPanics(t *testing.T) {
+	expectPanic := func(name string, fn func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s: expected panic", name)
+			}
+		}()
+		fn()
+	}
+
+	r := NewRegistry()
+	c := r.NewCounter("c_total", "C.", "a")
+	expectPanic("duplicate", func() { r.NewGauge("c_total", "C.") })
+	expectPanic("labels", func() { c.Inc() })
+	expectPanic("decrease", func() { c.Add(-1, "x") })
+}
+
+// TestHandler tests the HTTP endpoint and the metrics of the Default registry
+func TestHandler(t *testing.T) {
+	CacheLookup("test", true)
+	CacheLookup("test", false)
+	CacheLookup("test", true)
+
+	h := NewHistogram("test_duration_seconds", "Test.", nil)
+	h.ObserveDuration(time.Now().Add(-2 * time.Second))
+
+	body := scrape(t, Handler())
+	for _, want := range []string{
+		`qrmenu_cache_requests_total{cache="test",result="hit"} 2`,
+		`qrmenu_cache_requests_total{cache="test",result="miss"} 1`,
+		`test_duration_seconds_bucket{le="2.5"} 1`,
+		"go_goroutines ",
+		"process_start_time_seconds ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected %q in:\n%s", want, body)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package middleware
 import (
 	"bytes"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 	"time"
 
@@ -10,12 +12,25 @@ import (
 	"qr-menu/pkg/cache"
 )
 
+// CachePolicy configures the response cache for the routes under a path prefix
+type CachePolicy struct {
+	TTL         time.Duration // Overrides the default TTL when positive
+	NoStore     bool          // Never cache the responses
+	VaryHeaders []string      // Request headers selecting a variant, e.g. Accept-Language
+	QueryParams []string      // Query parameters that are part of the key; nil keeps them all
+	PerSubject  bool          // Cache authenticated requests, with a variant per subject
+}
+
 // ResponseCachingMiddleware creates a middleware that caches HTTP responses
 type ResponseCachingMiddleware struct {
 	cache            *cache.ResponseCache
 	cacheTTL         time.Duration
 	cacheableStatus  map[int]bool
 	cacheableMethods map[string]bool
+	policies         map[string]CachePolicy
+	prefixes         []string // Policy prefixes, longest first
+	subject          func(r *http.Request) string
+	subjectVary      []string // Request headers carrying the subject, sent in Vary
 }
 
 // NewResponseCachingMiddleware creates a new response caching middleware
@@ -33,6 +48,93 @@ func NewResponseCachingMiddleware(c *cache.ResponseCache, ttl time.Duration) *Re
 			"GET":  true,
 			"HEAD": true,
 		},
+		policies:    make(map[string]CachePolicy),
+		subject:     RequestSubject,
+		subjectVary: []string{"Authorization", "X-API-Key"},
+	}
+}
+
+// SetPolicy sets the policy of the routes under a path prefix; the longest matching prefix wins
+func (rcm *ResponseCachingMiddleware) SetPolicy(prefix string, policy CachePolicy) {
+	if _, exists := rcm.policies[prefix]; !exists {
+		rcm.prefixes = append(rcm.prefixes, prefix)
+		sort.Slice(rcm.prefixes, func(i, j int) bool { return len(rcm.prefixes[i]) > len(rcm.prefixes[j]) })
+	}
+	rcm.policies[prefix] = policy
+}
+
+// Policy returns the policy applied to a path
+func (rcm *ResponseCachingMiddleware) Policy(path string) CachePolicy {
+	for _, prefix := range rcm.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return rcm.policies[prefix]
+		}
+	}
+	return CachePolicy{}
+}
+
+// SetSubjectFunc sets how the authenticated subject of a request is identified, and the
+// request headers it reads, which PerSubject responses list in Vary. Requests with a
+// subject are cached only on routes with a PerSubject policy
+func (rcm *ResponseCachingMiddleware) SetSubjectFunc(subject func(r *http.Request) string, vary ...string) {
+	rcm.subject = subject
+	rcm.subjectVary = vary
+}
+
+// RequestSubject identifies the credentials of a request: the Authorization header or the
+// API key. Anonymous requests have no subject
+func RequestSubject(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		return auth
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// cacheKey builds the key of the response variant requested by r
+func (rcm *ResponseCachingMiddleware) cacheKey(r *http.Request, policy CachePolicy, subject string) string {
+	// Sorted parameters, so that ?a=1&b=2 and ?b=2&a=1 share the entry
+	query := r.URL.Query()
+	if policy.QueryParams != nil {
+		kept := url.Values{}
+		for _, name := range policy.QueryParams {
+			if values, ok := query[name]; ok {
+				kept[name] = values
+			}
+		}
+		query = kept
+	}
+
+	var vary []string
+	for _, header := range policy.VaryHeaders {
+		vary = append(vary, strings.ToLower(header)+"="+r.Header.Get(header))
+	}
+	if policy.PerSubject && subject != "" {
+		vary = append(vary, "subject="+subject)
+	}
+	return cache.GenerateVariantCacheKey(r.Method, r.URL.Path, query.Encode(), vary...)
+}
+
+// storable reports whether the handler allows caching the response: no-store always opts
+// out, private only when the entry would be shared between subjects. Responses setting a
+// cookie are never stored, as replaying them would hand the cookie to other clients
+func storable(header http.Header, policy CachePolicy) bool {
+	if len(header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	control := strings.ToLower(header.Get("Cache-Control"))
+	if strings.Contains(control, "no-store") {
+		return false
+	}
+	return policy.PerSubject || !strings.Contains(control, "private")
+}
+
+// NoCache marks a handler whose responses must never be cached, such as an authenticated
+// endpoint returning per-user data. The response carries Cache-Control: no-store, which
+// also keeps browsers and proxies from storing it
+func NoCache(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		next(w, r)
 	}
 }
 
@@ -46,8 +148,16 @@ func (rcm *ResponseCachingMiddleware) Middleware() Middleware {
 				return
 			}
 
+			policy := rcm.Policy(r.URL.Path)
+			subject := rcm.subject(r)
+			// Authenticated responses are shared only on routes that vary by subject
+			if policy.NoStore || (subject != "" && !policy.PerSubject) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// Check for cache hit
-			cacheKey := cache.GenerateResponseCacheKey(r.Method, r.URL.Path, r.URL.RawQuery)
+			cacheKey := rcm.cacheKey(r, policy, subject)
 			if cachedResp, exists := rcm.cache.GetCachedResponse(cacheKey); exists {
 				// Write cached response
 				for key, values := range cachedResp.Headers {
@@ -69,6 +179,16 @@ func (rcm *ResponseCachingMiddleware) Middleware() Middleware {
 				return
 			}
 
+			// Tell downstream caches which request headers select the variant
+			for _, header := range policy.VaryHeaders {
+				w.Header().Add("Vary", header)
+			}
+			if policy.PerSubject {
+				for _, header := range rcm.subjectVary {
+					w.Header().Add("Vary", header)
+				}
+			}
+
 			// Wrap response writer to capture response
 			wrapped := &responseCapture{
 				ResponseWriter: w,
@@ -79,14 +199,18 @@ func (rcm *ResponseCachingMiddleware) Middleware() Middleware {
 			next.ServeHTTP(wrapped, r)
 
 			// Cache the response if cacheable
-			if rcm.cacheableStatus[wrapped.statusCode] {
+			if rcm.cacheableStatus[wrapped.statusCode] && storable(wrapped.Header(), policy) {
+				ttl := rcm.cacheTTL
+				if policy.TTL > 0 {
+					ttl = policy.TTL
+				}
 				cachedResp := &cache.CachedResponse{
 					StatusCode: wrapped.statusCode,
-					Headers:    wrapped.Header(),
+					Headers:    wrapped.Header().Clone(),
 					Body:       wrapped.body.Bytes(),
 				}
 
-				rcm.cache.SetCachedResponse(cacheKey, cachedResp, rcm.cacheTTL)
+				rcm.cache.SetCachedResponse(cacheKey, cachedResp, ttl)
 
 				w.Header().Set("X-Cache", "MISS")
 				logger.Debug("Response cached", map[string]interface{}{
@@ -94,7 +218,7 @@ func (rcm *ResponseCachingMiddleware) Middleware() Middleware {
 					"path":    r.URL.Path,
 					"status":  wrapped.statusCode,
 					"size":    len(wrapped.body.Bytes()),
-					"ttl_sec": int(rcm.cacheTTL.Seconds()),
+					"ttl_sec": int(ttl.Seconds()),
 				})
 			}
 		})
@@ -333,6 +333,140 @@ func TestResponseCachingMiddlewareWithHeaders(t *testing.T) {
 	}
 }
 
+// countingHandler echoes the Accept-Language header and counts its calls
+func countingHandler(calls *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("lang: " + r.Header.Get("Accept-Language")))
+	}
+}
+
+// TestResponseCachingMiddlewareVaryHeaders tests that each language gets its own entry
+func TestResponseCachingMiddlewareVaryHeaders(t *testing.T) {
+	middleware := NewResponseCachingMiddleware(cache.NewResponseCache(cache.NewInMemoryCache()), time.Hour)
+	middleware.SetPolicy("/api/v1/i18n", CachePolicy{VaryHeaders: []string{"Accept-Language"}})
+
+	calls := 0
+	wrapped := middleware.Middleware()(countingHandler(&calls))
+
+	for _, lang := range []string{"it", "en", "it"} {
+		req := httptest.NewRequest("GET", "/api/v1/i18n/translations", nil)
+		req.Header.Set("Accept-Language", lang)
+		w := httptest.NewRecorder()
+		wrapped.ServeHTTP(w, req)
+
+		if w.Body.String() != "lang: "+lang {
+			t.Errorf("Expected response for %s, got %s", lang, w.Body.String())
+		}
+		if w.Header().Get("Vary") != "Accept-Language" {
+			t.Errorf("Expected Vary: Accept-Language, got %q", w.Header().Get("Vary"))
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 handler calls (one per language), got %d", calls)
+	}
+}
+
+// TestResponseCachingMiddlewareSubjects tests that authenticated responses are shared only
+// on routes with a per-subject policy
+func TestResponseCachingMiddlewareSubjects(t *testing.T) {
+	middleware := NewResponseCachingMiddleware(cache.NewResponseCache(cache.NewInMemoryCache()), time.Hour)
+	middleware.SetPolicy("/api/v1/analytics", CachePolicy{PerSubject: true})
+
+	calls := 0
+	wrapped := middleware.Middleware()(countingHandler(&calls))
+	request := func(path, token string) {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		wrapped.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// No per-subject policy: authenticated requests are never cached
+	request("/api/users", "alice")
+	request("/api/users", "alice")
+	if calls != 2 {
+		t.Errorf("Expected authenticated requests not to be cached, got %d calls", calls)
+	}
+
+	calls = 0
+	request("/api/v1/analytics/stats", "alice")
+	request("/api/v1/analytics/stats", "bob")
+	request("/api/v1/analytics/stats", "alice")
+	if calls != 2 {
+		t.Errorf("Expected one entry per subject, got %d calls", calls)
+	}
+}
+
+// TestResponseCachingMiddlewareOptOut tests NoStore policies and the NoCache annotation
+func TestResponseCachingMiddlewareOptOut(t *testing.T) {
+	middleware := NewResponseCachingMiddleware(cache.NewResponseCache(cache.NewInMemoryCache()), time.Hour)
+	middleware.SetPolicy("/api/admin", CachePolicy{NoStore: true})
+
+	calls := 0
+	wrapped := middleware.Middleware()(countingHandler(&calls))
+	annotated := middleware.Middleware()(NoCache(countingHandler(&calls)))
+
+	for i := 0; i < 2; i++ {
+		wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/admin/database/stats", nil))
+		w := httptest.NewRecorder()
+		annotated.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/analytics/export", nil))
+		if w.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("Expected Cache-Control: no-store, got %q", w.Header().Get("Cache-Control"))
+		}
+	}
+	if calls != 4 {
+		t.Errorf("Expected every request to reach the handler, got %d calls", calls)
+	}
+
+	// A response setting a cookie belongs to the client that received it
+	calls = 0
+	withCookie := middleware.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Write([]byte("ok"))
+	}))
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		withCookie.ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+		if w.Header().Get("Set-Cookie") == "" {
+			t.Error("Expected every response to carry its own cookie")
+		}
+	}
+	if calls != 2 {
+		t.Errorf("Expected responses with Set-Cookie not to be cached, got %d calls", calls)
+	}
+}
+
+// TestResponseCachingMiddlewarePolicyTTL tests per-route TTLs and query normalization
+func TestResponseCachingMiddlewarePolicyTTL(t *testing.T) {
+	middleware := NewResponseCachingMiddleware(cache.NewResponseCache(cache.NewInMemoryCache()), time.Hour)
+	middleware.SetPolicy("/api", CachePolicy{TTL: time.Minute})
+	middleware.SetPolicy("/api/live", CachePolicy{TTL: 20 * time.Millisecond, QueryParams: []string{"page"}})
+
+	if got := middleware.Policy("/api/live/feed").TTL; got != 20*time.Millisecond {
+		t.Errorf("Expected the longest prefix to win, got TTL %v", got)
+	}
+
+	calls := 0
+	wrapped := middleware.Middleware()(countingHandler(&calls))
+	request := func(target string) {
+		wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	request("/api/live/feed?page=1&_=123")
+	request("/api/live/feed?_=456&page=1")
+	if calls != 1 {
+		t.Errorf("Expected parameters outside the policy to be ignored, got %d calls", calls)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	request("/api/live/feed?page=1")
+	if calls != 2 {
+		t.Errorf("Expected the entry to expire after the route TTL, got %d calls", calls)
+	}
+}
+
 // BenchmarkResponseCachingMiddlewareHit benchmarks cache hit
 func BenchmarkResponseCachingMiddlewareHit(b *testing.B) {
 	baseCache := cache.NewInMemoryCache()
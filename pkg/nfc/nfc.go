@@ -0,0 +1,90 @@
+// Package nfc encodes the NDEF messages written on the NFC table tags: a single URI record
+// that opens the menu when a phone touches the tag. Writer apps accept the raw message; tags
+// programmed byte by byte (NFC Forum Type 2, e.g. NTAG21x) need it wrapped in a TLV block.
+package nfc
+
+import (
+	"errors"
+	"strings"
+)
+
+// uriPrefixes are the abbreviations of the NFC Forum URI record type, by identifier code.
+// Only the prefixes of web links are listed
+var uriPrefixes = []struct {
+	code   byte
+	prefix string
+}{
+	{0x02, "https://www."},
+	{0x01, "http://www."},
+	{0x04, "https://"},
+	{0x03, "http://"},
+}
+
+// Chip is a common NFC tag chip and its user memory, in bytes
+type Chip struct {
+	Name     string `json:"name"`
+	Capacity int    `json:"capacity"`
+}
+
+// Chips are the common chips of table tags, from the smallest
+var Chips = []Chip{
+	{Name: "NTAG213", Capacity: 144},
+	{Name: "NTAG215", Capacity: 504},
+	{Name: "NTAG216", Capacity: 888},
+}
+
+// ErrEmptyURI is returned for an empty URI
+var ErrEmptyURI = errors.New("nfc: empty URI")
+
+// URIMessage returns the NDEF message with a single URI record for uri
+func URIMessage(uri string) ([]byte, error) {
+	if uri == "" {
+		return nil, ErrEmptyURI
+	}
+	code := byte(0x00)
+	for _, p := range uriPrefixes {
+		if strings.HasPrefix(uri, p.prefix) {
+			code, uri = p.code, uri[len(p.prefix):]
+			break
+		}
+	}
+	payload := append([]byte{code}, uri...)
+
+	// Header: message begin, message end, NFC Forum well-known type; short records have a
+	// one byte payload length
+	header := byte(0x80 | 0x40 | 0x01)
+	msg := []byte{header, 1}
+	if len(payload) <= 0xff {
+		msg[0] |= 0x10
+		msg = append(msg, byte(len(payload)))
+	} else {
+		n := len(payload)
+		msg = append(msg, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	msg = append(msg, 'U')
+	return append(msg, payload...), nil
+}
+
+// Type2TLV wraps an NDEF message in the NDEF Message TLV and Terminator TLV written to the
+// user memory of Type 2 tags
+func Type2TLV(message []byte) []byte {
+	var out []byte
+	if len(message) < 0xff {
+		out = []byte{0x03, byte(len(message))}
+	} else {
+		out = []byte{0x03, 0xff, byte(len(message) >> 8), byte(len(message))}
+	}
+	out = append(out, message...)
+	return append(out, 0xfe)
+}
+
+// Fits returns the chips whose user memory holds size bytes
+func Fits(size int) []Chip {
+	var out []Chip
+	for _, c := range Chips {
+		if size <= c.Capacity {
+			out = append(out, c)
+		}
+	}
+	return out
+}
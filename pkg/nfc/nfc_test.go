@@ -0,0 +1,60 @@
+package nfc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestURIMessage(t *testing.T) {
+	msg, err := URIMessage("https://qr.example.com/n/ABCD2345")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := append([]byte{0x04}, "qr.example.com/n/ABCD2345"...)
+	want := append([]byte{0xd1, 0x01, byte(len(payload)), 'U'}, payload...)
+	if !bytes.Equal(msg, want) {
+		t.Fatalf("URIMessage = % x, want % x", msg, want)
+	}
+
+	msg, _ = URIMessage("https://www.example.com")
+	if msg[4] != 0x02 || string(msg[5:]) != "example.com" {
+		t.Errorf("www prefix not abbreviated: % x", msg)
+	}
+	msg, _ = URIMessage("tel:+39061234567")
+	if msg[4] != 0x00 || string(msg[5:]) != "tel:+39061234567" {
+		t.Errorf("unknown prefix: % x", msg)
+	}
+
+	long := "https://example.com/" + strings.Repeat("a", 300)
+	msg, _ = URIMessage(long)
+	if msg[0] != 0xc1 || msg[2] != 0 || msg[3] != 0 || int(msg[4])<<8|int(msg[5]) != len(long)-len("https://")+1 || msg[6] != 'U' {
+		t.Errorf("long record header: % x", msg[:7])
+	}
+
+	if _, err := URIMessage(""); err != ErrEmptyURI {
+		t.Errorf("empty URI: %v", err)
+	}
+}
+
+func TestType2TLV(t *testing.T) {
+	if got := Type2TLV([]byte{1, 2, 3}); !bytes.Equal(got, []byte{0x03, 3, 1, 2, 3, 0xfe}) {
+		t.Errorf("Type2TLV = % x", got)
+	}
+	got := Type2TLV(make([]byte, 300))
+	if !bytes.Equal(got[:4], []byte{0x03, 0xff, 0x01, 0x2c}) || got[len(got)-1] != 0xfe || len(got) != 305 {
+		t.Errorf("long TLV header % x, length %d", got[:4], len(got))
+	}
+}
+
+func TestFits(t *testing.T) {
+	if got := Fits(100); len(got) != 3 {
+		t.Errorf("Fits(100) = %v", got)
+	}
+	if got := Fits(500); len(got) != 2 || got[0].Name != "NTAG215" {
+		t.Errorf("Fits(500) = %v", got)
+	}
+	if got := Fits(1000); len(got) != 0 {
+		t.Errorf("Fits(1000) = %v", got)
+	}
+}
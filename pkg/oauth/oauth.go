@@ -0,0 +1,202 @@
+// Package oauth implements the OpenID Connect authorization code flow used for social login
+// with Google and Sign in with Apple.
+//
+// The code is redeemed with golang.org/x/oauth2 and the ID token is verified with go-oidc:
+// signature against the keys published by the provider, issuer, audience and expiry, plus the
+// nonce of the login attempt.
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// Default endpoints
+const (
+	GoogleAuthURL  = "https://accounts.google.com/o/oauth2/v2/auth"
+	GoogleTokenURL = "https://oauth2.googleapis.com/token"
+	GoogleKeysURL  = "https://www.googleapis.com/oauth2/v3/certs"
+	googleIssuer   = "https://accounts.google.com"
+	AppleAuthURL   = "https://appleid.apple.com/auth/authorize"
+	AppleTokenURL  = "https://appleid.apple.com/auth/token"
+	AppleKeysURL   = "https://appleid.apple.com/auth/keys"
+	appleIssuer    = "https://appleid.apple.com"
+)
+
+// ErrInvalidToken is matched (with errors.Is) by the error returned when the ID token is
+// malformed, badly signed, expired, or issued for another client or login attempt
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// Identity is the account authenticated by the provider
+type Identity struct {
+	Provider      string
+	Subject       string // Stable user ID at the provider
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an OpenID Connect provider configured with the client credentials
+type Provider struct {
+	Name     string // "google" or "apple"
+	ClientID string
+	AuthURL  string
+	TokenURL string
+	KeysURL  string // JSON Web Key Set signing the ID tokens
+	Issuer   string
+	Scopes   []string
+
+	// FormPost asks the provider to send the callback as a POST form (required by Apple
+	// when requesting the email scope)
+	FormPost bool
+
+	clientSecret func(now time.Time) (string, error)
+	client       *http.Client
+
+	verifierOnce sync.Once
+	verifier     *oidc.IDTokenVerifier
+}
+
+// NewGoogle returns the Google provider for the OAuth client credentials
+func NewGoogle(clientID, clientSecret string) *Provider {
+	return &Provider{
+		Name:         "google",
+		ClientID:     clientID,
+		AuthURL:      GoogleAuthURL,
+		TokenURL:     GoogleTokenURL,
+		KeysURL:      GoogleKeysURL,
+		Issuer:       googleIssuer,
+		Scopes:       []string{"openid", "email", "profile"},
+		clientSecret: func(time.Time) (string, error) { return clientSecret, nil },
+		client:       &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// NewApple returns the Sign in with Apple provider. clientID is the Services ID, and the
+// PEM (.p8) private key identified by keyID signs the client secret for teamID
+func NewApple(clientID, teamID, keyID string, privateKeyPEM []byte) (*Provider, error) {
+	key, err := jwt.ParseECPrivateKeyFromPEM(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("oauth: parse apple private key: %w", err)
+	}
+
+	return &Provider{
+		Name:     "apple",
+		ClientID: clientID,
+		AuthURL:  AppleAuthURL,
+		TokenURL: AppleTokenURL,
+		KeysURL:  AppleKeysURL,
+		Issuer:   appleIssuer,
+		Scopes:   []string{"name", "email"},
+		FormPost: true,
+		clientSecret: func(now time.Time) (string, error) {
+			token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+				"iss": teamID,
+				"iat": now.Unix(),
+				"exp": now.Add(5 * time.Minute).Unix(),
+				"aud": appleIssuer,
+				"sub": clientID,
+			})
+			token.Header["kid"] = keyID
+			secret, err := token.SignedString(key)
+			if err != nil {
+				return "", fmt.Errorf("oauth: sign apple client secret: %w", err)
+			}
+			return secret, nil
+		},
+		client: &http.Client{Timeout: 15 * time.Second},
+	}, nil
+}
+
+// config returns the OAuth2 client configuration. The client secret is sent in the form, as
+// Apple requires
+func (p *Provider) config(secret, redirectURI string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     p.ClientID,
+		ClientSecret: secret,
+		Endpoint:     oauth2.Endpoint{AuthURL: p.AuthURL, TokenURL: p.TokenURL, AuthStyle: oauth2.AuthStyleInParams},
+		RedirectURL:  redirectURI,
+		Scopes:       p.Scopes,
+	}
+}
+
+// AuthCodeURL returns the URL of the provider's consent page. state protects the callback
+// from forgery and nonce is echoed in the ID token of this login attempt
+func (p *Provider) AuthCodeURL(state, nonce, redirectURI string) string {
+	opts := []oauth2.AuthCodeOption{oidc.Nonce(nonce)}
+	if p.FormPost {
+		opts = append(opts, oauth2.SetAuthURLParam("response_mode", "form_post"))
+	} else {
+		opts = append(opts, oauth2.SetAuthURLParam("prompt", "select_account"))
+	}
+	return p.config("", redirectURI).AuthCodeURL(state, opts...)
+}
+
+// Exchange redeems the authorization code and returns the identity in the ID token, after
+// checking that it was issued to this client for the login attempt identified by nonce
+func (p *Provider) Exchange(ctx context.Context, code, redirectURI, nonce string) (*Identity, error) {
+	secret, err := p.clientSecret(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ctx = oidc.ClientContext(ctx, p.client)
+	token, err := p.config(secret, redirectURI).Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("oauth: %s token request: %w", p.Name, err)
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, fmt.Errorf("oauth: %s token response without id_token", p.Name)
+	}
+	return p.identity(ctx, rawIDToken, nonce)
+}
+
+// idClaims are the ID token claims used for login, besides those checked by the verifier.
+// email_verified is a boolean for Google and a string for Apple
+type idClaims struct {
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"`
+	Name          string      `json:"name"`
+}
+
+// identity verifies the ID token and decodes its claims
+func (p *Provider) identity(ctx context.Context, rawIDToken, nonce string) (*Identity, error) {
+	p.verifierOnce.Do(func() {
+		// The key set is fetched with the provider's client and cached across logins
+		keys := oidc.NewRemoteKeySet(oidc.ClientContext(context.Background(), p.client), p.KeysURL)
+		p.verifier = oidc.NewVerifier(p.Issuer, keys, &oidc.Config{ClientID: p.ClientID})
+	})
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	switch {
+	case idToken.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	case idToken.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidToken)
+	}
+	var claims idClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+	return &Identity{
+		Provider:      p.Name,
+		Subject:       idToken.Subject,
+		Email:         strings.ToLower(strings.TrimSpace(claims.Email)),
+		EmailVerified: verified,
+		Name:          claims.Name,
+	}, nil
+}
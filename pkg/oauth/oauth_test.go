@@ -0,0 +1,223 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// fakeTokenEndpoint serves the token endpoint, answering the code exchange with an ID token
+// signed with a new key after calling check on the form, and the key set with that key
+func fakeTokenEndpoint(t *testing.T, claims map[string]interface{}, check func(url.Values) error) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "key-1", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.FormValue("grant_type") != "authorization_code" || r.FormValue("code") != "code-1" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		if check != nil {
+			if err := check(r.PostForm); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(claims))
+		token.Header["kid"] = "key-1"
+		idToken, _ := token.SignedString(key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// useEndpoint points the provider to the token endpoint and key set of srv
+func useEndpoint(p *Provider, srv *httptest.Server) *Provider {
+	p.TokenURL = srv.URL + "/token"
+	p.KeysURL = srv.URL + "/keys"
+	return p
+}
+
+func googleClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            "https://accounts.google.com",
+		"sub":            "1234567890",
+		"aud":            "client-id",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          "nonce-1",
+		"email":          "Mario@Example.com",
+		"email_verified": true,
+		"name":           "Mario Rossi",
+	}
+}
+
+func TestGoogleExchange(t *testing.T) {
+	srv := fakeTokenEndpoint(t, googleClaims(), func(form url.Values) error {
+		if form.Get("client_secret") != "secret" || form.Get("redirect_uri") != "https://menu.example.com/cb" {
+			return errors.New("bad client")
+		}
+		return nil
+	})
+	p := useEndpoint(NewGoogle("client-id", "secret"), srv)
+
+	identity, err := p.Exchange(context.Background(), "code-1", "https://menu.example.com/cb", "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Identity{Provider: "google", Subject: "1234567890", Email: "mario@example.com", EmailVerified: true, Name: "Mario Rossi"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestExchangeRejectsInvalidTokens(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(map[string]interface{})
+	}{
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = "other-client" }},
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"nonce mismatch", func(c map[string]interface{}) { c["nonce"] = "other" }},
+		{"missing subject", func(c map[string]interface{}) { delete(c, "sub") }},
+		{"missing expiry", func(c map[string]interface{}) { delete(c, "exp") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := googleClaims()
+			tt.modify(claims)
+			p := useEndpoint(NewGoogle("client-id", "secret"), fakeTokenEndpoint(t, claims, nil))
+
+			_, err := p.Exchange(context.Background(), "code-1", "https://menu.example.com/cb", "nonce-1")
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+// TestExchangeRejectsForgedTokens tests that an ID token is rejected when it is not signed by
+// a key of the provider's key set
+func TestExchangeRejectsForgedTokens(t *testing.T) {
+	p := useEndpoint(NewGoogle("client-id", "secret"), fakeTokenEndpoint(t, googleClaims(), nil))
+	p.KeysURL = fakeTokenEndpoint(t, googleClaims(), nil).URL + "/keys"
+
+	_, err := p.Exchange(context.Background(), "code-1", "https://menu.example.com/cb", "nonce-1")
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestExchangeTokenError(t *testing.T) {
+	p := useEndpoint(NewGoogle("client-id", "secret"), fakeTokenEndpoint(t, googleClaims(), nil))
+
+	_, err := p.Exchange(context.Background(), "expired-code", "https://menu.example.com/cb", "nonce-1")
+	var retrieveErr *oauth2.RetrieveError
+	if !errors.As(err, &retrieveErr) || retrieveErr.Response.StatusCode != http.StatusBadRequest || retrieveErr.ErrorCode != "invalid_grant" {
+		t.Errorf("err = %v, want invalid_grant", err)
+	}
+}
+
+func TestAppleExchange(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	claims := map[string]interface{}{
+		"iss":            "https://appleid.apple.com",
+		"sub":            "001234.abcdef",
+		"aud":            "com.example.menu",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          "nonce-1",
+		"email":          "abc@privaterelay.appleid.com",
+		"email_verified": "true",
+	}
+	srv := fakeTokenEndpoint(t, claims, func(form url.Values) error {
+		// The client secret is an ES256 JWT signed with the .p8 key
+		parts := strings.Split(form.Get("client_secret"), ".")
+		if len(parts) != 3 {
+			return errors.New("malformed client secret")
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if len(sig) != 64 || !ecdsa.Verify(&key.PublicKey, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+			return errors.New("bad signature")
+		}
+		header, _ := base64.RawURLEncoding.DecodeString(parts[0])
+		payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		if !strings.Contains(string(header), `"kid":"KEY123"`) || !strings.Contains(string(payload), `"iss":"TEAM123"`) ||
+			!strings.Contains(string(payload), `"sub":"com.example.menu"`) {
+			return errors.New("bad claims")
+		}
+		return nil
+	})
+
+	p, err := NewApple("com.example.menu", "TEAM123", "KEY123", keyPEM)
+	if err != nil {
+		t.Fatalf("NewApple: %v", err)
+	}
+	useEndpoint(p, srv)
+
+	identity, err := p.Exchange(context.Background(), "code-1", "https://menu.example.com/cb", "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Provider != "apple" || identity.Subject != "001234.abcdef" || !identity.EmailVerified {
+		t.Errorf("identity = %+v", *identity)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	google, _ := url.Parse(NewGoogle("client-id", "secret").AuthCodeURL("state-1", "nonce-1", "https://menu.example.com/cb"))
+	q := google.Query()
+	if q.Get("state") != "state-1" || q.Get("nonce") != "nonce-1" || q.Get("scope") != "openid email profile" ||
+		q.Get("response_type") != "code" || q.Get("prompt") != "select_account" || q.Get("response_mode") != "" {
+		t.Errorf("google auth URL = %s", google)
+	}
+
+	apple := &Provider{Name: "apple", ClientID: "com.example.menu", AuthURL: AppleAuthURL, Scopes: []string{"name", "email"}, FormPost: true}
+	parsed, _ := url.Parse(apple.AuthCodeURL("state-1", "nonce-1", "https://menu.example.com/cb"))
+	if parsed.Query().Get("response_mode") != "form_post" {
+		t.Errorf("apple auth URL = %s", parsed)
+	}
+}
+
+func TestNewAppleRejectsInvalidKey(t *testing.T) {
+	if _, err := NewApple("id", "team", "key", []byte("not a key")); err == nil {
+		t.Error("expected an error for a non-PEM key")
+	}
+}
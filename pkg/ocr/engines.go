@@ -0,0 +1,163 @@
+package ocr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Tesseract runs the tesseract command line tool. PDF pages are rasterized first with
+// pdftoppm, so both tesseract-ocr and poppler-utils must be installed
+type Tesseract struct {
+	binary    string
+	pdftoppm  string
+	languages string
+}
+
+// NewTesseract creates a Tesseract engine. Empty binaries default to "tesseract" and
+// "pdftoppm" in PATH; empty languages use the Tesseract default
+func NewTesseract(binary, pdftoppm, languages string) *Tesseract {
+	if binary == "" {
+		binary = "tesseract"
+	}
+	if pdftoppm == "" {
+		pdftoppm = "pdftoppm"
+	}
+	return &Tesseract{binary: binary, pdftoppm: pdftoppm, languages: languages}
+}
+
+// Recognize implements Engine
+func (t *Tesseract) Recognize(ctx context.Context, data []byte, contentType string) (string, error) {
+	dir, err := os.MkdirTemp("", "qrmenu-ocr-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	var pages []string
+	switch contentType {
+	case TypeJPEG, TypePNG:
+		page := filepath.Join(dir, "page")
+		if err := os.WriteFile(page, data, 0600); err != nil {
+			return "", err
+		}
+		pages = []string{page}
+	case TypePDF:
+		if pages, err = t.rasterize(ctx, dir, data); err != nil {
+			return "", err
+		}
+	default:
+		return "", ErrUnsupported
+	}
+
+	var text strings.Builder
+	for _, page := range pages {
+		args := []string{page, "stdout"}
+		if t.languages != "" {
+			args = append(args, "-l", t.languages)
+		}
+		out, err := run(ctx, t.binary, args...)
+		if err != nil {
+			return "", err
+		}
+		text.Write(out)
+		text.WriteString("\n")
+	}
+	return text.String(), nil
+}
+
+// rasterize converts every PDF page to a PNG image and returns the paths in page order
+func (t *Tesseract) rasterize(ctx context.Context, dir string, data []byte) ([]string, error) {
+	pdf := filepath.Join(dir, "document.pdf")
+	if err := os.WriteFile(pdf, data, 0600); err != nil {
+		return nil, err
+	}
+	if _, err := run(ctx, t.pdftoppm, "-r", "300", "-png", pdf, filepath.Join(dir, "page")); err != nil {
+		return nil, err
+	}
+	pages, err := filepath.Glob(filepath.Join(dir, "page-*.png"))
+	if err != nil {
+		return nil, err
+	}
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("ocr: no pages in the PDF")
+	}
+	// pdftoppm pads the page numbers to the same width, so the names sort in page order
+	sort.Strings(pages)
+	return pages, nil
+}
+
+// run executes a command and returns its standard output, with standard error in the error
+func run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ocr: %s: %w: %s", filepath.Base(name), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// API sends the document to an external OCR service. The file is posted as the request
+// body with its content type, and the service answers with JSON {"text": "..."}
+type API struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewAPI creates an engine backed by the OCR service at url
+func NewAPI(url, apiKey string, client *http.Client) *API {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &API{url: url, apiKey: apiKey, client: client}
+}
+
+// Recognize implements Engine
+func (a *API) Recognize(ctx context.Context, data []byte, contentType string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	if a.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+a.apiKey)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("ocr api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return "", fmt.Errorf("ocr api: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		message := strings.TrimSpace(string(body))
+		if len(message) > 200 {
+			message = message[:200] + "..."
+		}
+		return "", fmt.Errorf("ocr api: unexpected status %d: %s", resp.StatusCode, message)
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("ocr api: invalid response: %w", err)
+	}
+	return result.Text, nil
+}
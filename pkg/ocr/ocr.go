@@ -0,0 +1,74 @@
+// Package ocr recognizes the text of a photographed or scanned paper menu, with the
+// Tesseract command line tools or an external OCR service, and parses it into a draft
+// menu of categories, items and prices.
+package ocr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Engine types
+const (
+	EngineNone      = ""
+	EngineTesseract = "tesseract"
+	EngineAPI       = "api"
+)
+
+// Supported content types
+const (
+	TypeJPEG = "image/jpeg"
+	TypePNG  = "image/png"
+	TypePDF  = "application/pdf"
+)
+
+// ErrUnsupported is returned for files that are neither a JPEG or PNG image nor a PDF
+var ErrUnsupported = errors.New("ocr: unsupported file type")
+
+// Engine extracts the text of an image or PDF
+type Engine interface {
+	// Recognize returns the text of data, whose content type is one of TypeJPEG, TypePNG
+	// and TypePDF
+	Recognize(ctx context.Context, data []byte, contentType string) (string, error)
+}
+
+// Config holds the OCR engine settings
+type Config struct {
+	Engine        string        // "", tesseract, api
+	TesseractPath string        // tesseract binary, looked up in PATH when not absolute
+	PDFToPPMPath  string        // pdftoppm binary (poppler-utils), used to rasterize PDF pages
+	Languages     string        // Tesseract languages, e.g. "ita+eng"
+	APIURL        string        // Endpoint of the external OCR service
+	APIKey        string        // Bearer token of the external OCR service
+	Timeout       time.Duration // Per-document timeout
+}
+
+// New creates the engine selected by cfg.Engine, or nil when OCR is disabled
+func New(cfg Config) (Engine, error) {
+	switch cfg.Engine {
+	case EngineNone:
+		return nil, nil
+	case EngineTesseract:
+		return NewTesseract(cfg.TesseractPath, cfg.PDFToPPMPath, cfg.Languages), nil
+	case EngineAPI:
+		if cfg.APIURL == "" {
+			return nil, fmt.Errorf("ocr api engine requires a URL")
+		}
+		return NewAPI(cfg.APIURL, cfg.APIKey, &http.Client{Timeout: cfg.Timeout}), nil
+	default:
+		return nil, fmt.Errorf("unknown ocr engine: %s", cfg.Engine)
+	}
+}
+
+// DetectType returns the content type of a supported file, or ErrUnsupported
+func DetectType(data []byte) (string, error) {
+	switch contentType := http.DetectContentType(data); contentType {
+	case TypeJPEG, TypePNG, TypePDF:
+		return contentType, nil
+	default:
+		return "", ErrUnsupported
+	}
+}
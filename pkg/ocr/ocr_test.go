@@ -0,0 +1,146 @@
+package ocr
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMenu(t *testing.T) {
+	text := `Trattoria da Mario
+
+Bruschetta al pomodoro 4,50
+pane casereccio, pomodoro,
+basilico
+Caprese ........ 8
+ANTIPASTI
+
+PIZZE
+Margherita € 7.50
+Pizza 4 formaggi 9,00€
+Diavola
+8,50
+Dolci:
+Tiramisù 5 EUR
+Birra 33
+`
+	draft := ParseMenu(text, "Menu")
+
+	want := []DraftCategory{
+		{Name: "Menu", Items: []DraftItem{
+			{Name: "Bruschetta al pomodoro", Description: "pane casereccio, pomodoro, basilico", Price: 4.5},
+			{Name: "Caprese", Price: 8},
+		}},
+		{Name: "PIZZE", Items: []DraftItem{
+			{Name: "Margherita", Price: 7.5},
+			{Name: "Pizza 4 formaggi", Price: 9},
+			{Name: "Diavola", Price: 8.5},
+		}},
+		{Name: "Dolci", Items: []DraftItem{
+			{Name: "Tiramisù", Description: "Birra 33", Price: 5},
+		}},
+	}
+	if !reflect.DeepEqual(draft.Categories, want) {
+		t.Errorf("categories:\n got %+v\nwant %+v", draft.Categories, want)
+	}
+	if draft.ItemCount() != 6 {
+		t.Errorf("ItemCount = %d", draft.ItemCount())
+	}
+	if !reflect.DeepEqual(draft.Unparsed, []string{"Trattoria da Mario", "ANTIPASTI"}) {
+		t.Errorf("unparsed = %q", draft.Unparsed)
+	}
+}
+
+func TestSplitPrice(t *testing.T) {
+	tests := []struct {
+		line  string
+		name  string
+		price float64
+		ok    bool
+	}{
+		{"Carbonara 12,00", "Carbonara", 12, true},
+		{"Carbonara - 12", "Carbonara", 12, true},
+		{"Carbonara €12", "Carbonara", 12, true},
+		{"Acqua 0.5", "Acqua", 0.5, true},
+		{"3,50", "", 3.5, true},
+		{"Menu 2024", "", 0, false},
+		{"Quattro stagioni", "", 0, false},
+	}
+	for _, tt := range tests {
+		name, price, ok := splitPrice(tt.line)
+		if name != tt.name || price != tt.price || ok != tt.ok {
+			t.Errorf("splitPrice(%q) = %q, %v, %v; want %q, %v, %v", tt.line, name, price, ok, tt.name, tt.price, tt.ok)
+		}
+	}
+}
+
+func TestDetectType(t *testing.T) {
+	if ct, err := DetectType([]byte("%PDF-1.7\n")); err != nil || ct != TypePDF {
+		t.Errorf("pdf: %q, %v", ct, err)
+	}
+	if ct, err := DetectType([]byte("\x89PNG\r\n\x1a\n0000")); err != nil || ct != TypePNG {
+		t.Errorf("png: %q, %v", ct, err)
+	}
+	if _, err := DetectType([]byte("GIF89a")); err != ErrUnsupported {
+		t.Errorf("gif: %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if e, err := New(Config{}); e != nil || err != nil {
+		t.Errorf("disabled engine: %v, %v", e, err)
+	}
+	if _, err := New(Config{Engine: EngineAPI}); err == nil {
+		t.Error("api engine without URL should fail")
+	}
+	if _, err := New(Config{Engine: "textract"}); err == nil {
+		t.Error("unknown engine should fail")
+	}
+}
+
+func TestAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != TypePNG || r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "image" {
+			t.Errorf("unexpected body %q", body)
+		}
+		w.Write([]byte(`{"text":"PIZZE\nMargherita 7,50"}`))
+	}))
+	defer srv.Close()
+
+	text, err := NewAPI(srv.URL, "key", nil).Recognize(context.Background(), []byte("image"), TypePNG)
+	if err != nil || !strings.Contains(text, "Margherita") {
+		t.Fatalf("got %q, %v", text, err)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer failing.Close()
+	if _, err := NewAPI(failing.URL, "", nil).Recognize(context.Background(), []byte("image"), TypePNG); err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestTesseractUnsupported(t *testing.T) {
+	if _, err := NewTesseract("", "", "").Recognize(context.Background(), []byte("x"), "image/gif"); err != ErrUnsupported {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestTesseractMissingBinary(t *testing.T) {
+	if _, err := exec.LookPath("tesseract"); err == nil {
+		t.Skip("tesseract installed")
+	}
+	if _, err := NewTesseract("", "", "ita").Recognize(context.Background(), []byte("image"), TypePNG); err == nil {
+		t.Error("expected an error without the tesseract binary")
+	}
+}
@@ -0,0 +1,177 @@
+package ocr
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Draft is a menu recognized from a paper menu, to be reviewed before it is saved. The
+// JSON layout matches the body of the menu creation API
+type Draft struct {
+	Categories []DraftCategory `json:"categories"`
+	Unparsed   []string        `json:"unparsed,omitempty"` // Lines that are neither headings nor items
+}
+
+// DraftCategory is a heading of the paper menu with the items below it
+type DraftCategory struct {
+	Name  string      `json:"name"`
+	Items []DraftItem `json:"items"`
+}
+
+// DraftItem is a recognized menu item. Price is 0 when none was found
+type DraftItem struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+}
+
+// ItemCount returns the number of items in the draft
+func (d *Draft) ItemCount() int {
+	n := 0
+	for _, category := range d.Categories {
+		n += len(category.Items)
+	}
+	return n
+}
+
+var (
+	// trailingPrice splits a line ending with a price ("7,50", "€ 7.50", "7.50€", "12 EUR") into
+	// name, leader, currency, integer part, decimals and currency
+	trailingPrice = regexp.MustCompile(`(?i)^(.*?)([\s.…:_|·-]*)(€|eur|euro)?\s*(\d{1,4})(?:[.,](\d{1,2}))?\s*(€|eur|euro)?$`)
+	spaces        = regexp.MustCompile(`\s+`)
+)
+
+// ParseMenu turns the OCR text of a paper menu into a draft. Lines ending with a price are
+// items, short lines without a price in capitals or ending with a colon are category
+// headings, and other lines continue the description of the previous item. Items before
+// the first heading go to a category named defaultCategory
+func ParseMenu(text, defaultCategory string) Draft {
+	var draft Draft
+	var current *DraftCategory
+	var last *DraftItem // Item whose description the next plain lines continue
+	var plain string    // Previous line, when it was neither an item nor a heading
+
+	category := func() *DraftCategory {
+		if current == nil {
+			draft.Categories = append(draft.Categories, DraftCategory{Name: defaultCategory})
+			current = &draft.Categories[len(draft.Categories)-1]
+		}
+		return current
+	}
+
+	for _, raw := range strings.Split(text, "\n") {
+		line := strings.TrimSpace(spaces.ReplaceAllString(raw, " "))
+		previous := plain
+		plain = ""
+		if !hasLetterOrDigit(line) {
+			last = nil
+			continue
+		}
+
+		if name, price, ok := splitPrice(line); ok {
+			if name == "" {
+				// Price on a line of its own, as OCR reads two-column layouts: it belongs to
+				// the line above, which was taken for a description
+				switch {
+				case previous != "" && last != nil && strings.HasSuffix(last.Description, previous):
+					last.Description = strings.TrimSpace(strings.TrimSuffix(last.Description, previous))
+					name = previous
+				case previous != "" && len(draft.Unparsed) > 0 && draft.Unparsed[len(draft.Unparsed)-1] == previous:
+					draft.Unparsed = draft.Unparsed[:len(draft.Unparsed)-1]
+					name = previous
+				default:
+					draft.Unparsed = append(draft.Unparsed, line)
+					continue
+				}
+			}
+			c := category()
+			c.Items = append(c.Items, DraftItem{Name: name, Price: price})
+			last = &c.Items[len(c.Items)-1]
+			continue
+		}
+
+		if isHeading(line) {
+			draft.Categories = append(draft.Categories, DraftCategory{Name: strings.TrimRight(line, ": ")})
+			current = &draft.Categories[len(draft.Categories)-1]
+			last = nil
+			continue
+		}
+
+		plain = line
+		if last != nil {
+			if last.Description != "" {
+				last.Description += " "
+			}
+			last.Description += line
+			continue
+		}
+		draft.Unparsed = append(draft.Unparsed, line)
+	}
+
+	// Headings without items (the restaurant name, "Menu", ...) are dropped
+	categories := draft.Categories[:0]
+	for _, c := range draft.Categories {
+		if len(c.Items) == 0 {
+			draft.Unparsed = append(draft.Unparsed, c.Name)
+			continue
+		}
+		categories = append(categories, c)
+	}
+	draft.Categories = categories
+	return draft
+}
+
+// splitPrice separates a trailing price from a line. A price needs decimals, a currency or
+// a leader before it, so numbers in names ("Pizza 4 formaggi", "Birra 33") are not prices
+func splitPrice(line string) (string, float64, bool) {
+	m := trailingPrice.FindStringSubmatch(line)
+	if m == nil {
+		return "", 0, false
+	}
+	name, leader, integer, decimals := m[1], m[2], m[4], m[5]
+	currency := m[3] != "" || m[6] != ""
+	if decimals == "" && !currency && strings.TrimSpace(leader) == "" {
+		return "", 0, false
+	}
+
+	value := integer
+	if decimals != "" {
+		value += "." + decimals
+	}
+	price, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.TrimSpace(name), price, true
+}
+
+// isHeading reports whether a line without price looks like a category heading
+func isHeading(line string) bool {
+	if len(strings.Fields(line)) > 5 {
+		return false
+	}
+	if strings.HasSuffix(line, ":") {
+		return true
+	}
+	letters, upper := 0, 0
+	for _, r := range line {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	return letters >= 3 && upper == letters
+}
+
+func hasLetterOrDigit(line string) bool {
+	for _, r := range line {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
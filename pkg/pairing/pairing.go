@@ -0,0 +1,131 @@
+// Package pairing suggests the menu items that pair well with a cart, from the items that
+// customers ordered together. Scores are association rule confidences over past orders: they
+// need no training and no data about the visitor, only the contents of the orders.
+//
+// This co-occurrence heuristic replaces the ML engine the suggestions were meant to come
+// from, which does not exist in this codebase.
+package pairing
+
+import "sort"
+
+// DefaultMinSupport is the number of orders two items must share before one is suggested
+// with the other, so a single unusual order does not produce suggestions
+const DefaultMinSupport = 2
+
+// Suggestion is an item that pairs well with the cart
+type Suggestion struct {
+	ItemID string
+	// Score is the average, over the cart items, of the share of their orders that also
+	// contain this item (0-1)
+	Score float64
+	// Orders is the largest number of orders shared with a single cart item
+	Orders int
+}
+
+// Matrix counts how often items are ordered together. Add is not safe for concurrent use;
+// once built, a Matrix can be queried concurrently
+type Matrix struct {
+	orders   int
+	items    map[string]int            // Orders containing the item
+	together map[string]map[string]int // Orders containing both items
+}
+
+// New returns an empty Matrix
+func New() *Matrix {
+	return &Matrix{items: make(map[string]int), together: make(map[string]map[string]int)}
+}
+
+// Add records the items of an order. Repeated items are counted once
+func (m *Matrix) Add(items []string) {
+	distinct := unique(items)
+	if len(distinct) == 0 {
+		return
+	}
+	m.orders++
+	for _, a := range distinct {
+		m.items[a]++
+		for _, b := range distinct {
+			if a == b {
+				continue
+			}
+			if m.together[a] == nil {
+				m.together[a] = make(map[string]int)
+			}
+			m.together[a][b]++
+		}
+	}
+}
+
+// Orders returns the number of orders added
+func (m *Matrix) Orders() int {
+	return m.orders
+}
+
+// Suggest returns up to limit items ordered together with the cart items, best first. Items
+// already in the cart, items rejected by allow (nil allows every item) and pairs shared by
+// fewer than minSupport orders are skipped
+func (m *Matrix) Suggest(cart []string, limit, minSupport int, allow func(itemID string) bool) []Suggestion {
+	cart = unique(cart)
+	if len(cart) == 0 || limit <= 0 {
+		return nil
+	}
+	inCart := make(map[string]bool, len(cart))
+	for _, id := range cart {
+		inCart[id] = true
+	}
+
+	byItem := make(map[string]*Suggestion)
+	for _, a := range cart {
+		count := m.items[a]
+		if count == 0 {
+			continue
+		}
+		for b, shared := range m.together[a] {
+			if inCart[b] || shared < minSupport || (allow != nil && !allow(b)) {
+				continue
+			}
+			s := byItem[b]
+			if s == nil {
+				s = &Suggestion{ItemID: b}
+				byItem[b] = s
+			}
+			s.Score += float64(shared) / float64(count)
+			if shared > s.Orders {
+				s.Orders = shared
+			}
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, len(byItem))
+	for _, s := range byItem {
+		s.Score /= float64(len(cart))
+		suggestions = append(suggestions, *s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Orders != b.Orders {
+			return a.Orders > b.Orders
+		}
+		return a.ItemID < b.ItemID
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// unique returns the non-empty items without repetitions, in their original order
+func unique(items []string) []string {
+	seen := make(map[string]bool, len(items))
+	result := make([]string, 0, len(items))
+	for _, id := range items {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package pairing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSuggest(t *testing.T) {
+	m := New()
+	m.Add([]string{"pizza", "beer", "beer"})
+	m.Add([]string{"pizza", "beer"})
+	m.Add([]string{"pizza", "cola"})
+	m.Add([]string{"pizza", "cola", "tiramisu"})
+	m.Add([]string{"pizza", "tiramisu", "beer"})
+	m.Add([]string{"salad", "water"})
+	m.Add(nil)
+
+	if m.Orders() != 6 {
+		t.Fatalf("Orders = %d, want 6", m.Orders())
+	}
+
+	got := m.Suggest([]string{"pizza"}, 5, DefaultMinSupport, nil)
+	want := []Suggestion{
+		{ItemID: "beer", Score: 3.0 / 5, Orders: 3},
+		{ItemID: "cola", Score: 2.0 / 5, Orders: 2},
+		{ItemID: "tiramisu", Score: 2.0 / 5, Orders: 2},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Suggest = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].ItemID != want[i].ItemID || got[i].Orders != want[i].Orders || math.Abs(got[i].Score-want[i].Score) > 1e-9 {
+			t.Errorf("suggestion %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Pairs seen once are not suggested
+	if got := m.Suggest([]string{"salad"}, 5, DefaultMinSupport, nil); len(got) != 0 {
+		t.Errorf("salad suggestions = %+v, want none", got)
+	}
+}
+
+func TestSuggestCart(t *testing.T) {
+	m := New()
+	for i := 0; i < 3; i++ {
+		m.Add([]string{"pizza", "beer", "tiramisu"})
+	}
+	m.Add([]string{"pizza", "cola"})
+	m.Add([]string{"pizza", "cola"})
+
+	// Items in the cart are never suggested; the score averages over the cart items
+	got := m.Suggest([]string{"pizza", "beer", "pizza"}, 5, DefaultMinSupport, nil)
+	if len(got) != 2 || got[0].ItemID != "tiramisu" || got[1].ItemID != "cola" {
+		t.Fatalf("Suggest = %+v", got)
+	}
+	if want := (3.0/5 + 3.0/3) / 2; math.Abs(got[0].Score-want) > 1e-9 {
+		t.Errorf("tiramisu score = %v, want %v", got[0].Score, want)
+	}
+
+	got = m.Suggest([]string{"pizza"}, 1, DefaultMinSupport, func(id string) bool { return id != "beer" })
+	if len(got) != 1 || got[0].ItemID != "tiramisu" {
+		t.Errorf("filtered and limited = %+v", got)
+	}
+
+	if got := m.Suggest([]string{"unknown"}, 5, DefaultMinSupport, nil); len(got) != 0 {
+		t.Errorf("unknown item = %+v", got)
+	}
+	if got := m.Suggest(nil, 5, DefaultMinSupport, nil); got != nil {
+		t.Errorf("empty cart = %+v", got)
+	}
+}
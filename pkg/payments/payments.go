@@ -0,0 +1,182 @@
+// Package payments takes the online payments of the orders through the payment provider of
+// each restaurant: Stripe, SumUp or Satispay. The restaurant opens a hosted payment page for an
+// order, the provider notifies the outcome to the webhook endpoint of the restaurant, and paid
+// orders can be refunded in full or in part.
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Providers
+const (
+	ProviderStripe   = "stripe"
+	ProviderSumUp    = "sumup"
+	ProviderSatispay = "satispay"
+)
+
+// Providers lists the supported providers
+var Providers = []string{ProviderStripe, ProviderSumUp, ProviderSatispay}
+
+// Payment statuses reported by the providers
+const (
+	StatusPending = "pending"
+	StatusPaid    = "paid"
+	StatusFailed  = "failed" // Declined, cancelled or expired: a new checkout is needed
+)
+
+// maxWebhookBody is the maximum size of a provider notification
+const maxWebhookBody = 64 << 10
+
+// ErrInvalidConfig is matched by the errors of New for missing or malformed credentials
+var ErrInvalidConfig = errors.New("invalid payment provider configuration")
+
+// Config holds the provider credentials of a restaurant. It is stored encrypted
+type Config struct {
+	Provider string `json:"provider"`
+
+	// Stripe
+	SecretKey     string `json:"secret_key,omitempty"`
+	WebhookSecret string `json:"webhook_secret,omitempty"` // Signing secret of the restaurant webhook endpoint
+
+	// SumUp
+	APIKey       string `json:"api_key,omitempty"`
+	MerchantCode string `json:"merchant_code,omitempty"`
+
+	// Satispay
+	KeyID      string `json:"key_id,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"` // PEM RSA key registered with the key ID
+	Sandbox    bool   `json:"sandbox,omitempty"`     // Satispay staging environment
+
+	APIBase string        `json:"-"` // API endpoint of SumUp or Satispay, overrides the default
+	Timeout time.Duration `json:"-"`
+}
+
+// CheckoutRequest describes the payment of an order
+type CheckoutRequest struct {
+	Reference   string // Order ID, returned with the payment
+	Description string
+	AmountCents int64
+	Currency    string // ISO 4217, e.g. EUR
+	ReturnURL   string // Page the buyer lands on after paying or giving up
+	WebhookURL  string // Notification endpoint; Stripe uses the one registered in its dashboard
+}
+
+// Checkout is a hosted payment page the buyer is redirected to
+type Checkout struct {
+	ID  string
+	URL string
+}
+
+// Payment is the outcome of a checkout notified by the provider, verified with its signature
+// or read back from the provider API
+type Payment struct {
+	CheckoutID  string
+	PaymentID   string // Passed to Refund
+	Reference   string
+	Status      string
+	AmountCents int64
+	Currency    string // Upper case
+}
+
+// Provider takes the payments of a restaurant
+type Provider interface {
+	// Name returns the provider, e.g. ProviderStripe
+	Name() string
+	// CreateCheckout opens a payment page for the request
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error)
+	// ParseWebhook authenticates a notification and returns the payment it reports; nil,
+	// without error, for notifications that do not concern a payment
+	ParseWebhook(ctx context.Context, r *http.Request) (*Payment, error)
+	// Refund returns amountCents of the payment to the buyer and returns the refund ID, if the
+	// provider assigns one
+	Refund(ctx context.Context, paymentID string, amountCents int64, currency string) (string, error)
+}
+
+// New creates the provider selected by cfg.Provider
+func New(cfg Config) (Provider, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 15 * time.Second
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+
+	switch cfg.Provider {
+	case ProviderStripe:
+		if cfg.SecretKey == "" || cfg.WebhookSecret == "" {
+			return nil, fmt.Errorf("%w: stripe requires secret_key and webhook_secret", ErrInvalidConfig)
+		}
+		return newStripe(cfg), nil
+	case ProviderSumUp:
+		if cfg.APIKey == "" || cfg.MerchantCode == "" {
+			return nil, fmt.Errorf("%w: sumup requires api_key and merchant_code", ErrInvalidConfig)
+		}
+		if cfg.APIBase == "" {
+			cfg.APIBase = SumUpAPIBase
+		}
+		return &SumUp{cfg: cfg, client: client}, nil
+	case ProviderSatispay:
+		if cfg.KeyID == "" {
+			return nil, fmt.Errorf("%w: satispay requires key_id and private_key", ErrInvalidConfig)
+		}
+		key, err := parsePrivateKey(cfg.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: satispay private_key: %v", ErrInvalidConfig, err)
+		}
+		if cfg.APIBase == "" {
+			cfg.APIBase = SatispayAPIBase
+			if cfg.Sandbox {
+				cfg.APIBase = SatispaySandboxAPIBase
+			}
+		}
+		return &Satispay{cfg: cfg, key: key, client: client}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown provider %q", ErrInvalidConfig, cfg.Provider)
+	}
+}
+
+// readWebhook reads the body of a notification
+func readWebhook(r *http.Request) ([]byte, error) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxWebhookBody {
+		return nil, errors.New("webhook payload too large")
+	}
+	return payload, nil
+}
+
+// doJSON sends an API request and decodes the JSON response into out, if not nil
+func doJSON(client *http.Client, req *http.Request, provider string, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("payments: %s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("payments: %s: HTTP %d: %s", provider, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("payments: %s: invalid response: %v", provider, err)
+	}
+	return nil
+}
+
+// toCents converts an amount in major units, as returned by SumUp, to cents
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
@@ -0,0 +1,211 @@
+package payments
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stripe/stripe-go/v79/webhook"
+)
+
+func TestNewValidatesConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{Provider: "paypal"},
+		{Provider: ProviderStripe, SecretKey: "sk_test"},
+		{Provider: ProviderSumUp, APIKey: "sup_sk"},
+		{Provider: ProviderSatispay, KeyID: "key", PrivateKey: "not a key"},
+	} {
+		if _, err := New(cfg); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("New(%s) error = %v, want ErrInvalidConfig", cfg.Provider, err)
+		}
+	}
+}
+
+func TestStripeParseWebhook(t *testing.T) {
+	provider, err := New(Config{Provider: ProviderStripe, SecretKey: "sk_test", WebhookSecret: "whsec_test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{
+		Payload: []byte(`{"id": "evt_1", "type": "checkout.session.completed", "data": {"object": {"id": "cs_1", "payment_status": "paid", "payment_intent": "pi_1", "amount_total": 2450, "currency": "eur", "metadata": {"order_id": "o1"}}}}`),
+		Secret:  "whsec_test",
+	})
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(string(signed.Payload)))
+	r.Header.Set("Stripe-Signature", signed.Header)
+
+	payment, err := provider.ParseWebhook(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Payment{CheckoutID: "cs_1", PaymentID: "pi_1", Reference: "o1", Status: StatusPaid, AmountCents: 2450, Currency: "EUR"}
+	if payment == nil || *payment != want {
+		t.Errorf("payment = %+v, want %+v", payment, want)
+	}
+}
+
+func TestSumUp(t *testing.T) {
+	var created map[string]interface{}
+	var refunded map[string]float64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sup_sk" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v0.1/checkouts":
+			json.NewDecoder(r.Body).Decode(&created)
+			fmt.Fprint(w, `{"id": "chk_1", "status": "PENDING", "hosted_checkout_url": "https://checkout.sumup.com/pay/chk_1"}`)
+		case r.Method == http.MethodGet && r.URL.Path == "/v0.1/checkouts/chk_1":
+			fmt.Fprint(w, `{"id": "chk_1", "checkout_reference": "o1", "amount": 24.5, "currency": "EUR", "status": "PAID", "transaction_id": "txn_1"}`)
+		case r.Method == http.MethodPost && r.URL.Path == "/v0.1/me/refund/txn_1":
+			json.NewDecoder(r.Body).Decode(&refunded)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	provider, err := New(Config{Provider: ProviderSumUp, APIKey: "sup_sk", MerchantCode: "M1", APIBase: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	checkout, err := provider.CreateCheckout(ctx, CheckoutRequest{Reference: "o1", AmountCents: 2450, Currency: "eur",
+		ReturnURL: "https://menu.example.com/paid", WebhookURL: "https://menu.example.com/hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkout.ID != "chk_1" || checkout.URL != "https://checkout.sumup.com/pay/chk_1" {
+		t.Errorf("checkout = %+v", checkout)
+	}
+	if created["amount"] != 24.5 || created["currency"] != "EUR" || created["merchant_code"] != "M1" ||
+		created["return_url"] != "https://menu.example.com/hook" {
+		t.Errorf("created = %v", created)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"event_type": "CHECKOUT_STATUS_CHANGED", "id": "chk_1"}`))
+	payment, err := provider.ParseWebhook(ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Payment{CheckoutID: "chk_1", PaymentID: "txn_1", Reference: "o1", Status: StatusPaid, AmountCents: 2450, Currency: "EUR"}
+	if payment == nil || *payment != want {
+		t.Errorf("payment = %+v, want %+v", payment, want)
+	}
+
+	if _, err := provider.Refund(ctx, "txn_1", 1000, "EUR"); err != nil {
+		t.Fatal(err)
+	}
+	if refunded["amount"] != 10 {
+		t.Errorf("refunded = %v", refunded)
+	}
+}
+
+func TestSatispaySignsRequests(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	signature := regexp.MustCompile(`^Signature keyId="key_1", algorithm="rsa-sha256", headers="\(request-target\) host date digest", signature="([^"]+)"$`)
+	var created map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		if r.Header.Get("Digest") != "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]) {
+			t.Errorf("Digest = %q", r.Header.Get("Digest"))
+		}
+		match := signature.FindStringSubmatch(r.Header.Get("Authorization"))
+		if match == nil {
+			t.Fatalf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		signed := fmt.Sprintf("(request-target): %s %s\nhost: %s\ndate: %s\ndigest: %s",
+			strings.ToLower(r.Method), r.URL.RequestURI(), r.Host, r.Header.Get("Date"), r.Header.Get("Digest"))
+		hashed := sha256.Sum256([]byte(signed))
+		raw, _ := base64.StdEncoding.DecodeString(match[1])
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, hashed[:], raw); err != nil {
+			t.Errorf("invalid signature for %s %s: %v", r.Method, r.URL.Path, err)
+		}
+
+		switch {
+		case r.Method == http.MethodPost:
+			json.Unmarshal(body, &created)
+			fmt.Fprint(w, `{"id": "pay_1", "status": "PENDING"}`)
+		case r.URL.Path == "/g_business/v1/payments/pay_1":
+			fmt.Fprint(w, `{"id": "pay_1", "status": "ACCEPTED", "amount_unit": 2450, "currency": "EUR", "external_code": "o1"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	provider, err := New(Config{Provider: ProviderSatispay, KeyID: "key_1", PrivateKey: keyPEM, APIBase: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	checkout, err := provider.CreateCheckout(ctx, CheckoutRequest{Reference: "o1", AmountCents: 2450, Currency: "EUR",
+		ReturnURL: "https://menu.example.com/paid", WebhookURL: "https://menu.example.com/hook"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkout.ID != "pay_1" || checkout.URL != satispayPayURL+"pay_1" {
+		t.Errorf("checkout = %+v", checkout)
+	}
+	if created["callback_url"] != "https://menu.example.com/hook?payment_id={uuid}" || created["amount_unit"] != 2450.0 {
+		t.Errorf("created = %v", created)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/hook?payment_id=pay_1", nil)
+	payment, err := provider.ParseWebhook(ctx, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Payment{CheckoutID: "pay_1", PaymentID: "pay_1", Reference: "o1", Status: StatusPaid, AmountCents: 2450, Currency: "EUR"}
+	if payment == nil || *payment != want {
+		t.Errorf("payment = %+v, want %+v", payment, want)
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{1000, []int64{1, 1, 1}, []int64{334, 333, 333}},
+		{2450, []int64{1, 1}, []int64{1225, 1225}},
+		{1500, []int64{800, 1850, 0}, []int64{453, 1047, 0}},
+		{100, []int64{0, 0}, []int64{0, 0}},
+	}
+	for _, tt := range tests {
+		got := Allocate(tt.amount, tt.weights)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("Allocate(%d, %v) = %v, want %v", tt.amount, tt.weights, got, tt.want)
+		}
+	}
+	if got := TipCents(2450, 10); got != 245 {
+		t.Errorf("TipCents = %d", got)
+	}
+}
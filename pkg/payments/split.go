@@ -0,0 +1,41 @@
+package payments
+
+import "math"
+
+// Allocate divides amountCents into shares proportional to weights, assigning the cents left
+// over by rounding to the shares with the largest remainders, so that the shares always add up
+// to amountCents. Shares with zero weight get nothing
+func Allocate(amountCents int64, weights []int64) []int64 {
+	shares := make([]int64, len(weights))
+	var total int64
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return shares
+	}
+
+	remainders := make([]int64, len(weights))
+	var allocated int64
+	for i, w := range weights {
+		shares[i] = amountCents * w / total
+		remainders[i] = amountCents * w % total
+		allocated += shares[i]
+	}
+	for left := amountCents - allocated; left > 0; left-- {
+		best := -1
+		for i, rem := range remainders {
+			if weights[i] > 0 && (best < 0 || rem > remainders[best]) {
+				best = i
+			}
+		}
+		shares[best]++
+		remainders[best] = -1
+	}
+	return shares
+}
+
+// TipCents returns the tip of percent on amountCents, rounded to the cent
+func TipCents(amountCents int64, percent float64) int64 {
+	return int64(math.Round(float64(amountCents) * percent / 100))
+}
@@ -0,0 +1,81 @@
+package payments
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/stripe/stripe-go/v79"
+	"github.com/stripe/stripe-go/v79/refund"
+
+	"qr-menu/pkg/billing"
+)
+
+// Stripe takes payments with Stripe Checkout on the restaurant's own Stripe account. The
+// webhook endpoint of the restaurant must be registered in the Stripe dashboard for the
+// checkout.session.completed and checkout.session.async_payment_succeeded events
+type Stripe struct {
+	checkout *billing.StripeCheckout
+	refunds  refund.Client
+}
+
+func newStripe(cfg Config) *Stripe {
+	return &Stripe{
+		checkout: billing.NewStripeCheckout(cfg.SecretKey, cfg.WebhookSecret),
+		refunds:  refund.Client{B: stripe.GetBackend(stripe.APIBackend), Key: cfg.SecretKey},
+	}
+}
+
+// Name implements Provider
+func (s *Stripe) Name() string {
+	return ProviderStripe
+}
+
+// CreateCheckout implements Provider
+func (s *Stripe) CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error) {
+	session, err := s.checkout.CreateCheckout(ctx, billing.CheckoutRequest{
+		Description: req.Description,
+		AmountCents: req.AmountCents,
+		Currency:    req.Currency,
+		SuccessURL:  req.ReturnURL,
+		CancelURL:   req.ReturnURL,
+		Metadata:    map[string]string{"order_id": req.Reference},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Checkout{ID: session.ID, URL: session.URL}, nil
+}
+
+// ParseWebhook implements Provider: the notification is authenticated by its signature
+func (s *Stripe) ParseWebhook(ctx context.Context, r *http.Request) (*Payment, error) {
+	payload, err := readWebhook(r)
+	if err != nil {
+		return nil, err
+	}
+	completed, err := s.checkout.ParseWebhook(payload, r.Header.Get("Stripe-Signature"))
+	if err != nil || completed == nil {
+		return nil, err
+	}
+	return &Payment{
+		CheckoutID:  completed.SessionID,
+		PaymentID:   completed.PaymentID,
+		Reference:   completed.Metadata["order_id"],
+		Status:      StatusPaid,
+		AmountCents: completed.AmountCents,
+		Currency:    completed.Currency,
+	}, nil
+}
+
+// Refund implements Provider
+func (s *Stripe) Refund(ctx context.Context, paymentID string, amountCents int64, currency string) (string, error) {
+	params := &stripe.RefundParams{
+		PaymentIntent: stripe.String(paymentID),
+		Amount:        stripe.Int64(amountCents),
+	}
+	params.Context = ctx
+	refunded, err := s.refunds.New(params)
+	if err != nil {
+		return "", err
+	}
+	return refunded.ID, nil
+}
@@ -0,0 +1,130 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SumUpAPIBase is the default SumUp API endpoint
+const SumUpAPIBase = "https://api.sumup.com"
+
+// SumUp takes payments with the SumUp hosted checkout. Its notifications are not signed: they
+// only carry the checkout ID, whose status is read back from the API
+type SumUp struct {
+	cfg    Config
+	client *http.Client
+}
+
+// sumUpCheckout is a checkout of the SumUp API
+type sumUpCheckout struct {
+	ID                string  `json:"id"`
+	Reference         string  `json:"checkout_reference"`
+	Amount            float64 `json:"amount"`
+	Currency          string  `json:"currency"`
+	Status            string  `json:"status"` // PENDING, PAID, FAILED or EXPIRED
+	TransactionID     string  `json:"transaction_id"`
+	HostedCheckoutURL string  `json:"hosted_checkout_url"`
+	Transactions      []struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	} `json:"transactions"`
+}
+
+// Name implements Provider
+func (s *SumUp) Name() string {
+	return ProviderSumUp
+}
+
+// CreateCheckout implements Provider with POST /v0.1/checkouts
+func (s *SumUp) CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"checkout_reference": req.Reference,
+		"amount":             float64(req.AmountCents) / 100,
+		"currency":           strings.ToUpper(req.Currency),
+		"merchant_code":      s.cfg.MerchantCode,
+		"description":        req.Description,
+		"return_url":         req.WebhookURL,
+		"redirect_url":       req.ReturnURL,
+		"hosted_checkout":    map[string]bool{"enabled": true},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var checkout sumUpCheckout
+	if err := s.do(ctx, http.MethodPost, "/v0.1/checkouts", body, &checkout); err != nil {
+		return nil, err
+	}
+	if checkout.HostedCheckoutURL == "" {
+		return nil, errors.New("payments: sumup: hosted checkout not enabled for the merchant")
+	}
+	return &Checkout{ID: checkout.ID, URL: checkout.HostedCheckoutURL}, nil
+}
+
+// ParseWebhook implements Provider: the checkout of a CHECKOUT_STATUS_CHANGED notification is
+// read back with GET /v0.1/checkouts/{id}
+func (s *SumUp) ParseWebhook(ctx context.Context, r *http.Request) (*Payment, error) {
+	payload, err := readWebhook(r)
+	if err != nil {
+		return nil, err
+	}
+	var event struct {
+		EventType string `json:"event_type"`
+		ID        string `json:"id"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("payments: sumup: invalid notification: %v", err)
+	}
+	if event.EventType != "CHECKOUT_STATUS_CHANGED" || event.ID == "" {
+		return nil, nil
+	}
+
+	var checkout sumUpCheckout
+	if err := s.do(ctx, http.MethodGet, "/v0.1/checkouts/"+url.PathEscape(event.ID), nil, &checkout); err != nil {
+		return nil, err
+	}
+	payment := &Payment{
+		CheckoutID:  checkout.ID,
+		PaymentID:   checkout.TransactionID,
+		Reference:   checkout.Reference,
+		Status:      StatusPending,
+		AmountCents: toCents(checkout.Amount),
+		Currency:    strings.ToUpper(checkout.Currency),
+	}
+	if payment.PaymentID == "" && len(checkout.Transactions) > 0 {
+		payment.PaymentID = checkout.Transactions[0].ID
+	}
+	switch checkout.Status {
+	case "PAID":
+		payment.Status = StatusPaid
+	case "FAILED", "EXPIRED":
+		payment.Status = StatusFailed
+	}
+	return payment, nil
+}
+
+// Refund implements Provider with POST /v0.1/me/refund/{transaction}
+func (s *SumUp) Refund(ctx context.Context, paymentID string, amountCents int64, currency string) (string, error) {
+	body, err := json.Marshal(map[string]float64{"amount": float64(amountCents) / 100})
+	if err != nil {
+		return "", err
+	}
+	return "", s.do(ctx, http.MethodPost, "/v0.1/me/refund/"+url.PathEscape(paymentID), body, nil)
+}
+
+func (s *SumUp) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.cfg.APIBase+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.cfg.APIKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return doJSON(s.client, req, ProviderSumUp, out)
+}
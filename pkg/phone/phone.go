@@ -0,0 +1,63 @@
+// Package phone normalizes the phone numbers left by customers and builds the links that open
+// a text message or a WhatsApp chat with them
+package phone
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Normalize returns phone in international form (E.164) without the leading '+', e.g.
+// 393331234567. Numbers without an international prefix (+ or 00) get countryCode, e.g. "39".
+// It returns "" if phone is not a plausible number
+func Normalize(phone, countryCode string) string {
+	phone = strings.TrimSpace(phone)
+	international := false
+	switch {
+	case strings.HasPrefix(phone, "+"):
+		international = true
+		phone = phone[1:]
+	case strings.HasPrefix(phone, "00"):
+		international = true
+		phone = phone[2:]
+	}
+
+	var digits strings.Builder
+	for _, c := range phone {
+		switch {
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case c == ' ' || c == '-' || c == '.' || c == '/' || c == '(' || c == ')':
+		default:
+			return ""
+		}
+	}
+	number := digits.String()
+	if !international {
+		number = countryCode + number
+	}
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return ""
+	}
+	return number
+}
+
+// WhatsAppLink returns a click-to-chat link that opens a WhatsApp chat with the normalized
+// number with text already written
+func WhatsAppLink(number, text string) string {
+	link := "https://wa.me/" + number
+	if text != "" {
+		link += "?text=" + url.QueryEscape(text)
+	}
+	return link
+}
+
+// SMSLink returns an sms: link that opens a text message to the normalized number with body
+// already written. Spaces are encoded as %20, since some phones show a literal '+'
+func SMSLink(number, body string) string {
+	link := "sms:+" + number
+	if body != "" {
+		link += "?body=" + strings.ReplaceAll(url.QueryEscape(body), "+", "%20")
+	}
+	return link
+}
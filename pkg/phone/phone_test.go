@@ -0,0 +1,33 @@
+package phone
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"333 123 4567":     "393331234567",
+		"+39 333-123-4567": "393331234567",
+		"0039 02 1234567":  "39021234567",
+		"(02) 123.4567":    "39021234567",
+		"+44 20 7946 0958": "442079460958",
+		"12345":            "",
+		"333 123 4567 x1":  "",
+		"+0 333 1234567":   "",
+		"":                 "",
+	} {
+		if got := Normalize(in, "39"); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLinks(t *testing.T) {
+	if got := WhatsAppLink("393331234567", "Ordine pronto & caldo"); got != "https://wa.me/393331234567?text=Ordine+pronto+%26+caldo" {
+		t.Errorf("WhatsAppLink = %q", got)
+	}
+	if got := WhatsAppLink("393331234567", ""); got != "https://wa.me/393331234567" {
+		t.Errorf("WhatsAppLink without text = %q", got)
+	}
+	if got := SMSLink("393331234567", "Ordine pronto"); got != "sms:+393331234567?body=Ordine%20pronto" {
+		t.Errorf("SMSLink = %q", got)
+	}
+}
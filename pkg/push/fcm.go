@@ -0,0 +1,210 @@
+// Package push delivers push notifications to the owners' devices: to the mobile app through
+// the Firebase Cloud Messaging HTTP v1 API, and to browsers through Web Push with VAPID.
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// ErrUnregistered is matched (with errors.Is) by the error returned for device tokens and
+// browser subscriptions the push service no longer accepts (app uninstalled, subscription
+// expired): they should be deleted
+var ErrUnregistered = errors.New("device token is no longer registered")
+
+// ErrPermanent is matched by errors that would fail again on retry, e.g. an invalid payload
+var ErrPermanent = errors.New("permanent push delivery failure")
+
+// Default endpoints
+const (
+	FCMAPIBase = "https://fcm.googleapis.com"
+	fcmScope   = "https://www.googleapis.com/auth/firebase.messaging"
+)
+
+// Message is a notification for one device
+type Message struct {
+	Token string
+	Title string
+	Body  string
+	Data  map[string]string // Delivered to the app alongside the notification
+}
+
+// Sender delivers push notifications and returns the provider message ID
+type Sender interface {
+	Send(ctx context.Context, msg Message) (string, error)
+}
+
+// ServiceAccount holds the fields of a Google service account key file used by FCM
+type ServiceAccount struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+
+	// Credentials is the key file itself, from which the OAuth2 token sources are created
+	Credentials []byte `json:"-"`
+}
+
+// LoadServiceAccount reads the service account key from a file path, a file:// URL
+// or an http(s):// URL (e.g. a secret manager endpoint)
+func LoadServiceAccount(ctx context.Context, source string) (*ServiceAccount, error) {
+	var data []byte
+	var err error
+	switch {
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		data, err = fetch(ctx, source)
+	case strings.HasPrefix(source, "file://"):
+		data, err = os.ReadFile(strings.TrimPrefix(source, "file://"))
+	default:
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("push: read service account: %w", err)
+	}
+
+	var sa ServiceAccount
+	if err := json.Unmarshal(data, &sa); err != nil {
+		return nil, fmt.Errorf("push: parse service account: %w", err)
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, fmt.Errorf("push: service account must contain project_id, client_email and private_key")
+	}
+	sa.Credentials = data
+	return &sa, nil
+}
+
+func fetch(ctx context.Context, source string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+}
+
+// TokenSource returns the OAuth2 access tokens of the account for scopes, obtained with a
+// signed JWT assertion and reused until shortly before they expire. Token requests go through
+// client
+func (sa *ServiceAccount) TokenSource(client *http.Client, scopes ...string) (oauth2.TokenSource, error) {
+	cfg, err := google.JWTConfigFromJSON(sa.Credentials, scopes...)
+	if err != nil {
+		return nil, fmt.Errorf("push: service account: %w", err)
+	}
+	return cfg.TokenSource(context.WithValue(context.Background(), oauth2.HTTPClient, client)), nil
+}
+
+// FCM sends notifications with the FCM HTTP v1 API, authorized with the OAuth2 access tokens
+// of the service account
+type FCM struct {
+	projectID string
+	apiBase   string
+	client    *http.Client
+}
+
+// NewFCM creates the FCM client. apiBase overrides FCMAPIBase (empty uses the default)
+func NewFCM(account *ServiceAccount, apiBase string, timeout time.Duration) (*FCM, error) {
+	if apiBase == "" {
+		apiBase = FCMAPIBase
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	base := &http.Client{Timeout: timeout}
+	tokens, err := account.TokenSource(base, fcmScope)
+	if err != nil {
+		return nil, err
+	}
+	return &FCM{
+		projectID: account.ProjectID,
+		apiBase:   strings.TrimRight(apiBase, "/"),
+		client:    &http.Client{Transport: &oauth2.Transport{Source: tokens}, Timeout: timeout},
+	}, nil
+}
+
+// Send delivers the message to one device and returns the FCM message name
+func (f *FCM) Send(ctx context.Context, msg Message) (string, error) {
+	if msg.Token == "" {
+		return "", fmt.Errorf("%w: missing device token", ErrPermanent)
+	}
+	payload := map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        msg.Token,
+			"notification": map[string]string{"title": msg.Title, "body": msg.Body},
+			"data":         msg.Data,
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	endpoint := fmt.Sprintf("%s/v1/projects/%s/messages:send", f.apiBase, url.PathEscape(f.projectID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("push: fcm: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode == http.StatusOK {
+		var result struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(data, &result)
+		return result.Name, nil
+	}
+	return "", fcmError(resp.StatusCode, data)
+}
+
+// fcmError maps an FCM error response: 404/410 and UNREGISTERED mean the token must be
+// pruned, other client errors except 429 are permanent
+func fcmError(status int, body []byte) error {
+	var apiErr struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.Unmarshal(body, &apiErr)
+
+	err := fmt.Errorf("push: fcm: HTTP %d: %s %s", status, apiErr.Error.Status, apiErr.Error.Message)
+	unregistered := status == http.StatusNotFound || status == http.StatusGone
+	for _, detail := range apiErr.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			unregistered = true
+		}
+	}
+	switch {
+	case unregistered:
+		return fmt.Errorf("%w: %w", ErrUnregistered, err)
+	case status >= 400 && status < 500 && status != http.StatusTooManyRequests && status != http.StatusUnauthorized:
+		return fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	return err
+}
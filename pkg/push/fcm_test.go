@@ -0,0 +1,183 @@
+package push
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeFCM serves the OAuth2 token endpoint and messages:send, verifying the JWT signature
+func fakeFCM(t *testing.T, key *rsa.PrivateKey, send http.HandlerFunc) (*httptest.Server, *int32) {
+	var tokens int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.FormValue("assertion"), ".")
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || len(parts) != 3 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		atomic.AddInt32(&tokens, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "ya29.test", "expires_in": 3600})
+	})
+	mux.HandleFunc("/v1/projects/demo/messages:send", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ya29.test" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		send(w, r)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &tokens
+}
+
+// testAccount returns a service account whose key file points to tokenURI
+func testAccount(t *testing.T, key *rsa.PrivateKey, tokenURI string) *ServiceAccount {
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	account := &ServiceAccount{
+		ProjectID:   "demo",
+		ClientEmail: "fcm@demo.iam.gserviceaccount.com",
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+	}
+	account.Credentials, _ = json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   account.ProjectID,
+		"client_email": account.ClientEmail,
+		"private_key":  account.PrivateKey,
+		"token_uri":    tokenURI,
+	})
+	return account
+}
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestFCMSend(t *testing.T) {
+	key := testKey(t)
+	var got map[string]map[string]interface{}
+	srv, tokens := fakeFCM(t, key, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"name":"projects/demo/messages/42"}`))
+	})
+	fcm, err := NewFCM(testAccount(t, key, srv.URL+"/token"), srv.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		id, err := fcm.Send(context.Background(), Message{
+			Token: "device-1", Title: "Ciao", Body: "Nuovo ordine", Data: map[string]string{"key": "test"},
+		})
+		if err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		if id != "projects/demo/messages/42" {
+			t.Errorf("id = %q", id)
+		}
+	}
+	if *tokens != 1 {
+		t.Errorf("access token requested %d times, want 1 (cached)", *tokens)
+	}
+	msg := got["message"]
+	if msg["token"] != "device-1" || msg["notification"].(map[string]interface{})["title"] != "Ciao" {
+		t.Errorf("payload = %v", got)
+	}
+
+	if _, err := NewFCM(&ServiceAccount{ProjectID: "demo"}, srv.URL, 0); err == nil {
+		t.Error("account without key file accepted")
+	}
+}
+
+func TestFCMErrors(t *testing.T) {
+	key := testKey(t)
+	status := http.StatusNotFound
+	body := `{"error":{"code":404,"status":"NOT_FOUND","message":"Requested entity was not found."}}`
+	srv, _ := fakeFCM(t, key, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})
+	fcm, err := NewFCM(testAccount(t, key, srv.URL+"/token"), srv.URL, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func() error {
+		_, err := fcm.Send(context.Background(), Message{Token: "device-1", Title: "t", Body: "b"})
+		return err
+	}
+
+	if err := send(); !errors.Is(err, ErrUnregistered) {
+		t.Errorf("404: err = %v, want ErrUnregistered", err)
+	}
+
+	status = http.StatusBadRequest
+	body = `{"error":{"code":400,"status":"INVALID_ARGUMENT","details":[{"errorCode":"UNREGISTERED"}]}}`
+	if err := send(); !errors.Is(err, ErrUnregistered) {
+		t.Errorf("UNREGISTERED: err = %v, want ErrUnregistered", err)
+	}
+
+	body = `{"error":{"code":400,"status":"INVALID_ARGUMENT","message":"bad payload"}}`
+	if err := send(); !errors.Is(err, ErrPermanent) || errors.Is(err, ErrUnregistered) {
+		t.Errorf("400: err = %v, want ErrPermanent", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	body = `{"error":{"code":503,"status":"UNAVAILABLE"}}`
+	if err := send(); err == nil || errors.Is(err, ErrPermanent) || errors.Is(err, ErrUnregistered) {
+		t.Errorf("503: err = %v, want temporary error", err)
+	}
+}
+
+func TestLoadServiceAccount(t *testing.T) {
+	data := testAccount(t, testKey(t), "").Credentials
+	path := filepath.Join(t.TempDir(), "sa.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{path, "file://" + path} {
+		sa, err := LoadServiceAccount(context.Background(), source)
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		if sa.ProjectID != "demo" || string(sa.Credentials) != string(data) {
+			t.Errorf("%s: account = %+v", source, sa)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer srv.Close()
+	if _, err := LoadServiceAccount(context.Background(), srv.URL); err != nil {
+		t.Errorf("http: %v", err)
+	}
+
+	os.WriteFile(path, []byte(`{"project_id":"demo"}`), 0600)
+	if _, err := LoadServiceAccount(context.Background(), path); err == nil {
+		t.Error("incomplete service account accepted")
+	}
+}
@@ -0,0 +1,165 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	webpush "github.com/SherClockHolmes/webpush-go"
+
+	"qr-menu/pkg/webhook"
+)
+
+// VAPIDKeys is the application server key pair identifying the sender to the browsers'
+// push services (RFC 8292), as unpadded base64url: the uncompressed P-256 public key
+// (passed to pushManager.subscribe) and the private scalar
+type VAPIDKeys struct {
+	PublicKey  string
+	PrivateKey string
+}
+
+// GenerateVAPIDKeys creates a new VAPID key pair
+func GenerateVAPIDKeys() (VAPIDKeys, error) {
+	private, public, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+	return VAPIDKeys{PublicKey: public, PrivateKey: private}, nil
+}
+
+// Subscription is a browser push subscription (PushSubscription.toJSON())
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// WebPush sends encrypted notifications (RFC 8291) to browser push services,
+// authenticated with VAPID (RFC 8292), through webpush-go
+type WebPush struct {
+	publicKey  []byte
+	privateKey string
+	subject    string
+	client     *http.Client
+}
+
+// NewWebPush creates the Web Push sender. subject is the contact the push services can
+// use to reach the operator (mailto: or https: URL)
+func NewWebPush(keys VAPIDKeys, subject string, timeout time.Duration) (*WebPush, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(keys.PrivateKey, "="))
+	if err != nil {
+		return nil, fmt.Errorf("push: invalid VAPID private key: %w", err)
+	}
+	priv, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("push: invalid VAPID private key: %w", err)
+	}
+	public := priv.PublicKey().Bytes()
+	if keys.PublicKey != "" && keys.PublicKey != base64.RawURLEncoding.EncodeToString(public) {
+		return nil, fmt.Errorf("push: VAPID public key does not match the private key")
+	}
+	if !strings.HasPrefix(subject, "mailto:") && !strings.HasPrefix(subject, "https://") {
+		return nil, fmt.Errorf("push: VAPID subject must be a mailto: or https:// URL")
+	}
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &WebPush{
+		publicKey:  public,
+		privateKey: base64.RawURLEncoding.EncodeToString(raw),
+		subject:    subject,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: webhook.PublicTransport(timeout),
+			// The endpoint comes from the browser: a redirect must not lead to another host
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}, nil
+}
+
+// PublicKey returns the VAPID public key to pass as applicationServerKey to pushManager.subscribe
+func (p *WebPush) PublicKey() string {
+	return base64.RawURLEncoding.EncodeToString(p.publicKey)
+}
+
+// Send encrypts msg as JSON ({"title", "body", "data"}) and delivers it to the subscription.
+// It returns the message URL assigned by the push service, if any
+func (p *WebPush) Send(ctx context.Context, sub Subscription, msg Message) (string, error) {
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+		return "", fmt.Errorf("%w: invalid subscription endpoint", ErrPermanent)
+	}
+	if err := validateKeys(sub); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"title": msg.Title,
+		"body":  msg.Body,
+		"data":  msg.Data,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := webpush.SendNotificationWithContext(ctx, payload, &webpush.Subscription{
+		Endpoint: sub.Endpoint,
+		Keys:     webpush.Keys{P256dh: sub.Keys.P256dh, Auth: sub.Keys.Auth},
+	}, &webpush.Options{
+		HTTPClient: p.client,
+		// webpush-go adds mailto: itself to anything that is not an https: URL
+		Subscriber:      strings.TrimPrefix(p.subject, "mailto:"),
+		TTL:             int((24 * time.Hour).Seconds()),
+		VAPIDPublicKey:  p.PublicKey(),
+		VAPIDPrivateKey: p.privateKey,
+	})
+	if errors.Is(err, webpush.ErrMaxPadExceeded) {
+		return "", fmt.Errorf("%w: payload too large for a single record", ErrPermanent)
+	}
+	if err != nil {
+		return "", fmt.Errorf("push: webpush: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drained so the connection can be reused. The body never goes into the error, which
+	// ends up in the notification history shown to the owner
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.Header.Get("Location"), nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return "", fmt.Errorf("%w: push: webpush: HTTP %d", ErrUnregistered, resp.StatusCode)
+	}
+	err = fmt.Errorf("push: webpush: HTTP %d", resp.StatusCode)
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return "", fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	return "", err
+}
+
+// validateKeys checks the browser keys of the subscription, so that a subscription that can
+// never be encrypted for is reported as permanent instead of being retried
+func validateKeys(sub Subscription) error {
+	uaPublic, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(sub.Keys.P256dh, "="))
+	if err != nil {
+		return fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	if _, err := ecdh.P256().NewPublicKey(uaPublic); err != nil {
+		return fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(sub.Keys.Auth, "="))
+	if err != nil || len(authSecret) == 0 {
+		return fmt.Errorf("invalid auth secret")
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"qr-menu/pkg/webhook"
+)
+
+// browser simulates the user agent side of a subscription
+type browser struct {
+	key  *ecdh.PrivateKey
+	auth []byte
+}
+
+func newBrowser(t *testing.T, endpoint string) (*browser, Subscription) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &browser{key: key, auth: make([]byte, 16)}
+	rand.Read(b.auth)
+
+	var sub Subscription
+	sub.Endpoint = endpoint
+	sub.Keys.P256dh = base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes())
+	sub.Keys.Auth = base64.RawURLEncoding.EncodeToString(b.auth)
+	return b, sub
+}
+
+// decrypt reverses the aes128gcm encoding as a browser would
+func (b *browser) decrypt(t *testing.T, body []byte) []byte {
+	salt, rs, idLen := body[:16], binary.BigEndian.Uint32(body[16:20]), int(body[20])
+	if rs != 4096 || idLen != 65 {
+		t.Fatalf("header rs=%d idlen=%d", rs, idLen)
+	}
+	asPublic := body[21 : 21+idLen]
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared, _ := b.key.ECDH(asKey)
+
+	prkKey, _ := hkdf.Extract(sha256.New, shared, b.auth)
+	ikm, _ := hkdf.Expand(sha256.New, prkKey, "WebPush: info\x00"+string(b.key.PublicKey().Bytes())+string(asPublic), 32)
+	prk, _ := hkdf.Extract(sha256.New, ikm, salt)
+	cek, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	nonce, _ := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, body[21+idLen:], nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+	// The record is padded with zeros after the last record delimiter
+	plaintext = bytes.TrimRight(plaintext, "\x00")
+	if len(plaintext) == 0 || plaintext[len(plaintext)-1] != 0x02 {
+		t.Fatalf("missing last record delimiter")
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+// verifyVAPID checks the ES256 signature of the Authorization header against its k= key
+func verifyVAPID(t *testing.T, header string) map[string]interface{} {
+	var token, key string
+	for _, part := range strings.Split(strings.TrimPrefix(header, "vapid "), ", ") {
+		if v, ok := strings.CutPrefix(part, "t="); ok {
+			token = v
+		}
+		if v, ok := strings.CutPrefix(part, "k="); ok {
+			key = v
+		}
+	}
+	public, _ := base64.RawURLEncoding.DecodeString(key)
+	parts := strings.Split(token, ".")
+	if len(public) != 65 || len(parts) != 3 {
+		t.Fatalf("malformed VAPID header %q", header)
+	}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(public[1:33]), Y: new(big.Int).SetBytes(public[33:])}
+	if !ecdsa.Verify(pub, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		t.Fatal("invalid VAPID signature")
+	}
+	claims, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var result map[string]interface{}
+	json.Unmarshal(claims, &result)
+	return result
+}
+
+func TestWebPushSend(t *testing.T) {
+	keys, err := GenerateVAPIDKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b *browser
+	var got map[string]interface{}
+	var claims map[string]interface{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		claims = verifyVAPID(t, r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b.decrypt(t, body), &got)
+		w.Header().Set("Location", "https://push.example/m/1")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	b, sub := newBrowser(t, srv.URL+"/push/abc")
+	wp, err := NewWebPush(keys, "mailto:ops@example.com", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wp.client = srv.Client()
+	if wp.PublicKey() != keys.PublicKey {
+		t.Errorf("PublicKey() = %q, want %q", wp.PublicKey(), keys.PublicKey)
+	}
+
+	id, err := wp.Send(context.Background(), sub, Message{Title: "Ciao", Body: "Nuova recensione", Data: map[string]string{"key": "k"}})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if id != "https://push.example/m/1" {
+		t.Errorf("id = %q", id)
+	}
+	if got["title"] != "Ciao" || got["body"] != "Nuova recensione" {
+		t.Errorf("payload = %v", got)
+	}
+	if claims["aud"] != srv.URL || claims["sub"] != "mailto:ops@example.com" {
+		t.Errorf("claims = %v", claims)
+	}
+}
+
+func TestWebPushErrors(t *testing.T) {
+	keys, _ := GenerateVAPIDKeys()
+	status := http.StatusGone
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, "internal detail")
+	}))
+	defer srv.Close()
+
+	_, sub := newBrowser(t, srv.URL+"/push/abc")
+	wp, _ := NewWebPush(keys, "https://menu.example.com", 0)
+	wp.client = srv.Client()
+	send := func() error {
+		_, err := wp.Send(context.Background(), sub, Message{Title: "t"})
+		return err
+	}
+
+	if err := send(); !errors.Is(err, ErrUnregistered) {
+		t.Errorf("410: err = %v, want ErrUnregistered", err)
+	}
+	status = http.StatusBadRequest
+	if err := send(); !errors.Is(err, ErrPermanent) {
+		t.Errorf("400: err = %v, want ErrPermanent", err)
+	}
+	if err := send(); err != nil && strings.Contains(err.Error(), "internal detail") {
+		t.Errorf("error %q exposes the response body", err)
+	}
+	status = http.StatusTooManyRequests
+	if err := send(); err == nil || errors.Is(err, ErrPermanent) {
+		t.Errorf("429: err = %v, want temporary error", err)
+	}
+
+	sub.Endpoint = "http://insecure.example/push"
+	if err := send(); !errors.Is(err, ErrPermanent) {
+		t.Errorf("http endpoint: err = %v, want ErrPermanent", err)
+	}
+}
+
+func TestWebPushRejectsInternalAddresses(t *testing.T) {
+	keys, _ := GenerateVAPIDKeys()
+	hit := false
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer srv.Close()
+
+	wp, _ := NewWebPush(keys, "mailto:ops@example.com", time.Second)
+	for _, endpoint := range []string{
+		srv.URL + "/push/abc",
+		"https://169.254.169.254/latest/meta-data/",
+		"https://10.0.0.1/push",
+	} {
+		_, sub := newBrowser(t, endpoint)
+		_, err := wp.Send(context.Background(), sub, Message{Title: "t"})
+		if !errors.Is(err, webhook.ErrForbiddenAddress) {
+			t.Errorf("Send(%s) = %v, want ErrForbiddenAddress", endpoint, err)
+		}
+	}
+	if hit {
+		t.Error("the loopback push service was reached")
+	}
+}
+
+func TestNewWebPushValidation(t *testing.T) {
+	keys, _ := GenerateVAPIDKeys()
+	other, _ := GenerateVAPIDKeys()
+
+	if _, err := NewWebPush(keys, "ops@example.com", 0); err == nil {
+		t.Error("subject without mailto: accepted")
+	}
+	if _, err := NewWebPush(VAPIDKeys{PublicKey: other.PublicKey, PrivateKey: keys.PrivateKey}, "mailto:a@b.c", 0); err == nil {
+		t.Error("mismatched key pair accepted")
+	}
+	if _, err := NewWebPush(VAPIDKeys{PrivateKey: "not-a-key"}, "mailto:a@b.c", 0); err == nil {
+		t.Error("invalid private key accepted")
+	}
+}
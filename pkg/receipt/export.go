@@ -0,0 +1,244 @@
+package receipt
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Entry is an order in the export for the accountant
+type Entry struct {
+	Date          time.Time
+	Number        string // Receipt number
+	OrderID       string
+	Table         string
+	Status        string
+	PaymentStatus string
+	PaymentMethod string
+	TotalCents    int64 // VAT included
+	VATRate       float64
+	VoucherCents  int64
+	OnlineCents   int64 // Tips included
+	TipCents      int64
+	RefundedCents int64
+}
+
+// ExportWriter writes the entries of an export one at a time, so that a month of orders is
+// never held in memory. Close completes the document
+type ExportWriter interface {
+	Write(e Entry) error
+	Close() error
+}
+
+// csvHeader is the header row of the CSV export
+var csvHeader = []string{
+	"Data", "Numero", "ID ordine", "Tavolo", "Stato", "Pagamento", "Metodo",
+	"Totale", "Imponibile", "Aliquota IVA", "IVA", "Buono regalo", "Pagato online", "Mancia", "Rimborsato",
+}
+
+// csvWriter writes the export as CSV separated by semicolons, with decimal commas, as opened
+// by spreadsheets with Italian settings
+type csvWriter struct {
+	w      *csv.Writer
+	header bool
+}
+
+// NewCSVWriter returns an export writer producing CSV
+func NewCSVWriter(w io.Writer) ExportWriter {
+	cw := csv.NewWriter(w)
+	cw.Comma = ';'
+	return &csvWriter{w: cw}
+}
+
+func (c *csvWriter) Write(e Entry) error {
+	if !c.header {
+		c.header = true
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	taxable, vat := SplitVAT(e.TotalCents, e.VATRate)
+	return c.w.Write([]string{
+		e.Date.Format("02/01/2006 15:04"),
+		e.Number,
+		e.OrderID,
+		e.Table,
+		e.Status,
+		e.PaymentStatus,
+		e.PaymentMethod,
+		FormatAmount(e.TotalCents),
+		FormatAmount(taxable),
+		FormatRate(e.VATRate),
+		FormatAmount(vat),
+		FormatAmount(e.VoucherCents),
+		FormatAmount(e.OnlineCents),
+		FormatAmount(e.TipCents),
+		FormatAmount(e.RefundedCents),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	if !c.header {
+		c.header = true
+		c.w.Write(csvHeader)
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// xmlSeller is the seller in the XML export
+type xmlSeller struct {
+	Name      string `xml:"Denominazione"`
+	LegalName string `xml:"RagioneSociale,omitempty"`
+	VATNumber string `xml:"PartitaIVA,omitempty"`
+	TaxCode   string `xml:"CodiceFiscale,omitempty"`
+	Address   string `xml:"Sede,omitempty"`
+}
+
+// xmlEntry is an order in the XML export. Amounts use a decimal point
+type xmlEntry struct {
+	XMLName       xml.Name `xml:"Ordine"`
+	Date          string   `xml:"Data"`
+	Number        string   `xml:"Numero"`
+	OrderID       string   `xml:"IdOrdine"`
+	Table         string   `xml:"Tavolo,omitempty"`
+	Status        string   `xml:"Stato"`
+	PaymentStatus string   `xml:"StatoPagamento,omitempty"`
+	PaymentMethod string   `xml:"MetodoPagamento,omitempty"`
+	Total         string   `xml:"Totale"`
+	Taxable       string   `xml:"Imponibile"`
+	VATRate       string   `xml:"AliquotaIVA"`
+	VAT           string   `xml:"Imposta"`
+	Voucher       string   `xml:"BuonoRegalo,omitempty"`
+	Online        string   `xml:"PagatoOnline,omitempty"`
+	Tip           string   `xml:"Mancia,omitempty"`
+	Refunded      string   `xml:"Rimborsato,omitempty"`
+}
+
+// xmlSummary holds the totals of the XML export
+type xmlSummary struct {
+	XMLName xml.Name `xml:"Riepilogo"`
+	Orders  int      `xml:"NumeroOrdini"`
+	Total   string   `xml:"Totale"`
+	Taxable string   `xml:"Imponibile"`
+	VAT     string   `xml:"Imposta"`
+	Voucher string   `xml:"BuonoRegalo"`
+	Online  string   `xml:"PagatoOnline"`
+	Tip     string   `xml:"Mancia"`
+	Refund  string   `xml:"Rimborsato"`
+}
+
+// xmlWriter writes the export as an XML document with the seller, the orders and a summary
+type xmlWriter struct {
+	enc     *xml.Encoder
+	root    xml.StartElement
+	started bool
+	seller  Seller
+	period  string
+	orders  int
+	total   int64
+	taxable int64
+	vat     int64
+	voucher int64
+	online  int64
+	tip     int64
+	refund  int64
+}
+
+// NewXMLWriter returns an export writer producing XML for the period, e.g. 2026-10
+func NewXMLWriter(w io.Writer, period string, seller Seller) ExportWriter {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return &xmlWriter{enc: enc, seller: seller, period: period}
+}
+
+func (x *xmlWriter) start() error {
+	if x.started {
+		return nil
+	}
+	x.started = true
+	if err := x.enc.EncodeToken(xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8"`)}); err != nil {
+		return err
+	}
+	x.root = xml.StartElement{Name: xml.Name{Local: "EsportazioneOrdini"}, Attr: []xml.Attr{{Name: xml.Name{Local: "periodo"}, Value: x.period}}}
+	if err := x.enc.EncodeToken(x.root); err != nil {
+		return err
+	}
+	seller := xmlSeller(x.seller)
+	return x.enc.EncodeElement(seller, xml.StartElement{Name: xml.Name{Local: "Cedente"}})
+}
+
+func (x *xmlWriter) Write(e Entry) error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	taxable, vat := SplitVAT(e.TotalCents, e.VATRate)
+	x.orders++
+	x.total += e.TotalCents
+	x.taxable += taxable
+	x.vat += vat
+	x.voucher += e.VoucherCents
+	x.online += e.OnlineCents
+	x.tip += e.TipCents
+	x.refund += e.RefundedCents
+	return x.enc.Encode(xmlEntry{
+		Date:          e.Date.Format(time.RFC3339),
+		Number:        e.Number,
+		OrderID:       e.OrderID,
+		Table:         e.Table,
+		Status:        e.Status,
+		PaymentStatus: e.PaymentStatus,
+		PaymentMethod: e.PaymentMethod,
+		Total:         decimal(e.TotalCents),
+		Taxable:       decimal(taxable),
+		VATRate:       strconv.FormatFloat(e.VATRate, 'f', -1, 64),
+		VAT:           decimal(vat),
+		Voucher:       optionalDecimal(e.VoucherCents),
+		Online:        optionalDecimal(e.OnlineCents),
+		Tip:           optionalDecimal(e.TipCents),
+		Refunded:      optionalDecimal(e.RefundedCents),
+	})
+}
+
+func (x *xmlWriter) Close() error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	summary := xmlSummary{
+		Orders:  x.orders,
+		Total:   decimal(x.total),
+		Taxable: decimal(x.taxable),
+		VAT:     decimal(x.vat),
+		Voucher: decimal(x.voucher),
+		Online:  decimal(x.online),
+		Tip:     decimal(x.tip),
+		Refund:  decimal(x.refund),
+	}
+	if err := x.enc.Encode(summary); err != nil {
+		return err
+	}
+	if err := x.enc.EncodeToken(x.root.End()); err != nil {
+		return err
+	}
+	return x.enc.Flush()
+}
+
+// decimal formats cents with a decimal point, e.g. 1234.50
+func decimal(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func optionalDecimal(cents int64) string {
+	if cents == 0 {
+		return ""
+	}
+	return decimal(cents)
+}
@@ -0,0 +1,182 @@
+package receipt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// Layout of the receipt: a roll of 80 mm set in Courier, whose fixed width lets the amounts
+// be aligned by counting characters
+const (
+	pageWidth  = 226.77 // 80 mm in points
+	margin     = 12.0
+	fontSize   = 8.0
+	lineHeight = 10.0
+	columns    = 42 // Courier is 0.6 em wide: 42 characters fill the roll between the margins
+)
+
+// receiptLine is a line of text of the receipt
+type receiptLine struct {
+	text string
+	bold bool
+}
+
+// WritePDF writes the receipt as a single page PDF, as tall as the receipt needs
+func WritePDF(w io.Writer, r Receipt) error {
+	return writePDF(w, layout(r))
+}
+
+// layout sets the receipt into lines of at most columns characters
+func layout(r Receipt) []receiptLine {
+	var lines []receiptLine
+	text := func(s string, bold bool) {
+		for _, wrapped := range wrap(s, columns) {
+			lines = append(lines, receiptLine{text: wrapped, bold: bold})
+		}
+	}
+	amount := func(label string, cents int64, bold bool) {
+		lines = append(lines, receiptLine{text: justify(label, FormatAmount(cents)), bold: bold})
+	}
+	rule := func() {
+		lines = append(lines, receiptLine{text: strings.Repeat("-", columns)})
+	}
+
+	seller := r.Seller
+	if seller.LegalName != "" {
+		text(seller.LegalName, true)
+		if seller.Name != "" && seller.Name != seller.LegalName {
+			text(seller.Name, false)
+		}
+	} else {
+		text(seller.Name, true)
+	}
+	if seller.Address != "" {
+		text(seller.Address, false)
+	}
+	if seller.VATNumber != "" {
+		text("P.IVA "+seller.VATNumber, false)
+	}
+	if seller.TaxCode != "" && seller.TaxCode != seller.VATNumber {
+		text("C.F. "+seller.TaxCode, false)
+	}
+	rule()
+
+	text("RICEVUTA N. "+r.Number, true)
+	issued := r.IssuedAt.Format("02/01/2006 15:04")
+	if r.Table != "" {
+		lines = append(lines, receiptLine{text: justify(issued, "Tavolo "+r.Table)})
+	} else {
+		text(issued, false)
+	}
+	rule()
+
+	for _, line := range r.Lines {
+		desc := wrap(fmt.Sprintf("%d x %s", line.Quantity, line.Name), columns-11)
+		for _, d := range desc[:len(desc)-1] {
+			text(d, false)
+		}
+		amount(desc[len(desc)-1], line.TotalCents(), false)
+		if line.Quantity > 1 {
+			text("    cad. "+FormatAmount(line.UnitCents), false)
+		}
+	}
+	rule()
+
+	total := r.TotalCents()
+	taxable, vat := SplitVAT(total, r.VATRate)
+	amount("TOTALE "+strings.ToUpper(r.Currency), total, true)
+	amount("Imponibile", taxable, false)
+	amount("IVA "+FormatRate(r.VATRate)+"%", vat, false)
+	if r.VoucherCents > 0 {
+		amount("Pagato con buono regalo", r.VoucherCents, false)
+	}
+	if r.OnlineCents > 0 {
+		label := "Pagato online"
+		if r.OnlineMethod != "" {
+			label += " (" + r.OnlineMethod + ")"
+		}
+		amount(label, r.OnlineCents, false)
+	}
+	if r.TipCents > 0 {
+		amount("  di cui mancia", r.TipCents, false)
+	}
+	if r.RefundedCents > 0 {
+		amount("Rimborsato", r.RefundedCents, false)
+	}
+	rule()
+
+	if r.Footer != "" {
+		for _, paragraph := range strings.Split(r.Footer, "\n") {
+			text(paragraph, false)
+		}
+	}
+	text("Documento non fiscale", false)
+	return lines
+}
+
+// justify puts left and right at the two ends of a line, shortening left if they do not fit
+func justify(left, right string) string {
+	room := columns - utf8.RuneCountInString(right) - 1
+	if n := utf8.RuneCountInString(left); n > room {
+		left = string([]rune(left)[:room])
+	}
+	return left + strings.Repeat(" ", columns-utf8.RuneCountInString(left)-utf8.RuneCountInString(right)) + right
+}
+
+// wrap breaks s into lines of at most width characters, at spaces where possible
+func wrap(s string, width int) []string {
+	var lines []string
+	var current []rune
+	for _, word := range strings.Fields(s) {
+		w := []rune(word)
+		if len(current) > 0 && len(current)+1+len(w) > width {
+			lines = append(lines, string(current))
+			current = nil
+		}
+		if len(current) > 0 {
+			current = append(current, ' ')
+		}
+		current = append(current, w...)
+		for len(current) > width {
+			lines = append(lines, string(current[:width]))
+			current = current[width:]
+		}
+	}
+	if len(current) > 0 || len(lines) == 0 {
+		lines = append(lines, string(current))
+	}
+	return lines
+}
+
+// writePDF writes the lines as a PDF document using the standard Courier fonts, which readers
+// provide without embedding. The text is encoded in WinAnsi: other characters become '.'
+func writePDF(w io.Writer, lines []receiptLine) error {
+	height := 2*margin + float64(len(lines))*lineHeight
+
+	pdf := fpdf.NewCustom(&fpdf.InitType{
+		UnitStr: "pt",
+		Size:    fpdf.SizeType{Wd: pageWidth, Ht: height},
+	})
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetCellMargin(0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.AddPage()
+	winAnsi := pdf.UnicodeTranslatorFromDescriptor("")
+	font := "-"
+	for _, line := range lines {
+		style := ""
+		if line.bold {
+			style = "B"
+		}
+		if style != font {
+			pdf.SetFont("Courier", style, fontSize)
+			font = style
+		}
+		pdf.CellFormat(0, lineHeight, winAnsi(line.text), "", 1, "L", false, 0, "")
+	}
+	return pdf.Output(w)
+}
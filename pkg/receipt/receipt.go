@@ -0,0 +1,122 @@
+// Package receipt renders the receipt of an order as a PDF ready to print, laid out like a till
+// receipt, and exports the orders of a period for the accountant as CSV or XML. Prices include
+// VAT: the taxable amount and the VAT are worked out from the total at the restaurant's rate.
+package receipt
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Seller identifies the restaurant on receipts and exports
+type Seller struct {
+	Name      string // Trading name
+	LegalName string // Company name, if different
+	VATNumber string
+	TaxCode   string
+	Address   string // Registered office
+}
+
+// Line is an item of the receipt
+type Line struct {
+	Name      string
+	Quantity  int
+	UnitCents int64 // VAT included
+}
+
+// TotalCents returns the amount of the line
+func (l Line) TotalCents() int64 {
+	return int64(l.Quantity) * l.UnitCents
+}
+
+// Receipt is the receipt of an order
+type Receipt struct {
+	Seller        Seller
+	Number        string
+	IssuedAt      time.Time
+	Table         string
+	Lines         []Line
+	Currency      string
+	VATRate       float64 // Percent
+	VoucherCents  int64   // Paid with a gift voucher
+	OnlineCents   int64   // Paid online, tips included
+	TipCents      int64   // Tips left with the online payments, not part of the total
+	OnlineMethod  string  // Payment provider, e.g. Stripe
+	RefundedCents int64
+	Footer        string
+}
+
+// TotalCents returns the total of the receipt, VAT included
+func (r Receipt) TotalCents() int64 {
+	var total int64
+	for _, line := range r.Lines {
+		total += line.TotalCents()
+	}
+	return total
+}
+
+// SplitVAT splits an amount that includes VAT at rate percent into taxable amount and VAT
+func SplitVAT(grossCents int64, rate float64) (taxable, vat int64) {
+	if rate <= 0 {
+		return grossCents, 0
+	}
+	taxable = int64(math.Round(float64(grossCents) / (1 + rate/100)))
+	return taxable, grossCents - taxable
+}
+
+// FormatAmount formats cents with the decimal comma used in Italy, e.g. 1234,50
+func FormatAmount(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d,%02d", sign, cents/100, cents%100)
+}
+
+// FormatRate formats a VAT rate without trailing zeros, e.g. 10 or 5,5
+func FormatRate(rate float64) string {
+	return strings.Replace(strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", rate), "0"), "."), ".", ",", 1)
+}
+
+var (
+	euVATNumber = regexp.MustCompile(`^[A-Z]{2}[0-9A-Z+*]{2,13}$`)
+	itVATNumber = regexp.MustCompile(`^[0-9]{11}$`)
+)
+
+// NormalizeVATNumber removes spaces and dots and upper-cases a VAT number
+func NormalizeVATNumber(number string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", ".", "", "-", "").Replace(number))
+}
+
+// ValidVATNumber checks a normalized VAT number: Italian numbers, with or without the IT
+// prefix, are checked with their check digit, the other EU numbers only by their format
+func ValidVATNumber(number string) bool {
+	digits := strings.TrimPrefix(number, "IT")
+	if itVATNumber.MatchString(digits) {
+		return italianVATCheck(digits)
+	}
+	if strings.HasPrefix(number, "IT") {
+		return false
+	}
+	return euVATNumber.MatchString(number)
+}
+
+// italianVATCheck verifies the check digit (Luhn) of an Italian partita IVA
+func italianVATCheck(digits string) bool {
+	sum := 0
+	for i := 0; i < 10; i++ {
+		d := int(digits[i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return (10-sum%10)%10 == int(digits[10]-'0')
+}
@@ -0,0 +1,208 @@
+package receipt
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitVAT(t *testing.T) {
+	tests := []struct {
+		gross   int64
+		rate    float64
+		taxable int64
+		vat     int64
+	}{
+		{1100, 10, 1000, 100},
+		{2450, 10, 2227, 223},
+		{1000, 22, 820, 180},
+		{999, 0, 999, 0},
+	}
+	for _, tt := range tests {
+		taxable, vat := SplitVAT(tt.gross, tt.rate)
+		if taxable != tt.taxable || vat != tt.vat {
+			t.Errorf("SplitVAT(%d, %v) = %d, %d, want %d, %d", tt.gross, tt.rate, taxable, vat, tt.taxable, tt.vat)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	if got := FormatAmount(123450); got != "1234,50" {
+		t.Errorf("FormatAmount = %q", got)
+	}
+	if got := FormatAmount(-5); got != "-0,05" {
+		t.Errorf("FormatAmount(-5) = %q", got)
+	}
+	if got := FormatRate(10); got != "10" {
+		t.Errorf("FormatRate(10) = %q", got)
+	}
+	if got := FormatRate(5.5); got != "5,5" {
+		t.Errorf("FormatRate(5.5) = %q", got)
+	}
+}
+
+func TestValidVATNumber(t *testing.T) {
+	for number, want := range map[string]bool{
+		"01234567897":   true,
+		"IT01234567897": true,
+		"01234567890":   false,
+		"IT123":         false,
+		"DE123456789":   true,
+		"123":           false,
+	} {
+		if got := ValidVATNumber(NormalizeVATNumber(number)); got != want {
+			t.Errorf("ValidVATNumber(%q) = %v, want %v", number, got, want)
+		}
+	}
+}
+
+func testReceipt() Receipt {
+	return Receipt{
+		Seller:   Seller{Name: "Trattoria (da Mario)", LegalName: "Mario Rossi S.r.l.", VATNumber: "01234567897", Address: "Via Roma 1, Milano"},
+		Number:   "2026-10-16/12",
+		IssuedAt: time.Date(2026, 10, 16, 20, 15, 0, 0, time.UTC),
+		Table:    "12",
+		Lines: []Line{
+			{Name: "Margherita", Quantity: 2, UnitCents: 800},
+			{Name: "Tagliata di manzo con rucola e scaglie di grana padano", Quantity: 1, UnitCents: 1850},
+		},
+		Currency:     "EUR",
+		VATRate:      10,
+		VoucherCents: 500,
+		Footer:       "Grazie e arrivederci €",
+	}
+}
+
+func TestLayout(t *testing.T) {
+	lines := layout(testReceipt())
+	var texts []string
+	for _, line := range lines {
+		if n := len([]rune(line.text)); n > columns {
+			t.Errorf("line %q is %d characters long", line.text, n)
+		}
+		texts = append(texts, line.text)
+	}
+	text := strings.Join(texts, "\n")
+	for _, want := range []string{
+		"Mario Rossi S.r.l.",
+		"P.IVA 01234567897",
+		"RICEVUTA N. 2026-10-16/12",
+		"16/10/2026 20:15",
+		"2 x Margherita                       16,00",
+		"TOTALE EUR                           34,50",
+		"Imponibile                           31,36",
+		"IVA 10%                               3,14",
+		"Pagato con buono regalo               5,00",
+		"Documento non fiscale",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("receipt lacks %q:\n%s", want, text)
+		}
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, testReceipt()); err != nil {
+		t.Fatal(err)
+	}
+	pdf := buf.Bytes()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("not a PDF document")
+	}
+	if !bytes.Contains(pdf, []byte("/Count 1")) || !bytes.Contains(pdf, []byte("/BaseFont /Courier-Bold")) {
+		t.Error("expected a single page set in Courier")
+	}
+
+	// The page content is the first compressed stream
+	stream := regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindSubmatch(pdf)
+	if stream == nil {
+		t.Fatal("no content stream")
+	}
+	r, err := zlib.NewReader(bytes.NewReader(stream[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(content, []byte(`(Trattoria \(da Mario\))Tj`)) {
+		t.Error("parentheses are not escaped")
+	}
+	if !bytes.Contains(content, []byte("arrivederci \x80")) {
+		t.Error("euro sign is not encoded in WinAnsi")
+	}
+}
+
+func testEntries() []Entry {
+	return []Entry{
+		{Date: time.Date(2026, 10, 1, 13, 0, 0, 0, time.UTC), Number: "2026-10-01/1", OrderID: "o1", Table: "4",
+			Status: "completed", TotalCents: 2450, VATRate: 10, OnlineCents: 2695, TipCents: 245, PaymentStatus: "paid", PaymentMethod: "satispay"},
+		{Date: time.Date(2026, 10, 2, 20, 30, 0, 0, time.UTC), Number: "2026-10-02/7", OrderID: "o2",
+			Status: "completed", TotalCents: 1100, VATRate: 10, VoucherCents: 1100},
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	for _, e := range testEntries() {
+		if err := w.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(rows) != 3 || !strings.HasPrefix(rows[0], "Data;Numero;") {
+		t.Fatalf("rows = %q", rows)
+	}
+	want := "01/10/2026 13:00;2026-10-01/1;o1;4;completed;paid;satispay;24,50;22,27;10;2,23;0,00;26,95;2,45;0,00"
+	if rows[1] != want {
+		t.Errorf("row = %q, want %q", rows[1], want)
+	}
+
+	buf.Reset()
+	if err := NewCSVWriter(&buf).Close(); err != nil || !strings.HasPrefix(buf.String(), "Data;") {
+		t.Errorf("empty export = %q, %v", buf.String(), err)
+	}
+}
+
+func TestXMLWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewXMLWriter(&buf, "2026-10", Seller{Name: "Trattoria", VATNumber: "01234567897"})
+	for _, e := range testEntries() {
+		if err := w.Write(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Period  string     `xml:"periodo,attr"`
+		Seller  xmlSeller  `xml:"Cedente"`
+		Orders  []xmlEntry `xml:"Ordine"`
+		Summary xmlSummary `xml:"Riepilogo"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if doc.Period != "2026-10" || doc.Seller.VATNumber != "01234567897" || len(doc.Orders) != 2 {
+		t.Fatalf("doc = %+v", doc)
+	}
+	if doc.Orders[0].Total != "24.50" || doc.Orders[0].VAT != "2.23" || doc.Orders[1].Voucher != "11.00" {
+		t.Errorf("orders = %+v", doc.Orders)
+	}
+	if doc.Summary.Orders != 2 || doc.Summary.Total != "35.50" || doc.Summary.VAT != "3.23" || doc.Summary.Online != "26.95" || doc.Summary.Tip != "2.45" {
+		t.Errorf("summary = %+v", doc.Summary)
+	}
+}
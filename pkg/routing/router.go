@@ -3,6 +3,7 @@ package routing
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	"qr-menu/pkg/container"
 	"qr-menu/pkg/errors"
@@ -147,7 +148,7 @@ func (r *Router) setupAnalyticsRoutes(api *mux.Router) {
 	analytics.HandleFunc("/dashboard", analyticsHandlers.GetDashboard).Methods("GET")
 	analytics.HandleFunc("/stats", analyticsHandlers.GetStats).Methods("GET")
 	analytics.HandleFunc("/track", analyticsHandlers.TrackEvent).Methods("POST")
-	analytics.HandleFunc("/export", analyticsHandlers.ExportData).Methods("GET")
+	analytics.HandleFunc("/export", middleware.NoCache(analyticsHandlers.ExportData)).Methods("GET")
 }
 
 // setupLocalizationRoutes configures localization-related routes
@@ -230,6 +231,7 @@ func (r *Router) setupCachingMiddleware() {
 
 	// Apply response caching middleware
 	r.responseCaching = middleware.NewResponseCachingMiddleware(respCache, cfg.Cache.ResponseCacheTTL)
+	r.registerCachePolicies()
 	r.mux.Use(mux.MiddlewareFunc(r.responseCaching.Middleware()))
 
 	// Apply cache invalidation middleware
@@ -240,6 +242,45 @@ func (r *Router) setupCachingMiddleware() {
 	r.registerCacheInvalidationPatterns()
 }
 
+// registerCachePolicies sets which routes are cached, for how long and by which variants
+func (r *Router) registerCachePolicies() {
+	policies := map[string]middleware.CachePolicy{
+		// Health and status must reflect the current state
+		"/health":  {NoStore: true},
+		"/healthz": {NoStore: true},
+		"/ready":   {NoStore: true},
+		"/status":  {NoStore: true},
+
+		// Admin and operational data is never shared
+		"/api/admin":       {NoStore: true},
+		"/api/auth":        {NoStore: true},
+		"/api/v1/backup":   {NoStore: true},
+		"/api/v1/database": {NoStore: true},
+		"/api/v1/pwa":      {NoStore: true},
+
+		// Per-user data is cached for each authenticated subject
+		"/api/v1/analytics":     {PerSubject: true, TTL: time.Minute},
+		"/api/v1/notifications": {PerSubject: true, TTL: 30 * time.Second},
+
+		// Translations and formats depend on the requested language
+		"/api/v1/i18n": {VaryHeaders: []string{"Accept-Language"}, TTL: time.Hour},
+
+		"/manifest.json":     {TTL: time.Hour},
+		"/service-worker.js": {TTL: time.Hour},
+	}
+
+	// Configured TTLs override the defaults above
+	for prefix, ttl := range r.container.Config().Cache.RouteTTL {
+		policy := policies[prefix]
+		policy.TTL = ttl
+		policies[prefix] = policy
+	}
+
+	for prefix, policy := range policies {
+		r.responseCaching.SetPolicy(prefix, policy)
+	}
+}
+
 // registerCacheInvalidationPatterns registers which paths invalidate which cache entries
 func (r *Router) registerCacheInvalidationPatterns() {
 	if r.cacheInvalidation == nil {
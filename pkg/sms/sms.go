@@ -0,0 +1,296 @@
+// Package sms sends text messages through Twilio or Vonage and parses the callbacks with
+// which the providers report delivery status and replies such as STOP. Without a provider
+// messages are only logged.
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"qr-menu/logger"
+)
+
+// ErrInvalidMessage is matched (with errors.Is) by the error returned for messages with an
+// invalid recipient or an empty body
+var ErrInvalidMessage = errors.New("invalid sms message")
+
+// ErrPermanent is matched by delivery errors that would fail again on retry, e.g. an
+// unreachable number or invalid API credentials
+var ErrPermanent = errors.New("permanent sms delivery failure")
+
+// ErrOptedOut is matched by the error returned when the recipient replied STOP and the
+// provider refuses to deliver further messages. It also matches ErrPermanent
+var ErrOptedOut = fmt.Errorf("%w: recipient opted out", ErrPermanent)
+
+// ErrUnauthenticated is returned by the callback parsers for requests that were not signed
+// by the provider
+var ErrUnauthenticated = errors.New("sms: callback not authenticated")
+
+// Providers
+const (
+	ProviderLog    = "log"
+	ProviderTwilio = "twilio"
+	ProviderVonage = "vonage"
+)
+
+// Delivery status reported by the callbacks
+const (
+	StatusSent        = "sent"        // Accepted by the carrier
+	StatusDelivered   = "delivered"   // Confirmed by the handset
+	StatusUndelivered = "undelivered" // Not delivered, e.g. phone off for too long
+	StatusFailed      = "failed"      // Rejected by the provider or the carrier
+)
+
+// MaxSegments is the number of concatenated segments a message is truncated to by Fit
+const MaxSegments = 3
+
+// Message is a text message. To is an international number without the leading '+',
+// e.g. 393331234567
+type Message struct {
+	To   string
+	Body string
+}
+
+// StatusUpdate is a delivery status callback
+type StatusUpdate struct {
+	MessageID string
+	Status    string // One of the Status constants, "" for intermediate states
+	ErrorCode string
+}
+
+// Inbound is a message sent by a recipient to one of the sender numbers
+type Inbound struct {
+	From string // International number without the leading '+'
+	Body string
+}
+
+// Provider sends text messages and authenticates the callbacks of the provider
+type Provider interface {
+	Name() string
+	// Send delivers msg and returns the provider message ID, reported again by status callbacks
+	Send(ctx context.Context, msg Message) (string, error)
+	// ParseStatus verifies and parses a delivery status callback
+	ParseStatus(r *http.Request) (*StatusUpdate, error)
+	// ParseInbound verifies and parses an incoming message callback
+	ParseInbound(r *http.Request) (*Inbound, error)
+}
+
+// Config holds the SMS provider configuration
+type Config struct {
+	Provider string            // log, twilio or vonage
+	From     string            // Default sender: a number in international form or an alphanumeric ID
+	Senders  map[string]string // Sender by country calling code of the recipient, e.g. "1" -> "+15551234567"
+	Timeout  time.Duration
+
+	// Twilio
+	AccountSID string
+	AuthToken  string // Also signs the callbacks
+
+	// Vonage
+	APIKey       string
+	APISecret    string
+	WebhookToken string // Query parameter "token" expected on the callbacks, which Vonage does not sign
+
+	APIBase    string // API endpoint, defaults to TwilioAPIBase or VonageAPIBase
+	StatusURL  string // Public URL of the delivery status callback, empty disables the reports
+	InboundURL string // Public URL of the incoming message callback, as configured on the provider
+}
+
+// New creates the provider selected by cfg.Provider
+func New(cfg Config) (Provider, error) {
+	if cfg.Provider == "" || cfg.Provider == ProviderLog {
+		return &Log{cfg: cfg}, nil
+	}
+	if cfg.From == "" && len(cfg.Senders) == 0 {
+		return nil, fmt.Errorf("sms: sender is required")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+
+	switch cfg.Provider {
+	case ProviderTwilio:
+		if cfg.AccountSID == "" || cfg.AuthToken == "" {
+			return nil, fmt.Errorf("sms: Twilio account SID and auth token are required")
+		}
+		if cfg.APIBase == "" {
+			cfg.APIBase = TwilioAPIBase
+		}
+		cfg.APIBase = strings.TrimRight(cfg.APIBase, "/")
+		return &Twilio{cfg: cfg, client: client}, nil
+	case ProviderVonage:
+		if cfg.APIKey == "" || cfg.APISecret == "" {
+			return nil, fmt.Errorf("sms: Vonage API key and secret are required")
+		}
+		if cfg.WebhookToken == "" {
+			return nil, fmt.Errorf("sms: Vonage webhook token is required")
+		}
+		if cfg.APIBase == "" {
+			cfg.APIBase = VonageAPIBase
+		}
+		cfg.APIBase = strings.TrimRight(cfg.APIBase, "/")
+		return &Vonage{cfg: cfg, client: client}, nil
+	default:
+		return nil, fmt.Errorf("sms: unknown provider %q", cfg.Provider)
+	}
+}
+
+// SenderFor returns the sender for number: the entry of Senders with the longest country
+// code prefixing it, or From
+func (c Config) SenderFor(number string) string {
+	sender, matched := c.From, 0
+	for code, s := range c.Senders {
+		if len(code) > matched && strings.HasPrefix(number, code) {
+			sender, matched = s, len(code)
+		}
+	}
+	return sender
+}
+
+// Log only records messages in the application log, for development and tests
+type Log struct {
+	cfg Config
+}
+
+// Name returns "log"
+func (*Log) Name() string { return ProviderLog }
+
+// Send logs the message and returns an ID derived from the current time
+func (l *Log) Send(ctx context.Context, msg Message) (string, error) {
+	if err := msg.validate(); err != nil {
+		return "", err
+	}
+	logger.InfoCtx(ctx, "SMS (provider non configurato)", map[string]interface{}{
+		"to":   msg.To,
+		"from": l.cfg.SenderFor(msg.To),
+		"body": msg.Body,
+	})
+	return fmt.Sprintf("log-%d", time.Now().UnixNano()), nil
+}
+
+// ParseStatus rejects every callback: the log provider has none
+func (*Log) ParseStatus(r *http.Request) (*StatusUpdate, error) { return nil, ErrUnauthenticated }
+
+// ParseInbound rejects every callback: the log provider has none
+func (*Log) ParseInbound(r *http.Request) (*Inbound, error) { return nil, ErrUnauthenticated }
+
+// validate rejects empty bodies and recipients that are not international numbers
+func (m Message) validate() error {
+	if len(m.To) < 8 || len(m.To) > 15 || m.To[0] == '0' {
+		return fmt.Errorf("%w: invalid recipient %q", ErrInvalidMessage, m.To)
+	}
+	for _, c := range m.To {
+		if c < '0' || c > '9' {
+			return fmt.Errorf("%w: invalid recipient %q", ErrInvalidMessage, m.To)
+		}
+	}
+	if strings.TrimSpace(m.Body) == "" {
+		return fmt.Errorf("%w: empty body", ErrInvalidMessage)
+	}
+	return nil
+}
+
+// gsmCharset holds the characters of the GSM 7-bit default alphabet. Messages using only
+// these fit 160 characters per segment, the others are sent as UCS-2 with 70
+const gsmCharset = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// gsmExtended holds the characters of the GSM extension table, which count twice
+const gsmExtended = "^{}\\[~]|€\f"
+
+// IsGSM reports whether body can be encoded with the GSM 7-bit alphabet
+func IsGSM(body string) bool {
+	for _, c := range body {
+		if !strings.ContainsRune(gsmCharset, c) && !strings.ContainsRune(gsmExtended, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Segments returns how many segments body takes once sent
+func Segments(body string) int {
+	if body == "" {
+		return 0
+	}
+	single, multi, length := 70, 67, utf8.RuneCountInString(body)
+	if IsGSM(body) {
+		single, multi, length = 160, 153, gsmLength(body)
+	}
+	if length <= single {
+		return 1
+	}
+	return (length + multi - 1) / multi
+}
+
+// Fit collapses the whitespace of body and truncates it to MaxSegments segments, ending it
+// with an ellipsis when cut
+func Fit(body string) string {
+	body = strings.Join(strings.Fields(body), " ")
+	if Segments(body) <= MaxSegments {
+		return body
+	}
+	limit := MaxSegments * 67
+	if IsGSM(body) {
+		limit = MaxSegments * 153
+	}
+	runes := []rune(body)
+	if len(runes) > limit {
+		runes = runes[:limit]
+	}
+	for len(runes) > 0 {
+		cut := string(runes) + "..."
+		length := utf8.RuneCountInString(cut)
+		if IsGSM(cut) {
+			length = gsmLength(cut)
+		}
+		if length <= limit {
+			return cut
+		}
+		runes = runes[:len(runes)-1]
+	}
+	return ""
+}
+
+func gsmLength(body string) int {
+	n := 0
+	for _, c := range body {
+		n++
+		if strings.ContainsRune(gsmExtended, c) {
+			n++
+		}
+	}
+	return n
+}
+
+// Keywords with which recipients stop and resume messages, compared case-insensitively
+var (
+	optOutKeywords = []string{"STOP", "STOPALL", "UNSUBSCRIBE", "CANCEL", "END", "QUIT", "ARRESTA", "BASTA"}
+	optInKeywords  = []string{"START", "UNSTOP", "YES", "RIPRENDI"}
+)
+
+// IsOptOut reports whether an incoming message asks to stop receiving messages
+func IsOptOut(body string) bool {
+	return matchKeyword(body, optOutKeywords)
+}
+
+// IsOptIn reports whether an incoming message asks to receive messages again
+func IsOptIn(body string) bool {
+	return matchKeyword(body, optInKeywords)
+}
+
+func matchKeyword(body string, keywords []string) bool {
+	word := strings.ToUpper(strings.Trim(strings.TrimSpace(body), ".!"))
+	for _, k := range keywords {
+		if word == k {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package sms
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSenderFor(t *testing.T) {
+	cfg := Config{From: "QRMenu", Senders: map[string]string{"1": "+15551234567", "44": "+447700900000", "1876": "+18765550000"}}
+	for number, want := range map[string]string{
+		"393331234567": "QRMenu",
+		"15557654321":  "+15551234567",
+		"18765551234":  "+18765550000",
+		"447911123456": "+447700900000",
+	} {
+		if got := cfg.SenderFor(number); got != want {
+			t.Errorf("SenderFor(%s) = %q, want %q", number, got, want)
+		}
+	}
+}
+
+func TestSegmentsAndFit(t *testing.T) {
+	if got := Segments(strings.Repeat("a", 160)); got != 1 {
+		t.Errorf("160 GSM characters = %d segments", got)
+	}
+	if got := Segments(strings.Repeat("a", 161)); got != 2 {
+		t.Errorf("161 GSM characters = %d segments", got)
+	}
+	if got := Segments(strings.Repeat("€", 80)); got != 1 {
+		t.Errorf("80 euro signs = %d segments, they count twice in GSM", got)
+	}
+	if IsGSM("Ordine pronto 🍕") || Segments(strings.Repeat("✓", 71)) != 2 {
+		t.Error("UCS-2 messages take 70 characters per segment")
+	}
+
+	if got := Fit("  Ordine \n pronto  "); got != "Ordine pronto" {
+		t.Errorf("Fit = %q", got)
+	}
+	long := Fit(strings.Repeat("parola ", 200))
+	if Segments(long) != MaxSegments || !strings.HasSuffix(long, "...") {
+		t.Errorf("Fit of a long message: %d segments, %q", Segments(long), long[len(long)-10:])
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	for _, body := range []string{"STOP", " stop ", "Stop.", "arresta"} {
+		if !IsOptOut(body) {
+			t.Errorf("%q should opt out", body)
+		}
+	}
+	if IsOptOut("non fermatevi") || IsOptOut("stop please") || !IsOptIn("start") || IsOptIn("stop") {
+		t.Error("keywords must match the whole message")
+	}
+}
+
+func TestTwilioSend(t *testing.T) {
+	var form url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); r.URL.Path != "/2010-04-01/Accounts/AC1/Messages.json" || user != "AC1" || pass != "token" {
+			t.Errorf("unexpected request %s as %s", r.URL.Path, user)
+		}
+		r.ParseForm()
+		form = r.PostForm
+		if form.Get("To") == "+393330000000" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"code": 21610, "message": "Attempt to send to unsubscribed recipient"}`)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"sid": "SM123", "status": "queued"}`)
+	}))
+	defer srv.Close()
+
+	p, err := New(Config{Provider: ProviderTwilio, AccountSID: "AC1", AuthToken: "token", From: "+15550001111", APIBase: srv.URL, StatusURL: "https://menu.example.com/api/v1/public/sms/status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := p.Send(context.Background(), Message{To: "393331234567", Body: "Ordine pronto"})
+	if err != nil || id != "SM123" {
+		t.Fatalf("Send = %q, %v", id, err)
+	}
+	if form.Get("To") != "+393331234567" || form.Get("From") != "+15550001111" || form.Get("StatusCallback") == "" {
+		t.Errorf("unexpected form %v", form)
+	}
+
+	_, err = p.Send(context.Background(), Message{To: "393330000000", Body: "Ordine pronto"})
+	if !errors.Is(err, ErrOptedOut) || !errors.Is(err, ErrPermanent) {
+		t.Errorf("unsubscribed recipient: %v", err)
+	}
+	if _, err := p.Send(context.Background(), Message{To: "+39333", Body: "x"}); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("invalid recipient: %v", err)
+	}
+}
+
+func TestTwilioCallbacks(t *testing.T) {
+	cfg := Config{Provider: ProviderTwilio, AccountSID: "AC1", AuthToken: "token", From: "+15550001111",
+		StatusURL: "https://menu.example.com/api/v1/public/sms/status", InboundURL: "https://menu.example.com/api/v1/public/sms/inbound"}
+	p, _ := New(cfg)
+
+	callback := func(target string, params url.Values, signature []byte) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(params.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Twilio-Signature", base64.StdEncoding.EncodeToString(signature))
+		return r
+	}
+
+	status := url.Values{"MessageSid": {"SM123"}, "MessageStatus": {"undelivered"}, "ErrorCode": {"30003"}}
+	update, err := p.ParseStatus(callback(cfg.StatusURL, status, TwilioSignature("token", cfg.StatusURL, status)))
+	if err != nil || update.MessageID != "SM123" || update.Status != StatusUndelivered || update.ErrorCode != "30003" {
+		t.Fatalf("ParseStatus = %+v, %v", update, err)
+	}
+	if _, err := p.ParseStatus(callback(cfg.StatusURL, status, TwilioSignature("other", cfg.StatusURL, status))); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("wrong signature: %v", err)
+	}
+	if _, err := p.ParseStatus(callback(cfg.StatusURL, status, TwilioSignature("token", cfg.InboundURL, status))); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("signature for another URL: %v", err)
+	}
+
+	inbound := url.Values{"From": {"+393331234567"}, "Body": {"STOP"}}
+	in, err := p.ParseInbound(callback(cfg.InboundURL, inbound, TwilioSignature("token", cfg.InboundURL, inbound)))
+	if err != nil || in.From != "393331234567" || !IsOptOut(in.Body) {
+		t.Fatalf("ParseInbound = %+v, %v", in, err)
+	}
+}
+
+func TestVonage(t *testing.T) {
+	var form url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		if form.Get("to") == "393330000000" {
+			io.WriteString(w, `{"message-count": "1", "messages": [{"status": "7", "error-text": "Number barred"}]}`)
+			return
+		}
+		io.WriteString(w, `{"message-count": "2", "messages": [{"status": "0", "message-id": "MSG1"}, {"status": "0", "message-id": "MSG2"}]}`)
+	}))
+	defer srv.Close()
+
+	cfg := Config{Provider: ProviderVonage, APIKey: "key", APISecret: "secret", WebhookToken: "hook", From: "QRMenu",
+		APIBase: srv.URL, StatusURL: "https://menu.example.com/api/v1/public/sms/status"}
+	if _, err := New(Config{Provider: ProviderVonage, APIKey: "key", APISecret: "secret", From: "QRMenu"}); err == nil {
+		t.Error("Vonage without webhook token should be rejected")
+	}
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := p.Send(context.Background(), Message{To: "393331234567", Body: "Il tuo ordine è pronto ✓"})
+	if err != nil || id != "MSG1" {
+		t.Fatalf("Send = %q, %v", id, err)
+	}
+	if form.Get("type") != "unicode" || form.Get("callback") != cfg.StatusURL+"?token=hook" || form.Get("api_key") != "key" {
+		t.Errorf("unexpected form %v", form)
+	}
+	if _, err := p.Send(context.Background(), Message{To: "393330000000", Body: "x"}); !errors.Is(err, ErrOptedOut) {
+		t.Errorf("barred number: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/public/sms/status?token=hook&messageId=MSG1&status=delivered&err-code=0", nil)
+	update, err := p.ParseStatus(r)
+	if err != nil || update.MessageID != "MSG1" || update.Status != StatusDelivered || update.ErrorCode != "" {
+		t.Fatalf("ParseStatus = %+v, %v", update, err)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/api/v1/public/sms/inbound?token=hook", strings.NewReader(`{"msisdn": "393331234567", "text": "Stop"}`))
+	r.Header.Set("Content-Type", "application/json")
+	in, err := p.ParseInbound(r)
+	if err != nil || in.From != "393331234567" || in.Body != "Stop" {
+		t.Fatalf("ParseInbound = %+v, %v", in, err)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/public/sms/status?token=wrong&messageId=MSG1&status=delivered", nil)
+	if _, err := p.ParseStatus(r); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("wrong token: %v", err)
+	}
+}
@@ -0,0 +1,160 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// TwilioAPIBase is the default Twilio REST API endpoint
+const TwilioAPIBase = "https://api.twilio.com"
+
+// twilioOptedOut is the Twilio error code for recipients that replied STOP
+const twilioOptedOut = 21610
+
+// Twilio delivers messages through the Twilio Programmable Messaging API
+type Twilio struct {
+	cfg    Config
+	client *http.Client
+}
+
+// Name returns "twilio"
+func (*Twilio) Name() string { return ProviderTwilio }
+
+// Send delivers the message with POST /2010-04-01/Accounts/{sid}/Messages.json
+func (t *Twilio) Send(ctx context.Context, msg Message) (string, error) {
+	if err := msg.validate(); err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"To":   {"+" + msg.To},
+		"From": {t.cfg.SenderFor(msg.To)},
+		"Body": {msg.Body},
+	}
+	if t.cfg.StatusURL != "" {
+		form.Set("StatusCallback", t.cfg.StatusURL)
+	}
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", t.cfg.APIBase, url.PathEscape(t.cfg.AccountSID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(t.cfg.AccountSID, t.cfg.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("sms: twilio: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		SID     string `json:"sid"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	json.Unmarshal(body, &result)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 && result.SID != "" {
+		return result.SID, nil
+	}
+
+	err = fmt.Errorf("sms: twilio: HTTP %d: %d %s", resp.StatusCode, result.Code, result.Message)
+	switch {
+	case result.Code == twilioOptedOut:
+		return "", fmt.Errorf("%w: %w", ErrOptedOut, err)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return "", fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	return "", err
+}
+
+// ParseStatus verifies the X-Twilio-Signature of a status callback sent to StatusURL and
+// reads MessageSid, MessageStatus and ErrorCode
+func (t *Twilio) ParseStatus(r *http.Request) (*StatusUpdate, error) {
+	if err := t.verify(r, t.cfg.StatusURL); err != nil {
+		return nil, err
+	}
+	update := &StatusUpdate{
+		MessageID: r.PostForm.Get("MessageSid"),
+		ErrorCode: r.PostForm.Get("ErrorCode"),
+	}
+	switch r.PostForm.Get("MessageStatus") {
+	case "sent":
+		update.Status = StatusSent
+	case "delivered":
+		update.Status = StatusDelivered
+	case "undelivered":
+		update.Status = StatusUndelivered
+	case "failed":
+		update.Status = StatusFailed
+	}
+	if update.MessageID == "" {
+		return nil, fmt.Errorf("sms: twilio: status callback without MessageSid")
+	}
+	return update, nil
+}
+
+// ParseInbound verifies the X-Twilio-Signature of an incoming message sent to InboundURL
+func (t *Twilio) ParseInbound(r *http.Request) (*Inbound, error) {
+	if err := t.verify(r, t.cfg.InboundURL); err != nil {
+		return nil, err
+	}
+	from := strings.TrimPrefix(r.PostForm.Get("From"), "+")
+	if from == "" {
+		return nil, fmt.Errorf("sms: twilio: incoming message without sender")
+	}
+	return &Inbound{From: from, Body: r.PostForm.Get("Body")}, nil
+}
+
+// verify checks the signature of a callback: the base64 HMAC-SHA1, keyed with the auth
+// token, of the callback URL followed by the POST parameters sorted by name
+func (t *Twilio) verify(r *http.Request, callbackURL string) error {
+	if callbackURL == "" {
+		return ErrUnauthenticated
+	}
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("sms: twilio: %w", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Twilio-Signature"))
+	if err != nil || len(signature) == 0 {
+		return ErrUnauthenticated
+	}
+	if subtle.ConstantTimeCompare(signature, TwilioSignature(t.cfg.AuthToken, callbackURL, r.PostForm)) != 1 {
+		return ErrUnauthenticated
+	}
+	return nil
+}
+
+// TwilioSignature computes the signature Twilio sends with a callback to callbackURL
+func TwilioSignature(authToken, callbackURL string, params url.Values) []byte {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(callbackURL)
+	for _, k := range keys {
+		values := append([]string(nil), params[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			b.WriteString(k)
+			b.WriteString(v)
+		}
+	}
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(b.String()))
+	return mac.Sum(nil)
+}
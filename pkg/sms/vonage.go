@@ -0,0 +1,174 @@
+package sms
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// VonageAPIBase is the default Vonage SMS API endpoint
+const VonageAPIBase = "https://rest.nexmo.com"
+
+// Vonage delivers messages through the Vonage SMS API
+type Vonage struct {
+	cfg    Config
+	client *http.Client
+}
+
+// Name returns "vonage"
+func (*Vonage) Name() string { return ProviderVonage }
+
+// Send delivers the message with POST /sms/json. Vonage answers 200 also for rejected
+// messages, with the outcome in the status of each part
+func (v *Vonage) Send(ctx context.Context, msg Message) (string, error) {
+	if err := msg.validate(); err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"api_key":    {v.cfg.APIKey},
+		"api_secret": {v.cfg.APISecret},
+		"from":       {strings.TrimPrefix(v.cfg.SenderFor(msg.To), "+")},
+		"to":         {msg.To},
+		"text":       {msg.Body},
+	}
+	if !IsGSM(msg.Body) {
+		form.Set("type", "unicode")
+	}
+	if v.cfg.StatusURL != "" {
+		form.Set("callback", v.callbackURL(v.cfg.StatusURL))
+		form.Set("status-report-req", "1")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.cfg.APIBase+"/sms/json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("sms: vonage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err := fmt.Errorf("sms: vonage: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return "", fmt.Errorf("%w: %w", ErrPermanent, err)
+		}
+		return "", err
+	}
+
+	var result struct {
+		Messages []struct {
+			Status    string `json:"status"`
+			MessageID string `json:"message-id"`
+			ErrorText string `json:"error-text"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || len(result.Messages) == 0 {
+		return "", fmt.Errorf("sms: vonage: unexpected response %q", strings.TrimSpace(string(body)))
+	}
+	// Messages longer than a segment are sent in parts: the first ID identifies the message
+	for _, part := range result.Messages {
+		if part.Status == "0" {
+			continue
+		}
+		err := fmt.Errorf("sms: vonage: status %s: %s", part.Status, part.ErrorText)
+		switch part.Status {
+		case "1", "5": // Throttled or internal error
+			return "", err
+		case "7": // Number barred, e.g. after STOP
+			return "", fmt.Errorf("%w: %w", ErrOptedOut, err)
+		}
+		return "", fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	return result.Messages[0].MessageID, nil
+}
+
+// ParseStatus reads a delivery receipt, sent either as query parameters or as JSON.
+// Vonage does not sign receipts of the SMS API: the callback URL carries WebhookToken
+func (v *Vonage) ParseStatus(r *http.Request) (*StatusUpdate, error) {
+	params, err := v.params(r)
+	if err != nil {
+		return nil, err
+	}
+	update := &StatusUpdate{
+		MessageID: params["messageId"],
+		ErrorCode: params["err-code"],
+	}
+	switch params["status"] {
+	case "accepted", "buffered":
+		update.Status = StatusSent
+	case "delivered":
+		update.Status = StatusDelivered
+	case "expired":
+		update.Status = StatusUndelivered
+	case "failed", "rejected":
+		update.Status = StatusFailed
+	}
+	if update.ErrorCode == "0" {
+		update.ErrorCode = ""
+	}
+	if update.MessageID == "" {
+		return nil, fmt.Errorf("sms: vonage: receipt without messageId")
+	}
+	return update, nil
+}
+
+// ParseInbound reads an incoming message. The inbound URL configured on Vonage must carry
+// WebhookToken as the "token" query parameter
+func (v *Vonage) ParseInbound(r *http.Request) (*Inbound, error) {
+	params, err := v.params(r)
+	if err != nil {
+		return nil, err
+	}
+	if params["msisdn"] == "" {
+		return nil, fmt.Errorf("sms: vonage: incoming message without sender")
+	}
+	return &Inbound{From: params["msisdn"], Body: params["text"]}, nil
+}
+
+// params checks the webhook token and returns the parameters of a callback
+func (v *Vonage) params(r *http.Request) (map[string]string, error) {
+	token := r.URL.Query().Get("token")
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(v.cfg.WebhookToken)) != 1 {
+		return nil, ErrUnauthenticated
+	}
+
+	params := make(map[string]string)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body map[string]interface{}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&body); err != nil {
+			return nil, fmt.Errorf("sms: vonage: %w", err)
+		}
+		for k, value := range body {
+			params[k] = fmt.Sprint(value)
+		}
+		return params, nil
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("sms: vonage: %w", err)
+	}
+	for k := range r.Form {
+		if k != "token" {
+			params[k] = r.Form.Get(k)
+		}
+	}
+	return params, nil
+}
+
+// callbackURL adds the webhook token to a callback URL
+func (v *Vonage) callbackURL(raw string) string {
+	sep := "?"
+	if strings.Contains(raw, "?") {
+		sep = "&"
+	}
+	return raw + sep + "token=" + url.QueryEscape(v.cfg.WebhookToken)
+}
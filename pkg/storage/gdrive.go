@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// Default endpoints of the Google Drive API
+const (
+	DriveAPIBase = "https://www.googleapis.com"
+	driveScope   = "https://www.googleapis.com/auth/drive"
+)
+
+// DriveStore stores blobs as files of a Google Drive folder, accessed with a service account.
+// The folder must be shared with the service account's email, or belong to a shared drive the
+// account is a member of. The key is the file name
+type DriveStore struct {
+	folderID string
+	apiBase  string
+	client   *http.Client // Authorized with the service account's access tokens
+}
+
+// driveFile is the subset of the Drive file resource used by the store
+type driveFile struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Size         int64     `json:"size,string"`
+	ModifiedTime time.Time `json:"modifiedTime"`
+}
+
+// NewDriveStore creates a blob store on the Drive folder cfg.DriveFolderID, reading the
+// service account key from cfg.DriveCredentialsFile
+func NewDriveStore(cfg Config) (*DriveStore, error) {
+	if cfg.DriveCredentialsFile == "" || cfg.DriveFolderID == "" {
+		return nil, fmt.Errorf("Google Drive credentials file and folder ID are required for the gdrive blob backend")
+	}
+	data, err := os.ReadFile(cfg.DriveCredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Google service account: %w", err)
+	}
+	auth, err := google.JWTConfigFromJSON(data, driveScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Google service account: %w", err)
+	}
+	apiBase := strings.TrimRight(cfg.DriveAPIBase, "/")
+	if apiBase == "" {
+		apiBase = DriveAPIBase
+	}
+	// No client timeout: archives can take minutes to transfer, the callers' contexts bound them.
+	// Access tokens are reused until shortly before they expire
+	client := oauth2.NewClient(context.Background(), auth.TokenSource(context.Background()))
+	return &DriveStore{folderID: cfg.DriveFolderID, apiBase: apiBase, client: client}, nil
+}
+
+// Put uploads the blob with a resumable upload session, replacing the content of an existing
+// file with the same name. The size must be known
+func (s *DriveStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		return fmt.Errorf("failed to upload %s: size required by Google Drive", name)
+	}
+	existing, err := s.find(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// The session is started with the metadata; its URL then receives the content
+	method, endpoint := http.MethodPost, s.apiBase+"/upload/drive/v3/files"
+	metadata := map[string]interface{}{"name": name, "mimeType": contentType}
+	if existing != nil {
+		method, endpoint = http.MethodPatch, endpoint+"/"+url.PathEscape(existing.ID)
+		delete(metadata, "name")
+	} else {
+		metadata["parents"] = []string{s.folderID}
+	}
+	body, _ := json.Marshal(metadata)
+	req, err := http.NewRequestWithContext(ctx, method, endpoint+"?uploadType=resumable&supportsAllDrives=true", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Type", contentType)
+	req.Header.Set("X-Upload-Content-Length", fmt.Sprint(size))
+	resp, err := s.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to start upload of %s: %w", name, err)
+	}
+	resp.Body.Close()
+	session := resp.Header.Get("Location")
+	if session == "" {
+		return fmt.Errorf("failed to start upload of %s: no session URL", name)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPut, session, io.NopCloser(r))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	resp, err = s.do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get downloads a blob
+func (s *DriveStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := s.find(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, ErrNotFound
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		s.apiBase+"/drive/v3/files/"+url.PathEscape(file.ID)+"?alt=media&supportsAllDrives=true", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	return resp.Body, nil
+}
+
+// Delete removes a blob
+func (s *DriveStore) Delete(ctx context.Context, key string) error {
+	name, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+	file, err := s.find(ctx, name)
+	if err != nil || file == nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete,
+		s.apiBase+"/drive/v3/files/"+url.PathEscape(file.ID)+"?supportsAllDrives=true", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if err != nil && err != ErrNotFound {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+// Exists checks if a blob exists
+func (s *DriveStore) Exists(ctx context.Context, key string) (bool, error) {
+	name, err := cleanKey(key)
+	if err != nil {
+		return false, err
+	}
+	file, err := s.find(ctx, name)
+	return file != nil, err
+}
+
+// List returns all blobs whose key starts with prefix
+func (s *DriveStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	files, err := s.query(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	var blobs []BlobInfo
+	for _, f := range files {
+		if strings.HasPrefix(f.Name, prefix) {
+			blobs = append(blobs, BlobInfo{Key: f.Name, Size: f.Size, LastModified: f.ModifiedTime})
+		}
+	}
+	return blobs, nil
+}
+
+// URL returns an empty string: files of the folder are not public
+func (s *DriveStore) URL(key string) string {
+	return ""
+}
+
+// find returns the file of the folder with the given name, or nil
+func (s *DriveStore) find(ctx context.Context, name string) (*driveFile, error) {
+	escape := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	files, err := s.query(ctx, fmt.Sprintf(" and name = '%s'", escape.Replace(name)))
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	return &files[0], nil
+}
+
+// query lists the files of the folder matching the extra search terms, following the pages
+func (s *DriveStore) query(ctx context.Context, terms string) ([]driveFile, error) {
+	params := url.Values{
+		"q":                         {fmt.Sprintf("'%s' in parents and trashed = false%s", s.folderID, terms)},
+		"fields":                    {"nextPageToken,files(id,name,size,modifiedTime)"},
+		"pageSize":                  {"1000"},
+		"supportsAllDrives":         {"true"},
+		"includeItemsFromAllDrives": {"true"},
+	}
+	var files []driveFile
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.apiBase+"/drive/v3/files?"+params.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Drive folder: %w", err)
+		}
+		var page struct {
+			NextPageToken string      `json:"nextPageToken"`
+			Files         []driveFile `json:"files"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Drive folder: %w", err)
+		}
+		files = append(files, page.Files...)
+		if page.NextPageToken == "" {
+			return files, nil
+		}
+		params.Set("pageToken", page.NextPageToken)
+	}
+}
+
+// do sends an authorized request and turns error statuses into errors (ErrNotFound for 404)
+func (s *DriveStore) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDrive emulates the token endpoint and the files resource of the Drive API for one folder
+type fakeDrive struct {
+	mu       sync.Mutex
+	files    map[string]*driveFile // id -> file
+	content  map[string][]byte
+	sessions map[string]string // session -> file id
+	nextID   int
+	tokens   int
+}
+
+func newFakeDrive(t *testing.T) (*fakeDrive, *DriveStore) {
+	f := &fakeDrive{files: map[string]*driveFile{}, content: map[string][]byte{}, sessions: map[string]string{}}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	account, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "backups@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    srv.URL + "/token",
+	})
+	path := filepath.Join(t.TempDir(), "account.json")
+	os.WriteFile(path, account, 0600)
+
+	store, err := NewDriveStore(Config{DriveCredentialsFile: path, DriveFolderID: "folder1", DriveAPIBase: srv.URL})
+	if err != nil {
+		t.Fatalf("NewDriveStore failed: %v", err)
+	}
+	return f, store
+}
+
+func (f *fakeDrive) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || strings.Count(r.FormValue("assertion"), ".") != 2 {
+			http.Error(w, "bad assertion", http.StatusBadRequest)
+			return
+		}
+		f.tokens++
+		fmt.Fprint(w, `{"access_token":"token1","expires_in":3600}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer token1" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/drive/v3/files":
+		q := r.URL.Query().Get("q")
+		var files []*driveFile
+		for _, file := range f.files {
+			if !strings.Contains(q, "name = ") || strings.Contains(q, "name = '"+file.Name+"'") {
+				files = append(files, file)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"files": files})
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/drive/v3/files",
+		r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/upload/drive/v3/files/"):
+		var metadata struct {
+			Name    string   `json:"name"`
+			Parents []string `json:"parents"`
+		}
+		json.NewDecoder(r.Body).Decode(&metadata)
+		id := strings.TrimPrefix(r.URL.Path, "/upload/drive/v3/files/")
+		if r.Method == http.MethodPost {
+			if len(metadata.Parents) != 1 || metadata.Parents[0] != "folder1" {
+				http.Error(w, "missing parent", http.StatusBadRequest)
+				return
+			}
+			f.nextID++
+			id = fmt.Sprintf("file%d", f.nextID)
+			f.files[id] = &driveFile{ID: id, Name: metadata.Name}
+		}
+		f.sessions["s-"+id] = id
+		w.Header().Set("Location", "http://"+r.Host+"/session/s-"+id)
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/session/"):
+		id := f.sessions[strings.TrimPrefix(r.URL.Path, "/session/")]
+		data, _ := io.ReadAll(r.Body)
+		f.content[id] = data
+		f.files[id].Size = int64(len(data))
+		f.files[id].ModifiedTime = time.Now()
+		json.NewEncoder(w).Encode(f.files[id])
+	case r.Method == http.MethodGet && r.URL.Query().Get("alt") == "media":
+		data, ok := f.content[strings.TrimPrefix(r.URL.Path, "/drive/v3/files/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		id := strings.TrimPrefix(r.URL.Path, "/drive/v3/files/")
+		delete(f.files, id)
+		delete(f.content, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+// TestDriveStore tests upload, replacement, download, listing and deletion
+func TestDriveStore(t *testing.T) {
+	drive, store := newFakeDrive(t)
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "backup-1.zip", strings.NewReader("first"), 5, "application/zip"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := store.Put(ctx, "backup-1.zip", strings.NewReader("second"), 6, "application/zip"); err != nil {
+		t.Fatalf("Put of an existing file failed: %v", err)
+	}
+	if err := store.Put(ctx, "backup-2.zip", strings.NewReader("other"), 5, "application/zip"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if len(drive.files) != 2 {
+		t.Errorf("Drive holds %d files, want 2 (the update must not create a copy)", len(drive.files))
+	}
+	if drive.tokens != 1 {
+		t.Errorf("Requested %d access tokens, want 1 cached", drive.tokens)
+	}
+
+	rc, err := store.Get(ctx, "backup-1.zip")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "second" {
+		t.Errorf("Get = %q, want the replaced content", data)
+	}
+
+	blobs, err := store.List(ctx, "backup-")
+	if err != nil || len(blobs) != 2 {
+		t.Fatalf("List = %v, %v", blobs, err)
+	}
+	for _, b := range blobs {
+		if b.Size == 0 || b.LastModified.IsZero() {
+			t.Errorf("List entry %+v", b)
+		}
+	}
+
+	if err := store.Delete(ctx, "backup-1.zip"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if exists, err := store.Exists(ctx, "backup-1.zip"); err != nil || exists {
+		t.Errorf("Exists after Delete = %v, %v", exists, err)
+	}
+	if _, err := store.Get(ctx, "backup-1.zip"); err != ErrNotFound {
+		t.Errorf("Get of a deleted blob = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "backup-1.zip"); err != nil {
+		t.Errorf("Delete of a missing blob = %v", err)
+	}
+	if err := store.Put(ctx, "stream.zip", strings.NewReader("x"), -1, "application/zip"); err == nil {
+		t.Error("Put accepted an unknown size")
+	}
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestLocalStorePutGet tests storing and reading back a blob
+func TestLocalStorePutGet(t *testing.T) {
+	store := NewLocalStore(t.TempDir(), "/static")
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "qrcodes/r1.png", strings.NewReader("png-data"), 8, "image/png"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	rc, err := store.Get(ctx, "qrcodes/r1.png")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer rc.Close()
+
+	data, _ := io.ReadAll(rc)
+	if string(data) != "png-data" {
+		t.Errorf("Expected 'png-data', got '%s'", data)
+	}
+
+	if url := store.URL("qrcodes/r1.png"); url != "/static/qrcodes/r1.png" {
+		t.Errorf("Unexpected URL: %s", url)
+	}
+}
+
+// TestLocalStoreMissing tests missing blobs and deletes
+func TestLocalStoreMissing(t *testing.T) {
+	store := NewLocalStore(t.TempDir(), "/static")
+	ctx := context.Background()
+
+	if _, err := store.Get(ctx, "missing.png"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if err := store.Delete(ctx, "missing.png"); err != nil {
+		t.Errorf("Delete of missing blob should not fail: %v", err)
+	}
+}
+
+// TestLocalStoreList tests listing by prefix
+func TestLocalStoreList(t *testing.T) {
+	store := NewLocalStore(t.TempDir(), "/static")
+	ctx := context.Background()
+
+	store.Put(ctx, "images/a.jpg", strings.NewReader("a"), 1, "image/jpeg")
+	store.Put(ctx, "images/b.jpg", strings.NewReader("b"), 1, "image/jpeg")
+	store.Put(ctx, "qrcodes/c.png", strings.NewReader("c"), 1, "image/png")
+
+	blobs, err := store.List(ctx, "images/")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(blobs) != 2 {
+		t.Errorf("Expected 2 blobs, got %d", len(blobs))
+	}
+}
+
+// TestLocalStoreRejectsTraversal tests that keys cannot escape the root
+func TestLocalStoreRejectsTraversal(t *testing.T) {
+	store := NewLocalStore(t.TempDir(), "/static")
+
+	if err := store.Put(context.Background(), "../escape.txt", strings.NewReader("x"), 1, "text/plain"); err == nil {
+		t.Error("Expected error for path traversal key")
+	}
+}
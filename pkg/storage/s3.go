@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Store stores blobs in an S3-compatible bucket (AWS S3, MinIO, R2, ...)
+type S3Store struct {
+	client    *minio.Client
+	bucket    string
+	prefix    string
+	publicURL string
+}
+
+// NewS3Store creates a new S3/MinIO blob store and ensures the bucket exists
+func NewS3Store(cfg Config) (*S3Store, error) {
+	if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+		return nil, fmt.Errorf("S3_ENDPOINT and S3_BUCKET are required for the s3 blob backend")
+	}
+
+	client, err := minio.New(cfg.S3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3AccessKey, cfg.S3SecretKey, ""),
+		Secure: cfg.S3UseSSL,
+		Region: cfg.S3Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	publicURL := strings.TrimSuffix(cfg.S3PublicURL, "/")
+	if publicURL == "" {
+		scheme := "http"
+		if cfg.S3UseSSL {
+			scheme = "https"
+		}
+		publicURL = fmt.Sprintf("%s://%s/%s", scheme, cfg.S3Endpoint, cfg.S3Bucket)
+	}
+
+	store := &S3Store{
+		client:    client,
+		bucket:    cfg.S3Bucket,
+		prefix:    cfg.S3Prefix,
+		publicURL: publicURL,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := store.ensureBucket(ctx, cfg.S3Region); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// ensureBucket creates the bucket if it does not exist (useful for MinIO)
+func (s *S3Store) ensureBucket(ctx context.Context, region string) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("failed to check bucket %s: %w", s.bucket, err)
+	}
+	if exists {
+		return nil
+	}
+
+	if err := s.client.MakeBucket(ctx, s.bucket, minio.MakeBucketOptions{Region: region}); err != nil {
+		return fmt.Errorf("failed to create bucket %s: %w", s.bucket, err)
+	}
+	return nil
+}
+
+// objectName maps a key to the object name inside the bucket
+func (s *S3Store) objectName(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return s.prefix + key, nil
+}
+
+// Put uploads a blob
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := s.objectName(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(ctx, s.bucket, name, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+	return nil
+}
+
+// Get downloads a blob
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.objectName(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// GetObject is lazy: stat first so a missing object maps to ErrNotFound
+	if _, err := s.client.StatObject(ctx, s.bucket, name, minio.StatObjectOptions{}); err != nil {
+		if isNoSuchKey(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to stat %s: %w", name, err)
+	}
+
+	obj, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	return obj, nil
+}
+
+// Delete removes a blob
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	name, err := s.objectName(key)
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{}); err != nil && !isNoSuchKey(err) {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
+
+// Exists checks if a blob exists
+func (s *S3Store) Exists(ctx context.Context, key string) (bool, error) {
+	name, err := s.objectName(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = s.client.StatObject(ctx, s.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		if isNoSuchKey(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// List returns all blobs whose key starts with prefix
+func (s *S3Store) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	var blobs []BlobInfo
+
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix + prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", obj.Err)
+		}
+		blobs = append(blobs, BlobInfo{
+			Key:          strings.TrimPrefix(obj.Key, s.prefix),
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+		})
+	}
+
+	return blobs, nil
+}
+
+// URL returns the public URL of a blob
+func (s *S3Store) URL(key string) string {
+	return s.publicURL + "/" + s.prefix + strings.TrimPrefix(key, "/")
+}
+
+func isNoSuchKey(err error) bool {
+	return minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTPStore stores blobs in a directory of an SFTP server. Every operation opens its own SSH
+// connection: the store is meant for backup archives, written and read a few times a day
+type SFTPStore struct {
+	addr   string
+	dir    string
+	config *ssh.ClientConfig
+
+	// dial opens the SFTP session; replaced in tests
+	dial func(ctx context.Context) (*sftpSession, error)
+}
+
+// sftpSession is an SFTP client that also closes the connection it runs on
+type sftpSession struct {
+	*sftp.Client
+	close func() error
+}
+
+// Close ends the SFTP session and closes the connection
+func (s *sftpSession) Close() error {
+	err := s.Client.Close()
+	if s.close != nil {
+		if cerr := s.close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// NewSFTPStore creates a blob store on an SFTP server. The server is authenticated with
+// cfg.SFTPHostKey, the user with the private key file and/or the password
+func NewSFTPStore(cfg Config) (*SFTPStore, error) {
+	if cfg.SFTPAddress == "" || cfg.SFTPUser == "" {
+		return nil, fmt.Errorf("SFTP address and user are required for the sftp blob backend")
+	}
+	if cfg.SFTPHostKey == "" {
+		return nil, fmt.Errorf("SFTP host key is required to verify the server %s", cfg.SFTPAddress)
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.SFTPHostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SFTP host key: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.SFTPKeyFile != "" {
+		data, err := os.ReadFile(cfg.SFTPKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SFTP private key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SFTP private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.SFTPPassword != "" {
+		auth = append(auth, ssh.Password(cfg.SFTPPassword))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("SFTP private key or password is required")
+	}
+
+	addr := cfg.SFTPAddress
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	dir := strings.TrimSuffix(cfg.SFTPDir, "/")
+	if dir == "" {
+		dir = "."
+	}
+	return &SFTPStore{
+		addr: addr,
+		dir:  dir,
+		config: &ssh.ClientConfig{
+			User:            cfg.SFTPUser,
+			Auth:            auth,
+			HostKeyCallback: ssh.FixedHostKey(hostKey),
+			Timeout:         15 * time.Second,
+		},
+	}, nil
+}
+
+// connect opens an SSH connection and starts the sftp subsystem. The connection is closed
+// when ctx is done or the session is closed
+func (s *SFTPStore) connect(ctx context.Context) (*sftpSession, error) {
+	if s.dial != nil {
+		return s.dial(ctx)
+	}
+
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", s.addr, err)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, s.addr, s.config)
+	if err != nil {
+		stop()
+		conn.Close()
+		return nil, fmt.Errorf("SSH handshake with %s failed: %w", s.addr, err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	c, err := sftp.NewClient(client)
+	if err != nil {
+		stop()
+		client.Close()
+		return nil, fmt.Errorf("SFTP subsystem unavailable on %s: %w", s.addr, err)
+	}
+	return &sftpSession{Client: c, close: func() error {
+		stop()
+		return client.Close()
+	}}, nil
+}
+
+// path maps a key to the file path on the server
+func (s *SFTPStore) path(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(s.dir, key), nil
+}
+
+// Put uploads the blob to a .part file and renames it into place, so an interrupted upload
+// never replaces a complete one
+func (s *SFTPStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	c, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.MkdirAll(path.Dir(name)); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", name, err)
+	}
+	part := name + ".part"
+	f, err := c.Create(part)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", part, err)
+	}
+	_, err = f.ReadFrom(r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		c.Remove(part)
+		return fmt.Errorf("failed to upload %s: %w", name, err)
+	}
+
+	// SFTP v3 servers refuse to rename over an existing file
+	if err := c.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to replace %s: %w", name, err)
+	}
+	if err := c.Rename(part, name); err != nil {
+		return fmt.Errorf("failed to rename %s: %w", part, err)
+	}
+	return nil
+}
+
+// Get opens the blob; the connection stays open until the reader is closed
+func (s *SFTPStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := c.Open(name)
+	if err != nil {
+		c.Close()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	return &sftpFile{File: f, session: c}, nil
+}
+
+// Delete removes a blob
+func (s *SFTPStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	c, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
+
+// Exists checks if a blob exists
+func (s *SFTPStore) Exists(ctx context.Context, key string) (bool, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+	c, err := s.connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	if _, err := c.Stat(name); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// List returns all blobs whose key starts with prefix, skipping unfinished uploads
+func (s *SFTPStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	c, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var blobs []BlobInfo
+	var walk func(dir, rel string) error
+	walk = func(dir, rel string) error {
+		entries, err := c.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if strings.HasSuffix(e.Name(), ".part") {
+				continue
+			}
+			key := rel + e.Name()
+			if e.IsDir() {
+				if strings.HasPrefix(key+"/", prefix) || strings.HasPrefix(prefix, key+"/") {
+					if err := walk(path.Join(dir, e.Name()), key+"/"); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if strings.HasPrefix(key, prefix) {
+				blobs = append(blobs, BlobInfo{Key: key, Size: e.Size(), LastModified: e.ModTime()})
+			}
+		}
+		return nil
+	}
+	if err := walk(s.dir, ""); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to list %s: %w", s.dir, err)
+	}
+	return blobs, nil
+}
+
+// URL returns an empty string: blobs on an SFTP server have no public URL
+func (s *SFTPStore) URL(key string) string {
+	return ""
+}
+
+// sftpFile is an open blob that closes its session with the file
+type sftpFile struct {
+	*sftp.File
+	session *sftpSession
+}
+
+func (f *sftpFile) Close() error {
+	f.File.Close()
+	return f.session.Close()
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// memSFTPStore returns an SFTPStore whose sessions are served by one in-memory SFTP server
+func memSFTPStore(dir string) *SFTPStore {
+	handlers := sftp.InMemHandler()
+	return &SFTPStore{dir: dir, dial: func(context.Context) (*sftpSession, error) {
+		client, server := net.Pipe()
+		go sftp.NewRequestServer(server, handlers).Serve()
+		c, err := sftp.NewClientPipe(client, client)
+		if err != nil {
+			return nil, err
+		}
+		return &sftpSession{Client: c, close: client.Close}, nil
+	}}
+}
+
+// TestSFTPStore tests upload, download, listing and deletion against an in-memory server
+func TestSFTPStore(t *testing.T) {
+	store := memSFTPStore("/backups")
+	ctx := context.Background()
+
+	// Spans many packets, so the upload is split into concurrent writes
+	archive := bytes.Repeat([]byte("0123456789abcdef"), 40000)
+	if err := store.Put(ctx, "backup-1.zip", bytes.NewReader(archive), int64(len(archive)), "application/zip"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	// Overwrites replace the file despite the v3 rename semantics
+	if err := store.Put(ctx, "backup-1.zip", bytes.NewReader(archive), int64(len(archive)), "application/zip"); err != nil {
+		t.Fatalf("Put over an existing file failed: %v", err)
+	}
+	if err := store.Put(ctx, "2024/backup-2.zip", strings.NewReader("zip"), 3, "application/zip"); err != nil {
+		t.Fatalf("Put in a new directory failed: %v", err)
+	}
+	if exists, _ := store.Exists(ctx, "backup-1.zip.part"); exists {
+		t.Error("Temporary .part file left on the server")
+	}
+
+	rc, err := store.Get(ctx, "backup-1.zip")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(data, archive) {
+		t.Errorf("Get returned %d bytes (err %v), want %d", len(data), err, len(archive))
+	}
+
+	blobs, err := store.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var keys []string
+	for _, b := range blobs {
+		keys = append(keys, b.Key)
+		if b.Key == "backup-1.zip" && (b.Size != int64(len(archive)) || b.LastModified.IsZero()) {
+			t.Errorf("List entry %+v", b)
+		}
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "2024/backup-2.zip,backup-1.zip" {
+		t.Errorf("List keys = %v", keys)
+	}
+	if blobs, _ := store.List(ctx, "2024/"); len(blobs) != 1 {
+		t.Errorf("List with prefix returned %d blobs, want 1", len(blobs))
+	}
+
+	if err := store.Delete(ctx, "backup-1.zip"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if exists, err := store.Exists(ctx, "backup-1.zip"); err != nil || exists {
+		t.Errorf("Exists after Delete = %v, %v", exists, err)
+	}
+	if _, err := store.Get(ctx, "backup-1.zip"); err != ErrNotFound {
+		t.Errorf("Get of a deleted blob = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "backup-1.zip"); err != nil {
+		t.Errorf("Delete of a missing blob = %v", err)
+	}
+	if blobs, err := memSFTPStore("/missing").List(ctx, ""); err != nil || len(blobs) != 0 {
+		t.Errorf("List of a missing directory = %v, %v", blobs, err)
+	}
+}
+
+func TestNewSFTPStore(t *testing.T) {
+	hostKey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOMqqnkVzrm0SdG6UOoqKLsabgH5C9okWi0dh2l9GKJl"
+	store, err := NewSFTPStore(Config{SFTPAddress: "backup.example.com", SFTPUser: "qrmenu",
+		SFTPPassword: "secret", SFTPHostKey: hostKey, SFTPDir: "/srv/backups/"})
+	if err != nil {
+		t.Fatalf("NewSFTPStore failed: %v", err)
+	}
+	if store.addr != "backup.example.com:22" || store.dir != "/srv/backups" {
+		t.Errorf("addr = %q, dir = %q", store.addr, store.dir)
+	}
+
+	for name, cfg := range map[string]Config{
+		"no host key":  {SFTPAddress: "h", SFTPUser: "u", SFTPPassword: "p"},
+		"bad host key": {SFTPAddress: "h", SFTPUser: "u", SFTPPassword: "p", SFTPHostKey: "nope"},
+		"no auth":      {SFTPAddress: "h", SFTPUser: "u", SFTPHostKey: hostKey},
+		"no user":      {SFTPAddress: "h", SFTPPassword: "p", SFTPHostKey: hostKey},
+	} {
+		if _, err := NewSFTPStore(cfg); err == nil {
+			t.Errorf("%s: NewSFTPStore accepted the configuration", name)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore defines the interface for binary object storage (images, QR codes, backups)
+type BlobStore interface {
+	// Put stores the content read from r under key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Get opens the blob stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Delete removes a blob; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+
+	// Exists checks if a blob exists
+	Exists(ctx context.Context, key string) (bool, error)
+
+	// List returns all blobs whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+
+	// URL returns the public URL of a blob
+	URL(key string) string
+}
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// Backend types
+const (
+	BackendLocal  = "local"
+	BackendS3     = "s3"
+	BackendSFTP   = "sftp"
+	BackendGDrive = "gdrive"
+)
+
+// Config holds blob store configuration
+type Config struct {
+	Backend string // local, s3, sftp, gdrive
+
+	// Local backend
+	LocalDir string
+	LocalURL string
+
+	// S3/MinIO backend
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3UseSSL    bool
+	S3Prefix    string
+	S3PublicURL string // Optional CDN or public bucket URL
+
+	// SFTP backend
+	SFTPAddress  string // host or host:port
+	SFTPUser     string
+	SFTPPassword string
+	SFTPKeyFile  string // Private key file, alternative or in addition to the password
+	SFTPHostKey  string // Server public key in authorized_keys format (e.g. "ssh-ed25519 AAAA...")
+	SFTPDir      string
+
+	// Google Drive backend
+	DriveCredentialsFile string // Service account key file
+	DriveFolderID        string
+	DriveAPIBase         string // Empty uses DriveAPIBase
+}
+
+// ConfigFromEnv loads the blob store configuration for a namespace
+// (e.g. "static" for public assets, "backups" for backup archives).
+// Each namespace maps to its own local directory or S3 key prefix.
+func ConfigFromEnv(namespace string) Config {
+	return Config{
+		Backend:     getEnv("BLOB_BACKEND", BackendLocal),
+		LocalDir:    getEnv("BLOB_LOCAL_ROOT", ".") + "/" + namespace,
+		LocalURL:    "/" + namespace,
+		S3Endpoint:  getEnv("S3_ENDPOINT", ""),
+		S3Region:    getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:    getEnv("S3_BUCKET", ""),
+		S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+		S3UseSSL:    getEnvBool("S3_USE_SSL", true),
+		S3Prefix:    namespace + "/",
+		S3PublicURL: getEnv("S3_PUBLIC_URL", ""),
+	}
+}
+
+// New creates the blob store selected by cfg.Backend
+func New(cfg Config) (BlobStore, error) {
+	switch cfg.Backend {
+	case "", BackendLocal:
+		return NewLocalStore(cfg.LocalDir, cfg.LocalURL), nil
+	case BackendS3:
+		return NewS3Store(cfg)
+	case BackendSFTP:
+		return NewSFTPStore(cfg)
+	case BackendGDrive:
+		return NewDriveStore(cfg)
+	default:
+		return nil, fmt.Errorf("unknown blob backend: %s", cfg.Backend)
+	}
+}
+
+// cleanKey normalizes a key and rejects path traversal
+func cleanKey(key string) (string, error) {
+	key = strings.TrimPrefix(strings.ReplaceAll(key, "\\", "/"), "/")
+	if key == "" {
+		return "", fmt.Errorf("empty blob key")
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("invalid blob key: %s", key)
+		}
+	}
+	return key, nil
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := getEnv(key, "")
+	if value == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue
+	}
+	return b
+}
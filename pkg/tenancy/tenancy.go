@@ -0,0 +1,67 @@
+// Package tenancy carries the restaurant a request is scoped to through its context, so
+// data access can be checked against the tenant that was authenticated instead of
+// trusting IDs taken from the URL or the request body.
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+var (
+	// ErrNoScope is returned when the context carries no restaurant: the request did not go
+	// through an authentication middleware and must not read tenant data
+	ErrNoScope = errors.New("tenancy: no restaurant scope in context")
+
+	// ErrForeignTenant is returned when a resource belongs to a restaurant other than the
+	// one in scope
+	ErrForeignTenant = errors.New("tenancy: resource belongs to another restaurant")
+)
+
+// restaurantKey is the context key of the scoped restaurant ID
+type restaurantKey struct{}
+
+// WithRestaurant returns a copy of ctx scoped to restaurantID. An empty ID leaves ctx unchanged
+func WithRestaurant(ctx context.Context, restaurantID string) context.Context {
+	if restaurantID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, restaurantKey{}, restaurantID)
+}
+
+// RestaurantID returns the restaurant ctx is scoped to
+func RestaurantID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(restaurantKey{}).(string)
+	return id, ok && id != ""
+}
+
+// Check returns nil if a resource owned by ownerID can be accessed within ctx
+func Check(ctx context.Context, ownerID string) error {
+	id, ok := RestaurantID(ctx)
+	if !ok {
+		return ErrNoScope
+	}
+	if ownerID != id {
+		return ErrForeignTenant
+	}
+	return nil
+}
+
+// Middleware scopes each request to the restaurant returned by resolve. If resolve fails
+// the request is passed to deny and next is not called
+func Middleware(resolve func(*http.Request) (string, error), deny func(http.ResponseWriter, *http.Request, error)) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id, err := resolve(r)
+			if err == nil && id == "" {
+				err = ErrNoScope
+			}
+			if err != nil {
+				deny(w, r, err)
+				return
+			}
+			next(w, r.WithContext(WithRestaurant(r.Context(), id)))
+		}
+	}
+}
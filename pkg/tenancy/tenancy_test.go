@@ -0,0 +1,122 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type menu struct {
+	ID           string
+	RestaurantID string
+}
+
+func TestCheck(t *testing.T) {
+	ctx := WithRestaurant(context.Background(), "rest-a")
+
+	if err := Check(ctx, "rest-a"); err != nil {
+		t.Errorf("own resource: unexpected error %v", err)
+	}
+	if err := Check(ctx, "rest-b"); !errors.Is(err, ErrForeignTenant) {
+		t.Errorf("foreign resource: expected ErrForeignTenant, got %v", err)
+	}
+	if err := Check(ctx, ""); !errors.Is(err, ErrForeignTenant) {
+		t.Errorf("resource without owner: expected ErrForeignTenant, got %v", err)
+	}
+	if err := Check(context.Background(), "rest-a"); !errors.Is(err, ErrNoScope) {
+		t.Errorf("no scope: expected ErrNoScope, got %v", err)
+	}
+}
+
+func TestWithRestaurantEmptyID(t *testing.T) {
+	ctx := WithRestaurant(context.Background(), "")
+	if _, ok := RestaurantID(ctx); ok {
+		t.Error("empty restaurant ID should not create a scope")
+	}
+	if err := Check(ctx, ""); !errors.Is(err, ErrNoScope) {
+		t.Errorf("expected ErrNoScope, got %v", err)
+	}
+}
+
+func TestWithRestaurantOverridesScope(t *testing.T) {
+	ctx := WithRestaurant(WithRestaurant(context.Background(), "rest-a"), "rest-b")
+	if id, _ := RestaurantID(ctx); id != "rest-b" {
+		t.Errorf("RestaurantID = %q, want rest-b", id)
+	}
+	if err := Check(ctx, "rest-a"); !errors.Is(err, ErrForeignTenant) {
+		t.Errorf("previous scope should not grant access, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tenants := map[string]string{"token-a": "rest-a", "token-b": "rest-b"}
+	store := []menu{{ID: "1", RestaurantID: "rest-a"}, {ID: "2", RestaurantID: "rest-b"}}
+
+	resolve := func(r *http.Request) (string, error) {
+		id, ok := tenants[r.Header.Get("Authorization")]
+		if !ok {
+			return "", errors.New("unknown token")
+		}
+		return id, nil
+	}
+	deny := func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	}
+	// The handler trusts only the scope: the menu ID comes from the client
+	handler := Middleware(resolve, deny)(func(w http.ResponseWriter, r *http.Request) {
+		for _, m := range store {
+			if m.ID != r.URL.Query().Get("id") {
+				continue
+			}
+			if err := Check(r.Context(), m.RestaurantID); err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(m.ID))
+			return
+		}
+		http.NotFound(w, r)
+	})
+
+	tests := []struct {
+		token, id string
+		status    int
+	}{
+		{"token-a", "1", http.StatusOK},
+		{"token-a", "2", http.StatusNotFound},
+		{"token-b", "2", http.StatusOK},
+		{"token-b", "1", http.StatusNotFound},
+		{"", "1", http.StatusUnauthorized},
+		{"token-c", "1", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/menu?id="+tt.id, nil)
+		req.Header.Set("Authorization", tt.token)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("token %q, menu %s: status %d, want %d", tt.token, tt.id, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestMiddlewareRejectsEmptyScope(t *testing.T) {
+	called := false
+	handler := Middleware(
+		func(*http.Request) (string, error) { return "", nil },
+		func(w http.ResponseWriter, r *http.Request, err error) {
+			if !errors.Is(err, ErrNoScope) {
+				t.Errorf("expected ErrNoScope, got %v", err)
+			}
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+	)(func(http.ResponseWriter, *http.Request) { called = true })
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if called || rec.Code != http.StatusUnauthorized {
+		t.Errorf("handler called = %v, status %d", called, rec.Code)
+	}
+}
@@ -0,0 +1,290 @@
+package wallet
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+
+	"qr-menu/pkg/imaging"
+)
+
+// APNsURL is the production endpoint of the Apple Push Notification service
+const APNsURL = "https://api.push.apple.com"
+
+// AppleConfig holds the Pass Type ID certificate issued by the Apple developer account
+type AppleConfig struct {
+	PassTypeID string // e.g. pass.com.example.menu
+	TeamID     string
+	CertPEM    []byte // Pass Type ID certificate
+	KeyPEM     []byte // Private key of the certificate
+	WWDRPEM    []byte // Apple WWDR intermediate certificate
+	APNsURL    string // Overrides APNsURL
+	Timeout    time.Duration
+}
+
+// Apple signs .pkpass archives and asks the devices to refresh them
+type Apple struct {
+	passTypeID string
+	teamID     string
+	cert       *x509.Certificate
+	key        crypto.Signer
+	wwdr       *x509.Certificate
+	apnsURL    string
+	client     *http.Client
+}
+
+// NewApple loads the certificates of cfg. The pass certificate is also the client
+// certificate of the APNs connection
+func NewApple(cfg AppleConfig) (*Apple, error) {
+	if cfg.PassTypeID == "" || cfg.TeamID == "" {
+		return nil, errors.New("wallet: apple pass type ID and team ID are required")
+	}
+	pair, err := tls.X509KeyPair(cfg.CertPEM, cfg.KeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("wallet: apple certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("wallet: apple certificate: %w", err)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("wallet: apple certificate key cannot sign")
+	}
+	block, _ := pem.Decode(cfg.WWDRPEM)
+	if block == nil {
+		return nil, errors.New("wallet: apple WWDR certificate is not PEM encoded")
+	}
+	wwdr, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("wallet: apple WWDR certificate: %w", err)
+	}
+	if cfg.APNsURL == "" {
+		cfg.APNsURL = APNsURL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Apple{
+		passTypeID: cfg.PassTypeID,
+		teamID:     cfg.TeamID,
+		cert:       cert,
+		key:        key,
+		wwdr:       wwdr,
+		apnsURL:    strings.TrimRight(cfg.APNsURL, "/"),
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{Certificates: []tls.Certificate{pair}},
+				ForceAttemptHTTP2: true,
+			},
+		},
+	}, nil
+}
+
+// PassTypeID returns the pass type identifier of the passes
+func (a *Apple) PassTypeID() string {
+	return a.passTypeID
+}
+
+// field is a field of pass.json
+type field struct {
+	Key   string `json:"key"`
+	Label string `json:"label,omitempty"`
+	Value string `json:"value"`
+}
+
+func fields(list []Field) []field {
+	out := make([]field, 0, len(list))
+	for _, f := range list {
+		if f.Value != "" {
+			out = append(out, field{Key: f.Key, Label: f.Label, Value: f.Value})
+		}
+	}
+	return out
+}
+
+// passJSON returns pass.json for a generic pass
+func (a *Apple) passJSON(pass Pass) ([]byte, error) {
+	barcode := map[string]string{
+		"format":          "PKBarcodeFormatQR",
+		"message":         pass.MenuURL,
+		"messageEncoding": "iso-8859-1",
+	}
+	doc := map[string]interface{}{
+		"formatVersion":      1,
+		"passTypeIdentifier": a.passTypeID,
+		"teamIdentifier":     a.teamID,
+		"serialNumber":       pass.SerialNumber,
+		"organizationName":   pass.Name,
+		"description":        pass.Description,
+		"logoText":           pass.Name,
+		"backgroundColor":    rgb(pass.BackgroundColor),
+		"foregroundColor":    rgb(pass.ForegroundColor),
+		"labelColor":         rgb(pass.ForegroundColor),
+		"barcode":            barcode, // iOS 8 and earlier
+		"barcodes":           []map[string]string{barcode},
+		"generic": map[string]interface{}{
+			"primaryFields":   fields([]Field{{Key: "menu", Label: pass.MenuLabel, Value: pass.MenuName}}),
+			"secondaryFields": fields(pass.Fields),
+			"backFields":      fields(pass.BackFields),
+		},
+	}
+	if pass.WebServiceURL != "" {
+		if len(pass.AuthToken) < 16 {
+			return nil, errors.New("wallet: the web service token must be at least 16 characters")
+		}
+		doc["webServiceURL"] = pass.WebServiceURL
+		doc["authenticationToken"] = pass.AuthToken
+	}
+	return json.Marshal(doc)
+}
+
+// images returns the icon and logo files, at 1x and 2x
+func images(pass Pass) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for name, img := range map[string]image.Image{
+		"icon.png":    solidImage(29, parseColor(pass.BackgroundColor)),
+		"icon@2x.png": solidImage(58, parseColor(pass.BackgroundColor)),
+	} {
+		data, err := encodePNG(img)
+		if err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+	if pass.Logo == nil {
+		return files, nil
+	}
+	for name, scale := range map[string]int{"logo.png": 1, "logo@2x.png": 2} {
+		data, err := encodePNG(fitLogo(pass.Logo, 160*scale, 50*scale))
+		if err != nil {
+			return nil, err
+		}
+		files[name] = data
+	}
+	return files, nil
+}
+
+// fitLogo scales img down to fit in width x height, keeping the aspect ratio
+func fitLogo(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return img
+	}
+	side := height
+	switch {
+	case b.Dx()*height > b.Dy()*width:
+		side = width
+	case b.Dx() > b.Dy():
+		side = b.Dx() * height / b.Dy()
+	}
+	return imaging.Resize(img, side)
+}
+
+// Build returns the signed .pkpass archive of the pass
+func (a *Apple) Build(pass Pass) ([]byte, error) {
+	if pass.SerialNumber == "" || pass.MenuURL == "" {
+		return nil, errors.New("wallet: serial number and menu URL are required")
+	}
+	files, err := images(pass)
+	if err != nil {
+		return nil, err
+	}
+	if files["pass.json"], err = a.passJSON(pass); err != nil {
+		return nil, err
+	}
+
+	manifest := map[string]string{}
+	for name, data := range files {
+		sum := sha1.Sum(data)
+		manifest[name] = hex.EncodeToString(sum[:])
+	}
+	if files["manifest.json"], err = json.Marshal(manifest); err != nil {
+		return nil, err
+	}
+	if files["signature"], err = a.sign(files["manifest.json"]); err != nil {
+		return nil, fmt.Errorf("wallet: sign manifest: %w", err)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := archive.Create(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sign returns the detached PKCS #7 signature of the manifest required by Apple Wallet:
+// SHA-256 signed attributes with the pass certificate, which is chained to the WWDR
+// certificate
+func (a *Apple) sign(manifest []byte) ([]byte, error) {
+	sd, err := pkcs7.NewSignedData(manifest)
+	if err != nil {
+		return nil, err
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := sd.AddSignerChain(a.cert, a.key, []*x509.Certificate{a.wwdr}, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, err
+	}
+	sd.Detach()
+	return sd.Finish()
+}
+
+// Notify asks the device with the push token to download the updated pass from the web
+// service. Returns an error matching ErrUnregistered if the device removed the pass
+func (a *Apple) Notify(ctx context.Context, pushToken string) error {
+	endpoint := a.apnsURL + "/3/device/" + url.PathEscape(pushToken)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader("{}"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apns-topic", a.passTypeID)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("wallet: apns: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	var apnsErr struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&apnsErr)
+	err = fmt.Errorf("wallet: apns: HTTP %d: %s", resp.StatusCode, apnsErr.Reason)
+	if resp.StatusCode == http.StatusGone || apnsErr.Reason == "BadDeviceToken" || apnsErr.Reason == "Unregistered" {
+		return fmt.Errorf("%w: %w", ErrUnregistered, err)
+	}
+	return err
+}
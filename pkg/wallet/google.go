@@ -0,0 +1,177 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// Google Wallet endpoints
+const (
+	GoogleAPIBase = "https://walletobjects.googleapis.com"
+	GoogleSaveURL = "https://pay.google.com/gp/v/save/"
+	googleScope   = "https://www.googleapis.com/auth/wallet_object.issuer"
+
+	// googleClassSuffix identifies the pass class shared by all the restaurants
+	googleClassSuffix = "qrmenu"
+)
+
+// GoogleConfig holds the issuer account and the service account allowed to manage its passes
+type GoogleConfig struct {
+	IssuerID    string
+	Credentials []byte // Key file (JSON) of the service account
+	APIBase     string // Overrides GoogleAPIBase
+	Timeout     time.Duration
+}
+
+// Google creates "Save to Google Wallet" links and updates the saved passes
+type Google struct {
+	cfg    GoogleConfig
+	email  string // Service account email, issuer of the save links
+	key    *rsa.PrivateKey
+	client *http.Client // Authorized with the service account's access tokens
+}
+
+var googleIDPattern = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// NewGoogle creates the Google Wallet client
+func NewGoogle(cfg GoogleConfig) (*Google, error) {
+	if cfg.IssuerID == "" || len(cfg.Credentials) == 0 {
+		return nil, errors.New("wallet: google issuer ID and service account are required")
+	}
+	auth, err := google.JWTConfigFromJSON(cfg.Credentials, googleScope)
+	if err != nil {
+		return nil, fmt.Errorf("wallet: google service account: %w", err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(auth.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("wallet: google private key: %w", err)
+	}
+	if cfg.APIBase == "" {
+		cfg.APIBase = GoogleAPIBase
+	}
+	cfg.APIBase = strings.TrimRight(cfg.APIBase, "/")
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	// Access tokens are requested with the same timeout and reused until shortly before they expire
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Timeout: cfg.Timeout})
+	client := oauth2.NewClient(ctx, auth.TokenSource(ctx))
+	client.Timeout = cfg.Timeout
+	return &Google{cfg: cfg, email: auth.Email, key: key, client: client}, nil
+}
+
+// objectID returns the ID of the pass object: issuer ID and serial number
+func (g *Google) objectID(pass Pass) string {
+	return g.cfg.IssuerID + "." + googleIDPattern.ReplaceAllString(pass.SerialNumber, "_")
+}
+
+func (g *Google) classID() string {
+	return g.cfg.IssuerID + "." + googleClassSuffix
+}
+
+// localized is a LocalizedString of the Google Wallet API
+func localized(language, value string) map[string]interface{} {
+	return map[string]interface{}{"defaultValue": map[string]string{"language": language, "value": value}}
+}
+
+// object returns the generic object of the pass
+func (g *Google) object(pass Pass) map[string]interface{} {
+	language := pass.Language
+	if language == "" {
+		language = "en"
+	}
+	object := map[string]interface{}{
+		"id":                 g.objectID(pass),
+		"classId":            g.classID(),
+		"state":              "ACTIVE",
+		"cardTitle":          localized(language, pass.Name),
+		"header":             localized(language, pass.MenuName),
+		"hexBackgroundColor": pass.BackgroundColor,
+		"barcode":            map[string]string{"type": "QR_CODE", "value": pass.MenuURL},
+		"linksModuleData": map[string]interface{}{
+			"uris": []map[string]string{{"uri": pass.MenuURL, "description": pass.MenuLabel}},
+		},
+	}
+	if pass.MenuName == "" {
+		object["header"] = localized(language, pass.Name)
+	}
+	var modules []map[string]string
+	for _, f := range append(append([]Field(nil), pass.Fields...), pass.BackFields...) {
+		if f.Value != "" {
+			modules = append(modules, map[string]string{"id": f.Key, "header": f.Label, "body": f.Value})
+		}
+	}
+	if len(modules) > 0 {
+		object["textModulesData"] = modules
+	}
+	if strings.HasPrefix(pass.LogoURL, "https://") {
+		object["logo"] = map[string]interface{}{"sourceUri": map[string]string{"uri": pass.LogoURL}}
+	}
+	return object
+}
+
+// SaveURL returns the "Save to Google Wallet" link of the pass: a JWT signed by the service
+// account carrying the pass class and object
+func (g *Google) SaveURL(pass Pass) (string, error) {
+	if pass.SerialNumber == "" || pass.MenuURL == "" {
+		return "", errors.New("wallet: serial number and menu URL are required")
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":     g.email,
+		"aud":     "google",
+		"typ":     "savetowallet",
+		"iat":     time.Now().Unix(),
+		"origins": []string{},
+		"payload": map[string]interface{}{
+			"genericClasses": []map[string]string{{"id": g.classID()}},
+			"genericObjects": []map[string]interface{}{g.object(pass)},
+		},
+	})
+	signed, err := token.SignedString(g.key)
+	if err != nil {
+		return "", fmt.Errorf("wallet: sign google pass: %w", err)
+	}
+	return GoogleSaveURL + signed, nil
+}
+
+// Update replaces the saved pass with pass. Passes nobody has saved yet are ignored
+func (g *Google) Update(ctx context.Context, pass Pass) error {
+	body, err := json.Marshal(g.object(pass))
+	if err != nil {
+		return err
+	}
+	endpoint := g.cfg.APIBase + "/walletobjects/v1/genericObject/" + url.PathEscape(g.objectID(pass))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("wallet: google: %w", err)
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil
+	case resp.StatusCode < 300:
+		return nil
+	}
+	return fmt.Errorf("wallet: google: HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+}
@@ -0,0 +1,90 @@
+// Package wallet issues Apple Wallet and Google Wallet passes with the QR code of a restaurant
+// menu, so regulars can keep the menu in their phone wallet. Apple passes are signed .pkpass
+// archives kept up to date through the Apple web service protocol and APNs pushes; Google
+// passes are generic objects saved through a signed "Save to Google Wallet" link and updated
+// with the Google Wallet REST API.
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strconv"
+)
+
+// ErrUnregistered is matched by the errors of Apple.Notify for push tokens of devices that
+// removed the pass: their registrations should be deleted
+var ErrUnregistered = errors.New("wallet: device is no longer registered")
+
+// Field is a label and value shown on the pass
+type Field struct {
+	Key   string
+	Label string
+	Value string
+}
+
+// Pass is the pass of a restaurant. All the customers share the same pass, identified by
+// SerialNumber
+type Pass struct {
+	SerialNumber string // Stable identifier, e.g. the restaurant ID
+	Name         string // Restaurant name, shown as the title
+	Description  string // Accessibility description of the pass
+	Language     string // Language of the texts, e.g. it
+	MenuName     string // Primary field, e.g. the active menu
+	MenuLabel    string // Label of MenuName
+	MenuURL      string // Encoded in the QR code
+	Fields       []Field
+	BackFields   []Field // Apple only; Google shows them with Fields
+
+	BackgroundColor string      // #rrggbb
+	ForegroundColor string      // #rrggbb
+	Logo            image.Image // Apple only, scaled to fit 160x50 points
+	LogoURL         string      // Google only, public https URL of the logo
+
+	WebServiceURL string // Apple web service for updates, empty disables them
+	AuthToken     string // Apple web service token, at least 16 characters
+}
+
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ValidColor reports whether c is a #rrggbb color
+func ValidColor(c string) bool {
+	return hexColorPattern.MatchString(c)
+}
+
+// parseColor converts a #rrggbb color; invalid colors are black
+func parseColor(c string) color.RGBA {
+	if !ValidColor(c) {
+		return color.RGBA{A: 0xff}
+	}
+	v, _ := strconv.ParseUint(c[1:], 16, 32)
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
+
+// rgb formats a #rrggbb color as the rgb(r, g, b) value of pass.json
+func rgb(c string) string {
+	v := parseColor(c)
+	return fmt.Sprintf("rgb(%d, %d, %d)", v.R, v.G, v.B)
+}
+
+// encodePNG encodes img as PNG
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// solidImage returns a square image of the given side filled with c
+func solidImage(side int, c color.RGBA) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, side, side))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
@@ -0,0 +1,321 @@
+package wallet
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"image"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// testCertificate creates a certificate for key signed by parent (self-signed if nil)
+func testCertificate(t *testing.T, name string, key *rsa.PrivateKey, parent *x509.Certificate, parentKey *rsa.PrivateKey) *x509.Certificate {
+	t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func pemBlock(kind string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der})
+}
+
+func testApple(t *testing.T, apnsURL string) (*Apple, *x509.Certificate) {
+	t.Helper()
+	caKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ca := testCertificate(t, "Test WWDR", caKey, nil, nil)
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	cert := testCertificate(t, "Pass Type ID: pass.test.menu", key, ca, caKey)
+	apple, err := NewApple(AppleConfig{
+		PassTypeID: "pass.test.menu",
+		TeamID:     "TEAM123456",
+		CertPEM:    pemBlock("CERTIFICATE", cert.Raw),
+		KeyPEM:     pemBlock("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+		WWDRPEM:    pemBlock("CERTIFICATE", ca.Raw),
+		APNsURL:    apnsURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return apple, cert
+}
+
+func testPass() Pass {
+	return Pass{
+		SerialNumber:    "rest-1",
+		Name:            "Trattoria da Mario",
+		Description:     "Menu di Trattoria da Mario",
+		Language:        "it",
+		MenuName:        "Menu cena",
+		MenuLabel:       "Menu",
+		MenuURL:         "https://menu.example.com/r/mario",
+		Fields:          []Field{{Key: "address", Label: "Indirizzo", Value: "Via Roma 1"}},
+		BackFields:      []Field{{Key: "phone", Label: "Telefono", Value: "+39 06 1234567"}, {Key: "empty", Label: "Vuoto"}},
+		BackgroundColor: "#8B0000",
+		ForegroundColor: "#FFFFFF",
+		Logo:            image.NewRGBA(image.Rect(0, 0, 400, 100)),
+		LogoURL:         "https://menu.example.com/uploads/logo.png",
+		WebServiceURL:   "https://menu.example.com/api/v1/public/wallet",
+		AuthToken:       "0123456789abcdef0123",
+	}
+}
+
+func TestAppleBuild(t *testing.T) {
+	apple, cert := testApple(t, "")
+	data, err := apple.Build(testPass())
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, _ := f.Open()
+		files[f.Name], _ = io.ReadAll(r)
+		r.Close()
+	}
+
+	var manifest map[string]string
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"pass.json", "icon.png", "icon@2x.png", "logo.png", "logo@2x.png"} {
+		sum := sha1.Sum(files[name])
+		if manifest[name] != hex.EncodeToString(sum[:]) {
+			t.Errorf("manifest entry of %s does not match", name)
+		}
+	}
+
+	var pass map[string]interface{}
+	json.Unmarshal(files["pass.json"], &pass)
+	if pass["passTypeIdentifier"] != "pass.test.menu" || pass["backgroundColor"] != "rgb(139, 0, 0)" || pass["authenticationToken"] != "0123456789abcdef0123" {
+		t.Errorf("unexpected pass.json %s", files["pass.json"])
+	}
+	barcode := pass["barcodes"].([]interface{})[0].(map[string]interface{})
+	if barcode["message"] != "https://menu.example.com/r/mario" || barcode["format"] != "PKBarcodeFormatQR" {
+		t.Errorf("unexpected barcode %v", barcode)
+	}
+	if back := pass["generic"].(map[string]interface{})["backFields"].([]interface{}); len(back) != 1 {
+		t.Errorf("empty fields should be left out: %v", back)
+	}
+
+	verifySignature(t, files["signature"], files["manifest.json"], cert, apple.wwdr)
+
+	logo, _, err := image.DecodeConfig(bytes.NewReader(files["logo@2x.png"]))
+	if err != nil || logo.Width != 320 || logo.Height != 80 {
+		t.Errorf("logo@2x is %dx%d, want 320x80", logo.Width, logo.Height)
+	}
+
+	noToken := testPass()
+	noToken.AuthToken = "short"
+	if _, err := apple.Build(noToken); err == nil {
+		t.Error("expected an error for a short web service token")
+	}
+}
+
+// verifySignature parses the detached PKCS #7 signature, checks that it carries the signer
+// and WWDR certificates and verifies it over content, with the chain up to the WWDR certificate
+func verifySignature(t *testing.T, signature, content []byte, cert, wwdr *x509.Certificate) {
+	t.Helper()
+	p7, err := pkcs7.Parse(signature)
+	if err != nil {
+		t.Fatalf("signature is not PKCS #7 signed data: %v", err)
+	}
+	if len(p7.Signers) != 1 {
+		t.Fatalf("expected one signer, got %d", len(p7.Signers))
+	}
+	if len(p7.Certificates) != 2 || !p7.Certificates[0].Equal(cert) || !p7.Certificates[1].Equal(wwdr) {
+		t.Errorf("expected the signer and WWDR certificates, got %d", len(p7.Certificates))
+	}
+	if p7.GetOnlySigner() == nil || !p7.GetOnlySigner().Equal(cert) {
+		t.Error("signer does not match the certificate")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(wwdr)
+	p7.Content = content
+	if err := p7.VerifyWithChain(roots); err != nil {
+		t.Errorf("invalid signature: %v", err)
+	}
+	p7.Content = append([]byte(nil), content...)
+	p7.Content[0] ^= 1
+	if err := p7.Verify(); err == nil {
+		t.Error("signature verified over a modified manifest")
+	}
+}
+
+func TestAppleNotify(t *testing.T) {
+	var topic atomic.Value
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		topic.Store(r.Header.Get("apns-topic"))
+		switch r.URL.Path {
+		case "/3/device/gone":
+			w.WriteHeader(http.StatusGone)
+			io.WriteString(w, `{"reason": "Unregistered"}`)
+		case "/3/device/busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"reason": "TooManyRequests"}`)
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	apple, _ := testApple(t, srv.URL)
+	transport := apple.client.Transport.(*http.Transport)
+	transport.TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	ctx := context.Background()
+	if err := apple.Notify(ctx, "token-1"); err != nil {
+		t.Fatal(err)
+	}
+	if topic.Load() != "pass.test.menu" {
+		t.Errorf("apns-topic = %v", topic.Load())
+	}
+	if err := apple.Notify(ctx, "gone"); !errors.Is(err, ErrUnregistered) {
+		t.Errorf("removed pass: %v", err)
+	}
+	if err := apple.Notify(ctx, "busy"); err == nil || errors.Is(err, ErrUnregistered) {
+		t.Errorf("rate limited push: %v", err)
+	}
+}
+
+func testGoogle(t *testing.T, srvURL string) (*Google, *rsa.PrivateKey) {
+	t.Helper()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	credentials, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "wallet@demo.iam.gserviceaccount.com",
+		"private_key":  string(pemBlock("PRIVATE KEY", der)),
+		"token_uri":    srvURL + "/token",
+	})
+	google, err := NewGoogle(GoogleConfig{
+		IssuerID:    "3388000000012345678",
+		Credentials: credentials,
+		APIBase:     srvURL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return google, key
+}
+
+func TestGoogleSaveURL(t *testing.T) {
+	google, key := testGoogle(t, "")
+	link, err := google.SaveURL(testPass())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link, GoogleSaveURL) {
+		t.Fatalf("unexpected link %s", link)
+	}
+	parts := strings.Split(strings.TrimPrefix(link, GoogleSaveURL), ".")
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatalf("invalid JWT signature: %v", err)
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	var claims struct {
+		Iss     string `json:"iss"`
+		Aud     string `json:"aud"`
+		Typ     string `json:"typ"`
+		Payload struct {
+			GenericObjects []map[string]interface{} `json:"genericObjects"`
+		} `json:"payload"`
+	}
+	json.Unmarshal(raw, &claims)
+	if claims.Iss != "wallet@demo.iam.gserviceaccount.com" || claims.Aud != "google" || claims.Typ != "savetowallet" || len(claims.Payload.GenericObjects) != 1 {
+		t.Fatalf("unexpected claims %s", raw)
+	}
+	object := claims.Payload.GenericObjects[0]
+	if object["id"] != "3388000000012345678.rest-1" || object["classId"] != "3388000000012345678.qrmenu" {
+		t.Errorf("unexpected object IDs %v", object)
+	}
+	if object["barcode"].(map[string]interface{})["value"] != "https://menu.example.com/r/mario" || object["logo"] == nil {
+		t.Errorf("unexpected object %v", object)
+	}
+	if modules := object["textModulesData"].([]interface{}); len(modules) != 2 {
+		t.Errorf("unexpected text modules %v", modules)
+	}
+}
+
+func TestGoogleUpdate(t *testing.T) {
+	var tokens, updates int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			atomic.AddInt32(&tokens, 1)
+			io.WriteString(w, `{"access_token": "ya29.test", "expires_in": 3600}`)
+		case r.Header.Get("Authorization") != "Bearer ya29.test":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodPut && r.URL.Path == "/walletobjects/v1/genericObject/3388000000012345678.rest-1":
+			atomic.AddInt32(&updates, 1)
+			io.WriteString(w, `{}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	google, _ := testGoogle(t, srv.URL)
+	ctx := context.Background()
+	if err := google.Update(ctx, testPass()); err != nil {
+		t.Fatal(err)
+	}
+	unsaved := testPass()
+	unsaved.SerialNumber = "rest-2"
+	if err := google.Update(ctx, unsaved); err != nil {
+		t.Errorf("passes nobody saved should be ignored: %v", err)
+	}
+	if tokens != 1 || updates != 1 {
+		t.Errorf("tokens = %d, updates = %d", tokens, updates)
+	}
+}
+
+func TestValidColor(t *testing.T) {
+	for c, want := range map[string]bool{"#8b0000": true, "#FFFFFF": true, "8b0000": false, "#fff": false, "#gggggg": false} {
+		if ValidColor(c) != want {
+			t.Errorf("ValidColor(%q) = %v", c, !want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package webhook signs and sends webhook deliveries, and decides when a failed delivery is
+// retried, when it goes to the dead-letter list and when a failing endpoint is paused.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// signatureVersion prefixes the signature, so the scheme can change without breaking receivers
+const signatureVersion = "v1="
+
+// ErrInvalidSignature is returned by Verify for a wrong or stale signature
+var ErrInvalidSignature = errors.New("webhook: invalid signature")
+
+// Sign returns the signature of a payload: the HMAC-SHA256 with the endpoint secret of the
+// Unix timestamp, a dot and the body. Signing the timestamp stops replays of old deliveries
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a delivery as a receiver would. A
+// timestamp further than tolerance from now is rejected
+func Verify(secret, timestamp, signature string, body []byte, tolerance time.Duration, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Policy holds the retry and circuit-breaking rules of the deliveries
+type Policy struct {
+	MaxAttempts      int           // Attempts before a delivery goes to the dead-letter list
+	BaseDelay        time.Duration // Delay before the first retry, doubled at every attempt
+	MaxDelay         time.Duration
+	BreakerThreshold int           // Consecutive failures of an endpoint that open its circuit
+	BreakerCooldown  time.Duration // How long an open circuit pauses the deliveries to the endpoint
+}
+
+// NextRetry returns when a delivery that failed its attempt-th attempt is tried again, with
+// up to 10% of jitter so retries of many deliveries spread out. It returns false when the
+// attempts are over and the delivery is dead
+func (p Policy) NextRetry(attempt int, now time.Time) (time.Time, bool) {
+	if attempt >= p.MaxAttempts {
+		return time.Time{}, false
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if jitter := int64(delay / 10); jitter > 0 {
+		delay += time.Duration(rand.Int63n(jitter))
+	}
+	return now.Add(delay), true
+}
+
+// CircuitOpenUntil returns until when the deliveries to an endpoint are paused after its
+// latest failure, or the zero time if the endpoint has not failed often enough
+func (p Policy) CircuitOpenUntil(consecutiveFailures int, lastFailure time.Time) time.Time {
+	if p.BreakerThreshold <= 0 || consecutiveFailures < p.BreakerThreshold {
+		return time.Time{}
+	}
+	return lastFailure.Add(p.BreakerCooldown)
+}
+
+// Request is a signed delivery of an event to an endpoint
+type Request struct {
+	URL        string
+	Secret     string
+	DeliveryID string
+	EventType  string
+	Locale     string
+	Body       []byte
+}
+
+// ErrForbiddenAddress is matched (with errors.Is) by the error of a delivery to an endpoint that
+// resolves to a loopback, private, link-local (cloud metadata included) or unspecified address
+var ErrForbiddenAddress = errors.New("webhook: endpoint address not allowed")
+
+// reservedNetworks are blocked on top of the ranges the net.IP methods recognize
+var reservedNetworks = []*net.IPNet{
+	mustCIDR("0.0.0.0/8"),     // "This" network
+	mustCIDR("100.64.0.0/10"), // Carrier-grade NAT
+	mustCIDR("192.0.0.0/24"),  // IETF protocol assignments
+	mustCIDR("198.18.0.0/15"), // Benchmarking
+	mustCIDR("64:ff9b::/96"),  // NAT64, which would reach IPv4 addresses through a translator
+}
+
+func mustCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// PublicAddress reports whether deliveries may be sent to ip: endpoints are configured by
+// tenants, so they must not reach the server itself, its private network or the cloud
+// metadata service
+func PublicAddress(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialControl rejects connections to addresses that are not public. It runs on the resolved
+// address of every connection, so a hostname that resolves (or later rebinds) to an internal
+// address is blocked too
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !PublicAddress(net.ParseIP(host)) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// Sender posts deliveries to the endpoints
+type Sender struct {
+	Client *http.Client
+}
+
+// PublicTransport returns a transport that only connects to public addresses, for requests
+// to URLs chosen by tenants or browsers (webhook endpoints, push subscriptions)
+func PublicTransport(timeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialControl}
+	return &http.Transport{
+		// No proxy from the environment: the address check must apply to the endpoint
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: timeout,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// NewSender creates a sender whose requests time out after timeout and only reach public
+// addresses
+func NewSender(timeout time.Duration) *Sender {
+	return &Sender{Client: &http.Client{
+		Timeout:   timeout,
+		Transport: PublicTransport(timeout),
+		// A redirect would resend the signed payload to a host the owner did not configure
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}}
+}
+
+// Send signs and posts the delivery. It returns the response status, and an error for network
+// failures and statuses other than 2xx. The response body is never part of the error: the
+// error is shown to the tenant, who must not read what an endpoint answers
+func (s *Sender) Send(ctx context.Context, req Request, now time.Time) (int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return 0, fmt.Errorf("webhook: %w", err)
+	}
+	timestamp := now.Unix()
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "qr-menu-webhooks/1.0")
+	httpReq.Header.Set(HeaderEvent, req.EventType)
+	httpReq.Header.Set(HeaderDelivery, req.DeliveryID)
+	httpReq.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	httpReq.Header.Set(HeaderSignature, Sign(req.Secret, timestamp, req.Body))
+	if req.Locale != "" {
+		httpReq.Header.Set("Content-Language", req.Locale)
+	}
+
+	resp, err := s.Client.Do(httpReq)
+	if err != nil {
+		return 0, fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drained so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook: endpoint responded %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
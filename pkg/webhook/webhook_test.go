@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"type":"webhook.test"}`)
+	now := time.Unix(1793448000, 0)
+	sig := Sign("secret", now.Unix(), body)
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	if err := Verify("secret", ts, sig, body, 5*time.Minute, now.Add(time.Minute)); err != nil {
+		t.Errorf("Verify = %v", err)
+	}
+	if err := Verify("other", ts, sig, body, 5*time.Minute, now); err != ErrInvalidSignature {
+		t.Errorf("wrong secret: Verify = %v", err)
+	}
+	if err := Verify("secret", ts, sig, []byte(`{}`), 5*time.Minute, now); err != ErrInvalidSignature {
+		t.Errorf("tampered body: Verify = %v", err)
+	}
+	if err := Verify("secret", ts, sig, body, 5*time.Minute, now.Add(10*time.Minute)); err != ErrInvalidSignature {
+		t.Errorf("stale timestamp: Verify = %v", err)
+	}
+}
+
+func TestNextRetry(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: 5 * time.Minute}
+	now := time.Now()
+
+	tests := []struct {
+		attempt int
+		min     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 5 * time.Minute}, // Capped
+	}
+	for _, tt := range tests {
+		next, ok := p.NextRetry(tt.attempt, now)
+		if !ok {
+			t.Fatalf("attempt %d: expected a retry", tt.attempt)
+		}
+		if delay := next.Sub(now); delay < tt.min || delay > tt.min+tt.min/10 {
+			t.Errorf("attempt %d: delay = %s, want %s plus jitter", tt.attempt, delay, tt.min)
+		}
+	}
+	if _, ok := p.NextRetry(5, now); ok {
+		t.Error("Expected the delivery to be dead after the last attempt")
+	}
+}
+
+func TestCircuitOpenUntil(t *testing.T) {
+	p := Policy{BreakerThreshold: 3, BreakerCooldown: time.Hour}
+	failure := time.Now()
+
+	if until := p.CircuitOpenUntil(2, failure); !until.IsZero() {
+		t.Errorf("below threshold: open until %s", until)
+	}
+	if until := p.CircuitOpenUntil(3, failure); !until.Equal(failure.Add(time.Hour)) {
+		t.Errorf("at threshold: open until %s", until)
+	}
+}
+
+func TestSend(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	status := http.StatusNoContent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte("busy"))
+	}))
+	defer srv.Close()
+
+	// The test server listens on loopback, which NewSender refuses
+	sender := &Sender{Client: srv.Client()}
+	now := time.Unix(1793448000, 0)
+	req := Request{URL: srv.URL, Secret: "secret", DeliveryID: "d1", EventType: "webhook.test", Locale: "it", Body: []byte(`{"id":"e1"}`)}
+
+	code, err := sender.Send(context.Background(), req, now)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("Send = %d, %v", code, err)
+	}
+	if got.Header.Get(HeaderEvent) != "webhook.test" || got.Header.Get(HeaderDelivery) != "d1" || got.Header.Get("Content-Language") != "it" {
+		t.Errorf("headers = %v", got.Header)
+	}
+	if err := Verify("secret", got.Header.Get(HeaderTimestamp), got.Header.Get(HeaderSignature), gotBody, time.Minute, now); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	code, err = sender.Send(context.Background(), req, now)
+	if err == nil || code != http.StatusServiceUnavailable {
+		t.Errorf("Send = %d, %v; expected an error", code, err)
+	}
+	if err != nil && strings.Contains(err.Error(), "busy") {
+		t.Errorf("error %q exposes the response body", err)
+	}
+}
+
+func TestSendRejectsInternalAddresses(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	sender := NewSender(time.Second)
+	for _, target := range []string{
+		srv.URL,
+		"http://localhost:" + port,
+		"http://[::1]:" + port,
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.1/",
+		"http://0.0.0.0:" + port,
+	} {
+		_, err := sender.Send(context.Background(), Request{URL: target, Secret: "secret", Body: []byte(`{}`)}, time.Now())
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("Send(%s) = %v, want ErrForbiddenAddress", target, err)
+		}
+	}
+	if hit {
+		t.Error("the loopback endpoint was reached")
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":                      true,
+		"2606:2800:220:1:248:1893:25c8:1946": true,
+		"127.0.0.1":                          false,
+		"10.1.2.3":                           false,
+		"172.16.0.1":                         false,
+		"192.168.1.1":                        false,
+		"169.254.169.254":                    false,
+		"100.64.0.1":                         false,
+		"0.0.0.0":                            false,
+		"::1":                                false,
+		"fd00::1":                            false,
+		"fe80::1":                            false,
+		"::ffff:127.0.0.1":                   false,
+	} {
+		if got := PublicAddress(net.ParseIP(addr)); got != want {
+			t.Errorf("PublicAddress(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
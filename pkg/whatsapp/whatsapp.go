@@ -0,0 +1,307 @@
+// Package whatsapp sends messages through the WhatsApp Business Cloud API and parses the
+// webhooks with which Meta reports incoming messages and delivery status. Messages started by
+// the business must use a template approved on the WhatsApp Business account; free-form text
+// is allowed only within 24 hours of the last message of the customer.
+package whatsapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAPIBase is the Graph API endpoint of the Cloud API
+const DefaultAPIBase = "https://graph.facebook.com/v20.0"
+
+// ErrPermanent is matched (with errors.Is) by send errors that would fail again on retry,
+// e.g. an unknown template or an expired access token
+var ErrPermanent = errors.New("permanent whatsapp delivery failure")
+
+// ErrOptedOut is matched by the error returned when the recipient blocked the business or
+// stopped its messages. It also matches ErrPermanent
+var ErrOptedOut = fmt.Errorf("%w: recipient opted out", ErrPermanent)
+
+// Error codes of the Cloud API for recipients that cannot be messaged any more
+var optOutCodes = map[int]bool{
+	131050: true, // User stopped marketing messages
+}
+
+// Delivery status reported by the webhooks
+const (
+	StatusSent      = "sent"
+	StatusDelivered = "delivered"
+	StatusRead      = "read"
+	StatusFailed    = "failed"
+)
+
+// Account identifies the business phone number messages are sent from
+type Account struct {
+	PhoneNumberID string
+	AccessToken   string
+}
+
+// Template is an approved message template with the values of its body variables,
+// {{1}}, {{2}}... in order
+type Template struct {
+	Name     string
+	Language string // e.g. it or en_US
+	Params   []string
+}
+
+// Config holds the Cloud API client configuration
+type Config struct {
+	APIBase string        // Defaults to DefaultAPIBase
+	Timeout time.Duration // Defaults to 30 seconds
+}
+
+// Client sends messages through the Cloud API on behalf of any Account
+type Client struct {
+	base string
+	http *http.Client
+}
+
+// New creates a Cloud API client
+func New(cfg Config) *Client {
+	if cfg.APIBase == "" {
+		cfg.APIBase = DefaultAPIBase
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	return &Client{base: strings.TrimRight(cfg.APIBase, "/"), http: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// SendTemplate sends a template message to the number to, in international form without
+// the leading '+', and returns the message ID reported again by the status webhooks
+func (c *Client) SendTemplate(ctx context.Context, account Account, to string, tmpl Template) (string, error) {
+	params := make([]map[string]string, len(tmpl.Params))
+	for i, p := range tmpl.Params {
+		params[i] = map[string]string{"type": "text", "text": Param(p)}
+	}
+	template := map[string]interface{}{
+		"name":     tmpl.Name,
+		"language": map[string]string{"code": tmpl.Language},
+	}
+	if len(params) > 0 {
+		template["components"] = []map[string]interface{}{{"type": "body", "parameters": params}}
+	}
+	return c.send(ctx, account, map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"to":                to,
+		"type":              "template",
+		"template":          template,
+	})
+}
+
+// SendText sends a free-form text message, allowed only as a reply within 24 hours of the
+// last message of the recipient
+func (c *Client) SendText(ctx context.Context, account Account, to, body string) (string, error) {
+	return c.send(ctx, account, map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"to":                to,
+		"type":              "text",
+		"text":              map[string]interface{}{"body": body, "preview_url": true},
+	})
+}
+
+func (c *Client) send(ctx context.Context, account Account, payload map[string]interface{}) (string, error) {
+	if account.PhoneNumberID == "" || account.AccessToken == "" {
+		return "", fmt.Errorf("%w: phone number ID and access token are required", ErrPermanent)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.base+"/"+account.PhoneNumberID+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+account.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("whatsapp: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+		Error struct {
+			Message string `json:"message"`
+			Code    int    `json:"code"`
+		} `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	json.Unmarshal(data, &result)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 && len(result.Messages) > 0 {
+		return result.Messages[0].ID, nil
+	}
+
+	err = fmt.Errorf("whatsapp: HTTP %d: %d %s", resp.StatusCode, result.Error.Code, result.Error.Message)
+	switch {
+	case optOutCodes[result.Error.Code]:
+		return "", fmt.Errorf("%w: %w", ErrOptedOut, err)
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return "", fmt.Errorf("%w: %w", ErrPermanent, err)
+	}
+	return "", err
+}
+
+// Param prepares a template variable: the Cloud API rejects values with line breaks, tabs or
+// more than four consecutive spaces, and longer than 1024 characters
+func Param(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if runes := []rune(s); len(runes) > 1024 {
+		s = string(runes[:1021]) + "..."
+	}
+	return s
+}
+
+// VerifySignature checks the X-Hub-Signature-256 header of a webhook: the hex HMAC-SHA256 of
+// the raw body keyed with the app secret, prefixed by "sha256="
+func VerifySignature(appSecret string, body []byte, header string) bool {
+	signature, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if appSecret == "" || err != nil || !strings.HasPrefix(header, "sha256=") {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+// VerifyChallenge answers the subscription check of a webhook: it returns hub.challenge if
+// hub.mode is subscribe and hub.verify_token matches verifyToken
+func VerifyChallenge(r *http.Request, verifyToken string) (string, bool) {
+	q := r.URL.Query()
+	token := q.Get("hub.verify_token")
+	if verifyToken == "" || q.Get("hub.mode") != "subscribe" || !hmac.Equal([]byte(token), []byte(verifyToken)) {
+		return "", false
+	}
+	return q.Get("hub.challenge"), true
+}
+
+// Message is an incoming message
+type Message struct {
+	PhoneNumberID string // Business number that received the message
+	From          string // International number without the leading '+'
+	Name          string // Profile name of the sender
+	ID            string
+	Text          string // Body of text messages and text of quick-reply buttons
+}
+
+// Status is a delivery status update of a sent message
+type Status struct {
+	PhoneNumberID string
+	MessageID     string
+	Recipient     string
+	Status        string // One of the Status constants
+	ErrorCode     int
+}
+
+// Notification is the content of a webhook, which may batch several updates
+type Notification struct {
+	Messages []Message
+	Statuses []Status
+}
+
+// ParseWebhook parses the body of a webhook of the whatsapp_business_account object.
+// Signatures must be checked first with VerifySignature
+func ParseWebhook(body []byte) (*Notification, error) {
+	var payload struct {
+		Object string `json:"object"`
+		Entry  []struct {
+			Changes []struct {
+				Value struct {
+					Metadata struct {
+						PhoneNumberID string `json:"phone_number_id"`
+					} `json:"metadata"`
+					Contacts []struct {
+						WaID    string `json:"wa_id"`
+						Profile struct {
+							Name string `json:"name"`
+						} `json:"profile"`
+					} `json:"contacts"`
+					Messages []struct {
+						ID   string `json:"id"`
+						From string `json:"from"`
+						Type string `json:"type"`
+						Text struct {
+							Body string `json:"body"`
+						} `json:"text"`
+						Button struct {
+							Text string `json:"text"`
+						} `json:"button"`
+					} `json:"messages"`
+					Statuses []struct {
+						ID          string `json:"id"`
+						Status      string `json:"status"`
+						RecipientID string `json:"recipient_id"`
+						Errors      []struct {
+							Code int `json:"code"`
+						} `json:"errors"`
+					} `json:"statuses"`
+				} `json:"value"`
+			} `json:"changes"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("whatsapp: invalid webhook: %w", err)
+	}
+	if payload.Object != "whatsapp_business_account" {
+		return nil, fmt.Errorf("whatsapp: unexpected webhook object %q", payload.Object)
+	}
+
+	n := &Notification{}
+	for _, entry := range payload.Entry {
+		for _, change := range entry.Changes {
+			v := change.Value
+			names := make(map[string]string, len(v.Contacts))
+			for _, c := range v.Contacts {
+				names[c.WaID] = c.Profile.Name
+			}
+			for _, m := range v.Messages {
+				text := m.Text.Body
+				if m.Type == "button" {
+					text = m.Button.Text
+				}
+				n.Messages = append(n.Messages, Message{
+					PhoneNumberID: v.Metadata.PhoneNumberID,
+					From:          m.From,
+					Name:          names[m.From],
+					ID:            m.ID,
+					Text:          text,
+				})
+			}
+			for _, s := range v.Statuses {
+				status := Status{
+					PhoneNumberID: v.Metadata.PhoneNumberID,
+					MessageID:     s.ID,
+					Recipient:     s.RecipientID,
+					Status:        s.Status,
+				}
+				if len(s.Errors) > 0 {
+					status.ErrorCode = s.Errors[0].Code
+				}
+				n.Statuses = append(n.Statuses, status)
+			}
+		}
+	}
+	return n, nil
+}
+
+// OptedOut reports whether a failed status means the recipient cannot be messaged any more
+func (s Status) OptedOut() bool {
+	return s.Status == StatusFailed && optOutCodes[s.ErrorCode]
+}
@@ -0,0 +1,122 @@
+package whatsapp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSendTemplate(t *testing.T) {
+	var payload map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1234/messages" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		switch payload["to"] {
+		case "393330000000":
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error": {"message": "User stopped marketing messages", "code": 131050}}`)
+		case "393331111111":
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"error": {"message": "Invalid OAuth access token", "code": 190}}`)
+		case "393332222222":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			io.WriteString(w, `{"messaging_product": "whatsapp", "messages": [{"id": "wamid.123"}]}`)
+		}
+	}))
+	defer srv.Close()
+
+	client := New(Config{APIBase: srv.URL + "/"})
+	account := Account{PhoneNumberID: "1234", AccessToken: "token"}
+	tmpl := Template{Name: "order_confirmed", Language: "it", Params: []string{"Trattoria\nda Mario", "A12"}}
+
+	id, err := client.SendTemplate(context.Background(), account, "393331234567", tmpl)
+	if err != nil || id != "wamid.123" {
+		t.Fatalf("SendTemplate = %q, %v", id, err)
+	}
+	template := payload["template"].(map[string]interface{})
+	params := template["components"].([]interface{})[0].(map[string]interface{})["parameters"].([]interface{})
+	if template["name"] != "order_confirmed" || len(params) != 2 || params[0].(map[string]interface{})["text"] != "Trattoria da Mario" {
+		t.Errorf("unexpected template %v", template)
+	}
+
+	if _, err := client.SendTemplate(context.Background(), account, "393330000000", tmpl); !errors.Is(err, ErrOptedOut) || !errors.Is(err, ErrPermanent) {
+		t.Errorf("stopped recipient: %v", err)
+	}
+	if _, err := client.SendTemplate(context.Background(), account, "393331111111", tmpl); errors.Is(err, ErrOptedOut) || !errors.Is(err, ErrPermanent) {
+		t.Errorf("invalid token: %v", err)
+	}
+	if _, err := client.SendTemplate(context.Background(), account, "393332222222", tmpl); err == nil || errors.Is(err, ErrPermanent) {
+		t.Errorf("unavailable service should be temporary: %v", err)
+	}
+	if _, err := client.SendText(context.Background(), Account{}, "393331234567", "Ciao"); !errors.Is(err, ErrPermanent) {
+		t.Errorf("missing account: %v", err)
+	}
+}
+
+func TestParam(t *testing.T) {
+	if got := Param("  Menu\tdel\n\ngiorno     oggi "); got != "Menu del giorno oggi" {
+		t.Errorf("Param = %q", got)
+	}
+	if got := []rune(Param(strings.Repeat("è", 2000))); len(got) != 1024 {
+		t.Errorf("long parameter has %d characters", len(got))
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"object":"whatsapp_business_account"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	header := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !VerifySignature("secret", body, header) {
+		t.Error("valid signature rejected")
+	}
+	if VerifySignature("other", body, header) || VerifySignature("secret", body, strings.TrimPrefix(header, "sha256=")) || VerifySignature("", body, header) {
+		t.Error("invalid signature accepted")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/webhook?hub.mode=subscribe&hub.verify_token=tok&hub.challenge=42", nil)
+	if challenge, ok := VerifyChallenge(r, "tok"); !ok || challenge != "42" {
+		t.Errorf("VerifyChallenge = %q, %v", challenge, ok)
+	}
+	if _, ok := VerifyChallenge(r, "other"); ok {
+		t.Error("wrong verify token accepted")
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+	body := `{"object": "whatsapp_business_account", "entry": [{"changes": [{"value": {
+		"metadata": {"phone_number_id": "1234"},
+		"contacts": [{"wa_id": "393331234567", "profile": {"name": "Anna"}}],
+		"messages": [
+			{"id": "wamid.in1", "from": "393331234567", "type": "text", "text": {"body": "MENU"}},
+			{"id": "wamid.in2", "from": "393331234567", "type": "button", "button": {"text": "Stop"}}
+		],
+		"statuses": [{"id": "wamid.123", "status": "failed", "recipient_id": "393330000000", "errors": [{"code": 131050}]}]
+	}}]}]}`
+	n, err := ParseWebhook([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Messages) != 2 || n.Messages[0] != (Message{PhoneNumberID: "1234", From: "393331234567", Name: "Anna", ID: "wamid.in1", Text: "MENU"}) || n.Messages[1].Text != "Stop" {
+		t.Errorf("unexpected messages %+v", n.Messages)
+	}
+	if len(n.Statuses) != 1 || n.Statuses[0].MessageID != "wamid.123" || !n.Statuses[0].OptedOut() {
+		t.Errorf("unexpected statuses %+v", n.Statuses)
+	}
+
+	if _, err := ParseWebhook([]byte(`{"object": "page"}`)); err == nil {
+		t.Error("webhooks of other objects should be rejected")
+	}
+}
@@ -0,0 +1,4 @@
+// Package qrmenuv1 contiene messaggi e servizi gRPC generati da qrmenu.proto
+package qrmenuv1
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative qrmenu/v1/qrmenu.proto
@@ -12,6 +12,8 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/pbkdf2"
+
+	"qr-menu/pkg/memstore"
 )
 
 // Encryption provides encryption utilities
@@ -183,9 +185,9 @@ func (fe *FieldEncryption) DecryptSensitiveFields(data map[string]interface{}) e
 	return nil
 }
 
-// TokenManager handles secure token generation and validation
+// TokenManager handles secure token generation and validation. It is safe for concurrent use
 type TokenManager struct {
-	tokens map[string]TokenInfo
+	tokens *memstore.Map[string, TokenInfo]
 }
 
 // TokenInfo stores token metadata
@@ -198,7 +200,7 @@ type TokenInfo struct {
 // NewTokenManager creates a new token manager
 func NewTokenManager() *TokenManager {
 	return &TokenManager{
-		tokens: make(map[string]TokenInfo),
+		tokens: memstore.New[string, TokenInfo](),
 	}
 }
 
@@ -209,25 +211,25 @@ func (tm *TokenManager) GenerateToken(userID, tokenType string, expiresAt int64)
 		return "", err
 	}
 
-	tm.tokens[token] = TokenInfo{
+	tm.tokens.Set(token, TokenInfo{
 		UserID:    userID,
 		ExpiresAt: expiresAt,
 		Type:      tokenType,
-	}
+	})
 
 	return token, nil
 }
 
 // ValidateToken checks if a token is valid
 func (tm *TokenManager) ValidateToken(token string) (TokenInfo, bool) {
-	info, exists := tm.tokens[token]
+	info, exists := tm.tokens.Get(token)
 	if !exists {
 		return TokenInfo{}, false
 	}
 
 	// Check expiration
 	if info.ExpiresAt > 0 && info.ExpiresAt < currentTimeMillis() {
-		delete(tm.tokens, token)
+		tm.tokens.Delete(token)
 		return TokenInfo{}, false
 	}
 
@@ -236,7 +238,7 @@ func (tm *TokenManager) ValidateToken(token string) (TokenInfo, bool) {
 
 // RevokeToken invalidates a token
 func (tm *TokenManager) RevokeToken(token string) {
-	delete(tm.tokens, token)
+	tm.tokens.Delete(token)
 }
 
 func currentTimeMillis() int64 {
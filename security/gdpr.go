@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"qr-menu/pkg/memstore"
 )
 
 // GDPRManager handles GDPR compliance operations
@@ -66,7 +68,8 @@ const (
 	ConsentCookies     = "cookies"
 )
 
-var consentStore = make(map[string][]ConsentRecord)
+// consentStore holds the consent history of each user, oldest first
+var consentStore = memstore.New[string, []ConsentRecord]()
 
 // RecordConsent records a user's consent
 func (gm *GDPRManager) RecordConsent(record ConsentRecord) error {
@@ -79,11 +82,10 @@ func (gm *GDPRManager) RecordConsent(record ConsentRecord) error {
 
 	record.Timestamp = time.Now()
 
-	// Store consent
-	if _, exists := consentStore[record.UserID]; !exists {
-		consentStore[record.UserID] = make([]ConsentRecord, 0)
-	}
-	consentStore[record.UserID] = append(consentStore[record.UserID], record)
+	// Store consent. The slice is copied so readers holding the previous one never see it change
+	consentStore.Update(record.UserID, func(records []ConsentRecord, _ bool) []ConsentRecord {
+		return append(records[:len(records):len(records)], record)
+	})
 
 	// Audit log
 	gm.auditLogger.LogDataAccess(record.UserID, "consent", "record", map[string]interface{}{
@@ -96,7 +98,7 @@ func (gm *GDPRManager) RecordConsent(record ConsentRecord) error {
 
 // GetConsents retrieves all consents for a user
 func (gm *GDPRManager) GetConsents(userID string) []ConsentRecord {
-	if records, exists := consentStore[userID]; exists {
+	if records, exists := consentStore.Get(userID); exists {
 		return records
 	}
 	return []ConsentRecord{}
@@ -104,7 +106,7 @@ func (gm *GDPRManager) GetConsents(userID string) []ConsentRecord {
 
 // HasConsent checks if user has granted specific consent
 func (gm *GDPRManager) HasConsent(userID, consentType string) bool {
-	records, exists := consentStore[userID]
+	records, exists := consentStore.Get(userID)
 	if !exists {
 		return false
 	}
@@ -157,7 +159,9 @@ func (gm *GDPRManager) ExportUserDataJSON(userID string, user interface{}, resta
 	return json.MarshalIndent(export, "", "  ")
 }
 
-var deletionRequests = make(map[string]*DataDeletionRequest)
+// deletionRequests holds the latest deletion request of each user. Requests are stored by
+// value: callers receive copies and changes go through Update
+var deletionRequests = memstore.New[string, DataDeletionRequest]()
 
 // RequestDataDeletion submits a data deletion request (right to be forgotten)
 func (gm *GDPRManager) RequestDataDeletion(userID, reason string) (*DataDeletionRequest, error) {
@@ -165,13 +169,8 @@ func (gm *GDPRManager) RequestDataDeletion(userID, reason string) (*DataDeletion
 		return nil, fmt.Errorf("user_id is required")
 	}
 
-	// Check if already requested
-	if req, exists := deletionRequests[userID]; exists && req.Status != "cancelled" {
-		return nil, fmt.Errorf("deletion already requested")
-	}
-
 	now := time.Now()
-	request := &DataDeletionRequest{
+	request := DataDeletionRequest{
 		UserID:      userID,
 		RequestedAt: now,
 		ScheduledAt: now.Add(30 * 24 * time.Hour), // 30-day grace period
@@ -179,7 +178,13 @@ func (gm *GDPRManager) RequestDataDeletion(userID, reason string) (*DataDeletion
 		Reason:      reason,
 	}
 
-	deletionRequests[userID] = request
+	// Check if already requested: a cancelled request can be replaced
+	stored := deletionRequests.SetIfAbsent(userID, request, func(current DataDeletionRequest) bool {
+		return current.Status == "cancelled"
+	})
+	if !stored {
+		return nil, fmt.Errorf("deletion already requested")
+	}
 
 	// Audit log
 	gm.auditLogger.Log(AuditEvent{
@@ -194,22 +199,27 @@ func (gm *GDPRManager) RequestDataDeletion(userID, reason string) (*DataDeletion
 		},
 	})
 
-	return request, nil
+	return &request, nil
 }
 
 // CancelDataDeletion cancels a pending deletion request
 func (gm *GDPRManager) CancelDataDeletion(userID string) error {
-	req, exists := deletionRequests[userID]
-	if !exists {
-		return fmt.Errorf("no deletion request found")
-	}
-
-	if req.Status == "completed" {
-		return fmt.Errorf("deletion already completed")
+	var err error
+	deletionRequests.Update(userID, func(req DataDeletionRequest, exists bool) DataDeletionRequest {
+		switch {
+		case !exists:
+			err = fmt.Errorf("no deletion request found")
+		case req.Status == "completed":
+			err = fmt.Errorf("deletion already completed")
+		default:
+			req.Status = "cancelled"
+		}
+		return req
+	})
+	if err != nil {
+		return err
 	}
 
-	req.Status = "cancelled"
-
 	gm.auditLogger.Log(AuditEvent{
 		Timestamp: time.Now(),
 		UserID:    userID,
@@ -223,11 +233,11 @@ func (gm *GDPRManager) CancelDataDeletion(userID string) error {
 
 // GetDeletionRequest retrieves a deletion request
 func (gm *GDPRManager) GetDeletionRequest(userID string) (*DataDeletionRequest, error) {
-	req, exists := deletionRequests[userID]
+	req, exists := deletionRequests.Get(userID)
 	if !exists {
 		return nil, fmt.Errorf("no deletion request found")
 	}
-	return req, nil
+	return &req, nil
 }
 
 // ProcessScheduledDeletions processes all scheduled deletions that are due
@@ -235,10 +245,20 @@ func (gm *GDPRManager) ProcessScheduledDeletions() []string {
 	now := time.Now()
 	deleted := make([]string, 0)
 
-	for userID, req := range deletionRequests {
-		if req.Status == "scheduled" && now.After(req.ScheduledAt) {
-			// Mark as completed (actual deletion would happen here)
-			req.Status = "completed"
+	for userID, req := range deletionRequests.Snapshot() {
+		if req.Status != "scheduled" || !now.After(req.ScheduledAt) {
+			continue
+		}
+		// Mark as completed (actual deletion would happen here), unless it was cancelled meanwhile
+		completed := false
+		deletionRequests.Update(userID, func(current DataDeletionRequest, exists bool) DataDeletionRequest {
+			if exists && current.Status == "scheduled" {
+				current.Status = "completed"
+				completed = true
+			}
+			return current
+		})
+		if completed {
 			deleted = append(deleted, userID)
 
 			gm.auditLogger.Log(AuditEvent{
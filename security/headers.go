@@ -129,6 +129,7 @@ func DefaultCORSConfig() CORSConfig {
 			"Accept",
 			"Authorization",
 			"Content-Type",
+			"X-API-Key",
 			"X-CSRF-Token",
 			"X-Requested-With",
 		},
@@ -1,8 +1,15 @@
 package security
 
 import (
+	"context"
+	"io"
+	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -14,6 +21,17 @@ type RateLimiter struct {
 	buckets  map[string]*bucket
 	cleanup  time.Duration
 	stopChan chan struct{}
+	defaults RateLimitConfig // Limits for endpoints without a specific config
+
+	// Shared store for multi-instance deployments; nil keeps the buckets in memory
+	store          RateLimitStore
+	storeFailureAt time.Time
+}
+
+// RateLimitStore keeps the counters outside the process, so that all instances share the
+// same limits. Take consumes one request from the bucket identified by key
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, config RateLimitConfig) (allowed bool, remaining int, err error)
 }
 
 type bucket struct {
@@ -56,11 +74,25 @@ func NewRateLimiter() *RateLimiter {
 		buckets:  make(map[string]*bucket),
 		cleanup:  time.Minute * 5,
 		stopChan: make(chan struct{}),
+		defaults: defaultConfig,
 	}
 	go rl.cleanupLoop()
 	return rl
 }
 
+// SetDefaultLimit changes the limits applied to endpoints without a specific config.
+// It must be called before the limiter starts serving requests
+func (rl *RateLimiter) SetDefaultLimit(config RateLimitConfig) {
+	rl.defaults = config
+}
+
+// SetStore makes the limiter use a shared store such as Redis. When the store fails the
+// limiter falls back to the in-memory buckets of this instance.
+// It must be called before the limiter starts serving requests
+func (rl *RateLimiter) SetStore(store RateLimitStore) {
+	rl.store = store
+}
+
 func (rl *RateLimiter) cleanupLoop() {
 	ticker := time.NewTicker(rl.cleanup)
 	defer ticker.Stop()
@@ -116,7 +148,7 @@ func (rl *RateLimiter) getBucket(key string, config RateLimitConfig) *bucket {
 	return b
 }
 
-func (b *bucket) allow() bool {
+func (b *bucket) allow() (bool, int) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -129,9 +161,9 @@ func (b *bucket) allow() bool {
 
 	if b.tokens >= 1 {
 		b.tokens--
-		return true
+		return true, int(b.tokens)
 	}
-	return false
+	return false, 0
 }
 
 func min(a, b float64) float64 {
@@ -141,14 +173,34 @@ func min(a, b float64) float64 {
 	return b
 }
 
-// RateLimitMiddleware applies rate limiting per user and per endpoint
+// Allow consumes a token from the bucket identified by key, created with config on first
+// use. It is meant for limits that do not depend on the endpoint, such as per API key quotas
+func (rl *RateLimiter) Allow(key string, config RateLimitConfig) bool {
+	allowed, _ := rl.Take(context.Background(), key, config)
+	return allowed
+}
+
+// Take is like Allow, and also returns the requests left in the bucket
+func (rl *RateLimiter) Take(ctx context.Context, key string, config RateLimitConfig) (bool, int) {
+	if rl.store != nil {
+		allowed, remaining, err := rl.store.Take(ctx, key, config)
+		if err == nil {
+			return allowed, remaining
+		}
+		rl.mu.Lock()
+		if time.Since(rl.storeFailureAt) > time.Minute {
+			rl.storeFailureAt = time.Now()
+			log.Printf("⚠️ Rate limit store non disponibile, uso i limiti locali: %v", err)
+		}
+		rl.mu.Unlock()
+	}
+	return rl.getBucket(key, config).allow()
+}
+
+// RateLimitMiddleware applies rate limiting per client IP and per endpoint
 func (rl *RateLimiter) RateLimitMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Get user identifier (IP or user ID from JWT)
-		userID := r.Header.Get("X-User-ID")
-		if userID == "" {
-			userID = r.RemoteAddr
-		}
+		userID := ClientIP(r)
 
 		// Get endpoint pattern
 		route := mux.CurrentRoute(r)
@@ -163,41 +215,73 @@ func (rl *RateLimiter) RateLimitMiddleware(next http.Handler) http.Handler {
 		// Get config for this endpoint
 		config, exists := endpointConfigs[endpoint]
 		if !exists {
-			config = defaultConfig
+			config = rl.defaults
 		}
 
 		// Create unique key for user+endpoint
 		key := userID + ":" + endpoint
-		bucket := rl.getBucket(key, config)
+		allowed, remaining := rl.Take(r.Context(), key, config)
 
-		if !bucket.allow() {
-			w.Header().Set("X-RateLimit-Limit", formatFloat(config.RequestsPerSecond))
-			w.Header().Set("X-RateLimit-Remaining", "0")
-			w.Header().Set("Retry-After", "1")
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(config.BurstSize))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(RetryAfter(config)))
 			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 			return
 		}
 
-		bucket.mu.Lock()
-		remaining := int(bucket.tokens)
-		bucket.mu.Unlock()
-
-		w.Header().Set("X-RateLimit-Limit", formatFloat(config.RequestsPerSecond))
-		w.Header().Set("X-RateLimit-Remaining", formatInt(remaining))
-
 		next.ServeHTTP(w, r)
 	})
 }
 
-func formatFloat(f float64) string {
-	return formatInt(int(f))
+// RetryAfter returns the seconds after which a request is allowed again
+func RetryAfter(config RateLimitConfig) int {
+	if config.RequestsPerSecond <= 0 {
+		return 60
+	}
+	return int(1/config.RequestsPerSecond) + 1
 }
 
-func formatInt(i int) string {
-	return string(rune(i + '0'))
+// trustProxyHeaders enables X-Forwarded-For/X-Real-IP set by the reverse proxy in front of
+// the server; without a proxy those headers come from the client and are ignored
+var trustProxyHeaders atomic.Bool
+
+// SetTrustProxyHeaders sets whether ClientIP honors the headers of the reverse proxy
+func SetTrustProxyHeaders(trust bool) {
+	trustProxyHeaders.Store(trust)
+}
+
+// ClientIP returns the client address without the port. Behind a trusted proxy it is the
+// last X-Forwarded-For entry, the one appended by the proxy (the earlier ones are sent by
+// the client and can be forged), or X-Real-IP; otherwise the address of the connection
+func ClientIP(r *http.Request) string {
+	if trustProxyHeaders.Load() {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			if i := strings.LastIndexByte(xff, ','); i >= 0 {
+				xff = xff[i+1:]
+			}
+			if ip := strings.TrimSpace(xff); ip != "" {
+				return ip
+			}
+		}
+		if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+			return xri
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
 }
 
 // Stop stops the rate limiter cleanup goroutine
 func (rl *RateLimiter) Stop() {
 	close(rl.stopChan)
+	if closer, ok := rl.store.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+func formatInt(i int) string {
+	return strconv.Itoa(i)
 }
@@ -0,0 +1,52 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisWindowScript counts the requests of the current window and starts the window on the
+// first one, atomically
+var redisWindowScript = redis.NewScript(`local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return n`)
+
+// RedisRateLimitStore shares the rate limits of all instances through Redis. A bucket of
+// BurstSize requests refilled at RequestsPerSecond becomes a window of BurstSize requests
+// lasting BurstSize/RequestsPerSecond seconds
+type RedisRateLimitStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisRateLimitStore creates the store for a URL such as redis://localhost:6379/0
+func NewRedisRateLimitStore(url string) (*RedisRateLimitStore, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	return &RedisRateLimitStore{client: redis.NewClient(options), prefix: "qr-menu:ratelimit:"}, nil
+}
+
+// Take implements RateLimitStore
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, config RateLimitConfig) (bool, int, error) {
+	window := 1000.0
+	if config.RequestsPerSecond > 0 {
+		window = math.Max(window, math.Ceil(float64(config.BurstSize)/config.RequestsPerSecond*1000))
+	}
+
+	count, err := redisWindowScript.Run(ctx, s.client, []string{s.prefix + key}, int64(window)).Int64()
+	if err != nil {
+		return false, 0, err
+	}
+	remaining := config.BurstSize - int(count)
+	return remaining >= 0, max(remaining, 0), nil
+}
+
+// Close closes the connections to Redis
+func (s *RedisRateLimitStore) Close() error {
+	return s.client.Close()
+}
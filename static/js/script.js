@@ -15,12 +15,19 @@ class MenuAPI {
         }
     }
 
+    // Token CSRF pubblicato dalla pagina in <meta name="csrf-token">
+    static csrfToken() {
+        const meta = document.querySelector('meta[name="csrf-token"]');
+        return meta ? meta.content : '';
+    }
+
     static async post(url, data) {
         try {
             const response = await fetch(url, {
                 method: 'POST',
                 headers: {
                     'Content-Type': 'application/json',
+                    'X-CSRF-Token': MenuAPI.csrfToken(),
                 },
                 body: JSON.stringify(data)
             });
@@ -1,14 +1,11 @@
 // Service Worker per QR Menu PWA
-const CACHE_VERSION = 'v1.0.0';
+const CACHE_VERSION = 'v1.1.0';
 const CACHE_NAME = 'qr-menu-' + CACHE_VERSION;
+// Solo risorse esistenti: se una manca cache.addAll fallisce e il worker non si installa
 const urlsToCache = [
-  '/',
-  '/login',
-  '/admin',
-  '/static/style.css',
-  '/static/script.js',
-  '/static/offline.html',
-  '/manifest.json'
+  '/static/css/style.css',
+  '/static/js/script.js',
+  '/static/manifest.json'
 ];
 
 // Install event
@@ -188,6 +185,40 @@ function openIndexedDB() {
   });
 }
 
+// Notifiche Web Push inviate dal server (payload cifrato: {title, body, data})
+self.addEventListener('push', event => {
+  let payload = {};
+  try {
+    payload = event.data ? event.data.json() : {};
+  } catch (error) {
+    payload = { body: event.data ? event.data.text() : '' };
+  }
+
+  event.waitUntil(
+    self.registration.showNotification(payload.title || 'QR Menu', {
+      body: payload.body || '',
+      data: payload.data || {},
+      tag: payload.data && payload.data.key,
+      icon: '/static/icon-192x192.png'
+    })
+  );
+});
+
+// Click sulla notifica: riporta alla dashboard, riusando una scheda già aperta
+self.addEventListener('notificationclick', event => {
+  event.notification.close();
+  event.waitUntil(
+    self.clients.matchAll({ type: 'window', includeUncontrolled: true }).then(windows => {
+      for (const client of windows) {
+        if (new URL(client.url).pathname.startsWith('/admin') && 'focus' in client) {
+          return client.focus();
+        }
+      }
+      return self.clients.openWindow('/admin');
+    })
+  );
+});
+
 // Message from client
 self.addEventListener('message', event => {
   if (event.data && event.data.type === 'SKIP_WAITING') {
@@ -14,11 +14,11 @@ var Templates *template.Template
 
 func InitTemplates() {
 	var err error
-	Templates, err = template.ParseFS(templateFS, "templates/*.html")
+	Templates, err = template.New("").Funcs(handlers.TemplateFuncs()).ParseFS(templateFS, "templates/*.html")
 	if err != nil {
 		log.Printf("❌ Errore caricamento embedded templates: %v", err)
 		// Fallback a filesystem locale
-		Templates, err = template.ParseGlob("templates/*.html")
+		Templates, err = template.New("").Funcs(handlers.TemplateFuncs()).ParseGlob("templates/*.html")
 		if err != nil {
 			log.Printf("❌ Errore caricamento templates da filesystem: %v", err)
 			Templates = nil